@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// checkKeyOrigin is a middleware which denies requests from browsers on origins the API key used hasn't been allowed
+// for.  Requests without an Origin header aren't coming from a browser based application, so they're not restricted
+func checkKeyOrigin(c *gin.Context) {
+	key := c.MustGet("key").(database.APIKey)
+	origin := c.GetHeader("Origin")
+	if origin == "" || len(key.AllowedOrigins) == 0 {
+		return
+	}
+	if !originAllowed(origin, key.AllowedOrigins) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "The API key provided can't be used from this origin",
+		})
+		c.Abort()
+		return
+	}
+}
+
+// corsHandler returns the middleware which handles cross-origin requests, including preflight requests, using the
+// allowed origins and headers from the configuration file.  When no origins are configured, all origins are allowed
+func corsHandler() (gin.HandlerFunc, error) {
+	corsConfig := cors.Config{
+		// Allow common REST methods
+		AllowMethods: []string{"GET", "POST", "PATCH", "DELETE"},
+
+		AllowHeaders: config.Conf.Api.CorsAllowedHeaders,
+		MaxAge:       config.Conf.Api.CorsMaxAge * time.Second,
+
+		// Let browser based applications see the headers used for conditional and range requests
+		ExposeHeaders: []string{"Accept-Ranges", "Content-Range", "ETag"},
+	}
+	if len(config.Conf.Api.CorsAllowedOrigins) == 0 {
+		// Allow all origins but avoid using the "*" specifier which would disallow sending credentials
+		corsConfig.AllowOriginFunc = func(origin string) bool { return true }
+	} else {
+		for _, o := range config.Conf.Api.CorsAllowedOrigins {
+			if err := com.ValidateOrigin(o); err != nil {
+				return nil, err
+			}
+		}
+
+		// The web UI always needs to be able to call the API
+		origins := append([]string{"https://" + config.Conf.Web.ServerName}, config.Conf.Api.CorsAllowedOrigins...)
+		corsConfig.AllowOriginFunc = func(origin string) bool {
+			return originAllowed(origin, origins)
+		}
+	}
+	return cors.New(corsConfig), nil
+}
+
+// originAllowed checks whether an origin is in a list of allowed origins.  Allowed origins with a host starting with
+// "*." match all subdomains of the rest of the host, eg "https://*.example.org" matches "https://app.example.org"
+func originAllowed(origin string, allowed []string) bool {
+	origin = strings.ToLower(origin)
+	for _, a := range allowed {
+		a = strings.ToLower(a)
+		if a == origin {
+			return true
+		}
+		scheme, host, found := strings.Cut(a, "://*.")
+		if found && strings.HasPrefix(origin, scheme+"://") && strings.HasSuffix(origin, "."+host) {
+			return true
+		}
+	}
+	return false
+}
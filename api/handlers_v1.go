@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -8,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	sqlite "github.com/gwenn/gosqlite"
@@ -26,6 +28,16 @@ type APIJSONColumn struct {
 	Pk        int    `json:"primary_key"`
 }
 
+// databaseListOrders are the sort orders which can be requested for lists of databases
+var databaseListOrders = map[string]database.DBOrder{
+	"created":   database.DBOrderCreated,
+	"downloads": database.DBOrderDownloads,
+	"modified":  database.DBOrderModified,
+	"pinned":    database.DBOrderPinned,
+	"size":      database.DBOrderSize,
+	"stars":     database.DBOrderStars,
+}
+
 // collectInfo is an internal function which xtracts the database owner, name, and commit ID from the request
 // and checks the permissions
 func collectInfo(c *gin.Context) (loggedInUser, dbOwner, dbName, commitID string, httpStatus int, err error) {
@@ -166,7 +178,13 @@ func columnsHandler(c *gin.Context) {
 	var cols []sqlite.Column
 	if !isLive {
 		// Get Minio bucket and object id for the SQLite file
-		bucket, id, _, err := com.MinioLocation(dbOwner, dbName, "", loggedInUser)
+		bucket, id, err := com.SQLiteLocation(dbOwner, dbName, "", loggedInUser)
+		if errors.Is(err, com.ErrClientEncrypted) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
@@ -226,6 +244,9 @@ func columnsHandler(c *gin.Context) {
 	} else {
 		// Send the columns request to our job queue backend
 		cols, _, err = com.LiveColumns(liveNode, loggedInUser, dbOwner, dbName, table)
+		if jobQueueFull(c, err) {
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error": err.Error(),
@@ -300,11 +321,19 @@ func commitsHandler(c *gin.Context) {
 // databasesHandler returns the list of databases in the requesting users account.
 // If the new (optional) "live" boolean text field is set to true, then it will return the list of live
 // databases.  Otherwise, it will return the list of standard databases.
+// If the (optional) "verified" boolean text field is set to true, then only the databases verified by the instance
+// admins are returned.
+// The list can be sorted with the (optional) "sort" field, and narrowed down to the databases using a licence or
+// having releases.
 // This can be run from the command line using curl, like this:
 //
 //	$ curl -F apikey="YOUR_API_KEY_HERE" -F live="true" https://api.dbhub.io/v1/databases
 //	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
-//	* "live" is whether to show Live databases, or standard ones
+//	* "live" is an (optional) boolean, whether to show Live databases, or standard ones
+//	* "verified" is an (optional) boolean, whether to only show verified databases
+//	* "sort" is the (optional) order of the list.  One of "modified" (the default), "created", "downloads", "pinned", "size", or "stars"
+//	* "licence" is the (optional) short name of a licence, eg "CC0".  Only databases using it are shown
+//	* "releases" is an (optional) boolean, whether to only show databases with releases
 func databasesHandler(c *gin.Context) {
 	loggedInUser := c.MustGet("user").(string)
 
@@ -317,11 +346,53 @@ func databasesHandler(c *gin.Context) {
 		return
 	}
 
+	// Get the (optional) "verified" boolean value
+	verifiedOnly := false
+	if v := c.PostForm("verified"); v != "" {
+		verifiedOnly, err = strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid value for verified",
+			})
+			return
+		}
+	}
+
+	// Get the (optional) sort order and filters
+	order := database.DBOrderModified
+	if o := c.PostForm("sort"); o != "" {
+		var ok bool
+		order, ok = databaseListOrders[o]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Unknown sort order requested",
+			})
+			return
+		}
+	}
+	var filter database.DBFilter
+	filter.Licence, err = com.GetFormLicence(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid licence name",
+		})
+		return
+	}
+	if r := c.PostForm("releases"); r != "" {
+		filter.HasReleases, err = strconv.ParseBool(r)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid value for releases",
+			})
+			return
+		}
+	}
+
 	// Retrieve the list of databases in the user account
 	var databases []database.DBInfo
 	if !live {
 		// Get the list of standard databases
-		databases, err = database.UserDBs(loggedInUser, database.DB_BOTH)
+		databases, err = database.UserDBs(loggedInUser, database.DB_BOTH, order, filter)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
@@ -330,7 +401,7 @@ func databasesHandler(c *gin.Context) {
 		}
 	} else {
 		// Get the list of live databases
-		databases, err = com.LiveUserDBs(loggedInUser, database.DB_BOTH)
+		databases, err = com.LiveUserDBs(loggedInUser, database.DB_BOTH, order, filter)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
@@ -342,6 +413,9 @@ func databasesHandler(c *gin.Context) {
 	// Extract just the database names
 	var list []string
 	for _, j := range databases {
+		if verifiedOnly && !j.Verified {
+			continue
+		}
 		list = append(list, j.Database)
 	}
 
@@ -387,21 +461,36 @@ func deleteHandler(c *gin.Context) {
 		return
 	}
 
+	// Delete the database
+	if !removeDatabase(c, dbOwner, dbName) {
+		return
+	}
+
+	// Return a "success" message
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// removeDatabase deletes a database, including removing a live database from its node.  The database owner is used
+// for the calls needing a user, so instance admins can remove databases too.  When it fails an error is returned to the
+// caller, and false is returned
+func removeDatabase(c *gin.Context, dbOwner, dbName string) bool {
 	// For a standard database, invalidate its memcache data
 	isLive, liveNode, err := database.CheckDBLive(dbOwner, dbName)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error": err.Error(),
 		})
-		return
+		return false
 	}
 	if !isLive {
-		err = com.InvalidateCacheEntry(loggedInUser, dbOwner, dbName, "") // Empty string indicates "for all versions"
+		err = com.InvalidateCacheEntry(dbOwner, dbOwner, dbName, "") // Empty string indicates "for all versions"
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
 			})
-			return
+			return false
 		}
 	}
 
@@ -409,12 +498,12 @@ func deleteHandler(c *gin.Context) {
 	var bucket, id string
 	if isLive {
 		// Get the Minio bucket and object names for this database
-		bucket, id, err = com.LiveGetMinioNames(loggedInUser, dbOwner, dbName)
+		bucket, id, err = com.LiveGetMinioNames(dbOwner, dbOwner, dbName)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
 			})
-			return
+			return false
 		}
 
 		// Delete the database from Minio
@@ -423,16 +512,19 @@ func deleteHandler(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
 			})
-			return
+			return false
 		}
 
 		// Delete the database from our job queue backend
-		err = com.LiveDelete(liveNode, loggedInUser, dbOwner, dbName)
+		err = com.LiveDelete(liveNode, dbOwner, dbOwner, dbName)
+		if jobQueueFull(c, err) {
+			return false
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
 			})
-			return
+			return false
 		}
 	}
 
@@ -442,13 +534,10 @@ func deleteHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": err.Error(),
 		})
-		return
+		return false
 	}
 
-	// Return a "success" message
-	c.JSON(200, gin.H{
-		"status": "OK",
-	})
+	return true
 }
 
 // diffHandler generates a diff between two databases or two versions of a database
@@ -660,6 +749,8 @@ func diffHandler(c *gin.Context) {
 //	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
 //	* "dbowner" is the owner of the database
 //	* "dbname" is the name of the database
+//	* "tables" is an (optional) JSON array of table names.  When given, a copy of the database holding only those tables
+//	  (along with their indexes and triggers) is returned instead.  Only standard databases can be downloaded this way
 func downloadHandler(c *gin.Context) {
 	// Authenticate user and collect requested database details
 	loggedInUser, dbOwner, dbName, commitID, httpStatus, err := collectInfo(c)
@@ -670,6 +761,25 @@ func downloadHandler(c *gin.Context) {
 		return
 	}
 
+	// Return just some of the tables, if that's what was asked for
+	tables, err := com.GetFormTables(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if len(tables) > 0 {
+		_, httpStatus, err = com.DownloadPartialDatabase(c.Writer, c.Request, dbOwner, dbName, commitID, loggedInUser,
+			"api", tables)
+		if err != nil {
+			c.JSON(httpStatus, gin.H{
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+
 	// Return the requested database to the user
 	_, err = com.DownloadDatabase(c.Writer, c.Request, dbOwner, dbName, commitID, loggedInUser, "api")
 	if err != nil {
@@ -691,6 +801,8 @@ func downloadHandler(c *gin.Context) {
 //	* "dbowner" is the owner of the database
 //	* "dbname" is the name of the database
 //	* "sql" is the SQL query to execute, base64 encoded
+//	* "params" is an (optional) JSON array of values for the "?" parameters of the query, or a JSON object of values for
+//	  its named parameters
 //	NOTE that the above example (base64) encoded sql is: "UPDATE table1 SET Name = 'Testing 1' WHERE id = 1"
 func executeHandler(c *gin.Context) {
 	// Note - This code is useful for very specific debugging of incoming POST data, so there's no need to leave it uncommented at all times
@@ -736,6 +848,19 @@ func executeHandler(c *gin.Context) {
 		return
 	}
 
+	// Grab the (optional) parameter values for the query
+	var params *com.QueryParams
+	if z := c.PostForm("params"); z != "" {
+		p, err := com.ParseQueryParams(z)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		params = &p
+	}
+
 	// Check if the requested database exists
 	exists, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, false)
 	if err != nil {
@@ -778,7 +903,33 @@ func executeHandler(c *gin.Context) {
 	}
 
 	// Send the SQL execution request to our job queue backend
-	rowsChanged, err := com.LiveExecute(liveNode, loggedInUser, dbOwner, dbName, sql)
+	var rowsChanged int
+	if params != nil {
+		rowsChanged, err = com.LiveExecuteParams(liveNode, loggedInUser, dbOwner, dbName, sql, *params)
+	} else {
+		rowsChanged, err = com.LiveExecute(liveNode, loggedInUser, dbOwner, dbName, sql)
+	}
+	if jobQueueFull(c, err) {
+		return
+	}
+	if errors.Is(err, database.ErrDBArchived) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, com.ErrTransactionInProgress) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if errors.Is(err, com.ErrQueryLimit) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		log.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -831,7 +982,13 @@ func indexesHandler(c *gin.Context) {
 	var indexes []com.APIJSONIndex
 	if !isLive {
 		// Get Minio bucket and object id for the SQLite file
-		bucket, id, _, err := com.MinioLocation(dbOwner, dbName, "", loggedInUser)
+		bucket, id, err := com.SQLiteLocation(dbOwner, dbName, "", loggedInUser)
+		if errors.Is(err, com.ErrClientEncrypted) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
@@ -894,6 +1051,9 @@ func indexesHandler(c *gin.Context) {
 	} else {
 		// Send the indexes request to our job queue backend
 		indexes, err = com.LiveIndexes(liveNode, loggedInUser, dbOwner, dbName)
+		if jobQueueFull(c, err) {
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
@@ -947,6 +1107,18 @@ func metadataHandler(c *gin.Context) {
 		return
 	}
 
+	// If the client already has the current metadata there's no need to send it again
+	etag, lastModified, err := com.MetadataValidators(meta)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if com.NotModified(c.Writer, c.Request, etag, lastModified) {
+		return
+	}
+
 	// Return the list as JSON
 	c.JSON(200, meta)
 }
@@ -961,6 +1133,12 @@ func metadataHandler(c *gin.Context) {
 //	* "dbowner" is the owner of the database
 //	* "dbname" is the name of the database
 //	* "sql" is the SQL query to run, base64 encoded
+//	* "format" is the (optional) layout of the returned data.  Either "rows" (the default) or "columnar"
+//	* "params" is an (optional) JSON array of values for the "?" parameters of the query, or a JSON object of values for
+//	  its named parameters.  Only live databases accept parameter values
+//	* "previews" is an (optional) boolean string ("true", "false"), for whether BLOB values holding images or SpatiaLite
+//	  geometries should have previews added.  Images get a thumbnail, and geometries are converted to GeoJSON.  Only
+//	  used with the "rows" format.  Defaults to false
 func queryHandler(c *gin.Context) {
 	loggedInUser := c.MustGet("user").(string)
 
@@ -987,6 +1165,38 @@ func queryHandler(c *gin.Context) {
 		return
 	}
 
+	// Grab the (optional) parameter values for the query
+	var params *com.QueryParams
+	if z := c.PostForm("params"); z != "" {
+		p, err := com.ParseQueryParams(z)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		params = &p
+	}
+
+	// Check the requested output format
+	format := c.PostForm("format")
+	if format != "" && format != "rows" && format != "columnar" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Unknown output format requested",
+		})
+		return
+	}
+	previews := false
+	if z := c.PostForm("previews"); z != "" {
+		previews, err = strconv.ParseBool(z)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid previews value",
+			})
+			return
+		}
+	}
+
 	// Check if the requested database exists
 	exists, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, false)
 	if err != nil {
@@ -1020,6 +1230,14 @@ func queryHandler(c *gin.Context) {
 		return
 	}
 
+	// Parameter values are bound by the live nodes, so standard databases don't accept them
+	if !isLive && params != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Parameter values can only be given for queries on live databases",
+		})
+		return
+	}
+
 	// Run the query
 	var data com.SQLiteRecordSet
 	if !isLive {
@@ -1033,7 +1251,20 @@ func queryHandler(c *gin.Context) {
 		}
 	} else {
 		// Send the query to the appropriate backend live node
-		data, err = com.LiveQuery(liveNode, loggedInUser, dbOwner, dbName, query)
+		if params != nil {
+			data, err = com.LiveQueryParams(liveNode, loggedInUser, dbOwner, dbName, query, *params)
+		} else {
+			data, err = com.LiveQuery(liveNode, loggedInUser, dbOwner, dbName, query)
+		}
+		if jobQueueFull(c, err) {
+			return
+		}
+		if errors.Is(err, com.ErrQueryLimit) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
 		if err != nil {
 			log.Println(err)
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -1044,6 +1275,13 @@ func queryHandler(c *gin.Context) {
 	}
 
 	// Return the results
+	if format == "columnar" {
+		c.JSON(200, com.ColumnarResponse(data))
+		return
+	}
+	if previews {
+		com.AddCellPreviews(&data)
+	}
 	c.JSON(200, data.Records)
 }
 
@@ -1131,7 +1369,13 @@ func tablesHandler(c *gin.Context) {
 	var tables []string
 	if !isLive {
 		// Get Minio bucket and object id for the SQLite file
-		bucket, id, _, err := com.MinioLocation(dbOwner, dbName, "", loggedInUser)
+		bucket, id, err := com.SQLiteLocation(dbOwner, dbName, "", loggedInUser)
+		if errors.Is(err, com.ErrClientEncrypted) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
@@ -1170,6 +1414,9 @@ func tablesHandler(c *gin.Context) {
 	} else {
 		// Send the tables request to our job queue backend
 		tables, err = com.LiveTables(liveNode, loggedInUser, dbOwner, dbName)
+		if jobQueueFull(c, err) {
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
@@ -1236,18 +1483,19 @@ func tagsHandler(c *gin.Context) {
 //	    -F "lastmodified=2017-01-02T03:04:05Z"  -F "licence=CC0"  -F "public=true" \
 //	    -F "commit=51d494f2c5eb6734ddaa204eccb9597b426091c79c951924ac83c72038f22b55" https://api.dbhub.io/v1/upload
 //	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
-//	* "dbname" is the name of the database being created
+//	* "dbname" (optional) is the name of the database being created.  Defaults to the name of the uploaded file
 //	* "file" is the database file to upload
+//	* "encrypted" (optional) is a boolean string ("true", "false") indicating whether the database file was encrypted
+//	   before uploading.  Encrypted databases are stored and downloaded as is, but can't be queried
 //	* "branch" (optional) is the database branch this commit is for.  Uses the default database branch if not specified
 //	* "commitmsg" (optional) is a message to include with the commit.  Often a description of the changes in the new data
 //	* "sourceurl" (optional) is the URL to the reference source of the data
 //	* "lastmodified" (optional) is a datestamp in RFC3339 format
 //	* "licence" (optional) is an identifier for a license that's "in the system"
 //	* "live" (optional) is a boolean string ("true", "false") indicating whether this upload is a live database
-//	* "public" (optional) is whether the database should be public.  True means "public", false means "not public"
-//	* "commit" (ignored for new databases, required for existing ones) is the commit ID this new database revision
-//	   should be appended to.  For new databases it's not needed, but for existing databases it's required (it's used to
-//	   detect out of date / conflicting uploads)
+//	* "public" (optional) is a boolean, whether the database should be public.  True means "public", false means "not public"
+//	* "commit" (optional) is the commit ID this new database revision should be appended to.  For new databases it's
+//	   ignored, but for existing databases it's required (it's used to detect out of date / conflicting uploads)
 func uploadHandler(c *gin.Context) {
 	loggedInUser := c.MustGet("user").(string)
 
@@ -1297,6 +1545,23 @@ func uploadHandler(c *gin.Context) {
 		return
 	}
 
+	// Live databases are queried by the server, so they can't be encrypted with a key it doesn't have
+	if live {
+		clientEncrypted, err := com.GetFormEncrypted(c.Request)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if clientEncrypted {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Live databases can't be encrypted before uploading",
+			})
+			return
+		}
+	}
+
 	// Process the upload
 	var httpStatus int
 	var x map[string]string
@@ -1380,7 +1645,7 @@ func uploadHandler(c *gin.Context) {
 		defer src.Close()
 
 		// Write the incoming database to a temporary file on disk, and sanity check it
-		numBytes, tempDB, _, _, err := com.WriteDBtoDisk(loggedInUser, dbOwner, dbName, src)
+		numBytes, tempDB, _, _, err := com.WriteDBtoDisk(loggedInUser, dbOwner, dbName, src, false)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
@@ -1421,6 +1686,9 @@ func uploadHandler(c *gin.Context) {
 
 		// Send a request to the job queue to set up the database
 		liveNode, err := com.LiveCreateDB(dbOwner, dbName, objectID)
+		if jobQueueFull(c, err) {
+			return
+		}
 		if err != nil {
 			log.Println(err)
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -1515,7 +1783,13 @@ func viewsHandler(c *gin.Context) {
 	var views []string
 	if !isLive {
 		// Get Minio bucket and object id for the SQLite file
-		bucket, id, _, err := com.MinioLocation(dbOwner, dbName, "", loggedInUser)
+		bucket, id, err := com.SQLiteLocation(dbOwner, dbName, "", loggedInUser)
+		if errors.Is(err, com.ErrClientEncrypted) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
@@ -1554,6 +1828,9 @@ func viewsHandler(c *gin.Context) {
 	} else {
 		// Send the views request to our job queue backend
 		views, err = com.LiveViews(liveNode, loggedInUser, dbOwner, dbName)
+		if jobQueueFull(c, err) {
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
@@ -2,6 +2,7 @@ package main
 
 import (
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -12,7 +13,6 @@ import (
 	"time"
 
 	gsm "github.com/bradleypeabody/gorilla-sessions-memcache"
-	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/gzip"
 	"github.com/gin-gonic/gin"
 	com "github.com/sqlitebrowser/dbhub.io/common"
@@ -46,8 +46,8 @@ func main() {
 	defer reqLog.Close()
 	log.Printf("%s: request log opened: %s", config.Conf.Live.Nodename, config.Conf.Api.RequestLog)
 
-	// Connect to Minio server
-	err = com.ConnectMinio()
+	// Connect to the storage backend
+	err = com.ConnectBlobStore()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -65,7 +65,7 @@ func main() {
 	}
 
 	// Setup session storage
-	sessionStore := gsm.NewMemcacheStore(com.MemcacheHandle(), "dbhub_", []byte(config.Conf.Web.SessionStorePassword))
+	sessionStore := gsm.NewMemcacherStore(com.SessionCache{}, "dbhub_", []byte(config.Conf.Web.SessionStorePassword))
 
 	// Start background goroutines to handle job queue responses
 	com.ResponseQueue = com.NewResponseQueue()
@@ -74,6 +74,9 @@ func main() {
 	go com.ResponseQueueCheck()
 	go com.ResponseQueueListen()
 
+	// Start background goroutine to keep the read only mode up to date
+	go com.MaintenanceLoop()
+
 	// Start background signal handler
 	exitSignal := make(chan struct{}, 1)
 	go com.SignalHandler(&exitSignal)
@@ -118,20 +121,26 @@ func main() {
 		TLSNextProto:   make(map[string]func(*http.Server, *tls.Conn, http.Handler), 0),
 	}
 
-	// Add gzip middleware
-	router.Use(gzip.Gzip(gzip.DefaultCompression))
-
-	// Add CORS middlewares. These allow all origins but only allow sending credentials for the DBHub.io web UI.
-	// For this we are using two middlewares here. The first one does the majority of the CORS handling but does
-	// not support setting the allow credentials header depending on the provided origin header. Because of this
-	// the second one is just adding that header if required.
-	router.Use(cors.New(cors.Config{
-		// Allow all origins but avoid using the "*" specifier which would disallow sending credentials
-		AllowOriginFunc: func(origin string) bool { return true },
+	// Add gzip middleware.  The events endpoint is excluded, as compression would buffer its event stream.  Range
+	// requests and the pages end points are excluded too, as their ranges refer to the uncompressed bytes
+	gz := gzip.Gzip(gzip.DefaultCompression, gzip.WithExcludedPaths([]string{"/v1/events"}),
+		gzip.WithExcludedPathsRegexs([]string{"^(/v2)?/pages/"}))
+	router.Use(func(c *gin.Context) {
+		if c.GetHeader("Range") == "" {
+			gz(c)
+		}
+	})
 
-		// Allow common REST methods
-		AllowMethods: []string{"GET", "POST", "PATCH", "DELETE"},
-	}))
+	// Add CORS middlewares. By default these allow all origins, but the allowed origins and headers can be set in the
+	// configuration file. Sending credentials is only allowed for the DBHub.io web UI.
+	// For this we are using two middlewares here. The first one does the majority of the CORS handling, including
+	// answering preflight requests, but does not support setting the allow credentials header depending on the
+	// provided origin header. Because of this the second one is just adding that header if required.
+	corsMiddleware, err := corsHandler()
+	if err != nil {
+		log.Fatalf("Invalid CORS configuration: %s", err)
+	}
+	router.Use(corsMiddleware)
 
 	router.Use(func(c *gin.Context) {
 		origin := c.Request.Header.Get("Origin")
@@ -149,45 +158,215 @@ func main() {
 	router.Delims("[[", "]]")
 	router.LoadHTMLGlob(filepath.Join(config.Conf.Web.BaseDir, "api", "templates", "*.html"))
 
-	// Register API v1 handlers. There is three middlewares which apply to all of them:
+	// Register API v1 handlers. There is four middlewares which apply to all of them:
 	// 1) authentication is required
 	// 2) usage limits are applied; because these are applied per user this needs to happen after authentication
 	// 3) authenticated and permitted calls are logged
-	v1 := router.Group("/v1", authenticateV1, limit, callLog)
+	// 4) calls from browsers are only allowed on the origins the API key is restricted to (if any)
+	v1 := router.Group("/v1", authenticateV1, limit, callLog, checkKeyOrigin)
 	{
+		v1.POST("/abusereport", authRequireWritePermission, abuseReportHandler)
+		v1.POST("/alerthistory", alertHistoryHandler)
+		v1.POST("/alertruledelete", authRequireWritePermission, alertRuleDeleteHandler)
+		v1.POST("/alertrules", alertRulesHandler)
+		v1.POST("/alertrulesave", authRequireWritePermission, alertRuleSaveHandler)
+		v1.POST("/analytics", analyticsHandler)
+		v1.POST("/apicalls", apiCallsHandler)
+		v1.POST("/apikeyusage", apiKeyUsageHandler)
+		v1.POST("/archive", authRequireWritePermission, archiveHandler)
+		v1.POST("/autoversion", autoVersionHandler)
+		v1.POST("/autoversionremove", authRequireWritePermission, autoVersionRemoveHandler)
+		v1.POST("/autoversionset", authRequireWritePermission, autoVersionSetHandler)
+		v1.POST("/blob", blobHandler)
+		v1.POST("/block", authRequireWritePermission, blockHandler)
+		v1.POST("/blocks", blocksHandler)
 		v1.POST("/branches", branchesHandler)
+		v1.POST("/branchesdelete", authRequireWritePermission, branchesDeleteHandler)
+		v1.POST("/bulkdelete", authRequireWritePermission, bulkDeleteHandler)
+		v1.POST("/bulkinsert", authRequireWritePermission, bulkInsertHandler)
+		v1.POST("/bulkupsert", authRequireWritePermission, bulkUpsertHandler)
+		v1.POST("/citation", citationHandler)
+		v1.POST("/ckan", ckanHandler)
+		v1.POST("/ckanharvest", authRequireWritePermission, ckanHarvestHandler)
+		v1.POST("/ckanremove", authRequireWritePermission, ckanRemoveHandler)
+		v1.POST("/ckanset", authRequireWritePermission, ckanSetHandler)
+		v1.POST("/collection", collectionHandler)
+		v1.POST("/collectionadd", authRequireWritePermission, collectionAddHandler)
+		v1.POST("/collectiondelete", authRequireWritePermission, collectionDeleteHandler)
+		v1.POST("/collectionremove", authRequireWritePermission, collectionRemoveHandler)
+		v1.POST("/collections", collectionsHandler)
+		v1.POST("/collectionsave", authRequireWritePermission, collectionSaveHandler)
+		v1.POST("/collectionstar", authRequireWritePermission, collectionStarHandler)
 		v1.POST("/columns", columnsHandler)
 		v1.POST("/commits", commitsHandler)
+		v1.POST("/commitsearch", commitSearchHandler)
+		v1.POST("/commitstatus", authRequireWritePermission, commitStatusHandler)
+		v1.POST("/commitstatuses", commitStatusesHandler)
+		v1.POST("/contributions", contributionsHandler)
 		v1.POST("/databases", databasesHandler)
+		v1.POST("/datacomment", authRequireWritePermission, dataCommentHandler)
+		v1.POST("/datacommentreply", authRequireWritePermission, dataCommentReplyHandler)
+		v1.POST("/datacommentresolve", authRequireWritePermission, dataCommentResolveHandler)
+		v1.POST("/datacomments", dataCommentsHandler)
+		v1.POST("/datapackage", dataPackageHandler)
+		v1.POST("/datapackageimport", authRequireWritePermission, dataPackageImportHandler)
 		v1.POST("/delete", authRequireWritePermission, deleteHandler)
 		v1.POST("/diff", diffHandler)
+		v1.POST("/discussionassign", authRequireWritePermission, discussionAssignHandler)
+		v1.POST("/discussionlabels", authRequireWritePermission, discussionLabelsHandler)
+		v1.POST("/discussionmilestone", authRequireWritePermission, discussionMilestoneHandler)
+		v1.POST("/discussions", discussionsHandler)
 		v1.POST("/download", downloadHandler)
+		v1.POST("/events", eventsHandler)
 		v1.POST("/execute", authRequireWritePermission, executeHandler)
+		v1.POST("/explain", explainHandler)
+		v1.POST("/ftscreate", authRequireWritePermission, ftsCreateHandler)
+		v1.POST("/ftsdrop", authRequireWritePermission, ftsDropHandler)
+		v1.POST("/healthreport", healthReportHandler)
+		v1.POST("/heldcontent", heldContentHandler)
+		v1.POST("/heldcontentaction", authRequireWritePermission, heldContentActionHandler)
+		v1.POST("/indexadvisor", indexAdvisorHandler)
 		v1.POST("/indexes", indexesHandler)
+		v1.POST("/invitationcreate", authRequireWritePermission, invitationCreateHandler)
+		v1.POST("/invitationrevoke", authRequireWritePermission, invitationRevokeHandler)
+		v1.POST("/invitations", invitationsHandler)
+		v1.POST("/jobqueue", jobQueueHandler)
+		v1.POST("/labeldelete", authRequireWritePermission, labelDeleteHandler)
+		v1.POST("/labels", labelsHandler)
+		v1.POST("/labelsave", authRequireWritePermission, labelSaveHandler)
+		v1.POST("/licence", licenceHandler)
+		v1.POST("/licenceadd", authRequireWritePermission, licenceAddHandler)
+		v1.POST("/licencedelete", authRequireWritePermission, licenceDeleteHandler)
+		v1.POST("/licencehistory", licenceHistoryHandler)
+		v1.POST("/licences", licencesHandler)
+		v1.POST("/licenceset", authRequireWritePermission, licenceSetHandler)
+		v1.POST("/lineage", lineageHandler)
+		v1.POST("/lineageadd", authRequireWritePermission, lineageAddHandler)
+		v1.POST("/lineageremove", authRequireWritePermission, lineageRemoveHandler)
+		v1.POST("/livenodes", liveNodesHandler)
+		v1.POST("/livenodestate", authRequireWritePermission, liveNodeStateHandler)
+		v1.POST("/liveplacements", livePlacementsHandler)
+		v1.POST("/maintenance", maintenanceHandler)
+		v1.POST("/maintenanceset", maintenanceSetHandler)
+		v1.POST("/mergerequestreview", authRequireWritePermission, mergeRequestReviewHandler)
+		v1.POST("/mergerequestreviews", mergeRequestReviewsHandler)
 		v1.POST("/metadata", metadataHandler)
+		v1.POST("/migration", migrationHandler)
+		v1.POST("/milestonedelete", authRequireWritePermission, milestoneDeleteHandler)
+		v1.POST("/milestones", milestonesHandler)
+		v1.POST("/milestonesave", authRequireWritePermission, milestoneSaveHandler)
+		v1.POST("/moderationaction", authRequireWritePermission, moderationActionHandler)
+		v1.POST("/moderationqueue", moderationQueueHandler)
+		v1.POST("/notificationprefs", notificationPrefsHandler)
+		v1.POST("/notificationprefssave", authRequireWritePermission, notificationPrefsSaveHandler)
+		v1.POST("/optimize", authRequireWritePermission, optimizeHandler)
+		v1.POST("/optimizestatus", optimizeStatusHandler)
+		v1.POST("/profile", profileHandler)
+		v1.POST("/profilepin", authRequireWritePermission, profilePinHandler)
+		v1.POST("/profilesave", authRequireWritePermission, profileSaveHandler)
 		v1.POST("/query", queryHandler)
+		v1.POST("/react", authRequireWritePermission, reactHandler)
+		v1.POST("/reactions", reactionsHandler)
+		v1.POST("/releasedoi", authRequireWritePermission, releaseDOIHandler)
 		v1.POST("/releases", releasesHandler)
+		v1.POST("/replication", replicationHandler)
+		v1.POST("/replicationremove", authRequireWritePermission, replicationRemoveHandler)
+		v1.POST("/replicationset", authRequireWritePermission, replicationSetHandler)
+		v1.POST("/reportdelete", authRequireWritePermission, reportDeleteHandler)
+		v1.POST("/reportoutput", reportOutputHandler)
+		v1.POST("/reportrun", authRequireWritePermission, reportRunHandler)
+		v1.POST("/reportruns", reportRunsHandler)
+		v1.POST("/reports", reportsHandler)
+		v1.POST("/reportsave", authRequireWritePermission, reportSaveHandler)
+		v1.POST("/requiredapprovals", requiredApprovalsHandler)
+		v1.POST("/requiredapprovalsset", authRequireWritePermission, requiredApprovalsSetHandler)
+		v1.POST("/requiredchecks", requiredChecksHandler)
+		v1.POST("/requiredchecksset", authRequireWritePermission, requiredChecksSetHandler)
+		v1.POST("/reviewowners", reviewOwnersHandler)
+		v1.POST("/reviewownersset", authRequireWritePermission, reviewOwnersSetHandler)
+		v1.POST("/rowhistory", rowHistoryHandler)
+		v1.POST("/rowsdelete", authRequireWritePermission, rowsDeleteHandler)
+		v1.POST("/rowsinsert", authRequireWritePermission, rowsInsertHandler)
+		v1.POST("/rowsupdate", authRequireWritePermission, rowsUpdateHandler)
+		v1.POST("/savedqueries", savedQueriesHandler)
+		v1.POST("/savedquery", savedQueryHandler)
+		v1.POST("/savedquerysave", authRequireWritePermission, savedQuerySaveHandler)
+		v1.POST("/savedqueryversions", savedQueryVersionsHandler)
+		v1.POST("/sandboxcreate", authRequireWritePermission, sandboxCreateHandler)
+		v1.POST("/sandboxdiff", sandboxDiffHandler)
+		v1.POST("/sandboxes", sandboxesHandler)
+		v1.POST("/sandboxmerge", authRequireWritePermission, sandboxMergeHandler)
+		v1.POST("/schemacreate", authRequireWritePermission, schemaCreateHandler)
+		v1.POST("/schemapolicies", schemaPoliciesHandler)
+		v1.POST("/schemapolicyset", authRequireWritePermission, schemaPolicySetHandler)
+		v1.POST("/sizealert", sizeAlertHandler)
+		v1.POST("/sizealertset", authRequireWritePermission, sizeAlertSetHandler)
+		v1.POST("/sizehistory", sizeHistoryHandler)
+		v1.POST("/stalebranches", staleBranchesHandler)
+		v1.POST("/statusupdates", statusUpdatesHandler)
+		v1.POST("/statusupdatesdismiss", authRequireWritePermission, statusUpdatesDismissHandler)
+		v1.POST("/statusupdatesread", authRequireWritePermission, statusUpdatesReadHandler)
 		v1.POST("/tables", tablesHandler)
 		v1.POST("/tags", tagsHandler)
+		v1.POST("/templates", templatesHandler)
+		v1.POST("/templateset", authRequireWritePermission, templateSetHandler)
+		v1.POST("/templateuse", authRequireWritePermission, templateUseHandler)
+		v1.POST("/transactionbegin", authRequireWritePermission, transactionBeginHandler)
+		v1.POST("/transactioncommit", authRequireWritePermission, transactionCommitHandler)
+		v1.POST("/transactionexecute", authRequireWritePermission, transactionExecuteHandler)
+		v1.POST("/transactionquery", authRequireWritePermission, transactionQueryHandler)
+		v1.POST("/transactionrollback", authRequireWritePermission, transactionRollbackHandler)
+		v1.POST("/transformationdelete", authRequireWritePermission, transformationDeleteHandler)
+		v1.POST("/transformationrun", authRequireWritePermission, transformationRunHandler)
+		v1.POST("/transformationruns", transformationRunsHandler)
+		v1.POST("/transformations", transformationsHandler)
+		v1.POST("/transformationsave", authRequireWritePermission, transformationSaveHandler)
+		v1.POST("/trending", trendingHandler)
+		v1.POST("/unblock", authRequireWritePermission, unblockHandler)
 		v1.POST("/upload", authRequireWritePermission, uploadHandler)
+		v1.POST("/uploadpages", authRequireWritePermission, uploadPagesHandler)
+		v1.POST("/validationresults", validationResultsHandler)
+		v1.POST("/validationruledelete", authRequireWritePermission, validationRuleDeleteHandler)
+		v1.POST("/validationrules", validationRulesHandler)
+		v1.POST("/validationrulesexport", validationRulesExportHandler)
+		v1.POST("/validationrulesimport", authRequireWritePermission, validationRulesImportHandler)
+		v1.POST("/validationrulesave", authRequireWritePermission, validationRuleSaveHandler)
+		v1.POST("/verified", verifiedHandler)
+		v1.POST("/verify", authRequireWritePermission, verifyHandler)
 		v1.POST("/views", viewsHandler)
 		v1.POST("/webpage", webpageHandler)
+
+		// Add routes which are only useful during testing
+		if config.Conf.Environment.Environment == "test" {
+			v1.POST("/testfixtures", authRequireWritePermission, testFixturesHandler)
+		}
 	}
 
-	// Register API v2 handlers. There is three middlewares which apply to all of them:
+	// Register API v2 handlers. There is four middlewares which apply to all of them:
 	// 1) authentication is required
 	// 2) usage limits are applied; because these are applied per user this needs to happen after authentication
 	// 3) authenticated and permitted calls are logged
-	v2 := router.Group("/v2", authenticateV2(sessionStore), limit, callLog)
+	// 4) calls from browsers are only allowed on the origins the API key is restricted to (if any)
+	v2 := router.Group("/v2", authenticateV2(sessionStore), limit, callLog, checkKeyOrigin)
 	{
+		v2.GET("/pages/:dbowner/:dbname/:commit", pagesHandler)
+		v2.HEAD("/pages/:dbowner/:dbname/:commit", pagesHandler)
 		v2.GET("/status", statusHandler)
+		v2.GET("/subscribe", subscribeHandler)
 	}
 
+	// Register the public end points.  These don't need authentication, and only provide access to public databases and
+	// the health of the server
+	router.GET("/health", healthHandler)
+	router.GET("/pages/:dbowner/:dbname/:commit", pagesHandler)
+	router.HEAD("/pages/:dbowner/:dbname/:commit", pagesHandler)
+
 	// Register web routes
 	router.GET("/", rootHandler)
 	router.GET("/changelog", changeLogHandler)
 	router.GET("/changelog.html", changeLogHandler)
 	router.StaticFile("/favicon.ico", filepath.Join(config.Conf.Web.BaseDir, "webui", "favicon.ico"))
+	router.GET("/v1/openapi.json", openapiHandler)
 
 	// Generate the formatted server string
 	server = fmt.Sprintf("https://%s", config.Conf.Api.ServerName)
@@ -264,6 +443,13 @@ func authenticateV2(store *gsm.MemcacheStore) gin.HandlerFunc {
 				return
 			}
 
+			// Banned users can't use the API, even with an existing session
+			banned, err := database.UserBanned(u.(string))
+			if err != nil || banned {
+				c.AbortWithStatus(http.StatusUnauthorized)
+				return
+			}
+
 			c.Set("user", u.(string))
 			c.Set("key", database.APIKey{
 				ID:          0,                        // The ID 0 is translated into NULL when inserting into api_call_log
@@ -273,7 +459,8 @@ func authenticateV2(store *gsm.MemcacheStore) gin.HandlerFunc {
 	}
 }
 
-// authRequireWritePermission is a middleware which denies requests when the API key used does not provide write permissions
+// authRequireWritePermission is a middleware which denies requests when the API key used does not provide write
+// permissions, or when the server is in read only mode
 func authRequireWritePermission(c *gin.Context) {
 	key := c.MustGet("key").(database.APIKey)
 	if key.Permissions != database.MayReadAndWrite {
@@ -283,6 +470,14 @@ func authRequireWritePermission(c *gin.Context) {
 		c.Abort()
 		return
 	}
+	if ro, msg := com.ReadOnlyMode(); ro {
+		c.Header("Retry-After", "300")
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": msg,
+		})
+		c.Abort()
+		return
+	}
 }
 
 // callLog is a middleware to log authenticated calls to API endpoints to the database
@@ -322,6 +517,33 @@ func changeLogHandler(c *gin.Context) {
 	c.HTML(http.StatusOK, "changelog", pageData)
 }
 
+// openapiHandler returns the OpenAPI document describing the API.  The document is generated from the route
+// definitions above and the doc comments of the handlers, by running "go run ./standalone/openapi".  No API key is
+// needed for this
+func openapiHandler(c *gin.Context) {
+	data, err := os.ReadFile(filepath.Join(config.Conf.Web.BaseDir, "api", "openapi.json"))
+	if err != nil {
+		log.Printf("Error reading the OpenAPI document: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "The OpenAPI document isn't available",
+		})
+		return
+	}
+	var doc map[string]interface{}
+	err = json.Unmarshal(data, &doc)
+	if err != nil {
+		log.Printf("Error parsing the OpenAPI document: %s", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "The OpenAPI document isn't available",
+		})
+		return
+	}
+
+	// Point the document at this server, rather than the public DBHub.io one
+	doc["servers"] = []gin.H{{"url": "https://" + config.Conf.Api.ServerName}}
+	c.JSON(200, doc)
+}
+
 // rootHandler handles requests for "/" and all unknown paths
 func rootHandler(c *gin.Context) {
 	var pageData struct {
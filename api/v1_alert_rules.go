@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// alertHistoryHandler returns the most recent evaluations of an alert rule, newest first
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F name="Orders dropped" https://api.dbhub.io/v1/alerthistory
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "name" is the name of the alert rule
+func alertHistoryHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	name, ok := alertRuleName(c)
+	if !ok {
+		return
+	}
+	list, err := database.AlertHistory(loggedInUser, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, list)
+}
+
+// alertRuleDeleteHandler removes an alert rule, along with its history
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F name="Orders dropped" https://api.dbhub.io/v1/alertruledelete
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "name" is the name of the alert rule
+func alertRuleDeleteHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	name, ok := alertRuleName(c)
+	if !ok {
+		return
+	}
+	exists, err := database.AlertRuleDelete(loggedInUser, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Alert rule '%s' not found", name),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// alertRuleName extracts and validates the alert rule name of a request.  When it's invalid an error is returned to the
+// caller, and false is returned
+func alertRuleName(c *gin.Context) (name string, ok bool) {
+	name = c.PostForm("name")
+	err := com.ValidateAlertRuleName(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid alert rule name",
+		})
+		return
+	}
+	return name, true
+}
+
+// alertRuleSaveHandler adds an alert rule, or changes an existing one.  Changing a rule resets its state.  The secret
+// used for signing webhook requests is returned
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F name="Orders dropped" -F dbowner="justinclift" -F dbname="orders" \
+//	    -F query="Orders today" -F schedule="0 * * * *" -F metric="rows" -F condition="drop" -F threshold="50" \
+//	    -F delivery="email" https://api.dbhub.io/v1/alertrulesave
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "name" is the name of the alert rule
+//	* "dbowner" and "dbname" are the owner and name of the live database to run the query on
+//	* "query" is the name of the saved query to run
+//	* "schedule" is when the rule is evaluated, as a five field cron schedule in UTC (eg "0 * * * *"), or one of
+//	  "@hourly", "@daily", "@weekly", "@monthly", or "@yearly".  Rules can't be evaluated more than once every 15 minutes
+//	* "metric" is what's checked.  Either "rows" for the number of rows returned, or "value" for the numeric value of the
+//	  first column of the first row
+//	* "condition" is when the alert triggers.  Either "above", "below", or "equal" to compare the metric with the
+//	  threshold, or "drop" or "rise" for when it changes by at least the threshold percentage since the last evaluation
+//	* "threshold" is the number the metric is compared with, or the percentage for "drop" and "rise"
+//	* "delivery" is how you're notified.  Either "email" to your email address, or "webhook"
+//	* "webhookurl" is the address the alert is POSTed to, when notifying a webhook.  The requests are signed with the
+//	  returned secret, in the "X-DBHub-Signature" header
+func alertRuleSaveHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	name, ok := alertRuleName(c)
+	if !ok {
+		return
+	}
+	r := database.AlertRule{
+		Condition: c.PostForm("condition"),
+		DBName:    c.PostForm("dbname"),
+		DBOwner:   c.PostForm("dbowner"),
+		Delivery:  c.PostForm("delivery"),
+		Metric:    c.PostForm("metric"),
+		Name:      name,
+		QueryName: c.PostForm("query"),
+		Schedule:  c.PostForm("schedule"),
+		User:      loggedInUser,
+	}
+
+	// Check the schedule and condition
+	sched, err := com.ScheduledReportSchedule(r.Schedule)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	r.NextRun = sched.Next(time.Now())
+	r.Threshold, err = strconv.ParseFloat(c.PostForm("threshold"), 64)
+	if err != nil || math.IsNaN(r.Threshold) || math.IsInf(r.Threshold, 0) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid threshold",
+		})
+		return
+	}
+	err = com.AlertCondition(r.Metric, r.Condition, r.Threshold)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Check the delivery method
+	switch r.Delivery {
+	case "email":
+	case "webhook":
+		r.WebhookURL = c.PostForm("webhookurl")
+		err = com.ValidateWebhookURL(r.WebhookURL)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Unknown delivery method.  Must be either 'email' or 'webhook'",
+		})
+		return
+	}
+
+	// Make sure the database is a live one the user can access, and the saved query exists
+	err = com.ValidateUserDB(r.DBOwner, r.DBName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid database owner or name",
+		})
+		return
+	}
+	err = com.ValidateSavedQueryName(r.QueryName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid saved query name",
+		})
+		return
+	}
+	allowed, err := database.CheckDBPermissions(loggedInUser, r.DBOwner, r.DBName, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Database does not exist, or user isn't authorised to access it",
+		})
+		return
+	}
+	isLive, _, err := database.CheckDBLive(r.DBOwner, r.DBName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !isLive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Alert rules can only be used with live databases",
+		})
+		return
+	}
+	_, exists, err := database.SavedQueryGet(loggedInUser, r.DBOwner, r.DBName, r.QueryName, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Saved query '%s' not found", r.QueryName),
+		})
+		return
+	}
+
+	// Check the user hasn't already reached the most alert rules they can have
+	list, err := database.AlertRules(loggedInUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	existing := false
+	for _, z := range list {
+		if z.Name == name {
+			existing = true
+		}
+	}
+	if !existing && len(list) >= database.AlertRuleMaxRules {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("You can't have more than %d alert rules", database.AlertRuleMaxRules),
+		})
+		return
+	}
+
+	// Save the rule
+	secret, err := database.AlertRuleSave(r)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"next_run":       r.NextRun,
+		"webhook_secret": secret,
+	})
+}
+
+// alertRulesHandler returns the alert rules of the user, along with their current state
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" https://api.dbhub.io/v1/alertrules
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+func alertRulesHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	list, err := database.AlertRules(loggedInUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, list)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// Maximum number of days of analytics returned by a single request
+const analyticsMaxDays = 366
+
+// analyticsHandler returns the daily traffic of one of your databases: the number of downloads, clones (downloads by
+// DB4S and Dio), page views, and API queries on each day.  The downloads over the whole range are also broken down by
+// client type, country, and referring site.  Only the owner of a database can see its analytics
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F from="2026-09-01" -F to="2026-09-30" https://api.dbhub.io/v1/analytics
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "from" is the (optional) first day to return, in YYYY-MM-DD format.  Defaults to 29 days before "to"
+//	* "to" is the (optional) last day to return, in YYYY-MM-DD format.  Defaults to today
+func analyticsHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if strings.ToLower(loggedInUser) != strings.ToLower(dbOwner) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Only the owner of a database can see its analytics",
+		})
+		return
+	}
+
+	// Validate the date range
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	if t := c.PostForm("to"); t != "" {
+		to, err = time.Parse("2006-01-02", t)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid 'to' date.  It needs to be in YYYY-MM-DD format",
+			})
+			return
+		}
+	}
+	from := to.AddDate(0, 0, -29)
+	if f := c.PostForm("from"); f != "" {
+		from, err = time.Parse("2006-01-02", f)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid 'from' date.  It needs to be in YYYY-MM-DD format",
+			})
+			return
+		}
+	}
+	if from.After(to) || to.Sub(from) >= analyticsMaxDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid date range.  It needs to cover between 1 and 366 days",
+		})
+		return
+	}
+
+	// Retrieve the analytics
+	days, err := database.Analytics(dbOwner, dbName, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if days == nil {
+		days = []database.AnalyticsDay{}
+	}
+
+	// Break down the downloads by where they came from
+	breakdown, err := database.DownloadStats(dbOwner, dbName, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Add up the totals for the whole range
+	var totals database.AnalyticsDay
+	for _, j := range days {
+		totals.APIQueries += j.APIQueries
+		totals.Clones += j.Clones
+		totals.Downloads += j.Downloads
+		totals.Views += j.Views
+	}
+	c.JSON(200, gin.H{
+		"days":         days,
+		"downloads_by": breakdown,
+		"totals": gin.H{
+			"api_queries": totals.APIQueries,
+			"clones":      totals.Clones,
+			"downloads":   totals.Downloads,
+			"views":       totals.Views,
+		},
+	})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+const (
+	// Maximum number of API calls returned by a single request
+	apiCallsMaxLimit = 100
+
+	// Maximum number of days the API key usage can be summarised over
+	apiKeyUsageMaxDays = 366
+)
+
+// apiCallsHandler returns a page of your most recent API calls, newest first.  Each call includes the endpoint, the
+// HTTP status code, how long it took to run, and the API key used.  This is useful for debugging integrations
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F failed="true" https://api.dbhub.io/v1/apicalls
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "key" is the (optional) ID of one of your API keys.  When given, only the calls made with that key are returned
+//	* "failed" is an (optional) boolean.  When "true", only the calls which failed (with a 4xx or 5xx status code)
+//	  are returned
+//	* "offset" is the (optional) number of calls to skip.  Defaults to 0
+//	* "limit" is the (optional) maximum number of calls to return, up to 100.  Defaults to 25
+func apiCallsHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	// Validate the filters and paging parameters
+	var err error
+	failed := false
+	if f := c.PostForm("failed"); f != "" {
+		failed, err = strconv.ParseBool(f)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid value for failed",
+			})
+			return
+		}
+	}
+	offset, limit := 0, 25
+	if o := c.PostForm("offset"); o != "" {
+		offset, err = strconv.Atoi(o)
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid offset",
+			})
+			return
+		}
+	}
+	if l := c.PostForm("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > apiCallsMaxLimit {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid limit.  It needs to be between 1 and %d", apiCallsMaxLimit),
+			})
+			return
+		}
+	}
+
+	// Retrieve the API calls
+	list, total, err := database.ApiCalls(loggedInUser, c.PostForm("key"), failed, offset, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if list == nil {
+		list = []database.ApiCall{}
+	}
+	c.JSON(200, gin.H{
+		"calls": list,
+		"total": total,
+	})
+}
+
+// apiKeyUsageHandler returns a summary of the API calls made with each of your API keys over a number of days: the
+// number of calls, how many of them failed, their average run time, and when each key was last used
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F days="7" https://api.dbhub.io/v1/apikeyusage
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "days" is the (optional) number of days to summarise, up to 366.  Defaults to 30
+func apiKeyUsageHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	// Validate the number of days
+	days := 30
+	if d := c.PostForm("days"); d != "" {
+		var err error
+		days, err = strconv.Atoi(d)
+		if err != nil || days < 1 || days > apiKeyUsageMaxDays {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid number of days.  It needs to be between 1 and %d", apiKeyUsageMaxDays),
+			})
+			return
+		}
+	}
+
+	// Retrieve the usage summary
+	keys, err := database.ApiKeyUsageSummary(loggedInUser, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if keys == nil {
+		keys = []database.ApiKeyUsage{}
+	}
+	c.JSON(200, gin.H{
+		"days": days,
+		"keys": keys,
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// archiveHandler archives one of your databases, or makes it writable again.  Archived databases are read only, so
+// they don't accept new commits, discussions, or merge requests
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F archived="true" https://api.dbhub.io/v1/archive
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "archived" is a boolean.  Either "true" to archive the database, or "false" to make it writable again
+func archiveHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Only the owner of a database can archive it
+	if !strings.EqualFold(loggedInUser, dbOwner) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Only the owner of a database can archive it",
+		})
+		return
+	}
+	archived, err := strconv.ParseBool(c.PostForm("archived"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid value for archived",
+		})
+		return
+	}
+
+	exists, err := database.SetDBArchived(dbOwner, dbName, archived)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Database does not exist",
+		})
+		return
+	}
+
+	// Invalidate the memcache data for the database, so the new status gets picked up
+	err = com.InvalidateCacheEntry(loggedInUser, dbOwner, dbName, "") // Empty string indicates "for all versions"
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status":   "OK",
+		"archived": archived,
+	})
+}
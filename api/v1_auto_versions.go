@@ -0,0 +1,324 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// autoVersionHandler returns the standard database one of your live databases is automatically versioned into, how
+// often new versions are committed, and the outcome of the last version
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing live.sqlite" \
+//	    https://api.dbhub.io/v1/autoversion
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+func autoVersionHandler(c *gin.Context) {
+	dbOwner, dbName, ok := autoVersionOwnerAccess(c)
+	if !ok {
+		return
+	}
+
+	a, exists, err := database.LiveAutoVersionFor(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "That database isn't being automatically versioned",
+		})
+		return
+	}
+	c.JSON(200, a)
+}
+
+// autoVersionRemoveHandler stops automatically versioning one of your live databases.  The versions already committed
+// to the target database are kept
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing live.sqlite" \
+//	    https://api.dbhub.io/v1/autoversionremove
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+func autoVersionRemoveHandler(c *gin.Context) {
+	dbOwner, dbName, ok := autoVersionOwnerAccess(c)
+	if !ok {
+		return
+	}
+
+	exists, err := database.LiveAutoVersionRemove(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "That database isn't being automatically versioned",
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// autoVersionSetHandler automatically commits versions of one of your live databases to a branch of one of your
+// standard databases, replacing any existing settings.  After the live database is changed, a new version is committed
+// once it's gone unchanged for the debounce time, and/or once the interval has passed since the last version.  The
+// versions are committed by you, so your full name and email address need to be set.  When only some of the versions
+// are kept, the older ones are pruned from the branch as new ones are added.  The owner of the databases is emailed
+// when versioning keeps failing
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing live.sqlite" \
+//	    -F target="Join Testing.sqlite" -F branch="main" -F debounce="600" -F keep="20" \
+//	    https://api.dbhub.io/v1/autoversionset
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "target" is the name of the standard database to commit the versions to.  It needs to be owned by the owner of the live database
+//	* "branch" is the (optional) branch of the target database to commit the versions to.  Defaults to its default branch
+//	* "onwrite" is an (optional) boolean for whether to commit a new version after each change to the database, once the debounce time has passed.  Defaults to true
+//	* "debounce" is the (optional) number of seconds the database needs to go unchanged before a new version is committed.  Defaults to 300
+//	* "interval" is the (optional) number of minutes between versions while the database is being changed.  Defaults to 0, for no scheduled versions
+//	* "keep" is the (optional) number of the most recent versions to keep on the branch.  Defaults to 0, which keeps all of them
+func autoVersionSetHandler(c *gin.Context) {
+	dbOwner, dbName, ok := autoVersionOwnerAccess(c)
+	if !ok {
+		return
+	}
+
+	// Check the target is a standard database of the same owner, which can be committed to
+	target := c.PostForm("target")
+	err := com.ValidateDB(target)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid target database name",
+		})
+		return
+	}
+	exists, err := database.CheckDBExists(dbOwner, target)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Database '%s/%s' doesn't exist", dbOwner, target),
+		})
+		return
+	}
+	isLive, _, err := database.CheckDBLive(dbOwner, target)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if isLive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "The target database needs to be a standard database",
+		})
+		return
+	}
+	clientEncrypted, err := database.CheckDBClientEncrypted(dbOwner, target)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if clientEncrypted {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": com.ErrClientEncrypted.Error(),
+		})
+		return
+	}
+	archived, err := database.CheckDBArchived(dbOwner, target)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if archived {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": database.ErrDBArchived.Error(),
+		})
+		return
+	}
+	other, err := database.LiveAutoVersionOf(dbOwner, target)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if other != "" && other != dbName {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": fmt.Sprintf("The live database '%s' is already versioned into that database", other),
+		})
+		return
+	}
+
+	branch := c.PostForm("branch")
+	if branch == "" {
+		branch, err = database.GetDefaultBranchName(dbOwner, target)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+	branches, err := database.GetBranches(dbOwner, target)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if _, ok = branches[branch]; !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Branch not found",
+		})
+		return
+	}
+
+	onWrite := true
+	if z := c.PostForm("onwrite"); z != "" {
+		onWrite, err = strconv.ParseBool(z)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid onwrite value",
+			})
+			return
+		}
+	}
+	debounce := 300
+	if z := c.PostForm("debounce"); z != "" {
+		debounce, err = strconv.Atoi(z)
+		if err != nil || debounce < 10 || debounce > 86400 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "The debounce time needs to be between 10 and 86400 seconds",
+			})
+			return
+		}
+	}
+	var interval int
+	if z := c.PostForm("interval"); z != "" {
+		interval, err = strconv.Atoi(z)
+		if err != nil || interval < 0 || interval > 10080 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "The interval needs to be between 0 and 10080 minutes",
+			})
+			return
+		}
+	}
+	if !onWrite && interval == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Versions need to be committed either after changes, or on an interval",
+		})
+		return
+	}
+	var keep int
+	if z := c.PostForm("keep"); z != "" {
+		keep, err = strconv.Atoi(z)
+		if err != nil || keep < 0 || keep > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "The number of versions to keep needs to be between 0 and 1000",
+			})
+			return
+		}
+	}
+
+	// The versions are committed by the owner of the databases, which needs their name and email address
+	usr, err := database.User(dbOwner)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if usr.DisplayName == "" || usr.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "You need to set your full name and email address in Preferences first",
+		})
+		return
+	}
+
+	err = database.LiveAutoVersionSave(database.LiveAutoVersion{
+		Branch:   branch,
+		DBName:   dbName,
+		DBOwner:  dbOwner,
+		Debounce: debounce,
+		Interval: interval,
+		Keep:     keep,
+		OnWrite:  onWrite,
+		Target:   target,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// The first version is committed by the live node once the debounce time or interval has passed
+	a, _, err := database.LiveAutoVersionFor(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, a)
+}
+
+// autoVersionOwnerAccess checks the database in the request is a live database owned by the user, as only the owner of
+// a database can see or change its automatic versioning.  The versions are committed in their name
+func autoVersionOwnerAccess(c *gin.Context) (dbOwner, dbName string, ok bool) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !strings.EqualFold(loggedInUser, dbOwner) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Only the owner of a database can manage its automatic versioning",
+		})
+		return
+	}
+	isLive, _, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !isLive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Only live databases can be automatically versioned",
+		})
+		return
+	}
+	return dbOwner, dbName, true
+}
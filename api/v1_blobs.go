@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// blobHandler returns the value of a single BLOB or TEXT cell of a database, such as an image or PDF stored in it.
+// The content type is worked out from the value, and HTTP range requests are supported, so large values can be
+// previewed or downloaded without fetching the whole database
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Media.sqlite" -F table="photos" \
+//	    -F column="image" -F rowid="42" -o photo.jpg https://api.dbhub.io/v1/blob
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "commit" is the (optional) commit ID to read the value from.  Uses the head commit of the default branch if not specified
+//	* "table" is the name of the table holding the value
+//	* "column" is the name of the column holding the value
+//	* "rowid" is the number of the row (its rowid) holding the value
+//	* "download" is an (optional) boolean string ("true", "false"), for whether the value should be saved as a file
+//	   rather than shown by web browsers.  Defaults to false
+func blobHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, commitID, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Work out which cell is wanted
+	var req com.JobRequestBlob
+	req.Table, err = com.GetFormTable(c.Request, false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	req.Column = c.PostForm("column")
+	if req.Table == "" || req.Column == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "The table and column names are needed",
+		})
+		return
+	}
+	req.RowID, err = strconv.ParseInt(c.PostForm("rowid"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid rowid value",
+		})
+		return
+	}
+	download := false
+	if z := c.PostForm("download"); z != "" {
+		download, err = strconv.ParseBool(z)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid download value",
+			})
+			return
+		}
+	}
+
+	// Check if the database is a live database, and get the node/queue to send the request to
+	isLive, liveNode, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Values of standard databases are streamed from the database file.  Live databases send them through the job queue
+	if !isLive {
+		httpStatus, err = com.BlobStandard(c.Writer, c.Request, dbOwner, dbName, commitID, loggedInUser, req, download)
+		if err != nil {
+			c.JSON(httpStatus, gin.H{
+				"error": err.Error(),
+			})
+		}
+		return
+	}
+	if liveNode == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "No job queue node available for request",
+		})
+		return
+	}
+	data, httpStatus, err := com.LiveBlob(liveNode, loggedInUser, dbOwner, dbName, req)
+	if err != nil {
+		if jobQueueFull(c, err) {
+			return
+		}
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	err = com.ServeBlob(c.Writer, c.Request, req, time.Time{}, bytes.NewReader(data), download)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+	}
+}
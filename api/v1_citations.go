@@ -0,0 +1,116 @@
+package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+)
+
+// citationHandler returns the metadata for citing a release of a database, either as DataCite JSON or in the Citation
+// File Format used for CITATION.cff files
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F release="v1.0" https://api.dbhub.io/v1/citation
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "release" is the name of the release
+//	* "format" is the (optional) format of the metadata.  Either "datacite" (the default) or "cff"
+func citationHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	relName, ok := releaseName(c)
+	if !ok {
+		return
+	}
+	format := c.PostForm("format")
+	if format != "" && format != "datacite" && format != "cff" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Unknown citation format",
+		})
+		return
+	}
+
+	cit, err := com.GetReleaseCitation(loggedInUser, dbOwner, dbName, relName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if format == "cff" {
+		c.Data(200, "application/x-yaml; charset=utf-8", []byte(cit.CFF()))
+		return
+	}
+	c.JSON(200, cit.DataCite())
+}
+
+// releaseDOIHandler mints a DOI for a release of a public database, so it can be cited.  Each release can only have
+// one DOI, and it can't be removed afterwards
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F release="v1.0" https://api.dbhub.io/v1/releasedoi
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "release" is the name of the release
+func releaseDOIHandler(c *gin.Context) {
+	dbOwner, dbName, ok := labelsWriteAccess(c)
+	if !ok {
+		return
+	}
+	relName, ok := releaseName(c)
+	if !ok {
+		return
+	}
+	if !com.DOIEnabled() {
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"error": "DOIs can't be minted on this server",
+		})
+		return
+	}
+
+	loggedInUser := c.MustGet("user").(string)
+	doi, err := com.MintReleaseDOI(loggedInUser, dbOwner, dbName, relName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	log.Printf("DOI '%s' minted for release '%s' of '%s/%s' by user '%s'", doi, com.SanitiseLogString(relName),
+		dbOwner, dbName, loggedInUser)
+	c.JSON(200, gin.H{
+		"doi": doi,
+	})
+}
+
+// releaseName returns the validated name of the release a request is for, writing an error response if it's missing or
+// invalid
+func releaseName(c *gin.Context) (relName string, ok bool) {
+	relName = c.PostForm("release")
+	if relName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "The release name is missing",
+		})
+		return
+	}
+	err := com.ValidateBranchName(relName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid release name",
+		})
+		return
+	}
+	return relName, true
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// ckanDatasetName matches valid CKAN dataset names.  CKAN also accepts dataset IDs in their place, which match it too
+var ckanDatasetName = regexp.MustCompile(`^[a-z0-9_-]{2,100}$`)
+
+// ckanHandler returns the CKAN catalog a database is connected to, along with the outcome of the last sync with it
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    https://api.dbhub.io/v1/ckan
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+func ckanHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	_, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	integ, exists, err := database.CKANIntegrationFor(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "That database isn't connected to a CKAN catalog",
+		})
+		return
+	}
+	c.JSON(200, integ)
+}
+
+// ckanHarvestHandler creates a new database from the CSV resources of a CKAN dataset, with a table for each of them.
+// Only resources stored in the CKAN catalogs this server can connect to are harvested
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F ckanurl="https://catalog.data.gov" -F dataset="electric-vehicle-population-data" \
+//	    -F keepupdated="true" https://api.dbhub.io/v1/ckanharvest
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "ckanurl" is the base URL of the CKAN catalog
+//	* "dataset" is the name of the CKAN dataset
+//	* "token" is an (optional) CKAN API token, for harvesting private datasets
+//	* "dbname" is the (optional) name for the new database.  Uses the name of the dataset if not specified
+//	* "public" is an (optional) boolean for whether the new database is public.  Defaults to private
+//	* "keepupdated" is an (optional) boolean for whether to add a new commit to the database whenever the dataset changes
+func ckanHarvestHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	ckanURL, dataset, token, ok := ckanParams(c)
+	if !ok {
+		return
+	}
+
+	// If no database name was given, use the name of the dataset
+	dbName := c.PostForm("dbname")
+	if dbName == "" {
+		dbName = dataset + ".sqlite"
+	}
+	err := com.ValidateDB(dbName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid database name",
+		})
+		return
+	}
+	c.Set("owner", loggedInUser)
+	c.Set("database", dbName)
+
+	// Only new databases can be created this way
+	exists, err := database.CheckDBExists(loggedInUser, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "A database with that name already exists.  Please choose a different name.",
+		})
+		return
+	}
+
+	accessType := database.SetToPrivate
+	if z := c.PostForm("public"); z != "" {
+		public, err := strconv.ParseBool(z)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid public value",
+			})
+			return
+		}
+		if public {
+			accessType = database.SetToPublic
+		}
+	}
+	var keepUpdated bool
+	if z := c.PostForm("keepupdated"); z != "" {
+		keepUpdated, err = strconv.ParseBool(z)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid keepupdated value",
+			})
+			return
+		}
+	}
+
+	commitID, sha, err := com.CKANHarvest(loggedInUser, ckanURL, token, dataset, dbName, accessType, keepUpdated)
+	if errors.Is(err, com.ErrCKAN) {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Make a record of the upload
+	err = database.LogUpload(loggedInUser, dbName, loggedInUser, c.ClientIP(), "api", c.Request.UserAgent(),
+		time.Now().UTC(), sha)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"commit": commitID,
+		"url":    server + filepath.Join("/", loggedInUser, dbName) + "?branch=main&commit=" + commitID,
+	})
+}
+
+// ckanRemoveHandler disconnects one of your databases from its CKAN catalog.  Datasets already published to the catalog
+// aren't removed from it
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    https://api.dbhub.io/v1/ckanremove
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+func ckanRemoveHandler(c *gin.Context) {
+	dbOwner, dbName, ok := ckanOwnerAccess(c)
+	if !ok {
+		return
+	}
+
+	exists, err := database.CKANIntegrationRemove(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "That database isn't connected to a CKAN catalog",
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// ckanSetHandler connects one of your databases to a CKAN dataset, replacing any existing connection.  In "publish" mode
+// the latest release of the database is published to the dataset, creating it if needed, and new releases are
+// published as they're made.  In "harvest" mode a new commit is added to the database whenever the CSV resources of the
+// dataset change.  The database is synced straight away, and the outcome is returned
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F mode="publish" -F ckanurl="https://demo.ckan.org" -F dataset="join-testing" \
+//	    -F organization="dbhub" -F token="YOUR_CKAN_API_TOKEN" https://api.dbhub.io/v1/ckanset
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "mode" is either "publish" or "harvest"
+//	* "ckanurl" is the base URL of the CKAN catalog
+//	* "dataset" is the name of the CKAN dataset
+//	* "organization" is the (optional) CKAN organization new datasets are published in
+//	* "token" is an (optional) CKAN API token.  It's needed for publishing, and keeps the existing one when not specified
+func ckanSetHandler(c *gin.Context) {
+	dbOwner, dbName, ok := ckanOwnerAccess(c)
+	if !ok {
+		return
+	}
+	ckanURL, dataset, token, ok := ckanParams(c)
+	if !ok {
+		return
+	}
+	mode := c.PostForm("mode")
+	if mode != "publish" && mode != "harvest" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "The mode needs to be either 'publish' or 'harvest'",
+		})
+		return
+	}
+	organization := c.PostForm("organization")
+	if organization != "" && !ckanDatasetName.MatchString(organization) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid CKAN organization name",
+		})
+		return
+	}
+
+	// Live databases don't have commits or releases
+	isLive, _, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if isLive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Live databases can't be connected to CKAN catalogs",
+		})
+		return
+	}
+
+	base, err := com.CKANInstance(ckanURL)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Publishing needs an API token, which can be the one already saved for the catalog
+	existing, exists, err := database.CKANIntegrationFor(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if mode == "publish" && token == "" && (!exists || existing.URL != base || existing.APIToken == "") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "A CKAN API token is needed for publishing",
+		})
+		return
+	}
+
+	err = database.CKANIntegrationSave(database.CKANIntegration{
+		APIToken:     token,
+		DBName:       dbName,
+		DBOwner:      dbOwner,
+		Dataset:      dataset,
+		Mode:         mode,
+		Organization: organization,
+		URL:          base,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Sync straight away.  Problems talking to the catalog are returned in the last_error field
+	integ, _, err := database.CKANIntegrationFor(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err = com.CKANSync(integ); err != nil && !errors.Is(err, com.ErrCKAN) {
+		log.Printf("Syncing '%s/%s' with CKAN failed: %v", dbOwner, com.SanitiseLogString(dbName), err)
+	}
+	integ, _, err = database.CKANIntegrationFor(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, integ)
+}
+
+// ckanOwnerAccess checks the database in the request exists and is owned by the user, as only the owner of a database
+// can connect it to a CKAN catalog
+func ckanOwnerAccess(c *gin.Context) (dbOwner, dbName string, ok bool) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !strings.EqualFold(loggedInUser, dbOwner) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Only the owner of a database can change its CKAN integration",
+		})
+		return
+	}
+	return dbOwner, dbName, true
+}
+
+// ckanParams extracts and validates the CKAN catalog, dataset, and API token of a request
+func ckanParams(c *gin.Context) (ckanURL, dataset, token string, ok bool) {
+	if !com.CKANEnabled() {
+		c.JSON(http.StatusNotImplemented, gin.H{
+			"error": "This server can't connect to CKAN catalogs",
+		})
+		return
+	}
+	ckanURL = c.PostForm("ckanurl")
+	if _, err := com.CKANInstance(ckanURL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	dataset = c.PostForm("dataset")
+	if !ckanDatasetName.MatchString(dataset) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid CKAN dataset name",
+		})
+		return
+	}
+	token = c.PostForm("token")
+	if len(token) > 1024 || strings.ContainsAny(token, "\r\n") {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid CKAN API token",
+		})
+		return
+	}
+	return ckanURL, dataset, token, true
+}
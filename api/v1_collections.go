@@ -0,0 +1,388 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// CollectionDetails holds the details of a collection, along with the databases in it
+type CollectionDetails struct {
+	database.Collection
+	Databases []database.CollectionEntry `json:"databases"`
+}
+
+// collectionAddHandler adds a public database to one of your collections.  When the database is already in the
+// collection, its note and position are changed instead
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F name="Awesome climate data" -F dbowner="justinclift" \
+//	    -F dbname="Join Testing.sqlite" -F note="Good for testing joins" https://api.dbhub.io/v1/collectionadd
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "name" is the name of the collection
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "note" is an (optional) note about the database, shown with it in the collection
+//	* "position" is the (optional) number of the place in the collection to put the database, starting at 1.  Defaults to the end
+func collectionAddHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+	name, ok := collectionName(c, loggedInUser)
+	if !ok {
+		return
+	}
+
+	// Extract the database owner and name, and the details of the entry
+	dbOwner, dbName, _, err := com.GetFormODC(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.Set("owner", dbOwner)
+	c.Set("database", dbName)
+	note := c.PostForm("note")
+	if note != "" {
+		err = com.ValidateMarkdown(note)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid note",
+			})
+			return
+		}
+	}
+	position := 0
+	if p := c.PostForm("position"); p != "" {
+		position, err = strconv.Atoi(p)
+		if err != nil || position < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid position",
+			})
+			return
+		}
+	}
+
+	exists, err := database.CollectionAddDB(loggedInUser, name, dbOwner, dbName, note, position)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Database does not exist, or isn't public",
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// collectionDeleteHandler deletes one of your collections.  The databases in it aren't affected
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F name="Awesome climate data" https://api.dbhub.io/v1/collectiondelete
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "name" is the name of the collection to delete
+func collectionDeleteHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+	name := strings.TrimSpace(c.PostForm("name"))
+	err := com.ValidateCollectionName(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid collection name",
+		})
+		return
+	}
+
+	err = database.CollectionDelete(loggedInUser, name)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// collectionHandler returns the details of a collection, along with the databases in it in their curated order
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F username="justinclift" -F name="Awesome climate data" \
+//	    https://api.dbhub.io/v1/collection
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "username" is the (optional) owner of the collection.  Defaults to yourself
+//	* "name" is the name of the collection
+func collectionHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+	owner, ok := formUser(c, loggedInUser)
+	if !ok {
+		return
+	}
+	name := strings.TrimSpace(c.PostForm("name"))
+	err := com.ValidateCollectionName(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid collection name",
+		})
+		return
+	}
+
+	// Private collections are only visible to their owner
+	col, exists, err := database.CollectionGet(owner, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists || (!col.Public && !strings.EqualFold(owner, loggedInUser)) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Collection '%s' not found", name),
+		})
+		return
+	}
+
+	details := CollectionDetails{Collection: col}
+	details.Databases, err = database.CollectionEntries(owner, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if details.Databases == nil {
+		details.Databases = []database.CollectionEntry{}
+	}
+	c.JSON(200, details)
+}
+
+// collectionRemoveHandler removes a database from one of your collections
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F name="Awesome climate data" -F dbowner="justinclift" \
+//	    -F dbname="Join Testing.sqlite" https://api.dbhub.io/v1/collectionremove
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "name" is the name of the collection
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+func collectionRemoveHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+	name, ok := collectionName(c, loggedInUser)
+	if !ok {
+		return
+	}
+	dbOwner, dbName, _, err := com.GetFormODC(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.Set("owner", dbOwner)
+	c.Set("database", dbName)
+
+	exists, err := database.CollectionRemoveDB(loggedInUser, name, dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "That database isn't in the collection",
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// collectionSaveHandler creates one of your collections, or changes its details
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F name="Awesome climate data" \
+//	    -F description="Temperature, rainfall, and emissions data" https://api.dbhub.io/v1/collectionsave
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "name" is the name of the collection
+//	* "description" is an (optional) description of the collection
+//	* "public" is an (optional) boolean.  Either "true" (the default) for a public collection, or "false" for one only you can see
+func collectionSaveHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	// Validate the collection details
+	name := strings.TrimSpace(c.PostForm("name"))
+	err := com.ValidateCollectionName(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid collection name",
+		})
+		return
+	}
+	description := c.PostForm("description")
+	if description != "" {
+		err = com.ValidateMarkdown(description)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid collection description",
+			})
+			return
+		}
+	}
+	public := true
+	if p := c.PostForm("public"); p != "" {
+		public, err = strconv.ParseBool(p)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid value for public",
+			})
+			return
+		}
+	}
+
+	err = database.CollectionSave(loggedInUser, name, description, public)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// collectionsHandler returns the collections a user has created, or the ones they have starred
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F username="justinclift" https://api.dbhub.io/v1/collections
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "username" is the (optional) name of the user.  Defaults to yourself
+//	* "starred" is an (optional) boolean.  Either "false" (the default) for the collections the user created, or "true" for the ones they starred
+func collectionsHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+	userName, ok := formUser(c, loggedInUser)
+	if !ok {
+		return
+	}
+	starred := false
+	if s := c.PostForm("starred"); s != "" {
+		var err error
+		starred, err = strconv.ParseBool(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid value for starred",
+			})
+			return
+		}
+	}
+
+	// Private collections are only included for their owner
+	self := strings.EqualFold(userName, loggedInUser)
+	var list []database.Collection
+	var err error
+	if starred {
+		list, err = database.StarredCollections(userName, self)
+	} else {
+		list, err = database.Collections(userName, self)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if list == nil {
+		list = []database.Collection{}
+	}
+	c.JSON(200, list)
+}
+
+// collectionStarHandler stars or unstars a collection, which adds it to (or removes it from) the list of collections
+// you follow
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F username="justinclift" -F name="Awesome climate data" \
+//	    -F starred="true" https://api.dbhub.io/v1/collectionstar
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "username" is the (optional) owner of the collection.  Defaults to yourself
+//	* "name" is the name of the collection
+//	* "starred" is a boolean.  Either "true" to star the collection, or "false" to remove your star
+func collectionStarHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+	owner, ok := formUser(c, loggedInUser)
+	if !ok {
+		return
+	}
+	name := strings.TrimSpace(c.PostForm("name"))
+	err := com.ValidateCollectionName(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid collection name",
+		})
+		return
+	}
+	starred, err := strconv.ParseBool(c.PostForm("starred"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid value for starred",
+		})
+		return
+	}
+
+	exists, err := database.SetCollectionStar(loggedInUser, owner, name, starred)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Collection '%s' not found", name),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status":  "OK",
+		"starred": starred,
+	})
+}
+
+// collectionName returns the validated name of one of the logged in user's collections, checking it exists.  When it
+// doesn't, the error response is sent
+func collectionName(c *gin.Context, loggedInUser string) (name string, ok bool) {
+	name = strings.TrimSpace(c.PostForm("name"))
+	err := com.ValidateCollectionName(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid collection name",
+		})
+		return
+	}
+	_, exists, err := database.CollectionGet(loggedInUser, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Collection '%s' not found", name),
+		})
+		return
+	}
+	return name, true
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+const (
+	// Maximum number of commits returned by a single commit search
+	commitSearchMaxLimit = 100
+
+	// Maximum length of the text searched for in commit authors and messages
+	commitSearchMaxText = 255
+)
+
+// commitSearchHandler searches the commit history of a database by author, date range, and message text.  The
+// matching commits are returned a page at a time, newest first
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F author="justin" -F message="fix" -F from="2026-01-01" https://api.dbhub.io/v1/commitsearch
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "author" is (optional) text to look for in the name or email address of the commit author.  Case insensitive
+//	* "message" is (optional) text to look for in the commit message.  Case insensitive
+//	* "from" is the (optional) date of the earliest commits to return, in YYYY-MM-DD format
+//	* "to" is the (optional) date of the latest commits to return, in YYYY-MM-DD format.  Commits made on that day are included
+//	* "offset" is the (optional) number of commits to skip.  Defaults to 0
+//	* "limit" is the (optional) maximum number of commits to return, up to 100.  Defaults to 25
+func commitSearchHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	_, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Validate the search conditions and paging parameters
+	search := database.CommitSearch{
+		Author:  c.PostForm("author"),
+		Message: c.PostForm("message"),
+	}
+	if len(search.Author) > commitSearchMaxText || len(search.Message) > commitSearchMaxText {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("The author and message to search for can't be longer than %d characters",
+				commitSearchMaxText),
+		})
+		return
+	}
+	if f := c.PostForm("from"); f != "" {
+		search.From, err = time.Parse("2006-01-02", f)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid from date.  It needs to be in YYYY-MM-DD format",
+			})
+			return
+		}
+	}
+	if t := c.PostForm("to"); t != "" {
+		search.To, err = time.Parse("2006-01-02", t)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid to date.  It needs to be in YYYY-MM-DD format",
+			})
+			return
+		}
+
+		// Include the commits made during the day
+		search.To = search.To.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	offset, limit := 0, 25
+	if o := c.PostForm("offset"); o != "" {
+		offset, err = strconv.Atoi(o)
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid offset",
+			})
+			return
+		}
+	}
+	if l := c.PostForm("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > commitSearchMaxLimit {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid limit.  It needs to be between 1 and %d", commitSearchMaxLimit),
+			})
+			return
+		}
+	}
+
+	// Live databases don't have commits
+	isLive, _, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if isLive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "That database is a live database.  It doesn't have commits.",
+		})
+		return
+	}
+
+	// Run the search
+	list, total, err := database.SearchCommits(dbOwner, dbName, search, offset, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if list == nil {
+		list = []database.CommitEntry{}
+	}
+	c.JSON(200, gin.H{
+		"commits": list,
+		"total":   total,
+	})
+}
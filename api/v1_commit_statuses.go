@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// statusContextName matches valid commit status contexts, such as "ci/tests" or "Lint: schema"
+var statusContextName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_./: -]{0,99}$`)
+
+// commitStatusHandler sets the status of a commit for a context, replacing any earlier status for the same context.
+// This is intended for CI systems, which can post "pending" when they start checking a commit and "success" or
+// "failure" once they're done.  Statuses on the head commit of a merge request are shown on it, and can be required to
+// succeed before it's merged
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F commit="ea12b36fc2b1a1fb8a3a8b8c1b7b2b1e0fb1e8a1d4a6b6e2c0c3b6f8a1c2d3e4" -F state="success" \
+//	    -F context="ci/tests" -F targeturl="https://ci.example.com/builds/123" https://api.dbhub.io/v1/commitstatus
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "commit" is the commit ID the status is for
+//	* "state" is the status of the commit, either "pending", "success", or "failure"
+//	* "context" is the (optional) name of the check the status is for.  Defaults to "default"
+//	* "targeturl" is an (optional) URL with the details of the check, such as a CI build page
+//	* "description" is an (optional) short description of the status
+func commitStatusHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, commitID, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Posting statuses needs write access to the database
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "You need write access to the database to post commit statuses",
+		})
+		return
+	}
+
+	// Validate the status details
+	if commitID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "A commit ID is needed",
+		})
+		return
+	}
+	exists, err := database.CommitExists(dbOwner, dbName, commitID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Commit not found in the database",
+		})
+		return
+	}
+	state := c.PostForm("state")
+	validState := false
+	for _, z := range com.CommitStatusStates {
+		if state == z {
+			validState = true
+		}
+	}
+	if !validState {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("The state needs to be one of: %s", strings.Join(com.CommitStatusStates, ", ")),
+		})
+		return
+	}
+	statusContext := c.PostForm("context")
+	if statusContext == "" {
+		statusContext = "default"
+	}
+	if !statusContextName.MatchString(statusContext) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid context",
+		})
+		return
+	}
+	targetURL := c.PostForm("targeturl")
+	if targetURL != "" {
+		u, err := url.Parse(targetURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(targetURL) > 1024 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid target URL",
+			})
+			return
+		}
+	}
+	description, err := com.CheckUnicode(c.PostForm("description"), false)
+	if err != nil || len(description) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid description",
+		})
+		return
+	}
+
+	status := database.CommitStatus{
+		Commit:      commitID,
+		Context:     statusContext,
+		Creator:     loggedInUser,
+		Description: description,
+		State:       state,
+		TargetURL:   targetURL,
+	}
+	err = database.CommitStatusSave(dbOwner, dbName, status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"status": "OK",
+	})
+}
+
+// commitStatusesHandler returns the statuses posted for a commit, one for each context
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F commit="ea12b36fc2b1a1fb8a3a8b8c1b7b2b1e0fb1e8a1d4a6b6e2c0c3b6f8a1c2d3e4" https://api.dbhub.io/v1/commitstatuses
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "commit" is the commit ID to return the statuses of
+func commitStatusesHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	_, dbOwner, dbName, commitID, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if commitID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "A commit ID is needed",
+		})
+		return
+	}
+
+	list, err := database.CommitStatuses(dbOwner, dbName, commitID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if list == nil {
+		list = []database.CommitStatus{}
+	}
+	c.JSON(200, list)
+}
+
+// requiredChecksHandler returns the status checks which need to succeed on the head commit of a merge request to a
+// database, before it can be merged
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    https://api.dbhub.io/v1/requiredchecks
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+func requiredChecksHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	_, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	contexts, err := database.RequiredStatusChecks(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if contexts == nil {
+		contexts = []string{}
+	}
+	c.JSON(200, contexts)
+}
+
+// requiredChecksSetHandler sets the status checks which need to succeed on the head commit of a merge request to one
+// of your databases, before it can be merged
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F contexts="ci/tests,ci/lint" https://api.dbhub.io/v1/requiredchecksset
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "contexts" is an (optional) comma separated list of the status check contexts needing to succeed.  Merge requests can be merged regardless of their status checks when not specified
+func requiredChecksSetHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !strings.EqualFold(loggedInUser, dbOwner) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Only the owner of a database can change its required status checks",
+		})
+		return
+	}
+
+	var contexts []string
+	for _, z := range strings.Split(c.PostForm("contexts"), ",") {
+		if z = strings.TrimSpace(z); z == "" {
+			continue
+		}
+		if !statusContextName.MatchString(z) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid context: '%s'", z),
+			})
+			return
+		}
+		contexts = append(contexts, z)
+	}
+	if len(contexts) > 20 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "At most 20 status checks can be required",
+		})
+		return
+	}
+
+	err = database.RequiredStatusChecksSet(dbOwner, dbName, contexts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// dataCommentHandler starts a comment thread about a row, or a single cell, of the data diff of a merge request.  The
+// row needs to be added, changed, or deleted by the merge request
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F discid="3" -F table="table1" -F key='{"id": 5}' -F column="price" -F body="Is this right?" \
+//	    https://api.dbhub.io/v1/datacomment
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "discid" is the ID of the merge request
+//	* "table" is the name of the table holding the row
+//	* "key" is a JSON object with the value of each primary key column of the row.  Tables without a primary key use "rowid"
+//	* "column" is the (optional) column of the cell the comment is about.  The comment is about the whole row when not specified
+//	* "body" is the text of the comment
+func dataCommentHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Validate the merge request ID and the comment
+	discID, body, ok := dataCommentForm(c)
+	if !ok {
+		return
+	}
+	anchor := database.DataCommentAnchor{Column: c.PostForm("column")}
+	anchor.Table, err = com.GetFormTable(c.Request, false)
+	if err != nil || anchor.Table == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid table name",
+		})
+		return
+	}
+	anchor.Key, err = com.ParseRowKey(c.PostForm("key"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Make sure the row is part of the changes in the merge request
+	disc, err := database.Discussions(dbOwner, dbName, database.MERGE_REQUEST, discID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if len(disc) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Merge request not found",
+		})
+		return
+	}
+	err = com.DataCommentAnchorCheck(dbOwner, dbName, disc[0].MRDetails, &anchor)
+	if errors.Is(err, com.ErrClientEncrypted) || errors.Is(err, com.ErrDataCommentAnchor) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	comID, err := database.StoreDataComment(dbOwner, dbName, loggedInUser, discID, anchor, 0, body)
+	if errors.Is(err, database.ErrDBArchived) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"com_id": comID,
+	})
+}
+
+// dataCommentForm validates the merge request ID and comment text given to the data comment handlers, responding with
+// an error when they're invalid
+func dataCommentForm(c *gin.Context) (discID int, body string, ok bool) {
+	discID, err := strconv.Atoi(c.PostForm("discid"))
+	if err != nil || discID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid merge request ID",
+		})
+		return
+	}
+	body = c.PostForm("body")
+	if body == "" || com.ValidateMarkdown(body) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid comment body",
+		})
+		return
+	}
+	return discID, body, true
+}
+
+// dataCommentReplyHandler replies to a comment thread on the data diff of a merge request
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F discid="3" -F comid="12" -F body="Yes, the supplier changed it" https://api.dbhub.io/v1/datacommentreply
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "discid" is the ID of the merge request
+//	* "comid" is the ID of the comment starting the thread
+//	* "body" is the text of the reply
+func dataCommentReplyHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	discID, body, ok := dataCommentForm(c)
+	if !ok {
+		return
+	}
+	parentID, err := strconv.Atoi(c.PostForm("comid"))
+	if err != nil || parentID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid comment ID",
+		})
+		return
+	}
+
+	if _, _, ok = dataCommentThread(c, dbOwner, dbName, discID, parentID); !ok {
+		return
+	}
+
+	comID, err := database.StoreDataComment(dbOwner, dbName, loggedInUser, discID, database.DataCommentAnchor{},
+		parentID, body)
+	if errors.Is(err, database.ErrDBArchived) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"com_id": comID,
+	})
+}
+
+// dataCommentResolveHandler marks a comment thread on the data diff of a merge request as resolved, or as unresolved
+// again.  This can be done by whoever started the thread, the creator of the merge request, and users with write
+// access to the database
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F discid="3" -F comid="12" https://api.dbhub.io/v1/datacommentresolve
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "discid" is the ID of the merge request
+//	* "comid" is the ID of the comment starting the thread
+//	* "unresolve" is an (optional) boolean.  When true, the thread is marked as unresolved again
+func dataCommentResolveHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	discID, err := strconv.Atoi(c.PostForm("discid"))
+	if err != nil || discID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid merge request ID",
+		})
+		return
+	}
+	comID, err := strconv.Atoi(c.PostForm("comid"))
+	if err != nil || comID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid comment ID",
+		})
+		return
+	}
+	resolved := true
+	if u := c.PostForm("unresolve"); u != "" {
+		var unresolve bool
+		unresolve, err = strconv.ParseBool(u)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid unresolve value",
+			})
+			return
+		}
+		resolved = !unresolve
+	}
+
+	// Find the thread, and make sure the user is allowed to resolve it
+	mr, thread, ok := dataCommentThread(c, dbOwner, dbName, discID, comID)
+	if !ok {
+		return
+	}
+	allowed := strings.EqualFold(loggedInUser, thread.Commenter) || strings.EqualFold(loggedInUser, mr.Creator)
+	if !allowed {
+		allowed, err = database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "You can't resolve this comment thread",
+		})
+		return
+	}
+
+	err = database.DataCommentResolve(dbOwner, dbName, loggedInUser, discID, comID, resolved)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// dataCommentThread retrieves a merge request and the comment starting one of the threads on its data diff, responding
+// with an error when either doesn't exist
+func dataCommentThread(c *gin.Context, dbOwner, dbName string, discID, comID int) (mr database.DiscussionEntry, thread database.DiscussionCommentEntry, ok bool) {
+	disc, err := database.Discussions(dbOwner, dbName, database.MERGE_REQUEST, discID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if len(disc) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Merge request not found",
+		})
+		return
+	}
+	comments, err := database.DiscussionComments(dbOwner, dbName, discID, comID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if len(comments) == 0 || comments[0].Anchor == nil || comments[0].ParentID != 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Comment thread not found",
+		})
+		return
+	}
+	return disc[0], comments[0], true
+}
+
+// dataCommentsHandler returns the comment threads on the data diff of a merge request, oldest first
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F discid="3" https://api.dbhub.io/v1/datacomments
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "discid" is the ID of the merge request
+func dataCommentsHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	_, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	discID, err := strconv.Atoi(c.PostForm("discid"))
+	if err != nil || discID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid merge request ID",
+		})
+		return
+	}
+
+	threads, err := database.DataCommentThreads(dbOwner, dbName, discID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, threads)
+}
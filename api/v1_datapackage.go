@@ -0,0 +1,229 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// dataPackageHandler returns a Frictionless Data Package descriptor (datapackage.json) for a database, describing its
+// tables, their columns, and its licence
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    https://api.dbhub.io/v1/datapackage
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "commit" is the (optional) commit ID to describe.  Uses the head commit of the default branch if not specified
+func dataPackageHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, commitID, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Live databases don't have commits to describe
+	isLive, _, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if isLive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "That database is a live database.  Data packages are only available for standard databases.",
+		})
+		return
+	}
+
+	pkg, err := com.DataPackageFor(loggedInUser, dbOwner, dbName, commitID)
+	if errors.Is(err, com.ErrClientEncrypted) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, pkg)
+}
+
+// dataPackageImportHandler creates a new database from a Frictionless Data Package.  The upload needs to be a zip file
+// holding the datapackage.json descriptor and the CSV file of each resource.  Each resource becomes a table
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F file=@country-codes.zip -F dbname="Country codes.sqlite" \
+//	    https://api.dbhub.io/v1/datapackageimport
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "file" is the zip file holding the data package
+//	* "dbname" is the (optional) name for the new database.  Uses the name of the data package if not specified
+//	* "licence" is the (optional) licence of the new database.  Uses the licence of the data package if not specified and it's one known to DBHub.io
+//	* "public" is an (optional) boolean for whether the new database is public.  Defaults to private
+func dataPackageImportHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	// Set the maximum accepted upload size
+	maxSize, err := database.MaxUploadSizeForUser(loggedInUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if maxSize != -1 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize)
+	}
+
+	// Grab the uploaded file
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Something went wrong when grabbing the file data: '%s'", err.Error()),
+		})
+		return
+	}
+	src, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to open uploaded file for reading",
+		})
+		return
+	}
+	defer src.Close()
+
+	// Build the database from the data package
+	tempDB, pkg, err := com.ImportDataPackage(src, fileHeader.Size, maxSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	defer os.Remove(tempDB.Name())
+	defer tempDB.Close()
+
+	// If no database name was given, use the name of the data package
+	dbName := c.PostForm("dbname")
+	if dbName == "" {
+		dbName = pkg.Name + ".sqlite"
+	}
+	err = com.ValidateDB(dbName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid database name",
+		})
+		return
+	}
+	c.Set("owner", loggedInUser)
+	c.Set("database", dbName)
+
+	// Only new databases can be created this way
+	exists, err := database.CheckDBExists(loggedInUser, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "A database with that name already exists.  Please choose a different name.",
+		})
+		return
+	}
+
+	// Use the given licence, or else the licence of the data package when it's one we know about
+	licences, err := database.GetLicences(loggedInUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	licenceName := "Not specified"
+	if z := c.PostForm("licence"); z != "" {
+		if _, ok := licences[z]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Unknown licence: '%s'", z),
+			})
+			return
+		}
+		licenceName = z
+	} else if len(pkg.Licenses) > 0 {
+		for name := range licences {
+			if strings.EqualFold(name, pkg.Licenses[0].Name) {
+				licenceName = name
+			}
+		}
+	}
+
+	accessType := database.SetToPrivate
+	if z := c.PostForm("public"); z != "" {
+		public, err := strconv.ParseBool(z)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid public value",
+			})
+			return
+		}
+		if public {
+			accessType = database.SetToPublic
+		}
+	}
+
+	// Keep the home page of the data package as the source of the data, if it's usable
+	var sourceURL string
+	if com.Validate.Var(pkg.Homepage, "url,min=5,max=255") == nil {
+		sourceURL = pkg.Homepage
+	}
+
+	// Add the new database
+	commitMsg := "Imported from a data package"
+	if pkg.Title != "" {
+		commitMsg = fmt.Sprintf("Imported from the '%s' data package", pkg.Title)
+	}
+	numBytes, commitID, sha, err := com.AddDatabase(loggedInUser, loggedInUser, dbName, true, "main", "",
+		accessType, licenceName, commitMsg, sourceURL, tempDB, time.Now().UTC(), time.Time{}, "", "", "", "", nil, "",
+		com.AddDatabaseOptions{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Make a record of the upload
+	err = database.LogUpload(loggedInUser, dbName, loggedInUser, c.ClientIP(), "api", c.Request.UserAgent(),
+		time.Now().UTC(), sha)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	log.Printf("Data package imported: '%s/%s', bytes: %v", loggedInUser, com.SanitiseLogString(dbName), numBytes)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"commit": commitID,
+		"url":    server + filepath.Join("/", loggedInUser, dbName) + "?branch=main&commit=" + commitID,
+	})
+}
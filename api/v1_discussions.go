@@ -0,0 +1,375 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// discussionAssignHandler assigns a discussion or merge request to a user, or removes the assignment.  Only users
+// with write access to the database can do this
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F discid="3" -F assignee="someuser" https://api.dbhub.io/v1/discussionassign
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "discid" is the ID of the discussion or merge request
+//	* "assignee" is the (optional) name of the user to assign it to.  Leave it empty to remove the assignment
+func discussionAssignHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Only users with write access to the database can assign discussions
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "You don't have write access to this database",
+		})
+		return
+	}
+
+	// Validate the discussion ID
+	discID, err := strconv.Atoi(c.PostForm("discid"))
+	if err != nil || discID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid discussion ID",
+		})
+		return
+	}
+
+	// Validate the assignee
+	assignee := c.PostForm("assignee")
+	if assignee != "" {
+		err = com.ValidateUser(assignee)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid assignee",
+			})
+			return
+		}
+		usr, err := database.User(assignee)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if usr.Username == "" {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": fmt.Sprintf("Unknown user '%s'", assignee),
+			})
+			return
+		}
+		assignee = usr.Username
+		canAccess, err := database.CheckDBPermissions(assignee, dbOwner, dbName, false)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if !canAccess {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("User '%s' doesn't have access to this database", assignee),
+			})
+			return
+		}
+	}
+
+	// Assign the discussion, and let the assignee know
+	exists, err := database.SetDiscussionAssignee(dbOwner, dbName, discID, assignee)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Unknown discussion",
+		})
+		return
+	}
+	err = database.NewAssignmentEvent(dbOwner, dbName, loggedInUser, discID, assignee)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"assignee": assignee,
+	})
+}
+
+// discussionLabelsHandler replaces the labels applied to a discussion or merge request.  Only users with write access
+// to the database can do this
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F discid="3" -F labels="bug,data-error" https://api.dbhub.io/v1/discussionlabels
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "discid" is the ID of the discussion or merge request
+//	* "labels" is a comma separated list of label names.  Leave it empty to remove all labels
+func discussionLabelsHandler(c *gin.Context) {
+	dbOwner, dbName, ok := labelsWriteAccess(c)
+	if !ok {
+		return
+	}
+
+	// Validate the discussion ID
+	discID, err := strconv.Atoi(c.PostForm("discid"))
+	if err != nil || discID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid discussion ID",
+		})
+		return
+	}
+
+	// Only the labels available for the database can be applied
+	available, err := database.Labels(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	labels := []string{}
+	for _, l := range strings.Split(c.PostForm("labels"), ",") {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+		found := false
+		for _, a := range available {
+			if strings.ToLower(a.Name) == strings.ToLower(l) {
+				labels = append(labels, a.Name)
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Unknown label '%s'", l),
+			})
+			return
+		}
+	}
+
+	exists, err := database.SetDiscussionLabels(dbOwner, dbName, discID, labels)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Unknown discussion",
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"labels": labels,
+	})
+}
+
+// discussionMilestoneHandler adds a discussion or merge request to a milestone, or removes it from its milestone.
+// Only users with write access to the database can do this
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F discid="3" -F milestone="Version 2" https://api.dbhub.io/v1/discussionmilestone
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "discid" is the ID of the discussion or merge request
+//	* "milestone" is the (optional) title of the milestone.  Leave it empty to remove it from its milestone
+func discussionMilestoneHandler(c *gin.Context) {
+	dbOwner, dbName, ok := labelsWriteAccess(c)
+	if !ok {
+		return
+	}
+
+	// Validate the discussion ID
+	discID, err := strconv.Atoi(c.PostForm("discid"))
+	if err != nil || discID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid discussion ID",
+		})
+		return
+	}
+
+	// Make sure the milestone exists, and use its established capitalisation
+	milestone := c.PostForm("milestone")
+	if milestone != "" {
+		milestones, err := database.Milestones(dbOwner, dbName)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		found := false
+		for _, m := range milestones {
+			if strings.ToLower(m.Title) == strings.ToLower(milestone) {
+				milestone = m.Title
+				found = true
+				break
+			}
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Unknown milestone",
+			})
+			return
+		}
+	}
+
+	exists, err := database.SetDiscussionMilestone(dbOwner, dbName, discID, milestone)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Unknown discussion",
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"milestone": milestone,
+	})
+}
+
+// discussionsHandler returns the list of discussions or merge requests for a database.  Open merge requests include
+// any warnings about combining data under incompatible licences
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F assigned="me" https://api.dbhub.io/v1/discussions
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "type" is the (optional) type of thread to return.  Either "discussion" (the default) or "mr"
+//	* "assigned" is the (optional) name of a user, to only return the threads assigned to them.  "me" returns the
+//	  threads assigned to you
+//	* "label" is the (optional) name of a label, to only return the threads with that label
+//	* "milestone" is the (optional) title of a milestone, to only return the threads in that milestone
+//	* "open" is an (optional) boolean, to only return open or closed threads
+func discussionsHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Validate the filters
+	var discType database.DiscussionType
+	switch c.PostForm("type") {
+	case "", "discussion":
+		discType = database.DISCUSSION
+	case "mr":
+		discType = database.MERGE_REQUEST
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Unknown discussion type",
+		})
+		return
+	}
+	filter := database.DiscussionFilter{
+		Assignee:  c.PostForm("assigned"),
+		Label:     c.PostForm("label"),
+		Milestone: c.PostForm("milestone"),
+	}
+	if filter.Assignee == "me" {
+		filter.Assignee = loggedInUser
+	}
+	if o := c.PostForm("open"); o != "" {
+		open, err := strconv.ParseBool(o)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid value for open",
+			})
+			return
+		}
+		filter.Open = &open
+	}
+
+	// Retrieve the list of discussions
+	discs, err := database.DiscussionsFiltered(dbOwner, dbName, discType, 0, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if discs == nil {
+		discs = []database.DiscussionEntry{}
+	}
+
+	// Add the reviews of merge requests, and who has been asked for one.  Warn about open ones which would combine data under incompatible licences,
+	// and add their status checks
+	if discType == database.MERGE_REQUEST {
+		for i, d := range discs {
+			discs[i].MRDetails.Reviews, err = database.MergeRequestReviews(dbOwner, dbName, d.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+			discs[i].MRDetails.RequestedReviewers, err = database.MergeRequestReviewRequests(dbOwner, dbName, d.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+			if !d.Open {
+				continue
+			}
+			discs[i].MRDetails.LicenceWarnings, err = com.MergeRequestLicenceWarnings(dbOwner, dbName, d.MRDetails)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+			discs[i].MRDetails.StatusChecks, discs[i].MRDetails.MergeBlocked, err = com.MergeRequestStatusChecks(dbOwner, dbName, d)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+		}
+	}
+	c.JSON(200, discs)
+}
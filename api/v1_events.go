@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+const (
+	// Maximum number of events returned by a single poll, or sent in a single batch on a stream
+	eventsMaxBatch = 100
+
+	// How often the database is checked for new events while a request is waiting for them
+	eventsPollInterval = time.Second
+
+	// Maximum amount of time a request stays open waiting for events.  This is kept below the write timeout of the
+	// API server, so streams need to be reconnected by clients (which EventSource clients do automatically)
+	eventsMaxWait = 8 * time.Second
+)
+
+// eventsHandler returns the status updates of the user, and the events for the databases they're watching.  It can
+// either be long-polled, or used as a Server-Sent Events stream
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F since="1234" https://api.dbhub.io/v1/events
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "since" is the (optional) ID of the last event already received.  Only events after it are returned
+//	* "mode" is the (optional) way of returning events.  Either "poll" (the default) or "stream" for Server-Sent Events
+//	* "timeout" is the (optional) number of seconds to wait for new events when polling, up to 8.  Defaults to 8
+func eventsHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	// Work out which events the caller has already received.  Reconnecting SSE clients send this as a header
+	since := c.PostForm("since")
+	if since == "" {
+		since = c.GetHeader("Last-Event-ID")
+	}
+	var sinceID int64
+	if since != "" {
+		var err error
+		sinceID, err = strconv.ParseInt(since, 10, 64)
+		if err != nil || sinceID < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid event ID",
+			})
+			return
+		}
+	}
+
+	// Check the requested mode
+	mode := c.PostForm("mode")
+	if mode == "" && strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		mode = "stream"
+	}
+	switch mode {
+	case "", "poll":
+		eventsPoll(c, loggedInUser, sinceID)
+	case "stream":
+		eventsStream(c, loggedInUser, sinceID)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Unknown mode requested",
+		})
+	}
+}
+
+// eventsPoll waits until new events are available for the user or the timeout is reached, then returns them along
+// with the user's current status updates
+func eventsPoll(c *gin.Context, loggedInUser string, sinceID int64) {
+	// Work out how long to wait for new events
+	wait := eventsMaxWait
+	if t := c.PostForm("timeout"); t != "" {
+		secs, err := strconv.Atoi(t)
+		if err != nil || secs < 0 || time.Duration(secs)*time.Second > eventsMaxWait {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid timeout.  It needs to be between 0 and %d seconds", eventsMaxWait/time.Second),
+			})
+			return
+		}
+		wait = time.Duration(secs) * time.Second
+	}
+
+	// Wait for new events
+	deadline := time.Now().Add(wait)
+	var events []database.EventEntry
+	for {
+		var err error
+		events, err = database.UserEvents(loggedInUser, sinceID, eventsMaxBatch)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if len(events) > 0 || time.Now().Add(eventsPollInterval).After(deadline) {
+			break
+		}
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-time.After(eventsPollInterval):
+		}
+	}
+
+	// Retrieve the status updates for the user
+	updates, err := database.StatusUpdates(loggedInUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Return the results
+	lastID := sinceID
+	if len(events) > 0 {
+		lastID = events[len(events)-1].ID
+	}
+	if events == nil {
+		events = []database.EventEntry{}
+	}
+	c.JSON(200, gin.H{
+		"events":         events,
+		"last_event_id":  lastID,
+		"status_updates": updates,
+	})
+}
+
+// eventsStream sends the user's events and status updates as a Server-Sent Events stream.  Status updates are sent
+// at the start of the stream, then again whenever they change
+func eventsStream(c *gin.Context, loggedInUser string, sinceID int64) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	// Ask clients to reconnect quickly when the stream ends
+	fmt.Fprint(c.Writer, "retry: 1000\n\n")
+	c.Writer.Flush()
+
+	deadline := time.Now().Add(eventsMaxWait)
+	var lastUpdates map[string][]database.StatusUpdateEntry
+	first := true
+	for {
+		// Send the status updates if they've changed
+		updates, err := database.StatusUpdates(loggedInUser)
+		if err != nil {
+			eventsStreamMessage(c, "error", "", gin.H{"error": err.Error()})
+			return
+		}
+		if first || !reflect.DeepEqual(updates, lastUpdates) {
+			eventsStreamMessage(c, "status_updates", "", updates)
+			lastUpdates = updates
+			first = false
+		}
+
+		// Send any new events
+		events, err := database.UserEvents(loggedInUser, sinceID, eventsMaxBatch)
+		if err != nil {
+			eventsStreamMessage(c, "error", "", gin.H{"error": err.Error()})
+			return
+		}
+		for _, ev := range events {
+			eventsStreamMessage(c, "event", strconv.FormatInt(ev.ID, 10), ev)
+			sinceID = ev.ID
+		}
+		c.Writer.Flush()
+
+		// End the stream before the server write timeout is reached.  The client reconnects with the ID of the last
+		// event it received
+		if time.Now().Add(eventsPollInterval).After(deadline) {
+			return
+		}
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-time.After(eventsPollInterval):
+		}
+	}
+}
+
+// eventsStreamMessage writes a single Server-Sent Events message
+func eventsStreamMessage(c *gin.Context, eventType, id string, data interface{}) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		jsonData = []byte(fmt.Sprintf(`{"error": %q}`, err.Error()))
+		eventType = "error"
+	}
+	if id != "" {
+		fmt.Fprintf(c.Writer, "id: %s\n", id)
+	}
+	fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", eventType, jsonData)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// explainHandler returns the query plan of a SQL statement on a SQLite database, without running the statement
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F sql="U0VMRUNUIHRhYmxlMS5OYW1lLCB0YWJsZTIudmFsdWUKRlJPTSB0YWJsZTEgSk9JTiB0YWJsZTIKVVNJTkcgKGlkKQpPUkRFUiBCWSB0YWJsZTEuaWQ7" \
+//	    https://api.dbhub.io/v1/explain
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "commit" is the (optional) commit ID of the database to use.  Uses the head commit of the default branch if not given
+//	* "sql" is the SQL statement to explain, base64 encoded
+//	* "bytecode" is an (optional) boolean.  When true, the bytecode listing of the statement is returned as well
+func explainHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	// Extract the database owner name, database name, and (optional) commit ID for the database from the request
+	dbOwner, dbName, commitID, err := com.GetFormODC(c.Request)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Store database path for later logging
+	c.Set("owner", dbOwner)
+	c.Set("database", dbName)
+
+	// Grab the incoming SQLite statement
+	sql, err := com.CheckUnicode(c.PostForm("sql"), true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	var bytecode bool
+	if z := c.PostForm("bytecode"); z != "" {
+		bytecode, err = strconv.ParseBool(z)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid bytecode value",
+			})
+			return
+		}
+	}
+
+	// Check if the requested database exists
+	exists, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Database '%s/%s' doesn't exist", dbOwner, dbName),
+		})
+		return
+	}
+
+	// Check if the database is a live database, and get the node/queue to send the request to
+	isLive, liveNode, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if isLive && liveNode == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "No job queue node available for request",
+		})
+		return
+	}
+
+	// Explain the statement
+	var result com.ExplainResult
+	if !isLive {
+		result, err = com.SQLiteExplainDefensive(c.Writer, c.Request, dbOwner, dbName, commitID, loggedInUser, sql,
+			bytecode)
+	} else {
+		result, err = com.LiveExplain(liveNode, loggedInUser, dbOwner, dbName, sql, bytecode)
+	}
+	if jobQueueFull(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, result)
+}
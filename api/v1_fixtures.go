@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sqlitebrowser/dbhub.io/common/fixtures"
+)
+
+// testFixturesHandler creates test data, for integration tests in CI and for local development.  It's only available
+// when the server runs in the "test" environment, and can only be used by the instance admins
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F fixtures='{"users": [{"name": "alice"}], "databases": [{"owner": "alice",
+//	    "name": "test.sqlite", "commits": 5}]}' https://api.dbhub.io/v1/testfixtures
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "fixtures" is the test data to create, as JSON.  It can have "users", "databases" (standard or live, with a
+//	  synthetic commit history), "shares" of the databases, "discussions" with their comments, and "api_keys".  When
+//	  "reset" is true, the database is emptied first, which removes the API key used for the call too.  Keys given in
+//	  "api_keys" can be used instead afterwards
+func testFixturesHandler(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	var spec fixtures.Spec
+	err := json.Unmarshal([]byte(c.PostForm("fixtures")), &spec)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid fixtures: " + err.Error(),
+		})
+		return
+	}
+	res, err := fixtures.Create(spec)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, res)
+}
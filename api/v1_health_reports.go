@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// healthReportHandler returns the health report of a commit of a standard database.  It covers the integrity check
+// results, the amount of unused space, the tables without a primary key or with a lot of columns, and whether running
+// VACUUM is suggested.  Reports are worked out in the background, so when the report isn't ready yet it is requested
+// and a 202 response with a "pending" state is returned.  Try again a bit later to get it
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    https://api.dbhub.io/v1/healthreport
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "commit" is the (optional) commit ID of the database to use.  Uses the head commit of the default branch if not given
+func healthReportHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	// Extract the database owner name, database name, and (optional) commit ID for the database from the request
+	dbOwner, dbName, commitID, err := com.GetFormODC(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Store database path for later logging
+	c.Set("owner", dbOwner)
+	c.Set("database", dbName)
+
+	// Check if the user has access to the requested database
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Database '%s/%s' doesn't exist", dbOwner, dbName),
+		})
+		return
+	}
+
+	// Health reports are only for the commits of standard databases
+	isLive, _, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if isLive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Health reports are only available for standard databases",
+		})
+		return
+	}
+
+	// If no commit ID was given, use the head commit of the default branch
+	if commitID == "" {
+		commitID, err = database.DefaultCommit(dbOwner, dbName)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+	} else {
+		exists, err := database.CommitExists(dbOwner, dbName, commitID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": fmt.Sprintf("Commit '%s' doesn't exist in database '%s/%s'", commitID, dbOwner, dbName),
+			})
+			return
+		}
+	}
+
+	// Retrieve the report, asking for it to be worked out if that hasn't happened yet
+	report, err := database.HealthReportFor(dbOwner, dbName, commitID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if report == nil {
+		err = database.HealthReportRequest(dbOwner, dbName, commitID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{
+			"commit": commitID,
+			"state":  "pending",
+		})
+		return
+	}
+	if report.State == "pending" {
+		c.JSON(http.StatusAccepted, report)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
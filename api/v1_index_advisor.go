@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// indexAdvisorHandler suggests indexes for a SQLite database, based on the queries recently run on it.  An index is
+// suggested when it would let queries search a table instead of scanning the whole of it.  For live databases, the
+// suggested indexes can be created by the same call
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing live.sqlite" \
+//	    -F apply="true" https://api.dbhub.io/v1/indexadvisor
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "commit" is the (optional) commit ID of the database to use.  Uses the head commit of the default branch if not given
+//	* "apply" is an (optional) boolean.  When true, the suggested indexes are created.  Only for live databases, and
+//	  needs an API key with write permission
+func indexAdvisorHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	// Extract the database owner name, database name, and (optional) commit ID for the database from the request
+	dbOwner, dbName, commitID, err := com.GetFormODC(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Store database path for later logging
+	c.Set("owner", dbOwner)
+	c.Set("database", dbName)
+
+	var apply bool
+	if z := c.PostForm("apply"); z != "" {
+		apply, err = strconv.ParseBool(z)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid apply value",
+			})
+			return
+		}
+	}
+	if apply && c.MustGet("key").(database.APIKey).Permissions != database.MayReadAndWrite {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "Applying the suggested indexes requires an API key with Write access.  The API key provided " +
+				"doesn't have it.",
+		})
+		return
+	}
+
+	// The suggestions are based on the queries everyone has run on the database, so are only for the users who can
+	// change it
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Database '%s/%s' doesn't exist", dbOwner, dbName),
+		})
+		return
+	}
+
+	// Check if the database is a live database, and get the node/queue to send the request to
+	isLive, liveNode, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if isLive && liveNode == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "No job queue node available for request",
+		})
+		return
+	}
+	if apply && !isLive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Suggested indexes can only be applied to live databases.  For standard databases, add them " +
+				"in a new commit instead.",
+		})
+		return
+	}
+
+	// Retrieve the queries recently run on the database
+	queries, err := database.QueryHistory(dbOwner, dbName, com.IndexAdvisorMaxQueries)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Work out the indexes which would help them
+	var suggestions []com.IndexSuggestion
+	if !isLive {
+		suggestions, err = com.SQLiteIndexAdviceDefensive(c.Writer, c.Request, dbOwner, dbName, commitID, loggedInUser,
+			queries)
+	} else {
+		suggestions, err = com.LiveIndexAdvice(liveNode, loggedInUser, dbOwner, dbName, queries)
+	}
+	if jobQueueFull(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Create the suggested indexes when asked to.  A failure to create one doesn't stop the others being created
+	if apply {
+		for i, s := range suggestions {
+			_, err = com.LiveExecute(liveNode, loggedInUser, dbOwner, dbName, s.SQL)
+			if err != nil {
+				suggestions[i].Error = err.Error()
+				continue
+			}
+			suggestions[i].Applied = true
+			log.Printf("Index '%s' suggested by the index advisor created on '%s/%s' by '%s'",
+				com.SanitiseLogString(s.Name), dbOwner, com.SanitiseLogString(dbName), loggedInUser)
+		}
+	}
+	c.JSON(200, gin.H{
+		"queries":     len(queries),
+		"suggestions": suggestions,
+	})
+}
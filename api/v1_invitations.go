@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// invitationCreateHandler issues an invitation to sign up, for when signups are closed.  The invitation code is only
+// returned here, so it needs to be passed on to the person being invited unless it's emailed to them.  It can only be
+// used by the instance admins
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F email="someone@example.org" https://api.dbhub.io/v1/invitationcreate
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "email" is the (optional) email address of the person being invited.  When given, the invitation code is emailed
+//	  to them, and only they can use it
+//	* "expires" is the (optional) number of days the invitation can be used for.  Defaults to the configured expiry
+func invitationCreateHandler(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+	loggedInUser := c.MustGet("user").(string)
+
+	email := c.PostForm("email")
+	if email != "" {
+		err := com.Validate.Var(email, "email")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid email address",
+			})
+			return
+		}
+	}
+	days := int(config.Conf.Signup.InviteExpiry)
+	if z := c.PostForm("expires"); z != "" {
+		var err error
+		days, err = strconv.Atoi(z)
+		if err != nil || days < 1 || days > 365 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid expiry.  It needs to be between 1 and 365 days",
+			})
+			return
+		}
+	}
+
+	inv, err := database.InvitationCreate(loggedInUser, email, time.Now().AddDate(0, 0, days))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, inv)
+}
+
+// invitationRevokeHandler revokes an invitation which hasn't been used yet.  It can only be used by the instance admins
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F invite="12" https://api.dbhub.io/v1/invitationrevoke
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "invite" is the ID of the invitation
+func invitationRevokeHandler(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	inviteID, err := strconv.ParseInt(c.PostForm("invite"), 10, 64)
+	if err != nil || inviteID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid invitation ID",
+		})
+		return
+	}
+	exists, err := database.InvitationRevoke(inviteID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Invitation not found, or it's already been used",
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// invitationsHandler returns the invitations issued so far, newest first, along with who used them.  It can only be used
+// by the instance admins
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" https://api.dbhub.io/v1/invitations
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+func invitationsHandler(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	list, err := database.Invitations()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, list)
+}
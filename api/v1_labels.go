@@ -0,0 +1,278 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// labelDeleteHandler deletes a label of a database.  The default labels can't be deleted
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F name="needs review" https://api.dbhub.io/v1/labeldelete
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "name" is the name of the label to delete
+func labelDeleteHandler(c *gin.Context) {
+	dbOwner, dbName, ok := labelsWriteAccess(c)
+	if !ok {
+		return
+	}
+
+	err := database.LabelDelete(dbOwner, dbName, c.PostForm("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// labelSaveHandler creates or updates a label of a database
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F name="needs review" -F colour="#fbca04" https://api.dbhub.io/v1/labelsave
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "name" is the name of the label
+//	* "colour" is the colour of the label, as a hex value
+//	* "description" is an (optional) description of the label
+func labelSaveHandler(c *gin.Context) {
+	dbOwner, dbName, ok := labelsWriteAccess(c)
+	if !ok {
+		return
+	}
+
+	// Validate the label details
+	name := strings.TrimSpace(c.PostForm("name"))
+	colour := c.PostForm("colour")
+	err := com.ValidateLabel(name, colour)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid label name or colour",
+		})
+		return
+	}
+	description := c.PostForm("description")
+	if description != "" {
+		err = com.ValidateMarkdown(description)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid label description",
+			})
+			return
+		}
+	}
+
+	err = database.LabelSave(dbOwner, dbName, name, colour, description)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// labelsHandler returns the labels which can be applied to the discussions and merge requests of a database
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    https://api.dbhub.io/v1/labels
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+func labelsHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	_, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	labels, err := database.Labels(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if labels == nil {
+		labels = []database.Label{}
+	}
+	c.JSON(200, labels)
+}
+
+// milestoneDeleteHandler deletes a milestone of a database.  The discussions and merge requests in it are kept
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F title="Version 2" https://api.dbhub.io/v1/milestonedelete
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "title" is the title of the milestone to delete
+func milestoneDeleteHandler(c *gin.Context) {
+	dbOwner, dbName, ok := labelsWriteAccess(c)
+	if !ok {
+		return
+	}
+
+	err := database.MilestoneDelete(dbOwner, dbName, c.PostForm("title"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// milestoneSaveHandler creates or updates a milestone of a database
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F title="Version 2" -F due="2026-12-31" https://api.dbhub.io/v1/milestonesave
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "title" is the title of the milestone
+//	* "description" is an (optional) description of the milestone
+//	* "due" is the (optional) due date of the milestone, in YYYY-MM-DD format
+//	* "open" is an (optional) boolean.  Either "true" (the default) for an open milestone, or "false" to close it
+func milestoneSaveHandler(c *gin.Context) {
+	dbOwner, dbName, ok := labelsWriteAccess(c)
+	if !ok {
+		return
+	}
+
+	// Validate the milestone details
+	title := strings.TrimSpace(c.PostForm("title"))
+	err := com.ValidateMilestoneTitle(title)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid milestone title",
+		})
+		return
+	}
+	description := c.PostForm("description")
+	if description != "" {
+		err = com.ValidateMarkdown(description)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid milestone description",
+			})
+			return
+		}
+	}
+	var dueDate *time.Time
+	if d := c.PostForm("due"); d != "" {
+		due, err := time.Parse("2006-01-02", d)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid due date.  It needs to be in YYYY-MM-DD format",
+			})
+			return
+		}
+		dueDate = &due
+	}
+	open := true
+	if o := c.PostForm("open"); o != "" {
+		open, err = strconv.ParseBool(o)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid value for open",
+			})
+			return
+		}
+	}
+
+	err = database.MilestoneSave(dbOwner, dbName, title, description, dueDate, open)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// milestonesHandler returns the milestones of a database, along with the number of open and closed discussions and
+// merge requests in each of them
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    https://api.dbhub.io/v1/milestones
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+func milestonesHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	_, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	milestones, err := database.Milestones(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if milestones == nil {
+		milestones = []database.Milestone{}
+	}
+	c.JSON(200, milestones)
+}
+
+// labelsWriteAccess checks the user has write access to the requested database, which is needed for managing its
+// labels and milestones.  When they don't, the error response is sent
+func labelsWriteAccess(c *gin.Context) (dbOwner, dbName string, ok bool) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "You don't have write access to this database",
+		})
+		return
+	}
+	return dbOwner, dbName, true
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// licenceAddHandler adds a custom licence, which can then be used by your databases
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F licence="ACME-1.0" -F fullname="ACME Data Licence 1.0" \
+//	    -F file=@acme-1.0.txt https://api.dbhub.io/v1/licenceadd
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "licence" is the short name of the licence, used when choosing it for a database
+//	* "file" is the text of the licence
+//	* "fullname" is the (optional) full name of the licence
+//	* "format" is the (optional) format of the licence text.  Either "text" (the default) or "html"
+//	* "sourceurl" is the (optional) URL to the reference source of the licence
+//	* "order" is the (optional) number of the licence in the display order.  Defaults to after the existing licences
+func licenceAddHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	// Check whether the uploaded licence is too large
+	if c.Request.ContentLength > (com.MaxLicenceSize * 1024 * 1024) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Licence file is too large. Maximum licence upload size is %d MB", com.MaxLicenceSize),
+		})
+		return
+	}
+
+	// Validate the licence details
+	licID := c.PostForm("licence")
+	err := com.ValidateLicence(licID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid licence short name",
+		})
+		return
+	}
+	fullName := c.PostForm("fullname")
+	if fullName != "" {
+		err = com.ValidateLicenceFullName(fullName)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid licence full name",
+			})
+			return
+		}
+	}
+	format := c.PostForm("format")
+	if format == "" {
+		format = "text"
+	}
+	sourceURL := c.PostForm("sourceurl")
+	if sourceURL != "" {
+		err = com.Validate.Var(sourceURL, "url,min=5,max=255")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid source URL",
+			})
+			return
+		}
+	}
+	var order int
+	if o := c.PostForm("order"); o != "" {
+		order, err = strconv.Atoi(o)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid display order",
+			})
+			return
+		}
+	} else {
+		// Place the new licence after the existing ones
+		lics, err := database.GetLicences(loggedInUser)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		for _, l := range lics {
+			if l.Order > order {
+				order = l.Order
+			}
+		}
+		order += 100
+	}
+
+	// Read the licence text
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "The licence text is missing",
+		})
+		return
+	}
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to open uploaded file for reading",
+		})
+		return
+	}
+	defer src.Close()
+	txt := new(bytes.Buffer)
+	_, err = io.Copy(txt, io.LimitReader(src, com.MaxLicenceSize*1024*1024))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	httpStatus, err := com.AddLicence(loggedInUser, licID, fullName, sourceURL, format, order, txt.Bytes())
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	log.Printf("New licence '%s' added to the server by user '%v'", com.SanitiseLogString(licID), loggedInUser)
+	c.JSON(httpStatus, gin.H{
+		"status": "OK",
+	})
+}
+
+// licenceDeleteHandler removes one of your custom licences.  Licences used by a database can't be removed
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F licence="ACME-1.0" https://api.dbhub.io/v1/licencedelete
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "licence" is the short name of the licence to remove
+func licenceDeleteHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	licID := c.PostForm("licence")
+	err := com.ValidateLicence(licID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid licence short name",
+		})
+		return
+	}
+	exists, err := database.CheckLicenceExists(loggedInUser, licID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "A licence with that short name can't be found",
+		})
+		return
+	}
+
+	err = database.DeleteLicence(loggedInUser, licID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	log.Printf("Licence '%s' removed by user '%v'", com.SanitiseLogString(licID), loggedInUser)
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// licenceHandler returns the text of a licence, in its original text or html format
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F licence="CC-BY-4.0" https://api.dbhub.io/v1/licence
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "licence" is the short name of the licence
+func licenceHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	licID := c.PostForm("licence")
+	err := com.ValidateLicence(licID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid licence short name",
+		})
+		return
+	}
+	txt, format, err := database.GetLicence(loggedInUser, licID)
+	if err != nil {
+		if err.Error() == "unknown licence" {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	mimeType := "text/plain; charset=utf-8"
+	if format == "html" {
+		mimeType = "text/html; charset=utf-8"
+	}
+	c.Data(200, mimeType, []byte(txt))
+}
+
+// licenceHistoryHandler returns the commits which changed the licence of a database branch, newest first
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    https://api.dbhub.io/v1/licencehistory
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "branch" is the (optional) database branch.  Uses the default database branch if not specified
+func licenceHistoryHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	_, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	branchName, ok := licenceBranch(c, dbOwner, dbName)
+	if !ok {
+		return
+	}
+
+	history, err := com.LicenceHistory(dbOwner, dbName, branchName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, history)
+}
+
+// licenceSetHandler changes the licence of a database branch, by adding a commit to it.  For forked databases, any
+// warnings about the new licence not being compatible with the licence of the original database are returned too
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F licence="CC-BY-4.0" https://api.dbhub.io/v1/licenceset
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "licence" is the short name of the new licence
+//	* "branch" is the (optional) database branch.  Uses the default database branch if not specified
+func licenceSetHandler(c *gin.Context) {
+	dbOwner, dbName, ok := labelsWriteAccess(c)
+	if !ok {
+		return
+	}
+	branchName, ok := licenceBranch(c, dbOwner, dbName)
+	if !ok {
+		return
+	}
+	licID := c.PostForm("licence")
+	err := com.ValidateLicence(licID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid licence short name",
+		})
+		return
+	}
+
+	commitID, err := com.SetBranchLicence(c.MustGet("user").(string), dbOwner, dbName, branchName, licID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Warn if the new licence isn't compatible with the licence of the database this one was forked from.  The licence
+	// has already been changed by this point, so a failure here doesn't fail the request
+	warnings, err := com.ForkLicenceWarnings(dbOwner, dbName, licID)
+	if err != nil {
+		log.Printf("Checking the licence compatibility of '%s/%s' failed: %v", dbOwner, dbName, err)
+	}
+	if warnings == nil {
+		warnings = []string{}
+	}
+	c.JSON(200, gin.H{
+		"commit_id":        commitID,
+		"licence_warnings": warnings,
+	})
+}
+
+// licencesHandler returns the licences you can use for your databases.  These are the default licences, along with
+// any custom ones you've added
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" https://api.dbhub.io/v1/licences
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+func licencesHandler(c *gin.Context) {
+	lics, err := database.GetLicences(c.MustGet("user").(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, lics)
+}
+
+// licenceBranch returns the branch of a database a licence request is for, writing an error response if the database
+// doesn't have branches or the branch name is invalid
+func licenceBranch(c *gin.Context, dbOwner, dbName string) (branchName string, ok bool) {
+	isLive, _, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if isLive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "That database is a live database.  It doesn't have licences.",
+		})
+		return
+	}
+
+	branchName, err = com.GetFormBranch(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if branchName == "" {
+		branchName, err = database.GetDefaultBranchName(dbOwner, dbName)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+	return branchName, true
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// lineageAddHandler declares that one of your databases was derived from a commit of another database.  Declaring the
+// same source commit again changes its description
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F sourceowner="default" -F sourcename="Assembly Election 2017.sqlite" \
+//	    -F sourcecommit="ee752d746655cf141971a5db011aec2f395213cf76d8aa9c613a6c16902df521" \
+//	    -F description="Cleaned up the candidate names" https://api.dbhub.io/v1/lineageadd
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the derived database
+//	* "dbname" is the name of the derived database
+//	* "sourceowner" is the owner of the database it was derived from
+//	* "sourcename" is the name of the database it was derived from
+//	* "sourcecommit" is the commit it was derived from
+//	* "description" is an (optional) description of how the data was derived
+func lineageAddHandler(c *gin.Context) {
+	dbOwner, dbName, ok := lineageOwnerAccess(c)
+	if !ok {
+		return
+	}
+	srcOwner, srcName, srcCommit, ok := lineageSource(c)
+	if !ok {
+		return
+	}
+	description := c.PostForm("description")
+	if description != "" {
+		err := com.ValidateMarkdown(description)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid description",
+			})
+			return
+		}
+	}
+
+	// The source needs to be a different database, which the user can see
+	if strings.EqualFold(srcOwner, dbOwner) && srcName == dbName {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "A database can't be derived from itself",
+		})
+		return
+	}
+	allowed, err := database.CheckDBPermissions(c.MustGet("user").(string), srcOwner, srcName, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Source database does not exist, or you don't have access to it",
+		})
+		return
+	}
+
+	exists, err := database.LineageAdd(dbOwner, dbName, srcOwner, srcName, srcCommit, description)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "That commit doesn't exist in the source database",
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// lineageHandler returns the lineage graph of a database.  This holds the databases it was derived from, and the
+// databases derived from it, up to 10 steps away in each direction
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    https://api.dbhub.io/v1/lineage
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+func lineageHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	graph, err := database.LineageGraphFor(loggedInUser, dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, graph)
+}
+
+// lineageRemoveHandler removes a declaration that one of your databases was derived from a commit of another database
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F sourceowner="default" -F sourcename="Assembly Election 2017.sqlite" \
+//	    -F sourcecommit="ee752d746655cf141971a5db011aec2f395213cf76d8aa9c613a6c16902df521" \
+//	    https://api.dbhub.io/v1/lineageremove
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the derived database
+//	* "dbname" is the name of the derived database
+//	* "sourceowner" is the owner of the database it was derived from
+//	* "sourcename" is the name of the database it was derived from
+//	* "sourcecommit" is the commit it was derived from
+func lineageRemoveHandler(c *gin.Context) {
+	dbOwner, dbName, ok := lineageOwnerAccess(c)
+	if !ok {
+		return
+	}
+	srcOwner, srcName, srcCommit, ok := lineageSource(c)
+	if !ok {
+		return
+	}
+
+	exists, err := database.LineageRemove(dbOwner, dbName, srcOwner, srcName, srcCommit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "The database isn't declared as derived from that commit",
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// lineageOwnerAccess checks the database in the request exists and is owned by the user, as only the owner of a
+// database can declare where its data came from
+func lineageOwnerAccess(c *gin.Context) (dbOwner, dbName string, ok bool) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !strings.EqualFold(loggedInUser, dbOwner) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Only the owner of a database can change its lineage",
+		})
+		return
+	}
+	return dbOwner, dbName, true
+}
+
+// lineageSource extracts and validates the source database and commit of a lineage declaration
+func lineageSource(c *gin.Context) (srcOwner, srcName, srcCommit string, ok bool) {
+	srcOwner = c.PostForm("sourceowner")
+	srcName = c.PostForm("sourcename")
+	err := com.ValidateUserDB(srcOwner, srcName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid source database owner or name",
+		})
+		return
+	}
+	srcCommit = c.PostForm("sourcecommit")
+	err = com.ValidateCommitID(srcCommit)
+	if err != nil || srcCommit == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid source commit ID",
+		})
+		return
+	}
+	return srcOwner, srcName, srcCommit, true
+}
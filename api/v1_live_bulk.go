@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// bulkDeleteHandler deletes rows from a table of a live database, finding them by the values of their primary key
+// columns
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing live.sqlite" \
+//	    -F table="table1" -F rows='[{"id": 1}, {"id": 2}]' https://api.dbhub.io/v1/bulkdelete
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "table" is the name of the table
+//	* "rows" is the rows, either as a JSON array of objects or as CSV data with the column names on its first line
+//	* "format" is the (optional) format of the rows.  Either "json" (the default) or "csv"
+//	* "atomic" is an (optional) boolean.  When true (the default), either all of the rows are changed or none of them are
+//	* "batchsize" is the (optional) number of rows in each batch, when the operation isn't atomic.  Defaults to 1000
+func bulkDeleteHandler(c *gin.Context) {
+	liveBulk(c, com.LiveBulkDelete)
+}
+
+// bulkInsertHandler inserts rows into a table of a live database
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing live.sqlite" \
+//	    -F table="table1" -F format="csv" -F rows="<table1.csv" https://api.dbhub.io/v1/bulkinsert
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "table" is the name of the table
+//	* "rows" is the rows, either as a JSON array of objects or as CSV data with the column names on its first line
+//	* "format" is the (optional) format of the rows.  Either "json" (the default) or "csv"
+//	* "atomic" is an (optional) boolean.  When true (the default), either all of the rows are changed or none of them are
+//	* "batchsize" is the (optional) number of rows in each batch, when the operation isn't atomic.  Defaults to 1000
+func bulkInsertHandler(c *gin.Context) {
+	liveBulk(c, com.LiveBulkInsert)
+}
+
+// bulkUpsertHandler inserts rows into a table of a live database, changing the existing rows with the same primary key
+// instead
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing live.sqlite" \
+//	    -F table="table1" -F rows='[{"id": 1, "Name": "Some name"}]' https://api.dbhub.io/v1/bulkupsert
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "table" is the name of the table
+//	* "rows" is the rows, either as a JSON array of objects or as CSV data with the column names on its first line
+//	* "format" is the (optional) format of the rows.  Either "json" (the default) or "csv"
+//	* "atomic" is an (optional) boolean.  When true (the default), either all of the rows are changed or none of them are
+//	* "batchsize" is the (optional) number of rows in each batch, when the operation isn't atomic.  Defaults to 1000
+func bulkUpsertHandler(c *gin.Context) {
+	liveBulk(c, com.LiveBulkUpsert)
+}
+
+// liveBulk reads a bulk operation request, and sends it to the live node of the database
+func liveBulk(c *gin.Context, op com.LiveBulkOperation) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Bulk operations change the database, so need write access to it
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "You don't have write access to that database",
+		})
+		return
+	}
+
+	// Only live databases can be changed this way
+	isLive, liveNode, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !isLive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "That database isn't a live database.  The rows of standard databases are changed with " +
+				"/v1/rowsinsert, /v1/rowsupdate, and /v1/rowsdelete instead.",
+		})
+		return
+	}
+	if liveNode == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "No job queue node available for request",
+		})
+		return
+	}
+
+	table := c.PostForm("table")
+	err = com.ValidatePGTable(table)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid table name",
+		})
+		return
+	}
+	atomic := true
+	if z := c.PostForm("atomic"); z != "" {
+		atomic, err = strconv.ParseBool(z)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid atomic value",
+			})
+			return
+		}
+	}
+	batchSize := com.LiveBulkBatchSize
+	if z := c.PostForm("batchsize"); z != "" {
+		batchSize, err = strconv.Atoi(z)
+		if err != nil || batchSize < 1 || batchSize > com.LiveBulkMaxBatchSize {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("The batch size needs to be between 1 and %d", com.LiveBulkMaxBatchSize),
+			})
+			return
+		}
+	}
+
+	// Read the rows
+	columns, rows, err := com.ParseBulkRows(c.PostForm("format"), strings.NewReader(c.PostForm("rows")))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Send the bulk operation to our job queue backend
+	req := com.JobRequestBulk{
+		Columns:   columns,
+		Operation: op,
+		Rows:      rows,
+		Table:     table,
+	}
+	result, err := com.LiveBulk(liveNode, loggedInUser, dbOwner, dbName, req, batchSize, atomic)
+	if jobQueueFull(c, err) {
+		return
+	}
+	if errors.Is(err, database.ErrDBArchived) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	log.Printf("Bulk %s on '%s/%s' by '%s': %d rows changed", op, dbOwner, com.SanitiseLogString(dbName),
+		loggedInUser, result.RowsChanged)
+
+	// When a batch failed, the error is returned along with how far the operation got
+	if result.Error != "" {
+		c.JSON(http.StatusBadRequest, result)
+		return
+	}
+	c.JSON(200, result)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// ftsCreateHandler creates a full text search index of a table in a live database.  The index is an FTS5 table, which
+// is kept up to date with the changes to the table by triggers created along with it.  It's searched using the FTS5
+// MATCH syntax, eg. SELECT * FROM table1_fts WHERE table1_fts MATCH 'some words'
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing live.sqlite" \
+//	    -F table="table1" -F columns='["Name", "Notes"]' https://api.dbhub.io/v1/ftscreate
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "table" is the name of the table to index
+//	* "columns" is a JSON array of the columns to index
+//	* "name" is the (optional) name of the index.  Defaults to the table name followed by "_fts"
+//	* "tokenizer" is the (optional) way text is split into words.  Either "unicode61" (the default), "ascii", "porter"
+//	  (which also matches other forms of the same English word), or "trigram" (for matching parts of words)
+func ftsCreateHandler(c *gin.Context) {
+	loggedInUser, dbOwner, dbName, liveNode, ok := ftsDatabase(c)
+	if !ok {
+		return
+	}
+
+	// Read the details of the index
+	table := c.PostForm("table")
+	err := com.ValidatePGTable(table)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid table name",
+		})
+		return
+	}
+	name := c.PostForm("name")
+	if name == "" {
+		name = table + "_fts"
+	}
+	err = com.ValidatePGTable(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid index name",
+		})
+		return
+	}
+	var columns []string
+	err = json.Unmarshal([]byte(c.PostForm("columns")), &columns)
+	if err != nil || len(columns) == 0 || len(columns) > com.LiveFTSMaxColumns {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("The columns need to be a JSON array of between 1 and %d column names",
+				com.LiveFTSMaxColumns),
+		})
+		return
+	}
+	tokenizer := c.PostForm("tokenizer")
+	if tokenizer == "" {
+		tokenizer = "unicode61"
+	}
+	if _, ok := com.LiveFTSTokenizers[tokenizer]; !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Unknown tokenizer.  It needs to be one of 'unicode61', 'ascii', 'porter', or 'trigram'",
+		})
+		return
+	}
+
+	// Create the index
+	req := com.JobRequestFTS{
+		Columns:   columns,
+		Name:      name,
+		Table:     table,
+		Tokenizer: tokenizer,
+	}
+	failure, err := com.LiveFTSCreate(liveNode, loggedInUser, dbOwner, dbName, req)
+	if !ftsResult(c, failure, err) {
+		return
+	}
+	log.Printf("Full text search index '%s' created on '%s/%s' by '%s'", com.SanitiseLogString(name), dbOwner,
+		com.SanitiseLogString(dbName), loggedInUser)
+	c.JSON(200, gin.H{
+		"name":   name,
+		"status": "OK",
+	})
+}
+
+// ftsDropHandler removes a full text search index from a live database, along with the triggers keeping it up to date.
+// The indexed table isn't changed
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing live.sqlite" \
+//	    -F name="table1_fts" https://api.dbhub.io/v1/ftsdrop
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "name" is the name of the index
+func ftsDropHandler(c *gin.Context) {
+	loggedInUser, dbOwner, dbName, liveNode, ok := ftsDatabase(c)
+	if !ok {
+		return
+	}
+	name := c.PostForm("name")
+	err := com.ValidatePGTable(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid index name",
+		})
+		return
+	}
+
+	failure, err := com.LiveFTSDrop(liveNode, loggedInUser, dbOwner, dbName, name)
+	if !ftsResult(c, failure, err) {
+		return
+	}
+	log.Printf("Full text search index '%s' removed from '%s/%s' by '%s'", com.SanitiseLogString(name), dbOwner,
+		com.SanitiseLogString(dbName), loggedInUser)
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// ftsDatabase reads the live database a full text search index call is for, checking the user can change it.  An error
+// response has been sent when ok is false
+func ftsDatabase(c *gin.Context) (loggedInUser, dbOwner, dbName, liveNode string, ok bool) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Indexes change the database, so need write access to it
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "You don't have write access to that database",
+		})
+		return
+	}
+
+	// Full text search indexes are only available for live databases
+	isLive, liveNode, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !isLive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Full text search indexes are only available for live databases",
+		})
+		return
+	}
+	if liveNode == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "No job queue node available for request",
+		})
+		return
+	}
+	return loggedInUser, dbOwner, dbName, liveNode, true
+}
+
+// ftsResult checks the outcome of a full text search index call, sending the error response when it failed.  The
+// failures reported by the live node are about the request, such as a missing table or column
+func ftsResult(c *gin.Context, failure string, err error) bool {
+	if jobQueueFull(c, err) {
+		return false
+	}
+	if errors.Is(err, database.ErrDBArchived) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return false
+	}
+	if failure != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": failure,
+		})
+		return false
+	}
+	return true
+}
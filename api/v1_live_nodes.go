@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// jobQueueRetryAfter is the number of seconds callers are asked to wait before trying again, when the job queue of a
+// live node is full
+const jobQueueRetryAfter = 5
+
+// jobQueueHandler returns the number of jobs waiting and in progress in the live job queue, and how long jobs have
+// waited to be picked up over the last hour, for each live node and priority class.  It can only be used by the
+// instance admins
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" https://api.dbhub.io/v1/jobqueue
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+func jobQueueHandler(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	list, err := database.GetJobQueueStats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if list == nil {
+		list = []database.JobQueueStats{}
+	}
+	c.JSON(200, list)
+}
+
+// liveNodesHandler returns the statistics last reported by each live node, including the state and recent use of the
+// databases it holds.  It can only be used by the instance admins
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" https://api.dbhub.io/v1/livenodes
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+func liveNodesHandler(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	list, err := database.GetLiveNodeStats()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if list == nil {
+		list = []database.LiveNodeStats{}
+	}
+	c.JSON(200, list)
+}
+
+// liveNodeStateHandler changes the state of a live node.  Draining a node stops new databases being placed on it, and
+// moves the databases it holds to the other nodes.  A node can only be decommissioned once it holds no databases.  It
+// can only be used by the instance admins
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F node="live1" -F state="draining" https://api.dbhub.io/v1/livenodestate
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "node" is the name of the live node
+//	* "state" is the new state of the node.  Either "active", "draining", or "decommissioned"
+func liveNodeStateHandler(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	node := c.PostForm("node")
+	state := c.PostForm("state")
+	if !database.LiveNodeStates[state] {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid state.  It needs to be one of 'active', 'draining', or 'decommissioned'",
+		})
+		return
+	}
+
+	// Nodes still holding databases need draining first
+	if state == "decommissioned" {
+		count, err := database.LiveNodeDatabaseCount(node)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if count > 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "Databases are still placed on the node.  It needs to be drained first",
+			})
+			return
+		}
+	}
+
+	exists, err := database.SetLiveNodeState(node, state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Live node not found",
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"node":  node,
+		"state": state,
+	})
+}
+
+// livePlacementsHandler returns the placement history of a live database, showing the live nodes it has been on.  It
+// can only be used by the instance admins
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing live.sqlite" \
+//	    https://api.dbhub.io/v1/liveplacements
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+func livePlacementsHandler(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	dbOwner, dbName, _, err := com.GetFormODC(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.Set("owner", dbOwner)
+	c.Set("database", dbName)
+
+	list, err := database.LivePlacements(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if list == nil {
+		list = []database.LivePlacement{}
+	}
+	c.JSON(200, list)
+}
+
+// jobQueueFull checks whether a live database request was refused because the job queue of its live node is full,
+// sending a 503 response asking the caller to try again shortly when it was
+func jobQueueFull(c *gin.Context, err error) bool {
+	if !errors.Is(err, com.ErrJobQueueFull) {
+		return false
+	}
+	c.Header("Retry-After", strconv.Itoa(jobQueueRetryAfter))
+	c.JSON(http.StatusServiceUnavailable, gin.H{
+		"error": err.Error(),
+	})
+	return true
+}
+
+// requireAdmin checks the logged in user is one of the instance admins, sending an error response when they aren't
+func requireAdmin(c *gin.Context) bool {
+	usr, err := database.User(c.MustGet("user").(string))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return false
+	}
+	if !usr.IsAdmin {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Only administrators can use this call",
+		})
+		return false
+	}
+	return true
+}
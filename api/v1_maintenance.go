@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// maintenanceHandler returns whether the server is in read only mode.  While it is, calls which change anything are
+// refused with a 503 status
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" https://api.dbhub.io/v1/maintenance
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+func maintenanceHandler(c *gin.Context) {
+	conf, state := com.MaintenanceStatus()
+	ro, msg := com.ReadOnlyMode()
+	c.JSON(200, gin.H{
+		"read_only":        ro,
+		"message":          msg,
+		"config_read_only": conf.ReadOnly,
+		"changed_by":       state.ChangedBy,
+		"date_changed":     state.DateChanged,
+	})
+}
+
+// maintenanceSetHandler switches read only mode on or off for all of the daemons.  This call keeps working while in read
+// only mode, so it can be switched off again.  Read only mode set in the configuration file can't be switched off here.
+// It can only be used by the instance admins
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F readonly="true" -F message="Back in 30 minutes" \
+//	    https://api.dbhub.io/v1/maintenanceset
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "readonly" is either "true" or "false"
+//	* "message" is the (optional) message shown to people while in read only mode
+func maintenanceSetHandler(c *gin.Context) {
+	// This isn't behind authRequireWritePermission, as that refuses everything while in read only mode
+	key := c.MustGet("key").(database.APIKey)
+	if key.Permissions != database.MayReadAndWrite {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error": "This function requires an API key with Write access.  The API key provided doesn't have it.",
+		})
+		return
+	}
+	if !requireAdmin(c) {
+		return
+	}
+	loggedInUser := c.MustGet("user").(string)
+
+	readOnly, err := strconv.ParseBool(c.PostForm("readonly"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid readonly value.  It needs to be either true or false",
+		})
+		return
+	}
+	message := c.PostForm("message")
+	if len(message) > 1024 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "The message can't be longer than 1024 characters",
+		})
+		return
+	}
+
+	err = com.SetReadOnlyMode(loggedInUser, readOnly, message)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
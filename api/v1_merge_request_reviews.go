@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// requiredApprovalsMax is the largest number of approvals a database can require merge requests to have
+const requiredApprovalsMax = 10
+
+// mergeRequestReviewHandler approves the head commit of a merge request, or requests changes to it.  Only users with
+// write access to the database can review merge requests, and not ones they created themselves
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F discid="3" -F state="approved" https://api.dbhub.io/v1/mergerequestreview
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "discid" is the ID of the merge request
+//	* "state" is the outcome of the review, either "approved" or "changes_requested"
+//	* "body" is an (optional) comment on the merge request, explaining the review
+func mergeRequestReviewHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Only users with write access to the database can review merge requests
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "You don't have write access to this database",
+		})
+		return
+	}
+
+	// Validate the merge request ID
+	discID, err := strconv.Atoi(c.PostForm("discid"))
+	if err != nil || discID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid merge request ID",
+		})
+		return
+	}
+
+	// Validate the review
+	review := database.MergeRequestReview{
+		Body:  c.PostForm("body"),
+		State: c.PostForm("state"),
+	}
+	validState := false
+	for _, z := range com.ReviewStates {
+		if review.State == z {
+			validState = true
+		}
+	}
+	if !validState {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("The state needs to be one of: %s", strings.Join(com.ReviewStates, ", ")),
+		})
+		return
+	}
+	if review.Body != "" && com.ValidateMarkdown(review.Body) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid review body",
+		})
+		return
+	}
+
+	// Retrieve the merge request
+	disc, err := database.Discussions(dbOwner, dbName, database.MERGE_REQUEST, discID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if len(disc) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Merge request not found",
+		})
+		return
+	}
+	mr := disc[0]
+	if !mr.Open {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Cannot review a closed merge request",
+		})
+		return
+	}
+	if strings.EqualFold(mr.Creator, loggedInUser) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "You can't review your own merge request",
+		})
+		return
+	}
+	if len(mr.MRDetails.Commits) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "The merge request has no commits to review",
+		})
+		return
+	}
+
+	review.Commit = mr.MRDetails.Commits[0].ID
+	err = database.MergeRequestReviewSave(dbOwner, dbName, discID, loggedInUser, review)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	reviews, err := database.MergeRequestReviews(dbOwner, dbName, discID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, reviews)
+}
+
+// mergeRequestReviewsHandler returns the reviews of a merge request.  Each reviewer's latest review is returned, along
+// with the commit it was given for
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F discid="3" https://api.dbhub.io/v1/mergerequestreviews
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "discid" is the ID of the merge request
+func mergeRequestReviewsHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	_, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Validate the merge request ID
+	discID, err := strconv.Atoi(c.PostForm("discid"))
+	if err != nil || discID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid merge request ID",
+		})
+		return
+	}
+
+	reviews, err := database.MergeRequestReviews(dbOwner, dbName, discID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if reviews == nil {
+		reviews = []database.MergeRequestReview{}
+	}
+	c.JSON(200, reviews)
+}
+
+// requiredApprovalsHandler returns the number of approvals of its head commit a merge request to a database needs
+// before it can be merged
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    https://api.dbhub.io/v1/requiredapprovals
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+func requiredApprovalsHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	_, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	approvals, err := database.RequiredApprovals(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"required_approvals": approvals,
+	})
+}
+
+// requiredApprovalsSetHandler sets the number of approvals of its head commit a merge request to one of your databases
+// needs before it can be merged
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F approvals="2" https://api.dbhub.io/v1/requiredapprovalsset
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "approvals" is the number of approvals needed.  Merge requests can be merged without being approved when it's 0
+func requiredApprovalsSetHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !strings.EqualFold(loggedInUser, dbOwner) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Only the owner of a database can change the approvals its merge requests need",
+		})
+		return
+	}
+
+	approvals, err := strconv.Atoi(c.PostForm("approvals"))
+	if err != nil || approvals < 0 || approvals > requiredApprovalsMax {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("The number of approvals needs to be between 0 and %d", requiredApprovalsMax),
+		})
+		return
+	}
+
+	err = database.RequiredApprovalsSet(dbOwner, dbName, approvals)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
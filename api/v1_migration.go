@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// migrationHandler returns an SQL script which upgrades a copy of a database from one commit to another, by altering
+// the changed tables and updating their data
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F fromcommit="ea12..." https://api.dbhub.io/v1/migration
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "fromcommit" is the commit ID the copy of the database is at
+//	* "commit" is the (optional) commit ID to upgrade the copy to.  Uses the head commit of the default branch if not specified
+//	* "schemaonly" is an (optional) boolean for leaving the data out of the script.  Defaults to false
+func migrationHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, commitID, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Live databases don't have commits to migrate between
+	isLive, _, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if isLive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "That database is a live database.  Migration scripts are only available for standard databases.",
+		})
+		return
+	}
+
+	// Get the commit the copy of the database is at
+	fromCommit := c.PostForm("fromcommit")
+	if fromCommit == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing commit ID to migrate from",
+		})
+		return
+	}
+	if err = com.ValidateCommitID(fromCommit); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid commit ID to migrate from",
+		})
+		return
+	}
+
+	// Use the head commit of the default branch when no commit to migrate to was given
+	if commitID == "" {
+		commitID, err = database.DefaultCommit(dbOwner, dbName)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+
+	// Make sure both commits are part of the database
+	for _, z := range []string{fromCommit, commitID} {
+		exists, err := database.CommitExists(dbOwner, dbName, z)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": fmt.Sprintf("Commit '%s' doesn't exist in database '%s/%s'", z, dbOwner, dbName),
+			})
+			return
+		}
+	}
+
+	// Get the (optional) "schemaonly" boolean value
+	schemaOnly := false
+	if s := c.PostForm("schemaonly"); s != "" {
+		schemaOnly, err = strconv.ParseBool(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid value for schemaonly",
+			})
+			return
+		}
+	}
+
+	script, err := com.MigrationScript(dbOwner, dbName, fromCommit, commitID, loggedInUser, schemaOnly)
+	if errors.Is(err, com.ErrClientEncrypted) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-migration.sql"`, commitID))
+	c.Data(200, "application/sql", []byte(script))
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// abuseReportHandler reports a database, or a comment in one of its discussions, to the instance admins
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" -F comid="1234" \
+//	    -F reason="spam" -F details="Advertising links" https://api.dbhub.io/v1/abusereport
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "comid" is the (optional) ID of a discussion comment on the database to report, rather than the database itself
+//	* "reason" is one of "copyright", "harassment", "illegal", "malware", "spam", or "other"
+//	* "details" is an (optional) explanation for the admins
+func abuseReportHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Validate the report details
+	var comID int64
+	if z := c.PostForm("comid"); z != "" {
+		comID, err = strconv.ParseInt(z, 10, 64)
+		if err != nil || comID < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid comment ID",
+			})
+			return
+		}
+	}
+	reason := c.PostForm("reason")
+	if !com.ValidAbuseReason(reason) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Unknown reason.  Must be one of '%s'", strings.Join(com.AbuseReasons, "', '")),
+		})
+		return
+	}
+	details, err := com.CheckUnicode(c.PostForm("details"), false)
+	if err != nil || utf8.RuneCountInString(details) > com.AbuseReportMaxDetails {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Invalid details.  They can be up to %d characters long", com.AbuseReportMaxDetails),
+		})
+		return
+	}
+
+	// Record the report
+	reportID, exists, err := database.AbuseReportAdd(loggedInUser, dbOwner, dbName, comID, reason, details)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Comment not found",
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"report_id": reportID,
+		"status":    "OK",
+	})
+}
+
+// blockHandler blocks a user.  Their discussion comments are hidden from you, and optionally they can no longer fork
+// your databases.  Blocking an already blocked user changes whether they can fork your databases
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F user="spammer" -F preventforks="true" https://api.dbhub.io/v1/block
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "user" is the user to block
+//	* "preventforks" is an (optional) boolean for whether the user is also stopped from forking your databases
+func blockHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	user := c.PostForm("user")
+	err := com.ValidateUser(user)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user name",
+		})
+		return
+	}
+	if strings.ToLower(user) == strings.ToLower(loggedInUser) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "You can't block yourself",
+		})
+		return
+	}
+	preventForks := false
+	if z := c.PostForm("preventforks"); z != "" {
+		preventForks, err = strconv.ParseBool(z)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid value for preventforks",
+			})
+			return
+		}
+	}
+
+	exists, err := database.BlockUser(loggedInUser, user, preventForks)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "User not found",
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// blocksHandler returns the users you've blocked
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" https://api.dbhub.io/v1/blocks
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+func blocksHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	list, err := database.BlockedUsers(loggedInUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, list)
+}
+
+// heldContentHandler returns the new discussions, comments, and database descriptions held for moderation by the spam
+// filters, oldest first.  It can only be used by the instance admins
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" https://api.dbhub.io/v1/heldcontent
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+func heldContentHandler(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	list, err := database.HeldContentList()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, list)
+}
+
+// heldContentActionHandler publishes or rejects content held for moderation by the spam filters.  It can only be used
+// by the instance admins
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F held="42" -F action="publish" https://api.dbhub.io/v1/heldcontentaction
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "held" is the ID of the held content
+//	* "action" is one of:
+//	  * "publish" to publish the content, as it isn't spam
+//	  * "reject" to throw the content away
+//	  * "ban" to throw the content away, and ban its author
+func heldContentActionHandler(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+	loggedInUser := c.MustGet("user").(string)
+
+	heldID, err := strconv.ParseInt(c.PostForm("held"), 10, 64)
+	if err != nil || heldID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid held content ID",
+		})
+		return
+	}
+	action := c.PostForm("action")
+	if action != "publish" && action != "reject" && action != "ban" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Unknown action.  Must be one of 'publish', 'reject', or 'ban'",
+		})
+		return
+	}
+	h, exists, err := database.HeldContentGet(heldID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Held content not found",
+		})
+		return
+	}
+	c.Set("owner", h.DBOwner)
+	c.Set("database", h.DBName)
+
+	// Take the action
+	switch action {
+	case "publish":
+		err = com.PublishHeldContent(h)
+	case "ban":
+		if strings.ToLower(h.User) == strings.ToLower(loggedInUser) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "You can't ban yourself",
+			})
+			return
+		}
+		_, err = database.BanUser(h.User, true)
+		if err == nil {
+			err = database.HeldContentDelete(h.HeldID)
+		}
+	case "reject":
+		err = database.HeldContentDelete(h.HeldID)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Let the spam filters learn from the decision
+	com.SpamDecision(h, action != "publish")
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// moderationActionHandler closes an abuse report, taking action on the reported database or comment.  It can only be
+// used by the instance admins
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F report="42" -F action="hide" https://api.dbhub.io/v1/moderationaction
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "report" is the ID of the abuse report
+//	* "action" is one of:
+//	  * "dismiss" to close the report without doing anything
+//	  * "hide" to hide the comment, or make the database private
+//	  * "delete" to delete the comment or database
+//	  * "ban" to ban the author of the comment, or the owner of the database
+func moderationActionHandler(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+	loggedInUser := c.MustGet("user").(string)
+
+	reportID, err := strconv.ParseInt(c.PostForm("report"), 10, 64)
+	if err != nil || reportID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid report ID",
+		})
+		return
+	}
+	action := c.PostForm("action")
+	if action != "dismiss" && action != "hide" && action != "delete" && action != "ban" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Unknown action.  Must be one of 'dismiss', 'hide', 'delete', or 'ban'",
+		})
+		return
+	}
+	r, exists, err := database.AbuseReportGet(reportID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Abuse report not found",
+		})
+		return
+	}
+	if r.Status != "open" {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "That abuse report has already been closed",
+		})
+		return
+	}
+	if r.ComID != 0 && r.Commenter == "" && action != "dismiss" {
+		// The reported comment has been deleted since, so there's nothing left to act on
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "The reported comment no longer exists, so the report can only be dismissed",
+		})
+		return
+	}
+	c.Set("owner", r.DBOwner)
+	c.Set("database", r.DBName)
+
+	// Take the action
+	status := "resolved"
+	switch action {
+	case "dismiss":
+		status, action = "dismissed", ""
+	case "hide":
+		if r.ComID != 0 {
+			err = database.HideComment(r.ComID)
+		} else {
+			err = database.HideDatabase(r.DBOwner, r.DBName)
+			if err == nil {
+				err = com.InvalidateCacheEntry(r.DBOwner, r.DBOwner, r.DBName, "")
+			}
+		}
+	case "delete":
+		if r.ComID != 0 {
+			err = database.DeleteComment(r.DBOwner, r.DBName, r.DiscID, int(r.ComID))
+		} else if !removeDatabase(c, r.DBOwner, r.DBName) {
+			return
+		}
+	case "ban":
+		user := r.DBOwner
+		if r.ComID != 0 {
+			user = r.Commenter
+		}
+		if strings.ToLower(user) == strings.ToLower(loggedInUser) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "You can't ban yourself",
+			})
+			return
+		}
+		_, err = database.BanUser(user, true)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	err = database.AbuseReportResolve(r, loggedInUser, status, action)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// moderationQueueHandler returns the abuse reports waiting to be reviewed, oldest first.  It can only be used by the
+// instance admins
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" https://api.dbhub.io/v1/moderationqueue
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "status" is the (optional) status of the reports to return.  Either "open" (the default), "resolved",
+//	  "dismissed", or "all" for the most recent reports of any status
+func moderationQueueHandler(c *gin.Context) {
+	if !requireAdmin(c) {
+		return
+	}
+
+	status := c.DefaultPostForm("status", "open")
+	switch status {
+	case "all":
+		status = ""
+	case "open", "resolved", "dismissed":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Unknown status.  Must be one of 'open', 'resolved', 'dismissed', or 'all'",
+		})
+		return
+	}
+	list, err := database.AbuseReports(status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, list)
+}
+
+// unblockHandler unblocks a user
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F user="spammer" https://api.dbhub.io/v1/unblock
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "user" is the user to unblock
+func unblockHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	user := c.PostForm("user")
+	err := com.ValidateUser(user)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user name",
+		})
+		return
+	}
+	exists, err := database.UnblockUser(loggedInUser, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("User '%s' isn't blocked", user),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// notificationPrefsHandler returns the notification settings of the user
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" https://api.dbhub.io/v1/notificationprefs
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+func notificationPrefsHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	prefs, err := database.NotificationPreferences(loggedInUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, prefs)
+}
+
+// notificationPrefsSaveHandler changes the notification settings of the user.  Only the settings provided are changed
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F comments="false" -F digest="weekly" \
+//	    https://api.dbhub.io/v1/notificationprefssave
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "email" is an (optional) boolean turning all notification emails on or off
+//	* "comments", "discussions", "merge_requests", and "releases" are (optional) booleans turning emails for each
+//	  type of event on or off
+//	* "digest" is the (optional) digest mode.  Either "none" for an email per event, "daily", or "weekly"
+//	* "dbowner" and "dbname" are the (optional) owner and name of a watched database, whose setting is changed
+//	* "dbemail" is (optional), used along with "dbowner" and "dbname".  Either "true", "false", or "default" to remove the
+//	  setting for the database
+//	* "dbwatch" is (optional), used along with "dbowner" and "dbname".  The activity on the database to be notified about.  Either
+//	  "all", "releases" for new releases only, or "participating" for only the discussions and merge requests you've
+//	  created or commented on
+func notificationPrefsSaveHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	prefs, err := database.NotificationPreferences(loggedInUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Apply the general settings
+	for field, setting := range map[string]*bool{
+		"comments":       &prefs.Comments,
+		"discussions":    &prefs.Discussions,
+		"email":          &prefs.Email,
+		"merge_requests": &prefs.MergeRequests,
+		"releases":       &prefs.Releases,
+	} {
+		if v := c.PostForm(field); v != "" {
+			*setting, err = strconv.ParseBool(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": fmt.Sprintf("Invalid value for %s", field),
+				})
+				return
+			}
+		}
+	}
+	switch d := c.PostForm("digest"); d {
+	case "":
+	case "none":
+		prefs.Digest = database.DigestNone
+	case string(database.DigestDaily), string(database.DigestWeekly):
+		prefs.Digest = database.DigestMode(d)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid digest mode",
+		})
+		return
+	}
+
+	// Apply the setting for a specific database
+	dbOwner := c.PostForm("dbowner")
+	dbName := c.PostForm("dbname")
+	if dbOwner != "" || dbName != "" {
+		err = com.ValidateUserDB(dbOwner, dbName)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		watched, err := database.CheckDBWatched(loggedInUser, dbOwner, dbName)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if !watched {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": fmt.Sprintf("You're not watching database '%s/%s'", dbOwner, dbName),
+			})
+			return
+		}
+
+		// Use the correctly capitalised owner name, as that's what events are matched against
+		usr, err := database.User(dbOwner)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		dbKey := fmt.Sprintf("%s/%s", usr.Username, dbName)
+		switch v := c.PostForm("dbemail"); v {
+		case "":
+		case "default":
+			delete(prefs.Databases, dbKey)
+		default:
+			prefs.Databases[dbKey], err = strconv.ParseBool(v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "Invalid value for dbemail",
+				})
+				return
+			}
+		}
+
+		// Change the type of activity being watched for
+		if v := c.PostForm("dbwatch"); v != "" {
+			mode := database.WatchMode(v)
+			if !mode.Valid() {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "Invalid value for dbwatch",
+				})
+				return
+			}
+			err = database.SetDBWatchMode(loggedInUser, dbOwner, dbName, mode)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+			err = com.InvalidateCacheEntry(loggedInUser, dbOwner, dbName, "") // Empty string indicates "for all versions"
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+		}
+	}
+
+	// Save the updated settings
+	err = database.SetNotificationPreferences(loggedInUser, prefs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, prefs)
+}
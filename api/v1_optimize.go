@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// optimizeHandler runs VACUUM and/or ANALYZE on a database.  Live databases are optimised in place, through the job
+// queue.  For standard databases, the optimised database is added as a new commit on the branch.  The call returns
+// once the optimisation has finished, and its progress can be followed in the meantime with optimizeStatusHandler
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing live.sqlite" \
+//	    -F vacuum="true" -F analyze="true" https://api.dbhub.io/v1/optimize
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "vacuum" is an (optional) boolean, for whether to run VACUUM.  Defaults to true
+//	* "analyze" is an (optional) boolean, for whether to run ANALYZE.  Defaults to true
+//	* "branch" is the (optional) database branch, for standard databases.  Uses the default database branch if not specified
+//	* "commitmsg" is the (optional) commit message for the new commit, for standard databases
+func optimizeHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	// Extract the database owner name and database name from the request.  Optimisations apply to the whole database,
+	// so any commit ID given is ignored
+	dbOwner, dbName, _, err := com.GetFormODC(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Store database path for later logging
+	c.Set("owner", dbOwner)
+	c.Set("database", dbName)
+
+	// Work out which steps to run.  Both are run unless asked otherwise
+	req := com.JobRequestOptimize{Analyze: true, Vacuum: true}
+	for _, f := range []struct {
+		name  string
+		value *bool
+	}{
+		{"analyze", &req.Analyze},
+		{"vacuum", &req.Vacuum},
+	} {
+		if z := c.PostForm(f.name); z != "" {
+			*f.value, err = strconv.ParseBool(z)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": fmt.Sprintf("Invalid %s value", f.name),
+				})
+				return
+			}
+		}
+	}
+	if !req.Analyze && !req.Vacuum {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "At least one of vacuum and analyze needs to be true",
+		})
+		return
+	}
+
+	// Make sure the user has write access to the database
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Database '%s/%s' doesn't exist", dbOwner, dbName),
+		})
+		return
+	}
+
+	// Check if the database is a live database, and get the node/queue to send the request to
+	isLive, liveNode, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Standard databases get a new commit with the optimised database
+	if !isLive {
+		branchName := c.PostForm("branch")
+		if branchName != "" {
+			err = com.ValidateBranchName(branchName)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "Invalid branch name",
+				})
+				return
+			}
+		}
+		commitMsg := c.PostForm("commitmsg")
+		if commitMsg != "" {
+			err = com.ValidateMarkdown(commitMsg)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": "Invalid commit message",
+				})
+				return
+			}
+		}
+		commitID, sizeBefore, sizeAfter, httpStatus, err := com.OptimizeCommit(loggedInUser, dbOwner, dbName,
+			branchName, commitMsg, req)
+		if err != nil {
+			c.JSON(httpStatus, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		log.Printf("Database '%s/%s' optimised by '%s' in commit '%s'", dbOwner, com.SanitiseLogString(dbName),
+			loggedInUser, commitID)
+		c.JSON(200, gin.H{
+			"commit":      commitID,
+			"size_after":  sizeAfter,
+			"size_before": sizeBefore,
+			"url":         server + filepath.Join("/", dbOwner, dbName) + "?commit=" + commitID,
+		})
+		return
+	}
+
+	// Live databases are optimised in place by their live node
+	if liveNode == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "No job queue node available for request",
+		})
+		return
+	}
+	sizeBefore, sizeAfter, err := com.LiveOptimize(liveNode, loggedInUser, dbOwner, dbName, req)
+	if jobQueueFull(c, err) {
+		return
+	}
+	if err != nil {
+		httpStatus := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, database.ErrDBArchived):
+			httpStatus = http.StatusForbidden
+		case errors.Is(err, database.ErrOptimizationRunning):
+			httpStatus = http.StatusConflict
+		}
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	log.Printf("Live database '%s/%s' optimised by '%s'", dbOwner, com.SanitiseLogString(dbName), loggedInUser)
+	c.JSON(200, gin.H{
+		"size_after":  sizeAfter,
+		"size_before": sizeBefore,
+	})
+}
+
+// optimizeStatusHandler returns the state and progress of the most recent optimisation of a database.  While it runs,
+// the stage it's up to and the number of pages done so far are included
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing live.sqlite" \
+//	    https://api.dbhub.io/v1/optimizestatus
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+func optimizeStatusHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	// Extract the database owner name and database name from the request.  Optimisations apply to the whole database,
+	// so any commit ID given is ignored
+	dbOwner, dbName, _, err := com.GetFormODC(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Store database path for later logging
+	c.Set("owner", dbOwner)
+	c.Set("database", dbName)
+
+	// Only the users who can optimise the database can see its optimisations
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Database '%s/%s' doesn't exist", dbOwner, dbName),
+		})
+		return
+	}
+
+	opt, err := database.OptimizationStatus(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if opt == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "The database hasn't been optimised yet",
+		})
+		return
+	}
+	c.JSON(200, opt)
+}
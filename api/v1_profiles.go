@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// contributionsHandler returns the contributions a user made each day over the last year, for drawing a contribution
+// heatmap.  Commits, uploads, and discussion posts are counted, for the databases you can see.  Days without any
+// contributions are left out
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F username="justinclift" https://api.dbhub.io/v1/contributions
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "username" is the (optional) name of the user.  Defaults to yourself
+func contributionsHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+	userName, ok := formUser(c, loggedInUser)
+	if !ok {
+		return
+	}
+	exists, err := database.CheckUserExists(userName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Unknown user: %s", userName),
+		})
+		return
+	}
+
+	graph, err := com.UserContributions(loggedInUser, userName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, graph)
+}
+
+// profileHandler returns the public profile of a user, including their bio, links, and public databases with the
+// pinned ones first
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F username="justinclift" https://api.dbhub.io/v1/profile
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "username" is the (optional) name of the user.  Defaults to yourself
+func profileHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+	userName, ok := formUser(c, loggedInUser)
+	if !ok {
+		return
+	}
+
+	profile, exists, err := com.GetUserProfile(userName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Unknown user: %s", userName),
+		})
+		return
+	}
+	c.JSON(200, profile)
+}
+
+// profilePinHandler pins one of your standard databases to your public profile, or unpins it.  Up to 6 databases can
+// be pinned, and they're shown first in the order you choose
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbname="Join Testing.sqlite" -F pinned="true" -F position="1" \
+//	    https://api.dbhub.io/v1/profilepin
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbname" is the name of the database
+//	* "pinned" is a boolean.  Either "true" to pin the database, or "false" to unpin it
+//	* "position" is the (optional) number of the place among your pinned databases to put it, starting at 1.  Defaults to the end
+func profilePinHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	dbName, err := com.GetDatabase(c.Request, false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.Set("owner", loggedInUser)
+	c.Set("database", dbName)
+	pinned, err := strconv.ParseBool(c.PostForm("pinned"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid value for pinned",
+		})
+		return
+	}
+	position := 0
+	if p := c.PostForm("position"); p != "" {
+		position, err = strconv.Atoi(p)
+		if err != nil || position < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid position",
+			})
+			return
+		}
+	}
+
+	exists, err := database.SetDBPinned(loggedInUser, dbName, pinned, position)
+	if errors.Is(err, database.ErrTooManyPins) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Database does not exist, or isn't a standard database",
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+		"pinned": pinned,
+	})
+}
+
+// profileSaveHandler changes the details shown on your public profile.  Only the fields given are changed
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F bio="Collector of transport data" \
+//	    -F links="https://example.org https://github.com/example" https://api.dbhub.io/v1/profilesave
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "displayname" is your (optional) new display name
+//	* "bio" is your (optional) new bio.  Up to 500 characters of plain text
+//	* "links" is an (optional) space separated list of up to 5 web links.  Leave it empty to remove all links
+func profileSaveHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	usr, err := database.User(loggedInUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	displayName, bio, links := usr.DisplayName, usr.Bio, usr.Links
+	if v, ok := c.GetPostForm("displayname"); ok {
+		displayName = strings.TrimSpace(v)
+	}
+	if v, ok := c.GetPostForm("bio"); ok {
+		bio = strings.TrimSpace(v)
+	}
+	if v, ok := c.GetPostForm("links"); ok {
+		links = strings.Fields(v)
+	}
+
+	err = com.SaveUserProfile(loggedInUser, displayName, bio, links)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	log.Printf("Profile updated by user '%s'", loggedInUser)
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// formUser returns the validated name of the user given in the (optional) "username" field, defaulting to the logged in
+// user.  When the name is invalid, the error response is sent
+func formUser(c *gin.Context, loggedInUser string) (userName string, ok bool) {
+	userName = c.PostForm("username")
+	if userName == "" {
+		return loggedInUser, true
+	}
+	err := com.ValidateUser(userName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid user name",
+		})
+		return
+	}
+	return userName, true
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// CommentReactionSummary holds the reactions given to a single discussion comment
+type CommentReactionSummary struct {
+	CommentID   int            `json:"com_id"`
+	Likes       int            `json:"likes"`
+	MyReactions []string       `json:"my_reactions"`
+	Reactions   map[string]int `json:"reactions"`
+	Total       int            `json:"total"`
+}
+
+// reactHandler adds or removes one of your reactions on a discussion or merge request comment
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F discid="3" -F comid="12" -F reaction="+1" https://api.dbhub.io/v1/react
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "discid" is the ID of the discussion or merge request
+//	* "comid" is the ID of the comment
+//	* "reaction" is one of "+1", "-1", "laugh", "hooray", "confused", "heart", "rocket", or "eyes"
+//	* "add" is an (optional) boolean.  Either "true" (the default) to add the reaction, or "false" to remove it
+func reactHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Validate the discussion and comment IDs, and the reaction
+	discID, err := strconv.Atoi(c.PostForm("discid"))
+	if err != nil || discID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid discussion ID",
+		})
+		return
+	}
+	comID, err := strconv.Atoi(c.PostForm("comid"))
+	if err != nil || comID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid comment ID",
+		})
+		return
+	}
+	reaction := c.PostForm("reaction")
+	if !database.ValidReaction(reaction) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Unknown reaction",
+		})
+		return
+	}
+	add := true
+	if a := c.PostForm("add"); a != "" {
+		add, err = strconv.ParseBool(a)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid value for add",
+			})
+			return
+		}
+	}
+
+	if add {
+		exists, err := database.ReactionAdd(loggedInUser, dbOwner, dbName, discID, comID, reaction)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Unknown comment",
+			})
+			return
+		}
+	} else {
+		err = database.ReactionRemove(loggedInUser, dbOwner, dbName, discID, comID, reaction)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+	err = com.InvalidateCommentReactions(dbOwner, dbName, discID)
+	if err != nil {
+		log.Printf("Error when invalidating the cached reactions for '%s/%s': %v", com.SanitiseLogString(dbOwner),
+			com.SanitiseLogString(dbName), err)
+	}
+
+	// Return the updated reactions of the comment
+	comment := []database.DiscussionCommentEntry{{ID: comID}}
+	err = com.AddCommentReactions(loggedInUser, dbOwner, dbName, discID, comment)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, reactionSummary(comment[0]))
+}
+
+// reactionsHandler returns the reactions given to the comments of a discussion or merge request, along with a
+// summary of them across the whole discussion
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F discid="3" https://api.dbhub.io/v1/reactions
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "discid" is the ID of the discussion or merge request
+func reactionsHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Validate the discussion ID
+	discID, err := strconv.Atoi(c.PostForm("discid"))
+	if err != nil || discID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid discussion ID",
+		})
+		return
+	}
+
+	// Retrieve the comments and their reactions
+	comments, err := database.DiscussionComments(dbOwner, dbName, discID, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	err = com.AddCommentReactions(loggedInUser, dbOwner, dbName, discID, comments)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Summarise the reactions
+	list := []CommentReactionSummary{}
+	reactions := make(map[string]int)
+	likes, total := 0, 0
+	for _, j := range comments {
+		if j.EntryType != database.TEXT {
+			continue
+		}
+		s := reactionSummary(j)
+		list = append(list, s)
+		for r, n := range s.Reactions {
+			reactions[r] += n
+		}
+		likes += s.Likes
+		total += s.Total
+	}
+	c.JSON(200, gin.H{
+		"comments":  list,
+		"likes":     likes,
+		"reactions": reactions,
+		"total":     total,
+	})
+}
+
+// reactionSummary summarises the reactions of a comment.  The number of likes is the number of "+1" and "heart"
+// reactions
+func reactionSummary(comment database.DiscussionCommentEntry) (s CommentReactionSummary) {
+	s.CommentID = comment.ID
+	s.MyReactions = comment.MyReactions
+	s.Reactions = comment.Reactions
+	for r, n := range comment.Reactions {
+		s.Total += n
+		if r == "+1" || r == "heart" {
+			s.Likes += n
+		}
+	}
+	return
+}
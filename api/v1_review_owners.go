@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// reviewOwnersHandler returns the table ownership rules of a database, in the order they were given.  Merge requests
+// changing a table automatically ask its owners for a review, and need an approval from one of them before merging
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    https://api.dbhub.io/v1/reviewowners
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+func reviewOwnersHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	_, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	rules, err := database.ReviewOwnerRules(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if rules == nil {
+		rules = []database.ReviewOwnerRule{}
+	}
+	c.JSON(200, rules)
+}
+
+// reviewOwnersSetHandler replaces the table ownership rules of one of your databases.  The rules are written like a
+// CODEOWNERS file, with each line holding a table name pattern followed by the users who own the matching tables.  When
+// several rules match a table, the last one applies
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F rules="order* alice bob" https://api.dbhub.io/v1/reviewownersset
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "rules" is the (optional) list of table ownership rules, one per line.  The database has no table owners when not specified
+func reviewOwnersSetHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !strings.EqualFold(loggedInUser, dbOwner) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Only the owner of a database can change its table owners",
+		})
+		return
+	}
+
+	rules, err := com.ParseReviewOwners(c.PostForm("rules"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Table owners approve merge requests, so they need write access to the database
+	for _, r := range rules {
+		for _, u := range r.Owners {
+			allowed, err := database.CheckDBPermissions(u, dbOwner, dbName, true)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+			if !allowed {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": fmt.Sprintf("'%s' doesn't have write access to this database", u),
+				})
+				return
+			}
+		}
+	}
+
+	err = database.ReviewOwnerRulesSet(dbOwner, dbName, rules)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// rowHistoryHandler returns the history of a table row, by walking back through the commits of a database branch.  The
+// commit which introduced the row and the one which last changed it are pointed out, along with the full list of
+// changes, newest first
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F table="table1" -F key='{"id": 5}' https://api.dbhub.io/v1/rowhistory
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "table" is the name of the table holding the row
+//	* "key" is a JSON object with the value of each primary key column of the row.  Tables without a primary key use "rowid"
+//	* "branch" is the (optional) database branch.  Uses the default database branch if not specified
+func rowHistoryHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Extract the table name and row key
+	table, err := com.GetFormTable(c.Request, false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if table == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing table name",
+		})
+		return
+	}
+	key, err := com.ParseRowKey(c.PostForm("key"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Live databases don't have commits
+	isLive, _, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if isLive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "That database is a live database.  It doesn't have a row history.",
+		})
+		return
+	}
+
+	branchName, err := com.GetFormBranch(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if branchName == "" {
+		branchName, err = database.GetDefaultBranchName(dbOwner, dbName)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+
+	history, err := com.RowHistory(loggedInUser, dbOwner, dbName, branchName, table, key)
+	if errors.Is(err, com.ErrClientEncrypted) || errors.Is(err, com.ErrRowKey) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, history)
+}
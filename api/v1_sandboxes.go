@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// sandboxCreateHandler creates a sandbox of a live database.  A sandbox is a private live database of your own, starting
+// out as a copy of the parent database, which you can change without affecting anyone else.  Its changes can be looked
+// at with sandboxDiffHandler, and merged back into the parent database with sandboxMergeHandler
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing live.sqlite" \
+//	    -F sandbox="Join Testing sandbox.sqlite" https://api.dbhub.io/v1/sandboxcreate
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "sandbox" is the name of the new sandbox.  It's created as one of your databases
+func sandboxCreateHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	isLive, liveNode, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !isLive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Sandboxes can only be created of live databases",
+		})
+		return
+	}
+
+	// Check the name of the sandbox isn't already in use
+	sandboxName := c.PostForm("sandbox")
+	err = com.ValidateDB(sandboxName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid sandbox name",
+		})
+		return
+	}
+	exists, err := database.CheckDBExists(loggedInUser, sandboxName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": fmt.Sprintf("You already have a database called '%s'", sandboxName),
+		})
+		return
+	}
+
+	// Store the copies of the parent database the sandbox starts out from
+	objectID, baseBucket, baseObject, err := com.LiveSandboxSnapshot(liveNode, loggedInUser, dbOwner, dbName,
+		loggedInUser, sandboxName)
+	if jobQueueFull(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Send a request to the job queue to set up the sandbox, then record it the same way as uploaded live databases
+	sandboxNode, err := com.LiveCreateDB(loggedInUser, sandboxName, objectID)
+	if jobQueueFull(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	err = database.LiveAddDatabasePG(loggedInUser, sandboxName, objectID, sandboxNode, database.SetToPrivate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	err = database.ToggleDBWatch(loggedInUser, loggedInUser, sandboxName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	s := database.LiveSandbox{
+		BaseBucket:  baseBucket,
+		BaseObject:  baseObject,
+		DBName:      sandboxName,
+		DBOwner:     loggedInUser,
+		ParentName:  dbName,
+		ParentOwner: dbOwner,
+	}
+	err = database.LiveSandboxAdd(s)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	log.Printf("API Server: Username '%s' created sandbox '%s/%s' of '%s/%s'", loggedInUser,
+		com.SanitiseLogString(loggedInUser), com.SanitiseLogString(sandboxName), com.SanitiseLogString(dbOwner),
+		com.SanitiseLogString(dbName))
+
+	s, _, err = database.LiveSandboxFor(loggedInUser, sandboxName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, s)
+}
+
+// sandboxDiffHandler returns the changes made to a sandbox since it was created from its parent database
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing sandbox.sqlite" \
+//	    https://api.dbhub.io/v1/sandboxdiff
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the sandbox
+//	* "dbname" is the name of the sandbox
+func sandboxDiffHandler(c *gin.Context) {
+	loggedInUser, s, sandboxNode, ok := sandboxAccess(c)
+	if !ok {
+		return
+	}
+
+	diffs, err := com.LiveSandboxDiff(sandboxNode, loggedInUser, s, com.NoMerge, true)
+	if jobQueueFull(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, diffs)
+}
+
+// sandboxMergeHandler merges the changes made to a sandbox back into its parent database, which needs write access to
+// the parent database.  Rows added to the sandbox are given new primary keys as needed.  Nothing is merged when any of
+// the changes conflict with changes made to the parent database since the sandbox was created.  After merging, the
+// sandbox is closed and can't be merged again
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing sandbox.sqlite" \
+//	    -F objects='["table1"]' https://api.dbhub.io/v1/sandboxmerge
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the sandbox
+//	* "dbname" is the name of the sandbox
+//	* "objects" is an (optional) JSON array of the names of the tables, views, indexes, and triggers whose changes are merged.  Defaults to all of them
+func sandboxMergeHandler(c *gin.Context) {
+	loggedInUser, s, sandboxNode, ok := sandboxAccess(c)
+	if !ok {
+		return
+	}
+	if s.State != "open" {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "That sandbox has already been merged",
+		})
+		return
+	}
+	var objects []string
+	if z := c.PostForm("objects"); z != "" {
+		err := json.Unmarshal([]byte(z), &objects)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid objects value.  It needs to be a JSON array of object names",
+			})
+			return
+		}
+	}
+
+	// Make sure the user has write access to the parent database
+	allowed, err := database.CheckDBPermissions(loggedInUser, s.ParentOwner, s.ParentName, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "You need write access to the parent database to merge its sandboxes",
+		})
+		return
+	}
+	_, parentNode, err := database.CheckDBLive(s.ParentOwner, s.ParentName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Gather the changes to merge, in the form of SQL statements which can be run on the parent database
+	diffs, err := com.LiveSandboxDiff(sandboxNode, loggedInUser, s, com.NewPkMerge, false)
+	if jobQueueFull(c, err) {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if len(objects) > 0 {
+		var picked com.Diffs
+		for _, d := range diffs.Diff {
+			for _, o := range objects {
+				if d.ObjectName == o {
+					picked.Diff = append(picked.Diff, d)
+					break
+				}
+			}
+		}
+		diffs = picked
+	}
+	if len(diffs.Diff) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "There are no changes to merge",
+		})
+		return
+	}
+
+	conflicts, err := com.LiveSandboxMerge(parentNode, loggedInUser, s, diffs)
+	if jobQueueFull(c, err) {
+		return
+	}
+	if errors.Is(err, database.ErrDBArchived) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if len(conflicts) > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":     "The changes conflict with changes made to the parent database since the sandbox was created",
+			"conflicts": conflicts,
+		})
+		return
+	}
+
+	// Close the sandbox.  The changes are already merged, so a merge running at the same time is only reported here
+	merged, err := database.LiveSandboxMerged(s.DBOwner, s.DBName, loggedInUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !merged {
+		log.Printf("API Server: sandbox '%s/%s' was merged more than once at the same time",
+			com.SanitiseLogString(s.DBOwner), com.SanitiseLogString(s.DBName))
+	}
+	err = database.UpdateModified(s.ParentOwner, s.ParentName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status":  "OK",
+		"objects": len(diffs.Diff),
+	})
+}
+
+// sandboxesHandler returns the sandboxes of a live database, newest first.  Users with write access to the database
+// see all of its sandboxes, while everyone else only sees their own
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing live.sqlite" \
+//	    https://api.dbhub.io/v1/sandboxes
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+func sandboxesHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	writer, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	owner := loggedInUser
+	if writer {
+		owner = ""
+	}
+
+	list, err := database.LiveSandboxes(dbOwner, dbName, owner)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if list == nil {
+		list = []database.LiveSandbox{}
+	}
+	c.JSON(200, list)
+}
+
+// sandboxAccess checks the database in the request is a sandbox the user can read, returning its details and the node
+// it's on
+func sandboxAccess(c *gin.Context) (loggedInUser string, s database.LiveSandbox, liveNode string, ok bool) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	s, exists, err := database.LiveSandboxFor(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "That database isn't a sandbox",
+		})
+		return
+	}
+	_, liveNode, err = database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	return loggedInUser, s, liveNode, true
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// savedQueriesHandler returns the list of saved queries for a database which are visible to the caller
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    https://api.dbhub.io/v1/savedqueries
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+func savedQueriesHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Retrieve the list of saved queries
+	queries, err := database.SavedQueries(loggedInUser, dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Return the list as JSON
+	c.JSON(200, queries)
+}
+
+// savedQueryHandler runs a saved query on a database, returning the results to the caller
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F name="Top ten" https://api.dbhub.io/v1/savedquery
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "name" is the name of the saved query
+//	* "version" is the (optional) version of the saved query to run.  Defaults to the latest version
+//	* "format" is the (optional) layout of the returned data.  Either "rows" (the default) or "columnar"
+func savedQueryHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, commitID, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Validate the saved query name and version
+	queryName := c.PostForm("name")
+	err = com.ValidateSavedQueryName(queryName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid saved query name",
+		})
+		return
+	}
+	version := 0
+	if v := c.PostForm("version"); v != "" {
+		version, err = strconv.Atoi(v)
+		if err != nil || version < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid version number",
+			})
+			return
+		}
+	}
+
+	// Check the requested output format
+	format := c.PostForm("format")
+	if format != "" && format != "rows" && format != "columnar" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Unknown output format requested",
+		})
+		return
+	}
+
+	// Retrieve the saved query
+	query, exists, err := database.SavedQueryGet(loggedInUser, dbOwner, dbName, queryName, version)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Saved query '%s' not found", queryName),
+		})
+		return
+	}
+
+	// Check if the database is a live database, and get the node/queue to send the request to
+	isLive, liveNode, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if isLive && liveNode == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "No job queue node available for request",
+		})
+		return
+	}
+
+	// Run the query
+	var data com.SQLiteRecordSet
+	if !isLive {
+		// Standard database
+		data, err = com.SQLiteRunQueryDefensive(c.Writer, c.Request, com.QuerySourceAPI, dbOwner, dbName, commitID, loggedInUser, query.SQL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+	} else {
+		// Send the query to the appropriate backend live node
+		data, err = com.LiveQuery(liveNode, loggedInUser, dbOwner, dbName, query.SQL)
+		if jobQueueFull(c, err) {
+			return
+		}
+		if err != nil {
+			log.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+
+	// Return the results
+	if format == "columnar" {
+		c.JSON(200, com.ColumnarResponse(data))
+		return
+	}
+	c.JSON(200, data.Records)
+}
+
+// savedQuerySaveHandler saves a query for a database.  Saving an existing query adds a new version of it.  This needs
+// write access to the database
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F name="Top ten" -F sql="U0VMRUNUICogRlJPTSB0YWJsZTEgTElNSVQgMTA=" -F shared="true" \
+//	    https://api.dbhub.io/v1/savedquerysave
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "name" is the name of the saved query
+//	* "sql" is the SQL query, base64 encoded
+//	* "description" is an (optional) description of the query
+//	* "shared" is an (optional) boolean indicating whether the query is visible to everyone with access to the database
+func savedQuerySaveHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Saving and sharing queries needs write access to the database, so other users can't take the query names
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "You need write access to the database to save queries for it",
+		})
+		return
+	}
+
+	// Validate the saved query details
+	queryName := c.PostForm("name")
+	err = com.ValidateSavedQueryName(queryName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid saved query name",
+		})
+		return
+	}
+	description := c.PostForm("description")
+	if description != "" {
+		err = com.ValidateMarkdown(description)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid description",
+			})
+			return
+		}
+	}
+	sql, err := com.CheckUnicode(c.PostForm("sql"), true)
+	if err != nil || sql == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid SQL query",
+		})
+		return
+	}
+	shared := false
+	if s := c.PostForm("shared"); s != "" {
+		shared, err = strconv.ParseBool(s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid value for shared",
+			})
+			return
+		}
+	}
+
+	// Save the query
+	version, err := database.SavedQuerySave(loggedInUser, dbOwner, dbName, queryName, description, sql, shared)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"version": version,
+	})
+}
+
+// savedQueryVersionsHandler returns the version history of a saved query
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F name="Top ten" https://api.dbhub.io/v1/savedqueryversions
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "name" is the name of the saved query
+func savedQueryVersionsHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Validate the saved query name
+	queryName := c.PostForm("name")
+	err = com.ValidateSavedQueryName(queryName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid saved query name",
+		})
+		return
+	}
+
+	// Retrieve the version history
+	versions, err := database.SavedQueryVersions(loggedInUser, dbOwner, dbName, queryName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if len(versions) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Saved query '%s' not found", queryName),
+		})
+		return
+	}
+	c.JSON(200, versions)
+}
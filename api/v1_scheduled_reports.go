@@ -0,0 +1,345 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// reportDeleteHandler removes a scheduled report, along with its run history
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F name="Weekly sales" https://api.dbhub.io/v1/reportdelete
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "name" is the name of the scheduled report
+func reportDeleteHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	name, ok := reportName(c)
+	if !ok {
+		return
+	}
+	exists, err := database.ScheduledReportDelete(loggedInUser, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Scheduled report '%s' not found", name),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// reportName extracts and validates the scheduled report name of a request.  When it's invalid an error is returned to
+// the caller, and false is returned
+func reportName(c *gin.Context) (name string, ok bool) {
+	name = c.PostForm("name")
+	err := com.ValidateReportName(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid report name",
+		})
+		return
+	}
+	return name, true
+}
+
+// reportOutputHandler returns the rendered output of a run of a scheduled report
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F name="Weekly sales" -F run="1234" -o report.pdf \
+//	    https://api.dbhub.io/v1/reportoutput
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "name" is the name of the scheduled report
+//	* "run" is the ID of the run, as returned by the "reportruns" call
+func reportOutputHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	name, ok := reportName(c)
+	if !ok {
+		return
+	}
+	runID, err := strconv.ParseInt(c.PostForm("run"), 10, 64)
+	if err != nil || runID < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid run ID",
+		})
+		return
+	}
+
+	contentType, output, exists, err := database.ScheduledReportRunOutput(loggedInUser, name, runID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists || output == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Report output not found",
+		})
+		return
+	}
+	c.Data(200, contentType, output)
+}
+
+// reportRunHandler queues a scheduled report to be run and delivered straight away, outside of its schedule
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F name="Weekly sales" https://api.dbhub.io/v1/reportrun
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "name" is the name of the scheduled report
+func reportRunHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	name, ok := reportName(c)
+	if !ok {
+		return
+	}
+	exists, err := database.ScheduledReportPending(loggedInUser, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Scheduled report '%s' not found", name),
+		})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"status": "OK",
+	})
+}
+
+// reportRunsHandler returns the run history of a scheduled report, most recent first
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F name="Weekly sales" https://api.dbhub.io/v1/reportruns
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "name" is the name of the scheduled report
+func reportRunsHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	name, ok := reportName(c)
+	if !ok {
+		return
+	}
+	runs, err := database.ScheduledReportRuns(loggedInUser, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, runs)
+}
+
+// reportSaveHandler adds a scheduled report, or changes an existing one.  The secret used for signing webhook requests
+// is returned
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F name="Weekly sales" -F source="query" -F dbowner="justinclift" \
+//	    -F dbname="Join Testing.sqlite" -F sourcename="Top ten" -F schedule="0 9 * * 1" -F format="csv" \
+//	    -F delivery="email" https://api.dbhub.io/v1/reportsave
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "name" is the name of the scheduled report
+//	* "source" is what the report runs.  Either "query" for a saved query, or "dashboard" for one of your dashboards
+//	* "sourcename" is the name of the saved query or dashboard
+//	* "dbowner" and "dbname" are the owner and name of the database the saved query belongs to.  Only used for "query"
+//	  reports
+//	* "schedule" is when the report runs, as a five field cron schedule in UTC (eg "0 9 * * 1"), or one of "@hourly",
+//	  "@daily", "@weekly", "@monthly", or "@yearly".  Reports can't run more than once every 15 minutes
+//	* "format" is the format the results are rendered in.  Either "csv", "html", or "pdf"
+//	* "delivery" is how the report is delivered.  Either "email" to your email address, or "webhook"
+//	* "webhookurl" is the address the report is POSTed to, when delivering to a webhook.  The requests are signed
+//	  with the returned secret, in the "X-DBHub-Signature" header
+func reportSaveHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	name, ok := reportName(c)
+	if !ok {
+		return
+	}
+	r := database.ScheduledReport{
+		Delivery:   c.PostForm("delivery"),
+		Format:     c.PostForm("format"),
+		Name:       name,
+		Schedule:   c.PostForm("schedule"),
+		Source:     c.PostForm("source"),
+		SourceName: c.PostForm("sourcename"),
+		User:       loggedInUser,
+	}
+
+	// Check the schedule, format, and delivery method
+	sched, err := com.ScheduledReportSchedule(r.Schedule)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	r.NextRun = sched.Next(time.Now())
+	if _, _, ok = com.ScheduledReportFormat(r.Format); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Unknown report format.  Must be one of 'csv', 'html', or 'pdf'",
+		})
+		return
+	}
+	switch r.Delivery {
+	case "email":
+	case "webhook":
+		r.WebhookURL = c.PostForm("webhookurl")
+		err = com.ValidateWebhookURL(r.WebhookURL)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Unknown delivery method.  Must be either 'email' or 'webhook'",
+		})
+		return
+	}
+
+	// Make sure the saved query or dashboard exists
+	switch r.Source {
+	case "query":
+		r.DBOwner = c.PostForm("dbowner")
+		r.DBName = c.PostForm("dbname")
+		err = com.ValidateUserDB(r.DBOwner, r.DBName)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid database owner or name",
+			})
+			return
+		}
+		err = com.ValidateSavedQueryName(r.SourceName)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid saved query name",
+			})
+			return
+		}
+		allowed, err := database.CheckDBPermissions(loggedInUser, r.DBOwner, r.DBName, false)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if !allowed {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Database does not exist, or user isn't authorised to access it",
+			})
+			return
+		}
+		_, exists, err := database.SavedQueryGet(loggedInUser, r.DBOwner, r.DBName, r.SourceName, 0)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": fmt.Sprintf("Saved query '%s' not found", r.SourceName),
+			})
+			return
+		}
+	case "dashboard":
+		err = com.ValidateDashboardName(r.SourceName)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid dashboard name",
+			})
+			return
+		}
+		_, exists, err := database.DashboardGet(loggedInUser, r.SourceName)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": fmt.Sprintf("Dashboard '%s' not found", r.SourceName),
+			})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Unknown report source.  Must be either 'query' or 'dashboard'",
+		})
+		return
+	}
+
+	// Check the user hasn't already reached the most reports they can have
+	list, err := database.ScheduledReports(loggedInUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	existing := false
+	for _, z := range list {
+		if z.Name == name {
+			existing = true
+		}
+	}
+	if !existing && len(list) >= database.ScheduledReportMaxReports {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("You can't have more than %d scheduled reports", database.ScheduledReportMaxReports),
+		})
+		return
+	}
+
+	// Save the report
+	secret, err := database.ScheduledReportSave(r)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"next_run":       r.NextRun,
+		"webhook_secret": secret,
+	})
+}
+
+// reportsHandler returns the scheduled reports of the user
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" https://api.dbhub.io/v1/reports
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+func reportsHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	list, err := database.ScheduledReports(loggedInUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, list)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// schemaCreateHandler creates a new database from a schema definition, without needing a database file to be uploaded.
+// The database file is generated on the server, and becomes the first commit of the new database
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbname="Inventory.sqlite" \
+//	    -F schema='{"tables": [{"name": "items", "columns": [{"name": "id", "type": "INTEGER", "primary_key": true}, {"name": "name", "type": "TEXT", "not_null": true}]}]}' \
+//	    https://api.dbhub.io/v1/schemacreate
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbname" is the name for the new database
+//	* "schema" is the JSON definition of the tables, columns and indexes of the new database
+//	* "commitmsg" is the (optional) commit message for the first commit.  Defaults to "Created from a schema definition"
+//	* "licence" is the (optional) licence of the new database.  Defaults to "Not specified"
+//	* "public" is an (optional) boolean for whether the new database is public.  Defaults to private
+func schemaCreateHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	dbName := c.PostForm("dbname")
+	err := com.ValidateDB(dbName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid database name",
+		})
+		return
+	}
+	c.Set("owner", loggedInUser)
+	c.Set("database", dbName)
+
+	// Read the schema definition
+	def, err := com.ParseSchemaDefinition(c.PostForm("schema"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Only new databases can be created this way
+	exists, err := database.CheckDBExists(loggedInUser, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "A database with that name already exists.  Please choose a different name.",
+		})
+		return
+	}
+
+	commitMsg := "Created from a schema definition"
+	if z := c.PostForm("commitmsg"); z != "" {
+		err = com.ValidateMarkdown(z)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid commit message",
+			})
+			return
+		}
+		commitMsg = z
+	}
+
+	licenceName := "Not specified"
+	if z := c.PostForm("licence"); z != "" {
+		licences, err := database.GetLicences(loggedInUser)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if _, ok := licences[z]; !ok {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Unknown licence: '%s'", z),
+			})
+			return
+		}
+		licenceName = z
+	}
+
+	accessType := database.SetToPrivate
+	if z := c.PostForm("public"); z != "" {
+		public, err := strconv.ParseBool(z)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid public value",
+			})
+			return
+		}
+		if public {
+			accessType = database.SetToPublic
+		}
+	}
+
+	// Generate the database file.  SQLite has the final say on whether the definition makes sense, so any errors it
+	// gives are returned to the caller
+	tempDB, err := com.CreateSchemaDatabase(def)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("The database couldn't be created from the schema definition: %s", err),
+		})
+		return
+	}
+	defer os.Remove(tempDB.Name())
+	defer tempDB.Close()
+
+	// Add the new database
+	numBytes, commitID, sha, err := com.AddDatabase(loggedInUser, loggedInUser, dbName, true, "main", "",
+		accessType, licenceName, commitMsg, "", tempDB, time.Now().UTC(), time.Time{}, "", "", "", "", nil, "",
+		com.AddDatabaseOptions{})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Make a record of the upload
+	err = database.LogUpload(loggedInUser, dbName, loggedInUser, c.ClientIP(), "api", c.Request.UserAgent(),
+		time.Now().UTC(), sha)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	log.Printf("Database created from a schema definition: '%s/%s', bytes: %v", loggedInUser,
+		com.SanitiseLogString(dbName), numBytes)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"commit": commitID,
+		"url":    server + filepath.Join("/", loggedInUser, dbName) + "?branch=main&commit=" + commitID,
+	})
+}
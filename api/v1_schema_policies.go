@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// schemaPoliciesHandler returns the schema change policy of each branch of a database which has one.  Branches with
+// the "block" policy don't accept schema changes, and branches with the "approval" policy only accept them from
+// approved merge requests
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    https://api.dbhub.io/v1/schemapolicies
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+func schemaPoliciesHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	_, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	policies, err := database.BranchSchemaPolicies(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, policies)
+}
+
+// schemaPolicySetHandler sets the schema change policy of a branch of one of your databases
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F branch="main" -F policy="approval" https://api.dbhub.io/v1/schemapolicyset
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "branch" is the name of the branch
+//	* "policy" is the (optional) schema change policy, either "block" or "approval".  The branch accepts any schema change when not specified
+func schemaPolicySetHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !strings.EqualFold(loggedInUser, dbOwner) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Only the owner of a database can change its schema change policies",
+		})
+		return
+	}
+
+	// Validate the branch name, and make sure the branch exists
+	branchName := c.PostForm("branch")
+	if err = com.ValidateBranchName(branchName); err != nil || branchName == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid branch name",
+		})
+		return
+	}
+	branches, err := database.GetBranches(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if _, ok := branches[branchName]; !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Unknown branch '%s'", branchName),
+		})
+		return
+	}
+
+	// Validate the policy
+	policy := c.PostForm("policy")
+	validPolicy := policy == ""
+	for _, z := range com.SchemaPolicies {
+		if policy == z {
+			validPolicy = true
+		}
+	}
+	if !validPolicy {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("The policy needs to be one of: %s", strings.Join(com.SchemaPolicies, ", ")),
+		})
+		return
+	}
+
+	err = database.BranchSchemaPolicySet(dbOwner, dbName, branchName, policy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// sizeAlertHandler returns how much a database can grow from one commit to the next before its owner is emailed
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    https://api.dbhub.io/v1/sizealert
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+func sizeAlertHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	_, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	alert, err := database.SizeAlertFor(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, alert)
+}
+
+// sizeAlertSetHandler sets how much one of your databases can grow from one commit to the next before you're emailed
+// about it.  This is useful for catching runaway data appends
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F growth_percent="50" -F growth_bytes="104857600" https://api.dbhub.io/v1/sizealertset
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "growth_bytes" is the (optional) number of bytes a commit can grow the database by.  0 turns it off, the default
+//	* "growth_percent" is the (optional) percentage a commit can grow the database by.  0 turns it off, the default
+func sizeAlertSetHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !strings.EqualFold(loggedInUser, dbOwner) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Only the owner of a database can change its size alert",
+		})
+		return
+	}
+
+	var alert database.SizeAlert
+	if z := c.PostForm("growth_bytes"); z != "" {
+		alert.GrowthBytes, err = strconv.ParseInt(z, 10, 64)
+		if err != nil || alert.GrowthBytes < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid growth_bytes value",
+			})
+			return
+		}
+	}
+	if z := c.PostForm("growth_percent"); z != "" {
+		alert.GrowthPercent, err = strconv.Atoi(z)
+		if err != nil || alert.GrowthPercent < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid growth_percent value",
+			})
+			return
+		}
+	}
+
+	err = database.SizeAlertSet(dbOwner, dbName, alert)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// sizeHistoryHandler returns the size of a database for each commit of a branch, oldest first
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F branch="main" https://api.dbhub.io/v1/sizehistory
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "branch" is the (optional) database branch.  Uses the default database branch if not specified
+func sizeHistoryHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	_, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Live databases don't have commits
+	isLive, _, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if isLive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "That database is a live database.  It doesn't have a size history.",
+		})
+		return
+	}
+
+	branchName, err := com.GetFormBranch(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	history, err := com.BranchSizeHistory(dbOwner, dbName, branchName)
+	if errors.Is(err, com.ErrBranchNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, history)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// Maximum number of status updates returned by a single request
+const statusUpdatesMaxLimit = 100
+
+// statusUpdatesHandler returns a page of your status updates, most recent first
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F unread="true" https://api.dbhub.io/v1/statusupdates
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "offset" is the (optional) number of status updates to skip.  Defaults to 0
+//	* "limit" is the (optional) maximum number of status updates to return, up to 100.  Defaults to 25
+//	* "unread" is an (optional) boolean.  When true, only unread status updates are returned
+func statusUpdatesHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	// Validate the paging parameters
+	offset, limit := 0, 25
+	var err error
+	if o := c.PostForm("offset"); o != "" {
+		offset, err = strconv.Atoi(o)
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid offset",
+			})
+			return
+		}
+	}
+	if l := c.PostForm("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > statusUpdatesMaxLimit {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid limit.  It needs to be between 1 and %d", statusUpdatesMaxLimit),
+			})
+			return
+		}
+	}
+	unreadOnly := false
+	if u := c.PostForm("unread"); u != "" {
+		unreadOnly, err = strconv.ParseBool(u)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid value for unread",
+			})
+			return
+		}
+	}
+
+	// Retrieve the status updates
+	updates, total, err := database.StatusUpdatesList(loggedInUser, unreadOnly, offset, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	numUnread, err := com.UserStatusUpdates(loggedInUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if updates == nil {
+		updates = []database.StatusUpdateEntry{}
+	}
+	c.JSON(200, gin.H{
+		"total":   total,
+		"unread":  numUnread,
+		"updates": updates,
+	})
+}
+
+// statusUpdatesDismissHandler marks all of your status updates as read
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" https://api.dbhub.io/v1/statusupdatesdismiss
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+func statusUpdatesDismissHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	err := database.StatusUpdatesMarkAllRead(loggedInUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	statusUpdatesCountResponse(c, loggedInUser)
+}
+
+// statusUpdatesReadHandler marks some of your status updates as read or unread
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F ids="12,15" -F read="true" https://api.dbhub.io/v1/statusupdatesread
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "ids" is a comma separated list of status update IDs
+//	* "read" is an (optional) boolean.  Either "true" (the default) to mark the status updates as read, or "false"
+//	  to mark them as unread
+func statusUpdatesReadHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	// Validate the status update IDs
+	var ids []int64
+	for _, i := range strings.Split(c.PostForm("ids"), ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(i), 10, 64)
+		if err != nil || id < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid status update ID",
+			})
+			return
+		}
+		ids = append(ids, id)
+	}
+	read := true
+	if r := c.PostForm("read"); r != "" {
+		var err error
+		read, err = strconv.ParseBool(r)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid value for read",
+			})
+			return
+		}
+	}
+
+	err := database.StatusUpdatesMarkRead(loggedInUser, ids, read)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	statusUpdatesCountResponse(c, loggedInUser)
+}
+
+// statusUpdatesCountResponse updates the cached number of unread status updates for a user, then returns it
+func statusUpdatesCountResponse(c *gin.Context, loggedInUser string) {
+	numUnread, err := com.StatusUpdatesRecount(loggedInUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"unread": numUnread,
+	})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+)
+
+// rowsDeleteHandler deletes rows from a table of a standard database, adding a commit with the result to the branch
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" -F table="table1" \
+//	    -F rows='[{"key": {"id": 3}}]' https://api.dbhub.io/v1/rowsdelete
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "table" is the name of the table
+//	* "rows" is a JSON array of the rows to delete, each with the "key" holding the values of its primary key columns
+//	* "branch" is the (optional) database branch.  Uses the default database branch if not specified
+//	* "commitmsg" is the (optional) commit message for the new commit
+func rowsDeleteHandler(c *gin.Context) {
+	tableEdit(c, com.TableEditDelete)
+}
+
+// rowsInsertHandler inserts rows into a table of a standard database, adding a commit with the result to the branch
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" -F table="table1" \
+//	    -F rows='[{"values": {"id": 3, "Name": "Some name"}}]' https://api.dbhub.io/v1/rowsinsert
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "table" is the name of the table
+//	* "rows" is a JSON array of the rows to insert, each with the "values" of its columns
+//	* "branch" is the (optional) database branch.  Uses the default database branch if not specified
+//	* "commitmsg" is the (optional) commit message for the new commit
+func rowsInsertHandler(c *gin.Context) {
+	tableEdit(c, com.TableEditInsert)
+}
+
+// rowsUpdateHandler changes rows of a table in a standard database, adding a commit with the result to the branch
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" -F table="table1" \
+//	    -F rows='[{"key": {"id": 3}, "values": {"Name": "New name"}}]' https://api.dbhub.io/v1/rowsupdate
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "table" is the name of the table
+//	* "rows" is a JSON array of the rows to change, each with the "key" holding the values of its primary key columns and the new "values" of its columns
+//	* "branch" is the (optional) database branch.  Uses the default database branch if not specified
+//	* "commitmsg" is the (optional) commit message for the new commit
+func rowsUpdateHandler(c *gin.Context) {
+	tableEdit(c, com.TableEditUpdate)
+}
+
+// tableEdit reads a table edit request, and makes the change to the database as a new commit
+func tableEdit(c *gin.Context, action com.TableEditAction) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	table := c.PostForm("table")
+	err = com.ValidatePGTable(table)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid table name",
+		})
+		return
+	}
+	branchName := c.PostForm("branch")
+	if branchName != "" {
+		err = com.ValidateBranchName(branchName)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid branch name",
+			})
+			return
+		}
+	}
+	commitMsg := c.PostForm("commitmsg")
+	if commitMsg != "" {
+		err = com.ValidateMarkdown(commitMsg)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid commit message",
+			})
+			return
+		}
+	}
+
+	// Numbers are kept as they were given, so large integers don't lose precision
+	var rows []com.TableEditRow
+	d := json.NewDecoder(strings.NewReader(c.PostForm("rows")))
+	d.UseNumber()
+	err = d.Decode(&rows)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "The rows couldn't be read: " + err.Error(),
+		})
+		return
+	}
+
+	commitID, httpStatus, err := com.EditTableRows(loggedInUser, dbOwner, dbName, branchName, table, action, rows,
+		commitMsg)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	log.Printf("Table '%s' of '%s/%s' edited (%s) by '%s'", com.SanitiseLogString(table), dbOwner,
+		com.SanitiseLogString(dbName), action, loggedInUser)
+
+	u := server + filepath.Join("/", dbOwner, dbName) + "?commit=" + commitID
+	if branchName != "" {
+		u += "&branch=" + url.QueryEscape(branchName)
+	}
+	c.JSON(200, gin.H{
+		"commit": commitID,
+		"url":    u,
+	})
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// TemplateDatabase holds the details of a public database which has been marked as a template
+type TemplateDatabase struct {
+	Database     string `json:"database"`
+	DisplayName  string `json:"display_name"`
+	LastModified string `json:"last_modified"`
+	Owner        string `json:"owner"`
+}
+
+// templatesHandler returns the list of public databases which have been marked as templates
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" https://api.dbhub.io/v1/templates
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+func templatesHandler(c *gin.Context) {
+	dbs, err := database.TemplateDBs()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	list := []TemplateDatabase{}
+	for _, j := range dbs {
+		list = append(list, TemplateDatabase{
+			Database:     j.DBName,
+			DisplayName:  j.OwnerDisplayName,
+			LastModified: j.DateEntry.Format(time.RFC3339),
+			Owner:        j.Owner,
+		})
+	}
+	c.JSON(200, list)
+}
+
+// templateSetHandler marks one of your databases as a template, or stops it being one.  Other users who can access
+// a template can create new databases from it
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F template="true" https://api.dbhub.io/v1/templateset
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "template" is a boolean.  Either "true" to mark the database as a template, or "false" to stop it being one
+func templateSetHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Only the owner of a database can make it a template
+	if !strings.EqualFold(loggedInUser, dbOwner) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Only the owner of a database can make it a template",
+		})
+		return
+	}
+	isTemplate, err := strconv.ParseBool(c.PostForm("template"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid value for template",
+		})
+		return
+	}
+
+	exists, err := database.SetDBTemplate(dbOwner, dbName, isTemplate)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Live databases, and databases encrypted before being uploaded, can't be templates",
+		})
+		return
+	}
+
+	// Invalidate the memcache data for the database, so the new status gets picked up
+	err = com.InvalidateCacheEntry(loggedInUser, dbOwner, dbName, "") // Empty string indicates "for all versions"
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status":   "OK",
+		"template": isTemplate,
+	})
+}
+
+// templateUseHandler creates a new database in your account from a template, with the same schema as the latest
+// commit of the template.  The new database isn't a fork of the template, so it starts with its own history
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F newname="My joins.sqlite" -F data="true" https://api.dbhub.io/v1/templateuse
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the template
+//	* "dbname" is the name of the template
+//	* "newname" is the name of the new database
+//	* "data" is an (optional) boolean.  When true, the rows of the template are copied into the new database too
+//	* "public" is an (optional) boolean.  When true, the new database is public.  Defaults to false
+func templateUseHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	newName := c.PostForm("newname")
+	err = com.ValidateDB(newName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid database name",
+		})
+		return
+	}
+	withData := false
+	if z := c.PostForm("data"); z != "" {
+		withData, err = strconv.ParseBool(z)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid data value",
+			})
+			return
+		}
+	}
+	accessType := database.SetToPrivate
+	if z := c.PostForm("public"); z != "" {
+		public, err := strconv.ParseBool(z)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid public value",
+			})
+			return
+		}
+		if public {
+			accessType = database.SetToPublic
+		}
+	}
+
+	commitID, httpStatus, err := com.CreateFromTemplate(loggedInUser, dbOwner, dbName, newName, withData, accessType)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	log.Printf("Database '%s/%s' created from the '%s/%s' template", loggedInUser, com.SanitiseLogString(newName),
+		dbOwner, com.SanitiseLogString(dbName))
+
+	c.JSON(httpStatus, gin.H{
+		"commit": commitID,
+		"url":    server + filepath.Join("/", loggedInUser, newName) + "?branch=main&commit=" + commitID,
+	})
+}
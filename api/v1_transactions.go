@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// transactionBeginHandler begins a transaction on a live database.  The returned token is given to the other
+// transaction calls, for running statements in the transaction and then committing or rolling it back.  Other changes
+// to the database wait until the transaction ends
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing live.sqlite" \
+//	    -F timeout="60" https://api.dbhub.io/v1/transactionbegin
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "timeout" is the (optional) number of seconds the transaction stays open between calls, before it's rolled back.
+//	  Defaults to 30 seconds, and can be up to 300
+func transactionBeginHandler(c *gin.Context) {
+	loggedInUser, dbOwner, dbName, liveNode, ok := transactionDatabase(c)
+	if !ok {
+		return
+	}
+	timeout := com.LiveTransactionDefaultTimeout
+	if z := c.PostForm("timeout"); z != "" {
+		secs, err := strconv.Atoi(z)
+		if err != nil || secs < 1 || time.Duration(secs)*time.Second > com.LiveTransactionMaxTimeout {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("The timeout needs to be between 1 and %d seconds",
+					int(com.LiveTransactionMaxTimeout.Seconds())),
+			})
+			return
+		}
+		timeout = time.Duration(secs) * time.Second
+	}
+
+	token, expires, err := com.LiveTransactionBegin(liveNode, loggedInUser, dbOwner, dbName, timeout)
+	if err != nil {
+		transactionError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{
+		"expires": expires,
+		"token":   token,
+	})
+}
+
+// transactionCommitHandler commits a transaction on a live database
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing live.sqlite" \
+//	    -F token="YOUR_TRANSACTION_TOKEN" https://api.dbhub.io/v1/transactioncommit
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "token" is the token returned when the transaction was begun
+func transactionCommitHandler(c *gin.Context) {
+	transactionEnd(c, true)
+}
+
+// transactionExecuteHandler executes a SQL statement in a transaction on a live database
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing live.sqlite" \
+//	    -F token="YOUR_TRANSACTION_TOKEN" -F sql="VVBEQVRFIHRhYmxlMSBTRVQgTmFtZSA9ICdUZXN0aW5nIDEnIFdIRVJFIGlkID0gMQ==" \
+//	    https://api.dbhub.io/v1/transactionexecute
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "token" is the token returned when the transaction was begun
+//	* "sql" is the SQL statement to execute, base64 encoded
+//	* "params" is an (optional) JSON array of values for the "?" parameters of the statement, or a JSON object of values
+//	  for its named parameters
+func transactionExecuteHandler(c *gin.Context) {
+	loggedInUser, dbOwner, dbName, liveNode, ok := transactionDatabase(c)
+	if !ok {
+		return
+	}
+	token, sql, params, ok := transactionStatement(c)
+	if !ok {
+		return
+	}
+
+	rowsChanged, err := com.LiveTransactionExecute(liveNode, loggedInUser, dbOwner, dbName, token, sql, params)
+	if err != nil {
+		transactionError(c, err)
+		return
+	}
+	c.JSON(200, com.ExecuteResponseContainer{RowsChanged: rowsChanged, Status: "OK"})
+}
+
+// transactionQueryHandler runs a SQL query in a transaction on a live database, returning the results to the caller.
+// The query sees the changes made earlier in the transaction
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing live.sqlite" \
+//	    -F token="YOUR_TRANSACTION_TOKEN" -F sql="U0VMRUNUICogRlJPTSB0YWJsZTE=" https://api.dbhub.io/v1/transactionquery
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "token" is the token returned when the transaction was begun
+//	* "sql" is the SQL query to run, base64 encoded
+//	* "format" is the (optional) layout of the returned data.  Either "rows" (the default) or "columnar"
+//	* "params" is an (optional) JSON array of values for the "?" parameters of the query, or a JSON object of values for
+//	  its named parameters
+func transactionQueryHandler(c *gin.Context) {
+	loggedInUser, dbOwner, dbName, liveNode, ok := transactionDatabase(c)
+	if !ok {
+		return
+	}
+	token, query, params, ok := transactionStatement(c)
+	if !ok {
+		return
+	}
+	format := c.PostForm("format")
+	if format != "" && format != "rows" && format != "columnar" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Unknown output format requested",
+		})
+		return
+	}
+
+	data, err := com.LiveTransactionQuery(liveNode, loggedInUser, dbOwner, dbName, token, query, params)
+	if err != nil {
+		transactionError(c, err)
+		return
+	}
+	if format == "columnar" {
+		c.JSON(200, com.ColumnarResponse(data))
+		return
+	}
+	c.JSON(200, data.Records)
+}
+
+// transactionRollbackHandler rolls back a transaction on a live database
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing live.sqlite" \
+//	    -F token="YOUR_TRANSACTION_TOKEN" https://api.dbhub.io/v1/transactionrollback
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "token" is the token returned when the transaction was begun
+func transactionRollbackHandler(c *gin.Context) {
+	transactionEnd(c, false)
+}
+
+// transactionDatabase reads the live database a transaction call is for, checking the user can change it.  An error
+// response has been sent when ok is false
+func transactionDatabase(c *gin.Context) (loggedInUser, dbOwner, dbName, liveNode string, ok bool) {
+	loggedInUser = c.MustGet("user").(string)
+
+	// Extract the database owner name and database name from the request
+	dbOwner, dbName, _, err := com.GetFormODC(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Store database path for later logging
+	c.Set("owner", dbOwner)
+	c.Set("database", dbName)
+
+	// Check the user can change the database
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Database '%s/%s' doesn't exist", dbOwner, dbName),
+		})
+		return
+	}
+
+	// Transactions are only available for live databases
+	isLive, liveNode, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !isLive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Transactions are only available for live databases",
+		})
+		return
+	}
+	if liveNode == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "No job queue node available for request",
+		})
+		return
+	}
+	return loggedInUser, dbOwner, dbName, liveNode, true
+}
+
+// transactionEnd commits or rolls back the transaction given in a request
+func transactionEnd(c *gin.Context, commit bool) {
+	loggedInUser, dbOwner, dbName, liveNode, ok := transactionDatabase(c)
+	if !ok {
+		return
+	}
+	token := c.PostForm("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing transaction token",
+		})
+		return
+	}
+
+	err := com.LiveTransactionEnd(liveNode, loggedInUser, dbOwner, dbName, token, commit)
+	if err != nil {
+		transactionError(c, err)
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// transactionError sends the error response for a failed transaction call
+func transactionError(c *gin.Context, err error) {
+	if jobQueueFull(c, err) {
+		return
+	}
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, com.ErrTransactionNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, com.ErrTransactionInProgress):
+		status = http.StatusConflict
+	case errors.Is(err, com.ErrTransactionLimit):
+		status = http.StatusTooManyRequests
+	case errors.Is(err, database.ErrDBArchived):
+		status = http.StatusForbidden
+	case errors.Is(err, com.ErrQueryLimit):
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, gin.H{
+		"error": err.Error(),
+	})
+}
+
+// transactionStatement reads the token, SQL, and (optional) parameter values of a statement to run in a transaction.
+// An error response has been sent when ok is false
+func transactionStatement(c *gin.Context) (token, sql string, params *com.QueryParams, ok bool) {
+	token = c.PostForm("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Missing transaction token",
+		})
+		return
+	}
+	sql, err := com.CheckUnicode(c.PostForm("sql"), true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if z := c.PostForm("params"); z != "" {
+		p, err := com.ParseQueryParams(z)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		params = &p
+	}
+	return token, sql, params, true
+}
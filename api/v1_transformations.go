@@ -0,0 +1,356 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// transformationMaxCount is the most transformations a live database can have
+const transformationMaxCount = 50
+
+// transformationDeleteHandler removes a transformation from one of your live databases, along with its run history.  The
+// table it created is left in the database
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F name="daily_totals" https://api.dbhub.io/v1/transformationdelete
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "name" is the name of the transformation
+func transformationDeleteHandler(c *gin.Context) {
+	dbOwner, dbName, ok := transformationAccess(c, true)
+	if !ok {
+		return
+	}
+	name := c.PostForm("name")
+
+	// Transformations other ones depend on can't be removed
+	list, err := database.Transformations(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	for _, t := range list {
+		for _, d := range t.DependsOn {
+			if d == name {
+				c.JSON(http.StatusConflict, gin.H{
+					"error": fmt.Sprintf("The '%s' transformation depends on that one", t.Name),
+				})
+				return
+			}
+		}
+	}
+
+	exists, err := database.TransformationDelete(dbOwner, dbName, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Transformation not found",
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// transformationRunHandler runs transformations of one of your live databases, along with the transformations which
+// depend on them.  They're run by the server holding the database shortly afterwards, and their outcome is added to the
+// run history
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F name="daily_totals" https://api.dbhub.io/v1/transformationrun
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "name" is the (optional) name of the transformation to run.  Runs all of them if not specified
+func transformationRunHandler(c *gin.Context) {
+	dbOwner, dbName, ok := transformationAccess(c, true)
+	if !ok {
+		return
+	}
+
+	var names []string
+	if name := c.PostForm("name"); name != "" {
+		list, err := database.Transformations(dbOwner, dbName)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		found := false
+		for _, t := range list {
+			if t.Name == name {
+				found = true
+			}
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Transformation not found",
+			})
+			return
+		}
+		names = append(names, name)
+	}
+
+	err := database.TransformationsPending(dbOwner, dbName, "manual", names)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"status": "OK",
+	})
+}
+
+// transformationRunsHandler returns the run history of the transformations of a live database, newest first
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    https://api.dbhub.io/v1/transformationruns
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "name" is the (optional) name of a transformation, to only return its runs
+func transformationRunsHandler(c *gin.Context) {
+	dbOwner, dbName, ok := transformationAccess(c, false)
+	if !ok {
+		return
+	}
+
+	runs, err := database.TransformationRuns(dbOwner, dbName, c.PostForm("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, runs)
+}
+
+// transformationSaveHandler adds a transformation to one of your live databases, or changes an existing one.  A
+// transformation is a SELECT query whose result is saved as a table with the name of the transformation, replacing the
+// table each time it runs.  Transformations run after the ones they depend on, on a schedule, after each change to the
+// database, or when asked to.  You're emailed when a transformation starts failing
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F name="daily_totals" -F sql="U0VMRUNUIGRhdGUsIHN1bSh0b3RhbCkgRlJPTSBvcmRlcnMgR1JPVVAgQlkgZGF0ZQ==" \
+//	    -F dependson="clean_orders" -F interval="1440" https://api.dbhub.io/v1/transformationsave
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "name" is the name of the transformation, which is also the name of the table it creates
+//	* "sql" is the SELECT query of the transformation, base64 encoded
+//	* "dependson" is an (optional) comma separated list of the transformations this one runs after
+//	* "interval" is the (optional) number of minutes between scheduled runs.  Isn't run on a schedule if not specified
+//	* "onwrite" is an (optional) boolean for whether to run after each change to the database
+func transformationSaveHandler(c *gin.Context) {
+	dbOwner, dbName, ok := transformationAccess(c, true)
+	if !ok {
+		return
+	}
+
+	// Validate the transformation details
+	name := c.PostForm("name")
+	if com.ValidatePGTable(name) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid transformation name",
+		})
+		return
+	}
+	sql, err := com.CheckUnicode(c.PostForm("sql"), true)
+	if err != nil || strings.TrimSpace(sql) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid SQL query",
+		})
+		return
+	}
+	var dependsOn []string
+	for _, z := range strings.Split(c.PostForm("dependson"), ",") {
+		if z = strings.TrimSpace(z); z != "" {
+			dependsOn = append(dependsOn, z)
+		}
+	}
+	var interval int
+	if z := c.PostForm("interval"); z != "" {
+		interval, err = strconv.Atoi(z)
+		if err != nil || (interval != 0 && (interval < 5 || interval > 10080)) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "The interval needs to be between 5 and 10080 minutes",
+			})
+			return
+		}
+	}
+	var onWrite bool
+	if z := c.PostForm("onwrite"); z != "" {
+		onWrite, err = strconv.ParseBool(z)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid onwrite value",
+			})
+			return
+		}
+	}
+
+	// Check the dependencies exist and don't loop, using the transformations with this one added or changed
+	list, err := database.Transformations(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	t := database.Transformation{
+		DBName:    dbName,
+		DBOwner:   dbOwner,
+		DependsOn: dependsOn,
+		Interval:  interval,
+		Name:      name,
+		OnWrite:   onWrite,
+		SQL:       sql,
+	}
+	exists := false
+	for i, z := range list {
+		if z.Name == name {
+			list[i] = t
+			exists = true
+		} else if strings.EqualFold(z.Name, name) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": fmt.Sprintf("That name is too similar to the '%s' transformation", z.Name),
+			})
+			return
+		}
+	}
+	if !exists {
+		if len(list) >= transformationMaxCount {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Live databases can have at most %d transformations", transformationMaxCount),
+			})
+			return
+		}
+		list = append(list, t)
+	}
+	if _, err = com.TransformationOrder(list); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// New transformations can't take the name of an existing table or view, as it would be replaced when they run
+	if !exists {
+		_, liveNode, err := database.CheckDBLive(dbOwner, dbName)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		tablesViews, err := com.LiveTablesAndViews(liveNode, dbOwner, dbOwner, dbName)
+		if jobQueueFull(c, err) {
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		for _, z := range tablesViews {
+			if strings.EqualFold(z, name) {
+				c.JSON(http.StatusConflict, gin.H{
+					"error": "The database already has a table or view with that name",
+				})
+				return
+			}
+		}
+	}
+
+	err = database.TransformationSave(t)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// transformationsHandler returns the transformations of a live database, along with when they last ran and whether
+// that failed
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    https://api.dbhub.io/v1/transformations
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+func transformationsHandler(c *gin.Context) {
+	dbOwner, dbName, ok := transformationAccess(c, false)
+	if !ok {
+		return
+	}
+
+	list, err := database.Transformations(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, list)
+}
+
+// transformationAccess checks the database in the request is a live database the user can access.  Only the owner of
+// a database can change its transformations, so that's checked too when ownerOnly is set
+func transformationAccess(c *gin.Context, ownerOnly bool) (dbOwner, dbName string, ok bool) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if ownerOnly && !strings.EqualFold(loggedInUser, dbOwner) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Only the owner of a database can change its transformations",
+		})
+		return
+	}
+	isLive, _, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !isLive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Only live databases have transformations",
+		})
+		return
+	}
+	return dbOwner, dbName, true
+}
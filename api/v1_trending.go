@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// Maximum number of trending databases returned by a single request
+const trendingMaxLimit = 100
+
+// trendingHandler returns a page of the public databases which are trending at the moment, highest scoring first.
+// The trending score adds up the recent stars, forks, downloads, and views of each database, with older activity
+// counting for less.  It is recalculated every hour
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F limit="10" https://api.dbhub.io/v1/trending
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "offset" is the (optional) number of databases to skip.  Defaults to 0
+//	* "limit" is the (optional) maximum number of databases to return, up to 100.  Defaults to 25
+func trendingHandler(c *gin.Context) {
+	// Validate the paging parameters
+	offset, limit := 0, 25
+	var err error
+	if o := c.PostForm("offset"); o != "" {
+		offset, err = strconv.Atoi(o)
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid offset",
+			})
+			return
+		}
+	}
+	if l := c.PostForm("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > trendingMaxLimit {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid limit.  It needs to be between 1 and %d", trendingMaxLimit),
+			})
+			return
+		}
+	}
+
+	// Retrieve the trending databases
+	list, total, err := database.Trending(offset, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if list == nil {
+		list = []database.TrendingEntry{}
+	}
+	c.JSON(200, gin.H{
+		"databases": list,
+		"total":     total,
+	})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// uploadPagesHandler adds a new commit to an existing standard database, from just the pages of the database file
+// which have changed since the commit it's based on.  The new database file is rebuilt on the server, and checked
+// against the given SHA256 before being added.  If the check fails, the whole file needs to be uploaded instead
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbname="Join Testing.sqlite" -F pages=@changed.pages \
+//	    -F pagesize=4096 -F size=1048576 -F dbshasum="..." -F branch=main -F commitmsg="stuff" \
+//	    -F "commit=51d494f2c5eb6734ddaa204eccb9597b426091c79c951924ac83c72038f22b55" https://api.dbhub.io/v1/uploadpages
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbname" is the name of the database being updated
+//	* "commit" is the commit ID the changed pages are based on
+//	* "pages" is a file holding the changed pages.  Each page is a 4 byte big endian page number (starting from 1),
+//	   followed by the page data
+//	* "pagesize" is the page size of the database, in bytes
+//	* "size" is the size of the new database file, in bytes
+//	* "dbshasum" is the SHA256 of the new database file
+//	* "branch" (optional) is the database branch this commit is for.  Uses the default database branch if not specified
+//	* "commitmsg" (optional) is a message to include with the commit.  Often a description of the changes in the new data
+//	* "force" (optional) is a boolean string ("true", "false"), for whether to overwrite newer commits on the branch
+//	* "merge" (optional) is a boolean string ("true", "false"), for whether to merge the changes into the branch when
+//	   newer commits have been added to it since the base commit
+//	* The other optional fields of the upload call are accepted too
+func uploadPagesHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	// Set the maximum accepted request size.  The size of the rebuilt database is checked too
+	maxSize, err := database.MaxUploadSizeForUser(loggedInUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if maxSize != -1 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize)
+	}
+
+	// Extract the database name and commit ID for the database from the request
+	_, dbName, commitID, err := com.GetFormODC(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Store database path for later logging
+	dbOwner := loggedInUser // We always use the API key user as the database owner for uploads
+	c.Set("owner", dbOwner)
+	c.Set("database", dbName)
+
+	// Live databases aren't stored as commits, so there's nothing to apply the pages to
+	isLive, _, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if isLive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Changed pages can only be uploaded for standard databases",
+		})
+		return
+	}
+
+	// Rebuild and add the new database
+	x, httpStatus, err := com.UploadPagesResponse(c.Request, loggedInUser, dbOwner, dbName, commitID, "api")
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// When the changes were merged into a branch which had moved on, include the result of that
+	resp := gin.H{
+		"commit": x["commit_id"],
+		"url":    x["url"],
+	}
+	for _, k := range []string{"merged", "merge_request", "conflicts"} {
+		if v, ok := x[k]; ok {
+			resp[k] = v
+		}
+	}
+	c.JSON(http.StatusCreated, resp)
+}
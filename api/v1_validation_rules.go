@@ -0,0 +1,472 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// validationRuleMaxCount is the most validation rules a database can have
+const validationRuleMaxCount = 50
+
+// validationResultsHandler returns the outcome of checking a commit against the validation rules of a database
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F commit="ea12b36fc2b1a1fb8a3a8b8c1b7b2b1e0fb1e8a1d4a6b6e2c0c3b6f8a1c2d3e4" https://api.dbhub.io/v1/validationresults
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "commit" is the commit ID to return the validation results of
+func validationResultsHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	_, dbOwner, dbName, commitID, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if commitID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "A commit ID is needed",
+		})
+		return
+	}
+
+	result, err := database.ValidationResultFor(dbOwner, dbName, commitID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if result == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "That commit hasn't been checked against validation rules",
+		})
+		return
+	}
+	c.JSON(200, result)
+}
+
+// validationRuleDeleteHandler removes a validation rule from one of your databases
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F name="No negative prices" https://api.dbhub.io/v1/validationruledelete
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "name" is the name of the validation rule
+func validationRuleDeleteHandler(c *gin.Context) {
+	dbOwner, dbName, ok := validationRuleOwnerAccess(c)
+	if !ok {
+		return
+	}
+
+	exists, err := database.ValidationRuleDelete(dbOwner, dbName, c.PostForm("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Validation rule not found",
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// validationRuleSaveHandler adds a validation rule to one of your databases, or changes an existing one.  Each new
+// commit of the database is checked against its validation rules, with the outcome posted as the "dbhub/validation"
+// status of the commit.  Commits failing a blocking rule aren't accepted, and merge requests whose head commit fails
+// one can't be merged
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F name="Orders have a customer" -F type="not_null" -F table="orders" -F column="customer_id" \
+//	    -F blocking="true" https://api.dbhub.io/v1/validationrulesave
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "name" is the name of the validation rule
+//	* "type" is the type of rule, either "assertion", "not_null", "unique", or "row_count"
+//	* "table" is the (optional) table the rule checks.  Needed for all types of rule except "assertion"
+//	* "column" is the (optional) column the rule checks.  Needed for "not_null" and "unique" rules
+//	* "sql" is an (optional) base64 encoded SELECT query which returns no rows when the data is valid.  Needed for "assertion" rules
+//	* "minrows" is the (optional) number of rows the table needs at least, for "row_count" rules
+//	* "maxrows" is the (optional) number of rows the table can have at most, for "row_count" rules
+//	* "blocking" is an (optional) boolean for whether commits failing the rule are rejected
+func validationRuleSaveHandler(c *gin.Context) {
+	dbOwner, dbName, ok := validationRuleOwnerAccess(c)
+	if !ok {
+		return
+	}
+
+	// Validate the rule details
+	rule := database.ValidationRule{
+		Name: c.PostForm("name"),
+		Type: c.PostForm("type"),
+	}
+	if com.ValidateValidationRuleName(rule.Name) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid validation rule name",
+		})
+		return
+	}
+	validType := false
+	for _, z := range com.ValidationRuleTypes {
+		if rule.Type == z {
+			validType = true
+		}
+	}
+	if !validType {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("The type needs to be one of: %s", strings.Join(com.ValidationRuleTypes, ", ")),
+		})
+		return
+	}
+	var err error
+	switch rule.Type {
+	case "assertion":
+		rule.SQL, err = com.CheckUnicode(c.PostForm("sql"), true)
+		if err != nil || strings.TrimSpace(rule.SQL) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid SQL query",
+			})
+			return
+		}
+	case "not_null", "unique":
+		rule.Column = c.PostForm("column")
+		if com.ValidateFieldName(rule.Column) != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid column name",
+			})
+			return
+		}
+	case "row_count":
+		for _, z := range []struct {
+			field string
+			val   **int64
+		}{{"minrows", &rule.MinRows}, {"maxrows", &rule.MaxRows}} {
+			s := c.PostForm(z.field)
+			if s == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil || n < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": fmt.Sprintf("Invalid %s value", z.field),
+				})
+				return
+			}
+			*z.val = &n
+		}
+		if rule.MinRows == nil && rule.MaxRows == nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Row count rules need a minrows or maxrows value",
+			})
+			return
+		}
+		if rule.MinRows != nil && rule.MaxRows != nil && *rule.MinRows > *rule.MaxRows {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "The minrows value can't be larger than the maxrows one",
+			})
+			return
+		}
+	}
+	if rule.Type != "assertion" {
+		rule.Table = c.PostForm("table")
+		if com.ValidatePGTable(rule.Table) != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid table name",
+			})
+			return
+		}
+	}
+	if z := c.PostForm("blocking"); z != "" {
+		rule.Blocking, err = strconv.ParseBool(z)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid blocking value",
+			})
+			return
+		}
+	}
+
+	// Limit the number of rules, as they're all run for each new commit
+	list, err := database.ValidationRules(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	exists := false
+	for _, z := range list {
+		if z.Name == rule.Name {
+			exists = true
+		}
+	}
+	if !exists && len(list) >= validationRuleMaxCount {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Databases can have at most %d validation rules", validationRuleMaxCount),
+		})
+		return
+	}
+
+	err = database.ValidationRuleSave(dbOwner, dbName, rule)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status": "OK",
+	})
+}
+
+// validationRulesExportHandler returns the validation rules of a database for a table, as a Great Expectations
+// expectation suite or a JSON Schema.  Rules which can't be described in the format are left out
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F format="greatexpectations" -F table="orders" https://api.dbhub.io/v1/validationrulesexport
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "format" is the format to export the rules in, either "greatexpectations" or "jsonschema"
+//	* "table" is the table to export the rules of
+func validationRulesExportHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	_, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	format, ok := validationSuiteFormat(c)
+	if !ok {
+		return
+	}
+	table := c.PostForm("table")
+	if com.ValidatePGTable(table) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid table name",
+		})
+		return
+	}
+
+	rules, err := database.ValidationRules(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if format == "jsonschema" {
+		c.JSON(200, com.ValidationRulesToJSONSchema(rules, table))
+		return
+	}
+	c.JSON(200, com.ValidationRulesToGreatExpectations(rules, table))
+}
+
+// validationRulesImportHandler adds validation rules to one of your databases from a Great Expectations expectation
+// suite or a JSON Schema for a table.  Existing rules with the same names are replaced
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F format="greatexpectations" -F table="orders" -F file=@orders_suite.json \
+//	    https://api.dbhub.io/v1/validationrulesimport
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "format" is the format of the file, either "greatexpectations" or "jsonschema"
+//	* "file" is the expectation suite or JSON Schema
+//	* "table" is the (optional) table the rules are for.  Uses the name of the suite, or the title of the schema if not specified
+//	* "blocking" is an (optional) boolean for whether commits failing the imported rules are rejected
+func validationRulesImportHandler(c *gin.Context) {
+	dbOwner, dbName, ok := validationRuleOwnerAccess(c)
+	if !ok {
+		return
+	}
+	format, ok := validationSuiteFormat(c)
+	if !ok {
+		return
+	}
+	table := c.PostForm("table")
+	var blocking bool
+	var err error
+	if z := c.PostForm("blocking"); z != "" {
+		blocking, err = strconv.ParseBool(z)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid blocking value",
+			})
+			return
+		}
+	}
+
+	// Convert the uploaded file to validation rules
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Something went wrong when grabbing the file data: '%s'", err.Error()),
+		})
+		return
+	}
+	if fileHeader.Size > com.ValidationSuiteMaxSize {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "The file is too large",
+		})
+		return
+	}
+	src, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "Failed to open uploaded file for reading",
+		})
+		return
+	}
+	defer src.Close()
+	var rules []database.ValidationRule
+	var skipped []string
+	if format == "jsonschema" {
+		rules, skipped, err = com.ValidationRulesFromJSONSchema(src, table, blocking)
+	} else {
+		rules, skipped, err = com.ValidationRulesFromGreatExpectations(src, table, blocking)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	for _, r := range rules {
+		if com.ValidateValidationRuleName(r.Name) != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("Invalid validation rule name: '%s'", r.Name),
+			})
+			return
+		}
+	}
+
+	// Make sure the database doesn't end up with too many rules
+	existing, err := database.ValidationRules(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	names := make(map[string]bool)
+	for _, r := range existing {
+		names[r.Name] = true
+	}
+	for _, r := range rules {
+		names[r.Name] = true
+	}
+	if len(names) > validationRuleMaxCount {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("Databases can have at most %d validation rules", validationRuleMaxCount),
+		})
+		return
+	}
+
+	imported := []string{}
+	for _, r := range rules {
+		err = database.ValidationRuleSave(dbOwner, dbName, r)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		imported = append(imported, r.Name)
+	}
+	if skipped == nil {
+		skipped = []string{}
+	}
+	c.JSON(200, gin.H{
+		"imported": imported,
+		"skipped":  skipped,
+	})
+}
+
+// validationRulesHandler returns the validation rules of a database
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    https://api.dbhub.io/v1/validationrules
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+func validationRulesHandler(c *gin.Context) {
+	// Do auth check, grab request info
+	_, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	list, err := database.ValidationRules(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if list == nil {
+		list = []database.ValidationRule{}
+	}
+	c.JSON(200, list)
+}
+
+// validationRuleOwnerAccess checks the user is the owner of the database in the request, as only they can change its
+// validation rules
+func validationRuleOwnerAccess(c *gin.Context) (dbOwner, dbName string, ok bool) {
+	// Do auth check, grab request info
+	loggedInUser, dbOwner, dbName, _, httpStatus, err := collectInfo(c)
+	if err != nil {
+		c.JSON(httpStatus, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !strings.EqualFold(loggedInUser, dbOwner) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Only the owner of a database can change its validation rules",
+		})
+		return
+	}
+	return dbOwner, dbName, true
+}
+
+// validationSuiteFormat returns the validation rule import or export format in the request, after checking it's known
+func validationSuiteFormat(c *gin.Context) (format string, ok bool) {
+	format = c.PostForm("format")
+	for _, z := range com.ValidationSuiteFormats {
+		if format == z {
+			return format, true
+		}
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": fmt.Sprintf("The format needs to be one of: %s", strings.Join(com.ValidationSuiteFormats, ", ")),
+	})
+	return "", false
+}
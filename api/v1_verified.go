@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// VerifiedDatabase holds the details of a database which has been verified by the instance admins
+type VerifiedDatabase struct {
+	Database     string    `json:"database"`
+	DateVerified time.Time `json:"date_verified"`
+	DisplayName  string    `json:"display_name"`
+	Owner        string    `json:"owner"`
+}
+
+// verifiedHandler returns the list of public databases which have been verified by the instance admins
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" https://api.dbhub.io/v1/verified
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+func verifiedHandler(c *gin.Context) {
+	dbs, err := database.VerifiedDBs()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	list := []VerifiedDatabase{}
+	for _, j := range dbs {
+		list = append(list, VerifiedDatabase{
+			Database:     j.DBName,
+			DateVerified: j.DateEntry,
+			DisplayName:  j.OwnerDisplayName,
+			Owner:        j.Owner,
+		})
+	}
+	c.JSON(200, list)
+}
+
+// verifyHandler marks a database as verified, or removes the verification again.  It can only be used by the
+// instance admins
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -F apikey="YOUR_API_KEY_HERE" -F dbowner="justinclift" -F dbname="Join Testing.sqlite" \
+//	    -F verified="true" https://api.dbhub.io/v1/verify
+//	* "apikey" is one of your API keys.  These can be generated from your Settings page once logged in
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "verified" is a boolean.  Either "true" to mark the database as verified, or "false" to remove the verification
+func verifyHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+
+	// Only instance admins can change the verified status of databases
+	usr, err := database.User(loggedInUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !usr.IsAdmin {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Only administrators can verify databases",
+		})
+		return
+	}
+
+	// Extract the database owner and name, and the new status
+	dbOwner, dbName, _, err := com.GetFormODC(c.Request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	c.Set("owner", dbOwner)
+	c.Set("database", dbName)
+	verified, err := strconv.ParseBool(c.PostForm("verified"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid value for verified",
+		})
+		return
+	}
+
+	exists, err := database.SetDBVerified(loggedInUser, dbOwner, dbName, verified)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "Database does not exist",
+		})
+		return
+	}
+	c.JSON(200, gin.H{
+		"status":   "OK",
+		"verified": verified,
+	})
+}
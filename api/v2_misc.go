@@ -1,9 +1,30 @@
 package main
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
 )
 
+// GET /health
+// This returns the health of the API server's PostgreSQL connection pool, for load balancers and monitoring.  It doesn't
+// need authentication, and the HTTP status is 503 when PostgreSQL can't be used
+func healthHandler(c *gin.Context) {
+	h, err := database.Health()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"database": h,
+			"status":   "unavailable",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"database": h,
+		"status":   "ok",
+	})
+}
+
 // GET /v2/status
 // This is a very simple call which returns an OK status if the user has been authenticated successfully
 func statusHandler(c *gin.Context) {
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// How long clients and caches may keep the pages of a database before checking whether they're still allowed to access
+// them.  The file of a commit never changes, but the database can still be made private or deleted
+const pagesMaxAge = 24 * 60 * 60
+
+// pagesHandler serves the database file of a commit as a read only static object, so SQLite clients using an HTTP VFS
+// (eg sql.js-httpvfs) can query it by retrieving just the pages they need with range requests, instead of downloading
+// the whole database.  Public databases can also be retrieved without authentication, using /pages/ instead of
+// /v2/pages/.  Unlike downloads, these requests aren't recorded as downloads of the database.
+// This can be run from the command line using curl, like this:
+//
+//	$ curl -H "Authorization: apikey YOUR_API_KEY_HERE" -H "Range: bytes=0-99" \
+//	    "https://api.dbhub.io/v2/pages/justinclift/Join%20Testing.sqlite/COMMIT_ID"
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "commit" is the ID of the commit
+func pagesHandler(c *gin.Context) {
+	// Requests to the public end point aren't authenticated
+	loggedInUser := c.GetString("user")
+
+	// Validate the database and commit
+	dbOwner := c.Param("dbowner")
+	dbName := c.Param("dbname")
+	commitID := c.Param("commit")
+	err := com.ValidateUserDB(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid database owner or name",
+		})
+		return
+	}
+	err = com.ValidateCommitID(commitID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid commit ID",
+		})
+		return
+	}
+
+	// Store database path for later logging
+	c.Set("owner", dbOwner)
+	c.Set("database", dbName)
+
+	// Check if the requested database exists
+	exists, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Database '%s/%s' doesn't exist", dbOwner, dbName),
+		})
+		return
+	}
+
+	// Live databases change all the time and don't have commits, so can't be served this way
+	isLive, _, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if isLive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "That database is a live database.  It can't be retrieved by pages.",
+		})
+		return
+	}
+
+	// Retrieve the Minio details of the database file for the commit
+	bucket, id, lastModified, err := com.MinioLocation(dbOwner, dbName, commitID, loggedInUser)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Commit '%s' of database '%s/%s' doesn't exist", commitID, dbOwner, dbName),
+		})
+		return
+	}
+
+	// Responses for authenticated requests mustn't be stored by shared caches, as the database could be private
+	if loggedInUser == "" {
+		c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", pagesMaxAge))
+	} else {
+		c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", pagesMaxAge))
+	}
+	c.Header("Accept-Ranges", "bytes")
+	if com.NotModified(c.Writer, c.Request, `"`+bucket+id+`"`, lastModified) {
+		return
+	}
+
+	// Get a handle from Minio for the database file
+	userDB, err := com.MinioHandle(bucket, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	defer com.MinioHandleClose(userDB)
+
+	// Send the requested parts of the file, or all of it if no range was given
+	com.ServeDatabaseRange(c.Writer, c.Request, userDB, lastModified)
+}
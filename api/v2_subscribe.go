@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+	"golang.org/x/net/websocket"
+)
+
+// Minimum amount of time between runs of a subscribed query, so databases which change often don't keep the live
+// nodes busy.  Changes made in the meantime are picked up by the next run
+const subscribeMinInterval = time.Second
+
+// subscribeHandler is a WebSocket end point which runs a query on a live database, then runs it again and sends the new
+// results each time the database is changed.  Each message sent is a JSON object with either the "results" of the
+// query, or an "error".  Messages sent by the client are ignored.  The subscription lasts until the connection is closed
+// This can be run from the command line using websocat, like this:
+//
+//	$ websocat -H "Authorization: apikey YOUR_API_KEY_HERE" \
+//	    "wss://api.dbhub.io/v2/subscribe?dbowner=justinclift&dbname=Join%20Testing.sqlite&sql=U0VMRUNUICogRlJPTSB0YWJsZTE="
+//	* "dbowner" is the owner of the database
+//	* "dbname" is the name of the database
+//	* "sql" is the SQL query to run, base64 encoded
+//	* "format" is the (optional) layout of the returned data.  Either "rows" (the default) or "columnar"
+func subscribeHandler(c *gin.Context) {
+	loggedInUser := c.MustGet("user").(string)
+	key := c.MustGet("key").(database.APIKey)
+
+	// Validate the database and query
+	dbOwner := c.Query("dbowner")
+	dbName := c.Query("dbname")
+	err := com.ValidateUserDB(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Invalid database owner or name",
+		})
+		return
+	}
+
+	// Store database path for later logging
+	c.Set("owner", dbOwner)
+	c.Set("database", dbName)
+
+	query, err := com.CheckUnicode(c.Query("sql"), true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	format := c.Query("format")
+	if format != "" && format != "rows" && format != "columnar" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Unknown output format requested",
+		})
+		return
+	}
+
+	// Check if the requested database exists
+	exists, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": fmt.Sprintf("Database '%s/%s' doesn't exist", dbOwner, dbName),
+		})
+		return
+	}
+
+	// Only live databases can change, so subscriptions only make sense for them
+	isLive, liveNode, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !isLive {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Subscriptions are only available for live databases",
+		})
+		return
+	}
+	if liveNode == "" {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "No job queue node available for request",
+		})
+		return
+	}
+
+	s := websocket.Server{
+		Handshake: func(_ *websocket.Config, r *http.Request) error {
+			// Requests authenticated with the session cookie of the web UI need to come from the web UI, so other
+			// sites can't open subscriptions for logged in users
+			if key.ID == 0 && r.Header.Get("Origin") != "https://"+config.Conf.Web.ServerName {
+				return fmt.Errorf("Origin not allowed")
+			}
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+
+			// The write timeout of the API server is still set on the connection, which doesn't suit long running
+			// subscriptions
+			ws.SetDeadline(time.Time{})
+
+			// Watch for the client closing the connection
+			closed := make(chan struct{})
+			go func() {
+				var msg []byte
+				for websocket.Message.Receive(ws, &msg) == nil {
+				}
+				close(closed)
+			}()
+
+			changed, cancel := com.LiveSubscribe(dbOwner, dbName)
+			defer cancel()
+			for {
+				err := sendSubscriptionResults(ws, liveNode, loggedInUser, dbOwner, dbName, query, format)
+				if err != nil {
+					return
+				}
+
+				// Wait for the database to change, then give it a moment in case more changes follow
+				select {
+				case <-closed:
+					return
+				case <-changed:
+				}
+				select {
+				case <-closed:
+					return
+				case <-time.After(subscribeMinInterval):
+				}
+			}
+		},
+	}
+	s.ServeHTTP(c.Writer, c.Request)
+}
+
+// sendSubscriptionResults runs a subscribed query, then sends the results to the client.  Errors from the query itself
+// are sent to the client rather than returned, as a later change to the database may fix them
+func sendSubscriptionResults(ws *websocket.Conn, liveNode, loggedInUser, dbOwner, dbName, query, format string) error {
+	data, err := com.LiveQuery(liveNode, loggedInUser, dbOwner, dbName, query)
+	if err != nil {
+		return websocket.JSON.Send(ws, gin.H{"error": err.Error()})
+	}
+	if format == "columnar" {
+		return websocket.JSON.Send(ws, gin.H{"results": com.ColumnarResponse(data)})
+	}
+	return websocket.JSON.Send(ws, gin.H{"results": data.Records})
+}
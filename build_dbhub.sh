@@ -65,6 +65,12 @@ if [ -d "${GOBIN}" ]; then
     go install .
     cd ..
   )
+  (
+    echo "Compiling DBHub.io gRPC API daemon"
+    cd grpcapi || exit 10
+    go install .
+    cd ..
+  )
   (
     echo "Compiling DBHub.io Live daemon"
     cd live || exit 7
@@ -0,0 +1,212 @@
+// Package client provides typed access to the DBHub.io API.
+//
+// The methods for each API end point are generated from the OpenAPI document of the API server (api/openapi.json),
+// by running "go run ./standalone/openapi" from the root of the source tree.  For example:
+//
+//	c := client.New("YOUR_API_KEY_HERE")
+//	var branches map[string]interface{}
+//	err := c.Branches(ctx, client.BranchesParams{DBOwner: "justinclift", DBName: "Join Testing.sqlite"}, &branches)
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultServer is the address of the public DBHub.io API server
+const DefaultServer = "https://api.dbhub.io"
+
+// Client is a connection to a DBHub.io API server
+type Client struct {
+	// APIKey is the API key sent with each request.  These can be generated from your Settings page on DBHub.io
+	APIKey string
+
+	// Server is the address of the API server.  Defaults to DefaultServer
+	Server string
+
+	// HTTPClient is the HTTP client used for the requests.  Defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// Error is returned when the API server responds with an error
+type Error struct {
+	Message    string
+	StatusCode int
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("dbhub: server returned status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("dbhub: %s (status %d)", e.Message, e.StatusCode)
+}
+
+// New returns a client for the public DBHub.io API server, using the given API key
+func New(apiKey string) *Client {
+	return &Client{
+		APIKey: apiKey,
+		Server: DefaultServer,
+	}
+}
+
+// Bool returns a pointer to a boolean, for setting optional boolean parameters
+func Bool(b bool) *bool {
+	return &b
+}
+
+// Int returns a pointer to an integer, for setting optional integer parameters
+func Int(i int) *int {
+	return &i
+}
+
+// form holds the parameters of a request
+type form struct {
+	files  map[string]io.Reader
+	values url.Values
+}
+
+func newForm() *form {
+	return &form{
+		files:  make(map[string]io.Reader),
+		values: make(url.Values),
+	}
+}
+
+func (f *form) bool(name string, value bool) {
+	f.values.Set(name, strconv.FormatBool(value))
+}
+
+func (f *form) file(name string, r io.Reader) {
+	if r != nil {
+		f.files[name] = r
+	}
+}
+
+func (f *form) int(name string, value int) {
+	f.values.Set(name, strconv.Itoa(value))
+}
+
+func (f *form) optionalBool(name string, value *bool) {
+	if value != nil {
+		f.bool(name, *value)
+	}
+}
+
+func (f *form) optionalInt(name string, value *int) {
+	if value != nil {
+		f.int(name, *value)
+	}
+}
+
+func (f *form) optionalString(name, value string) {
+	if value != "" {
+		f.string(name, value)
+	}
+}
+
+func (f *form) string(name, value string) {
+	f.values.Set(name, value)
+}
+
+// call sends a request to an API end point.  The API key is sent as a form field, or in the Authorization header when
+// headerAuth is true.  A successful response is decoded as JSON into out, unless out is an io.Writer in which case the
+// response is copied to it as is
+func (c *Client) call(ctx context.Context, method, path string, headerAuth bool, f *form, out interface{}) error {
+	server := c.Server
+	if server == "" {
+		server = DefaultServer
+	}
+	if !headerAuth {
+		f.string("apikey", c.APIKey)
+	}
+
+	// Encode the parameters.  A multipart form is used when uploading files
+	var body io.Reader
+	var contentType string
+	if method == http.MethodGet {
+		if len(f.values) > 0 {
+			path += "?" + f.values.Encode()
+		}
+	} else if len(f.files) > 0 {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for name, values := range f.values {
+			for _, v := range values {
+				if err := mw.WriteField(name, v); err != nil {
+					return err
+				}
+			}
+		}
+		for name, r := range f.files {
+			fileName := f.values.Get("dbname")
+			if fileName == "" {
+				fileName = name
+			}
+			w, err := mw.CreateFormFile(name, fileName)
+			if err != nil {
+				return err
+			}
+			if _, err = io.Copy(w, r); err != nil {
+				return err
+			}
+		}
+		if err := mw.Close(); err != nil {
+			return err
+		}
+		body = &buf
+		contentType = mw.FormDataContentType()
+	} else {
+		body = strings.NewReader(f.values.Encode())
+		contentType = "application/x-www-form-urlencoded"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(server, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if headerAuth {
+		req.Header.Set("Authorization", "apikey "+c.APIKey)
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Errors are returned as a JSON object with an "error" field, though not always
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&e) == nil {
+			apiErr.Message = e.Error
+		}
+		return apiErr
+	}
+
+	switch o := out.(type) {
+	case nil:
+		return nil
+	case io.Writer:
+		_, err = io.Copy(o, resp.Body)
+		return err
+	default:
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+}
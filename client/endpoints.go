@@ -0,0 +1,3600 @@
+// Code generated by standalone/openapi from api/openapi.json. DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"io"
+)
+
+// Make sure the io package is used, even when no end point takes a file
+var _ io.Reader
+
+// AbuseReportParams holds the parameters for AbuseReport
+type AbuseReportParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The (optional) ID of a discussion comment on the database to report, rather than the database itself
+	ComID string
+	// One of "copyright", "harassment", "illegal", "malware", "spam", or "other"
+	Reason string
+	// An (optional) explanation for the admins
+	Details string
+}
+
+// AbuseReport reports a database, or a comment in one of its discussions, to the instance admins (POST /v1/abusereport)
+// The response is decoded into out, unless it's nil
+func (c *Client) AbuseReport(ctx context.Context, p AbuseReportParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.optionalString("comid", p.ComID)
+	f.string("reason", p.Reason)
+	f.optionalString("details", p.Details)
+	return c.call(ctx, "POST", "/v1/abusereport", false, f, out)
+}
+
+// AlertHistoryParams holds the parameters for AlertHistory
+type AlertHistoryParams struct {
+	// The name of the alert rule
+	Name string
+}
+
+// AlertHistory returns the most recent evaluations of an alert rule, newest first (POST /v1/alerthistory)
+// The response is decoded into out, unless it's nil
+func (c *Client) AlertHistory(ctx context.Context, p AlertHistoryParams, out interface{}) error {
+	f := newForm()
+	f.string("name", p.Name)
+	return c.call(ctx, "POST", "/v1/alerthistory", false, f, out)
+}
+
+// AlertRuleDeleteParams holds the parameters for AlertRuleDelete
+type AlertRuleDeleteParams struct {
+	// The name of the alert rule
+	Name string
+}
+
+// AlertRuleDelete removes an alert rule, along with its history (POST /v1/alertruledelete)
+// The response is decoded into out, unless it's nil
+func (c *Client) AlertRuleDelete(ctx context.Context, p AlertRuleDeleteParams, out interface{}) error {
+	f := newForm()
+	f.string("name", p.Name)
+	return c.call(ctx, "POST", "/v1/alertruledelete", false, f, out)
+}
+
+// AlertRules returns the alert rules of the user, along with their current state (POST /v1/alertrules)
+// The response is decoded into out, unless it's nil
+func (c *Client) AlertRules(ctx context.Context, out interface{}) error {
+	f := newForm()
+	return c.call(ctx, "POST", "/v1/alertrules", false, f, out)
+}
+
+// AlertRuleSaveParams holds the parameters for AlertRuleSave
+type AlertRuleSaveParams struct {
+	// The name of the alert rule
+	Name string
+	// The owner and name of the live database to run the query on
+	DBOwner string
+	// The owner and name of the live database to run the query on
+	DBName string
+	// The name of the saved query to run
+	Query string
+	// When the rule is evaluated, as a five field cron schedule in UTC (eg "0 * * * *"), or one of "@hourly", "@daily", "@weekly", "@monthly", or "@yearly".  Rules can't be evaluated more than once every 15 minutes
+	Schedule string
+	// What's checked.  Either "rows" for the number of rows returned, or "value" for the numeric value of the first column of the first row
+	Metric int
+	// When the alert triggers.  Either "above", "below", or "equal" to compare the metric with the threshold, or "drop" or "rise" for when it changes by at least the threshold percentage since the last evaluation
+	Condition string
+	// The number the metric is compared with, or the percentage for "drop" and "rise"
+	Threshold string
+	// How you're notified.  Either "email" to your email address, or "webhook"
+	Delivery string
+	// The address the alert is POSTed to, when notifying a webhook.  The requests are signed with the returned secret, in the "X-DBHub-Signature" header
+	Webhookurl string
+}
+
+// AlertRuleSave adds an alert rule, or changes an existing one (POST /v1/alertrulesave)
+// The response is decoded into out, unless it's nil
+func (c *Client) AlertRuleSave(ctx context.Context, p AlertRuleSaveParams, out interface{}) error {
+	f := newForm()
+	f.string("name", p.Name)
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("query", p.Query)
+	f.string("schedule", p.Schedule)
+	f.int("metric", p.Metric)
+	f.string("condition", p.Condition)
+	f.string("threshold", p.Threshold)
+	f.string("delivery", p.Delivery)
+	f.string("webhookurl", p.Webhookurl)
+	return c.call(ctx, "POST", "/v1/alertrulesave", false, f, out)
+}
+
+// AnalyticsParams holds the parameters for Analytics
+type AnalyticsParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The (optional) first day to return, in YYYY-MM-DD format.  Defaults to 29 days before "to"
+	From string
+	// The (optional) last day to return, in YYYY-MM-DD format.  Defaults to today
+	To string
+}
+
+// Analytics returns the daily traffic of one of your databases: the number of downloads, clones (downloads by DB4S and Dio), page views, and API queries on each day (POST /v1/analytics)
+// The response is decoded into out, unless it's nil
+func (c *Client) Analytics(ctx context.Context, p AnalyticsParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.optionalString("from", p.From)
+	f.optionalString("to", p.To)
+	return c.call(ctx, "POST", "/v1/analytics", false, f, out)
+}
+
+// ApiCallsParams holds the parameters for ApiCalls
+type ApiCallsParams struct {
+	// The (optional) ID of one of your API keys.  When given, only the calls made with that key are returned
+	Key string
+	// An (optional) boolean.  When "true", only the calls which failed (with a 4xx or 5xx status code) are returned
+	Failed *bool
+	// The (optional) number of calls to skip.  Defaults to 0
+	Offset *int
+	// The (optional) maximum number of calls to return, up to 100.  Defaults to 25
+	Limit *int
+}
+
+// ApiCalls returns a page of your most recent API calls, newest first (POST /v1/apicalls)
+// The response is decoded into out, unless it's nil
+func (c *Client) ApiCalls(ctx context.Context, p ApiCallsParams, out interface{}) error {
+	f := newForm()
+	f.optionalString("key", p.Key)
+	f.optionalBool("failed", p.Failed)
+	f.optionalInt("offset", p.Offset)
+	f.optionalInt("limit", p.Limit)
+	return c.call(ctx, "POST", "/v1/apicalls", false, f, out)
+}
+
+// ApiKeyUsageParams holds the parameters for ApiKeyUsage
+type ApiKeyUsageParams struct {
+	// The (optional) number of days to summarise, up to 366.  Defaults to 30
+	Days *int
+}
+
+// ApiKeyUsage returns a summary of the API calls made with each of your API keys over a number of days: the number of calls, how many of them failed, their average run time, and when each key was last used (POST /v1/apikeyusage)
+// The response is decoded into out, unless it's nil
+func (c *Client) ApiKeyUsage(ctx context.Context, p ApiKeyUsageParams, out interface{}) error {
+	f := newForm()
+	f.optionalInt("days", p.Days)
+	return c.call(ctx, "POST", "/v1/apikeyusage", false, f, out)
+}
+
+// ArchiveParams holds the parameters for Archive
+type ArchiveParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// A boolean.  Either "true" to archive the database, or "false" to make it writable again
+	Archived bool
+}
+
+// Archive archives one of your databases, or makes it writable again (POST /v1/archive)
+// The response is decoded into out, unless it's nil
+func (c *Client) Archive(ctx context.Context, p ArchiveParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.bool("archived", p.Archived)
+	return c.call(ctx, "POST", "/v1/archive", false, f, out)
+}
+
+// AutoVersionParams holds the parameters for AutoVersion
+type AutoVersionParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// AutoVersion returns the standard database one of your live databases is automatically versioned into, how often new versions are committed, and the outcome of the last version (POST /v1/autoversion)
+// The response is decoded into out, unless it's nil
+func (c *Client) AutoVersion(ctx context.Context, p AutoVersionParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/autoversion", false, f, out)
+}
+
+// AutoVersionRemoveParams holds the parameters for AutoVersionRemove
+type AutoVersionRemoveParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// AutoVersionRemove stops automatically versioning one of your live databases (POST /v1/autoversionremove)
+// The response is decoded into out, unless it's nil
+func (c *Client) AutoVersionRemove(ctx context.Context, p AutoVersionRemoveParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/autoversionremove", false, f, out)
+}
+
+// AutoVersionSetParams holds the parameters for AutoVersionSet
+type AutoVersionSetParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The name of the standard database to commit the versions to.  It needs to be owned by the owner of the live database
+	Target string
+	// The (optional) branch of the target database to commit the versions to.  Defaults to its default branch
+	Branch string
+	// An (optional) boolean for whether to commit a new version after each change to the database, once the debounce time has passed.  Defaults to true
+	OnWrite *bool
+	// The (optional) number of seconds the database needs to go unchanged before a new version is committed.  Defaults to 300
+	Debounce *int
+	// The (optional) number of minutes between versions while the database is being changed.  Defaults to 0, for no scheduled versions
+	Interval *int
+	// The (optional) number of the most recent versions to keep on the branch.  Defaults to 0, which keeps all of them
+	Keep *int
+}
+
+// AutoVersionSet automatically commits versions of one of your live databases to a branch of one of your standard databases, replacing any existing settings (POST /v1/autoversionset)
+// The response is decoded into out, unless it's nil
+func (c *Client) AutoVersionSet(ctx context.Context, p AutoVersionSetParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("target", p.Target)
+	f.optionalString("branch", p.Branch)
+	f.optionalBool("onwrite", p.OnWrite)
+	f.optionalInt("debounce", p.Debounce)
+	f.optionalInt("interval", p.Interval)
+	f.optionalInt("keep", p.Keep)
+	return c.call(ctx, "POST", "/v1/autoversionset", false, f, out)
+}
+
+// BlobParams holds the parameters for Blob
+type BlobParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The (optional) commit ID to read the value from.  Uses the head commit of the default branch if not specified
+	Commit string
+	// The name of the table holding the value
+	Table string
+	// The name of the column holding the value
+	Column string
+	// The number of the row (its rowid) holding the value
+	Rowid int
+	// An (optional) boolean string ("true", "false"), for whether the value should be saved as a file rather than shown by web browsers.  Defaults to false
+	Download *bool
+}
+
+// Blob returns the value of a single BLOB or TEXT cell of a database, such as an image or PDF stored in it. The content type is worked out from the value, and HTTP range requests are supported, so large values can be previewed or downloaded without fetching the whole database (POST /v1/blob)
+// The response is decoded into out, unless it's nil
+func (c *Client) Blob(ctx context.Context, p BlobParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.optionalString("commit", p.Commit)
+	f.string("table", p.Table)
+	f.string("column", p.Column)
+	f.int("rowid", p.Rowid)
+	f.optionalBool("download", p.Download)
+	return c.call(ctx, "POST", "/v1/blob", false, f, out)
+}
+
+// BlockParams holds the parameters for Block
+type BlockParams struct {
+	// The user to block
+	User string
+	// An (optional) boolean for whether the user is also stopped from forking your databases
+	Preventforks *bool
+}
+
+// Block blocks a user (POST /v1/block)
+// The response is decoded into out, unless it's nil
+func (c *Client) Block(ctx context.Context, p BlockParams, out interface{}) error {
+	f := newForm()
+	f.string("user", p.User)
+	f.optionalBool("preventforks", p.Preventforks)
+	return c.call(ctx, "POST", "/v1/block", false, f, out)
+}
+
+// Blocks returns the users you've blocked (POST /v1/blocks)
+// The response is decoded into out, unless it's nil
+func (c *Client) Blocks(ctx context.Context, out interface{}) error {
+	f := newForm()
+	return c.call(ctx, "POST", "/v1/blocks", false, f, out)
+}
+
+// BranchesParams holds the parameters for Branches
+type BranchesParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// Branches returns the list of branches for a database (POST /v1/branches)
+// The response is decoded into out, unless it's nil
+func (c *Client) Branches(ctx context.Context, p BranchesParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/branches", false, f, out)
+}
+
+// BranchesDeleteParams holds the parameters for BranchesDelete
+type BranchesDeleteParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// A comma separated list of the branches to delete
+	Branches string
+}
+
+// BranchesDelete deletes branches of a database, along with the commits which are only part of them (POST /v1/branchesdelete)
+// The response is decoded into out, unless it's nil
+func (c *Client) BranchesDelete(ctx context.Context, p BranchesDeleteParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("branches", p.Branches)
+	return c.call(ctx, "POST", "/v1/branchesdelete", false, f, out)
+}
+
+// BulkDeleteParams holds the parameters for BulkDelete
+type BulkDeleteParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The name of the table
+	Table string
+	// The rows, either as a JSON array of objects or as CSV data with the column names on its first line
+	Rows string
+	// The (optional) format of the rows.  Either "json" (the default) or "csv"
+	Format string
+	// An (optional) boolean.  When true (the default), either all of the rows are changed or none of them are
+	Atomic *bool
+	// The (optional) number of rows in each batch, when the operation isn't atomic.  Defaults to 1000
+	Batchsize *int
+}
+
+// BulkDelete deletes rows from a table of a live database, finding them by the values of their primary key columns (POST /v1/bulkdelete)
+// The response is decoded into out, unless it's nil
+func (c *Client) BulkDelete(ctx context.Context, p BulkDeleteParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("table", p.Table)
+	f.string("rows", p.Rows)
+	f.optionalString("format", p.Format)
+	f.optionalBool("atomic", p.Atomic)
+	f.optionalInt("batchsize", p.Batchsize)
+	return c.call(ctx, "POST", "/v1/bulkdelete", false, f, out)
+}
+
+// BulkInsertParams holds the parameters for BulkInsert
+type BulkInsertParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The name of the table
+	Table string
+	// The rows, either as a JSON array of objects or as CSV data with the column names on its first line
+	Rows string
+	// The (optional) format of the rows.  Either "json" (the default) or "csv"
+	Format string
+	// An (optional) boolean.  When true (the default), either all of the rows are changed or none of them are
+	Atomic *bool
+	// The (optional) number of rows in each batch, when the operation isn't atomic.  Defaults to 1000
+	Batchsize *int
+}
+
+// BulkInsert inserts rows into a table of a live database (POST /v1/bulkinsert)
+// The response is decoded into out, unless it's nil
+func (c *Client) BulkInsert(ctx context.Context, p BulkInsertParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("table", p.Table)
+	f.string("rows", p.Rows)
+	f.optionalString("format", p.Format)
+	f.optionalBool("atomic", p.Atomic)
+	f.optionalInt("batchsize", p.Batchsize)
+	return c.call(ctx, "POST", "/v1/bulkinsert", false, f, out)
+}
+
+// BulkUpsertParams holds the parameters for BulkUpsert
+type BulkUpsertParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The name of the table
+	Table string
+	// The rows, either as a JSON array of objects or as CSV data with the column names on its first line
+	Rows string
+	// The (optional) format of the rows.  Either "json" (the default) or "csv"
+	Format string
+	// An (optional) boolean.  When true (the default), either all of the rows are changed or none of them are
+	Atomic *bool
+	// The (optional) number of rows in each batch, when the operation isn't atomic.  Defaults to 1000
+	Batchsize *int
+}
+
+// BulkUpsert inserts rows into a table of a live database, changing the existing rows with the same primary key instead (POST /v1/bulkupsert)
+// The response is decoded into out, unless it's nil
+func (c *Client) BulkUpsert(ctx context.Context, p BulkUpsertParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("table", p.Table)
+	f.string("rows", p.Rows)
+	f.optionalString("format", p.Format)
+	f.optionalBool("atomic", p.Atomic)
+	f.optionalInt("batchsize", p.Batchsize)
+	return c.call(ctx, "POST", "/v1/bulkupsert", false, f, out)
+}
+
+// CitationParams holds the parameters for Citation
+type CitationParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The name of the release
+	Release string
+	// The (optional) format of the metadata.  Either "datacite" (the default) or "cff"
+	Format string
+}
+
+// Citation returns the metadata for citing a release of a database, either as DataCite JSON or in the Citation File Format used for CITATION.cff files (POST /v1/citation)
+// The response is decoded into out, unless it's nil
+func (c *Client) Citation(ctx context.Context, p CitationParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("release", p.Release)
+	f.optionalString("format", p.Format)
+	return c.call(ctx, "POST", "/v1/citation", false, f, out)
+}
+
+// CkanParams holds the parameters for Ckan
+type CkanParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// Ckan returns the CKAN catalog a database is connected to, along with the outcome of the last sync with it (POST /v1/ckan)
+// The response is decoded into out, unless it's nil
+func (c *Client) Ckan(ctx context.Context, p CkanParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/ckan", false, f, out)
+}
+
+// CkanHarvestParams holds the parameters for CkanHarvest
+type CkanHarvestParams struct {
+	// The base URL of the CKAN catalog
+	CKANURL string
+	// The name of the CKAN dataset
+	Dataset string
+	// An (optional) CKAN API token, for harvesting private datasets
+	Token string
+	// The (optional) name for the new database.  Uses the name of the dataset if not specified
+	DBName string
+	// An (optional) boolean for whether the new database is public.  Defaults to private
+	Public *bool
+	// An (optional) boolean for whether to add a new commit to the database whenever the dataset changes
+	KeepUpdated *bool
+}
+
+// CkanHarvest creates a new database from the CSV resources of a CKAN dataset, with a table for each of them. Only resources stored in the CKAN catalogs this server can connect to are harvested (POST /v1/ckanharvest)
+// The response is decoded into out, unless it's nil
+func (c *Client) CkanHarvest(ctx context.Context, p CkanHarvestParams, out interface{}) error {
+	f := newForm()
+	f.string("ckanurl", p.CKANURL)
+	f.string("dataset", p.Dataset)
+	f.optionalString("token", p.Token)
+	f.optionalString("dbname", p.DBName)
+	f.optionalBool("public", p.Public)
+	f.optionalBool("keepupdated", p.KeepUpdated)
+	return c.call(ctx, "POST", "/v1/ckanharvest", false, f, out)
+}
+
+// CkanRemoveParams holds the parameters for CkanRemove
+type CkanRemoveParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// CkanRemove disconnects one of your databases from its CKAN catalog (POST /v1/ckanremove)
+// The response is decoded into out, unless it's nil
+func (c *Client) CkanRemove(ctx context.Context, p CkanRemoveParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/ckanremove", false, f, out)
+}
+
+// CkanSetParams holds the parameters for CkanSet
+type CkanSetParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// Either "publish" or "harvest"
+	Mode string
+	// The base URL of the CKAN catalog
+	CKANURL string
+	// The name of the CKAN dataset
+	Dataset string
+	// The (optional) CKAN organization new datasets are published in
+	Organization string
+	// An (optional) CKAN API token.  It's needed for publishing, and keeps the existing one when not specified
+	Token string
+}
+
+// CkanSet connects one of your databases to a CKAN dataset, replacing any existing connection (POST /v1/ckanset)
+// The response is decoded into out, unless it's nil
+func (c *Client) CkanSet(ctx context.Context, p CkanSetParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("mode", p.Mode)
+	f.string("ckanurl", p.CKANURL)
+	f.string("dataset", p.Dataset)
+	f.optionalString("organization", p.Organization)
+	f.optionalString("token", p.Token)
+	return c.call(ctx, "POST", "/v1/ckanset", false, f, out)
+}
+
+// CollectionParams holds the parameters for Collection
+type CollectionParams struct {
+	// The (optional) owner of the collection.  Defaults to yourself
+	Username string
+	// The name of the collection
+	Name string
+}
+
+// Collection returns the details of a collection, along with the databases in it in their curated order (POST /v1/collection)
+// The response is decoded into out, unless it's nil
+func (c *Client) Collection(ctx context.Context, p CollectionParams, out interface{}) error {
+	f := newForm()
+	f.optionalString("username", p.Username)
+	f.string("name", p.Name)
+	return c.call(ctx, "POST", "/v1/collection", false, f, out)
+}
+
+// CollectionAddParams holds the parameters for CollectionAdd
+type CollectionAddParams struct {
+	// The name of the collection
+	Name string
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// An (optional) note about the database, shown with it in the collection
+	Note string
+	// The (optional) number of the place in the collection to put the database, starting at 1.  Defaults to the end
+	Position *int
+}
+
+// CollectionAdd adds a public database to one of your collections (POST /v1/collectionadd)
+// The response is decoded into out, unless it's nil
+func (c *Client) CollectionAdd(ctx context.Context, p CollectionAddParams, out interface{}) error {
+	f := newForm()
+	f.string("name", p.Name)
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.optionalString("note", p.Note)
+	f.optionalInt("position", p.Position)
+	return c.call(ctx, "POST", "/v1/collectionadd", false, f, out)
+}
+
+// CollectionDeleteParams holds the parameters for CollectionDelete
+type CollectionDeleteParams struct {
+	// The name of the collection to delete
+	Name string
+}
+
+// CollectionDelete deletes one of your collections (POST /v1/collectiondelete)
+// The response is decoded into out, unless it's nil
+func (c *Client) CollectionDelete(ctx context.Context, p CollectionDeleteParams, out interface{}) error {
+	f := newForm()
+	f.string("name", p.Name)
+	return c.call(ctx, "POST", "/v1/collectiondelete", false, f, out)
+}
+
+// CollectionRemoveParams holds the parameters for CollectionRemove
+type CollectionRemoveParams struct {
+	// The name of the collection
+	Name string
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// CollectionRemove removes a database from one of your collections (POST /v1/collectionremove)
+// The response is decoded into out, unless it's nil
+func (c *Client) CollectionRemove(ctx context.Context, p CollectionRemoveParams, out interface{}) error {
+	f := newForm()
+	f.string("name", p.Name)
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/collectionremove", false, f, out)
+}
+
+// CollectionsParams holds the parameters for Collections
+type CollectionsParams struct {
+	// The (optional) name of the user.  Defaults to yourself
+	Username string
+	// An (optional) boolean.  Either "false" (the default) for the collections the user created, or "true" for the ones they starred
+	Starred *bool
+}
+
+// Collections returns the collections a user has created, or the ones they have starred (POST /v1/collections)
+// The response is decoded into out, unless it's nil
+func (c *Client) Collections(ctx context.Context, p CollectionsParams, out interface{}) error {
+	f := newForm()
+	f.optionalString("username", p.Username)
+	f.optionalBool("starred", p.Starred)
+	return c.call(ctx, "POST", "/v1/collections", false, f, out)
+}
+
+// CollectionSaveParams holds the parameters for CollectionSave
+type CollectionSaveParams struct {
+	// The name of the collection
+	Name string
+	// An (optional) description of the collection
+	Description string
+	// An (optional) boolean.  Either "true" (the default) for a public collection, or "false" for one only you can see
+	Public *bool
+}
+
+// CollectionSave creates one of your collections, or changes its details (POST /v1/collectionsave)
+// The response is decoded into out, unless it's nil
+func (c *Client) CollectionSave(ctx context.Context, p CollectionSaveParams, out interface{}) error {
+	f := newForm()
+	f.string("name", p.Name)
+	f.optionalString("description", p.Description)
+	f.optionalBool("public", p.Public)
+	return c.call(ctx, "POST", "/v1/collectionsave", false, f, out)
+}
+
+// CollectionStarParams holds the parameters for CollectionStar
+type CollectionStarParams struct {
+	// The (optional) owner of the collection.  Defaults to yourself
+	Username string
+	// The name of the collection
+	Name string
+	// A boolean.  Either "true" to star the collection, or "false" to remove your star
+	Starred bool
+}
+
+// CollectionStar stars or unstars a collection, which adds it to (or removes it from) the list of collections you follow (POST /v1/collectionstar)
+// The response is decoded into out, unless it's nil
+func (c *Client) CollectionStar(ctx context.Context, p CollectionStarParams, out interface{}) error {
+	f := newForm()
+	f.optionalString("username", p.Username)
+	f.string("name", p.Name)
+	f.bool("starred", p.Starred)
+	return c.call(ctx, "POST", "/v1/collectionstar", false, f, out)
+}
+
+// ColumnsParams holds the parameters for Columns
+type ColumnsParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The name of the table or view
+	Table string
+}
+
+// Columns returns the list of columns in a table or view (POST /v1/columns)
+// The response is decoded into out, unless it's nil
+func (c *Client) Columns(ctx context.Context, p ColumnsParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("table", p.Table)
+	return c.call(ctx, "POST", "/v1/columns", false, f, out)
+}
+
+// CommitsParams holds the parameters for Commits
+type CommitsParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// Commits returns the details of all commits for a database (POST /v1/commits)
+// The response is decoded into out, unless it's nil
+func (c *Client) Commits(ctx context.Context, p CommitsParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/commits", false, f, out)
+}
+
+// CommitSearchParams holds the parameters for CommitSearch
+type CommitSearchParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// Text to look for in the name or email address of the commit author.  Case insensitive
+	Author string
+	// Text to look for in the commit message.  Case insensitive
+	Message string
+	// The (optional) date of the earliest commits to return, in YYYY-MM-DD format
+	From string
+	// The (optional) date of the latest commits to return, in YYYY-MM-DD format.  Commits made on that day are included
+	To string
+	// The (optional) number of commits to skip.  Defaults to 0
+	Offset *int
+	// The (optional) maximum number of commits to return, up to 100.  Defaults to 25
+	Limit *int
+}
+
+// CommitSearch searches the commit history of a database by author, date range, and message text (POST /v1/commitsearch)
+// The response is decoded into out, unless it's nil
+func (c *Client) CommitSearch(ctx context.Context, p CommitSearchParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.optionalString("author", p.Author)
+	f.optionalString("message", p.Message)
+	f.optionalString("from", p.From)
+	f.optionalString("to", p.To)
+	f.optionalInt("offset", p.Offset)
+	f.optionalInt("limit", p.Limit)
+	return c.call(ctx, "POST", "/v1/commitsearch", false, f, out)
+}
+
+// CommitStatusParams holds the parameters for CommitStatus
+type CommitStatusParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The commit ID the status is for
+	Commit string
+	// The status of the commit, either "pending", "success", or "failure"
+	State string
+	// The (optional) name of the check the status is for.  Defaults to "default"
+	Context string
+	// An (optional) URL with the details of the check, such as a CI build page
+	TargetURL string
+	// An (optional) short description of the status
+	Description string
+}
+
+// CommitStatus sets the status of a commit for a context, replacing any earlier status for the same context. This is intended for CI systems, which can post "pending" when they start checking a commit and "success" or "failure" once they're done (POST /v1/commitstatus)
+// The response is decoded into out, unless it's nil
+func (c *Client) CommitStatus(ctx context.Context, p CommitStatusParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("commit", p.Commit)
+	f.string("state", p.State)
+	f.optionalString("context", p.Context)
+	f.optionalString("targeturl", p.TargetURL)
+	f.optionalString("description", p.Description)
+	return c.call(ctx, "POST", "/v1/commitstatus", false, f, out)
+}
+
+// CommitStatusesParams holds the parameters for CommitStatuses
+type CommitStatusesParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The commit ID to return the statuses of
+	Commit string
+}
+
+// CommitStatuses returns the statuses posted for a commit, one for each context (POST /v1/commitstatuses)
+// The response is decoded into out, unless it's nil
+func (c *Client) CommitStatuses(ctx context.Context, p CommitStatusesParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("commit", p.Commit)
+	return c.call(ctx, "POST", "/v1/commitstatuses", false, f, out)
+}
+
+// ContributionsParams holds the parameters for Contributions
+type ContributionsParams struct {
+	// The (optional) name of the user.  Defaults to yourself
+	Username string
+}
+
+// Contributions returns the contributions a user made each day over the last year, for drawing a contribution heatmap (POST /v1/contributions)
+// The response is decoded into out, unless it's nil
+func (c *Client) Contributions(ctx context.Context, p ContributionsParams, out interface{}) error {
+	f := newForm()
+	f.optionalString("username", p.Username)
+	return c.call(ctx, "POST", "/v1/contributions", false, f, out)
+}
+
+// DatabasesParams holds the parameters for Databases
+type DatabasesParams struct {
+	// An (optional) boolean, whether to show Live databases, or standard ones
+	Live *bool
+	// An (optional) boolean, whether to only show verified databases
+	Verified *bool
+	// The (optional) order of the list.  One of "modified" (the default), "created", "downloads", "pinned", "size", or "stars"
+	Sort string
+	// The (optional) short name of a licence, eg "CC0".  Only databases using it are shown
+	Licence string
+	// An (optional) boolean, whether to only show databases with releases
+	Releases *bool
+}
+
+// Databases returns the list of databases in the requesting users account. If the new (optional) "live" boolean text field is set to true, then it will return the list of live databases (POST /v1/databases)
+// The response is decoded into out, unless it's nil
+func (c *Client) Databases(ctx context.Context, p DatabasesParams, out interface{}) error {
+	f := newForm()
+	f.optionalBool("live", p.Live)
+	f.optionalBool("verified", p.Verified)
+	f.optionalString("sort", p.Sort)
+	f.optionalString("licence", p.Licence)
+	f.optionalBool("releases", p.Releases)
+	return c.call(ctx, "POST", "/v1/databases", false, f, out)
+}
+
+// DataCommentParams holds the parameters for DataComment
+type DataCommentParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The ID of the merge request
+	DiscID int
+	// The name of the table holding the row
+	Table string
+	// A JSON object with the value of each primary key column of the row.  Tables without a primary key use "rowid"
+	Key string
+	// The (optional) column of the cell the comment is about.  The comment is about the whole row when not specified
+	Column string
+	// The text of the comment
+	Body string
+}
+
+// DataComment starts a comment thread about a row, or a single cell, of the data diff of a merge request (POST /v1/datacomment)
+// The response is decoded into out, unless it's nil
+func (c *Client) DataComment(ctx context.Context, p DataCommentParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.int("discid", p.DiscID)
+	f.string("table", p.Table)
+	f.string("key", p.Key)
+	f.optionalString("column", p.Column)
+	f.string("body", p.Body)
+	return c.call(ctx, "POST", "/v1/datacomment", false, f, out)
+}
+
+// DataCommentReplyParams holds the parameters for DataCommentReply
+type DataCommentReplyParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The ID of the merge request
+	DiscID int
+	// The ID of the comment starting the thread
+	ComID int
+	// The text of the reply
+	Body string
+}
+
+// DataCommentReply replies to a comment thread on the data diff of a merge request (POST /v1/datacommentreply)
+// The response is decoded into out, unless it's nil
+func (c *Client) DataCommentReply(ctx context.Context, p DataCommentReplyParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.int("discid", p.DiscID)
+	f.int("comid", p.ComID)
+	f.string("body", p.Body)
+	return c.call(ctx, "POST", "/v1/datacommentreply", false, f, out)
+}
+
+// DataCommentResolveParams holds the parameters for DataCommentResolve
+type DataCommentResolveParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The ID of the merge request
+	DiscID int
+	// The ID of the comment starting the thread
+	ComID int
+	// An (optional) boolean.  When true, the thread is marked as unresolved again
+	Unresolve *bool
+}
+
+// DataCommentResolve marks a comment thread on the data diff of a merge request as resolved, or as unresolved again (POST /v1/datacommentresolve)
+// The response is decoded into out, unless it's nil
+func (c *Client) DataCommentResolve(ctx context.Context, p DataCommentResolveParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.int("discid", p.DiscID)
+	f.int("comid", p.ComID)
+	f.optionalBool("unresolve", p.Unresolve)
+	return c.call(ctx, "POST", "/v1/datacommentresolve", false, f, out)
+}
+
+// DataCommentsParams holds the parameters for DataComments
+type DataCommentsParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The ID of the merge request
+	DiscID int
+}
+
+// DataComments returns the comment threads on the data diff of a merge request, oldest first (POST /v1/datacomments)
+// The response is decoded into out, unless it's nil
+func (c *Client) DataComments(ctx context.Context, p DataCommentsParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.int("discid", p.DiscID)
+	return c.call(ctx, "POST", "/v1/datacomments", false, f, out)
+}
+
+// DataPackageParams holds the parameters for DataPackage
+type DataPackageParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The (optional) commit ID to describe.  Uses the head commit of the default branch if not specified
+	Commit string
+}
+
+// DataPackage returns a Frictionless Data Package descriptor (datapackage.json) for a database, describing its tables, their columns, and its licence (POST /v1/datapackage)
+// The response is decoded into out, unless it's nil
+func (c *Client) DataPackage(ctx context.Context, p DataPackageParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.optionalString("commit", p.Commit)
+	return c.call(ctx, "POST", "/v1/datapackage", false, f, out)
+}
+
+// DataPackageImportParams holds the parameters for DataPackageImport
+type DataPackageImportParams struct {
+	// The zip file holding the data package
+	File io.Reader
+	// The (optional) name for the new database.  Uses the name of the data package if not specified
+	DBName string
+	// The (optional) licence of the new database.  Uses the licence of the data package if not specified and it's one known to DBHub.io
+	Licence string
+	// An (optional) boolean for whether the new database is public.  Defaults to private
+	Public *bool
+}
+
+// DataPackageImport creates a new database from a Frictionless Data Package (POST /v1/datapackageimport)
+// The response is decoded into out, unless it's nil
+func (c *Client) DataPackageImport(ctx context.Context, p DataPackageImportParams, out interface{}) error {
+	f := newForm()
+	f.file("file", p.File)
+	f.optionalString("dbname", p.DBName)
+	f.optionalString("licence", p.Licence)
+	f.optionalBool("public", p.Public)
+	return c.call(ctx, "POST", "/v1/datapackageimport", false, f, out)
+}
+
+// DeleteParams holds the parameters for Delete
+type DeleteParams struct {
+	// The name of the database
+	DBName string
+}
+
+// Delete deletes a database from the requesting users account (POST /v1/delete)
+// The response is decoded into out, unless it's nil
+func (c *Client) Delete(ctx context.Context, p DeleteParams, out interface{}) error {
+	f := newForm()
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/delete", false, f, out)
+}
+
+// DiffParams holds the parameters for Diff
+type DiffParams struct {
+	// The owner of the first database being diffed
+	DBOwnerA string
+	// The name of the first database being diffed
+	DBNameA string
+	// The owner of the second database being diffed (optional, if not provided same as first owner)
+	DBOwnerB string
+	// The name of the second database being diffed (optional, if not provided same as first name)
+	DBNameB string
+	// The first commit for diffing
+	CommitA string
+	// The second commit for diffing
+	CommitB string
+	// Specifies the merge strategy (possible values: "none", "preserve_pk", "new_pk"; optional, defaults to "none")
+	Merge string
+	// Can be set to "1" to include the full data of all changed rows instead of just the primary keys (optional, defaults to 0)
+	IncludeData string
+}
+
+// Diff generates a diff between two databases or two versions of a database (POST /v1/diff)
+// The response is decoded into out, unless it's nil
+func (c *Client) Diff(ctx context.Context, p DiffParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner_a", p.DBOwnerA)
+	f.string("dbname_a", p.DBNameA)
+	f.optionalString("dbowner_b", p.DBOwnerB)
+	f.optionalString("dbname_b", p.DBNameB)
+	f.string("commit_a", p.CommitA)
+	f.string("commit_b", p.CommitB)
+	f.optionalString("merge", p.Merge)
+	f.optionalString("include_data", p.IncludeData)
+	return c.call(ctx, "POST", "/v1/diff", false, f, out)
+}
+
+// DiscussionAssignParams holds the parameters for DiscussionAssign
+type DiscussionAssignParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The ID of the discussion or merge request
+	DiscID int
+	// The (optional) name of the user to assign it to.  Leave it empty to remove the assignment
+	Assignee string
+}
+
+// DiscussionAssign assigns a discussion or merge request to a user, or removes the assignment (POST /v1/discussionassign)
+// The response is decoded into out, unless it's nil
+func (c *Client) DiscussionAssign(ctx context.Context, p DiscussionAssignParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.int("discid", p.DiscID)
+	f.optionalString("assignee", p.Assignee)
+	return c.call(ctx, "POST", "/v1/discussionassign", false, f, out)
+}
+
+// DiscussionLabelsParams holds the parameters for DiscussionLabels
+type DiscussionLabelsParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The ID of the discussion or merge request
+	DiscID int
+	// A comma separated list of label names.  Leave it empty to remove all labels
+	Labels string
+}
+
+// DiscussionLabels replaces the labels applied to a discussion or merge request (POST /v1/discussionlabels)
+// The response is decoded into out, unless it's nil
+func (c *Client) DiscussionLabels(ctx context.Context, p DiscussionLabelsParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.int("discid", p.DiscID)
+	f.string("labels", p.Labels)
+	return c.call(ctx, "POST", "/v1/discussionlabels", false, f, out)
+}
+
+// DiscussionMilestoneParams holds the parameters for DiscussionMilestone
+type DiscussionMilestoneParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The ID of the discussion or merge request
+	DiscID int
+	// The (optional) title of the milestone.  Leave it empty to remove it from its milestone
+	Milestone string
+}
+
+// DiscussionMilestone adds a discussion or merge request to a milestone, or removes it from its milestone. Only users with write access to the database can do this (POST /v1/discussionmilestone)
+// The response is decoded into out, unless it's nil
+func (c *Client) DiscussionMilestone(ctx context.Context, p DiscussionMilestoneParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.int("discid", p.DiscID)
+	f.optionalString("milestone", p.Milestone)
+	return c.call(ctx, "POST", "/v1/discussionmilestone", false, f, out)
+}
+
+// DiscussionsParams holds the parameters for Discussions
+type DiscussionsParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The (optional) type of thread to return.  Either "discussion" (the default) or "mr"
+	Type string
+	// The (optional) name of a user, to only return the threads assigned to them.  "me" returns the threads assigned to you
+	Assigned string
+	// The (optional) name of a label, to only return the threads with that label
+	Label string
+	// The (optional) title of a milestone, to only return the threads in that milestone
+	Milestone string
+	// An (optional) boolean, to only return open or closed threads
+	Open *bool
+}
+
+// Discussions returns the list of discussions or merge requests for a database (POST /v1/discussions)
+// The response is decoded into out, unless it's nil
+func (c *Client) Discussions(ctx context.Context, p DiscussionsParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.optionalString("type", p.Type)
+	f.optionalString("assigned", p.Assigned)
+	f.optionalString("label", p.Label)
+	f.optionalString("milestone", p.Milestone)
+	f.optionalBool("open", p.Open)
+	return c.call(ctx, "POST", "/v1/discussions", false, f, out)
+}
+
+// DownloadParams holds the parameters for Download
+type DownloadParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// An (optional) JSON array of table names.  When given, a copy of the database holding only those tables (along with their indexes and triggers) is returned instead.  Only standard databases can be downloaded this way
+	Tables string
+}
+
+// Download returns the requested SQLite database file (POST /v1/download)
+// The response is written to w
+func (c *Client) Download(ctx context.Context, p DownloadParams, w io.Writer) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.optionalString("tables", p.Tables)
+	return c.call(ctx, "POST", "/v1/download", false, f, w)
+}
+
+// EventsParams holds the parameters for Events
+type EventsParams struct {
+	// The (optional) ID of the last event already received.  Only events after it are returned
+	Since *int
+	// The (optional) way of returning events.  Either "poll" (the default) or "stream" for Server-Sent Events
+	Mode string
+	// The (optional) number of seconds to wait for new events when polling, up to 8.  Defaults to 8
+	Timeout *int
+}
+
+// Events returns the status updates of the user, and the events for the databases they're watching (POST /v1/events)
+// The response is decoded into out, unless it's nil
+func (c *Client) Events(ctx context.Context, p EventsParams, out interface{}) error {
+	f := newForm()
+	f.optionalInt("since", p.Since)
+	f.optionalString("mode", p.Mode)
+	f.optionalInt("timeout", p.Timeout)
+	return c.call(ctx, "POST", "/v1/events", false, f, out)
+}
+
+// ExecuteParams holds the parameters for Execute
+type ExecuteParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The SQL query to execute, base64 encoded
+	SQL string
+	// An (optional) JSON array of values for the "?" parameters of the query, or a JSON object of values for its named parameters
+	Params string
+}
+
+// Execute executes a SQL query on a SQLite database (POST /v1/execute)
+// The response is decoded into out, unless it's nil
+func (c *Client) Execute(ctx context.Context, p ExecuteParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("sql", p.SQL)
+	f.optionalString("params", p.Params)
+	return c.call(ctx, "POST", "/v1/execute", false, f, out)
+}
+
+// ExplainParams holds the parameters for Explain
+type ExplainParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The (optional) commit ID of the database to use.  Uses the head commit of the default branch if not given
+	Commit *int
+	// The SQL statement to explain, base64 encoded
+	SQL string
+	// An (optional) boolean.  When true, the bytecode listing of the statement is returned as well
+	Bytecode *bool
+}
+
+// Explain returns the query plan of a SQL statement on a SQLite database, without running the statement (POST /v1/explain)
+// The response is decoded into out, unless it's nil
+func (c *Client) Explain(ctx context.Context, p ExplainParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.optionalInt("commit", p.Commit)
+	f.string("sql", p.SQL)
+	f.optionalBool("bytecode", p.Bytecode)
+	return c.call(ctx, "POST", "/v1/explain", false, f, out)
+}
+
+// FtsCreateParams holds the parameters for FtsCreate
+type FtsCreateParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The name of the table to index
+	Table string
+	// A JSON array of the columns to index
+	Columns string
+	// The (optional) name of the index.  Defaults to the table name followed by "_fts"
+	Name string
+	// The (optional) way text is split into words.  Either "unicode61" (the default), "ascii", "porter" (which also matches other forms of the same English word), or "trigram" (for matching parts of words)
+	Tokenizer string
+}
+
+// FtsCreate creates a full text search index of a table in a live database (POST /v1/ftscreate)
+// The response is decoded into out, unless it's nil
+func (c *Client) FtsCreate(ctx context.Context, p FtsCreateParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("table", p.Table)
+	f.string("columns", p.Columns)
+	f.optionalString("name", p.Name)
+	f.optionalString("tokenizer", p.Tokenizer)
+	return c.call(ctx, "POST", "/v1/ftscreate", false, f, out)
+}
+
+// FtsDropParams holds the parameters for FtsDrop
+type FtsDropParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The name of the index
+	Name string
+}
+
+// FtsDrop removes a full text search index from a live database, along with the triggers keeping it up to date. The indexed table isn't changed (POST /v1/ftsdrop)
+// The response is decoded into out, unless it's nil
+func (c *Client) FtsDrop(ctx context.Context, p FtsDropParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("name", p.Name)
+	return c.call(ctx, "POST", "/v1/ftsdrop", false, f, out)
+}
+
+// HealthReportParams holds the parameters for HealthReport
+type HealthReportParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The (optional) commit ID of the database to use.  Uses the head commit of the default branch if not given
+	Commit *int
+}
+
+// HealthReport returns the health report of a commit of a standard database (POST /v1/healthreport)
+// The response is decoded into out, unless it's nil
+func (c *Client) HealthReport(ctx context.Context, p HealthReportParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.optionalInt("commit", p.Commit)
+	return c.call(ctx, "POST", "/v1/healthreport", false, f, out)
+}
+
+// HeldContent returns the new discussions, comments, and database descriptions held for moderation by the spam filters, oldest first (POST /v1/heldcontent)
+// The response is decoded into out, unless it's nil
+func (c *Client) HeldContent(ctx context.Context, out interface{}) error {
+	f := newForm()
+	return c.call(ctx, "POST", "/v1/heldcontent", false, f, out)
+}
+
+// HeldContentActionParams holds the parameters for HeldContentAction
+type HeldContentActionParams struct {
+	// The ID of the held content
+	Held int
+	// One of:
+	Action string
+	// To publish the content, as it isn't spam
+	Publish string
+	// To throw the content away
+	Reject string
+	// To throw the content away, and ban its author
+	Ban string
+}
+
+// HeldContentAction publishes or rejects content held for moderation by the spam filters (POST /v1/heldcontentaction)
+// The response is decoded into out, unless it's nil
+func (c *Client) HeldContentAction(ctx context.Context, p HeldContentActionParams, out interface{}) error {
+	f := newForm()
+	f.int("held", p.Held)
+	f.string("action", p.Action)
+	f.string("publish", p.Publish)
+	f.string("reject", p.Reject)
+	f.string("ban", p.Ban)
+	return c.call(ctx, "POST", "/v1/heldcontentaction", false, f, out)
+}
+
+// IndexAdvisorParams holds the parameters for IndexAdvisor
+type IndexAdvisorParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The (optional) commit ID of the database to use.  Uses the head commit of the default branch if not given
+	Commit *int
+	// An (optional) boolean.  When true, the suggested indexes are created.  Only for live databases, and needs an API key with write permission
+	Apply *bool
+}
+
+// IndexAdvisor suggests indexes for a SQLite database, based on the queries recently run on it (POST /v1/indexadvisor)
+// The response is decoded into out, unless it's nil
+func (c *Client) IndexAdvisor(ctx context.Context, p IndexAdvisorParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.optionalInt("commit", p.Commit)
+	f.optionalBool("apply", p.Apply)
+	return c.call(ctx, "POST", "/v1/indexadvisor", false, f, out)
+}
+
+// IndexesParams holds the parameters for Indexes
+type IndexesParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// Indexes returns the details of all indexes in a SQLite database (POST /v1/indexes)
+// The response is decoded into out, unless it's nil
+func (c *Client) Indexes(ctx context.Context, p IndexesParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/indexes", false, f, out)
+}
+
+// InvitationCreateParams holds the parameters for InvitationCreate
+type InvitationCreateParams struct {
+	// The (optional) email address of the person being invited.  When given, the invitation code is emailed to them, and only they can use it
+	Email string
+	// The (optional) number of days the invitation can be used for.  Defaults to the configured expiry
+	Expires *int
+}
+
+// InvitationCreate issues an invitation to sign up, for when signups are closed (POST /v1/invitationcreate)
+// The response is decoded into out, unless it's nil
+func (c *Client) InvitationCreate(ctx context.Context, p InvitationCreateParams, out interface{}) error {
+	f := newForm()
+	f.optionalString("email", p.Email)
+	f.optionalInt("expires", p.Expires)
+	return c.call(ctx, "POST", "/v1/invitationcreate", false, f, out)
+}
+
+// InvitationRevokeParams holds the parameters for InvitationRevoke
+type InvitationRevokeParams struct {
+	// The ID of the invitation
+	Invite int
+}
+
+// InvitationRevoke revokes an invitation which hasn't been used yet (POST /v1/invitationrevoke)
+// The response is decoded into out, unless it's nil
+func (c *Client) InvitationRevoke(ctx context.Context, p InvitationRevokeParams, out interface{}) error {
+	f := newForm()
+	f.int("invite", p.Invite)
+	return c.call(ctx, "POST", "/v1/invitationrevoke", false, f, out)
+}
+
+// Invitations returns the invitations issued so far, newest first, along with who used them (POST /v1/invitations)
+// The response is decoded into out, unless it's nil
+func (c *Client) Invitations(ctx context.Context, out interface{}) error {
+	f := newForm()
+	return c.call(ctx, "POST", "/v1/invitations", false, f, out)
+}
+
+// JobQueue returns the number of jobs waiting and in progress in the live job queue, and how long jobs have waited to be picked up over the last hour, for each live node and priority class (POST /v1/jobqueue)
+// The response is decoded into out, unless it's nil
+func (c *Client) JobQueue(ctx context.Context, out interface{}) error {
+	f := newForm()
+	return c.call(ctx, "POST", "/v1/jobqueue", false, f, out)
+}
+
+// LabelDeleteParams holds the parameters for LabelDelete
+type LabelDeleteParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The name of the label to delete
+	Name string
+}
+
+// LabelDelete deletes a label of a database (POST /v1/labeldelete)
+// The response is decoded into out, unless it's nil
+func (c *Client) LabelDelete(ctx context.Context, p LabelDeleteParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("name", p.Name)
+	return c.call(ctx, "POST", "/v1/labeldelete", false, f, out)
+}
+
+// LabelsParams holds the parameters for Labels
+type LabelsParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// Labels returns the labels which can be applied to the discussions and merge requests of a database (POST /v1/labels)
+// The response is decoded into out, unless it's nil
+func (c *Client) Labels(ctx context.Context, p LabelsParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/labels", false, f, out)
+}
+
+// LabelSaveParams holds the parameters for LabelSave
+type LabelSaveParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The name of the label
+	Name string
+	// The colour of the label, as a hex value
+	Colour string
+	// An (optional) description of the label
+	Description string
+}
+
+// LabelSave creates or updates a label of a database (POST /v1/labelsave)
+// The response is decoded into out, unless it's nil
+func (c *Client) LabelSave(ctx context.Context, p LabelSaveParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("name", p.Name)
+	f.string("colour", p.Colour)
+	f.optionalString("description", p.Description)
+	return c.call(ctx, "POST", "/v1/labelsave", false, f, out)
+}
+
+// LicenceParams holds the parameters for Licence
+type LicenceParams struct {
+	// The short name of the licence
+	Licence string
+}
+
+// Licence returns the text of a licence, in its original text or html format (POST /v1/licence)
+// The response is written to w
+func (c *Client) Licence(ctx context.Context, p LicenceParams, w io.Writer) error {
+	f := newForm()
+	f.string("licence", p.Licence)
+	return c.call(ctx, "POST", "/v1/licence", false, f, w)
+}
+
+// LicenceAddParams holds the parameters for LicenceAdd
+type LicenceAddParams struct {
+	// The short name of the licence, used when choosing it for a database
+	Licence string
+	// The text of the licence
+	File io.Reader
+	// The (optional) full name of the licence
+	Fullname string
+	// The (optional) format of the licence text.  Either "text" (the default) or "html"
+	Format string
+	// The (optional) URL to the reference source of the licence
+	SourceURL string
+	// The (optional) number of the licence in the display order.  Defaults to after the existing licences
+	Order *int
+}
+
+// LicenceAdd adds a custom licence, which can then be used by your databases (POST /v1/licenceadd)
+// The response is decoded into out, unless it's nil
+func (c *Client) LicenceAdd(ctx context.Context, p LicenceAddParams, out interface{}) error {
+	f := newForm()
+	f.string("licence", p.Licence)
+	f.file("file", p.File)
+	f.optionalString("fullname", p.Fullname)
+	f.optionalString("format", p.Format)
+	f.optionalString("sourceurl", p.SourceURL)
+	f.optionalInt("order", p.Order)
+	return c.call(ctx, "POST", "/v1/licenceadd", false, f, out)
+}
+
+// LicenceDeleteParams holds the parameters for LicenceDelete
+type LicenceDeleteParams struct {
+	// The short name of the licence to remove
+	Licence string
+}
+
+// LicenceDelete removes one of your custom licences (POST /v1/licencedelete)
+// The response is decoded into out, unless it's nil
+func (c *Client) LicenceDelete(ctx context.Context, p LicenceDeleteParams, out interface{}) error {
+	f := newForm()
+	f.string("licence", p.Licence)
+	return c.call(ctx, "POST", "/v1/licencedelete", false, f, out)
+}
+
+// LicenceHistoryParams holds the parameters for LicenceHistory
+type LicenceHistoryParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The (optional) database branch.  Uses the default database branch if not specified
+	Branch string
+}
+
+// LicenceHistory returns the commits which changed the licence of a database branch, newest first (POST /v1/licencehistory)
+// The response is decoded into out, unless it's nil
+func (c *Client) LicenceHistory(ctx context.Context, p LicenceHistoryParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.optionalString("branch", p.Branch)
+	return c.call(ctx, "POST", "/v1/licencehistory", false, f, out)
+}
+
+// Licences returns the licences you can use for your databases (POST /v1/licences)
+// The response is decoded into out, unless it's nil
+func (c *Client) Licences(ctx context.Context, out interface{}) error {
+	f := newForm()
+	return c.call(ctx, "POST", "/v1/licences", false, f, out)
+}
+
+// LicenceSetParams holds the parameters for LicenceSet
+type LicenceSetParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The short name of the new licence
+	Licence string
+	// The (optional) database branch.  Uses the default database branch if not specified
+	Branch string
+}
+
+// LicenceSet changes the licence of a database branch, by adding a commit to it (POST /v1/licenceset)
+// The response is decoded into out, unless it's nil
+func (c *Client) LicenceSet(ctx context.Context, p LicenceSetParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("licence", p.Licence)
+	f.optionalString("branch", p.Branch)
+	return c.call(ctx, "POST", "/v1/licenceset", false, f, out)
+}
+
+// LineageParams holds the parameters for Lineage
+type LineageParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// Lineage returns the lineage graph of a database (POST /v1/lineage)
+// The response is decoded into out, unless it's nil
+func (c *Client) Lineage(ctx context.Context, p LineageParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/lineage", false, f, out)
+}
+
+// LineageAddParams holds the parameters for LineageAdd
+type LineageAddParams struct {
+	// The owner of the derived database
+	DBOwner string
+	// The name of the derived database
+	DBName string
+	// The owner of the database it was derived from
+	Sourceowner string
+	// The name of the database it was derived from
+	Sourcename string
+	// The commit it was derived from
+	Sourcecommit string
+	// An (optional) description of how the data was derived
+	Description string
+}
+
+// LineageAdd declares that one of your databases was derived from a commit of another database (POST /v1/lineageadd)
+// The response is decoded into out, unless it's nil
+func (c *Client) LineageAdd(ctx context.Context, p LineageAddParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("sourceowner", p.Sourceowner)
+	f.string("sourcename", p.Sourcename)
+	f.string("sourcecommit", p.Sourcecommit)
+	f.optionalString("description", p.Description)
+	return c.call(ctx, "POST", "/v1/lineageadd", false, f, out)
+}
+
+// LineageRemoveParams holds the parameters for LineageRemove
+type LineageRemoveParams struct {
+	// The owner of the derived database
+	DBOwner string
+	// The name of the derived database
+	DBName string
+	// The owner of the database it was derived from
+	Sourceowner string
+	// The name of the database it was derived from
+	Sourcename string
+	// The commit it was derived from
+	Sourcecommit string
+}
+
+// LineageRemove removes a declaration that one of your databases was derived from a commit of another database (POST /v1/lineageremove)
+// The response is decoded into out, unless it's nil
+func (c *Client) LineageRemove(ctx context.Context, p LineageRemoveParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("sourceowner", p.Sourceowner)
+	f.string("sourcename", p.Sourcename)
+	f.string("sourcecommit", p.Sourcecommit)
+	return c.call(ctx, "POST", "/v1/lineageremove", false, f, out)
+}
+
+// LiveNodes returns the statistics last reported by each live node, including the state and recent use of the databases it holds (POST /v1/livenodes)
+// The response is decoded into out, unless it's nil
+func (c *Client) LiveNodes(ctx context.Context, out interface{}) error {
+	f := newForm()
+	return c.call(ctx, "POST", "/v1/livenodes", false, f, out)
+}
+
+// LiveNodeStateParams holds the parameters for LiveNodeState
+type LiveNodeStateParams struct {
+	// The name of the live node
+	Node string
+	// The new state of the node.  Either "active", "draining", or "decommissioned"
+	State string
+}
+
+// LiveNodeState changes the state of a live node (POST /v1/livenodestate)
+// The response is decoded into out, unless it's nil
+func (c *Client) LiveNodeState(ctx context.Context, p LiveNodeStateParams, out interface{}) error {
+	f := newForm()
+	f.string("node", p.Node)
+	f.string("state", p.State)
+	return c.call(ctx, "POST", "/v1/livenodestate", false, f, out)
+}
+
+// LivePlacementsParams holds the parameters for LivePlacements
+type LivePlacementsParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// LivePlacements returns the placement history of a live database, showing the live nodes it has been on (POST /v1/liveplacements)
+// The response is decoded into out, unless it's nil
+func (c *Client) LivePlacements(ctx context.Context, p LivePlacementsParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/liveplacements", false, f, out)
+}
+
+// Maintenance returns whether the server is in read only mode (POST /v1/maintenance)
+// The response is decoded into out, unless it's nil
+func (c *Client) Maintenance(ctx context.Context, out interface{}) error {
+	f := newForm()
+	return c.call(ctx, "POST", "/v1/maintenance", false, f, out)
+}
+
+// MaintenanceSetParams holds the parameters for MaintenanceSet
+type MaintenanceSetParams struct {
+	// Either "true" or "false"
+	Readonly string
+	// The (optional) message shown to people while in read only mode
+	Message string
+}
+
+// MaintenanceSet switches read only mode on or off for all of the daemons (POST /v1/maintenanceset)
+// The response is decoded into out, unless it's nil
+func (c *Client) MaintenanceSet(ctx context.Context, p MaintenanceSetParams, out interface{}) error {
+	f := newForm()
+	f.string("readonly", p.Readonly)
+	f.optionalString("message", p.Message)
+	return c.call(ctx, "POST", "/v1/maintenanceset", false, f, out)
+}
+
+// MergeRequestReviewParams holds the parameters for MergeRequestReview
+type MergeRequestReviewParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The ID of the merge request
+	DiscID int
+	// The outcome of the review, either "approved" or "changes_requested"
+	State string
+	// An (optional) comment on the merge request, explaining the review
+	Body string
+}
+
+// MergeRequestReview approves the head commit of a merge request, or requests changes to it (POST /v1/mergerequestreview)
+// The response is decoded into out, unless it's nil
+func (c *Client) MergeRequestReview(ctx context.Context, p MergeRequestReviewParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.int("discid", p.DiscID)
+	f.string("state", p.State)
+	f.optionalString("body", p.Body)
+	return c.call(ctx, "POST", "/v1/mergerequestreview", false, f, out)
+}
+
+// MergeRequestReviewsParams holds the parameters for MergeRequestReviews
+type MergeRequestReviewsParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The ID of the merge request
+	DiscID int
+}
+
+// MergeRequestReviews returns the reviews of a merge request (POST /v1/mergerequestreviews)
+// The response is decoded into out, unless it's nil
+func (c *Client) MergeRequestReviews(ctx context.Context, p MergeRequestReviewsParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.int("discid", p.DiscID)
+	return c.call(ctx, "POST", "/v1/mergerequestreviews", false, f, out)
+}
+
+// MetadataParams holds the parameters for Metadata
+type MetadataParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// Metadata returns the commit, branch, release, tag and web page information for a database (POST /v1/metadata)
+// The response is decoded into out, unless it's nil
+func (c *Client) Metadata(ctx context.Context, p MetadataParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/metadata", false, f, out)
+}
+
+// MigrationParams holds the parameters for Migration
+type MigrationParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The commit ID the copy of the database is at
+	FromCommit string
+	// The (optional) commit ID to upgrade the copy to.  Uses the head commit of the default branch if not specified
+	Commit string
+	// An (optional) boolean for leaving the data out of the script.  Defaults to false
+	SchemaOnly *bool
+}
+
+// Migration returns an SQL script which upgrades a copy of a database from one commit to another, by altering the changed tables and updating their data (POST /v1/migration)
+// The response is written to w
+func (c *Client) Migration(ctx context.Context, p MigrationParams, w io.Writer) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("fromcommit", p.FromCommit)
+	f.optionalString("commit", p.Commit)
+	f.optionalBool("schemaonly", p.SchemaOnly)
+	return c.call(ctx, "POST", "/v1/migration", false, f, w)
+}
+
+// MilestoneDeleteParams holds the parameters for MilestoneDelete
+type MilestoneDeleteParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The title of the milestone to delete
+	Title string
+}
+
+// MilestoneDelete deletes a milestone of a database (POST /v1/milestonedelete)
+// The response is decoded into out, unless it's nil
+func (c *Client) MilestoneDelete(ctx context.Context, p MilestoneDeleteParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("title", p.Title)
+	return c.call(ctx, "POST", "/v1/milestonedelete", false, f, out)
+}
+
+// MilestonesParams holds the parameters for Milestones
+type MilestonesParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// Milestones returns the milestones of a database, along with the number of open and closed discussions and merge requests in each of them (POST /v1/milestones)
+// The response is decoded into out, unless it's nil
+func (c *Client) Milestones(ctx context.Context, p MilestonesParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/milestones", false, f, out)
+}
+
+// MilestoneSaveParams holds the parameters for MilestoneSave
+type MilestoneSaveParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The title of the milestone
+	Title string
+	// An (optional) description of the milestone
+	Description string
+	// The (optional) due date of the milestone, in YYYY-MM-DD format
+	Due string
+	// An (optional) boolean.  Either "true" (the default) for an open milestone, or "false" to close it
+	Open *bool
+}
+
+// MilestoneSave creates or updates a milestone of a database (POST /v1/milestonesave)
+// The response is decoded into out, unless it's nil
+func (c *Client) MilestoneSave(ctx context.Context, p MilestoneSaveParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("title", p.Title)
+	f.optionalString("description", p.Description)
+	f.optionalString("due", p.Due)
+	f.optionalBool("open", p.Open)
+	return c.call(ctx, "POST", "/v1/milestonesave", false, f, out)
+}
+
+// ModerationActionParams holds the parameters for ModerationAction
+type ModerationActionParams struct {
+	// The ID of the abuse report
+	Report int
+	// One of:
+	Action string
+	// To close the report without doing anything
+	Dismiss string
+	// To hide the comment, or make the database private
+	Hide string
+	// To delete the comment or database
+	Delete string
+	// To ban the author of the comment, or the owner of the database
+	Ban string
+}
+
+// ModerationAction closes an abuse report, taking action on the reported database or comment (POST /v1/moderationaction)
+// The response is decoded into out, unless it's nil
+func (c *Client) ModerationAction(ctx context.Context, p ModerationActionParams, out interface{}) error {
+	f := newForm()
+	f.int("report", p.Report)
+	f.string("action", p.Action)
+	f.string("dismiss", p.Dismiss)
+	f.string("hide", p.Hide)
+	f.string("delete", p.Delete)
+	f.string("ban", p.Ban)
+	return c.call(ctx, "POST", "/v1/moderationaction", false, f, out)
+}
+
+// ModerationQueueParams holds the parameters for ModerationQueue
+type ModerationQueueParams struct {
+	// The (optional) status of the reports to return.  Either "open" (the default), "resolved", "dismissed", or "all" for the most recent reports of any status
+	Status string
+}
+
+// ModerationQueue returns the abuse reports waiting to be reviewed, oldest first (POST /v1/moderationqueue)
+// The response is decoded into out, unless it's nil
+func (c *Client) ModerationQueue(ctx context.Context, p ModerationQueueParams, out interface{}) error {
+	f := newForm()
+	f.optionalString("status", p.Status)
+	return c.call(ctx, "POST", "/v1/moderationqueue", false, f, out)
+}
+
+// NotificationPrefs returns the notification settings of the user (POST /v1/notificationprefs)
+// The response is decoded into out, unless it's nil
+func (c *Client) NotificationPrefs(ctx context.Context, out interface{}) error {
+	f := newForm()
+	return c.call(ctx, "POST", "/v1/notificationprefs", false, f, out)
+}
+
+// NotificationPrefsSaveParams holds the parameters for NotificationPrefsSave
+type NotificationPrefsSaveParams struct {
+	// An (optional) boolean turning all notification emails on or off
+	Email *bool
+	// Booleans turning emails for each type of event on or off
+	Comments *bool
+	// Booleans turning emails for each type of event on or off
+	Discussions *bool
+	// Booleans turning emails for each type of event on or off
+	MergeRequests *bool
+	// Booleans turning emails for each type of event on or off
+	Releases *bool
+	// The (optional) digest mode.  Either "none" for an email per event, "daily", or "weekly"
+	Digest string
+	// The (optional) owner and name of a watched database, whose setting is changed
+	DBOwner string
+	// The (optional) owner and name of a watched database, whose setting is changed
+	DBName string
+	// Used along with "dbowner" and "dbname".  Either "true", "false", or "default" to remove the setting for the database
+	DBEmail string
+	// Used along with "dbowner" and "dbname".  The activity on the database to be notified about.  Either "all", "releases" for new releases only, or "participating" for only the discussions and merge requests you've created or commented on
+	DBWatch string
+}
+
+// NotificationPrefsSave changes the notification settings of the user (POST /v1/notificationprefssave)
+// The response is decoded into out, unless it's nil
+func (c *Client) NotificationPrefsSave(ctx context.Context, p NotificationPrefsSaveParams, out interface{}) error {
+	f := newForm()
+	f.optionalBool("email", p.Email)
+	f.optionalBool("comments", p.Comments)
+	f.optionalBool("discussions", p.Discussions)
+	f.optionalBool("merge_requests", p.MergeRequests)
+	f.optionalBool("releases", p.Releases)
+	f.optionalString("digest", p.Digest)
+	f.optionalString("dbowner", p.DBOwner)
+	f.optionalString("dbname", p.DBName)
+	f.optionalString("dbemail", p.DBEmail)
+	f.optionalString("dbwatch", p.DBWatch)
+	return c.call(ctx, "POST", "/v1/notificationprefssave", false, f, out)
+}
+
+// OptimizeParams holds the parameters for Optimize
+type OptimizeParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// An (optional) boolean, for whether to run VACUUM.  Defaults to true
+	Vacuum *bool
+	// An (optional) boolean, for whether to run ANALYZE.  Defaults to true
+	Analyze *bool
+	// The (optional) database branch, for standard databases.  Uses the default database branch if not specified
+	Branch string
+	// The (optional) commit message for the new commit, for standard databases
+	CommitMsg string
+}
+
+// Optimize runs VACUUM and/or ANALYZE on a database (POST /v1/optimize)
+// The response is decoded into out, unless it's nil
+func (c *Client) Optimize(ctx context.Context, p OptimizeParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.optionalBool("vacuum", p.Vacuum)
+	f.optionalBool("analyze", p.Analyze)
+	f.optionalString("branch", p.Branch)
+	f.optionalString("commitmsg", p.CommitMsg)
+	return c.call(ctx, "POST", "/v1/optimize", false, f, out)
+}
+
+// OptimizeStatusParams holds the parameters for OptimizeStatus
+type OptimizeStatusParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// OptimizeStatus returns the state and progress of the most recent optimisation of a database (POST /v1/optimizestatus)
+// The response is decoded into out, unless it's nil
+func (c *Client) OptimizeStatus(ctx context.Context, p OptimizeStatusParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/optimizestatus", false, f, out)
+}
+
+// ProfileParams holds the parameters for Profile
+type ProfileParams struct {
+	// The (optional) name of the user.  Defaults to yourself
+	Username string
+}
+
+// Profile returns the public profile of a user, including their bio, links, and public databases with the pinned ones first (POST /v1/profile)
+// The response is decoded into out, unless it's nil
+func (c *Client) Profile(ctx context.Context, p ProfileParams, out interface{}) error {
+	f := newForm()
+	f.optionalString("username", p.Username)
+	return c.call(ctx, "POST", "/v1/profile", false, f, out)
+}
+
+// ProfilePinParams holds the parameters for ProfilePin
+type ProfilePinParams struct {
+	// The name of the database
+	DBName string
+	// A boolean.  Either "true" to pin the database, or "false" to unpin it
+	Pinned bool
+	// The (optional) number of the place among your pinned databases to put it, starting at 1.  Defaults to the end
+	Position *int
+}
+
+// ProfilePin pins one of your standard databases to your public profile, or unpins it (POST /v1/profilepin)
+// The response is decoded into out, unless it's nil
+func (c *Client) ProfilePin(ctx context.Context, p ProfilePinParams, out interface{}) error {
+	f := newForm()
+	f.string("dbname", p.DBName)
+	f.bool("pinned", p.Pinned)
+	f.optionalInt("position", p.Position)
+	return c.call(ctx, "POST", "/v1/profilepin", false, f, out)
+}
+
+// ProfileSaveParams holds the parameters for ProfileSave
+type ProfileSaveParams struct {
+	// Your (optional) new display name
+	Displayname string
+	// Your (optional) new bio.  Up to 500 characters of plain text
+	Bio string
+	// An (optional) space separated list of up to 5 web links.  Leave it empty to remove all links
+	Links string
+}
+
+// ProfileSave changes the details shown on your public profile (POST /v1/profilesave)
+// The response is decoded into out, unless it's nil
+func (c *Client) ProfileSave(ctx context.Context, p ProfileSaveParams, out interface{}) error {
+	f := newForm()
+	f.optionalString("displayname", p.Displayname)
+	f.optionalString("bio", p.Bio)
+	f.optionalString("links", p.Links)
+	return c.call(ctx, "POST", "/v1/profilesave", false, f, out)
+}
+
+// QueryParams holds the parameters for Query
+type QueryParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The SQL query to run, base64 encoded
+	SQL string
+	// The (optional) layout of the returned data.  Either "rows" (the default) or "columnar"
+	Format string
+	// An (optional) JSON array of values for the "?" parameters of the query, or a JSON object of values for its named parameters.  Only live databases accept parameter values
+	Params string
+	// An (optional) boolean string ("true", "false"), for whether BLOB values holding images or SpatiaLite geometries should have previews added.  Images get a thumbnail, and geometries are converted to GeoJSON.  Only used with the "rows" format.  Defaults to false
+	Previews *bool
+}
+
+// Query executes a SQL query on a SQLite database, returning the results to the caller (POST /v1/query)
+// The response is decoded into out, unless it's nil
+func (c *Client) Query(ctx context.Context, p QueryParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("sql", p.SQL)
+	f.optionalString("format", p.Format)
+	f.optionalString("params", p.Params)
+	f.optionalBool("previews", p.Previews)
+	return c.call(ctx, "POST", "/v1/query", false, f, out)
+}
+
+// ReactParams holds the parameters for React
+type ReactParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The ID of the discussion or merge request
+	DiscID int
+	// The ID of the comment
+	ComID int
+	// One of "+1", "-1", "laugh", "hooray", "confused", "heart", "rocket", or "eyes"
+	Reaction string
+	// An (optional) boolean.  Either "true" (the default) to add the reaction, or "false" to remove it
+	Add *bool
+}
+
+// React adds or removes one of your reactions on a discussion or merge request comment (POST /v1/react)
+// The response is decoded into out, unless it's nil
+func (c *Client) React(ctx context.Context, p ReactParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.int("discid", p.DiscID)
+	f.int("comid", p.ComID)
+	f.string("reaction", p.Reaction)
+	f.optionalBool("add", p.Add)
+	return c.call(ctx, "POST", "/v1/react", false, f, out)
+}
+
+// ReactionsParams holds the parameters for Reactions
+type ReactionsParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The ID of the discussion or merge request
+	DiscID int
+}
+
+// Reactions returns the reactions given to the comments of a discussion or merge request, along with a summary of them across the whole discussion (POST /v1/reactions)
+// The response is decoded into out, unless it's nil
+func (c *Client) Reactions(ctx context.Context, p ReactionsParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.int("discid", p.DiscID)
+	return c.call(ctx, "POST", "/v1/reactions", false, f, out)
+}
+
+// ReleaseDOIParams holds the parameters for ReleaseDOI
+type ReleaseDOIParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The name of the release
+	Release string
+}
+
+// ReleaseDOI mints a DOI for a release of a public database, so it can be cited (POST /v1/releasedoi)
+// The response is decoded into out, unless it's nil
+func (c *Client) ReleaseDOI(ctx context.Context, p ReleaseDOIParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("release", p.Release)
+	return c.call(ctx, "POST", "/v1/releasedoi", false, f, out)
+}
+
+// ReleasesParams holds the parameters for Releases
+type ReleasesParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// Releases returns the details of all releases for a database (POST /v1/releases)
+// The response is decoded into out, unless it's nil
+func (c *Client) Releases(ctx context.Context, p ReleasesParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/releases", false, f, out)
+}
+
+// ReplicationParams holds the parameters for Replication
+type ReplicationParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// Replication returns the external server one of your live databases is replicated to, the tables replicated, and the outcome of the last replication (POST /v1/replication)
+// The response is decoded into out, unless it's nil
+func (c *Client) Replication(ctx context.Context, p ReplicationParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/replication", false, f, out)
+}
+
+// ReplicationRemoveParams holds the parameters for ReplicationRemove
+type ReplicationRemoveParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// ReplicationRemove stops replicating one of your live databases (POST /v1/replicationremove)
+// The response is decoded into out, unless it's nil
+func (c *Client) ReplicationRemove(ctx context.Context, p ReplicationRemoveParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/replicationremove", false, f, out)
+}
+
+// ReplicationSetParams holds the parameters for ReplicationSet
+type ReplicationSetParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The type of server to replicate to, either "postgresql" or "mysql"
+	Type string
+	// The (optional) connection string for the server.  Keeps the existing one when not specified
+	DSN string
+	// A JSON array of the tables to replicate.  Each entry has the "table" name, and optionally its "target" table name, a "columns" object renaming columns, and an "exclude" array of columns not to replicate
+	Tables string
+	// The (optional) number of minutes between replications.  Defaults to 60
+	Interval *int
+	// An (optional) boolean for whether to also replicate after each change to the database
+	OnWrite *bool
+}
+
+// ReplicationSet replicates tables of one of your live databases to an external PostgreSQL or MySQL server, replacing any existing replication settings (POST /v1/replicationset)
+// The response is decoded into out, unless it's nil
+func (c *Client) ReplicationSet(ctx context.Context, p ReplicationSetParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("type", p.Type)
+	f.optionalString("dsn", p.DSN)
+	f.optionalString("tables", p.Tables)
+	f.optionalInt("interval", p.Interval)
+	f.optionalBool("onwrite", p.OnWrite)
+	return c.call(ctx, "POST", "/v1/replicationset", false, f, out)
+}
+
+// ReportDeleteParams holds the parameters for ReportDelete
+type ReportDeleteParams struct {
+	// The name of the scheduled report
+	Name string
+}
+
+// ReportDelete removes a scheduled report, along with its run history (POST /v1/reportdelete)
+// The response is decoded into out, unless it's nil
+func (c *Client) ReportDelete(ctx context.Context, p ReportDeleteParams, out interface{}) error {
+	f := newForm()
+	f.string("name", p.Name)
+	return c.call(ctx, "POST", "/v1/reportdelete", false, f, out)
+}
+
+// ReportOutputParams holds the parameters for ReportOutput
+type ReportOutputParams struct {
+	// The name of the scheduled report
+	Name string
+	// The ID of the run, as returned by the "reportruns" call
+	Run int
+}
+
+// ReportOutput returns the rendered output of a run of a scheduled report (POST /v1/reportoutput)
+// The response is decoded into out, unless it's nil
+func (c *Client) ReportOutput(ctx context.Context, p ReportOutputParams, out interface{}) error {
+	f := newForm()
+	f.string("name", p.Name)
+	f.int("run", p.Run)
+	return c.call(ctx, "POST", "/v1/reportoutput", false, f, out)
+}
+
+// ReportRunParams holds the parameters for ReportRun
+type ReportRunParams struct {
+	// The name of the scheduled report
+	Name string
+}
+
+// ReportRun queues a scheduled report to be run and delivered straight away, outside of its schedule (POST /v1/reportrun)
+// The response is decoded into out, unless it's nil
+func (c *Client) ReportRun(ctx context.Context, p ReportRunParams, out interface{}) error {
+	f := newForm()
+	f.string("name", p.Name)
+	return c.call(ctx, "POST", "/v1/reportrun", false, f, out)
+}
+
+// ReportRunsParams holds the parameters for ReportRuns
+type ReportRunsParams struct {
+	// The name of the scheduled report
+	Name string
+}
+
+// ReportRuns returns the run history of a scheduled report, most recent first (POST /v1/reportruns)
+// The response is decoded into out, unless it's nil
+func (c *Client) ReportRuns(ctx context.Context, p ReportRunsParams, out interface{}) error {
+	f := newForm()
+	f.string("name", p.Name)
+	return c.call(ctx, "POST", "/v1/reportruns", false, f, out)
+}
+
+// Reports returns the scheduled reports of the user (POST /v1/reports)
+// The response is decoded into out, unless it's nil
+func (c *Client) Reports(ctx context.Context, out interface{}) error {
+	f := newForm()
+	return c.call(ctx, "POST", "/v1/reports", false, f, out)
+}
+
+// ReportSaveParams holds the parameters for ReportSave
+type ReportSaveParams struct {
+	// The name of the scheduled report
+	Name string
+	// What the report runs.  Either "query" for a saved query, or "dashboard" for one of your dashboards
+	Source string
+	// The name of the saved query or dashboard
+	Sourcename string
+	// The owner and name of the database the saved query belongs to.  Only used for "query" reports
+	DBOwner string
+	// The owner and name of the database the saved query belongs to.  Only used for "query" reports
+	DBName string
+	// When the report runs, as a five field cron schedule in UTC (eg "0 9 * * 1"), or one of "@hourly", "@daily", "@weekly", "@monthly", or "@yearly".  Reports can't run more than once every 15 minutes
+	Schedule string
+	// The format the results are rendered in.  Either "csv", "html", or "pdf"
+	Format string
+	// How the report is delivered.  Either "email" to your email address, or "webhook"
+	Delivery string
+	// The address the report is POSTed to, when delivering to a webhook.  The requests are signed with the returned secret, in the "X-DBHub-Signature" header
+	Webhookurl string
+}
+
+// ReportSave adds a scheduled report, or changes an existing one (POST /v1/reportsave)
+// The response is decoded into out, unless it's nil
+func (c *Client) ReportSave(ctx context.Context, p ReportSaveParams, out interface{}) error {
+	f := newForm()
+	f.string("name", p.Name)
+	f.string("source", p.Source)
+	f.string("sourcename", p.Sourcename)
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("schedule", p.Schedule)
+	f.string("format", p.Format)
+	f.string("delivery", p.Delivery)
+	f.string("webhookurl", p.Webhookurl)
+	return c.call(ctx, "POST", "/v1/reportsave", false, f, out)
+}
+
+// RequiredApprovalsParams holds the parameters for RequiredApprovals
+type RequiredApprovalsParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// RequiredApprovals returns the number of approvals of its head commit a merge request to a database needs before it can be merged (POST /v1/requiredapprovals)
+// The response is decoded into out, unless it's nil
+func (c *Client) RequiredApprovals(ctx context.Context, p RequiredApprovalsParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/requiredapprovals", false, f, out)
+}
+
+// RequiredApprovalsSetParams holds the parameters for RequiredApprovalsSet
+type RequiredApprovalsSetParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The number of approvals needed.  Merge requests can be merged without being approved when it's 0
+	Approvals int
+}
+
+// RequiredApprovalsSet sets the number of approvals of its head commit a merge request to one of your databases needs before it can be merged (POST /v1/requiredapprovalsset)
+// The response is decoded into out, unless it's nil
+func (c *Client) RequiredApprovalsSet(ctx context.Context, p RequiredApprovalsSetParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.int("approvals", p.Approvals)
+	return c.call(ctx, "POST", "/v1/requiredapprovalsset", false, f, out)
+}
+
+// RequiredChecksParams holds the parameters for RequiredChecks
+type RequiredChecksParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// RequiredChecks returns the status checks which need to succeed on the head commit of a merge request to a database, before it can be merged (POST /v1/requiredchecks)
+// The response is decoded into out, unless it's nil
+func (c *Client) RequiredChecks(ctx context.Context, p RequiredChecksParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/requiredchecks", false, f, out)
+}
+
+// RequiredChecksSetParams holds the parameters for RequiredChecksSet
+type RequiredChecksSetParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// An (optional) comma separated list of the status check contexts needing to succeed.  Merge requests can be merged regardless of their status checks when not specified
+	Contexts string
+}
+
+// RequiredChecksSet sets the status checks which need to succeed on the head commit of a merge request to one of your databases, before it can be merged (POST /v1/requiredchecksset)
+// The response is decoded into out, unless it's nil
+func (c *Client) RequiredChecksSet(ctx context.Context, p RequiredChecksSetParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.optionalString("contexts", p.Contexts)
+	return c.call(ctx, "POST", "/v1/requiredchecksset", false, f, out)
+}
+
+// ReviewOwnersParams holds the parameters for ReviewOwners
+type ReviewOwnersParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// ReviewOwners returns the table ownership rules of a database, in the order they were given (POST /v1/reviewowners)
+// The response is decoded into out, unless it's nil
+func (c *Client) ReviewOwners(ctx context.Context, p ReviewOwnersParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/reviewowners", false, f, out)
+}
+
+// ReviewOwnersSetParams holds the parameters for ReviewOwnersSet
+type ReviewOwnersSetParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The (optional) list of table ownership rules, one per line.  The database has no table owners when not specified
+	Rules string
+}
+
+// ReviewOwnersSet replaces the table ownership rules of one of your databases (POST /v1/reviewownersset)
+// The response is decoded into out, unless it's nil
+func (c *Client) ReviewOwnersSet(ctx context.Context, p ReviewOwnersSetParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.optionalString("rules", p.Rules)
+	return c.call(ctx, "POST", "/v1/reviewownersset", false, f, out)
+}
+
+// RowHistoryParams holds the parameters for RowHistory
+type RowHistoryParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The name of the table holding the row
+	Table string
+	// A JSON object with the value of each primary key column of the row.  Tables without a primary key use "rowid"
+	Key string
+	// The (optional) database branch.  Uses the default database branch if not specified
+	Branch string
+}
+
+// RowHistory returns the history of a table row, by walking back through the commits of a database branch (POST /v1/rowhistory)
+// The response is decoded into out, unless it's nil
+func (c *Client) RowHistory(ctx context.Context, p RowHistoryParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("table", p.Table)
+	f.string("key", p.Key)
+	f.optionalString("branch", p.Branch)
+	return c.call(ctx, "POST", "/v1/rowhistory", false, f, out)
+}
+
+// RowsDeleteParams holds the parameters for RowsDelete
+type RowsDeleteParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The name of the table
+	Table string
+	// A JSON array of the rows to delete, each with the "key" holding the values of its primary key columns
+	Rows string
+	// The (optional) database branch.  Uses the default database branch if not specified
+	Branch string
+	// The (optional) commit message for the new commit
+	CommitMsg string
+}
+
+// RowsDelete deletes rows from a table of a standard database, adding a commit with the result to the branch (POST /v1/rowsdelete)
+// The response is decoded into out, unless it's nil
+func (c *Client) RowsDelete(ctx context.Context, p RowsDeleteParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("table", p.Table)
+	f.string("rows", p.Rows)
+	f.optionalString("branch", p.Branch)
+	f.optionalString("commitmsg", p.CommitMsg)
+	return c.call(ctx, "POST", "/v1/rowsdelete", false, f, out)
+}
+
+// RowsInsertParams holds the parameters for RowsInsert
+type RowsInsertParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The name of the table
+	Table string
+	// A JSON array of the rows to insert, each with the "values" of its columns
+	Rows string
+	// The (optional) database branch.  Uses the default database branch if not specified
+	Branch string
+	// The (optional) commit message for the new commit
+	CommitMsg string
+}
+
+// RowsInsert inserts rows into a table of a standard database, adding a commit with the result to the branch (POST /v1/rowsinsert)
+// The response is decoded into out, unless it's nil
+func (c *Client) RowsInsert(ctx context.Context, p RowsInsertParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("table", p.Table)
+	f.string("rows", p.Rows)
+	f.optionalString("branch", p.Branch)
+	f.optionalString("commitmsg", p.CommitMsg)
+	return c.call(ctx, "POST", "/v1/rowsinsert", false, f, out)
+}
+
+// RowsUpdateParams holds the parameters for RowsUpdate
+type RowsUpdateParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The name of the table
+	Table string
+	// A JSON array of the rows to change, each with the "key" holding the values of its primary key columns and the new "values" of its columns
+	Rows string
+	// The (optional) database branch.  Uses the default database branch if not specified
+	Branch string
+	// The (optional) commit message for the new commit
+	CommitMsg string
+}
+
+// RowsUpdate changes rows of a table in a standard database, adding a commit with the result to the branch (POST /v1/rowsupdate)
+// The response is decoded into out, unless it's nil
+func (c *Client) RowsUpdate(ctx context.Context, p RowsUpdateParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("table", p.Table)
+	f.string("rows", p.Rows)
+	f.optionalString("branch", p.Branch)
+	f.optionalString("commitmsg", p.CommitMsg)
+	return c.call(ctx, "POST", "/v1/rowsupdate", false, f, out)
+}
+
+// SandboxCreateParams holds the parameters for SandboxCreate
+type SandboxCreateParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The name of the new sandbox.  It's created as one of your databases
+	Sandbox string
+}
+
+// SandboxCreate creates a sandbox of a live database (POST /v1/sandboxcreate)
+// The response is decoded into out, unless it's nil
+func (c *Client) SandboxCreate(ctx context.Context, p SandboxCreateParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("sandbox", p.Sandbox)
+	return c.call(ctx, "POST", "/v1/sandboxcreate", false, f, out)
+}
+
+// SandboxDiffParams holds the parameters for SandboxDiff
+type SandboxDiffParams struct {
+	// The owner of the sandbox
+	DBOwner string
+	// The name of the sandbox
+	DBName string
+}
+
+// SandboxDiff returns the changes made to a sandbox since it was created from its parent database (POST /v1/sandboxdiff)
+// The response is decoded into out, unless it's nil
+func (c *Client) SandboxDiff(ctx context.Context, p SandboxDiffParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/sandboxdiff", false, f, out)
+}
+
+// SandboxesParams holds the parameters for Sandboxes
+type SandboxesParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// Sandboxes returns the sandboxes of a live database, newest first (POST /v1/sandboxes)
+// The response is decoded into out, unless it's nil
+func (c *Client) Sandboxes(ctx context.Context, p SandboxesParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/sandboxes", false, f, out)
+}
+
+// SandboxMergeParams holds the parameters for SandboxMerge
+type SandboxMergeParams struct {
+	// The owner of the sandbox
+	DBOwner string
+	// The name of the sandbox
+	DBName string
+	// An (optional) JSON array of the names of the tables, views, indexes, and triggers whose changes are merged.  Defaults to all of them
+	Objects string
+}
+
+// SandboxMerge merges the changes made to a sandbox back into its parent database, which needs write access to the parent database (POST /v1/sandboxmerge)
+// The response is decoded into out, unless it's nil
+func (c *Client) SandboxMerge(ctx context.Context, p SandboxMergeParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.optionalString("objects", p.Objects)
+	return c.call(ctx, "POST", "/v1/sandboxmerge", false, f, out)
+}
+
+// SavedQueriesParams holds the parameters for SavedQueries
+type SavedQueriesParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// SavedQueries returns the list of saved queries for a database which are visible to the caller (POST /v1/savedqueries)
+// The response is decoded into out, unless it's nil
+func (c *Client) SavedQueries(ctx context.Context, p SavedQueriesParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/savedqueries", false, f, out)
+}
+
+// SavedQueryParams holds the parameters for SavedQuery
+type SavedQueryParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The name of the saved query
+	Name string
+	// The (optional) version of the saved query to run.  Defaults to the latest version
+	Version string
+	// The (optional) layout of the returned data.  Either "rows" (the default) or "columnar"
+	Format string
+}
+
+// SavedQuery runs a saved query on a database, returning the results to the caller (POST /v1/savedquery)
+// The response is decoded into out, unless it's nil
+func (c *Client) SavedQuery(ctx context.Context, p SavedQueryParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("name", p.Name)
+	f.optionalString("version", p.Version)
+	f.optionalString("format", p.Format)
+	return c.call(ctx, "POST", "/v1/savedquery", false, f, out)
+}
+
+// SavedQuerySaveParams holds the parameters for SavedQuerySave
+type SavedQuerySaveParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The name of the saved query
+	Name string
+	// The SQL query, base64 encoded
+	SQL string
+	// An (optional) description of the query
+	Description string
+	// An (optional) boolean indicating whether the query is visible to everyone with access to the database
+	Shared *bool
+}
+
+// SavedQuerySave saves a query for a database (POST /v1/savedquerysave)
+// The response is decoded into out, unless it's nil
+func (c *Client) SavedQuerySave(ctx context.Context, p SavedQuerySaveParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("name", p.Name)
+	f.string("sql", p.SQL)
+	f.optionalString("description", p.Description)
+	f.optionalBool("shared", p.Shared)
+	return c.call(ctx, "POST", "/v1/savedquerysave", false, f, out)
+}
+
+// SavedQueryVersionsParams holds the parameters for SavedQueryVersions
+type SavedQueryVersionsParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The name of the saved query
+	Name string
+}
+
+// SavedQueryVersions returns the version history of a saved query (POST /v1/savedqueryversions)
+// The response is decoded into out, unless it's nil
+func (c *Client) SavedQueryVersions(ctx context.Context, p SavedQueryVersionsParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("name", p.Name)
+	return c.call(ctx, "POST", "/v1/savedqueryversions", false, f, out)
+}
+
+// SchemaCreateParams holds the parameters for SchemaCreate
+type SchemaCreateParams struct {
+	// The name for the new database
+	DBName string
+	// The JSON definition of the tables, columns and indexes of the new database
+	Schema string
+	// The (optional) commit message for the first commit.  Defaults to "Created from a schema definition"
+	CommitMsg string
+	// The (optional) licence of the new database.  Defaults to "Not specified"
+	Licence string
+	// An (optional) boolean for whether the new database is public.  Defaults to private
+	Public *bool
+}
+
+// SchemaCreate creates a new database from a schema definition, without needing a database file to be uploaded. The database file is generated on the server, and becomes the first commit of the new database (POST /v1/schemacreate)
+// The response is decoded into out, unless it's nil
+func (c *Client) SchemaCreate(ctx context.Context, p SchemaCreateParams, out interface{}) error {
+	f := newForm()
+	f.string("dbname", p.DBName)
+	f.string("schema", p.Schema)
+	f.optionalString("commitmsg", p.CommitMsg)
+	f.optionalString("licence", p.Licence)
+	f.optionalBool("public", p.Public)
+	return c.call(ctx, "POST", "/v1/schemacreate", false, f, out)
+}
+
+// SchemaPoliciesParams holds the parameters for SchemaPolicies
+type SchemaPoliciesParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// SchemaPolicies returns the schema change policy of each branch of a database which has one (POST /v1/schemapolicies)
+// The response is decoded into out, unless it's nil
+func (c *Client) SchemaPolicies(ctx context.Context, p SchemaPoliciesParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/schemapolicies", false, f, out)
+}
+
+// SchemaPolicySetParams holds the parameters for SchemaPolicySet
+type SchemaPolicySetParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The name of the branch
+	Branch string
+	// The (optional) schema change policy, either "block" or "approval".  The branch accepts any schema change when not specified
+	Policy string
+}
+
+// SchemaPolicySet sets the schema change policy of a branch of one of your databases (POST /v1/schemapolicyset)
+// The response is decoded into out, unless it's nil
+func (c *Client) SchemaPolicySet(ctx context.Context, p SchemaPolicySetParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("branch", p.Branch)
+	f.optionalString("policy", p.Policy)
+	return c.call(ctx, "POST", "/v1/schemapolicyset", false, f, out)
+}
+
+// SizeAlertParams holds the parameters for SizeAlert
+type SizeAlertParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// SizeAlert returns how much a database can grow from one commit to the next before its owner is emailed (POST /v1/sizealert)
+// The response is decoded into out, unless it's nil
+func (c *Client) SizeAlert(ctx context.Context, p SizeAlertParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/sizealert", false, f, out)
+}
+
+// SizeAlertSetParams holds the parameters for SizeAlertSet
+type SizeAlertSetParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The (optional) number of bytes a commit can grow the database by.  0 turns it off, the default
+	GrowthBytes *int
+	// The (optional) percentage a commit can grow the database by.  0 turns it off, the default
+	GrowthPercent string
+}
+
+// SizeAlertSet sets how much one of your databases can grow from one commit to the next before you're emailed about it (POST /v1/sizealertset)
+// The response is decoded into out, unless it's nil
+func (c *Client) SizeAlertSet(ctx context.Context, p SizeAlertSetParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.optionalInt("growth_bytes", p.GrowthBytes)
+	f.optionalString("growth_percent", p.GrowthPercent)
+	return c.call(ctx, "POST", "/v1/sizealertset", false, f, out)
+}
+
+// SizeHistoryParams holds the parameters for SizeHistory
+type SizeHistoryParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The (optional) database branch.  Uses the default database branch if not specified
+	Branch string
+}
+
+// SizeHistory returns the size of a database for each commit of a branch, oldest first (POST /v1/sizehistory)
+// The response is decoded into out, unless it's nil
+func (c *Client) SizeHistory(ctx context.Context, p SizeHistoryParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.optionalString("branch", p.Branch)
+	return c.call(ctx, "POST", "/v1/sizehistory", false, f, out)
+}
+
+// StaleBranchesParams holds the parameters for StaleBranches
+type StaleBranchesParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// StaleBranches returns the branches of a database flagged as stale (POST /v1/stalebranches)
+// The response is decoded into out, unless it's nil
+func (c *Client) StaleBranches(ctx context.Context, p StaleBranchesParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/stalebranches", false, f, out)
+}
+
+// StatusUpdatesParams holds the parameters for StatusUpdates
+type StatusUpdatesParams struct {
+	// The (optional) number of status updates to skip.  Defaults to 0
+	Offset *int
+	// The (optional) maximum number of status updates to return, up to 100.  Defaults to 25
+	Limit *int
+	// An (optional) boolean.  When true, only unread status updates are returned
+	Unread *bool
+}
+
+// StatusUpdates returns a page of your status updates, most recent first (POST /v1/statusupdates)
+// The response is decoded into out, unless it's nil
+func (c *Client) StatusUpdates(ctx context.Context, p StatusUpdatesParams, out interface{}) error {
+	f := newForm()
+	f.optionalInt("offset", p.Offset)
+	f.optionalInt("limit", p.Limit)
+	f.optionalBool("unread", p.Unread)
+	return c.call(ctx, "POST", "/v1/statusupdates", false, f, out)
+}
+
+// StatusUpdatesDismiss marks all of your status updates as read (POST /v1/statusupdatesdismiss)
+// The response is decoded into out, unless it's nil
+func (c *Client) StatusUpdatesDismiss(ctx context.Context, out interface{}) error {
+	f := newForm()
+	return c.call(ctx, "POST", "/v1/statusupdatesdismiss", false, f, out)
+}
+
+// StatusUpdatesReadParams holds the parameters for StatusUpdatesRead
+type StatusUpdatesReadParams struct {
+	// A comma separated list of status update IDs
+	IDs string
+	// An (optional) boolean.  Either "true" (the default) to mark the status updates as read, or "false" to mark them as unread
+	Read *bool
+}
+
+// StatusUpdatesRead marks some of your status updates as read or unread (POST /v1/statusupdatesread)
+// The response is decoded into out, unless it's nil
+func (c *Client) StatusUpdatesRead(ctx context.Context, p StatusUpdatesReadParams, out interface{}) error {
+	f := newForm()
+	f.string("ids", p.IDs)
+	f.optionalBool("read", p.Read)
+	return c.call(ctx, "POST", "/v1/statusupdatesread", false, f, out)
+}
+
+// TablesParams holds the parameters for Tables
+type TablesParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// Tables returns the list of tables in a SQLite database (POST /v1/tables)
+// The response is decoded into out, unless it's nil
+func (c *Client) Tables(ctx context.Context, p TablesParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/tables", false, f, out)
+}
+
+// TagsParams holds the parameters for Tags
+type TagsParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// Tags returns the details of all tags for a database (POST /v1/tags)
+// The response is decoded into out, unless it's nil
+func (c *Client) Tags(ctx context.Context, p TagsParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/tags", false, f, out)
+}
+
+// Templates returns the list of public databases which have been marked as templates (POST /v1/templates)
+// The response is decoded into out, unless it's nil
+func (c *Client) Templates(ctx context.Context, out interface{}) error {
+	f := newForm()
+	return c.call(ctx, "POST", "/v1/templates", false, f, out)
+}
+
+// TemplateSetParams holds the parameters for TemplateSet
+type TemplateSetParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// A boolean.  Either "true" to mark the database as a template, or "false" to stop it being one
+	Template bool
+}
+
+// TemplateSet marks one of your databases as a template, or stops it being one (POST /v1/templateset)
+// The response is decoded into out, unless it's nil
+func (c *Client) TemplateSet(ctx context.Context, p TemplateSetParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.bool("template", p.Template)
+	return c.call(ctx, "POST", "/v1/templateset", false, f, out)
+}
+
+// TemplateUseParams holds the parameters for TemplateUse
+type TemplateUseParams struct {
+	// The owner of the template
+	DBOwner string
+	// The name of the template
+	DBName string
+	// The name of the new database
+	Newname string
+	// An (optional) boolean.  When true, the rows of the template are copied into the new database too
+	Data *bool
+	// An (optional) boolean.  When true, the new database is public.  Defaults to false
+	Public *bool
+}
+
+// TemplateUse creates a new database in your account from a template, with the same schema as the latest commit of the template (POST /v1/templateuse)
+// The response is decoded into out, unless it's nil
+func (c *Client) TemplateUse(ctx context.Context, p TemplateUseParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("newname", p.Newname)
+	f.optionalBool("data", p.Data)
+	f.optionalBool("public", p.Public)
+	return c.call(ctx, "POST", "/v1/templateuse", false, f, out)
+}
+
+// TransactionBeginParams holds the parameters for TransactionBegin
+type TransactionBeginParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The (optional) number of seconds the transaction stays open between calls, before it's rolled back. Defaults to 30 seconds, and can be up to 300
+	Timeout *int
+}
+
+// TransactionBegin begins a transaction on a live database (POST /v1/transactionbegin)
+// The response is decoded into out, unless it's nil
+func (c *Client) TransactionBegin(ctx context.Context, p TransactionBeginParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.optionalInt("timeout", p.Timeout)
+	return c.call(ctx, "POST", "/v1/transactionbegin", false, f, out)
+}
+
+// TransactionCommitParams holds the parameters for TransactionCommit
+type TransactionCommitParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The token returned when the transaction was begun
+	Token string
+}
+
+// TransactionCommit commits a transaction on a live database (POST /v1/transactioncommit)
+// The response is decoded into out, unless it's nil
+func (c *Client) TransactionCommit(ctx context.Context, p TransactionCommitParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("token", p.Token)
+	return c.call(ctx, "POST", "/v1/transactioncommit", false, f, out)
+}
+
+// TransactionExecuteParams holds the parameters for TransactionExecute
+type TransactionExecuteParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The token returned when the transaction was begun
+	Token string
+	// The SQL statement to execute, base64 encoded
+	SQL string
+	// An (optional) JSON array of values for the "?" parameters of the statement, or a JSON object of values for its named parameters
+	Params string
+}
+
+// TransactionExecute executes a SQL statement in a transaction on a live database (POST /v1/transactionexecute)
+// The response is decoded into out, unless it's nil
+func (c *Client) TransactionExecute(ctx context.Context, p TransactionExecuteParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("token", p.Token)
+	f.string("sql", p.SQL)
+	f.optionalString("params", p.Params)
+	return c.call(ctx, "POST", "/v1/transactionexecute", false, f, out)
+}
+
+// TransactionQueryParams holds the parameters for TransactionQuery
+type TransactionQueryParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The token returned when the transaction was begun
+	Token string
+	// The SQL query to run, base64 encoded
+	SQL string
+	// The (optional) layout of the returned data.  Either "rows" (the default) or "columnar"
+	Format string
+	// An (optional) JSON array of values for the "?" parameters of the query, or a JSON object of values for its named parameters
+	Params string
+}
+
+// TransactionQuery runs a SQL query in a transaction on a live database, returning the results to the caller. The query sees the changes made earlier in the transaction (POST /v1/transactionquery)
+// The response is decoded into out, unless it's nil
+func (c *Client) TransactionQuery(ctx context.Context, p TransactionQueryParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("token", p.Token)
+	f.string("sql", p.SQL)
+	f.optionalString("format", p.Format)
+	f.optionalString("params", p.Params)
+	return c.call(ctx, "POST", "/v1/transactionquery", false, f, out)
+}
+
+// TransactionRollbackParams holds the parameters for TransactionRollback
+type TransactionRollbackParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The token returned when the transaction was begun
+	Token string
+}
+
+// TransactionRollback rolls back a transaction on a live database (POST /v1/transactionrollback)
+// The response is decoded into out, unless it's nil
+func (c *Client) TransactionRollback(ctx context.Context, p TransactionRollbackParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("token", p.Token)
+	return c.call(ctx, "POST", "/v1/transactionrollback", false, f, out)
+}
+
+// TransformationDeleteParams holds the parameters for TransformationDelete
+type TransformationDeleteParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The name of the transformation
+	Name string
+}
+
+// TransformationDelete removes a transformation from one of your live databases, along with its run history (POST /v1/transformationdelete)
+// The response is decoded into out, unless it's nil
+func (c *Client) TransformationDelete(ctx context.Context, p TransformationDeleteParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("name", p.Name)
+	return c.call(ctx, "POST", "/v1/transformationdelete", false, f, out)
+}
+
+// TransformationRunParams holds the parameters for TransformationRun
+type TransformationRunParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The (optional) name of the transformation to run.  Runs all of them if not specified
+	Name string
+}
+
+// TransformationRun runs transformations of one of your live databases, along with the transformations which depend on them (POST /v1/transformationrun)
+// The response is decoded into out, unless it's nil
+func (c *Client) TransformationRun(ctx context.Context, p TransformationRunParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.optionalString("name", p.Name)
+	return c.call(ctx, "POST", "/v1/transformationrun", false, f, out)
+}
+
+// TransformationRunsParams holds the parameters for TransformationRuns
+type TransformationRunsParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The (optional) name of a transformation, to only return its runs
+	Name string
+}
+
+// TransformationRuns returns the run history of the transformations of a live database, newest first (POST /v1/transformationruns)
+// The response is decoded into out, unless it's nil
+func (c *Client) TransformationRuns(ctx context.Context, p TransformationRunsParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.optionalString("name", p.Name)
+	return c.call(ctx, "POST", "/v1/transformationruns", false, f, out)
+}
+
+// TransformationsParams holds the parameters for Transformations
+type TransformationsParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// Transformations returns the transformations of a live database, along with when they last ran and whether that failed (POST /v1/transformations)
+// The response is decoded into out, unless it's nil
+func (c *Client) Transformations(ctx context.Context, p TransformationsParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/transformations", false, f, out)
+}
+
+// TransformationSaveParams holds the parameters for TransformationSave
+type TransformationSaveParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The name of the transformation, which is also the name of the table it creates
+	Name string
+	// The SELECT query of the transformation, base64 encoded
+	SQL string
+	// An (optional) comma separated list of the transformations this one runs after
+	DependsOn string
+	// The (optional) number of minutes between scheduled runs.  Isn't run on a schedule if not specified
+	Interval *int
+	// An (optional) boolean for whether to run after each change to the database
+	OnWrite *bool
+}
+
+// TransformationSave adds a transformation to one of your live databases, or changes an existing one (POST /v1/transformationsave)
+// The response is decoded into out, unless it's nil
+func (c *Client) TransformationSave(ctx context.Context, p TransformationSaveParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("name", p.Name)
+	f.string("sql", p.SQL)
+	f.optionalString("dependson", p.DependsOn)
+	f.optionalInt("interval", p.Interval)
+	f.optionalBool("onwrite", p.OnWrite)
+	return c.call(ctx, "POST", "/v1/transformationsave", false, f, out)
+}
+
+// TrendingParams holds the parameters for Trending
+type TrendingParams struct {
+	// The (optional) number of databases to skip.  Defaults to 0
+	Offset *int
+	// The (optional) maximum number of databases to return, up to 100.  Defaults to 25
+	Limit *int
+}
+
+// Trending returns a page of the public databases which are trending at the moment, highest scoring first. The trending score adds up the recent stars, forks, downloads, and views of each database, with older activity counting for less (POST /v1/trending)
+// The response is decoded into out, unless it's nil
+func (c *Client) Trending(ctx context.Context, p TrendingParams, out interface{}) error {
+	f := newForm()
+	f.optionalInt("offset", p.Offset)
+	f.optionalInt("limit", p.Limit)
+	return c.call(ctx, "POST", "/v1/trending", false, f, out)
+}
+
+// UnblockParams holds the parameters for Unblock
+type UnblockParams struct {
+	// The user to unblock
+	User string
+}
+
+// Unblock unblocks a user (POST /v1/unblock)
+// The response is decoded into out, unless it's nil
+func (c *Client) Unblock(ctx context.Context, p UnblockParams, out interface{}) error {
+	f := newForm()
+	f.string("user", p.User)
+	return c.call(ctx, "POST", "/v1/unblock", false, f, out)
+}
+
+// UploadParams holds the parameters for Upload
+type UploadParams struct {
+	// The name of the database being created.  Defaults to the name of the uploaded file
+	DBName string
+	// The database file to upload
+	File io.Reader
+	// A boolean string ("true", "false") indicating whether the database file was encrypted before uploading.  Encrypted databases are stored and downloaded as is, but can't be queried
+	Encrypted *bool
+	// The database branch this commit is for.  Uses the default database branch if not specified
+	Branch string
+	// A message to include with the commit.  Often a description of the changes in the new data
+	CommitMsg string
+	// The URL to the reference source of the data
+	SourceURL string
+	// A datestamp in RFC3339 format
+	LastModified string
+	// An identifier for a license that's "in the system"
+	Licence string
+	// A boolean string ("true", "false") indicating whether this upload is a live database
+	Live *bool
+	// A boolean, whether the database should be public.  True means "public", false means "not public"
+	Public *bool
+	// The commit ID this new database revision should be appended to.  For new databases it's ignored, but for existing databases it's required (it's used to detect out of date / conflicting uploads)
+	Commit string
+}
+
+// Upload creates a new database in your account, or adds a new commit to an existing database (POST /v1/upload)
+// The response is decoded into out, unless it's nil
+func (c *Client) Upload(ctx context.Context, p UploadParams, out interface{}) error {
+	f := newForm()
+	f.optionalString("dbname", p.DBName)
+	f.file("file", p.File)
+	f.optionalBool("encrypted", p.Encrypted)
+	f.optionalString("branch", p.Branch)
+	f.optionalString("commitmsg", p.CommitMsg)
+	f.optionalString("sourceurl", p.SourceURL)
+	f.optionalString("lastmodified", p.LastModified)
+	f.optionalString("licence", p.Licence)
+	f.optionalBool("live", p.Live)
+	f.optionalBool("public", p.Public)
+	f.optionalString("commit", p.Commit)
+	return c.call(ctx, "POST", "/v1/upload", false, f, out)
+}
+
+// UploadPagesParams holds the parameters for UploadPages
+type UploadPagesParams struct {
+	// The name of the database being updated
+	DBName string
+	// The commit ID the changed pages are based on
+	Commit string
+	// A file holding the changed pages.  Each page is a 4 byte big endian page number (starting from 1), followed by the page data
+	Pages string
+	// The page size of the database, in bytes
+	Pagesize string
+	// The size of the new database file, in bytes
+	Size string
+	// The SHA256 of the new database file
+	Dbshasum string
+	// The database branch this commit is for.  Uses the default database branch if not specified
+	Branch string
+	// A message to include with the commit.  Often a description of the changes in the new data
+	CommitMsg string
+	// A boolean string ("true", "false"), for whether to overwrite newer commits on the branch
+	Force *bool
+	// A boolean string ("true", "false"), for whether to merge the changes into the branch when newer commits have been added to it since the base commit
+	Merge *bool
+}
+
+// UploadPages adds a new commit to an existing standard database, from just the pages of the database file which have changed since the commit it's based on (POST /v1/uploadpages)
+// The response is decoded into out, unless it's nil
+func (c *Client) UploadPages(ctx context.Context, p UploadPagesParams, out interface{}) error {
+	f := newForm()
+	f.string("dbname", p.DBName)
+	f.string("commit", p.Commit)
+	f.string("pages", p.Pages)
+	f.string("pagesize", p.Pagesize)
+	f.string("size", p.Size)
+	f.string("dbshasum", p.Dbshasum)
+	f.optionalString("branch", p.Branch)
+	f.optionalString("commitmsg", p.CommitMsg)
+	f.optionalBool("force", p.Force)
+	f.optionalBool("merge", p.Merge)
+	return c.call(ctx, "POST", "/v1/uploadpages", false, f, out)
+}
+
+// ValidationResultsParams holds the parameters for ValidationResults
+type ValidationResultsParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The commit ID to return the validation results of
+	Commit string
+}
+
+// ValidationResults returns the outcome of checking a commit against the validation rules of a database (POST /v1/validationresults)
+// The response is decoded into out, unless it's nil
+func (c *Client) ValidationResults(ctx context.Context, p ValidationResultsParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("commit", p.Commit)
+	return c.call(ctx, "POST", "/v1/validationresults", false, f, out)
+}
+
+// ValidationRuleDeleteParams holds the parameters for ValidationRuleDelete
+type ValidationRuleDeleteParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The name of the validation rule
+	Name string
+}
+
+// ValidationRuleDelete removes a validation rule from one of your databases (POST /v1/validationruledelete)
+// The response is decoded into out, unless it's nil
+func (c *Client) ValidationRuleDelete(ctx context.Context, p ValidationRuleDeleteParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("name", p.Name)
+	return c.call(ctx, "POST", "/v1/validationruledelete", false, f, out)
+}
+
+// ValidationRulesParams holds the parameters for ValidationRules
+type ValidationRulesParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+}
+
+// ValidationRules returns the validation rules of a database (POST /v1/validationrules)
+// The response is decoded into out, unless it's nil
+func (c *Client) ValidationRules(ctx context.Context, p ValidationRulesParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/validationrules", false, f, out)
+}
+
+// ValidationRuleSaveParams holds the parameters for ValidationRuleSave
+type ValidationRuleSaveParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The name of the validation rule
+	Name string
+	// The type of rule, either "assertion", "not_null", "unique", or "row_count"
+	Type string
+	// The (optional) table the rule checks.  Needed for all types of rule except "assertion"
+	Table string
+	// The (optional) column the rule checks.  Needed for "not_null" and "unique" rules
+	Column string
+	// An (optional) base64 encoded SELECT query which returns no rows when the data is valid.  Needed for "assertion" rules
+	SQL string
+	// The (optional) number of rows the table needs at least, for "row_count" rules
+	MinRows *int
+	// The (optional) number of rows the table can have at most, for "row_count" rules
+	MaxRows *int
+	// An (optional) boolean for whether commits failing the rule are rejected
+	Blocking *bool
+}
+
+// ValidationRuleSave adds a validation rule to one of your databases, or changes an existing one (POST /v1/validationrulesave)
+// The response is decoded into out, unless it's nil
+func (c *Client) ValidationRuleSave(ctx context.Context, p ValidationRuleSaveParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("name", p.Name)
+	f.string("type", p.Type)
+	f.optionalString("table", p.Table)
+	f.optionalString("column", p.Column)
+	f.optionalString("sql", p.SQL)
+	f.optionalInt("minrows", p.MinRows)
+	f.optionalInt("maxrows", p.MaxRows)
+	f.optionalBool("blocking", p.Blocking)
+	return c.call(ctx, "POST", "/v1/validationrulesave", false, f, out)
+}
+
+// ValidationRulesExportParams holds the parameters for ValidationRulesExport
+type ValidationRulesExportParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The format to export the rules in, either "greatexpectations" or "jsonschema"
+	Format string
+	// The table to export the rules of
+	Table string
+}
+
+// ValidationRulesExport returns the validation rules of a database for a table, as a Great Expectations expectation suite or a JSON Schema (POST /v1/validationrulesexport)
+// The response is decoded into out, unless it's nil
+func (c *Client) ValidationRulesExport(ctx context.Context, p ValidationRulesExportParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("format", p.Format)
+	f.string("table", p.Table)
+	return c.call(ctx, "POST", "/v1/validationrulesexport", false, f, out)
+}
+
+// ValidationRulesImportParams holds the parameters for ValidationRulesImport
+type ValidationRulesImportParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// The format of the file, either "greatexpectations" or "jsonschema"
+	Format string
+	// The expectation suite or JSON Schema
+	File io.Reader
+	// The (optional) table the rules are for.  Uses the name of the suite, or the title of the schema if not specified
+	Table string
+	// An (optional) boolean for whether commits failing the imported rules are rejected
+	Blocking *bool
+}
+
+// ValidationRulesImport adds validation rules to one of your databases from a Great Expectations expectation suite or a JSON Schema for a table (POST /v1/validationrulesimport)
+// The response is decoded into out, unless it's nil
+func (c *Client) ValidationRulesImport(ctx context.Context, p ValidationRulesImportParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.string("format", p.Format)
+	f.file("file", p.File)
+	f.optionalString("table", p.Table)
+	f.optionalBool("blocking", p.Blocking)
+	return c.call(ctx, "POST", "/v1/validationrulesimport", false, f, out)
+}
+
+// Verified returns the list of public databases which have been verified by the instance admins (POST /v1/verified)
+// The response is decoded into out, unless it's nil
+func (c *Client) Verified(ctx context.Context, out interface{}) error {
+	f := newForm()
+	return c.call(ctx, "POST", "/v1/verified", false, f, out)
+}
+
+// VerifyParams holds the parameters for Verify
+type VerifyParams struct {
+	// The owner of the database
+	DBOwner string
+	// The name of the database
+	DBName string
+	// A boolean.  Either "true" to mark the database as verified, or "false" to remove the verification
+	Verified bool
+}
+
+// Verify marks a database as verified, or removes the verification again (POST /v1/verify)
+// The response is decoded into out, unless it's nil
+func (c *Client) Verify(ctx context.Context, p VerifyParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	f.bool("verified", p.Verified)
+	return c.call(ctx, "POST", "/v1/verify", false, f, out)
+}
+
+// ViewsParams holds the parameters for Views
+type ViewsParams struct {
+	// The owner of the database being queried
+	DBOwner string
+	// The name of the database being queried
+	DBName string
+}
+
+// Views returns the list of views in a SQLite database (POST /v1/views)
+// The response is decoded into out, unless it's nil
+func (c *Client) Views(ctx context.Context, p ViewsParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/views", false, f, out)
+}
+
+// WebpageParams holds the parameters for Webpage
+type WebpageParams struct {
+	// The owner of the database being queried
+	DBOwner string
+	// The name of the database being queried
+	DBName string
+}
+
+// Webpage returns the address of the database in the webUI (POST /v1/webpage)
+// The response is decoded into out, unless it's nil
+func (c *Client) Webpage(ctx context.Context, p WebpageParams, out interface{}) error {
+	f := newForm()
+	f.string("dbowner", p.DBOwner)
+	f.string("dbname", p.DBName)
+	return c.call(ctx, "POST", "/v1/webpage", false, f, out)
+}
+
+// StatusV2 this is a very simple call which returns an OK status if the user has been authenticated successfully (GET /v2/status)
+// The response is decoded into out, unless it's nil
+func (c *Client) StatusV2(ctx context.Context, out interface{}) error {
+	f := newForm()
+	return c.call(ctx, "GET", "/v2/status", true, f, out)
+}
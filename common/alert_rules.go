@@ -0,0 +1,267 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// alertCheckInterval is how often the alert loop looks for rules due to be evaluated
+const alertCheckInterval = time.Minute
+
+var (
+	// alertConditions are the conditions alert rules can check their metric against, and how they're described in
+	// notifications.  The "drop" and "rise" thresholds are percentages of the previous value
+	alertConditions = map[string]string{
+		"above": "is above %v",
+		"below": "is below %v",
+		"drop":  "dropped by at least %v%%",
+		"equal": "is equal to %v",
+		"rise":  "rose by at least %v%%",
+	}
+
+	// alertMetrics are the parts of a query result alert rules can check, and how they're described in notifications
+	alertMetrics = map[string]string{
+		"rows":  "The number of rows returned",
+		"value": "The returned value",
+	}
+)
+
+// AlertLoop evaluates the alert rules which are due, notifying their owners of the ones which have started triggering.
+// When several nodes are running, only one of them does it.  When ctx is cancelled the alert rule being evaluated is
+// finished off, then wg is marked as done
+func AlertLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// Ensure a warning message is displayed on the console if the alert loop exits other than by shutting down
+	defer func() {
+		if ctx.Err() != nil {
+			log.Printf("%s: alert loop stopped", config.Conf.Live.Nodename)
+			return
+		}
+		log.Printf("%s: WARN: Alert loop exited", config.Conf.Live.Nodename)
+	}()
+
+	leader := database.NewLeader("alerts")
+	defer leader.Resign()
+
+	log.Printf("%s: alert loop started.  %v refresh.", config.Conf.Live.Nodename, alertCheckInterval)
+	for {
+		if leader.IsLeader() {
+			list, err := database.AlertRulesDue()
+			if err != nil {
+				log.Printf("Error when retrieving the alert rules which are due: %v", err)
+			}
+			for _, r := range list {
+				if ctx.Err() != nil {
+					break
+				}
+				err = evaluateAlertRule(r)
+				if err != nil {
+					log.Printf("Evaluating the alert rule '%s' of '%s' failed: %v", SanitiseLogString(r.Name),
+						r.User, err)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(alertCheckInterval):
+		}
+	}
+}
+
+// AlertCondition checks the metric and condition of an alert rule are known ones, and its threshold makes sense for
+// the condition
+func AlertCondition(metric, condition string, threshold float64) error {
+	if _, ok := alertMetrics[metric]; !ok {
+		return errors.New("Unknown metric.  Must be either 'rows' or 'value'")
+	}
+	if _, ok := alertConditions[condition]; !ok {
+		return errors.New("Unknown condition.  Must be one of 'above', 'below', 'equal', 'drop', or 'rise'")
+	}
+	if (condition == "drop" || condition == "rise") && threshold <= 0 {
+		return errors.New("The threshold of 'drop' and 'rise' conditions is a percentage, which needs to be above 0")
+	}
+	if condition == "drop" && threshold > 100 {
+		return errors.New("Values can't drop by more than 100%")
+	}
+	return nil
+}
+
+// alertTriggered returns whether a value meets the condition of an alert rule.  The "drop" and "rise" conditions
+// compare it against the previous value, so are never met when there isn't a previous value to compare against
+func alertTriggered(condition string, threshold, value float64, previous *float64) bool {
+	switch condition {
+	case "above":
+		return value > threshold
+	case "below":
+		return value < threshold
+	case "equal":
+		return value == threshold
+	case "drop":
+		return previous != nil && *previous > 0 && value <= *previous*(1-threshold/100)
+	case "rise":
+		return previous != nil && *previous > 0 && value >= *previous*(1+threshold/100)
+	}
+	return false
+}
+
+// alertValue runs the saved query of an alert rule, returning the value of its metric
+func alertValue(r database.AlertRule) (value float64, err error) {
+	allowed, err := database.CheckDBPermissions(r.User, r.DBOwner, r.DBName, false)
+	if err != nil {
+		return
+	}
+	if !allowed {
+		return 0, fmt.Errorf("The database '%s/%s' doesn't exist, or you no longer have access to it", r.DBOwner,
+			r.DBName)
+	}
+	q, exists, err := database.SavedQueryGet(r.User, r.DBOwner, r.DBName, r.QueryName, 0)
+	if err != nil {
+		return
+	}
+	if !exists {
+		return 0, fmt.Errorf("The saved query '%s' of '%s/%s' no longer exists", r.QueryName, r.DBOwner, r.DBName)
+	}
+	isLive, liveNode, err := database.CheckDBLive(r.DBOwner, r.DBName)
+	if err != nil {
+		return
+	}
+	if !isLive {
+		return 0, fmt.Errorf("The database '%s/%s' is no longer a live database", r.DBOwner, r.DBName)
+	}
+	if liveNode == "" {
+		return 0, errors.New("No job queue node available for the live database")
+	}
+	data, err := LiveQuery(liveNode, r.User, r.DBOwner, r.DBName, q.SQL)
+	if err != nil {
+		return
+	}
+
+	if r.Metric == "rows" {
+		return float64(len(data.Records)), nil
+	}
+	if len(data.Records) == 0 || len(data.Records[0]) == 0 {
+		return 0, errors.New("The query didn't return a value")
+	}
+	v := data.Records[0][0]
+	if v.Type == Null || v.Value == nil {
+		return 0, errors.New("The query returned NULL rather than a number")
+	}
+	value, err = strconv.ParseFloat(fmt.Sprint(v.Value), 64)
+	if err != nil {
+		return 0, fmt.Errorf("The query returned '%v' rather than a number", v.Value)
+	}
+	return
+}
+
+// evaluateAlertRule runs the query of an alert rule and checks its condition, then records the result.  The owner is
+// notified when the condition starts being met, but not again until it has stopped being met.  Failures are recorded
+// in the history rather than returned, with the owner being emailed when a rule starts failing
+func evaluateAlertRule(r database.AlertRule) (err error) {
+	e := database.AlertEvent{Evaluated: time.Now().UTC(), Previous: r.LastValue}
+	value, evalErr := alertValue(r)
+	if evalErr == nil {
+		e.Value = &value
+		e.Triggered = alertTriggered(r.Condition, r.Threshold, value, r.LastValue)
+	}
+
+	// Webhooks are notified straight away, while emails are queued along with the evaluation being saved
+	var notifySubj, notifyMsg string
+	if evalErr == nil && e.Triggered && !r.Triggered {
+		notifySubj, notifyMsg = alertEmail(r, e)
+		if r.Delivery == "webhook" {
+			notifySubj, notifyMsg = "", ""
+			evalErr = notifyAlertWebhook(r, e)
+			if evalErr != nil {
+				// Leaving the rule untriggered means the notification is tried again at its next evaluation
+				evalErr = fmt.Errorf("Sending the alert to its webhook failed: %v", evalErr)
+			}
+		}
+		e.Notified = evalErr == nil
+	}
+	if evalErr != nil {
+		e.Error = evalErr.Error()
+	}
+
+	// Work out when the rule is next evaluated
+	sched, err := ParseCron(r.Schedule)
+	nextRun := time.Time{}
+	if err == nil {
+		nextRun = sched.Next(e.Evaluated)
+	}
+	if err != nil || nextRun.IsZero() {
+		// This shouldn't happen, as schedules are checked when they're saved
+		nextRun = e.Evaluated.AddDate(1, 0, 0)
+	}
+
+	failSubj := fmt.Sprintf("DBHub.io: alert rule '%s' failed", r.Name)
+	failMsg := fmt.Sprintf("Your alert rule '%s' couldn't be evaluated, due to this error:\n\n%s\n\nYou won't be "+
+		"emailed again until it has been evaluated successfully.  Its history can be retrieved using the alerthistory "+
+		"API call.", r.Name, e.Error)
+	return database.AlertEvaluationSave(r, e, nextRun, failSubj, failMsg, notifySubj, notifyMsg)
+}
+
+// alertDescription describes the condition of an alert rule which has been met, such as "The number of rows returned
+// dropped by at least 50% (from 120 to 43)"
+func alertDescription(r database.AlertRule, e database.AlertEvent) string {
+	desc := alertMetrics[r.Metric] + " " + fmt.Sprintf(alertConditions[r.Condition], r.Threshold)
+	if e.Previous != nil && (r.Condition == "drop" || r.Condition == "rise") {
+		return fmt.Sprintf("%s (from %v to %v)", desc, *e.Previous, *e.Value)
+	}
+	return fmt.Sprintf("%s (it's %v)", desc, *e.Value)
+}
+
+// alertEmail returns the subject and body of the email notifying the owner of a rule that its condition has been met
+func alertEmail(r database.AlertRule, e database.AlertEvent) (subj, msg string) {
+	subj = fmt.Sprintf("DBHub.io: alert '%s' triggered", r.Name)
+	msg = fmt.Sprintf("Your alert rule '%s' was triggered at %s UTC, when running the saved query '%s' on "+
+		"https://%s/%s/%s.\n\n%s.\n\nYou won't be notified again until the condition has stopped being met.", r.Name,
+		e.Evaluated.Format("2006-01-02 15:04"), r.QueryName, config.Conf.Web.ServerName, r.DBOwner, r.DBName,
+		alertDescription(r, e))
+	return
+}
+
+// notifyAlertWebhook sends the details of a triggered alert to the webhook of its rule, as JSON
+func notifyAlertWebhook(r database.AlertRule, e database.AlertEvent) error {
+	body, err := json.Marshal(struct {
+		Condition   string    `json:"condition"`
+		DBName      string    `json:"database"`
+		DBOwner     string    `json:"owner"`
+		Description string    `json:"description"`
+		Metric      string    `json:"metric"`
+		Previous    *float64  `json:"previous"`
+		QueryName   string    `json:"query_name"`
+		Rule        string    `json:"rule"`
+		Threshold   float64   `json:"threshold"`
+		Triggered   time.Time `json:"triggered"`
+		Value       float64   `json:"value"`
+	}{
+		Condition:   r.Condition,
+		DBName:      r.DBName,
+		DBOwner:     r.DBOwner,
+		Description: alertDescription(r, e),
+		Metric:      r.Metric,
+		Previous:    e.Previous,
+		QueryName:   r.QueryName,
+		Rule:        r.Name,
+		Threshold:   r.Threshold,
+		Triggered:   e.Evaluated,
+		Value:       *e.Value,
+	})
+	if err != nil {
+		return err
+	}
+	return postSignedWebhook(r.WebhookURL, r.WebhookSecret, "application/json", body, map[string]string{
+		"X-DBHub-Alert": r.Name,
+	})
+}
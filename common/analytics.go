@@ -0,0 +1,57 @@
+package common
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// How often the daily database analytics are updated from the download and API call logs
+const analyticsRefreshInterval = time.Hour
+
+// AnalyticsLoop periodically updates the daily download, clone, and API query counts of the databases.  The first run
+// goes through the complete logs, so any days missed while the server was down are filled in.  After that only
+// yesterday and today are updated.  When ctx is cancelled the loop stops once the run in progress is done, then wg is
+// marked as done
+func AnalyticsLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// Ensure a warning message is displayed on the console if the analytics loop exits other than by shutting down
+	defer func() {
+		if ctx.Err() != nil {
+			log.Printf("%s: analytics loop stopped", config.Conf.Live.Nodename)
+			return
+		}
+		log.Printf("%s: WARN: Analytics loop exited", config.Conf.Live.Nodename)
+	}()
+
+	// When several nodes are running, only one of them updates the analytics
+	leader := database.NewLeader("analytics")
+	defer leader.Resign()
+
+	log.Printf("%s: analytics refresh loop started.  %v refresh.", config.Conf.Live.Nodename, analyticsRefreshInterval)
+	var since time.Time
+	for {
+		if leader.IsLeader() {
+			err := database.AnalyticsAggregate(since)
+			if err != nil {
+				log.Printf("Error when updating the database analytics: %v", err)
+			} else {
+				since = time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -1)
+			}
+		} else {
+			// Go through the complete logs again if this node becomes the leader later on, as it doesn't know which
+			// days the previous leader got to
+			since = time.Time{}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(analyticsRefreshInterval):
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package common
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// AvatarSize is the width and height, in pixels, of the stored avatars.  Smaller sizes are scaled down from it when
+// requested
+const AvatarSize = 256
+
+// avatarBucket is the storage bucket holding the uploaded avatars, named after the ID of their user
+const avatarBucket = "avatars"
+
+// Avatar returns the avatar of a user as a PNG image of the given size, along with when it last changed.  Users who
+// haven't uploaded one get an identicon generated from their name
+func Avatar(userName string, size int) (img []byte, modified time.Time, err error) {
+	if size < 1 || size > AvatarSize {
+		size = AvatarSize
+	}
+	userID, uploaded, err := database.UserAvatar(userName)
+	if err != nil {
+		return
+	}
+	if userID == 0 || uploaded == nil {
+		img, err = AvatarIdenticon(userName, size)
+		return
+	}
+
+	obj, err := blobStore.Get(avatarBucket, fmt.Sprint(userID))
+	if err != nil {
+		log.Printf("Retrieving the avatar of user '%s' failed: %v", SanitiseLogString(userName), err)
+		return nil, time.Time{}, errors.New("Error retrieving avatar from internal storage")
+	}
+	defer obj.Close()
+	img, err = io.ReadAll(obj)
+	if err != nil {
+		return
+	}
+	modified = *uploaded
+	if size == AvatarSize {
+		return
+	}
+	src, err := png.Decode(bytes.NewReader(img))
+	if err != nil {
+		return
+	}
+	var buf bytes.Buffer
+	err = png.Encode(&buf, scaleImage(src, src.Bounds(), size, size))
+	return buf.Bytes(), modified, err
+}
+
+// AvatarIdenticon generates the default avatar of a user, a symmetrical pattern of squares derived from their name.  It's
+// used instead of Gravatar when that's turned off, so no details of the people viewing the site are sent elsewhere
+func AvatarIdenticon(userName string, size int) ([]byte, error) {
+	hash := md5.Sum([]byte(strings.ToLower(userName)))
+	fg := color.NRGBA{R: hash[0]/2 + 64, G: hash[1]/2 + 64, B: hash[2]/2 + 64, A: 255}
+	bg := color.NRGBA{R: 240, G: 240, B: 240, A: 255}
+	bits := uint16(hash[3])<<8 | uint16(hash[4])
+
+	// The pattern is a 5x5 grid, with the right hand columns mirroring the left hand ones
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		row := y * 5 / size
+		for x := 0; x < size; x++ {
+			col := x * 5 / size
+			if col > 2 {
+				col = 4 - col
+			}
+			c := bg
+			if bits>>(row*3+col)&1 == 1 {
+				c = fg
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	return buf.Bytes(), err
+}
+
+// RemoveAvatar removes the uploaded avatar of a user, so they get the default one again
+func RemoveAvatar(userName string) (err error) {
+	userID, uploaded, err := database.UserAvatar(userName)
+	if err != nil {
+		return
+	}
+	if userID == 0 || uploaded == nil {
+		return
+	}
+	err = database.UserAvatarSet(userName, "")
+	if err != nil {
+		return
+	}
+	err = blobStore.Remove(avatarBucket, fmt.Sprint(userID))
+	if err != nil {
+		log.Printf("Removing the avatar of user '%s' failed: %v", SanitiseLogString(userName), err)
+	}
+	return
+}
+
+// SetAvatar stores an uploaded image as the avatar of a user.  The middle of the image is cropped to a square, then
+// scaled to AvatarSize pixels and stored as PNG
+func SetAvatar(userName string, data []byte) (err error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return errors.New("The avatar needs to be a GIF, JPEG, or PNG image")
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > cellPreviewMaxPixels {
+		return errors.New("The avatar image is too large")
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return errors.New("The avatar image couldn't be read")
+	}
+	userID, _, err := database.UserAvatar(userName)
+	if err != nil {
+		return
+	}
+	if userID == 0 {
+		return fmt.Errorf("Unknown user '%s'", userName)
+	}
+
+	// Crop the image to a square from its middle
+	area := src.Bounds()
+	if d := area.Dx() - area.Dy(); d > 0 {
+		area.Min.X += d / 2
+		area.Max.X = area.Min.X + area.Dy()
+	} else if d < 0 {
+		area.Min.Y += -d / 2
+		area.Max.Y = area.Min.Y + area.Dx()
+	}
+	var buf bytes.Buffer
+	err = png.Encode(&buf, scaleImage(src, area, AvatarSize, AvatarSize))
+	if err != nil {
+		return
+	}
+	_, err = blobStore.Put(avatarBucket, fmt.Sprint(userID), bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		log.Printf("Storing the avatar of user '%s' failed: %v", SanitiseLogString(userName), err)
+		return errors.New("Error storing avatar")
+	}
+
+	// The version in the URL changes with each upload, so the cached copies of the old avatar aren't used
+	avatarURL := fmt.Sprintf("https://%s/avatar/%s?v=%d", config.Conf.Web.ServerName, url.PathEscape(userName),
+		time.Now().Unix())
+	return database.UserAvatarSet(userName, avatarURL)
+}
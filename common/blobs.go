@@ -0,0 +1,193 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	sqlite "github.com/gwenn/gosqlite"
+)
+
+// LiveBlobMaxSize is the largest cell value which can be returned from a live database.  Values from live databases
+// are passed back through the job queue, so they're limited to a reasonable size
+const LiveBlobMaxSize = 50 * 1024 * 1024
+
+// JobRequestBlob holds the data used when making a request for the value of a single cell to our job queue backend
+type JobRequestBlob struct {
+	Column string `json:"column"`
+	RowID  int64  `json:"rowid"`
+	Table  string `json:"table"`
+}
+
+// JobResponseBlob holds the fields used for receiving the value of a single cell from our job queue backend
+type JobResponseBlob struct {
+	Data   []byte `json:"data"`
+	Err    string `json:"error"`
+	Status int    `json:"status"`
+}
+
+// BlobStandard sends the value of a single BLOB or TEXT cell of a standard database to the client, identified by its
+// table, column, and rowid.  It's streamed straight from the database file, with support for HTTP range requests, so
+// large values such as images and PDFs can be previewed or downloaded without fetching the whole database
+func BlobStandard(w http.ResponseWriter, r *http.Request, dbOwner, dbName, commitID, loggedInUser string, req JobRequestBlob, download bool) (httpStatus int, err error) {
+	bucket, id, lastModified, clientEncrypted, err := minioLocation(dbOwner, dbName, commitID, loggedInUser)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if clientEncrypted {
+		return http.StatusBadRequest, ErrClientEncrypted
+	}
+	sdb, err := OpenSQLiteDatabase(bucket, id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer sdb.Close()
+
+	blob, httpStatus, err := openBlob(sdb, req)
+	if err != nil {
+		return
+	}
+	defer blob.Close()
+
+	// The value in a database file never changes, so it's identified by the file and the cell
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s/%s/%s/%s/%d", bucket, id, req.Table, req.Column, req.RowID)))
+	w.Header().Set("ETag", `"`+hex.EncodeToString(h[:16])+`"`)
+	return http.StatusOK, ServeBlob(w, r, req, lastModified, blob, download)
+}
+
+// LiveBlob asks our job queue backend for the value of a single BLOB or TEXT cell of a live database
+func LiveBlob(liveNode, loggedInUser, dbOwner, dbName string, req JobRequestBlob) (data []byte, httpStatus int, err error) {
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	var resp JobResponseBlob
+	err = JobSubmit(&resp, liveNode, "blob", loggedInUser, dbOwner, dbName, reqJSON)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if resp.Err != "" {
+		httpStatus = resp.Status
+		if httpStatus == 0 {
+			httpStatus = http.StatusInternalServerError
+		}
+		return nil, httpStatus, errors.New(resp.Err)
+	}
+	return resp.Data, http.StatusOK, nil
+}
+
+// ServeBlob sends the value of a cell to the client.  Its content type is worked out from the start of the value, and
+// range requests are handled by http.ServeContent.  Values which would be run by a web browser, such as HTML and SVG,
+// are sent as plain text, so they can't run scripts from our domain
+func ServeBlob(w http.ResponseWriter, r *http.Request, req JobRequestBlob, modTime time.Time, content io.ReadSeeker, download bool) (err error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(content, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return
+	}
+	if _, err = content.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	contentType := http.DetectContentType(head[:n])
+	if strings.HasPrefix(contentType, "text/html") || strings.Contains(contentType, "xml") {
+		contentType = "text/plain; charset=utf-8"
+	}
+
+	// Name the file after the cell, with an extension matching its type
+	fileName := fmt.Sprintf("%s-%s-%d", req.Table, req.Column, req.RowID)
+	if exts, _ := mime.ExtensionsByType(contentType); len(exts) > 0 {
+		fileName += exts[0]
+	}
+	disposition := "inline"
+	if download {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": fileName}))
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, fileName, modTime, content)
+	return nil
+}
+
+// SQLiteBlobLive is used by our job queue backend nodes to read the value of a single BLOB or TEXT cell of a live
+// database
+func SQLiteBlobLive(baseDir, dbOwner, dbName string, req JobRequestBlob) (data []byte, httpStatus int, err error) {
+	sdb, release, err := liveReadConn(baseDir, dbOwner, dbName)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	defer release()
+
+	blob, httpStatus, err := openBlob(sdb, req)
+	if err != nil {
+		return
+	}
+	defer blob.Close()
+	size, err := blob.Size()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if size > LiveBlobMaxSize {
+		return nil, http.StatusBadRequest, fmt.Errorf("The value is too large to return from a live database.  The "+
+			"limit is %d MB", LiveBlobMaxSize/1024/1024)
+	}
+	data, err = io.ReadAll(blob)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return data, http.StatusOK, nil
+}
+
+// openBlob opens a reader for the value of a BLOB or TEXT cell, after checking the cell exists and holds one of those
+func openBlob(sdb *sqlite.Conn, req JobRequestBlob) (blob *sqlite.BlobReader, httpStatus int, err error) {
+	var found bool
+	err = sdb.OneValue("SELECT count(*) > 0 FROM main.sqlite_master AS m, pragma_table_info(m.name) AS p "+
+		"WHERE m.type = 'table' AND m.name = ? AND p.name = ?", &found, req.Table, req.Column)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if !found {
+		return nil, http.StatusNotFound, errors.New("That table or column doesn't exist in the database")
+	}
+
+	// Tables without a rowid have their rows stored differently, so their values can't be read a piece at a time
+	var withoutRowID bool
+	err = sdb.OneValue("SELECT count(*) > 0 FROM pragma_table_list WHERE schema = 'main' AND name = ? AND wr = 1",
+		&withoutRowID, req.Table)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if withoutRowID {
+		return nil, http.StatusBadRequest, errors.New("Values can't be streamed from WITHOUT ROWID tables")
+	}
+
+	var valueType string
+	err = sdb.OneValue(fmt.Sprintf("SELECT typeof(%s) FROM main.%s WHERE rowid = ?", EscapeId(req.Column),
+		EscapeId(req.Table)), &valueType, req.RowID)
+	if err == io.EOF {
+		return nil, http.StatusNotFound, fmt.Errorf("Row %d doesn't exist in the table", req.RowID)
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if valueType == "null" {
+		return nil, http.StatusNotFound, errors.New("That cell is empty")
+	}
+	if valueType != "blob" && valueType != "text" {
+		return nil, http.StatusBadRequest, fmt.Errorf("That cell holds a value of type %s, not a BLOB or text", valueType)
+	}
+
+	blob, err = sdb.NewBlobReader("main", req.Table, req.Column, req.RowID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return blob, http.StatusOK, nil
+}
@@ -0,0 +1,81 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+)
+
+var (
+	// The storage used for the database files
+	blobStore BlobStore
+)
+
+// BlobStore is the interface to the storage used for the database files.  Minio, AWS S3, Google Cloud Storage, or a
+// directory on the local filesystem can be used, depending on the configuration.  The files are stored in buckets,
+// which the drivers for the cloud providers map onto a prefix inside a single configured bucket
+type BlobStore interface {
+	// BucketExists returns whether a bucket exists
+	BucketExists(bucket string) (bool, error)
+
+	// Get returns a handle for reading a stored object
+	Get(bucket, id string) (BlobObject, error)
+
+	// Put stores an object of the given size, creating its bucket first if needed.  It returns the number of bytes
+	// stored
+	Put(bucket, id string, r io.Reader, size int64) (int64, error)
+
+	// Remove deletes a stored object
+	Remove(bucket, id string) error
+}
+
+// BlobObject is a handle for reading a stored object.  It's seekable, so parts of the object can be read without
+// retrieving the rest of it
+type BlobObject interface {
+	io.ReadSeekCloser
+
+	// Size returns the size of the object in bytes
+	Size() (int64, error)
+}
+
+// ConnectBlobStore sets up the storage used for the database files, and checks it's working
+func ConnectBlobStore() (err error) {
+	switch config.Conf.Minio.Backend {
+	case "", "minio":
+		blobStore, err = newMinioBlobStore(config.Conf.Minio.Server, "", "")
+	case "s3":
+		blobStore, err = newMinioBlobStore(config.Conf.Minio.Server, config.Conf.Minio.Region, config.Conf.Minio.Bucket)
+	case "gcs":
+		// Google Cloud Storage is used through its S3 compatible API, with HMAC keys for the access key and secret
+		blobStore, err = newMinioBlobStore(config.Conf.Minio.Server, "", config.Conf.Minio.Bucket)
+	case "filesystem":
+		blobStore, err = newFilesystemBlobStore(config.Conf.Minio.Directory)
+	default:
+		return fmt.Errorf("%s: unknown storage backend '%s'", config.Conf.Live.Nodename, config.Conf.Minio.Backend)
+	}
+	if err != nil {
+		return fmt.Errorf("Problem with storage backend configuration: %v", err)
+	}
+	err = setupEncryption()
+	if err != nil {
+		return fmt.Errorf("Problem with encryption configuration: %v", err)
+	}
+
+	// Verify the connection is actually functional
+	// NOTE: We don't care about the bucket itself, more just that this function call returns without an error
+	_, err = blobStore.BucketExists("non-existing")
+	if err != nil {
+		return
+	}
+
+	// Log successful connection message for the storage backend
+	if config.Conf.Minio.Backend == "filesystem" {
+		log.Printf("%v: storage ok. Directory: %v", config.Conf.Live.Nodename, config.Conf.Minio.Directory)
+	} else {
+		log.Printf("%v: storage connection ok. Backend: %v, Address: %v", config.Conf.Live.Nodename,
+			config.Conf.Minio.Backend, config.Conf.Minio.Server)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package common
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// filesystemBlobStore is the BlobStore implementation for a directory on the local filesystem.  Each bucket is a
+// subdirectory, holding a file for each of its objects
+type filesystemBlobStore struct {
+	dir string
+}
+
+// newFilesystemBlobStore returns the BlobStore for a directory, creating it if it doesn't exist yet
+func newFilesystemBlobStore(dir string) (*filesystemBlobStore, error) {
+	if dir == "" {
+		return nil, errors.New("no directory given for the filesystem storage backend")
+	}
+	err := os.MkdirAll(dir, 0750)
+	if err != nil {
+		return nil, err
+	}
+	return &filesystemBlobStore{dir: dir}, nil
+}
+
+func (f *filesystemBlobStore) BucketExists(bucket string) (bool, error) {
+	p, err := f.path(bucket)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (f *filesystemBlobStore) Get(bucket, id string) (BlobObject, error) {
+	p, err := f.path(bucket, id)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	return &filesystemBlobObject{file}, nil
+}
+
+func (f *filesystemBlobStore) Put(bucket, id string, r io.Reader, size int64) (int64, error) {
+	p, err := f.path(bucket, id)
+	if err != nil {
+		return 0, err
+	}
+	err = os.MkdirAll(filepath.Dir(p), 0750)
+	if err != nil {
+		return 0, err
+	}
+
+	// Write the object to a temporary file first, so readers never see a partly written one
+	tmp, err := os.CreateTemp(filepath.Dir(p), filepath.Base(p)+".*.new")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	numBytes, err := io.Copy(tmp, io.LimitReader(r, size))
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return 0, err
+	}
+	return numBytes, os.Rename(tmp.Name(), p)
+}
+
+func (f *filesystemBlobStore) Remove(bucket, id string) error {
+	p, err := f.path(bucket, id)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
+
+// path returns the location on the filesystem of a bucket or object, making sure it's inside the storage directory
+func (f *filesystemBlobStore) path(parts ...string) (string, error) {
+	for _, p := range parts {
+		if p == "" || p == "." || p == ".." || filepath.Base(p) != p {
+			return "", errors.New("invalid bucket or object name")
+		}
+	}
+	return filepath.Join(append([]string{f.dir}, parts...)...), nil
+}
+
+// filesystemBlobObject is the BlobObject implementation for files on the local filesystem
+type filesystemBlobObject struct {
+	*os.File
+}
+
+func (o *filesystemBlobObject) Size() (int64, error) {
+	stat, err := o.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size(), nil
+}
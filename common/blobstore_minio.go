@@ -0,0 +1,92 @@
+package common
+
+import (
+	"io"
+	"path"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+
+	"github.com/minio/minio-go"
+)
+
+// minioBlobStore is the BlobStore implementation for Minio and the S3 compatible cloud storage services
+type minioBlobStore struct {
+	client *minio.Client
+
+	// When set, all the objects are stored in this bucket, with the name of their own bucket as a prefix.  Bucket names
+	// are global on the cloud storage services, so the buckets can't be created directly there
+	bucket string
+	region string
+}
+
+// newMinioBlobStore returns the BlobStore for a Minio or S3 compatible server
+func newMinioBlobStore(server, region, bucket string) (*minioBlobStore, error) {
+	client, err := minio.NewWithRegion(server, config.Conf.Minio.AccessKey, config.Conf.Minio.Secret,
+		config.Conf.Minio.HTTPS, region)
+	if err != nil {
+		return nil, err
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &minioBlobStore{client: client, bucket: bucket, region: region}, nil
+}
+
+func (m *minioBlobStore) BucketExists(bucket string) (bool, error) {
+	if m.bucket != "" {
+		return m.client.BucketExists(m.bucket)
+	}
+	return m.client.BucketExists(bucket)
+}
+
+func (m *minioBlobStore) Get(bucket, id string) (BlobObject, error) {
+	bucket, id = m.location(bucket, id)
+	obj, err := m.client.GetObject(bucket, id, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &minioBlobObject{obj}, nil
+}
+
+func (m *minioBlobStore) Put(bucket, id string, r io.Reader, size int64) (int64, error) {
+	bucket, id = m.location(bucket, id)
+
+	// If a bucket with the desired name doesn't already exist, create it
+	found, err := m.client.BucketExists(bucket)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		err = m.client.MakeBucket(bucket, m.region)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return m.client.PutObject(bucket, id, r, size, minio.PutObjectOptions{ContentType: "application/x-sqlite3"})
+}
+
+func (m *minioBlobStore) Remove(bucket, id string) error {
+	bucket, id = m.location(bucket, id)
+	return m.client.RemoveObject(bucket, id)
+}
+
+// location returns the bucket and object name used on the server for an object
+func (m *minioBlobStore) location(bucket, id string) (string, string) {
+	if m.bucket != "" {
+		return m.bucket, path.Join(bucket, id)
+	}
+	return bucket, id
+}
+
+// minioBlobObject is the BlobObject implementation for Minio objects
+type minioBlobObject struct {
+	*minio.Object
+}
+
+func (o *minioBlobObject) Size() (int64, error) {
+	stat, err := o.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return stat.Size, nil
+}
@@ -0,0 +1,287 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// DeleteBranches deletes branches of a database, along with the commits which are only part of them.  None of the
+// branches can be the default branch, and the commits only part of them can't have tags or releases, as those would
+// be left with no way to reach them.  The returned status is the HTTP status code matching the error
+func DeleteBranches(loggedInUser, dbOwner, dbName string, names []string) (httpStatus int, err error) {
+	branchList, err := database.GetBranches(dbOwner, dbName)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defBranch, err := database.GetDefaultBranchName(dbOwner, dbName)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	deleting := make(map[string]bool)
+	for _, n := range names {
+		if _, ok := branchList[n]; !ok {
+			return http.StatusBadRequest, fmt.Errorf("Unknown branch '%s'", n)
+		}
+		if n == defBranch {
+			return http.StatusConflict, fmt.Errorf("The default branch '%s' can't be deleted", n)
+		}
+		deleting[n] = true
+	}
+	if len(deleting) == 0 {
+		return http.StatusBadRequest, fmt.Errorf("No branches given")
+	}
+
+	// Work out which commits are only part of the branches being deleted
+	commitList, err := database.GetCommitList(dbOwner, dbName)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	kept := make(map[string]bool)
+	for bName, bEntry := range branchList {
+		if !deleting[bName] {
+			branchCommits(commitList, bEntry.Commit, kept)
+		}
+	}
+	lst := make(map[string]bool)
+	for bName := range deleting {
+		branchCommits(commitList, branchList[bName].Commit, lst)
+	}
+	for cid := range kept {
+		delete(lst, cid)
+	}
+
+	// Make sure that deleting the branches wouldn't result in any isolated tags or releases
+	target := "this branch"
+	if len(deleting) > 1 {
+		target = "these branches"
+	}
+	tags, err := database.GetTags(dbOwner, dbName)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	var isolated []string
+	for tName, tEntry := range tags {
+		if lst[tEntry.Commit] {
+			isolated = append(isolated, tName)
+		}
+	}
+	if len(isolated) > 0 {
+		sort.Strings(isolated)
+		return http.StatusConflict, fmt.Errorf("You need to delete the %s '%s' before you can delete %s",
+			plural(len(isolated), "tag", "tags"), strings.Join(isolated, ", "), target)
+	}
+	rels, err := database.GetReleases(dbOwner, dbName)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	for rName, rEntry := range rels {
+		if lst[rEntry.Commit] {
+			isolated = append(isolated, rName)
+		}
+	}
+	if len(isolated) > 0 {
+		sort.Strings(isolated)
+		return http.StatusConflict, fmt.Errorf("You need to delete the %s '%s' before you can delete %s",
+			plural(len(isolated), "release", "releases"), strings.Join(isolated, ", "), target)
+	}
+
+	// Delete the branches, and anything attached to them
+	for bName := range deleting {
+		delete(branchList, bName)
+	}
+	err = database.StoreBranches(dbOwner, dbName, branchList)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	for bName := range deleting {
+		err = database.BranchSchemaPolicySet(dbOwner, dbName, bName, "")
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+	err = database.StaleBranchesRemove(dbOwner, dbName, names)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	// Delete the left over commits
+	// TODO: We may want to consider clearing any memcache entries for the deleted commits too
+	for cid := range lst {
+		delete(commitList, cid)
+	}
+	err = database.StoreCommits(dbOwner, dbName, commitList)
+	if err != nil {
+		log.Printf("Error when updating commit list while deleting branches of database '%s/%s': %s",
+			SanitiseLogString(dbOwner), SanitiseLogString(dbName), err.Error())
+		return http.StatusInternalServerError, err
+	}
+
+	// Invalidate the memcache data for the database, so the new branch count gets picked up
+	err = InvalidateCacheEntry(loggedInUser, dbOwner, dbName, "") // Empty string indicates "for all versions"
+	if err != nil {
+		// Something went wrong when invalidating memcached entries for the database
+		log.Printf("Error when invalidating memcache entries: %s", err.Error())
+	}
+	return http.StatusOK, nil
+}
+
+// FindStaleBranches returns the branches of a database which are stale.  These are branches other than the default
+// one, whose head commit is older than the configured age, and is part of the history of another branch
+func FindStaleBranches(dbOwner, dbName string) (stale []database.StaleBranch, err error) {
+	branchList, err := database.GetBranches(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	defBranch, err := database.GetDefaultBranchName(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	commitList, err := database.GetCommitList(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+
+	// Check the default branch first, so it's the one reported when a branch was merged into several
+	var others []string
+	for bName := range branchList {
+		if bName != defBranch {
+			others = append(others, bName)
+		}
+	}
+	sort.Strings(others)
+	order := append([]string{defBranch}, others...)
+
+	cutoff := time.Now().AddDate(0, 0, -config.Conf.Branch.StaleAge)
+	histories := make(map[string]map[string]bool)
+	for _, bName := range others {
+		head, ok := commitList[branchList[bName].Commit]
+		if !ok || head.Timestamp.After(cutoff) {
+			continue
+		}
+		for _, o := range order {
+			if o == bName {
+				continue
+			}
+			if histories[o] == nil {
+				histories[o] = make(map[string]bool)
+				branchCommits(commitList, branchList[o].Commit, histories[o])
+			}
+			if histories[o][head.ID] {
+				stale = append(stale, database.StaleBranch{
+					Branch:     bName,
+					Commit:     head.ID,
+					LastCommit: head.Timestamp,
+					MergedInto: o,
+				})
+				break
+			}
+		}
+	}
+	return
+}
+
+// StaleBranches returns the branches of a database flagged as stale by the last check, leaving out any which have
+// been changed since
+func StaleBranches(dbOwner, dbName string) (stale []database.StaleBranch, err error) {
+	flagged, err := database.StaleBranches(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	branchList, err := database.GetBranches(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	stale = []database.StaleBranch{}
+	for _, b := range flagged {
+		if z, ok := branchList[b.Branch]; ok && z.Commit == b.Commit {
+			stale = append(stale, b)
+		}
+	}
+	return
+}
+
+// StaleBranchLoop periodically flags the stale branches of each database, so their owners can clean them up.  When
+// several nodes are running, only one of them does it.  When ctx is cancelled the database being checked is finished
+// off, then wg is marked as done
+func StaleBranchLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// Ensure a warning message is displayed on the console if the stale branch loop exits other than by shutting down
+	defer func() {
+		if ctx.Err() != nil {
+			log.Printf("%s: stale branch loop stopped", config.Conf.Live.Nodename)
+			return
+		}
+		log.Printf("%s: WARN: Stale branch loop exited", config.Conf.Live.Nodename)
+	}()
+
+	leader := database.NewLeader("stale branches")
+	defer leader.Resign()
+
+	interval := config.Conf.Branch.StaleInterval * time.Hour
+	log.Printf("%s: stale branch loop started.  %v refresh.", config.Conf.Live.Nodename, interval)
+	for {
+		if leader.IsLeader() {
+			list, err := database.StaleBranchDatabases()
+			if err != nil {
+				log.Printf("Error when retrieving the databases to check for stale branches: %v", err)
+			}
+			for _, d := range list {
+				if ctx.Err() != nil {
+					break
+				}
+				stale, err := FindStaleBranches(d.Owner, d.DBName)
+				if err != nil {
+					log.Printf("Error when checking '%s/%s' for stale branches: %v", d.Owner, d.DBName, err)
+					continue
+				}
+				err = database.StaleBranchesSave(d.Owner, d.DBName, stale)
+				if err != nil {
+					log.Printf("Error when saving the stale branches of '%s/%s': %v", d.Owner, d.DBName, err)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// branchCommits adds the commits in the history of a branch head to a set, following the parents of merge commits
+// too.  Commits already in the set aren't followed again
+func branchCommits(commitList map[string]database.CommitEntry, head string, set map[string]bool) {
+	pending := []string{head}
+	for len(pending) > 0 {
+		id := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if id == "" || set[id] {
+			continue
+		}
+		c, ok := commitList[id]
+		if !ok {
+			continue
+		}
+		set[id] = true
+		pending = append(pending, c.Parent)
+		pending = append(pending, c.OtherParents...)
+	}
+}
+
+// plural returns the singular or plural form of a word, depending on the count
+func plural(n int, singular, plural string) string {
+	if n == 1 {
+		return singular
+	}
+	return plural
+}
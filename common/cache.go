@@ -0,0 +1,74 @@
+package common
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// ErrCacheMiss is returned by the cache when the requested item isn't cached
+var ErrCacheMiss = memcache.ErrCacheMiss
+
+// Cache is the interface to the server used for caching.  Either Memcached or Redis can be used, depending on the
+// configuration
+type Cache interface {
+	// Delete removes an item from the cache.  Items which aren't cached aren't an error
+	Delete(key string) error
+
+	// FlushAll removes all the items from the cache
+	FlushAll() error
+
+	// Get returns the value of an item, or ErrCacheMiss if it isn't cached
+	Get(key string) ([]byte, error)
+
+	// Increment adds delta to the numeric value of an item and returns the new value, or ErrCacheMiss if the item
+	// isn't cached
+	Increment(key string, delta uint64) (uint64, error)
+
+	// Set stores an item, which expires after the given number of seconds.  An expiration of 0 means it doesn't expire
+	Set(key string, value []byte, expiration int) error
+}
+
+// ConnectCache connects to the cache server
+func ConnectCache() (err error) {
+	switch config.Conf.Memcache.Backend {
+	case "", "memcached":
+		cache, err = newMemcachedCache(config.Conf.Memcache.Server)
+	case "redis":
+		cache, err = newRedisCache(config.Conf.Redis)
+	default:
+		return fmt.Errorf("%s: unknown cache backend '%s'", config.Conf.Live.Nodename, config.Conf.Memcache.Backend)
+	}
+	if err != nil {
+		return
+	}
+
+	// Test the cache connection
+	err = cache.Set("connecttext", []byte("1"), 10)
+	if err != nil {
+		return fmt.Errorf("%s: couldn't connect to cache server: %s", config.Conf.Live.Nodename, err)
+	}
+
+	// Log successful connection message for the cache
+	if config.Conf.Memcache.Backend == "redis" {
+		log.Printf("%v: connected to Redis: %v", config.Conf.Live.Nodename, config.Conf.Redis.Server)
+	} else {
+		log.Printf("%v: connected to Memcached: %v", config.Conf.Live.Nodename, config.Conf.Memcache.Server)
+	}
+	return nil
+}
+
+// SessionCache stores the sessions of the web and API servers in the cache, whichever backend it's using
+type SessionCache struct{}
+
+func (SessionCache) Get(key string) (val string, flags uint32, cas uint64, err error) {
+	v, err := cache.Get(key)
+	return string(v), 0, 0, err
+}
+
+func (SessionCache) Set(key, val string, flags, exp uint32, ocas uint64) (cas uint64, err error) {
+	return ocas, cache.Set(key, []byte(val), int(exp))
+}
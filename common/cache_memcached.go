@@ -0,0 +1,65 @@
+package common
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// memcachedCache is the Cache implementation for Memcached
+type memcachedCache struct {
+	client *memcache.Client
+}
+
+// newMemcachedCache returns the Cache for a Memcached server
+func newMemcachedCache(server string) (*memcachedCache, error) {
+	client := memcache.New(server)
+	if config.Conf.Environment.Environment == "production" {
+		serverName, _, _ := strings.Cut(server, ":")
+		client.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			var td tls.Dialer
+			td.Config = &tls.Config{
+				// This REQUIRES the memcached server to be configured with the full cert chain, not just it's own cert
+				ServerName: serverName,
+			}
+			return td.DialContext(context.Background(), network, addr)
+		}
+	}
+	return &memcachedCache{client: client}, nil
+}
+
+func (m *memcachedCache) Delete(key string) error {
+	err := m.client.Delete(key)
+
+	// We don't care about cache misses
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return nil
+	}
+	return err
+}
+
+func (m *memcachedCache) FlushAll() error {
+	return m.client.FlushAll()
+}
+
+func (m *memcachedCache) Get(key string) ([]byte, error) {
+	item, err := m.client.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return item.Value, nil
+}
+
+func (m *memcachedCache) Increment(key string, delta uint64) (uint64, error) {
+	return m.client.Increment(key, delta)
+}
+
+func (m *memcachedCache) Set(key string, value []byte, expiration int) error {
+	return m.client.Set(&memcache.Item{Key: key, Value: value, Expiration: int32(expiration)})
+}
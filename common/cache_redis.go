@@ -0,0 +1,69 @@
+package common
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis doesn't have a command for only incrementing existing keys, which is how Memcached behaves
+var redisIncrementExisting = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+	return redis.call('INCRBY', KEYS[1], ARGV[1])
+end
+return false`)
+
+// redisCache is the Cache implementation for Redis
+type redisCache struct {
+	client *redis.Client
+}
+
+// newRedisCache returns the Cache for a Redis server
+func newRedisCache(conf config.RedisConfig) (*redisCache, error) {
+	opts := redis.Options{
+		Addr:     conf.Server,
+		DB:       conf.Database,
+		Password: conf.Password,
+		Username: conf.Username,
+	}
+	if config.Conf.Environment.Environment == "production" {
+		serverName, _, _ := strings.Cut(conf.Server, ":")
+		opts.TLSConfig = &tls.Config{ServerName: serverName}
+	}
+	return &redisCache{client: redis.NewClient(&opts)}, nil
+}
+
+func (r *redisCache) Delete(key string) error {
+	return r.client.Del(context.Background(), key).Err()
+}
+
+func (r *redisCache) FlushAll() error {
+	// Only the database used by DBHub.io is cleared, as the Redis server may be shared with other things
+	return r.client.FlushDB(context.Background()).Err()
+}
+
+func (r *redisCache) Get(key string) ([]byte, error) {
+	value, err := r.client.Get(context.Background(), key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrCacheMiss
+	}
+	return value, err
+}
+
+func (r *redisCache) Increment(key string, delta uint64) (uint64, error) {
+	n, err := redisIncrementExisting.Run(context.Background(), r.client, []string{key}, delta).Uint64()
+	if errors.Is(err, redis.Nil) {
+		return 0, ErrCacheMiss
+	}
+	return n, err
+}
+
+func (r *redisCache) Set(key string, value []byte, expiration int) error {
+	return r.client.Set(context.Background(), key, value, time.Duration(expiration)*time.Second).Err()
+}
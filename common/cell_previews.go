@@ -0,0 +1,345 @@
+package common
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"math"
+)
+
+// CellPreviewThumbnailSize is the largest width or height of the thumbnails made of images stored in cells
+const CellPreviewThumbnailSize = 128
+
+// cellPreviewMaxPixels is the largest image, in pixels, which thumbnails are made of.  Larger ones would take too much
+// memory and time to decode just for a preview
+const cellPreviewMaxPixels = 16 * 1024 * 1024
+
+// The geometry classes of SpatiaLite, without the Z, M, and ZM variations
+const (
+	spatialitePoint = iota + 1
+	spatialiteLineString
+	spatialitePolygon
+	spatialiteMultiPoint
+	spatialiteMultiLineString
+	spatialiteMultiPolygon
+	spatialiteGeometryCollection
+)
+
+// CellPreview holds rendered previews of a binary cell value.  Images get a thumbnail, as a data URI which can be used
+// straight away as the source of an image, and SpatiaLite geometries are converted to GeoJSON
+type CellPreview struct {
+	GeoJSON   json.RawMessage `json:"geojson,omitempty"`
+	Thumbnail string          `json:"thumbnail,omitempty"`
+}
+
+// AddCellPreviews adds previews to the binary values of a record set which hold images or SpatiaLite geometries.  The
+// values need to have been read for the API, so they're base64 encoded.  Values which can't be previewed are left as is
+func AddCellPreviews(rs *SQLiteRecordSet) {
+	for _, row := range rs.Records {
+		for i, v := range row {
+			if v.Type != Binary {
+				continue
+			}
+			s, ok := v.Value.(string)
+			if !ok {
+				continue
+			}
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				continue
+			}
+			if geo, err := spatialiteGeoJSON(b); err == nil {
+				row[i].Preview = &CellPreview{GeoJSON: geo}
+			} else if thumb, err := imageThumbnail(b); err == nil {
+				row[i].Preview = &CellPreview{Thumbnail: thumb}
+			}
+		}
+	}
+}
+
+// imageThumbnail returns a small copy of a PNG, JPEG, or GIF image as a data URI.  JPEG images stay as JPEGs, while the
+// others become PNGs so any transparency is kept
+func imageThumbnail(b []byte) (thumb string, err error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > cellPreviewMaxPixels {
+		return "", errors.New("Image is too large to make a thumbnail of")
+	}
+	src, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return
+	}
+
+	// Work out the size of the thumbnail, keeping the aspect ratio of the image
+	w, h := cfg.Width, cfg.Height
+	if w > CellPreviewThumbnailSize || h > CellPreviewThumbnailSize {
+		if w >= h {
+			h = int(math.Max(1, math.Round(float64(h)*CellPreviewThumbnailSize/float64(w))))
+			w = CellPreviewThumbnailSize
+		} else {
+			w = int(math.Max(1, math.Round(float64(w)*CellPreviewThumbnailSize/float64(h))))
+			h = CellPreviewThumbnailSize
+		}
+	}
+
+	dst := scaleImage(src, src.Bounds(), w, h)
+
+	var buf bytes.Buffer
+	mimeType := "image/png"
+	if format == "jpeg" {
+		mimeType = "image/jpeg"
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80})
+	} else {
+		err = png.Encode(&buf, dst)
+	}
+	if err != nil {
+		return
+	}
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// scaleImage resizes an area of an image to the given width and height.  Each pixel of the result is the average of up
+// to 4x4 pixels spread across the part of the area it covers
+func scaleImage(src image.Image, area image.Rectangle, w, h int) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := area.Min.Y + y*area.Dy()/h
+		y1 := area.Min.Y + (y+1)*area.Dy()/h
+		if y1 == y0 {
+			// Enlarging, so several pixels of the result come from the same pixel of the image
+			y1++
+		}
+		for x := 0; x < w; x++ {
+			x0 := area.Min.X + x*area.Dx()/w
+			x1 := area.Min.X + (x+1)*area.Dx()/w
+			if x1 == x0 {
+				x1++
+			}
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy += int(math.Max(1, float64(y1-y0)/4)) {
+				for sx := x0; sx < x1; sx += int(math.Max(1, float64(x1-x0)/4)) {
+					c := color.NRGBA64Model.Convert(src.At(sx, sy)).(color.NRGBA64)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					bl += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			if n == 0 {
+				continue
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(bl / n >> 8),
+				A: uint8(a / n >> 8)})
+		}
+	}
+	return dst
+}
+
+// spatialiteReader reads the values of a SpatiaLite geometry blob in turn
+type spatialiteReader struct {
+	b     []byte
+	order binary.ByteOrder
+	pos   int
+}
+
+func (r *spatialiteReader) byte() (v byte, err error) {
+	if r.pos+1 > len(r.b) {
+		return 0, errors.New("Geometry ends too early")
+	}
+	v = r.b[r.pos]
+	r.pos++
+	return
+}
+
+func (r *spatialiteReader) int() (v int, err error) {
+	if r.pos+4 > len(r.b) {
+		return 0, errors.New("Geometry ends too early")
+	}
+	v = int(r.order.Uint32(r.b[r.pos:]))
+	r.pos += 4
+	return
+}
+
+func (r *spatialiteReader) double() (v float64, err error) {
+	if r.pos+8 > len(r.b) {
+		return 0, errors.New("Geometry ends too early")
+	}
+	v = math.Float64frombits(r.order.Uint64(r.b[r.pos:]))
+	r.pos += 8
+	return
+}
+
+// spatialiteGeoJSON converts a geometry stored in the SpatiaLite blob format to GeoJSON.  Compressed geometries aren't
+// supported.  When geometries have M values they're left out, as GeoJSON doesn't have them
+func spatialiteGeoJSON(b []byte) (geo json.RawMessage, err error) {
+	// The blob starts with a header holding the byte order, SRID, and bounding box, and ends with a marker byte
+	if len(b) < 44 || b[0] != 0x00 || b[38] != 0x7C || b[len(b)-1] != 0xFE {
+		return nil, errors.New("Not a SpatiaLite geometry")
+	}
+	r := spatialiteReader{b: b[:len(b)-1], pos: 39}
+	switch b[1] {
+	case 0x00:
+		r.order = binary.BigEndian
+	case 0x01:
+		r.order = binary.LittleEndian
+	default:
+		return nil, errors.New("Not a SpatiaLite geometry")
+	}
+	class, err := r.int()
+	if err != nil {
+		return
+	}
+	g, err := spatialiteGeometry(&r, class, 0)
+	if err != nil {
+		return
+	}
+	if r.pos != len(r.b) {
+		return nil, errors.New("Not a SpatiaLite geometry")
+	}
+	return json.Marshal(g)
+}
+
+// spatialiteGeometry reads the body of a SpatiaLite geometry of the given class, returning it as a GeoJSON geometry
+func spatialiteGeometry(r *spatialiteReader, class, depth int) (g map[string]interface{}, err error) {
+	// Geometry collections can't hold other collections, so there's no need to go further than that
+	if depth > 1 {
+		return nil, errors.New("Geometry is nested too deeply")
+	}
+
+	// The thousands of the class say which extra values each point has.  1 is Z, 2 is M, and 3 is both
+	dims := class / 1000
+	if dims > 3 {
+		return nil, errors.New("Compressed geometries aren't supported")
+	}
+	point := func() (p []float64, err error) {
+		x, err := r.double()
+		if err != nil {
+			return
+		}
+		y, err := r.double()
+		if err != nil {
+			return
+		}
+		p = []float64{x, y}
+		if dims == 1 || dims == 3 {
+			z, err := r.double()
+			if err != nil {
+				return nil, err
+			}
+			p = append(p, z)
+		}
+		if dims >= 2 {
+			if _, err = r.double(); err != nil {
+				return nil, err
+			}
+		}
+		return p, nil
+	}
+	points := func() (ps [][]float64, err error) {
+		n, err := r.int()
+		if err != nil {
+			return
+		}
+		if n > (len(r.b)-r.pos)/16 {
+			return nil, errors.New("Geometry ends too early")
+		}
+		ps = make([][]float64, 0, n)
+		for i := 0; i < n; i++ {
+			p, err := point()
+			if err != nil {
+				return nil, err
+			}
+			ps = append(ps, p)
+		}
+		return
+	}
+	rings := func() (rs [][][]float64, err error) {
+		n, err := r.int()
+		if err != nil {
+			return
+		}
+		if n > (len(r.b)-r.pos)/4 {
+			return nil, errors.New("Geometry ends too early")
+		}
+		rs = make([][][]float64, 0, n)
+		for i := 0; i < n; i++ {
+			ps, err := points()
+			if err != nil {
+				return nil, err
+			}
+			rs = append(rs, ps)
+		}
+		return
+	}
+
+	var coords interface{}
+	switch class % 1000 {
+	case spatialitePoint:
+		g = map[string]interface{}{"type": "Point"}
+		coords, err = point()
+	case spatialiteLineString:
+		g = map[string]interface{}{"type": "LineString"}
+		coords, err = points()
+	case spatialitePolygon:
+		g = map[string]interface{}{"type": "Polygon"}
+		coords, err = rings()
+	case spatialiteMultiPoint, spatialiteMultiLineString, spatialiteMultiPolygon, spatialiteGeometryCollection:
+		// Each entity of a collection is marked, and holds its own class
+		var n int
+		n, err = r.int()
+		if err != nil {
+			return
+		}
+		if n > (len(r.b)-r.pos)/5 {
+			return nil, errors.New("Geometry ends too early")
+		}
+		var parts []map[string]interface{}
+		for i := 0; i < n; i++ {
+			var marker byte
+			if marker, err = r.byte(); err != nil {
+				return
+			}
+			if marker != 0x69 {
+				return nil, errors.New("Not a SpatiaLite geometry")
+			}
+			var partClass int
+			if partClass, err = r.int(); err != nil {
+				return
+			}
+			var part map[string]interface{}
+			if part, err = spatialiteGeometry(r, partClass, depth+1); err != nil {
+				return
+			}
+			parts = append(parts, part)
+		}
+		if class%1000 == spatialiteGeometryCollection {
+			if parts == nil {
+				parts = []map[string]interface{}{}
+			}
+			return map[string]interface{}{"type": "GeometryCollection", "geometries": parts}, nil
+		}
+		multi := []interface{}{}
+		for _, p := range parts {
+			multi = append(multi, p["coordinates"])
+		}
+		g = map[string]interface{}{"type": []string{"MultiPoint", "MultiLineString", "MultiPolygon"}[class%1000-spatialiteMultiPoint]}
+		coords = multi
+	default:
+		return nil, errors.New("Unknown geometry class")
+	}
+	if err != nil {
+		return nil, err
+	}
+	g["coordinates"] = coords
+	return g, nil
+}
@@ -0,0 +1,223 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// The SPDX identifiers of the default licences, for citation formats which identify licences that way
+var spdxLicences = map[string]string{
+	"CC0":           "CC0-1.0",
+	"CC-BY-4.0":     "CC-BY-4.0",
+	"CC-BY-SA-4.0":  "CC-BY-SA-4.0",
+	"CC-BY-NC-4.0":  "CC-BY-NC-4.0",
+	"CC-BY-IGO-3.0": "CC-BY-3.0-IGO",
+	"ODbL-1.0":      "ODbL-1.0",
+	"UK-OGL-3":      "OGL-UK-3.0",
+}
+
+// DataCiteDOI is the metadata of a DOI, in the JSON format used by the DataCite REST API
+type DataCiteDOI struct {
+	Data struct {
+		Attributes DataCiteAttributes `json:"attributes"`
+		ID         string             `json:"id,omitempty"`
+		Type       string             `json:"type"`
+	} `json:"data"`
+}
+
+// DataCiteAttributes holds the DataCite metadata properties of a DOI
+type DataCiteAttributes struct {
+	Creators        []DataCiteName        `json:"creators"`
+	Dates           []DataCiteDate        `json:"dates"`
+	Descriptions    []DataCiteDescription `json:"descriptions,omitempty"`
+	DOI             string                `json:"doi,omitempty"`
+	Event           string                `json:"event,omitempty"`
+	Formats         []string              `json:"formats"`
+	Prefix          string                `json:"prefix,omitempty"`
+	PublicationYear int                   `json:"publicationYear"`
+	Publisher       string                `json:"publisher"`
+	RightsList      []DataCiteRights      `json:"rightsList,omitempty"`
+	SchemaVersion   string                `json:"schemaVersion"`
+	Sizes           []string              `json:"sizes"`
+	Titles          []DataCiteTitle       `json:"titles"`
+	Types           DataCiteTypes         `json:"types"`
+	URL             string                `json:"url"`
+	Version         string                `json:"version"`
+}
+
+type DataCiteDate struct {
+	Date     string `json:"date"`
+	DateType string `json:"dateType"`
+}
+
+type DataCiteDescription struct {
+	Description     string `json:"description"`
+	DescriptionType string `json:"descriptionType"`
+}
+
+type DataCiteName struct {
+	Name string `json:"name"`
+}
+
+type DataCiteRights struct {
+	Rights                 string `json:"rights"`
+	RightsIdentifier       string `json:"rightsIdentifier,omitempty"`
+	RightsIdentifierScheme string `json:"rightsIdentifierScheme,omitempty"`
+	RightsURI              string `json:"rightsUri,omitempty"`
+}
+
+type DataCiteTitle struct {
+	Title string `json:"title"`
+}
+
+type DataCiteTypes struct {
+	ResourceType        string `json:"resourceType"`
+	ResourceTypeGeneral string `json:"resourceTypeGeneral"`
+}
+
+// CFF returns the citation in the Citation File Format, as used for CITATION.cff files
+func (c ReleaseCitation) CFF() string {
+	// JSON strings are valid YAML double quoted strings, so they're used for quoting the values
+	q := func(s string) string {
+		b, _ := json.Marshal(s)
+		return string(b)
+	}
+	var b strings.Builder
+	b.WriteString("cff-version: 1.2.0\n")
+	b.WriteString("message: \"If you use this dataset, please cite it using the metadata from this file.\"\n")
+	b.WriteString("type: dataset\n")
+	fmt.Fprintf(&b, "title: %s\n", q(c.Title))
+	b.WriteString("authors:\n")
+	for _, a := range c.Authors {
+		fmt.Fprintf(&b, "  - name: %s\n", q(a))
+	}
+	fmt.Fprintf(&b, "version: %s\n", q(c.Release))
+	fmt.Fprintf(&b, "date-released: %s\n", c.DateReleased.UTC().Format("2006-01-02"))
+	if c.DOI != "" {
+		fmt.Fprintf(&b, "doi: %s\n", q(c.DOI))
+	}
+	fmt.Fprintf(&b, "url: %s\n", q(c.URL))
+	fmt.Fprintf(&b, "commit: %s\n", q(c.Commit))
+	if spdx, ok := spdxLicences[c.Licence]; ok {
+		fmt.Fprintf(&b, "license: %s\n", q(spdx))
+	}
+	if c.Description != "" {
+		fmt.Fprintf(&b, "abstract: %s\n", q(c.Description))
+	}
+	return b.String()
+}
+
+// DataCite returns the citation as DataCite metadata
+func (c ReleaseCitation) DataCite() (d DataCiteDOI) {
+	d.Data.Type = "dois"
+	d.Data.ID = c.DOI
+	a := &d.Data.Attributes
+	for _, n := range c.Authors {
+		a.Creators = append(a.Creators, DataCiteName{Name: n})
+	}
+	a.Dates = []DataCiteDate{{Date: c.DateReleased.UTC().Format("2006-01-02"), DateType: "Issued"}}
+	if c.Description != "" {
+		a.Descriptions = []DataCiteDescription{{Description: c.Description, DescriptionType: "Abstract"}}
+	}
+	a.DOI = c.DOI
+	a.Formats = []string{"application/vnd.sqlite3"}
+	a.PublicationYear = c.DateReleased.UTC().Year()
+	a.Publisher = c.Publisher
+	if c.Licence != "" && c.Licence != "Not specified" {
+		r := DataCiteRights{Rights: c.Licence, RightsURI: c.LicenceURL}
+		if spdx, ok := spdxLicences[c.Licence]; ok {
+			r.RightsIdentifier = spdx
+			r.RightsIdentifierScheme = "SPDX"
+		}
+		a.RightsList = []DataCiteRights{r}
+	}
+	a.SchemaVersion = "http://datacite.org/schema/kernel-4"
+	a.Sizes = []string{fmt.Sprintf("%d bytes", c.Size)}
+	a.Titles = []DataCiteTitle{{Title: c.Title}}
+	a.Types = DataCiteTypes{ResourceType: "SQLite database", ResourceTypeGeneral: "Dataset"}
+	a.URL = c.URL
+	a.Version = c.Release
+	return
+}
+
+// GetReleaseCitation returns the details for citing a release of a database
+func GetReleaseCitation(loggedInUser, dbOwner, dbName, releaseName string) (cit ReleaseCitation, err error) {
+	cit, _, err = releaseCitation(loggedInUser, dbOwner, dbName, releaseName)
+	return
+}
+
+// releaseCitation returns the details for citing a release of a database, along with the details of the database
+func releaseCitation(loggedInUser, dbOwner, dbName, releaseName string) (cit ReleaseCitation, db database.SQLiteDBinfo, err error) {
+	err = database.DBDetails(&db, loggedInUser, dbOwner, dbName, "")
+	if err != nil {
+		return
+	}
+	if db.Info.IsLive {
+		err = errors.New("Live databases don't have releases")
+		return
+	}
+	releases, err := database.GetReleases(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	rel, ok := releases[releaseName]
+	if !ok {
+		err = fmt.Errorf("Unknown release: '%s'", releaseName)
+		return
+	}
+
+	// The licence is the one used by the release commit, which may differ from the current one
+	commitList, err := database.GetCommitList(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	c, ok := commitList[rel.Commit]
+	if !ok {
+		err = fmt.Errorf("Commit '%s' is missing from the commit list", rel.Commit)
+		return
+	}
+	var licURL string
+	licName := "Not specified"
+	if sha := c.Tree.Entries[0].LicenceSHA; sha != "" {
+		licName, licURL, err = database.GetLicenceInfoFromSha256(dbOwner, sha)
+		if err != nil {
+			return
+		}
+	}
+
+	// The database owner is the author of the dataset
+	usr, err := database.User(dbOwner)
+	if err != nil {
+		return
+	}
+	author := usr.DisplayName
+	if author == "" {
+		author = usr.Username
+	}
+
+	cit = ReleaseCitation{
+		Authors:      []string{author},
+		Commit:       rel.Commit,
+		DateReleased: rel.Date,
+		Description:  rel.Description,
+		DOI:          rel.DOI,
+		Licence:      licName,
+		LicenceURL:   licURL,
+		Publisher:    config.Conf.DOI.Publisher,
+		Release:      releaseName,
+		Size:         rel.Size,
+		Title:        dbName,
+		URL: fmt.Sprintf("https://%s/%s/%s?release=%s", config.Conf.Web.ServerName, url.PathEscape(dbOwner),
+			url.PathEscape(dbName), url.QueryEscape(releaseName)),
+	}
+	if cit.Description == "" {
+		cit.Description = db.Info.OneLineDesc
+	}
+	return
+}
@@ -0,0 +1,538 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	sqlite "github.com/gwenn/gosqlite"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// ErrCKAN is returned when a CKAN catalog can't be used, or rejects a request
+var ErrCKAN = errors.New("CKAN request failed")
+
+// ckanClient is the HTTP client used for talking to CKAN catalogs.  Harvesting downloads whole resources, so the
+// timeout is generous
+var ckanClient = &http.Client{Timeout: 5 * time.Minute}
+
+// ckanDataset holds the fields of a CKAN dataset which are used when publishing and harvesting
+type ckanDataset struct {
+	ID               string         `json:"id,omitempty"`
+	LicenseID        string         `json:"license_id,omitempty"`
+	MetadataModified string         `json:"metadata_modified,omitempty"`
+	Name             string         `json:"name"`
+	Notes            string         `json:"notes,omitempty"`
+	OwnerOrg         string         `json:"owner_org,omitempty"`
+	Resources        []ckanResource `json:"resources"`
+	Title            string         `json:"title,omitempty"`
+	URL              string         `json:"url,omitempty"`
+	Version          string         `json:"version,omitempty"`
+}
+
+// ckanResource is a file of a CKAN dataset
+type ckanResource struct {
+	Format string `json:"format"`
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+}
+
+// CKANEnabled returns whether databases can be connected to CKAN catalogs on this server
+func CKANEnabled() bool {
+	return len(config.Conf.CKAN.Instances) > 0
+}
+
+// CKANInstance returns the configured base URL of a CKAN catalog, given its URL.  Only the catalogs listed in the server
+// configuration can be used, so the server doesn't send requests anywhere users ask it to
+func CKANInstance(u string) (string, error) {
+	u = strings.TrimSuffix(strings.TrimSpace(u), "/")
+	for _, inst := range config.Conf.CKAN.Instances {
+		if strings.EqualFold(strings.TrimSuffix(inst, "/"), u) {
+			return strings.TrimSuffix(inst, "/"), nil
+		}
+	}
+	return "", fmt.Errorf("%w: '%s' isn't one of the CKAN catalogs this server can connect to", ErrCKAN, u)
+}
+
+// CKANHarvest creates a new database from the CSV resources of a CKAN dataset, with a table for each of them.  When
+// keepUpdated is set, the database is connected to the dataset and gets a new commit whenever the dataset changes.  The
+// sha256 of the new database file is returned along with the commit ID, for logging the upload
+func CKANHarvest(loggedInUser, ckanURL, token, dataset, dbName string, accessType database.SetAccessType, keepUpdated bool) (commitID, sha string, err error) {
+	base, err := CKANInstance(ckanURL)
+	if err != nil {
+		return
+	}
+	maxSize, err := database.MaxUploadSizeForUser(loggedInUser)
+	if err != nil {
+		return
+	}
+	tempDB, ds, err := ckanHarvestDataset(base, token, dataset, maxSize)
+	if err != nil {
+		return
+	}
+	defer os.Remove(tempDB.Name())
+	defer tempDB.Close()
+
+	// Use the licence of the dataset when it's one we know about
+	licenceName, err := ckanLicence(loggedInUser, ds.LicenseID)
+	if err != nil {
+		return
+	}
+
+	commitID, sha, err = ckanHarvestCommit(loggedInUser, dbName, true, "main", "", accessType, licenceName, base, ds,
+		tempDB)
+	if err != nil {
+		return
+	}
+
+	if keepUpdated {
+		err = database.CKANIntegrationSave(database.CKANIntegration{
+			APIToken:      token,
+			DBName:        dbName,
+			DBOwner:       loggedInUser,
+			Dataset:       ds.Name,
+			Mode:          "harvest",
+			SyncedVersion: ds.MetadataModified,
+			URL:           base,
+		})
+		if err != nil {
+			return
+		}
+		err = database.CKANIntegrationSynced(loggedInUser, dbName, ds.MetadataModified, "")
+	}
+	return
+}
+
+// CKANSync brings a database and its CKAN dataset up to date.  In "publish" mode the latest release of the database is
+// published to the dataset if it hasn't been already, and in "harvest" mode a new commit is added to the default branch
+// of the database if the dataset has changed since it was last harvested.  The outcome is recorded with the integration
+func CKANSync(integ database.CKANIntegration) (err error) {
+	var version string
+	switch integ.Mode {
+	case "publish":
+		version, err = ckanSyncPublish(integ)
+	case "harvest":
+		version, err = ckanSyncHarvest(integ)
+	default:
+		err = fmt.Errorf("Unknown CKAN integration mode '%s'", integ.Mode)
+	}
+	if version == "" && err == nil {
+		// Nothing has changed
+		return
+	}
+	var msg string
+	if err != nil {
+		msg = err.Error()
+		log.Printf("Syncing '%s/%s' with CKAN dataset '%s' failed: %v", integ.DBOwner,
+			SanitiseLogString(integ.DBName), SanitiseLogString(integ.Dataset), err)
+	}
+	if e := database.CKANIntegrationSynced(integ.DBOwner, integ.DBName, version, msg); e != nil && err == nil {
+		err = e
+	}
+	return
+}
+
+// CKANSyncLoop periodically syncs the databases connected to CKAN catalogs.  When several nodes are running, only one
+// of them does it, so releases don't get published twice.  When ctx is cancelled the dataset being synced is finished
+// off, then wg is marked as done
+func CKANSyncLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// If no CKAN catalogs have been configured, there's nothing to sync with
+	if !CKANEnabled() {
+		log.Printf("%s: CKAN sync is disabled, as no CKAN catalogs are configured", config.Conf.Live.Nodename)
+		return
+	}
+
+	// Ensure a warning message is displayed on the console if the sync loop exits other than by shutting down
+	defer func() {
+		if ctx.Err() != nil {
+			log.Printf("%s: CKAN sync loop stopped", config.Conf.Live.Nodename)
+			return
+		}
+		log.Printf("%s: WARN: CKAN sync loop exited", config.Conf.Live.Nodename)
+	}()
+
+	leader := database.NewLeader("ckan sync")
+	defer leader.Resign()
+
+	interval := config.Conf.CKAN.SyncInterval * time.Minute
+	log.Printf("%s: CKAN sync loop started.  %v refresh.", config.Conf.Live.Nodename, interval)
+	for {
+		if leader.IsLeader() {
+			list, err := database.CKANIntegrations()
+			if err != nil {
+				log.Printf("Error when retrieving the CKAN integrations: %v", err)
+			}
+			for _, integ := range list {
+				if ctx.Err() != nil {
+					break
+				}
+
+				// Errors are recorded with each integration, for their owners to see
+				_ = CKANSync(integ)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// ckanAction calls an action of the CKAN API, decoding its result into result
+func ckanAction(base, token, action string, params, result interface{}) error {
+	payload, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequest(http.MethodPost, base+"/api/3/action/"+action, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		r.Header.Set("Authorization", token)
+	}
+	res, err := ckanClient.Do(r)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCKAN, err)
+	}
+	defer res.Body.Close()
+
+	// CKAN returns its errors in the same envelope as its results, along with a matching status code
+	var resp struct {
+		Error *struct {
+			Message string `json:"message"`
+			Type    string `json:"__type"`
+		} `json:"error"`
+		Result  json.RawMessage `json:"result"`
+		Success bool            `json:"success"`
+	}
+	err = json.NewDecoder(io.LimitReader(res.Body, 10*1024*1024)).Decode(&resp)
+	if err != nil {
+		return fmt.Errorf("%w: %s returned status %d", ErrCKAN, r.URL.Host, res.StatusCode)
+	}
+	if !resp.Success {
+		if resp.Error != nil {
+			return fmt.Errorf("%w: %s: %s %s", ErrCKAN, action, resp.Error.Type, resp.Error.Message)
+		}
+		return fmt.Errorf("%w: %s returned status %d", ErrCKAN, r.URL.Host, res.StatusCode)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Result, result)
+}
+
+// ckanAllowedHost returns whether a host name belongs to one of the configured CKAN catalogs
+func ckanAllowedHost(host string) bool {
+	for _, inst := range config.Conf.CKAN.Instances {
+		u, err := url.Parse(inst)
+		if err == nil && strings.EqualFold(u.Host, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// ckanHarvestCommit adds a database file harvested from a CKAN dataset to a database
+func ckanHarvestCommit(dbOwner, dbName string, createBranch bool, branchName, commitID string, accessType database.SetAccessType, licenceName, base string, ds ckanDataset, tempDB *os.File) (newCommitID, sha string, err error) {
+	title := ds.Title
+	if title == "" {
+		title = ds.Name
+	}
+	commitMsg := fmt.Sprintf("Harvested from the '%s' CKAN dataset", title)
+	if ds.MetadataModified != "" {
+		commitMsg += fmt.Sprintf(", last modified %s", ds.MetadataModified)
+	}
+	numBytes, newCommitID, sha, err := AddDatabase(dbOwner, dbOwner, dbName, createBranch, branchName, commitID,
+		accessType, licenceName, commitMsg, base+"/dataset/"+url.PathEscape(ds.Name), tempDB, time.Now().UTC(),
+		time.Time{}, "", "", "", "", nil, "", AddDatabaseOptions{})
+	if err != nil {
+		return
+	}
+	log.Printf("Database harvested from CKAN: '%s/%s', bytes: %v", dbOwner, SanitiseLogString(dbName), numBytes)
+	return
+}
+
+// ckanHarvestDataset creates a SQLite database from the CSV resources of a CKAN dataset.  Resources stored outside the
+// configured CKAN catalogs are skipped.  The combined size of the resources is limited to maxSize bytes, unless maxSize
+// is -1.  The caller needs to remove the returned temporary file when finished with it
+func ckanHarvestDataset(base, token, dataset string, maxSize int64) (tempDB *os.File, ds ckanDataset, err error) {
+	err = ckanAction(base, token, "package_show", map[string]string{"id": dataset}, &ds)
+	if err != nil {
+		return
+	}
+
+	tempDB, err = os.CreateTemp(config.Conf.DiskCache.Directory, "dbhub-ckan-*.db")
+	if err != nil {
+		return
+	}
+	err = func() (err error) {
+		sdb, err := sqlite.Open(tempDB.Name(), sqlite.OpenReadWrite|sqlite.OpenCreate)
+		if err != nil {
+			return
+		}
+		defer sdb.Close()
+		if err = sdb.Begin(); err != nil {
+			return
+		}
+		remaining := maxSize
+		used := make(map[string]bool)
+		for _, res := range ds.Resources {
+			if !strings.EqualFold(strings.TrimSpace(res.Format), "csv") {
+				continue
+			}
+			u, err := url.Parse(res.URL)
+			if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+				continue
+			}
+			if !ckanAllowedHost(u.Host) {
+				log.Printf("Skipping CKAN resource '%s', as it's stored outside the configured catalogs",
+					SanitiseLogString(res.URL))
+				continue
+			}
+
+			// Table names need to be unique, so number any which end up the same
+			baseName := dataPackageName(strings.TrimSuffix(res.Name, ".csv"))
+			name := baseName
+			for i := 2; used[name]; i++ {
+				name = fmt.Sprintf("%s-%d", baseName, i)
+			}
+			used[name] = true
+
+			err = ckanHarvestResource(sdb, res.URL, token, name, &remaining)
+			if err != nil {
+				sdb.Rollback()
+				return fmt.Errorf("Harvesting resource '%s' failed: %w", res.Name, err)
+			}
+		}
+		if len(used) == 0 {
+			sdb.Rollback()
+			return fmt.Errorf("%w: dataset '%s' doesn't have any CSV resources stored in the catalog", ErrCKAN,
+				dataset)
+		}
+		return sdb.Commit()
+	}()
+	if err != nil {
+		tempDB.Close()
+		os.Remove(tempDB.Name())
+		return nil, ds, err
+	}
+	return
+}
+
+// ckanHarvestResource downloads a CSV resource of a CKAN dataset into a new table.  remaining is the number of bytes
+// which can still be downloaded for the dataset, or -1 for no limit
+func ckanHarvestResource(sdb *sqlite.Conn, resURL, token, table string, remaining *int64) error {
+	r, err := http.NewRequest(http.MethodGet, resURL, nil)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		r.Header.Set("Authorization", token)
+	}
+	res, err := ckanClient.Do(r)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrCKAN, err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("%w: %s returned status %d", ErrCKAN, r.URL.Host, res.StatusCode)
+	}
+	var body io.Reader = res.Body
+	if *remaining != -1 {
+		body = &limitedReader{r: res.Body, remaining: remaining}
+	}
+	return importCSVTable(sdb, DataPackageResource{Name: table}, body)
+}
+
+// ckanLicence returns the short name of the licence matching a CKAN licence ID, or "Not specified" if it's not one
+// known to DBHub.io.  CKAN catalogs use either SPDX IDs or their own lower case ones, such as "cc-by"
+func ckanLicence(userName, licenceID string) (string, error) {
+	licences, err := database.GetLicences(userName)
+	if err != nil {
+		return "", err
+	}
+	if licenceID == "" {
+		return "Not specified", nil
+	}
+	for name := range licences {
+		if strings.EqualFold(name, licenceID) || strings.EqualFold(spdxLicences[name], licenceID) {
+			return name, nil
+		}
+	}
+	switch strings.ToLower(licenceID) {
+	case "cc-zero":
+		return "CC0", nil
+	case "cc-by":
+		return "CC-BY-4.0", nil
+	case "cc-by-sa":
+		return "CC-BY-SA-4.0", nil
+	case "cc-nc":
+		return "CC-BY-NC-4.0", nil
+	case "odc-odbl":
+		return "ODbL-1.0", nil
+	case "uk-ogl":
+		return "UK-OGL-3", nil
+	}
+	return "Not specified", nil
+}
+
+// ckanSyncHarvest commits the CSV resources of a CKAN dataset to the default branch of a database, if the dataset has
+// changed since it was last harvested.  The modification time of the harvested dataset is returned, or an empty
+// string if it hasn't changed
+func ckanSyncHarvest(integ database.CKANIntegration) (version string, err error) {
+	base, err := CKANInstance(integ.URL)
+	if err != nil {
+		return
+	}
+	var ds ckanDataset
+	err = ckanAction(base, integ.APIToken, "package_show", map[string]string{"id": integ.Dataset}, &ds)
+	if err != nil {
+		return
+	}
+	if ds.MetadataModified == integ.SyncedVersion {
+		return
+	}
+
+	maxSize, err := database.MaxUploadSizeForUser(integ.DBOwner)
+	if err != nil {
+		return
+	}
+	tempDB, ds, err := ckanHarvestDataset(base, integ.APIToken, integ.Dataset, maxSize)
+	if err != nil {
+		return
+	}
+	defer os.Remove(tempDB.Name())
+	defer tempDB.Close()
+
+	// Add the new commit to the head of the default branch, keeping its licence
+	branchName, err := database.GetDefaultBranchName(integ.DBOwner, integ.DBName)
+	if err != nil {
+		return
+	}
+	branches, err := database.GetBranches(integ.DBOwner, integ.DBName)
+	if err != nil {
+		return
+	}
+	licenceName, err := branchLicence(integ.DBOwner, integ.DBName, branchName)
+	if err != nil {
+		return
+	}
+	_, _, err = ckanHarvestCommit(integ.DBOwner, integ.DBName, false, branchName, branches[branchName].Commit,
+		database.KeepCurrentAccessType, licenceName, base, ds, tempDB)
+	if err != nil {
+		return
+	}
+	err = InvalidateCacheEntry(integ.DBOwner, integ.DBOwner, integ.DBName, "")
+	if err != nil {
+		return
+	}
+	return ds.MetadataModified, nil
+}
+
+// ckanSyncPublish publishes the latest release of a database to its CKAN dataset, creating the dataset if it doesn't
+// exist yet.  The name of the published release is returned, or an empty string if it was already published
+func ckanSyncPublish(integ database.CKANIntegration) (version string, err error) {
+	base, err := CKANInstance(integ.URL)
+	if err != nil {
+		return
+	}
+	releases, err := database.GetReleases(integ.DBOwner, integ.DBName)
+	if err != nil {
+		return
+	}
+	if len(releases) == 0 {
+		return
+	}
+	var names []string
+	for name := range releases {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return releases[names[i]].Date.After(releases[names[j]].Date)
+	})
+	if names[0] == integ.SyncedVersion {
+		return
+	}
+	version = names[0]
+
+	// Only public databases can be published, as the catalog links to their downloads
+	cit, db, err := releaseCitation(integ.DBOwner, integ.DBOwner, integ.DBName, version)
+	if err != nil {
+		return
+	}
+	if !db.Info.Public {
+		return version, errors.New("Only public databases can be published to CKAN")
+	}
+
+	notes := db.Info.FullDesc
+	if notes == "" {
+		notes = cit.Description
+	}
+	licenceID := cit.Licence
+	if spdx, ok := spdxLicences[cit.Licence]; ok {
+		licenceID = spdx
+	}
+	if cit.Licence == "Not specified" {
+		licenceID = "notspecified"
+	}
+	downloadURL := fmt.Sprintf("https://%s/x/download/%s/%s?commit=%s", config.Conf.Web.ServerName,
+		url.PathEscape(integ.DBOwner), url.PathEscape(integ.DBName), cit.Commit)
+	ds := ckanDataset{
+		LicenseID: licenceID,
+		Name:      integ.Dataset,
+		Notes:     notes,
+		OwnerOrg:  integ.Organization,
+		Resources: []ckanResource{
+			{Format: "SQLite", Name: integ.DBName, URL: downloadURL},
+			{Format: "ZIP", Name: "Data package", URL: strings.Replace(downloadURL, "/x/download/",
+				"/x/downloaddatapackage/", 1)},
+		},
+		Title:   cit.Title,
+		URL:     cit.URL,
+		Version: version,
+	}
+
+	// Update the dataset if it exists, otherwise create it
+	var existing ckanDataset
+	err = ckanAction(base, integ.APIToken, "package_show", map[string]string{"id": integ.Dataset}, &existing)
+	switch {
+	case err == nil:
+		ds.ID = existing.ID
+		err = ckanAction(base, integ.APIToken, "package_patch", ds, nil)
+	case strings.Contains(err.Error(), "Not Found"):
+		err = ckanAction(base, integ.APIToken, "package_create", ds, nil)
+	}
+	return
+}
+
+// limitedReader returns an error once more than the remaining number of bytes have been read from it
+type limitedReader struct {
+	r         io.Reader
+	remaining *int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	*l.remaining -= int64(n)
+	if *l.remaining < 0 {
+		return n, errors.New("The dataset is larger than the maximum database size for your account")
+	}
+	return n, err
+}
@@ -1,15 +1,20 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strconv"
 
 	"github.com/BurntSushi/toml"
+	"golang.org/x/crypto/hkdf"
 )
 
 var (
@@ -19,18 +24,9 @@ var (
 
 // ReadConfig reads the server configuration file.
 func ReadConfig() (err error) {
-	// Override config file location via environment variables
-	configFile := os.Getenv("CONFIG_FILE")
-	if configFile == "" {
-		// TODO: Might be a good idea to add permission checks of the dir & conf file, to ensure they're not
-		//       world readable.  Similar in concept to what ssh does for its config files.
-		var userHome string
-		userHome, err = os.UserHomeDir()
-		if err != nil {
-			log.Printf("User home directory couldn't be determined: '%s'", err)
-			return
-		}
-		configFile = filepath.Join(userHome, ".dbhub", "config.toml")
+	configFile, err := configFilePath()
+	if err != nil {
+		return
 	}
 
 	// Reads the server configuration from disk
@@ -83,19 +79,45 @@ func ReadConfig() (err error) {
 	if tempString != "" {
 		Conf.Pg.Database = tempString
 	}
+	tempString = os.Getenv("VAULT_TOKEN")
+	if tempString != "" {
+		Conf.Encryption.VaultToken = tempString
+	}
 
 	// Verify we have the needed configuration information
 	// Note - We don't check for a valid Conf.Pg.Password here, as the PostgreSQL password can also be kept
 	// in a .pgpass file as per https://www.postgresql.org/docs/current/static/libpq-pgpass.html
 	var missingConfig []string
-	if Conf.Minio.Server == "" {
-		missingConfig = append(missingConfig, "Minio server:port string")
+	if Conf.Minio.Backend == "" {
+		Conf.Minio.Backend = "minio"
 	}
-	if Conf.Minio.AccessKey == "" && Conf.Environment.Environment == "production" {
-		missingConfig = append(missingConfig, "Minio access key string")
+	switch Conf.Minio.Backend {
+	case "s3":
+		if Conf.Minio.Server == "" {
+			Conf.Minio.Server = "s3.amazonaws.com"
+		}
+	case "gcs":
+		if Conf.Minio.Server == "" {
+			Conf.Minio.Server = "storage.googleapis.com"
+		}
 	}
-	if Conf.Minio.Secret == "" && Conf.Environment.Environment == "production" {
-		missingConfig = append(missingConfig, "Minio secret string")
+	if Conf.Minio.Backend == "filesystem" {
+		if Conf.Minio.Directory == "" {
+			missingConfig = append(missingConfig, "Storage directory string")
+		}
+	} else {
+		if Conf.Minio.Server == "" {
+			missingConfig = append(missingConfig, "Minio server:port string")
+		}
+		if Conf.Minio.AccessKey == "" && (Conf.Environment.Environment == "production" || Conf.Minio.Backend != "minio") {
+			missingConfig = append(missingConfig, "Minio access key string")
+		}
+		if Conf.Minio.Secret == "" && (Conf.Environment.Environment == "production" || Conf.Minio.Backend != "minio") {
+			missingConfig = append(missingConfig, "Minio secret string")
+		}
+		if Conf.Minio.Bucket == "" && Conf.Minio.Backend != "minio" {
+			missingConfig = append(missingConfig, "Storage bucket string")
+		}
 	}
 	if Conf.Pg.Server == "" {
 		missingConfig = append(missingConfig, "PostgreSQL server string")
@@ -109,6 +131,30 @@ func ReadConfig() (err error) {
 	if Conf.Pg.Database == "" {
 		missingConfig = append(missingConfig, "PostgreSQL database string")
 	}
+	if Conf.Encryption.Provider == "" {
+		Conf.Encryption.Provider = "local"
+	}
+	if Conf.Encryption.VaultMount == "" {
+		Conf.Encryption.VaultMount = "transit"
+	}
+	if Conf.Encryption.Enabled {
+		switch Conf.Encryption.Provider {
+		case "local":
+			if _, ok := Conf.Encryption.Keys[Conf.Encryption.CurrentKey]; !ok {
+				missingConfig = append(missingConfig, "Current encryption key ID")
+			}
+		case "vault":
+			if Conf.Encryption.VaultAddress == "" {
+				missingConfig = append(missingConfig, "Vault address string")
+			}
+			if Conf.Encryption.VaultKey == "" {
+				missingConfig = append(missingConfig, "Vault encryption key name")
+			}
+			if Conf.Encryption.VaultToken == "" {
+				missingConfig = append(missingConfig, "Vault token string")
+			}
+		}
+	}
 	if len(missingConfig) > 0 {
 		// Some config is missing
 		returnMessage := fmt.Sprint("Missing or incomplete value(s):\n")
@@ -130,6 +176,64 @@ func ReadConfig() (err error) {
 		Conf.Memcache.DefaultCacheTime = 2592000
 	}
 
+	// Browser based applications need to be able to send the Authorization header for the v2 API, form data, and
+	// conditional and range requests
+	if len(Conf.Api.CorsAllowedHeaders) == 0 {
+		Conf.Api.CorsAllowedHeaders = []string{"Authorization", "Content-Type", "If-Modified-Since", "If-None-Match",
+			"Range"}
+	}
+	if Conf.Api.CorsMaxAge == 0 {
+		Conf.Api.CorsMaxAge = 600
+	}
+
+	// Stop slow queries from holding up request handlers indefinitely.  The PostgreSQL server gets a bit less time than
+	// the client, so it can cancel a slow statement itself and report that back
+	if Conf.Pg.QueryTimeout == 0 {
+		Conf.Pg.QueryTimeout = 60
+	}
+	if Conf.Pg.StatementTimeout == 0 {
+		Conf.Pg.StatementTimeout = 55
+	}
+
+	// Stop queries on live databases from tying up the live nodes.  Negative values turn a limit off
+	if Conf.Live.QueryMaxMemory == 0 {
+		Conf.Live.QueryMaxMemory = 256 * 1024 * 1024
+	}
+	if Conf.Live.QueryMaxRows == 0 {
+		Conf.Live.QueryMaxRows = 100000
+	}
+	if Conf.Live.QueryTimeout == 0 {
+		Conf.Live.QueryTimeout = 30
+	}
+
+	// Let live nodes run several jobs at once, with a few read only connections kept open for each database
+	if Conf.Live.ReadConnections == 0 {
+		Conf.Live.ReadConnections = 4
+	}
+	if Conf.Live.Workers == 0 {
+		Conf.Live.Workers = 2 * runtime.NumCPU()
+	}
+	if Conf.Live.BackgroundWorkers == 0 {
+		Conf.Live.BackgroundWorkers = Conf.Live.Workers / 2
+		if Conf.Live.BackgroundWorkers < 1 {
+			Conf.Live.BackgroundWorkers = 1
+		}
+	}
+	if Conf.Live.QueueDepth == 0 {
+		Conf.Live.QueueDepth = 200
+	}
+	if Conf.Live.QueueDepthUser == 0 {
+		Conf.Live.QueueDepthUser = 20
+	}
+	if Conf.Live.IdleTimeout == 0 {
+		Conf.Live.IdleTimeout = 1440
+	}
+
+	// The extensions built into SQLite are allowed unless the config file says otherwise
+	if Conf.Extensions.Allowed == nil {
+		Conf.Extensions.Allowed = []string{"geopoly", "json1", "math"}
+	}
+
 	// Warn if the view count flush delay isn't set in the config file
 	if Conf.Memcache.ViewCountFlushDelay == 0 {
 		log.Printf("WARN: Memcache view count flush delay isn't set in the config file. Defaulting to 2 minutes.")
@@ -148,6 +252,27 @@ func ReadConfig() (err error) {
 		Conf.Event.EmailQueueProcessingDelay = 10
 	}
 
+	// Default to sending emails using SMTP2Go, which is what was used before other email backends were added
+	if Conf.Event.EmailBackend == "" {
+		Conf.Event.EmailBackend = "smtp2go"
+	}
+	if Conf.Event.EmailFrom == "" {
+		Conf.Event.EmailFrom = "updates@dbhub.io"
+	}
+	if Conf.Event.EmailBackend == "smtp" && Conf.Event.SmtpPort == 0 {
+		log.Printf("WARN: SMTP port isn't set in the config file. Defaulting to 587.")
+		Conf.Event.SmtpPort = 587
+	}
+	if Conf.Event.EmailBackend == "mailgun" && Conf.Event.MailgunAPIBase == "" {
+		Conf.Event.MailgunAPIBase = "https://api.mailgun.net/v3"
+	}
+
+	// Warn if the processed event retention time isn't set in the config file
+	if Conf.Event.Retention == 0 {
+		log.Printf("WARN: Processed event retention time isn't set in the config file. Defaulting to 24 hours.")
+		Conf.Event.Retention = 24
+	}
+
 	// If an SMTP2Go environment variable is already set, don't mess with it.
 	tempString = os.Getenv("SMTP2GO_API_KEY")
 	if tempString != "" {
@@ -155,13 +280,115 @@ func ReadConfig() (err error) {
 	} else {
 		// If this is a production environment, and the SMTP2Go env variable wasn't set, we'd better
 		// warn when the key isn't in the config file either
-		if Conf.Event.Smtp2GoKey == "" && Conf.Environment.Environment == "production" {
+		if Conf.Event.Smtp2GoKey == "" && Conf.Event.EmailBackend == "smtp2go" && Conf.Environment.Environment == "production" {
 			log.Printf("WARN: SMTP2Go API key isn't set in the config file.  Event emails won't be sent.")
 		} else {
 			os.Setenv("SMTP2GO_API_KEY", Conf.Event.Smtp2GoKey)
 		}
 	}
 
+	// Warn if the secret used for signing visualisation embed tokens isn't set in the config file.  A separate key is
+	// derived from the session store password then, so the session cookie key isn't also used for the public tokens
+	if Conf.Web.EmbedSecret == "" && Conf.Web.SessionStorePassword != "" {
+		log.Printf("WARN: Embed token secret isn't set in the config file. Deriving one from the session store password.")
+		Conf.Web.EmbedSecret, err = deriveSecret(Conf.Web.SessionStorePassword, "dbhub.io visualisation embed tokens")
+		if err != nil {
+			return
+		}
+	} else if Conf.Web.EmbedSecret == "" {
+		log.Printf("WARN: Neither the embed token secret nor the session store password are set in the config file.  " +
+			"Visualisation embed tokens won't work.")
+	}
+
+	// Default to the production APIs of the DOI providers
+	if Conf.DOI.APIURL == "" {
+		switch Conf.DOI.Provider {
+		case "datacite":
+			Conf.DOI.APIURL = "https://api.datacite.org"
+		case "zenodo":
+			Conf.DOI.APIURL = "https://zenodo.org/api"
+		}
+	}
+	if Conf.DOI.Publisher == "" {
+		Conf.DOI.Publisher = "DBHub.io"
+	}
+
+	// Accept avatar images of up to 5MB by default
+	if Conf.Avatars.MaxUpload == 0 {
+		Conf.Avatars.MaxUpload = 5 * 1024 * 1024
+	}
+
+	// Flag merged branches without commits for 90 days as stale, checking once a day by default
+	if Conf.Branch.StaleAge == 0 {
+		Conf.Branch.StaleAge = 90
+	}
+	if Conf.Branch.StaleInterval == 0 {
+		Conf.Branch.StaleInterval = 24
+	}
+
+	// Check for new releases and changed CKAN datasets once an hour by default
+	if Conf.CKAN.SyncInterval == 0 {
+		Conf.CKAN.SyncInterval = 60
+	}
+
+	// Let each user add a few custom domains, verified within a week with a TXT record on "_dbhub-verification.<domain>"
+	// by default
+	if Conf.Domains.MaxPerUser == 0 {
+		Conf.Domains.MaxPerUser = 3
+	}
+	if Conf.Domains.TXTPrefix == "" {
+		Conf.Domains.TXTPrefix = "_dbhub-verification"
+	}
+	if Conf.Domains.VerifyExpiry == 0 {
+		Conf.Domains.VerifyExpiry = 7
+	}
+
+	// Default to the standard OpenStreetMap tiles for map visualisations
+	if len(Conf.Map.TileProviders) == 0 {
+		Conf.Map.TileProviders = []MapTileProvider{{
+			Attribution: "© OpenStreetMap contributors",
+			MaxZoom:     19,
+			Name:        "OpenStreetMap",
+			URL:         "https://tile.openstreetmap.org/{z}/{x}/{y}.png",
+		}}
+	}
+	for i, p := range Conf.Map.TileProviders {
+		if p.MaxZoom == 0 {
+			Conf.Map.TileProviders[i].MaxZoom = 18
+		}
+	}
+
+	// Invitations can be used for two weeks by default
+	if Conf.Signup.InviteExpiry == 0 {
+		Conf.Signup.InviteExpiry = 14
+	}
+
+	// Hold posts with lots of links, or from users posting very often, for moderation by default
+	if Conf.Spam.AkismetURL == "" {
+		Conf.Spam.AkismetURL = "https://rest.akismet.com/1.1"
+	}
+	if Conf.Spam.MaxLinks == 0 {
+		Conf.Spam.MaxLinks = 10
+	}
+	if Conf.Spam.MaxPostsPerHour == 0 {
+		Conf.Spam.MaxPostsPerHour = 30
+	}
+
+	// Default to a compatibility matrix for the licences shipped with DBHub.io.  Licences which aren't in the matrix,
+	// such as custom ones, are reported as having unknown compatibility
+	if len(Conf.Licence.Compatibility) == 0 {
+		attribution := []string{"CC-BY-4.0", "CC-BY-SA-4.0", "CC-BY-NC-4.0", "ODbL-1.0"}
+		Conf.Licence.Compatibility = map[string][]string{
+			"CC0":           {"*"},
+			"CC-BY-4.0":     attribution,
+			"CC-BY-SA-4.0":  {"CC-BY-SA-4.0"},
+			"CC-BY-NC-4.0":  {"CC-BY-NC-4.0"},
+			"CC-BY-IGO-3.0": append([]string{"CC-BY-IGO-3.0"}, attribution...),
+			"ODbL-1.0":      {"ODbL-1.0"},
+			"UK-OGL-3":      append([]string{"UK-OGL-3"}, attribution...),
+		}
+	}
+
 	// Check cache directory exists
 	_, err = os.Stat(Conf.DiskCache.Directory)
 	if errors.Is(err, fs.ErrNotExist) {
@@ -179,3 +406,46 @@ func ReadConfig() (err error) {
 	// The configuration file seems good
 	return
 }
+
+// ReadMaintenanceConfig re-reads the maintenance section of the configuration file, so read only mode can be switched
+// on and off without restarting the daemons.  Conf itself isn't changed
+func ReadMaintenanceConfig() (conf MaintenanceConfig, err error) {
+	configFile, err := configFilePath()
+	if err != nil {
+		return
+	}
+	var c TomlConfig
+	_, err = toml.DecodeFile(configFile, &c)
+	if err != nil {
+		return conf, fmt.Errorf("Config file couldn't be parsed: %s", err)
+	}
+	return c.Maintenance, nil
+}
+
+// configFilePath returns the location of the configuration file
+func configFilePath() (configFile string, err error) {
+	// Override config file location via environment variables
+	configFile = os.Getenv("CONFIG_FILE")
+	if configFile == "" {
+		// TODO: Might be a good idea to add permission checks of the dir & conf file, to ensure they're not
+		//       world readable.  Similar in concept to what ssh does for its config files.
+		var userHome string
+		userHome, err = os.UserHomeDir()
+		if err != nil {
+			log.Printf("User home directory couldn't be determined: '%s'", err)
+			return
+		}
+		configFile = filepath.Join(userHome, ".dbhub", "config.toml")
+	}
+	return
+}
+
+// deriveSecret derives a separate secret from another one with HKDF, using a fixed label for what it's used for
+func deriveSecret(secret, label string) (string, error) {
+	key := make([]byte, 32)
+	_, err := io.ReadFull(hkdf.New(sha256.New, []byte(secret), nil, []byte(label)), key)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key), nil
+}
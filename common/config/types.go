@@ -6,16 +6,32 @@ import "time"
 type TomlConfig struct {
 	Api         ApiConfig
 	Auth0       Auth0Config
+	Avatars     AvatarConfig
+	Branch      BranchConfig
+	CKAN        CKANConfig
 	DB4S        DB4SConfig
 	Environment EnvConfig
 	DiskCache   DiskCacheConfig
+	DOI         DOIConfig
+	Domains     CustomDomainConfig
+	Encryption  EncryptionConfig
 	Event       EventProcessingConfig
+	Extensions  ExtensionsConfig
+	GeoIP       GeoIPConfig
+	GrpcApi     GrpcApiConfig
 	Licence     LicenceConfig
 	Live        LiveConfig
+	Maintenance MaintenanceConfig
+	Map         MapConfig
 	Memcache    MemcacheConfig
 	Minio       MinioConfig
 	Pg          PGConfig
+	Redis       RedisConfig
+	Replication ReplicationConfig
+	Reports     ReportsConfig
 	Sign        SigningConfig
+	Signup      SignupConfig
+	Spam        SpamConfig
 	Web         WebConfig
 }
 
@@ -27,6 +43,11 @@ type ApiConfig struct {
 	CertificateKey string `toml:"certificate_key"`
 	RequestLog     string `toml:"request_log"`
 	ServerName     string `toml:"server_name"`
+
+	// Cross-origin (CORS) settings, for browser based applications calling the API
+	CorsAllowedHeaders []string      `toml:"cors_allowed_headers"` // Request headers browsers may send
+	CorsAllowedOrigins []string      `toml:"cors_allowed_origins"` // Origins browsers may call the API from.  Empty allows all origins
+	CorsMaxAge         time.Duration `toml:"cors_max_age"`         // Number of seconds browsers may cache preflight responses for
 }
 
 // Auth0Config contains the Auth0 connection info used authenticating webUI users
@@ -36,6 +57,37 @@ type Auth0Config struct {
 	Domain       string
 }
 
+// AvatarConfig holds the settings for user avatars.  Uploaded avatars are kept in the same storage as the database
+// files.  Users without one get a Gravatar, unless that's turned off, for instances which shouldn't send the email
+// address hashes of their users elsewhere.  A generated identicon is used instead then
+type AvatarConfig struct {
+	DisableGravatar bool  `toml:"disable_gravatar"` // Also stops the pictures provided by Auth0 from being used
+	MaxUpload       int64 `toml:"max_upload"`       // Largest image, in bytes, which can be uploaded.  Defaults to 5MB
+}
+
+// BranchConfig contains the settings for flagging stale branches.  Branches are stale when their head commit is older
+// than StaleAge, and is already part of another branch
+type BranchConfig struct {
+	StaleAge      int           `toml:"stale_age"`      // Number of days without commits before a merged branch is stale.  Defaults to 90
+	StaleInterval time.Duration `toml:"stale_interval"` // Number of hours between checks for stale branches.  Defaults to 24
+}
+
+// CKANConfig contains the settings for publishing database metadata to CKAN catalogs, and harvesting datasets from
+// them.  Only the listed catalogs can be used, and the CKAN integration is disabled when there aren't any
+type CKANConfig struct {
+	Instances    []string      `toml:"instances"`     // Base URLs of the CKAN catalogs which can be used, eg "https://catalog.data.gov"
+	SyncInterval time.Duration `toml:"sync_interval"` // Number of minutes between checks for new releases and changed datasets.  Defaults to 60
+}
+
+// CustomDomainConfig contains the settings for custom domains, which let users serve their profile and databases from a
+// domain of their own.  The domains need to point at the web UI, with TLS for them handled in front of it
+type CustomDomainConfig struct {
+	Enabled      bool   `toml:"enabled"`
+	MaxPerUser   int    `toml:"max_per_user"`  // Number of custom domains each user can add.  Defaults to 3
+	TXTPrefix    string `toml:"txt_prefix"`    // Label the verification TXT record goes under.  Defaults to "_dbhub-verification"
+	VerifyExpiry int    `toml:"verify_expiry"` // Number of days added domains have to be verified in.  Defaults to 7
+}
+
 // DB4SConfig contains configuration info for the DB4S end point daemon
 type DB4SConfig struct {
 	CAChain        string `toml:"ca_chain"`
@@ -51,6 +103,33 @@ type DiskCacheConfig struct {
 	Directory string
 }
 
+// DOIConfig contains the settings for minting DOIs for database releases, using either DataCite or Zenodo.  DOIs can't
+// be minted when Provider is empty
+type DOIConfig struct {
+	APIURL    string `toml:"api_url"`   // Defaults to the production API of the provider.  Use the provider's test API while setting up
+	Password  string `toml:"password"`  // The password of the DataCite repository
+	Prefix    string `toml:"prefix"`    // The DOI prefix of the DataCite repository, eg "10.12345"
+	Provider  string `toml:"provider"`  // Either "datacite" or "zenodo"
+	Publisher string `toml:"publisher"` // The publisher recorded for the datasets.  Defaults to "DBHub.io"
+	Token     string `toml:"token"`     // The Zenodo personal access token, with the deposit:write and deposit:actions scopes
+	Username  string `toml:"username"`  // The ID of the DataCite repository, eg "DBHUB.DATA"
+}
+
+// EncryptionConfig contains the settings for encrypting the database files before they're stored.  Each file is
+// encrypted with its own data key, which is stored alongside it encrypted with an instance key ("local" or "vault"), or
+// with a key for the user owning the database when PerUserKeys is enabled
+type EncryptionConfig struct {
+	CurrentKey   string            `toml:"current_key"` // The ID of the instance key used for encrypting new files, when using "local"
+	Enabled      bool              // Encrypt new database files.  Existing encrypted files can be read while the keys are configured
+	Keys         map[string]string // The instance keys by ID, base64 encoded 256 bit keys, when using "local"
+	PerUserKeys  bool              `toml:"per_user_keys"`
+	Provider     string            // Where the instance keys are kept.  Either "local" (the default) or "vault"
+	VaultAddress string            `toml:"vault_address"`
+	VaultMount   string            `toml:"vault_mount"` // The mount path of the Vault Transit secrets engine.  Defaults to "transit"
+	VaultKey     string            `toml:"vault_key"`
+	VaultToken   string            `toml:"vault_token"`
+}
+
 // EnvConfig holds information about the purpose of the running server.  eg "is this a production, docker,
 // or development" instance?
 type EnvConfig struct {
@@ -60,24 +139,105 @@ type EnvConfig struct {
 
 // EventProcessingConfig hold configuration for the event processing loop
 type EventProcessingConfig struct {
+	BounceWebhookSecret       string        `toml:"bounce_webhook_secret"` // Secret included in the URL of the bounce notification webhook
 	Delay                     time.Duration `toml:"delay"`
+	EmailBackend              string        `toml:"email_backend"` // One of "smtp2go", "smtp", "ses", or "mailgun"
+	EmailFrom                 string        `toml:"email_from"`
 	EmailQueueProcessingDelay time.Duration `toml:"email_queue_processing_delay"`
+	MailgunAPIBase            string        `toml:"mailgun_api_base"` // eg "https://api.eu.mailgun.net/v3" for the EU region
+	MailgunDomain             string        `toml:"mailgun_domain"`
+	MailgunKey                string        `toml:"mailgun_key"`
+	Retention                 time.Duration `toml:"retention"` // Number of hours processed events are kept for
+	SesAccessKey              string        `toml:"ses_access_key"`
+	SesRegion                 string        `toml:"ses_region"`
+	SesSecretKey              string        `toml:"ses_secret_key"`
+	SmtpHost                  string        `toml:"smtp_host"`
+	SmtpPassword              string        `toml:"smtp_password"`
+	SmtpPort                  int           `toml:"smtp_port"`
+	SmtpUsername              string        `toml:"smtp_username"`
 	Smtp2GoKey                string        `toml:"smtp2go_key"` // The SMTP2GO API key
 }
 
-// LicenceConfig -> LicenceDir holds the path to the licence files
+// ExtensionsConfig holds the SQLite extensions made available to the queries run on live databases, and the read only
+// queries run on standard databases
+type ExtensionsConfig struct {
+	Allowed    []string `toml:"allowed"`    // The extensions allowed on this instance.  Any of "geopoly", "json1", "math", and "spatialite"
+	Spatialite string   `toml:"spatialite"` // Path to the SpatiaLite loadable extension library (mod_spatialite)
+}
+
+// GeoIPConfig holds the settings used for working out which country a request came from
+type GeoIPConfig struct {
+	CountryHeader string `toml:"country_header"` // Header set by a reverse proxy or CDN with the country code, eg "CF-IPCountry"
+	Database      string `toml:"database"`       // CSV file of IP address ranges and their country codes
+}
+
+// GrpcApiConfig contains configuration info for the gRPC API daemon
+type GrpcApiConfig struct {
+	BindAddress    string `toml:"bind_address"`
+	Certificate    string `toml:"certificate"`
+	CertificateKey string `toml:"certificate_key"`
+}
+
+// LicenceConfig -> LicenceDir holds the path to the licence files.  Compatibility lists the licences data under each
+// licence can be combined into, with "*" meaning any licence
 type LicenceConfig struct {
-	LicenceDir string `toml:"licence_dir"`
+	Compatibility map[string][]string `toml:"compatibility"`
+	LicenceDir    string              `toml:"licence_dir"`
 }
 
 // LiveConfig holds configuration info for the Live database daemon
 type LiveConfig struct {
 	Nodename   string `toml:"node_name"`
 	StorageDir string `toml:"storage_dir"`
+
+	// Limits for each query run on a live database, unless the usage limits of the user set their own.  Negative values
+	// mean no limit
+	QueryMaxMemory int64         `toml:"query_max_memory"` // Bytes of memory a query can use
+	QueryMaxRows   int           `toml:"query_max_rows"`   // Rows a query can return
+	QueryTimeout   time.Duration `toml:"query_timeout"`    // Number of seconds a query can run before it's cancelled
+
+	// Jobs reading a live database run in parallel, while jobs changing one run one at a time
+	ReadConnections int `toml:"read_connections"` // Idle read only connections kept open for each database
+	Workers         int `toml:"workers"`          // Jobs a live node runs at once
+
+	// Background jobs, such as snapshots and bulk changes, are only picked up when no interactive jobs are waiting, and
+	// only use some of the workers.  New jobs are refused while the queue of their node is full.  Negative values mean
+	// no limit
+	BackgroundWorkers int `toml:"background_workers"` // Background jobs a live node runs at once
+	QueueDepth        int `toml:"queue_depth"`        // Jobs which can be waiting for each node
+	QueueDepthUser    int `toml:"queue_depth_user"`   // Jobs which can be waiting for each node from the same user
+
+	// Databases not used for this many minutes are backed up to Minio and removed from the node, then downloaded again
+	// when next used.  Negative values keep them on the node
+	IdleTimeout time.Duration `toml:"idle_timeout"`
+}
+
+// MaintenanceConfig holds the read only mode settings.  While read only, requests changing anything are refused but
+// everything can still be viewed and downloaded.  This section is re-read when the daemons receive a SIGHUP, and the
+// instance admins can also switch read only mode on through the API
+type MaintenanceConfig struct {
+	Message  string `toml:"message"`   // Shown to people while in read only mode.  A generic message is used when empty
+	ReadOnly bool   `toml:"read_only"` // Refuse requests which change anything
+}
+
+// MapConfig contains the tile providers which map visualisations can use as their background.  The first one is used
+// by default
+type MapConfig struct {
+	TileProviders []MapTileProvider `toml:"tile_providers"`
+}
+
+// MapTileProvider is a source of raster map tiles.  The URL holds "{z}", "{x}", and "{y}" placeholders for the zoom
+// level and position of each tile
+type MapTileProvider struct {
+	Attribution string `toml:"attribution" json:"attribution"` // Shown on the maps, as most providers require it
+	MaxZoom     int    `toml:"max_zoom" json:"max_zoom"`
+	Name        string `toml:"name" json:"name"`
+	URL         string `toml:"url" json:"url"`
 }
 
 // MemcacheConfig contains the Memcached configuration parameters
 type MemcacheConfig struct {
+	Backend             string        `toml:"backend"` // The cache server to use.  Either "memcached" (the default) or "redis"
 	DefaultCacheTime    int           `toml:"default_cache_time"`
 	Server              string        `toml:"server"`
 	ViewCountFlushDelay time.Duration `toml:"view_count_flush_delay"`
@@ -86,20 +246,46 @@ type MemcacheConfig struct {
 // MinioConfig contains the Minio connection parameters
 type MinioConfig struct {
 	AccessKey string `toml:"access_key"`
+	Backend   string `toml:"backend"`   // The storage to use.  One of "minio" (the default), "s3", "gcs", or "filesystem"
+	Bucket    string `toml:"bucket"`    // The bucket holding all the files, when using "s3" or "gcs"
+	Directory string `toml:"directory"` // The directory holding all the files, when using "filesystem"
 	HTTPS     bool
+	Region    string `toml:"region"` // The region of the bucket, when using "s3"
 	Secret    string
 	Server    string
 }
 
 // PGConfig contains the PostgreSQL connection parameters
 type PGConfig struct {
-	Database       string
-	NumConnections int `toml:"num_connections"`
-	Port           int
-	Password       string
-	Server         string
-	SSL            bool
-	Username       string
+	Database         string
+	NumConnections   int `toml:"num_connections"`
+	Port             int
+	Password         string
+	QueryTimeout     time.Duration `toml:"query_timeout"` // Number of seconds a query can run before it's cancelled
+	Server           string
+	SSL              bool
+	StatementTimeout time.Duration `toml:"statement_timeout"` // Number of seconds the PostgreSQL server lets a statement run for
+	Username         string
+}
+
+// RedisConfig contains the Redis connection parameters, used when Redis is the cache backend
+type RedisConfig struct {
+	Database int
+	Password string
+	Server   string
+	Username string
+}
+
+// ReplicationConfig contains the settings for replicating live databases to external PostgreSQL and MySQL servers.
+// The live nodes do the replication, so they need to be able to reach the servers
+type ReplicationConfig struct {
+	AllowPrivateHosts bool `toml:"allow_private_hosts"` // Allow replicating to servers on loopback and private networks.  Only useful for development
+	Enabled           bool `toml:"enabled"`
+}
+
+// ReportsConfig contains the settings for scheduled reports
+type ReportsConfig struct {
+	AllowPrivateHosts bool `toml:"allow_private_hosts"` // Allow delivering reports to webhooks on loopback and private networks.  Only useful for development
 }
 
 // SigningConfig contains the info used for signing DB4S client certificates
@@ -110,12 +296,30 @@ type SigningConfig struct {
 	IntermediateKey  string `toml:"intermediate_key"`
 }
 
+// SignupConfig contains the settings controlling who can create an account.  When signups are closed, new users need an
+// invitation from the instance admins, unless their email address is in one of the allowed domains
+type SignupConfig struct {
+	AllowedDomains []string      `toml:"allowed_domains"` // Email domains, eg "example.org", whose users can sign up without an invitation
+	Closed         bool          `toml:"closed"`          // Only let invited users, and those in the allowed domains, sign up
+	InviteExpiry   time.Duration `toml:"invite_expiry"`   // Number of days invitations can be used for by default.  Defaults to 14
+}
+
+// SpamConfig contains the settings for the spam filtering of new discussions, comments, and database descriptions.
+// Content flagged as spam is held for moderation by the instance admins rather than published
+type SpamConfig struct {
+	AkismetKey      string `toml:"akismet_key"`        // API key for Akismet.  Akismet isn't used when this isn't set
+	AkismetURL      string `toml:"akismet_url"`        // Base URL of the Akismet compatible API.  Defaults to "https://rest.akismet.com/1.1"
+	MaxLinks        int    `toml:"max_links"`          // Most links a post can hold.  Defaults to 10, negative values mean no limit
+	MaxPostsPerHour int    `toml:"max_posts_per_hour"` // Most discussions and comments a user can post in an hour.  Defaults to 30, negative values mean no limit
+}
+
 // WebConfig contains configuration info for the webUI daemon
 type WebConfig struct {
 	BaseDir              string `toml:"base_dir"`
 	BindAddress          string `toml:"bind_address"`
 	Certificate          string `toml:"certificate"`
 	CertificateKey       string `toml:"certificate_key"`
+	EmbedSecret          string `toml:"embed_secret"`
 	RequestLog           string `toml:"request_log"`
 	ServerName           string `toml:"server_name"`
 	SessionStorePassword string `toml:"session_store_password"`
@@ -0,0 +1,160 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronAliases are the shorthand schedules accepted in place of the five cron fields
+var cronAliases = map[string]string{
+	"@daily":   "0 0 * * *",
+	"@hourly":  "0 * * * *",
+	"@monthly": "0 0 1 * *",
+	"@weekly":  "0 0 * * 0",
+	"@yearly":  "0 0 1 1 *",
+}
+
+// cronFields are the names and allowed ranges of the five fields of a cron schedule, in order
+var cronFields = []struct {
+	max  int
+	min  int
+	name string
+}{
+	{59, 0, "minute"},
+	{23, 0, "hour"},
+	{31, 1, "day of month"},
+	{12, 1, "month"},
+	{7, 0, "day of week"},
+}
+
+// CronSchedule is a parsed cron schedule.  Each field is a bit mask of the values it matches.  Schedules are worked
+// out in UTC
+type CronSchedule struct {
+	dom, dow, hour, minute, month uint64
+	domAll, dowAll                bool
+}
+
+// ParseCron parses a standard five field cron schedule ("minute hour day-of-month month day-of-week"), or one of the
+// @hourly, @daily, @weekly, @monthly, and @yearly shorthands.  Fields can be *, single values, ranges, comma separated
+// lists of those, and can have a /step.  Sunday is either 0 or 7 in the day of week field
+func ParseCron(spec string) (s CronSchedule, err error) {
+	spec = strings.TrimSpace(spec)
+	if z, ok := cronAliases[strings.ToLower(spec)]; ok {
+		spec = z
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return s, errors.New("A cron schedule needs five fields: minute, hour, day of month, month, and day of week")
+	}
+	masks := make([]uint64, len(fields))
+	for i, f := range fields {
+		masks[i], err = parseCronField(f, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return s, fmt.Errorf("Invalid %s field '%s': %v", cronFields[i].name, f, err)
+		}
+	}
+	s.minute, s.hour, s.dom, s.month, s.dow = masks[0], masks[1], masks[2], masks[3], masks[4]
+
+	// Sunday can be given as 7 too
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+
+	// When both day fields are restricted a day matching either is used, so it matters whether they were "*"
+	s.domAll = strings.HasPrefix(fields[2], "*")
+	s.dowAll = strings.HasPrefix(fields[4], "*")
+	return
+}
+
+// parseCronField parses a single field of a cron schedule into a bit mask of the values it matches
+func parseCronField(field string, min, max int) (mask uint64, err error) {
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i != -1 {
+			rng = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return 0, errors.New("invalid step")
+			}
+		}
+
+		lo, hi := min, max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			z := strings.SplitN(rng, "-", 2)
+			lo, err = strconv.Atoi(z[0])
+			if err != nil {
+				return 0, errors.New("invalid range")
+			}
+			hi, err = strconv.Atoi(z[1])
+			if err != nil {
+				return 0, errors.New("invalid range")
+			}
+		default:
+			lo, err = strconv.Atoi(rng)
+			if err != nil {
+				return 0, errors.New("invalid value")
+			}
+			hi = lo
+
+			// A single value with a step, such as "5/15", runs from that value onwards
+			if strings.Contains(part, "/") {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("values need to be between %d and %d", min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			mask |= 1 << uint(v)
+		}
+	}
+	return
+}
+
+// Next returns the first time after the given one which matches the schedule.  The zero time is returned when there
+// isn't one within the next five years, such as for the 31st of February
+func (s CronSchedule) Next(after time.Time) time.Time {
+	t := after.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches checks the day of a time against the day of month and day of week fields of the schedule.  As with cron
+// itself, when both fields are restricted a day only needs to match one of them
+func (s CronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.domAll && s.dowAll:
+		return true
+	case s.domAll:
+		return dow
+	case s.dowAll:
+		return dom
+	}
+	return dom || dow
+}
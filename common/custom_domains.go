@@ -0,0 +1,247 @@
+package common
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// customDomainCacheTime is how long the owners of custom domains are cached for, so each request to a custom domain
+// doesn't need a database query
+const customDomainCacheTime = time.Minute
+
+// customDomainOwners caches the owners of the custom domains requests have come in for.  Domains which aren't verified
+// are cached too, with an empty owner
+var customDomainOwners struct {
+	sync.Mutex
+	entries map[string]customDomainEntry
+}
+
+type customDomainEntry struct {
+	expires time.Time
+	owner   string
+}
+
+// CustomDomainAdd adds a custom domain for a user.  It needs verifying with a DNS TXT record before it's used, so the
+// returned details include the verification token to publish.  Domains not verified within the configured number of
+// days are removed
+func CustomDomainAdd(userName, domain string) (d database.CustomDomain, err error) {
+	if !config.Conf.Domains.Enabled {
+		return d, errors.New("Custom domains aren't enabled on this server")
+	}
+	domain = NormaliseDomain(domain)
+	err = Validate.Var(domain, "required,fqdn,max=253")
+	if err != nil {
+		return d, errors.New("Invalid domain name")
+	}
+	for _, s := range []string{config.Conf.Web.ServerName, config.Conf.Api.ServerName, config.Conf.DB4S.Server} {
+		host := NormaliseDomain(s)
+		if host != "" && (domain == host || strings.HasSuffix(domain, "."+host)) {
+			return d, errors.New("The domains of this server can't be used as custom domains")
+		}
+	}
+	existing, err := CustomDomains(userName)
+	if err != nil {
+		return
+	}
+	if len(existing) >= config.Conf.Domains.MaxPerUser {
+		return d, fmt.Errorf("You can have up to %d custom domains", config.Conf.Domains.MaxPerUser)
+	}
+	owner, err := database.CustomDomainOwner(domain)
+	if err != nil {
+		return
+	}
+	if owner != "" && !strings.EqualFold(owner, userName) {
+		return d, errors.New("That domain is already used by another user")
+	}
+
+	data := make([]byte, 16)
+	_, err = rand.Read(data)
+	if err != nil {
+		return
+	}
+	d = database.CustomDomain{Domain: domain, DateCreated: time.Now(), VerificationToken: hex.EncodeToString(data)}
+	added, err := database.CustomDomainAdd(userName, domain, d.VerificationToken)
+	if err != nil {
+		return
+	}
+	if !added {
+		return d, errors.New("That domain has already been added")
+	}
+	invalidateCanonicalDomain(userName)
+	return
+}
+
+// CustomDomainOwner returns the user a request host is the verified custom domain of, or an empty string when it isn't
+// one.  Any port in the host is ignored
+func CustomDomainOwner(host string) (owner string, err error) {
+	if !config.Conf.Domains.Enabled {
+		return "", nil
+	}
+	domain := NormaliseDomain(host)
+	customDomainOwners.Lock()
+	e, ok := customDomainOwners.entries[domain]
+	customDomainOwners.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.owner, nil
+	}
+
+	owner, err = database.CustomDomainOwner(domain)
+	if err != nil {
+		return
+	}
+	customDomainOwners.Lock()
+	if customDomainOwners.entries == nil {
+		customDomainOwners.entries = make(map[string]customDomainEntry)
+	}
+	customDomainOwners.entries[domain] = customDomainEntry{expires: time.Now().Add(customDomainCacheTime), owner: owner}
+	customDomainOwners.Unlock()
+	return
+}
+
+// CustomDomainRemove removes a custom domain of a user
+func CustomDomainRemove(userName, domain string) (err error) {
+	domain = NormaliseDomain(domain)
+	exists, err := database.CustomDomainDelete(userName, domain)
+	if err != nil {
+		return
+	}
+	if !exists {
+		return errors.New("Unknown custom domain")
+	}
+	customDomainOwners.Lock()
+	delete(customDomainOwners.entries, domain)
+	customDomainOwners.Unlock()
+	invalidateCanonicalDomain(userName)
+	return
+}
+
+// CustomDomainURL returns the canonical URL of a user profile, or of one of their databases when a database name is
+// given.  That's on the custom domain of the user when they have a verified one, otherwise it's an empty string
+func CustomDomainURL(userName, dbName string) (string, error) {
+	if !config.Conf.Domains.Enabled {
+		return "", nil
+	}
+	domain, err := userCanonicalDomain(userName)
+	if err != nil || domain == "" {
+		return "", err
+	}
+	return fmt.Sprintf("https://%s/%s", domain, dbName), nil
+}
+
+// CustomDomainVerify checks the DNS TXT record of a custom domain holds its verification token, marking the domain as
+// verified when it does.  The record goes under the configured prefix, eg "_dbhub-verification.example.org".  The
+// first user to verify a domain gets it, and the claims other users have on it are removed
+func CustomDomainVerify(userName, domain string) (err error) {
+	domain = NormaliseDomain(domain)
+	list, err := CustomDomains(userName)
+	if err != nil {
+		return
+	}
+	var d *database.CustomDomain
+	for i := range list {
+		if strings.EqualFold(list[i].Domain, domain) {
+			d = &list[i]
+			break
+		}
+	}
+	if d == nil {
+		return errors.New("Unknown custom domain.  Domains not verified in time need adding again")
+	}
+	if d.DateVerified != nil {
+		return nil
+	}
+
+	record := config.Conf.Domains.TXTPrefix + "." + domain
+	txt, err := net.LookupTXT(record)
+	if err != nil {
+		log.Printf("Looking up the verification record '%s' of user '%s' failed: %v", SanitiseLogString(record),
+			SanitiseLogString(userName), err)
+		return fmt.Errorf("No TXT record was found for '%s'", record)
+	}
+	for _, t := range txt {
+		if strings.TrimSpace(t) == d.VerificationToken {
+			var verified bool
+			verified, err = database.CustomDomainVerified(userName, domain)
+			if err != nil {
+				return
+			}
+			if !verified {
+				return errors.New("That domain has already been verified by another user")
+			}
+			customDomainOwners.Lock()
+			delete(customDomainOwners.entries, domain)
+			customDomainOwners.Unlock()
+			invalidateCanonicalDomain(userName)
+			return nil
+		}
+	}
+	return fmt.Errorf("The TXT record for '%s' doesn't hold the verification token", record)
+}
+
+// CustomDomains returns the custom domains of a user, oldest first.  The domains which weren't verified in time are
+// removed first
+func CustomDomains(userName string) (list []database.CustomDomain, err error) {
+	err = database.CustomDomainsExpire(config.Conf.Domains.VerifyExpiry)
+	if err != nil {
+		return
+	}
+	return database.CustomDomains(userName)
+}
+
+// NormaliseDomain lower cases a domain name, removing any port and trailing dot
+func NormaliseDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if h, _, err := net.SplitHostPort(domain); err == nil {
+		domain = h
+	}
+	return strings.TrimSuffix(domain, ".")
+}
+
+// canonicalDomainCacheKey generates the cache key for the canonical domain of a user
+func canonicalDomainCacheKey(userName string) string {
+	tempArr := md5.Sum([]byte("canonicaldomain/" + strings.ToLower(userName)))
+	return hex.EncodeToString(tempArr[:])
+}
+
+// invalidateCanonicalDomain removes the cached canonical domain of a user, after their custom domains change
+func invalidateCanonicalDomain(userName string) {
+	err := DeleteCacheItem(canonicalDomainCacheKey(userName))
+	if err != nil && err != ErrCacheMiss {
+		log.Printf("Error when removing the cached canonical domain of user '%s': %v", SanitiseLogString(userName), err)
+	}
+}
+
+// userCanonicalDomain returns the verified custom domain the pages of a user are served from, or an empty string when
+// they don't have one.  It's cached in Memcached, as it's needed for each of their pages
+func userCanonicalDomain(userName string) (domain string, err error) {
+	cacheKey := canonicalDomainCacheKey(userName)
+	ok, err := GetCachedData(cacheKey, &domain)
+	if err != nil {
+		log.Printf("Error retrieving canonical domain from cache: %v", err)
+	}
+	if ok {
+		return
+	}
+
+	// The domain isn't cached, so retrieve it from PostgreSQL then cache it
+	domain, err = database.UserCanonicalDomain(userName)
+	if err != nil {
+		return
+	}
+	err = CacheData(cacheKey, domain, config.Conf.Memcache.DefaultCacheTime)
+	if err != nil {
+		log.Printf("Error when caching the canonical domain of user '%s': %v", SanitiseLogString(userName), err)
+	}
+	return domain, nil
+}
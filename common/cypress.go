@@ -52,7 +52,7 @@ func CypressSeed(w http.ResponseWriter, r *http.Request) {
 	_, _, _, err = AddDatabase("default", "default", "Assembly Election 2017.sqlite",
 		false, "", "", database.SetToPublic, "CC-BY-SA-4.0", "Initial commit",
 		"http://data.nicva.org/dataset/assembly-election-2017", testDB, time.Now(), time.Time{},
-		"", "", "", "", nil, "")
+		"", "", "", "", nil, "", AddDatabaseOptions{})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -66,7 +66,7 @@ func CypressSeed(w http.ResponseWriter, r *http.Request) {
 	_, _, _, err = AddDatabase("default", "default", "Assembly Election 2017 with view.sqlite",
 		false, "", "", database.SetToPrivate, "CC-BY-SA-4.0", "Initial commit",
 		"http://data.nicva.org/dataset/assembly-election-2017", testDB2, time.Now(), time.Time{},
-		"", "", "", "", nil, "")
+		"", "", "", "", nil, "", AddDatabaseOptions{})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -179,6 +179,19 @@ func CypressSeed(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Add an instance admin, for the tests of the admin only calls.  That includes the test fixtures call, which the
+	// tests use to add the data they need
+	err = database.AddUser("auth0testadmin", "testadmin", fmt.Sprintf("testadmin@%s", serverName[0]), "Admin test user", "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = database.SetUserAdmin("testadmin", true)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	// Add some API keys
 	keys := map[string]string{
 		// Old API key format
@@ -198,15 +211,16 @@ func CypressSeed(w http.ResponseWriter, r *http.Request) {
 		"NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g": "third",
 		"R4btZIUCGfLeIPJN1qDtBRuz7I6YWhiM2F0EOh3-neoLxqd9h7J8uw": "limited",
 		"bpS7m7zstkN-wxX0UMaUS11MfrSqlMsYkwmqZWbh1DThNgw5xhnnyA": "banned",
+		"lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ": "testadmin",
 	}
 	for key, user := range keys {
-		_, err = database.APIKeySave(key, user, time.Now(), nil, database.MayReadAndWrite, "Cypress tests")
+		_, err = database.APIKeySave(key, user, time.Now(), nil, database.MayReadAndWrite, "Cypress tests", nil)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 	}
-	_, err = database.APIKeySave("ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw", "default", time.Now(), nil, database.MayRead, "Cypress tests (ro)")
+	_, err = database.APIKeySave("ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw", "default", time.Now(), nil, database.MayRead, "Cypress tests (ro)", nil)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -244,6 +258,7 @@ func CypressSeed(w http.ResponseWriter, r *http.Request) {
 	database.SetUserLimits("first", 2)
 	database.SetUserLimits("second", 2)
 	database.SetUserLimits("third", 2)
+	database.SetUserLimits("testadmin", 2)
 	database.SetUserLimits("banned", 3)  // ID=3 is the 'banned' limit
 	database.SetUserLimits("limited", 4) // ID=4 should be the 'restrictive' limit that was just created
 	log.Println("Assigned usage limits to users")
@@ -0,0 +1,79 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// ErrDataCommentAnchor is returned when the row or cell a comment is attached to isn't part of the data diff of a
+// merge request
+var ErrDataCommentAnchor = errors.New("The table needs to be changed by the merge request, the key needs to give " +
+	"the primary key of a changed row, and the column needs to exist in the table")
+
+// DataCommentAnchorCheck makes sure a comment can be attached to a row or cell of the data diff of a merge request.
+// The row needs to be added, changed, or deleted by the merge request.  The commit of the anchor is set to the head
+// commit of the merge request, so it's clear which version of the changes the comment was about
+func DataCommentAnchorCheck(destOwner, destName string, mr database.MergeRequestEntry, anchor *database.DataCommentAnchor) (err error) {
+	if len(mr.Commits) == 0 {
+		return ErrDataCommentAnchor
+	}
+	dest, head, err := mergeRequestDatabases(destOwner, destName, mr)
+	if err != nil {
+		return
+	}
+
+	// Look up the columns of the table, from the merge request when it still has the table
+	sdb, err := openDiffDatabases(dest, head)
+	if err != nil {
+		return
+	}
+	pks, _, other, err := GetPrimaryKeyAndOtherColumns(sdb, "aux", anchor.Table)
+	if err == nil && len(pks) == 0 {
+		pks, _, other, err = GetPrimaryKeyAndOtherColumns(sdb, "main", anchor.Table)
+	}
+	sdb.Close()
+	if err != nil {
+		return
+	}
+	if len(pks) != len(anchor.Key) {
+		return ErrDataCommentAnchor
+	}
+	columnFound := anchor.Column == ""
+	for _, c := range append(append([]string{}, pks...), other...) {
+		if c == anchor.Column {
+			columnFound = true
+		}
+	}
+	if !columnFound {
+		return ErrDataCommentAnchor
+	}
+
+	// Find the row among the changes to the table
+	diffs, err := DBDiff(dest, head, NoMerge, false)
+	if err != nil {
+		return
+	}
+	for _, d := range diffs.Diff {
+		if d.ObjectType != "table" || d.ObjectName != anchor.Table {
+			continue
+		}
+		for _, row := range d.Data {
+			if len(row.Pk) != len(pks) {
+				continue
+			}
+			match := true
+			for i, p := range pks {
+				if v, ok := anchor.Key[p]; !ok || v != fmt.Sprint(row.Pk[i].Value) {
+					match = false
+				}
+			}
+			if match {
+				anchor.Commit = mr.Commits[0].ID
+				return nil
+			}
+		}
+	}
+	return ErrDataCommentAnchor
+}
@@ -0,0 +1,283 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+const (
+	// AlertHistoryMaxEvents is the number of evaluations kept in the history of each alert rule
+	AlertHistoryMaxEvents = 100
+
+	// AlertRuleMaxRules is the most alert rules each user can have
+	AlertRuleMaxRules = 25
+)
+
+// AlertEvent is one evaluation of an alert rule.  Previous is the value from the evaluation before it, used by the
+// "drop" and "rise" conditions
+type AlertEvent struct {
+	Error     string    `json:"error"`
+	EventID   int64     `json:"event_id"`
+	Evaluated time.Time `json:"evaluated"`
+	Notified  bool      `json:"notified"`
+	Previous  *float64  `json:"previous"`
+	Triggered bool      `json:"triggered"`
+	Value     *float64  `json:"value"`
+}
+
+// AlertRule runs a saved query against a live database on a cron schedule, and checks a metric of its result against a
+// condition.  The metric is either the number of rows returned, or the numeric value of the first column of the first
+// row.  Triggered is whether the condition was met at the last successful evaluation, so the owner is only notified
+// when it starts being met
+type AlertRule struct {
+	Condition     string     `json:"condition"`
+	DateCreated   time.Time  `json:"date_created"`
+	DBName        string     `json:"database"`
+	DBOwner       string     `json:"owner"`
+	Delivery      string     `json:"delivery"`
+	LastError     string     `json:"last_error"`
+	LastModified  time.Time  `json:"last_modified"`
+	LastRun       *time.Time `json:"last_run"`
+	LastValue     *float64   `json:"last_value"`
+	Metric        string     `json:"metric"`
+	Name          string     `json:"name"`
+	NextRun       time.Time  `json:"next_run"`
+	QueryName     string     `json:"query_name"`
+	RuleID        int64      `json:"-"`
+	Schedule      string     `json:"schedule"`
+	Threshold     float64    `json:"threshold"`
+	Triggered     bool       `json:"triggered"`
+	User          string     `json:"user"`
+	WebhookSecret string     `json:"webhook_secret,omitempty"`
+	WebhookURL    string     `json:"webhook_url,omitempty"`
+}
+
+// AlertEvaluationSave records an evaluation of an alert rule, along with when it's next due.  When a notification email
+// is given it's queued for the rule owner.  When the evaluation fails after the previous one succeeded, the rule owner
+// is emailed the given failure message instead
+func AlertEvaluationSave(r AlertRule, e AlertEvent, nextRun time.Time, failSubj, failMsg, notifySubj, notifyMsg string) (err error) {
+	ctx := context.Background()
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Update the rule.  Failed evaluations don't change its value or triggered state, and the previous error is kept so
+	// we can tell if it was already failing
+	dbQuery := `
+		UPDATE alert_rules AS a
+		SET next_run = $2,
+			last_run = $3,
+			last_error = $4,
+			last_value = CASE WHEN $4 = '' THEN $5 ELSE a.last_value END,
+			triggered = CASE WHEN $4 = '' THEN $6 ELSE a.triggered END
+		FROM alert_rules AS prev
+		WHERE prev.rule_id = a.rule_id
+			AND a.rule_id = $1
+		RETURNING prev.last_error, prev.last_run`
+	var prevError string
+	var prevRun *time.Time
+	err = tx.QueryRow(ctx, dbQuery, r.RuleID, nextRun, e.Evaluated, e.Error, e.Value, e.Triggered).Scan(&prevError,
+		&prevRun)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The rule was deleted while it was being evaluated
+		return nil
+	}
+	if err != nil {
+		log.Printf("Recording the evaluation of alert rule '%s' of '%s' failed: %v", r.Name, r.User, err)
+		return
+	}
+
+	// Add the evaluation to the history, only keeping the most recent ones
+	dbQuery = `
+		INSERT INTO alert_history (rule_id, evaluated, value, previous, triggered, notified, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err = tx.Exec(ctx, dbQuery, r.RuleID, e.Evaluated, e.Value, e.Previous, e.Triggered, e.Notified, e.Error)
+	if err != nil {
+		log.Printf("Recording the evaluation of alert rule '%s' of '%s' failed: %v", r.Name, r.User, err)
+		return
+	}
+	dbQuery = `
+		DELETE FROM alert_history
+		WHERE rule_id = $1
+			AND event_id NOT IN (
+				SELECT event_id
+				FROM alert_history
+				WHERE rule_id = $1
+				ORDER BY evaluated DESC
+				LIMIT $2
+			)`
+	_, err = tx.Exec(ctx, dbQuery, r.RuleID, AlertHistoryMaxEvents)
+	if err != nil {
+		log.Printf("Trimming the history of alert rule '%s' of '%s' failed: %v", r.Name, r.User, err)
+		return
+	}
+
+	// Only tell the owner about failures when a rule starts failing, rather than on every failed evaluation
+	subj, msg := notifySubj, notifyMsg
+	if e.Error != "" {
+		subj, msg = "", ""
+		if prevError == "" || prevRun == nil {
+			subj, msg = failSubj, failMsg
+		}
+	}
+	if msg != "" {
+		dbQuery = `
+			INSERT INTO email_queue (mail_to, subject, body)
+			SELECT email, $2, $3
+			FROM users
+			WHERE lower(user_name) = lower($1)
+				AND email IS NOT NULL
+				AND email != ''`
+		_, err = tx.Exec(ctx, dbQuery, r.User, subj, msg)
+		if err != nil {
+			log.Printf("Queuing the alert email for '%s' failed: %v", r.User, err)
+			return
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// AlertHistory returns the most recent evaluations of an alert rule, newest first
+func AlertHistory(loggedInUser, name string) (list []AlertEvent, err error) {
+	dbQuery := `
+		SELECT h.event_id, h.evaluated, h.value, h.previous, h.triggered, h.notified, h.error
+		FROM alert_history AS h
+			JOIN alert_rules AS a ON a.rule_id = h.rule_id
+		WHERE a.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND a.name = $2
+		ORDER BY h.evaluated DESC, h.event_id DESC
+		LIMIT $3`
+	rows, err := DB.Query(context.Background(), dbQuery, loggedInUser, name, AlertHistoryMaxEvents)
+	if err != nil {
+		log.Printf("Retrieving the history of alert rule '%s' of '%s' failed: %v", name, loggedInUser, err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (e AlertEvent, err error) {
+		err = row.Scan(&e.EventID, &e.Evaluated, &e.Value, &e.Previous, &e.Triggered, &e.Notified, &e.Error)
+		return
+	})
+	if err != nil {
+		log.Printf("Retrieving the history of alert rule '%s' of '%s' failed: %v", name, loggedInUser, err)
+	}
+	return
+}
+
+// AlertRuleDelete removes an alert rule, along with its history.  The returned boolean is false when it didn't exist
+func AlertRuleDelete(loggedInUser, name string) (exists bool, err error) {
+	dbQuery := `
+		DELETE FROM alert_rules
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND name = $2`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, loggedInUser, name)
+	if err != nil {
+		log.Printf("Deleting the alert rule '%s' of '%s' failed: %v", name, loggedInUser, err)
+		return
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+// AlertRuleSave adds an alert rule, or changes an existing one.  New rules are given a random secret for signing their
+// webhook requests, which existing ones keep.  Changing a rule resets its state, as the previous value may no longer
+// be comparable.  The secret of the rule is returned
+func AlertRuleSave(r AlertRule) (secret string, err error) {
+	data := make([]byte, 32)
+	_, err = rand.Read(data)
+	if err != nil {
+		return
+	}
+	dbQuery := `
+		INSERT INTO alert_rules (user_id, name, db_id, query_name, schedule, metric, condition, threshold, delivery,
+			webhook_url, webhook_secret, next_run)
+		SELECT (SELECT user_id FROM users WHERE lower(user_name) = lower($1)), $2, db.db_id, $5, $6, $7, $8, $9, $10,
+			$11, $12, $13
+		FROM sqlite_databases AS db
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($3))
+			AND db.db_name = $4
+			AND db.is_deleted = false
+		ON CONFLICT (user_id, name)
+			DO UPDATE
+			SET db_id = excluded.db_id,
+				query_name = excluded.query_name,
+				schedule = excluded.schedule,
+				metric = excluded.metric,
+				condition = excluded.condition,
+				threshold = excluded.threshold,
+				delivery = excluded.delivery,
+				webhook_url = excluded.webhook_url,
+				next_run = excluded.next_run,
+				last_value = NULL,
+				last_error = '',
+				triggered = false,
+				last_modified = now()
+		RETURNING webhook_secret`
+	err = DB.QueryRow(context.Background(), dbQuery, r.User, r.Name, r.DBOwner, r.DBName, r.QueryName, r.Schedule,
+		r.Metric, r.Condition, r.Threshold, r.Delivery, r.WebhookURL, hex.EncodeToString(data), r.NextRun).Scan(&secret)
+	if err != nil {
+		log.Printf("Saving the alert rule '%s' of '%s' failed: %v", r.Name, r.User, err)
+	}
+	return
+}
+
+// AlertRules returns the alert rules of a user, in name order
+func AlertRules(loggedInUser string) (list []AlertRule, err error) {
+	dbQuery := `
+		SELECT a.rule_id, u.user_name, a.name, owner.user_name, db.db_name, a.query_name, a.schedule, a.metric,
+			a.condition, a.threshold, a.delivery, a.webhook_url, a.webhook_secret, a.next_run, a.last_run, a.last_value,
+			a.last_error, a.triggered, a.date_created, a.last_modified
+		FROM alert_rules AS a
+			JOIN users AS u ON u.user_id = a.user_id
+			JOIN sqlite_databases AS db ON db.db_id = a.db_id
+			JOIN users AS owner ON owner.user_id = db.user_id
+		WHERE lower(u.user_name) = lower($1)
+		ORDER BY a.name`
+	rows, err := DB.Query(context.Background(), dbQuery, loggedInUser)
+	if err != nil {
+		log.Printf("Retrieving the alert rules of '%s' failed: %v", loggedInUser, err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, scanAlertRule)
+	if err != nil {
+		log.Printf("Retrieving the alert rules of '%s' failed: %v", loggedInUser, err)
+	}
+	return
+}
+
+// AlertRulesDue returns the alert rules which are due to be evaluated
+func AlertRulesDue() (list []AlertRule, err error) {
+	dbQuery := `
+		SELECT a.rule_id, u.user_name, a.name, owner.user_name, db.db_name, a.query_name, a.schedule, a.metric,
+			a.condition, a.threshold, a.delivery, a.webhook_url, a.webhook_secret, a.next_run, a.last_run, a.last_value,
+			a.last_error, a.triggered, a.date_created, a.last_modified
+		FROM alert_rules AS a
+			JOIN users AS u ON u.user_id = a.user_id
+			JOIN sqlite_databases AS db ON db.db_id = a.db_id
+			JOIN users AS owner ON owner.user_id = db.user_id
+		WHERE a.next_run <= now()
+		ORDER BY a.next_run`
+	rows, err := DB.Query(context.Background(), dbQuery)
+	if err != nil {
+		log.Printf("Retrieving the due alert rules failed: %v", err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, scanAlertRule)
+	if err != nil {
+		log.Printf("Retrieving the due alert rules failed: %v", err)
+	}
+	return
+}
+
+// scanAlertRule reads an alert rule from a row returned by AlertRules() or AlertRulesDue()
+func scanAlertRule(row pgx.CollectableRow) (r AlertRule, err error) {
+	err = row.Scan(&r.RuleID, &r.User, &r.Name, &r.DBOwner, &r.DBName, &r.QueryName, &r.Schedule, &r.Metric,
+		&r.Condition, &r.Threshold, &r.Delivery, &r.WebhookURL, &r.WebhookSecret, &r.NextRun, &r.LastRun, &r.LastValue,
+		&r.LastError, &r.Triggered, &r.DateCreated, &r.LastModified)
+	return
+}
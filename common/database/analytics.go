@@ -0,0 +1,114 @@
+package database
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// AnalyticsDay holds the traffic of a database on a single day
+type AnalyticsDay struct {
+	APIQueries int    `json:"api_queries"`
+	Clones     int    `json:"clones"`
+	Date       string `json:"date"`
+	Downloads  int    `json:"downloads"`
+	Views      int    `json:"views"`
+}
+
+// Analytics returns the daily traffic of a database between two dates (inclusive).  Days without any traffic are
+// included in the list, with zero counts
+func Analytics(dbOwner, dbName string, from, to time.Time) (days []AnalyticsDay, err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+				AND is_deleted = false
+		)
+		SELECT to_char(s.day, 'YYYY-MM-DD'), coalesce(a.downloads, 0), coalesce(a.clones, 0), coalesce(a.views, 0),
+			coalesce(a.api_queries, 0)
+		FROM generate_series($3::date, $4::date, interval '1 day') AS s(day)
+			LEFT JOIN database_analytics AS a
+				ON a.day = s.day::date
+				AND a.db_id = (SELECT db_id FROM d)
+		ORDER BY s.day`
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName, from, to)
+	if err != nil {
+		log.Printf("Retrieving the analytics for '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var day AnalyticsDay
+		err = rows.Scan(&day.Date, &day.Downloads, &day.Clones, &day.Views, &day.APIQueries)
+		if err != nil {
+			log.Printf("Error retrieving the analytics for '%s/%s': %v", dbOwner, dbName, err)
+			return nil, err
+		}
+		days = append(days, day)
+	}
+	return
+}
+
+// AnalyticsAddViews adds to today's view count of a database
+func AnalyticsAddViews(dbOwner, dbName string, views int) (err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		)
+		INSERT INTO database_analytics (db_id, day, views)
+		SELECT db.db_id, (now() AT TIME ZONE 'UTC')::date, $3
+		FROM sqlite_databases AS db, u
+		WHERE db.user_id = u.user_id
+			AND db.db_name = $2
+		ON CONFLICT (db_id, day) DO UPDATE
+			SET views = database_analytics.views + excluded.views`
+	_, err = DB.Exec(context.Background(), dbQuery, dbOwner, dbName, views)
+	if err != nil {
+		log.Printf("Adding %d views to the analytics for '%s/%s' failed: %v", views, dbOwner, dbName, err)
+	}
+	return
+}
+
+// AnalyticsAggregate updates the daily download, clone, and API query counts of all databases, from the download and
+// API call logs.  Only the days from the given time onwards are updated.  Downloads by DB4S and Dio are counted as
+// clones, while downloads through the webUI and API are counted as downloads
+func AnalyticsAggregate(since time.Time) (err error) {
+	dbQuery := `
+		WITH dl AS (
+			SELECT db_id, (download_date AT TIME ZONE 'UTC')::date AS day,
+				count(*) FILTER (WHERE server_sw <> 'db4s') AS downloads,
+				count(*) FILTER (WHERE server_sw = 'db4s') AS clones
+			FROM database_downloads
+			WHERE download_date >= $1
+			GROUP BY 1, 2
+		), api AS (
+			SELECT db_id, (api_call_date AT TIME ZONE 'UTC')::date AS day, count(*) AS api_queries
+			FROM api_call_log
+			WHERE db_id IN (SELECT db_id FROM sqlite_databases)
+				AND api_operation = '/v1/query'
+				AND api_call_date >= $1
+			GROUP BY 1, 2
+		)
+		INSERT INTO database_analytics (db_id, day, downloads, clones, api_queries)
+		SELECT coalesce(dl.db_id, api.db_id), coalesce(dl.day, api.day), coalesce(dl.downloads, 0),
+			coalesce(dl.clones, 0), coalesce(api.api_queries, 0)
+		FROM dl
+			FULL OUTER JOIN api ON api.db_id = dl.db_id AND api.day = dl.day
+		ON CONFLICT (db_id, day) DO UPDATE
+			SET downloads = excluded.downloads,
+				clones = excluded.clones,
+				api_queries = excluded.api_queries`
+	_, err = DB.Exec(context.Background(), dbQuery, since)
+	if err != nil {
+		log.Printf("Aggregating the database analytics failed: %v", err)
+	}
+	return
+}
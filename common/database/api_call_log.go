@@ -10,6 +10,35 @@ import (
 	"github.com/jackc/pgx/v5/pgconn"
 )
 
+// ApiCall holds the details of a single logged API call.  The key details are empty for calls made from the web UI, or
+// with a key which has since been deleted
+type ApiCall struct {
+	Date         time.Time `json:"date"`
+	DBName       string    `json:"database"`
+	DBOwner      string    `json:"owner"`
+	Endpoint     string    `json:"endpoint"`
+	KeyComment   string    `json:"key_comment"`
+	KeyUuid      string    `json:"key_uuid"`
+	Method       string    `json:"method"`
+	RequestSize  int64     `json:"request_size"`
+	ResponseSize int64     `json:"response_size"`
+	Runtime      float64   `json:"runtime_ms"`
+	StatusCode   int       `json:"status_code"`
+	UserAgent    string    `json:"user_agent"`
+}
+
+// ApiKeyUsage holds a summary of the API calls made with one API key
+type ApiKeyUsage struct {
+	AvgRuntime   float64    `json:"avg_runtime_ms"`
+	Errors       int64      `json:"errors"`
+	KeyComment   string     `json:"key_comment"`
+	KeyUuid      string     `json:"key_uuid"`
+	LastCall     *time.Time `json:"last_call"`
+	NumCalls     int64      `json:"num_calls"`
+	RequestSize  int64      `json:"request_size"`
+	ResponseSize int64      `json:"response_size"`
+}
+
 type ApiUsage struct {
 	Date         string `json:"date"`
 	NumCalls     int64  `json:"num_calls"`
@@ -62,6 +91,109 @@ func ApiCallLog(key APIKey, loggedInUser, dbOwner, dbName, operation, callerSw,
 	}
 }
 
+// ApiCalls returns a page of the most recent API calls made by a user, newest first.  The calls can optionally be
+// limited to those made with one API key (given by its uuid), and to failed calls (those with a 4xx or 5xx status
+// code).  The total number of matching calls is returned too, for paging
+func ApiCalls(user, keyUuid string, failedOnly bool, offset, limit int) (list []ApiCall, total int, err error) {
+	dbQuery := `
+		WITH userData AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		)
+		SELECT l.api_call_date, coalesce(owner.user_name, ''), coalesce(db.db_name, ''), l.api_operation,
+			coalesce(k.uuid::text, ''), coalesce(k.comment, ''), coalesce(l.method, ''), coalesce(l.status_code, 0),
+			coalesce(l.runtime, 0) / 1000000.0, coalesce(l.request_size, 0), coalesce(l.response_size, 0),
+			coalesce(l.api_caller_sw, ''), count(*) OVER ()
+		FROM api_call_log AS l
+			LEFT JOIN api_keys AS k ON k.key_id = l.key_id
+			LEFT JOIN users AS owner ON owner.user_id = l.db_owner_id
+			LEFT JOIN sqlite_databases AS db ON db.db_id = l.db_id
+		WHERE l.caller_id = (SELECT user_id FROM userData)
+			AND ($2 = '' OR k.uuid::text = lower($2))
+			AND ($3 = false OR l.status_code >= 400)
+		ORDER BY l.api_call_date DESC, l.api_call_id DESC
+		OFFSET $4
+		LIMIT nullif($5, 0)`
+	rows, err := DB.Query(context.Background(), dbQuery, user, keyUuid, failedOnly, offset, limit)
+	if err != nil {
+		log.Printf("Retrieving the API calls of user '%s' failed: %v", user, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a ApiCall
+		err = rows.Scan(&a.Date, &a.DBOwner, &a.DBName, &a.Endpoint, &a.KeyUuid, &a.KeyComment, &a.Method,
+			&a.StatusCode, &a.Runtime, &a.RequestSize, &a.ResponseSize, &a.UserAgent, &total)
+		if err != nil {
+			log.Printf("Error retrieving the API calls of user '%s': %v", user, err)
+			return nil, 0, err
+		}
+		list = append(list, a)
+	}
+
+	// When the requested page is past the end of the list there aren't any rows to take the total from
+	if len(list) == 0 && offset > 0 {
+		dbQuery = `
+			WITH userData AS (
+				SELECT user_id
+				FROM users
+				WHERE lower(user_name) = lower($1)
+			)
+			SELECT count(*)
+			FROM api_call_log AS l
+				LEFT JOIN api_keys AS k ON k.key_id = l.key_id
+			WHERE l.caller_id = (SELECT user_id FROM userData)
+				AND ($2 = '' OR k.uuid::text = lower($2))
+				AND ($3 = false OR l.status_code >= 400)`
+		err = DB.QueryRow(context.Background(), dbQuery, user, keyUuid, failedOnly).Scan(&total)
+		if err != nil {
+			log.Printf("Error counting the API calls of user '%s': %v", user, err)
+			return
+		}
+	}
+	return
+}
+
+// ApiKeyUsageSummary returns a summary of the API calls made with each of a user's API keys since the given time.
+// Keys which haven't been used in that time are included too, with zero counts
+func ApiKeyUsageSummary(user string, since time.Time) (list []ApiKeyUsage, err error) {
+	dbQuery := `
+		WITH userData AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		)
+		SELECT k.uuid::text, coalesce(k.comment, ''), count(l.api_call_id),
+			count(l.api_call_id) FILTER (WHERE l.status_code >= 400),
+			coalesce(avg(l.runtime) / 1000000.0, 0), coalesce(sum(l.request_size), 0)::bigint,
+			coalesce(sum(l.response_size), 0)::bigint, max(l.api_call_date)
+		FROM api_keys AS k
+			LEFT JOIN api_call_log AS l
+				ON l.key_id = k.key_id
+				AND l.api_call_date >= $2
+		WHERE k.user_id = (SELECT user_id FROM userData)
+		GROUP BY k.key_id, k.uuid, k.comment, k.date_created
+		ORDER BY k.date_created`
+	rows, err := DB.Query(context.Background(), dbQuery, user, since)
+	if err != nil {
+		log.Printf("Retrieving the API key usage of user '%s' failed: %v", user, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var u ApiKeyUsage
+		err = rows.Scan(&u.KeyUuid, &u.KeyComment, &u.NumCalls, &u.Errors, &u.AvgRuntime, &u.RequestSize,
+			&u.ResponseSize, &u.LastCall)
+		if err != nil {
+			log.Printf("Error retrieving the API key usage of user '%s': %v", user, err)
+			return nil, err
+		}
+		list = append(list, u)
+	}
+	return
+}
+
 func ApiUsageData(user string, from, to time.Time) (usage []ApiUsage, err error) {
 	query := `
 		WITH userData AS (
@@ -23,6 +23,9 @@ type APIKey struct {
 	ExpiryDate  *time.Time
 	Comment     string
 	Permissions ShareDatabasePermissions
+
+	// The origins browsers may use the key from.  When empty, the key can be used from any origin
+	AllowedOrigins []string
 }
 
 // APIKeyDelete deletes an existing API key from the PostgreSQL database
@@ -41,7 +44,7 @@ func APIKeyDelete(loggedInUser, uuid string) (err error) {
 }
 
 // APIKeyGenerate generates a random API key and saves it in the database
-func APIKeyGenerate(loggedInUser string, expiryDate *time.Time, permissions ShareDatabasePermissions, comment string) (key APIKey, err error) {
+func APIKeyGenerate(loggedInUser string, expiryDate *time.Time, permissions ShareDatabasePermissions, comment string, allowedOrigins []string) (key APIKey, err error) {
 	// Generate key
 	length := 40
 	data := make([]byte, length)
@@ -63,13 +66,17 @@ func APIKeyGenerate(loggedInUser string, expiryDate *time.Time, permissions Shar
 	// Set comment
 	key.Comment = comment
 
+	// Set the allowed origins
+	key.AllowedOrigins = allowedOrigins
+
 	// Save new key
-	key.Uuid, err = APIKeySave(key.Key, loggedInUser, key.DateCreated, key.ExpiryDate, key.Permissions, key.Comment)
+	key.Uuid, err = APIKeySave(key.Key, loggedInUser, key.DateCreated, key.ExpiryDate, key.Permissions, key.Comment,
+		key.AllowedOrigins)
 	return
 }
 
 // APIKeySave saves a new API key to the PostgreSQL database
-func APIKeySave(key, loggedInUser string, dateCreated time.Time, expiryDate *time.Time, permissions ShareDatabasePermissions, comment string) (uuid string, err error) {
+func APIKeySave(key, loggedInUser string, dateCreated time.Time, expiryDate *time.Time, permissions ShareDatabasePermissions, comment string, allowedOrigins []string) (uuid string, err error) {
 	// Hash the key
 	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(key)))
 
@@ -92,10 +99,16 @@ func APIKeySave(key, loggedInUser string, dateCreated time.Time, expiryDate *tim
 
 	// Add the new API key to the database
 	dbQuery = `
-		INSERT INTO api_keys (user_id, key, date_created, expiry_date, permissions, comment)
-		SELECT (SELECT user_id FROM users WHERE lower(user_name) = lower($1)), $2, $3, $4, $5, $6
+		INSERT INTO api_keys (user_id, key, date_created, expiry_date, permissions, comment, allowed_origins)
+		SELECT (SELECT user_id FROM users WHERE lower(user_name) = lower($1)), $2, $3, $4, $5, $6, $7
 		RETURNING concat(uuid, '')`
-	err = DB.QueryRow(context.Background(), dbQuery, loggedInUser, hash, dateCreated, expiryDate, permissions, comment).Scan(&uuid)
+	// Store NULL rather than an empty list when all origins are allowed
+	var origins []string
+	if len(allowedOrigins) > 0 {
+		origins = allowedOrigins
+	}
+	err = DB.QueryRow(context.Background(), dbQuery, loggedInUser, hash, dateCreated, expiryDate, permissions, comment,
+		origins).Scan(&uuid)
 	if err != nil {
 		log.Printf("Adding API key to database failed: %v", err)
 		return
@@ -106,7 +119,8 @@ func APIKeySave(key, loggedInUser string, dateCreated time.Time, expiryDate *tim
 // GetAPIKeys returns the list of API keys for a user
 func GetAPIKeys(user string) ([]APIKey, error) {
 	dbQuery := `
-		SELECT key_id, uuid, date_created, expiry_date, permissions, coalesce(comment, '')
+		SELECT key_id, uuid, date_created, expiry_date, permissions, coalesce(comment, ''),
+			coalesce(allowed_origins, '{}')
 		FROM api_keys
 		WHERE user_id = (
 				SELECT user_id
@@ -122,7 +136,8 @@ func GetAPIKeys(user string) ([]APIKey, error) {
 	var keys []APIKey
 	for rows.Next() {
 		var key APIKey
-		err = rows.Scan(&key.ID, &key.Uuid, &key.DateCreated, &key.ExpiryDate, &key.Permissions, &key.Comment)
+		err = rows.Scan(&key.ID, &key.Uuid, &key.DateCreated, &key.ExpiryDate, &key.Permissions, &key.Comment,
+			&key.AllowedOrigins)
 		if err != nil {
 			log.Printf("Error retrieving API key list: %v", err)
 			return nil, err
@@ -138,12 +153,15 @@ func GetAPIKeyBySecret(secret string) (user string, key APIKey, err error) {
 	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(secret)))
 
 	dbQuery := `
-		SELECT user_name, key_id, uuid, date_created, expiry_date, permissions, coalesce(comment, '')
+		SELECT user_name, key_id, uuid, date_created, expiry_date, permissions, coalesce(comment, ''),
+			coalesce(allowed_origins, '{}')
 		FROM api_keys AS api, users
 		WHERE api.key = $1
 			AND api.user_id = users.user_id
+			AND users.banned = false
 			AND (api.expiry_date is null OR api.expiry_date > now())`
-	err = DB.QueryRow(context.Background(), dbQuery, hash).Scan(&user, &key.ID, &key.Uuid, &key.DateCreated, &key.ExpiryDate, &key.Permissions, &key.Comment)
+	err = DB.QueryRow(context.Background(), dbQuery, hash).Scan(&user, &key.ID, &key.Uuid, &key.DateCreated, &key.ExpiryDate, &key.Permissions, &key.Comment,
+		&key.AllowedOrigins)
 	if err != nil {
 		return
 	}
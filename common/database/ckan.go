@@ -0,0 +1,155 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// CKANIntegration is the connection between a database and a dataset in a CKAN catalog.  In "publish" mode the
+// releases of the database are published to the dataset, and in "harvest" mode the CSV resources of the dataset are
+// committed to the database when they change.  SyncedVersion is the last release published, or the modification time of
+// the last dataset version harvested.  The API token is never returned to users
+type CKANIntegration struct {
+	APIToken      string     `json:"-"`
+	DateCreated   time.Time  `json:"date_created"`
+	DBName        string     `json:"database"`
+	DBOwner       string     `json:"owner"`
+	Dataset       string     `json:"dataset"`
+	LastError     string     `json:"last_error"`
+	LastSync      *time.Time `json:"last_sync"`
+	Mode          string     `json:"mode"`
+	Organization  string     `json:"organization"`
+	SyncedVersion string     `json:"synced_version"`
+	URL           string     `json:"url"`
+}
+
+// CKANIntegrationFor returns the CKAN integration of a database.  The returned boolean is false when it doesn't have one
+func CKANIntegrationFor(dbOwner, dbName string) (integ CKANIntegration, exists bool, err error) {
+	dbQuery := `
+		SELECT u.user_name, db.db_name, i.mode, i.ckan_url, i.ckan_dataset, i.ckan_organization, i.api_token,
+			i.synced_version, i.last_sync, i.last_error, i.date_created
+		FROM ckan_integrations AS i
+			JOIN sqlite_databases AS db ON db.db_id = i.db_id
+			JOIN users AS u ON u.user_id = db.user_id
+		WHERE lower(u.user_name) = lower($1)
+			AND db.db_name = $2
+			AND db.is_deleted = false`
+	err = DB.QueryRow(context.Background(), dbQuery, dbOwner, dbName).Scan(&integ.DBOwner, &integ.DBName, &integ.Mode,
+		&integ.URL, &integ.Dataset, &integ.Organization, &integ.APIToken, &integ.SyncedVersion, &integ.LastSync,
+		&integ.LastError, &integ.DateCreated)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return integ, false, nil
+	}
+	if err != nil {
+		log.Printf("Retrieving the CKAN integration of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	return integ, true, nil
+}
+
+// CKANIntegrations returns the CKAN integrations of all databases, for the background sync
+func CKANIntegrations() (list []CKANIntegration, err error) {
+	dbQuery := `
+		SELECT u.user_name, db.db_name, i.mode, i.ckan_url, i.ckan_dataset, i.ckan_organization, i.api_token,
+			i.synced_version, i.last_sync, i.last_error, i.date_created
+		FROM ckan_integrations AS i
+			JOIN sqlite_databases AS db ON db.db_id = i.db_id
+			JOIN users AS u ON u.user_id = db.user_id
+		WHERE db.is_deleted = false
+		ORDER BY i.last_sync NULLS FIRST`
+	rows, err := DB.Query(context.Background(), dbQuery)
+	if err != nil {
+		log.Printf("Retrieving the CKAN integrations failed: %v", err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, scanCKANIntegration)
+	if err != nil {
+		log.Printf("Retrieving the CKAN integrations failed: %v", err)
+	}
+	return
+}
+
+// CKANIntegrationRemove disconnects a database from its CKAN dataset.  The returned boolean is false when it wasn't
+// connected to one
+func CKANIntegrationRemove(dbOwner, dbName string) (exists bool, err error) {
+	dbQuery := `
+		DELETE FROM ckan_integrations
+		WHERE db_id = (
+				SELECT db_id
+				FROM sqlite_databases
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+					AND db_name = $2
+					AND is_deleted = false
+			)`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName)
+	if err != nil {
+		log.Printf("Removing the CKAN integration of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+// CKANIntegrationSave connects a database to a CKAN dataset, replacing any existing connection.  When the API token is
+// empty, the token of the existing connection to the same catalog is kept
+func CKANIntegrationSave(integ CKANIntegration) (err error) {
+	dbQuery := `
+		INSERT INTO ckan_integrations (db_id, mode, ckan_url, ckan_dataset, ckan_organization, api_token, synced_version)
+		SELECT db_id, $3, $4, $5, $6, $7, $8
+		FROM sqlite_databases
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db_name = $2
+			AND is_deleted = false
+		ON CONFLICT (db_id)
+			DO UPDATE
+			SET mode = $3,
+				ckan_url = $4,
+				ckan_dataset = $5,
+				ckan_organization = $6,
+				api_token = CASE WHEN $7 = '' AND ckan_integrations.ckan_url = $4 THEN ckan_integrations.api_token ELSE $7 END,
+				synced_version = $8,
+				last_sync = NULL,
+				last_error = ''`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, integ.DBOwner, integ.DBName, integ.Mode, integ.URL,
+		integ.Dataset, integ.Organization, integ.APIToken, integ.SyncedVersion)
+	if err != nil {
+		log.Printf("Saving the CKAN integration of '%s/%s' failed: %v", integ.DBOwner, integ.DBName, err)
+		return
+	}
+	if commandTag.RowsAffected() != 1 {
+		return errors.New("Database not found")
+	}
+	return
+}
+
+// CKANIntegrationSynced records the outcome of syncing a database with its CKAN dataset.  The synced version is only
+// changed when the sync succeeded
+func CKANIntegrationSynced(dbOwner, dbName, syncedVersion, syncError string) (err error) {
+	dbQuery := `
+		UPDATE ckan_integrations
+		SET synced_version = CASE WHEN $4 = '' THEN $3 ELSE synced_version END,
+			last_sync = now(),
+			last_error = $4
+		WHERE db_id = (
+				SELECT db_id
+				FROM sqlite_databases
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+					AND db_name = $2
+					AND is_deleted = false
+			)`
+	_, err = DB.Exec(context.Background(), dbQuery, dbOwner, dbName, syncedVersion, syncError)
+	if err != nil {
+		log.Printf("Recording the CKAN sync of '%s/%s' failed: %v", dbOwner, dbName, err)
+	}
+	return
+}
+
+// scanCKANIntegration reads a CKAN integration from a query result row
+func scanCKANIntegration(row pgx.CollectableRow) (i CKANIntegration, err error) {
+	err = row.Scan(&i.DBOwner, &i.DBName, &i.Mode, &i.URL, &i.Dataset, &i.Organization, &i.APIToken,
+		&i.SyncedVersion, &i.LastSync, &i.LastError, &i.DateCreated)
+	return
+}
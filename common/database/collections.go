@@ -0,0 +1,427 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// Collection holds the details of a collection, which is a named list of public databases curated by a user
+type Collection struct {
+	DatabaseCount int       `json:"database_count"`
+	DateCreated   time.Time `json:"date_created"`
+	Description   string    `json:"description"`
+	LastModified  time.Time `json:"last_modified"`
+	Name          string    `json:"name"`
+	Owner         string    `json:"owner"`
+	Public        bool      `json:"public"`
+	Stars         int       `json:"stars"`
+}
+
+// CollectionEntry holds the details of a database in a collection
+type CollectionEntry struct {
+	Database  string    `json:"database"`
+	DateAdded time.Time `json:"date_added"`
+	Note      string    `json:"note"`
+	Owner     string    `json:"owner"`
+	Position  int       `json:"position"`
+}
+
+// collectionFields are the columns returned for each collection by the collection queries.  Databases which have been
+// deleted or made private since being added aren't counted
+const collectionFields = `
+	u.user_name, col.name, col.description, col.public, col.stars, col.date_created, col.last_modified,
+	(
+		SELECT count(*)
+		FROM collection_entries AS e
+			JOIN sqlite_databases AS db ON db.db_id = e.db_id
+		WHERE e.collection_id = col.collection_id
+			AND db.public = true
+			AND db.is_deleted = false
+	)`
+
+// CollectionAddDB adds a public database to a collection, or changes its note and position when it's already there.
+// Positions start at 1, and a position of 0 adds the database at the end.  The returned boolean is false if the
+// collection or the public database doesn't exist
+func CollectionAddDB(owner, name, dbOwner, dbName, note string, position int) (exists bool, err error) {
+	tx, err := DB.Begin(context.Background())
+	if err != nil {
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	// Retrieve the IDs of the collection and the database, and where the database currently is in the collection
+	dbQuery := `
+		WITH c AS (
+			SELECT collection_id
+			FROM collections
+			WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+				AND lower(name) = lower($2)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db
+			WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($3))
+				AND db.db_name = $4
+				AND db.public = true
+				AND db.is_deleted = false
+		)
+		SELECT c.collection_id, d.db_id,
+			(SELECT count(*) FROM collection_entries AS e WHERE e.collection_id = c.collection_id),
+			coalesce((
+				SELECT e.position
+				FROM collection_entries AS e
+				WHERE e.collection_id = c.collection_id
+					AND e.db_id = d.db_id
+			), 0)
+		FROM c, d`
+	var collectionID, dbID int64
+	var count, oldPosition int
+	err = tx.QueryRow(context.Background(), dbQuery, owner, name, dbOwner, dbName).Scan(&collectionID, &dbID, &count,
+		&oldPosition)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		log.Printf("Retrieving collection '%s' of user '%s' failed: %v", name, owner, err)
+		return
+	}
+
+	// Move the other databases out of the way
+	if oldPosition == 0 {
+		if position < 1 || position > count+1 {
+			position = count + 1
+		}
+		dbQuery = `
+			UPDATE collection_entries
+			SET position = position + 1
+			WHERE collection_id = $1
+				AND position >= $2`
+		_, err = tx.Exec(context.Background(), dbQuery, collectionID, position)
+	} else {
+		if position < 1 || position > count {
+			position = count
+		}
+		dbQuery = `
+			UPDATE collection_entries
+			SET position = CASE WHEN $2::integer < $3::integer THEN position + 1 ELSE position - 1 END
+			WHERE collection_id = $1
+				AND position BETWEEN least($2, $3) AND greatest($2, $3)
+				AND db_id <> $4`
+		_, err = tx.Exec(context.Background(), dbQuery, collectionID, position, oldPosition, dbID)
+	}
+	if err != nil {
+		log.Printf("Reordering collection '%s' of user '%s' failed: %v", name, owner, err)
+		return
+	}
+
+	// Save the entry
+	dbQuery = `
+		INSERT INTO collection_entries (collection_id, db_id, position, note)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (collection_id, db_id)
+			DO UPDATE
+			SET position = $3,
+				note = $4`
+	_, err = tx.Exec(context.Background(), dbQuery, collectionID, dbID, position, note)
+	if err != nil {
+		log.Printf("Adding database '%s/%s' to collection '%s' of user '%s' failed: %v", dbOwner, dbName, name,
+			owner, err)
+		return
+	}
+	dbQuery = `
+		UPDATE collections
+		SET last_modified = now()
+		WHERE collection_id = $1`
+	_, err = tx.Exec(context.Background(), dbQuery, collectionID)
+	if err != nil {
+		log.Printf("Updating the modification time of collection '%s' of user '%s' failed: %v", name, owner, err)
+		return
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return
+	}
+	return true, nil
+}
+
+// CollectionDelete deletes a collection.  The databases in it aren't affected
+func CollectionDelete(owner, name string) (err error) {
+	dbQuery := `
+		DELETE FROM collections
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND lower(name) = lower($2)`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, owner, name)
+	if err != nil {
+		log.Printf("Deleting collection '%s' for user '%s' failed: %v", name, owner, err)
+		return
+	}
+	if numRows := commandTag.RowsAffected(); numRows != 1 {
+		return fmt.Errorf("Collection '%s' not found", name)
+	}
+	return
+}
+
+// CollectionEntries returns the databases in a collection, in their curated order.  Databases which have been deleted
+// or made private since being added are left out
+func CollectionEntries(owner, name string) (entries []CollectionEntry, err error) {
+	dbQuery := `
+		SELECT db_owner.user_name, db.db_name, e.position, e.note, e.date_added
+		FROM collection_entries AS e
+			JOIN sqlite_databases AS db ON db.db_id = e.db_id
+			JOIN users AS db_owner ON db_owner.user_id = db.user_id
+		WHERE e.collection_id = (
+				SELECT collection_id
+				FROM collections
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+					AND lower(name) = lower($2)
+			)
+			AND db.public = true
+			AND db.is_deleted = false
+		ORDER BY e.position`
+	rows, err := DB.Query(context.Background(), dbQuery, owner, name)
+	if err != nil {
+		log.Printf("Retrieving the databases in collection '%s' of user '%s' failed: %v", name, owner, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e CollectionEntry
+		err = rows.Scan(&e.Owner, &e.Database, &e.Position, &e.Note, &e.DateAdded)
+		if err != nil {
+			log.Printf("Error retrieving the databases in collection '%s' of user '%s': %v", name, owner, err)
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return
+}
+
+// CollectionGet returns the details of a collection, and whether it exists
+func CollectionGet(owner, name string) (col Collection, exists bool, err error) {
+	dbQuery := `
+		SELECT ` + collectionFields + `
+		FROM collections AS col
+			JOIN users AS u ON u.user_id = col.user_id
+		WHERE lower(u.user_name) = lower($1)
+			AND lower(col.name) = lower($2)`
+	err = DB.QueryRow(context.Background(), dbQuery, owner, name).Scan(&col.Owner, &col.Name, &col.Description,
+		&col.Public, &col.Stars, &col.DateCreated, &col.LastModified, &col.DatabaseCount)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// No collection with that name exists for the user
+			return col, false, nil
+		}
+		log.Printf("Retrieving collection '%s' for user '%s' failed: %v", name, owner, err)
+		return
+	}
+	return col, true, nil
+}
+
+// CollectionRemoveDB removes a database from a collection.  The returned boolean is false if the database isn't in
+// the collection
+func CollectionRemoveDB(owner, name, dbOwner, dbName string) (exists bool, err error) {
+	tx, err := DB.Begin(context.Background())
+	if err != nil {
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	dbQuery := `
+		DELETE FROM collection_entries
+		WHERE collection_id = (
+				SELECT collection_id
+				FROM collections
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+					AND lower(name) = lower($2)
+			)
+			AND db_id = (
+				SELECT db_id
+				FROM sqlite_databases
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($3))
+					AND db_name = $4
+			)
+		RETURNING collection_id, position`
+	var collectionID int64
+	var position int
+	err = tx.QueryRow(context.Background(), dbQuery, owner, name, dbOwner, dbName).Scan(&collectionID, &position)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		log.Printf("Removing database '%s/%s' from collection '%s' of user '%s' failed: %v", dbOwner, dbName, name,
+			owner, err)
+		return
+	}
+
+	// Close the gap left by the database
+	dbQuery = `
+		UPDATE collection_entries
+		SET position = position - 1
+		WHERE collection_id = $1
+			AND position > $2`
+	_, err = tx.Exec(context.Background(), dbQuery, collectionID, position)
+	if err != nil {
+		log.Printf("Reordering collection '%s' of user '%s' failed: %v", name, owner, err)
+		return
+	}
+	dbQuery = `
+		UPDATE collections
+		SET last_modified = now()
+		WHERE collection_id = $1`
+	_, err = tx.Exec(context.Background(), dbQuery, collectionID)
+	if err != nil {
+		log.Printf("Updating the modification time of collection '%s' of user '%s' failed: %v", name, owner, err)
+		return
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return
+	}
+	return true, nil
+}
+
+// CollectionSave creates a collection, or updates its details if it already exists
+func CollectionSave(owner, name, description string, public bool) (err error) {
+	dbQuery := `
+		INSERT INTO collections (user_id, name, description, public)
+		SELECT (SELECT user_id FROM users WHERE lower(user_name) = lower($1)), $2, $3, $4
+		ON CONFLICT (user_id, lower(name))
+			DO UPDATE
+			SET name = $2,
+				description = $3,
+				public = $4,
+				last_modified = now()`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, owner, name, description, public)
+	if err != nil {
+		log.Printf("Saving collection '%s' for user '%s' failed: %v", name, owner, err)
+		return
+	}
+	if numRows := commandTag.RowsAffected(); numRows != 1 {
+		log.Printf("Wrong number of rows (%d) affected when saving collection '%s' for user '%s'", numRows, name,
+			owner)
+	}
+	return
+}
+
+// Collections returns the list of collections created by a user.  Private collections are only included when
+// requested
+func Collections(owner string, includePrivate bool) (list []Collection, err error) {
+	dbQuery := `
+		SELECT ` + collectionFields + `
+		FROM collections AS col
+			JOIN users AS u ON u.user_id = col.user_id
+		WHERE lower(u.user_name) = lower($1)
+			AND (col.public = true OR $2 = true)
+		ORDER BY lower(col.name)`
+	return collectionList(dbQuery, owner, includePrivate)
+}
+
+// SetCollectionStar stars or unstars a collection for a user.  Private collections can only be starred by their
+// owner.  The returned boolean is false if the collection doesn't exist or the user can't see it
+func SetCollectionStar(loggedInUser, owner, name string, starred bool) (exists bool, err error) {
+	tx, err := DB.Begin(context.Background())
+	if err != nil {
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	dbQuery := `
+		SELECT col.collection_id
+		FROM collections AS col
+			JOIN users AS u ON u.user_id = col.user_id
+		WHERE lower(u.user_name) = lower($1)
+			AND lower(col.name) = lower($2)
+			AND (col.public = true OR lower(u.user_name) = lower($3))`
+	var collectionID int64
+	err = tx.QueryRow(context.Background(), dbQuery, owner, name, loggedInUser).Scan(&collectionID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		log.Printf("Retrieving collection '%s' of user '%s' failed: %v", name, owner, err)
+		return
+	}
+
+	// Add or remove the star
+	if starred {
+		dbQuery = `
+			INSERT INTO collection_stars (collection_id, user_id)
+			SELECT $1, user_id
+			FROM users
+			WHERE lower(user_name) = lower($2)
+			ON CONFLICT DO NOTHING`
+	} else {
+		dbQuery = `
+			DELETE FROM collection_stars
+			WHERE collection_id = $1
+				AND user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($2))`
+	}
+	_, err = tx.Exec(context.Background(), dbQuery, collectionID, loggedInUser)
+	if err != nil {
+		log.Printf("Changing the star by '%s' on collection '%s' of user '%s' failed: %v", loggedInUser, name,
+			owner, err)
+		return
+	}
+
+	// Refresh the star count of the collection
+	dbQuery = `
+		UPDATE collections
+		SET stars = (
+			SELECT count(*)
+			FROM collection_stars
+			WHERE collection_id = $1
+		)
+		WHERE collection_id = $1`
+	_, err = tx.Exec(context.Background(), dbQuery, collectionID)
+	if err != nil {
+		log.Printf("Updating the star count of collection '%s' of user '%s' failed: %v", name, owner, err)
+		return
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return
+	}
+	return true, nil
+}
+
+// StarredCollections returns the list of collections a user has starred, most recently starred first.  Private
+// collections (which only their owner can star) are only included when requested
+func StarredCollections(userName string, includePrivate bool) (list []Collection, err error) {
+	dbQuery := `
+		SELECT ` + collectionFields + `
+		FROM collection_stars AS s
+			JOIN collections AS col ON col.collection_id = s.collection_id
+			JOIN users AS u ON u.user_id = col.user_id
+		WHERE s.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND (col.public = true OR $2 = true)
+		ORDER BY s.date_starred DESC`
+	return collectionList(dbQuery, userName, includePrivate)
+}
+
+// collectionList runs a query returning the collectionFields of a list of collections
+func collectionList(dbQuery, userName string, includePrivate bool) (list []Collection, err error) {
+	rows, err := DB.Query(context.Background(), dbQuery, userName, includePrivate)
+	if err != nil {
+		log.Printf("Retrieving the list of collections for user '%s' failed: %v", userName, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var col Collection
+		err = rows.Scan(&col.Owner, &col.Name, &col.Description, &col.Public, &col.Stars, &col.DateCreated,
+			&col.LastModified, &col.DatabaseCount)
+		if err != nil {
+			log.Printf("Error retrieving the list of collections for user '%s': %v", userName, err)
+			return nil, err
+		}
+		list = append(list, col)
+	}
+	return
+}
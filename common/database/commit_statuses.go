@@ -0,0 +1,169 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// CommitStatus is the status an external system, such as a CI server, has posted for a commit.  Context identifies the
+// system or check which posted it, and State is one of "pending", "success", or "failure"
+type CommitStatus struct {
+	Commit       string    `json:"commit"`
+	Context      string    `json:"context"`
+	Creator      string    `json:"creator"`
+	DateCreated  time.Time `json:"date_created"`
+	Description  string    `json:"description"`
+	LastModified time.Time `json:"last_modified"`
+	State        string    `json:"state"`
+	TargetURL    string    `json:"target_url"`
+}
+
+// CommitExists returns whether a commit is part of a database
+func CommitExists(dbOwner, dbName, commitID string) (exists bool, err error) {
+	dbQuery := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM commits
+			WHERE db_id = (
+					SELECT db_id
+					FROM sqlite_databases
+					WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+						AND db_name = $2
+						AND is_deleted = false
+				)
+				AND commit_id = $3
+		)`
+	err = DB.QueryRow(context.Background(), dbQuery, dbOwner, dbName, commitID).Scan(&exists)
+	if err != nil {
+		log.Printf("Checking if commit '%s' of '%s/%s' exists failed: %v", commitID, dbOwner, dbName, err)
+	}
+	return
+}
+
+// CommitStatusSave sets the status of a commit for a context, replacing any earlier status for the same context
+func CommitStatusSave(dbOwner, dbName string, s CommitStatus) (err error) {
+	dbQuery := `
+		INSERT INTO commit_statuses (db_id, commit_id, context, state, target_url, description, creator)
+		SELECT db.db_id, $3, $4, $5, $6, $7, (SELECT user_id FROM users WHERE lower(user_name) = lower($8))
+		FROM sqlite_databases AS db
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false
+		ON CONFLICT (db_id, commit_id, context)
+			DO UPDATE
+			SET state = $5,
+				target_url = $6,
+				description = $7,
+				creator = excluded.creator,
+				last_modified = now()`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, s.Commit, s.Context, s.State,
+		s.TargetURL, s.Description, s.Creator)
+	if err != nil {
+		log.Printf("Saving the '%s' status of commit '%s' of '%s/%s' failed: %v", s.Context, s.Commit, dbOwner,
+			dbName, err)
+		return
+	}
+	if commandTag.RowsAffected() != 1 {
+		return errors.New("Database not found")
+	}
+	return
+}
+
+// CommitStatuses returns the statuses posted for a commit, in context order
+func CommitStatuses(dbOwner, dbName, commitID string) (list []CommitStatus, err error) {
+	dbQuery := `
+		SELECT s.commit_id, s.context, s.state, s.target_url, s.description, u.user_name, s.date_created,
+			s.last_modified
+		FROM commit_statuses AS s
+			JOIN sqlite_databases AS db ON db.db_id = s.db_id
+			JOIN users AS u ON u.user_id = s.creator
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false
+			AND s.commit_id = $3
+		ORDER BY s.context`
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName, commitID)
+	if err != nil {
+		log.Printf("Retrieving the statuses of commit '%s' of '%s/%s' failed: %v", commitID, dbOwner, dbName, err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (s CommitStatus, err error) {
+		err = row.Scan(&s.Commit, &s.Context, &s.State, &s.TargetURL, &s.Description, &s.Creator, &s.DateCreated,
+			&s.LastModified)
+		return
+	})
+	if err != nil {
+		log.Printf("Retrieving the statuses of commit '%s' of '%s/%s' failed: %v", commitID, dbOwner, dbName, err)
+	}
+	return
+}
+
+// RequiredStatusChecks returns the status check contexts which need to succeed before merge requests to a database can
+// be merged
+func RequiredStatusChecks(dbOwner, dbName string) (contexts []string, err error) {
+	dbQuery := `
+		SELECT r.context
+		FROM required_status_checks AS r
+			JOIN sqlite_databases AS db ON db.db_id = r.db_id
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false
+		ORDER BY r.context`
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName)
+	if err != nil {
+		log.Printf("Retrieving the required status checks of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	contexts, err = pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		log.Printf("Retrieving the required status checks of '%s/%s' failed: %v", dbOwner, dbName, err)
+	}
+	return
+}
+
+// RequiredStatusChecksSet replaces the status check contexts which need to succeed before merge requests to a database
+// can be merged.  An empty list lets merge requests be merged regardless of their status checks
+func RequiredStatusChecksSet(dbOwner, dbName string, contexts []string) (err error) {
+	ctx := context.Background()
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	var dbID int64
+	dbQuery := `
+		SELECT db_id
+		FROM sqlite_databases
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db_name = $2
+			AND is_deleted = false`
+	err = tx.QueryRow(ctx, dbQuery, dbOwner, dbName).Scan(&dbID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errors.New("Database not found")
+	}
+	if err != nil {
+		log.Printf("Setting the required status checks of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM required_status_checks WHERE db_id = $1`, dbID)
+	if err != nil {
+		log.Printf("Setting the required status checks of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	dbQuery = `
+		INSERT INTO required_status_checks (db_id, context)
+		SELECT $1, unnest($2::text[])
+		ON CONFLICT DO NOTHING`
+	_, err = tx.Exec(ctx, dbQuery, dbID, contexts)
+	if err != nil {
+		log.Printf("Setting the required status checks of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,308 @@
+package database
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CommitSearch holds the conditions for searching the commit history of a database.  Empty fields match all commits
+type CommitSearch struct {
+	Author  string    // Part of the author's name or email address, case insensitive
+	From    time.Time // The earliest commit time
+	Message string    // Part of the commit message, case insensitive
+	To      time.Time // The latest commit time
+}
+
+// AddCommits adds new commits to a database, leaving its existing ones alone
+func AddCommits(dbOwner, dbName string, commits []CommitEntry) error {
+	tx, err := DB.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	// Set up an automatic transaction roll back if the function exits without committing
+	defer tx.Rollback(context.Background())
+
+	dbID, err := lockDatabaseForCommits(tx, dbOwner, dbName)
+	if err != nil {
+		return err
+	}
+	err = insertCommits(tx, dbID, commits)
+	if err != nil {
+		log.Printf("Adding commits to database '%s/%s' failed: %v", dbOwner, dbName, err)
+		return err
+	}
+	return tx.Commit(context.Background())
+}
+
+// GetCommitList returns the full commit list for a database
+func GetCommitList(dbOwner, dbName string) (map[string]CommitEntry, error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db.db_name = $2
+				AND db.is_deleted = false
+		)
+		SELECT c.commit_id, c.author_email, c.author_name, c.committer_email, c.committer_name, c.message,
+			c.commit_timestamp, c.tree, coalesce((
+				SELECT p.parent_id
+				FROM commit_parents AS p
+				WHERE p.db_id = c.db_id
+					AND p.commit_id = c.commit_id
+					AND p.position = 0
+			), ''), (
+				SELECT array_agg(p.parent_id ORDER BY p.position)
+				FROM commit_parents AS p
+				WHERE p.db_id = c.db_id
+					AND p.commit_id = c.commit_id
+					AND p.position > 0
+			)
+		FROM commits AS c, d
+		WHERE c.db_id = d.db_id`
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName)
+	if err != nil {
+		log.Printf("Retrieving commit list for '%s/%s' failed: %v", dbOwner, dbName, err)
+		return map[string]CommitEntry{}, err
+	}
+	defer rows.Close()
+	l := make(map[string]CommitEntry)
+	for rows.Next() {
+		var c CommitEntry
+		err = rows.Scan(&c.ID, &c.AuthorEmail, &c.AuthorName, &c.CommitterEmail, &c.CommitterName, &c.Message,
+			&c.Timestamp, &c.Tree, &c.Parent, &c.OtherParents)
+		if err != nil {
+			log.Printf("Retrieving commit list for '%s/%s' failed: %v", dbOwner, dbName, err)
+			return map[string]CommitEntry{}, err
+		}
+		l[c.ID] = c
+	}
+	if err = rows.Err(); err != nil {
+		log.Printf("Retrieving commit list for '%s/%s' failed: %v", dbOwner, dbName, err)
+		return map[string]CommitEntry{}, err
+	}
+	return l, nil
+}
+
+// SearchCommits returns a page of the commits of a database matching the search conditions, newest first, along with
+// the total number of matching commits
+func SearchCommits(dbOwner, dbName string, search CommitSearch, offset, limit int) (list []CommitEntry, total int, err error) {
+	var from, to *time.Time
+	if !search.From.IsZero() {
+		from = &search.From
+	}
+	if !search.To.IsZero() {
+		to = &search.To
+	}
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db.db_name = $2
+				AND db.is_deleted = false
+		), matches AS (
+			SELECT c.*
+			FROM commits AS c, d
+			WHERE c.db_id = d.db_id
+				AND ($3 = '' OR strpos(lower(c.author_name), lower($3)) > 0
+					OR strpos(lower(c.author_email), lower($3)) > 0)
+				AND ($4 = '' OR strpos(lower(c.message), lower($4)) > 0)
+				AND ($5::timestamptz IS NULL OR c.commit_timestamp >= $5)
+				AND ($6::timestamptz IS NULL OR c.commit_timestamp <= $6)
+		)
+		SELECT c.commit_id, c.author_email, c.author_name, c.committer_email, c.committer_name, c.message,
+			c.commit_timestamp, c.tree, coalesce((
+				SELECT p.parent_id
+				FROM commit_parents AS p
+				WHERE p.db_id = c.db_id
+					AND p.commit_id = c.commit_id
+					AND p.position = 0
+			), ''), (
+				SELECT array_agg(p.parent_id ORDER BY p.position)
+				FROM commit_parents AS p
+				WHERE p.db_id = c.db_id
+					AND p.commit_id = c.commit_id
+					AND p.position > 0
+			), (SELECT count(*) FROM matches)
+		FROM matches AS c
+		ORDER BY c.commit_timestamp DESC, c.commit_id
+		OFFSET $7
+		LIMIT nullif($8, 0)`
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName, search.Author, search.Message, from, to,
+		offset, limit)
+	if err != nil {
+		log.Printf("Searching the commits of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c CommitEntry
+		err = rows.Scan(&c.ID, &c.AuthorEmail, &c.AuthorName, &c.CommitterEmail, &c.CommitterName, &c.Message,
+			&c.Timestamp, &c.Tree, &c.Parent, &c.OtherParents, &total)
+		if err != nil {
+			log.Printf("Searching the commits of '%s/%s' failed: %v", dbOwner, dbName, err)
+			return nil, 0, err
+		}
+		list = append(list, c)
+	}
+	if err = rows.Err(); err != nil {
+		log.Printf("Searching the commits of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return nil, 0, err
+	}
+
+	// When the requested page is past the end of the results there aren't any rows to take the total from
+	if len(list) == 0 && offset > 0 {
+		dbQuery = `
+			SELECT count(*)
+			FROM commits AS c
+			WHERE c.db_id = (
+					SELECT db.db_id
+					FROM sqlite_databases AS db
+					WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+						AND db.db_name = $2
+						AND db.is_deleted = false
+				)
+				AND ($3 = '' OR strpos(lower(c.author_name), lower($3)) > 0
+					OR strpos(lower(c.author_email), lower($3)) > 0)
+				AND ($4 = '' OR strpos(lower(c.message), lower($4)) > 0)
+				AND ($5::timestamptz IS NULL OR c.commit_timestamp >= $5)
+				AND ($6::timestamptz IS NULL OR c.commit_timestamp <= $6)`
+		err = DB.QueryRow(context.Background(), dbQuery, dbOwner, dbName, search.Author, search.Message, from,
+			to).Scan(&total)
+		if err != nil {
+			log.Printf("Error counting the matching commits of '%s/%s': %v", dbOwner, dbName, err)
+			return
+		}
+	}
+	return
+}
+
+// StoreCommits updates the commit list for a database.  Only the differences to the stored commit list are written,
+// so this doesn't get slower as the history of a database grows
+func StoreCommits(dbOwner, dbName string, commitList map[string]CommitEntry) error {
+	tx, err := DB.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	// Set up an automatic transaction roll back if the function exits without committing
+	defer tx.Rollback(context.Background())
+
+	dbID, err := lockDatabaseForCommits(tx, dbOwner, dbName)
+	if err != nil {
+		return err
+	}
+
+	// Work out which commits have been added and removed
+	rows, err := tx.Query(context.Background(), `SELECT commit_id FROM commits WHERE db_id = $1`, dbID)
+	if err != nil {
+		log.Printf("Updating commit list for database '%s/%s' failed: %v", dbOwner, dbName, err)
+		return err
+	}
+	existing, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		log.Printf("Updating commit list for database '%s/%s' failed: %v", dbOwner, dbName, err)
+		return err
+	}
+	var removed []string
+	stored := make(map[string]struct{}, len(existing))
+	for _, id := range existing {
+		stored[id] = struct{}{}
+		if _, ok := commitList[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	var added []CommitEntry
+	for id, c := range commitList {
+		if _, ok := stored[id]; !ok {
+			c.ID = id
+			added = append(added, c)
+		}
+	}
+
+	// Update the stored commits.  The parents of removed commits are removed along with them
+	if len(removed) > 0 {
+		_, err = tx.Exec(context.Background(), `DELETE FROM commits WHERE db_id = $1 AND commit_id = ANY($2)`, dbID,
+			removed)
+		if err != nil {
+			log.Printf("Updating commit list for database '%s/%s' failed: %v", dbOwner, dbName, err)
+			return err
+		}
+	}
+	err = insertCommits(tx, dbID, added)
+	if err != nil {
+		log.Printf("Updating commit list for database '%s/%s' failed: %v", dbOwner, dbName, err)
+		return err
+	}
+	_, err = tx.Exec(context.Background(), `UPDATE sqlite_databases SET last_modified = now() WHERE db_id = $1`, dbID)
+	if err != nil {
+		log.Printf("Updating commit list for database '%s/%s' failed: %v", dbOwner, dbName, err)
+		return err
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return err
+	}
+	return UpdateLatestCommit(dbOwner, dbName)
+}
+
+// insertCommits adds commits to the commits and commit_parents tables.  Commits which are already stored are skipped
+func insertCommits(tx pgx.Tx, dbID int64, commits []CommitEntry) error {
+	if len(commits) == 0 {
+		return nil
+	}
+	var b pgx.Batch
+	for _, c := range commits {
+		b.Queue(`
+			INSERT INTO commits (db_id, commit_id, author_name, author_email, committer_name, committer_email,
+				message, commit_timestamp, tree)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			ON CONFLICT DO NOTHING`, dbID, c.ID, c.AuthorName, c.AuthorEmail, c.CommitterName, c.CommitterEmail,
+			c.Message, c.Timestamp, c.Tree)
+		if c.Parent != "" {
+			b.Queue(`
+				INSERT INTO commit_parents (db_id, commit_id, position, parent_id)
+				VALUES ($1, $2, 0, $3)
+				ON CONFLICT DO NOTHING`, dbID, c.ID, c.Parent)
+		}
+		for i, p := range c.OtherParents {
+			b.Queue(`
+				INSERT INTO commit_parents (db_id, commit_id, position, parent_id)
+				VALUES ($1, $2, $3, $4)
+				ON CONFLICT DO NOTHING`, dbID, c.ID, i+1, p)
+		}
+	}
+	return tx.SendBatch(context.Background(), &b).Close()
+}
+
+// lockDatabaseForCommits returns the ID of a database, locking its row until the end of the transaction so changes to
+// its commits don't run concurrently
+func lockDatabaseForCommits(tx pgx.Tx, dbOwner, dbName string) (dbID int64, err error) {
+	dbQuery := `
+		SELECT db_id
+		FROM sqlite_databases
+		WHERE user_id = (
+				SELECT user_id
+				FROM users
+				WHERE lower(user_name) = lower($1)
+			)
+			AND db_name = $2
+		FOR UPDATE`
+	err = tx.QueryRow(context.Background(), dbQuery, dbOwner, dbName).Scan(&dbID)
+	if err != nil {
+		log.Printf("Looking up the ID of database '%s/%s' failed: %v", dbOwner, dbName, err)
+	}
+	return
+}
@@ -6,13 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"net/url"
+	"time"
 
 	"github.com/sqlitebrowser/dbhub.io/common/config"
 
-	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/pgx/v5"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
 	pgx "github.com/jackc/pgx/v5"
 	pgpool "github.com/jackc/pgx/v5/pgxpool"
 
@@ -34,6 +31,20 @@ var (
 	JobQueue *pgpool.Pool
 )
 
+// PoolHealth holds the health details of the PostgreSQL connection pool
+type PoolHealth struct {
+	AcquireCount         int64  `json:"acquire_count"`
+	AcquireDuration      int64  `json:"acquire_duration_ms"` // Total time spent waiting for connections
+	AcquiredConns        int32  `json:"acquired_conns"`
+	CanceledAcquireCount int64  `json:"canceled_acquire_count"`
+	EmptyAcquireCount    int64  `json:"empty_acquire_count"`
+	IdleConns            int32  `json:"idle_conns"`
+	MaxConns             int32  `json:"max_conns"`
+	PingDuration         int64  `json:"ping_duration_ms"`
+	Status               string `json:"status"`
+	TotalConns           int32  `json:"total_conns"`
+}
+
 // Connect creates a connection pool to the PostgreSQL server and a connection to the backend queue server
 func Connect() (err error) {
 	// Prepare TLS configuration
@@ -46,7 +57,7 @@ func Connect() (err error) {
 	}
 
 	// Set the main PostgreSQL database configuration values
-	pgConfig, err := pgpool.ParseConfig(fmt.Sprintf("host=%s port=%d user= %s password = %s dbname=%s pool_max_conns=%d connect_timeout=10", config.Conf.Pg.Server, uint16(config.Conf.Pg.Port), config.Conf.Pg.Username, config.Conf.Pg.Password, config.Conf.Pg.Database, config.Conf.Pg.NumConnections))
+	pgConfig, err := pgpool.ParseConfig(fmt.Sprintf("host=%s port=%d user= %s password = %s dbname=%s pool_max_conns=%d connect_timeout=10 statement_timeout=%d", config.Conf.Pg.Server, uint16(config.Conf.Pg.Port), config.Conf.Pg.Username, config.Conf.Pg.Password, config.Conf.Pg.Database, config.Conf.Pg.NumConnections, (config.Conf.Pg.StatementTimeout * time.Second).Milliseconds()))
 	if err != nil {
 		return
 	}
@@ -74,28 +85,10 @@ func Connect() (err error) {
 		return fmt.Errorf("could not connect to database: %v", err)
 	}
 
-	// migrate doesn't handle pgx connection strings, so we need to manually create something it can use
-	var mConnStr string
-	if config.Conf.Environment.Environment == "production" {
-		mConnStr = fmt.Sprintf("pgx5://%s@%s:%d/%s?password=%s&connect_timeout=10", config.Conf.Pg.Username, config.Conf.Pg.Server,
-			uint16(config.Conf.Pg.Port), config.Conf.Pg.Database, url.PathEscape(config.Conf.Pg.Password))
-	} else {
-		// Non-production, so probably our Docker test container
-		mConnStr = "pgx5://dbhub@localhost:5432/dbhub"
-	}
-	if config.Conf.Pg.SSL {
-		mConnStr += "&sslmode=require"
-	}
-	m, err := migrate.New(fmt.Sprintf("file://%s/database/migrations", config.Conf.Web.BaseDir), mConnStr)
+	// Bring the database schema up to date
+	err = Migrate()
 	if err != nil {
-		return
-	}
-
-	// Bizarrely, migrate throws a "no change" error when there are no migrations to apply.  So, we work around it:
-	// https://github.com/golang-migrate/migrate/issues/485
-	err = m.Up()
-	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
-		return
+		return fmt.Errorf("%s: couldn't migrate the database schema: %v", config.Conf.Live.Nodename, err)
 	}
 
 	// Log successful connection
@@ -141,6 +134,12 @@ func Connect() (err error) {
 		return
 	}
 
+	// Add the default discussion labels to the system
+	err = AddDefaultLabels()
+	if err != nil {
+		return
+	}
+
 	return nil
 }
 
@@ -159,103 +158,98 @@ func Disconnect() {
 	}
 }
 
-// ResetDB resets the database to its default state. eg for testing purposes
-func ResetDB() error {
-	// We probably don't want to drop the database itself, as that'd screw up the current database
-	// connection.  Instead, lets truncate all the tables then load their default values
-	tableNames := []string{
-		"api_call_log",
-		"api_keys",
-		"database_downloads",
-		"database_licences",
-		"database_shares",
-		"database_stars",
-		"database_uploads",
-		"db4s_connects",
-		"discussion_comments",
-		"discussions",
-		"email_queue",
-		"events",
-		"sql_terminal_history",
-		"sqlite_databases",
-		"usage_limits",
-		"users",
-		"vis_params",
-		"vis_query_runs",
-		"watchers",
-		"webui_logins",
-		"analysis_space_used",
-		"job_submissions",
-		"job_responses",
+// Health checks the PostgreSQL server can still be reached, and returns the usage statistics of the connection pool.
+// A non-nil error means the server isn't usable, though the statistics are still filled out
+func Health() (h PoolHealth, err error) {
+	stats := DB.Stat()
+	h = PoolHealth{
+		AcquireCount:         stats.AcquireCount(),
+		AcquireDuration:      stats.AcquireDuration().Milliseconds(),
+		AcquiredConns:        stats.AcquiredConns(),
+		CanceledAcquireCount: stats.CanceledAcquireCount(),
+		EmptyAcquireCount:    stats.EmptyAcquireCount(),
+		IdleConns:            stats.IdleConns(),
+		MaxConns:             stats.MaxConns(),
+		TotalConns:           stats.TotalConns(),
+	}
+
+	// Ping the server through the pool, so a pool without free connections shows up as unhealthy too
+	ctx, cancel := QueryContext()
+	defer cancel()
+	start := time.Now()
+	err = DB.Ping(ctx)
+	h.PingDuration = time.Since(start).Milliseconds()
+	if err != nil {
+		log.Printf("%s: PostgreSQL health check failed: %v", config.Conf.Live.Nodename, err)
+		h.Status = "unavailable"
+		return
 	}
+	h.Status = "ok"
+	return
+}
 
-	sequenceNames := []string{
-		"api_keys_key_id_seq",
-		"api_log_log_id_seq",
-		"database_downloads_dl_id_seq",
-		"database_licences_lic_id_seq",
-		"database_uploads_up_id_seq",
-		"db4s_connects_connect_id_seq",
-		"discussion_comments_com_id_seq",
-		"discussions_disc_id_seq",
-		"email_queue_email_id_seq",
-		"events_event_id_seq",
-		"sql_terminal_history_history_id_seq",
-		"sqlite_databases_db_id_seq",
-		"usage_limits_id_seq",
-		"users_user_id_seq",
-		"vis_query_runs_query_run_id_seq",
+// QueryContext returns the context to run queries with, so slow ones are cancelled once the configured query timeout
+// has passed instead of holding things up indefinitely.  The returned cancel function needs calling once the queries
+// are finished, to release the resources of the context
+func QueryContext() (context.Context, context.CancelFunc) {
+	if config.Conf.Pg.QueryTimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), config.Conf.Pg.QueryTimeout*time.Second)
+}
+
+// ResetDB resets the database to its default state. eg for testing purposes.  Everything is dropped, then the schema
+// is built again from the migrations, so it's always the same as in production
+func ResetDB() error {
+	// Make sure this never happens to a live server
+	if config.Conf.Environment.Environment == "production" {
+		return errors.New("The database can't be reset in production")
 	}
 
-	// Begin a transaction
-	tx, err := DB.Begin(context.Background())
+	// We probably don't want to drop the database itself, as that'd screw up the current database
+	// connection.  Instead, lets drop everything in it
+	_, err := DB.Exec(context.Background(), "DROP OWNED BY CURRENT_USER")
 	if err != nil {
+		log.Printf("Error dropping the database objects while resetting database: %s", err)
 		return err
 	}
-	// Set up an automatic transaction roll back if the function exits without committing
-	defer tx.Rollback(context.Background())
-
-	// Truncate the database tables
-	for _, tbl := range tableNames {
-		// Ugh, string smashing just feels so wrong when working with SQL
-		dbQuery := fmt.Sprintf("TRUNCATE TABLE %s CASCADE", tbl)
-		_, err := DB.Exec(context.Background(), dbQuery)
-		if err != nil {
-			log.Printf("Error truncating table while resetting database: %s", err)
-			return err
-		}
+	_, err = DB.Exec(context.Background(), "CREATE SCHEMA IF NOT EXISTS public")
+	if err != nil {
+		log.Printf("Error creating the public schema while resetting database: %s", err)
+		return err
 	}
 
-	// Reset the sequences
-	for _, seq := range sequenceNames {
-		dbQuery := fmt.Sprintf("ALTER SEQUENCE %v RESTART", seq)
-		_, err := DB.Exec(context.Background(), dbQuery)
-		if err != nil {
-			log.Printf("Error restarting sequence while resetting database: %v", err)
-			return err
-		}
+	// Open connections may have cached statements for the dropped tables, so start with fresh ones
+	DB.Reset()
+	JobQueue.Reset()
+
+	// Build the schema again
+	err = Migrate()
+	if err != nil {
+		log.Printf("Error migrating the database schema while resetting database: %s", err)
+		return err
 	}
 
 	// Add default usage limits to the system
 	err = AddDefaultUsageLimits()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	// Add the default user to the system
 	err = AddDefaultUser()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	// Add the default licences
 	err = AddDefaultLicences()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	// Commit the transaction
-	err = tx.Commit(context.Background())
+	// Add the default discussion labels
+	err = AddDefaultLabels()
 	if err != nil {
 		return err
 	}
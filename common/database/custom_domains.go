@@ -0,0 +1,191 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// CustomDomain is a domain a user has added for serving their profile and databases from.  It's only used once verified
+type CustomDomain struct {
+	DateCreated       time.Time  `json:"date_created"`
+	DateVerified      *time.Time `json:"date_verified"`
+	Domain            string     `json:"domain"`
+	VerificationToken string     `json:"verification_token"`
+}
+
+// CustomDomainAdd adds an unverified custom domain for a user.  It returns false when the user has already added the
+// domain, or another user has verified it.  Other users having unverified claims on the domain doesn't stop it being
+// added, as the first user to verify the domain gets it
+func CustomDomainAdd(userName, domain, token string) (added bool, err error) {
+	dbQuery := `
+		INSERT INTO custom_domains (user_id, domain, verification_token)
+		SELECT user_id, $2, $3
+		FROM users
+		WHERE lower(user_name) = lower($1)
+			AND NOT EXISTS (
+				SELECT 1
+				FROM custom_domains
+				WHERE lower(domain) = lower($2)
+					AND date_verified IS NOT NULL
+			)
+		ON CONFLICT (user_id, lower(domain)) DO NOTHING`
+	tag, err := DB.Exec(context.Background(), dbQuery, userName, domain, token)
+	if err != nil {
+		log.Printf("Adding custom domain '%s' for user '%s' failed: %v", domain, userName, err)
+		return
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// CustomDomainDelete removes a custom domain of a user.  It returns false when the user doesn't have the domain
+func CustomDomainDelete(userName, domain string) (exists bool, err error) {
+	dbQuery := `
+		DELETE FROM custom_domains
+		WHERE lower(domain) = lower($2)
+			AND user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))`
+	tag, err := DB.Exec(context.Background(), dbQuery, userName, domain)
+	if err != nil {
+		log.Printf("Removing custom domain '%s' of user '%s' failed: %v", domain, userName, err)
+		return
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// CustomDomainOwner returns the user a verified custom domain belongs to, or an empty string when the domain isn't a
+// verified one
+func CustomDomainOwner(domain string) (owner string, err error) {
+	dbQuery := `
+		SELECT u.user_name
+		FROM custom_domains AS d
+			JOIN users AS u ON u.user_id = d.user_id
+		WHERE lower(d.domain) = lower($1)
+			AND d.date_verified IS NOT NULL`
+	err = DB.QueryRow(context.Background(), dbQuery, domain).Scan(&owner)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		log.Printf("Looking up the owner of custom domain '%s' failed: %v", domain, err)
+	}
+	return
+}
+
+// CustomDomainVerified marks a custom domain of a user as verified, removing the unverified claims other users have on
+// it.  It returns false when another user has verified the domain already
+func CustomDomainVerified(userName, domain string) (verified bool, err error) {
+	tx, err := DB.Begin(context.Background())
+	if err != nil {
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	// Lock the claims on the domain, so they don't change until this is done
+	dbQuery := `
+		SELECT d.date_verified IS NOT NULL AND lower(u.user_name) <> lower($1)
+		FROM custom_domains AS d
+			JOIN users AS u ON u.user_id = d.user_id
+		WHERE lower(d.domain) = lower($2)
+		FOR UPDATE OF d`
+	rows, err := tx.Query(context.Background(), dbQuery, userName, domain)
+	if err != nil {
+		log.Printf("Retrieving the claims on custom domain '%s' failed: %v", domain, err)
+		return
+	}
+	taken, err := pgx.CollectRows(rows, pgx.RowTo[bool])
+	if err != nil {
+		log.Printf("Retrieving the claims on custom domain '%s' failed: %v", domain, err)
+		return
+	}
+	for _, t := range taken {
+		if t {
+			return false, nil
+		}
+	}
+
+	dbQuery = `
+		DELETE FROM custom_domains
+		WHERE lower(domain) = lower($2)
+			AND date_verified IS NULL
+			AND user_id <> (SELECT user_id FROM users WHERE lower(user_name) = lower($1))`
+	_, err = tx.Exec(context.Background(), dbQuery, userName, domain)
+	if err != nil {
+		log.Printf("Removing the other claims on custom domain '%s' failed: %v", domain, err)
+		return
+	}
+	dbQuery = `
+		UPDATE custom_domains
+		SET date_verified = now()
+		WHERE lower(domain) = lower($2)
+			AND user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))`
+	_, err = tx.Exec(context.Background(), dbQuery, userName, domain)
+	if err != nil {
+		log.Printf("Marking custom domain '%s' of user '%s' as verified failed: %v", domain, userName, err)
+		return
+	}
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return
+	}
+	return true, nil
+}
+
+// CustomDomains returns the custom domains of a user, oldest first
+func CustomDomains(userName string) (list []CustomDomain, err error) {
+	dbQuery := `
+		SELECT d.domain, d.verification_token, d.date_verified, d.date_created
+		FROM custom_domains AS d
+			JOIN users AS u ON u.user_id = d.user_id
+		WHERE lower(u.user_name) = lower($1)
+		ORDER BY d.date_created`
+	rows, err := DB.Query(context.Background(), dbQuery, userName)
+	if err != nil {
+		log.Printf("Retrieving the custom domains of user '%s' failed: %v", userName, err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (d CustomDomain, err error) {
+		err = row.Scan(&d.Domain, &d.VerificationToken, &d.DateVerified, &d.DateCreated)
+		return
+	})
+	if err != nil {
+		log.Printf("Retrieving the custom domains of user '%s' failed: %v", userName, err)
+	}
+	return
+}
+
+// CustomDomainsExpire removes the custom domains which weren't verified within the given number of days of being added
+func CustomDomainsExpire(days int) (err error) {
+	dbQuery := `
+		DELETE FROM custom_domains
+		WHERE date_verified IS NULL
+			AND date_created < now() - make_interval(days => $1)`
+	_, err = DB.Exec(context.Background(), dbQuery, days)
+	if err != nil {
+		log.Printf("Removing the expired custom domains failed: %v", err)
+	}
+	return
+}
+
+// UserCanonicalDomain returns the domain the pages of a user are canonically served from.  That's the first custom
+// domain they verified, or an empty string when they haven't verified any
+func UserCanonicalDomain(userName string) (domain string, err error) {
+	dbQuery := `
+		SELECT d.domain
+		FROM custom_domains AS d
+			JOIN users AS u ON u.user_id = d.user_id
+		WHERE lower(u.user_name) = lower($1)
+			AND d.date_verified IS NOT NULL
+		ORDER BY d.date_verified
+		LIMIT 1`
+	err = DB.QueryRow(context.Background(), dbQuery, userName).Scan(&domain)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		log.Printf("Retrieving the canonical domain of user '%s' failed: %v", userName, err)
+	}
+	return
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// Dashboard is the model type for the dashboards table
+type Dashboard struct {
+	Name         string            `json:"name"`
+	Description  string            `json:"description"`
+	Public       bool              `json:"public"`
+	DateCreated  time.Time         `json:"date_created"`
+	LastModified time.Time         `json:"last_modified"`
+	Widgets      []DashboardWidget `json:"widgets"`
+}
+
+// DashboardWidget is a single saved visualisation displayed on a dashboard
+type DashboardWidget struct {
+	DBOwner         string `json:"db_owner"`
+	DBName          string `json:"db_name"`
+	VisName         string `json:"vis_name"`
+	Title           string `json:"title"`
+	RefreshInterval int    `json:"refresh_interval"` // Number of seconds between refreshes.  Only used for live databases
+}
+
+// DashboardDelete deletes a dashboard
+func DashboardDelete(owner, name string) (err error) {
+	dbQuery := `
+		DELETE FROM dashboards
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND name = $2`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, owner, name)
+	if err != nil {
+		log.Printf("Deleting dashboard '%s' for user '%s' failed: %v", name, owner, err)
+		return
+	}
+	if numRows := commandTag.RowsAffected(); numRows != 1 {
+		log.Printf("Wrong number of rows (%d) affected when deleting dashboard '%s' for user '%s'", numRows, name, owner)
+	}
+	return
+}
+
+// DashboardGet returns the details of a dashboard, and whether it exists
+func DashboardGet(owner, name string) (dash Dashboard, exists bool, err error) {
+	dbQuery := `
+		SELECT name, coalesce(description, ''), public, date_created, last_modified, widgets
+		FROM dashboards
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND name = $2`
+	err = DB.QueryRow(context.Background(), dbQuery, owner, name).Scan(&dash.Name, &dash.Description, &dash.Public,
+		&dash.DateCreated, &dash.LastModified, &dash.Widgets)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// No dashboard with that name exists for the user
+			return dash, false, nil
+		}
+		log.Printf("Retrieving dashboard '%s' for user '%s' failed: %v", name, owner, err)
+		return
+	}
+	return dash, true, nil
+}
+
+// DashboardSave creates a dashboard, or updates it if it already exists
+func DashboardSave(owner string, dash Dashboard) (err error) {
+	if dash.Widgets == nil {
+		dash.Widgets = []DashboardWidget{}
+	}
+	dbQuery := `
+		INSERT INTO dashboards (user_id, name, description, public, widgets)
+		SELECT (SELECT user_id FROM users WHERE lower(user_name) = lower($1)), $2, nullif($3, ''), $4, $5
+		ON CONFLICT (user_id, name)
+			DO UPDATE
+			SET description = nullif($3, ''),
+				public = $4,
+				widgets = $5,
+				last_modified = now()`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, owner, dash.Name, dash.Description, dash.Public, dash.Widgets)
+	if err != nil {
+		log.Printf("Saving dashboard '%s' for user '%s' failed: %v", dash.Name, owner, err)
+		return
+	}
+	if numRows := commandTag.RowsAffected(); numRows != 1 {
+		log.Printf("Wrong number of rows (%d) affected when saving dashboard '%s' for user '%s'", numRows, dash.Name, owner)
+	}
+	return
+}
+
+// Dashboards returns the list of dashboards for a user.  Private dashboards are only included when requested
+func Dashboards(owner string, includePrivate bool) (list []Dashboard, err error) {
+	dbQuery := `
+		SELECT name, coalesce(description, ''), public, date_created, last_modified, widgets
+		FROM dashboards
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND (public = true OR $2 = true)
+		ORDER BY name`
+	rows, err := DB.Query(context.Background(), dbQuery, owner, includePrivate)
+	if err != nil {
+		log.Printf("Retrieving dashboard list for user '%s' failed: %v", owner, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var dash Dashboard
+		err = rows.Scan(&dash.Name, &dash.Description, &dash.Public, &dash.DateCreated, &dash.LastModified, &dash.Widgets)
+		if err != nil {
+			log.Printf("Error retrieving dashboard list for user '%s': %v", owner, err)
+			return nil, err
+		}
+		list = append(list, dash)
+	}
+	return
+}
@@ -0,0 +1,194 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// DataCommentAnchor is the place in the data diff of a merge request a comment is attached to.  The row is given by
+// the values of the primary key columns of the table, and the column is empty for comments about the whole row
+type DataCommentAnchor struct {
+	Column string            `json:"column,omitempty"`
+	Commit string            `json:"commit"`
+	Key    map[string]string `json:"key"`
+	Table  string            `json:"table"`
+}
+
+// DataCommentThread is a comment on the data diff of a merge request, along with the replies to it
+type DataCommentThread struct {
+	Comment DiscussionCommentEntry   `json:"comment"`
+	Replies []DiscussionCommentEntry `json:"replies"`
+}
+
+// DataCommentThreads returns the comment threads on the data diff of a merge request, oldest first
+func DataCommentThreads(dbOwner, dbName string, discID int) (threads []DataCommentThread, err error) {
+	comments, err := DiscussionComments(dbOwner, dbName, discID, 0)
+	if err != nil {
+		return
+	}
+	threads = []DataCommentThread{}
+	index := make(map[int]int)
+	for _, c := range comments {
+		if c.Anchor != nil && c.ParentID == 0 {
+			index[c.ID] = len(threads)
+			threads = append(threads, DataCommentThread{Comment: c, Replies: []DiscussionCommentEntry{}})
+		}
+	}
+	for _, c := range comments {
+		if i, ok := index[c.ParentID]; ok {
+			threads[i].Replies = append(threads[i].Replies, c)
+		}
+	}
+	return
+}
+
+// DataCommentResolve marks a comment thread on the data diff of a merge request as resolved or unresolved
+func DataCommentResolve(dbOwner, dbName, loggedInUser string, discID, comID int, resolved bool) (err error) {
+	dbQuery := `
+		UPDATE discussion_comments AS com
+		SET resolved = $5,
+			resolved_by = CASE WHEN $5 THEN (SELECT user_id FROM users WHERE lower(user_name) = lower($4)) END,
+			date_resolved = CASE WHEN $5 THEN now() END
+		FROM discussions AS disc
+			JOIN sqlite_databases AS db ON db.db_id = disc.db_id
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false
+			AND disc.disc_id = $3
+			AND com.disc_id = disc.internal_id
+			AND com.com_id = $6
+			AND com.anchor_table IS NOT NULL
+			AND com.parent_com_id IS NULL`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, discID, loggedInUser, resolved, comID)
+	if err != nil {
+		log.Printf("Resolving comment thread '%d' of MR '%d' of '%s/%s' failed: %v", comID, discID, dbOwner, dbName,
+			err)
+		return
+	}
+	if commandTag.RowsAffected() != 1 {
+		return errors.New("Comment thread not found")
+	}
+	return
+}
+
+// StoreDataComment adds a comment to a merge request, either starting a thread about a row or cell of its data diff,
+// or replying to an existing thread when parentID isn't 0.  The anchor is only used for new threads, as replies share
+// the anchor of their thread
+func StoreDataComment(dbOwner, dbName, commenter string, discID int, anchor DataCommentAnchor, parentID int, comText string) (comID int, err error) {
+	// Archived databases don't accept new comments
+	archived, err := CheckDBArchived(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	if archived {
+		return 0, ErrDBArchived
+	}
+
+	tx, err := DB.Begin(context.Background())
+	if err != nil {
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	// Get the details of the merge request
+	dbQuery := `
+		SELECT disc.db_id, disc.internal_id, disc.discussion_type, disc.title
+		FROM discussions AS disc
+			JOIN sqlite_databases AS db ON db.db_id = disc.db_id
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false
+			AND disc.disc_id = $3`
+	var dbID, internalID int64
+	var discType DiscussionType
+	var discTitle string
+	err = tx.QueryRow(context.Background(), dbQuery, dbOwner, dbName, discID).Scan(&dbID, &internalID, &discType,
+		&discTitle)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && discType != MERGE_REQUEST) {
+		return 0, errors.New("Merge request not found")
+	}
+	if err != nil {
+		log.Printf("Retrieving the details of MR '%d' of '%s/%s' failed: %v", discID, dbOwner, dbName, err)
+		return
+	}
+
+	// Replies go to the comment starting a thread, rather than to other replies
+	var table, key, column, commit, parent interface{}
+	if parentID != 0 {
+		dbQuery = `
+			SELECT count(*)
+			FROM discussion_comments
+			WHERE disc_id = $1
+				AND com_id = $2
+				AND anchor_table IS NOT NULL
+				AND parent_com_id IS NULL`
+		var n int
+		err = tx.QueryRow(context.Background(), dbQuery, internalID, parentID).Scan(&n)
+		if err != nil {
+			log.Printf("Checking comment thread '%d' of MR '%d' of '%s/%s' failed: %v", parentID, discID, dbOwner,
+				dbName, err)
+			return
+		}
+		if n != 1 {
+			return 0, errors.New("Comment thread not found")
+		}
+		parent = parentID
+	} else {
+		table, key, commit = anchor.Table, anchor.Key, anchor.Commit
+		if anchor.Column != "" {
+			column = anchor.Column
+		}
+	}
+
+	dbQuery = `
+		INSERT INTO discussion_comments (db_id, disc_id, commenter, body, entry_type, anchor_table, anchor_key,
+			anchor_column, anchor_commit, parent_com_id)
+		SELECT $1, $2, (SELECT user_id FROM users WHERE lower(user_name) = lower($3)), $4, 'txt', $5, $6, $7, $8, $9
+		RETURNING com_id`
+	err = tx.QueryRow(context.Background(), dbQuery, dbID, internalID, commenter, comText, table, key, column, commit,
+		parent).Scan(&comID)
+	if err != nil {
+		log.Printf("Adding data comment to MR '%d' of '%s/%s' failed: %v", discID, dbOwner, dbName, err)
+		return
+	}
+
+	dbQuery = `
+		UPDATE discussions
+		SET comment_count = comment_count + 1, last_modified = now()
+		WHERE internal_id = $1`
+	_, err = tx.Exec(context.Background(), dbQuery, internalID)
+	if err != nil {
+		log.Printf("Updating comment count for MR '%d' of '%s/%s' failed: %v", discID, dbOwner, dbName, err)
+		return
+	}
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return
+	}
+
+	// Generate an event about the new comment, and notify any users mentioned in it
+	details := EventDetails{
+		DBName:   dbName,
+		DiscID:   discID,
+		Owner:    dbOwner,
+		Type:     EVENT_NEW_COMMENT,
+		Title:    discTitle,
+		URL:      fmt.Sprintf("/merge/%s/%s?id=%d#c%d", url.PathEscape(dbOwner), url.PathEscape(dbName), discID, comID),
+		UserName: commenter,
+	}
+	err = NewEvent(details)
+	if err != nil {
+		log.Printf("Error when creating a new event: %s", err.Error())
+		return
+	}
+	err = NewMentionEvents(details, comText)
+	if err != nil {
+		log.Printf("Error when creating a new mention event: %s", err.Error())
+	}
+	return
+}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// DataStory holds the details of a data story.  Data stories are Markdown documents, which can include blocks of SQL
+// that are run against their database when the story is viewed
+type DataStory struct {
+	Author       string    `json:"author"`
+	Body         string    `json:"body"`
+	DateCreated  time.Time `json:"date_created"`
+	LastModified time.Time `json:"last_modified"`
+	Name         string    `json:"name"`
+}
+
+// DataStories returns the list of data stories for a database.  The story bodies aren't included
+func DataStories(dbOwner, dbName string) (stories []DataStory, err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+				AND is_deleted = false
+		)
+		SELECT s.name, coalesce(author.user_name, ''), s.date_created, s.last_modified
+		FROM data_stories AS s
+			LEFT JOIN users AS author ON author.user_id = s.user_id
+		WHERE s.db_id = (SELECT db_id FROM d)
+		ORDER BY s.name`
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName)
+	if err != nil {
+		log.Printf("Retrieving data stories for '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s DataStory
+		err = rows.Scan(&s.Name, &s.Author, &s.DateCreated, &s.LastModified)
+		if err != nil {
+			log.Printf("Error retrieving data stories for '%s/%s': %v", dbOwner, dbName, err)
+			return nil, err
+		}
+		stories = append(stories, s)
+	}
+	return
+}
+
+// DataStoryDelete deletes a data story
+func DataStoryDelete(dbOwner, dbName, storyName string) (err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+		)
+		DELETE FROM data_stories
+		WHERE db_id = (SELECT db_id FROM d)
+			AND name = $3`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, storyName)
+	if err != nil {
+		log.Printf("Deleting data story '%s' for database '%s/%s' failed: %v", storyName, dbOwner, dbName, err)
+		return
+	}
+	if numRows := commandTag.RowsAffected(); numRows != 1 {
+		return fmt.Errorf("Data story '%s' not found", storyName)
+	}
+	return
+}
+
+// DataStoryGet returns a data story of a database
+func DataStoryGet(dbOwner, dbName, storyName string) (story DataStory, exists bool, err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+				AND is_deleted = false
+		)
+		SELECT s.name, s.body, coalesce(author.user_name, ''), s.date_created, s.last_modified
+		FROM data_stories AS s
+			LEFT JOIN users AS author ON author.user_id = s.user_id
+		WHERE s.db_id = (SELECT db_id FROM d)
+			AND s.name = $3`
+	err = DB.QueryRow(context.Background(), dbQuery, dbOwner, dbName, storyName).Scan(&story.Name, &story.Body,
+		&story.Author, &story.DateCreated, &story.LastModified)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return story, false, nil
+		}
+		log.Printf("Retrieving data story '%s' for database '%s/%s' failed: %v", storyName, dbOwner, dbName, err)
+		return
+	}
+	return story, true, nil
+}
+
+// DataStorySave creates or updates a data story for a database
+func DataStorySave(loggedInUser, dbOwner, dbName, storyName, body string) (err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+		)
+		INSERT INTO data_stories (db_id, user_id, name, body)
+		SELECT (SELECT db_id FROM d), (SELECT user_id FROM users WHERE lower(user_name) = lower($3)), $4, $5
+		ON CONFLICT (db_id, name)
+			DO UPDATE
+			SET body = $5,
+				user_id = excluded.user_id,
+				last_modified = now()`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, loggedInUser, storyName, body)
+	if err != nil {
+		log.Printf("Saving data story '%s' for database '%s/%s' failed: %v", storyName, dbOwner, dbName, err)
+		return
+	}
+	if numRows := commandTag.RowsAffected(); numRows != 1 {
+		log.Printf("Wrong number of rows (%d) affected when saving data story '%s' for database '%s/%s'", numRows,
+			storyName, dbOwner, dbName)
+	}
+	return
+}
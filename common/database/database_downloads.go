@@ -2,20 +2,116 @@ package database
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-// LogDownload creates a download log entry
-func LogDownload(dbOwner, dbName, loggedInUser, ipAddr, serverSw, userAgent string, downloadDate time.Time, sha string) error {
+// The maximum number of countries and referrers returned in a download breakdown
+const downloadBreakdownMaxEntries = 25
+
+// DownloadBreakdown holds the number of downloads of a database, broken down by client type, country, and referring
+// site
+type DownloadBreakdown struct {
+	Clients   []DownloadCount `json:"clients"`
+	Countries []DownloadCount `json:"countries"`
+	Referrers []DownloadCount `json:"referrers"`
+}
+
+// DownloadCount holds the number of downloads from a single client type, country, or referring site.  An empty name
+// means it's not known, or for referrers that there wasn't one
+type DownloadCount struct {
+	Downloads int    `json:"downloads"`
+	Name      string `json:"name"`
+}
+
+// DownloadClient works out what kind of client downloaded a database, from the server which handled the download and
+// the user agent of the client.  It returns one of "webui", "api", "db4s", or "cli" (for Dio)
+func DownloadClient(serverSw, userAgent string) string {
+	if serverSw == "db4s" && strings.HasPrefix(strings.ToLower(userAgent), "dio") {
+		return "cli"
+	}
+	return serverSw
+}
+
+// DownloadStats returns the downloads of a database between two dates (inclusive), broken down by client type,
+// country, and referring site.  Only the most common countries and referrers are included
+func DownloadStats(dbOwner, dbName string, from, to time.Time) (b DownloadBreakdown, err error) {
+	b.Clients, err = downloadCounts(dbOwner, dbName, "client", from, to)
+	if err != nil {
+		return
+	}
+	b.Countries, err = downloadCounts(dbOwner, dbName, "country", from, to)
+	if err != nil {
+		return
+	}
+
+	// Referrers are grouped by the site they're on, rather than the individual page
+	b.Referrers, err = downloadCounts(dbOwner, dbName, `substring(dl.referrer from '^[a-z]+://([^/:]+)')`, from, to)
+	return
+}
+
+// downloadCounts returns the number of downloads of a database between two dates (inclusive), grouped by the given
+// column expression.  The expression is included in the query as is, so it must never come from user input
+func downloadCounts(dbOwner, dbName, groupBy string, from, to time.Time) (counts []DownloadCount, err error) {
+	dbQuery := fmt.Sprintf(`
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+				AND is_deleted = false
+		)
+		SELECT coalesce(%s, ''), count(*)
+		FROM database_downloads AS dl, d
+		WHERE dl.db_id = d.db_id
+			AND (dl.download_date AT TIME ZONE 'UTC')::date BETWEEN $3::date AND $4::date
+		GROUP BY 1
+		ORDER BY 2 DESC, 1
+		LIMIT $5`, groupBy)
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName, from, to, downloadBreakdownMaxEntries)
+	if err != nil {
+		log.Printf("Retrieving the download breakdown for '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	defer rows.Close()
+	counts = []DownloadCount{}
+	for rows.Next() {
+		var c DownloadCount
+		err = rows.Scan(&c.Name, &c.Downloads)
+		if err != nil {
+			log.Printf("Error retrieving the download breakdown for '%s/%s': %v", dbOwner, dbName, err)
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return
+}
+
+// LogDownload creates a download log entry.  The country and referrer are optional, and can be empty strings
+func LogDownload(dbOwner, dbName, loggedInUser, ipAddr, serverSw, userAgent, country, referrer string, downloadDate time.Time, sha string) error {
 	// If the downloader isn't a logged in user, use a NULL value for that column
 	var downloader pgtype.Text
 	if loggedInUser != "" {
 		downloader.String = loggedInUser
 		downloader.Valid = true
 	}
+	var countryCode, referrerURL pgtype.Text
+	if country != "" {
+		countryCode.String = country
+		countryCode.Valid = true
+	}
+	if referrer != "" {
+		referrerURL.String = referrer
+		referrerURL.Valid = true
+	}
 
 	// Store the download details
 	dbQuery := `
@@ -29,10 +125,12 @@ func LogDownload(dbOwner, dbName, loggedInUser, ipAddr, serverSw, userAgent stri
 				)
 				AND db.db_name = $2
 		)
-		INSERT INTO database_downloads (db_id, user_id, ip_addr, server_sw, user_agent, download_date, db_sha256)
-		SELECT (SELECT db_id FROM d), (SELECT user_id FROM users WHERE lower(user_name) = lower($3)), $4, $5, $6, $7, $8`
+		INSERT INTO database_downloads (db_id, user_id, ip_addr, server_sw, user_agent, download_date, db_sha256, client,
+			country, referrer)
+		SELECT (SELECT db_id FROM d), (SELECT user_id FROM users WHERE lower(user_name) = lower($3)), $4, $5, $6, $7, $8,
+			$9, $10, $11`
 	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, downloader, ipAddr, serverSw, userAgent,
-		downloadDate, sha)
+		downloadDate, sha, DownloadClient(serverSw, userAgent), countryCode, referrerURL)
 	if err != nil {
 		log.Printf("Storing record of download '%s/%s', sha '%s' by '%v' failed: %v", dbOwner,
 			dbName, sha, downloader, err)
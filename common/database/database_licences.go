@@ -149,14 +149,7 @@ func DeleteLicence(userName, licenceName string) (err error) {
 
 	// Don't allow deletion of the default licences
 	switch licenceName {
-	case "Not specified":
-	case "CC0":
-	case "CC-BY-4.0":
-	case "CC-BY-SA-4.0":
-	case "CC-BY-NC-4.0":
-	case "CC-BY-IGO-3.0":
-	case "ODbL-1.0":
-	case "UK-OGL-3":
+	case "Not specified", "CC0", "CC-BY-4.0", "CC-BY-SA-4.0", "CC-BY-NC-4.0", "CC-BY-IGO-3.0", "ODbL-1.0", "UK-OGL-3":
 		return errors.New("Default licences can't be removed")
 	}
 
@@ -171,8 +164,8 @@ func DeleteLicence(userName, licenceName string) (err error) {
 		WITH working_set AS (
 			SELECT DISTINCT db.db_id
 			FROM sqlite_databases AS db
-				CROSS JOIN jsonb_each(db.commit_list) AS firstjoin
-				CROSS JOIN jsonb_array_elements(firstjoin.value -> 'tree' -> 'entries') AS secondjoin
+				JOIN commits AS c ON c.db_id = db.db_id
+				CROSS JOIN jsonb_array_elements(c.tree -> 'entries') AS secondjoin
 			WHERE secondjoin ->> 'licence' = $2
 				AND (
 					user_id = (
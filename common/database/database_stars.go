@@ -76,7 +76,7 @@ func ToggleDBStar(loggedInUser, dbOwner, dbName string) error {
 			FROM d, u`
 		commandTag, err := DB.Exec(context.Background(), insertQuery, dbOwner, dbName, loggedInUser)
 		if err != nil {
-			log.Printf("Adding star by '%s' to database '%s/s' failed: Error '%v'", loggedInUser,
+			log.Printf("Adding star by '%s' to database '%s/%s' failed: Error '%v'", loggedInUser,
 				dbOwner, dbName, err)
 			return err
 		}
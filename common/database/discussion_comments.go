@@ -2,7 +2,6 @@ package database
 
 import (
 	"context"
-	"crypto/md5"
 	"errors"
 	"fmt"
 	"log"
@@ -25,13 +24,20 @@ const (
 )
 
 type DiscussionCommentEntry struct {
+	Anchor       *DataCommentAnchor    `json:"anchor,omitempty"`
 	AvatarURL    string                `json:"avatar_url"`
 	Body         string                `json:"body"`
 	BodyRendered string                `json:"body_rendered"`
 	Commenter    string                `json:"commenter"`
 	DateCreated  time.Time             `json:"creation_date"`
+	DateResolved *time.Time            `json:"date_resolved,omitempty"`
 	EntryType    DiscussionCommentType `json:"entry_type"`
 	ID           int                   `json:"com_id"`
+	MyReactions  []string              `json:"my_reactions"`
+	ParentID     int                   `json:"parent_id,omitempty"`
+	Reactions    map[string]int        `json:"reactions"`
+	Resolved     bool                  `json:"resolved,omitempty"`
+	ResolvedBy   string                `json:"resolved_by,omitempty"`
 }
 
 // DeleteComment deletes a specific comment from a discussion
@@ -145,14 +151,22 @@ func DiscussionComments(dbOwner, dbName string, discID, comID int) (list []Discu
 				WHERE db_id = (SELECT db_id FROM d)
 				AND disc_id = $3
 			)
-		SELECT com.com_id, users.user_name, users.email, users.avatar_url, com.date_created, com.body, com.entry_type
-		FROM discussion_comments AS com, d, users
+		SELECT com.com_id, users.user_name, users.email, users.avatar_url, com.date_created, com.body, com.entry_type,
+			com.anchor_table, com.anchor_key, com.anchor_column, com.anchor_commit, com.parent_com_id, com.resolved,
+			ru.user_name, com.date_resolved
+		FROM discussion_comments AS com
+				LEFT JOIN users AS ru ON ru.user_id = com.resolved_by,
+			d, users
 		WHERE com.db_id = d.db_id
 			AND com.disc_id = (SELECT int_id FROM int)
 			AND com.commenter = users.user_id`
 	if comID != 0 {
 		dbQuery += fmt.Sprintf(`
 			AND com.com_id = %d`, comID)
+	} else {
+		// Comments hidden by the instance admins are left out of discussions
+		dbQuery += `
+			AND com.hidden = false`
 	}
 	dbQuery += `
 		ORDER BY date_created ASC`
@@ -163,9 +177,13 @@ func DiscussionComments(dbOwner, dbName string, discID, comID int) (list []Discu
 		return
 	}
 	for rows.Next() {
-		var av, em pgtype.Text
+		var av, em, anchorTable, anchorColumn, anchorCommit, resolvedBy pgtype.Text
+		var anchorKey map[string]string
+		var parentID pgtype.Int8
 		var oneRow DiscussionCommentEntry
-		err = rows.Scan(&oneRow.ID, &oneRow.Commenter, &em, &av, &oneRow.DateCreated, &oneRow.Body, &oneRow.EntryType)
+		err = rows.Scan(&oneRow.ID, &oneRow.Commenter, &em, &av, &oneRow.DateCreated, &oneRow.Body, &oneRow.EntryType,
+			&anchorTable, &anchorKey, &anchorColumn, &anchorCommit, &parentID, &oneRow.Resolved, &resolvedBy,
+			&oneRow.DateResolved)
 		if err != nil {
 			log.Printf("Error retrieving comment list for database '%s/%s', discussion '%d': %v",
 				dbOwner, dbName, discID, err)
@@ -173,13 +191,23 @@ func DiscussionComments(dbOwner, dbName string, discID, comID int) (list []Discu
 			return
 		}
 
+		// Comments on the data diff of a merge request say which row or cell they're about
+		if anchorTable.Valid {
+			oneRow.Anchor = &DataCommentAnchor{
+				Column: anchorColumn.String,
+				Commit: anchorCommit.String,
+				Key:    anchorKey,
+				Table:  anchorTable.String,
+			}
+		}
+		oneRow.ParentID = int(parentID.Int64)
+		oneRow.ResolvedBy = resolvedBy.String
+
 		if av.Valid {
-			oneRow.AvatarURL = av.String
+			oneRow.AvatarURL = AvatarURLSized(av.String, 30)
 		} else {
-			if em.Valid {
-				picHash := md5.Sum([]byte(em.String))
-				oneRow.AvatarURL = fmt.Sprintf("https://www.gravatar.com/avatar/%x?d=identicon&s=30", picHash)
-			}
+			// If no avatar URL is presently stored, use the default one
+			oneRow.AvatarURL = AvatarURLSized(defaultAvatarURL(oneRow.Commenter, em.String), 30)
 		}
 
 		oneRow.BodyRendered = string(gfm.Markdown([]byte(oneRow.Body)))
@@ -191,6 +219,15 @@ func DiscussionComments(dbOwner, dbName string, discID, comID int) (list []Discu
 
 // StoreComment adds a comment to a discussion
 func StoreComment(dbOwner, dbName, commenter string, discID int, comText string, discClose bool, mrState MergeRequestState) error {
+	// Archived databases don't accept new comments
+	archived, err := CheckDBArchived(dbOwner, dbName)
+	if err != nil {
+		return err
+	}
+	if archived {
+		return ErrDBArchived
+	}
+
 	// Begin a transaction
 	tx, err := DB.Begin(context.Background())
 	if err != nil {
@@ -443,6 +480,13 @@ func StoreComment(dbOwner, dbName, commenter string, discID int, comText string,
 			log.Printf("Error when creating a new event: %s", err.Error())
 			return err
 		}
+
+		// Notify any users mentioned in the comment
+		err = NewMentionEvents(details, comText)
+		if err != nil {
+			log.Printf("Error when creating a new mention event: %s", err.Error())
+			return err
+		}
 	}
 
 	// Commit the transaction
@@ -2,10 +2,10 @@ package database
 
 import (
 	"context"
-	"crypto/md5"
 	"errors"
 	"fmt"
 	"log"
+	"net/url"
 	"strings"
 	"time"
 
@@ -30,6 +30,7 @@ const (
 )
 
 type DiscussionEntry struct {
+	Assignee     string            `json:"assignee"`
 	AvatarURL    string            `json:"avatar_url"`
 	Body         string            `json:"body"`
 	BodyRendered string            `json:"body_rendered"`
@@ -37,21 +38,37 @@ type DiscussionEntry struct {
 	Creator      string            `json:"creator"`
 	DateCreated  time.Time         `json:"creation_date"`
 	ID           int               `json:"disc_id"`
+	Labels       []string          `json:"labels"`
 	LastModified time.Time         `json:"last_modified"`
+	Milestone    string            `json:"milestone"`
 	MRDetails    MergeRequestEntry `json:"mr_details"`
 	Open         bool              `json:"open"`
 	Title        string            `json:"title"`
 	Type         DiscussionType    `json:"discussion_type"`
 }
 
+// DiscussionFilter holds the optional criteria used to narrow down a list of discussions or MRs.  Empty strings and
+// nil values match everything
+type DiscussionFilter struct {
+	Assignee  string
+	Label     string
+	Milestone string
+	Open      *bool
+}
+
 type MergeRequestEntry struct {
-	Commits      []CommitEntry     `json:"commits"`
-	DestBranch   string            `json:"destination_branch"`
-	SourceBranch string            `json:"source_branch"`
-	SourceDBID   int64             `json:"source_database_id"`
-	SourceDBName string            `json:"source_database_name"`
-	SourceOwner  string            `json:"source_owner"`
-	State        MergeRequestState `json:"state"`
+	Commits            []CommitEntry        `json:"commits"`
+	DestBranch         string               `json:"destination_branch"`
+	LicenceWarnings    []string             `json:"licence_warnings,omitempty"`
+	MergeBlocked       string               `json:"merge_blocked,omitempty"`
+	RequestedReviewers []string             `json:"requested_reviewers,omitempty"`
+	Reviews            []MergeRequestReview `json:"reviews,omitempty"`
+	SourceBranch       string               `json:"source_branch"`
+	SourceDBID         int64                `json:"source_database_id"`
+	SourceDBName       string               `json:"source_database_name"`
+	SourceOwner        string               `json:"source_owner"`
+	State              MergeRequestState    `json:"state"`
+	StatusChecks       []CommitStatus       `json:"status_checks,omitempty"`
 }
 
 // Discussions returns the list of discussions or MRs for a given database
@@ -63,6 +80,12 @@ type MergeRequestEntry struct {
 //	need to preserve the order, it might be useful to switch to using a map instead since they're often simpler
 //	to work with.
 func Discussions(dbOwner, dbName string, discType DiscussionType, discID int) (list []DiscussionEntry, err error) {
+	return DiscussionsFiltered(dbOwner, dbName, discType, discID, DiscussionFilter{})
+}
+
+// DiscussionsFiltered returns the list of discussions or MRs for a given database which match the filter.  As with
+// Discussions(), a non-0 discID value only returns the details for that specific discussion/MR
+func DiscussionsFiltered(dbOwner, dbName string, discType DiscussionType, discID int, filter DiscussionFilter) (list []DiscussionEntry, err error) {
 	dbQuery := `
 		WITH u AS (
 			SELECT user_id
@@ -75,11 +98,29 @@ func Discussions(dbOwner, dbName string, discType DiscussionType, discID int) (l
 				AND db.db_name = $2)
 		SELECT disc.disc_id, disc.title, disc.open, disc.date_created, users.user_name, users.email, users.avatar_url,
 			disc.description, last_modified, comment_count, mr_source_db_id, mr_source_db_branch,
-			mr_destination_branch, mr_state, mr_commits
-		FROM discussions AS disc, d, users
+			mr_destination_branch, mr_state, mr_commits, coalesce(assignee.user_name, ''),
+			coalesce(milestone.title, ''),
+			coalesce((
+				SELECT array_agg(l.name ORDER BY lower(l.name))
+				FROM discussion_labels AS dl, labels AS l
+				WHERE dl.internal_id = disc.internal_id
+					AND dl.label_id = l.label_id
+			), '{}')
+		FROM discussions AS disc
+			LEFT JOIN users AS assignee ON assignee.user_id = disc.assignee
+			LEFT JOIN milestones AS milestone ON milestone.milestone_id = disc.milestone_id, d, users
 		WHERE disc.db_id = d.db_id
 			AND disc.discussion_type = $3
-			AND disc.creator = users.user_id`
+			AND disc.creator = users.user_id
+			AND ($4::text = '' OR lower(assignee.user_name) = lower($4))
+			AND ($5::text = '' OR EXISTS (
+				SELECT 1
+				FROM discussion_labels AS dl, labels AS l
+				WHERE dl.internal_id = disc.internal_id
+					AND dl.label_id = l.label_id
+					AND lower(l.name) = lower($5)))
+			AND ($6::text = '' OR lower(milestone.title) = lower($6))
+			AND ($7::boolean IS NULL OR disc.open = $7)`
 	if discID != 0 {
 		dbQuery += fmt.Sprintf(`
 			AND disc_id = %d`, discID)
@@ -87,7 +128,8 @@ func Discussions(dbOwner, dbName string, discType DiscussionType, discID int) (l
 	dbQuery += `
 		ORDER BY last_modified DESC`
 	var rows pgx.Rows
-	rows, err = DB.Query(context.Background(), dbQuery, dbOwner, dbName, discType)
+	rows, err = DB.Query(context.Background(), dbQuery, dbOwner, dbName, discType, filter.Assignee, filter.Label,
+		filter.Milestone, filter.Open)
 	if err != nil {
 		log.Printf("Database query failed: %v", err)
 		return
@@ -98,7 +140,7 @@ func Discussions(dbOwner, dbName string, discType DiscussionType, discID int) (l
 		var oneRow DiscussionEntry
 		err = rows.Scan(&oneRow.ID, &oneRow.Title, &oneRow.Open, &oneRow.DateCreated, &oneRow.Creator, &em, &av,
 			&oneRow.Body, &oneRow.LastModified, &oneRow.CommentCount, &sdb, &sb, &db, &oneRow.MRDetails.State,
-			&oneRow.MRDetails.Commits)
+			&oneRow.MRDetails.Commits, &oneRow.Assignee, &oneRow.Milestone, &oneRow.Labels)
 		if err != nil {
 			log.Printf("Error retrieving discussion/MR list for database '%s/%s': %v",
 				dbOwner, dbName, err)
@@ -106,13 +148,10 @@ func Discussions(dbOwner, dbName string, discType DiscussionType, discID int) (l
 			return
 		}
 		if av.Valid {
-			oneRow.AvatarURL = av.String
+			oneRow.AvatarURL = AvatarURLSized(av.String, 30)
 		} else {
-			// If no avatar URL is presently stored, default to a gravatar based on the users email (if known)
-			if em.Valid {
-				picHash := md5.Sum([]byte(em.String))
-				oneRow.AvatarURL = fmt.Sprintf("https://www.gravatar.com/avatar/%x?d=identicon&s=30", picHash)
-			}
+			// If no avatar URL is presently stored, use the default one
+			oneRow.AvatarURL = AvatarURLSized(defaultAvatarURL(oneRow.Creator, em.String), 30)
 		}
 		if discType == MERGE_REQUEST && sdb.Valid {
 			oneRow.MRDetails.SourceDBID = sdb.Int64
@@ -155,10 +194,96 @@ func Discussions(dbOwner, dbName string, discType DiscussionType, discID int) (l
 	return
 }
 
+// NewAssignmentEvent generates an event notifying a user a discussion or MR has been assigned to them.  Nothing is
+// generated when users assign things to themselves
+func NewAssignmentEvent(dbOwner, dbName, loggedInUser string, discID int, assignee string) (err error) {
+	if assignee == "" || strings.ToLower(assignee) == strings.ToLower(loggedInUser) {
+		return
+	}
+
+	// Retrieve the title and type of the discussion
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+				AND is_deleted = false
+		)
+		SELECT title, discussion_type
+		FROM discussions
+		WHERE db_id = (SELECT db_id FROM d)
+			AND disc_id = $3`
+	var title string
+	var discType DiscussionType
+	err = DB.QueryRow(context.Background(), dbQuery, dbOwner, dbName, discID).Scan(&title, &discType)
+	if err != nil {
+		log.Printf("Error retrieving details of discussion '%d' for '%s/%s': %v", discID, dbOwner, dbName, err)
+		return
+	}
+	page := "discuss"
+	if discType == MERGE_REQUEST {
+		page = "merge"
+	}
+	details := EventDetails{
+		DBName:     dbName,
+		DiscID:     discID,
+		Owner:      dbOwner,
+		Recipients: []string{assignee},
+		Title:      title,
+		Type:       EVENT_ASSIGNED,
+		URL:        fmt.Sprintf("/%s/%s/%s?id=%d", page, url.PathEscape(dbOwner), url.PathEscape(dbName), discID),
+		UserName:   loggedInUser,
+	}
+	return NewEvent(details)
+}
+
+// SetDiscussionAssignee assigns a discussion or MR to a user.  An empty assignee name removes the assignment.  The
+// returned boolean is false if the discussion or MR doesn't exist
+func SetDiscussionAssignee(dbOwner, dbName string, discID int, assignee string) (exists bool, err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+				AND is_deleted = false
+		)
+		UPDATE discussions
+		SET assignee = (SELECT user_id FROM users WHERE lower(user_name) = lower(nullif($4, '')))
+		WHERE db_id = (SELECT db_id FROM d)
+			AND disc_id = $3`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, discID, assignee)
+	if err != nil {
+		log.Printf("Assigning discussion '%d' of '%s/%s' to '%s' failed: %v", discID, dbOwner, dbName, assignee,
+			err)
+		return
+	}
+	exists = commandTag.RowsAffected() == 1
+	return
+}
+
 // StoreDiscussion stores a new discussion for a database
 func StoreDiscussion(dbOwner, dbName, loggedInUser, title, text string, discType DiscussionType,
 	mr MergeRequestEntry) (newID int, err error) {
 
+	// Archived databases don't accept new discussions or merge requests
+	archived, err := CheckDBArchived(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	if archived {
+		return 0, ErrDBArchived
+	}
+
 	// Begin a transaction
 	tx, err := DB.Begin(context.Background())
 	if err != nil {
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// LiveDatabaseFile is the location in Minio of the file for a live database
+type LiveDatabaseFile struct {
+	Bucket string
+	ID     string
+	Owner  string
+}
+
+// UserEncryptionKey is the key used for encrypting the database files of a user, encrypted with the instance key
+// named in KeyID
+type UserEncryptionKey struct {
+	Key    []byte
+	KeyID  string
+	UserID int64
+}
+
+// AddUserEncryptionKey stores the encryption key for a user, unless they already have one.  It returns whether the key
+// was stored
+func AddUserEncryptionKey(userID int64, keyID string, key []byte) (bool, error) {
+	dbQuery := `
+		UPDATE users
+		SET encryption_key = $2, encryption_key_id = $3
+		WHERE user_id = $1
+			AND encryption_key IS NULL`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, userID, key, keyID)
+	if err != nil {
+		log.Printf("Storing the encryption key for user ID '%d' failed: %v", userID, err)
+		return false, err
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+// DatabaseFileOwners returns the SHA256 of each standard database file, along with the name of a user owning a
+// database using it
+func DatabaseFileOwners() (map[string]string, error) {
+	dbQuery := `
+		SELECT DISTINCT ON (e.sha256) e.sha256, u.user_name
+		FROM commits AS c, sqlite_databases AS db, users AS u,
+			jsonb_to_recordset(c.tree->'entries') AS e(entry_type text, sha256 text)
+		WHERE c.db_id = db.db_id
+			AND db.user_id = u.user_id
+			AND e.entry_type = 'db'
+		ORDER BY e.sha256, db.db_id`
+	rows, err := DB.Query(context.Background(), dbQuery)
+	if err != nil {
+		log.Printf("Retrieving the list of database files failed: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+	owners := make(map[string]string)
+	for rows.Next() {
+		var sha, owner string
+		err = rows.Scan(&sha, &owner)
+		if err != nil {
+			log.Printf("Retrieving the list of database files failed: %v", err)
+			return nil, err
+		}
+		owners[sha] = owner
+	}
+	if err = rows.Err(); err != nil {
+		log.Printf("Retrieving the list of database files failed: %v", err)
+		return nil, err
+	}
+	return owners, nil
+}
+
+// LiveDatabaseFiles returns the locations in Minio of the files for all the live databases
+func LiveDatabaseFiles() ([]LiveDatabaseFile, error) {
+	// Databases from before a user had a bucket name assigned use the initial "live-username" naming scheme
+	dbQuery := `
+		SELECT CASE WHEN coalesce(u.live_minio_bucket_name, '') = '' OR coalesce(db.live_minio_object_id, '') = ''
+				THEN 'live-' || u.user_name ELSE u.live_minio_bucket_name END,
+			CASE WHEN coalesce(u.live_minio_bucket_name, '') = '' OR coalesce(db.live_minio_object_id, '') = ''
+				THEN db.db_name ELSE db.live_minio_object_id END,
+			u.user_name
+		FROM sqlite_databases AS db, users AS u
+		WHERE db.user_id = u.user_id
+			AND db.live_db = true
+			AND db.is_deleted = false`
+	rows, err := DB.Query(context.Background(), dbQuery)
+	if err != nil {
+		log.Printf("Retrieving the list of live database files failed: %v", err)
+		return nil, err
+	}
+	files, err := pgx.CollectRows(rows, pgx.RowToStructByPos[LiveDatabaseFile])
+	if err != nil {
+		log.Printf("Retrieving the list of live database files failed: %v", err)
+		return nil, err
+	}
+	return files, nil
+}
+
+// UpdateUserEncryptionKey replaces the stored copy of the encryption key for a user, after it's been encrypted again
+// with a different instance key
+func UpdateUserEncryptionKey(userID int64, keyID string, key []byte) error {
+	dbQuery := `
+		UPDATE users
+		SET encryption_key = $2, encryption_key_id = $3
+		WHERE user_id = $1`
+	_, err := DB.Exec(context.Background(), dbQuery, userID, key, keyID)
+	if err != nil {
+		log.Printf("Updating the encryption key for user ID '%d' failed: %v", userID, err)
+	}
+	return err
+}
+
+// UserEncryptionKeyByID returns the encryption key for a user.  The key is nil if the user doesn't have one yet
+func UserEncryptionKeyByID(userID int64) (key UserEncryptionKey, err error) {
+	dbQuery := `
+		SELECT user_id, encryption_key, coalesce(encryption_key_id, '')
+		FROM users
+		WHERE user_id = $1`
+	err = DB.QueryRow(context.Background(), dbQuery, userID).Scan(&key.UserID, &key.Key, &key.KeyID)
+	if err != nil {
+		log.Printf("Retrieving the encryption key for user ID '%d' failed: %v", userID, err)
+	}
+	return
+}
+
+// UserEncryptionKeyByName returns the encryption key for a user.  The key is nil if the user doesn't have one yet
+func UserEncryptionKeyByName(userName string) (key UserEncryptionKey, err error) {
+	dbQuery := `
+		SELECT user_id, encryption_key, coalesce(encryption_key_id, '')
+		FROM users
+		WHERE lower(user_name) = lower($1)`
+	err = DB.QueryRow(context.Background(), dbQuery, userName).Scan(&key.UserID, &key.Key, &key.KeyID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return key, errors.New("unknown user")
+		}
+		log.Printf("Retrieving the encryption key for user '%s' failed: %v", userName, err)
+	}
+	return
+}
+
+// UserEncryptionKeys returns the encryption keys of all the users which have one
+func UserEncryptionKeys() ([]UserEncryptionKey, error) {
+	dbQuery := `
+		SELECT encryption_key, encryption_key_id, user_id
+		FROM users
+		WHERE encryption_key IS NOT NULL
+		ORDER BY user_id`
+	rows, err := DB.Query(context.Background(), dbQuery)
+	if err != nil {
+		log.Printf("Retrieving the user encryption keys failed: %v", err)
+		return nil, err
+	}
+	keys, err := pgx.CollectRows(rows, pgx.RowToStructByPos[UserEncryptionKey])
+	if err != nil {
+		log.Printf("Retrieving the user encryption keys failed: %v", err)
+		return nil, err
+	}
+	return keys, nil
+}
@@ -2,8 +2,17 @@ package database
 
 import (
 	"context"
+	"log"
+	"time"
 )
 
+// EventEntry holds the details of an event, as returned to users through the events API
+type EventEntry struct {
+	Details   EventDetails `json:"details"`
+	ID        int64        `json:"id"`
+	Timestamp time.Time    `json:"timestamp"`
+}
+
 // NewEvent adds an event entry to PostgreSQL
 func NewEvent(details EventDetails) (err error) {
 	dbQuery := `
@@ -26,3 +35,55 @@ func NewEvent(details EventDetails) (err error) {
 	}
 	return
 }
+
+// UserEvents returns the events with an ID greater than sinceID, for the databases a user is watching and still has
+// access to.  Events meant for specific users (such as mentions) are only returned to those users, whether they're
+// watching the database or not.  Events generated by the user themselves aren't included
+func UserEvents(userName string, sinceID int64, maxEvents int) (events []EventEntry, err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id, user_name
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		)
+		SELECT e.event_id, e.event_timestamp, e.event_data
+		FROM events AS e
+			JOIN sqlite_databases AS db ON db.db_id = e.db_id AND db.is_deleted = false
+		WHERE e.event_id > $2
+			AND lower(coalesce(e.event_data->>'username', '')) <> lower($1)
+			AND CASE WHEN e.event_data ? 'recipients'
+				THEN e.event_data->'recipients' ? (SELECT user_name FROM u)
+				ELSE EXISTS (
+					SELECT 1
+					FROM watchers AS w
+					WHERE w.db_id = e.db_id
+						AND w.user_id = (SELECT user_id FROM u)
+				)
+			END
+			AND (db.public = true
+				OR db.user_id = (SELECT user_id FROM u)
+				OR EXISTS (
+					SELECT 1
+					FROM database_shares AS s
+					WHERE s.db_id = db.db_id
+						AND s.user_id = (SELECT user_id FROM u)
+				))
+		ORDER BY e.event_id ASC
+		LIMIT $3`
+	rows, err := DB.Query(context.Background(), dbQuery, userName, sinceID, maxEvents)
+	if err != nil {
+		log.Printf("Retrieving events for user '%s' failed: %v", userName, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ev EventEntry
+		err = rows.Scan(&ev.ID, &ev.Timestamp, &ev.Details)
+		if err != nil {
+			log.Printf("Error retrieving events for user '%s': %v", userName, err)
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	return
+}
@@ -0,0 +1,152 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// HealthReport is the health report of a commit of a standard database.  Details is only set once the report has been
+// worked out, when the state is "done"
+type HealthReport struct {
+	Commit        string               `json:"commit"`
+	DateCreated   *time.Time           `json:"date_created,omitempty"`
+	DateRequested time.Time            `json:"date_requested"`
+	Details       *HealthReportDetails `json:"details,omitempty"`
+	Error         string               `json:"error,omitempty"`
+	State         string               `json:"state"`
+}
+
+// HealthReportDetails holds the findings of a health report
+type HealthReportDetails struct {
+	FreelistPages   int64             `json:"freelist_pages"`
+	IntegrityErrors []string          `json:"integrity_errors"`
+	IntegrityOK     bool              `json:"integrity_ok"`
+	NoPrimaryKey    []string          `json:"no_primary_key"`
+	PageCount       int64             `json:"page_count"`
+	PageSize        int64             `json:"page_size"`
+	UnusedBytes     int64             `json:"unused_bytes"`
+	VacuumSuggested bool              `json:"vacuum_suggested"`
+	WideTables      []HealthWideTable `json:"wide_tables"`
+}
+
+// HealthReportJob identifies a commit waiting for its health report to be worked out
+type HealthReportJob struct {
+	Commit string
+	DBName string
+	Owner  string
+}
+
+// HealthWideTable is a table with a lot of columns
+type HealthWideTable struct {
+	Columns int    `json:"columns"`
+	Table   string `json:"table"`
+}
+
+// HealthReportFor returns the health report of a commit of a database.  The returned report is nil when one hasn't been
+// asked for yet
+func HealthReportFor(dbOwner, dbName, commitID string) (report *HealthReport, err error) {
+	dbQuery := `
+		SELECT h.commit_id, h.date_created, h.date_requested, h.report, h.error, h.state
+		FROM health_reports AS h
+			JOIN sqlite_databases AS db ON db.db_id = h.db_id
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false
+			AND h.commit_id = $3`
+	var z HealthReport
+	err = DB.QueryRow(context.Background(), dbQuery, dbOwner, dbName, commitID).Scan(&z.Commit, &z.DateCreated,
+		&z.DateRequested, &z.Details, &z.Error, &z.State)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("Retrieving the health report of commit '%s' of '%s/%s' failed: %v", commitID, dbOwner, dbName, err)
+		return
+	}
+	return &z, nil
+}
+
+// HealthReportRequest asks for the health report of a commit of a database to be worked out, if it hasn't been already
+func HealthReportRequest(dbOwner, dbName, commitID string) (err error) {
+	dbQuery := `
+		INSERT INTO health_reports (db_id, commit_id)
+		SELECT db.db_id, $3
+		FROM sqlite_databases AS db
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false
+		ON CONFLICT (db_id, commit_id) DO NOTHING`
+	_, err = DB.Exec(context.Background(), dbQuery, dbOwner, dbName, commitID)
+	if err != nil {
+		log.Printf("Requesting the health report of commit '%s' of '%s/%s' failed: %v", commitID, dbOwner, dbName, err)
+	}
+	return
+}
+
+// HealthReportSave stores the health report of a commit of a database.  When errMsg isn't empty, the report couldn't be
+// worked out and is marked as failed
+func HealthReportSave(dbOwner, dbName, commitID string, details *HealthReportDetails, errMsg string) (err error) {
+	state := "done"
+	if errMsg != "" {
+		state = "failed"
+		details = nil
+	}
+	dbQuery := `
+		UPDATE health_reports AS h
+		SET state = $4, report = $5, error = $6, date_created = now()
+		FROM sqlite_databases AS db
+		WHERE db.db_id = h.db_id
+			AND db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND h.commit_id = $3`
+	_, err = DB.Exec(context.Background(), dbQuery, dbOwner, dbName, commitID, state, details, errMsg)
+	if err != nil {
+		log.Printf("Saving the health report of commit '%s' of '%s/%s' failed: %v", commitID, dbOwner, dbName, err)
+	}
+	return
+}
+
+// HealthReportsPending returns the commits waiting for their health reports, oldest request first.  The head commits
+// of the default branches of standard databases are always given a report, so the ones without one are added first
+func HealthReportsPending(limit int) (list []HealthReportJob, err error) {
+	dbQuery := `
+		INSERT INTO health_reports (db_id, commit_id)
+		SELECT db.db_id, db.latest_commit_id
+		FROM sqlite_databases AS db
+		WHERE db.is_deleted = false
+			AND db.live_db = false
+			AND db.latest_commit_id IS NOT NULL
+		ON CONFLICT (db_id, commit_id) DO NOTHING`
+	_, err = DB.Exec(context.Background(), dbQuery)
+	if err != nil {
+		log.Printf("Adding the head commits without health reports failed: %v", err)
+		return
+	}
+
+	dbQuery = `
+		SELECT u.user_name, db.db_name, h.commit_id
+		FROM health_reports AS h
+			JOIN sqlite_databases AS db ON db.db_id = h.db_id
+			JOIN users AS u ON u.user_id = db.user_id
+		WHERE h.state = 'pending'
+			AND db.is_deleted = false
+		ORDER BY h.date_requested
+		LIMIT $1`
+	rows, err := DB.Query(context.Background(), dbQuery, limit)
+	if err != nil {
+		log.Printf("Retrieving the pending health reports failed: %v", err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (j HealthReportJob, err error) {
+		err = row.Scan(&j.Owner, &j.DBName, &j.Commit)
+		return
+	})
+	if err != nil {
+		log.Printf("Retrieving the pending health reports failed: %v", err)
+	}
+	return
+}
@@ -0,0 +1,165 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// HeldContent is a new discussion, comment, or database description flagged by the spam filter, which is held for
+// moderation rather than published.  For discussions Body is the discussion text, and for descriptions it's the full
+// description
+type HeldContent struct {
+	Body        string    `json:"body"`
+	DateCreated time.Time `json:"date_created"`
+	DBName      string    `json:"database"`
+	DBOwner     string    `json:"owner"`
+	DiscID      int       `json:"disc_id,omitempty"`
+	HeldID      int64     `json:"held_id"`
+	IP          string    `json:"-"`
+	Kind        string    `json:"kind"`
+	OneLineDesc string    `json:"one_line_description,omitempty"`
+	Reason      string    `json:"reason"`
+	Title       string    `json:"title,omitempty"`
+	User        string    `json:"user"`
+	UserAgent   string    `json:"-"`
+}
+
+// DBDescriptions returns the one line and full descriptions of a database
+func DBDescriptions(dbOwner, dbName string) (oneLineDesc, fullDesc string, err error) {
+	dbQuery := `
+		SELECT coalesce(one_line_description, ''), coalesce(full_description, '')
+		FROM sqlite_databases
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db_name = $2
+			AND is_deleted = false`
+	ctx, cancel := QueryContext()
+	defer cancel()
+	err = DB.QueryRow(ctx, dbQuery, dbOwner, dbName).Scan(&oneLineDesc, &fullDesc)
+	if err != nil {
+		log.Printf("Retrieving the descriptions of database '%s/%s' failed: %v", dbOwner, dbName, err)
+	}
+	return
+}
+
+// HeldContentAdd holds a new discussion, comment, or database description for moderation
+func HeldContentAdd(h HeldContent) (heldID int64, err error) {
+	dbQuery := `
+		INSERT INTO held_content (kind, user_id, db_id, disc_id, title, body, one_line_description, reason, ip,
+			user_agent)
+		SELECT $1, (SELECT user_id FROM users WHERE lower(user_name) = lower($2)), db.db_id, $5, $6, $7, $8, $9, $10,
+			$11
+		FROM sqlite_databases AS db
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($3))
+			AND db.db_name = $4
+			AND db.is_deleted = false
+		RETURNING held_id`
+	err = DB.QueryRow(context.Background(), dbQuery, h.Kind, h.User, h.DBOwner, h.DBName, h.DiscID, h.Title, h.Body,
+		h.OneLineDesc, h.Reason, h.IP, h.UserAgent).Scan(&heldID)
+	if err != nil {
+		log.Printf("Holding a %s by '%s' on database '%s/%s' for moderation failed: %v", h.Kind, h.User, h.DBOwner,
+			h.DBName, err)
+	}
+	return
+}
+
+// HeldContentDelete removes content from the moderation queue, once it's been published or rejected
+func HeldContentDelete(heldID int64) (err error) {
+	dbQuery := `
+		DELETE FROM held_content
+		WHERE held_id = $1`
+	_, err = DB.Exec(context.Background(), dbQuery, heldID)
+	if err != nil {
+		log.Printf("Removing held content %d failed: %v", heldID, err)
+	}
+	return
+}
+
+// HeldContentGet returns held content, and whether it exists
+func HeldContentGet(heldID int64) (h HeldContent, exists bool, err error) {
+	list, err := heldContent("WHERE h.held_id = $1", heldID)
+	if err != nil || len(list) == 0 {
+		return
+	}
+	return list[0], true, nil
+}
+
+// HeldContentList returns the content waiting for moderation, oldest first
+func HeldContentList() (list []HeldContent, err error) {
+	return heldContent("ORDER BY h.date_created LIMIT 500")
+}
+
+// heldContent returns the held content matching the given clauses
+func heldContent(clauses string, args ...interface{}) (list []HeldContent, err error) {
+	dbQuery := `
+		SELECT h.held_id, h.kind, u.user_name, owner.user_name, db.db_name, h.disc_id, h.title, h.body,
+			h.one_line_description, h.reason, h.ip, h.user_agent, h.date_created
+		FROM held_content AS h
+			JOIN users AS u ON u.user_id = h.user_id
+			JOIN sqlite_databases AS db ON db.db_id = h.db_id
+			JOIN users AS owner ON owner.user_id = db.user_id
+		` + clauses
+	rows, err := DB.Query(context.Background(), dbQuery, args...)
+	if err != nil {
+		log.Printf("Retrieving held content failed: %v", err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (h HeldContent, err error) {
+		err = row.Scan(&h.HeldID, &h.Kind, &h.User, &h.DBOwner, &h.DBName, &h.DiscID, &h.Title, &h.Body,
+			&h.OneLineDesc, &h.Reason, &h.IP, &h.UserAgent, &h.DateCreated)
+		return
+	})
+	if err != nil {
+		log.Printf("Retrieving held content failed: %v", err)
+	}
+	return
+}
+
+// RecentPostCount returns the number of discussions and comments a user has posted in the last hour, including those
+// held for moderation
+func RecentPostCount(userName string) (count int, err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		)
+		SELECT (SELECT count(*) FROM discussions WHERE creator = (SELECT user_id FROM u)
+				AND date_created > now() - interval '1 hour')
+			+ (SELECT count(*) FROM discussion_comments WHERE commenter = (SELECT user_id FROM u)
+				AND entry_type = 'txt' AND date_created > now() - interval '1 hour')
+			+ (SELECT count(*) FROM held_content WHERE user_id = (SELECT user_id FROM u)
+				AND kind != 'description' AND date_created > now() - interval '1 hour')`
+	ctx, cancel := QueryContext()
+	defer cancel()
+	err = DB.QueryRow(ctx, dbQuery, userName).Scan(&count)
+	if err != nil {
+		log.Printf("Counting the recent posts of user '%s' failed: %v", userName, err)
+	}
+	return
+}
+
+// SetDBDescriptions changes the one line and full descriptions of a database.  Empty descriptions are stored as NULL,
+// the same as when saving the database settings
+func SetDBDescriptions(dbOwner, dbName, oneLineDesc, fullDesc string) (err error) {
+	dbQuery := `
+		UPDATE sqlite_databases
+		SET one_line_description = $3, full_description = $4
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db_name = $2
+			AND is_deleted = false`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName,
+		pgtype.Text{String: oneLineDesc, Valid: oneLineDesc != ""}, pgtype.Text{String: fullDesc, Valid: fullDesc != ""})
+	if err != nil {
+		log.Printf("Updating the descriptions of database '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	if commandTag.RowsAffected() != 1 {
+		return errors.New("Database not found")
+	}
+	return
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// Invitation is an invitation to sign up, issued by one of the instance admins.  The token itself is only returned when
+// the invitation is created
+type Invitation struct {
+	DateCreated time.Time  `json:"date_created"`
+	DateUsed    *time.Time `json:"date_used"`
+	Email       string     `json:"email"`
+	ExpiryDate  time.Time  `json:"expiry_date"`
+	InvitedBy   string     `json:"invited_by"`
+	InviteID    int64      `json:"invite_id"`
+	Token       string     `json:"token,omitempty"`
+	UsedEmail   string     `json:"used_email"`
+}
+
+// InvitationClaim marks an invitation as used by a new user signing up with the given email address.  It returns the
+// ID of the invitation, or 0 when the token doesn't match an unused and unexpired invitation for the email address
+func InvitationClaim(token, email string) (inviteID int64, err error) {
+	dbQuery := `
+		UPDATE invitations
+		SET used_email = $2, date_used = now()
+		WHERE token_hash = $1
+			AND date_used IS NULL
+			AND expiry_date > now()
+			AND (email = '' OR lower(email) = lower($2))
+		RETURNING invite_id`
+	err = DB.QueryRow(context.Background(), dbQuery, fmt.Sprintf("%x", sha256.Sum256([]byte(token))), email).Scan(&inviteID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		log.Printf("Claiming an invitation for '%s' failed: %v", email, err)
+	}
+	return
+}
+
+// InvitationCreate issues an invitation to sign up, returning it along with its token.  When an email address is given
+// only that address can use the invitation, and the token is emailed to it
+func InvitationCreate(adminUser, email string, expiryDate time.Time) (inv Invitation, err error) {
+	data := make([]byte, 24)
+	_, err = rand.Read(data)
+	if err != nil {
+		return
+	}
+	inv.Token = strings.Trim(base64.URLEncoding.EncodeToString(data), "=")
+
+	ctx := context.Background()
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback(ctx)
+	dbQuery := `
+		INSERT INTO invitations (token_hash, email, created_by, expiry_date)
+		VALUES ($1, $2, (SELECT user_id FROM users WHERE lower(user_name) = lower($3)), $4)
+		RETURNING invite_id, date_created`
+	err = tx.QueryRow(ctx, dbQuery, fmt.Sprintf("%x", sha256.Sum256([]byte(inv.Token))), email, adminUser,
+		expiryDate).Scan(&inv.InviteID, &inv.DateCreated)
+	if err != nil {
+		log.Printf("Creating an invitation by '%s' failed: %v", adminUser, err)
+		return
+	}
+	inv.Email = email
+	inv.ExpiryDate = expiryDate
+	inv.InvitedBy = adminUser
+
+	// Send the invitation
+	if email != "" {
+		dbQuery = `
+			INSERT INTO email_queue (mail_to, subject, body)
+			VALUES ($1, $2, $3)`
+		_, err = tx.Exec(ctx, dbQuery, email, "You've been invited to DBHub.io",
+			fmt.Sprintf("'%s' has invited you to sign up to https://%s.\n\nLog in with this email address, then "+
+				"enter this invitation code when choosing your username:\n\n%s\n\nThe invitation can be used until %s.",
+				adminUser, config.Conf.Web.ServerName, inv.Token, expiryDate.UTC().Format("2 January 2006")))
+		if err != nil {
+			log.Printf("Queuing the invitation email for '%s' failed: %v", email, err)
+			return
+		}
+	}
+	err = tx.Commit(ctx)
+	return
+}
+
+// InvitationRelease makes a claimed invitation usable again, for when signing up fails after the invitation was claimed
+func InvitationRelease(inviteID int64) (err error) {
+	dbQuery := `
+		UPDATE invitations
+		SET used_email = NULL, date_used = NULL
+		WHERE invite_id = $1`
+	_, err = DB.Exec(context.Background(), dbQuery, inviteID)
+	if err != nil {
+		log.Printf("Releasing invitation %d failed: %v", inviteID, err)
+	}
+	return
+}
+
+// InvitationRevoke removes an invitation which hasn't been used yet.  The returned boolean is false when there's no
+// such unused invitation
+func InvitationRevoke(inviteID int64) (exists bool, err error) {
+	dbQuery := `
+		DELETE FROM invitations
+		WHERE invite_id = $1
+			AND date_used IS NULL`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, inviteID)
+	if err != nil {
+		log.Printf("Revoking invitation %d failed: %v", inviteID, err)
+		return
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+// Invitations returns the invitations issued by the instance admins, newest first
+func Invitations() (list []Invitation, err error) {
+	dbQuery := `
+		SELECT i.invite_id, i.email, coalesce(u.user_name, ''), coalesce(i.used_email, ''), i.date_used, i.expiry_date,
+			i.date_created
+		FROM invitations AS i
+			LEFT JOIN users AS u ON u.user_id = i.created_by
+		ORDER BY i.date_created DESC`
+	rows, err := DB.Query(context.Background(), dbQuery)
+	if err != nil {
+		log.Printf("Retrieving invitations failed: %v", err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (i Invitation, err error) {
+		err = row.Scan(&i.InviteID, &i.Email, &i.InvitedBy, &i.UsedEmail, &i.DateUsed, &i.ExpiryDate, &i.DateCreated)
+		return
+	})
+	if err != nil {
+		log.Printf("Retrieving invitations failed: %v", err)
+	}
+	return
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"log"
+)
+
+// JobQueueStats holds the state of the job queue for one live node and priority class.  Jobs targeted at whichever
+// node picks them up first are listed under the node name "any".  The wait times are in seconds, between a job being
+// submitted and a node picking it up, for the jobs picked up in the last hour
+type JobQueueStats struct {
+	AvgWait    float64 `json:"avg_wait"`
+	InProgress int     `json:"in_progress"`
+	MaxWait    float64 `json:"max_wait"`
+	NodeName   string  `json:"node_name"`
+	OldestWait float64 `json:"oldest_waiting"`
+	Priority   string  `json:"priority"`
+	Started    int     `json:"started_last_hour"`
+	Waiting    int     `json:"waiting"`
+}
+
+// jobPriorityNames are the names of the job priority classes, by their value in the job queue
+var jobPriorityNames = map[int]string{
+	0: "interactive",
+	1: "background",
+}
+
+// GetJobQueueStats returns the number of jobs waiting and in progress in the job queue, and how long jobs have waited
+// to be picked up recently, for each live node and priority class
+func GetJobQueueStats() (list []JobQueueStats, err error) {
+	dbQuery := `
+		SELECT target_node, priority,
+			count(*) FILTER (WHERE state = 'new'),
+			count(*) FILTER (WHERE state = 'in progress'),
+			count(*) FILTER (WHERE started_date > now() - interval '1 hour'),
+			coalesce(extract(epoch FROM avg(started_date - submission_date)
+				FILTER (WHERE started_date > now() - interval '1 hour')), 0),
+			coalesce(extract(epoch FROM max(started_date - submission_date)
+				FILTER (WHERE started_date > now() - interval '1 hour')), 0),
+			coalesce(extract(epoch FROM now() - min(submission_date) FILTER (WHERE state = 'new')), 0)
+		FROM job_submissions
+		WHERE state IN ('new', 'in progress')
+			OR started_date > now() - interval '1 hour'
+		GROUP BY target_node, priority
+		ORDER BY target_node, priority`
+	rows, err := JobQueue.Query(context.Background(), dbQuery)
+	if err != nil {
+		log.Printf("Retrieving the job queue statistics failed: %v", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s JobQueueStats
+		var priority int
+		err = rows.Scan(&s.NodeName, &priority, &s.Waiting, &s.InProgress, &s.Started, &s.AvgWait, &s.MaxWait,
+			&s.OldestWait)
+		if err != nil {
+			log.Printf("Retrieving the job queue statistics failed: %v", err)
+			return
+		}
+		s.Priority = jobPriorityNames[priority]
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
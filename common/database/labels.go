@@ -0,0 +1,217 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+)
+
+// Label holds the details of a label which can be applied to discussions and merge requests.  Default labels are
+// available on every database, while the other labels belong to a single database
+type Label struct {
+	Colour      string `json:"colour"`
+	Default     bool   `json:"default"`
+	Description string `json:"description"`
+	Name        string `json:"name"`
+}
+
+// AddDefaultLabels adds the default discussion labels to the system.  These are available on every database
+func AddDefaultLabels() (err error) {
+	labels := []Label{
+		{Name: "bug", Colour: "#d73a4a", Description: "Something isn't working"},
+		{Name: "data-error", Colour: "#e99695", Description: "Some of the data is wrong or missing"},
+		{Name: "enhancement", Colour: "#a2eeef", Description: "New feature or request"},
+	}
+	for _, l := range labels {
+		dbQuery := `
+			INSERT INTO labels (db_id, name, colour, description)
+			VALUES (NULL, $1, $2, $3)
+			ON CONFLICT ((coalesce(db_id, 0)), (lower(name)))
+				DO NOTHING`
+		_, err = DB.Exec(context.Background(), dbQuery, l.Name, l.Colour, l.Description)
+		if err != nil {
+			log.Printf("%v: error when adding the default label '%s' to the database: %v",
+				config.Conf.Live.Nodename, l.Name, err)
+			return
+		}
+	}
+	log.Printf("%v: default labels added", config.Conf.Live.Nodename)
+	return
+}
+
+// LabelDelete deletes a label from a database.  The default labels can't be deleted
+func LabelDelete(dbOwner, dbName, labelName string) (err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+		)
+		DELETE FROM labels
+		WHERE db_id = (SELECT db_id FROM d)
+			AND lower(name) = lower($3)`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, labelName)
+	if err != nil {
+		log.Printf("Deleting label '%s' for database '%s/%s' failed: %v", labelName, dbOwner, dbName, err)
+		return
+	}
+	if numRows := commandTag.RowsAffected(); numRows != 1 {
+		return fmt.Errorf("Label '%s' not found", labelName)
+	}
+	return
+}
+
+// LabelSave creates or updates a label for a database.  Saving a label with the same name as a default label
+// overrides the default one for the database
+func LabelSave(dbOwner, dbName, labelName, colour, description string) (err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+				AND is_deleted = false
+		)
+		INSERT INTO labels (db_id, name, colour, description)
+		SELECT db_id, $3, $4, $5
+		FROM d
+		ON CONFLICT ((coalesce(db_id, 0)), (lower(name)))
+			DO UPDATE
+			SET name = $3,
+				colour = $4,
+				description = $5`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, labelName, colour, description)
+	if err != nil {
+		log.Printf("Saving label '%s' for database '%s/%s' failed: %v", labelName, dbOwner, dbName, err)
+		return
+	}
+	if numRows := commandTag.RowsAffected(); numRows != 1 {
+		log.Printf("Wrong number of rows (%d) affected when saving label '%s' for database '%s/%s'", numRows,
+			labelName, dbOwner, dbName)
+	}
+	return
+}
+
+// Labels returns the list of labels available for a database.  This is the default labels, plus the ones added to
+// the database itself
+func Labels(dbOwner, dbName string) (labels []Label, err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+				AND is_deleted = false
+		)
+		SELECT name, colour, description, is_default
+		FROM (
+			SELECT DISTINCT ON (lower(l.name)) l.name, l.colour, l.description, l.db_id IS NULL AS is_default
+			FROM labels AS l
+			WHERE l.db_id = (SELECT db_id FROM d)
+				OR l.db_id IS NULL
+			ORDER BY lower(l.name), l.db_id NULLS LAST
+		) AS available
+		ORDER BY lower(name)`
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName)
+	if err != nil {
+		log.Printf("Retrieving labels for '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var l Label
+		err = rows.Scan(&l.Name, &l.Colour, &l.Description, &l.Default)
+		if err != nil {
+			log.Printf("Error retrieving labels for '%s/%s': %v", dbOwner, dbName, err)
+			return nil, err
+		}
+		labels = append(labels, l)
+	}
+	return
+}
+
+// SetDiscussionLabels replaces the labels applied to a discussion or MR.  Label names which aren't available for the
+// database are ignored.  The returned boolean is false if the discussion or MR doesn't exist
+func SetDiscussionLabels(dbOwner, dbName string, discID int, labelNames []string) (exists bool, err error) {
+	tx, err := DB.Begin(context.Background())
+	if err != nil {
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	// Retrieve the internal ID of the discussion
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+				AND is_deleted = false
+		)
+		SELECT internal_id, db_id
+		FROM discussions
+		WHERE db_id = (SELECT db_id FROM d)
+			AND disc_id = $3`
+	var internalID, dbID int64
+	err = tx.QueryRow(context.Background(), dbQuery, dbOwner, dbName, discID).Scan(&internalID, &dbID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		log.Printf("Retrieving discussion '%d' of '%s/%s' failed: %v", discID, dbOwner, dbName, err)
+		return
+	}
+
+	// Replace the labels.  When a database has overridden a default label, its own one is used
+	dbQuery = `
+		DELETE FROM discussion_labels
+		WHERE internal_id = $1`
+	_, err = tx.Exec(context.Background(), dbQuery, internalID)
+	if err != nil {
+		log.Printf("Removing the labels of discussion '%d' of '%s/%s' failed: %v", discID, dbOwner, dbName, err)
+		return
+	}
+	for i := range labelNames {
+		labelNames[i] = strings.ToLower(labelNames[i])
+	}
+	dbQuery = `
+		INSERT INTO discussion_labels (internal_id, label_id)
+		SELECT DISTINCT ON (lower(l.name)) $1::bigint, l.label_id
+		FROM labels AS l
+		WHERE (l.db_id = $2 OR l.db_id IS NULL)
+			AND lower(l.name) = ANY($3)
+		ORDER BY lower(l.name), l.db_id NULLS LAST`
+	_, err = tx.Exec(context.Background(), dbQuery, internalID, dbID, labelNames)
+	if err != nil {
+		log.Printf("Labelling discussion '%d' of '%s/%s' failed: %v", discID, dbOwner, dbName, err)
+		return
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return
+	}
+	return true, nil
+}
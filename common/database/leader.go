@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// Leader is used for running a background job on only one node at a time, when several nodes are running it.  The node
+// which is the leader holds a PostgreSQL advisory lock for the job, using its own connection to the server.  If that
+// node dies or loses its connection, the lock is released by the server and another node takes over
+type Leader struct {
+	conn    *pgx.Conn
+	key     int64
+	leading bool
+	name    string
+}
+
+// NewLeader returns the leader election for a background job.  All nodes running the job need to use the same name
+func NewLeader(name string) *Leader {
+	h := fnv.New64a()
+	h.Write([]byte("leader/" + name))
+	return &Leader{key: int64(h.Sum64()), name: name}
+}
+
+// IsLeader returns whether this node is the leader for the job, trying to become it if no other node is.  It needs
+// calling before each run of the job, as leadership can be lost when the connection to PostgreSQL goes away
+func (l *Leader) IsLeader() bool {
+	ctx, cancel := QueryContext()
+	defer cancel()
+
+	// Check we still hold the lock
+	if l.leading {
+		if l.conn.Ping(ctx) == nil {
+			return true
+		}
+		log.Printf("%s: lost the leadership for '%s'", config.Conf.Live.Nodename, l.name)
+		l.close(ctx)
+	}
+
+	// Try to become the leader
+	var err error
+	if l.conn == nil {
+		l.conn, err = pgx.ConnectConfig(ctx, DB.Config().ConnConfig.Copy())
+		if err != nil {
+			log.Printf("%s: couldn't connect to PostgreSQL for the leadership of '%s': %v", config.Conf.Live.Nodename,
+				l.name, err)
+			l.conn = nil
+			return false
+		}
+	}
+	err = l.conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, l.key).Scan(&l.leading)
+	if err != nil {
+		log.Printf("%s: trying to become the leader for '%s' failed: %v", config.Conf.Live.Nodename, l.name, err)
+		l.close(ctx)
+		return false
+	}
+	if l.leading {
+		log.Printf("%s: became the leader for '%s'", config.Conf.Live.Nodename, l.name)
+	}
+	return l.leading
+}
+
+// Resign gives up the leadership for the job if this node holds it, so another node can take over straight away
+func (l *Leader) Resign() {
+	ctx, cancel := QueryContext()
+	defer cancel()
+	l.close(ctx)
+}
+
+// close closes the connection used for the leadership, which releases the lock if this node holds it
+func (l *Leader) close(ctx context.Context) {
+	if l.conn != nil {
+		err := l.conn.Close(ctx)
+		if err != nil {
+			log.Printf("%s: closing the leadership connection for '%s' failed: %v", config.Conf.Live.Nodename, l.name,
+				err)
+		}
+	}
+	l.conn = nil
+	l.leading = false
+}
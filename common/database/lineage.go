@@ -0,0 +1,219 @@
+package database
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// LineageMaxDepth is the maximum number of steps followed in each direction when retrieving a lineage graph
+const LineageMaxDepth = 10
+
+// LineageEdge is a declaration that one database was derived from a commit of another one
+type LineageEdge struct {
+	Commit      string    `json:"commit"`
+	DateAdded   time.Time `json:"date_added"`
+	Derived     int64     `json:"derived"`
+	Description string    `json:"description"`
+	Source      int64     `json:"source"`
+}
+
+// LineageGraph holds the databases a database was derived from, and the databases derived from it, along with the
+// declarations joining them.  Start is the ID of the database the graph was retrieved for
+type LineageGraph struct {
+	Edges []LineageEdge `json:"edges"`
+	Nodes []LineageNode `json:"nodes"`
+	Start int64         `json:"start"`
+}
+
+// LineageNode is a database in a lineage graph.  The name and owner of databases the user can't see aren't included
+type LineageNode struct {
+	Database string `json:"database"`
+	Deleted  bool   `json:"deleted"`
+	ID       int64  `json:"id"`
+	Owner    string `json:"owner"`
+	Private  bool   `json:"private"`
+}
+
+// LineageAdd records that a database was derived from a commit of another database, or changes the description of an
+// existing declaration.  The returned boolean is false when either database or the source commit doesn't exist
+func LineageAdd(dbOwner, dbName, srcOwner, srcName, srcCommit, description string) (exists bool, err error) {
+	dbQuery := `
+		WITH d AS (
+			SELECT db_id
+			FROM sqlite_databases
+			WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+				AND db_name = $2
+				AND is_deleted = false
+		), s AS (
+			SELECT c.db_id
+			FROM sqlite_databases AS db
+				JOIN commits AS c ON c.db_id = db.db_id
+			WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($3))
+				AND db.db_name = $4
+				AND db.is_deleted = false
+				AND c.commit_id = $5
+		)
+		INSERT INTO database_lineage (db_id, source_db_id, source_commit, description)
+		SELECT d.db_id, s.db_id, $5, $6
+		FROM d, s
+		ON CONFLICT (db_id, source_db_id, source_commit)
+			DO UPDATE
+			SET description = $6`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, srcOwner, srcName, srcCommit,
+		description)
+	if err != nil {
+		log.Printf("Adding lineage of '%s/%s' from '%s/%s' commit '%s' failed: %v", dbOwner, dbName, srcOwner,
+			srcName, srcCommit, err)
+		return
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+// LineageGraphFor returns the lineage graph around a database, following the declarations up to LineageMaxDepth steps
+// towards the databases it was derived from and towards the databases derived from it
+func LineageGraphFor(loggedInUser, dbOwner, dbName string) (graph LineageGraph, err error) {
+	dbQuery := `
+		WITH RECURSIVE start AS (
+			SELECT db_id
+			FROM sqlite_databases
+			WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+				AND db_name = $2
+				AND is_deleted = false
+		), up AS (
+			SELECT l.db_id, l.source_db_id, l.source_commit, l.description, l.date_added, 1 AS depth
+			FROM database_lineage AS l, start
+			WHERE l.db_id = start.db_id
+			UNION
+			SELECT l.db_id, l.source_db_id, l.source_commit, l.description, l.date_added, up.depth + 1
+			FROM database_lineage AS l
+				JOIN up ON l.db_id = up.source_db_id
+			WHERE up.depth < $3
+		), down AS (
+			SELECT l.db_id, l.source_db_id, l.source_commit, l.description, l.date_added, 1 AS depth
+			FROM database_lineage AS l, start
+			WHERE l.source_db_id = start.db_id
+			UNION
+			SELECT l.db_id, l.source_db_id, l.source_commit, l.description, l.date_added, down.depth + 1
+			FROM database_lineage AS l
+				JOIN down ON l.source_db_id = down.db_id
+			WHERE down.depth < $3
+		)
+		SELECT DISTINCT db_id, source_db_id, source_commit, description, date_added
+		FROM (
+			SELECT * FROM up
+			UNION ALL
+			SELECT * FROM down
+		) AS e
+		ORDER BY date_added, db_id, source_db_id, source_commit`
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName, LineageMaxDepth)
+	if err != nil {
+		log.Printf("Retrieving lineage graph of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	graph.Edges, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (e LineageEdge, err error) {
+		err = row.Scan(&e.Derived, &e.Source, &e.Commit, &e.Description, &e.DateAdded)
+		return
+	})
+	if err != nil {
+		log.Printf("Retrieving lineage graph of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+
+	// Retrieve the details of the databases in the graph, including the one it was requested for
+	ids := []int64{}
+	for _, e := range graph.Edges {
+		ids = append(ids, e.Derived, e.Source)
+	}
+	dbQuery = `
+		SELECT db.db_id, u.user_name, db.db_name, db.is_deleted,
+			db.public OR lower(u.user_name) = lower($4) OR EXISTS (
+				SELECT 1
+				FROM database_shares AS s
+				WHERE s.db_id = db.db_id
+					AND s.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($4))
+			)
+		FROM sqlite_databases AS db
+			JOIN users AS u ON u.user_id = db.user_id
+		WHERE db.db_id = ANY($3)
+			OR (lower(u.user_name) = lower($1) AND db.db_name = $2 AND db.is_deleted = false)
+		ORDER BY db.db_id`
+	rows, err = DB.Query(context.Background(), dbQuery, dbOwner, dbName, ids, loggedInUser)
+	if err != nil {
+		log.Printf("Retrieving lineage graph databases of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	graph.Nodes, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (n LineageNode, err error) {
+		var visible bool
+		err = row.Scan(&n.ID, &n.Owner, &n.Database, &n.Deleted, &visible)
+		if err != nil {
+			return
+		}
+		if !n.Deleted && strings.EqualFold(n.Owner, dbOwner) && n.Database == dbName {
+			graph.Start = n.ID
+		}
+
+		// Use placeholder details for databases the user can't see, the same as the fork tree does
+		if !visible {
+			n.Database = "private database"
+			n.Owner = ""
+			n.Private = true
+		}
+		if n.Deleted {
+			n.Database = "deleted database"
+			n.Owner = ""
+		}
+		return
+	})
+	if err != nil {
+		log.Printf("Retrieving lineage graph databases of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+
+	// Don't give away the commits of databases the user can't see, or the descriptions written about them
+	private := make(map[int64]bool)
+	for _, n := range graph.Nodes {
+		private[n.ID] = n.Private
+	}
+	for i, e := range graph.Edges {
+		if private[e.Source] {
+			graph.Edges[i].Commit = ""
+		}
+		if private[e.Source] || private[e.Derived] {
+			graph.Edges[i].Description = ""
+		}
+	}
+	return
+}
+
+// LineageRemove removes a declaration that a database was derived from a commit of another database.  The returned
+// boolean is false when there was no such declaration
+func LineageRemove(dbOwner, dbName, srcOwner, srcName, srcCommit string) (exists bool, err error) {
+	dbQuery := `
+		DELETE FROM database_lineage
+		WHERE db_id = (
+				SELECT db_id
+				FROM sqlite_databases
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+					AND db_name = $2
+					AND is_deleted = false
+			)
+			AND source_db_id = (
+				SELECT db_id
+				FROM sqlite_databases
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($3))
+					AND db_name = $4
+					AND is_deleted = false
+			)
+			AND source_commit = $5`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, srcOwner, srcName, srcCommit)
+	if err != nil {
+		log.Printf("Removing lineage of '%s/%s' from '%s/%s' commit '%s' failed: %v", dbOwner, dbName, srcOwner,
+			srcName, srcCommit, err)
+		return
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
@@ -0,0 +1,269 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// LiveAutoVersionAlertFailures is the number of automatic versioning failures in a row after which the database owner
+// is emailed about it
+const LiveAutoVersionAlertFailures = 3
+
+// LiveAutoVersion is the automatic versioning of a live database into a standard database of the same owner.  After
+// the live database has changed, a copy of it is committed to the branch of the target database once it's gone
+// unchanged for Debounce seconds (when OnWrite is set), and/or once Interval minutes have passed since the last
+// version.  When Keep isn't 0, only that many of the most recent automatic versions are kept on the branch
+type LiveAutoVersion struct {
+	Branch      string     `json:"branch"`
+	DateCreated time.Time  `json:"date_created"`
+	DBName      string     `json:"database"`
+	DBOwner     string     `json:"owner"`
+	Debounce    int        `json:"debounce_seconds"`
+	Failures    int        `json:"failures"`
+	Interval    int        `json:"interval_minutes"`
+	Keep        int        `json:"keep_versions"`
+	LastChange  time.Time  `json:"last_change"`
+	LastCommit  string     `json:"last_commit"`
+	LastError   string     `json:"last_error"`
+	LastVersion *time.Time `json:"last_version"`
+	OnWrite     bool       `json:"on_write"`
+	Pending     bool       `json:"pending"`
+	Target      string     `json:"target"`
+}
+
+// liveAutoVersionColumns are the columns scanned into a LiveAutoVersion, in the order of scanLiveAutoVersion
+const liveAutoVersionColumns = `u.user_name, db.db_name, t.db_name, a.branch, a.on_write, a.debounce_seconds,
+	a.interval_minutes, a.keep_versions, a.pending, a.changed_at, a.last_version, a.last_commit, a.last_error,
+	a.failures, a.date_created`
+
+// scanLiveAutoVersion reads a row of liveAutoVersionColumns
+func scanLiveAutoVersion(row pgx.Row) (a LiveAutoVersion, err error) {
+	err = row.Scan(&a.DBOwner, &a.DBName, &a.Target, &a.Branch, &a.OnWrite, &a.Debounce, &a.Interval, &a.Keep,
+		&a.Pending, &a.LastChange, &a.LastVersion, &a.LastCommit, &a.LastError, &a.Failures, &a.DateCreated)
+	return
+}
+
+// LiveAutoVersionDone records the outcome of versioning a live database.  The live database stays pending when it has
+// changed again since the given time of its last change, as read before the version was started.  When it has failed
+// LiveAutoVersionAlertFailures times in a row, the database owner is emailed the given alert
+func LiveAutoVersionDone(dbOwner, dbName string, lastChange time.Time, commitID, versionError, alertSubj, alertMsg string) (err error) {
+	ctx := context.Background()
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	dbQuery := `
+		UPDATE live_auto_versions
+		SET pending = CASE WHEN $5 = '' THEN changed_at > $3 ELSE true END,
+			last_run = now(),
+			last_version = CASE WHEN $5 = '' THEN now() ELSE last_version END,
+			last_commit = CASE WHEN $4 = '' THEN last_commit ELSE $4 END,
+			last_error = $5,
+			failures = CASE WHEN $5 = '' THEN 0 ELSE failures + 1 END
+		WHERE db_id = (
+				SELECT db_id
+				FROM sqlite_databases
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+					AND db_name = $2
+					AND is_deleted = false
+			)
+		RETURNING failures`
+	var failures int
+	err = tx.QueryRow(ctx, dbQuery, dbOwner, dbName, lastChange, commitID, versionError).Scan(&failures)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The automatic versioning was removed while it was running
+		return nil
+	}
+	if err != nil {
+		log.Printf("Recording the automatic version of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+
+	// Only alert the owner once per run of failures, rather than every time it fails
+	if failures == LiveAutoVersionAlertFailures {
+		dbQuery = `
+			INSERT INTO email_queue (mail_to, subject, body)
+			SELECT email, $2, $3
+			FROM users
+			WHERE lower(user_name) = lower($1)
+				AND email IS NOT NULL
+				AND email != ''`
+		_, err = tx.Exec(ctx, dbQuery, dbOwner, alertSubj, alertMsg)
+		if err != nil {
+			log.Printf("Queuing the automatic versioning failure email for '%s/%s' failed: %v", dbOwner, dbName, err)
+			return
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// LiveAutoVersionFor returns the automatic versioning settings of a live database.  The returned boolean is false when
+// it isn't automatically versioned
+func LiveAutoVersionFor(dbOwner, dbName string) (a LiveAutoVersion, exists bool, err error) {
+	dbQuery := `
+		SELECT ` + liveAutoVersionColumns + `
+		FROM live_auto_versions AS a
+			JOIN sqlite_databases AS db ON db.db_id = a.db_id
+			JOIN sqlite_databases AS t ON t.db_id = a.target_db_id
+			JOIN users AS u ON u.user_id = db.user_id
+		WHERE lower(u.user_name) = lower($1)
+			AND db.db_name = $2
+			AND db.is_deleted = false`
+	a, err = scanLiveAutoVersion(DB.QueryRow(context.Background(), dbQuery, dbOwner, dbName))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return a, false, nil
+	}
+	if err != nil {
+		log.Printf("Retrieving the automatic versioning settings of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	return a, true, nil
+}
+
+// LiveAutoVersionOf returns the name of the live database whose automatic versions are committed to a standard
+// database.  The returned name is empty when there's none
+func LiveAutoVersionOf(dbOwner, targetName string) (dbName string, err error) {
+	dbQuery := `
+		SELECT db.db_name
+		FROM live_auto_versions AS a
+			JOIN sqlite_databases AS db ON db.db_id = a.db_id
+			JOIN sqlite_databases AS t ON t.db_id = a.target_db_id
+		WHERE t.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND t.db_name = $2
+			AND t.is_deleted = false
+			AND db.is_deleted = false`
+	err = DB.QueryRow(context.Background(), dbQuery, dbOwner, targetName).Scan(&dbName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		log.Printf("Checking for live databases versioned into '%s/%s' failed: %v", dbOwner, targetName, err)
+	}
+	return
+}
+
+// LiveAutoVersionPending marks a live database as changed, if it's automatically versioned
+func LiveAutoVersionPending(dbOwner, dbName string) (err error) {
+	dbQuery := `
+		UPDATE live_auto_versions
+		SET pending = true,
+			changed_at = now()
+		WHERE db_id = (
+				SELECT db_id
+				FROM sqlite_databases
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+					AND db_name = $2
+					AND is_deleted = false
+			)`
+	_, err = DB.Exec(context.Background(), dbQuery, dbOwner, dbName)
+	if err != nil {
+		log.Printf("Marking '%s/%s' for automatic versioning failed: %v", dbOwner, dbName, err)
+	}
+	return
+}
+
+// LiveAutoVersionRemove stops the automatic versioning of a live database.  The versions already committed are kept.
+// The returned boolean is false when it wasn't being automatically versioned
+func LiveAutoVersionRemove(dbOwner, dbName string) (exists bool, err error) {
+	dbQuery := `
+		DELETE FROM live_auto_versions
+		WHERE db_id = (
+				SELECT db_id
+				FROM sqlite_databases
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+					AND db_name = $2
+					AND is_deleted = false
+			)`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName)
+	if err != nil {
+		log.Printf("Removing the automatic versioning settings of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+// LiveAutoVersionSave sets up the automatic versioning of a live database, replacing any existing settings.  The target
+// database needs to be a standard database of the same owner.  A new version is committed soon after
+func LiveAutoVersionSave(a LiveAutoVersion) (err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		)
+		INSERT INTO live_auto_versions (db_id, target_db_id, branch, on_write, debounce_seconds, interval_minutes,
+			keep_versions)
+		SELECT db.db_id, t.db_id, $4, $5, $6, $7, $8
+		FROM sqlite_databases AS db, sqlite_databases AS t
+		WHERE db.user_id = (SELECT user_id FROM u)
+			AND db.db_name = $2
+			AND db.live_db = true
+			AND db.is_deleted = false
+			AND t.user_id = (SELECT user_id FROM u)
+			AND t.db_name = $3
+			AND t.live_db = false
+			AND t.is_deleted = false
+		ON CONFLICT (db_id)
+			DO UPDATE
+			SET target_db_id = excluded.target_db_id,
+				branch = $4,
+				on_write = $5,
+				debounce_seconds = $6,
+				interval_minutes = $7,
+				keep_versions = $8,
+				pending = true,
+				changed_at = now(),
+				last_error = '',
+				failures = 0`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, a.DBOwner, a.DBName, a.Target, a.Branch, a.OnWrite,
+		a.Debounce, a.Interval, a.Keep)
+	if err != nil {
+		log.Printf("Saving the automatic versioning settings of '%s/%s' failed: %v", a.DBOwner, a.DBName, err)
+		return
+	}
+	if commandTag.RowsAffected() != 1 {
+		return errors.New("Database not found")
+	}
+	return
+}
+
+// LiveAutoVersionsDue returns the automatically versioned live databases on a node which need a new version.  That's
+// those with changes which have either gone unchanged for their debounce time, or whose interval has passed since
+// their last version.  After a failure, the next attempt waits a minute for each failure in a row, up to an hour
+func LiveAutoVersionsDue(liveNode string) (list []LiveAutoVersion, err error) {
+	dbQuery := `
+		SELECT ` + liveAutoVersionColumns + `
+		FROM live_auto_versions AS a
+			JOIN sqlite_databases AS db ON db.db_id = a.db_id
+			JOIN sqlite_databases AS t ON t.db_id = a.target_db_id
+			JOIN users AS u ON u.user_id = db.user_id
+		WHERE db.live_node = $1
+			AND db.is_deleted = false
+			AND t.is_deleted = false
+			AND a.pending = true
+			AND ((a.on_write = true AND a.changed_at <= now() - make_interval(secs => a.debounce_seconds))
+				OR (a.interval_minutes > 0
+					AND (a.last_version IS NULL
+						OR a.last_version <= now() - make_interval(mins => a.interval_minutes))))
+			AND (a.failures = 0
+				OR a.last_run <= now() - make_interval(mins => least(a.failures, 60)))
+		ORDER BY a.changed_at`
+	rows, err := DB.Query(context.Background(), dbQuery, liveNode)
+	if err != nil {
+		log.Printf("Retrieving the due automatic versions failed: %v", err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (LiveAutoVersion, error) {
+		return scanLiveAutoVersion(row)
+	})
+	if err != nil {
+		log.Printf("Retrieving the due automatic versions failed: %v", err)
+	}
+	return
+}
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// LiveDBStats holds the state and recent use of a database on a live node.  State is "open" when the database has
+// connections open to it, "closed" when it's only on disk, and "warming" while it's being downloaded from Minio
+type LiveDBStats struct {
+	Connections int       `json:"connections"`
+	DBName      string    `json:"database"`
+	DBOwner     string    `json:"owner"`
+	Jobs        int64     `json:"jobs"`
+	LastUsed    time.Time `json:"last_used"`
+	Size        int64     `json:"size"`
+	State       string    `json:"state"`
+	WarmDone    int64     `json:"warm_done,omitempty"`
+	WarmTotal   int64     `json:"warm_total,omitempty"`
+}
+
+// LiveNodeStats holds the statistics last reported by a live node.  Evictions and WarmUps count the databases removed
+// from the node for being idle, and downloaded again when next used, since it started.  State is set by the instance
+// admins, rather than reported by the node
+type LiveNodeStats struct {
+	DatabaseCount int           `json:"database_count"`
+	Databases     []LiveDBStats `json:"databases"`
+	DiskFree      int64         `json:"disk_free"`
+	Evictions     int64         `json:"evictions"`
+	MemoryUsed    int64         `json:"memory_used"`
+	NodeName      string        `json:"node_name"`
+	OpenDatabases int           `json:"open_databases"`
+	Reported      time.Time     `json:"reported"`
+	Started       time.Time     `json:"started"`
+	State         string        `json:"state"`
+	WarmUps       int64         `json:"warm_ups"`
+}
+
+// LiveNodeStates are the states a live node can be put in.  Only active nodes are given new databases, and draining
+// nodes move the databases they hold to other nodes
+var LiveNodeStates = map[string]bool{
+	"active":         true,
+	"decommissioned": true,
+	"draining":       true,
+}
+
+// liveNodeReportWindow is how recently a live node needs to have reported its statistics to be given new databases
+const liveNodeReportWindow = "3 minutes"
+
+// GetLiveNodeStats returns the statistics last reported by each of the live nodes
+func GetLiveNodeStats() (list []LiveNodeStats, err error) {
+	dbQuery := `
+		SELECT node_name, state, open_databases, database_count, disk_free, memory_used, databases, evictions,
+			warm_ups, started, reported
+		FROM live_node_stats
+		ORDER BY node_name`
+	rows, err := DB.Query(context.Background(), dbQuery)
+	if err != nil {
+		log.Printf("Retrieving the live node statistics failed: %v", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s LiveNodeStats
+		err = rows.Scan(&s.NodeName, &s.State, &s.OpenDatabases, &s.DatabaseCount, &s.DiskFree, &s.MemoryUsed,
+			&s.Databases, &s.Evictions, &s.WarmUps, &s.Started, &s.Reported)
+		if err != nil {
+			log.Printf("Retrieving the live node statistics failed: %v", err)
+			return
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// LiveNodeDatabaseCount returns the number of live databases placed on a live node
+func LiveNodeDatabaseCount(nodeName string) (count int, err error) {
+	dbQuery := `
+		SELECT count(*)
+		FROM sqlite_databases
+		WHERE live_db = true
+			AND live_node = $1
+			AND is_deleted = false`
+	err = DB.QueryRow(context.Background(), dbQuery, nodeName).Scan(&count)
+	if err != nil {
+		log.Printf("Counting the databases on live node '%s' failed: %v", nodeName, err)
+	}
+	return
+}
+
+// LiveNodeState returns the state of a live node.  Nodes which haven't reported their statistics yet are active
+func LiveNodeState(nodeName string) (state string, err error) {
+	dbQuery := `
+		SELECT state
+		FROM live_node_stats
+		WHERE node_name = $1`
+	err = DB.QueryRow(context.Background(), dbQuery, nodeName).Scan(&state)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "active", nil
+	}
+	if err != nil {
+		log.Printf("Retrieving the state of live node '%s' failed: %v", nodeName, err)
+	}
+	return
+}
+
+// LivePlacementNode returns the least loaded active live node, for placing a database on.  Nodes are compared by the
+// number of databases they have open, then their free disk space, then their memory use.  The exclude node isn't
+// considered, and an empty string is returned when no node is available
+func LivePlacementNode(exclude string) (nodeName string, err error) {
+	dbQuery := `
+		SELECT node_name
+		FROM live_node_stats
+		WHERE state = 'active'
+			AND node_name <> $1
+			AND reported > now() - interval '` + liveNodeReportWindow + `'
+		ORDER BY open_databases, disk_free DESC, memory_used, node_name
+		LIMIT 1`
+	err = DB.QueryRow(context.Background(), dbQuery, exclude).Scan(&nodeName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		log.Printf("Choosing a live node to place a database on failed: %v", err)
+	}
+	return
+}
+
+// SaveLiveNodeStats stores the current statistics of a live node, replacing the ones it reported before.  The state
+// of the node isn't changed
+func SaveLiveNodeStats(s LiveNodeStats) (err error) {
+	if s.Databases == nil {
+		s.Databases = []LiveDBStats{}
+	}
+	dbQuery := `
+		INSERT INTO live_node_stats (node_name, open_databases, database_count, disk_free, memory_used, databases,
+			evictions, warm_ups, started, reported)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, now())
+		ON CONFLICT (node_name) DO UPDATE
+		SET open_databases = excluded.open_databases,
+			database_count = excluded.database_count,
+			disk_free = excluded.disk_free,
+			memory_used = excluded.memory_used,
+			databases = excluded.databases,
+			evictions = excluded.evictions,
+			warm_ups = excluded.warm_ups,
+			started = excluded.started,
+			reported = excluded.reported`
+	_, err = DB.Exec(context.Background(), dbQuery, s.NodeName, s.OpenDatabases, s.DatabaseCount, s.DiskFree,
+		s.MemoryUsed, s.Databases, s.Evictions, s.WarmUps, s.Started)
+	if err != nil {
+		log.Printf("Saving the statistics of live node '%s' failed: %v", s.NodeName, err)
+	}
+	return
+}
+
+// SetLiveNodeState changes the state of a live node.  The returned boolean is false when the node hasn't reported its
+// statistics yet
+func SetLiveNodeState(nodeName, state string) (exists bool, err error) {
+	dbQuery := `
+		UPDATE live_node_stats
+		SET state = $2
+		WHERE node_name = $1`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, nodeName, state)
+	if err != nil {
+		log.Printf("Changing the state of live node '%s' to '%s' failed: %v", nodeName, state, err)
+		return
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// LivePlacement is an entry in the placement history of a live database.  Reason is "created" when the database was
+// first placed on the node, or "drain" when it was moved there from a node being drained
+type LivePlacement struct {
+	Node         string    `json:"node"`
+	Placed       time.Time `json:"placed"`
+	PreviousNode string    `json:"previous_node,omitempty"`
+	Reason       string    `json:"reason"`
+}
+
+// LiveMoveDatabase changes the live node a database is placed on, recording the move in its placement history.  The
+// returned boolean is false when the database wasn't on the from node
+func LiveMoveDatabase(dbOwner, dbName, fromNode, toNode string) (moved bool, err error) {
+	ctx := context.Background()
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	dbQuery := `
+		UPDATE sqlite_databases
+		SET live_node = $4
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db_name = $2
+			AND live_db = true
+			AND live_node = $3
+			AND is_deleted = false
+		RETURNING db_id`
+	var dbID int64
+	err = tx.QueryRow(ctx, dbQuery, dbOwner, dbName, fromNode, toNode).Scan(&dbID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		log.Printf("Moving live database '%s/%s' to node '%s' failed: %v", dbOwner, dbName, toNode, err)
+		return
+	}
+	err = recordLivePlacement(ctx, tx, dbID, toNode, fromNode, "drain")
+	if err != nil {
+		return
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return
+	}
+	return true, nil
+}
+
+// LivePlacements returns the placement history of a live database, most recent first
+func LivePlacements(dbOwner, dbName string) (list []LivePlacement, err error) {
+	dbQuery := `
+		SELECT p.node_name, p.previous_node, p.reason, p.placed_date
+		FROM live_placements AS p
+			JOIN sqlite_databases AS db ON db.db_id = p.db_id
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false
+		ORDER BY p.placed_date DESC, p.placement_id DESC`
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName)
+	if err != nil {
+		log.Printf("Retrieving the placement history of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p LivePlacement
+		err = rows.Scan(&p.Node, &p.PreviousNode, &p.Reason, &p.Placed)
+		if err != nil {
+			log.Printf("Retrieving the placement history of '%s/%s' failed: %v", dbOwner, dbName, err)
+			return
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+// recordLivePlacement adds an entry to the placement history of a live database
+func recordLivePlacement(ctx context.Context, tx pgx.Tx, dbID int64, node, previousNode, reason string) (err error) {
+	dbQuery := `
+		INSERT INTO live_placements (db_id, node_name, previous_node, reason)
+		VALUES ($1, $2, $3, $4)`
+	_, err = tx.Exec(ctx, dbQuery, dbID, node, previousNode, reason)
+	if err != nil {
+		log.Printf("Recording the placement of database ID '%d' on live node '%s' failed: %v", dbID, node, err)
+	}
+	return
+}
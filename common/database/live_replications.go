@@ -0,0 +1,221 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// LiveReplicationAlertFailures is the number of replication failures in a row after which the database owner is
+// emailed about it
+const LiveReplicationAlertFailures = 3
+
+// LiveReplication is the replication of a live database to an external PostgreSQL or MySQL server.  The tables are
+// copied in full whenever the interval has passed, and also after each change to the database when OnWrite is set.
+// The DSN holds the server credentials, so is never returned to users
+type LiveReplication struct {
+	DateCreated time.Time          `json:"date_created"`
+	DBName      string             `json:"database"`
+	DBOwner     string             `json:"owner"`
+	DSN         string             `json:"-"`
+	Failures    int                `json:"failures"`
+	Interval    int                `json:"interval_minutes"`
+	LastError   string             `json:"last_error"`
+	LastSync    *time.Time         `json:"last_sync"`
+	OnWrite     bool               `json:"sync_on_write"`
+	Tables      []ReplicationTable `json:"tables"`
+	TargetType  string             `json:"target_type"`
+}
+
+// ReplicationTable maps a table of a live database to the table it's replicated to.  When Target is empty the table
+// keeps its name.  Columns renames columns in the target table, and Exclude lists columns which aren't replicated
+type ReplicationTable struct {
+	Columns map[string]string `json:"columns,omitempty"`
+	Exclude []string          `json:"exclude,omitempty"`
+	Table   string            `json:"table"`
+	Target  string            `json:"target,omitempty"`
+}
+
+// LiveReplicationFor returns the replication settings of a live database.  The returned boolean is false when it isn't
+// replicated
+func LiveReplicationFor(dbOwner, dbName string) (r LiveReplication, exists bool, err error) {
+	dbQuery := `
+		SELECT u.user_name, db.db_name, r.target_type, r.target_dsn, r.tables, r.sync_on_write, r.interval_minutes,
+			r.last_sync, r.last_error, r.failures, r.date_created
+		FROM live_replications AS r
+			JOIN sqlite_databases AS db ON db.db_id = r.db_id
+			JOIN users AS u ON u.user_id = db.user_id
+		WHERE lower(u.user_name) = lower($1)
+			AND db.db_name = $2
+			AND db.is_deleted = false`
+	err = DB.QueryRow(context.Background(), dbQuery, dbOwner, dbName).Scan(&r.DBOwner, &r.DBName, &r.TargetType,
+		&r.DSN, &r.Tables, &r.OnWrite, &r.Interval, &r.LastSync, &r.LastError, &r.Failures, &r.DateCreated)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return r, false, nil
+	}
+	if err != nil {
+		log.Printf("Retrieving the replication settings of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	return r, true, nil
+}
+
+// LiveReplicationPending marks a live database as needing replication after a change, if it's set to replicate on write
+func LiveReplicationPending(dbOwner, dbName string) (err error) {
+	dbQuery := `
+		UPDATE live_replications
+		SET pending = true
+		WHERE sync_on_write = true
+			AND db_id = (
+				SELECT db_id
+				FROM sqlite_databases
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+					AND db_name = $2
+					AND is_deleted = false
+			)`
+	_, err = DB.Exec(context.Background(), dbQuery, dbOwner, dbName)
+	if err != nil {
+		log.Printf("Marking '%s/%s' for replication failed: %v", dbOwner, dbName, err)
+	}
+	return
+}
+
+// LiveReplicationRemove stops the replication of a live database.  The returned boolean is false when it wasn't being
+// replicated
+func LiveReplicationRemove(dbOwner, dbName string) (exists bool, err error) {
+	dbQuery := `
+		DELETE FROM live_replications
+		WHERE db_id = (
+				SELECT db_id
+				FROM sqlite_databases
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+					AND db_name = $2
+					AND is_deleted = false
+			)`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName)
+	if err != nil {
+		log.Printf("Removing the replication settings of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+// LiveReplicationSave sets up the replication of a live database, replacing any existing settings.  When the DSN is
+// empty, the DSN of the existing settings is kept.  The database is replicated again soon after
+func LiveReplicationSave(r LiveReplication) (err error) {
+	dbQuery := `
+		INSERT INTO live_replications (db_id, target_type, target_dsn, tables, sync_on_write, interval_minutes)
+		SELECT db_id, $3, $4, $5, $6, $7
+		FROM sqlite_databases
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db_name = $2
+			AND live_db = true
+			AND is_deleted = false
+		ON CONFLICT (db_id)
+			DO UPDATE
+			SET target_type = $3,
+				target_dsn = CASE WHEN $4 = '' THEN live_replications.target_dsn ELSE $4 END,
+				tables = $5,
+				sync_on_write = $6,
+				interval_minutes = $7,
+				pending = true,
+				last_error = '',
+				failures = 0`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, r.DBOwner, r.DBName, r.TargetType, r.DSN, r.Tables,
+		r.OnWrite, r.Interval)
+	if err != nil {
+		log.Printf("Saving the replication settings of '%s/%s' failed: %v", r.DBOwner, r.DBName, err)
+		return
+	}
+	if commandTag.RowsAffected() != 1 {
+		return errors.New("Database not found")
+	}
+	return
+}
+
+// LiveReplicationsDue returns the replications of the live databases on a node which need running.  That's those
+// changed since their last replication, and those whose interval has passed
+func LiveReplicationsDue(liveNode string) (list []LiveReplication, err error) {
+	dbQuery := `
+		SELECT u.user_name, db.db_name, r.target_type, r.target_dsn, r.tables, r.sync_on_write, r.interval_minutes,
+			r.last_sync, r.last_error, r.failures, r.date_created
+		FROM live_replications AS r
+			JOIN sqlite_databases AS db ON db.db_id = r.db_id
+			JOIN users AS u ON u.user_id = db.user_id
+		WHERE db.live_node = $1
+			AND db.is_deleted = false
+			AND (r.pending = true
+				OR r.last_sync IS NULL
+				OR r.last_sync < now() - make_interval(mins => r.interval_minutes))
+		ORDER BY r.last_sync NULLS FIRST`
+	rows, err := DB.Query(context.Background(), dbQuery, liveNode)
+	if err != nil {
+		log.Printf("Retrieving the due replications failed: %v", err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (r LiveReplication, err error) {
+		err = row.Scan(&r.DBOwner, &r.DBName, &r.TargetType, &r.DSN, &r.Tables, &r.OnWrite, &r.Interval, &r.LastSync,
+			&r.LastError, &r.Failures, &r.DateCreated)
+		return
+	})
+	if err != nil {
+		log.Printf("Retrieving the due replications failed: %v", err)
+	}
+	return
+}
+
+// LiveReplicationSynced records the outcome of replicating a live database.  When it has failed
+// LiveReplicationAlertFailures times in a row, the database owner is emailed the given alert
+func LiveReplicationSynced(dbOwner, dbName, syncError, alertSubj, alertMsg string) (err error) {
+	ctx := context.Background()
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	dbQuery := `
+		UPDATE live_replications
+		SET pending = false,
+			last_sync = now(),
+			last_error = $3,
+			failures = CASE WHEN $3 = '' THEN 0 ELSE failures + 1 END
+		WHERE db_id = (
+				SELECT db_id
+				FROM sqlite_databases
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+					AND db_name = $2
+					AND is_deleted = false
+			)
+		RETURNING failures`
+	var failures int
+	err = tx.QueryRow(ctx, dbQuery, dbOwner, dbName, syncError).Scan(&failures)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The replication was removed while it was running
+		return nil
+	}
+	if err != nil {
+		log.Printf("Recording the replication of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+
+	// Only alert the owner once per run of failures, rather than every time it fails
+	if failures == LiveReplicationAlertFailures {
+		dbQuery = `
+			INSERT INTO email_queue (mail_to, subject, body)
+			SELECT email, $2, $3
+			FROM users
+			WHERE lower(user_name) = lower($1)
+				AND email IS NOT NULL
+				AND email != ''`
+		_, err = tx.Exec(ctx, dbQuery, dbOwner, alertSubj, alertMsg)
+		if err != nil {
+			log.Printf("Queuing the replication failure email for '%s/%s' failed: %v", dbOwner, dbName, err)
+			return
+		}
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// LiveSandbox is a sandbox of a live database.  It's a live database of its own, created as a copy of its parent, whose
+// changes can be merged back into the parent.  The copy it started from is kept in storage as its base, which isn't
+// returned to users
+type LiveSandbox struct {
+	BaseBucket  string     `json:"-"`
+	BaseObject  string     `json:"-"`
+	DateCreated time.Time  `json:"date_created"`
+	DateMerged  *time.Time `json:"date_merged,omitempty"`
+	DBName      string     `json:"database"`
+	DBOwner     string     `json:"owner"`
+	MergedBy    string     `json:"merged_by,omitempty"`
+	ParentName  string     `json:"parent_database"`
+	ParentOwner string     `json:"parent_owner"`
+	State       string     `json:"state"`
+}
+
+// liveSandboxColumns are the columns scanned into a LiveSandbox, in the order of scanLiveSandbox
+const liveSandboxColumns = `u.user_name, db.db_name, pu.user_name, p.db_name, s.base_bucket, s.base_object, s.state,
+	coalesce(m.user_name, ''), s.date_merged, s.date_created`
+
+// liveSandboxJoins are the tables joined to live_sandboxes to fill in a LiveSandbox
+const liveSandboxJoins = `
+	FROM live_sandboxes AS s
+		JOIN sqlite_databases AS db ON db.db_id = s.db_id
+		JOIN users AS u ON u.user_id = db.user_id
+		JOIN sqlite_databases AS p ON p.db_id = s.parent_db_id
+		JOIN users AS pu ON pu.user_id = p.user_id
+		LEFT JOIN users AS m ON m.user_id = s.merged_by`
+
+// scanLiveSandbox reads a row of liveSandboxColumns
+func scanLiveSandbox(row pgx.Row) (s LiveSandbox, err error) {
+	err = row.Scan(&s.DBOwner, &s.DBName, &s.ParentOwner, &s.ParentName, &s.BaseBucket, &s.BaseObject, &s.State,
+		&s.MergedBy, &s.DateMerged, &s.DateCreated)
+	return
+}
+
+// LiveSandboxAdd records a newly created live database as being a sandbox of another live database
+func LiveSandboxAdd(s LiveSandbox) (err error) {
+	dbQuery := `
+		INSERT INTO live_sandboxes (db_id, parent_db_id, base_bucket, base_object)
+		SELECT db.db_id, p.db_id, $5, $6
+		FROM sqlite_databases AS db, sqlite_databases AS p
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.live_db = true
+			AND db.is_deleted = false
+			AND p.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($3))
+			AND p.db_name = $4
+			AND p.live_db = true
+			AND p.is_deleted = false`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, s.DBOwner, s.DBName, s.ParentOwner, s.ParentName,
+		s.BaseBucket, s.BaseObject)
+	if err != nil {
+		log.Printf("Recording '%s/%s' as a sandbox of '%s/%s' failed: %v", s.DBOwner, s.DBName, s.ParentOwner,
+			s.ParentName, err)
+		return
+	}
+	if commandTag.RowsAffected() != 1 {
+		return errors.New("Database not found")
+	}
+	return
+}
+
+// LiveSandboxFor returns the details of a sandbox.  The returned boolean is false when the database isn't a sandbox
+func LiveSandboxFor(dbOwner, dbName string) (s LiveSandbox, exists bool, err error) {
+	dbQuery := `
+		SELECT ` + liveSandboxColumns + liveSandboxJoins + `
+		WHERE lower(u.user_name) = lower($1)
+			AND db.db_name = $2
+			AND db.is_deleted = false
+			AND p.is_deleted = false`
+	s, err = scanLiveSandbox(DB.QueryRow(context.Background(), dbQuery, dbOwner, dbName))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return s, false, nil
+	}
+	if err != nil {
+		log.Printf("Retrieving the sandbox details of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	return s, true, nil
+}
+
+// LiveSandboxMerged records a sandbox as having been merged into its parent.  The returned boolean is false when the
+// sandbox had already been merged
+func LiveSandboxMerged(dbOwner, dbName, mergedBy string) (merged bool, err error) {
+	dbQuery := `
+		UPDATE live_sandboxes
+		SET state = 'merged',
+			merged_by = (SELECT user_id FROM users WHERE lower(user_name) = lower($3)),
+			date_merged = now()
+		WHERE state = 'open'
+			AND db_id = (
+				SELECT db_id
+				FROM sqlite_databases
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+					AND db_name = $2
+					AND is_deleted = false
+			)`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, mergedBy)
+	if err != nil {
+		log.Printf("Recording the merge of sandbox '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+// LiveSandboxes returns the sandboxes of a live database, newest first.  When the owner is given, only their sandboxes
+// are returned
+func LiveSandboxes(parentOwner, parentName, owner string) (list []LiveSandbox, err error) {
+	dbQuery := `
+		SELECT ` + liveSandboxColumns + liveSandboxJoins + `
+		WHERE lower(pu.user_name) = lower($1)
+			AND p.db_name = $2
+			AND p.is_deleted = false
+			AND db.is_deleted = false
+			AND ($3 = '' OR lower(u.user_name) = lower($3))
+		ORDER BY s.date_created DESC`
+	rows, err := DB.Query(context.Background(), dbQuery, parentOwner, parentName, owner)
+	if err != nil {
+		log.Printf("Retrieving the sandboxes of '%s/%s' failed: %v", parentOwner, parentName, err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (LiveSandbox, error) {
+		return scanLiveSandbox(row)
+	})
+	if err != nil {
+		log.Printf("Retrieving the sandboxes of '%s/%s' failed: %v", parentOwner, parentName, err)
+	}
+	return
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// MaintenanceState is the read only mode set by the instance admins
+type MaintenanceState struct {
+	ChangedBy   string    `json:"changed_by"`
+	DateChanged time.Time `json:"date_changed"`
+	Message     string    `json:"message"`
+	ReadOnly    bool      `json:"read_only"`
+}
+
+// MaintenanceModeGet returns the read only mode set by the instance admins
+func MaintenanceModeGet() (m MaintenanceState, err error) {
+	dbQuery := `
+		SELECT m.read_only, m.message, coalesce(u.user_name, ''), m.date_changed
+		FROM maintenance_mode AS m
+			LEFT JOIN users AS u ON u.user_id = m.changed_by`
+	ctx, cancel := QueryContext()
+	defer cancel()
+	err = DB.QueryRow(ctx, dbQuery).Scan(&m.ReadOnly, &m.Message, &m.ChangedBy, &m.DateChanged)
+	if err != nil {
+		log.Printf("Retrieving the maintenance mode failed: %v", err)
+	}
+	return
+}
+
+// MaintenanceModeSave switches read only mode on or off for all of the daemons
+func MaintenanceModeSave(adminUser string, readOnly bool, message string) (err error) {
+	dbQuery := `
+		UPDATE maintenance_mode
+		SET read_only = $2, message = $3, changed_by = (SELECT user_id FROM users WHERE lower(user_name) = lower($1)),
+			date_changed = now()`
+	_, err = DB.Exec(context.Background(), dbQuery, adminUser, readOnly, message)
+	if err != nil {
+		log.Printf("Changing the maintenance mode by '%s' failed: %v", adminUser, err)
+	}
+	return
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// Matches @username mentions in Markdown text.  The @ needs to be at the start of the text or follow a character which
+// can't be part of an email address or URL, so "someone@example.org" isn't treated as a mention
+var mentionRegex = regexp.MustCompile(`(?:^|[^A-Za-z0-9_.@/-])@([A-Za-z0-9_.-]+)`)
+
+// Mentions returns the list of distinct usernames mentioned in a piece of text, in the order they first appear
+func Mentions(text string) (names []string) {
+	seen := make(map[string]bool)
+	for _, m := range mentionRegex.FindAllStringSubmatch(text, -1) {
+		// Punctuation at the end of a sentence isn't part of the username
+		name := strings.TrimRight(m[1], ".-")
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		names = append(names, name)
+	}
+	return
+}
+
+// NewMentionEvents generates an event for the users mentioned in a piece of text, so they're notified even if they're
+// not watching the database.  Only users who exist and have access to the database are notified, and users
+// mentioning themselves are ignored.  The other event fields are taken from the details passed in
+func NewMentionEvents(details EventDetails, text string) (err error) {
+	names := Mentions(text)
+	if len(names) == 0 {
+		return
+	}
+	details.Recipients, err = eventRecipients(details.Owner, details.DBName, details.UserName, names)
+	if err != nil || len(details.Recipients) == 0 {
+		return
+	}
+	details.Type = EVENT_MENTION
+	return NewEvent(details)
+}
+
+// eventRecipients returns the correctly capitalised names of the given users, skipping the ones who don't exist,
+// can't access the database, or are the user generating the event
+func eventRecipients(dbOwner, dbName, loggedInUser string, names []string) (recipients []string, err error) {
+	for i := range names {
+		names[i] = strings.ToLower(names[i])
+	}
+	dbQuery := `
+		SELECT u.user_name
+		FROM users AS u
+		WHERE lower(u.user_name) = ANY($1)
+			AND lower(u.user_name) <> lower($2)
+		ORDER BY u.user_name`
+	rows, err := DB.Query(context.Background(), dbQuery, names, loggedInUser)
+	if err != nil {
+		log.Printf("Looking up the users mentioned on '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	var users []string
+	for rows.Next() {
+		var u string
+		err = rows.Scan(&u)
+		if err != nil {
+			log.Printf("Error looking up the users mentioned on '%s/%s': %v", dbOwner, dbName, err)
+			rows.Close()
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	rows.Close()
+
+	// Only include the users who can see the database
+	for _, u := range users {
+		var allowed bool
+		allowed, err = CheckDBPermissions(u, dbOwner, dbName, false)
+		if err != nil {
+			return nil, err
+		}
+		if allowed {
+			recipients = append(recipients, u)
+		}
+	}
+	return
+}
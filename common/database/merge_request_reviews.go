@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+const (
+	// ReviewApproved is the state of a review approving the head commit of a merge request
+	ReviewApproved = "approved"
+
+	// ReviewChangesRequested is the state of a review asking for changes to a merge request before it's merged
+	ReviewChangesRequested = "changes_requested"
+)
+
+// MergeRequestReview is a user's review of a merge request.  Only the latest review of each user is kept, and it's for
+// the head commit of the merge request at the time
+type MergeRequestReview struct {
+	Body        string    `json:"body,omitempty"`
+	Commit      string    `json:"commit"`
+	DateCreated time.Time `json:"date_created"`
+	State       string    `json:"state"`
+	User        string    `json:"user"`
+}
+
+// MergeRequestReviewSave records a user's review of the head commit of a merge request, replacing any earlier review
+// they gave it
+func MergeRequestReviewSave(dbOwner, dbName string, discID int, loggedInUser string, review MergeRequestReview) (err error) {
+	dbQuery := `
+		INSERT INTO merge_request_reviews (internal_id, user_id, commit_id, state, body)
+		SELECT disc.internal_id, (SELECT user_id FROM users WHERE lower(user_name) = lower($4)), $5, $6, $7
+		FROM discussions AS disc
+			JOIN sqlite_databases AS db ON db.db_id = disc.db_id
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false
+			AND disc.disc_id = $3
+			AND disc.discussion_type = $8
+		ON CONFLICT (internal_id, user_id)
+			DO UPDATE
+			SET commit_id = $5,
+				state = $6,
+				body = $7,
+				date_created = now()`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, discID, loggedInUser, review.Commit,
+		review.State, review.Body, MERGE_REQUEST)
+	if err != nil {
+		log.Printf("Saving the review of MR '%d' of '%s/%s' by '%s' failed: %v", discID, dbOwner, dbName, loggedInUser,
+			err)
+		return
+	}
+	if commandTag.RowsAffected() != 1 {
+		return errors.New("Merge request not found")
+	}
+	return
+}
+
+// MergeRequestReviews returns the reviews of a merge request, oldest first
+func MergeRequestReviews(dbOwner, dbName string, discID int) (list []MergeRequestReview, err error) {
+	dbQuery := `
+		SELECT r.body, r.commit_id, r.date_created, r.state, u.user_name
+		FROM merge_request_reviews AS r
+			JOIN discussions AS disc ON disc.internal_id = r.internal_id
+			JOIN sqlite_databases AS db ON db.db_id = disc.db_id
+			JOIN users AS u ON u.user_id = r.user_id
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false
+			AND disc.disc_id = $3
+		ORDER BY r.date_created`
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName, discID)
+	if err != nil {
+		log.Printf("Retrieving the reviews of MR '%d' of '%s/%s' failed: %v", discID, dbOwner, dbName, err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (r MergeRequestReview, err error) {
+		err = row.Scan(&r.Body, &r.Commit, &r.DateCreated, &r.State, &r.User)
+		return
+	})
+	if err != nil {
+		log.Printf("Retrieving the reviews of MR '%d' of '%s/%s' failed: %v", discID, dbOwner, dbName, err)
+	}
+	return
+}
+
+// RequiredApprovals returns the number of approvals of its head commit a merge request to a database needs before it
+// can be merged
+func RequiredApprovals(dbOwner, dbName string) (approvals int, err error) {
+	dbQuery := `
+		SELECT required_approvals
+		FROM sqlite_databases
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db_name = $2
+			AND is_deleted = false`
+	err = DB.QueryRow(context.Background(), dbQuery, dbOwner, dbName).Scan(&approvals)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, errors.New("Database not found")
+	}
+	if err != nil {
+		log.Printf("Retrieving the required approvals of '%s/%s' failed: %v", dbOwner, dbName, err)
+	}
+	return
+}
+
+// RequiredApprovalsSet changes the number of approvals of its head commit a merge request to a database needs before
+// it can be merged
+func RequiredApprovalsSet(dbOwner, dbName string, approvals int) (err error) {
+	dbQuery := `
+		UPDATE sqlite_databases
+		SET required_approvals = $3
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db_name = $2
+			AND is_deleted = false`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, approvals)
+	if err != nil {
+		log.Printf("Setting the required approvals of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	if commandTag.RowsAffected() != 1 {
+		return errors.New("Database not found")
+	}
+	return
+}
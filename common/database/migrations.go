@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/database/migrations"
+
+	"github.com/golang-migrate/migrate/v4"
+	pgxmigrate "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// migrationLockID is the PostgreSQL advisory lock held while migrating, so daemons starting at the same time take turns
+const migrationLockID = 7400710
+
+// Migrate brings the database schema up to date, by applying the migrations embedded in the daemons.  Databases created
+// from the old schema file, before migrations were used, are first marked as having the baseline migration applied
+func Migrate() (err error) {
+	// Migrations use their own connections rather than ones from the pool, without the statement timeout as some of them
+	// take a while
+	connConfig := DB.Config().ConnConfig
+	delete(connConfig.RuntimeParams, "statement_timeout")
+
+	// Hold the lock while migrating
+	ctx := context.Background()
+	conn, err := pgx.ConnectConfig(ctx, connConfig)
+	if err != nil {
+		return
+	}
+	defer conn.Close(ctx)
+	_, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockID)
+	if err != nil {
+		return
+	}
+	defer conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+	src, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		return
+	}
+	driver, err := pgxmigrate.WithInstance(stdlib.OpenDB(*connConfig), &pgxmigrate.Config{})
+	if err != nil {
+		return
+	}
+	m, err := migrate.NewWithInstance("iofs", src, "pgx5", driver)
+	if err != nil {
+		return
+	}
+	defer m.Close()
+
+	// Mark databases created from the old schema file as having the baseline
+	_, _, err = m.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		var legacy bool
+		err = conn.QueryRow(ctx, "SELECT to_regclass('public.users') IS NOT NULL").Scan(&legacy)
+		if err != nil {
+			return
+		}
+		if legacy {
+			log.Printf("%s: existing database schema found, marking the baseline migration as applied",
+				config.Conf.Live.Nodename)
+			err = m.Force(0)
+			if err != nil {
+				return
+			}
+		}
+	} else if err != nil {
+		return
+	}
+
+	// Bizarrely, migrate throws a "no change" error when there are no migrations to apply.  So, we work around it:
+	// https://github.com/golang-migrate/migrate/issues/485
+	err = m.Up()
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return
+	}
+	version, _, err := m.Version()
+	if err != nil {
+		return
+	}
+	log.Printf("%s: database schema is at migration %d", config.Conf.Live.Nodename, version)
+	return
+}
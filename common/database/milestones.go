@@ -0,0 +1,155 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Milestone holds the details of a milestone, which groups together discussions and merge requests of a database
+type Milestone struct {
+	ClosedCount int        `json:"closed_count"`
+	Description string     `json:"description"`
+	DueDate     *time.Time `json:"due_date"`
+	Open        bool       `json:"open"`
+	OpenCount   int        `json:"open_count"`
+	Title       string     `json:"title"`
+}
+
+// MilestoneDelete deletes a milestone of a database.  Discussions and MRs which were part of it are kept
+func MilestoneDelete(dbOwner, dbName, title string) (err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+		)
+		DELETE FROM milestones
+		WHERE db_id = (SELECT db_id FROM d)
+			AND lower(title) = lower($3)`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, title)
+	if err != nil {
+		log.Printf("Deleting milestone '%s' for database '%s/%s' failed: %v", title, dbOwner, dbName, err)
+		return
+	}
+	if numRows := commandTag.RowsAffected(); numRows != 1 {
+		return fmt.Errorf("Milestone '%s' not found", title)
+	}
+	return
+}
+
+// MilestoneSave creates or updates a milestone for a database.  A nil due date means the milestone doesn't have one
+func MilestoneSave(dbOwner, dbName, title, description string, dueDate *time.Time, open bool) (err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+				AND is_deleted = false
+		)
+		INSERT INTO milestones (db_id, title, description, due_date, open)
+		SELECT db_id, $3, $4, $5, $6
+		FROM d
+		ON CONFLICT (db_id, lower(title))
+			DO UPDATE
+			SET title = $3,
+				description = $4,
+				due_date = $5,
+				open = $6`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, title, description, dueDate, open)
+	if err != nil {
+		log.Printf("Saving milestone '%s' for database '%s/%s' failed: %v", title, dbOwner, dbName, err)
+		return
+	}
+	if numRows := commandTag.RowsAffected(); numRows != 1 {
+		log.Printf("Wrong number of rows (%d) affected when saving milestone '%s' for database '%s/%s'", numRows,
+			title, dbOwner, dbName)
+	}
+	return
+}
+
+// Milestones returns the list of milestones for a database, along with the number of open and closed discussions and
+// MRs in each of them.  Open milestones are listed first, with the ones due soonest at the top
+func Milestones(dbOwner, dbName string) (milestones []Milestone, err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+				AND is_deleted = false
+		)
+		SELECT m.title, m.description, m.due_date, m.open,
+			count(disc.internal_id) FILTER (WHERE disc.open = true),
+			count(disc.internal_id) FILTER (WHERE disc.open = false)
+		FROM milestones AS m
+			LEFT JOIN discussions AS disc ON disc.milestone_id = m.milestone_id
+		WHERE m.db_id = (SELECT db_id FROM d)
+		GROUP BY m.milestone_id
+		ORDER BY m.open DESC, m.due_date NULLS LAST, lower(m.title)`
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName)
+	if err != nil {
+		log.Printf("Retrieving milestones for '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m Milestone
+		err = rows.Scan(&m.Title, &m.Description, &m.DueDate, &m.Open, &m.OpenCount, &m.ClosedCount)
+		if err != nil {
+			log.Printf("Error retrieving milestones for '%s/%s': %v", dbOwner, dbName, err)
+			return nil, err
+		}
+		milestones = append(milestones, m)
+	}
+	return
+}
+
+// SetDiscussionMilestone adds a discussion or MR to a milestone of its database.  An empty milestone title removes
+// it from its milestone.  The returned boolean is false if the discussion or MR doesn't exist
+func SetDiscussionMilestone(dbOwner, dbName string, discID int, title string) (exists bool, err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+				AND is_deleted = false
+		)
+		UPDATE discussions
+		SET milestone_id = (
+			SELECT milestone_id
+			FROM milestones
+			WHERE db_id = (SELECT db_id FROM d)
+				AND lower(title) = lower(nullif($4, ''))
+		)
+		WHERE db_id = (SELECT db_id FROM d)
+			AND disc_id = $3`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, discID, title)
+	if err != nil {
+		log.Printf("Setting the milestone of discussion '%d' of '%s/%s' to '%s' failed: %v", discID, dbOwner,
+			dbName, title, err)
+		return
+	}
+	exists = commandTag.RowsAffected() == 1
+	return
+}
@@ -0,0 +1,330 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// AbuseReport is a report of an abusive database or discussion comment, made to the instance admins.  Comment
+// reports also have the discussion the comment is in, its author, and its text, which are empty once the comment has
+// been deleted
+type AbuseReport struct {
+	Action       string     `json:"action"`
+	ComID        int64      `json:"com_id,omitempty"`
+	Commenter    string     `json:"commenter,omitempty"`
+	CommentBody  string     `json:"comment,omitempty"`
+	DateCreated  time.Time  `json:"date_created"`
+	DateResolved *time.Time `json:"date_resolved"`
+	DBName       string     `json:"database"`
+	DBOwner      string     `json:"owner"`
+	Details      string     `json:"details"`
+	DiscID       int        `json:"disc_id,omitempty"`
+	Reason       string     `json:"reason"`
+	Reporter     string     `json:"reporter"`
+	ReportID     int64      `json:"report_id"`
+	ResolvedBy   string     `json:"resolved_by"`
+	Status       string     `json:"status"`
+}
+
+// UserBlock is a user blocked by another user
+type UserBlock struct {
+	DateCreated  time.Time `json:"date_created"`
+	PreventForks bool      `json:"prevent_forks"`
+	User         string    `json:"user"`
+}
+
+// AbuseReportAdd records a report of an abusive database, or of a comment in one of its discussions when a comment ID
+// is given, then emails the instance admins about it.  Reporting the same thing again while the earlier report is
+// still open returns the earlier report rather than adding another one.  The returned boolean is false when the
+// database or comment doesn't exist
+func AbuseReportAdd(reporter, dbOwner, dbName string, comID int64, reason, details string) (reportID int64, exists bool, err error) {
+	ctx := context.Background()
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Look up the database, and the comment if one is being reported
+	var dbID int64
+	dbQuery := `
+		SELECT db.db_id
+		FROM sqlite_databases AS db
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false
+			AND ($3::bigint = 0 OR EXISTS (SELECT 1 FROM discussion_comments WHERE com_id = $3 AND db_id = db.db_id))`
+	err = tx.QueryRow(ctx, dbQuery, dbOwner, dbName, comID).Scan(&dbID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		log.Printf("Looking up the target of an abuse report by '%s' failed: %v", reporter, err)
+		return
+	}
+	var com *int64
+	if comID != 0 {
+		com = &comID
+	}
+
+	// Don't add another report when the user has already reported this and it's still open
+	dbQuery = `
+		SELECT report_id
+		FROM abuse_reports
+		WHERE reporter_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db_id = $2
+			AND com_id IS NOT DISTINCT FROM $3
+			AND status = 'open'`
+	err = tx.QueryRow(ctx, dbQuery, reporter, dbID, com).Scan(&reportID)
+	if err == nil {
+		return reportID, true, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Checking for an existing abuse report by '%s' failed: %v", reporter, err)
+		return
+	}
+
+	dbQuery = `
+		INSERT INTO abuse_reports (reporter_id, db_id, com_id, reason, details)
+		VALUES ((SELECT user_id FROM users WHERE lower(user_name) = lower($1)), $2, $3, $4, $5)
+		RETURNING report_id`
+	err = tx.QueryRow(ctx, dbQuery, reporter, dbID, com, reason, details).Scan(&reportID)
+	if err != nil {
+		log.Printf("Adding an abuse report by '%s' failed: %v", reporter, err)
+		return
+	}
+
+	// Let the instance admins know there's something to review
+	target := fmt.Sprintf("the database '%s/%s'", dbOwner, dbName)
+	if comID != 0 {
+		target = fmt.Sprintf("comment %d on the database '%s/%s'", comID, dbOwner, dbName)
+	}
+	dbQuery = `
+		INSERT INTO email_queue (mail_to, subject, body)
+		SELECT email, $1, $2
+		FROM users
+		WHERE is_admin = true
+			AND banned = false
+			AND email IS NOT NULL
+			AND email != ''`
+	_, err = tx.Exec(ctx, dbQuery, fmt.Sprintf("DBHub.io: abuse report %d", reportID),
+		fmt.Sprintf("'%s' has reported %s for '%s'.\n\nThe open reports can be retrieved using the moderationqueue API "+
+			"call.", reporter, target, reason))
+	if err != nil {
+		log.Printf("Queuing the abuse report emails for the admins failed: %v", err)
+		return
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		return
+	}
+	return reportID, true, nil
+}
+
+// AbuseReportGet returns the details of an abuse report, and whether it exists
+func AbuseReportGet(reportID int64) (r AbuseReport, exists bool, err error) {
+	list, err := abuseReports("WHERE r.report_id = $1", reportID)
+	if err != nil || len(list) == 0 {
+		return
+	}
+	return list[0], true, nil
+}
+
+// AbuseReportResolve closes an abuse report, recording the admin who did it and the action taken.  Other open reports
+// of the same database or comment are closed along with it
+func AbuseReportResolve(r AbuseReport, adminUser, status, action string) (err error) {
+	var com *int64
+	if r.ComID != 0 {
+		com = &r.ComID
+	}
+	dbQuery := `
+		UPDATE abuse_reports
+		SET status = $4,
+			action = $5,
+			resolved_by = (SELECT user_id FROM users WHERE lower(user_name) = lower($1)),
+			date_resolved = now()
+		WHERE report_id = $2
+			OR (status = 'open'
+				AND db_id = (SELECT db_id FROM abuse_reports WHERE report_id = $2)
+				AND com_id IS NOT DISTINCT FROM $3)`
+	_, err = DB.Exec(context.Background(), dbQuery, adminUser, r.ReportID, com, status, action)
+	if err != nil {
+		log.Printf("Resolving abuse report %d failed: %v", r.ReportID, err)
+	}
+	return
+}
+
+// AbuseReports returns the abuse reports with the given status, oldest first.  An empty status returns all of them,
+// newest first
+func AbuseReports(status string) (list []AbuseReport, err error) {
+	if status == "" {
+		return abuseReports("ORDER BY r.date_created DESC LIMIT 500")
+	}
+	return abuseReports("WHERE r.status = $1 ORDER BY r.date_created", status)
+}
+
+// abuseReports returns the abuse reports matching the given clauses
+func abuseReports(clauses string, args ...interface{}) (list []AbuseReport, err error) {
+	dbQuery := `
+		SELECT r.report_id, reporter.user_name, owner.user_name, db.db_name, coalesce(r.com_id, 0),
+			coalesce(disc.disc_id, 0), coalesce(commenter.user_name, ''), coalesce(com.body, ''), r.reason, r.details,
+			r.status, r.action, coalesce(admin.user_name, ''), r.date_resolved, r.date_created
+		FROM abuse_reports AS r
+			JOIN users AS reporter ON reporter.user_id = r.reporter_id
+			JOIN sqlite_databases AS db ON db.db_id = r.db_id
+			JOIN users AS owner ON owner.user_id = db.user_id
+			LEFT JOIN discussion_comments AS com ON com.com_id = r.com_id
+			LEFT JOIN discussions AS disc ON disc.internal_id = com.disc_id
+			LEFT JOIN users AS commenter ON commenter.user_id = com.commenter
+			LEFT JOIN users AS admin ON admin.user_id = r.resolved_by
+		` + clauses
+	rows, err := DB.Query(context.Background(), dbQuery, args...)
+	if err != nil {
+		log.Printf("Retrieving abuse reports failed: %v", err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (r AbuseReport, err error) {
+		err = row.Scan(&r.ReportID, &r.Reporter, &r.DBOwner, &r.DBName, &r.ComID, &r.DiscID, &r.Commenter,
+			&r.CommentBody, &r.Reason, &r.Details, &r.Status, &r.Action, &r.ResolvedBy, &r.DateResolved, &r.DateCreated)
+		return
+	})
+	if err != nil {
+		log.Printf("Retrieving abuse reports failed: %v", err)
+	}
+	return
+}
+
+// BanUser stops a user from logging in or using the API, or lets them do so again
+func BanUser(userName string, banned bool) (exists bool, err error) {
+	dbQuery := `
+		UPDATE users
+		SET banned = $2
+		WHERE lower(user_name) = lower($1)`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, userName, banned)
+	if err != nil {
+		log.Printf("Changing the banned status of user '%s' failed: %v", userName, err)
+		return
+	}
+	if banned {
+		log.Printf("User '%s' has been banned", userName)
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+// BlockUser blocks a user, or changes whether they're prevented from forking the databases of the user blocking them
+func BlockUser(loggedInUser, blockedUser string, preventForks bool) (exists bool, err error) {
+	dbQuery := `
+		INSERT INTO user_blocks (user_id, blocked_user_id, prevent_forks)
+		SELECT (SELECT user_id FROM users WHERE lower(user_name) = lower($1)), user_id, $3
+		FROM users
+		WHERE lower(user_name) = lower($2)
+		ON CONFLICT (user_id, blocked_user_id)
+			DO UPDATE
+			SET prevent_forks = excluded.prevent_forks`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, loggedInUser, blockedUser, preventForks)
+	if err != nil {
+		log.Printf("Blocking user '%s' for '%s' failed: %v", blockedUser, loggedInUser, err)
+		return
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+// BlockedUsers returns the users blocked by a user, in name order
+func BlockedUsers(loggedInUser string) (list []UserBlock, err error) {
+	dbQuery := `
+		SELECT u.user_name, b.prevent_forks, b.date_created
+		FROM user_blocks AS b
+			JOIN users AS u ON u.user_id = b.blocked_user_id
+		WHERE b.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+		ORDER BY lower(u.user_name)`
+	rows, err := DB.Query(context.Background(), dbQuery, loggedInUser)
+	if err != nil {
+		log.Printf("Retrieving the users blocked by '%s' failed: %v", loggedInUser, err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (b UserBlock, err error) {
+		err = row.Scan(&b.User, &b.PreventForks, &b.DateCreated)
+		return
+	})
+	if err != nil {
+		log.Printf("Retrieving the users blocked by '%s' failed: %v", loggedInUser, err)
+	}
+	return
+}
+
+// ForkBlocked returns whether a database owner has blocked a user from forking their databases
+func ForkBlocked(dbOwner, loggedInUser string) (blocked bool, err error) {
+	dbQuery := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM user_blocks
+			WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+				AND blocked_user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($2))
+				AND prevent_forks = true
+		)`
+	err = DB.QueryRow(context.Background(), dbQuery, dbOwner, loggedInUser).Scan(&blocked)
+	if err != nil {
+		log.Printf("Checking if '%s' is blocked from forking the databases of '%s' failed: %v", loggedInUser, dbOwner,
+			err)
+	}
+	return
+}
+
+// HideComment hides a discussion comment from everyone, without deleting it
+func HideComment(comID int64) (err error) {
+	_, err = DB.Exec(context.Background(), `UPDATE discussion_comments SET hidden = true WHERE com_id = $1`, comID)
+	if err != nil {
+		log.Printf("Hiding discussion comment %d failed: %v", comID, err)
+	}
+	return
+}
+
+// HideDatabase makes a database private, so only its owner and the users it's shared with can see it
+func HideDatabase(dbOwner, dbName string) (err error) {
+	dbQuery := `
+		UPDATE sqlite_databases
+		SET public = false
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db_name = $2`
+	_, err = DB.Exec(context.Background(), dbQuery, dbOwner, dbName)
+	if err != nil {
+		log.Printf("Hiding database '%s/%s' failed: %v", dbOwner, dbName, err)
+	}
+	return
+}
+
+// UnblockUser removes a user from the users blocked by another.  The returned boolean is false when they weren't
+// blocked
+func UnblockUser(loggedInUser, blockedUser string) (exists bool, err error) {
+	dbQuery := `
+		DELETE FROM user_blocks
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND blocked_user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($2))`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, loggedInUser, blockedUser)
+	if err != nil {
+		log.Printf("Unblocking user '%s' for '%s' failed: %v", blockedUser, loggedInUser, err)
+		return
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+// UserBanned returns whether a user has been banned by the instance admins
+func UserBanned(userName string) (banned bool, err error) {
+	dbQuery := `
+		SELECT banned
+		FROM users
+		WHERE lower(user_name) = lower($1)`
+	err = DB.QueryRow(context.Background(), dbQuery, userName).Scan(&banned)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		log.Printf("Checking if user '%s' is banned failed: %v", userName, err)
+	}
+	return
+}
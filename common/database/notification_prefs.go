@@ -0,0 +1,135 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// DigestMode is how often emails for status updates are sent to a user
+type DigestMode string
+
+const (
+	DigestNone   DigestMode = ""       // An email is sent for each status update
+	DigestDaily  DigestMode = "daily"  // Status updates are batched into a daily email
+	DigestWeekly DigestMode = "weekly" // Status updates are batched into a weekly email
+)
+
+// NotificationPrefs holds the notification settings of a user
+type NotificationPrefs struct {
+	Comments      bool            `json:"comments"`       // Email for new comments
+	Databases     map[string]bool `json:"databases"`      // Per watched database ("owner/name") email on/off.  Databases not listed use the other settings
+	Digest        DigestMode      `json:"digest"`         // Whether status update emails are batched into digests
+	Discussions   bool            `json:"discussions"`    // Email for new discussions
+	Email         bool            `json:"email"`          // Master switch for all notification emails
+	MergeRequests bool            `json:"merge_requests"` // Email for new merge requests
+	Releases      bool            `json:"releases"`       // Email for new releases
+}
+
+// DefaultNotificationPrefs returns the notification settings used for users who haven't changed them
+func DefaultNotificationPrefs() NotificationPrefs {
+	return NotificationPrefs{
+		Comments:      true,
+		Databases:     make(map[string]bool),
+		Discussions:   true,
+		Email:         true,
+		MergeRequests: true,
+		Releases:      true,
+	}
+}
+
+// ParseNotificationPrefs converts the stored JSON form of notification settings to a NotificationPrefs structure.
+// Settings missing from the JSON keep their default values
+func ParseNotificationPrefs(data []byte) (prefs NotificationPrefs, err error) {
+	prefs = DefaultNotificationPrefs()
+	if len(data) == 0 {
+		return
+	}
+	err = json.Unmarshal(data, &prefs)
+	if prefs.Databases == nil {
+		prefs.Databases = make(map[string]bool)
+	}
+	return
+}
+
+// EmailFor returns whether an email should be sent straight away for an event of the given type on a database.  When
+// the user has chosen a digest mode, this is always false as their status updates are sent in digest emails instead
+func (p NotificationPrefs) EmailFor(eventType EventType, dbOwner, dbName string) bool {
+	if !p.Email || p.Digest != DigestNone {
+		return false
+	}
+	return p.Wants(eventType, dbOwner, dbName)
+}
+
+// Wants returns whether the user wants to be notified by email about an event of the given type on a database,
+// regardless of their digest mode
+func (p NotificationPrefs) Wants(eventType EventType, dbOwner, dbName string) bool {
+	if !p.Email {
+		return false
+	}
+	if enabled, ok := p.Databases[fmt.Sprintf("%s/%s", dbOwner, dbName)]; ok && !enabled {
+		return false
+	}
+	switch eventType {
+	case EVENT_NEW_DISCUSSION:
+		return p.Discussions
+	case EVENT_NEW_MERGE_REQUEST:
+		return p.MergeRequests
+	case EVENT_NEW_COMMENT:
+		return p.Comments
+	case EVENT_NEW_RELEASE:
+		return p.Releases
+	}
+	return true
+}
+
+// NotificationPreferences returns the notification settings of a user
+func NotificationPreferences(userName string) (prefs NotificationPrefs, err error) {
+	dbQuery := `
+		SELECT notification_prefs
+		FROM users
+		WHERE lower(user_name) = lower($1)`
+	var data []byte
+	err = DB.QueryRow(context.Background(), dbQuery, userName).Scan(&data)
+	if err != nil {
+		log.Printf("Retrieving notification preferences for user '%s' failed: %v", userName, err)
+		return
+	}
+	prefs, err = ParseNotificationPrefs(data)
+	if err != nil {
+		log.Printf("Error when parsing notification preferences for user '%s': %v", userName, err)
+	}
+	return
+}
+
+// SetNotificationPreferences stores the notification settings of a user
+func SetNotificationPreferences(userName string, prefs NotificationPrefs) error {
+	dbQuery := `
+		UPDATE users
+		SET notification_prefs = $2
+		WHERE lower(user_name) = lower($1)`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, userName, prefs)
+	if err != nil {
+		log.Printf("Updating notification preferences for user '%s' failed: %v", userName, err)
+		return err
+	}
+	if numRows := commandTag.RowsAffected(); numRows != 1 {
+		log.Printf("Wrong number of rows (%d) affected when updating notification preferences for user '%s'",
+			numRows, userName)
+	}
+	return nil
+}
+
+// DisableNotificationEmails turns off notification emails for the users with the given email address
+func DisableNotificationEmails(email string) error {
+	dbQuery := `
+		UPDATE users
+		SET notification_prefs = jsonb_set(notification_prefs, '{email}', 'false'::jsonb)
+		WHERE lower(email) = lower($1)`
+	_, err := DB.Exec(context.Background(), dbQuery, email)
+	if err != nil {
+		log.Printf("Disabling notification emails for '%s' failed: %v", email, err)
+	}
+	return err
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// Optimization is the most recent optimisation of a database.  Stage is the step being run, one of "vacuum", "copy",
+// or "analyze", with the pages done so far for the steps which work through the pages of the database.  For standard
+// databases, CommitID is the commit holding the optimised database
+type Optimization struct {
+	CommitID     string     `json:"commit_id,omitempty"`
+	DateFinished *time.Time `json:"date_finished,omitempty"`
+	DateStarted  time.Time  `json:"date_started"`
+	Error        string     `json:"error,omitempty"`
+	PagesDone    int64      `json:"pages_done"`
+	PagesTotal   int64      `json:"pages_total"`
+	RequestedBy  string     `json:"requested_by"`
+	SizeAfter    int64      `json:"size_after"`
+	SizeBefore   int64      `json:"size_before"`
+	Stage        string     `json:"stage"`
+	State        string     `json:"state"`
+}
+
+// ErrOptimizationRunning is returned when asking for a database to be optimised while an earlier optimisation of it
+// hasn't finished yet
+var ErrOptimizationRunning = errors.New("The database is already being optimised")
+
+// OptimizationFinish records the outcome of the optimisation of a database.  When errMsg isn't empty, the optimisation
+// failed
+func OptimizationFinish(dbOwner, dbName string, sizeBefore, sizeAfter int64, commitID, errMsg string) (err error) {
+	state := "done"
+	if errMsg != "" {
+		state = "failed"
+	}
+	dbQuery := `
+		UPDATE database_optimizations
+		SET state = $3, size_before = $4, size_after = $5, commit_id = $6, error = $7, date_finished = now()
+		WHERE db_id = (
+				SELECT db_id
+				FROM sqlite_databases
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+					AND db_name = $2
+			)`
+	_, err = DB.Exec(context.Background(), dbQuery, dbOwner, dbName, state, sizeBefore, sizeAfter, commitID, errMsg)
+	if err != nil {
+		log.Printf("Recording the optimisation outcome of '%s/%s' failed: %v", dbOwner, dbName, err)
+	}
+	return
+}
+
+// OptimizationProgress records the step an optimisation of a database is up to, and how many of the pages it's done
+func OptimizationProgress(dbOwner, dbName, stage string, pagesDone, pagesTotal int64) (err error) {
+	dbQuery := `
+		UPDATE database_optimizations
+		SET state = 'running', stage = $3, pages_done = $4, pages_total = $5
+		WHERE db_id = (
+				SELECT db_id
+				FROM sqlite_databases
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+					AND db_name = $2
+			)
+			AND state IN ('queued', 'running')`
+	_, err = DB.Exec(context.Background(), dbQuery, dbOwner, dbName, stage, pagesDone, pagesTotal)
+	if err != nil {
+		log.Printf("Recording the optimisation progress of '%s/%s' failed: %v", dbOwner, dbName, err)
+	}
+	return
+}
+
+// OptimizationStart records the start of an optimisation of a database, replacing the details of the previous one.  If
+// an earlier optimisation is still queued or running, ErrOptimizationRunning is returned instead.  Optimisations left
+// unfinished for longer than staleAfter are taken to have been interrupted, and don't stop a new one starting
+func OptimizationStart(dbOwner, dbName, requestingUser string, staleAfter time.Duration) (err error) {
+	dbQuery := `
+		INSERT INTO database_optimizations (db_id, requested_by)
+		SELECT db.db_id, (SELECT user_id FROM users WHERE lower(user_name) = lower($3))
+		FROM sqlite_databases AS db
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false
+		ON CONFLICT (db_id) DO UPDATE
+		SET requested_by = excluded.requested_by, state = 'queued', stage = '', pages_done = 0, pages_total = 0,
+			size_before = 0, size_after = 0, commit_id = '', error = '', date_started = now(), date_finished = NULL
+		WHERE database_optimizations.state NOT IN ('queued', 'running')
+			OR database_optimizations.date_started < now() - $4::interval`
+	t, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, requestingUser, staleAfter.String())
+	if err != nil {
+		log.Printf("Recording the start of an optimisation of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	if t.RowsAffected() != 1 {
+		return ErrOptimizationRunning
+	}
+	return
+}
+
+// OptimizationStatus returns the most recent optimisation of a database.  The returned details are nil when it hasn't
+// been optimised yet
+func OptimizationStatus(dbOwner, dbName string) (opt *Optimization, err error) {
+	dbQuery := `
+		SELECT o.state, o.stage, o.pages_done, o.pages_total, o.size_before, o.size_after, o.commit_id, o.error,
+			o.date_started, o.date_finished, u.user_name
+		FROM database_optimizations AS o
+			JOIN sqlite_databases AS db ON db.db_id = o.db_id
+			JOIN users AS u ON u.user_id = o.requested_by
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false`
+	var z Optimization
+	err = DB.QueryRow(context.Background(), dbQuery, dbOwner, dbName).Scan(&z.State, &z.Stage, &z.PagesDone,
+		&z.PagesTotal, &z.SizeBefore, &z.SizeAfter, &z.CommitID, &z.Error, &z.DateStarted, &z.DateFinished,
+		&z.RequestedBy)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("Retrieving the optimisation status of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	return &z, nil
+}
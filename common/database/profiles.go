@@ -0,0 +1,186 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// MaxPinnedDatabases is the maximum number of databases a user can pin to their profile
+const MaxPinnedDatabases = 6
+
+// ErrTooManyPins is returned when pinning a database would take a user over the maximum number of pinned databases
+var ErrTooManyPins = fmt.Errorf("You can't pin more than %d databases", MaxPinnedDatabases)
+
+// ContributionDay holds the number of contributions a user made on one day (UTC)
+type ContributionDay struct {
+	Date        string `json:"date"`
+	Commits     int    `json:"commits"`
+	Discussions int    `json:"discussions"`
+	Uploads     int    `json:"uploads"`
+}
+
+// SetDBPinned pins one of a user's standard databases to their profile, or unpins it.  Positions start at 1, and a
+// position of 0 pins the database after the others.  Pinning a database which is already pinned moves it to the new
+// position.  The returned boolean is false if the database doesn't exist
+func SetDBPinned(userName, dbName string, pinned bool, position int) (exists bool, err error) {
+	tx, err := DB.Begin(context.Background())
+	if err != nil {
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	// Retrieve the ID of the database, and the IDs of the databases currently pinned in their order
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		)
+		SELECT db.db_id,
+			coalesce((
+				SELECT array_agg(p.db_id ORDER BY p.pin_position)
+				FROM sqlite_databases AS p
+				WHERE p.user_id = u.user_id
+					AND p.pin_position IS NOT NULL
+					AND p.is_deleted = false
+					AND p.live_db = false
+			), '{}')
+		FROM sqlite_databases AS db, u
+		WHERE db.user_id = u.user_id
+			AND db.db_name = $2
+			AND db.is_deleted = false
+			AND db.live_db = false`
+	var dbID int64
+	var pins []int64
+	err = tx.QueryRow(context.Background(), dbQuery, userName, dbName).Scan(&dbID, &pins)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		log.Printf("Retrieving the pinned databases of user '%s' failed: %v", userName, err)
+		return
+	}
+
+	// Work out the new order of the pinned databases
+	var newPins []int64
+	for _, id := range pins {
+		if id != dbID {
+			newPins = append(newPins, id)
+		}
+	}
+	if pinned {
+		if len(newPins) >= MaxPinnedDatabases {
+			return true, ErrTooManyPins
+		}
+		if position < 1 || position > len(newPins)+1 {
+			position = len(newPins) + 1
+		}
+		newPins = append(newPins[:position-1], append([]int64{dbID}, newPins[position-1:]...)...)
+	}
+
+	// Save the new order.  This also clears any pins left on deleted databases
+	dbQuery = `
+		UPDATE sqlite_databases
+		SET pin_position = NULL
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND pin_position IS NOT NULL`
+	_, err = tx.Exec(context.Background(), dbQuery, userName)
+	if err != nil {
+		log.Printf("Removing the pinned databases of user '%s' failed: %v", userName, err)
+		return
+	}
+	dbQuery = `
+		UPDATE sqlite_databases AS db
+		SET pin_position = p.position
+		FROM unnest($1::bigint[]) WITH ORDINALITY AS p(db_id, position)
+		WHERE db.db_id = p.db_id`
+	_, err = tx.Exec(context.Background(), dbQuery, newPins)
+	if err != nil {
+		log.Printf("Saving the pinned databases of user '%s' failed: %v", userName, err)
+		return
+	}
+
+	err = tx.Commit(context.Background())
+	if err != nil {
+		return
+	}
+	return true, nil
+}
+
+// UserContributions returns the number of commits, uploads, and discussion posts a user made on each day since the given
+// time, for the days they made any.  Commits are matched to the user by their author email address.  Only contributions
+// to databases the logged in user can see are counted
+func UserContributions(loggedInUser, userName string, since time.Time) (days []ContributionDay, err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id, lower(coalesce(email, '')) AS email
+			FROM users
+			WHERE lower(user_name) = lower($2)
+		), viewer AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), visible AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db
+			WHERE db.is_deleted = false
+				AND (db.public = true
+					OR db.user_id = (SELECT user_id FROM viewer)
+					OR EXISTS (
+						SELECT 1
+						FROM database_shares AS s
+						WHERE s.db_id = db.db_id
+							AND s.user_id = (SELECT user_id FROM viewer)
+					))
+		), contributions AS (
+			-- Forks share their commits with the original database, so each commit is only counted once
+			SELECT DISTINCT ON (c.commit_id) c.commit_timestamp AS happened, 'commit' AS kind
+			FROM commits AS c
+			WHERE (SELECT email FROM u) <> ''
+				AND lower(c.author_email) = (SELECT email FROM u)
+				AND c.commit_timestamp >= $3
+				AND c.db_id IN (SELECT db_id FROM visible)
+			UNION ALL
+			SELECT up.upload_date, 'upload'
+			FROM database_uploads AS up
+			WHERE up.user_id = (SELECT user_id FROM u)
+				AND up.upload_date >= $3
+				AND up.db_id IN (SELECT db_id FROM visible)
+			UNION ALL
+			SELECT disc.date_created, 'discussion'
+			FROM discussions AS disc
+			WHERE disc.creator = (SELECT user_id FROM u)
+				AND disc.date_created >= $3
+				AND disc.db_id IN (SELECT db_id FROM visible)
+			UNION ALL
+			SELECT com.date_created, 'discussion'
+			FROM discussion_comments AS com
+			WHERE com.commenter = (SELECT user_id FROM u)
+				AND com.entry_type = 'txt'
+				AND com.date_created >= $3
+				AND com.db_id IN (SELECT db_id FROM visible)
+		)
+		SELECT to_char(happened AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day,
+			count(*) FILTER (WHERE kind = 'commit'),
+			count(*) FILTER (WHERE kind = 'discussion'),
+			count(*) FILTER (WHERE kind = 'upload')
+		FROM contributions
+		GROUP BY day
+		ORDER BY day`
+	rows, err := DB.Query(context.Background(), dbQuery, loggedInUser, userName, since)
+	if err != nil {
+		log.Printf("Retrieving the contributions of user '%s' failed: %v", userName, err)
+		return
+	}
+	days, err = pgx.CollectRows(rows, pgx.RowToStructByPos[ContributionDay])
+	if err != nil {
+		log.Printf("Retrieving the contributions of user '%s' failed: %v", userName, err)
+		return nil, err
+	}
+	return
+}
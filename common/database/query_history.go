@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+)
+
+// QueryHistory returns the most recent distinct SQL statements run on a database.  Those from the SQL terminal history
+// come first, followed by those from the log of query runs, each newest first.  Statements which failed in the SQL
+// terminal are left out
+func QueryHistory(dbOwner, dbName string, limit int) (queries []string, err error) {
+	dbQuery := `
+		WITH d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db
+			WHERE db.user_id = (
+					SELECT user_id
+					FROM users
+					WHERE lower(user_name) = lower($1)
+				)
+				AND db.db_name = $2
+				AND db.is_deleted = false
+		), h AS (
+			SELECT sql_stmt AS query, false AS encoded, history_id AS n
+			FROM sql_terminal_history
+			WHERE db_id = (SELECT db_id FROM d)
+				AND state != 'error'
+				AND sql_stmt IS NOT NULL
+			ORDER BY history_id DESC
+			LIMIT $3
+		), r AS (
+			SELECT query_string AS query, true AS encoded, query_run_id AS n
+			FROM vis_query_runs
+			WHERE db_id = (SELECT db_id FROM d)
+				AND query_string IS NOT NULL
+			ORDER BY query_run_id DESC
+			LIMIT $3
+		)
+		SELECT query, encoded
+		FROM (SELECT * FROM h UNION ALL SELECT * FROM r) AS q
+		ORDER BY encoded, n DESC`
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName, limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var query string
+		var encoded bool
+		err = rows.Scan(&query, &encoded)
+		if err != nil {
+			return
+		}
+
+		// The queries in the log of query runs are base64 encoded
+		if encoded {
+			b, err := base64.StdEncoding.DecodeString(query)
+			if err != nil {
+				continue
+			}
+			query = string(b)
+		}
+		query = strings.TrimSpace(query)
+		if query == "" || seen[query] {
+			continue
+		}
+		seen[query] = true
+		queries = append(queries, query)
+		if len(queries) >= limit {
+			break
+		}
+	}
+	err = rows.Err()
+	return
+}
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"context"
+	"log"
+)
+
+// Reactions holds the reactions which can be added to discussion comments.  These need to match the check constraint
+// on the reactions table
+var Reactions = []string{"+1", "-1", "laugh", "hooray", "confused", "heart", "rocket", "eyes"}
+
+// CommentReactionCounts returns the number of each reaction given to the comments of a discussion or MR, keyed by
+// comment ID
+func CommentReactionCounts(dbOwner, dbName string, discID int) (counts map[int]map[string]int, err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+				AND is_deleted = false
+		)
+		SELECT r.com_id, r.reaction, count(*)
+		FROM reactions AS r, discussion_comments AS com, discussions AS disc
+		WHERE r.com_id = com.com_id
+			AND com.disc_id = disc.internal_id
+			AND disc.db_id = (SELECT db_id FROM d)
+			AND disc.disc_id = $3
+		GROUP BY r.com_id, r.reaction`
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName, discID)
+	if err != nil {
+		log.Printf("Retrieving the reactions for discussion '%d' of '%s/%s' failed: %v", discID, dbOwner, dbName,
+			err)
+		return
+	}
+	defer rows.Close()
+	counts = make(map[int]map[string]int)
+	for rows.Next() {
+		var comID, num int
+		var reaction string
+		err = rows.Scan(&comID, &reaction, &num)
+		if err != nil {
+			log.Printf("Error retrieving the reactions for discussion '%d' of '%s/%s': %v", discID, dbOwner, dbName,
+				err)
+			return nil, err
+		}
+		if counts[comID] == nil {
+			counts[comID] = make(map[string]int)
+		}
+		counts[comID][reaction] = num
+	}
+	return
+}
+
+// ReactionAdd adds a reaction from a user to a comment of a discussion or MR.  Adding the same reaction twice doesn't
+// do anything.  The returned boolean is false if the comment doesn't exist
+func ReactionAdd(loggedInUser, dbOwner, dbName string, discID, comID int, reaction string) (exists bool, err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+				AND is_deleted = false
+		), com AS (
+			SELECT com.com_id
+			FROM discussion_comments AS com, discussions AS disc
+			WHERE com.disc_id = disc.internal_id
+				AND disc.db_id = (SELECT db_id FROM d)
+				AND disc.disc_id = $3
+				AND com.com_id = $4
+		), ins AS (
+			INSERT INTO reactions (com_id, user_id, reaction)
+			SELECT com_id, (SELECT user_id FROM users WHERE lower(user_name) = lower($5)), $6
+			FROM com
+			ON CONFLICT DO NOTHING
+		)
+		SELECT count(*)
+		FROM com`
+	var numComments int
+	err = DB.QueryRow(context.Background(), dbQuery, dbOwner, dbName, discID, comID, loggedInUser, reaction).Scan(&numComments)
+	if err != nil {
+		log.Printf("Adding reaction '%s' from '%s' to comment '%d' of '%s/%s' failed: %v", reaction, loggedInUser,
+			comID, dbOwner, dbName, err)
+		return
+	}
+	exists = numComments == 1
+	return
+}
+
+// ReactionRemove removes a reaction of a user from a comment of a discussion or MR
+func ReactionRemove(loggedInUser, dbOwner, dbName string, discID, comID int, reaction string) (err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+				AND is_deleted = false
+		)
+		DELETE FROM reactions
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($5))
+			AND reaction = $6
+			AND com_id = (
+				SELECT com.com_id
+				FROM discussion_comments AS com, discussions AS disc
+				WHERE com.disc_id = disc.internal_id
+					AND disc.db_id = (SELECT db_id FROM d)
+					AND disc.disc_id = $3
+					AND com.com_id = $4
+			)`
+	_, err = DB.Exec(context.Background(), dbQuery, dbOwner, dbName, discID, comID, loggedInUser, reaction)
+	if err != nil {
+		log.Printf("Removing reaction '%s' from '%s' on comment '%d' of '%s/%s' failed: %v", reaction,
+			loggedInUser, comID, dbOwner, dbName, err)
+	}
+	return
+}
+
+// UserCommentReactions returns the reactions a user has given to the comments of a discussion or MR, keyed by comment
+// ID
+func UserCommentReactions(loggedInUser, dbOwner, dbName string, discID int) (reactions map[int][]string, err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+				AND is_deleted = false
+		)
+		SELECT r.com_id, r.reaction
+		FROM reactions AS r, discussion_comments AS com, discussions AS disc
+		WHERE r.com_id = com.com_id
+			AND com.disc_id = disc.internal_id
+			AND disc.db_id = (SELECT db_id FROM d)
+			AND disc.disc_id = $3
+			AND r.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($4))
+		ORDER BY r.date_created`
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName, discID, loggedInUser)
+	if err != nil {
+		log.Printf("Retrieving the reactions of '%s' for discussion '%d' of '%s/%s' failed: %v", loggedInUser,
+			discID, dbOwner, dbName, err)
+		return
+	}
+	defer rows.Close()
+	reactions = make(map[int][]string)
+	for rows.Next() {
+		var comID int
+		var reaction string
+		err = rows.Scan(&comID, &reaction)
+		if err != nil {
+			log.Printf("Error retrieving the reactions of '%s' for discussion '%d' of '%s/%s': %v", loggedInUser,
+				discID, dbOwner, dbName, err)
+			return nil, err
+		}
+		reactions[comID] = append(reactions[comID], reaction)
+	}
+	return
+}
+
+// ValidReaction returns true if the given reaction is one which can be added to comments
+func ValidReaction(reaction string) bool {
+	for _, r := range Reactions {
+		if r == reaction {
+			return true
+		}
+	}
+	return false
+}
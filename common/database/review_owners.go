@@ -0,0 +1,173 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// ReviewOwnerRule names the users who own the tables of a database matching a pattern.  Merge requests changing those
+// tables automatically ask them for a review, and need an approval from one of them before merging
+type ReviewOwnerRule struct {
+	Owners []string `json:"owners"`
+	Table  string   `json:"table"`
+}
+
+// MergeRequestReviewRequests returns the users who have been asked to review a merge request, sorted by name
+func MergeRequestReviewRequests(dbOwner, dbName string, discID int) (list []string, err error) {
+	dbQuery := `
+		SELECT u.user_name
+		FROM merge_request_review_requests AS r
+			JOIN discussions AS disc ON disc.internal_id = r.internal_id
+			JOIN sqlite_databases AS db ON db.db_id = disc.db_id
+			JOIN users AS u ON u.user_id = r.user_id
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false
+			AND disc.disc_id = $3
+		ORDER BY u.user_name`
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName, discID)
+	if err != nil {
+		log.Printf("Retrieving the review requests of MR '%d' of '%s/%s' failed: %v", discID, dbOwner, dbName, err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		log.Printf("Retrieving the review requests of MR '%d' of '%s/%s' failed: %v", discID, dbOwner, dbName, err)
+	}
+	return
+}
+
+// MergeRequestReviewRequestsAdd asks users to review a merge request.  The returned list holds the users who hadn't
+// been asked already
+func MergeRequestReviewRequestsAdd(dbOwner, dbName string, discID int, users []string) (added []string, err error) {
+	if len(users) == 0 {
+		return
+	}
+	lowered := make([]string, 0, len(users))
+	for _, u := range users {
+		lowered = append(lowered, strings.ToLower(u))
+	}
+	dbQuery := `
+		WITH new AS (
+			INSERT INTO merge_request_review_requests (internal_id, user_id)
+			SELECT disc.internal_id, u.user_id
+			FROM discussions AS disc
+				JOIN sqlite_databases AS db ON db.db_id = disc.db_id,
+				users AS u
+			WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+				AND db.db_name = $2
+				AND db.is_deleted = false
+				AND disc.disc_id = $3
+				AND disc.discussion_type = $5
+				AND lower(u.user_name) = ANY($4)
+			ON CONFLICT (internal_id, user_id) DO NOTHING
+			RETURNING user_id
+		)
+		SELECT u.user_name
+		FROM new
+			JOIN users AS u ON u.user_id = new.user_id
+		ORDER BY u.user_name`
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName, discID, lowered, MERGE_REQUEST)
+	if err != nil {
+		log.Printf("Adding review requests to MR '%d' of '%s/%s' failed: %v", discID, dbOwner, dbName, err)
+		return
+	}
+	added, err = pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		log.Printf("Adding review requests to MR '%d' of '%s/%s' failed: %v", discID, dbOwner, dbName, err)
+	}
+	return
+}
+
+// NewReviewRequestEvent notifies users they've been asked to review a merge request
+func NewReviewRequestEvent(dbOwner, dbName, loggedInUser string, discID int, title string, reviewers []string) (err error) {
+	if len(reviewers) == 0 {
+		return
+	}
+	details := EventDetails{
+		DBName:     dbName,
+		DiscID:     discID,
+		Owner:      dbOwner,
+		Recipients: reviewers,
+		Title:      title,
+		Type:       EVENT_REVIEW_REQUESTED,
+		URL:        fmt.Sprintf("/merge/%s/%s?id=%d", url.PathEscape(dbOwner), url.PathEscape(dbName), discID),
+		UserName:   loggedInUser,
+	}
+	return NewEvent(details)
+}
+
+// ReviewOwnerRules returns the table ownership rules of a database, in the order they were given
+func ReviewOwnerRules(dbOwner, dbName string) (rules []ReviewOwnerRule, err error) {
+	dbQuery := `
+		SELECT r.table_pattern, array_agg(u.user_name ORDER BY u.user_name)
+		FROM review_owners AS r
+			JOIN sqlite_databases AS db ON db.db_id = r.db_id
+			JOIN users AS u ON u.user_id = r.user_id
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false
+		GROUP BY r.rule_order, r.table_pattern
+		ORDER BY r.rule_order`
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName)
+	if err != nil {
+		log.Printf("Retrieving the review owners of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	rules, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (r ReviewOwnerRule, err error) {
+		err = row.Scan(&r.Table, &r.Owners)
+		return
+	})
+	if err != nil {
+		log.Printf("Retrieving the review owners of '%s/%s' failed: %v", dbOwner, dbName, err)
+	}
+	return
+}
+
+// ReviewOwnerRulesSet replaces the table ownership rules of a database
+func ReviewOwnerRulesSet(dbOwner, dbName string, rules []ReviewOwnerRule) (err error) {
+	tx, err := DB.Begin(context.Background())
+	if err != nil {
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	dbQuery := `
+		DELETE FROM review_owners
+		WHERE db_id = (
+				SELECT db_id
+				FROM sqlite_databases
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+					AND db_name = $2
+					AND is_deleted = false
+			)`
+	_, err = tx.Exec(context.Background(), dbQuery, dbOwner, dbName)
+	if err != nil {
+		log.Printf("Removing the review owners of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+
+	dbQuery = `
+		INSERT INTO review_owners (db_id, rule_order, table_pattern, user_id)
+		SELECT db.db_id, $3, $4, (SELECT user_id FROM users WHERE lower(user_name) = lower($5))
+		FROM sqlite_databases AS db
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false
+		ON CONFLICT DO NOTHING`
+	for i, r := range rules {
+		for _, u := range r.Owners {
+			_, err = tx.Exec(context.Background(), dbQuery, dbOwner, dbName, i, r.Table, u)
+			if err != nil {
+				log.Printf("Adding a review owner rule to '%s/%s' failed: %v", dbOwner, dbName, err)
+				return
+			}
+		}
+	}
+	return tx.Commit(context.Background())
+}
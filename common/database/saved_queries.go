@@ -0,0 +1,281 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// SavedQuery holds the details of a saved query, along with the SQL of one of its versions
+type SavedQuery struct {
+	Creator      string    `json:"creator"`
+	DateCreated  time.Time `json:"date_created"`
+	Description  string    `json:"description"`
+	LastModified time.Time `json:"last_modified"`
+	Name         string    `json:"name"`
+	Shared       bool      `json:"shared"`
+	SQL          string    `json:"sql"`
+	Version      int       `json:"version"`
+}
+
+// SavedQueryVersion holds the details of a single version of a saved query
+type SavedQueryVersion struct {
+	Author      string    `json:"author"`
+	DateCreated time.Time `json:"date_created"`
+	SQL         string    `json:"sql"`
+	Version     int       `json:"version"`
+}
+
+// SavedQueries returns the saved queries for a database which are visible to the logged in user.  These are the
+// queries the user created themselves, plus the ones other users have shared
+func SavedQueries(loggedInUser, dbOwner, dbName string) (queries []SavedQuery, err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+				AND is_deleted = false
+		)
+		SELECT q.name, coalesce(q.description, ''), q.shared, q.date_created, q.last_modified, creator.user_name,
+			v.version, v.sql_stmt
+		FROM saved_queries AS q
+			JOIN users AS creator ON creator.user_id = q.user_id
+			JOIN saved_query_versions AS v ON v.query_id = q.query_id
+				AND v.version = (SELECT max(version) FROM saved_query_versions WHERE query_id = q.query_id)
+		WHERE q.db_id = (SELECT db_id FROM d)
+			AND (q.shared = true OR lower(creator.user_name) = lower($3))
+		ORDER BY q.name`
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName, loggedInUser)
+	if err != nil {
+		log.Printf("Retrieving saved queries for '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var q SavedQuery
+		err = rows.Scan(&q.Name, &q.Description, &q.Shared, &q.DateCreated, &q.LastModified, &q.Creator, &q.Version, &q.SQL)
+		if err != nil {
+			log.Printf("Error retrieving saved queries for '%s/%s': %v", dbOwner, dbName, err)
+			return nil, err
+		}
+		queries = append(queries, q)
+	}
+	return
+}
+
+// SavedQueryDelete deletes a saved query, including all of its versions.  Only the creator of a saved query can
+// delete it
+func SavedQueryDelete(loggedInUser, dbOwner, dbName, queryName string) (err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+		)
+		DELETE FROM saved_queries
+		WHERE db_id = (SELECT db_id FROM d)
+			AND name = $3
+			AND user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($4))`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, queryName, loggedInUser)
+	if err != nil {
+		log.Printf("Deleting saved query '%s' for database '%s/%s' failed: %v", queryName, dbOwner, dbName, err)
+		return
+	}
+	if numRows := commandTag.RowsAffected(); numRows != 1 {
+		return fmt.Errorf("Saved query '%s' not found", queryName)
+	}
+	return
+}
+
+// SavedQueryGet returns a saved query visible to the logged in user.  If version is 0, the latest version of the
+// query is returned
+func SavedQueryGet(loggedInUser, dbOwner, dbName, queryName string, version int) (q SavedQuery, exists bool, err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+				AND is_deleted = false
+		)
+		SELECT q.name, coalesce(q.description, ''), q.shared, q.date_created, q.last_modified, creator.user_name,
+			v.version, v.sql_stmt
+		FROM saved_queries AS q
+			JOIN users AS creator ON creator.user_id = q.user_id
+			JOIN saved_query_versions AS v ON v.query_id = q.query_id
+		WHERE q.db_id = (SELECT db_id FROM d)
+			AND q.name = $3
+			AND (q.shared = true OR lower(creator.user_name) = lower($4))
+			AND (v.version = $5 OR ($5 = 0 AND v.version = (SELECT max(version) FROM saved_query_versions WHERE query_id = q.query_id)))`
+	err = DB.QueryRow(context.Background(), dbQuery, dbOwner, dbName, queryName, loggedInUser, version).Scan(&q.Name,
+		&q.Description, &q.Shared, &q.DateCreated, &q.LastModified, &q.Creator, &q.Version, &q.SQL)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// The saved query (or requested version of it) doesn't exist, or isn't visible to the user
+			return q, false, nil
+		}
+		log.Printf("Retrieving saved query '%s' for database '%s/%s' failed: %v", queryName, dbOwner, dbName, err)
+		return
+	}
+	return q, true, nil
+}
+
+// SavedQuerySave saves a query for a database.  If the query already exists, a new version of it is added.  The
+// number of the resulting latest version is returned
+func SavedQuerySave(loggedInUser, dbOwner, dbName, queryName, description, sql string, shared bool) (version int, err error) {
+	// Begin a transaction
+	tx, err := DB.Begin(context.Background())
+	if err != nil {
+		return
+	}
+
+	// Set up an automatic transaction roll back if the function exits without committing
+	defer tx.Rollback(context.Background())
+
+	// Check if a query with this name already exists for the database
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+		)
+		SELECT q.query_id, creator.user_name,
+			(SELECT sql_stmt FROM saved_query_versions WHERE query_id = q.query_id ORDER BY version DESC LIMIT 1),
+			(SELECT max(version) FROM saved_query_versions WHERE query_id = q.query_id)
+		FROM saved_queries AS q, users AS creator
+		WHERE q.db_id = (SELECT db_id FROM d)
+			AND q.name = $3
+			AND creator.user_id = q.user_id
+		FOR UPDATE OF q`
+	var queryID int64
+	var creator, latestSQL string
+	err = tx.QueryRow(context.Background(), dbQuery, dbOwner, dbName, queryName).Scan(&queryID, &creator, &latestSQL, &version)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Checking for existing saved query '%s' on database '%s/%s' failed: %v", queryName, dbOwner, dbName, err)
+		return
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		// This is a new saved query
+		dbQuery = `
+			WITH u AS (
+				SELECT user_id
+				FROM users
+				WHERE lower(user_name) = lower($1)
+			), d AS (
+				SELECT db.db_id
+				FROM sqlite_databases AS db, u
+				WHERE db.user_id = u.user_id
+					AND db_name = $2
+			)
+			INSERT INTO saved_queries (db_id, user_id, name, description, shared)
+			SELECT (SELECT db_id FROM d), (SELECT user_id FROM users WHERE lower(user_name) = lower($3)), $4, nullif($5, ''), $6
+			RETURNING query_id`
+		err = tx.QueryRow(context.Background(), dbQuery, dbOwner, dbName, loggedInUser, queryName, description, shared).Scan(&queryID)
+		if err != nil {
+			log.Printf("Adding saved query '%s' for database '%s/%s' failed: %v", queryName, dbOwner, dbName, err)
+			return
+		}
+		version = 0
+	} else {
+		// Only the creator of a saved query can change it
+		if strings.ToLower(creator) != strings.ToLower(loggedInUser) {
+			return 0, fmt.Errorf("A saved query called '%s' already exists for this database", queryName)
+		}
+
+		dbQuery = `
+			UPDATE saved_queries
+			SET description = nullif($2, ''), shared = $3, last_modified = now()
+			WHERE query_id = $1`
+		_, err = tx.Exec(context.Background(), dbQuery, queryID, description, shared)
+		if err != nil {
+			log.Printf("Updating saved query '%s' for database '%s/%s' failed: %v", queryName, dbOwner, dbName, err)
+			return
+		}
+	}
+
+	// Add a new version, unless the SQL hasn't changed since the latest one
+	if version == 0 || latestSQL != sql {
+		version++
+		dbQuery = `
+			INSERT INTO saved_query_versions (query_id, version, sql_stmt, user_id)
+			SELECT $1, $2, $3, (SELECT user_id FROM users WHERE lower(user_name) = lower($4))`
+		_, err = tx.Exec(context.Background(), dbQuery, queryID, version, sql, loggedInUser)
+		if err != nil {
+			log.Printf("Adding version %d of saved query '%s' for database '%s/%s' failed: %v", version, queryName,
+				dbOwner, dbName, err)
+			return
+		}
+	}
+
+	// Commit the transaction
+	err = tx.Commit(context.Background())
+	return
+}
+
+// SavedQueryVersions returns the version history of a saved query visible to the logged in user, newest first
+func SavedQueryVersions(loggedInUser, dbOwner, dbName, queryName string) (versions []SavedQueryVersion, err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+				AND is_deleted = false
+		)
+		SELECT v.version, v.sql_stmt, v.date_created, coalesce(author.user_name, '')
+		FROM saved_queries AS q
+			JOIN users AS creator ON creator.user_id = q.user_id
+			JOIN saved_query_versions AS v ON v.query_id = q.query_id
+			LEFT JOIN users AS author ON author.user_id = v.user_id
+		WHERE q.db_id = (SELECT db_id FROM d)
+			AND q.name = $3
+			AND (q.shared = true OR lower(creator.user_name) = lower($4))
+		ORDER BY v.version DESC`
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName, queryName, loggedInUser)
+	if err != nil {
+		log.Printf("Retrieving versions of saved query '%s' for database '%s/%s' failed: %v", queryName, dbOwner,
+			dbName, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v SavedQueryVersion
+		err = rows.Scan(&v.Version, &v.SQL, &v.DateCreated, &v.Author)
+		if err != nil {
+			log.Printf("Error retrieving versions of saved query '%s' for database '%s/%s': %v", queryName, dbOwner,
+				dbName, err)
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return
+}
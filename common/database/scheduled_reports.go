@@ -0,0 +1,332 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+const (
+	// ScheduledReportMaxReports is the most scheduled reports each user can have
+	ScheduledReportMaxReports = 25
+
+	// ScheduledReportMaxRuns is the number of runs kept in the history of each scheduled report
+	ScheduledReportMaxRuns = 50
+)
+
+// ScheduledReport runs a saved query or a dashboard on a cron schedule, renders the results as CSV, HTML, or PDF, then
+// delivers them by email or to a webhook.  Saved query reports also have the database the query belongs to.  Trigger is
+// the reason it's due to run, when it is
+type ScheduledReport struct {
+	DateCreated   time.Time  `json:"date_created"`
+	DBName        string     `json:"database,omitempty"`
+	DBOwner       string     `json:"owner,omitempty"`
+	Delivery      string     `json:"delivery"`
+	Format        string     `json:"format"`
+	LastError     string     `json:"last_error"`
+	LastModified  time.Time  `json:"last_modified"`
+	LastRun       *time.Time `json:"last_run"`
+	Name          string     `json:"name"`
+	NextRun       time.Time  `json:"next_run"`
+	ReportID      int64      `json:"-"`
+	Schedule      string     `json:"schedule"`
+	Source        string     `json:"source"`
+	SourceName    string     `json:"source_name"`
+	Trigger       string     `json:"-"`
+	User          string     `json:"user"`
+	WebhookSecret string     `json:"webhook_secret,omitempty"`
+	WebhookURL    string     `json:"webhook_url,omitempty"`
+}
+
+// ScheduledReportRun is one run of a scheduled report
+type ScheduledReportRun struct {
+	ContentType string    `json:"content_type"`
+	Delivered   bool      `json:"delivered"`
+	Error       string    `json:"error"`
+	Finished    time.Time `json:"finished"`
+	Output      []byte    `json:"-"`
+	Rows        int64     `json:"rows"`
+	RunID       int64     `json:"run_id"`
+	Started     time.Time `json:"started"`
+	Trigger     string    `json:"trigger"`
+}
+
+// ScheduledReportDelete removes a scheduled report, along with its run history.  The returned boolean is false when it
+// didn't exist
+func ScheduledReportDelete(loggedInUser, name string) (exists bool, err error) {
+	dbQuery := `
+		DELETE FROM scheduled_reports
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND name = $2`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, loggedInUser, name)
+	if err != nil {
+		log.Printf("Deleting the scheduled report '%s' of '%s' failed: %v", name, loggedInUser, err)
+		return
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+// ScheduledReportPending marks a scheduled report as due to run straight away.  The returned boolean is false when it
+// doesn't exist
+func ScheduledReportPending(loggedInUser, name string) (exists bool, err error) {
+	dbQuery := `
+		UPDATE scheduled_reports
+		SET run_pending = true
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND name = $2`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, loggedInUser, name)
+	if err != nil {
+		log.Printf("Marking the scheduled report '%s' of '%s' to run failed: %v", name, loggedInUser, err)
+		return
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+// ScheduledReportRunOutput returns the rendered output of a run of a scheduled report.  The returned boolean is false
+// when the run doesn't exist, or didn't produce any output
+func ScheduledReportRunOutput(loggedInUser, name string, runID int64) (contentType string, output []byte, exists bool, err error) {
+	dbQuery := `
+		SELECT r.content_type, r.output
+		FROM scheduled_report_runs AS r
+			JOIN scheduled_reports AS s ON s.report_id = r.report_id
+		WHERE s.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND s.name = $2
+			AND r.run_id = $3
+			AND r.output IS NOT NULL`
+	err = DB.QueryRow(context.Background(), dbQuery, loggedInUser, name, runID).Scan(&contentType, &output)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil, false, nil
+	}
+	if err != nil {
+		log.Printf("Retrieving the output of run %d of scheduled report '%s' of '%s' failed: %v", runID, name,
+			loggedInUser, err)
+		return
+	}
+	return contentType, output, true, nil
+}
+
+// ScheduledReportRunID reserves the ID of a new run of a scheduled report, so it can be referred to while the run is
+// delivered
+func ScheduledReportRunID() (runID int64, err error) {
+	err = DB.QueryRow(context.Background(), "SELECT nextval('scheduled_report_runs_run_id_seq')").Scan(&runID)
+	if err != nil {
+		log.Printf("Reserving the ID of a scheduled report run failed: %v", err)
+	}
+	return
+}
+
+// ScheduledReportRunSave records a run of a scheduled report, along with when it's next due.  When a delivery email is
+// given it's queued for the report owner.  When the run fails after the previous one succeeded, the report owner is
+// emailed the given alert instead
+func ScheduledReportRunSave(r ScheduledReport, run ScheduledReportRun, nextRun time.Time, alertSubj, alertMsg, deliverSubj, deliverMsg string) (err error) {
+	ctx := context.Background()
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Update the report, keeping the previous error so we can tell if it was already failing
+	dbQuery := `
+		UPDATE scheduled_reports AS s
+		SET run_pending = CASE WHEN $2 = 'manual' THEN false ELSE s.run_pending END,
+			next_run = $3,
+			last_run = $4,
+			last_error = $5
+		FROM scheduled_reports AS prev
+		WHERE prev.report_id = s.report_id
+			AND s.report_id = $1
+		RETURNING prev.last_error, prev.last_run`
+	var prevError string
+	var prevRun *time.Time
+	err = tx.QueryRow(ctx, dbQuery, r.ReportID, run.Trigger, nextRun, run.Finished, run.Error).Scan(&prevError,
+		&prevRun)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The report was deleted while it was running
+		return nil
+	}
+	if err != nil {
+		log.Printf("Recording the run of scheduled report '%s' of '%s' failed: %v", r.Name, r.User, err)
+		return
+	}
+
+	// Add the run to the history, only keeping the most recent ones
+	dbQuery = `
+		INSERT INTO scheduled_report_runs (run_id, report_id, trigger, started, finished, row_count, delivered, error,
+			content_type, output)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	_, err = tx.Exec(ctx, dbQuery, run.RunID, r.ReportID, run.Trigger, run.Started, run.Finished, run.Rows, run.Delivered,
+		run.Error, run.ContentType, run.Output)
+	if err != nil {
+		log.Printf("Recording the run of scheduled report '%s' of '%s' failed: %v", r.Name, r.User, err)
+		return
+	}
+	dbQuery = `
+		DELETE FROM scheduled_report_runs
+		WHERE report_id = $1
+			AND run_id NOT IN (
+				SELECT run_id
+				FROM scheduled_report_runs
+				WHERE report_id = $1
+				ORDER BY started DESC
+				LIMIT $2
+			)`
+	_, err = tx.Exec(ctx, dbQuery, r.ReportID, ScheduledReportMaxRuns)
+	if err != nil {
+		log.Printf("Trimming the run history of scheduled report '%s' of '%s' failed: %v", r.Name, r.User, err)
+		return
+	}
+
+	// Only alert the owner when a report starts failing, rather than on every failed run
+	subj, msg := deliverSubj, deliverMsg
+	if run.Error != "" {
+		subj, msg = "", ""
+		if prevError == "" || prevRun == nil {
+			subj, msg = alertSubj, alertMsg
+		}
+	}
+	if msg != "" {
+		dbQuery = `
+			INSERT INTO email_queue (mail_to, subject, body)
+			SELECT email, $2, $3
+			FROM users
+			WHERE lower(user_name) = lower($1)
+				AND email IS NOT NULL
+				AND email != ''`
+		_, err = tx.Exec(ctx, dbQuery, r.User, subj, msg)
+		if err != nil {
+			log.Printf("Queuing the scheduled report email for '%s' failed: %v", r.User, err)
+			return
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// ScheduledReportRuns returns the most recent runs of a scheduled report, newest first
+func ScheduledReportRuns(loggedInUser, name string) (list []ScheduledReportRun, err error) {
+	dbQuery := `
+		SELECT r.run_id, r.trigger, r.started, r.finished, r.row_count, r.delivered, r.error, r.content_type
+		FROM scheduled_report_runs AS r
+			JOIN scheduled_reports AS s ON s.report_id = r.report_id
+		WHERE s.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND s.name = $2
+		ORDER BY r.started DESC, r.run_id DESC
+		LIMIT $3`
+	rows, err := DB.Query(context.Background(), dbQuery, loggedInUser, name, ScheduledReportMaxRuns)
+	if err != nil {
+		log.Printf("Retrieving the runs of scheduled report '%s' of '%s' failed: %v", name, loggedInUser, err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (r ScheduledReportRun, err error) {
+		err = row.Scan(&r.RunID, &r.Trigger, &r.Started, &r.Finished, &r.Rows, &r.Delivered, &r.Error, &r.ContentType)
+		return
+	})
+	if err != nil {
+		log.Printf("Retrieving the runs of scheduled report '%s' of '%s' failed: %v", name, loggedInUser, err)
+	}
+	return
+}
+
+// ScheduledReportSave adds a scheduled report, or changes an existing one.  New reports are given a random secret for
+// signing their webhook requests, which existing ones keep.  The secret of the report is returned
+func ScheduledReportSave(r ScheduledReport) (secret string, err error) {
+	data := make([]byte, 32)
+	_, err = rand.Read(data)
+	if err != nil {
+		return
+	}
+	dbQuery := `
+		INSERT INTO scheduled_reports (user_id, name, source, db_id, source_name, schedule, format, delivery,
+			webhook_url, webhook_secret, next_run)
+		SELECT (SELECT user_id FROM users WHERE lower(user_name) = lower($1)), $2, $3,
+			(
+				SELECT db_id
+				FROM sqlite_databases
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($4))
+					AND db_name = $5
+					AND is_deleted = false
+			), $6, $7, $8, $9, $10, $11, $12
+		ON CONFLICT (user_id, name)
+			DO UPDATE
+			SET source = excluded.source,
+				db_id = excluded.db_id,
+				source_name = excluded.source_name,
+				schedule = excluded.schedule,
+				format = excluded.format,
+				delivery = excluded.delivery,
+				webhook_url = excluded.webhook_url,
+				next_run = excluded.next_run,
+				last_modified = now()
+		RETURNING webhook_secret`
+	err = DB.QueryRow(context.Background(), dbQuery, r.User, r.Name, r.Source, r.DBOwner, r.DBName, r.SourceName,
+		r.Schedule, r.Format, r.Delivery, r.WebhookURL, hex.EncodeToString(data), r.NextRun).Scan(&secret)
+	if err != nil {
+		log.Printf("Saving the scheduled report '%s' of '%s' failed: %v", r.Name, r.User, err)
+	}
+	return
+}
+
+// ScheduledReports returns the scheduled reports of a user, in name order
+func ScheduledReports(loggedInUser string) (list []ScheduledReport, err error) {
+	dbQuery := `
+		SELECT s.report_id, u.user_name, s.name, s.source, coalesce(owner.user_name, ''), coalesce(db.db_name, ''),
+			s.source_name, s.schedule, s.format, s.delivery, s.webhook_url, s.webhook_secret, s.next_run,
+			CASE WHEN s.run_pending THEN 'manual' WHEN s.next_run <= now() THEN 'schedule' ELSE '' END,
+			s.last_run, s.last_error, s.date_created, s.last_modified
+		FROM scheduled_reports AS s
+			JOIN users AS u ON u.user_id = s.user_id
+			LEFT JOIN sqlite_databases AS db ON db.db_id = s.db_id
+			LEFT JOIN users AS owner ON owner.user_id = db.user_id
+		WHERE lower(u.user_name) = lower($1)
+		ORDER BY s.name`
+	rows, err := DB.Query(context.Background(), dbQuery, loggedInUser)
+	if err != nil {
+		log.Printf("Retrieving the scheduled reports of '%s' failed: %v", loggedInUser, err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, scanScheduledReport)
+	if err != nil {
+		log.Printf("Retrieving the scheduled reports of '%s' failed: %v", loggedInUser, err)
+	}
+	return
+}
+
+// ScheduledReportsDue returns the scheduled reports which are due to run, either on their schedule or because a run was
+// asked for
+func ScheduledReportsDue() (list []ScheduledReport, err error) {
+	dbQuery := `
+		SELECT s.report_id, u.user_name, s.name, s.source, coalesce(owner.user_name, ''), coalesce(db.db_name, ''),
+			s.source_name, s.schedule, s.format, s.delivery, s.webhook_url, s.webhook_secret, s.next_run,
+			CASE WHEN s.run_pending THEN 'manual' ELSE 'schedule' END,
+			s.last_run, s.last_error, s.date_created, s.last_modified
+		FROM scheduled_reports AS s
+			JOIN users AS u ON u.user_id = s.user_id
+			LEFT JOIN sqlite_databases AS db ON db.db_id = s.db_id
+			LEFT JOIN users AS owner ON owner.user_id = db.user_id
+		WHERE s.run_pending = true
+			OR s.next_run <= now()
+		ORDER BY s.next_run`
+	rows, err := DB.Query(context.Background(), dbQuery)
+	if err != nil {
+		log.Printf("Retrieving the due scheduled reports failed: %v", err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, scanScheduledReport)
+	if err != nil {
+		log.Printf("Retrieving the due scheduled reports failed: %v", err)
+	}
+	return
+}
+
+// scanScheduledReport reads a scheduled report from a row returned by ScheduledReports() or ScheduledReportsDue()
+func scanScheduledReport(row pgx.CollectableRow) (r ScheduledReport, err error) {
+	err = row.Scan(&r.ReportID, &r.User, &r.Name, &r.Source, &r.DBOwner, &r.DBName, &r.SourceName, &r.Schedule,
+		&r.Format, &r.Delivery, &r.WebhookURL, &r.WebhookSecret, &r.NextRun, &r.Trigger, &r.LastRun, &r.LastError,
+		&r.DateCreated, &r.LastModified)
+	return
+}
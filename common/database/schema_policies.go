@@ -0,0 +1,121 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+const (
+	// SchemaPolicyApproval only lets the schema of a branch change through merge requests which have been approved
+	SchemaPolicyApproval = "approval"
+
+	// SchemaPolicyBlock doesn't let the schema of a branch change at all, so only the data in it can be changed
+	SchemaPolicyBlock = "block"
+)
+
+// BranchSchemaPolicies returns the schema change policy of each branch of a database which has one
+func BranchSchemaPolicies(dbOwner, dbName string) (policies map[string]string, err error) {
+	dbQuery := `
+		SELECT p.branch_name, p.policy
+		FROM branch_schema_policies AS p
+			JOIN sqlite_databases AS db ON db.db_id = p.db_id
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false`
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName)
+	if err != nil {
+		log.Printf("Retrieving the branch schema policies of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	defer rows.Close()
+	policies = make(map[string]string)
+	for rows.Next() {
+		var branch, policy string
+		err = rows.Scan(&branch, &policy)
+		if err != nil {
+			log.Printf("Retrieving the branch schema policies of '%s/%s' failed: %v", dbOwner, dbName, err)
+			return
+		}
+		policies[branch] = policy
+	}
+	return policies, rows.Err()
+}
+
+// BranchSchemaPolicy returns the schema change policy of a branch.  The returned policy is empty when the branch
+// accepts any schema change
+func BranchSchemaPolicy(dbOwner, dbName, branchName string) (policy string, err error) {
+	dbQuery := `
+		SELECT p.policy
+		FROM branch_schema_policies AS p
+			JOIN sqlite_databases AS db ON db.db_id = p.db_id
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false
+			AND p.branch_name = $3`
+	err = DB.QueryRow(context.Background(), dbQuery, dbOwner, dbName, branchName).Scan(&policy)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		log.Printf("Retrieving the schema policy of branch '%s' of '%s/%s' failed: %v", branchName, dbOwner, dbName,
+			err)
+	}
+	return
+}
+
+// BranchSchemaPolicyRename moves the schema change policy of a branch to its new name
+func BranchSchemaPolicyRename(dbOwner, dbName, oldName, newName string) (err error) {
+	dbQuery := `
+		UPDATE branch_schema_policies
+		SET branch_name = $4
+		WHERE db_id = (
+				SELECT db_id
+				FROM sqlite_databases
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+					AND db_name = $2
+					AND is_deleted = false
+			)
+			AND branch_name = $3`
+	_, err = DB.Exec(context.Background(), dbQuery, dbOwner, dbName, oldName, newName)
+	if err != nil {
+		log.Printf("Renaming the schema policy of branch '%s' of '%s/%s' failed: %v", oldName, dbOwner, dbName, err)
+	}
+	return
+}
+
+// BranchSchemaPolicySet changes the schema change policy of a branch.  An empty policy lets the branch accept any
+// schema change
+func BranchSchemaPolicySet(dbOwner, dbName, branchName, policy string) (err error) {
+	dbQuery := `
+		DELETE FROM branch_schema_policies
+		WHERE db_id = (
+				SELECT db_id
+				FROM sqlite_databases
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+					AND db_name = $2
+					AND is_deleted = false
+			)
+			AND branch_name = $3`
+	args := []interface{}{dbOwner, dbName, branchName}
+	if policy != "" {
+		dbQuery = `
+			INSERT INTO branch_schema_policies (db_id, branch_name, policy)
+			SELECT db.db_id, $3, $4
+			FROM sqlite_databases AS db
+			WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+				AND db.db_name = $2
+				AND db.is_deleted = false
+			ON CONFLICT (db_id, branch_name)
+				DO UPDATE
+				SET policy = $4`
+		args = append(args, policy)
+	}
+	_, err = DB.Exec(context.Background(), dbQuery, args...)
+	if err != nil {
+		log.Printf("Setting the schema policy of branch '%s' of '%s/%s' failed: %v", branchName, dbOwner, dbName, err)
+	}
+	return
+}
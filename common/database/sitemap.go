@@ -0,0 +1,84 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SitemapEntry is a public database listed in the sitemap
+type SitemapEntry struct {
+	Owner        string
+	DBName       string
+	LastModified time.Time
+}
+
+// SitemapDatabases returns the public databases to list in the sitemap, ordered by owner and database name
+func SitemapDatabases() ([]SitemapEntry, error) {
+	dbQuery := `
+		SELECT u.user_name, db.db_name, db.last_modified
+		FROM sqlite_databases AS db, users AS u
+		WHERE db.user_id = u.user_id
+			AND db.public = true
+			AND db.is_deleted = false
+		ORDER BY lower(u.user_name), db.db_name`
+	rows, err := DB.Query(context.Background(), dbQuery)
+	if err != nil {
+		log.Printf("Retrieving the databases for the sitemap failed: %v", err)
+		return nil, err
+	}
+	list, err := pgx.CollectRows(rows, pgx.RowToStructByPos[SitemapEntry])
+	if err != nil {
+		log.Printf("Retrieving the databases for the sitemap failed: %v", err)
+		return nil, err
+	}
+	return list, nil
+}
+
+// SitemapGet returns a stored page of the sitemap, with page 0 being the index.  It returns false when there isn't a
+// page with that number, including when the sitemap hasn't been generated yet
+func SitemapGet(page int) (content []byte, ok bool, err error) {
+	dbQuery := `
+		SELECT content
+		FROM sitemap_pages
+		WHERE page = $1`
+	err = DB.QueryRow(context.Background(), dbQuery, page).Scan(&content)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		log.Printf("Retrieving page %d of the sitemap failed: %v", page, err)
+		return nil, false, err
+	}
+	return content, true, nil
+}
+
+// SitemapSave replaces the stored sitemap with a newly generated one.  The index is stored as page 0, and the pages it
+// lists are numbered from 1
+func SitemapSave(index []byte, pages [][]byte) (err error) {
+	tx, err := DB.Begin(context.Background())
+	if err != nil {
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	_, err = tx.Exec(context.Background(), `DELETE FROM sitemap_pages`)
+	if err != nil {
+		log.Printf("Removing the previous sitemap failed: %v", err)
+		return
+	}
+	dbQuery := `
+		INSERT INTO sitemap_pages (page, content)
+		VALUES ($1, $2)`
+	for i, content := range append([][]byte{index}, pages...) {
+		_, err = tx.Exec(context.Background(), dbQuery, i, content)
+		if err != nil {
+			log.Printf("Storing page %d of the sitemap failed: %v", i, err)
+			return
+		}
+	}
+	return tx.Commit(context.Background())
+}
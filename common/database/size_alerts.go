@@ -0,0 +1,69 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// SizeAlert is how much a database can grow from one commit to the next before its owner is emailed about it.  The
+// owner is emailed when either of them is exceeded.  Each one is turned off when it's 0
+type SizeAlert struct {
+	GrowthBytes   int64 `json:"growth_bytes"`
+	GrowthPercent int   `json:"growth_percent"`
+}
+
+// SizeAlertFor returns the size growth alert settings of a database
+func SizeAlertFor(dbOwner, dbName string) (a SizeAlert, err error) {
+	dbQuery := `
+		SELECT size_alert_bytes, size_alert_percent
+		FROM sqlite_databases
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db_name = $2
+			AND is_deleted = false`
+	err = DB.QueryRow(context.Background(), dbQuery, dbOwner, dbName).Scan(&a.GrowthBytes, &a.GrowthPercent)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return a, errors.New("Database not found")
+	}
+	if err != nil {
+		log.Printf("Retrieving the size alert settings of '%s/%s' failed: %v", dbOwner, dbName, err)
+	}
+	return
+}
+
+// SizeAlertSet changes the size growth alert settings of a database
+func SizeAlertSet(dbOwner, dbName string, a SizeAlert) (err error) {
+	dbQuery := `
+		UPDATE sqlite_databases
+		SET size_alert_bytes = $3, size_alert_percent = $4
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db_name = $2
+			AND is_deleted = false`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, a.GrowthBytes, a.GrowthPercent)
+	if err != nil {
+		log.Printf("Setting the size alert of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	if commandTag.RowsAffected() != 1 {
+		return errors.New("Database not found")
+	}
+	return
+}
+
+// SizeAlertSend emails the owner of a database about it growing by more than its size alert allows
+func SizeAlertSend(dbOwner, alertSubj, alertMsg string) (err error) {
+	dbQuery := `
+		INSERT INTO email_queue (mail_to, subject, body)
+		SELECT email, $2, $3
+		FROM users
+		WHERE lower(user_name) = lower($1)
+			AND email IS NOT NULL
+			AND email != ''`
+	_, err = DB.Exec(context.Background(), dbQuery, dbOwner, alertSubj, alertMsg)
+	if err != nil {
+		log.Printf("Queuing the size alert email for '%s' failed: %v", dbOwner, err)
+	}
+	return
+}
@@ -12,7 +12,6 @@ import (
 	"github.com/sqlitebrowser/dbhub.io/common/config"
 
 	pgx "github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
@@ -25,6 +24,84 @@ const (
 	DB_PUBLIC
 )
 
+// DBOrder is the order lists of databases are returned in
+type DBOrder int
+
+const (
+	// DBOrderModified lists the most recently modified databases first
+	DBOrderModified DBOrder = iota
+
+	// DBOrderPinned lists the databases pinned to the owner's profile first, in their chosen order, followed by the
+	// rest of the databases with the most recently modified first
+	DBOrderPinned
+
+	// DBOrderCreated lists the most recently created databases first
+	DBOrderCreated
+
+	// DBOrderDownloads lists the most downloaded databases first
+	DBOrderDownloads
+
+	// DBOrderSize lists the largest databases first
+	DBOrderSize
+
+	// DBOrderStars lists the most starred databases first
+	DBOrderStars
+)
+
+// DBFilter narrows down the databases included in lists of databases.  The zero value includes all of them
+type DBFilter struct {
+	HasReleases bool   // Only include databases with at least one release
+	Licence     string // Only include databases whose latest commit uses this licence, eg "CC0"
+}
+
+// Where returns the SQL clauses for the filter, for a query on the sqlite_databases table aliased as "db".  The
+// values the clauses refer to are appended to args, so the placeholders match their positions
+func (f DBFilter) Where(args []interface{}) (clauses string, newArgs []interface{}) {
+	newArgs = args
+	if f.HasReleases {
+		clauses += `
+			AND db.release_count > 0`
+	}
+	if f.Licence != "" {
+		newArgs = append(newArgs, f.Licence)
+		clauses += fmt.Sprintf(`
+			AND db.latest_licence IN (
+				SELECT lic_sha256
+				FROM database_licences
+				WHERE friendly_name = $%d
+					AND (user_id = (SELECT user_id FROM users WHERE user_name = 'default')
+						OR user_id = db.user_id)
+			)`, len(newArgs))
+	}
+	return
+}
+
+// OrderBy returns the SQL ORDER BY clause for a database list order, for a query on the sqlite_databases table aliased
+// as "db".  Live databases don't store their size, so DBOrderSize sorts them by name and they need sorting afterwards
+func (o DBOrder) OrderBy() (string, error) {
+	switch o {
+	case DBOrderModified:
+		return `
+		ORDER BY db.last_modified DESC`, nil
+	case DBOrderPinned:
+		return `
+		ORDER BY db.pin_position NULLS LAST, db.last_modified DESC`, nil
+	case DBOrderCreated:
+		return `
+		ORDER BY db.date_created DESC`, nil
+	case DBOrderDownloads:
+		return `
+		ORDER BY db.download_count DESC, db.last_modified DESC`, nil
+	case DBOrderSize:
+		return `
+		ORDER BY db.latest_size DESC NULLS LAST, db.db_name`, nil
+	case DBOrderStars:
+		return `
+		ORDER BY db.stars DESC, db.last_modified DESC`, nil
+	}
+	return "", fmt.Errorf("Unknown database list order '%v'", o)
+}
+
 type DBTreeEntryType string
 
 const (
@@ -52,20 +129,6 @@ const (
 	KeepCurrentAccessType
 )
 
-type ActivityRow struct {
-	Count  int    `json:"count"`
-	DBName string `json:"dbname"`
-	Owner  string `json:"owner"`
-}
-
-type ActivityStats struct {
-	Downloads []ActivityRow
-	Forked    []ActivityRow
-	Starred   []ActivityRow
-	Uploads   []UploadRow
-	Viewed    []ActivityRow
-}
-
 type BranchEntry struct {
 	Commit      string `json:"commit"`
 	CommitCount int    `json:"commit_count"`
@@ -93,45 +156,51 @@ type DBEntry struct {
 }
 
 type DBInfo struct {
-	Branch        string
-	Branches      int
-	BranchList    []string
-	Commits       int
-	CommitID      string
-	Contributors  int
-	Database      string
-	DateCreated   time.Time
-	DBEntry       DBTreeEntry
-	DefaultBranch string
-	DefaultTable  string
-	Discussions   int
-	Downloads     int
-	ForkDatabase  string
-	ForkDeleted   bool
-	ForkOwner     string
-	Forks         int
-	FullDesc      string
-	IsLive        bool
-	LastModified  time.Time
-	Licence       string
-	LicenceURL    string
-	LiveNode      string
-	MRs           int
-	MyStar        bool
-	MyWatch       bool
-	OneLineDesc   string
-	Owner         string
-	Public        bool
-	RepoModified  time.Time
-	Releases      int
-	SHA256        string
-	Size          int64
-	SourceURL     string
-	Stars         int
-	Tables        []string
-	Tags          int
-	Views         int
-	Watchers      int
+	Archived        bool
+	Branch          string
+	Branches        int
+	BranchList      []string
+	ClientEncrypted bool
+	Commits         int
+	CommitID        string
+	Contributors    int
+	Database        string
+	DateCreated     time.Time
+	DBEntry         DBTreeEntry
+	DefaultBranch   string
+	DefaultTable    string
+	Discussions     int
+	Downloads       int
+	ForkDatabase    string
+	ForkDeleted     bool
+	ForkOwner       string
+	Forks           int
+	FullDesc        string
+	IsLive          bool
+	IsTemplate      bool
+	LastModified    time.Time
+	Licence         string
+	LicenceURL      string
+	LiveNode        string
+	MRs             int
+	MyStar          bool
+	MyWatch         bool
+	MyWatchMode     WatchMode
+	OneLineDesc     string
+	Owner           string
+	PinPosition     int
+	Public          bool
+	RepoModified    time.Time
+	Releases        int
+	SHA256          string
+	Size            int64
+	SourceURL       string
+	Stars           int
+	Tables          []string
+	Tags            int
+	Verified        bool
+	Views           int
+	Watchers        int
 }
 
 type DBTree struct {
@@ -163,6 +232,7 @@ type ReleaseEntry struct {
 	Commit        string    `json:"commit"`
 	Date          time.Time `json:"date"`
 	Description   string    `json:"description"`
+	DOI           string    `json:"doi,omitempty"`
 	ReleaserEmail string    `json:"email"`
 	ReleaserName  string    `json:"name"`
 	Size          int64     `json:"size"`
@@ -183,12 +253,6 @@ type TagEntry struct {
 	TaggerName  string    `json:"name"`
 }
 
-type UploadRow struct {
-	DBName     string    `json:"dbname"`
-	Owner      string    `json:"owner"`
-	UploadDate time.Time `json:"upload_date"`
-}
-
 // AnalysisUsersWithDBs returns the list of users with at least one database
 func AnalysisUsersWithDBs() (userList map[string]int, err error) {
 	dbQuery := `
@@ -241,6 +305,67 @@ func CheckDBExists(dbOwner, dbName string) (bool, error) {
 	return dbCount != 0, nil
 }
 
+// ErrDBArchived is returned when trying to change a database which has been archived by its owner
+var ErrDBArchived = errors.New("This database has been archived by its owner, so it's read only")
+
+// CheckDBArchived checks if a database has been archived by its owner.  Archived databases are read only, so they
+// don't accept new commits, discussions, or merge requests
+func CheckDBArchived(dbOwner, dbName string) (archived bool, err error) {
+	dbQuery := `
+		SELECT archived
+		FROM sqlite_databases
+		WHERE user_id = (
+				SELECT user_id
+				FROM users
+				WHERE lower(user_name) = lower($1)
+			)
+			AND db_name = $2
+			AND is_deleted = false`
+	err = DB.QueryRow(context.Background(), dbQuery, dbOwner, dbName).Scan(&archived)
+	if err != nil {
+		log.Printf("Checking if database '%s/%s' is archived failed: %v", dbOwner, dbName, err)
+	}
+	return
+}
+
+// CheckDBTemplate checks if a database has been marked as a template by its owner
+func CheckDBTemplate(dbOwner, dbName string) (isTemplate bool, err error) {
+	dbQuery := `
+		SELECT is_template
+		FROM sqlite_databases
+		WHERE user_id = (
+				SELECT user_id
+				FROM users
+				WHERE lower(user_name) = lower($1)
+			)
+			AND db_name = $2
+			AND is_deleted = false`
+	err = DB.QueryRow(context.Background(), dbQuery, dbOwner, dbName).Scan(&isTemplate)
+	if err != nil {
+		log.Printf("Checking if database '%s/%s' is a template failed: %v", dbOwner, dbName, err)
+	}
+	return
+}
+
+// CheckDBClientEncrypted checks if a database was encrypted by its owner before being uploaded
+func CheckDBClientEncrypted(dbOwner, dbName string) (encrypted bool, err error) {
+	dbQuery := `
+		SELECT client_encrypted
+		FROM sqlite_databases
+		WHERE user_id = (
+				SELECT user_id
+				FROM users
+				WHERE lower(user_name) = lower($1)
+			)
+			AND db_name = $2
+			AND is_deleted = false`
+	err = DB.QueryRow(context.Background(), dbQuery, dbOwner, dbName).Scan(&encrypted)
+	if err != nil {
+		log.Printf("Checking if database '%s/%s' is encrypted failed: %v", dbOwner, dbName, err)
+	}
+	return
+}
+
 // CheckDBLive checks if the given database is a live database
 func CheckDBLive(dbOwner, dbName string) (isLive bool, liveNode string, err error) {
 	// Query matching databases
@@ -320,11 +445,17 @@ func DBDetails(dbInfo *SQLiteDBinfo, loggedInUser, dbOwner, dbName, commitID str
 		// Retrieve the database details
 		dbQuery := `
 			SELECT db.date_created, db.last_modified, db.watchers, db.stars, db.discussions, db.merge_requests,
-				$3::text AS commit_id, db.commit_list->$3::text->'tree'->'entries'->0 AS db_entry, db.branches,
+				$3::text AS commit_id, (
+					SELECT c.tree->'entries'->0
+					FROM commits AS c
+					WHERE c.db_id = db.db_id
+						AND c.commit_id = $3
+				) AS db_entry, db.branches,
 				db.release_count, db.contributors, coalesce(db.one_line_description, ''),
 				coalesce(db.full_description, 'No full description'), coalesce(db.default_table, ''), db.public,
 				coalesce(db.source_url, ''), db.tags, coalesce(db.default_branch, ''), db.live_db,
-				coalesce(db.live_node, ''), coalesce(db.live_minio_object_id, '')
+				coalesce(db.live_node, ''), coalesce(db.live_minio_object_id, ''), db.verified, db.client_encrypted,
+				db.archived, db.is_template
 			FROM sqlite_databases AS db
 			WHERE db.user_id = (
 					SELECT user_id
@@ -339,7 +470,8 @@ func DBDetails(dbInfo *SQLiteDBinfo, loggedInUser, dbOwner, dbName, commitID str
 			&dbInfo.Info.Watchers, &dbInfo.Info.Stars, &dbInfo.Info.Discussions, &dbInfo.Info.MRs, &dbInfo.Info.CommitID, &dbInfo.Info.DBEntry,
 			&dbInfo.Info.Branches, &dbInfo.Info.Releases, &dbInfo.Info.Contributors, &dbInfo.Info.OneLineDesc, &dbInfo.Info.FullDesc,
 			&dbInfo.Info.DefaultTable, &dbInfo.Info.Public, &dbInfo.Info.SourceURL, &dbInfo.Info.Tags, &dbInfo.Info.DefaultBranch,
-			&dbInfo.Info.IsLive, &dbInfo.Info.LiveNode, &dbInfo.MinioId)
+			&dbInfo.Info.IsLive, &dbInfo.Info.LiveNode, &dbInfo.MinioId, &dbInfo.Info.Verified, &dbInfo.Info.ClientEncrypted,
+			&dbInfo.Info.Archived, &dbInfo.Info.IsTemplate)
 		if err != nil {
 			log.Printf("Error when retrieving database details: %v", err.Error())
 			return errors.New("The requested database doesn't exist")
@@ -350,7 +482,7 @@ func DBDetails(dbInfo *SQLiteDBinfo, loggedInUser, dbOwner, dbName, commitID str
 			SELECT db.date_created, db.last_modified, db.watchers, db.stars, db.discussions, coalesce(db.one_line_description, ''),
 				coalesce(db.full_description, 'No full description'), coalesce(db.default_table, ''), db.public,
 				coalesce(db.source_url, ''), coalesce(db.default_branch, ''), coalesce(db.live_node, ''),
-				coalesce(db.live_minio_object_id, '')
+				coalesce(db.live_minio_object_id, ''), db.verified, db.archived
 			FROM sqlite_databases AS db
 			WHERE db.user_id = (
 					SELECT user_id
@@ -364,7 +496,7 @@ func DBDetails(dbInfo *SQLiteDBinfo, loggedInUser, dbOwner, dbName, commitID str
 		err = DB.QueryRow(context.Background(), dbQuery, dbOwner, dbName).Scan(&dbInfo.Info.DateCreated,
 			&dbInfo.Info.RepoModified, &dbInfo.Info.Watchers, &dbInfo.Info.Stars, &dbInfo.Info.Discussions, &dbInfo.Info.OneLineDesc,
 			&dbInfo.Info.FullDesc, &dbInfo.Info.DefaultTable, &dbInfo.Info.Public, &dbInfo.Info.SourceURL, &dbInfo.Info.DefaultBranch,
-			&dbInfo.Info.LiveNode, &dbInfo.MinioId)
+			&dbInfo.Info.LiveNode, &dbInfo.MinioId, &dbInfo.Info.Verified, &dbInfo.Info.Archived)
 		if err != nil {
 			log.Printf("Error when retrieving database details: %v", err.Error())
 			return errors.New("The requested database doesn't exist")
@@ -417,11 +549,12 @@ func DBDetails(dbInfo *SQLiteDBinfo, loggedInUser, dbOwner, dbName, commitID str
 		return err
 	}
 
-	// Check if the database is being watched by the logged in user
-	dbInfo.Info.MyWatch, err = CheckDBWatched(loggedInUser, dbOwner, dbName)
+	// Check if the database is being watched by the logged in user, and what activity they're watching for
+	dbInfo.Info.MyWatchMode, err = DBWatchMode(loggedInUser, dbOwner, dbName)
 	if err != nil {
 		return err
 	}
+	dbInfo.Info.MyWatch = dbInfo.Info.MyWatchMode != ""
 	return nil
 }
 
@@ -447,6 +580,26 @@ func DBStars(dbOwner, dbName string) (starCount int, err error) {
 	return starCount, nil
 }
 
+// DBVerified returns whether a given database has been verified by an admin
+func DBVerified(dbOwner, dbName string) (verified bool, err error) {
+	dbQuery := `
+		SELECT verified
+		FROM sqlite_databases
+		WHERE user_id = (
+				SELECT user_id
+				FROM users
+				WHERE lower(user_name) = lower($1)
+			)
+			AND db_name = $2
+			AND is_deleted = false`
+	err = DB.QueryRow(context.Background(), dbQuery, dbOwner, dbName).Scan(&verified)
+	if err != nil {
+		log.Printf("Error looking up the verified status of database '%s/%s'. Error: %v", dbOwner, dbName, err)
+		return false, err
+	}
+	return verified, nil
+}
+
 // DBWatchers returns the watchers count for a given database
 func DBWatchers(dbOwner, dbName string) (watcherCount int, err error) {
 	// Retrieve the updated watchers count
@@ -729,11 +882,12 @@ func ForkDatabase(srcOwner, dbName, dstOwner string) (newForkCount int, err erro
 			WHERE lower(user_name) = lower($1)
 		)
 		INSERT INTO sqlite_databases (user_id, db_name, public, forks, one_line_description, full_description,
-			branches, contributors, root_database, default_table, source_url, commit_list, branch_heads, tags,
-			default_branch, forked_from)
+			branches, contributors, root_database, default_table, source_url, branch_heads, tags, default_branch,
+			forked_from, latest_commit_id, latest_last_modified, latest_licence, latest_sha256, latest_size,
+			client_encrypted)
 		SELECT dst_u.user_id, db_name, public, 0, one_line_description, full_description, branches,
-			contributors, root_database, default_table, source_url, commit_list, branch_heads, tags, default_branch,
-			db_id
+			contributors, root_database, default_table, source_url, branch_heads, tags, default_branch, db_id,
+			latest_commit_id, latest_last_modified, latest_licence, latest_sha256, latest_size, client_encrypted
 		FROM sqlite_databases, dst_u
 		WHERE sqlite_databases.user_id = (
 				SELECT user_id
@@ -753,6 +907,68 @@ func ForkDatabase(srcOwner, dbName, dstOwner string) (newForkCount int, err erro
 			dstOwner, dbName)
 	}
 
+	// Copy the commit history, then the parents of the commits
+	dbQuery = `
+		WITH src AS (
+			SELECT db_id
+			FROM sqlite_databases
+			WHERE user_id = (
+					SELECT user_id
+					FROM users
+					WHERE lower(user_name) = lower($1)
+				)
+				AND db_name = $3
+		), dst AS (
+			SELECT db_id
+			FROM sqlite_databases
+			WHERE user_id = (
+					SELECT user_id
+					FROM users
+					WHERE lower(user_name) = lower($2)
+				)
+				AND db_name = $3
+		)
+		INSERT INTO commits (db_id, commit_id, author_name, author_email, committer_name, committer_email, message,
+			commit_timestamp, tree)
+		SELECT dst.db_id, c.commit_id, c.author_name, c.author_email, c.committer_name, c.committer_email, c.message,
+			c.commit_timestamp, c.tree
+		FROM commits AS c, src, dst
+		WHERE c.db_id = src.db_id`
+	_, err = DB.Exec(context.Background(), dbQuery, srcOwner, dstOwner, dbName)
+	if err != nil {
+		log.Printf("Copying commits when forking database '%s/%s' failed: %v", srcOwner, dbName, err)
+		return 0, err
+	}
+	dbQuery = `
+		WITH src AS (
+			SELECT db_id
+			FROM sqlite_databases
+			WHERE user_id = (
+					SELECT user_id
+					FROM users
+					WHERE lower(user_name) = lower($1)
+				)
+				AND db_name = $3
+		), dst AS (
+			SELECT db_id
+			FROM sqlite_databases
+			WHERE user_id = (
+					SELECT user_id
+					FROM users
+					WHERE lower(user_name) = lower($2)
+				)
+				AND db_name = $3
+		)
+		INSERT INTO commit_parents (db_id, commit_id, position, parent_id)
+		SELECT dst.db_id, p.commit_id, p.position, p.parent_id
+		FROM commit_parents AS p, src, dst
+		WHERE p.db_id = src.db_id`
+	_, err = DB.Exec(context.Background(), dbQuery, srcOwner, dstOwner, dbName)
+	if err != nil {
+		log.Printf("Copying commit parents when forking database '%s/%s' failed: %v", srcOwner, dbName, err)
+		return 0, err
+	}
+
 	// Update the fork count for the root database
 	dbQuery = `
 		WITH root_db AS (
@@ -1035,147 +1251,6 @@ func ForkTree(loggedInUser, dbOwner, dbName string) (outputList []ForkEntry, err
 	return outputList, nil
 }
 
-// GetActivityStats returns the latest activity stats
-func GetActivityStats() (stats ActivityStats, err error) {
-	// Retrieve a list of which databases are the most starred
-	dbQuery := `
-		WITH most_starred AS (
-			SELECT s.db_id, COUNT(s.db_id), max(s.date_starred)
-			FROM database_stars AS s, sqlite_databases AS db
-			WHERE s.db_id = db.db_id
-				AND db.public = true
-				AND db.is_deleted = false
-			GROUP BY s.db_id
-			ORDER BY count DESC
-			LIMIT 5
-		)
-		SELECT users.user_name, db.db_name, stars.count
-		FROM most_starred AS stars, sqlite_databases AS db, users
-		WHERE stars.db_id = db.db_id
-			AND users.user_id = db.user_id
-		ORDER BY count DESC, max ASC`
-	starRows, err := DB.Query(context.Background(), dbQuery)
-	if err != nil {
-		log.Printf("Database query failed: %v", err)
-		return
-	}
-	defer starRows.Close()
-	for starRows.Next() {
-		var oneRow ActivityRow
-		err = starRows.Scan(&oneRow.Owner, &oneRow.DBName, &oneRow.Count)
-		if err != nil {
-			log.Printf("Error retrieving list of most starred databases: %v", err)
-			return
-		}
-		stats.Starred = append(stats.Starred, oneRow)
-	}
-
-	// Retrieve a list of which databases are the most forked
-	dbQuery = `
-		SELECT users.user_name, db.db_name, db.forks
-		FROM sqlite_databases AS db, users
-		WHERE db.forks > 0
-			AND db.public = true
-			AND db.is_deleted = false
-			AND db.user_id = users.user_id
-		ORDER BY db.forks DESC, db.last_modified
-		LIMIT 5`
-	forkRows, err := DB.Query(context.Background(), dbQuery)
-	if err != nil {
-		log.Printf("Database query failed: %v", err)
-		return
-	}
-	defer forkRows.Close()
-	for forkRows.Next() {
-		var oneRow ActivityRow
-		err = forkRows.Scan(&oneRow.Owner, &oneRow.DBName, &oneRow.Count)
-		if err != nil {
-			log.Printf("Error retrieving list of most forked databases: %v", err)
-			return
-		}
-		stats.Forked = append(stats.Forked, oneRow)
-	}
-
-	// Retrieve a list of the most recent uploads
-	dbQuery = `
-		SELECT user_name, db.db_name, db.last_modified
-		FROM sqlite_databases AS db, users
-		WHERE db.forked_from IS NULL
-			AND db.public = true
-			AND db.is_deleted = false
-			AND db.user_id = users.user_id
-		ORDER BY db.last_modified DESC
-		LIMIT 5`
-	upRows, err := DB.Query(context.Background(), dbQuery)
-	if err != nil {
-		log.Printf("Database query failed: %v", err)
-		return
-	}
-	defer upRows.Close()
-	for upRows.Next() {
-		var oneRow UploadRow
-		err = upRows.Scan(&oneRow.Owner, &oneRow.DBName, &oneRow.UploadDate)
-		if err != nil {
-			log.Printf("Error retrieving list of most recent uploads: %v", err)
-			return
-		}
-		stats.Uploads = append(stats.Uploads, oneRow)
-	}
-
-	// Retrieve a list of which databases have been downloaded the most times by someone other than their owner
-	dbQuery = `
-		SELECT users.user_name, db.db_name, db.download_count
-		FROM sqlite_databases AS db, users
-		WHERE db.download_count > 0
-			AND db.public = true
-			AND db.is_deleted = false
-			AND db.user_id = users.user_id
-		ORDER BY db.download_count DESC, db.last_modified
-		LIMIT 5`
-	dlRows, err := DB.Query(context.Background(), dbQuery)
-	if err != nil {
-		log.Printf("Database query failed: %v", err)
-		return
-	}
-	defer dlRows.Close()
-	for dlRows.Next() {
-		var oneRow ActivityRow
-		err = dlRows.Scan(&oneRow.Owner, &oneRow.DBName, &oneRow.Count)
-		if err != nil {
-			log.Printf("Error retrieving list of most downloaded databases: %v", err)
-			return
-		}
-		stats.Downloads = append(stats.Downloads, oneRow)
-	}
-
-	// Retrieve the list of databases which have been viewed the most times
-	dbQuery = `
-		SELECT users.user_name, db.db_name, db.page_views
-		FROM sqlite_databases AS db, users
-		WHERE db.page_views > 0
-			AND db.public = true
-			AND db.is_deleted = false
-			AND db.user_id = users.user_id
-		ORDER BY db.page_views DESC, db.last_modified
-		LIMIT 5`
-	viewRows, err := DB.Query(context.Background(), dbQuery)
-	if err != nil {
-		log.Printf("Database query failed: %v", err)
-		return
-	}
-	defer viewRows.Close()
-	for viewRows.Next() {
-		var oneRow ActivityRow
-		err = viewRows.Scan(&oneRow.Owner, &oneRow.DBName, &oneRow.Count)
-		if err != nil {
-			log.Printf("Error retrieving list of most viewed databases: %v", err)
-			return
-		}
-		stats.Viewed = append(stats.Viewed, oneRow)
-	}
-	return
-}
-
 // GetBranches load the branch heads for a database
 // TODO: It might be better to have the default branch name be returned as part of this list, by indicating in the list
 // TODO  which of the branches is the default.
@@ -1198,29 +1273,6 @@ func GetBranches(dbOwner, dbName string) (branches map[string]BranchEntry, err e
 	return branches, nil
 }
 
-// GetCommitList returns the full commit list for a database
-func GetCommitList(dbOwner, dbName string) (map[string]CommitEntry, error) {
-	dbQuery := `
-		WITH u AS (
-			SELECT user_id
-			FROM users
-			WHERE lower(user_name) = lower($1)
-		)
-		SELECT commit_list as commits
-		FROM sqlite_databases AS db, u
-		WHERE db.user_id = u.user_id
-			AND db.db_name = $2
-			AND db.is_deleted = false`
-	var l map[string]CommitEntry
-	err := DB.QueryRow(context.Background(), dbQuery, dbOwner, dbName).Scan(&l)
-	if err != nil {
-		log.Printf("Retrieving commit list for '%s/%s' failed: %v", dbOwner,
-			dbName, err)
-		return map[string]CommitEntry{}, err
-	}
-	return l, nil
-}
-
 // GetDefaultBranchName returns the default branch name for a database
 func GetDefaultBranchName(dbOwner, dbName string) (branchName string, err error) {
 	dbQuery := `
@@ -1395,7 +1447,12 @@ func LiveAddDatabasePG(dbOwner, dbName, bucketName, liveNode string, accessType
 		return
 	}
 
-	var commandTag pgconn.CommandTag
+	ctx := context.Background()
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback(ctx)
 	dbQuery := `
 		WITH root AS (
 			SELECT nextval('sqlite_databases_db_id_seq') AS val
@@ -1404,17 +1461,21 @@ func LiveAddDatabasePG(dbOwner, dbName, bucketName, liveNode string, accessType
 		SELECT (
 			SELECT user_id
 			FROM users
-			WHERE lower(user_name) = lower($1)), (SELECT val FROM root), $2, $3, true, $4, $5`
-	commandTag, err = DB.Exec(context.Background(), dbQuery, dbOwner, dbName, public, liveNode, bucketName)
+			WHERE lower(user_name) = lower($1)), (SELECT val FROM root), $2, $3, true, $4, $5
+		RETURNING db_id`
+	var dbID int64
+	err = tx.QueryRow(ctx, dbQuery, dbOwner, dbName, public, liveNode, bucketName).Scan(&dbID)
 	if err != nil {
 		log.Printf("Storing LIVE database '%s/%s' failed: %s", dbOwner, dbName, err)
 		return err
 	}
-	if numRows := commandTag.RowsAffected(); numRows != 1 {
-		log.Printf("Wrong number of rows (%d) affected while storing LIVE database '%s/%s'", numRows,
-			dbOwner, dbName)
+
+	// Start the placement history of the database
+	err = recordLivePlacement(ctx, tx, dbID, liveNode, "", "created")
+	if err != nil {
+		return
 	}
-	return nil
+	return tx.Commit(ctx)
 }
 
 // RenameDatabase renames a SQLite database
@@ -1448,6 +1509,84 @@ func RenameDatabase(userName, dbName, newName string) error {
 	return nil
 }
 
+// SetDBArchived archives a database, or makes it writable again.  The returned boolean is false if the database
+// doesn't exist
+func SetDBArchived(dbOwner, dbName string, archived bool) (exists bool, err error) {
+	dbQuery := `
+		UPDATE sqlite_databases
+		SET archived = $3,
+			date_archived = CASE WHEN $3 THEN now() END
+		WHERE user_id = (
+				SELECT user_id
+				FROM users
+				WHERE lower(user_name) = lower($1)
+			)
+			AND db_name = $2
+			AND is_deleted = false`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, archived)
+	if err != nil {
+		log.Printf("Changing the archived status of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+// SetDBTemplate marks a database as a template, which other users can create new databases from, or stops it being
+// one.  Live databases and databases encrypted by their owner can't be templates.  The returned boolean is false if
+// the database doesn't exist
+func SetDBTemplate(dbOwner, dbName string, isTemplate bool) (exists bool, err error) {
+	dbQuery := `
+		UPDATE sqlite_databases
+		SET is_template = $3
+		WHERE user_id = (
+				SELECT user_id
+				FROM users
+				WHERE lower(user_name) = lower($1)
+			)
+			AND db_name = $2
+			AND is_deleted = false
+			AND (NOT $3 OR (live_db = false AND client_encrypted = false))`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, isTemplate)
+	if err != nil {
+		log.Printf("Changing the template status of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+// SetDBVerified marks a database as verified (or not) by an instance admin.  Verified databases are shown with a
+// badge, to point people towards official or curated data.  The returned boolean is false if the database doesn't exist
+func SetDBVerified(adminUser, dbOwner, dbName string, verified bool) (exists bool, err error) {
+	dbQuery := `
+		UPDATE sqlite_databases
+		SET verified = $3,
+			verified_by = CASE WHEN $3 THEN (SELECT user_id FROM users WHERE lower(user_name) = lower($4)) END,
+			date_verified = CASE WHEN $3 THEN now() END
+		WHERE user_id = (
+				SELECT user_id
+				FROM users
+				WHERE lower(user_name) = lower($1)
+			)
+			AND db_name = $2
+			AND is_deleted = false`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, verified, adminUser)
+	if err != nil {
+		log.Printf("Changing the verified status of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	if commandTag.RowsAffected() != 1 {
+		return
+	}
+
+	// Log the change
+	if verified {
+		log.Printf("Database '%s/%s' marked as verified by '%s'", dbOwner, dbName, adminUser)
+	} else {
+		log.Printf("Database '%s/%s' no longer verified, changed by '%s'", dbOwner, dbName, adminUser)
+	}
+	return true, nil
+}
+
 // SocialStats returns the latest social stats for a given database
 func SocialStats(dbOwner, dbName string) (wa, st, fo int, err error) {
 
@@ -1494,31 +1633,7 @@ func StoreBranches(dbOwner, dbName string, branches map[string]BranchEntry) erro
 			"Wrong number of rows (%d) affected when updating branch heads for database '%s/%s' to '%v'",
 			numRows, dbOwner, dbName, branches)
 	}
-	return nil
-}
-
-// StoreCommits updates the commit list for a database
-func StoreCommits(dbOwner, dbName string, commitList map[string]CommitEntry) error {
-	dbQuery := `
-		UPDATE sqlite_databases
-		SET commit_list = $3, last_modified = now()
-		WHERE user_id = (
-				SELECT user_id
-				FROM users
-				WHERE lower(user_name) = lower($1)
-				)
-			AND db_name = $2`
-	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, commitList)
-	if err != nil {
-		log.Printf("Updating commit list for database '%s/%s' failed: %v", dbOwner,
-			dbName, err)
-		return err
-	}
-	if numRows := commandTag.RowsAffected(); numRows != 1 {
-		log.Printf("Wrong number of rows (%d) affected when updating commit list for database '%s/%s'", numRows,
-			dbOwner, dbName)
-	}
-	return nil
+	return UpdateLatestCommit(dbOwner, dbName)
 }
 
 // StoreDefaultBranchName stores the default branch name for a database
@@ -1542,7 +1657,7 @@ func StoreDefaultBranchName(dbOwner, dbName, branchName string) error {
 		log.Printf("Wrong number of rows (%d) affected during update: database: %v, new branch name: '%v'",
 			numRows, dbName, branchName)
 	}
-	return nil
+	return UpdateLatestCommit(dbOwner, dbName)
 }
 
 // StoreDefaultTableName stores the default table name for a database
@@ -1660,6 +1775,40 @@ func UpdateContributorsCount(dbOwner, dbName string) error {
 	return nil
 }
 
+// UpdateLatestCommit refreshes the stored details of the latest commit (the head of the default branch) of a database.
+// It needs calling whenever the commits, branches, or default branch of a database are changed
+func UpdateLatestCommit(dbOwner, dbName string) error {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		)
+		UPDATE sqlite_databases AS db
+		SET (latest_commit_id, latest_last_modified, latest_licence, latest_sha256, latest_size) = (
+				SELECT head.id, (head.entry->>'last_modified')::timestamptz, head.entry->>'licence',
+					head.entry->>'sha256', (head.entry->>'size')::bigint
+				FROM (
+					SELECT db.branch_heads->db.default_branch->>'commit' AS id, (
+							SELECT c.tree->'entries'->0
+							FROM commits AS c
+							WHERE c.db_id = db.db_id
+								AND c.commit_id = db.branch_heads->db.default_branch->>'commit'
+						) AS entry
+				) AS head
+			)
+		FROM u
+		WHERE db.user_id = u.user_id
+			AND db.db_name = $2
+			AND db.live_db = false`
+	_, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName)
+	if err != nil {
+		log.Printf("Updating latest commit details for database '%s/%s' failed: %v", dbOwner, dbName, err)
+		return err
+	}
+	return nil
+}
+
 // UpdateModified is a simple function to change the 'last modified' timestamp for a database to now()
 func UpdateModified(dbOwner, dbName string) (err error) {
 	dbQuery := `
@@ -1684,28 +1833,24 @@ func UpdateModified(dbOwner, dbName string) (err error) {
 	return
 }
 
-// UserDBs returns the list of databases for a user
-func UserDBs(userName string, public AccessType) (list []DBInfo, err error) {
+// UserDBs returns the list of standard databases for a user which match the filter, in the requested order
+func UserDBs(userName string, public AccessType, order DBOrder, filter DBFilter) (list []DBInfo, err error) {
 	// Construct SQL query for retrieving the requested database list
 	dbQuery := `
 		WITH u AS (
 			SELECT user_id
 			FROM users
 			WHERE lower(user_name) = lower($1)
-		), default_commits AS (
-			SELECT DISTINCT ON (db.db_name) db_name, db.db_id, db.branch_heads->db.default_branch->>'commit' AS id
-			FROM sqlite_databases AS db, u
-			WHERE db.user_id = u.user_id
-		), dbs AS (
-			SELECT DISTINCT ON (db.db_name) db.db_name, db.date_created, db.last_modified, db.public,
-				db.watchers, db.stars, db.discussions, db.merge_requests, db.branches, db.release_count, db.tags,
-				db.contributors, db.one_line_description, default_commits.id,
-				db.commit_list->default_commits.id->'tree'->'entries'->0, db.source_url, db.default_branch,
-				db.download_count, db.page_views
-			FROM sqlite_databases AS db, default_commits
-			WHERE db.db_id = default_commits.db_id
-				AND db.is_deleted = false
-				AND db.live_db = false`
+		)
+		SELECT db.db_name, db.date_created, db.last_modified, db.public, db.watchers, db.stars, db.discussions,
+			db.merge_requests, db.branches, db.release_count, db.tags, db.contributors, db.one_line_description,
+			coalesce(db.latest_commit_id, ''), db.latest_last_modified, coalesce(db.latest_licence, ''),
+			coalesce(db.latest_sha256, ''), coalesce(db.latest_size, 0), db.source_url, db.default_branch,
+			db.download_count, db.page_views, db.verified, coalesce(db.pin_position, 0), db.archived, db.is_template
+		FROM sqlite_databases AS db, u
+		WHERE db.user_id = u.user_id
+			AND db.is_deleted = false
+			AND db.live_db = false`
 	switch public {
 	case DB_PUBLIC:
 		// Only public databases
@@ -1719,12 +1864,13 @@ func UserDBs(userName string, public AccessType) (list []DBInfo, err error) {
 		// This clause shouldn't ever be reached
 		return nil, fmt.Errorf("Incorrect 'public' value '%v' passed to UserDBs() function.", public)
 	}
-	dbQuery += `
-		)
-		SELECT *
-		FROM dbs
-		ORDER BY last_modified DESC`
-	rows, err := DB.Query(context.Background(), dbQuery, userName)
+	filterClauses, args := filter.Where([]interface{}{userName})
+	orderBy, err := order.OrderBy()
+	if err != nil {
+		return nil, err
+	}
+	dbQuery += filterClauses + orderBy
+	rows, err := DB.Query(context.Background(), dbQuery, args...)
 	if err != nil {
 		log.Printf("Getting list of databases for user failed: %s", err)
 		return nil, err
@@ -1732,11 +1878,14 @@ func UserDBs(userName string, public AccessType) (list []DBInfo, err error) {
 	defer rows.Close()
 	for rows.Next() {
 		var defBranch, desc, source pgtype.Text
+		var lastModified pgtype.Timestamptz
 		var oneRow DBInfo
 		err = rows.Scan(&oneRow.Database, &oneRow.DateCreated, &oneRow.RepoModified, &oneRow.Public,
 			&oneRow.Watchers, &oneRow.Stars, &oneRow.Discussions, &oneRow.MRs, &oneRow.Branches,
-			&oneRow.Releases, &oneRow.Tags, &oneRow.Contributors, &desc, &oneRow.CommitID, &oneRow.DBEntry, &source,
-			&defBranch, &oneRow.Downloads, &oneRow.Views)
+			&oneRow.Releases, &oneRow.Tags, &oneRow.Contributors, &desc, &oneRow.CommitID, &lastModified,
+			&oneRow.DBEntry.LicenceSHA, &oneRow.DBEntry.Sha256, &oneRow.DBEntry.Size, &source, &defBranch,
+			&oneRow.Downloads, &oneRow.Views, &oneRow.Verified, &oneRow.PinPosition, &oneRow.Archived,
+			&oneRow.IsTemplate)
 		if err != nil {
 			log.Printf("Error retrieving database list for user: %v", err)
 			return nil, err
@@ -1750,6 +1899,9 @@ func UserDBs(userName string, public AccessType) (list []DBInfo, err error) {
 		if source.Valid {
 			oneRow.SourceURL = source.String
 		}
+		if lastModified.Valid {
+			oneRow.DBEntry.LastModified = lastModified.Time
+		}
 		oneRow.LastModified = oneRow.DBEntry.LastModified
 		oneRow.Size = oneRow.DBEntry.Size
 		oneRow.SHA256 = oneRow.DBEntry.Sha256
@@ -1877,6 +2029,62 @@ func UserWatchingDBs(userName string) (list []DBEntry, err error) {
 	return list, nil
 }
 
+// VerifiedDBs returns the list of public databases which have been verified by an admin, most recently verified first
+func VerifiedDBs() (list []DBEntry, err error) {
+	dbQuery := `
+		SELECT users.user_name, coalesce(users.display_name, ''), db.db_name, db.date_verified
+		FROM sqlite_databases AS db, users
+		WHERE db.user_id = users.user_id
+			AND db.verified = true
+			AND db.public = true
+			AND db.is_deleted = false
+		ORDER BY db.date_verified DESC`
+	rows, err := DB.Query(context.Background(), dbQuery)
+	if err != nil {
+		log.Printf("Database query failed: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var oneRow DBEntry
+		err = rows.Scan(&oneRow.Owner, &oneRow.OwnerDisplayName, &oneRow.DBName, &oneRow.DateEntry)
+		if err != nil {
+			log.Printf("Error retrieving the list of verified databases: %v", err)
+			return nil, err
+		}
+		list = append(list, oneRow)
+	}
+	return list, nil
+}
+
+// TemplateDBs returns the list of public databases which have been marked as templates, most recently changed first
+func TemplateDBs() (list []DBEntry, err error) {
+	dbQuery := `
+		SELECT users.user_name, coalesce(users.display_name, ''), db.db_name, db.last_modified
+		FROM sqlite_databases AS db, users
+		WHERE db.user_id = users.user_id
+			AND db.is_template = true
+			AND db.public = true
+			AND db.is_deleted = false
+		ORDER BY db.last_modified DESC`
+	rows, err := DB.Query(context.Background(), dbQuery)
+	if err != nil {
+		log.Printf("Database query failed: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var oneRow DBEntry
+		err = rows.Scan(&oneRow.Owner, &oneRow.OwnerDisplayName, &oneRow.DBName, &oneRow.DateEntry)
+		if err != nil {
+			log.Printf("Error retrieving the list of template databases: %v", err)
+			return nil, err
+		}
+		list = append(list, oneRow)
+	}
+	return list, nil
+}
+
 // ViewCount returns the view counter for a specific database
 func ViewCount(dbOwner, dbName string) (viewCount int, err error) {
 	dbQuery := `
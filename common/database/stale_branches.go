@@ -0,0 +1,147 @@
+package database
+
+import (
+	"context"
+	"log"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// StaleBranch is a branch which hasn't had commits for a while, and whose head commit is already part of another
+// branch.  It can be deleted without losing any commits
+type StaleBranch struct {
+	Branch      string    `json:"branch"`
+	Commit      string    `json:"commit"`
+	DateFlagged time.Time `json:"date_flagged"`
+	LastCommit  time.Time `json:"last_commit"`
+	MergedInto  string    `json:"merged_into"`
+}
+
+// StaleBranchDatabase identifies a database which is checked for stale branches
+type StaleBranchDatabase struct {
+	DBName string
+	Owner  string
+}
+
+// StaleBranchDatabases returns the databases which could have stale branches.  Live databases don't have branches, and
+// databases with only one branch have nothing to clean up
+func StaleBranchDatabases() (list []StaleBranchDatabase, err error) {
+	dbQuery := `
+		SELECT u.user_name, db.db_name
+		FROM sqlite_databases AS db
+			JOIN users AS u ON u.user_id = db.user_id
+		WHERE db.is_deleted = false
+			AND db.live_db = false
+			AND db.branches > 1
+		ORDER BY db.db_id`
+	rows, err := DB.Query(context.Background(), dbQuery)
+	if err != nil {
+		log.Printf("Retrieving the databases to check for stale branches failed: %v", err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (d StaleBranchDatabase, err error) {
+		err = row.Scan(&d.Owner, &d.DBName)
+		return
+	})
+	if err != nil {
+		log.Printf("Retrieving the databases to check for stale branches failed: %v", err)
+	}
+	return
+}
+
+// StaleBranches returns the branches of a database flagged as stale by the last check, sorted by name
+func StaleBranches(dbOwner, dbName string) (list []StaleBranch, err error) {
+	dbQuery := `
+		SELECT s.branch_name, s.commit_id, s.date_flagged, s.last_commit, s.merged_into
+		FROM stale_branches AS s
+			JOIN sqlite_databases AS db ON db.db_id = s.db_id
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false
+		ORDER BY s.branch_name`
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName)
+	if err != nil {
+		log.Printf("Retrieving the stale branches of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (b StaleBranch, err error) {
+		err = row.Scan(&b.Branch, &b.Commit, &b.DateFlagged, &b.LastCommit, &b.MergedInto)
+		return
+	})
+	if err != nil {
+		log.Printf("Retrieving the stale branches of '%s/%s' failed: %v", dbOwner, dbName, err)
+	}
+	return
+}
+
+// StaleBranchesRemove removes the stale flags of branches, when they've been deleted
+func StaleBranchesRemove(dbOwner, dbName string, branches []string) (err error) {
+	dbQuery := `
+		DELETE FROM stale_branches
+		WHERE db_id = (
+				SELECT db_id
+				FROM sqlite_databases
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+					AND db_name = $2
+					AND is_deleted = false
+			)
+			AND branch_name = ANY($3)`
+	_, err = DB.Exec(context.Background(), dbQuery, dbOwner, dbName, branches)
+	if err != nil {
+		log.Printf("Removing stale branch flags of '%s/%s' failed: %v", dbOwner, dbName, err)
+	}
+	return
+}
+
+// StaleBranchesSave replaces the branches of a database flagged as stale.  Branches which were already flagged with
+// the same head commit keep the date they were first flagged
+func StaleBranchesSave(dbOwner, dbName string, branches []StaleBranch) (err error) {
+	tx, err := DB.Begin(context.Background())
+	if err != nil {
+		return
+	}
+	defer tx.Rollback(context.Background())
+
+	names := []string{}
+	for _, b := range branches {
+		names = append(names, b.Branch)
+	}
+	dbQuery := `
+		DELETE FROM stale_branches
+		WHERE db_id = (
+				SELECT db_id
+				FROM sqlite_databases
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+					AND db_name = $2
+					AND is_deleted = false
+			)
+			AND NOT branch_name = ANY($3)`
+	_, err = tx.Exec(context.Background(), dbQuery, dbOwner, dbName, names)
+	if err != nil {
+		log.Printf("Removing stale branch flags of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+
+	dbQuery = `
+		INSERT INTO stale_branches (db_id, branch_name, commit_id, last_commit, merged_into)
+		SELECT db.db_id, $3, $4, $5, $6
+		FROM sqlite_databases AS db
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false
+		ON CONFLICT (db_id, branch_name)
+			DO UPDATE
+			SET commit_id = $4,
+				last_commit = $5,
+				merged_into = $6,
+				date_flagged = CASE WHEN stale_branches.commit_id = $4 THEN stale_branches.date_flagged ELSE now() END`
+	for _, b := range branches {
+		_, err = tx.Exec(context.Background(), dbQuery, dbOwner, dbName, b.Branch, b.Commit, b.LastCommit, b.MergedInto)
+		if err != nil {
+			log.Printf("Flagging branch '%s' of '%s/%s' as stale failed: %v", b.Branch, dbOwner, dbName, err)
+			return
+		}
+	}
+	return tx.Commit(context.Background())
+}
@@ -0,0 +1,142 @@
+package database
+
+import (
+	"context"
+	"log"
+)
+
+// StatusUpdates returns the unread status updates for a user, grouped by database ("owner/name")
+func StatusUpdates(loggedInUser string) (statusUpdates map[string][]StatusUpdateEntry, err error) {
+	lst, _, err := StatusUpdatesList(loggedInUser, true, 0, 0)
+	if err != nil {
+		return
+	}
+	statusUpdates = make(map[string][]StatusUpdateEntry)
+	for _, j := range lst {
+		statusUpdates[j.Database] = append(statusUpdates[j.Database], j)
+	}
+	return
+}
+
+// StatusUpdatesList returns a page of the status updates for a user, most recent first, along with the total number
+// of matching status updates.  A limit of 0 returns all of them
+func StatusUpdatesList(loggedInUser string, unreadOnly bool, offset, limit int) (lst []StatusUpdateEntry, total int, err error) {
+	dbQuery := `
+		SELECT s.update_id, owner.user_name || '/' || db.db_name, s.discussion_id, s.event_type, s.title,
+			s.event_url, s.is_read, s.date_created, count(*) OVER ()
+		FROM status_updates AS s
+			JOIN sqlite_databases AS db ON db.db_id = s.db_id
+			JOIN users AS owner ON owner.user_id = db.user_id
+		WHERE s.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND ($2 = false OR s.is_read = false)
+		ORDER BY s.date_created DESC, s.update_id DESC
+		OFFSET $3
+		LIMIT nullif($4, 0)`
+	rows, err := DB.Query(context.Background(), dbQuery, loggedInUser, unreadOnly, offset, limit)
+	if err != nil {
+		log.Printf("Error retrieving status updates list for user '%s': %v", loggedInUser, err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var s StatusUpdateEntry
+		err = rows.Scan(&s.ID, &s.Database, &s.DiscID, &s.Type, &s.Title, &s.URL, &s.Read, &s.Timestamp, &total)
+		if err != nil {
+			log.Printf("Error retrieving status updates list for user '%s': %v", loggedInUser, err)
+			return nil, 0, err
+		}
+		lst = append(lst, s)
+	}
+
+	// When the requested page is past the end of the list there aren't any rows to take the total from
+	if len(lst) == 0 && offset > 0 {
+		dbQuery = `
+			SELECT count(*)
+			FROM status_updates
+			WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+				AND ($2 = false OR is_read = false)`
+		err = DB.QueryRow(context.Background(), dbQuery, loggedInUser, unreadOnly).Scan(&total)
+		if err != nil {
+			log.Printf("Error counting status updates for user '%s': %v", loggedInUser, err)
+			return
+		}
+	}
+	return
+}
+
+// StatusUpdatesMarkAllRead marks all of the status updates for a user as read
+func StatusUpdatesMarkAllRead(loggedInUser string) (err error) {
+	dbQuery := `
+		UPDATE status_updates
+		SET is_read = true
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND is_read = false`
+	_, err = DB.Exec(context.Background(), dbQuery, loggedInUser)
+	if err != nil {
+		log.Printf("Marking all status updates as read for user '%s' failed: %v", loggedInUser, err)
+	}
+	return
+}
+
+// StatusUpdatesMarkDiscussionRead marks the status updates for a user about a given discussion or merge request as
+// read.  It returns true if there were any unread status updates for it
+func StatusUpdatesMarkDiscussionRead(loggedInUser, dbOwner, dbName string, discID int) (changed bool, err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, users AS owner
+			WHERE db.user_id = owner.user_id
+				AND lower(owner.user_name) = lower($2)
+				AND db.db_name = $3
+		)
+		UPDATE status_updates
+		SET is_read = true
+		WHERE user_id = (SELECT user_id FROM u)
+			AND db_id = (SELECT db_id FROM d)
+			AND discussion_id = $4
+			AND event_type IN ($5, $6, $7, $8, $9, $10)
+			AND is_read = false`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, loggedInUser, dbOwner, dbName, discID,
+		EVENT_NEW_DISCUSSION, EVENT_NEW_MERGE_REQUEST, EVENT_NEW_COMMENT, EVENT_MENTION, EVENT_ASSIGNED,
+		EVENT_REVIEW_REQUESTED)
+	if err != nil {
+		log.Printf("Marking status updates as read for discussion '%d' of '%s/%s' for user '%s' failed: %v",
+			discID, dbOwner, dbName, loggedInUser, err)
+		return
+	}
+	changed = commandTag.RowsAffected() > 0
+	return
+}
+
+// StatusUpdatesMarkRead sets the read state of the given status updates for a user.  IDs of status updates belonging
+// to other users are ignored
+func StatusUpdatesMarkRead(loggedInUser string, ids []int64, read bool) (err error) {
+	dbQuery := `
+		UPDATE status_updates
+		SET is_read = $3
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND update_id = ANY($2)`
+	_, err = DB.Exec(context.Background(), dbQuery, loggedInUser, ids, read)
+	if err != nil {
+		log.Printf("Changing the read state of status updates for user '%s' failed: %v", loggedInUser, err)
+	}
+	return
+}
+
+// StatusUpdatesUnreadCount returns the number of unread status updates for a user
+func StatusUpdatesUnreadCount(loggedInUser string) (numUpdates int, err error) {
+	dbQuery := `
+		SELECT count(*)
+		FROM status_updates
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND is_read = false`
+	err = DB.QueryRow(context.Background(), dbQuery, loggedInUser).Scan(&numUpdates)
+	if err != nil {
+		log.Printf("Error counting unread status updates for user '%s': %v", loggedInUser, err)
+	}
+	return
+}
@@ -0,0 +1,300 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// TransformationMaxRuns is the number of runs kept in the history of each transformation
+const TransformationMaxRuns = 100
+
+// Transformation is a SQL query run against a live database, whose result is materialised as a table of the same name.
+// It runs after the transformations it depends on, every Interval minutes when that's not zero, and after each change
+// to the database when OnWrite is set.  Trigger is the reason it's due to run, when it is
+type Transformation struct {
+	DateCreated  time.Time  `json:"date_created"`
+	DBName       string     `json:"database"`
+	DBOwner      string     `json:"owner"`
+	DependsOn    []string   `json:"depends_on"`
+	Interval     int        `json:"interval_minutes"`
+	LastError    string     `json:"last_error"`
+	LastModified time.Time  `json:"last_modified"`
+	LastRun      *time.Time `json:"last_run"`
+	Name         string     `json:"name"`
+	OnWrite      bool       `json:"run_on_write"`
+	SQL          string     `json:"sql"`
+	Trigger      string     `json:"-"`
+}
+
+// TransformationRun is one run of a transformation
+type TransformationRun struct {
+	Error       string    `json:"error"`
+	Finished    time.Time `json:"finished"`
+	Name        string    `json:"name"`
+	RowsWritten int64     `json:"rows_written"`
+	RunID       int64     `json:"run_id"`
+	Started     time.Time `json:"started"`
+	Trigger     string    `json:"trigger"`
+}
+
+// TransformationDelete removes a transformation from a live database, along with its run history.  The returned boolean
+// is false when it didn't exist
+func TransformationDelete(dbOwner, dbName, name string) (exists bool, err error) {
+	dbQuery := `
+		DELETE FROM transformations
+		WHERE db_id = (
+				SELECT db_id
+				FROM sqlite_databases
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+					AND db_name = $2
+					AND is_deleted = false
+			)
+			AND name = $3`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, name)
+	if err != nil {
+		log.Printf("Deleting the transformation '%s' of '%s/%s' failed: %v", name, dbOwner, dbName, err)
+		return
+	}
+	return commandTag.RowsAffected() == 1, nil
+}
+
+// TransformationRunSave records a run of a transformation.  When it fails after the previous run succeeded, the
+// database owner is emailed the given alert
+func TransformationRunSave(dbOwner, dbName string, run TransformationRun, alertSubj, alertMsg string) (err error) {
+	ctx := context.Background()
+	tx, err := DB.Begin(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	// Update the transformation, keeping the previous error so we can tell if it was already failing
+	dbQuery := `
+		UPDATE transformations AS t
+		SET pending_trigger = CASE WHEN t.pending_trigger = $4 THEN '' ELSE t.pending_trigger END,
+			last_run = $5,
+			last_error = $6
+		FROM transformations AS prev
+		WHERE prev.db_id = t.db_id
+			AND prev.name = t.name
+			AND t.db_id = (
+				SELECT db_id
+				FROM sqlite_databases
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+					AND db_name = $2
+					AND is_deleted = false
+			)
+			AND t.name = $3
+		RETURNING t.db_id, prev.last_error, prev.last_run`
+	var dbID int64
+	var prevError string
+	var prevRun *time.Time
+	err = tx.QueryRow(ctx, dbQuery, dbOwner, dbName, run.Name, run.Trigger, run.Finished, run.Error).Scan(&dbID,
+		&prevError, &prevRun)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// The transformation was deleted while it was running
+		return nil
+	}
+	if err != nil {
+		log.Printf("Recording the run of transformation '%s' of '%s/%s' failed: %v", run.Name, dbOwner, dbName, err)
+		return
+	}
+
+	// Add the run to the history, only keeping the most recent ones
+	dbQuery = `
+		INSERT INTO transformation_runs (db_id, name, trigger, started, finished, rows_written, error)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err = tx.Exec(ctx, dbQuery, dbID, run.Name, run.Trigger, run.Started, run.Finished, run.RowsWritten, run.Error)
+	if err != nil {
+		log.Printf("Recording the run of transformation '%s' of '%s/%s' failed: %v", run.Name, dbOwner, dbName, err)
+		return
+	}
+	dbQuery = `
+		DELETE FROM transformation_runs
+		WHERE db_id = $1
+			AND name = $2
+			AND run_id NOT IN (
+				SELECT run_id
+				FROM transformation_runs
+				WHERE db_id = $1
+					AND name = $2
+				ORDER BY started DESC
+				LIMIT $3
+			)`
+	_, err = tx.Exec(ctx, dbQuery, dbID, run.Name, TransformationMaxRuns)
+	if err != nil {
+		log.Printf("Trimming the run history of transformation '%s' of '%s/%s' failed: %v", run.Name, dbOwner,
+			dbName, err)
+		return
+	}
+
+	// Only alert the owner when a transformation starts failing, rather than on every failed run
+	if run.Error != "" && (prevError == "" || prevRun == nil) {
+		dbQuery = `
+			INSERT INTO email_queue (mail_to, subject, body)
+			SELECT email, $2, $3
+			FROM users
+			WHERE lower(user_name) = lower($1)
+				AND email IS NOT NULL
+				AND email != ''`
+		_, err = tx.Exec(ctx, dbQuery, dbOwner, alertSubj, alertMsg)
+		if err != nil {
+			log.Printf("Queuing the transformation failure email for '%s/%s' failed: %v", dbOwner, dbName, err)
+			return
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// TransformationRuns returns the most recent runs of the transformations of a live database, newest first.  When a name
+// is given, only the runs of that transformation are returned
+func TransformationRuns(dbOwner, dbName, name string) (list []TransformationRun, err error) {
+	dbQuery := `
+		SELECT r.run_id, r.name, r.trigger, r.started, r.finished, r.rows_written, r.error
+		FROM transformation_runs AS r
+			JOIN sqlite_databases AS db ON db.db_id = r.db_id
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false
+			AND ($3 = '' OR r.name = $3)
+		ORDER BY r.started DESC, r.run_id DESC
+		LIMIT $4`
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName, name, TransformationMaxRuns)
+	if err != nil {
+		log.Printf("Retrieving the transformation runs of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (r TransformationRun, err error) {
+		err = row.Scan(&r.RunID, &r.Name, &r.Trigger, &r.Started, &r.Finished, &r.RowsWritten, &r.Error)
+		return
+	})
+	if err != nil {
+		log.Printf("Retrieving the transformation runs of '%s/%s' failed: %v", dbOwner, dbName, err)
+	}
+	return
+}
+
+// TransformationSave adds a transformation to a live database, or changes an existing one
+func TransformationSave(t Transformation) (err error) {
+	dbQuery := `
+		INSERT INTO transformations (db_id, name, sql, depends_on, interval_minutes, run_on_write)
+		SELECT db_id, $3, $4, $5, $6, $7
+		FROM sqlite_databases
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db_name = $2
+			AND live_db = true
+			AND is_deleted = false
+		ON CONFLICT (db_id, name)
+			DO UPDATE
+			SET sql = $4,
+				depends_on = $5,
+				interval_minutes = $6,
+				run_on_write = $7,
+				last_modified = now()`
+	if t.DependsOn == nil {
+		t.DependsOn = []string{}
+	}
+	commandTag, err := DB.Exec(context.Background(), dbQuery, t.DBOwner, t.DBName, t.Name, t.SQL, t.DependsOn,
+		t.Interval, t.OnWrite)
+	if err != nil {
+		log.Printf("Saving the transformation '%s' of '%s/%s' failed: %v", t.Name, t.DBOwner, t.DBName, err)
+		return
+	}
+	if commandTag.RowsAffected() != 1 {
+		return errors.New("Database not found")
+	}
+	return
+}
+
+// Transformations returns the transformations of a live database, in name order
+func Transformations(dbOwner, dbName string) (list []Transformation, err error) {
+	dbQuery := `
+		SELECT u.user_name, db.db_name, t.name, t.sql, t.depends_on, t.interval_minutes, t.run_on_write,
+			CASE
+				WHEN t.pending_trigger != '' THEN t.pending_trigger
+				WHEN t.interval_minutes > 0
+					AND (t.last_run IS NULL OR t.last_run < now() - make_interval(mins => t.interval_minutes))
+					THEN 'schedule'
+				ELSE ''
+			END,
+			t.last_run, t.last_error, t.date_created, t.last_modified
+		FROM transformations AS t
+			JOIN sqlite_databases AS db ON db.db_id = t.db_id
+			JOIN users AS u ON u.user_id = db.user_id
+		WHERE lower(u.user_name) = lower($1)
+			AND db.db_name = $2
+			AND db.is_deleted = false
+		ORDER BY t.name`
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName)
+	if err != nil {
+		log.Printf("Retrieving the transformations of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (t Transformation, err error) {
+		err = row.Scan(&t.DBOwner, &t.DBName, &t.Name, &t.SQL, &t.DependsOn, &t.Interval, &t.OnWrite, &t.Trigger,
+			&t.LastRun, &t.LastError, &t.DateCreated, &t.LastModified)
+		return
+	})
+	if err != nil {
+		log.Printf("Retrieving the transformations of '%s/%s' failed: %v", dbOwner, dbName, err)
+	}
+	return
+}
+
+// TransformationsDue returns the live databases on a node which have transformations due to run, as a list of owner
+// and database name pairs
+func TransformationsDue(liveNode string) (list [][2]string, err error) {
+	dbQuery := `
+		SELECT DISTINCT u.user_name, db.db_name
+		FROM transformations AS t
+			JOIN sqlite_databases AS db ON db.db_id = t.db_id
+			JOIN users AS u ON u.user_id = db.user_id
+		WHERE db.live_node = $1
+			AND db.is_deleted = false
+			AND db.archived = false
+			AND (t.pending_trigger != ''
+				OR (t.interval_minutes > 0
+					AND (t.last_run IS NULL OR t.last_run < now() - make_interval(mins => t.interval_minutes))))`
+	rows, err := DB.Query(context.Background(), dbQuery, liveNode)
+	if err != nil {
+		log.Printf("Retrieving the due transformations failed: %v", err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (z [2]string, err error) {
+		err = row.Scan(&z[0], &z[1])
+		return
+	})
+	if err != nil {
+		log.Printf("Retrieving the due transformations failed: %v", err)
+	}
+	return
+}
+
+// TransformationsPending marks transformations of a live database as due to run.  For the "write" trigger only the
+// transformations set to run on write are marked.  When no names are given, all of the transformations are marked
+func TransformationsPending(dbOwner, dbName, trigger string, names []string) (err error) {
+	dbQuery := `
+		UPDATE transformations
+		SET pending_trigger = $3
+		WHERE db_id = (
+				SELECT db_id
+				FROM sqlite_databases
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+					AND db_name = $2
+					AND is_deleted = false
+			)
+			AND ($3 != 'write' OR run_on_write = true)
+			AND (cardinality($4::text[]) = 0 OR name = ANY($4))`
+	if names == nil {
+		names = []string{}
+	}
+	_, err = DB.Exec(context.Background(), dbQuery, dbOwner, dbName, trigger, names)
+	if err != nil {
+		log.Printf("Marking the transformations of '%s/%s' to run failed: %v", dbOwner, dbName, err)
+	}
+	return
+}
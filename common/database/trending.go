@@ -0,0 +1,175 @@
+package database
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+)
+
+const (
+	// The half-life of the activity counted towards the trending score.  A star given this long ago counts half as
+	// much as one given now
+	trendingHalfLife = 3 * 24 * time.Hour
+
+	// Activity older than this is ignored when calculating trending scores, as it no longer makes any real difference
+	trendingWindow = 30 * 24 * time.Hour
+
+	// How much each kind of activity counts towards the trending score
+	trendingWeightDownloads = 2.0
+	trendingWeightForks     = 8.0
+	trendingWeightStars     = 5.0
+	trendingWeightViews     = 1.0
+)
+
+// TrendingEntry holds the details of a database in the trending list
+type TrendingEntry struct {
+	Archived    bool    `json:"archived"`
+	DBName      string  `json:"database"`
+	Downloads   int     `json:"downloads"`
+	Forks       int     `json:"forks"`
+	OneLineDesc string  `json:"one_line_description"`
+	Owner       string  `json:"owner"`
+	Score       float64 `json:"score"`
+	Stars       int     `json:"stars"`
+	Verified    bool    `json:"verified"`
+	Views       int     `json:"views"`
+}
+
+// RefreshTrending recalculates the trending score of every public database, and stores it in the trending table.  The
+// score adds up the recent stars, forks, downloads, and views of a database, with older activity counting for less.
+// As views are only recorded as a running total, the decayed view count is carried over from the previous refresh
+func RefreshTrending() (err error) {
+	tx, err := DB.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	// The decay rate per second for the given half-life
+	decay := math.Ln2 / trendingHalfLife.Seconds()
+	cutoff := time.Now().Add(-trendingWindow)
+
+	dbQuery := `
+		WITH dbs AS (
+			SELECT db_id, coalesce(page_views, 0) AS page_views
+			FROM sqlite_databases
+			WHERE public = true
+				AND is_deleted = false
+		), stars AS (
+			SELECT st.db_id, sum(exp(-$1::double precision * extract(epoch FROM now() - st.date_starred)::double precision)) AS score
+			FROM database_stars AS st, dbs
+			WHERE st.db_id = dbs.db_id
+				AND st.date_starred > $2
+			GROUP BY st.db_id
+		), forks AS (
+			SELECT f.forked_from AS db_id, sum(exp(-$1::double precision * extract(epoch FROM now() - f.date_created)::double precision)) AS score
+			FROM sqlite_databases AS f, dbs
+			WHERE f.forked_from = dbs.db_id
+				AND f.is_deleted = false
+				AND f.date_created > $2
+			GROUP BY f.forked_from
+		), downloads AS (
+			SELECT dl.db_id, sum(exp(-$1::double precision * extract(epoch FROM now() - dl.download_date)::double precision)) AS score
+			FROM database_downloads AS dl, dbs
+			WHERE dl.db_id = dbs.db_id
+				AND dl.download_date > $2
+			GROUP BY dl.db_id
+		), views AS (
+			SELECT dbs.db_id, dbs.page_views,
+				coalesce(t.views_score * exp(-$1::double precision * extract(epoch FROM now() - t.date_updated)::double precision), 0)
+					+ greatest(dbs.page_views - coalesce(t.last_page_views, dbs.page_views), 0) AS score
+			FROM dbs
+				LEFT JOIN trending AS t ON t.db_id = dbs.db_id
+		)
+		INSERT INTO trending (db_id, score, views_score, stars_score, forks_score, downloads_score, last_page_views,
+			date_updated)
+		SELECT v.db_id,
+			v.score * $3 + coalesce(s.score, 0) * $4 + coalesce(f.score, 0) * $5 + coalesce(d.score, 0) * $6,
+			v.score, coalesce(s.score, 0), coalesce(f.score, 0), coalesce(d.score, 0), v.page_views, now()
+		FROM views AS v
+			LEFT JOIN stars AS s ON s.db_id = v.db_id
+			LEFT JOIN forks AS f ON f.db_id = v.db_id
+			LEFT JOIN downloads AS d ON d.db_id = v.db_id
+		ON CONFLICT (db_id) DO UPDATE
+			SET score = excluded.score,
+				views_score = excluded.views_score,
+				stars_score = excluded.stars_score,
+				forks_score = excluded.forks_score,
+				downloads_score = excluded.downloads_score,
+				last_page_views = excluded.last_page_views,
+				date_updated = excluded.date_updated`
+	_, err = tx.Exec(context.Background(), dbQuery, decay, cutoff, trendingWeightViews, trendingWeightStars,
+		trendingWeightForks, trendingWeightDownloads)
+	if err != nil {
+		log.Printf("Calculating the trending scores failed: %v", err)
+		return err
+	}
+
+	// Remove the databases which have been made private or deleted since the last refresh
+	dbQuery = `
+		DELETE FROM trending
+		WHERE db_id IN (
+			SELECT db_id
+			FROM sqlite_databases
+			WHERE public = false
+				OR is_deleted = true
+		)`
+	_, err = tx.Exec(context.Background(), dbQuery)
+	if err != nil {
+		log.Printf("Removing private and deleted databases from the trending list failed: %v", err)
+		return err
+	}
+	return tx.Commit(context.Background())
+}
+
+// Trending returns a page of the trending databases, highest scoring first.  Databases without any recent activity
+// aren't included.  The total number of trending databases is returned too, for paging
+func Trending(offset, limit int) (list []TrendingEntry, total int, err error) {
+	dbQuery := `
+		SELECT users.user_name, db.db_name, coalesce(db.one_line_description, ''), coalesce(db.page_views, 0),
+			db.stars, db.forks, coalesce(db.download_count, 0), db.verified, t.score, db.archived,
+			count(*) OVER ()
+		FROM trending AS t, sqlite_databases AS db, users
+		WHERE t.db_id = db.db_id
+			AND db.user_id = users.user_id
+			AND db.public = true
+			AND db.is_deleted = false
+			AND t.score > 0
+		ORDER BY t.score DESC, db.db_id
+		OFFSET $1
+		LIMIT nullif($2, 0)`
+	rows, err := DB.Query(context.Background(), dbQuery, offset, limit)
+	if err != nil {
+		log.Printf("Retrieving the trending databases failed: %v", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t TrendingEntry
+		err = rows.Scan(&t.Owner, &t.DBName, &t.OneLineDesc, &t.Views, &t.Stars, &t.Forks, &t.Downloads,
+			&t.Verified, &t.Score, &t.Archived, &total)
+		if err != nil {
+			log.Printf("Error retrieving the trending databases: %v", err)
+			return nil, 0, err
+		}
+		list = append(list, t)
+	}
+
+	// When the requested page is past the end of the list there aren't any rows to take the total from
+	if len(list) == 0 && offset > 0 {
+		dbQuery = `
+			SELECT count(*)
+			FROM trending AS t, sqlite_databases AS db
+			WHERE t.db_id = db.db_id
+				AND db.public = true
+				AND db.is_deleted = false
+				AND t.score > 0`
+		err = DB.QueryRow(context.Background(), dbQuery).Scan(&total)
+		if err != nil {
+			log.Printf("Error counting the trending databases: %v", err)
+			return
+		}
+	}
+	return
+}
@@ -2,8 +2,10 @@ package database
 
 import (
 	"context"
+	"errors"
 	"log"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/sqlitebrowser/dbhub.io/common/config"
 )
 
@@ -20,6 +22,12 @@ type UsageLimit struct {
 	Description   string      `json:"description"`
 	RateLimits    []RateLimit `json:"rate_limits"`
 	MaxUploadSize int64       `json:"max_upload_size"`
+
+	// Limits for each query on a live database.  -1 means the limit set for the whole instance is used, and 0 means
+	// there's no limit
+	LiveQueryMaxMemory int64 `json:"live_query_max_memory"`
+	LiveQueryMaxRows   int64 `json:"live_query_max_rows"`
+	LiveQueryTimeout   int64 `json:"live_query_timeout"`
 }
 
 // AddDefaultUsageLimits adds the default usage limits to the system so the the default value for users is valid
@@ -68,6 +76,28 @@ func MaxUploadSizeForUser(user string) (size int64, err error) {
 	return
 }
 
+// LiveQueryLimitsForUser retrieves the limits for each query on a live database set by the usage limits of a user.
+// Limits which aren't set are returned as -1, so the limits set for the whole instance are used for them.  0 means
+// there's no limit
+func LiveQueryLimitsForUser(user string) (maxMemory, maxRows, timeout int64, err error) {
+	query := `
+		SELECT coalesce(l.live_query_max_memory, -1), coalesce(l.live_query_max_rows, -1),
+			coalesce(l.live_query_timeout, -1)
+		FROM usage_limits AS l, users AS u
+		WHERE l.id = u.usage_limits_id
+			AND lower(u.user_name) = lower($1)`
+	err = DB.QueryRow(context.Background(), query, user).Scan(&maxMemory, &maxRows, &timeout)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Queries from people who aren't logged in use the limits of the instance
+		return -1, -1, -1, nil
+	}
+	if err != nil {
+		log.Printf("Querying live query limits failed for user '%s': %v", user, err)
+		return 0, 0, 0, err
+	}
+	return
+}
+
 // RateLimitsForUser retrieves the rate limits for a user based on their configured usage limits.
 func RateLimitsForUser(user string) (limits []RateLimit, err error) {
 	query := `
@@ -89,7 +119,10 @@ func RateLimitsForUser(user string) (limits []RateLimit, err error) {
 
 // GetUsageLimits returns a list of all usage limits
 func GetUsageLimits() (usageLimits []UsageLimit, err error) {
-	query := `SELECT id, name, description, rate_limits, coalesce(max_upload_size, -1) FROM usage_limits`
+	query := `
+		SELECT id, name, description, rate_limits, coalesce(max_upload_size, -1), coalesce(live_query_max_memory, -1),
+			coalesce(live_query_max_rows, -1), coalesce(live_query_timeout, -1)
+		FROM usage_limits`
 	rows, err := DB.Query(context.Background(), query)
 	if err != nil {
 		log.Printf("Database query failed: %v", err)
@@ -99,7 +132,8 @@ func GetUsageLimits() (usageLimits []UsageLimit, err error) {
 
 	for rows.Next() {
 		var u UsageLimit
-		err = rows.Scan(&u.ID, &u.Name, &u.Description, &u.RateLimits, &u.MaxUploadSize)
+		err = rows.Scan(&u.ID, &u.Name, &u.Description, &u.RateLimits, &u.MaxUploadSize, &u.LiveQueryMaxMemory,
+			&u.LiveQueryMaxRows, &u.LiveQueryTimeout)
 		if err != nil {
 			log.Printf("Error retrieving usage limits list: %v", err)
 			return
@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/sqlitebrowser/dbhub.io/common/config"
@@ -15,16 +17,17 @@ import (
 )
 
 type EventDetails struct {
-	DBName    string    `json:"database_name"`
-	DiscID    int       `json:"discussion_id"`
-	ID        string    `json:"event_id"`
-	Message   string    `json:"message"`
-	Owner     string    `json:"database_owner"`
-	Timestamp time.Time `json:"event_timestamp"`
-	Title     string    `json:"title"`
-	Type      EventType `json:"event_type"`
-	URL       string    `json:"event_url"`
-	UserName  string    `json:"username"`
+	DBName     string    `json:"database_name"`
+	DiscID     int       `json:"discussion_id"`
+	ID         string    `json:"event_id"`
+	Message    string    `json:"message"`
+	Owner      string    `json:"database_owner"`
+	Recipients []string  `json:"recipients,omitempty"`
+	Timestamp  time.Time `json:"event_timestamp"`
+	Title      string    `json:"title"`
+	Type       EventType `json:"event_type"`
+	URL        string    `json:"event_url"`
+	UserName   string    `json:"username"`
 }
 
 type EventType int
@@ -34,25 +37,36 @@ const (
 	EVENT_NEW_MERGE_REQUEST           = 1
 	EVENT_NEW_COMMENT                 = 2
 	EVENT_NEW_RELEASE                 = 3
+	EVENT_MENTION                     = 4
+	EVENT_ASSIGNED                    = 5
+	EVENT_REVIEW_REQUESTED            = 6
 )
 
 type StatusUpdateEntry struct {
-	DiscID int    `json:"discussion_id"`
-	Title  string `json:"title"`
-	URL    string `json:"event_url"`
+	Database  string    `json:"database"`
+	DiscID    int       `json:"discussion_id"`
+	ID        int64     `json:"id"`
+	Read      bool      `json:"read"`
+	Timestamp time.Time `json:"timestamp"`
+	Title     string    `json:"title"`
+	Type      EventType `json:"event_type"`
+	URL       string    `json:"event_url"`
 }
 
 type UserDetails struct {
-	AvatarURL     string
-	DateJoined    time.Time
-	DisplayName   string
-	Email         string
-	MinioBucket   string
-	Password      string
-	PVerify       string
-	Username      string
-	UsageLimitsId int
-	IsAdmin       bool
+	AvatarUploaded bool
+	AvatarURL      string
+	Bio            string
+	DateJoined     time.Time
+	DisplayName    string
+	Email          string
+	Links          []string
+	MinioBucket    string
+	Password       string
+	PVerify        string
+	Username       string
+	UsageLimitsId  int
+	IsAdmin        bool
 }
 
 // DefaultNumDisplayRows is the number of rows to display by default on the database page
@@ -178,10 +192,9 @@ func GetUsernameFromEmail(email string) (userName, avatarURL string, err error)
 		return
 	}
 
-	// If no avatar URL is presently stored, default to a gravatar based on the users email (if known)
+	// If no avatar URL is presently stored, use the default one
 	if !av.Valid {
-		picHash := md5.Sum([]byte(email))
-		avatarURL = fmt.Sprintf("https://www.gravatar.com/avatar/%x?d=identicon", picHash)
+		avatarURL = defaultAvatarURL(userName, email)
 	} else {
 		avatarURL = av.String
 	}
@@ -207,6 +220,23 @@ func PrefUserMaxRows(loggedInUser string) int {
 	return maxRows
 }
 
+// SetUserAdmin makes a user an instance admin, or removes that
+func SetUserAdmin(userName string, admin bool) error {
+	dbQuery := `
+		UPDATE users
+		SET is_admin = $2
+		WHERE lower(user_name) = lower($1)`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, userName, admin)
+	if err != nil {
+		log.Printf("Updating the admin flag failed for user '%s'. Error: '%v'", userName, err)
+		return err
+	}
+	if numRows := commandTag.RowsAffected(); numRows != 1 {
+		return fmt.Errorf("User '%s' not found", userName)
+	}
+	return nil
+}
+
 // SetUserLimits sets the user's usage limits to the provided configuration
 func SetUserLimits(userName string, usageLimitsId int) error {
 	dbQuery := `
@@ -243,37 +273,55 @@ func SetUserPreferences(userName string, maxRows int, displayName, email string)
 	return nil
 }
 
-// StatusUpdates returns the list of outstanding status updates for a user
-func StatusUpdates(loggedInUser string) (statusUpdates map[string][]StatusUpdateEntry, err error) {
+// SetUserProfile sets the details shown on the public profile of a user
+func SetUserProfile(userName, displayName, bio string, links []string) error {
+	if links == nil {
+		links = []string{}
+	}
 	dbQuery := `
-		SELECT status_updates
+		UPDATE users
+		SET display_name = $2, bio = $3, profile_links = $4
+		WHERE lower(user_name) = lower($1)`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, userName, displayName, bio, links)
+	if err != nil {
+		log.Printf("Updating the profile failed for user '%s'. Error: '%v'", userName, err)
+		return err
+	}
+	if numRows := commandTag.RowsAffected(); numRows != 1 {
+		log.Printf("Wrong # of rows (%v) affected when updating the profile. User: '%s'", numRows, userName)
+	}
+	return nil
+}
+
+// UserAvatar returns the ID of a user, and when they last uploaded their own avatar.  The upload date is nil when they
+// haven't, and the ID is 0 when there's no such user
+func UserAvatar(userName string) (userID int64, uploaded *time.Time, err error) {
+	dbQuery := `
+		SELECT user_id, avatar_uploaded
 		FROM users
-		WHERE user_name = $1`
-	err = DB.QueryRow(context.Background(), dbQuery, loggedInUser).Scan(&statusUpdates)
+		WHERE lower(user_name) = lower($1)`
+	err = DB.QueryRow(context.Background(), dbQuery, userName).Scan(&userID, &uploaded)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil, nil
+	}
 	if err != nil {
-		log.Printf("Error retrieving status updates list for user '%s': %v", loggedInUser, err)
-		return
+		log.Printf("Retrieving the avatar details of user '%s' failed: %v", userName, err)
 	}
 	return
 }
 
-// StoreStatusUpdates stores the status updates list for a user
-func StoreStatusUpdates(userName string, statusUpdates map[string][]StatusUpdateEntry) error {
+// UserAvatarSet records that a user uploaded their own avatar, which is served from the given URL.  When the URL is
+// empty, the user removed their avatar so they're given the default one again
+func UserAvatarSet(userName, avatarURL string) (err error) {
 	dbQuery := `
 		UPDATE users
-		SET status_updates = $2
-		WHERE user_name = $1`
-	commandTag, err := DB.Exec(context.Background(), dbQuery, userName, statusUpdates)
+		SET avatar_url = $2, avatar_uploaded = CASE WHEN $2::text IS NULL THEN NULL ELSE now() END
+		WHERE lower(user_name) = lower($1)`
+	_, err = DB.Exec(context.Background(), dbQuery, userName, pgtype.Text{String: avatarURL, Valid: avatarURL != ""})
 	if err != nil {
-		log.Printf("Adding status update for user '%s' failed: %v", userName, err)
-		return err
+		log.Printf("Updating the avatar of user '%s' failed: %v", userName, err)
 	}
-	if numRows := commandTag.RowsAffected(); numRows != 1 {
-		log.Printf("Wrong number of rows affected (%d) when storing status update for user '%s'", numRows,
-			userName)
-		return err
-	}
-	return nil
+	return
 }
 
 // UpdateAvatarURL updates the Avatar URL for a user
@@ -298,11 +346,13 @@ func UpdateAvatarURL(userName, avatarURL string) error {
 func User(userName string) (user UserDetails, err error) {
 	dbQuery := `
 		SELECT user_name, coalesce(display_name, ''), coalesce(email, ''), coalesce(avatar_url, ''),
-		       date_joined, coalesce(live_minio_bucket_name, ''), usage_limits_id, is_admin
+		       date_joined, coalesce(live_minio_bucket_name, ''), usage_limits_id, is_admin, bio, profile_links,
+		       avatar_uploaded IS NOT NULL
 		FROM users
 		WHERE lower(user_name) = lower($1)`
 	err = DB.QueryRow(context.Background(), dbQuery, userName).Scan(&user.Username, &user.DisplayName, &user.Email, &user.AvatarURL,
-		&user.DateJoined, &user.MinioBucket, &user.UsageLimitsId, &user.IsAdmin)
+		&user.DateJoined, &user.MinioBucket, &user.UsageLimitsId, &user.IsAdmin, &user.Bio, &user.Links,
+		&user.AvatarUploaded)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			// The error was just "no such user found"
@@ -316,11 +366,8 @@ func User(userName string) (user UserDetails, err error) {
 
 	// Determine an appropriate URL for the users' profile pic
 	if user.AvatarURL == "" {
-		// No avatar URL is presently stored, so default to a gravatar based on users email (if known)
-		if user.Email != "" {
-			picHash := md5.Sum([]byte(user.Email))
-			user.AvatarURL = fmt.Sprintf("https://www.gravatar.com/avatar/%x?d=identicon", picHash)
-		}
+		// No avatar URL is presently stored, so use the default one
+		user.AvatarURL = defaultAvatarURL(user.Username, user.Email)
 	}
 	return user, nil
 }
@@ -347,3 +394,29 @@ func UserNameFromAuth0ID(auth0id string) (string, error) {
 
 	return userName, nil
 }
+
+// AvatarURLSized returns an avatar URL asking for the avatar at the given size in pixels, so small avatars aren't
+// downloaded at full size.  Gravatar and the avatars served by the web UI both take the size as the "s" parameter
+func AvatarURLSized(avatarURL string, size int) string {
+	if avatarURL == "" {
+		return ""
+	}
+	sep := "?"
+	if strings.Contains(avatarURL, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf("%s%ss=%d", avatarURL, sep, size)
+}
+
+// defaultAvatarURL returns the avatar of users who haven't uploaded their own, and didn't get one from Auth0.  That's a
+// Gravatar based on their email address (if known), unless Gravatar is turned off.  Then it's an identicon generated by
+// the web UI
+func defaultAvatarURL(userName, email string) string {
+	if config.Conf.Avatars.DisableGravatar {
+		return fmt.Sprintf("https://%s/avatar/%s?v=0", config.Conf.Web.ServerName, url.PathEscape(userName))
+	}
+	if email == "" {
+		return ""
+	}
+	return fmt.Sprintf("https://www.gravatar.com/avatar/%x?d=identicon", md5.Sum([]byte(email)))
+}
@@ -0,0 +1,197 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	pgx "github.com/jackc/pgx/v5"
+)
+
+// ValidationRule is a check the owner of a database wants each new commit of it to pass.  Type is one of "assertion"
+// (an SQL query which returns no rows when the data is valid), "not_null" and "unique" (for a column of a table), or
+// "row_count" (for the number of rows in a table).  Commits failing a blocking rule aren't accepted
+type ValidationRule struct {
+	Blocking    bool      `json:"blocking"`
+	Column      string    `json:"column,omitempty"`
+	DateCreated time.Time `json:"date_created"`
+	MaxRows     *int64    `json:"max_rows,omitempty"`
+	MinRows     *int64    `json:"min_rows,omitempty"`
+	Name        string    `json:"name"`
+	SQL         string    `json:"sql,omitempty"`
+	Table       string    `json:"table,omitempty"`
+	Type        string    `json:"type"`
+}
+
+// ValidationRuleResult is the outcome of checking a commit against a single validation rule
+type ValidationRuleResult struct {
+	Blocking bool   `json:"blocking"`
+	Message  string `json:"message,omitempty"`
+	Name     string `json:"name"`
+	Passed   bool   `json:"passed"`
+}
+
+// ValidationResult is the outcome of checking a commit against the validation rules of a database
+type ValidationResult struct {
+	Commit      string                 `json:"commit"`
+	DateCreated time.Time              `json:"date_created"`
+	Passed      bool                   `json:"passed"`
+	Rules       []ValidationRuleResult `json:"rules"`
+}
+
+// ValidationResultFor returns the stored outcome of checking a commit against the validation rules of a database.  The
+// returned result is nil when the commit hasn't been checked
+func ValidationResultFor(dbOwner, dbName, commitID string) (result *ValidationResult, err error) {
+	dbQuery := `
+		SELECT r.commit_id, r.passed, r.results, r.date_created
+		FROM validation_results AS r
+			JOIN sqlite_databases AS db ON db.db_id = r.db_id
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false
+			AND r.commit_id = $3`
+	var z ValidationResult
+	err = DB.QueryRow(context.Background(), dbQuery, dbOwner, dbName, commitID).Scan(&z.Commit, &z.Passed, &z.Rules,
+		&z.DateCreated)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("Retrieving the validation result of commit '%s' of '%s/%s' failed: %v", commitID, dbOwner, dbName,
+			err)
+		return
+	}
+	return &z, nil
+}
+
+// ValidationResultSave stores the outcome of checking a commit against the validation rules of a database, replacing
+// any earlier outcome for the commit
+func ValidationResultSave(dbOwner, dbName string, result ValidationResult) (err error) {
+	dbQuery := `
+		INSERT INTO validation_results (db_id, commit_id, passed, results)
+		SELECT db.db_id, $3, $4, $5
+		FROM sqlite_databases AS db
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false
+		ON CONFLICT (db_id, commit_id)
+			DO UPDATE
+			SET passed = $4,
+				results = $5,
+				date_created = now()`
+	_, err = DB.Exec(context.Background(), dbQuery, dbOwner, dbName, result.Commit, result.Passed, result.Rules)
+	if err != nil {
+		log.Printf("Saving the validation result of commit '%s' of '%s/%s' failed: %v", result.Commit, dbOwner, dbName,
+			err)
+	}
+	return
+}
+
+// ValidationRuleDelete removes a validation rule from a database, returning whether it existed
+func ValidationRuleDelete(dbOwner, dbName, ruleName string) (exists bool, err error) {
+	dbQuery := `
+		DELETE FROM validation_rules
+		WHERE db_id = (
+				SELECT db_id
+				FROM sqlite_databases
+				WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+					AND db_name = $2
+					AND is_deleted = false
+			)
+			AND rule_name = $3`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, ruleName)
+	if err != nil {
+		log.Printf("Removing validation rule '%s' of '%s/%s' failed: %v", ruleName, dbOwner, dbName, err)
+		return
+	}
+	if commandTag.RowsAffected() == 0 {
+		return
+	}
+	return true, validationResultsClearUnmerged(dbOwner, dbName)
+}
+
+// ValidationRuleSave adds a validation rule to a database, or changes the existing rule with the same name
+func ValidationRuleSave(dbOwner, dbName string, rule ValidationRule) (err error) {
+	dbQuery := `
+		INSERT INTO validation_rules (db_id, rule_name, rule_type, table_name, column_name, sql, min_rows, max_rows,
+			blocking)
+		SELECT db.db_id, $3, $4, $5, $6, $7, $8, $9, $10
+		FROM sqlite_databases AS db
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false
+		ON CONFLICT (db_id, rule_name)
+			DO UPDATE
+			SET rule_type = $4,
+				table_name = $5,
+				column_name = $6,
+				sql = $7,
+				min_rows = $8,
+				max_rows = $9,
+				blocking = $10`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, rule.Name, rule.Type, rule.Table,
+		rule.Column, rule.SQL, rule.MinRows, rule.MaxRows, rule.Blocking)
+	if err != nil {
+		log.Printf("Saving validation rule '%s' of '%s/%s' failed: %v", rule.Name, dbOwner, dbName, err)
+		return
+	}
+	if commandTag.RowsAffected() != 1 {
+		return errors.New("Database not found")
+	}
+	return validationResultsClearUnmerged(dbOwner, dbName)
+}
+
+// ValidationRules returns the validation rules of a database, in name order
+func ValidationRules(dbOwner, dbName string) (list []ValidationRule, err error) {
+	dbQuery := `
+		SELECT r.rule_name, r.rule_type, r.table_name, r.column_name, r.sql, r.min_rows, r.max_rows, r.blocking,
+			r.date_created
+		FROM validation_rules AS r
+			JOIN sqlite_databases AS db ON db.db_id = r.db_id
+		WHERE db.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db.db_name = $2
+			AND db.is_deleted = false
+		ORDER BY r.rule_name`
+	rows, err := DB.Query(context.Background(), dbQuery, dbOwner, dbName)
+	if err != nil {
+		log.Printf("Retrieving the validation rules of '%s/%s' failed: %v", dbOwner, dbName, err)
+		return
+	}
+	list, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (r ValidationRule, err error) {
+		err = row.Scan(&r.Name, &r.Type, &r.Table, &r.Column, &r.SQL, &r.MinRows, &r.MaxRows, &r.Blocking,
+			&r.DateCreated)
+		return
+	})
+	if err != nil {
+		log.Printf("Retrieving the validation rules of '%s/%s' failed: %v", dbOwner, dbName, err)
+	}
+	return
+}
+
+// validationResultsClearUnmerged removes the stored validation results of a database for commits which aren't part of
+// it, such as the head commits of merge requests, so they're checked again against the changed rules
+func validationResultsClearUnmerged(dbOwner, dbName string) (err error) {
+	dbQuery := `
+		WITH d AS (
+			SELECT db_id
+			FROM sqlite_databases
+			WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+				AND db_name = $2
+				AND is_deleted = false
+		)
+		DELETE FROM validation_results AS r
+		USING d
+		WHERE r.db_id = d.db_id
+			AND NOT EXISTS (
+				SELECT 1
+				FROM commits AS c
+				WHERE c.db_id = r.db_id
+					AND c.commit_id = r.commit_id
+			)`
+	_, err = DB.Exec(context.Background(), dbQuery, dbOwner, dbName)
+	if err != nil {
+		log.Printf("Clearing the unmerged validation results of '%s/%s' failed: %v", dbOwner, dbName, err)
+	}
+	return
+}
@@ -16,6 +16,27 @@ type VisParamsV2 struct {
 	SQL         string `json:"sql"`
 	XAXisColumn string `json:"x_axis_label"`
 	YAXisColumn string `json:"y_axis_label"`
+
+	// Map visualisations place each row using either its latitude and longitude columns, or a column holding GeoJSON.
+	// The label column is shown when hovering over a row, and the tiles are the name of one of the tile providers
+	GeoJSONColumn string `json:"geojson_column,omitempty"`
+	LabelColumn   string `json:"label_column,omitempty"`
+	LatColumn     string `json:"lat_column,omitempty"`
+	LonColumn     string `json:"lon_column,omitempty"`
+	MapTiles      string `json:"map_tiles,omitempty"`
+
+	// Pivot tables summarise the query results, instead of plotting them
+	Pivot *VisPivot `json:"pivot,omitempty"`
+}
+
+// VisPivot holds the settings of a pivot table visualisation.  The rows of the query are grouped by the values of the
+// row field, and optionally the column field, then the value field of each group is summarised using the aggregate
+// function.  The grouping is done by SQLite, so large result sets don't need to be sent to the browser
+type VisPivot struct {
+	Aggregate string `json:"aggregate"`
+	Column    string `json:"column,omitempty"`
+	Row       string `json:"row"`
+	Value     string `json:"value,omitempty"`
 }
 
 // GetVisualisations returns the saved visualisations for a given database
@@ -151,3 +172,60 @@ func VisualisationSaveParams(dbOwner, dbName, visName string, visParams VisParam
 	}
 	return
 }
+
+// VisualisationIsPublic returns whether a saved visualisation has been marked as public.  Public visualisations
+// can be embedded by anyone, even when the database they're built from is private
+func VisualisationIsPublic(dbOwner, dbName, visName string) (public bool, err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+		)
+		SELECT public
+		FROM vis_params
+		WHERE user_id = (SELECT user_id FROM u) AND db_id = (SELECT db_id FROM d) AND name = $3`
+	err = DB.QueryRow(context.Background(), dbQuery, dbOwner, dbName, visName).Scan(&public)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// No visualisation with that name exists, so it can't be public
+			return false, nil
+		}
+		log.Printf("Checking if visualisation '%s' for database '%s/%s' is public failed: %v", visName,
+			dbOwner, dbName, err)
+		return
+	}
+	return
+}
+
+// VisualisationSetPublic changes the public status of an existing saved visualisation
+func VisualisationSetPublic(dbOwner, dbName, visName string, public bool) (err error) {
+	dbQuery := `
+		WITH u AS (
+			SELECT user_id
+			FROM users
+			WHERE lower(user_name) = lower($1)
+		), d AS (
+			SELECT db.db_id
+			FROM sqlite_databases AS db, u
+			WHERE db.user_id = u.user_id
+				AND db_name = $2
+		)
+		UPDATE vis_params SET public = $4 WHERE user_id = (SELECT user_id FROM u) AND db_id = (SELECT db_id FROM d) AND name = $3`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, dbOwner, dbName, visName, public)
+	if err != nil {
+		log.Printf("Changing public status of visualisation '%s' for database '%s/%s' failed: %v", visName,
+			dbOwner, dbName, err)
+		return err
+	}
+	if numRows := commandTag.RowsAffected(); numRows != 1 {
+		log.Printf("Wrong number of rows (%d) affected while changing public status of visualisation '%s' for database '%s/%s'",
+			numRows, visName, dbOwner, dbName)
+	}
+	return
+}
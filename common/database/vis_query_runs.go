@@ -4,23 +4,31 @@ import (
 	"context"
 	"encoding/base64"
 	"log"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-// LogSQLiteQueryAfter adds memory allocation stats for the execution run of a user supplied SQLite query
-func LogSQLiteQueryAfter(insertID, memUsed, memHighWater int64) (err error) {
+// LogSQLiteQueryAfter adds the resources used by the execution run of a user supplied SQLite query.  limitExceeded
+// holds the name of the limit which stopped the query, if one did
+func LogSQLiteQueryAfter(insertID, memUsed, memHighWater int64, duration time.Duration, rowsReturned int, limitExceeded string) (err error) {
+	var limit pgtype.Text
+	if limitExceeded != "" {
+		limit.String = limitExceeded
+		limit.Valid = true
+	}
 	dbQuery := `
 		UPDATE vis_query_runs
-		SET memory_used = $2, memory_high_water = $3
+		SET memory_used = $2, memory_high_water = $3, duration_ms = $4, rows_returned = $5, limit_exceeded = $6
 		WHERE query_run_id = $1`
-	commandTag, err := DB.Exec(context.Background(), dbQuery, insertID, memUsed, memHighWater)
+	commandTag, err := DB.Exec(context.Background(), dbQuery, insertID, memUsed, memHighWater,
+		duration.Milliseconds(), rowsReturned, limit)
 	if err != nil {
-		log.Printf("Adding memory stats for SQLite query run '%d' failed: %v", insertID, err)
+		log.Printf("Adding resource use stats for SQLite query run '%d' failed: %v", insertID, err)
 		return err
 	}
 	if numRows := commandTag.RowsAffected(); numRows != 1 {
-		log.Printf("Wrong number of rows (%d) affected while adding memory stats for SQLite query run '%d'",
+		log.Printf("Wrong number of rows (%d) affected while adding resource use stats for SQLite query run '%d'",
 			numRows, insertID)
 	}
 	return nil
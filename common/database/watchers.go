@@ -2,11 +2,32 @@ package database
 
 import (
 	"context"
+	"errors"
 	"log"
 
+	pgx "github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+// WatchMode is the type of activity on a database a watcher is notified about
+type WatchMode string
+
+const (
+	// WatchAll notifies the watcher about all activity on the database
+	WatchAll WatchMode = "all"
+
+	// WatchParticipating only notifies the watcher about discussions and merge requests they've created or commented on
+	WatchParticipating WatchMode = "participating"
+
+	// WatchReleases only notifies the watcher about new releases
+	WatchReleases WatchMode = "releases"
+)
+
+// Valid returns true if the watch mode is one of the known ones
+func (m WatchMode) Valid() bool {
+	return m == WatchAll || m == WatchParticipating || m == WatchReleases
+}
+
 // CheckDBWatched checks if a database is being watched by a given user.  The boolean return value is only valid when
 // err is nil
 func CheckDBWatched(loggedInUser, dbOwner, dbName string) (bool, error) {
@@ -44,6 +65,67 @@ func CheckDBWatched(loggedInUser, dbOwner, dbName string) (bool, error) {
 	return true, nil
 }
 
+// DBWatchMode returns the watch mode a user has for a database.  An empty string is returned if the user isn't
+// watching the database
+func DBWatchMode(loggedInUser, dbOwner, dbName string) (mode WatchMode, err error) {
+	dbQuery := `
+		SELECT w.watch_mode
+		FROM watchers AS w
+			JOIN sqlite_databases AS db ON db.db_id = w.db_id
+			JOIN users AS owner ON owner.user_id = db.user_id
+		WHERE w.user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND lower(owner.user_name) = lower($2)
+			AND db.db_name = $3
+			AND db.is_deleted = false`
+	err = DB.QueryRow(context.Background(), dbQuery, loggedInUser, dbOwner, dbName).Scan(&mode)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil
+		}
+		log.Printf("Error looking up watch mode for database. User: '%s' DB: '%s/%s'. Error: %v", loggedInUser,
+			dbOwner, dbName, err)
+	}
+	return
+}
+
+// SetDBWatchMode changes the watch mode a user has for a database, starting to watch the database if they aren't
+// already
+func SetDBWatchMode(loggedInUser, dbOwner, dbName string, mode WatchMode) error {
+	watched, err := CheckDBWatched(loggedInUser, dbOwner, dbName)
+	if err != nil {
+		return err
+	}
+	if !watched {
+		err = ToggleDBWatch(loggedInUser, dbOwner, dbName)
+		if err != nil {
+			return err
+		}
+	}
+
+	dbQuery := `
+		UPDATE watchers
+		SET watch_mode = $4
+		WHERE user_id = (SELECT user_id FROM users WHERE lower(user_name) = lower($1))
+			AND db_id = (
+				SELECT db.db_id
+				FROM sqlite_databases AS db
+					JOIN users AS owner ON owner.user_id = db.user_id
+				WHERE lower(owner.user_name) = lower($2)
+					AND db.db_name = $3
+					AND db.is_deleted = false
+			)`
+	commandTag, err := DB.Exec(context.Background(), dbQuery, loggedInUser, dbOwner, dbName, mode)
+	if err != nil {
+		log.Printf("Changing watch mode of '%s' for database '%s/%s' failed: %v", loggedInUser, dbOwner, dbName, err)
+		return err
+	}
+	if numRows := commandTag.RowsAffected(); numRows != 1 {
+		log.Printf("Wrong # of rows affected (%v) when changing watch mode of '%s' for database '%s/%s'", numRows,
+			loggedInUser, dbOwner, dbName)
+	}
+	return nil
+}
+
 // ToggleDBWatch toggles the watch status of a database by a user
 func ToggleDBWatch(loggedInUser, dbOwner, dbName string) error {
 	// Check if the database is already being watched
@@ -0,0 +1,424 @@
+package common
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	sqlite "github.com/gwenn/gosqlite"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// DataPackageMaxResources is the maximum number of resources (tables) accepted in an imported data package
+const DataPackageMaxResources = 100
+
+// dataPackageNameChars matches the characters which aren't allowed in data package and resource names
+var dataPackageNameChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// DataPackage is a Frictionless Data Package descriptor (datapackage.json), describing the tables of a database as CSV
+// resources.  See https://specs.frictionlessdata.io/data-package/
+type DataPackage struct {
+	Description string                `json:"description,omitempty"`
+	Homepage    string                `json:"homepage,omitempty"`
+	Licenses    []DataPackageLicence  `json:"licenses,omitempty"`
+	Name        string                `json:"name"`
+	Resources   []DataPackageResource `json:"resources"`
+	Title       string                `json:"title,omitempty"`
+	Version     string                `json:"version,omitempty"`
+}
+
+// DataPackageField is a column of a table in a data package
+type DataPackageField struct {
+	Constraints *DataPackageConstraints `json:"constraints,omitempty"`
+	Name        string                  `json:"name"`
+	Type        string                  `json:"type"`
+}
+
+// DataPackageConstraints holds the constraints on a column of a table in a data package
+type DataPackageConstraints struct {
+	Required bool `json:"required,omitempty"`
+}
+
+// DataPackageLicence is a licence in a data package
+type DataPackageLicence struct {
+	Name  string `json:"name,omitempty"`
+	Path  string `json:"path,omitempty"`
+	Title string `json:"title,omitempty"`
+}
+
+// DataPackageResource is a table in a data package, stored as a CSV file
+type DataPackageResource struct {
+	Encoding  string            `json:"encoding,omitempty"`
+	Format    string            `json:"format,omitempty"`
+	Mediatype string            `json:"mediatype,omitempty"`
+	Name      string            `json:"name"`
+	Path      string            `json:"path"`
+	Profile   string            `json:"profile,omitempty"`
+	Schema    DataPackageSchema `json:"schema"`
+	Title     string            `json:"title,omitempty"`
+}
+
+// DataPackageSchema is the Table Schema of a resource in a data package
+type DataPackageSchema struct {
+	Fields     []DataPackageField `json:"fields"`
+	PrimaryKey []string           `json:"primaryKey,omitempty"`
+}
+
+// DataPackageFor returns the data package descriptor of a database commit.  If no commit ID is given, the head commit
+// of the default branch is used
+func DataPackageFor(loggedInUser, dbOwner, dbName, commitID string) (pkg DataPackage, err error) {
+	sdb, pkg, err := openDataPackage(loggedInUser, dbOwner, dbName, commitID)
+	if err != nil {
+		return
+	}
+	sdb.Close()
+	return
+}
+
+// WriteDataPackage writes a zip file holding the data package descriptor of a database commit, along with a CSV file
+// for each of its tables
+func WriteDataPackage(w io.Writer, loggedInUser, dbOwner, dbName, commitID string) (err error) {
+	sdb, pkg, err := openDataPackage(loggedInUser, dbOwner, dbName, commitID)
+	if err != nil {
+		return
+	}
+	defer sdb.Close()
+
+	z := zip.NewWriter(w)
+	f, err := z.Create("datapackage.json")
+	if err != nil {
+		return
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(pkg)
+	if err != nil {
+		return
+	}
+
+	// Missing values are written as empty fields, which is the default way of marking them in data packages
+	for _, res := range pkg.Resources {
+		f, err = z.Create(res.Path)
+		if err != nil {
+			return
+		}
+		_, _, data, err := SQLiteRunQuery(sdb, QuerySourceAPI, "SELECT * FROM main."+EscapeId(res.Title), false, false)
+		if err != nil {
+			return err
+		}
+		c := csv.NewWriter(f)
+		err = c.Write(data.ColNames)
+		if err != nil {
+			return err
+		}
+		for _, row := range data.Records {
+			rec := make([]string, len(row))
+			for i, v := range row {
+				if v.Type != Null {
+					rec[i] = v.Value.(string)
+				}
+			}
+			err = c.Write(rec)
+			if err != nil {
+				return err
+			}
+		}
+		c.Flush()
+		if err = c.Error(); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+// ImportDataPackage creates a new SQLite database from a zip file holding a data package descriptor and its CSV
+// resources.  Each resource becomes a table, using its Table Schema for the column types and primary key.  The
+// uncompressed size of the files is limited to maxSize bytes, unless maxSize is -1.  The caller needs to remove the
+// returned temporary file when finished with it
+func ImportDataPackage(r io.ReaderAt, size, maxSize int64) (tempDB *os.File, pkg DataPackage, err error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, pkg, errors.New("The data package needs to be a zip file")
+	}
+	files := make(map[string]*zip.File)
+	var total uint64
+	for _, f := range z.File {
+		files[path.Clean(f.Name)] = f
+		total += f.UncompressedSize64
+	}
+	if maxSize != -1 && total > uint64(maxSize) {
+		return nil, pkg, fmt.Errorf("The data package is too large.  Its files can't add up to more than %d MB",
+			maxSize/1024/1024)
+	}
+
+	// Read the descriptor
+	f, ok := files["datapackage.json"]
+	if !ok {
+		return nil, pkg, errors.New("The zip file doesn't have a datapackage.json file")
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return
+	}
+	err = json.NewDecoder(rc).Decode(&pkg)
+	rc.Close()
+	if err != nil {
+		return nil, pkg, fmt.Errorf("The datapackage.json file couldn't be read: %s", err)
+	}
+	if len(pkg.Resources) == 0 || len(pkg.Resources) > DataPackageMaxResources {
+		return nil, pkg, fmt.Errorf("The data package needs to have between 1 and %d resources", DataPackageMaxResources)
+	}
+
+	// Create the new database
+	tempDB, err = os.CreateTemp(config.Conf.DiskCache.Directory, "dbhub-datapackage-*.db")
+	if err != nil {
+		return
+	}
+	err = func() (err error) {
+		sdb, err := sqlite.Open(tempDB.Name(), sqlite.OpenReadWrite|sqlite.OpenCreate)
+		if err != nil {
+			return
+		}
+		defer sdb.Close()
+		if err = sdb.EnableExtendedResultCodes(true); err != nil {
+			return
+		}
+		if err = sdb.Begin(); err != nil {
+			return
+		}
+		for _, res := range pkg.Resources {
+			f, ok := files[path.Clean(res.Path)]
+			if !ok || res.Path == "" || path.IsAbs(res.Path) || strings.HasPrefix(path.Clean(res.Path), "..") {
+				sdb.Rollback()
+				return fmt.Errorf("The file for resource '%s' isn't in the zip file", res.Name)
+			}
+			rc, err := f.Open()
+			if err != nil {
+				sdb.Rollback()
+				return err
+			}
+			err = importCSVTable(sdb, res, rc)
+			rc.Close()
+			if err != nil {
+				sdb.Rollback()
+				return fmt.Errorf("Importing resource '%s' failed: %s", res.Name, err)
+			}
+		}
+		return sdb.Commit()
+	}()
+	if err != nil {
+		tempDB.Close()
+		os.Remove(tempDB.Name())
+		return nil, pkg, err
+	}
+	return
+}
+
+// dataPackageName turns a table or database name into a valid data package or resource name
+func dataPackageName(name string) string {
+	n := strings.Trim(dataPackageNameChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if n == "" {
+		n = "data"
+	}
+	return n
+}
+
+// dataPackageType returns the Table Schema type for a declared SQLite column type, following the SQLite column
+// affinity rules, along with a few well known names for dates and booleans
+func dataPackageType(declared string) string {
+	t := strings.ToUpper(declared)
+	switch {
+	case strings.Contains(t, "BOOL"):
+		return "boolean"
+	case strings.Contains(t, "DATETIME"), strings.Contains(t, "TIMESTAMP"):
+		return "datetime"
+	case strings.Contains(t, "DATE"):
+		return "date"
+	case strings.Contains(t, "INT"):
+		return "integer"
+	case strings.Contains(t, "CHAR"), strings.Contains(t, "CLOB"), strings.Contains(t, "TEXT"):
+		return "string"
+	case t == "", strings.Contains(t, "BLOB"):
+		return "any"
+	default:
+		return "number"
+	}
+}
+
+// importCSVTable creates a table for a data package resource, and fills it from its CSV data.  The first line of the
+// data needs to hold the column names.  When the resource doesn't have a schema, the columns are created without a type
+func importCSVTable(sdb *sqlite.Conn, res DataPackageResource, r io.Reader) (err error) {
+	if err = ValidatePGTable(res.Name); err != nil {
+		return errors.New("Invalid resource name")
+	}
+	c := csv.NewReader(r)
+	header, err := c.Read()
+	if err != nil {
+		return
+	}
+	fields := res.Schema.Fields
+	if len(fields) == 0 {
+		for _, name := range header {
+			fields = append(fields, DataPackageField{Name: name})
+		}
+	}
+	c.FieldsPerRecord = len(fields)
+
+	// Create the table
+	var cols, params []string
+	for _, fld := range fields {
+		var colType string
+		switch fld.Type {
+		case "integer", "boolean", "year":
+			colType = "INTEGER"
+		case "number":
+			colType = "REAL"
+		case "string", "date", "datetime", "time":
+			colType = "TEXT"
+		}
+		col := strings.TrimSpace(EscapeId(fld.Name) + " " + colType)
+		if fld.Constraints != nil && fld.Constraints.Required {
+			col += " NOT NULL"
+		}
+		cols = append(cols, col)
+		params = append(params, "?")
+	}
+	if len(res.Schema.PrimaryKey) > 0 {
+		cols = append(cols, "PRIMARY KEY("+strings.Join(EscapeIds(res.Schema.PrimaryKey), ",")+")")
+	}
+	err = sdb.Exec("CREATE TABLE " + EscapeId(res.Name) + " (" + strings.Join(cols, ", ") + ")")
+	if err != nil {
+		return
+	}
+
+	// Add the rows.  Empty fields are missing values, so they're stored as NULL
+	stmt, err := sdb.Prepare("INSERT INTO " + EscapeId(res.Name) + " VALUES (" + strings.Join(params, ",") + ")")
+	if err != nil {
+		return
+	}
+	defer stmt.Finalize()
+	args := make([]interface{}, len(fields))
+	for {
+		rec, err := c.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		for i, v := range rec {
+			if v == "" {
+				args[i] = nil
+			} else {
+				args[i] = v
+			}
+		}
+		if err = stmt.Exec(args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openDataPackage opens a database commit and works out its data package descriptor
+func openDataPackage(loggedInUser, dbOwner, dbName, commitID string) (sdb *sqlite.Conn, pkg DataPackage, err error) {
+	var info database.SQLiteDBinfo
+	err = database.DBDetails(&info, loggedInUser, dbOwner, dbName, commitID)
+	if err != nil {
+		return
+	}
+	bucket, id, err := SQLiteLocation(dbOwner, dbName, info.Info.CommitID, loggedInUser)
+	if err != nil {
+		return
+	}
+	sdb, err = OpenSQLiteDatabase(bucket, id)
+	if err != nil {
+		return
+	}
+
+	pkg.Name = dataPackageName(strings.TrimSuffix(dbName, ".sqlite"))
+	pkg.Title = dbName
+	pkg.Description = info.Info.OneLineDesc
+	pkg.Homepage = info.Info.SourceURL
+	pkg.Version = info.Info.CommitID
+	if info.Info.Licence != "" && info.Info.Licence != "Not specified" {
+		lic := DataPackageLicence{Path: info.Info.LicenceURL, Title: info.Info.Licence}
+
+		// Licences are identified by their short name in data packages
+		var lics map[string]database.LicenceEntry
+		lics, err = database.GetLicences(dbOwner)
+		if err != nil {
+			sdb.Close()
+			return
+		}
+		for name, l := range lics {
+			if l.Sha256 == info.Info.DBEntry.LicenceSHA {
+				lic.Name = name
+			}
+		}
+		pkg.Licenses = []DataPackageLicence{lic}
+	}
+
+	// Add a resource for each table
+	tables, err := sdb.Tables("")
+	if err != nil {
+		sdb.Close()
+		return
+	}
+	used := make(map[string]bool)
+	for _, t := range tables {
+		var cols []sqlite.Column
+		cols, err = sdb.Columns("main", t)
+		if err != nil {
+			log.Printf("Retrieving the columns of table '%s' failed: %s", SanitiseLogString(t), err)
+			sdb.Close()
+			return
+		}
+
+		// Resource names need to be unique, so number any which end up the same after leaving out unsupported
+		// characters
+		name := dataPackageName(t)
+		for i := 2; used[name]; i++ {
+			name = fmt.Sprintf("%s-%d", dataPackageName(t), i)
+		}
+		used[name] = true
+
+		res := DataPackageResource{
+			Encoding:  "utf-8",
+			Format:    "csv",
+			Mediatype: "text/csv",
+			Name:      name,
+			Path:      "data/" + name + ".csv",
+			Profile:   "tabular-data-resource",
+			Title:     t,
+		}
+		pks := make(map[int]string)
+		for _, col := range cols {
+			fld := DataPackageField{Name: col.Name, Type: dataPackageType(col.DataType)}
+			if col.NotNull {
+				fld.Constraints = &DataPackageConstraints{Required: true}
+			}
+			res.Schema.Fields = append(res.Schema.Fields, fld)
+			if col.Pk > 0 {
+				pks[col.Pk] = col.Name
+			}
+		}
+		for i := 1; i <= len(pks); i++ {
+			res.Schema.PrimaryKey = append(res.Schema.PrimaryKey, pks[i])
+		}
+		pkg.Resources = append(pkg.Resources, res)
+	}
+	if pkg.Resources == nil {
+		pkg.Resources = []DataPackageResource{}
+	}
+	return
+}
@@ -77,11 +77,11 @@ type Diffs struct {
 // Diff generates the differences between the two commits commitA and commitB of the two databases specified in the other parameters
 func Diff(ownerA string, nameA string, commitA string, ownerB string, nameB string, commitB string, loggedInUser string, merge MergeStrategy, includeData bool) (Diffs, error) {
 	// Check if the user has access to the requested databases
-	bucketA, idA, _, err := MinioLocation(ownerA, nameA, commitA, loggedInUser)
+	bucketA, idA, err := SQLiteLocation(ownerA, nameA, commitA, loggedInUser)
 	if err != nil {
 		return Diffs{}, err
 	}
-	bucketB, idB, _, err := MinioLocation(ownerB, nameB, commitB, loggedInUser)
+	bucketB, idB, err := SQLiteLocation(ownerB, nameB, commitB, loggedInUser)
 	if err != nil {
 		return Diffs{}, err
 	}
@@ -125,25 +125,12 @@ func DBDiff(dbA string, dbB string, merge MergeStrategy, includeData bool) (Diff
 		return diff, nil
 	}
 
-	// Open the first SQLite database in read only mode
-	var sdb *sqlite.Conn
-	sdb, err := sqlite.Open(dbA, sqlite.OpenReadOnly)
+	// Open the first SQLite database, with the second one attached
+	sdb, err := openDiffDatabases(dbA, dbB)
 	if err != nil {
-		log.Printf("Couldn't open database in DBDiff(): %s", err)
 		return Diffs{}, err
 	}
 	defer sdb.Close()
-	if err = sdb.EnableExtendedResultCodes(true); err != nil {
-		log.Printf("Couldn't enable extended result codes in DBDiff(): %v", err.Error())
-		return Diffs{}, err
-	}
-
-	// Attach the second database
-	err = sdb.Exec("ATTACH '" + dbB + "' AS aux")
-	if err != nil {
-		log.Printf("Couldn't attach database in DBDiff(): %s", err)
-		return Diffs{}, err
-	}
 
 	// Get list of all objects in both databases, excluding virtual tables because they tend to be unpredictable
 	var stmt *sqlite.Stmt
@@ -191,6 +178,30 @@ func DBDiff(dbA string, dbB string, merge MergeStrategy, includeData bool) (Diff
 	return diff, nil
 }
 
+// openDiffDatabases opens the database file dbA in read only mode as the main schema, and attaches the database file
+// dbB as the aux schema
+func openDiffDatabases(dbA, dbB string) (sdb *sqlite.Conn, err error) {
+	sdb, err = sqlite.Open(dbA, sqlite.OpenReadOnly)
+	if err != nil {
+		log.Printf("Couldn't open database for diffing: %s", err)
+		return nil, err
+	}
+	if err = sdb.EnableExtendedResultCodes(true); err != nil {
+		log.Printf("Couldn't enable extended result codes for diffing: %v", err.Error())
+		sdb.Close()
+		return nil, err
+	}
+
+	// Attach the second database
+	err = sdb.Exec("ATTACH '" + dbB + "' AS aux")
+	if err != nil {
+		log.Printf("Couldn't attach database for diffing: %s", err)
+		sdb.Close()
+		return nil, err
+	}
+	return
+}
+
 // diffSingleObject compares the object with name objectName and of type objectType in the main and aux schemata of the connection sdb
 // and returns three values: a boolean to indicate whether there are differences, a DiffObjectChangeset object containing all the differences, and an optional error object
 func diffSingleObject(sdb *sqlite.Conn, objectName string, objectType string, merge MergeStrategy, includeData bool) (bool, DiffObjectChangeset, error) {
@@ -362,8 +373,8 @@ func dataDiffForAllTableRows(sdb *sqlite.Conn, schemaName string, tableName stri
 			}
 
 			// If we want to include a SQL statement for adding data and this is the regular
-			// data part, add this to the prepared INSERT statement
-			if includeSql && action == ActionAdd && i >= len(pk) {
+			// data part or an explicit primary key, add this to the prepared INSERT statement
+			if includeSql && action == ActionAdd && (i >= len(pk) || !implicitPk) {
 				d.Sql += EscapeValue(row[i]) + ","
 			}
 
@@ -396,7 +407,8 @@ func dataDiffForAllTableRows(sdb *sqlite.Conn, schemaName string, tableName stri
 
 // This helper function gets the differences between the two tables named tableName in the main and in the aux schema.
 // It then builds an array of DataDiff objects which represents these differences. This function assumes that the table
-// schemas match.
+// schemas match, apart from columns which only exist in the aux schema.  Those are compared using their default value,
+// which is what they'd hold after being added to the table in the main schema.
 func dataDiffForModifiedTableRows(sdb *sqlite.Conn, tableName string, merge MergeStrategy, includeData bool) (diff []DataDiff, err error) {
 	// Retrieve a list of all primary key columns and other columns in this table
 	pk, implicitPk, otherColumns, err := GetPrimaryKeyAndOtherColumns(sdb, "aux", tableName)
@@ -404,6 +416,29 @@ func dataDiffForModifiedTableRows(sdb *sqlite.Conn, tableName string, merge Merg
 		return nil, err
 	}
 
+	// Work out how to get the old value of each of the other columns
+	mainColumns, err := sdb.Columns("main", tableName)
+	if err != nil {
+		return nil, err
+	}
+	auxColumns, err := sdb.Columns("aux", tableName)
+	if err != nil {
+		return nil, err
+	}
+	oldValues := make([]string, 0, len(otherColumns))
+	for _, c := range otherColumns {
+		v := "A." + EscapeId(c)
+		if !hasColumn(mainColumns, c) {
+			v = "NULL"
+			for _, z := range auxColumns {
+				if strings.EqualFold(z.Name, c) && z.DfltValue != "" {
+					v = "(" + z.DfltValue + ")"
+				}
+			}
+		}
+		oldValues = append(oldValues, v)
+	}
+
 	// If we need to produce merge statements using the NewPkMerge strategy we need to know if we can rely on SQLite
 	// to generate new primary keys or if we must generate them on our own.
 	var incrementingPk bool
@@ -435,8 +470,8 @@ func dataDiffForModifiedTableRows(sdb *sqlite.Conn, tableName string, merge Merg
 			query += "B." + c + ","
 		}
 		query += "'" + string(ActionModify) + "'" // Updated row
-		for _, c := range otherEscaped {          // Other columns last
-			query += ",A." + c + ",B." + c
+		for i, c := range otherEscaped {          // Other columns last
+			query += "," + oldValues[i] + ",B." + c
 		}
 
 		query += " FROM main." + EscapeId(tableName) + " A, aux." + EscapeId(tableName) + " B WHERE "
@@ -446,8 +481,8 @@ func dataDiffForModifiedTableRows(sdb *sqlite.Conn, tableName string, merge Merg
 		}
 
 		query += "(" // And at least one of the other columns differs
-		for _, c := range otherEscaped {
-			query += "A." + c + " IS NOT B." + c + " OR "
+		for i, c := range otherEscaped {
+			query += oldValues[i] + " IS NOT B." + c + " OR "
 		}
 		query = strings.TrimSuffix(query, " OR ") + ")"
 
@@ -460,8 +495,8 @@ func dataDiffForModifiedTableRows(sdb *sqlite.Conn, tableName string, merge Merg
 		query += "A." + c + ","
 	}
 	query += "'" + string(ActionDelete) + "'" // Deleted row
-	for _, c := range otherEscaped {          // Other columns last
-		query += ",A." + c + ",NULL"
+	for i := range otherEscaped {             // Other columns last
+		query += "," + oldValues[i] + ",NULL"
 	}
 
 	query += " FROM main." + EscapeId(tableName) + " A WHERE "
@@ -728,3 +763,14 @@ func hasIncrementingIntPk(sdb *sqlite.Conn, schemaName string, tableName string)
 	}
 	return true, nil
 }
+
+// hasColumn returns whether a list of table columns includes one with the given name.  Column names are case
+// insensitive in SQLite
+func hasColumn(columns []sqlite.Column, name string) bool {
+	for _, c := range columns {
+		if strings.EqualFold(c.Name, name) {
+			return true
+		}
+	}
+	return false
+}
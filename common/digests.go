@@ -0,0 +1,208 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// How often the digest loop checks for users who are due a digest email
+const digestCheckInterval = time.Hour
+
+// DigestLoop periodically sends digest emails to the users who have chosen them, batching up the status updates
+// they've received since their last digest.  When ctx is cancelled the run in progress is finished off, then wg is
+// marked as done
+func DigestLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// Ensure a warning message is displayed on the console if the digest loop exits other than by shutting down
+	defer func() {
+		if ctx.Err() != nil {
+			log.Printf("%s: email digest loop stopped", config.Conf.Live.Nodename)
+			return
+		}
+		log.Printf("%s: WARN: Email digest loop exited", config.Conf.Live.Nodename)
+	}()
+
+	// When several nodes are running, only one of them sends the digests so they don't get sent twice
+	leader := database.NewLeader("email digests")
+	defer leader.Resign()
+
+	log.Printf("%s: email digest loop started.  %v refresh.", config.Conf.Live.Nodename, digestCheckInterval)
+	for {
+		if leader.IsLeader() {
+			err := sendDigests()
+			if err != nil {
+				log.Printf("Error when sending email digests: %v", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(digestCheckInterval):
+		}
+	}
+}
+
+// sendDigests queues a digest email for each user who is due one
+func sendDigests() error {
+	// Retrieve the users due a digest
+	type digestUser struct {
+		email      string
+		lastDigest pgtype.Timestamptz
+		prefs      database.NotificationPrefs
+		updates    map[string][]database.StatusUpdateEntry
+		userName   string
+	}
+	dbQuery := `
+		SELECT user_name, email, notification_prefs, last_digest
+		FROM users
+		WHERE email IS NOT NULL
+			AND coalesce((notification_prefs->>'email')::boolean, true) = true
+			AND (
+				(notification_prefs->>'digest' = 'daily' AND (last_digest IS NULL OR last_digest < now() - interval '1 day'))
+				OR (notification_prefs->>'digest' = 'weekly' AND (last_digest IS NULL OR last_digest < now() - interval '7 days'))
+			)`
+	rows, err := database.DB.Query(context.Background(), dbQuery)
+	if err != nil {
+		return err
+	}
+	var users []digestUser
+	for rows.Next() {
+		var u digestUser
+		var prefsData []byte
+		err = rows.Scan(&u.userName, &u.email, &prefsData, &u.lastDigest)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		u.prefs, err = database.ParseNotificationPrefs(prefsData)
+		if err != nil {
+			log.Printf("Error when parsing notification preferences for user '%v': %v", u.userName, err)
+			continue
+		}
+		users = append(users, u)
+	}
+	rows.Close()
+
+	// Skip email addresses of the form username@this_server, as they're non-functional
+	serverName := strings.Split(config.Conf.Web.ServerName, ":")
+
+	for _, u := range users {
+		// Work out the start of the period covered by this digest
+		period := 24 * time.Hour
+		if u.prefs.Digest == database.DigestWeekly {
+			period = 7 * 24 * time.Hour
+		}
+		since := time.Now().Add(-period)
+		if u.lastDigest.Valid {
+			since = u.lastDigest.Time
+		}
+
+		// Retrieve the unread status updates for the user
+		u.updates, err = database.StatusUpdates(u.userName)
+		if err != nil {
+			log.Printf("Error when retrieving status updates for user '%v': %v", u.userName, err)
+			continue
+		}
+
+		// Generate the digest, then add it to the email queue.  The time of the digest is recorded even when there's
+		// nothing to send, so the next one covers the period after it
+		subj, msg, numUpdates := digestMessage(u.prefs.Digest, u.updates, u.prefs, since)
+		tx, err := database.DB.Begin(context.Background())
+		if err != nil {
+			return err
+		}
+		if numUpdates > 0 && !strings.HasSuffix(u.email, serverName[0]) {
+			dbQuery = `
+				INSERT INTO email_queue (mail_to, subject, body)
+				VALUES ($1, $2, $3)`
+			_, err = tx.Exec(context.Background(), dbQuery, u.email, subj, msg)
+			if err != nil {
+				log.Printf("Adding digest email to the queue for user '%v' failed: %v", u.userName, err)
+				tx.Rollback(context.Background())
+				continue
+			}
+		}
+		dbQuery = `
+			UPDATE users
+			SET last_digest = now()
+			WHERE user_name = $1`
+		_, err = tx.Exec(context.Background(), dbQuery, u.userName)
+		if err != nil {
+			log.Printf("Updating the last digest time for user '%v' failed: %v", u.userName, err)
+			tx.Rollback(context.Background())
+			continue
+		}
+		err = tx.Commit(context.Background())
+		if err != nil {
+			log.Printf("Could not commit transaction when queuing digest for user '%v': %v", u.userName, err)
+		}
+	}
+	return nil
+}
+
+// digestMessage generates the subject and body of a digest email, with a section for each database.  Only the status
+// updates since the given time which the user wants to be notified about are included
+func digestMessage(mode database.DigestMode, updates map[string][]database.StatusUpdateEntry, prefs database.NotificationPrefs, since time.Time) (subj, msg string, numUpdates int) {
+	// Sort the databases, so the sections are in a predictable order
+	var dbList []string
+	for db := range updates {
+		dbList = append(dbList, db)
+	}
+	sort.Strings(dbList)
+
+	var body strings.Builder
+	for _, db := range dbList {
+		dbOwner, dbName, _ := strings.Cut(db, "/")
+		var section strings.Builder
+		for _, j := range updates[db] {
+			// Entries without a timestamp were created before digests existed, so are skipped
+			if j.Timestamp.IsZero() || !j.Timestamp.After(since) || !prefs.Wants(j.Type, dbOwner, dbName) {
+				continue
+			}
+			var kind string
+			switch j.Type {
+			case database.EVENT_NEW_DISCUSSION:
+				kind = "New discussion"
+			case database.EVENT_NEW_MERGE_REQUEST:
+				kind = "New merge request"
+			case database.EVENT_NEW_COMMENT:
+				kind = "New comment"
+			case database.EVENT_NEW_RELEASE:
+				kind = "New release"
+			case database.EVENT_MENTION:
+				kind = "Mentioned you"
+			case database.EVENT_ASSIGNED:
+				kind = "Assigned to you"
+			case database.EVENT_REVIEW_REQUESTED:
+				kind = "Review requested"
+			}
+			section.WriteString(fmt.Sprintf("  * %s: %s - https://%s%s\n", kind, j.Title, config.Conf.Web.ServerName,
+				j.URL))
+			numUpdates++
+		}
+		if section.Len() > 0 {
+			body.WriteString(fmt.Sprintf("%s\n%s\n", db, section.String()))
+		}
+	}
+
+	period := "daily"
+	if mode == database.DigestWeekly {
+		period = "weekly"
+	}
+	subj = fmt.Sprintf("DBHub.io: Your %s summary of %d update(s)", period, numUpdates)
+	msg = fmt.Sprintf("Here's your %s summary of activity on the databases you're watching.\n\n%s"+
+		"Visit https://%s/updates/ for the details, or https://%s/pref to change how often these are sent.", period,
+		body.String(), config.Conf.Web.ServerName, config.Conf.Web.ServerName)
+	return
+}
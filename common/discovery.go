@@ -0,0 +1,194 @@
+package common
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+const (
+	// The most URLs the sitemap protocol allows in each sitemap file
+	sitemapPageSize = 50000
+
+	// How often the sitemap is regenerated
+	sitemapRefreshInterval = time.Hour
+)
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	XMLNS    string       `xml:"xmlns,attr"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+// DatasetJSONLD returns the schema.org Dataset description of a database, for including in its page as JSON-LD so
+// search engines (including Google Dataset Search) can find it
+func DatasetJSONLD(db database.SQLiteDBinfo) map[string]interface{} {
+	base := "https://" + config.Conf.Web.ServerName
+	dbURL := fmt.Sprintf("%s/%s/%s", base, url.PathEscape(db.Info.Owner), url.PathEscape(db.Info.Database))
+
+	// Search engines require a description, so fall back to a generic one when the database doesn't have one
+	desc := db.Info.OneLineDesc
+	if desc == "" && db.Info.FullDesc != "" && db.Info.FullDesc != "No full description" {
+		desc = db.Info.FullDesc
+		if r := []rune(desc); len(r) > 5000 {
+			desc = string(r[:5000])
+		}
+	}
+	if desc == "" {
+		desc = fmt.Sprintf("The %s SQLite database from %s, hosted on DBHub.io", db.Info.Database, db.Info.Owner)
+	}
+
+	d := map[string]interface{}{
+		"@context": "https://schema.org",
+		"@type":    "Dataset",
+		"creator": map[string]interface{}{
+			"@type": "Person",
+			"name":  db.Info.Owner,
+			"url":   base + "/" + url.PathEscape(db.Info.Owner),
+		},
+		"dateCreated":  db.Info.DateCreated.UTC().Format(time.RFC3339),
+		"dateModified": db.Info.RepoModified.UTC().Format(time.RFC3339),
+		"description":  desc,
+		"includedInDataCatalog": map[string]interface{}{
+			"@type": "DataCatalog",
+			"name":  "DBHub.io",
+			"url":   base,
+		},
+		"isAccessibleForFree": true,
+		"name":                db.Info.Database,
+		"url":                 dbURL,
+	}
+	if db.Info.LicenceURL != "" {
+		d["license"] = db.Info.LicenceURL
+	}
+	if db.Info.SourceURL != "" {
+		d["isBasedOn"] = db.Info.SourceURL
+	}
+
+	// Databases encrypted by their owner can be downloaded, but aren't usable as SQLite databases without the key
+	if !db.Info.ClientEncrypted {
+		d["distribution"] = []map[string]interface{}{{
+			"@type":          "DataDownload",
+			"contentUrl":     fmt.Sprintf("%s/x/download/%s/%s", base, url.PathEscape(db.Info.Owner), url.PathEscape(db.Info.Database)),
+			"encodingFormat": "application/vnd.sqlite3",
+		}}
+	}
+	return d
+}
+
+// Sitemap returns the sitemap index, which lists the pages of the sitemap.  It returns false if the sitemap hasn't been
+// generated yet, or can't be retrieved
+func Sitemap() ([]byte, bool) {
+	index, ok, err := database.SitemapGet(0)
+	return index, ok && err == nil
+}
+
+// SitemapLoop periodically regenerates the sitemap of the public databases.  The sitemap is stored in PostgreSQL, so only
+// one node needs to generate it for all of them to serve it.  When ctx is cancelled the loop stops once the run in
+// progress is done, then wg is marked as done
+func SitemapLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// Ensure a warning message is displayed on the console if the sitemap loop exits other than by shutting down
+	defer func() {
+		if ctx.Err() != nil {
+			log.Printf("%s: sitemap loop stopped", config.Conf.Live.Nodename)
+			return
+		}
+		log.Printf("%s: WARN: Sitemap loop exited", config.Conf.Live.Nodename)
+	}()
+
+	// When several nodes are running, only one of them generates the sitemap
+	leader := database.NewLeader("sitemap")
+	defer leader.Resign()
+
+	log.Printf("%s: sitemap refresh loop started.  %v refresh.", config.Conf.Live.Nodename, sitemapRefreshInterval)
+	for {
+		if leader.IsLeader() {
+			err := refreshSitemap()
+			if err != nil {
+				log.Printf("Error when refreshing the sitemap: %v", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(sitemapRefreshInterval):
+		}
+	}
+}
+
+// SitemapPage returns a page of the sitemap, numbered from 1.  It returns false if there isn't a page with that number
+func SitemapPage(n int) ([]byte, bool) {
+	if n < 1 {
+		return nil, false
+	}
+	page, ok, err := database.SitemapGet(n)
+	return page, ok && err == nil
+}
+
+// refreshSitemap generates the sitemap from the current list of public databases
+func refreshSitemap() error {
+	list, err := database.SitemapDatabases()
+	if err != nil {
+		return err
+	}
+	base := "https://" + config.Conf.Web.ServerName
+	urls := []sitemapURL{{Loc: base + "/"}, {Loc: base + "/about"}}
+	for _, e := range list {
+		urls = append(urls, sitemapURL{
+			Loc:     fmt.Sprintf("%s/%s/%s", base, url.PathEscape(e.Owner), url.PathEscape(e.DBName)),
+			LastMod: e.LastModified.UTC().Format("2006-01-02"),
+		})
+	}
+
+	// Split the URLs into pages, noting the most recent change in each one for the index
+	const xmlns = "http://www.sitemaps.org/schemas/sitemap/0.9"
+	idx := sitemapIndex{XMLNS: xmlns}
+	var pages [][]byte
+	for start := 0; start < len(urls); start += sitemapPageSize {
+		end := start + sitemapPageSize
+		if end > len(urls) {
+			end = len(urls)
+		}
+		var lastMod string
+		for _, u := range urls[start:end] {
+			if u.LastMod > lastMod {
+				lastMod = u.LastMod
+			}
+		}
+		page, err := xml.Marshal(sitemapURLSet{XMLNS: xmlns, URLs: urls[start:end]})
+		if err != nil {
+			return err
+		}
+		pages = append(pages, append([]byte(xml.Header), page...))
+		idx.Sitemaps = append(idx.Sitemaps, sitemapURL{
+			Loc:     fmt.Sprintf("%s/sitemap/%d.xml", base, len(pages)),
+			LastMod: lastMod,
+		})
+	}
+	index, err := xml.Marshal(idx)
+	if err != nil {
+		return err
+	}
+
+	return database.SitemapSave(append([]byte(xml.Header), index...), pages)
+}
@@ -0,0 +1,247 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// DOIProvider registers DOIs for database releases.  DataCite and Zenodo are supported, depending on the configuration
+type DOIProvider interface {
+	// Mint registers a DOI for a release of a database, returning the new DOI
+	Mint(cit ReleaseCitation, dbOwner, dbName string) (string, error)
+}
+
+// DOIEnabled returns whether DOIs can be minted on this server
+func DOIEnabled() bool {
+	return config.Conf.DOI.Provider != ""
+}
+
+// MintReleaseDOI registers a DOI for a release of a public database, and stores it with the release.  Releases only get
+// one DOI, so they can't be minted again
+func MintReleaseDOI(loggedInUser, dbOwner, dbName, releaseName string) (doi string, err error) {
+	p, err := doiProvider()
+	if err != nil {
+		return
+	}
+	cit, db, err := releaseCitation(loggedInUser, dbOwner, dbName, releaseName)
+	if err != nil {
+		return
+	}
+	if cit.DOI != "" {
+		return "", fmt.Errorf("This release already has the DOI '%s'", cit.DOI)
+	}
+	if !db.Info.Public {
+		return "", errors.New("DOIs can only be minted for public databases")
+	}
+
+	doi, err = p.Mint(cit, dbOwner, dbName)
+	if err != nil {
+		return "", fmt.Errorf("Minting the DOI failed: %v", err)
+	}
+
+	// Save the DOI with the release
+	releases, err := database.GetReleases(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	rel, ok := releases[releaseName]
+	if !ok {
+		return "", fmt.Errorf("Release '%s' was removed while its DOI was being minted.  The DOI is '%s'",
+			releaseName, doi)
+	}
+	rel.DOI = doi
+	releases[releaseName] = rel
+	err = database.StoreReleases(dbOwner, dbName, releases)
+	return
+}
+
+// doiProvider returns the provider used for minting DOIs
+func doiProvider() (DOIProvider, error) {
+	c := config.Conf.DOI
+	client := &http.Client{Timeout: 10 * time.Minute} // Zenodo needs the database file uploaded
+	switch c.Provider {
+	case "":
+		return nil, errors.New("DOIs can't be minted on this server")
+	case "datacite":
+		return &dataCiteDOIProvider{client: client, conf: c}, nil
+	case "zenodo":
+		return &zenodoDOIProvider{client: client, conf: c}, nil
+	default:
+		return nil, fmt.Errorf("%s: unknown DOI provider '%s'", config.Conf.Live.Nodename, c.Provider)
+	}
+}
+
+// doiRequest sends a request to the API of a DOI provider, decoding the JSON response into resp
+func doiRequest(client *http.Client, r *http.Request, resp interface{}) error {
+	res, err := client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("%s returned status %d: %s", r.URL.Host, res.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	if resp == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(resp)
+}
+
+// dataCiteDOIProvider is the DOIProvider implementation for DataCite, which only needs the metadata of a release
+type dataCiteDOIProvider struct {
+	client *http.Client
+	conf   config.DOIConfig
+}
+
+func (p *dataCiteDOIProvider) Mint(cit ReleaseCitation, dbOwner, dbName string) (string, error) {
+	d := cit.DataCite()
+	d.Data.Attributes.Event = "publish"
+	d.Data.Attributes.Prefix = p.conf.Prefix
+	payload, err := json.Marshal(d)
+	if err != nil {
+		return "", err
+	}
+	r, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(p.conf.APIURL, "/")+"/dois", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	r.Header.Set("Content-Type", "application/vnd.api+json")
+	r.SetBasicAuth(p.conf.Username, p.conf.Password)
+	var resp DataCiteDOI
+	err = doiRequest(p.client, r, &resp)
+	if err != nil {
+		return "", err
+	}
+	if resp.Data.ID == "" {
+		return "", errors.New("DataCite didn't return the new DOI")
+	}
+	return resp.Data.ID, nil
+}
+
+// zenodoDOIProvider is the DOIProvider implementation for Zenodo.  Zenodo only publishes records with files, so the
+// database file of the release is deposited along with the metadata
+type zenodoDOIProvider struct {
+	client *http.Client
+	conf   config.DOIConfig
+}
+
+func (p *zenodoDOIProvider) Mint(cit ReleaseCitation, dbOwner, dbName string) (string, error) {
+	api := strings.TrimSuffix(p.conf.APIURL, "/")
+
+	// Create the deposition with the metadata of the release
+	type creator struct {
+		Name string `json:"name"`
+	}
+	var meta struct {
+		Metadata struct {
+			AccessRight     string    `json:"access_right"`
+			Creators        []creator `json:"creators"`
+			Description     string    `json:"description"`
+			License         string    `json:"license,omitempty"`
+			PublicationDate string    `json:"publication_date"`
+			Title           string    `json:"title"`
+			UploadType      string    `json:"upload_type"`
+			Version         string    `json:"version"`
+		} `json:"metadata"`
+	}
+	m := &meta.Metadata
+	m.AccessRight = "open"
+	for _, a := range cit.Authors {
+		m.Creators = append(m.Creators, creator{Name: a})
+	}
+	m.Description = cit.Description
+	if m.Description == "" {
+		m.Description = cit.Title // Zenodo requires a description
+	}
+	if spdx, ok := spdxLicences[cit.Licence]; ok {
+		m.License = strings.ToLower(spdx)
+	}
+	m.PublicationDate = cit.DateReleased.UTC().Format("2006-01-02")
+	m.Title = cit.Title
+	m.UploadType = "dataset"
+	m.Version = cit.Release
+	payload, err := json.Marshal(meta)
+	if err != nil {
+		return "", err
+	}
+	r, err := p.newRequest(http.MethodPost, api+"/deposit/depositions", bytes.NewReader(payload))
+	if err != nil {
+		return "", err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	var dep struct {
+		ID    int64 `json:"id"`
+		Links struct {
+			Bucket string `json:"bucket"`
+		} `json:"links"`
+	}
+	err = doiRequest(p.client, r, &dep)
+	if err != nil {
+		return "", err
+	}
+
+	// Upload the database file
+	bucket, id, _, err := MinioLocation(dbOwner, dbName, cit.Commit, "")
+	if err != nil {
+		return "", err
+	}
+	obj, err := MinioHandle(bucket, id)
+	if err != nil {
+		return "", err
+	}
+	defer MinioHandleClose(obj)
+	size, err := obj.Size()
+	if err != nil {
+		return "", err
+	}
+
+	// The object handle is closed by the deferred call above, rather than by the HTTP client
+	r, err = p.newRequest(http.MethodPut, dep.Links.Bucket+"/"+url.PathEscape(dbName), io.NopCloser(obj))
+	if err != nil {
+		return "", err
+	}
+	r.ContentLength = size
+	r.Header.Set("Content-Type", "application/octet-stream")
+	err = doiRequest(p.client, r, nil)
+	if err != nil {
+		return "", err
+	}
+
+	// Publish the deposition, which registers its DOI
+	r, err = p.newRequest(http.MethodPost, fmt.Sprintf("%s/deposit/depositions/%d/actions/publish", api, dep.ID), nil)
+	if err != nil {
+		return "", err
+	}
+	var pub struct {
+		DOI string `json:"doi"`
+	}
+	err = doiRequest(p.client, r, &pub)
+	if err != nil {
+		return "", err
+	}
+	if pub.DOI == "" {
+		return "", errors.New("Zenodo didn't return the new DOI")
+	}
+	return pub.DOI, nil
+}
+
+// newRequest returns a request to the Zenodo API, authenticated with the configured access token
+func (p *zenodoDOIProvider) newRequest(method, u string, body io.Reader) (*http.Request, error) {
+	r, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Authorization", "Bearer "+p.conf.Token)
+	return r, nil
+}
@@ -0,0 +1,391 @@
+package common
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+
+	"github.com/smtp2go-oss/smtp2go-go"
+)
+
+var (
+	// emailBounceHooks are the functions called for each bounce notification received from the email backend
+	emailBounceHooks = []func(EmailBounce){disableBouncedEmail}
+
+	// emailHTMLTemplate is used for generating the HTML version of emails from their plain text body
+	emailHTMLTemplate = template.Must(template.New("email").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{ .Subject }}</title></head>
+<body style="font-family: sans-serif; font-size: 14px; color: #333;">
+<p>{{ .Body }}</p>
+<hr style="border: none; border-top: 1px solid #ddd;">
+<p style="font-size: 12px; color: #777;">You can change which emails you receive from <a href="https://{{ .ServerName }}/pref">your preferences page</a>.</p>
+</body>
+</html>
+`))
+
+	// emailURLs matches the web addresses in the plain text body of emails, so they can be turned into links
+	emailURLs = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+	// HTTP client used for the email backend APIs
+	emailHTTPClient = &http.Client{Timeout: 30 * time.Second}
+)
+
+// EmailBounce holds the details of a bounced email
+type EmailBounce struct {
+	Address   string
+	Permanent bool
+	Reason    string
+}
+
+// EmailMessage holds the details of an outgoing email
+type EmailMessage struct {
+	HTMLBody string
+	Subject  string
+	TextBody string
+	To       string
+}
+
+// EmailSender is implemented by each of the backends used for sending emails
+type EmailSender interface {
+	Send(msg EmailMessage) error
+}
+
+// EmailBounceParser is implemented by email backends which can report bounced emails via a webhook.  It extracts the
+// bounce details from an incoming webhook request
+type EmailBounceParser interface {
+	ParseBounces(r *http.Request) ([]EmailBounce, error)
+}
+
+// AddEmailBounceHook adds a function to be called for each bounced email
+func AddEmailBounceHook(hook func(EmailBounce)) {
+	emailBounceHooks = append(emailBounceHooks, hook)
+}
+
+// HandleEmailBounces passes the details of bounced emails to each of the bounce hooks
+func HandleEmailBounces(bounces []EmailBounce) {
+	for _, b := range bounces {
+		log.Printf("Email to '%s' bounced (permanent: %v): %s", SanitiseLogString(b.Address), b.Permanent,
+			SanitiseLogString(b.Reason))
+		for _, hook := range emailBounceHooks {
+			hook(b)
+		}
+	}
+}
+
+// disableBouncedEmail turns off notification emails for users whose email address permanently bounces
+func disableBouncedEmail(b EmailBounce) {
+	if !b.Permanent {
+		return
+	}
+	err := database.DisableNotificationEmails(b.Address)
+	if err != nil {
+		log.Printf("Error when disabling notification emails for bounced address '%s': %v",
+			SanitiseLogString(b.Address), err)
+	}
+}
+
+// EmailHTML generates the HTML version of an email from its plain text body
+func EmailHTML(subject, textBody string) (string, error) {
+	// Escape the text, then turn the web addresses into links and the line breaks into HTML ones
+	body := template.HTMLEscapeString(textBody)
+	body = emailURLs.ReplaceAllStringFunc(body, func(u string) string {
+		return fmt.Sprintf(`<a href="%s">%s</a>`, u, u)
+	})
+	body = strings.ReplaceAll(body, "\n", "<br>\n")
+
+	var buf bytes.Buffer
+	err := emailHTMLTemplate.Execute(&buf, struct {
+		Body       template.HTML
+		ServerName string
+		Subject    string
+	}{
+		Body:       template.HTML(body),
+		ServerName: config.Conf.Web.ServerName,
+		Subject:    subject,
+	})
+	return buf.String(), err
+}
+
+// NewEmailSender returns the email backend chosen in the configuration file
+func NewEmailSender() (EmailSender, error) {
+	c := config.Conf.Event
+	switch c.EmailBackend {
+	case "smtp2go":
+		if c.Smtp2GoKey == "" && os.Getenv("SMTP2GO_API_KEY") == "" {
+			return nil, errors.New("SMTP2Go API key isn't set")
+		}
+		return smtp2goSender{}, nil
+	case "smtp":
+		if c.SmtpHost == "" {
+			return nil, errors.New("SMTP host isn't set")
+		}
+		return smtpSender{}, nil
+	case "ses":
+		if c.SesRegion == "" || c.SesAccessKey == "" || c.SesSecretKey == "" {
+			return nil, errors.New("Amazon SES region and access keys need to be set")
+		}
+		return sesSender{}, nil
+	case "mailgun":
+		if c.MailgunDomain == "" || c.MailgunKey == "" {
+			return nil, errors.New("Mailgun domain and API key need to be set")
+		}
+		return mailgunSender{}, nil
+	}
+	return nil, fmt.Errorf("Unknown email backend '%s'", c.EmailBackend)
+}
+
+// smtp2goSender sends emails using the SMTP2Go API
+type smtp2goSender struct{}
+
+func (smtp2goSender) Send(msg EmailMessage) error {
+	e := smtp2go.Email{
+		From:     config.Conf.Event.EmailFrom,
+		To:       []string{msg.To},
+		Subject:  msg.Subject,
+		TextBody: msg.TextBody,
+		HtmlBody: msg.HTMLBody,
+	}
+	_, err := smtp2go.Send(&e)
+	return err
+}
+
+// smtpSender sends emails through a standard SMTP server
+type smtpSender struct{}
+
+func (smtpSender) Send(msg EmailMessage) error {
+	c := config.Conf.Event
+
+	// Assemble the message, with both the plain text and HTML versions of the body
+	var body bytes.Buffer
+	mp := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", msg.TextBody},
+		{"text/html; charset=utf-8", msg.HTMLBody},
+	} {
+		w, err := mp.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(w, part.content); err != nil {
+			return err
+		}
+	}
+	if err := mp.Close(); err != nil {
+		return err
+	}
+
+	var data bytes.Buffer
+	fmt.Fprintf(&data, "From: %s\r\n", c.EmailFrom)
+	fmt.Fprintf(&data, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&data, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&data, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprint(&data, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&data, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", mp.Boundary())
+	data.Write(body.Bytes())
+
+	var auth smtp.Auth
+	if c.SmtpUsername != "" {
+		auth = smtp.PlainAuth("", c.SmtpUsername, c.SmtpPassword, c.SmtpHost)
+	}
+	return smtp.SendMail(fmt.Sprintf("%s:%d", c.SmtpHost, c.SmtpPort), auth, c.EmailFrom, []string{msg.To},
+		data.Bytes())
+}
+
+// sesSender sends emails using the Amazon SES (v2) API
+type sesSender struct{}
+
+func (sesSender) Send(msg EmailMessage) error {
+	c := config.Conf.Event
+
+	// Assemble the request
+	type sesContent struct {
+		Data string `json:"Data"`
+	}
+	var req struct {
+		Content struct {
+			Simple struct {
+				Body struct {
+					Html sesContent `json:"Html"`
+					Text sesContent `json:"Text"`
+				} `json:"Body"`
+				Subject sesContent `json:"Subject"`
+			} `json:"Simple"`
+		} `json:"Content"`
+		Destination struct {
+			ToAddresses []string `json:"ToAddresses"`
+		} `json:"Destination"`
+		FromEmailAddress string `json:"FromEmailAddress"`
+	}
+	req.Content.Simple.Body.Html.Data = msg.HTMLBody
+	req.Content.Simple.Body.Text.Data = msg.TextBody
+	req.Content.Simple.Subject.Data = msg.Subject
+	req.Destination.ToAddresses = []string{msg.To}
+	req.FromEmailAddress = c.EmailFrom
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	// Sign the request using AWS signature version 4
+	host := fmt.Sprintf("email.%s.amazonaws.com", c.SesRegion)
+	path := "/v2/email/outbound-emails"
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256.Sum256(payload)
+	signedHeaders := "content-type;host;x-amz-date"
+	canonicalRequest := fmt.Sprintf("POST\n%s\n\ncontent-type:application/json\nhost:%s\nx-amz-date:%s\n\n%s\n%s", path,
+		host, amzDate, signedHeaders, hex.EncodeToString(payloadHash[:]))
+	scope := fmt.Sprintf("%s/%s/ses/aws4_request", day, c.SesRegion)
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := fmt.Sprintf("AWS4-HMAC-SHA256\n%s\n%s\n%s", amzDate, scope, hex.EncodeToString(requestHash[:]))
+	key := []byte("AWS4" + c.SesSecretKey)
+	for _, k := range []string{day, c.SesRegion, "ses", "aws4_request"} {
+		key = emailHMAC(key, k)
+	}
+	signature := hex.EncodeToString(emailHMAC(key, stringToSign))
+
+	// Send the request
+	r, err := http.NewRequest(http.MethodPost, "https://"+host+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Amz-Date", amzDate)
+	r.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.SesAccessKey, scope, signedHeaders, signature))
+	return emailSendRequest(r)
+}
+
+// ParseBounces extracts the bounced emails from an Amazon SNS notification
+func (sesSender) ParseBounces(r *http.Request) (bounces []EmailBounce, err error) {
+	var notification struct {
+		Message      string `json:"Message"`
+		SubscribeURL string `json:"SubscribeURL"`
+		Type         string `json:"Type"`
+	}
+	err = json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&notification)
+	if err != nil {
+		return
+	}
+
+	// New SNS subscriptions need to be confirmed by visiting the given URL, which is left for an administrator to do
+	if notification.Type == "SubscriptionConfirmation" {
+		log.Printf("Amazon SNS subscription for email bounces needs confirming.  Visit: %s",
+			SanitiseLogString(notification.SubscribeURL))
+		return
+	}
+
+	var msg struct {
+		Bounce struct {
+			BounceType        string `json:"bounceType"`
+			BouncedRecipients []struct {
+				DiagnosticCode string `json:"diagnosticCode"`
+				EmailAddress   string `json:"emailAddress"`
+			} `json:"bouncedRecipients"`
+		} `json:"bounce"`
+		NotificationType string `json:"notificationType"`
+	}
+	err = json.Unmarshal([]byte(notification.Message), &msg)
+	if err != nil || msg.NotificationType != "Bounce" {
+		return
+	}
+	for _, j := range msg.Bounce.BouncedRecipients {
+		bounces = append(bounces, EmailBounce{
+			Address:   j.EmailAddress,
+			Permanent: msg.Bounce.BounceType == "Permanent",
+			Reason:    j.DiagnosticCode,
+		})
+	}
+	return
+}
+
+// mailgunSender sends emails using the Mailgun API
+type mailgunSender struct{}
+
+func (mailgunSender) Send(msg EmailMessage) error {
+	c := config.Conf.Event
+	form := url.Values{}
+	form.Set("from", c.EmailFrom)
+	form.Set("to", msg.To)
+	form.Set("subject", msg.Subject)
+	form.Set("text", msg.TextBody)
+	form.Set("html", msg.HTMLBody)
+	r, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/%s/messages", strings.TrimSuffix(c.MailgunAPIBase, "/"),
+		url.PathEscape(c.MailgunDomain)), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.SetBasicAuth("api", c.MailgunKey)
+	return emailSendRequest(r)
+}
+
+// ParseBounces extracts the bounced email from a Mailgun webhook notification
+func (mailgunSender) ParseBounces(r *http.Request) (bounces []EmailBounce, err error) {
+	var notification struct {
+		EventData struct {
+			DeliveryStatus struct {
+				Message string `json:"message"`
+			} `json:"delivery-status"`
+			Event     string `json:"event"`
+			Recipient string `json:"recipient"`
+			Severity  string `json:"severity"`
+		} `json:"event-data"`
+	}
+	err = json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&notification)
+	if err != nil || notification.EventData.Event != "failed" {
+		return
+	}
+	bounces = append(bounces, EmailBounce{
+		Address:   notification.EventData.Recipient,
+		Permanent: notification.EventData.Severity == "permanent",
+		Reason:    notification.EventData.DeliveryStatus.Message,
+	})
+	return
+}
+
+// emailHMAC returns the HMAC-SHA256 of some data
+func emailHMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// emailSendRequest sends a request to an email backend API, returning an error if it wasn't successful
+func emailSendRequest(r *http.Request) error {
+	resp, err := emailHTTPClient.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("Email backend returned status %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+)
+
+// ErrNoEmbedSecret is returned when embed tokens are used without a secret to sign them with
+var ErrNoEmbedSecret = errors.New("Embed tokens aren't available, as no secret is configured for signing them")
+
+// EmbedToken generates a signed token which allows a saved visualisation to be embedded by people who don't
+// otherwise have access to the database.  The token is only valid for the given visualisation, and only until
+// the expiry time.  It isn't tied to a commit, so views using it always show the default one
+func EmbedToken(dbOwner, dbName, visName string, expiry time.Time) (string, error) {
+	if config.Conf.Web.EmbedSecret == "" {
+		return "", ErrNoEmbedSecret
+	}
+	exp := strconv.FormatInt(expiry.Unix(), 10)
+	return fmt.Sprintf("%s.%s", exp, embedSignature(dbOwner, dbName, visName, exp)), nil
+}
+
+// ValidateEmbedToken checks that an embed token is correctly signed for the given visualisation and hasn't expired
+func ValidateEmbedToken(token, dbOwner, dbName, visName string) error {
+	// Without a secret anyone could sign tokens, so none are accepted
+	if config.Conf.Web.EmbedSecret == "" {
+		return ErrNoEmbedSecret
+	}
+	exp, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return errors.New("Malformed embed token")
+	}
+	expiry, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil {
+		return errors.New("Malformed embed token")
+	}
+
+	// Compare the signatures in constant time, so the token can't be guessed by timing the responses
+	if !hmac.Equal([]byte(sig), []byte(embedSignature(dbOwner, dbName, visName, exp))) {
+		return errors.New("Invalid embed token")
+	}
+	if time.Now().Unix() > expiry {
+		return errors.New("Embed token has expired")
+	}
+	return nil
+}
+
+// embedSignature returns the hex encoded HMAC signature for an embed token
+func embedSignature(dbOwner, dbName, visName, expiry string) string {
+	mac := hmac.New(sha256.New, []byte(config.Conf.Web.EmbedSecret))
+	mac.Write([]byte(strings.ToLower(dbOwner) + "/" + dbName + "/" + visName + "/" + expiry))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,550 @@
+package common
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// Encrypted database files start with a header holding the details needed for decrypting them, followed by the file
+// contents encrypted in chunks with AES-256-GCM.  Each chunk can be decrypted by itself, so parts of a file can still be
+// read without retrieving the rest of it
+const (
+	encryptionChunkSize = 64 * 1024
+	encryptionMagic     = "DBHUBENC"
+	encryptionVersion   = 1
+
+	// The key ID of data keys encrypted with the key of a user, rather than an instance key
+	userKeyPrefix = "user/"
+)
+
+var (
+	// The provider of the instance keys, when encryption is configured
+	encryptionKeys KeyProvider
+
+	// The decrypted keys of users, by user ID, so they don't need decrypting for each file
+	userKeys sync.Map
+)
+
+// encryptionHeader is the header of an encrypted database file
+type encryptionHeader struct {
+	chunkSize  uint32
+	keyID      string
+	plainSize  int64
+	wrappedKey []byte
+}
+
+// aad returns the additional data authenticated with each chunk, which stops a file being truncated at a chunk boundary
+func (h encryptionHeader) aad() []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(h.plainSize))
+	return b
+}
+
+// encryptedSize returns the size of the encrypted file contents, not including the header
+func (h encryptionHeader) encryptedSize(overhead int) int64 {
+	chunks := (h.plainSize + int64(h.chunkSize) - 1) / int64(h.chunkSize)
+	return h.plainSize + chunks*int64(overhead)
+}
+
+// marshal returns the header in the form it's stored in
+func (h encryptionHeader) marshal() []byte {
+	var b bytes.Buffer
+	b.WriteString(encryptionMagic)
+	b.WriteByte(encryptionVersion)
+	binary.Write(&b, binary.BigEndian, h.chunkSize)
+	binary.Write(&b, binary.BigEndian, h.plainSize)
+	binary.Write(&b, binary.BigEndian, uint16(len(h.keyID)))
+	b.WriteString(h.keyID)
+	binary.Write(&b, binary.BigEndian, uint16(len(h.wrappedKey)))
+	b.Write(h.wrappedKey)
+	return b.Bytes()
+}
+
+// readEncryptionHeader reads the header of an encrypted database file.  Files which aren't encrypted are reported as
+// such, rather than being an error
+func readEncryptionHeader(r io.Reader) (h encryptionHeader, encrypted bool, err error) {
+	magic := make([]byte, len(encryptionMagic))
+	_, err = io.ReadFull(r, magic)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return h, false, nil
+	}
+	if err != nil || string(magic) != encryptionMagic {
+		return
+	}
+
+	var fixed struct {
+		Version   uint8
+		ChunkSize uint32
+		PlainSize int64
+		KeyIDLen  uint16
+	}
+	err = binary.Read(r, binary.BigEndian, &fixed)
+	if err != nil {
+		return
+	}
+	if fixed.Version != encryptionVersion || fixed.ChunkSize == 0 || fixed.PlainSize < 0 {
+		err = errors.New("unsupported encrypted database file")
+		return
+	}
+	keyID := make([]byte, fixed.KeyIDLen)
+	_, err = io.ReadFull(r, keyID)
+	if err != nil {
+		return
+	}
+	var wrappedLen uint16
+	err = binary.Read(r, binary.BigEndian, &wrappedLen)
+	if err != nil {
+		return
+	}
+	h = encryptionHeader{chunkSize: fixed.ChunkSize, keyID: string(keyID), plainSize: fixed.PlainSize,
+		wrappedKey: make([]byte, wrappedLen)}
+	_, err = io.ReadFull(r, h.wrappedKey)
+	if err != nil {
+		return
+	}
+	return h, true, nil
+}
+
+// chunkNonce returns the nonce for a chunk of an encrypted file.  Each file has its own data key, so the chunk number
+// is enough to keep them unique
+func chunkNonce(aead cipher.AEAD, chunk int64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], uint64(chunk))
+	return nonce
+}
+
+// decryptObject returns a handle which decrypts a stored database file as it's read.  Files which aren't encrypted
+// are returned as is
+func decryptObject(obj BlobObject) (BlobObject, error) {
+	if encryptionKeys == nil {
+		return obj, nil
+	}
+	h, encrypted, err := readEncryptionHeader(obj)
+	if err != nil {
+		return nil, err
+	}
+	if !encrypted {
+		_, err = obj.Seek(0, io.SeekStart)
+		return obj, err
+	}
+	dataKey, err := unwrapDataKey(h.keyID, h.wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	headerSize := int64(len(h.marshal()))
+	return &decryptedBlobObject{
+		aad:        h.aad(),
+		aead:       aead,
+		chunk:      -1,
+		chunkSize:  int64(h.chunkSize),
+		headerSize: headerSize,
+		obj:        obj,
+		plainSize:  h.plainSize,
+		rawPos:     headerSize,
+	}, nil
+}
+
+// encryptObject returns a reader which encrypts a database file with a new data key as it's read, along with the
+// size of the encrypted file.  The data key is encrypted with the key of the database owner when per user keys are
+// enabled, otherwise with the current instance key
+func encryptObject(dbOwner string, r io.Reader, size int64) (io.Reader, int64, error) {
+	dataKey := make([]byte, 32)
+	_, err := rand.Read(dataKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	keyID, wrapped, err := wrapDataKey(dbOwner, dataKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, 0, err
+	}
+	h := encryptionHeader{chunkSize: encryptionChunkSize, keyID: keyID, plainSize: size, wrappedKey: wrapped}
+	header := h.marshal()
+	enc := &encryptingReader{
+		aad:       h.aad(),
+		aead:      aead,
+		plain:     make([]byte, encryptionChunkSize),
+		remaining: size,
+		src:       r,
+	}
+	return io.MultiReader(bytes.NewReader(header), enc), int64(len(header)) + h.encryptedSize(aead.Overhead()), nil
+}
+
+// putDatabaseObject stores a database file, encrypting it first when encryption is enabled.  It returns the number of
+// bytes of the database file stored
+func putDatabaseObject(dbOwner, bucket, id string, r io.Reader, size int64) (int64, error) {
+	if !config.Conf.Encryption.Enabled {
+		return blobStore.Put(bucket, id, r, size)
+	}
+	enc, encSize, err := encryptObject(dbOwner, r, size)
+	if err != nil {
+		return 0, err
+	}
+	numBytes, err := blobStore.Put(bucket, id, enc, encSize)
+	if err != nil {
+		return 0, err
+	}
+	if numBytes != encSize {
+		return 0, fmt.Errorf("stored %d bytes of the encrypted database file, rather than %d", numBytes, encSize)
+	}
+	return size, nil
+}
+
+// RewrapDatabaseFile encrypts the data key of a stored database file again with the current instance key, for
+// rotating the instance keys.  Files using a user key aren't changed, as those keys are rewrapped by RewrapUserKeys
+// instead.  When encryptPlain is set, files which aren't encrypted are encrypted.  It returns whether the file was
+// changed
+func RewrapDatabaseFile(dbOwner, bucket, id string, encryptPlain bool) (changed bool, err error) {
+	if encryptionKeys == nil {
+		return false, errors.New("encryption isn't configured")
+	}
+	obj, err := blobStore.Get(bucket, id)
+	if err != nil {
+		return
+	}
+	defer obj.Close()
+	h, encrypted, err := readEncryptionHeader(obj)
+	if err != nil {
+		return
+	}
+	if (encrypted && (strings.HasPrefix(h.keyID, userKeyPrefix) || h.keyID == encryptionKeys.CurrentKeyID())) ||
+		(!encrypted && !encryptPlain) {
+		return false, nil
+	}
+
+	// The file is rewritten in place, so copy it somewhere else to read from while it's being stored
+	if !encrypted {
+		_, err = obj.Seek(0, io.SeekStart)
+		if err != nil {
+			return
+		}
+	}
+	tmp, err := os.CreateTemp("", "dbhub-rewrap-*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, obj)
+	if err != nil {
+		return
+	}
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		return
+	}
+
+	if !encrypted {
+		var enc io.Reader
+		var encSize int64
+		enc, encSize, err = encryptObject(dbOwner, tmp, size)
+		if err != nil {
+			return
+		}
+		_, err = blobStore.Put(bucket, id, enc, encSize)
+		return err == nil, err
+	}
+
+	// Only the header changes for encrypted files, as the data key stays the same
+	dataKey, err := unwrapDataKey(h.keyID, h.wrappedKey)
+	if err != nil {
+		return
+	}
+	h.keyID = encryptionKeys.CurrentKeyID()
+	h.wrappedKey, err = encryptionKeys.WrapKey(h.keyID, dataKey)
+	if err != nil {
+		return
+	}
+	header := h.marshal()
+	_, err = blobStore.Put(bucket, id, io.MultiReader(bytes.NewReader(header), tmp), int64(len(header))+size)
+	return err == nil, err
+}
+
+// RewrapUserKeys encrypts the keys of the users again with the current instance key, for rotating the instance keys.
+// It returns the number of user keys changed
+func RewrapUserKeys() (int, error) {
+	if encryptionKeys == nil {
+		return 0, errors.New("encryption isn't configured")
+	}
+	keys, err := database.UserEncryptionKeys()
+	if err != nil {
+		return 0, err
+	}
+	current := encryptionKeys.CurrentKeyID()
+	var changed int
+	for _, k := range keys {
+		if k.KeyID == current {
+			continue
+		}
+		key, err := encryptionKeys.UnwrapKey(k.KeyID, k.Key)
+		if err != nil {
+			return changed, fmt.Errorf("decrypting the key for user ID '%d' failed: %v", k.UserID, err)
+		}
+		wrapped, err := encryptionKeys.WrapKey(current, key)
+		if err != nil {
+			return changed, err
+		}
+		err = database.UpdateUserEncryptionKey(k.UserID, current, wrapped)
+		if err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// setupEncryption sets up the provider of the instance keys, when encryption is configured
+func setupEncryption() (err error) {
+	c := config.Conf.Encryption
+	if !c.Enabled && len(c.Keys) == 0 && c.VaultKey == "" {
+		return nil
+	}
+	switch c.Provider {
+	case "local":
+		encryptionKeys, err = newLocalKeyProvider(c)
+	case "vault":
+		encryptionKeys, err = newVaultKeyProvider(c)
+	default:
+		return fmt.Errorf("%s: unknown encryption key provider '%s'", config.Conf.Live.Nodename, c.Provider)
+	}
+	if err != nil {
+		return
+	}
+	if c.Enabled {
+		log.Printf("%v: encrypting database files. Key provider: %v, Per user keys: %v", config.Conf.Live.Nodename,
+			c.Provider, c.PerUserKeys)
+	}
+	return
+}
+
+// unwrapDataKey decrypts the data key of an encrypted database file
+func unwrapDataKey(keyID string, wrapped []byte) ([]byte, error) {
+	if !strings.HasPrefix(keyID, userKeyPrefix) {
+		return encryptionKeys.UnwrapKey(keyID, wrapped)
+	}
+	userID, err := strconv.ParseInt(strings.TrimPrefix(keyID, userKeyPrefix), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key ID '%s'", keyID)
+	}
+	userKey, err := userKeyByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return openKey(userKey, wrapped)
+}
+
+// userKeyByID returns the decrypted key of a user
+func userKeyByID(userID int64) ([]byte, error) {
+	if key, ok := userKeys.Load(userID); ok {
+		return key.([]byte), nil
+	}
+	k, err := database.UserEncryptionKeyByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if k.Key == nil {
+		return nil, fmt.Errorf("user ID '%d' doesn't have an encryption key", userID)
+	}
+	key, err := encryptionKeys.UnwrapKey(k.KeyID, k.Key)
+	if err != nil {
+		return nil, err
+	}
+	userKeys.Store(userID, key)
+	return key, nil
+}
+
+// userKeyByName returns the ID and decrypted key of a user, creating a key for them if they don't have one yet
+func userKeyByName(userName string) (int64, []byte, error) {
+	k, err := database.UserEncryptionKeyByName(userName)
+	if err != nil {
+		return 0, nil, err
+	}
+	if k.Key != nil {
+		key, err := userKeyByID(k.UserID)
+		return k.UserID, key, err
+	}
+
+	// Create a key for the user
+	key := make([]byte, 32)
+	_, err = rand.Read(key)
+	if err != nil {
+		return 0, nil, err
+	}
+	keyID := encryptionKeys.CurrentKeyID()
+	wrapped, err := encryptionKeys.WrapKey(keyID, key)
+	if err != nil {
+		return 0, nil, err
+	}
+	stored, err := database.AddUserEncryptionKey(k.UserID, keyID, wrapped)
+	if err != nil {
+		return 0, nil, err
+	}
+	if !stored {
+		// A key was created for the user by something else in the meantime, so use that one
+		key, err = userKeyByID(k.UserID)
+		return k.UserID, key, err
+	}
+	userKeys.Store(k.UserID, key)
+	return k.UserID, key, nil
+}
+
+// wrapDataKey encrypts the data key of a database file, returning the ID of the key it was encrypted with
+func wrapDataKey(dbOwner string, dataKey []byte) (keyID string, wrapped []byte, err error) {
+	if !config.Conf.Encryption.PerUserKeys {
+		keyID = encryptionKeys.CurrentKeyID()
+		wrapped, err = encryptionKeys.WrapKey(keyID, dataKey)
+		return
+	}
+	userID, userKey, err := userKeyByName(dbOwner)
+	if err != nil {
+		return
+	}
+	wrapped, err = sealKey(userKey, dataKey)
+	return fmt.Sprintf("%s%d", userKeyPrefix, userID), wrapped, err
+}
+
+// decryptedBlobObject is a BlobObject which decrypts an encrypted database file as it's read
+type decryptedBlobObject struct {
+	aad        []byte
+	aead       cipher.AEAD
+	buf        []byte // The decrypted contents of the current chunk
+	chunk      int64  // The number of the chunk in buf, or -1 if there isn't one
+	chunkSize  int64
+	headerSize int64
+	obj        BlobObject
+	plainSize  int64
+	pos        int64 // The position in the decrypted file
+	rawPos     int64 // The position in the encrypted file
+}
+
+func (d *decryptedBlobObject) Close() error {
+	return d.obj.Close()
+}
+
+func (d *decryptedBlobObject) Read(p []byte) (int, error) {
+	if d.pos >= d.plainSize {
+		return 0, io.EOF
+	}
+	chunk := d.pos / d.chunkSize
+	if chunk != d.chunk {
+		err := d.readChunk(chunk)
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buf[d.pos-chunk*d.chunkSize:])
+	d.pos += int64(n)
+	return n, nil
+}
+
+func (d *decryptedBlobObject) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = d.pos + offset
+	case io.SeekEnd:
+		pos = d.plainSize + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if pos < 0 {
+		return 0, errors.New("negative position")
+	}
+	d.pos = pos
+	return pos, nil
+}
+
+func (d *decryptedBlobObject) Size() (int64, error) {
+	return d.plainSize, nil
+}
+
+// readChunk reads and decrypts a chunk of the file.  The encrypted file is only seeked when reading out of order, as
+// seeking a Minio object starts a new request for it
+func (d *decryptedBlobObject) readChunk(chunk int64) error {
+	d.chunk = -1
+	overhead := int64(d.aead.Overhead())
+	start := d.headerSize + chunk*(d.chunkSize+overhead)
+	if start != d.rawPos {
+		_, err := d.obj.Seek(start, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		d.rawPos = start
+	}
+	n := d.chunkSize
+	if remaining := d.plainSize - chunk*d.chunkSize; remaining < n {
+		n = remaining
+	}
+	encrypted := make([]byte, n+overhead)
+	read, err := io.ReadFull(d.obj, encrypted)
+	d.rawPos += int64(read)
+	if err != nil {
+		return err
+	}
+	d.buf, err = d.aead.Open(d.buf[:0], chunkNonce(d.aead, chunk), encrypted, d.aad)
+	if err != nil {
+		return errors.New("decrypting the database file failed")
+	}
+	d.chunk = chunk
+	return nil
+}
+
+// encryptingReader encrypts a database file in chunks as it's read
+type encryptingReader struct {
+	aad       []byte
+	aead      cipher.AEAD
+	buf       []byte // The encrypted contents of the current chunk still to be read
+	chunk     int64
+	out       []byte
+	plain     []byte
+	remaining int64
+	src       io.Reader
+}
+
+func (e *encryptingReader) Read(p []byte) (int, error) {
+	for len(e.buf) == 0 {
+		if e.remaining == 0 {
+			return 0, io.EOF
+		}
+		n := int64(len(e.plain))
+		if e.remaining < n {
+			n = e.remaining
+		}
+		_, err := io.ReadFull(e.src, e.plain[:n])
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		e.out = e.aead.Seal(e.out[:0], chunkNonce(e.aead, e.chunk), e.plain[:n], e.aad)
+		e.buf = e.out
+		e.chunk++
+		e.remaining -= n
+	}
+	n := copy(p, e.buf)
+	e.buf = e.buf[n:]
+	return n, nil
+}
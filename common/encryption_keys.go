@@ -0,0 +1,183 @@
+package common
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+)
+
+// KeyProvider encrypts and decrypts the data keys of the database files with the instance keys.  The instance keys are
+// either kept in the config file, or in HashiCorp Vault using its Transit secrets engine, which never reveals them
+type KeyProvider interface {
+	// CurrentKeyID returns the ID of the instance key used for encrypting new data keys
+	CurrentKeyID() string
+
+	// UnwrapKey decrypts a data key, which was encrypted with the instance key with the given ID
+	UnwrapKey(keyID string, wrapped []byte) ([]byte, error)
+
+	// WrapKey encrypts a data key with the instance key with the given ID
+	WrapKey(keyID string, key []byte) ([]byte, error)
+}
+
+// localKeyProvider is the KeyProvider implementation for instance keys kept in the config file
+type localKeyProvider struct {
+	current string
+	keys    map[string][]byte
+}
+
+// newLocalKeyProvider returns the KeyProvider for instance keys kept in the config file
+func newLocalKeyProvider(c config.EncryptionConfig) (*localKeyProvider, error) {
+	p := &localKeyProvider{current: c.CurrentKey, keys: make(map[string][]byte)}
+	for id, k := range c.Keys {
+		key, err := base64.StdEncoding.DecodeString(k)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("encryption key '%s' isn't a base64 encoded 256 bit key", id)
+		}
+		p.keys[id] = key
+	}
+	return p, nil
+}
+
+func (p *localKeyProvider) CurrentKeyID() string {
+	return p.current
+}
+
+func (p *localKeyProvider) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key '%s'", keyID)
+	}
+	return openKey(key, wrapped)
+}
+
+func (p *localKeyProvider) WrapKey(keyID string, key []byte) ([]byte, error) {
+	k, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown encryption key '%s'", keyID)
+	}
+	return sealKey(k, key)
+}
+
+// vaultKeyProvider is the KeyProvider implementation for instance keys kept in HashiCorp Vault.  Vault keeps every
+// version of a key, and records the version used in the encrypted data key, so rotating the key in Vault doesn't stop
+// existing files being read
+type vaultKeyProvider struct {
+	address string
+	client  *http.Client
+	key     string
+	mount   string
+	token   string
+}
+
+// newVaultKeyProvider returns the KeyProvider for an instance key kept in HashiCorp Vault
+func newVaultKeyProvider(c config.EncryptionConfig) (*vaultKeyProvider, error) {
+	return &vaultKeyProvider{
+		address: strings.TrimSuffix(c.VaultAddress, "/"),
+		client:  &http.Client{Timeout: 30 * time.Second},
+		key:     c.VaultKey,
+		mount:   c.VaultMount,
+		token:   c.VaultToken,
+	}, nil
+}
+
+func (p *vaultKeyProvider) CurrentKeyID() string {
+	return p.key
+}
+
+func (p *vaultKeyProvider) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	var resp struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	err := p.request("decrypt", keyID, map[string]string{"ciphertext": string(wrapped)}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+}
+
+func (p *vaultKeyProvider) WrapKey(keyID string, key []byte) ([]byte, error) {
+	var resp struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	err := p.request("encrypt", keyID, map[string]string{"plaintext": base64.StdEncoding.EncodeToString(key)}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(resp.Data.Ciphertext), nil
+}
+
+// request calls a Transit secrets engine end point for a key
+func (p *vaultKeyProvider) request(endPoint, keyID string, body interface{}, resp interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/v1/%s/%s/%s", p.address, p.mount, endPoint,
+		url.PathEscape(keyID)), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("X-Vault-Token", p.token)
+	res, err := p.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("Vault returned status %d: %s", res.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(res.Body).Decode(resp)
+}
+
+// openKey decrypts a key which was encrypted with sealKey
+func openKey(kek, wrapped []byte) ([]byte, error) {
+	aead, err := newAEAD(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("encrypted key is too short")
+	}
+	return aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], nil)
+}
+
+// newAEAD returns AES-256-GCM using the given key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealKey encrypts a key with a key encryption key, using AES-256-GCM with a random nonce
+func sealKey(kek, key []byte) ([]byte, error) {
+	aead, err := newAEAD(kek)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, key, nil), nil
+}
@@ -0,0 +1,143 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	sqlite "github.com/gwenn/gosqlite"
+)
+
+// ExplainMaxOps is the maximum number of bytecode instructions returned for a statement
+const ExplainMaxOps = 10000
+
+// ExplainOp is one bytecode instruction of a prepared statement, as listed by EXPLAIN
+type ExplainOp struct {
+	Addr    int    `json:"addr"`
+	Comment string `json:"comment,omitempty"`
+	Opcode  string `json:"opcode"`
+	P1      int    `json:"p1"`
+	P2      int    `json:"p2"`
+	P3      int    `json:"p3"`
+	P4      string `json:"p4,omitempty"`
+	P5      int    `json:"p5"`
+}
+
+// ExplainPlanStep is one step of the query plan of a statement, as listed by EXPLAIN QUERY PLAN.  Steps are nested
+// under the step with the ID given as their parent
+type ExplainPlanStep struct {
+	Detail string `json:"detail"`
+	ID     int    `json:"id"`
+	Parent int    `json:"parent"`
+}
+
+// ExplainResult holds the query plan of a statement, and its bytecode listing when that was asked for
+type ExplainResult struct {
+	Bytecode []ExplainOp       `json:"bytecode,omitempty"`
+	Plan     []ExplainPlanStep `json:"plan"`
+}
+
+// JobRequestExplain holds the data used when asking our job queue backend for the query plan of a statement
+type JobRequestExplain struct {
+	Bytecode bool   `json:"bytecode"`
+	SQL      string `json:"sql"`
+}
+
+// JobResponseDBExplain holds the fields used for receiving the query plan of a statement from our job queue backend
+type JobResponseDBExplain struct {
+	Err    string        `json:"error"`
+	Result ExplainResult `json:"result"`
+}
+
+// LiveExplain asks our job queue backend for the query plan of a statement on a live database
+func LiveExplain(liveNode, loggedInUser, dbOwner, dbName, sql string, bytecode bool) (result ExplainResult, err error) {
+	reqJSON, err := json.Marshal(JobRequestExplain{Bytecode: bytecode, SQL: sql})
+	if err != nil {
+		return
+	}
+	var resp JobResponseDBExplain
+	err = JobSubmit(&resp, liveNode, "explain", loggedInUser, dbOwner, dbName, reqJSON)
+	if err != nil {
+		return
+	}
+	if resp.Err != "" {
+		return result, errors.New(resp.Err)
+	}
+	return resp.Result, nil
+}
+
+// SQLiteExplain returns the query plan of a statement, and its bytecode listing when bytecode is true.  The statement
+// itself isn't run, and only one statement can be given
+func SQLiteExplain(sdb *sqlite.Conn, sql string, bytecode bool) (result ExplainResult, err error) {
+	sql = strings.TrimSpace(sql)
+	if sql == "" {
+		return result, errors.New("No SQL statement was given")
+	}
+
+	// Retrieve the query plan
+	plan, err := sdb.Prepare("EXPLAIN QUERY PLAN " + sql)
+	if err != nil {
+		return
+	}
+	defer plan.Finalize()
+	if strings.Trim(plan.Tail(), " \t\r\n;") != "" {
+		return result, errors.New("Only one SQL statement can be explained at a time")
+	}
+	result.Plan = []ExplainPlanStep{}
+	err = plan.Select(func(s *sqlite.Stmt) error {
+		var step ExplainPlanStep
+		var notUsed int
+		if err := s.Scan(&step.ID, &step.Parent, &notUsed, &step.Detail); err != nil {
+			return err
+		}
+		result.Plan = append(result.Plan, step)
+		return nil
+	})
+	if err != nil || !bytecode {
+		return
+	}
+
+	// Retrieve the bytecode listing
+	ops, err := sdb.Prepare("EXPLAIN " + sql)
+	if err != nil {
+		return
+	}
+	defer ops.Finalize()
+	err = ops.Select(func(s *sqlite.Stmt) error {
+		if len(result.Bytecode) >= ExplainMaxOps {
+			return fmt.Errorf("The bytecode listing is too long.  Only statements with up to %d instructions can be "+
+				"listed", ExplainMaxOps)
+		}
+		var op ExplainOp
+		if err := s.Scan(&op.Addr, &op.Opcode, &op.P1, &op.P2, &op.P3, &op.P4, &op.P5, &op.Comment); err != nil {
+			return err
+		}
+		result.Bytecode = append(result.Bytecode, op)
+		return nil
+	})
+	return
+}
+
+// SQLiteExplainDefensive returns the query plan of a statement on a standard database, opening the database in the
+// same defensive way as user provided queries are run
+func SQLiteExplainDefensive(w http.ResponseWriter, r *http.Request, dbOwner, dbName, commitID, loggedInUser, sql string, bytecode bool) (result ExplainResult, err error) {
+	sdb, err := OpenSQLiteDatabaseDefensive(w, r, dbOwner, dbName, commitID, loggedInUser)
+	if err != nil {
+		// The return handling was already done in OpenSQLiteDatabaseDefensive()
+		return
+	}
+	defer sdb.Close()
+	return SQLiteExplain(sdb, sql, bytecode)
+}
+
+// SQLiteExplainLive is used by our job queue backend nodes to return the query plan of a statement on a live database
+func SQLiteExplainLive(baseDir, dbOwner, dbName string, req JobRequestExplain) (result ExplainResult, err error) {
+	sdb, release, err := liveReadConn(baseDir, dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	defer release()
+	return SQLiteExplain(sdb, req.SQL, req.Bytecode)
+}
@@ -0,0 +1,327 @@
+// Package fixtures creates test data programmatically, for integration tests in CI and for local development.  It
+// refuses to run in production
+package fixtures
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+
+	sqlite "github.com/gwenn/gosqlite"
+)
+
+// Spec describes the test data to create.  Users are created first, then databases, their shares, discussions, and API
+// keys, so the later parts can refer to the earlier ones
+type Spec struct {
+	APIKeys     []APIKeySpec     `json:"api_keys"`
+	Databases   []DatabaseSpec   `json:"databases"`
+	Discussions []DiscussionSpec `json:"discussions"`
+	Reset       bool             `json:"reset"` // Empty the database first, with ResetDB()
+	Shares      []ShareSpec      `json:"shares"`
+	Users       []UserSpec       `json:"users"`
+}
+
+// APIKeySpec is an API key to create.  When no key is given a random one is generated
+type APIKeySpec struct {
+	Key      string `json:"key"`
+	ReadOnly bool   `json:"read_only"`
+	User     string `json:"user"`
+}
+
+// DatabaseSpec is a database to create.  Standard databases get a synthetic commit history, with each commit adding
+// rows to an "items" table and dated a day after the previous one
+type DatabaseSpec struct {
+	Commits int    `json:"commits"` // Defaults to 1.  Ignored for live databases, which don't have commits
+	Live    bool   `json:"live"`
+	Name    string `json:"name"`
+	Owner   string `json:"owner"`
+	Public  bool   `json:"public"`
+	Rows    int    `json:"rows"` // Rows added by each commit.  Defaults to 10
+}
+
+// DiscussionSpec is a discussion to create on a database, along with its comments
+type DiscussionSpec struct {
+	Body     string        `json:"body"`
+	Comments []CommentSpec `json:"comments"`
+	Creator  string        `json:"creator"`
+	DBName   string        `json:"dbname"`
+	DBOwner  string        `json:"dbowner"`
+	Title    string        `json:"title"`
+}
+
+// CommentSpec is a comment on a discussion
+type CommentSpec struct {
+	Body      string `json:"body"`
+	Commenter string `json:"commenter"`
+}
+
+// ShareSpec shares a database with a user, giving them read only access unless write is set
+type ShareSpec struct {
+	DBName  string `json:"dbname"`
+	DBOwner string `json:"dbowner"`
+	User    string `json:"user"`
+	Write   bool   `json:"write"`
+}
+
+// UserSpec is a user to create.  The email address defaults to one at the server name
+type UserSpec struct {
+	Admin       bool   `json:"admin"`
+	DisplayName string `json:"display_name"`
+	Email       string `json:"email"`
+	Name        string `json:"name"`
+}
+
+// Result holds what was created, for the tests to use
+type Result struct {
+	APIKeys     []CreatedKey      `json:"api_keys"`
+	Databases   []CreatedDatabase `json:"databases"`
+	Discussions []CreatedDiscuss  `json:"discussions"`
+}
+
+// CreatedKey is a created API key
+type CreatedKey struct {
+	Key  string `json:"key"`
+	User string `json:"user"`
+}
+
+// CreatedDatabase is a created database, with the IDs of its commits, oldest first
+type CreatedDatabase struct {
+	Commits []string `json:"commits,omitempty"`
+	Live    bool     `json:"live"`
+	Name    string   `json:"name"`
+	Owner   string   `json:"owner"`
+}
+
+// CreatedDiscuss is a created discussion
+type CreatedDiscuss struct {
+	DBName  string `json:"dbname"`
+	DBOwner string `json:"dbowner"`
+	ID      int    `json:"id"`
+}
+
+// Create adds the test data described by a spec
+func Create(spec Spec) (res Result, err error) {
+	if config.Conf.Environment.Environment == "production" {
+		return res, errors.New("Test data can't be created in production")
+	}
+
+	if spec.Reset {
+		err = database.ResetDB()
+		if err != nil {
+			return
+		}
+		err = com.ClearCache()
+		if err != nil {
+			return
+		}
+	}
+	for _, u := range spec.Users {
+		err = User(u)
+		if err != nil {
+			return
+		}
+	}
+	for _, d := range spec.Databases {
+		var db CreatedDatabase
+		db, err = Database(d)
+		if err != nil {
+			return
+		}
+		res.Databases = append(res.Databases, db)
+	}
+	for _, s := range spec.Shares {
+		err = Share(s)
+		if err != nil {
+			return
+		}
+	}
+	for _, d := range spec.Discussions {
+		var id int
+		id, err = Discussion(d)
+		if err != nil {
+			return
+		}
+		res.Discussions = append(res.Discussions, CreatedDiscuss{DBName: d.DBName, DBOwner: d.DBOwner, ID: id})
+	}
+	for _, k := range spec.APIKeys {
+		var key string
+		key, err = APIKey(k)
+		if err != nil {
+			return
+		}
+		res.APIKeys = append(res.APIKeys, CreatedKey{Key: key, User: k.User})
+	}
+	return
+}
+
+// APIKey creates an API key for a user, returning the key
+func APIKey(k APIKeySpec) (key string, err error) {
+	perms := database.MayReadAndWrite
+	if k.ReadOnly {
+		perms = database.MayRead
+	}
+	if k.Key != "" {
+		_, err = database.APIKeySave(k.Key, k.User, time.Now(), nil, perms, "Test fixture", nil)
+		return k.Key, err
+	}
+	newKey, err := database.APIKeyGenerate(k.User, nil, perms, "Test fixture", nil)
+	return newKey.Key, err
+}
+
+// Database creates a database, either standard with a commit history or live
+func Database(d DatabaseSpec) (db CreatedDatabase, err error) {
+	if d.Owner == "" || d.Name == "" {
+		return db, errors.New("Databases need both an owner and a name")
+	}
+	if d.Commits < 1 {
+		d.Commits = 1
+	}
+	if d.Rows < 1 {
+		d.Rows = 10
+	}
+	access := database.SetToPrivate
+	if d.Public {
+		access = database.SetToPublic
+	}
+	db = CreatedDatabase{Live: d.Live, Name: d.Name, Owner: d.Owner}
+
+	// Build the database file up a commit at a time
+	tempDB, err := os.CreateTemp(config.Conf.DiskCache.Directory, "dbhub-fixture-*.db")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tempDB.Name())
+	defer tempDB.Close()
+	if d.Live {
+		d.Commits = 1
+	}
+	start := time.Now().AddDate(0, 0, -d.Commits)
+	for i := 1; i <= d.Commits; i++ {
+		err = addRows(tempDB.Name(), i, d.Rows)
+		if err != nil {
+			return
+		}
+		_, err = tempDB.Seek(0, 0)
+		if err != nil {
+			return
+		}
+		if d.Live {
+			break
+		}
+
+		var commitID string
+		when := start.AddDate(0, 0, i)
+		_, commitID, _, err = com.AddDatabase(d.Owner, d.Owner, d.Name, false, "", "", access, "",
+			fmt.Sprintf("Commit %d of the test data", i), "", tempDB, when, when, "", "", "", "", nil, "",
+			com.AddDatabaseOptions{})
+		if err != nil {
+			return
+		}
+		db.Commits = append(db.Commits, commitID)
+	}
+	if !d.Live {
+		return
+	}
+
+	// Live databases are stored in Minio, then set up on a live node
+	info, err := tempDB.Stat()
+	if err != nil {
+		return
+	}
+	objectID, err := com.LiveStoreDatabaseMinio(tempDB, d.Owner, d.Name, info.Size())
+	if err != nil {
+		return
+	}
+	liveNode, err := com.LiveCreateDB(d.Owner, d.Name, objectID)
+	if err != nil {
+		return
+	}
+	err = database.LiveAddDatabasePG(d.Owner, d.Name, objectID, liveNode, access)
+	return
+}
+
+// Discussion creates a discussion on a database along with its comments, returning the ID of the discussion
+func Discussion(d DiscussionSpec) (id int, err error) {
+	if d.Title == "" {
+		d.Title = "Test discussion"
+	}
+	id, err = database.StoreDiscussion(d.DBOwner, d.DBName, d.Creator, d.Title, d.Body, database.DISCUSSION,
+		database.MergeRequestEntry{})
+	if err != nil {
+		return
+	}
+	for _, c := range d.Comments {
+		err = database.StoreComment(d.DBOwner, d.DBName, c.Commenter, id, c.Body, false,
+			database.CLOSED_WITHOUT_MERGE)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Share shares a database with a user, keeping the existing shares of the database
+func Share(s ShareSpec) (err error) {
+	if s.DBOwner == "" || s.DBName == "" || s.User == "" {
+		return errors.New("Shares need the owner and name of the database, and the user to share it with")
+	}
+	shares, err := database.GetShares(s.DBOwner, s.DBName)
+	if err != nil {
+		return
+	}
+	shares[s.User] = database.MayRead
+	if s.Write {
+		shares[s.User] = database.MayReadAndWrite
+	}
+	return database.StoreShares(s.DBOwner, s.DBName, shares)
+}
+
+// User creates a user
+func User(u UserSpec) (err error) {
+	if u.Name == "" {
+		return errors.New("Users need a name")
+	}
+	if u.Email == "" {
+		u.Email = fmt.Sprintf("%s@%s", u.Name, strings.Split(config.Conf.Web.ServerName, ":")[0])
+	}
+	err = database.AddUser("auth0"+u.Name, u.Name, u.Email, u.DisplayName, "")
+	if err != nil {
+		return
+	}
+	if u.Admin {
+		err = database.SetUserAdmin(u.Name, true)
+	}
+	return
+}
+
+// addRows adds rows to the "items" table of a test database, creating it when needed
+func addRows(path string, commit, rows int) (err error) {
+	sdb, err := sqlite.Open(path, sqlite.OpenReadWrite|sqlite.OpenCreate)
+	if err != nil {
+		return
+	}
+	defer sdb.Close()
+	err = sdb.Exec(`CREATE TABLE IF NOT EXISTS items (id INTEGER PRIMARY KEY, name TEXT NOT NULL, value REAL, ` +
+		`added_in INTEGER NOT NULL)`)
+	if err != nil {
+		return
+	}
+	if err = sdb.Begin(); err != nil {
+		return
+	}
+	for i := 1; i <= rows; i++ {
+		err = sdb.Exec(`INSERT INTO items (name, value, added_in) VALUES (?, ?, ?)`,
+			fmt.Sprintf("Item %d.%d", commit, i), float64(commit*i)/10, commit)
+		if err != nil {
+			sdb.Rollback()
+			return
+		}
+	}
+	return sdb.Commit()
+}
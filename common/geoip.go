@@ -0,0 +1,164 @@
+package common
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+)
+
+// The longest referrer which is recorded.  Anything after this is cut off
+const maxReferrerLength = 1024
+
+// geoIPRange is a range of IP addresses, and the country they're allocated to
+type geoIPRange struct {
+	Country string
+	End     netip.Addr
+	Start   netip.Addr
+}
+
+var (
+	// The IP address ranges loaded from the GeoIP database, sorted by their starting address
+	geoIPRanges []geoIPRange
+	geoIPOnce   sync.Once
+
+	// Country codes are two letters, as per ISO 3166-1 alpha-2
+	countryCodeRegex = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+// loadGeoIPDatabase reads the GeoIP database given in the configuration file.  The database is a CSV file with the
+// first address, the last address, and the country code of each range on each line.  eg:
+//
+//	1.0.0.0,1.0.0.255,AU
+//
+// This is the format of the freely available DB-IP "IP to Country Lite" database
+func loadGeoIPDatabase(path string) (ranges []geoIPRange, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+	for {
+		var rec []string
+		rec, err = r.Read()
+		if errors.Is(err, io.EOF) {
+			err = nil
+			break
+		}
+		if err != nil {
+			return
+		}
+		if len(rec) < 3 {
+			continue
+		}
+
+		// Skip any lines which don't hold a valid range, such as a header line
+		var g geoIPRange
+		g.Start, err = netip.ParseAddr(strings.TrimSpace(rec[0]))
+		if err != nil {
+			err = nil
+			continue
+		}
+		g.End, err = netip.ParseAddr(strings.TrimSpace(rec[1]))
+		if err != nil || g.Start.BitLen() != g.End.BitLen() {
+			err = nil
+			continue
+		}
+		g.Country = strings.ToUpper(strings.TrimSpace(rec[2]))
+		if !countryCodeRegex.MatchString(g.Country) {
+			continue
+		}
+		ranges = append(ranges, g)
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].Start.Less(ranges[j].Start)
+	})
+	return
+}
+
+// geoIPCountry returns the country code for an IP address from the GeoIP database, or an empty string if it's not
+// known
+func geoIPCountry(ipAddr string) string {
+	geoIPOnce.Do(func() {
+		if config.Conf.GeoIP.Database == "" {
+			return
+		}
+		var err error
+		geoIPRanges, err = loadGeoIPDatabase(config.Conf.GeoIP.Database)
+		if err != nil {
+			log.Printf("Loading the GeoIP database '%s' failed: %v", config.Conf.GeoIP.Database, err)
+			return
+		}
+		log.Printf("%s: loaded %d GeoIP ranges", config.Conf.Live.Nodename, len(geoIPRanges))
+	})
+	if len(geoIPRanges) == 0 {
+		return ""
+	}
+
+	addr, err := netip.ParseAddr(ipAddr)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+
+	// Find the last range starting at or before the address, then check the address falls inside it
+	i := sort.Search(len(geoIPRanges), func(i int) bool {
+		return addr.Less(geoIPRanges[i].Start)
+	}) - 1
+	if i < 0 || geoIPRanges[i].Start.BitLen() != addr.BitLen() || geoIPRanges[i].End.Less(addr) {
+		return ""
+	}
+	return geoIPRanges[i].Country
+}
+
+// RequestCountry returns the two letter code of the country an incoming request came from, or an empty string if
+// it's not known.  When the server is behind a reverse proxy or CDN which adds the country as a header, that's used.
+// Otherwise the GeoIP database (if any) is used to look up the remote address
+func RequestCountry(r *http.Request) string {
+	if config.Conf.GeoIP.CountryHeader != "" {
+		country := strings.ToUpper(strings.TrimSpace(r.Header.Get(config.Conf.GeoIP.CountryHeader)))
+		if countryCodeRegex.MatchString(country) && country != "XX" {
+			return country
+		}
+	}
+	ipAddr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ipAddr = r.RemoteAddr
+	}
+	return geoIPCountry(ipAddr)
+}
+
+// RequestReferrer returns the page which referred an incoming request, without any query string or fragment.  Links
+// from within DBHub.io itself aren't counted as referrals, so an empty string is returned for those
+func RequestReferrer(r *http.Request) string {
+	ref, err := url.Parse(r.Referer())
+	if err != nil || ref.Host == "" || (ref.Scheme != "http" && ref.Scheme != "https") {
+		return ""
+	}
+	if strings.EqualFold(ref.Host, config.Conf.Web.ServerName) {
+		return ""
+	}
+	ref.RawQuery = ""
+	ref.Fragment = ""
+	ref.User = nil
+	s := ref.String()
+	if len(s) > maxReferrerLength {
+		s = s[:maxReferrerLength]
+	}
+	return s
+}
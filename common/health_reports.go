@@ -0,0 +1,203 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	sqlite "github.com/gwenn/gosqlite"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+const (
+	// HealthVacuumMinBytes is the least amount of unused space in a database before running VACUUM on it is suggested
+	HealthVacuumMinBytes = 1024 * 1024
+
+	// HealthVacuumMinPercent is the least percentage of the pages of a database which need to be unused before running
+	// VACUUM on it is suggested
+	HealthVacuumMinPercent = 10
+
+	// HealthWideTableColumns is the number of columns a table needs to have for a health report to call it very wide
+	HealthWideTableColumns = 100
+
+	// healthIntegrityMaxErrors is the maximum number of problems returned by the integrity check of a health report
+	healthIntegrityMaxErrors = 100
+
+	// healthReportBatch is the number of health reports worked out before checking for newer requests
+	healthReportBatch = 20
+
+	// healthReportInterval is how often the health report loop checks for commits waiting for their reports
+	healthReportInterval = time.Minute
+)
+
+// HealthReportLoop works out the health reports of the commits waiting for them, including the head commits of the
+// default branches of all standard databases.  When several nodes are running, only one of them does it.  When ctx is
+// cancelled the report being worked out is finished off, then wg is marked as done
+func HealthReportLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// Ensure a warning message is displayed on the console if the health report loop exits other than by shutting down
+	defer func() {
+		if ctx.Err() != nil {
+			log.Printf("%s: health report loop stopped", config.Conf.Live.Nodename)
+			return
+		}
+		log.Printf("%s: WARN: Health report loop exited", config.Conf.Live.Nodename)
+	}()
+
+	leader := database.NewLeader("health reports")
+	defer leader.Resign()
+
+	log.Printf("%s: health report loop started.  %v refresh.", config.Conf.Live.Nodename, healthReportInterval)
+	for {
+		var list []database.HealthReportJob
+		if leader.IsLeader() {
+			var err error
+			list, err = database.HealthReportsPending(healthReportBatch)
+			if err != nil {
+				log.Printf("Error when retrieving the commits waiting for health reports: %v", err)
+			}
+			for _, j := range list {
+				if ctx.Err() != nil {
+					break
+				}
+				var msg string
+				details, err := CommitHealthReport(j.Owner, j.DBName, j.Commit)
+				if err != nil {
+					log.Printf("Error when working out the health report of commit '%s' of '%s/%s': %v", j.Commit,
+						j.Owner, SanitiseLogString(j.DBName), err)
+					msg = err.Error()
+				}
+				_ = database.HealthReportSave(j.Owner, j.DBName, j.Commit, details, msg)
+			}
+		}
+
+		// Carry on straight away when there may be more reports waiting
+		wait := healthReportInterval
+		if len(list) >= healthReportBatch {
+			wait = 0
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// CommitHealthReport works out the health report of a commit of a standard database
+func CommitHealthReport(dbOwner, dbName, commitID string) (details *database.HealthReportDetails, err error) {
+	bucket, id, err := SQLiteLocation(dbOwner, dbName, commitID, dbOwner)
+	if err != nil {
+		return
+	}
+	if id == "" {
+		return nil, errors.New("The database file for the commit wasn't found")
+	}
+	dbPath, err := RetrieveDatabaseFile(bucket, id)
+	if err != nil {
+		return
+	}
+
+	// The database is opened read only, with the defensive flag set.  No user provided SQL is run, so there's no
+	// authorizer, letting the report use the pragmas it needs
+	sdb, err := sqlite.Open(dbPath, sqlite.OpenReadOnly)
+	if err != nil {
+		log.Printf("Couldn't open database for its health report: %s", err)
+		return nil, errors.New("Internal server error")
+	}
+	defer sdb.Close()
+	var enabled bool
+	if enabled, err = sdb.EnableDefensive(true); !enabled || err != nil {
+		log.Printf("Couldn't enable the defensive flag for a health report: %v", err)
+		return nil, errors.New("Internal server error")
+	}
+	if enabled, err = sdb.EnableTrustedSchema(false); enabled || err != nil {
+		log.Printf("Couldn't disable the trusted schema flag for a health report: %v", err)
+		return nil, errors.New("Internal server error")
+	}
+	return SQLiteHealthReport(sdb)
+}
+
+// SQLiteHealthReport checks the integrity of a SQLite database, how much of it is unused space, and the tables without
+// a primary key or with a lot of columns
+func SQLiteHealthReport(sdb *sqlite.Conn) (details *database.HealthReportDetails, err error) {
+	d := database.HealthReportDetails{
+		IntegrityErrors: []string{},
+		NoPrimaryKey:    []string{},
+		WideTables:      []database.HealthWideTable{},
+	}
+
+	// Check the integrity of the database
+	err = sdb.Select(fmt.Sprintf("PRAGMA integrity_check(%d)", healthIntegrityMaxErrors), func(s *sqlite.Stmt) error {
+		var msg string
+		if err := s.Scan(&msg); err != nil {
+			return err
+		}
+		if msg != "ok" {
+			d.IntegrityErrors = append(d.IntegrityErrors, msg)
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	d.IntegrityOK = len(d.IntegrityErrors) == 0
+
+	// Work out the amount of unused space
+	for _, p := range []struct {
+		name  string
+		value *int64
+	}{
+		{"page_size", &d.PageSize},
+		{"page_count", &d.PageCount},
+		{"freelist_count", &d.FreelistPages},
+	} {
+		if err = sdb.OneValue("PRAGMA "+p.name, p.value); err != nil {
+			return
+		}
+	}
+	d.UnusedBytes = d.FreelistPages * d.PageSize
+	d.VacuumSuggested = d.UnusedBytes >= HealthVacuumMinBytes &&
+		d.FreelistPages*100 >= d.PageCount*HealthVacuumMinPercent
+
+	// Check the tables.  Virtual tables don't have primary keys, so are skipped
+	var tables []string
+	err = sdb.Select("SELECT name, sql FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name",
+		func(s *sqlite.Stmt) error {
+			var name, sql string
+			if err := s.Scan(&name, &sql); err != nil {
+				return err
+			}
+			if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(sql)), "CREATE VIRTUAL TABLE") {
+				tables = append(tables, name)
+			}
+			return nil
+		})
+	if err != nil {
+		return
+	}
+	for _, t := range tables {
+		var pks, other []string
+		var implicitPk bool
+		pks, implicitPk, other, err = GetPrimaryKeyAndOtherColumns(sdb, "main", t)
+		if err != nil {
+			return
+		}
+		columns := len(other)
+		if implicitPk {
+			d.NoPrimaryKey = append(d.NoPrimaryKey, t)
+		} else {
+			columns += len(pks)
+		}
+		if columns >= HealthWideTableColumns {
+			d.WideTables = append(d.WideTables, database.HealthWideTable{Columns: columns, Table: t})
+		}
+	}
+	return &d, nil
+}
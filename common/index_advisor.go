@@ -0,0 +1,412 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	sqlite "github.com/gwenn/gosqlite"
+)
+
+// IndexAdvisorMaxColumns is the maximum number of columns in a suggested index
+const IndexAdvisorMaxColumns = 6
+
+// IndexAdvisorMaxQueries is the maximum number of queries from the query history looked at by the index advisor
+const IndexAdvisorMaxQueries = 500
+
+// indexAdvisorCandidate is the name of the index tried out by the index advisor.  It's only ever created in the in
+// memory copy of the database schema
+const indexAdvisorCandidate = "dbhub_index_advisor_candidate"
+
+// IndexSuggestion is an index suggested by the index advisor, along with the number of queries in the query history
+// which would use it instead of scanning the whole table
+type IndexSuggestion struct {
+	Applied bool     `json:"applied"`
+	Columns []string `json:"columns"`
+	Error   string   `json:"error,omitempty"`
+	Name    string   `json:"name"`
+	Queries int      `json:"queries"`
+	SQL     string   `json:"sql"`
+	Table   string   `json:"table"`
+}
+
+// JobRequestIndexAdvice holds the data used when asking our job queue backend for index suggestions
+type JobRequestIndexAdvice struct {
+	Queries []string `json:"queries"`
+}
+
+// JobResponseDBIndexAdvice holds the fields used for receiving index suggestions from our job queue backend
+type JobResponseDBIndexAdvice struct {
+	Err         string            `json:"error"`
+	Suggestions []IndexSuggestion `json:"suggestions"`
+}
+
+// indexAdvisorColumn is a column compared with something in a query, and whether the comparison is for equality
+type indexAdvisorColumn struct {
+	equality bool
+	name     string
+}
+
+// LiveIndexAdvice asks our job queue backend for the indexes which would help the given queries on a live database
+func LiveIndexAdvice(liveNode, loggedInUser, dbOwner, dbName string, queries []string) (suggestions []IndexSuggestion, err error) {
+	reqJSON, err := json.Marshal(JobRequestIndexAdvice{Queries: queries})
+	if err != nil {
+		return
+	}
+	var resp JobResponseDBIndexAdvice
+	err = JobSubmit(&resp, liveNode, "indexadvice", loggedInUser, dbOwner, dbName, reqJSON)
+	if err != nil {
+		return
+	}
+	if resp.Err != "" {
+		return nil, errors.New(resp.Err)
+	}
+	return resp.Suggestions, nil
+}
+
+// SQLiteIndexAdvice works out which indexes would stop the given queries from scanning whole tables.  The schema of the
+// database is copied into an in memory database, where each possible index is tried out by checking whether the query
+// plan uses it.  The database itself isn't changed, and none of the queries are run
+func SQLiteIndexAdvice(sdb *sqlite.Conn, queries []string) (suggestions []IndexSuggestion, err error) {
+	// Copy the schema of the database
+	type schemaItem struct {
+		name, sql, typ string
+	}
+	var schema []schemaItem
+	err = sdb.Select(`SELECT type, name, sql FROM sqlite_master
+		WHERE type IN ('table', 'view', 'index') AND sql IS NOT NULL AND name NOT LIKE 'sqlite_%'`,
+		func(s *sqlite.Stmt) error {
+			var i schemaItem
+			if err := s.Scan(&i.typ, &i.name, &i.sql); err != nil {
+				return err
+			}
+			schema = append(schema, i)
+			return nil
+		})
+	if err != nil {
+		return
+	}
+	mem, err := sqlite.Open(":memory:")
+	if err != nil {
+		return
+	}
+	defer mem.Close()
+	tableCols := make(map[string][]string)
+	for _, typ := range []string{"table", "view", "index"} {
+		for _, i := range schema {
+			if i.typ != typ {
+				continue
+			}
+
+			// Things which can't be created in the copy, such as virtual tables using modules which aren't
+			// available, are left out.  Queries using them are skipped
+			if err = mem.Exec(i.sql); err != nil {
+				continue
+			}
+			if typ == "table" {
+				var pks, other []string
+				pks, _, other, err = GetPrimaryKeyAndOtherColumns(mem, "main", i.name)
+				if err != nil {
+					return
+				}
+				tableCols[i.name] = append(pks, other...)
+			}
+		}
+	}
+	err = nil
+
+	// Try out the indexes which could help each query.  Queries can use tables through views, so each table with a
+	// column compared in the query is tried
+	var tables []string
+	for t := range tableCols {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+	found := make(map[string]*IndexSuggestion)
+	for _, q := range queries {
+		plan, ok := indexAdvisorPlan(mem, q)
+		if !ok || !strings.Contains(plan, "SCAN ") {
+			continue
+		}
+		compared := indexAdvisorColumns(q)
+		for _, table := range tables {
+			for _, cols := range indexAdvisorCandidates(compared, tableCols[table]) {
+				if !indexAdvisorHelps(mem, q, table, cols) {
+					continue
+				}
+				key := strings.ToLower(table + "\x00" + strings.Join(cols, "\x00"))
+				if s, ok := found[key]; ok {
+					s.Queries++
+					break
+				}
+				name := fmt.Sprintf("idx_%s_%s", table, strings.Join(cols, "_"))
+				found[key] = &IndexSuggestion{
+					Columns: cols,
+					Name:    name,
+					Queries: 1,
+					SQL: fmt.Sprintf("CREATE INDEX %s ON %s (%s)", EscapeId(name), EscapeId(table),
+						strings.Join(EscapeIds(cols), ", ")),
+					Table: table,
+				}
+				break
+			}
+		}
+	}
+
+	// Return the indexes helping the most queries first
+	suggestions = []IndexSuggestion{}
+	for _, s := range found {
+		suggestions = append(suggestions, *s)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Queries != suggestions[j].Queries {
+			return suggestions[i].Queries > suggestions[j].Queries
+		}
+		return suggestions[i].Name < suggestions[j].Name
+	})
+	return
+}
+
+// SQLiteIndexAdviceDefensive returns the indexes which would help the given queries on a standard database, opening the
+// database in the same defensive way as user provided queries are run
+func SQLiteIndexAdviceDefensive(w http.ResponseWriter, r *http.Request, dbOwner, dbName, commitID, loggedInUser string, queries []string) (suggestions []IndexSuggestion, err error) {
+	sdb, err := OpenSQLiteDatabaseDefensive(w, r, dbOwner, dbName, commitID, loggedInUser)
+	if err != nil {
+		// The return handling was already done in OpenSQLiteDatabaseDefensive()
+		return
+	}
+	defer sdb.Close()
+	return SQLiteIndexAdvice(sdb, queries)
+}
+
+// SQLiteIndexAdviceLive is used by our job queue backend nodes to return the indexes which would help the given queries
+// on a live database
+func SQLiteIndexAdviceLive(baseDir, dbOwner, dbName string, req JobRequestIndexAdvice) (suggestions []IndexSuggestion, err error) {
+	sdb, release, err := liveReadConn(baseDir, dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	defer release()
+	return SQLiteIndexAdvice(sdb, req.Queries)
+}
+
+// indexAdvisorCandidates returns the indexes to try out on a table for a query, best first.  The first is made from all
+// of the columns of the table compared for equality in the query, followed by the first one compared with a range.
+// Column names can be ambiguous between the tables of a query, so each of the columns on its own is tried after that
+func indexAdvisorCandidates(compared []indexAdvisorColumn, columns []string) (candidates [][]string) {
+	names := make(map[string]string)
+	for _, c := range columns {
+		names[strings.ToLower(c)] = c
+	}
+	var all []string
+	used := make(map[string]bool)
+	for _, equality := range []bool{true, false} {
+		for _, c := range compared {
+			col, ok := names[strings.ToLower(c.name)]
+			if !ok || c.equality != equality || used[col] {
+				continue
+			}
+			used[col] = true
+			all = append(all, col)
+			if !equality {
+				break
+			}
+		}
+	}
+	if len(all) == 0 {
+		return
+	}
+	if len(all) > IndexAdvisorMaxColumns {
+		all = all[:IndexAdvisorMaxColumns]
+	}
+	candidates = append(candidates, all)
+	if len(all) > 1 {
+		for _, c := range all {
+			candidates = append(candidates, []string{c})
+		}
+	}
+	return
+}
+
+// indexAdvisorColumns returns the names compared with something in a query, in the order they appear.  The query isn't
+// parsed properly, so some of them may not be columns, and the columns may be from any of the tables in the query
+func indexAdvisorColumns(query string) (columns []indexAdvisorColumn) {
+	tokens := indexAdvisorTokens(query)
+	operator := func(i int) (equality, ok bool) {
+		if i < 0 || i >= len(tokens) {
+			return false, false
+		}
+		switch strings.ToUpper(tokens[i]) {
+		case "=", "==", "IS", "IN":
+			return true, true
+		case "<", "<=", ">", ">=", "BETWEEN", "LIKE", "GLOB":
+			return false, true
+		}
+		return false, false
+	}
+	for i, t := range tokens {
+		if !indexAdvisorIdent(t) {
+			continue
+		}
+
+		// Qualified column names are compared by their last part
+		if i+1 < len(tokens) && tokens[i+1] == "." {
+			continue
+		}
+		if equality, ok := operator(i + 1); ok {
+			columns = append(columns, indexAdvisorColumn{equality: equality, name: indexAdvisorUnquote(t)})
+			continue
+		}
+		start := i
+		if i >= 2 && tokens[i-1] == "." {
+			start = i - 2
+		}
+		if equality, ok := operator(start - 1); ok && strings.ToUpper(tokens[start-1]) != "IN" {
+			columns = append(columns, indexAdvisorColumn{equality: equality, name: indexAdvisorUnquote(t)})
+		}
+	}
+	return
+}
+
+// indexAdvisorHelps returns whether an index on the given columns of a table would let a query search the table
+// instead of scanning it.  The index is created in the in memory copy of the schema, then removed again
+func indexAdvisorHelps(mem *sqlite.Conn, query, table string, columns []string) bool {
+	err := mem.Exec(fmt.Sprintf("CREATE INDEX %s ON %s (%s)", EscapeId(indexAdvisorCandidate), EscapeId(table),
+		strings.Join(EscapeIds(columns), ", ")))
+	if err != nil {
+		return false
+	}
+	defer mem.Exec("DROP INDEX " + EscapeId(indexAdvisorCandidate))
+	plan, ok := indexAdvisorPlan(mem, query)
+	if !ok {
+		return false
+	}
+	for _, step := range strings.Split(plan, "\n") {
+		if strings.HasPrefix(step, "SEARCH ") && strings.Contains(step, "INDEX "+indexAdvisorCandidate+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// indexAdvisorIdent returns whether a token of a query is an identifier
+func indexAdvisorIdent(token string) bool {
+	switch token[0] {
+	case '"', '`', '[':
+		return true
+	}
+	if token[0] != '_' && !(token[0] >= 'a' && token[0] <= 'z') && !(token[0] >= 'A' && token[0] <= 'Z') {
+		return false
+	}
+	switch strings.ToUpper(token) {
+	case "AND", "BETWEEN", "GLOB", "IN", "IS", "LIKE", "NOT", "NULL", "OR", "SELECT", "WHERE":
+		return false
+	}
+	return true
+}
+
+// indexAdvisorPlan returns the steps of the query plan of a query, one per line.  ok is false when the query can't be
+// explained, such as when it isn't valid SQL
+func indexAdvisorPlan(mem *sqlite.Conn, query string) (plan string, ok bool) {
+	stmt, err := mem.Prepare("EXPLAIN QUERY PLAN " + strings.TrimSpace(query))
+	if err != nil {
+		return
+	}
+	defer stmt.Finalize()
+	var steps []string
+	err = stmt.Select(func(s *sqlite.Stmt) error {
+		var id, parent, notUsed int
+		var detail string
+		if err := s.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			return err
+		}
+		steps = append(steps, detail)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	return strings.Join(steps, "\n"), true
+}
+
+// indexAdvisorTokens splits a query into its tokens, leaving out white space and comments
+func indexAdvisorTokens(query string) (tokens []string) {
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				return
+			}
+			i += end
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return
+			}
+			i += end + 4
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			j := i + 1
+			for j < len(query) {
+				if query[j] == closing {
+					if closing != ']' && j+1 < len(query) && query[j+1] == closing {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			if j >= len(query) {
+				return
+			}
+			tokens = append(tokens, query[i:j+1])
+			i = j + 1
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80:
+			j := i + 1
+			for j < len(query) {
+				d := query[j]
+				if d != '_' && d != '$' && !(d >= 'a' && d <= 'z') && !(d >= 'A' && d <= 'Z') &&
+					!(d >= '0' && d <= '9') && d < 0x80 {
+					break
+				}
+				j++
+			}
+			tokens = append(tokens, query[i:j])
+			i = j
+		default:
+			n := 1
+			if i+1 < len(query) {
+				switch query[i : i+2] {
+				case "==", "<=", ">=", "!=", "<>":
+					n = 2
+				}
+			}
+			tokens = append(tokens, query[i:i+n])
+			i += n
+		}
+	}
+	return
+}
+
+// indexAdvisorUnquote removes the quotes from a quoted identifier
+func indexAdvisorUnquote(ident string) string {
+	switch ident[0] {
+	case '"', '`':
+		q := ident[:1]
+		return strings.ReplaceAll(ident[1:len(ident)-1], q+q, q)
+	case '[':
+		return ident[1 : len(ident)-1]
+	}
+	return ident
+}
@@ -0,0 +1,361 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// AddLicence adds a user supplied licence to the system, after checking it doesn't clash with a licence already
+// available to the user
+func AddLicence(userName, licenceID, fullName, sourceURL, fileFormat string, displayOrder int, txt []byte) (httpStatus int, err error) {
+	// Only plain text and html licences are supported
+	if fileFormat != "text" && fileFormat != "html" {
+		return http.StatusBadRequest, fmt.Errorf("Unknown file format: %s", fileFormat)
+	}
+
+	// Ensure a licence by the same name (for this user) doesn't already exist, and the supplied display order isn't
+	// already used
+	licList, err := database.GetLicences(userName)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	for i, j := range licList {
+		if i == licenceID {
+			return http.StatusConflict, fmt.Errorf("A licence with that short name/id already exists")
+		}
+		if displayOrder == j.Order {
+			return http.StatusConflict, fmt.Errorf("That display order number is already used by another licence")
+		}
+	}
+
+	// Make sure this licence isn't a duplicate of an existing one
+	tmpSHA := sha256.Sum256(txt)
+	licCheckName, licCheckURL, err := database.GetLicenceInfoFromSha256(userName, hex.EncodeToString(tmpSHA[:]))
+	if err != nil && err.Error() != "No matching licence found, something has gone wrong!" {
+		return http.StatusInternalServerError, err
+	}
+	if licCheckName != "" || licCheckURL != "" {
+		return http.StatusConflict, fmt.Errorf("This licence is already in the system, using the short name of '%s'",
+			licCheckName)
+	}
+
+	// Save the licence in the database
+	err = database.StoreLicence(userName, licenceID, txt, sourceURL, displayOrder, fullName, fileFormat)
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Something went wrong when storing the new licence file: '%s'",
+			err.Error())
+	}
+	return http.StatusCreated, nil
+}
+
+// ForkLicenceWarnings returns the compatibility warnings for changing the licence of a forked database, based on the
+// licence of the default branch of the database it was forked from.  Databases which aren't forks don't have any
+func ForkLicenceWarnings(dbOwner, dbName, licenceName string) (warnings []string, err error) {
+	forkOwner, forkName, forkDeleted, err := database.ForkedFrom(dbOwner, dbName)
+	if err != nil || forkOwner == "" || forkDeleted {
+		return
+	}
+	branchName, err := database.GetDefaultBranchName(forkOwner, forkName)
+	if err != nil {
+		return
+	}
+	parentLic, err := branchLicence(forkOwner, forkName, branchName)
+	if err != nil || parentLic == "" {
+		return
+	}
+	if w := licenceWarning(parentLic, licenceName); w != "" {
+		warnings = append(warnings, w)
+	}
+	return
+}
+
+// LicenceCompatible returns whether data under one licence can be used in data under another, according to the
+// compatibility matrix in the config file.  Licences not in the matrix are reported as not known
+func LicenceCompatible(from, to string) (compatible, known bool) {
+	if from == to {
+		return true, true
+	}
+	allowed, ok := config.Conf.Licence.Compatibility[from]
+	if !ok {
+		return false, false
+	}
+	for _, l := range allowed {
+		if l == "*" || l == to {
+			return true, true
+		}
+	}
+	return false, true
+}
+
+// LicenceHistory returns the commits in the history of a database branch which changed its licence, newest first.
+// The initial commit of the branch is always included, as it sets the first licence
+func LicenceHistory(dbOwner, dbName, branchName string) (history []LicenceChange, err error) {
+	branches, err := database.GetBranches(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	head, ok := branches[branchName]
+	if !ok {
+		return nil, fmt.Errorf("Unknown branch name: '%s'", branchName)
+	}
+	commitList, err := database.GetCommitList(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+
+	// Look up the name of each licence only once, as most commits use the same one
+	type licInfo struct {
+		name string
+		url  string
+	}
+	lics := make(map[string]licInfo)
+	licence := func(sha string) (l licInfo, err error) {
+		if sha == "" {
+			return
+		}
+		l, ok := lics[sha]
+		if ok {
+			return
+		}
+		l.name, l.url, err = database.GetLicenceInfoFromSha256(dbOwner, sha)
+		if err != nil {
+			return
+		}
+		lics[sha] = l
+		return
+	}
+
+	// Walk back through the branch history, noting the commits where the licence differs from the one in their parent
+	for id := head.Commit; id != ""; {
+		c, ok := commitList[id]
+		if !ok {
+			return nil, fmt.Errorf("Commit '%s' is missing from the commit list", id)
+		}
+		sha := c.Tree.Entries[0].LicenceSHA
+		var parentSHA string
+		if c.Parent != "" {
+			p, ok := commitList[c.Parent]
+			if !ok {
+				return nil, fmt.Errorf("Commit '%s' is missing from the commit list", c.Parent)
+			}
+			parentSHA = p.Tree.Entries[0].LicenceSHA
+		}
+		if c.Parent == "" || sha != parentSHA {
+			var newLic, oldLic licInfo
+			newLic, err = licence(sha)
+			if err != nil {
+				return
+			}
+			oldLic, err = licence(parentSHA)
+			if err != nil {
+				return
+			}
+			history = append(history, LicenceChange{
+				AuthorName:      c.AuthorName,
+				CommitID:        c.ID,
+				Licence:         newLic.name,
+				LicenceURL:      newLic.url,
+				Message:         c.Message,
+				PreviousLicence: oldLic.name,
+				Timestamp:       c.Timestamp,
+			})
+		}
+		id = c.Parent
+	}
+	return
+}
+
+// MergeRequestLicenceWarnings returns the compatibility warnings for a merge request.  When merged, the destination
+// branch takes on the licence of the newest commit in the merge request, so the data already in the branch and the data
+// in each of the commits needs to be usable under that licence
+func MergeRequestLicenceWarnings(destOwner, destName string, mr database.MergeRequestEntry) (warnings []string, err error) {
+	if len(mr.Commits) == 0 {
+		return
+	}
+	destLic, err := branchLicence(destOwner, destName, mr.DestBranch)
+	if err != nil || destLic == "" {
+		return
+	}
+
+	// Gather the licences used by the commits in the merge request
+	lics := map[string]bool{destLic: true}
+	var newLic string
+	for i, c := range mr.Commits {
+		var name string
+		name, err = licenceName(mr.SourceOwner, c.Tree.Entries[0].LicenceSHA)
+		if err != nil {
+			return
+		}
+		if i == 0 {
+			newLic = name
+		}
+		lics[name] = true
+	}
+
+	for l := range lics {
+		if w := licenceWarning(l, newLic); w != "" {
+			warnings = append(warnings, w)
+		}
+	}
+	sort.Strings(warnings)
+	return
+}
+
+// NewLicenceCommit creates the commit which changes the licence of a database branch, on top of the branch's head
+// commit.  The database file itself is unchanged
+func NewLicenceCommit(loggedInUser string, parent database.CommitEntry, parentID, oldLic, newLic, newLicSHA string) (newCom database.CommitEntry, err error) {
+	// Create a new dbTree entry for the database file
+	dbEntry := parent.Tree.Entries[0]
+	var e database.DBTreeEntry
+	e.EntryType = database.DATABASE
+	e.LastModified = dbEntry.LastModified.UTC()
+	e.LicenceSHA = newLicSHA
+	e.Name = dbEntry.Name
+	e.Sha256 = dbEntry.Sha256
+	e.Size = dbEntry.Size
+
+	// Create a new dbTree structure for the new database entry
+	var t database.DBTree
+	t.Entries = append(t.Entries, e)
+	t.ID = CreateDBTreeID(t.Entries)
+
+	// Retrieve the user details
+	usr, err := database.User(loggedInUser)
+	if err != nil {
+		return
+	}
+
+	// Create a new commit for the new tree
+	newCom = database.CommitEntry{
+		AuthorEmail:    usr.Email,
+		AuthorName:     usr.DisplayName,
+		CommitterName:  parent.AuthorName,
+		CommitterEmail: parent.AuthorEmail,
+		Message:        fmt.Sprintf("Licence changed from '%s' to '%s'.", oldLic, newLic),
+		Parent:         parentID,
+		Timestamp:      time.Now().UTC(),
+		Tree:           t,
+	}
+
+	// Calculate the new commit ID, which incorporates the updated tree ID (and thus the new licence sha256)
+	newCom.ID = CreateCommitID(newCom)
+	return
+}
+
+// SetBranchLicence changes the licence of a database branch, by adding a new commit to it.  It returns the ID of the
+// branch's head commit afterwards, which is unchanged if the branch already used the licence
+func SetBranchLicence(loggedInUser, dbOwner, dbName, branchName, licenceName string) (commitID string, err error) {
+	branches, err := database.GetBranches(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	head, ok := branches[branchName]
+	if !ok {
+		return "", fmt.Errorf("Unknown branch name: '%s'", branchName)
+	}
+	commitList, err := database.GetCommitList(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	c, ok := commitList[head.Commit]
+	if !ok {
+		return "", fmt.Errorf("Commit '%s' is missing from the commit list", head.Commit)
+	}
+
+	// The licences available are the default ones, and the ones added by the database owner
+	newLicSHA, err := database.GetLicenceSha256FromName(dbOwner, licenceName)
+	if err != nil {
+		return "", fmt.Errorf("Unknown licence: '%s'", licenceName)
+	}
+	oldLicSHA := c.Tree.Entries[0].LicenceSHA
+	if newLicSHA == oldLicSHA {
+		return head.Commit, nil
+	}
+	var oldLic string
+	if oldLicSHA != "" {
+		oldLic, _, err = database.GetLicenceInfoFromSha256(dbOwner, oldLicSHA)
+		if err != nil {
+			return
+		}
+	}
+
+	// Add the new commit, and move the branch head to it
+	newCom, err := NewLicenceCommit(loggedInUser, c, head.Commit, oldLic, licenceName, newLicSHA)
+	if err != nil {
+		return
+	}
+	commitList[newCom.ID] = newCom
+	err = database.StoreCommits(dbOwner, dbName, commitList)
+	if err != nil {
+		return
+	}
+	branches[branchName] = database.BranchEntry{
+		Commit:      newCom.ID,
+		CommitCount: head.CommitCount + 1,
+		Description: head.Description,
+	}
+	err = database.StoreBranches(dbOwner, dbName, branches)
+	if err != nil {
+		return
+	}
+
+	// Invalidate the cached details of the database, as they include the licence
+	err = InvalidateCacheEntry(loggedInUser, dbOwner, dbName, "")
+	if err != nil {
+		return
+	}
+	return newCom.ID, nil
+}
+
+// branchLicence returns the name of the licence used by the head commit of a database branch.  An empty string is
+// returned if the branch doesn't exist
+func branchLicence(dbOwner, dbName, branchName string) (licence string, err error) {
+	branches, err := database.GetBranches(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	head, ok := branches[branchName]
+	if !ok {
+		return
+	}
+	commitList, err := database.GetCommitList(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	c, ok := commitList[head.Commit]
+	if !ok {
+		return "", fmt.Errorf("Commit '%s' is missing from the commit list", head.Commit)
+	}
+	return licenceName(dbOwner, c.Tree.Entries[0].LicenceSHA)
+}
+
+// licenceName returns the short name of a licence from its sha256, using the default licences and the ones added by
+// the given user
+func licenceName(userName, sha string) (name string, err error) {
+	if sha == "" {
+		return "Not specified", nil
+	}
+	name, _, err = database.GetLicenceInfoFromSha256(userName, sha)
+	return
+}
+
+// licenceWarning returns the warning for using data under one licence in data under another, or an empty string if
+// that's fine
+func licenceWarning(from, to string) string {
+	compatible, known := LicenceCompatible(from, to)
+	if !known {
+		return fmt.Sprintf("The compatibility of data licensed under '%s' with the '%s' licence isn't known.  "+
+			"Please check the terms of both licences.", from, to)
+	}
+	if !compatible {
+		return fmt.Sprintf("Data licensed under '%s' can't be relicensed under '%s'.", from, to)
+	}
+	return ""
+}
@@ -68,11 +68,20 @@ func LiveColumns(liveNode, loggedInUser, dbOwner, dbName, table string) (columns
 	return
 }
 
-// LiveCreateDB requests the job queue backend create a new live SQLite database
+// LiveCreateDB requests the job queue backend create a new live SQLite database.  It's placed on the least loaded
+// active live node, or on whichever node picks up the request first when none have reported their load yet
 func LiveCreateDB(dbOwner, dbName, objectID string) (liveNode string, err error) {
+	target, err := database.LivePlacementNode("")
+	if err != nil {
+		return
+	}
+	if target == "" {
+		target = "any"
+	}
+
 	// Send the database setup request to our job queue backend
 	var resp JobResponseDBCreate
-	err = JobSubmit(&resp, "any", "createdb", "", dbOwner, dbName, objectID)
+	err = JobSubmit(&resp, target, "createdb", "", dbOwner, dbName, objectID)
 	if err != nil {
 		return
 	}
@@ -109,6 +118,15 @@ func LiveDelete(liveNode, loggedInUser, dbOwner, dbName string) (err error) {
 
 // LiveExecute asks our job queue backend to execute a SQL statement on a database
 func LiveExecute(liveNode, loggedInUser, dbOwner, dbName, sql string) (rowsChanged int, err error) {
+	// Archived databases are read only
+	archived, err := database.CheckDBArchived(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	if archived {
+		return 0, database.ErrDBArchived
+	}
+
 	// Send the execute request to our job queue backend
 	var resp JobResponseDBExecute
 	err = JobSubmit(&resp, liveNode, "execute", loggedInUser, dbOwner, dbName, sql)
@@ -121,7 +139,7 @@ func LiveExecute(liveNode, loggedInUser, dbOwner, dbName, sql string) (rowsChang
 
 	// Handle error response from the live node
 	if resp.Err != "" {
-		err = errors.New(resp.Err)
+		err = liveError(resp.Err)
 		if !strings.HasPrefix(err.Error(), "don't use exec with") {
 			log.Printf("%s: an error was returned when retrieving the execution result for '%s/%s': '%v'", config.Conf.Live.Nodename, dbOwner, dbName, resp.Err)
 		}
@@ -168,7 +186,7 @@ func LiveQuery(liveNode, loggedInUser, dbOwner, dbName, query string) (rows SQLi
 
 	// Handle error response from the live node
 	if resp.Err != "" {
-		err = errors.New(resp.Err)
+		err = liveError(resp.Err)
 		log.Printf("%s: an error was returned when retrieving the query response for '%s/%s': '%v'", config.Conf.Live.Nodename, dbOwner, dbName, resp.Err)
 	}
 	return
@@ -306,6 +324,11 @@ func RemoveLiveDB(dbOwner, dbName string) (err error) {
 		return
 	}
 
+	// Close the pooled read only connections to the database and roll back its open transactions, so they're not used
+	// after it's gone
+	closeLiveReadConns(config.Conf.Live.StorageDir, dbOwner, dbName)
+	rollbackLiveTransactions(dbOwner, dbName)
+
 	// Delete the "live.sqlite" file
 	// NOTE: If this seems to leave wal or other files hanging around in actual production use, we could
 	//       instead use filepath.RemoveAll(dbDir).  That should kill the containing directory and
@@ -316,6 +339,15 @@ func RemoveLiveDB(dbOwner, dbName string) (err error) {
 		return
 	}
 
+	// Delete the WAL and shared memory files of the database, when they're present
+	for _, suffix := range []string{"-wal", "-shm"} {
+		err = os.Remove(dbPath + suffix)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Println(err)
+			return
+		}
+	}
+
 	// Remove the containing directory
 	err = os.Remove(dbDir)
 	if err != nil {
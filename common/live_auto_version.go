@@ -0,0 +1,271 @@
+package common
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+const (
+	// AutoVersionMessagePrefix starts the commit message of each automatic version of a live database.  It's how
+	// automatic versions are told apart from the other commits of a branch when pruning them
+	AutoVersionMessagePrefix = "Automatic version of live database"
+
+	// liveAutoVersionCheckInterval is how often the live nodes look for databases needing a new automatic version
+	liveAutoVersionCheckInterval = 30 * time.Second
+)
+
+// LiveAutoVersionLoop commits new versions of the automatically versioned live databases on this node to their target
+// databases, when they're due.  When ctx is cancelled the version being committed is finished off, then wg is marked as
+// done
+func LiveAutoVersionLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// Ensure a warning message is displayed on the console if the automatic versioning loop exits other than by shutting down
+	defer func() {
+		if ctx.Err() != nil {
+			log.Printf("%s: automatic versioning loop stopped", config.Conf.Live.Nodename)
+			return
+		}
+		log.Printf("%s: WARN: Automatic versioning loop exited", config.Conf.Live.Nodename)
+	}()
+
+	log.Printf("%s: automatic versioning loop started.  %v refresh.", config.Conf.Live.Nodename,
+		liveAutoVersionCheckInterval)
+	for {
+		list, err := database.LiveAutoVersionsDue(config.Conf.Live.Nodename)
+		if err == nil {
+			for _, a := range list {
+				if ctx.Err() != nil {
+					break
+				}
+				var versionErr string
+				commitID, err := liveAutoVersion(a)
+				if err != nil {
+					log.Printf("%s: automatic versioning of '%s/%s' failed: %v", config.Conf.Live.Nodename, a.DBOwner,
+						SanitiseLogString(a.DBName), err)
+					versionErr = err.Error()
+				}
+
+				subj := fmt.Sprintf("DBHub.io: automatic versioning of %s/%s is failing", a.DBOwner, a.DBName)
+				msg := fmt.Sprintf("Committing a new version of your live database '%s/%s' to '%s/%s' has failed %d "+
+					"times in a row.  The most recent error was:\n\n%s\n\nThe automatic versioning settings can be "+
+					"changed using the autoversionset API call.", a.DBOwner, a.DBName, a.DBOwner, a.Target,
+					database.LiveAutoVersionAlertFailures, versionErr)
+				err = database.LiveAutoVersionDone(a.DBOwner, a.DBName, a.LastChange, commitID, versionErr, subj, msg)
+				if err != nil {
+					log.Printf("%s: recording the automatic version of '%s/%s' failed: %v",
+						config.Conf.Live.Nodename, a.DBOwner, SanitiseLogString(a.DBName), err)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(liveAutoVersionCheckInterval):
+		}
+	}
+}
+
+// liveAutoVersion commits a copy of a live database to the branch of its target database, then prunes the older
+// automatic versions on the branch when only some of them are kept.  No commit is made when the live database is the
+// same as the head commit of the branch.  It returns the ID of the branch's head commit afterwards
+func liveAutoVersion(a database.LiveAutoVersion) (commitID string, err error) {
+	// Take a copy of the live database.  VACUUM INTO gives a consistent copy while the database keeps being used
+	dbPath := filepath.Join(config.Conf.Live.StorageDir, a.DBOwner, a.DBName, "live.sqlite")
+	tmpName := dbPath + ".autoversion"
+	os.Remove(tmpName)
+	defer os.Remove(tmpName)
+	err = func() (err error) {
+		defer liveDBUse(a.DBOwner, a.DBName, false, false)()
+		sdb, err := optimizeOpen(dbPath, true)
+		if err != nil {
+			return
+		}
+		defer sdb.Close()
+		if err = sdb.BusyTimeout(liveBusyTimeout); err != nil {
+			return
+		}
+		return sdb.Exec("VACUUM INTO ?", tmpName)
+	}()
+	if err != nil {
+		return
+	}
+
+	// Skip the commit when nothing has changed since the last one
+	newDB, err := os.Open(tmpName)
+	if err != nil {
+		return
+	}
+	defer newDB.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, newDB); err != nil {
+		return
+	}
+	if _, err = newDB.Seek(0, io.SeekStart); err != nil {
+		return
+	}
+	branches, err := database.GetBranches(a.DBOwner, a.Target)
+	if err != nil {
+		return
+	}
+	head, ok := branches[a.Branch]
+	if !ok {
+		return "", fmt.Errorf("Branch '%s' of '%s/%s' not found", a.Branch, a.DBOwner, a.Target)
+	}
+	commitList, err := database.GetCommitList(a.DBOwner, a.Target)
+	if err != nil {
+		return
+	}
+	if c, ok := commitList[head.Commit]; ok && len(c.Tree.Entries) > 0 &&
+		c.Tree.Entries[0].Sha256 == hex.EncodeToString(h.Sum(nil)) {
+		return head.Commit, nil
+	}
+
+	// Store the copy as a new commit, by the owner of the databases
+	msg := fmt.Sprintf("%s '%s'", AutoVersionMessagePrefix, a.DBName)
+	_, commitID, _, err = AddDatabase(a.DBOwner, a.DBOwner, a.Target, false, a.Branch, head.Commit,
+		database.KeepCurrentAccessType, "", msg, "", newDB, time.Now().UTC(), time.Time{}, "", "", "", "", nil, "",
+		AddDatabaseOptions{})
+	if err != nil {
+		return
+	}
+	log.Printf("%s: committed automatic version '%s' of '%s/%s' to '%s/%s'", config.Conf.Live.Nodename, commitID,
+		a.DBOwner, SanitiseLogString(a.DBName), a.DBOwner, SanitiseLogString(a.Target))
+
+	if a.Keep > 0 {
+		var newHead string
+		newHead, err = PruneAutoVersions(a.DBOwner, a.Target, a.Branch, a.Keep)
+		if err != nil {
+			return commitID, fmt.Errorf("Pruning the older versions failed: %w", err)
+		}
+		if newHead != "" {
+			commitID = newHead
+		}
+	}
+	return
+}
+
+// PruneAutoVersions removes the older automatic versions of a live database from a branch, keeping the given number of
+// the most recent ones.  Only the automatic versions at the top of the branch are looked at, stopping at the first
+// commit which isn't one.  The kept versions are placed on top of that commit, so they're given new commit IDs.
+// Nothing is pruned when the versions are also part of other branches, or have tags or releases on them.  The database
+// files of the pruned versions are left in storage.  It returns the ID of the branch's new head commit, which is empty
+// when nothing was pruned
+func PruneAutoVersions(dbOwner, dbName, branchName string, keep int) (headID string, err error) {
+	branches, err := database.GetBranches(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	head, ok := branches[branchName]
+	if !ok {
+		return "", fmt.Errorf("Branch '%s' not found", branchName)
+	}
+	commitList, err := database.GetCommitList(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+
+	// Gather the automatic versions at the top of the branch, newest first
+	var versions []database.CommitEntry
+	versionIDs := make(map[string]bool)
+	base := head.Commit
+	for base != "" {
+		c, ok := commitList[base]
+		if !ok {
+			return "", fmt.Errorf("Broken commit history encountered for branch '%s' in '%s/%s', when looking "+
+				"for commit '%s'", branchName, dbOwner, dbName, base)
+		}
+		if !strings.HasPrefix(c.Message, AutoVersionMessagePrefix) || len(c.OtherParents) > 0 {
+			break
+		}
+		versions = append(versions, c)
+		versionIDs[c.ID] = true
+		base = c.Parent
+	}
+	if len(versions) <= keep {
+		return
+	}
+
+	// Leave the history alone when other branches, tags, or releases point into it
+	tags, err := database.GetTags(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	for _, t := range tags {
+		if versionIDs[t.Commit] {
+			return
+		}
+	}
+	releases, err := database.GetReleases(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	for _, r := range releases {
+		if versionIDs[r.Commit] {
+			return
+		}
+	}
+	for name, b := range branches {
+		if name == branchName {
+			continue
+		}
+		for id := b.Commit; id != ""; {
+			if versionIDs[id] {
+				return
+			}
+			c, ok := commitList[id]
+			if !ok {
+				break
+			}
+			id = c.Parent
+		}
+	}
+
+	// Recreate the kept versions on top of the first commit which isn't an automatic version, oldest first
+	headID = base
+	for i := keep - 1; i >= 0; i-- {
+		c := versions[i]
+		c.Parent = headID
+		c.ID = CreateCommitID(c)
+		commitList[c.ID] = c
+		headID = c.ID
+	}
+
+	// Move the branch over to the new commits before removing the old ones, so it never points at a missing commit
+	err = database.StoreCommits(dbOwner, dbName, commitList)
+	if err != nil {
+		return
+	}
+	branches[branchName] = database.BranchEntry{
+		Commit:      headID,
+		CommitCount: head.CommitCount - (len(versions) - keep),
+		Description: head.Description,
+	}
+	err = database.StoreBranches(dbOwner, dbName, branches)
+	if err != nil {
+		return
+	}
+	for _, c := range versions {
+		delete(commitList, c.ID)
+	}
+	err = database.StoreCommits(dbOwner, dbName, commitList)
+	if err != nil {
+		return
+	}
+
+	// Invalidate the cached details of the database, as the commit history has changed
+	err = InvalidateCacheEntry(dbOwner, dbOwner, dbName, "")
+	return
+}
@@ -0,0 +1,323 @@
+package common
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+const (
+	// LiveBulkBatchSize is the default number of rows in each batch of a bulk operation which isn't atomic
+	LiveBulkBatchSize = 1000
+
+	// LiveBulkMaxBatchSize is the maximum number of rows which can be requested for each batch of a bulk operation
+	LiveBulkMaxBatchSize = 10000
+
+	// LiveBulkMaxRows is the maximum number of rows accepted by a bulk operation
+	LiveBulkMaxRows = 100000
+)
+
+// LiveBulkOperation is the kind of change a bulk operation makes to the rows of a live database table
+type LiveBulkOperation string
+
+const (
+	LiveBulkDelete LiveBulkOperation = "delete"
+	LiveBulkInsert LiveBulkOperation = "insert"
+	LiveBulkUpsert LiveBulkOperation = "upsert"
+)
+
+// JobRequestBulk holds the data used when making a bulk operation request to our job queue backend
+type JobRequestBulk struct {
+	Columns   []string          `json:"columns"`
+	Operation LiveBulkOperation `json:"operation"`
+	Rows      [][]interface{}   `json:"rows"`
+	Table     string            `json:"table"`
+}
+
+// LiveBulkResult is the outcome of a bulk operation.  When it isn't atomic, the batches before the first failing one
+// stay committed
+type LiveBulkResult struct {
+	Batches          int    `json:"batches"`
+	BatchesCommitted int    `json:"batches_committed"`
+	Error            string `json:"error,omitempty"`
+	RowsChanged      int    `json:"rows_changed"`
+}
+
+// LiveBulk runs a bulk operation on a table of a live database.  When atomic is true all of the rows are changed in one
+// transaction, so either all of them are changed or none of them are.  Otherwise, the rows are sent to the live node in
+// batches of batchSize rows, each in its own transaction, stopping at the first batch which fails
+func LiveBulk(liveNode, loggedInUser, dbOwner, dbName string, req JobRequestBulk, batchSize int, atomic bool) (result LiveBulkResult, err error) {
+	// Archived databases are read only
+	archived, err := database.CheckDBArchived(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	if archived {
+		return result, database.ErrDBArchived
+	}
+
+	// Split the rows into batches
+	var batches [][][]interface{}
+	if atomic || batchSize <= 0 {
+		batches = append(batches, req.Rows)
+	} else {
+		for i := 0; i < len(req.Rows); i += batchSize {
+			end := i + batchSize
+			if end > len(req.Rows) {
+				end = len(req.Rows)
+			}
+			batches = append(batches, req.Rows[i:end])
+		}
+	}
+	result.Batches = len(batches)
+
+	for _, b := range batches {
+		batch := req
+		batch.Rows = b
+
+		// Serialise the bulk request to JSON.  It ends up base64 encoded in the job details, the same as row data
+		// requests
+		var reqJSON []byte
+		reqJSON, err = json.Marshal(batch)
+		if err != nil {
+			return
+		}
+
+		// Send the bulk request to our job queue backend
+		var resp JobResponseDBExecute
+		err = JobSubmit(&resp, liveNode, "bulk", loggedInUser, dbOwner, dbName, reqJSON)
+		if err != nil {
+			return
+		}
+		if resp.Err != "" {
+			result.Error = resp.Err
+			break
+		}
+		result.BatchesCommitted++
+		result.RowsChanged += resp.RowsChanged
+	}
+
+	// Update the "last_modified" field for the database, if anything was changed
+	if result.BatchesCommitted > 0 {
+		err = database.UpdateModified(dbOwner, dbName)
+	}
+	return
+}
+
+// ParseBulkRows reads the rows of a bulk operation.  The format is either "json", for a JSON array of objects holding
+// the column values of each row, or "csv", for CSV data with the column names on its first line.  Empty CSV fields are
+// read as NULL
+func ParseBulkRows(format string, r io.Reader) (columns []string, rows [][]interface{}, err error) {
+	switch format {
+	case "", "json":
+		d := json.NewDecoder(r)
+		d.UseNumber()
+		var objs []map[string]interface{}
+		err = d.Decode(&objs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("The rows couldn't be read: %s", err)
+		}
+		if len(objs) == 0 {
+			return nil, nil, errors.New("No rows were given")
+		}
+		for c := range objs[0] {
+			columns = append(columns, c)
+		}
+		for i, o := range objs {
+			if len(o) != len(columns) {
+				return nil, nil, fmt.Errorf("Row %d doesn't have the same columns as the first row", i+1)
+			}
+			row := make([]interface{}, len(columns))
+			for j, c := range columns {
+				v, ok := o[c]
+				if !ok {
+					return nil, nil, fmt.Errorf("Row %d doesn't have the same columns as the first row", i+1)
+				}
+				if row[j], err = tableEditValue(v); err != nil {
+					return nil, nil, fmt.Errorf("Row %d has an invalid value for column '%s'", i+1, c)
+				}
+			}
+			rows = append(rows, row)
+			if len(rows) > LiveBulkMaxRows {
+				break
+			}
+		}
+	case "csv":
+		c := csv.NewReader(r)
+		columns, err = c.Read()
+		if err != nil {
+			return nil, nil, fmt.Errorf("The column names couldn't be read: %s", err)
+		}
+		c.FieldsPerRecord = len(columns)
+		for {
+			rec, err := c.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("The rows couldn't be read: %s", err)
+			}
+			row := make([]interface{}, len(rec))
+			for i, v := range rec {
+				if v != "" {
+					row[i] = v
+				}
+			}
+			rows = append(rows, row)
+			if len(rows) > LiveBulkMaxRows {
+				break
+			}
+		}
+		if len(rows) == 0 {
+			return nil, nil, errors.New("No rows were given")
+		}
+	default:
+		return nil, nil, errors.New("Unknown format.  It needs to be either 'json' or 'csv'")
+	}
+	if len(rows) > LiveBulkMaxRows {
+		return nil, nil, fmt.Errorf("Too many rows.  Up to %d rows can be changed at once", LiveBulkMaxRows)
+	}
+	return
+}
+
+// SQLiteBulkLive is used by our job queue backend nodes to run a bulk operation on a table of a live database, in a
+// single transaction
+func SQLiteBulkLive(baseDir, dbOwner, dbName, loggedInUser string, req JobRequestBulk) (rowsChanged int, err error) {
+	if err = liveTransactionCheck(dbOwner, dbName); err != nil {
+		return
+	}
+	sdb, err := OpenSQLiteDatabaseLive(baseDir, dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	defer sdb.Close()
+
+	// Only tables can be changed, not views
+	tables, err := Tables(sdb)
+	if err != nil {
+		return
+	}
+	found := false
+	for _, t := range tables {
+		if t == req.Table {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return 0, fmt.Errorf("Table '%s' not found", req.Table)
+	}
+
+	// Map the given column names to the columns of the table, so the statements only use names from the table schema
+	pks, implicitPk, other, err := GetPrimaryKeyAndOtherColumns(sdb, "main", req.Table)
+	if err != nil {
+		return
+	}
+	tableCols := make(map[string]string)
+	for _, c := range append(append([]string{}, pks...), other...) {
+		tableCols[strings.ToLower(c)] = c
+	}
+	var cols []string
+	given := make(map[string]bool)
+	for _, c := range req.Columns {
+		col, ok := tableCols[strings.ToLower(c)]
+		if !ok {
+			return 0, fmt.Errorf("Column '%s' not found", c)
+		}
+		if given[col] {
+			return 0, fmt.Errorf("Column '%s' is given more than once", c)
+		}
+		given[col] = true
+		cols = append(cols, col)
+	}
+	if len(cols) == 0 {
+		return 0, errors.New("No columns were given")
+	}
+	hasKey := len(pks) > 0
+	for _, p := range pks {
+		if !given[p] {
+			hasKey = false
+		}
+	}
+
+	// Work out the statement to run for each row
+	var sql string
+	params := "?" + strings.Repeat(", ?", len(cols)-1)
+	switch req.Operation {
+	case LiveBulkInsert:
+		sql = "INSERT INTO " + EscapeId(req.Table) + " (" + strings.Join(EscapeIds(cols), ", ") + ") VALUES (" +
+			params + ")"
+	case LiveBulkUpsert:
+		if implicitPk || !hasKey {
+			return 0, errors.New("Upserts need the values of all the primary key columns of the table")
+		}
+		var set []string
+		for _, c := range cols {
+			isKey := false
+			for _, p := range pks {
+				if c == p {
+					isKey = true
+				}
+			}
+			if !isKey {
+				set = append(set, EscapeId(c)+" = excluded."+EscapeId(c))
+			}
+		}
+		sql = "INSERT INTO " + EscapeId(req.Table) + " (" + strings.Join(EscapeIds(cols), ", ") + ") VALUES (" +
+			params + ") ON CONFLICT (" + strings.Join(EscapeIds(pks), ", ") + ") DO "
+		if len(set) == 0 {
+			sql += "NOTHING"
+		} else {
+			sql += "UPDATE SET " + strings.Join(set, ", ")
+		}
+	case LiveBulkDelete:
+		if !hasKey || len(cols) != len(pks) {
+			return 0, errors.New("Deletes need the values of the primary key columns of the table, and only those")
+		}
+		sql = "DELETE FROM " + EscapeId(req.Table) + " WHERE " + strings.Join(EscapeIds(cols), " = ? AND ") + " = ?"
+	default:
+		return 0, errors.New("Unknown bulk operation")
+	}
+
+	// Run the statement for each row, in one transaction
+	stmt, err := sdb.Prepare(sql)
+	if err != nil {
+		return
+	}
+	defer stmt.Finalize()
+	if err = sdb.Begin(); err != nil {
+		return
+	}
+	for i, row := range req.Rows {
+		if len(row) != len(cols) {
+			sdb.Rollback()
+			return 0, fmt.Errorf("Row %d doesn't have a value for each column", i+1)
+		}
+		args := make([]interface{}, len(row))
+		for j, v := range row {
+			if args[j], err = tableEditValue(v); err != nil {
+				sdb.Rollback()
+				return 0, fmt.Errorf("Row %d has an invalid value for column '%s'", i+1, cols[j])
+			}
+		}
+		if err = stmt.Exec(args...); err != nil {
+			sdb.Rollback()
+			return 0, fmt.Errorf("Row %d: %s", i+1, err)
+		}
+		rowsChanged += sdb.Changes()
+	}
+	err = sdb.Commit()
+	if err != nil {
+		log.Printf("%s: committing bulk %s on '%s/%s' by '%s' failed: %s", config.Conf.Live.Nodename, req.Operation,
+			SanitiseLogString(dbOwner), SanitiseLogString(dbName), SanitiseLogString(loggedInUser), err)
+		return 0, err
+	}
+	return
+}
@@ -0,0 +1,242 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+
+	sqlite "github.com/gwenn/gosqlite"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// LiveFTSMaxColumns is the maximum number of columns a full text search index can include
+const LiveFTSMaxColumns = 32
+
+// LiveFTSTokenizers are the tokenizers full text search indexes can use, and the FTS5 tokenize option for each of them
+var LiveFTSTokenizers = map[string]string{
+	"ascii":     "ascii",
+	"porter":    "porter unicode61",
+	"trigram":   "trigram",
+	"unicode61": "unicode61",
+}
+
+// JobRequestFTS holds the data used when making a full text search index request to our job queue backend
+type JobRequestFTS struct {
+	Columns   []string `json:"columns"`
+	Name      string   `json:"name"`
+	Table     string   `json:"table"`
+	Tokenizer string   `json:"tokenizer"`
+}
+
+// LiveFTSCreate creates a full text search index of a table in a live database.  The index is an FTS5 virtual table
+// using the table as its content, kept up to date by triggers on the table.  When the live node can't create the index,
+// such as for a missing column, the reason is returned in failure instead of err
+func LiveFTSCreate(liveNode, loggedInUser, dbOwner, dbName string, req JobRequestFTS) (failure string, err error) {
+	return liveFTSSubmit(liveNode, "ftscreate", loggedInUser, dbOwner, dbName, req)
+}
+
+// LiveFTSDrop removes a full text search index from a live database, along with the triggers keeping it up to date.  As
+// with LiveFTSCreate, the reason the live node couldn't remove it is returned in failure
+func LiveFTSDrop(liveNode, loggedInUser, dbOwner, dbName, name string) (failure string, err error) {
+	return liveFTSSubmit(liveNode, "ftsdrop", loggedInUser, dbOwner, dbName, JobRequestFTS{Name: name})
+}
+
+// liveFTSSubmit sends a full text search index request to our job queue backend
+func liveFTSSubmit(liveNode, op, loggedInUser, dbOwner, dbName string, req JobRequestFTS) (failure string, err error) {
+	// Archived databases are read only
+	archived, err := database.CheckDBArchived(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	if archived {
+		return "", database.ErrDBArchived
+	}
+
+	// Serialise the request to JSON.  It ends up base64 encoded in the job details, the same as bulk requests
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		return
+	}
+	var resp JobResponseDBError
+	err = JobSubmit(&resp, liveNode, op, loggedInUser, dbOwner, dbName, reqJSON)
+	if err != nil {
+		return
+	}
+	if resp.Err != "" {
+		return resp.Err, nil
+	}
+
+	// Update the "last_modified" field for the database
+	err = database.UpdateModified(dbOwner, dbName)
+	return
+}
+
+// liveFTSTriggers returns the names of the triggers keeping a full text search index up to date
+func liveFTSTriggers(name string) (insert, del, update string) {
+	return name + "_ai", name + "_ad", name + "_au"
+}
+
+// SQLiteFTSCreateLive is used by our job queue backend nodes to create a full text search index of a table in a live
+// database.  The FTS5 table, its triggers, and its initial contents are all created in one transaction
+func SQLiteFTSCreateLive(baseDir, dbOwner, dbName, loggedInUser string, req JobRequestFTS) (err error) {
+	tokenize, ok := LiveFTSTokenizers[req.Tokenizer]
+	if !ok {
+		return fmt.Errorf("Unknown tokenizer '%s'", req.Tokenizer)
+	}
+	if err = liveTransactionCheck(dbOwner, dbName); err != nil {
+		return
+	}
+
+	sdb, err := OpenSQLiteDatabaseLive(baseDir, dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	defer sdb.Close()
+
+	// Only tables can be indexed, not views
+	tables, err := Tables(sdb)
+	if err != nil {
+		return
+	}
+	found := false
+	for _, t := range tables {
+		if t == req.Table {
+			found = true
+		}
+		if strings.EqualFold(t, req.Name) {
+			return fmt.Errorf("A table called '%s' already exists", req.Name)
+		}
+	}
+	if !found {
+		return fmt.Errorf("Table '%s' not found", req.Table)
+	}
+
+	// The index refers to the rows of the table by their rowid, so tables without one can't be indexed
+	stmt, err := sdb.Prepare("SELECT rowid FROM " + EscapeId(req.Table) + " LIMIT 0")
+	if err != nil {
+		return fmt.Errorf("Table '%s' doesn't have a rowid, so can't have a full text search index", req.Table)
+	}
+	stmt.Finalize()
+
+	// Map the given column names to the columns of the table, so the statements only use names from the table schema
+	pks, _, other, err := GetPrimaryKeyAndOtherColumns(sdb, "main", req.Table)
+	if err != nil {
+		return
+	}
+	tableCols := make(map[string]string)
+	for _, c := range append(append([]string{}, pks...), other...) {
+		tableCols[strings.ToLower(c)] = c
+	}
+	var cols []string
+	given := make(map[string]bool)
+	for _, c := range req.Columns {
+		col, ok := tableCols[strings.ToLower(c)]
+		if !ok {
+			return fmt.Errorf("Column '%s' not found", c)
+		}
+		if given[col] {
+			return fmt.Errorf("Column '%s' is given more than once", c)
+		}
+		given[col] = true
+		cols = append(cols, col)
+	}
+	if len(cols) == 0 {
+		return errors.New("No columns were given")
+	}
+
+	// Work out the statements creating the index and its triggers
+	fts := EscapeId(req.Name)
+	table := EscapeId(req.Table)
+	colList := strings.Join(EscapeIds(cols), ", ")
+	var newCols, oldCols []string
+	for _, c := range cols {
+		newCols = append(newCols, "new."+EscapeId(c))
+		oldCols = append(oldCols, "old."+EscapeId(c))
+	}
+	insertRow := fmt.Sprintf("INSERT INTO %s (rowid, %s) VALUES (new.rowid, %s);", fts, colList,
+		strings.Join(newCols, ", "))
+	deleteRow := fmt.Sprintf("INSERT INTO %s (%s, rowid, %s) VALUES ('delete', old.rowid, %s);", fts, fts, colList,
+		strings.Join(oldCols, ", "))
+	insTrigger, delTrigger, updTrigger := liveFTSTriggers(req.Name)
+	statements := []string{
+		fmt.Sprintf("CREATE VIRTUAL TABLE %s USING fts5(%s, content=%s, content_rowid='rowid', tokenize=%s)", fts,
+			colList, sqlite.Mprintf("%Q", req.Table), sqlite.Mprintf("%Q", tokenize)),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER INSERT ON %s BEGIN %s END", EscapeId(insTrigger), table, insertRow),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER DELETE ON %s BEGIN %s END", EscapeId(delTrigger), table, deleteRow),
+		fmt.Sprintf("CREATE TRIGGER %s AFTER UPDATE ON %s BEGIN %s %s END", EscapeId(updTrigger), table, deleteRow,
+			insertRow),
+		fmt.Sprintf("INSERT INTO %s (%s) VALUES ('rebuild')", fts, fts),
+	}
+
+	// Run them in one transaction, so a failure doesn't leave part of the index behind
+	if err = sdb.Begin(); err != nil {
+		return
+	}
+	for _, s := range statements {
+		if err = sdb.Exec(s); err != nil {
+			sdb.Rollback()
+			return
+		}
+	}
+	err = sdb.Commit()
+	if err != nil {
+		log.Printf("%s: committing full text search index '%s' on '%s/%s' by '%s' failed: %s",
+			config.Conf.Live.Nodename, SanitiseLogString(req.Name), SanitiseLogString(dbOwner),
+			SanitiseLogString(dbName), SanitiseLogString(loggedInUser), err)
+	}
+	return
+}
+
+// SQLiteFTSDropLive is used by our job queue backend nodes to remove a full text search index from a live database,
+// along with its triggers
+func SQLiteFTSDropLive(baseDir, dbOwner, dbName, loggedInUser string, req JobRequestFTS) (err error) {
+	if err = liveTransactionCheck(dbOwner, dbName); err != nil {
+		return
+	}
+	sdb, err := OpenSQLiteDatabaseLive(baseDir, dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	defer sdb.Close()
+
+	// Make sure the table being removed is an FTS5 table, so this can't be used to drop other tables
+	var sql string
+	err = sdb.OneValue("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", &sql, req.Name)
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("Full text search index '%s' not found", req.Name)
+	}
+	if err != nil {
+		return
+	}
+	if !strings.Contains(strings.ToLower(sql), "using fts5") {
+		return fmt.Errorf("'%s' isn't a full text search index", req.Name)
+	}
+
+	// Remove the index and its triggers in one transaction
+	insTrigger, delTrigger, updTrigger := liveFTSTriggers(req.Name)
+	if err = sdb.Begin(); err != nil {
+		return
+	}
+	for _, s := range []string{
+		"DROP TRIGGER IF EXISTS " + EscapeId(insTrigger),
+		"DROP TRIGGER IF EXISTS " + EscapeId(delTrigger),
+		"DROP TRIGGER IF EXISTS " + EscapeId(updTrigger),
+		"DROP TABLE " + EscapeId(req.Name),
+	} {
+		if err = sdb.Exec(s); err != nil {
+			sdb.Rollback()
+			return
+		}
+	}
+	err = sdb.Commit()
+	if err != nil {
+		log.Printf("%s: committing the removal of full text search index '%s' on '%s/%s' by '%s' failed: %s",
+			config.Conf.Live.Nodename, SanitiseLogString(req.Name), SanitiseLogString(dbOwner),
+			SanitiseLogString(dbName), SanitiseLogString(loggedInUser), err)
+	}
+	return
+}
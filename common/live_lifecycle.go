@@ -0,0 +1,437 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+
+	sqlite "github.com/gwenn/gosqlite"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+const (
+	// liveDrainBatch is the most databases a draining node moves to other nodes each time around the lifecycle loop.
+	// The other nodes report their load in between, so the databases are spread across them
+	liveDrainBatch = 10
+
+	// liveLifecycleCheckInterval is how often the live nodes look for idle databases, and report their statistics
+	liveLifecycleCheckInterval = time.Minute
+)
+
+// liveDB tracks the use of a database on this live node.  Jobs hold its lock for reading while using the database, and
+// it's held for writing while the database file is created, removed, or evicted.  The other fields are protected by
+// the liveDBs mutex
+type liveDB struct {
+	active    int
+	jobs      int64
+	lastUsed  time.Time
+	lock      sync.RWMutex
+	warmDone  int64
+	warming   bool
+	warmMu    sync.Mutex
+	warmTotal int64
+}
+
+// liveDBs holds the use of the databases on this live node since it started
+var liveDBs = struct {
+	sync.Mutex
+	dbs       map[string]*liveDB
+	draining  bool
+	evictions int64
+	started   time.Time
+	warmUps   int64
+}{
+	dbs:     make(map[string]*liveDB),
+	started: time.Now().UTC(),
+}
+
+// LiveLifecycleLoop periodically removes the databases which haven't been used for a while from this live node, after
+// backing them up to Minio, and reports the statistics of the node's databases.  When the node is being drained or
+// decommissioned, its databases are moved to other nodes instead.  When ctx is cancelled the pass being done is
+// finished off, then wg is marked as done
+func LiveLifecycleLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// Ensure a warning message is displayed on the console if the lifecycle loop exits other than by shutting down
+	defer func() {
+		if ctx.Err() != nil {
+			log.Printf("%s: database lifecycle loop stopped", config.Conf.Live.Nodename)
+			return
+		}
+		log.Printf("%s: WARN: Database lifecycle loop exited", config.Conf.Live.Nodename)
+	}()
+
+	log.Printf("%s: database lifecycle loop started.  %v refresh.", config.Conf.Live.Nodename,
+		liveLifecycleCheckInterval)
+	for {
+		state, err := database.LiveNodeState(config.Conf.Live.Nodename)
+		if err == nil {
+			liveDBs.Lock()
+			liveDBs.draining = state != "active"
+			liveDBs.Unlock()
+			if state != "active" {
+				liveDrain()
+			} else if config.Conf.Live.IdleTimeout > 0 {
+				liveEvictIdle()
+			}
+		}
+		database.SaveLiveNodeStats(liveNodeStats())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(liveLifecycleCheckInterval):
+		}
+	}
+}
+
+// liveDBEntry returns the tracking details for a database on this node, adding them if needed
+func liveDBEntry(dbOwner, dbName string) *liveDB {
+	key := filepath.Join(dbOwner, dbName)
+	liveDBs.Lock()
+	defer liveDBs.Unlock()
+	d, ok := liveDBs.dbs[key]
+	if !ok {
+		d = &liveDB{}
+		liveDBs.dbs[key] = d
+	}
+	return d
+}
+
+// liveDBUse marks a database on this node as being in use, returning the function to call when finished with it.
+// Exclusive use is for creating or removing the database file, and waits for everything else using the database to
+// finish first.  Otherwise, a database which was evicted for being idle is downloaded again.  When touch is true the
+// use counts as activity, which keeps the database from being evicted
+func liveDBUse(dbOwner, dbName string, exclusive, touch bool) (release func()) {
+	d := liveDBEntry(dbOwner, dbName)
+	if exclusive {
+		d.lock.Lock()
+	} else {
+		d.lock.RLock()
+		if err := liveWarm(dbOwner, dbName, d); err != nil {
+			log.Printf("%s: warming up '%s/%s' failed: %v", config.Conf.Live.Nodename, SanitiseLogString(dbOwner),
+				SanitiseLogString(dbName), err)
+		}
+	}
+
+	liveDBs.Lock()
+	d.active++
+	liveDBs.Unlock()
+	return func() {
+		liveDBs.Lock()
+		d.active--
+		if touch {
+			d.jobs++
+			d.lastUsed = time.Now().UTC()
+		}
+		liveDBs.Unlock()
+		if exclusive {
+			d.lock.Unlock()
+		} else {
+			d.lock.RUnlock()
+		}
+	}
+}
+
+// liveDrain moves a batch of the databases on this node to other nodes
+func liveDrain() {
+	moved := 0
+	for _, db := range liveLocalDBs() {
+		if moved == liveDrainBatch {
+			return
+		}
+		target, err := liveMove(db[0], db[1])
+		if err != nil {
+			log.Printf("%s: moving database '%s/%s' to another node failed: %v", config.Conf.Live.Nodename,
+				SanitiseLogString(db[0]), SanitiseLogString(db[1]), err)
+			continue
+		}
+		if target != "" {
+			log.Printf("%s: moved database '%s/%s' to node '%s'", config.Conf.Live.Nodename,
+				SanitiseLogString(db[0]), SanitiseLogString(db[1]), target)
+			moved++
+		}
+	}
+}
+
+// liveEvict backs up a database on this node to Minio, then removes it from the node.  It's skipped if the database was
+// used while waiting for the jobs using it to finish
+func liveEvict(dbOwner, dbName string, idleSince time.Time) (evicted bool, err error) {
+	d := liveDBEntry(dbOwner, dbName)
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	liveDBs.Lock()
+	used := d.lastUsed.After(idleSince)
+	liveDBs.Unlock()
+	if used {
+		return false, nil
+	}
+
+	// Only remove databases this node is meant to hold, so they can be downloaded again later
+	isLive, liveNode, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	if !isLive || liveNode != config.Conf.Live.Nodename {
+		return false, nil
+	}
+
+	err = SQLiteBackupLive(config.Conf.Live.StorageDir, dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	err = RemoveLiveDB(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	liveDBs.Lock()
+	liveDBs.evictions++
+	liveDBs.Unlock()
+	return true, nil
+}
+
+// liveEvictIdle removes the databases on this node which haven't been used for longer than the idle timeout
+func liveEvictIdle() {
+	idleSince := time.Now().UTC().Add(-config.Conf.Live.IdleTimeout * time.Minute)
+	for _, db := range liveLocalDBs() {
+		if liveLastUsed(db[0], db[1]).After(idleSince) {
+			continue
+		}
+		evicted, err := liveEvict(db[0], db[1], idleSince)
+		if err != nil {
+			log.Printf("%s: evicting idle database '%s/%s' failed: %v", config.Conf.Live.Nodename,
+				SanitiseLogString(db[0]), SanitiseLogString(db[1]), err)
+			continue
+		}
+		if evicted {
+			log.Printf("%s: evicted idle database '%s/%s'", config.Conf.Live.Nodename, SanitiseLogString(db[0]),
+				SanitiseLogString(db[1]))
+		}
+	}
+}
+
+// liveLastUsed returns when a database on this node was last used.  For databases which haven't been used since the
+// node started, the time their files were last changed is used instead
+func liveLastUsed(dbOwner, dbName string) (lastUsed time.Time) {
+	liveDBs.Lock()
+	if d, ok := liveDBs.dbs[filepath.Join(dbOwner, dbName)]; ok {
+		lastUsed = d.lastUsed
+	}
+	liveDBs.Unlock()
+	if !lastUsed.IsZero() {
+		return
+	}
+	dbPath := filepath.Join(config.Conf.Live.StorageDir, dbOwner, dbName, "live.sqlite")
+	for _, p := range []string{dbPath, dbPath + "-wal"} {
+		if f, err := os.Stat(p); err == nil && f.ModTime().After(lastUsed) {
+			lastUsed = f.ModTime().UTC()
+		}
+	}
+	return
+}
+
+// liveLocalDBs returns the owner and name of each database stored on this node
+func liveLocalDBs() (list [][2]string) {
+	owners, err := os.ReadDir(config.Conf.Live.StorageDir)
+	if err != nil {
+		log.Printf("%s: reading the list of local databases failed: %v", config.Conf.Live.Nodename, err)
+		return
+	}
+	for _, o := range owners {
+		if !o.IsDir() {
+			continue
+		}
+		names, err := os.ReadDir(filepath.Join(config.Conf.Live.StorageDir, o.Name()))
+		if err != nil {
+			continue
+		}
+		for _, n := range names {
+			_, err = os.Stat(filepath.Join(config.Conf.Live.StorageDir, o.Name(), n.Name(), "live.sqlite"))
+			if n.IsDir() && err == nil {
+				list = append(list, [2]string{o.Name(), n.Name()})
+			}
+		}
+	}
+	return
+}
+
+// liveMove moves a database from this node to the least loaded of the other active nodes.  It's backed up to Minio and
+// removed from this node, and the other node downloads it when it's next used.  An empty target is returned when the
+// database isn't meant to be on this node, so wasn't moved
+func liveMove(dbOwner, dbName string) (target string, err error) {
+	d := liveDBEntry(dbOwner, dbName)
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	isLive, liveNode, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	if !isLive || liveNode != config.Conf.Live.Nodename {
+		return "", nil
+	}
+	target, err = database.LivePlacementNode(config.Conf.Live.Nodename)
+	if err != nil {
+		return
+	}
+	if target == "" {
+		return "", errors.New("No other live node is available")
+	}
+
+	err = SQLiteBackupLive(config.Conf.Live.StorageDir, dbOwner, dbName)
+	if err != nil {
+		return "", err
+	}
+	moved, err := database.LiveMoveDatabase(dbOwner, dbName, config.Conf.Live.Nodename, target)
+	if err != nil || !moved {
+		return "", err
+	}
+	err = RemoveLiveDB(dbOwner, dbName)
+	return
+}
+
+// liveNodeDraining returns whether this node is being drained or decommissioned, so shouldn't take on new databases
+func liveNodeDraining() bool {
+	liveDBs.Lock()
+	defer liveDBs.Unlock()
+	return liveDBs.draining
+}
+
+// liveNodeStats returns the current statistics of this node and the databases it holds
+func liveNodeStats() (stats database.LiveNodeStats) {
+	stats.NodeName = config.Conf.Live.Nodename
+	seen := make(map[string]bool)
+	for _, db := range liveLocalDBs() {
+		key := filepath.Join(db[0], db[1])
+		seen[key] = true
+		s := database.LiveDBStats{
+			DBName:   db[1],
+			DBOwner:  db[0],
+			LastUsed: liveLastUsed(db[0], db[1]),
+			State:    "closed",
+		}
+		s.Size, _ = liveDatabaseSize(config.Conf.Live.StorageDir, db[0], db[1])
+		liveReadPool.Lock()
+		s.Connections = len(liveReadPool.idle[filepath.Join(config.Conf.Live.StorageDir, key)])
+		liveReadPool.Unlock()
+		liveDBs.Lock()
+		if d, ok := liveDBs.dbs[key]; ok {
+			s.Connections += d.active
+			s.Jobs = d.jobs
+			if d.warming {
+				s.State = "warming"
+				s.WarmDone, s.WarmTotal = d.warmDone, d.warmTotal
+			}
+		}
+		liveDBs.Unlock()
+		if s.State == "closed" && s.Connections > 0 {
+			s.State = "open"
+			stats.OpenDatabases++
+		}
+		stats.Databases = append(stats.Databases, s)
+	}
+
+	stats.DatabaseCount = len(stats.Databases)
+
+	// Include the resources left on the node, for choosing where to place new databases
+	var disk syscall.Statfs_t
+	if err := syscall.Statfs(config.Conf.Live.StorageDir, &disk); err == nil {
+		stats.DiskFree = int64(disk.Bavail) * int64(disk.Bsize)
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	stats.MemoryUsed = int64(mem.Sys) + sqlite.MemoryUsed()
+
+	liveDBs.Lock()
+	defer liveDBs.Unlock()
+	stats.Evictions = liveDBs.evictions
+	stats.Started = liveDBs.started
+	stats.WarmUps = liveDBs.warmUps
+
+	// Databases still being downloaded don't have their file in place yet, so aren't found above
+	for key, d := range liveDBs.dbs {
+		if !d.warming || seen[key] {
+			continue
+		}
+		owner, name := filepath.Split(key)
+		stats.Databases = append(stats.Databases, database.LiveDBStats{
+			DBName:    name,
+			DBOwner:   filepath.Clean(owner),
+			Jobs:      d.jobs,
+			LastUsed:  d.lastUsed,
+			State:     "warming",
+			WarmDone:  d.warmDone,
+			WarmTotal: d.warmTotal,
+		})
+	}
+	return
+}
+
+// liveWarm downloads a database this node is meant to hold from Minio when its file isn't on the node, which happens
+// after it's evicted for being idle.  It's opened straight away too, leaving the connection in the pool for the job
+// which needs it
+func liveWarm(dbOwner, dbName string, d *liveDB) (err error) {
+	d.warmMu.Lock()
+	defer d.warmMu.Unlock()
+	dbPath := filepath.Join(config.Conf.Live.StorageDir, dbOwner, dbName, "live.sqlite")
+	if _, err = os.Stat(dbPath); !errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+
+	// Only databases this node is meant to hold are downloaded
+	isLive, liveNode, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	if !isLive {
+		return nil
+	}
+	if liveNode != config.Conf.Live.Nodename {
+		return fmt.Errorf("The database has moved to live node '%s'", liveNode)
+	}
+	_, objectID, err := LiveGetMinioNames(dbOwner, dbOwner, dbName)
+	if err != nil {
+		return
+	}
+
+	// Download the database, keeping track of how much of it has arrived
+	log.Printf("%s: warming up '%s/%s'", config.Conf.Live.Nodename, SanitiseLogString(dbOwner),
+		SanitiseLogString(dbName))
+	start := time.Now()
+	liveDBs.Lock()
+	d.warming = true
+	liveDBs.Unlock()
+	_, err = LiveRetrieveDatabaseMinio(config.Conf.Live.StorageDir, dbOwner, dbName, objectID, func(done, total int64) {
+		liveDBs.Lock()
+		d.warmDone, d.warmTotal = done, total
+		liveDBs.Unlock()
+	})
+	liveDBs.Lock()
+	d.warming, d.warmDone, d.warmTotal = false, 0, 0
+	liveDBs.Unlock()
+	if err != nil {
+		// Don't leave a partial download behind, as it'd be used as the database
+		os.Remove(dbPath)
+		return
+	}
+
+	_, release, err := liveReadConn(config.Conf.Live.StorageDir, dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	release()
+	liveDBs.Lock()
+	liveDBs.warmUps++
+	liveDBs.Unlock()
+	log.Printf("%s: warmed up '%s/%s' in %v", config.Conf.Live.Nodename, SanitiseLogString(dbOwner),
+		SanitiseLogString(dbName), time.Since(start).Round(time.Millisecond))
+	return
+}
@@ -0,0 +1,245 @@
+package common
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	sqlite "github.com/gwenn/gosqlite"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+)
+
+// liveBusyTimeout is how long a connection to a live database waits for the locks of other connections to be released
+const liveBusyTimeout = 5 * time.Second
+
+// liveWriteOps are the job queue operations which change a live database, replace its file, or need to see all of the
+// changes submitted before them.  For each database they're run one at a time, in the order they were submitted.  Those
+// changing the contents of the database (bulk, execute, executeparams, ftscreate, ftsdrop, optimize, sandboxmerge) are
+// refused while a transaction is open on it, and they and committed transactions call liveAfterWrite once done.
+// Beginning and ending transactions are included, so changes submitted after a transaction ends aren't refused
+var liveWriteOps = map[string]bool{
+	"backup":          true,
+	"bulk":            true,
+	"createdb":        true,
+	"delete":          true,
+	"execute":         true,
+	"executeparams":   true,
+	"ftscreate":       true,
+	"ftsdrop":         true,
+	"optimize":        true,
+	"sandboxdiff":     true,
+	"sandboxmerge":    true,
+	"sandboxsnapshot": true,
+	"txbegin":         true,
+	"txcommit":        true,
+	"txrollback":      true,
+}
+
+// liveBackgroundOps are the job queue operations run in the background priority class.  They're only picked up when no
+// interactive jobs are waiting for the node, and only some of its workers run them, so large bulk changes, snapshots,
+// and optimisations don't hold up users waiting on queries
+var liveBackgroundOps = map[string]bool{
+	"backup":          true,
+	"bulk":            true,
+	"optimize":        true,
+	"sandboxmerge":    true,
+	"sandboxsnapshot": true,
+}
+
+// Priority classes of the jobs in the job queue.  Lower values are picked up first
+const (
+	jobPriorityInteractive = 0
+	jobPriorityBackground  = 1
+)
+
+// jobPriority returns the priority class of a job queue operation
+func jobPriority(op string) int {
+	if liveBackgroundOps[op] {
+		return jobPriorityBackground
+	}
+	return jobPriorityInteractive
+}
+
+// liveReadPool holds the idle read only connections to the live databases on this node, so jobs reading a database
+// don't need to open it each time.  The generation of a database changes when its file is replaced or removed, so
+// connections opened before then are closed instead of being reused
+var liveReadPool = struct {
+	sync.Mutex
+	gen  map[string]uint64
+	idle map[string][]*sqlite.Conn
+	wal  map[string]bool
+}{
+	gen:  make(map[string]uint64),
+	idle: make(map[string][]*sqlite.Conn),
+	wal:  make(map[string]bool),
+}
+
+// liveJobRunner runs the jobs picked up from the job queue.  Up to a set number of jobs run at once, fewer of them
+// background jobs, and the jobs changing a database wait for the earlier jobs changing it to finish
+type liveJobRunner struct {
+	mu         sync.Mutex
+	background chan struct{}
+	slots      chan struct{}
+	writes     map[string]chan struct{}
+}
+
+// newLiveJobRunner returns a job runner which runs up to the given number of jobs at once, up to backgroundWorkers of
+// them being background jobs.  A negative number of background workers doesn't limit them
+func newLiveJobRunner(workers, backgroundWorkers int) *liveJobRunner {
+	if workers < 1 {
+		workers = 1
+	}
+	r := &liveJobRunner{
+		slots:  make(chan struct{}, workers),
+		writes: make(map[string]chan struct{}),
+	}
+	if backgroundWorkers >= 0 {
+		if backgroundWorkers < 1 {
+			backgroundWorkers = 1
+		}
+		r.background = make(chan struct{}, backgroundWorkers)
+	}
+	return r
+}
+
+// backgroundFree returns whether another background job can be started.  Background jobs are left in the queue when it
+// can't, for picking up once a running one finishes
+func (r *liveJobRunner) backgroundFree() bool {
+	return r.background == nil || len(r.background) < cap(r.background)
+}
+
+// run starts a job in the background, waiting first for a free slot.  The order of jobs changing the same database is
+// worked out before returning, so it's the order run() is called in
+func (r *liveJobRunner) run(op, dbOwner, dbName string, job func()) {
+	background := r.background != nil && liveBackgroundOps[op]
+	if background {
+		r.background <- struct{}{}
+	}
+	r.slots <- struct{}{}
+
+	var key string
+	var prev, done chan struct{}
+	if liveWriteOps[op] {
+		key = filepath.Join(dbOwner, dbName)
+		done = make(chan struct{})
+		r.mu.Lock()
+		prev = r.writes[key]
+		r.writes[key] = done
+		r.mu.Unlock()
+	}
+
+	go func() {
+		defer func() {
+			<-r.slots
+			if background {
+				<-r.background
+			}
+		}()
+		if prev != nil {
+			<-prev
+		}
+		job()
+		if done != nil {
+			close(done)
+			r.mu.Lock()
+			if r.writes[key] == done {
+				delete(r.writes, key)
+			}
+			r.mu.Unlock()
+		}
+	}()
+}
+
+// closeLiveReadConns closes the idle read only connections to a live database, and stops the ones in use from being
+// reused.  It's called when the database file is replaced or removed
+func closeLiveReadConns(baseDir, dbOwner, dbName string) {
+	key := filepath.Join(baseDir, dbOwner, dbName)
+	liveReadPool.Lock()
+	defer liveReadPool.Unlock()
+	for _, sdb := range liveReadPool.idle[key] {
+		sdb.Close()
+	}
+	delete(liveReadPool.idle, key)
+	delete(liveReadPool.wal, key)
+	liveReadPool.gen[key]++
+}
+
+// liveDatabaseSize returns the size of a live database on this node, including the changes in its WAL file which
+// haven't been copied back into the database file yet
+func liveDatabaseSize(baseDir, dbOwner, dbName string) (size int64, err error) {
+	dbPath := filepath.Join(baseDir, dbOwner, dbName, "live.sqlite")
+	db, err := os.Stat(dbPath)
+	if err != nil {
+		return
+	}
+	size = db.Size()
+	wal, err := os.Stat(dbPath + "-wal")
+	if errors.Is(err, fs.ErrNotExist) {
+		return size, nil
+	}
+	if err != nil {
+		return
+	}
+	return size + wal.Size(), nil
+}
+
+// liveReadConn returns a read only connection to a live database on this node, reusing an idle one when there is one.
+// The returned release function needs to be called when finished with the connection, instead of closing it
+func liveReadConn(baseDir, dbOwner, dbName string) (sdb *sqlite.Conn, release func(), err error) {
+	key := filepath.Join(baseDir, dbOwner, dbName)
+	liveReadPool.Lock()
+	gen := liveReadPool.gen[key]
+	if n := len(liveReadPool.idle[key]); n > 0 {
+		sdb = liveReadPool.idle[key][n-1]
+		liveReadPool.idle[key] = liveReadPool.idle[key][:n-1]
+		liveReadPool.Unlock()
+		return sdb, liveReadRelease(key, gen, sdb), nil
+	}
+	wal := liveReadPool.wal[key]
+	liveReadPool.Unlock()
+
+	// Read only connections can't change the journal mode, so make sure the database is in WAL mode first
+	if !wal {
+		var rw *sqlite.Conn
+		rw, err = OpenSQLiteDatabaseLive(baseDir, dbOwner, dbName)
+		if rw != nil {
+			rw.Close()
+		}
+		if err != nil {
+			return
+		}
+		liveReadPool.Lock()
+		if liveReadPool.gen[key] == gen {
+			liveReadPool.wal[key] = true
+		}
+		liveReadPool.Unlock()
+	}
+
+	sdb, err = openSQLiteDatabaseLive(baseDir, dbOwner, dbName, true)
+	if err != nil {
+		if sdb != nil {
+			sdb.Close()
+		}
+		return nil, nil, err
+	}
+	return sdb, liveReadRelease(key, gen, sdb), nil
+}
+
+// liveReadRelease returns the function giving a read only connection back to the pool.  The connection is closed
+// instead if the pool for the database is full, the database file has changed since it was opened, or it was left in
+// the middle of a transaction
+func liveReadRelease(key string, gen uint64, sdb *sqlite.Conn) func() {
+	return func() {
+		liveReadPool.Lock()
+		defer liveReadPool.Unlock()
+		if liveReadPool.gen[key] != gen || !sdb.GetAutocommit() ||
+			len(liveReadPool.idle[key]) >= config.Conf.Live.ReadConnections {
+			sdb.Close()
+			return
+		}
+		liveReadPool.idle[key] = append(liveReadPool.idle[key], sdb)
+	}
+}
@@ -0,0 +1,190 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	sqlite "github.com/gwenn/gosqlite"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// ErrQueryLimit is returned when a query on a live database is stopped for going over one of its limits
+var ErrQueryLimit = errors.New("Query limit exceeded")
+
+// QueryLimits holds the limits for a query on a live database.  Zero values mean there's no limit
+type QueryLimits struct {
+	MaxMemory int64
+	MaxRows   int
+	Timeout   time.Duration
+}
+
+// LiveQueryLimits returns the limits for the queries of a user on live databases.  The usage limits of the user are
+// used when they set them, otherwise the limits set for the whole instance are used
+func LiveQueryLimits(loggedInUser string) (limits QueryLimits, err error) {
+	maxMemory, maxRows, timeout, err := database.LiveQueryLimitsForUser(loggedInUser)
+	if err != nil {
+		return
+	}
+	if maxMemory < 0 {
+		maxMemory = config.Conf.Live.QueryMaxMemory
+	}
+	if maxRows < 0 {
+		maxRows = int64(config.Conf.Live.QueryMaxRows)
+	}
+	if timeout < 0 {
+		timeout = int64(config.Conf.Live.QueryTimeout)
+	}
+	if maxMemory > 0 {
+		limits.MaxMemory = maxMemory
+	}
+	if maxRows > 0 {
+		limits.MaxRows = int(maxRows)
+	}
+	if timeout > 0 {
+		limits.Timeout = time.Duration(timeout) * time.Second
+	}
+	return
+}
+
+// executeLimited runs a function executing a statement on a live database within the limits for the user, recording
+// the resources it used
+func executeLimited(sdb *sqlite.Conn, dbOwner, dbName, loggedInUser, sql string, execute func() (int, error)) (rowsChanged int, err error) {
+	limits, err := LiveQueryLimits(loggedInUser)
+	if err != nil {
+		return
+	}
+	logID, err := database.LogSQLiteQueryBefore("LIVE execute", dbOwner, dbName, loggedInUser, "-", "-", sql)
+	if err != nil {
+		return
+	}
+	limiter := startQueryLimits(sdb, limits)
+	rowsChanged, err = execute()
+	limiter.stop()
+	err = limiter.err(err)
+	database.LogSQLiteQueryAfter(logID, sqlite.MemoryUsed(), sqlite.MemoryHighwater(false), limiter.duration(), 0,
+		limiter.limitExceeded())
+	return
+}
+
+// liveError turns an error message returned by a live node back into an error, keeping query limit and transaction
+// errors recognisable with errors.Is()
+func liveError(msg string) error {
+	if msg == ErrTransactionNotFound.Error() {
+		return ErrTransactionNotFound
+	}
+	if msg == ErrTransactionInProgress.Error() {
+		return ErrTransactionInProgress
+	}
+	if msg == ErrTransactionLimit.Error() {
+		return ErrTransactionLimit
+	}
+	if strings.HasPrefix(msg, ErrQueryLimit.Error()+": ") {
+		return fmt.Errorf("%w%s", ErrQueryLimit, strings.TrimPrefix(msg, ErrQueryLimit.Error()))
+	}
+	return errors.New(msg)
+}
+
+// queryLimiter enforces the limits of a query while it runs.  The time and memory limits are checked by a watchdog
+// goroutine, which interrupts the query when either of them is exceeded
+type queryLimiter struct {
+	done     chan struct{}
+	exceeded string
+	limits   QueryLimits
+	memBase  int64
+	mu       sync.Mutex
+	rows     int
+	start    time.Time
+	stopped  chan struct{}
+}
+
+// startQueryLimits starts enforcing the limits of a query on a database connection.  stop() needs to be called when
+// the query has finished
+func startQueryLimits(sdb *sqlite.Conn, limits QueryLimits) *queryLimiter {
+	l := &queryLimiter{done: make(chan struct{}), limits: limits, memBase: sqlite.MemoryUsed(), start: time.Now(),
+		stopped: make(chan struct{})}
+	if limits.Timeout <= 0 && limits.MaxMemory <= 0 {
+		close(l.stopped)
+		return l
+	}
+	go func() {
+		defer close(l.stopped)
+		ticker := time.NewTicker(10 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-l.done:
+				return
+			case <-ticker.C:
+				var exceeded string
+				if limits.Timeout > 0 && time.Since(l.start) > limits.Timeout {
+					exceeded = "timeout"
+				} else if limits.MaxMemory > 0 && sqlite.MemoryUsed()-l.memBase > limits.MaxMemory {
+					exceeded = "memory"
+				}
+				if exceeded != "" {
+					l.setExceeded(exceeded)
+					sdb.Interrupt()
+					return
+				}
+			}
+		}
+	}()
+	return l
+}
+
+// addRow counts a row returned by the query, checking it doesn't go over the row limit
+func (l *queryLimiter) addRow() error {
+	l.rows++
+	if l.limits.MaxRows > 0 && l.rows > l.limits.MaxRows {
+		l.setExceeded("rows")
+		return l.err(nil)
+	}
+	return nil
+}
+
+// duration returns how long the query has been running for
+func (l *queryLimiter) duration() time.Duration {
+	return time.Since(l.start)
+}
+
+// err returns the error for the limit the query went over, or the given error when no limit was exceeded
+func (l *queryLimiter) err(err error) error {
+	switch l.limitExceeded() {
+	case "memory":
+		return fmt.Errorf("%w: the query used more than the %d MB of memory it's allowed", ErrQueryLimit,
+			l.limits.MaxMemory/1024/1024)
+	case "rows":
+		return fmt.Errorf("%w: the query returned more than the %d rows it's allowed.  Adding a LIMIT clause to it "+
+			"will return fewer rows", ErrQueryLimit, l.limits.MaxRows)
+	case "timeout":
+		return fmt.Errorf("%w: the query ran for longer than the %d seconds it's allowed", ErrQueryLimit,
+			int(l.limits.Timeout/time.Second))
+	}
+	return err
+}
+
+// limitExceeded returns the name of the limit the query went over, if any
+func (l *queryLimiter) limitExceeded() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.exceeded
+}
+
+// setExceeded records the limit the query went over.  Only the first one is kept
+func (l *queryLimiter) setExceeded(limit string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.exceeded == "" {
+		l.exceeded = limit
+	}
+}
+
+// stop stops the watchdog checking the time and memory limits
+func (l *queryLimiter) stop() {
+	close(l.done)
+	<-l.stopped
+}
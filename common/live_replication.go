@@ -0,0 +1,417 @@
+package common
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	sqlite "github.com/gwenn/gosqlite"
+	pgx "github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+const (
+	// liveReplicationCheckInterval is how often the live nodes look for databases needing replication
+	liveReplicationCheckInterval = 30 * time.Second
+
+	// liveReplicationTimeout is the longest a single replication is allowed to take
+	liveReplicationTimeout = 10 * time.Minute
+
+	// replicationMySQLNet is the network name our dialer is registered under with the MySQL driver
+	replicationMySQLNet = "dbhub-replication"
+)
+
+var (
+	// ErrReplicationTarget is returned when a replication target server isn't one we're allowed to connect to
+	ErrReplicationTarget = errors.New("Replication target not allowed")
+
+	// registerReplicationDialer makes sure our dialer is only registered with the MySQL driver once
+	registerReplicationDialer sync.Once
+
+	// replicationDialer is used for all connections to replication targets
+	replicationDialer = &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: replicationDialControl,
+	}
+)
+
+// replicationDialect holds the differences in SQL between the kinds of servers live databases can be replicated to
+type replicationDialect struct {
+	placeholder func(n int) string
+	quote       func(id string) string
+	types       map[string]string
+}
+
+var replicationDialects = map[string]replicationDialect{
+	"mysql": {
+		placeholder: func(n int) string { return "?" },
+		quote:       func(id string) string { return "`" + strings.ReplaceAll(id, "`", "``") + "`" },
+		types: map[string]string{
+			"blob":    "LONGBLOB",
+			"integer": "BIGINT",
+			"key":     "VARCHAR(255)",
+			"real":    "DOUBLE",
+			"text":    "LONGTEXT",
+		},
+	},
+	"postgresql": {
+		placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+		quote:       func(id string) string { return `"` + strings.ReplaceAll(id, `"`, `""`) + `"` },
+		types: map[string]string{
+			"blob":    "BYTEA",
+			"integer": "BIGINT",
+			"key":     "TEXT",
+			"real":    "DOUBLE PRECISION",
+			"text":    "TEXT",
+		},
+	},
+}
+
+// replicationColumn is a column being replicated, with the kind of data it holds
+type replicationColumn struct {
+	kind   string
+	pk     bool
+	source string
+	target string
+}
+
+// LiveReplicationLoop replicates the live databases on this node to their external servers, when they're due.  When
+// ctx is cancelled the database being replicated is finished off, then wg is marked as done
+func LiveReplicationLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	if !config.Conf.Replication.Enabled {
+		return
+	}
+
+	// Ensure a warning message is displayed on the console if the replication loop exits other than by shutting down
+	defer func() {
+		if ctx.Err() != nil {
+			log.Printf("%s: replication loop stopped", config.Conf.Live.Nodename)
+			return
+		}
+		log.Printf("%s: WARN: Replication loop exited", config.Conf.Live.Nodename)
+	}()
+
+	log.Printf("%s: replication loop started.  %v refresh.", config.Conf.Live.Nodename, liveReplicationCheckInterval)
+	for {
+		list, err := database.LiveReplicationsDue(config.Conf.Live.Nodename)
+		if err == nil {
+			for _, r := range list {
+				if ctx.Err() != nil {
+					break
+				}
+				var syncErr string
+				if err = liveReplicate(r); err != nil {
+					log.Printf("%s: replicating '%s/%s' failed: %v", config.Conf.Live.Nodename, r.DBOwner,
+						SanitiseLogString(r.DBName), err)
+					syncErr = err.Error()
+				}
+
+				subj := fmt.Sprintf("DBHub.io: replication of %s/%s is failing", r.DBOwner, r.DBName)
+				msg := fmt.Sprintf("Replicating your live database '%s/%s' to its %s server has failed %d times "+
+					"in a row.  The most recent error was:\n\n%s\n\nThe replication settings can be changed using "+
+					"the replicationset API call.", r.DBOwner, r.DBName, r.TargetType,
+					database.LiveReplicationAlertFailures, syncErr)
+				err = database.LiveReplicationSynced(r.DBOwner, r.DBName, syncErr, subj, msg)
+				if err != nil {
+					log.Printf("%s: recording the replication of '%s/%s' failed: %v", config.Conf.Live.Nodename,
+						r.DBOwner, SanitiseLogString(r.DBName), err)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(liveReplicationCheckInterval):
+		}
+	}
+}
+
+// ReplicationTargetHost checks the connection string of a replication target, returning the server it points at
+func ReplicationTargetHost(targetType, dsn string) (host string, err error) {
+	switch targetType {
+	case "postgresql":
+		var cfg *pgx.ConnConfig
+		cfg, err = pgx.ParseConfig(dsn)
+		if err != nil {
+			return "", errors.New("Invalid PostgreSQL connection string")
+		}
+		return net.JoinHostPort(cfg.Host, strconv.Itoa(int(cfg.Port))), nil
+	case "mysql":
+		var cfg *mysql.Config
+		cfg, err = mysql.ParseDSN(dsn)
+		if err != nil || cfg.Net != "tcp" {
+			return "", errors.New("Invalid MySQL connection string.  It needs to use a tcp connection")
+		}
+		return cfg.Addr, nil
+	}
+	return "", fmt.Errorf("Unknown replication target type: '%s'", targetType)
+}
+
+// liveReplicate copies the mapped tables of a live database to its replication target.  Each table is copied in full,
+// replacing the existing rows of the target table, in a single transaction
+func liveReplicate(r database.LiveReplication) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), liveReplicationTimeout)
+	defer cancel()
+
+	dialect, ok := replicationDialects[r.TargetType]
+	if !ok {
+		return fmt.Errorf("Unknown replication target type: '%s'", r.TargetType)
+	}
+
+	defer liveDBUse(r.DBOwner, r.DBName, false, false)()
+	sdb, err := OpenSQLiteDatabaseLive(config.Conf.Live.StorageDir, r.DBOwner, r.DBName)
+	if err != nil {
+		return
+	}
+	defer sdb.Close()
+
+	target, err := openReplicationTarget(r.TargetType, r.DSN)
+	if err != nil {
+		return
+	}
+	defer target.Close()
+
+	tx, err := target.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	for _, t := range r.Tables {
+		err = replicateTable(ctx, sdb, tx, dialect, t)
+		if err != nil {
+			return fmt.Errorf("Table '%s': %w", t.Table, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// openReplicationTarget connects to the server a live database is replicated to.  The connection goes through
+// replicationDialer, which refuses addresses on loopback and private networks unless those have been allowed
+func openReplicationTarget(targetType, dsn string) (*sql.DB, error) {
+	switch targetType {
+	case "postgresql":
+		cfg, err := pgx.ParseConfig(dsn)
+		if err != nil {
+			return nil, errors.New("Invalid PostgreSQL connection string")
+		}
+		cfg.DialFunc = replicationDialer.DialContext
+		return stdlib.OpenDB(*cfg), nil
+	case "mysql":
+		cfg, err := mysql.ParseDSN(dsn)
+		if err != nil || cfg.Net != "tcp" {
+			return nil, errors.New("Invalid MySQL connection string.  It needs to use a tcp connection")
+		}
+		registerReplicationDialer.Do(func() {
+			mysql.RegisterDialContext(replicationMySQLNet, func(ctx context.Context, addr string) (net.Conn, error) {
+				return replicationDialer.DialContext(ctx, "tcp", addr)
+			})
+		})
+		cfg.Net = replicationMySQLNet
+		cfg.AllowAllFiles = false
+		conn, err := mysql.NewConnector(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return sql.OpenDB(conn), nil
+	}
+	return nil, fmt.Errorf("Unknown replication target type: '%s'", targetType)
+}
+
+// replicateTable copies one table of a live database to the replication target, creating the target table if needed
+func replicateTable(ctx context.Context, sdb *sqlite.Conn, tx *sql.Tx, dialect replicationDialect, t database.ReplicationTable) (err error) {
+	cols, err := replicationColumns(sdb, t)
+	if err != nil {
+		return
+	}
+	targetTable := t.Table
+	if t.Target != "" {
+		targetTable = t.Target
+	}
+
+	// Create the target table if it doesn't exist yet
+	var colDefs, targetCols, placeholders, sourceCols, pk []string
+	for i, col := range cols {
+		colType := dialect.types[col.kind]
+		if col.pk && col.kind == "text" {
+			colType = dialect.types["key"]
+		}
+		colDefs = append(colDefs, dialect.quote(col.target)+" "+colType)
+		targetCols = append(targetCols, dialect.quote(col.target))
+		placeholders = append(placeholders, dialect.placeholder(i+1))
+		sourceCols = append(sourceCols, EscapeId(col.source))
+		if col.pk {
+			pk = append(pk, dialect.quote(col.target))
+		}
+	}
+	if len(pk) > 0 {
+		colDefs = append(colDefs, "PRIMARY KEY ("+strings.Join(pk, ", ")+")")
+	}
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", dialect.quote(targetTable),
+		strings.Join(colDefs, ", ")))
+	if err != nil {
+		return
+	}
+
+	// Replace the rows of the target table with the current ones
+	_, err = tx.ExecContext(ctx, "DELETE FROM "+dialect.quote(targetTable))
+	if err != nil {
+		return
+	}
+	ins, err := tx.PrepareContext(ctx, fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", dialect.quote(targetTable),
+		strings.Join(targetCols, ", "), strings.Join(placeholders, ", ")))
+	if err != nil {
+		return
+	}
+	defer ins.Close()
+
+	stmt, err := sdb.Prepare(fmt.Sprintf("SELECT %s FROM %s", strings.Join(sourceCols, ", "), EscapeId(t.Table)))
+	if err != nil {
+		return
+	}
+	defer stmt.Finalize()
+	return stmt.Select(func(s *sqlite.Stmt) (err error) {
+		values := make([]interface{}, len(cols))
+		for i, col := range cols {
+			v, isNull := s.ScanValue(i)
+			if isNull {
+				continue
+			}
+			values[i], err = replicationValue(v, col.kind)
+			if err != nil {
+				return fmt.Errorf("Column '%s': %w", col.source, err)
+			}
+		}
+		_, err = ins.ExecContext(ctx, values...)
+		return
+	})
+}
+
+// replicationColumns returns the columns of a live database table to be replicated, with their names in the target
+// table.  The kind of data in each column comes from its declared type, using the SQLite type affinity rules
+func replicationColumns(sdb *sqlite.Conn, t database.ReplicationTable) (cols []replicationColumn, err error) {
+	srcCols, err := sdb.Columns("main", t.Table)
+	if err != nil {
+		return
+	}
+	if len(srcCols) == 0 {
+		return nil, errors.New("Table not found")
+	}
+
+	excluded := make(map[string]bool)
+	for _, z := range t.Exclude {
+		excluded[z] = true
+	}
+	for _, c := range srcCols {
+		if excluded[c.Name] {
+			continue
+		}
+		col := replicationColumn{pk: c.Pk > 0, source: c.Name, target: c.Name}
+		if z, ok := t.Columns[c.Name]; ok && z != "" {
+			col.target = z
+		}
+		declType := strings.ToUpper(c.DataType)
+		switch {
+		case strings.Contains(declType, "INT"):
+			col.kind = "integer"
+		case strings.Contains(declType, "CHAR"), strings.Contains(declType, "CLOB"), strings.Contains(declType, "TEXT"):
+			col.kind = "text"
+		case strings.Contains(declType, "BLOB"):
+			col.kind = "blob"
+		case strings.Contains(declType, "REAL"), strings.Contains(declType, "FLOA"), strings.Contains(declType, "DOUB"):
+			col.kind = "real"
+		default:
+			// Columns without a declared type, or with numeric affinity, can hold any kind of value
+			col.kind = "text"
+		}
+		cols = append(cols, col)
+	}
+	if len(cols) == 0 {
+		return nil, errors.New("All of the columns are excluded")
+	}
+	return
+}
+
+// replicationDialControl refuses connections to replication targets on loopback, private, and link-local addresses,
+// unless they've been allowed in the configuration.  It's checked after name resolution, so can't be bypassed by DNS
+func replicationDialControl(network, address string, c syscall.RawConn) error {
+	if config.Conf.Replication.AllowPrivateHosts {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() {
+		return ErrReplicationTarget
+	}
+	return nil
+}
+
+// replicationValue converts a value from a live database to suit the kind of column it's replicated to.  SQLite lets
+// columns hold values of any type, which the external servers don't
+func replicationValue(v interface{}, kind string) (interface{}, error) {
+	switch kind {
+	case "integer":
+		switch z := v.(type) {
+		case int64:
+			return z, nil
+		case float64:
+			if z == float64(int64(z)) {
+				return int64(z), nil
+			}
+		case string:
+			if n, err := strconv.ParseInt(z, 10, 64); err == nil {
+				return n, nil
+			}
+		}
+		return nil, fmt.Errorf("Value '%v' isn't an integer", v)
+	case "real":
+		switch z := v.(type) {
+		case int64:
+			return float64(z), nil
+		case float64:
+			return z, nil
+		case string:
+			if f, err := strconv.ParseFloat(z, 64); err == nil {
+				return f, nil
+			}
+		}
+		return nil, fmt.Errorf("Value '%v' isn't a number", v)
+	case "blob":
+		switch z := v.(type) {
+		case []byte:
+			return z, nil
+		default:
+			return []byte(fmt.Sprint(z)), nil
+		}
+	}
+
+	// Text
+	switch z := v.(type) {
+	case string:
+		return z, nil
+	case []byte:
+		return string(z), nil
+	case int64:
+		return strconv.FormatInt(z, 10), nil
+	case float64:
+		return strconv.FormatFloat(z, 'g', -1, 64), nil
+	}
+	return fmt.Sprint(v), nil
+}
@@ -0,0 +1,258 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	sqlite "github.com/gwenn/gosqlite"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// JobRequestSandbox holds the data used when making a sandbox request to our job queue backend.  The base is the copy
+// of the parent database a sandbox was created from, which changes are worked out against.  When creating a sandbox,
+// Owner and Name are the sandbox being created.  When merging one, Diffs holds the changes being merged
+type JobRequestSandbox struct {
+	BaseBucket  string        `json:"base_bucket"`
+	BaseObject  string        `json:"base_object"`
+	Diffs       Diffs         `json:"diffs"`
+	IncludeData bool          `json:"include_data"`
+	Merge       MergeStrategy `json:"merge"`
+	Name        string        `json:"name"`
+	Owner       string        `json:"owner"`
+}
+
+// JobResponseSandboxDiff holds the fields used for receiving the changes made to a sandbox from our job queue backend
+type JobResponseSandboxDiff struct {
+	Diffs Diffs  `json:"diffs"`
+	Err   string `json:"error"`
+}
+
+// JobResponseSandboxMerge holds the fields used for receiving the result of merging a sandbox from our job queue
+// backend.  When the changes conflict with those made to the parent database, nothing is merged
+type JobResponseSandboxMerge struct {
+	Conflicts []string `json:"conflicts"`
+	Err       string   `json:"error"`
+}
+
+// JobResponseSandboxSnapshot holds the fields used for receiving the stored copies of a database a new sandbox is
+// created from
+type JobResponseSandboxSnapshot struct {
+	BaseBucket string `json:"base_bucket"`
+	BaseObject string `json:"base_object"`
+	Err        string `json:"error"`
+	ObjectID   string `json:"object_id"`
+}
+
+// LiveSandboxDiff asks our job queue backend for the changes made to a sandbox since it was created
+func LiveSandboxDiff(liveNode, loggedInUser string, s database.LiveSandbox, merge MergeStrategy, includeData bool) (diffs Diffs, err error) {
+	reqJSON, err := json.Marshal(JobRequestSandbox{
+		BaseBucket:  s.BaseBucket,
+		BaseObject:  s.BaseObject,
+		IncludeData: includeData,
+		Merge:       merge,
+	})
+	if err != nil {
+		return
+	}
+	var resp JobResponseSandboxDiff
+	err = JobSubmit(&resp, liveNode, "sandboxdiff", loggedInUser, s.DBOwner, s.DBName, reqJSON)
+	if err != nil {
+		return
+	}
+	if resp.Err != "" {
+		return Diffs{}, errors.New(resp.Err)
+	}
+	return resp.Diffs, nil
+}
+
+// LiveSandboxMerge asks our job queue backend to apply the changes of a sandbox to its parent database.  The changes
+// need to have been worked out using the NewPkMerge strategy.  When they conflict with changes made to the parent
+// since the sandbox was created, nothing is changed and the conflicts are returned
+func LiveSandboxMerge(liveNode, loggedInUser string, s database.LiveSandbox, diffs Diffs) (conflicts []string, err error) {
+	// Archived databases are read only
+	archived, err := database.CheckDBArchived(s.ParentOwner, s.ParentName)
+	if err != nil {
+		return
+	}
+	if archived {
+		return nil, database.ErrDBArchived
+	}
+
+	reqJSON, err := json.Marshal(JobRequestSandbox{
+		BaseBucket: s.BaseBucket,
+		BaseObject: s.BaseObject,
+		Diffs:      diffs,
+	})
+	if err != nil {
+		return
+	}
+	var resp JobResponseSandboxMerge
+	err = JobSubmit(&resp, liveNode, "sandboxmerge", loggedInUser, s.ParentOwner, s.ParentName, reqJSON)
+	if err != nil {
+		return
+	}
+	if resp.Err != "" {
+		return nil, errors.New(resp.Err)
+	}
+	return resp.Conflicts, nil
+}
+
+// LiveSandboxSnapshot asks our job queue backend to store a copy of a live database for a new sandbox of it.  Two
+// copies are stored, one the sandbox is created from and one kept as its base.  It returns the ID of the first one
+func LiveSandboxSnapshot(liveNode, loggedInUser, dbOwner, dbName, sandboxOwner, sandboxName string) (objectID, baseBucket, baseObject string, err error) {
+	reqJSON, err := json.Marshal(JobRequestSandbox{
+		Name:  sandboxName,
+		Owner: sandboxOwner,
+	})
+	if err != nil {
+		return
+	}
+	var resp JobResponseSandboxSnapshot
+	err = JobSubmit(&resp, liveNode, "sandboxsnapshot", loggedInUser, dbOwner, dbName, reqJSON)
+	if err != nil {
+		return
+	}
+	if resp.Err != "" {
+		err = errors.New(resp.Err)
+		return
+	}
+	return resp.ObjectID, resp.BaseBucket, resp.BaseObject, nil
+}
+
+// SQLiteSandboxDiffLive is used by our job queue backend nodes to work out the changes made to a live database since
+// the base copy in the request was taken
+func SQLiteSandboxDiffLive(baseDir, dbOwner, dbName string, req JobRequestSandbox) (diffs Diffs, err error) {
+	base, err := RetrieveDatabaseFile(req.BaseBucket, req.BaseObject)
+	if err != nil {
+		return
+	}
+	tmpName, err := sandboxCopy(baseDir, dbOwner, dbName, ".sandboxdiff")
+	defer os.Remove(tmpName)
+	if err != nil {
+		return
+	}
+	return DBDiff(base, tmpName, req.Merge, req.IncludeData)
+}
+
+// SQLiteSandboxMergeLive is used by our job queue backend nodes to apply the changes of a sandbox to its parent live
+// database.  Writes to the database are held off while the changes made to it since the sandbox was created are
+// checked for conflicts, and while the sandbox changes are applied.  Either all of the changes are applied, or none
+func SQLiteSandboxMergeLive(baseDir, dbOwner, dbName string, req JobRequestSandbox) (conflicts []string, err error) {
+	if err = liveTransactionCheck(dbOwner, dbName); err != nil {
+		return
+	}
+	sdb, err := OpenSQLiteDatabaseLive(baseDir, dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	defer sdb.Close()
+	if err = sdb.BusyTimeout(liveBusyTimeout); err != nil {
+		return
+	}
+	if err = sdb.BeginTransaction(sqlite.Immediate); err != nil {
+		return
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			sdb.Rollback()
+		}
+	}()
+
+	// Work out what's changed in the parent since the sandbox was created.  The copy this is worked out from is read
+	// using a different connection, which sees the database as it is now as nothing else can write to it
+	destDiffs, err := SQLiteSandboxDiffLive(baseDir, dbOwner, dbName, JobRequestSandbox{
+		BaseBucket: req.BaseBucket,
+		BaseObject: req.BaseObject,
+		Merge:      NoMerge,
+	})
+	if err != nil {
+		return
+	}
+	conflicts = checkForConflicts(req.Diffs, destDiffs, NewPkMerge)
+	if len(conflicts) > 0 {
+		return
+	}
+
+	// Apply the schema changes of each object, then its data changes
+	for _, diff := range req.Diffs.Diff {
+		if diff.Schema != nil && diff.Schema.Sql != "" {
+			if err = sdb.Exec(diff.Schema.Sql); err != nil {
+				return nil, fmt.Errorf("Merging the changes to '%s' failed: %v", diff.ObjectName, err)
+			}
+		}
+		for _, row := range diff.Data {
+			if err = sdb.Exec(row.Sql); err != nil {
+				return nil, fmt.Errorf("Merging the changes to '%s' failed: %v", diff.ObjectName, err)
+			}
+		}
+	}
+	if err = sdb.Commit(); err != nil {
+		return
+	}
+	committed = true
+	return
+}
+
+// SQLiteSandboxSnapshotLive is used by our job queue backend nodes to store a copy of a live database for a new
+// sandbox of it.  The copy is stored twice, as the database the sandbox is created from, and as its base.  The base
+// stays the same as the sandbox is changed, so the changes can be worked out later on
+func SQLiteSandboxSnapshotLive(baseDir, dbOwner, dbName string, req JobRequestSandbox) (objectID, baseBucket, baseObject string, err error) {
+	tmpName, err := sandboxCopy(baseDir, dbOwner, dbName, ".sandbox")
+	defer os.Remove(tmpName)
+	if err != nil {
+		return
+	}
+	f, err := os.Open(tmpName)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return
+	}
+
+	objectID, err = LiveStoreDatabaseMinio(f, req.Owner, req.Name, st.Size())
+	if err != nil {
+		return
+	}
+	if _, err = f.Seek(0, 0); err != nil {
+		return
+	}
+	baseBucket, baseObject, err = LiveGenerateMinioNames(req.Owner)
+	if err != nil {
+		return
+	}
+	numBytes, err := putDatabaseObject(req.Owner, baseBucket, baseObject, f, st.Size())
+	if err != nil {
+		return
+	}
+	if numBytes != st.Size() {
+		err = fmt.Errorf("Something went wrong storing the sandbox base.  dbSize = %d, numBytes = %d", st.Size(),
+			numBytes)
+	}
+	return
+}
+
+// sandboxCopy writes a consistent copy of a live database next to it, using VACUUM INTO, returning the path of the copy.
+// It's only called from jobs, which already mark the database as being in use.  The caller removes the copy once it's
+// finished with it
+func sandboxCopy(baseDir, dbOwner, dbName, suffix string) (tmpName string, err error) {
+	dbPath := filepath.Join(baseDir, dbOwner, dbName, "live.sqlite")
+	tmpName = dbPath + suffix
+	os.Remove(tmpName)
+	sdb, err := optimizeOpen(dbPath, true)
+	if err != nil {
+		return
+	}
+	defer sdb.Close()
+	if err = sdb.BusyTimeout(liveBusyTimeout); err != nil {
+		return
+	}
+	err = sdb.Exec("VACUUM INTO ?", tmpName)
+	return
+}
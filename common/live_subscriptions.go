@@ -0,0 +1,71 @@
+package common
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+)
+
+// The PostgreSQL notification channel the live nodes announce changes to live databases on
+const liveChangesChannel = "live_database_changes"
+
+// liveSubscriptions holds the channels waiting for changes to each live database, keyed by liveSubscriptionKey()
+var liveSubscriptions = struct {
+	sync.Mutex
+	subs map[string]map[chan struct{}]struct{}
+}{subs: make(map[string]map[chan struct{}]struct{})}
+
+// liveSubscriptionKey returns the key used for a live database in liveSubscriptions.  User names aren't case sensitive,
+// but database names are
+func liveSubscriptionKey(dbOwner, dbName string) string {
+	return strings.ToLower(dbOwner) + "/" + dbName
+}
+
+// LiveSubscribe returns a channel which receives a value whenever a live database is changed.  Changes made while an
+// earlier one is still waiting to be received are merged with it.  The returned function ends the subscription, and
+// needs to be called once it's no longer needed
+func LiveSubscribe(dbOwner, dbName string) (changed <-chan struct{}, cancel func()) {
+	key := liveSubscriptionKey(dbOwner, dbName)
+	ch := make(chan struct{}, 1)
+
+	liveSubscriptions.Lock()
+	if liveSubscriptions.subs[key] == nil {
+		liveSubscriptions.subs[key] = make(map[chan struct{}]struct{})
+	}
+	liveSubscriptions.subs[key][ch] = struct{}{}
+	liveSubscriptions.Unlock()
+
+	cancel = func() {
+		liveSubscriptions.Lock()
+		delete(liveSubscriptions.subs[key], ch)
+		if len(liveSubscriptions.subs[key]) == 0 {
+			delete(liveSubscriptions.subs, key)
+		}
+		liveSubscriptions.Unlock()
+	}
+	return ch, cancel
+}
+
+// liveChanged lets the subscriptions for a live database know it has changed.  It's called with the payload of each
+// notification received on the live changes channel
+func liveChanged(payload string) {
+	var c LiveChange
+	err := json.Unmarshal([]byte(payload), &c)
+	if err != nil {
+		log.Printf("%s: invalid live database change notification '%s': %s", config.Conf.Live.Nodename, payload, err)
+		return
+	}
+
+	liveSubscriptions.Lock()
+	defer liveSubscriptions.Unlock()
+	for ch := range liveSubscriptions.subs[liveSubscriptionKey(c.DBOwner, c.DBName)] {
+		select {
+		case ch <- struct{}{}:
+		default:
+			// There's already a change waiting to be received
+		}
+	}
+}
@@ -0,0 +1,449 @@
+package common
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	sqlite "github.com/gwenn/gosqlite"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+const (
+	// LiveTransactionDefaultTimeout is how long a live database transaction stays open without being used, when no
+	// timeout is requested
+	LiveTransactionDefaultTimeout = 30 * time.Second
+
+	// LiveTransactionMaxTimeout is the longest timeout which can be requested for a live database transaction
+	LiveTransactionMaxTimeout = 5 * time.Minute
+
+	// LiveTransactionMaxOpen is the maximum number of transactions a user can have open on each live node
+	LiveTransactionMaxOpen = 5
+)
+
+// ErrTransactionInProgress is returned for changes to a live database while a transaction is open on it.  The
+// transaction holds the write lock of the database until it's committed, rolled back, or times out
+var ErrTransactionInProgress = errors.New("A transaction is in progress on this database.  Changes can be made " +
+	"once it has been committed or rolled back, or has timed out")
+
+// ErrTransactionLimit is returned when beginning a transaction would give the user more than LiveTransactionMaxOpen
+// transactions open on the live node
+var ErrTransactionLimit = fmt.Errorf("You can't have more than %d transactions open at once", LiveTransactionMaxOpen)
+
+// ErrTransactionNotFound is returned when a transaction token doesn't match an open transaction.  Transactions which
+// time out are rolled back, after which their token no longer works
+var ErrTransactionNotFound = errors.New("Transaction not found.  It may have timed out and been rolled back")
+
+// JobRequestTransaction holds the data used when making a transaction request to our job queue backend.  Timeout is
+// only used when beginning a transaction, and SQL and Params only when running a statement in one
+type JobRequestTransaction struct {
+	Params  *QueryParams  `json:"params,omitempty"`
+	SQL     string        `json:"sql,omitempty"`
+	Timeout time.Duration `json:"timeout,omitempty"`
+	Token   string        `json:"token,omitempty"`
+}
+
+// JobResponseDBTransaction holds the fields used for receiving transaction responses from our job queue backend.
+// Changed is set when a committed transaction changed the database
+type JobResponseDBTransaction struct {
+	Changed     bool            `json:"changed"`
+	Err         string          `json:"error"`
+	Expires     time.Time       `json:"expires"`
+	Results     SQLiteRecordSet `json:"results"`
+	RowsChanged int             `json:"rows_changed"`
+	Token       string          `json:"token"`
+}
+
+// liveTransaction is a transaction open on a live database on this node.  It keeps its own connection to the database,
+// used by one request at a time, and is rolled back when it isn't used before it expires
+type liveTransaction struct {
+	mu           sync.Mutex
+	changed      bool
+	dbName       string
+	dbOwner      string
+	done         bool
+	expires      time.Time
+	sdb          *sqlite.Conn
+	timeout      time.Duration
+	timer        *time.Timer
+	token        string
+	totalChanges int
+	user         string
+}
+
+// liveTransactions holds the transactions open on this node, by their token
+var liveTransactions = struct {
+	sync.Mutex
+	txs map[string]*liveTransaction
+}{
+	txs: make(map[string]*liveTransaction),
+}
+
+// LiveTransactionBegin asks our job queue backend to begin a transaction on a live database.  The returned token is
+// used for running statements in the transaction, and for ending it.  The transaction is rolled back if it isn't used
+// for longer than the timeout
+func LiveTransactionBegin(liveNode, loggedInUser, dbOwner, dbName string, timeout time.Duration) (token string, expires time.Time, err error) {
+	// Archived databases are read only
+	archived, err := database.CheckDBArchived(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	if archived {
+		return "", expires, database.ErrDBArchived
+	}
+
+	resp, err := liveTransactionSubmit(liveNode, "txbegin", loggedInUser, dbOwner, dbName,
+		JobRequestTransaction{Timeout: timeout})
+	if err != nil {
+		return
+	}
+	return resp.Token, resp.Expires, nil
+}
+
+// LiveTransactionEnd asks our job queue backend to commit or roll back a transaction on a live database
+func LiveTransactionEnd(liveNode, loggedInUser, dbOwner, dbName, token string, commit bool) (err error) {
+	op := "txrollback"
+	if commit {
+		op = "txcommit"
+	}
+	resp, err := liveTransactionSubmit(liveNode, op, loggedInUser, dbOwner, dbName, JobRequestTransaction{Token: token})
+	if err != nil {
+		return
+	}
+
+	// Update the "last_modified" field for the database, if the transaction changed it
+	if resp.Changed {
+		err = database.UpdateModified(dbOwner, dbName)
+	}
+	return
+}
+
+// LiveTransactionExecute asks our job queue backend to execute a SQL statement in a transaction on a live database.
+// When params isn't nil, its values are bound to the parameters of the statement
+func LiveTransactionExecute(liveNode, loggedInUser, dbOwner, dbName, token, sql string, params *QueryParams) (rowsChanged int, err error) {
+	resp, err := liveTransactionSubmit(liveNode, "txexecute", loggedInUser, dbOwner, dbName,
+		JobRequestTransaction{Params: params, SQL: sql, Token: token})
+	return resp.RowsChanged, err
+}
+
+// LiveTransactionQuery asks our job queue backend to run a SQL query in a transaction on a live database.  The query
+// sees the changes made earlier in the transaction.  When params isn't nil, its values are bound to the parameters of
+// the query
+func LiveTransactionQuery(liveNode, loggedInUser, dbOwner, dbName, token, query string, params *QueryParams) (rows SQLiteRecordSet, err error) {
+	resp, err := liveTransactionSubmit(liveNode, "txquery", loggedInUser, dbOwner, dbName,
+		JobRequestTransaction{Params: params, SQL: query, Token: token})
+	return resp.Results, err
+}
+
+// liveTransactionSubmit sends a transaction request to our job queue backend
+func liveTransactionSubmit(liveNode, op, loggedInUser, dbOwner, dbName string, req JobRequestTransaction) (resp JobResponseDBTransaction, err error) {
+	// Serialise the request to JSON.  It ends up base64 encoded in the job details, the same as row data requests
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		return
+	}
+	err = JobSubmit(&resp, liveNode, op, loggedInUser, dbOwner, dbName, reqJSON)
+	if err != nil {
+		return
+	}
+	if resp.Err != "" {
+		err = liveError(resp.Err)
+	}
+	return
+}
+
+// liveTransactionJob is used by our job queue backend nodes to run a transaction request, returning the response to
+// send back
+func liveTransactionJob(op string, req JobRequest) (responsePayload []byte) {
+	var response JobResponseDBTransaction
+	err := func() (err error) {
+		// Decode the base64 request data back to JSON.  Numbers are kept as they were given, so large integers don't
+		// lose precision
+		b64, err := base64.StdEncoding.DecodeString(fmt.Sprintf("%s", req.Data))
+		if err != nil {
+			return fmt.Errorf("error when base64 decoding transaction job details: %v", err)
+		}
+		var reqData JobRequestTransaction
+		d := json.NewDecoder(bytes.NewReader(b64))
+		d.UseNumber()
+		err = d.Decode(&reqData)
+		if err != nil {
+			return fmt.Errorf("error when unmarshalling transaction job details: %v", err)
+		}
+
+		switch op {
+		case "txbegin":
+			response.Token, response.Expires, err = SQLiteTransactionBeginLive(config.Conf.Live.StorageDir,
+				req.DBOwner, req.DBName, req.RequestingUser, reqData.Timeout)
+		case "txcommit":
+			response.Changed, err = SQLiteTransactionEndLive(req.DBOwner, req.DBName, req.RequestingUser, reqData.Token,
+				true)
+			if response.Changed {
+				liveAfterWrite(req.DBOwner, req.DBName, true)
+			}
+		case "txexecute":
+			response.RowsChanged, response.Expires, err = SQLiteTransactionExecuteLive(req.DBOwner, req.DBName,
+				req.RequestingUser, reqData.Token, reqData.SQL, reqData.Params)
+		case "txquery":
+			response.Results, response.Expires, err = SQLiteTransactionQueryLive(req.DBOwner, req.DBName,
+				req.RequestingUser, reqData.Token, reqData.SQL, reqData.Params)
+		case "txrollback":
+			_, err = SQLiteTransactionEndLive(req.DBOwner, req.DBName, req.RequestingUser, reqData.Token, false)
+		}
+		return
+	}()
+	if err != nil {
+		response.Err = err.Error()
+	}
+	responsePayload, err = json.Marshal(response)
+	if err != nil {
+		log.Printf("%s: error when serialising transaction response json: %s", config.Conf.Live.Nodename, err)
+		responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
+	}
+	return
+}
+
+// SQLiteTransactionBeginLive is used by our job queue backend nodes to begin a transaction on a live database.  The
+// transaction takes the write lock of the database straight away, so other changes to the database are refused with
+// ErrTransactionInProgress until it ends
+func SQLiteTransactionBeginLive(baseDir, dbOwner, dbName, loggedInUser string, timeout time.Duration) (token string, expires time.Time, err error) {
+	if timeout <= 0 {
+		timeout = LiveTransactionDefaultTimeout
+	}
+	if timeout > LiveTransactionMaxTimeout {
+		timeout = LiveTransactionMaxTimeout
+	}
+
+	// Only one transaction can be open on a database at once
+	if err = liveTransactionCheck(dbOwner, dbName); err != nil {
+		return
+	}
+
+	// Limit the number of transactions each user can have open
+	open := 0
+	liveTransactions.Lock()
+	for _, tx := range liveTransactions.txs {
+		if tx.user == loggedInUser {
+			open++
+		}
+	}
+	liveTransactions.Unlock()
+	if open >= LiveTransactionMaxOpen {
+		return "", expires, ErrTransactionLimit
+	}
+
+	data := make([]byte, 30)
+	_, err = rand.Read(data)
+	if err != nil {
+		return
+	}
+	token = base64.RawURLEncoding.EncodeToString(data)
+
+	sdb, err := OpenSQLiteDatabaseLive(baseDir, dbOwner, dbName)
+	if err != nil {
+		if sdb != nil {
+			sdb.Close()
+		}
+		return
+	}
+	err = sdb.BeginTransaction(sqlite.Immediate)
+	if err != nil {
+		sdb.Close()
+		return
+	}
+
+	// Statements run in the transaction can't end it themselves
+	err = sdb.SetAuthorizer(authorizerLiveTransaction, nil)
+	if err != nil {
+		sdb.Rollback()
+		sdb.Close()
+		return
+	}
+
+	tx := &liveTransaction{
+		dbName:       dbName,
+		dbOwner:      dbOwner,
+		expires:      time.Now().Add(timeout),
+		sdb:          sdb,
+		timeout:      timeout,
+		token:        token,
+		totalChanges: sdb.TotalChanges(),
+		user:         loggedInUser,
+	}
+	tx.timer = time.AfterFunc(timeout, tx.expire)
+	liveTransactions.Lock()
+	liveTransactions.txs[token] = tx
+	liveTransactions.Unlock()
+	return token, tx.expires, nil
+}
+
+// SQLiteTransactionEndLive is used by our job queue backend nodes to commit or roll back a transaction on a live
+// database.  Transactions which can't be committed are rolled back
+func SQLiteTransactionEndLive(dbOwner, dbName, loggedInUser, token string, commit bool) (changed bool, err error) {
+	tx, err := liveTransactionGet(dbOwner, dbName, loggedInUser, token)
+	if err != nil {
+		return
+	}
+	defer tx.mu.Unlock()
+	changed = tx.changed || tx.sdb.TotalChanges() != tx.totalChanges
+	err = tx.end(commit)
+	if err != nil {
+		return false, fmt.Errorf("The transaction couldn't be committed, so it was rolled back: %w", err)
+	}
+	return commit && changed, nil
+}
+
+// SQLiteTransactionExecuteLive is used by our job queue backend nodes to execute a SQL statement in a transaction on a
+// live database
+func SQLiteTransactionExecuteLive(dbOwner, dbName, loggedInUser, token, sql string, params *QueryParams) (rowsChanged int, expires time.Time, err error) {
+	tx, err := liveTransactionGet(dbOwner, dbName, loggedInUser, token)
+	if err != nil {
+		return
+	}
+	defer tx.mu.Unlock()
+	if params != nil {
+		rowsChanged, err = executeParamsLimited(tx.sdb, dbOwner, dbName, loggedInUser, sql, *params)
+	} else {
+		rowsChanged, err = executeLimited(tx.sdb, dbOwner, dbName, loggedInUser, sql, func() (int, error) {
+			return tx.sdb.ExecDml(sql)
+		})
+	}
+	if err == nil {
+		tx.changed = true
+	}
+	err = tx.after(err)
+	return rowsChanged, tx.expires, err
+}
+
+// SQLiteTransactionQueryLive is used by our job queue backend nodes to run a SQL query in a transaction on a live
+// database
+func SQLiteTransactionQueryLive(dbOwner, dbName, loggedInUser, token, query string, params *QueryParams) (records SQLiteRecordSet, expires time.Time, err error) {
+	tx, err := liveTransactionGet(dbOwner, dbName, loggedInUser, token)
+	if err != nil {
+		return
+	}
+	defer tx.mu.Unlock()
+	records, err = runQueryLimited(tx.sdb, dbOwner, dbName, loggedInUser, query, params)
+	err = tx.after(err)
+	return records, tx.expires, err
+}
+
+// authorizerLiveTransaction is the SQLite authorizer callback used for statements run in a transaction on a live
+// database.  It allows the same things as AuthorizerLive, except for beginning or ending transactions
+func authorizerLiveTransaction(d interface{}, action sqlite.Action, tableName, funcName, dbName, triggerName string) sqlite.Auth {
+	if action == sqlite.Transaction {
+		return sqlite.AuthDeny
+	}
+	return AuthorizerLive(d, action, tableName, funcName, dbName, triggerName)
+}
+
+// liveTransactionCheck returns ErrTransactionInProgress when a transaction is open on a live database on this node.
+// It's called before changing the database, as otherwise the change would wait for the write lock of the transaction,
+// then fail with a "database is locked" error
+func liveTransactionCheck(dbOwner, dbName string) error {
+	liveTransactions.Lock()
+	defer liveTransactions.Unlock()
+	for _, tx := range liveTransactions.txs {
+		if tx.dbOwner == dbOwner && tx.dbName == dbName {
+			return ErrTransactionInProgress
+		}
+	}
+	return nil
+}
+
+// liveTransactionGet returns the open transaction with the given token, locked for the caller.  The transaction needs
+// to be on the given database, and begun by the same user
+func liveTransactionGet(dbOwner, dbName, loggedInUser, token string) (tx *liveTransaction, err error) {
+	liveTransactions.Lock()
+	tx, ok := liveTransactions.txs[token]
+	liveTransactions.Unlock()
+	if !ok || tx.dbOwner != dbOwner || tx.dbName != dbName || tx.user != loggedInUser {
+		return nil, ErrTransactionNotFound
+	}
+	tx.mu.Lock()
+	if tx.done {
+		tx.mu.Unlock()
+		return nil, ErrTransactionNotFound
+	}
+	return tx, nil
+}
+
+// rollbackLiveTransactions rolls back the transactions open on a live database.  It's called when the database file
+// is removed from the node
+func rollbackLiveTransactions(dbOwner, dbName string) {
+	var txs []*liveTransaction
+	liveTransactions.Lock()
+	for _, tx := range liveTransactions.txs {
+		if tx.dbOwner == dbOwner && tx.dbName == dbName {
+			txs = append(txs, tx)
+		}
+	}
+	liveTransactions.Unlock()
+	for _, tx := range txs {
+		tx.mu.Lock()
+		if !tx.done {
+			tx.end(false)
+		}
+		tx.mu.Unlock()
+	}
+}
+
+// after finishes a statement run in the transaction, restarting its timeout.  SQLite rolls back the whole transaction
+// for some errors, in which case the transaction is closed and the error says so
+func (tx *liveTransaction) after(err error) error {
+	if err != nil && tx.sdb.GetAutocommit() {
+		tx.end(false)
+		return fmt.Errorf("%w.  The transaction was rolled back", err)
+	}
+	tx.expires = time.Now().Add(tx.timeout)
+	tx.timer.Reset(tx.timeout)
+	return err
+}
+
+// end commits or rolls back the transaction, then closes its connection.  The transaction needs to be locked by the
+// caller
+func (tx *liveTransaction) end(commit bool) (err error) {
+	tx.done = true
+	tx.timer.Stop()
+	liveTransactions.Lock()
+	delete(liveTransactions.txs, tx.token)
+	liveTransactions.Unlock()
+	defer tx.sdb.Close()
+
+	// The authorizer used for the statements in the transaction doesn't allow ending it
+	err = tx.sdb.SetAuthorizer(AuthorizerLive, nil)
+	if err != nil {
+		tx.sdb.Rollback()
+		return
+	}
+	if commit {
+		err = tx.sdb.Commit()
+	}
+	if !commit || err != nil {
+		if !tx.sdb.GetAutocommit() {
+			tx.sdb.Rollback()
+		}
+	}
+	return
+}
+
+// expire rolls back the transaction when it hasn't been used before its timeout
+func (tx *liveTransaction) expire() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.done || time.Now().Before(tx.expires) {
+		return
+	}
+	if JobQueueDebug > 0 {
+		log.Printf("%s: rolling back timed out transaction on '%s/%s'", config.Conf.Live.Nodename,
+			SanitiseLogString(tx.dbOwner), SanitiseLogString(tx.dbName))
+	}
+	tx.end(false)
+}
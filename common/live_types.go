@@ -89,6 +89,12 @@ type JobResponseDBViews struct {
 	Views []string `json:"views"`
 }
 
+// LiveChange is the payload of the notifications sent when a live database is changed
+type LiveChange struct {
+	DBName  string `json:"dbname"`
+	DBOwner string `json:"dbowner"`
+}
+
 // ResponseInfo holds job queue responses.  Most of the useful info is json encoded in the payload field
 type ResponseInfo struct {
 	jobID      int
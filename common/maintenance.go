@@ -0,0 +1,155 @@
+package common
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// ReadOnlyDefaultMessage is shown to people while in read only mode, when no other message has been given
+const ReadOnlyDefaultMessage = "DBHub.io is in read only mode for maintenance.  Everything can still be viewed and " +
+	"downloaded, but changes can't be made at the moment.  Please try again a bit later."
+
+// readOnly holds the read only mode of this daemon.  It's refreshed by MaintenanceLoop
+var readOnly struct {
+	sync.RWMutex
+	conf       config.MaintenanceConfig  // From the configuration file, which is re-read on SIGHUP
+	confLoaded bool                      // Whether conf has been set yet.  Until then config.Conf is used
+	state      database.MaintenanceState // Set by the instance admins, and shared by all of the daemons
+}
+
+// MaintenanceLoop keeps the read only mode of the daemon up to date.  The mode set by the instance admins is checked
+// every few seconds, and the maintenance section of the configuration file is re-read when the daemon receives a SIGHUP
+func MaintenanceLoop() {
+	readOnly.Lock()
+	if !readOnly.confLoaded {
+		readOnly.conf = config.Conf.Maintenance
+		readOnly.confLoaded = true
+	}
+	readOnly.Unlock()
+	refreshReadOnlyState()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	ticker := time.NewTicker(5 * time.Second)
+	for {
+		select {
+		case <-hup:
+			conf, err := config.ReadMaintenanceConfig()
+			if err != nil {
+				log.Printf("%s: reloading the maintenance configuration failed: %v", config.Conf.Live.Nodename, err)
+				continue
+			}
+			readOnly.Lock()
+			readOnly.conf = conf
+			readOnly.Unlock()
+			log.Printf("%s: reloaded the maintenance configuration.  Read only: %v", config.Conf.Live.Nodename,
+				conf.ReadOnly)
+			refreshReadOnlyState()
+		case <-ticker.C:
+			refreshReadOnlyState()
+		}
+	}
+}
+
+// MaintenanceStatus returns the read only mode from the configuration file, and the one set by the instance admins
+func MaintenanceStatus() (conf config.MaintenanceConfig, state database.MaintenanceState) {
+	readOnly.RLock()
+	defer readOnly.RUnlock()
+	if !readOnly.confLoaded {
+		return config.Conf.Maintenance, readOnly.state
+	}
+	return readOnly.conf, readOnly.state
+}
+
+// ReadOnlyGuard wraps a handler, refusing requests which change things while in read only mode.  Requests other than
+// GET, HEAD, and OPTIONS are treated as changing things, except for those in readPaths.  GET requests in writePaths are
+// treated as changing things too.  Paths ending in "/" match everything beneath them
+func ReadOnlyGuard(next http.Handler, readPaths, writePaths []string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		write := !matchPath(r.URL.Path, readPaths)
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			write = matchPath(r.URL.Path, writePaths)
+		}
+		if write {
+			if ro, msg := ReadOnlyMode(); ro {
+				w.Header().Set("Retry-After", "300")
+				http.Error(w, msg, http.StatusServiceUnavailable)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// LiveQueryWriteError returns whether a live query failed because its statement changes the database.  Queries run on
+// a read only connection, so those statements either don't return data or fail when writing
+func LiveQueryWriteError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "don't use Select with query that returns no data") ||
+		strings.Contains(msg, "attempt to write a readonly database")
+}
+
+// ReadOnlyMode returns whether the server is in read only mode, along with the message to show people.  Read only mode
+// set in the configuration file takes precedence over the instance admins
+func ReadOnlyMode() (bool, string) {
+	conf, state := MaintenanceStatus()
+	switch {
+	case conf.ReadOnly:
+		return true, readOnlyMessage(conf.Message)
+	case state.ReadOnly:
+		return true, readOnlyMessage(state.Message)
+	}
+	return false, ""
+}
+
+// SetReadOnlyMode switches read only mode on or off for all of the daemons.  The other daemons pick up the change within
+// a few seconds
+func SetReadOnlyMode(adminUser string, on bool, message string) (err error) {
+	err = database.MaintenanceModeSave(adminUser, on, message)
+	if err != nil {
+		return
+	}
+	log.Printf("%s: read only mode set to %v by '%s'", config.Conf.Live.Nodename, on, SanitiseLogString(adminUser))
+	refreshReadOnlyState()
+	return
+}
+
+// matchPath returns whether a request path is in a list of paths
+func matchPath(path string, list []string) bool {
+	for _, p := range list {
+		if path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// readOnlyMessage returns the message to show people while in read only mode
+func readOnlyMessage(msg string) string {
+	if strings.TrimSpace(msg) == "" {
+		return ReadOnlyDefaultMessage
+	}
+	return msg
+}
+
+// refreshReadOnlyState updates the cached read only mode set by the instance admins.  When the database can't be
+// reached the last known mode is kept
+func refreshReadOnlyState() {
+	state, err := database.MaintenanceModeGet()
+	if err != nil {
+		return
+	}
+	readOnly.Lock()
+	readOnly.state = state
+	readOnly.Unlock()
+}
@@ -2,121 +2,125 @@ package common
 
 import (
 	"bytes"
-	"context"
 	"crypto/md5"
-	"crypto/tls"
 	"encoding/gob"
 	"encoding/hex"
-	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/sqlitebrowser/dbhub.io/common/config"
 	"github.com/sqlitebrowser/dbhub.io/common/database"
-
-	"github.com/bradfitz/gomemcache/memcache"
 )
 
 var (
-	// Connection handles
-	memCache *memcache.Client
+	// Connection handle for the cache server
+	cache Cache
+
+	// The locks held on cache keys while their data is being generated, keyed by cache key
+	cacheKeyLocks = struct {
+		sync.Mutex
+		locks map[string]*cacheKeyLock
+	}{locks: make(map[string]*cacheKeyLock)}
 )
 
-// CacheData caches data in Memcached
-func CacheData(cacheKey string, cacheData interface{}, cacheSeconds int) error {
+// cacheKeyLock is a lock on a cache key, along with the number of callers holding or waiting for it
+type cacheKeyLock struct {
+	sync.Mutex
+	users int
+}
+
+// CacheData caches data.  The data can be given tags, which let it be invalidated along with all the other data
+// having the same tag by InvalidateCacheTag().  The same tags need passing to GetCachedData() when retrieving it
+func CacheData(cacheKey string, cacheData interface{}, cacheSeconds int, tags ...string) error {
+	cacheKey, err := taggedCacheKey(cacheKey, tags)
+	if err != nil {
+		return err
+	}
+
 	// Encode the data
 	var encodedData bytes.Buffer
 	enc := gob.NewEncoder(&encodedData)
-	err := enc.Encode(cacheData)
+	err = enc.Encode(cacheData)
 	if err != nil {
 		return err
 	}
 
-	// Send the data to memcached
-	cachedData := memcache.Item{Key: cacheKey, Value: encodedData.Bytes(), Expiration: int32(cacheSeconds)}
-	err = memCache.Set(&cachedData)
+	// Send the data to the cache
+	err = cache.Set(cacheKey, encodedData.Bytes(), cacheSeconds)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// ClearCache removes all items currently cached by Memcached, so it's like a newly started server
+// ClearCache removes all items currently cached, so it's like a newly started server
 func ClearCache() (err error) {
-	err = memCache.FlushAll()
-	log.Println("Memcached cleared")
+	err = cache.FlushAll()
+	log.Println("Cache cleared")
 	return
 }
 
-// ConnectCache connects to the Memcached server
-func ConnectCache() (err error) {
-	memCache = memcache.New(config.Conf.Memcache.Server)
-	if config.Conf.Environment.Environment == "production" {
-		z := strings.Split(config.Conf.Memcache.Server, ":")
-		serverName := z[0]
-		memCache.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
-			var td tls.Dialer
-			td.Config = &tls.Config{
-				// This REQUIRES the memcached server to be configured with the full cert chain, not just it's own cert
-				ServerName: serverName,
-			}
-			return td.DialContext(context.Background(), network, addr)
-		}
-	}
-
-	// Test the memcached connection
-	cacheTest := memcache.Item{Key: "connecttext", Value: []byte("1"), Expiration: 10}
-	err = memCache.Set(&cacheTest)
-	if err != nil {
-		return fmt.Errorf("%s: couldn't connect to memcached server: %s", config.Conf.Live.Nodename, err)
-	}
-
-	// Log successful connection message for Memcached
-	log.Printf("%v: connected to Memcached: %v", config.Conf.Live.Nodename, config.Conf.Memcache.Server)
-
-	return nil
-}
-
 // DeleteCacheItem deletes the cached item with the given key if it exists
 func DeleteCacheItem(cacheKey string) error {
-	err := memCache.Delete(cacheKey)
+	return cache.Delete(cacheKey)
+}
 
-	// We don't care about cache misses
-	if errors.Is(err, memcache.ErrCacheMiss) {
-		return nil
+// DatabaseCacheTags returns the tags for data cached about a commit of a database.  Passing an empty commit ID returns
+// just the tag for the database as a whole
+func DatabaseCacheTags(dbOwner, dbName, commitID string) []string {
+	tags := []string{fmt.Sprintf("db/%s/%s", strings.ToLower(dbOwner), dbName)}
+	if commitID != "" {
+		tags = append(tags, fmt.Sprintf("db/%s/%s/%s", strings.ToLower(dbOwner), dbName, commitID))
 	}
-
-	return err
+	return tags
 }
 
-// GetCachedData retrieves cached data from Memcached
-func GetCachedData(cacheKey string, cacheData interface{}) (bool, error) {
-	cacheItem, err := memCache.Get(cacheKey)
+// GetCachedData retrieves cached data.  Data which was cached with tags is only found when given the same tags
+func GetCachedData(cacheKey string, cacheData interface{}, tags ...string) (bool, error) {
+	cacheKey, err := taggedCacheKey(cacheKey, tags)
 	if err != nil {
-		if err == memcache.ErrCacheMiss {
+		return false, err
+	}
+	value, err := cache.Get(cacheKey)
+	if err != nil {
+		if err == ErrCacheMiss {
 			return false, nil
 		}
 		return false, err
 	}
 
-	// If a value was retrieved, return it
-	if cacheItem != nil {
-		// Decode the serialised data
-		var decBuf bytes.Buffer
-		io.Copy(&decBuf, bytes.NewReader(cacheItem.Value))
-		dec := gob.NewDecoder(&decBuf)
-		dec.Decode(cacheData)
-		return true, nil
+	// Decode the serialised data
+	dec := gob.NewDecoder(bytes.NewReader(value))
+	dec.Decode(cacheData)
+	return true, nil
+}
+
+// GetCachedDataOrLock retrieves cached data like GetCachedData().  If the data isn't cached, the caller is expected to
+// generate and cache it, and gets a lock on the cache key for doing so which it releases by calling the returned
+// function.  Other callers for the same key wait until then, and get the newly cached data instead of all generating
+// it at once.  This stops popular pages from being regenerated many times over after their cache entry is invalidated
+func GetCachedDataOrLock(cacheKey string, cacheData interface{}, tags ...string) (ok bool, unlock func(), err error) {
+	unlock = func() {}
+	ok, err = GetCachedData(cacheKey, cacheData, tags...)
+	if ok || err != nil {
+		return
 	}
 
-	return false, nil
+	// Wait for any other caller generating the data, then check whether it has been cached in the meantime
+	unlock = lockCacheKey(cacheKey)
+	ok, err = GetCachedData(cacheKey, cacheData, tags...)
+	if ok || err != nil {
+		unlock()
+		unlock = func() {}
+	}
+	return
 }
 
-// GetViewCount retrieves the view count in Memcached for a database
+// GetViewCount retrieves the view count in the cache for a database
 func GetViewCount(dbOwner string, dbName string) (count int, err error) {
 	// Generate the cache key
 	cacheString := fmt.Sprintf("viewcount-%s-/-%s", dbOwner, dbName)
@@ -124,9 +128,9 @@ func GetViewCount(dbOwner string, dbName string) (count int, err error) {
 	cacheKey := hex.EncodeToString(tempArr[:])
 
 	// Retrieve the view count
-	data, err := memCache.Get(cacheKey)
+	data, err := cache.Get(cacheKey)
 	if err != nil {
-		if err != memcache.ErrCacheMiss {
+		if err != ErrCacheMiss {
 			// A real error occurred
 			return -1, err
 		}
@@ -136,14 +140,14 @@ func GetViewCount(dbOwner string, dbName string) (count int, err error) {
 	}
 
 	// Convert the string value to int, and return it
-	count, err = strconv.Atoi(string(data.Value))
+	count, err = strconv.Atoi(string(data))
 	if err != nil {
 		return -1, err
 	}
 	return count, nil
 }
 
-// IncrementViewCount increments the view counter in Memcached for a database
+// IncrementViewCount increments the view counter in the cache for a database
 func IncrementViewCount(dbOwner string, dbName string) error {
 	// Generate the cache key
 	cacheString := fmt.Sprintf("viewcount-%s-/-%s", dbOwner, dbName)
@@ -151,9 +155,9 @@ func IncrementViewCount(dbOwner string, dbName string) error {
 	cacheKey := hex.EncodeToString(tempArr[:])
 
 	// Attempt to directly increment the counter
-	_, err := memCache.Increment(cacheKey, 1)
+	_, err := cache.Increment(cacheKey, 1)
 	if err != nil {
-		if err != memcache.ErrCacheMiss {
+		if err != ErrCacheMiss {
 			// A real error occurred
 			return err
 		}
@@ -165,13 +169,8 @@ func IncrementViewCount(dbOwner string, dbName string) error {
 			return err
 		}
 
-		// It doesn't so we create a new memcached entry for it
-		cachedData := memcache.Item{
-			Key:        cacheKey,
-			Value:      []byte(fmt.Sprintf("%d", cnt+1)),
-			Expiration: int32(config.Conf.Memcache.DefaultCacheTime),
-		}
-		err = memCache.Set(&cachedData)
+		// It doesn't so we create a new cache entry for it
+		err = cache.Set(cacheKey, []byte(fmt.Sprintf("%d", cnt+1)), config.Conf.Memcache.DefaultCacheTime)
 		if err != nil {
 			return err
 		}
@@ -179,54 +178,17 @@ func IncrementViewCount(dbOwner string, dbName string) error {
 	return nil
 }
 
-// InvalidateCacheEntry invalidate Memcache data for a database entry or entries
+// InvalidateCacheEntry invalidate cached data for a database entry or entries
 func InvalidateCacheEntry(loggedInUser string, dbOwner string, dbName string, commitID string) error {
 	// If commitID is "", that means "for all commits".  Otherwise, just invalidate the data for the requested one
-	var commitList []string
-	if commitID == "" {
-		// Get the list of all commits for the given database
-		var err error
-		l, err := database.GetCommitList(dbOwner, dbName) // Get the full commit list
-		if err != nil {
-			return err
-		}
-		for i := range l {
-			commitList = append(commitList, i)
-		}
-		commitList = append(commitList, "") // Add "" on the end, to indicate all entries
-	} else {
-		// Only one cached commit needs invalidation
-		commitList = append(commitList, commitID)
-	}
-
-	// Loop around, invalidating the now outdated entries
-	for _, c := range commitList {
-		// Invalidate the download page data, for private database versions
-		cacheKey := MetadataCacheKey("dwndb-meta", dbOwner, dbOwner, dbName, c)
-		err := memCache.Delete(cacheKey)
-		if err != nil {
-			if err != memcache.ErrCacheMiss {
-				// Cache miss is not an error we care about
-				return err
-			}
-		}
-
-		// Invalidate the download page data for public database versions
-		cacheKey = MetadataCacheKey("dwndb-meta", "", dbOwner, dbName, c)
-		err = memCache.Delete(cacheKey)
-		if err != nil {
-			if err != memcache.ErrCacheMiss {
-				// Cache miss is not an error we care about
-				return err
-			}
-		}
-	}
-	return nil
+	tags := DatabaseCacheTags(dbOwner, dbName, commitID)
+	return InvalidateCacheTag(tags[len(tags)-1])
 }
 
-// MemcacheHandle returns the Memcached handle
-func MemcacheHandle() *memcache.Client {
-	return memCache
+// InvalidateCacheTag invalidates all the cached data with the given tag at once.  Each tag has a version number which
+// is part of the cache keys of its data, so this is done by changing the version
+func InvalidateCacheTag(tag string) error {
+	return cache.Set(cacheTagKey(tag), []byte(strconv.FormatInt(time.Now().UnixNano(), 10)), 0)
 }
 
 // MetadataCacheKey generates a predictable cache key for metadata information
@@ -239,20 +201,15 @@ func MetadataCacheKey(prefix string, loggedInUser string, dbOwner string, dbName
 	return hex.EncodeToString(tempArr[:])
 }
 
-// SetUserStatusUpdates increments the view counter in Memcached for a database
+// SetUserStatusUpdates stores the number of status updates outstanding for a user in the cache
 func SetUserStatusUpdates(userName string, numUpdates int) error {
 	// Generate the cache key
 	cacheString := fmt.Sprintf("status-updates-%s", userName)
 	tempArr := md5.Sum([]byte(cacheString))
 	cacheKey := hex.EncodeToString(tempArr[:])
 
-	// Create a memcached entry with the new user status updates count
-	cachedData := memcache.Item{
-		Key:        cacheKey,
-		Value:      []byte(fmt.Sprintf("%d", numUpdates)),
-		Expiration: int32(config.Conf.Memcache.DefaultCacheTime),
-	}
-	err := memCache.Set(&cachedData)
+	// Create a cache entry with the new user status updates count
+	err := cache.Set(cacheKey, []byte(fmt.Sprintf("%d", numUpdates)), config.Conf.Memcache.DefaultCacheTime)
 	if err != nil {
 		return err
 	}
@@ -282,29 +239,21 @@ func UserStatusUpdates(userName string) (numUpdates int, err error) {
 	cacheKey := hex.EncodeToString(tempArr[:])
 
 	// Retrieve the status updates counter
-	data, err := memCache.Get(cacheKey)
+	data, err := cache.Get(cacheKey)
 	if err != nil {
-		if err != memcache.ErrCacheMiss {
+		if err != ErrCacheMiss {
 			// A real error occurred
 			return 0, err
 		}
 
-		// There isn't a cached value for the user, so retrieve the list from PG and create an initial value
-		lst, err := database.StatusUpdates(userName)
+		// There isn't a cached value for the user, so count the unread status updates in PG and create an initial value
+		numUpdates, err = database.StatusUpdatesUnreadCount(userName)
 		if err != nil {
 			return 0, err
 		}
-		for _, i := range lst {
-			numUpdates += len(i)
-		}
 
 		// Set the initial number of updates
-		cachedData := memcache.Item{
-			Key:        cacheKey,
-			Value:      []byte(fmt.Sprintf("%d", numUpdates)),
-			Expiration: int32(config.Conf.Memcache.DefaultCacheTime),
-		}
-		err = memCache.Set(&cachedData)
+		err = cache.Set(cacheKey, []byte(fmt.Sprintf("%d", numUpdates)), config.Conf.Memcache.DefaultCacheTime)
 		if err != nil {
 			return 0, err
 		}
@@ -312,9 +261,61 @@ func UserStatusUpdates(userName string) (numUpdates int, err error) {
 	}
 
 	// Convert the string value to int, and return it
-	numUpdates, err = strconv.Atoi(string(data.Value))
+	numUpdates, err = strconv.Atoi(string(data))
 	if err != nil {
 		return 0, err
 	}
 	return numUpdates, nil
 }
+
+// cacheTagKey returns the cache key holding the version of a tag
+func cacheTagKey(tag string) string {
+	tempArr := md5.Sum([]byte("tag/" + tag))
+	return hex.EncodeToString(tempArr[:])
+}
+
+// lockCacheKey locks a cache key, waiting for any other caller holding the lock first.  It returns the function which
+// releases the lock
+func lockCacheKey(cacheKey string) (unlock func()) {
+	cacheKeyLocks.Lock()
+	l, ok := cacheKeyLocks.locks[cacheKey]
+	if !ok {
+		l = &cacheKeyLock{}
+		cacheKeyLocks.locks[cacheKey] = l
+	}
+	l.users++
+	cacheKeyLocks.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		cacheKeyLocks.Lock()
+		l.users--
+		if l.users == 0 {
+			delete(cacheKeyLocks.locks, cacheKey)
+		}
+		cacheKeyLocks.Unlock()
+	}
+}
+
+// taggedCacheKey returns the cache key to use for data with the given tags, which includes the current version of
+// each tag.  Tags which don't have a version yet are given one
+func taggedCacheKey(cacheKey string, tags []string) (string, error) {
+	if len(tags) == 0 {
+		return cacheKey, nil
+	}
+	keyString := cacheKey
+	for _, tag := range tags {
+		version, err := cache.Get(cacheTagKey(tag))
+		if err == ErrCacheMiss {
+			version = []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
+			err = cache.Set(cacheTagKey(tag), version, 0)
+		}
+		if err != nil {
+			return "", err
+		}
+		keyString += "/" + tag + "@" + string(version)
+	}
+	tempArr := md5.Sum([]byte(keyString))
+	return hex.EncodeToString(tempArr[:]), nil
+}
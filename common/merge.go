@@ -13,6 +13,16 @@ import (
 	sqlite "github.com/gwenn/gosqlite"
 )
 
+// MergeConflictError is returned when the changes being merged conflict with the changes made to the destination branch
+// since their last common ancestor.  Conflicts lists the objects and rows changed on both sides
+type MergeConflictError struct {
+	Conflicts []string
+}
+
+func (e MergeConflictError) Error() string {
+	return "The two branches are in conflict. Please fix this manually.\n" + strings.Join(e.Conflicts, "\n")
+}
+
 // Merge merges the commits in commitDiffList into the destination branch destBranch of the given database
 func Merge(destOwner, destName, destBranch, srcOwner, srcName string, commitDiffList []database.CommitEntry, message, loggedInUser string) (newCommitID string, err error) {
 	// Get the details of the head commit for the destination database branch
@@ -164,11 +174,11 @@ func performMerge(destOwner, destName, destBranch, destCommitID, srcOwner, srcNa
 	if conflicts != nil {
 		// TODO We don't have developed an intelligent conflict strategy yet.
 		// So in the case of a conflict, just abort with an error message.
-		return "", fmt.Errorf("The two branches are in conflict. Please fix this manually.\n" + strings.Join(conflicts, "\n"))
+		return "", MergeConflictError{Conflicts: conflicts}
 	}
 
 	// Get Minio location
-	bucket, id, _, err := MinioLocation(destOwner, destName, destCommitID, loggedInUser)
+	bucket, id, err := SQLiteLocation(destOwner, destName, destCommitID, loggedInUser)
 	if err != nil {
 		return
 	}
@@ -273,7 +283,7 @@ func performMerge(destOwner, destName, destBranch, destCommitID, srcOwner, srcNa
 	// Store merged database
 	_, newCommitID, _, err = AddDatabase(loggedInUser, destOwner, destName, false, destBranch, destCommitID,
 		database.KeepCurrentAccessType, "", message, "", tmpFile, time.Now(), time.Time{}, usr.DisplayName, usr.Email, usr.DisplayName, usr.Email,
-		[]string{currentHeadToMerge}, "")
+		[]string{currentHeadToMerge}, "", AddDatabaseOptions{MergeRequest: true})
 	if err != nil {
 		return
 	}
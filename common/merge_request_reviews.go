@@ -0,0 +1,45 @@
+package common
+
+import (
+	"fmt"
+
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// ReviewStates are the states a review of a merge request can have
+var ReviewStates = []string{database.ReviewApproved, database.ReviewChangesRequested}
+
+// headApprovals returns the number of reviews approving the head commit of a merge request.  Approvals of earlier
+// commits don't count, as the changes being merged have moved on since
+func headApprovals(reviews []database.MergeRequestReview, headID string) (approvals int) {
+	for _, r := range reviews {
+		if r.State == database.ReviewApproved && r.Commit == headID {
+			approvals++
+		}
+	}
+	return
+}
+
+// mergeRequestReviewed returns why the reviews of a merge request stop it being merged yet, or an empty string when
+// they don't.  A merge request can't be merged while a reviewer is asking for changes, before it has the number of
+// approvals the destination database requires, or before the owners of the tables it changes have approved it
+func mergeRequestReviewed(destOwner, destName string, disc database.DiscussionEntry) (blocked string, err error) {
+	required, err := database.RequiredApprovals(destOwner, destName)
+	if err != nil {
+		return
+	}
+	reviews, err := database.MergeRequestReviews(destOwner, destName, disc.ID)
+	if err != nil {
+		return
+	}
+	for _, r := range reviews {
+		if r.State == database.ReviewChangesRequested {
+			return fmt.Sprintf("'%s' has requested changes to the merge request", r.User), nil
+		}
+	}
+	if approvals := headApprovals(reviews, disc.MRDetails.Commits[0].ID); approvals < required {
+		return fmt.Sprintf("The merge request needs %d approvals of its head commit before merging, and has %d",
+			required, approvals), nil
+	}
+	return mergeRequestOwnersApproved(destOwner, destName, disc, reviews)
+}
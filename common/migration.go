@@ -0,0 +1,364 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	sqlite "github.com/gwenn/gosqlite"
+)
+
+// migrationTempSuffix is added to the name of a table while it's being rebuilt by a migration script
+const migrationTempSuffix = "_dbhub_migration"
+
+// migrationObject is a table, index, view, or trigger in either of the databases a migration script is generated for
+type migrationObject struct {
+	name    string
+	objType string
+	order   int64
+	sqlA    string
+	sqlB    string
+	tblName string
+}
+
+// MigrationScript generates an SQL script which changes a copy of a database at commit commitA into the database at
+// commit commitB.  Unless schemaOnly is set, the script also changes the data in the tables to match
+func MigrationScript(dbOwner, dbName, commitA, commitB, loggedInUser string, schemaOnly bool) (script string, err error) {
+	bucketA, idA, err := SQLiteLocation(dbOwner, dbName, commitA, loggedInUser)
+	if err != nil {
+		return
+	}
+	bucketB, idB, err := SQLiteLocation(dbOwner, dbName, commitB, loggedInUser)
+	if err != nil {
+		return
+	}
+	if idA == "" || idB == "" {
+		return "", errors.New("Requested database not found")
+	}
+
+	// Retrieve database files from Minio, using locally cached version if it's already there
+	dbA, err := RetrieveDatabaseFile(bucketA, idA)
+	if err != nil {
+		return
+	}
+	dbB, err := RetrieveDatabaseFile(bucketB, idB)
+	if err != nil {
+		return
+	}
+	stmts, err := DBMigrationScript(dbA, dbB, schemaOnly)
+	if err != nil {
+		return
+	}
+
+	// Foreign key enforcement can't be changed inside a transaction, and the legacy ALTER TABLE behaviour stops tables
+	// being rebuilt from changing the references to them in other tables, views, and triggers
+	var b strings.Builder
+	fmt.Fprintf(&b, "-- Migrates %s/%s from commit %s to commit %s\n", dbOwner, dbName, commitA, commitB)
+	fmt.Fprintf(&b, "-- Generated by DBHub.io on %s\n\n", time.Now().UTC().Format(time.RFC3339))
+	b.WriteString("PRAGMA foreign_keys = OFF;\nPRAGMA legacy_alter_table = ON;\nBEGIN TRANSACTION;\n\n")
+	for _, s := range stmts {
+		b.WriteString(s + "\n")
+	}
+	b.WriteString("\nCOMMIT;\nPRAGMA legacy_alter_table = OFF;\n")
+	return b.String(), nil
+}
+
+// DBMigrationScript generates the SQL statements which change a copy of the database file dbA into the database file
+// dbB.  Changed tables are altered when possible, and rebuilt otherwise.  Unless schemaOnly is set, statements changing
+// the data in the tables to match are included too
+func DBMigrationScript(dbA, dbB string, schemaOnly bool) (stmts []string, err error) {
+	sdb, err := openDiffDatabases(dbA, dbB)
+	if err != nil {
+		return
+	}
+	defer sdb.Close()
+
+	// Get the objects in both databases, excluding virtual tables like the diffs do
+	objects := make(map[string]*migrationObject)
+	for _, schema := range []string{"main", "aux"} {
+		dbQuery := "SELECT type, name, tbl_name, sql, rowid FROM " + schema + ".sqlite_master " +
+			"WHERE name NOT LIKE 'sqlite_%' AND sql IS NOT NULL AND (type != 'table' OR sql NOT LIKE 'CREATE VIRTUAL%')"
+		err = sdb.Select(dbQuery, func(s *sqlite.Stmt) error {
+			var o migrationObject
+			var objSQL string
+			if err := s.Scan(&o.objType, &o.name, &o.tblName, &objSQL, &o.order); err != nil {
+				return err
+			}
+			key := o.objType + "\x00" + o.name
+			if z, ok := objects[key]; ok {
+				z.sqlB, z.order = objSQL, o.order
+				return nil
+			}
+			if schema == "main" {
+				o.sqlA = objSQL
+			} else {
+				o.sqlB = objSQL
+			}
+			objects[key] = &o
+			return nil
+		})
+		if err != nil {
+			log.Printf("Error when listing objects for a migration script: %s", err)
+			return nil, err
+		}
+	}
+
+	// Sort the objects in name order, so the script is the same each time it's generated
+	list := make([]*migrationObject, 0, len(objects))
+	for _, o := range objects {
+		list = append(list, o)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].name < list[j].name
+	})
+
+	// Drop the indexes, views, and triggers which were removed or changed first, so they don't get in the way of the
+	// table changes
+	for _, o := range list {
+		if o.objType != "table" && o.sqlA != "" && o.sqlA != o.sqlB {
+			stmts = append(stmts, "DROP "+strings.ToUpper(o.objType)+" IF EXISTS "+EscapeId(o.name)+";")
+		}
+	}
+
+	// Change the tables and their data
+	rebuilt := make(map[string]bool)
+	for _, o := range list {
+		if o.objType != "table" {
+			continue
+		}
+		var tableStmts []string
+		switch {
+		case o.sqlB == "":
+			tableStmts = []string{"DROP TABLE IF EXISTS " + EscapeId(o.name) + ";"}
+		case o.sqlA == "":
+			tableStmts = []string{o.sqlB + ";"}
+			if !schemaOnly {
+				var data []DataDiff
+				data, err = dataDiffForAllTableRows(sdb, "aux", o.name, ActionAdd, true, false)
+				if err != nil {
+					return
+				}
+				tableStmts = append(tableStmts, dataDiffSQL(data)...)
+			}
+		case o.sqlA != o.sqlB:
+			var rebuild bool
+			tableStmts, rebuild, err = migrateTable(sdb, o.name, o.sqlA, o.sqlB, schemaOnly)
+			if err != nil {
+				return
+			}
+			rebuilt[strings.ToLower(o.name)] = rebuild
+		default:
+			if !schemaOnly {
+				var data []DataDiff
+				data, err = dataDiffForModifiedTableRows(sdb, o.name, PreservePkMerge, false)
+				if err != nil {
+					return
+				}
+				tableStmts = dataDiffSQL(data)
+			}
+		}
+		stmts = append(stmts, tableStmts...)
+	}
+
+	// Create the indexes, views, and triggers which were added or changed, in the order they were created in the second
+	// database.  The ones on rebuilt tables are created again too, as they were dropped along with the old table
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].order < list[j].order
+	})
+	for _, o := range list {
+		if o.objType == "table" || o.sqlB == "" {
+			continue
+		}
+		if o.sqlA != o.sqlB || rebuilt[strings.ToLower(o.tblName)] {
+			stmts = append(stmts, o.sqlB+";")
+		}
+	}
+	return
+}
+
+// alterTableStatements returns the ALTER TABLE statements which change a table from the sqlA definition to the sqlB
+// one, by dropping the columns it no longer has and adding the new ones.  The statements are tried on an empty copy of
+// the table, and ok is only returned when the result matches the sqlB definition exactly
+func alterTableStatements(table, sqlA, sqlB string, dropped []string) (stmts []string, ok bool) {
+	mem, err := sqlite.Open(":memory:")
+	if err != nil {
+		return
+	}
+	defer mem.Close()
+	if err = mem.Exec(sqlA); err != nil {
+		return
+	}
+	current := func() (s string) {
+		mem.OneValue("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", &s, table)
+		return
+	}
+
+	for _, c := range dropped {
+		s := "ALTER TABLE " + EscapeId(table) + " DROP COLUMN " + EscapeId(c) + ";"
+		if err = mem.Exec(s); err != nil {
+			return nil, false
+		}
+		stmts = append(stmts, s)
+	}
+
+	// SQLite adds columns by inserting ", <column definition>" into the CREATE TABLE statement after the last column,
+	// so the added text is the part of the new definition which isn't in the old one
+	sqlA = current()
+	pre := 0
+	for pre < len(sqlA) && pre < len(sqlB) && sqlA[pre] == sqlB[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(sqlA)-pre && suf < len(sqlB)-pre && sqlA[len(sqlA)-1-suf] == sqlB[len(sqlB)-1-suf] {
+		suf++
+	}
+	if pre+suf != len(sqlA) {
+		return nil, false
+	}
+	for _, def := range splitColumnDefinitions(sqlB[pre : len(sqlB)-suf]) {
+		s := "ALTER TABLE " + EscapeId(table) + " ADD COLUMN " + def + ";"
+		if err = mem.Exec(s); err != nil {
+			return nil, false
+		}
+		stmts = append(stmts, s)
+	}
+	if current() != sqlB {
+		return nil, false
+	}
+	return stmts, true
+}
+
+// dataDiffSQL returns the SQL statements of a set of data changes
+func dataDiffSQL(data []DataDiff) (stmts []string) {
+	for _, d := range data {
+		if d.Sql != "" {
+			stmts = append(stmts, d.Sql)
+		}
+	}
+	return
+}
+
+// migrateTable returns the statements which change a table from its schema and data in the main database to those in
+// the aux one, and whether the table is rebuilt by them.  When rebuilt, the table loses its indexes and triggers
+func migrateTable(sdb *sqlite.Conn, table, sqlA, sqlB string, schemaOnly bool) (stmts []string, rebuilt bool, err error) {
+	pkA, implicitA, otherA, err := GetPrimaryKeyAndOtherColumns(sdb, "main", table)
+	if err != nil {
+		return
+	}
+	pkB, implicitB, _, err := GetPrimaryKeyAndOtherColumns(sdb, "aux", table)
+	if err != nil {
+		return
+	}
+	colsA, err := sdb.Columns("main", table)
+	if err != nil {
+		return
+	}
+	colsB, err := sdb.Columns("aux", table)
+	if err != nil {
+		return
+	}
+
+	// The columns in both versions of the table keep their data
+	var common, dropped []string
+	for _, c := range append(append([]string{}, pkA...), otherA...) {
+		if implicitA && len(pkA) == 1 && c == pkA[0] {
+			continue
+		}
+		if hasColumn(colsB, c) {
+			common = append(common, c)
+		} else {
+			dropped = append(dropped, c)
+		}
+	}
+
+	// The rows can only be matched up when the primary key of the new table is in the old one too.  When they can't,
+	// or when a new column can't be filled in for the existing rows, the data is replaced instead
+	reload := implicitA != implicitB
+	if !implicitB {
+		for _, c := range pkB {
+			if !hasColumn(colsA, c) {
+				reload = true
+			}
+		}
+	}
+	for _, c := range colsB {
+		if c.NotNull && c.DfltValue == "" && !hasColumn(colsA, c.Name) {
+			reload = true
+		}
+	}
+
+	// Use ALTER TABLE when it can make the change, and rebuild the table otherwise
+	stmts, ok := alterTableStatements(table, sqlA, sqlB, dropped)
+	if !ok {
+		rebuilt = true
+		temp := EscapeId(table + migrationTempSuffix)
+		stmts = []string{
+			"ALTER TABLE " + EscapeId(table) + " RENAME TO " + temp + ";",
+			sqlB + ";",
+		}
+		copyCols := EscapeIds(common)
+		if implicitA && implicitB {
+			// Keep the rowids, so the rows can be matched up
+			copyCols = append([]string{EscapeId(pkB[0])}, copyCols...)
+		}
+		if len(copyCols) > 0 && !(reload && !schemaOnly) {
+			stmts = append(stmts, fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s;", EscapeId(table),
+				strings.Join(copyCols, ", "), strings.Join(copyCols, ", "), temp))
+		}
+		stmts = append(stmts, "DROP TABLE "+temp+";")
+	}
+	if schemaOnly {
+		return
+	}
+
+	// Change the data to match
+	var data []DataDiff
+	if reload {
+		stmts = append(stmts, "DELETE FROM "+EscapeId(table)+";")
+		data, err = dataDiffForAllTableRows(sdb, "aux", table, ActionAdd, true, false)
+	} else {
+		data, err = dataDiffForModifiedTableRows(sdb, table, PreservePkMerge, false)
+	}
+	if err != nil {
+		return
+	}
+	stmts = append(stmts, dataDiffSQL(data)...)
+	return
+}
+
+// splitColumnDefinitions splits the text added to a CREATE TABLE statement by adding columns, eg `, a INTEGER, b TEXT
+// DEFAULT 'x, y'`, into the definition of each column
+func splitColumnDefinitions(added string) (defs []string) {
+	var depth int
+	var quote rune
+	start := 0
+	add := func(end int) {
+		if d := strings.TrimSpace(added[start:end]); d != "" {
+			defs = append(defs, d)
+		}
+	}
+	for i, r := range added {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '[':
+			quote = ']'
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',' && depth == 0:
+			add(i)
+			start = i + 1
+		}
+	}
+	add(len(added))
+	return
+}
@@ -5,43 +5,18 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/sqlitebrowser/dbhub.io/common/config"
 	"github.com/sqlitebrowser/dbhub.io/common/database"
-
-	"github.com/minio/minio-go"
-)
-
-var (
-	// Minio connection handle
-	minioClient *minio.Client
 )
 
-// ConnectMinio parses the Minio configuration, to ensure it seems workable
-// Note - this doesn't actually open a connection to the Minio server.
-func ConnectMinio() (err error) {
-	// Connect to the Minio server
-	minioClient, err = minio.New(config.Conf.Minio.Server, config.Conf.Minio.AccessKey, config.Conf.Minio.Secret, config.Conf.Minio.HTTPS)
-	if err != nil {
-		return fmt.Errorf("Problem with Minio server configuration: %v", err)
-	}
-
-	// Verify the connection is actually functional
-	// NOTE: We don't care about the bucket itself, more just that this function call returns without an error
-	_, err = minioClient.BucketExists("non-existing")
-	if err != nil {
-		return
-	}
-
-	// Log Minio connection
-	log.Printf("%v: minio connection ok. Address: %v", config.Conf.Live.Nodename, config.Conf.Minio.Server)
-	return nil
-}
-
-// LiveRetrieveDatabaseMinio retrieves a live SQLite database from Minio, and places it on the local filesystem
-func LiveRetrieveDatabaseMinio(baseDir, dbOwner, dbName, objectID string) (dbPath string, err error) {
+// LiveRetrieveDatabaseMinio retrieves a live SQLite database from Minio, and places it on the local filesystem.  When
+// progress isn't nil, it's called with the number of bytes written so far as the file is downloaded
+func LiveRetrieveDatabaseMinio(baseDir, dbOwner, dbName, objectID string, progress func(done, total int64)) (dbPath string, err error) {
 	// Create the directory to hold the live database
 	// NOTE: It's probably best to use both dbOwner and dbName in the path, calling the database something like
 	//       "live.sqlite".  That should avoid any potential conflicts with creative database names having
@@ -82,7 +57,16 @@ func LiveRetrieveDatabaseMinio(baseDir, dbOwner, dbName, objectID string) (dbPat
 		return
 	}
 	defer f.Close()
-	bytesWritten, err := io.Copy(f, userDB)
+	var src io.Reader = userDB
+	if progress != nil {
+		var total int64
+		total, err = userDB.Size()
+		if err != nil {
+			return
+		}
+		src = &progressReader{r: userDB, total: total, progress: progress}
+	}
+	bytesWritten, err := io.Copy(f, src)
 	if err != nil {
 		return
 	}
@@ -98,6 +82,21 @@ func LiveRetrieveDatabaseMinio(baseDir, dbOwner, dbName, objectID string) (dbPat
 	return
 }
 
+// progressReader passes on the data read from another reader, reporting how much has been read so far
+type progressReader struct {
+	done     int64
+	progress func(done, total int64)
+	r        io.Reader
+	total    int64
+}
+
+func (p *progressReader) Read(b []byte) (n int, err error) {
+	n, err = p.r.Read(b)
+	p.done += int64(n)
+	p.progress(p.done, p.total)
+	return
+}
+
 // LiveStoreDatabaseMinio stores a live SQLite database in Minio
 func LiveStoreDatabaseMinio(db *os.File, dbOwner, dbName string, dbSize int64) (minioObjectID string, err error) {
 	// If the database doesn't already exist in the PG backend, then we generate a new Minio object id for it
@@ -120,21 +119,8 @@ func LiveStoreDatabaseMinio(db *os.File, dbOwner, dbName string, dbSize int64) (
 		}
 	}
 
-	// If a Minio bucket with the desired name doesn't already exist, create it
-	var found bool
-	found, err = minioClient.BucketExists(bkt)
-	if err != nil {
-		return
-	}
-	if !found {
-		err = minioClient.MakeBucket(bkt, "us-east-1")
-		if err != nil {
-			return
-		}
-	}
-
 	// Store the SQLite database file in Minio
-	numBytes, err := minioClient.PutObject(bkt, minioObjectID, db, dbSize, minio.PutObjectOptions{ContentType: "application/x-sqlite3"})
+	numBytes, err := putDatabaseObject(dbOwner, bkt, minioObjectID, db, dbSize)
 	if err != nil {
 		return
 	}
@@ -154,7 +140,7 @@ func LiveStoreDatabaseMinio(db *os.File, dbOwner, dbName string, dbSize int64) (
 
 // MinioDeleteDatabase deletes a database file from Minio
 func MinioDeleteDatabase(source, dbOwner, dbName, bucket, id string) (err error) {
-	err = minioClient.RemoveObject(bucket, id)
+	err = blobStore.Remove(bucket, id)
 	if err != nil {
 		return
 	}
@@ -167,17 +153,25 @@ func MinioDeleteDatabase(source, dbOwner, dbName, bucket, id string) (err error)
 }
 
 // MinioHandle gets a handle from Minio for a SQLite database object
-func MinioHandle(bucket, id string) (*minio.Object, error) {
-	userDB, err := minioClient.GetObject(bucket, id, minio.GetObjectOptions{})
+func MinioHandle(bucket, id string) (BlobObject, error) {
+	obj, err := blobStore.Get(bucket, id)
 	if err != nil {
 		log.Printf("Error retrieving DB from Minio: %v", err)
 		return nil, errors.New("Error retrieving database from internal storage")
 	}
+
+	// Encrypted database files are decrypted as they're read
+	userDB, err := decryptObject(obj)
+	if err != nil {
+		obj.Close()
+		log.Printf("Error decrypting DB from Minio: %v", err)
+		return nil, errors.New("Error retrieving database from internal storage")
+	}
 	return userDB, nil
 }
 
 // MinioHandleClose closes a Minio object handle.  Probably most useful for calling with defer()
-func MinioHandleClose(userDB *minio.Object) (err error) {
+func MinioHandleClose(userDB BlobObject) (err error) {
 	err = userDB.Close()
 	if err != nil {
 		log.Printf("Error closing object handle: %v", err)
@@ -199,7 +193,7 @@ func RetrieveDatabaseFile(bucket, id string) (newDB string, err error) {
 			// * The database isn't already being fetched, so we're ok to proceed
 
 			// Get a handle from Minio for the database object
-			var userDB *minio.Object
+			var userDB BlobObject
 			userDB, err = MinioHandle(bucket, id)
 			if err != nil {
 				return "", err
@@ -250,27 +244,36 @@ func RetrieveDatabaseFile(bucket, id string) (newDB string, err error) {
 	return
 }
 
-// StoreDatabaseFile stores a database file in Minio
-func StoreDatabaseFile(db *os.File, sha string, dbSize int64) error {
+// ServeDatabaseRange sends the byte ranges of a database file asked for in the Range header of a request, or the
+// whole file when no ranges were asked for.  Stored objects are seekable, so only the requested parts of the file are
+// retrieved from storage
+func ServeDatabaseRange(w http.ResponseWriter, r *http.Request, userDB BlobObject, lastModified time.Time) (bytesWritten int64) {
+	cw := &countingResponseWriter{ResponseWriter: w}
+	w.Header().Set("Content-Type", "application/x-sqlite3")
+	http.ServeContent(cw, r, "", lastModified, userDB)
+	return cw.written
+}
+
+// countingResponseWriter is an http.ResponseWriter which keeps track of how many bytes have been written to it
+type countingResponseWriter struct {
+	http.ResponseWriter
+	written int64
+}
+
+func (w *countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+// StoreDatabaseFile stores a database file in Minio.  When encryption is enabled, the file is encrypted using the key
+// for the database owner
+func StoreDatabaseFile(dbOwner string, db *os.File, sha string, dbSize int64) error {
 	bkt := sha[:MinioFolderChars]
 	id := sha[MinioFolderChars:]
 
-	// If a Minio bucket with the desired name doesn't already exist, create it
-	found, err := minioClient.BucketExists(bkt)
-	if err != nil {
-		log.Printf("Error when checking if Minio bucket '%s' already exists: %v", bkt, err)
-		return err
-	}
-	if !found {
-		err := minioClient.MakeBucket(bkt, "us-east-1")
-		if err != nil {
-			log.Printf("Error creating Minio bucket '%v': %v", bkt, err)
-			return err
-		}
-	}
-
 	// Store the SQLite database file in Minio
-	numBytes, err := minioClient.PutObject(bkt, id, db, dbSize, minio.PutObjectOptions{ContentType: "application/x-sqlite3"})
+	numBytes, err := putDatabaseObject(dbOwner, bkt, id, db, dbSize)
 	if err != nil {
 		log.Printf("Storing file in Minio failed: %v", err)
 		return err
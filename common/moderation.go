@@ -0,0 +1,45 @@
+package common
+
+import (
+	"strings"
+
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// AbuseReasons are the reasons databases and comments can be reported to the instance admins for
+var AbuseReasons = []string{"copyright", "harassment", "illegal", "malware", "other", "spam"}
+
+// AbuseReportMaxDetails is the longest the details given with an abuse report can be, in characters
+const AbuseReportMaxDetails = 2000
+
+// HideBlockedComments removes the comments written by users the logged in user has blocked from a discussion
+func HideBlockedComments(loggedInUser string, comments []database.DiscussionCommentEntry) ([]database.DiscussionCommentEntry, error) {
+	if loggedInUser == "" {
+		return comments, nil
+	}
+	blocks, err := database.BlockedUsers(loggedInUser)
+	if err != nil || len(blocks) == 0 {
+		return comments, err
+	}
+	blocked := make(map[string]bool)
+	for _, b := range blocks {
+		blocked[strings.ToLower(b.User)] = true
+	}
+	var list []database.DiscussionCommentEntry
+	for _, c := range comments {
+		if !blocked[strings.ToLower(c.Commenter)] {
+			list = append(list, c)
+		}
+	}
+	return list, nil
+}
+
+// ValidAbuseReason returns whether the reason given for an abuse report is a known one
+func ValidAbuseReason(reason string) bool {
+	for _, r := range AbuseReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// OfflineBranchName returns the name of a new branch for a database edited offline, which isn't in the given branch list
+func OfflineBranchName(branchList map[string]database.BranchEntry) string {
+	for i := 1; ; i++ {
+		name := fmt.Sprintf("offline-%d", i)
+		if _, ok := branchList[name]; !ok {
+			return name
+		}
+	}
+}
+
+// MergeOffline merges the changes of a database edited offline back into the branch it was pulled from, after the branch
+// has moved on.  The edited database needs to be the head of a branch of its own, forked from the commit it was pulled
+// from.  The changes made on both sides since then are merged with a row level three-way merge, adding a merge commit
+// to the destination branch and removing the offline branch.  When the changes conflict, or the schema change policy of
+// the destination branch doesn't allow them to be merged directly, a merge request is opened from the offline branch
+// instead, listing the conflicts.  The returned merge request ID is 0 when the changes were merged
+func MergeOffline(loggedInUser, dbOwner, dbName, destBranch, offlineBranch string) (commitID string, mrID int, conflicts []string, err error) {
+	ancestorID, commits, _, err := GetCommonAncestorCommits(dbOwner, dbName, offlineBranch, dbOwner, dbName, destBranch)
+	if err != nil {
+		return
+	}
+	if ancestorID == "" || len(commits) == 0 {
+		return "", 0, nil, errors.New("The offline changes don't have a common ancestor with the branch")
+	}
+
+	// Commits made outside of merge requests can't get around the schema change policy of the branch
+	bucket, id, err := SQLiteLocation(dbOwner, dbName, commits[0].ID, loggedInUser)
+	if err != nil {
+		return
+	}
+	offlineDB, err := RetrieveDatabaseFile(bucket, id)
+	if err != nil {
+		return
+	}
+	policyErr := SchemaPolicyCheck(dbOwner, dbName, destBranch, ancestorID, offlineDB)
+	if policyErr != nil {
+		conflicts = []string{policyErr.Error()}
+	} else {
+		msg := fmt.Sprintf("Merge offline changes from branch '%s' into '%s'", offlineBranch, destBranch)
+		commitID, err = Merge(dbOwner, dbName, destBranch, dbOwner, dbName, commits, msg, loggedInUser)
+		var conflictErr MergeConflictError
+		if errors.As(err, &conflictErr) {
+			conflicts = conflictErr.Conflicts
+		} else if err != nil {
+			return
+		} else {
+			// The offline commits are now part of the destination branch, so the offline branch isn't needed any more
+			_, err = DeleteBranches(loggedInUser, dbOwner, dbName, []string{offlineBranch})
+			return
+		}
+	}
+
+	// The changes couldn't be merged automatically, so open a merge request for them to be looked at
+	title := fmt.Sprintf("Offline changes to branch '%s'", destBranch)
+	descrip := fmt.Sprintf("These changes were made offline, starting from commit %s.  They couldn't be merged "+
+		"automatically:\n\n* %s", ancestorID, strings.Join(conflicts, "\n* "))
+	mrDetails := database.MergeRequestEntry{
+		Commits:      commits,
+		DestBranch:   destBranch,
+		SourceBranch: offlineBranch,
+		SourceDBName: dbName,
+		SourceOwner:  dbOwner,
+	}
+	mrID, err = database.StoreDiscussion(dbOwner, dbName, loggedInUser, title, descrip, database.MERGE_REQUEST,
+		mrDetails)
+	if err != nil {
+		return
+	}
+
+	// Generate an event about the new merge request
+	err = database.NewEvent(database.EventDetails{
+		DBName:   dbName,
+		DiscID:   mrID,
+		Owner:    dbOwner,
+		Title:    title,
+		Type:     database.EVENT_NEW_MERGE_REQUEST,
+		URL:      fmt.Sprintf("/merge/%s/%s?id=%d", url.PathEscape(dbOwner), url.PathEscape(dbName), mrID),
+		UserName: loggedInUser,
+	})
+	if err != nil {
+		log.Printf("Error when creating a new event: %s", err.Error())
+	}
+
+	// Ask the owners of the tables changed by the merge request to review it
+	err = RequestMergeRequestReviews(dbOwner, dbName, database.DiscussionEntry{
+		Creator:   loggedInUser,
+		ID:        mrID,
+		MRDetails: mrDetails,
+		Title:     title,
+	})
+	if err != nil {
+		log.Printf("Error when requesting merge request reviews: %s", err.Error())
+	}
+
+	// Invalidate the memcache data for the database, so the new MR count gets picked up
+	err = InvalidateCacheEntry(loggedInUser, dbOwner, dbName, "")
+	if err != nil {
+		log.Printf("Error when invalidating memcache entries: %s", err.Error())
+	}
+	return "", mrID, conflicts, nil
+}
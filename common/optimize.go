@@ -0,0 +1,451 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	sqlite "github.com/gwenn/gosqlite"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+const (
+	// optimizeCopyPages is the number of pages copied back into a live database each step, after vacuuming it
+	optimizeCopyPages = 1000
+
+	// optimizeProgressInterval is how often the progress of an optimisation is checked and recorded
+	optimizeProgressInterval = time.Second
+
+	// optimizeStaleAfter is how long an optimisation can run before it's taken to have been interrupted, letting a new
+	// one be started
+	optimizeStaleAfter = 6 * time.Hour
+)
+
+// JobRequestOptimize holds the data used when making an optimisation request to our job queue backend.  Vacuum
+// rebuilds the database without its unused space, and Analyze gathers the statistics used by the query planner
+type JobRequestOptimize struct {
+	Analyze bool `json:"analyze"`
+	Vacuum  bool `json:"vacuum"`
+}
+
+// JobResponseDBOptimize holds the fields used for receiving the result of an optimisation from our job queue backend
+type JobResponseDBOptimize struct {
+	Err        string `json:"error"`
+	SizeAfter  int64  `json:"size_after"`
+	SizeBefore int64  `json:"size_before"`
+}
+
+// LiveOptimize runs VACUUM and/or ANALYZE on a live database.  The job is run in the background priority class, with
+// its progress recorded as it goes so it can be followed by the caller
+func LiveOptimize(liveNode, loggedInUser, dbOwner, dbName string, req JobRequestOptimize) (sizeBefore, sizeAfter int64, err error) {
+	// Archived databases are read only
+	archived, err := database.CheckDBArchived(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	if archived {
+		return 0, 0, database.ErrDBArchived
+	}
+
+	// Only one optimisation of a database runs at a time
+	err = database.OptimizationStart(dbOwner, dbName, loggedInUser, optimizeStaleAfter)
+	if err != nil {
+		return
+	}
+
+	// Serialise the request to JSON.  It ends up base64 encoded in the job details, the same as bulk requests
+	reqJSON, err := json.Marshal(req)
+	if err == nil {
+		var resp JobResponseDBOptimize
+		err = JobSubmit(&resp, liveNode, "optimize", loggedInUser, dbOwner, dbName, reqJSON)
+		if err == nil && resp.Err != "" {
+			err = errors.New(resp.Err)
+		}
+		sizeBefore, sizeAfter = resp.SizeBefore, resp.SizeAfter
+	}
+
+	// Record the outcome
+	var msg string
+	if err != nil {
+		msg = err.Error()
+	}
+	database.OptimizationFinish(dbOwner, dbName, sizeBefore, sizeAfter, "", msg)
+	return
+}
+
+// OptimizeCommit runs VACUUM and/or ANALYZE on the head commit of a branch of a standard database, storing the result
+// as a new commit on the branch.  If no branch name is given, the default branch is used.  The returned status is the
+// HTTP status code matching the error
+func OptimizeCommit(loggedInUser, dbOwner, dbName, branchName, commitMsg string, req JobRequestOptimize) (commitID string, sizeBefore, sizeAfter int64, httpStatus int, err error) {
+	// Make sure the user has write access to the database
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+	if err != nil {
+		return "", 0, 0, http.StatusInternalServerError, err
+	}
+	if !allowed {
+		return "", 0, 0, http.StatusNotFound, errors.New("Database not found")
+	}
+
+	// Live databases are optimised in place instead, and databases encrypted by their owner can't be read
+	isLive, _, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		return "", 0, 0, http.StatusInternalServerError, err
+	}
+	if isLive {
+		return "", 0, 0, http.StatusBadRequest, errors.New("That database is a live database.  It's optimised " +
+			"in place, without creating commits")
+	}
+	clientEncrypted, err := database.CheckDBClientEncrypted(dbOwner, dbName)
+	if err != nil {
+		return "", 0, 0, http.StatusInternalServerError, err
+	}
+	if clientEncrypted {
+		return "", 0, 0, http.StatusBadRequest, ErrClientEncrypted
+	}
+	archived, err := database.CheckDBArchived(dbOwner, dbName)
+	if err != nil {
+		return "", 0, 0, http.StatusInternalServerError, err
+	}
+	if archived {
+		return "", 0, 0, http.StatusForbidden, database.ErrDBArchived
+	}
+
+	// Find the head commit of the branch
+	if branchName == "" {
+		branchName, err = database.GetDefaultBranchName(dbOwner, dbName)
+		if err != nil {
+			return "", 0, 0, http.StatusInternalServerError, err
+		}
+	}
+	branches, err := database.GetBranches(dbOwner, dbName)
+	if err != nil {
+		return "", 0, 0, http.StatusInternalServerError, err
+	}
+	head, ok := branches[branchName]
+	if !ok {
+		return "", 0, 0, http.StatusNotFound, errors.New("Branch not found")
+	}
+
+	// Only one optimisation of a database runs at a time
+	err = database.OptimizationStart(dbOwner, dbName, loggedInUser, optimizeStaleAfter)
+	if errors.Is(err, database.ErrOptimizationRunning) {
+		return "", 0, 0, http.StatusConflict, err
+	}
+	if err != nil {
+		return "", 0, 0, http.StatusInternalServerError, err
+	}
+	commitID, sizeBefore, sizeAfter, httpStatus, err = optimizeCommit(loggedInUser, dbOwner, dbName, branchName,
+		head.Commit, commitMsg, req)
+
+	// Record the outcome
+	var msg string
+	if err != nil {
+		msg = err.Error()
+	}
+	database.OptimizationFinish(dbOwner, dbName, sizeBefore, sizeAfter, commitID, msg)
+	return
+}
+
+// optimizeCommit does the work of OptimizeCommit, once the optimisation has been recorded as started
+func optimizeCommit(loggedInUser, dbOwner, dbName, branchName, headCommit, commitMsg string, req JobRequestOptimize) (commitID string, sizeBefore, sizeAfter int64, httpStatus int, err error) {
+	bucket, id, err := SQLiteLocation(dbOwner, dbName, headCommit, loggedInUser)
+	if err != nil {
+		return "", 0, 0, http.StatusInternalServerError, err
+	}
+	if id == "" {
+		return "", 0, 0, http.StatusNotFound, errors.New("Database not found")
+	}
+	dbFile, err := RetrieveDatabaseFile(bucket, id)
+	if err != nil {
+		return "", 0, 0, http.StatusInternalServerError, err
+	}
+	fileInfo, err := os.Stat(dbFile)
+	if err != nil {
+		return "", 0, 0, http.StatusInternalServerError, err
+	}
+	sizeBefore = fileInfo.Size()
+
+	// Work on a copy of the head commit, so the cached file isn't changed.  When vacuuming, the copy is written by
+	// VACUUM itself
+	tmpFile, err := os.CreateTemp(config.Conf.DiskCache.Directory, "dbhub-optimize-*.db")
+	if err != nil {
+		return "", 0, 0, http.StatusInternalServerError, err
+	}
+	tmpName := tmpFile.Name()
+	defer os.Remove(tmpName)
+	tmpFile.Close()
+	progress := optimizeProgress(dbOwner, dbName)
+	err = func() (err error) {
+		if !req.Vacuum {
+			return copyFile(dbFile, tmpName)
+		}
+		sdb, err := optimizeOpen(dbFile, true)
+		if err != nil {
+			return
+		}
+		defer sdb.Close()
+		if err = os.Remove(tmpName); err != nil {
+			return
+		}
+		return sqliteVacuumInto(sdb, tmpName, func(done, total int64) {
+			progress("vacuum", done, total)
+		})
+	}()
+	if err != nil {
+		return "", 0, 0, http.StatusInternalServerError, err
+	}
+
+	// Gather the statistics for the query planner
+	if req.Analyze {
+		progress("analyze", 0, 0)
+		err = func() (err error) {
+			sdb, err := optimizeOpen(tmpName, false)
+			if err != nil {
+				return
+			}
+			defer sdb.Close()
+			return sqliteAnalyze(sdb)
+		}()
+		if err != nil {
+			return "", 0, 0, http.StatusInternalServerError, err
+		}
+	}
+
+	// Store the optimised database as a new commit
+	newDB, err := os.Open(tmpName)
+	if err != nil {
+		return "", 0, 0, http.StatusInternalServerError, err
+	}
+	defer newDB.Close()
+	fileInfo, err = newDB.Stat()
+	if err != nil {
+		return "", 0, 0, http.StatusInternalServerError, err
+	}
+	sizeAfter = fileInfo.Size()
+	if commitMsg == "" {
+		switch {
+		case req.Vacuum && req.Analyze:
+			commitMsg = "Optimised the database with VACUUM and ANALYZE"
+		case req.Vacuum:
+			commitMsg = "Optimised the database with VACUUM"
+		default:
+			commitMsg = "Optimised the database with ANALYZE"
+		}
+	}
+	_, commitID, _, err = AddDatabase(loggedInUser, dbOwner, dbName, false, branchName, headCommit,
+		database.KeepCurrentAccessType, "", commitMsg, "", newDB, time.Now().UTC(), time.Time{}, "", "", "", "", nil,
+		"", AddDatabaseOptions{})
+	if errors.Is(err, database.ErrDBArchived) {
+		return "", 0, 0, http.StatusForbidden, err
+	}
+	if err != nil {
+		return "", 0, 0, http.StatusInternalServerError, err
+	}
+	return commitID, sizeBefore, sizeAfter, http.StatusOK, nil
+}
+
+// SQLiteOptimizeLive is used by our job queue backend nodes to run VACUUM and/or ANALYZE on a live database.  So the
+// progress of the VACUUM can be followed, it writes a vacuumed copy of the database first, which is then copied back
+// over the database using the SQLite backup API.  Connections reading the database keep seeing its earlier contents
+// until the copy is finished.  The progress function is called as each stage of the optimisation moves along
+func SQLiteOptimizeLive(baseDir, dbOwner, dbName string, req JobRequestOptimize, progress func(stage string, done, total int64)) (sizeBefore, sizeAfter int64, err error) {
+	if err = liveTransactionCheck(dbOwner, dbName); err != nil {
+		return
+	}
+	dbPath := filepath.Join(baseDir, dbOwner, dbName, "live.sqlite")
+	sizeBefore, err = liveDatabaseSize(baseDir, dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	sdb, err := optimizeOpen(dbPath, false)
+	if err != nil {
+		return
+	}
+	defer sdb.Close()
+	if err = sdb.BusyTimeout(liveBusyTimeout); err != nil {
+		return
+	}
+
+	if req.Vacuum {
+		tmpName := dbPath + ".optimize"
+		os.Remove(tmpName)
+		defer os.Remove(tmpName)
+		err = sqliteVacuumInto(sdb, tmpName, func(done, total int64) {
+			progress("vacuum", done, total)
+		})
+		if err != nil {
+			return
+		}
+
+		// Copy the vacuumed database back over the live one
+		err = func() (err error) {
+			src, err := optimizeOpen(tmpName, true)
+			if err != nil {
+				return
+			}
+			defer src.Close()
+			b, err := sqlite.NewBackup(sdb, "main", src, "main")
+			if err != nil {
+				return
+			}
+			for err == nil {
+				err = b.Step(optimizeCopyPages)
+				s := b.Status()
+				progress("copy", int64(s.PageCount-s.Remaining), int64(s.PageCount))
+			}
+			if err != sqlite.Done {
+				b.Close()
+				return
+			}
+			return b.Close()
+		}()
+		if err != nil {
+			return
+		}
+
+		// Move the changes out of the WAL file, which also shrinks the database file.  If connections reading the
+		// database stop it finishing, that's left for the automatic checkpoints to do later on
+		err = sdb.Select("PRAGMA wal_checkpoint(TRUNCATE)", func(s *sqlite.Stmt) error {
+			return nil
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	// Gather the statistics for the query planner
+	if req.Analyze {
+		progress("analyze", 0, 0)
+		if err = sqliteAnalyze(sdb); err != nil {
+			return
+		}
+	}
+	sizeAfter, err = liveDatabaseSize(baseDir, dbOwner, dbName)
+	return
+}
+
+// copyFile copies the contents of one file into another, creating or truncating the destination file
+func copyFile(src, dst string) (err error) {
+	inFile, err := os.Open(src)
+	if err != nil {
+		return
+	}
+	defer inFile.Close()
+	outFile, err := os.Create(dst)
+	if err != nil {
+		return
+	}
+	_, err = io.Copy(outFile, inFile)
+	if err != nil {
+		outFile.Close()
+		return
+	}
+	return outFile.Close()
+}
+
+// optimizeOpen opens a database to be optimised.  No user provided SQL is run on it, so there's no authorizer or limits,
+// but it's still opened with the defensive flag set and the trusted schema flag off
+func optimizeOpen(dbPath string, readOnly bool) (sdb *sqlite.Conn, err error) {
+	flags := sqlite.OpenReadWrite | sqlite.OpenFullMutex
+	if readOnly {
+		flags = sqlite.OpenReadOnly | sqlite.OpenFullMutex
+	}
+	sdb, err = sqlite.Open(dbPath, flags)
+	if err != nil {
+		log.Printf("Couldn't open database to optimise it: %s", err)
+		return
+	}
+	if err = sdb.EnableExtendedResultCodes(true); err != nil {
+		sdb.Close()
+		return nil, err
+	}
+	var enabled bool
+	if enabled, err = sdb.EnableDefensive(true); !enabled || err != nil {
+		sdb.Close()
+		return nil, fmt.Errorf("Couldn't enable the defensive flag: %v", err)
+	}
+	if enabled, err = sdb.EnableTrustedSchema(false); enabled || err != nil {
+		sdb.Close()
+		return nil, fmt.Errorf("Couldn't disable the trusted schema flag: %v", err)
+	}
+	return
+}
+
+// optimizeProgress returns the function recording the progress of an optimisation of a database.  Progress is recorded
+// at most once every optimizeProgressInterval, except when moving on to the next stage or finishing one
+func optimizeProgress(dbOwner, dbName string) func(stage string, done, total int64) {
+	var lastStage string
+	var lastTime time.Time
+	return func(stage string, done, total int64) {
+		if stage == lastStage && done < total && time.Since(lastTime) < optimizeProgressInterval {
+			return
+		}
+		lastStage, lastTime = stage, time.Now()
+		database.OptimizationProgress(dbOwner, dbName, stage, done, total)
+	}
+}
+
+// sqliteAnalyze gathers the statistics used by the query planner of a database
+func sqliteAnalyze(sdb *sqlite.Conn) (err error) {
+	if err = sdb.Exec("ANALYZE"); err != nil {
+		return
+	}
+	return sdb.Select("PRAGMA optimize", func(s *sqlite.Stmt) error {
+		return nil
+	})
+}
+
+// sqliteVacuumInto writes a vacuumed copy of a database to a new file.  The progress function is called now and then
+// with the number of pages written so far, out of the number of pages in use in the database
+func sqliteVacuumInto(sdb *sqlite.Conn, target string, progress func(done, total int64)) (err error) {
+	var pageSize, pageCount, freePages int64
+	for _, p := range []struct {
+		name  string
+		value *int64
+	}{
+		{"page_size", &pageSize},
+		{"page_count", &pageCount},
+		{"freelist_count", &freePages},
+	} {
+		if err = sdb.OneValue("PRAGMA "+p.name, p.value); err != nil {
+			return
+		}
+	}
+	total := pageCount - freePages
+	progress(0, total)
+
+	// The size of the new file tells how far the VACUUM has got, so it's checked every now and then until the VACUUM
+	// finishes
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(optimizeProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if fileInfo, err := os.Stat(target); err == nil {
+					progress(fileInfo.Size()/pageSize, total)
+				}
+			}
+		}
+	}()
+	err = sdb.Exec("VACUUM INTO ?", target)
+	close(done)
+	<-finished
+	if err != nil {
+		return
+	}
+	progress(total, total)
+	return
+}
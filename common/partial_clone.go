@@ -0,0 +1,246 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	sqlite "github.com/gwenn/gosqlite"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// DownloadPartialDatabase returns a copy of a standard database holding only some of its tables, along with their
+// indexes and triggers.  It's for working with parts of large databases, without needing to download all of them.  The
+// copies are created as needed, and kept in the disk cache.  The returned status is the HTTP status code matching the
+// error
+func DownloadPartialDatabase(w http.ResponseWriter, r *http.Request, dbOwner, dbName, commitID, loggedInUser, sourceSw string, tables []string) (bytesWritten int64, httpStatus int, err error) {
+	isLive, _, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		return 0, http.StatusInternalServerError, err
+	}
+	if isLive {
+		return 0, http.StatusBadRequest, errors.New("Live databases can only be downloaded in full")
+	}
+
+	// Verify the given database exists and is ok to be downloaded (and get the Minio bucket + id while at it)
+	bucket, id, lastModified, clientEncrypted, err := minioLocation(dbOwner, dbName, commitID, loggedInUser)
+	if err != nil {
+		return 0, http.StatusInternalServerError, err
+	}
+	if clientEncrypted {
+		return 0, http.StatusBadRequest, ErrClientEncrypted
+	}
+
+	// Create the copy with just the requested tables, unless it's already in the disk cache
+	partialPath, httpStatus, err := partialDatabaseFile(bucket, id, tables)
+	if err != nil {
+		return
+	}
+	f, err := os.Open(partialPath)
+	if err != nil {
+		return 0, http.StatusInternalServerError, err
+	}
+	defer f.Close()
+	userDB := &filesystemBlobObject{f}
+	size, err := userDB.Size()
+	if err != nil {
+		return 0, http.StatusInternalServerError, err
+	}
+
+	// The copy of each set of tables has its own ETag, based on the database file it was taken from
+	if NotModified(w, r, `"`+bucket+filepath.Base(partialPath)+`"`, lastModified) {
+		return 0, http.StatusOK, nil
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, dbName))
+	w.Header().Set("Accept-Ranges", "bytes")
+	if r.Header.Get("Range") != "" {
+		return ServeDatabaseRange(w, r, userDB, lastModified), http.StatusOK, nil
+	}
+
+	// Was a user agent part of the request?
+	var userAgent string
+	if ua, ok := r.Header["User-Agent"]; ok {
+		userAgent = ua[0]
+	}
+
+	// Make a record of the download
+	err = database.LogDownload(dbOwner, dbName, loggedInUser, r.RemoteAddr, sourceSw, userAgent, RequestCountry(r),
+		RequestReferrer(r), time.Now(), bucket+id)
+	if err != nil {
+		return 0, http.StatusInternalServerError, err
+	}
+
+	// Send the database to the user
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", size))
+	w.Header().Set("Content-Type", "application/x-sqlite3")
+	bytesWritten, err = io.Copy(w, userDB)
+	if err != nil {
+		log.Printf("Error returning partial DB file: %v", err)
+		return bytesWritten, http.StatusInternalServerError, err
+	}
+
+	// If downloaded by someone other than the owner, increment the download count for the database
+	if strings.ToLower(loggedInUser) != strings.ToLower(dbOwner) {
+		err = database.IncrementDownloadCount(dbOwner, dbName)
+		if err != nil {
+			return bytesWritten, http.StatusInternalServerError, err
+		}
+	}
+	return bytesWritten, http.StatusOK, nil
+}
+
+// partialDatabaseFile returns the path in the disk cache of a copy of a database file holding only the given tables.
+// The copy is created when it's not there already
+func partialDatabaseFile(bucket, id string, tables []string) (partialPath string, httpStatus int, err error) {
+	// Each set of tables gets its own copy, whatever order they were asked for in
+	var names []string
+	seen := make(map[string]bool)
+	for _, t := range tables {
+		if !seen[t] {
+			seen[t] = true
+			names = append(names, t)
+		}
+	}
+	sort.Strings(names)
+	h := sha256.Sum256([]byte(strings.Join(names, "\x00")))
+	partialPath = filepath.Join(config.Conf.DiskCache.Directory, bucket, id+".tables-"+hex.EncodeToString(h[:8]))
+	if _, err = os.Stat(partialPath); err == nil {
+		return partialPath, http.StatusOK, nil
+	}
+
+	dbPath, err := RetrieveDatabaseFile(bucket, id)
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+
+	// Write the copy to a temporary file first, then move it into place once it's finished.  That way other callers
+	// never see a partly written copy
+	tmpFile, err := os.CreateTemp(filepath.Dir(partialPath), filepath.Base(partialPath)+".new-*")
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+	httpStatus, err = copyTables(dbPath, tmpFile.Name(), names)
+	if err != nil {
+		return
+	}
+	err = os.Rename(tmpFile.Name(), partialPath)
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	return partialPath, http.StatusOK, nil
+}
+
+// copyTables copies tables from one SQLite database into a new one, along with their indexes and triggers.  Views are
+// left out, as they may use tables which aren't being copied
+func copyTables(srcPath, destPath string, tables []string) (httpStatus int, err error) {
+	sdb, err := sqlite.Open(destPath, sqlite.OpenReadWrite|sqlite.OpenFullMutex)
+	if err != nil {
+		log.Printf("Couldn't open database to copy tables into: %s", err)
+		return http.StatusInternalServerError, err
+	}
+	defer sdb.Close()
+	if err = sdb.EnableExtendedResultCodes(true); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if err = sdb.Exec("ATTACH ? AS src", srcPath); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if err = sdb.Begin(); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	defer sdb.Rollback()
+
+	for _, t := range tables {
+		var tableSQL string
+		err = sdb.OneValue("SELECT sql FROM src.sqlite_master WHERE type = 'table' AND name = ?", &tableSQL, t)
+		if err == io.EOF {
+			return http.StatusNotFound, fmt.Errorf("Table '%s' doesn't exist in the database", t)
+		}
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if strings.HasPrefix(strings.ToUpper(tableSQL), "CREATE VIRTUAL") {
+			return http.StatusBadRequest, fmt.Errorf("'%s' is a virtual table, which can't be copied on its own", t)
+		}
+		if err = sdb.Exec(tableSQL); err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		// Generated columns are worked out by SQLite, so only the others are copied
+		var cols []string
+		err = sdb.Select("SELECT name FROM pragma_table_xinfo(?, 'src') WHERE hidden = 0", func(s *sqlite.Stmt) error {
+			name, _ := s.ScanText(0)
+			cols = append(cols, EscapeId(name))
+			return nil
+		}, t)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		colList := strings.Join(cols, ", ")
+		err = sdb.Exec(fmt.Sprintf("INSERT INTO main.%s (%s) SELECT %s FROM src.%s", EscapeId(t), colList, colList,
+			EscapeId(t)))
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	// Add the indexes and triggers once the data is in place, as that's quicker than updating them row by row
+	var extras []string
+	for _, t := range tables {
+		err = sdb.Select("SELECT sql FROM src.sqlite_master WHERE type IN ('index', 'trigger') AND sql IS NOT NULL "+
+			"AND tbl_name = ? ORDER BY type", func(s *sqlite.Stmt) error {
+			q, _ := s.ScanText(0)
+			extras = append(extras, q)
+			return nil
+		}, t)
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+	for _, q := range extras {
+		if err = sdb.Exec(q); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	// Keep the AUTOINCREMENT counters of the copied tables, so new rows don't reuse the IDs of deleted ones
+	var hasSequence bool
+	err = sdb.OneValue("SELECT count(*) > 0 FROM main.sqlite_master WHERE name = 'sqlite_sequence'", &hasSequence)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if hasSequence {
+		err = sdb.Exec("DELETE FROM main.sqlite_sequence; INSERT INTO main.sqlite_sequence (name, seq) " +
+			"SELECT name, seq FROM src.sqlite_sequence WHERE name IN (SELECT name FROM main.sqlite_master)")
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+	var userVersion int
+	if err = sdb.OneValue("PRAGMA src.user_version", &userVersion); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if err = sdb.Exec(fmt.Sprintf("PRAGMA main.user_version = %d", userVersion)); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = sdb.Commit(); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if err = sdb.Exec("DETACH src"); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
@@ -8,21 +8,23 @@ import (
 	"os"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sqlitebrowser/dbhub.io/common/config"
 	"github.com/sqlitebrowser/dbhub.io/common/database"
 
 	"github.com/aquilax/truncate"
-	pgx "github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
-	"github.com/smtp2go-oss/smtp2go-go"
 )
 
 // DB4SDefaultList returns a list of 1) users with public databases, 2) along with the logged in users' most recently
 // modified database (including their private one(s))
 func DB4SDefaultList(loggedInUser string) (UserInfoSlice, error) {
+	ctx, cancel := database.QueryContext()
+	defer cancel()
+
 	// Retrieve the list of all users with public databases
 	dbQuery := `
 		WITH public_dbs AS (
@@ -42,7 +44,7 @@ func DB4SDefaultList(loggedInUser string) (UserInfoSlice, error) {
 		WHERE users.user_id = pu.user_id
 			AND users.user_name != $1
 		ORDER BY last_modified DESC`
-	rows, err := database.DB.Query(context.Background(), dbQuery, loggedInUser)
+	rows, err := database.DB.Query(ctx, dbQuery, loggedInUser)
 	if err != nil {
 		log.Printf("Database query failed: %v", err)
 		return nil, err
@@ -86,7 +88,7 @@ func DB4SDefaultList(loggedInUser string) (UserInfoSlice, error) {
 		SELECT last_modified
 		FROM most_recent_user_db`
 	userRow := UserInfo{Username: loggedInUser}
-	rows, err = database.DB.Query(context.Background(), dbQuery, loggedInUser)
+	rows, err = database.DB.Query(ctx, dbQuery, loggedInUser)
 	if err != nil {
 		log.Printf("Database query failed: %v", err)
 		return nil, err
@@ -114,89 +116,118 @@ func DB4SDefaultList(loggedInUser string) (UserInfoSlice, error) {
 	return completeList, nil
 }
 
-// FlushViewCount periodically flushes the database view count from Memcache to PostgreSQL
-func FlushViewCount() {
+// FlushViewCount periodically flushes the database view count from Memcache to PostgreSQL.  When ctx is cancelled the
+// view counts are flushed one last time, then wg is marked as done
+func FlushViewCount(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// Log the start of the loop
+	log.Printf("%s: periodic view count flushing loop started.  %d second refresh.", config.Conf.Live.Nodename, config.Conf.Memcache.ViewCountFlushDelay)
+
+	// Start the flush loop
+	for {
+		flushViewCounts()
+
+		// Wait before running the loop again, unless the daemon is shutting down
+		select {
+		case <-ctx.Done():
+			flushViewCounts()
+			log.Printf("%s: periodic view count flushing loop stopped.", config.Conf.Live.Nodename)
+			return
+		case <-time.After(config.Conf.Memcache.ViewCountFlushDelay * time.Second):
+		}
+	}
+}
+
+// flushViewCounts saves the view counts of the public databases from Memcache to PostgreSQL
+func flushViewCounts() {
 	type dbEntry struct {
 		Owner string
 		Name  string
 	}
 
-	// Log the start of the loop
-	log.Printf("%s: periodic view count flushing loop started.  %d second refresh.", config.Conf.Live.Nodename, config.Conf.Memcache.ViewCountFlushDelay)
+	// Retrieve the list of all public databases
+	dbQuery := `
+		SELECT users.user_name, db.db_name
+		FROM sqlite_databases AS db, users
+		WHERE db.public = true
+			AND db.is_deleted = false
+			AND db.user_id = users.user_id`
+	ctx, cancel := database.QueryContext()
+	rows, err := database.DB.Query(ctx, dbQuery)
+	if err != nil {
+		cancel()
+		log.Printf("Database query failed: %v", err)
+		return
+	}
+	var dbList []dbEntry
+	for rows.Next() {
+		var oneRow dbEntry
+		err = rows.Scan(&oneRow.Owner, &oneRow.Name)
+		if err != nil {
+			log.Printf("Error retrieving database list for view count flush thread: %v", err)
+			rows.Close()
+			cancel()
+			return
+		}
+		dbList = append(dbList, oneRow)
+	}
+	rows.Close()
+	cancel()
 
-	// Start the endless flush loop
-	var rows pgx.Rows
-	var err error
-	for {
-		// Retrieve the list of all public databases
-		dbQuery := `
-			SELECT users.user_name, db.db_name
-			FROM sqlite_databases AS db, users
-			WHERE db.public = true
-				AND db.is_deleted = false
-				AND db.user_id = users.user_id`
-		rows, err = database.DB.Query(context.Background(), dbQuery)
+	// For each public database, retrieve the latest view count from memcache and save it back to PostgreSQL
+	for _, db := range dbList {
+		dbOwner := db.Owner
+		dbName := db.Name
+
+		// Retrieve the view count from Memcached
+		newValue, err := GetViewCount(dbOwner, dbName)
 		if err != nil {
-			log.Printf("Database query failed: %v", err)
+			log.Printf("Error when getting memcached view count for %s/%s: %s", dbOwner, dbName,
+				err.Error())
 			continue
 		}
-		var dbList []dbEntry
-		for rows.Next() {
-			var oneRow dbEntry
-			err = rows.Scan(&oneRow.Owner, &oneRow.Name)
+
+		// We use a value of -1 to indicate there wasn't an entry in memcache for the database
+		if newValue != -1 {
+			// Retrieve the previously flushed view count, so the new views can be added to the daily analytics
+			oldValue, err := database.ViewCount(dbOwner, dbName)
 			if err != nil {
-				log.Printf("Error retrieving database list for view count flush thread: %v", err)
-				rows.Close()
 				continue
 			}
-			dbList = append(dbList, oneRow)
-		}
-		rows.Close()
-
-		// For each public database, retrieve the latest view count from memcache and save it back to PostgreSQL
-		for _, db := range dbList {
-			dbOwner := db.Owner
-			dbName := db.Name
 
-			// Retrieve the view count from Memcached
-			newValue, err := GetViewCount(dbOwner, dbName)
+			// Update the view count in PostgreSQL
+			dbQuery = `
+				UPDATE sqlite_databases
+				SET page_views = $3
+				WHERE user_id = (
+						SELECT user_id
+						FROM users
+						WHERE lower(user_name) = lower($1)
+					)
+					AND db_name = $2`
+			ctx, cancel := database.QueryContext()
+			commandTag, err := database.DB.Exec(ctx, dbQuery, dbOwner, dbName, newValue)
+			cancel()
 			if err != nil {
-				log.Printf("Error when getting memcached view count for %s/%s: %s", dbOwner, dbName,
-					err.Error())
+				log.Printf("Flushing view count for '%s/%s' failed: %v", dbOwner, dbName, err)
+				continue
+			}
+			if numRows := commandTag.RowsAffected(); numRows != 1 {
+				log.Printf("Wrong number of rows affected (%v) when flushing view count for '%s/%s'",
+					numRows, dbOwner, dbName)
 				continue
 			}
 
-			// We use a value of -1 to indicate there wasn't an entry in memcache for the database
-			if newValue != -1 {
-				// Update the view count in PostgreSQL
-				dbQuery = `
-					UPDATE sqlite_databases
-					SET page_views = $3
-					WHERE user_id = (
-							SELECT user_id
-							FROM users
-							WHERE lower(user_name) = lower($1)
-						)
-						AND db_name = $2`
-				commandTag, err := database.DB.Exec(context.Background(), dbQuery, dbOwner, dbName, newValue)
+			// Record the new views in the daily analytics
+			if newValue > oldValue {
+				err = database.AnalyticsAddViews(dbOwner, dbName, newValue-oldValue)
 				if err != nil {
-					log.Printf("Flushing view count for '%s/%s' failed: %v", dbOwner, dbName, err)
-					continue
-				}
-				if numRows := commandTag.RowsAffected(); numRows != 1 {
-					log.Printf("Wrong number of rows affected (%v) when flushing view count for '%s/%s'",
-						numRows, dbOwner, dbName)
 					continue
 				}
 			}
 		}
-
-		// Wait before running the loop again
-		time.Sleep(config.Conf.Memcache.ViewCountFlushDelay * time.Second)
 	}
-
-	// If somehow the endless loop finishes, then record that in the server logs
-	log.Printf("%s: WARN: periodic view count flushing loop stopped.", config.Conf.Live.Nodename)
 }
 
 // LiveGenerateMinioNames generates Minio bucket and object names for a live database
@@ -218,8 +249,10 @@ func LiveGenerateMinioNames(userName string) (bucketName, objectName string, err
 			SET live_minio_bucket_name = $2
 			WHERE user_name = $1
 			AND live_minio_bucket_name is null` // This should ensure we never overwrite an existing bucket name for the user
+		ctx, cancel := database.QueryContext()
+		defer cancel()
 		var commandTag pgconn.CommandTag
-		commandTag, err = database.DB.Exec(context.Background(), dbQuery, userName, bucketName)
+		commandTag, err = database.DB.Exec(ctx, dbQuery, userName, bucketName)
 		if err != nil {
 			log.Printf("Updating Minio bucket name for user '%s' failed: %v", userName, err)
 			return
@@ -264,13 +297,14 @@ func LiveGetMinioNames(loggedInUser, dbOwner, dbName string) (bucketName, object
 	return
 }
 
-// LiveUserDBs returns the list of live databases owned by the user
-func LiveUserDBs(dbOwner string, public database.AccessType) (list []database.DBInfo, err error) {
+// LiveUserDBs returns the list of live databases owned by the user which match the filter, in the requested order.
+// Pinning is only available for standard databases, so database.DBOrderPinned is the same as database.DBOrderModified
+func LiveUserDBs(dbOwner string, public database.AccessType, order database.DBOrder, filter database.DBFilter) (list []database.DBInfo, err error) {
 	dbQuery := `
 		SELECT db_name, date_created, last_modified, public, live_db, live_node,
 			db.watchers, db.stars, discussions, contributors,
 			coalesce(one_line_description, ''), coalesce(source_url, ''),
-			download_count, page_views
+			download_count, page_views, verified, archived
 		FROM sqlite_databases AS db, users
 		WHERE users.user_id = db.user_id
 			AND lower(users.user_name) = lower($1)
@@ -290,9 +324,16 @@ func LiveUserDBs(dbOwner string, public database.AccessType) (list []database.DB
 		// This clause shouldn't ever be reached
 		return nil, fmt.Errorf("Incorrect 'public' value '%v' passed to LiveUserDBs() function.", public)
 	}
-	dbQuery += " ORDER BY date_created DESC"
+	filterClauses, args := filter.Where([]interface{}{dbOwner})
+	orderBy, err := order.OrderBy()
+	if err != nil {
+		return nil, err
+	}
+	dbQuery += filterClauses + orderBy
 
-	rows, err := database.DB.Query(context.Background(), dbQuery, dbOwner)
+	ctx, cancel := database.QueryContext()
+	defer cancel()
+	rows, err := database.DB.Query(ctx, dbQuery, args...)
 	if err != nil {
 		log.Printf("Database query failed: %v", err)
 		return nil, err
@@ -303,7 +344,7 @@ func LiveUserDBs(dbOwner string, public database.AccessType) (list []database.DB
 		var liveNode string
 		err = rows.Scan(&oneRow.Database, &oneRow.DateCreated, &oneRow.RepoModified, &oneRow.Public, &oneRow.IsLive, &liveNode,
 			&oneRow.Watchers, &oneRow.Stars, &oneRow.Discussions, &oneRow.Contributors,
-			&oneRow.OneLineDesc, &oneRow.SourceURL, &oneRow.Downloads, &oneRow.Views)
+			&oneRow.OneLineDesc, &oneRow.SourceURL, &oneRow.Downloads, &oneRow.Views, &oneRow.Verified, &oneRow.Archived)
 		if err != nil {
 			log.Printf("Error when retrieving list of live databases for user '%s': %v", dbOwner, err)
 			return nil, err
@@ -318,6 +359,13 @@ func LiveUserDBs(dbOwner string, public database.AccessType) (list []database.DB
 
 		list = append(list, oneRow)
 	}
+
+	// The size of live databases is only known by their node, so they're sorted by it here
+	if order == database.DBOrderSize {
+		sort.SliceStable(list, func(i, j int) bool {
+			return list[i].Size > list[j].Size
+		})
+	}
 	return
 }
 
@@ -327,6 +375,13 @@ func LiveUserDBs(dbOwner string, public database.AccessType) (list []database.DB
 // If the requested database doesn't exist, or the loggedInUser doesn't have access to it, then an error will be
 // returned
 func MinioLocation(dbOwner, dbName, commitID, loggedInUser string) (minioBucket, minioID string, lastModified time.Time, err error) {
+	minioBucket, minioID, lastModified, _, err = minioLocation(dbOwner, dbName, commitID, loggedInUser)
+	return
+}
+
+// minioLocation returns the Minio bucket and ID for a given database commit, along with whether the database was
+// encrypted by its owner before being uploaded
+func minioLocation(dbOwner, dbName, commitID, loggedInUser string) (minioBucket, minioID string, lastModified time.Time, clientEncrypted bool, err error) {
 	// Check permissions
 	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, false)
 	if err != nil {
@@ -348,9 +403,10 @@ func MinioLocation(dbOwner, dbName, commitID, loggedInUser string) (minioBucket,
 	// Retrieve the sha256 and last modified date for the requested commits database file
 	var dbQuery string
 	dbQuery = `
-		SELECT commit_list->$3::text->'tree'->'entries'->0->>'sha256' AS sha256,
-			commit_list->$3::text->'tree'->'entries'->0->>'last_modified' AS last_modified
+		SELECT c.tree->'entries'->0->>'sha256' AS sha256,
+			c.tree->'entries'->0->>'last_modified' AS last_modified, db.client_encrypted
 		FROM sqlite_databases AS db
+			LEFT JOIN commits AS c ON c.db_id = db.db_id AND c.commit_id = $3
 		WHERE db.user_id = (
 				SELECT user_id
 				FROM users
@@ -358,8 +414,10 @@ func MinioLocation(dbOwner, dbName, commitID, loggedInUser string) (minioBucket,
 			)
 			AND db.db_name = $2
 			AND db.is_deleted = false`
+	ctx, cancel := database.QueryContext()
+	defer cancel()
 	var sha, mod pgtype.Text
-	err = database.DB.QueryRow(context.Background(), dbQuery, dbOwner, dbName, commitID).Scan(&sha, &mod)
+	err = database.DB.QueryRow(ctx, dbQuery, dbOwner, dbName, commitID).Scan(&sha, &mod, &clientEncrypted)
 	if err != nil {
 		log.Printf("Error retrieving MinioID for '%s/%s' version '%v' by logged in user '%v': %v",
 			dbOwner, dbName, commitID, loggedInUser, err)
@@ -383,6 +441,19 @@ func MinioLocation(dbOwner, dbName, commitID, loggedInUser string) (minioBucket,
 	return
 }
 
+// SQLiteLocation is MinioLocation for callers opening the database file with SQLite.  It returns ErrClientEncrypted for
+// databases encrypted by their owner, as the server can't read those
+func SQLiteLocation(dbOwner, dbName, commitID, loggedInUser string) (minioBucket, minioID string, err error) {
+	minioBucket, minioID, _, clientEncrypted, err := minioLocation(dbOwner, dbName, commitID, loggedInUser)
+	if err != nil {
+		return
+	}
+	if clientEncrypted {
+		return "", "", ErrClientEncrypted
+	}
+	return
+}
+
 // SaveDBSettings saves updated database settings to PostgreSQL
 func SaveDBSettings(userName, dbName, oneLineDesc, fullDesc, defaultTable string, public bool, sourceURL, defaultBranch string) error {
 	// Check for values which should be NULL
@@ -417,7 +488,9 @@ func SaveDBSettings(userName, dbName, oneLineDesc, fullDesc, defaultTable string
 				WHERE lower(user_name) = lower($1)
 			)
 			AND db_name = $2`
-	commandTag, err := database.DB.Exec(context.Background(), SQLQuery, userName, dbName, nullable1LineDesc, nullableFullDesc, defaultTable,
+	ctx, cancel := database.QueryContext()
+	defer cancel()
+	commandTag, err := database.DB.Exec(ctx, SQLQuery, userName, dbName, nullable1LineDesc, nullableFullDesc, defaultTable,
 		public, nullableSourceURL, defaultBranch)
 	if err != nil {
 		log.Printf("Updating description for database '%s/%s' failed: %v", SanitiseLogString(userName),
@@ -431,6 +504,12 @@ func SaveDBSettings(userName, dbName, oneLineDesc, fullDesc, defaultTable string
 		return errors.New(errMsg)
 	}
 
+	// The default branch may have changed, which changes the latest commit
+	err = database.UpdateLatestCommit(userName, dbName)
+	if err != nil {
+		return err
+	}
+
 	// Invalidate the old memcached entry for the database
 	err = InvalidateCacheEntry(userName, userName, dbName, "") // Empty string indicates "for all versions"
 	if err != nil {
@@ -441,66 +520,107 @@ func SaveDBSettings(userName, dbName, oneLineDesc, fullDesc, defaultTable string
 	return nil
 }
 
-// SendEmails sends status update emails to people watching databases
-func SendEmails() {
-	// If the SMTP2Go API key hasn't been configured, there's no use in trying to send emails
-	if config.Conf.Event.Smtp2GoKey == "" && os.Getenv("SMTP2GO_API_KEY") == "" {
+// SendEmails sends status update emails to people watching databases.  When ctx is cancelled the emails being sent are
+// finished off, then wg is marked as done.  Emails which haven't been started on stay queued for the next run
+func SendEmails(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// If the email backend hasn't been configured, there's no use in trying to send emails
+	sender, err := NewEmailSender()
+	if err != nil {
+		log.Printf("%s: email sending is disabled: %v", config.Conf.Live.Nodename, err)
 		return
 	}
 
+	// When several nodes are running, only one of them sends the emails so they don't get sent twice
+	leader := database.NewLeader("send emails")
+	defer leader.Resign()
+
 	for {
+		if !leader.IsLeader() {
+			select {
+			case <-ctx.Done():
+				log.Printf("%s: email sending loop stopped.", config.Conf.Live.Nodename)
+				return
+			case <-time.After(config.Conf.Event.EmailQueueProcessingDelay * time.Second):
+			}
+			continue
+		}
+
 		// Retrieve unsent emails from the email_queue
 		type eml struct {
 			Address string
 			Body    string
+			Enabled bool
 			ID      int64
 			Subject string
 		}
 		var emailList []eml
 		dbQuery := `
-				SELECT email_id, mail_to, subject, body
-				FROM email_queue
-				WHERE sent = false`
-		rows, err := database.DB.Query(context.Background(), dbQuery)
+				SELECT q.email_id, q.mail_to, q.subject, q.body,
+					coalesce((
+						SELECT (u.notification_prefs->>'email')::boolean
+						FROM users AS u
+						WHERE u.email = q.mail_to
+						LIMIT 1
+					), true)
+				FROM email_queue AS q
+				WHERE q.sent = false`
+		ctx, cancel := database.QueryContext()
+		rows, err := database.DB.Query(ctx, dbQuery)
 		if err != nil {
+			cancel()
 			log.Printf("Database query failed: %v", err.Error())
 			return // Abort, as we don't want to continuously resend the same emails
 		}
 		for rows.Next() {
 			var oneRow eml
-			err = rows.Scan(&oneRow.ID, &oneRow.Address, &oneRow.Subject, &oneRow.Body)
+			err = rows.Scan(&oneRow.ID, &oneRow.Address, &oneRow.Subject, &oneRow.Body, &oneRow.Enabled)
 			if err != nil {
 				log.Printf("Error retrieving queued emails: %v", err.Error())
 				rows.Close()
+				cancel()
 				return // Abort, as we don't want to continuously resend the same emails
 			}
 			emailList = append(emailList, oneRow)
 		}
 		rows.Close()
+		cancel()
 
 		// Send emails
 		for _, j := range emailList {
-			e := smtp2go.Email{
-				From:     "updates@dbhub.io",
-				To:       []string{j.Address},
-				Subject:  j.Subject,
-				TextBody: j.Body,
-				HtmlBody: j.Body,
-			}
-			_, err = smtp2go.Send(&e)
-			if err != nil {
-				log.Println(err)
-			}
+			// Don't send emails to users who have turned notification emails off since they were queued
+			if !j.Enabled {
+				log.Printf("Email with subject '%v' not sent to '%v', as they've turned off notification emails",
+					truncate.Truncate(j.Subject, 35, "...", truncate.PositionEnd), j.Address)
+			} else {
+				htmlBody, err := EmailHTML(j.Subject, j.Body)
+				if err != nil {
+					log.Printf("Generating the HTML version of email '%v' failed: %v", j.ID, err)
+					htmlBody = j.Body
+				}
+				err = sender.Send(EmailMessage{
+					HTMLBody: htmlBody,
+					Subject:  j.Subject,
+					TextBody: j.Body,
+					To:       j.Address,
+				})
+				if err != nil {
+					log.Println(err)
+				}
 
-			log.Printf("Email with subject '%v' sent to '%v'",
-				truncate.Truncate(j.Subject, 35, "...", truncate.PositionEnd), j.Address)
+				log.Printf("Email with subject '%v' sent to '%v'",
+					truncate.Truncate(j.Subject, 35, "...", truncate.PositionEnd), j.Address)
+			}
 
-			// We only attempt delivery via smtp2go once (retries are handled on their end), so mark message as sent
+			// We only attempt delivery once (retries are handled by the email backend), so mark message as sent
 			dbQuery := `
 				UPDATE email_queue
 				SET sent = true, sent_timestamp = now()
 				WHERE email_id = $1`
-			commandTag, err := database.DB.Exec(context.Background(), dbQuery, j.ID)
+			ctx, cancel := database.QueryContext()
+			commandTag, err := database.DB.Exec(ctx, dbQuery, j.ID)
+			cancel()
 			if err != nil {
 				log.Printf("Changing email status to sent failed for email '%v': '%v'", j.ID, err.Error())
 				return // Abort, as we don't want to continuously resend the same emails
@@ -511,273 +631,414 @@ func SendEmails() {
 			}
 		}
 
-		// Pause before running the loop again
-		time.Sleep(config.Conf.Event.EmailQueueProcessingDelay * time.Second)
+		// Pause before running the loop again, unless the daemon is shutting down
+		select {
+		case <-ctx.Done():
+			log.Printf("%s: email sending loop stopped.", config.Conf.Live.Nodename)
+			return
+		case <-time.After(config.Conf.Event.EmailQueueProcessingDelay * time.Second):
+		}
 	}
 }
 
-// StatusUpdatesLoop periodically generates status updates (alert emails TBD) from the event queue
-func StatusUpdatesLoop() {
-	// Ensure a warning message is displayed on the console if the status update loop exits
+// StatusUpdatesLoop periodically generates status updates (alert emails TBD) from the event queue.  When ctx is
+// cancelled the event being processed is finished off, then wg is marked as done
+func StatusUpdatesLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// Ensure a warning message is displayed on the console if the status update loop exits other than by shutting down
 	defer func() {
+		if ctx.Err() != nil {
+			log.Printf("%s: status update loop stopped", config.Conf.Live.Nodename)
+			return
+		}
 		log.Printf("%s: WARN: Status update loop exited", config.Conf.Live.Nodename)
 	}()
 
 	// Log the start of the loop
 	log.Printf("%s: status update processing loop started.  %d second refresh.", config.Conf.Live.Nodename, config.Conf.Event.Delay)
 
+	// When several nodes are running, only one of them processes the events so they don't get processed twice
+	leader := database.NewLeader("status updates")
+	defer leader.Resign()
+
 	// Start the endless status update processing loop
-	var err error
-	type evEntry struct {
-		dbID      int64
-		details   database.EventDetails
-		eType     database.EventType
-		eventID   int64
-		timeStamp time.Time
-	}
 	for {
 		// Wait at the start of the loop (simpler code then adding a delay before each continue statement below)
-		time.Sleep(config.Conf.Event.Delay * time.Second)
-
-		// Begin a transaction
-		var tx pgx.Tx
-		tx, err = database.DB.Begin(context.Background())
-		if err != nil {
-			log.Printf("%s: couldn't begin database transaction for status update processing loop: %s",
-				config.Conf.Live.Nodename, err.Error())
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(config.Conf.Event.Delay * time.Second):
+		}
+		if !leader.IsLeader() {
 			continue
 		}
 
 		// Retrieve the list of outstanding events
-		// NOTE - We gather the db_id here instead of dbOwner/dbName as it should be faster for PG to deal
-		//        with when generating the watcher list
-		dbQuery := `
-			SELECT event_id, event_timestamp, db_id, event_type, event_data
-			FROM events
-			ORDER BY event_id ASC`
-		rows, err := tx.Query(context.Background(), dbQuery)
+		evList, err := statusUpdateEvents()
 		if err != nil {
-			log.Printf("Generating status update event list failed: %v", err)
-			var pgErr *pgconn.PgError
-			if errors.As(err, &pgErr) {
-				log.Println(pgErr.Message)
-				log.Println(pgErr.Code)
-			}
-			tx.Rollback(context.Background())
 			continue
 		}
-		evList := make(map[int64]evEntry)
-		for rows.Next() {
-			var ev evEntry
-			err = rows.Scan(&ev.eventID, &ev.timeStamp, &ev.dbID, &ev.eType, &ev.details)
-			if err != nil {
-				log.Printf("Error retrieving event list for status updates thread: %v", err)
-				rows.Close()
-				tx.Rollback(context.Background())
-				continue
-			}
-			evList[ev.eventID] = ev
-		}
-		rows.Close()
 
-		// For each event, add a status update to the status_updates list for each watcher it's for
-		for id, ev := range evList {
-			// Retrieve the list of watchers for the database the event occurred on
-			dbQuery = `
-				SELECT user_id
-				FROM watchers
-				WHERE db_id = $1`
-			rows, err = tx.Query(context.Background(), dbQuery, ev.dbID)
+		// Add the status updates for each event.  Events which fail are tried again on the next run, carrying on from
+		// the last batch of users which succeeded
+		for _, ev := range evList {
+			err = fanOutEvent(ctx, ev)
 			if err != nil {
-				log.Printf("Error retrieving user list for status updates thread: %v", err)
-				tx.Rollback(context.Background())
-				continue
+				log.Printf("Processing event ID '%d' for status updates failed: %v", ev.eventID, err)
 			}
-			var users []int64
-			for rows.Next() {
-				var user int64
-				err = rows.Scan(&user)
-				if err != nil {
-					log.Printf("Error retrieving user list for status updates thread: %v", err)
-					rows.Close()
-					tx.Rollback(context.Background())
-					continue
-				}
-				users = append(users, user)
+			if ctx.Err() != nil {
+				return
 			}
+		}
 
-			// For each watcher, add the new status update to their existing list
-			// TODO: It might be better to store this list in Memcached instead of hitting the database like this
-			for _, u := range users {
-				// Retrieve the current status updates list for the user
-				var eml pgtype.Text
-				var userEvents map[string][]database.StatusUpdateEntry
-				var userName string
-				dbQuery = `
-					SELECT user_name, email, status_updates
-					FROM users
-					WHERE user_id = $1`
-				err = tx.QueryRow(context.Background(), dbQuery, u).Scan(&userName, &eml, &userEvents)
-				if err != nil {
-					if !errors.Is(err, pgx.ErrNoRows) {
-						// A real error occurred
-						log.Printf("Database query failed: %s", err)
-						tx.Rollback(context.Background())
-					}
-					continue
-				}
-				if len(userEvents) == 0 {
-					userEvents = make(map[string][]database.StatusUpdateEntry)
-				}
+		// Remove processed events which are older than the retention time
+		dbQuery := `
+			DELETE FROM events
+			WHERE processed = true
+				AND event_timestamp < now() - make_interval(hours => $1)`
+		queryCtx, cancel := database.QueryContext()
+		_, err = database.DB.Exec(queryCtx, dbQuery, int(config.Conf.Event.Retention))
+		cancel()
+		if err != nil {
+			log.Printf("Removing expired events failed: %v", err)
+		}
+	}
+}
 
-				// If the user generated this event themselves, skip them
-				if userName == ev.details.UserName {
-					log.Printf("User '%v' generated this event (id: %v), so not adding it to their event list",
-						userName, ev.eventID)
-					continue
-				}
+// The maximum number of users an event is fanned out to in one transaction.  Events for databases with more watchers
+// than this are processed in several batches
+const statusUpdatesBatchSize = 500
+
+// statusEvent is an event waiting to be turned into status updates
+type statusEvent struct {
+	dbID         int64
+	details      database.EventDetails
+	eType        database.EventType
+	eventID      int64
+	fanOutUserID int64 // The ID of the last user the event has been fanned out to
+	timeStamp    time.Time
+}
 
-				// * Add the new event to the users status updates list *
-
-				// Group the status updates by database, and coalesce multiple updates for the same discussion or MR
-				// into a single entry (keeping the most recent one of each)
-				dbName := fmt.Sprintf("%s/%s", ev.details.Owner, ev.details.DBName)
-				var a database.StatusUpdateEntry
-				lst, ok := userEvents[dbName]
-				if ev.details.Type == database.EVENT_NEW_DISCUSSION || ev.details.Type == database.EVENT_NEW_MERGE_REQUEST || ev.details.Type == database.EVENT_NEW_COMMENT {
-					if ok {
-						// Check if an entry already exists for the discussion/MR/comment
-						for i, j := range lst {
-							if j.DiscID == ev.details.DiscID {
-								// Yes, there's already an existing entry for the discussion/MR/comment so delete the old entry
-								lst = append(lst[:i], lst[i+1:]...) // Delete the old element
-							}
-						}
-					}
-				}
+// statusRecipient is a user receiving a status update
+type statusRecipient struct {
+	email     pgtype.Text
+	prefsData []byte
+	userID    int64
+	userName  string
+}
 
-				// Add the new entry
-				a.DiscID = ev.details.DiscID
-				a.Title = ev.details.Title
-				a.URL = ev.details.URL
-				lst = append(lst, a)
-				userEvents[dbName] = lst
-
-				// Save the updated list for the user back to PG
-				dbQuery = `
-					UPDATE users
-					SET status_updates = $2
-					WHERE user_id = $1`
-				commandTag, err := tx.Exec(context.Background(), dbQuery, u, userEvents)
-				if err != nil {
-					log.Printf("Adding status update for database ID '%d' to user id '%d' failed: %v", ev.dbID,
-						u, err)
-					tx.Rollback(context.Background())
-					continue
-				}
-				if numRows := commandTag.RowsAffected(); numRows != 1 {
-					log.Printf("Wrong number of rows affected (%d) when adding status update for database ID "+
-						"'%d' to user id '%d'", numRows, ev.dbID, u)
-					tx.Rollback(context.Background())
-					continue
-				}
+// fanOutEvent adds the status updates for an event to the users it's for, in batches of statusUpdatesBatchSize users.
+// If ctx is cancelled it stops after the current batch, and the event is finished off later
+func fanOutEvent(ctx context.Context, ev statusEvent) error {
+	for {
+		done, err := fanOutEventBatch(&ev)
+		if err != nil || done || ctx.Err() != nil {
+			return err
+		}
+	}
+}
 
-				// Count the number of status updates for the user, to be displayed in the webUI header row
-				var numUpdates int
-				for _, i := range userEvents {
-					numUpdates += len(i)
-				}
+// fanOutEventBatch adds the status updates for an event to the next batch of users it's for, then records how far
+// through its users the event is.  It returns true once the event has been added for all of them
+func fanOutEventBatch(ev *statusEvent) (done bool, err error) {
+	ctx, cancel := database.QueryContext()
+	defer cancel()
+	tx, err := database.DB.Begin(ctx)
+	if err != nil {
+		return
+	}
+	// Set up an automatic transaction roll back if the function exits without committing
+	defer tx.Rollback(context.Background())
 
-				// Add an entry to memcached for the user, indicating they have outstanding status updates available
-				err = SetUserStatusUpdates(userName, numUpdates)
-				if err != nil {
-					log.Printf("Error when updating user status updates # in memcached: %v", err)
-					continue
-				}
+	// Retrieve the next batch of watchers for the database the event occurred on, who are watching for this kind of
+	// event.  Watchers only wanting releases are skipped for other events, and watchers only wanting the threads
+	// they're participating in are skipped unless they created, commented on, or are assigned the thread
+	dbQuery := `
+		SELECT u.user_id, u.user_name, u.email, u.notification_prefs
+		FROM watchers AS w
+			JOIN users AS u ON u.user_id = w.user_id
+		WHERE w.db_id = $1
+			AND w.user_id > $11
+			AND (
+				w.watch_mode = $4
+				OR (w.watch_mode = $5 AND $2::integer = $7::integer)
+				OR (w.watch_mode = $6 AND $2::integer IN ($8::integer, $9::integer, $10::integer) AND EXISTS (
+					SELECT 1
+					FROM discussions AS disc
+					WHERE disc.db_id = w.db_id
+						AND disc.disc_id = $3
+						AND (
+							disc.creator = w.user_id
+							OR disc.assignee = w.user_id
+							OR EXISTS (
+								SELECT 1
+								FROM discussion_comments AS com
+								WHERE com.disc_id = disc.internal_id
+									AND com.commenter = w.user_id
+							)
+						)
+				))
+			)
+		ORDER BY w.user_id
+		LIMIT $12`
+	args := []interface{}{ev.dbID, ev.details.Type, ev.details.DiscID, database.WatchAll, database.WatchReleases,
+		database.WatchParticipating, database.EVENT_NEW_RELEASE, database.EVENT_NEW_DISCUSSION,
+		database.EVENT_NEW_MERGE_REQUEST, database.EVENT_NEW_COMMENT, ev.fanOutUserID, statusUpdatesBatchSize}
+
+	// Events for specific users, such as mentions and assignments, go to those users instead of the watchers
+	if len(ev.details.Recipients) > 0 {
+		dbQuery = `
+			SELECT user_id, user_name, email, notification_prefs
+			FROM users
+			WHERE user_name = ANY($1)
+				AND user_id > $2
+			ORDER BY user_id
+			LIMIT $3`
+		args = []interface{}{ev.details.Recipients, ev.fanOutUserID, statusUpdatesBatchSize}
+	}
+	rows, err := tx.Query(ctx, dbQuery, args...)
+	if err != nil {
+		log.Printf("Error retrieving user list for status updates thread: %v", err)
+		return
+	}
+	var batch []statusRecipient
+	for rows.Next() {
+		var r statusRecipient
+		err = rows.Scan(&r.userID, &r.userName, &r.email, &r.prefsData)
+		if err != nil {
+			log.Printf("Error retrieving user list for status updates thread: %v", err)
+			rows.Close()
+			return
+		}
+		batch = append(batch, r)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		log.Printf("Error retrieving user list for status updates thread: %v", err)
+		return
+	}
+	done = len(batch) < statusUpdatesBatchSize
+	lastUserID := ev.fanOutUserID
+	if len(batch) > 0 {
+		lastUserID = batch[len(batch)-1].userID
+	}
 
-				// TODO: Add a email for the status notification to the outgoing email queue
-				var msg, subj string
-				switch ev.details.Type {
-				case database.EVENT_NEW_DISCUSSION:
-					msg = fmt.Sprintf("A new discussion has been created for %s/%s.\n\nVisit https://%s%s "+
-						"for the details", ev.details.Owner, ev.details.DBName, config.Conf.Web.ServerName,
-						ev.details.URL)
-					subj = fmt.Sprintf("DBHub.io: New discussion created on %s/%s", ev.details.Owner,
-						ev.details.DBName)
-				case database.EVENT_NEW_MERGE_REQUEST:
-					msg = fmt.Sprintf("A new merge request has been created for %s/%s.\n\nVisit https://%s%s "+
-						"for the details", ev.details.Owner, ev.details.DBName, config.Conf.Web.ServerName,
-						ev.details.URL)
-					subj = fmt.Sprintf("DBHub.io: New merge request created on %s/%s", ev.details.Owner,
-						ev.details.DBName)
-				case database.EVENT_NEW_COMMENT:
-					msg = fmt.Sprintf("A new comment has been created for %s/%s.\n\nVisit https://%s%s for "+
-						"the details", ev.details.Owner, ev.details.DBName, config.Conf.Web.ServerName,
-						ev.details.URL)
-					subj = fmt.Sprintf("DBHub.io: New comment on %s/%s", ev.details.Owner,
-						ev.details.DBName)
-				default:
-					log.Printf("Unknown message type when creating email message")
-				}
-				if eml.Valid {
-					// If the email address is of the form username@this_server (which indicates a non-functional email address), then skip it
-					serverName := strings.Split(config.Conf.Web.ServerName, ":")
-					if strings.HasSuffix(eml.String, serverName[0]) {
-						log.Printf("Skipping email '%v' to destination '%v', as it ends in '%v'",
-							truncate.Truncate(subj, 35, "...", truncate.PositionEnd), eml.String, serverName[0])
-						continue
-					}
-
-					// Add the email to the queue
-					dbQuery = `
-						INSERT INTO email_queue (mail_to, subject, body)
-						VALUES ($1, $2, $3)`
-					commandTag, err = tx.Exec(context.Background(), dbQuery, eml.String, subj, msg)
-					if err != nil {
-						log.Printf("Adding status update to email queue for user '%v' failed: %v", u, err)
-						tx.Rollback(context.Background())
-						continue
-					}
-					if numRows := commandTag.RowsAffected(); numRows != 1 {
-						log.Printf("Wrong number of rows affected (%d) when adding status update to email"+
-							"queue for user '%v'", numRows, u)
-						tx.Rollback(context.Background())
-						continue
-					}
-				}
-			}
+	// Work out who gets the status update and who gets an email about it
+	subj, msg := statusUpdateEmail(ev.details)
+	serverName, _, _ := strings.Cut(config.Conf.Web.ServerName, ":")
+	var emails []string
+	var userIDs []int64
+	userNames := make(map[int64]string)
+	for _, r := range batch {
+		// If the user generated this event themselves, skip them
+		if r.userName == ev.details.UserName {
+			log.Printf("User '%v' generated this event (id: %v), so not adding it to their event list",
+				r.userName, ev.eventID)
+			continue
+		}
+		userIDs = append(userIDs, r.userID)
+		userNames[r.userID] = r.userName
+
+		// Only queue an email if the user wants one for this event straight away.  Users in digest mode get their
+		// status updates in a digest email instead
+		prefs, err := database.ParseNotificationPrefs(r.prefsData)
+		if err != nil {
+			log.Printf("Error when parsing notification preferences for user '%v': %v", r.userName, err)
+		}
+		if !r.email.Valid || !prefs.EmailFor(ev.details.Type, ev.details.Owner, ev.details.DBName) {
+			continue
+		}
 
-			// Remove the processed event from PG
+		// If the email address is of the form username@this_server (which indicates a non-functional email address),
+		// then skip it
+		if strings.HasSuffix(r.email.String, serverName) {
+			log.Printf("Skipping email '%v' to destination '%v', as it ends in '%v'",
+				truncate.Truncate(subj, 35, "...", truncate.PositionEnd), r.email.String, serverName)
+			continue
+		}
+		emails = append(emails, r.email.String)
+	}
+
+	numUpdates := make(map[string]int)
+	if len(userIDs) > 0 {
+		// Coalesce multiple updates for the same discussion or MR into a single entry (keeping the most recent one of
+		// each)
+		if ev.details.Type == database.EVENT_NEW_DISCUSSION || ev.details.Type == database.EVENT_NEW_MERGE_REQUEST || ev.details.Type == database.EVENT_NEW_COMMENT {
 			dbQuery = `
-				DELETE FROM events
-				WHERE event_id = $1`
-			commandTag, err := tx.Exec(context.Background(), dbQuery, id)
+				DELETE FROM status_updates
+				WHERE user_id = ANY($1)
+					AND db_id = $2
+					AND discussion_id = $3
+					AND event_type IN ($4, $5, $6)`
+			_, err = tx.Exec(ctx, dbQuery, userIDs, ev.dbID, ev.details.DiscID, database.EVENT_NEW_DISCUSSION,
+				database.EVENT_NEW_MERGE_REQUEST, database.EVENT_NEW_COMMENT)
 			if err != nil {
-				log.Printf("Removing event ID '%d' failed: %v", id, err)
-				continue
+				log.Printf("Removing old status updates for database ID '%d' failed: %v", ev.dbID, err)
+				return
 			}
-			if numRows := commandTag.RowsAffected(); numRows != 1 {
-				log.Printf("Wrong number of rows affected (%d) when removing event ID '%d'", numRows, id)
-				continue
+		}
+
+		// Add the new entries
+		dbQuery = `
+			INSERT INTO status_updates (user_id, db_id, discussion_id, event_type, title, event_url, date_created)
+			SELECT unnest($1::bigint[]), $2::bigint, $3::integer, $4::integer, $5::text, $6::text,
+				$7::timestamp with time zone`
+		_, err = tx.Exec(ctx, dbQuery, userIDs, ev.dbID, ev.details.DiscID, ev.details.Type, ev.details.Title,
+			ev.details.URL, ev.timeStamp)
+		if err != nil {
+			log.Printf("Adding status updates for database ID '%d' failed: %v", ev.dbID, err)
+			return
+		}
+
+		// Count the number of unread status updates for the users, to be displayed in the webUI header row
+		dbQuery = `
+			SELECT user_id, count(*)
+			FROM status_updates
+			WHERE user_id = ANY($1)
+				AND is_read = false
+			GROUP BY user_id`
+		rows, err = tx.Query(ctx, dbQuery, userIDs)
+		if err != nil {
+			log.Printf("Counting status updates failed: %v", err)
+			return
+		}
+		for rows.Next() {
+			var userID int64
+			var n int
+			err = rows.Scan(&userID, &n)
+			if err != nil {
+				log.Printf("Counting status updates failed: %v", err)
+				rows.Close()
+				return
 			}
+			numUpdates[userNames[userID]] = n
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			log.Printf("Counting status updates failed: %v", err)
+			return
 		}
+	}
 
-		// Commit the transaction
-		err = tx.Commit(context.Background())
+	// Add the emails to the queue
+	if len(emails) > 0 && subj != "" {
+		dbQuery = `
+			INSERT INTO email_queue (mail_to, subject, body)
+			SELECT unnest($1::text[]), $2::text, $3::text`
+		_, err = tx.Exec(ctx, dbQuery, emails, subj, msg)
 		if err != nil {
-			log.Printf("Could not commit transaction when processing status updates: %v", err.Error())
-			continue
+			log.Printf("Adding status updates for event ID '%d' to the email queue failed: %v", ev.eventID, err)
+			return
 		}
 	}
+
+	// Record how far through its users the event is.  Once it has been added for all of them, mark the event as
+	// processed.  It's kept around for a while afterwards, so the events API can return it
+	dbQuery = `
+		UPDATE events
+		SET fanout_user_id = $2, processed = $3
+		WHERE event_id = $1`
+	_, err = tx.Exec(ctx, dbQuery, ev.eventID, lastUserID, done)
+	if err != nil {
+		log.Printf("Updating the progress of event ID '%d' failed: %v", ev.eventID, err)
+		return
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		log.Printf("Could not commit transaction when processing status updates: %v", err.Error())
+		return
+	}
+	ev.fanOutUserID = lastUserID
+
+	// Update the entries in memcached for the users, indicating they have outstanding status updates available
+	for userName, n := range numUpdates {
+		err = SetUserStatusUpdates(userName, n)
+		if err != nil {
+			log.Printf("Error when updating user status updates # in memcached: %v", err)
+		}
+	}
+	return done, nil
+}
+
+// statusUpdateEmail returns the subject and body of the email sent to users about an event
+func statusUpdateEmail(ev database.EventDetails) (subj, msg string) {
+	switch ev.Type {
+	case database.EVENT_NEW_DISCUSSION:
+		msg = fmt.Sprintf("A new discussion has been created for %s/%s.\n\nVisit https://%s%s "+
+			"for the details", ev.Owner, ev.DBName, config.Conf.Web.ServerName, ev.URL)
+		subj = fmt.Sprintf("DBHub.io: New discussion created on %s/%s", ev.Owner, ev.DBName)
+	case database.EVENT_NEW_MERGE_REQUEST:
+		msg = fmt.Sprintf("A new merge request has been created for %s/%s.\n\nVisit https://%s%s "+
+			"for the details", ev.Owner, ev.DBName, config.Conf.Web.ServerName, ev.URL)
+		subj = fmt.Sprintf("DBHub.io: New merge request created on %s/%s", ev.Owner, ev.DBName)
+	case database.EVENT_NEW_COMMENT:
+		msg = fmt.Sprintf("A new comment has been created for %s/%s.\n\nVisit https://%s%s for "+
+			"the details", ev.Owner, ev.DBName, config.Conf.Web.ServerName, ev.URL)
+		subj = fmt.Sprintf("DBHub.io: New comment on %s/%s", ev.Owner, ev.DBName)
+	case database.EVENT_MENTION:
+		msg = fmt.Sprintf("%s mentioned you in \"%s\" on %s/%s.\n\nVisit https://%s%s for the "+
+			"details", ev.UserName, ev.Title, ev.Owner, ev.DBName, config.Conf.Web.ServerName, ev.URL)
+		subj = fmt.Sprintf("DBHub.io: You were mentioned on %s/%s", ev.Owner, ev.DBName)
+	case database.EVENT_ASSIGNED:
+		msg = fmt.Sprintf("%s assigned \"%s\" on %s/%s to you.\n\nVisit https://%s%s for the "+
+			"details", ev.UserName, ev.Title, ev.Owner, ev.DBName, config.Conf.Web.ServerName, ev.URL)
+		subj = fmt.Sprintf("DBHub.io: You were assigned to \"%s\" on %s/%s", ev.Title, ev.Owner, ev.DBName)
+	case database.EVENT_REVIEW_REQUESTED:
+		msg = fmt.Sprintf("Your review has been requested for the merge request \"%s\" on %s/%s, as it changes "+
+			"tables you own.\n\nVisit https://%s%s for the details", ev.Title, ev.Owner, ev.DBName,
+			config.Conf.Web.ServerName, ev.URL)
+		subj = fmt.Sprintf("DBHub.io: Review requested for \"%s\" on %s/%s", ev.Title, ev.Owner, ev.DBName)
+	default:
+		log.Printf("Unknown message type when creating email message")
+	}
+	return
+}
+
+// statusUpdateEvents returns the events which haven't been turned into status updates yet, oldest first
+func statusUpdateEvents() (evList []statusEvent, err error) {
+	// NOTE - We gather the db_id here instead of dbOwner/dbName as it should be faster for PG to deal
+	//        with when generating the watcher list
+	dbQuery := `
+		SELECT event_id, event_timestamp, db_id, event_type, event_data, fanout_user_id
+		FROM events
+		WHERE processed = false
+		ORDER BY event_id ASC`
+	ctx, cancel := database.QueryContext()
+	defer cancel()
+	rows, err := database.DB.Query(ctx, dbQuery)
+	if err != nil {
+		log.Printf("Generating status update event list failed: %v", err)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			log.Println(pgErr.Message)
+			log.Println(pgErr.Code)
+		}
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ev statusEvent
+		err = rows.Scan(&ev.eventID, &ev.timeStamp, &ev.dbID, &ev.eType, &ev.details, &ev.fanOutUserID)
+		if err != nil {
+			log.Printf("Error retrieving event list for status updates thread: %v", err)
+			return nil, err
+		}
+		evList = append(evList, ev)
+	}
+	if err = rows.Err(); err != nil {
+		log.Printf("Error retrieving event list for status updates thread: %v", err)
+		return nil, err
+	}
 	return
 }
 
 // StoreDatabase stores database details in PostgreSQL, and the database data itself in Minio
 func StoreDatabase(dbOwner, dbName string, branches map[string]database.BranchEntry, c database.CommitEntry, pub bool,
 	buf *os.File, sha string, dbSize int64, oneLineDesc, fullDesc string, createDefBranch bool, branchName,
-	sourceURL string) error {
+	sourceURL string, clientEncrypted bool) error {
 	// Store the database file
-	err := StoreDatabaseFile(buf, sha, dbSize)
+	err := StoreDatabaseFile(dbOwner, buf, sha, dbSize)
 	if err != nil {
 		return err
 	}
@@ -798,14 +1059,15 @@ func StoreDatabase(dbOwner, dbName string, branches map[string]database.BranchEn
 	}
 
 	// Store the database metadata
-	cMap := map[string]database.CommitEntry{c.ID: c}
+	ctx, cancel := database.QueryContext()
+	defer cancel()
 	var commandTag pgconn.CommandTag
 	dbQuery := `
 		WITH root AS (
 			SELECT nextval('sqlite_databases_db_id_seq') AS val
 		)
 		INSERT INTO sqlite_databases (user_id, db_id, db_name, public, one_line_description, full_description,
-			branch_heads, root_database, commit_list`
+			branch_heads, root_database, client_encrypted`
 	if sourceURL != "" {
 		dbQuery += `, source_url`
 	}
@@ -814,24 +1076,23 @@ func StoreDatabase(dbOwner, dbName string, branches map[string]database.BranchEn
 		SELECT (
 			SELECT user_id
 			FROM users
-			WHERE lower(user_name) = lower($1)), (SELECT val FROM root), $2, $3, $4, $5, $7, (SELECT val FROM root), $6`
+			WHERE lower(user_name) = lower($1)), (SELECT val FROM root), $2, $3, $4, $5, $6, (SELECT val FROM root), $7`
 	if sourceURL != "" {
 		dbQuery += `, $8`
 	}
 	dbQuery += `
 		ON CONFLICT (user_id, db_name)
 			DO UPDATE
-			SET commit_list = sqlite_databases.commit_list || $6,
-				branch_heads = sqlite_databases.branch_heads || $7,
+			SET branch_heads = sqlite_databases.branch_heads || $6,
 				last_modified = now()`
 	if sourceURL != "" {
 		dbQuery += `,
 			source_url = $8`
-		commandTag, err = database.DB.Exec(context.Background(), dbQuery, dbOwner, dbName, pub, nullable1LineDesc, nullableFullDesc,
-			cMap, branches, sourceURL)
+		commandTag, err = database.DB.Exec(ctx, dbQuery, dbOwner, dbName, pub, nullable1LineDesc, nullableFullDesc,
+			branches, clientEncrypted, sourceURL)
 	} else {
-		commandTag, err = database.DB.Exec(context.Background(), dbQuery, dbOwner, dbName, pub, nullable1LineDesc, nullableFullDesc,
-			cMap, branches)
+		commandTag, err = database.DB.Exec(ctx, dbQuery, dbOwner, dbName, pub, nullable1LineDesc, nullableFullDesc,
+			branches, clientEncrypted)
 	}
 	if err != nil {
 		log.Printf("Storing database '%s/%s' failed: %v", SanitiseLogString(dbOwner),
@@ -843,6 +1104,12 @@ func StoreDatabase(dbOwner, dbName string, branches map[string]database.BranchEn
 			SanitiseLogString(dbName))
 	}
 
+	// Store the commit
+	err = database.AddCommits(dbOwner, dbName, []database.CommitEntry{c})
+	if err != nil {
+		return err
+	}
+
 	if createDefBranch {
 		err = database.StoreDefaultBranchName(dbOwner, dbName, branchName)
 		if err != nil {
@@ -850,6 +1117,7 @@ func StoreDatabase(dbOwner, dbName string, branches map[string]database.BranchEn
 				SanitiseLogString(dbOwner), SanitiseLogString(dbName), err)
 			return err
 		}
+		return nil // Storing the default branch name also updates the latest commit details
 	}
-	return nil
+	return database.UpdateLatestCommit(dbOwner, dbName)
 }
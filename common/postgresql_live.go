@@ -1,14 +1,15 @@
 package common
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
-	"os"
-	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/sqlitebrowser/dbhub.io/common/config"
 	"github.com/sqlitebrowser/dbhub.io/common/database"
@@ -17,6 +18,10 @@ import (
 	"github.com/jackc/pgx/v5/pgconn"
 )
 
+// ErrJobQueueFull is returned when a job isn't accepted because too many jobs are already waiting in the job queue.  It's
+// worth trying again a little later
+var ErrJobQueueFull = errors.New("The job queue is full")
+
 var (
 	// CheckJobQueue is used by the live daemons for triggering a check of the job queue
 	CheckJobQueue chan struct{}
@@ -38,6 +43,7 @@ func JobQueueCheck() {
 	}
 
 	// Loop around checking for newly submitted jobs
+	jobs := newLiveJobRunner(config.Conf.Live.Workers, config.Conf.Live.BackgroundWorkers)
 	for range CheckJobQueue {
 		if JobQueueDebug > 1 { // Only show when we have job queue debug verbosity turned up high
 			log.Printf("%s: JobQueueCheck() received event", config.Conf.Live.Nodename)
@@ -53,18 +59,22 @@ func JobQueueCheck() {
 
 		// TODO: should we update the job state to 'error' on failure?
 
+		// Interactive jobs are picked up before background ones, and background jobs are left waiting while all of the
+		// workers for them are busy
 		dbQuery := `
 			SELECT job_id, operation, submitter_node, details
 			FROM job_submissions
 			WHERE state = 'new'
-		    	AND (target_node = 'any' OR target_node = $1)
+		    	AND ((target_node = 'any' AND NOT $2) OR target_node = $1)
 				AND completed_date IS NULL
-			ORDER BY submission_date ASC
+				AND (priority = $4 OR $3)
+			ORDER BY priority ASC, submission_date ASC
 			FOR UPDATE SKIP LOCKED
 			LIMIT 1`
 		var jobID int
 		var details, subNode, op string
-		err = tx.QueryRow(ctx, dbQuery, config.Conf.Live.Nodename).Scan(&jobID, &op, &subNode, &details)
+		err = tx.QueryRow(ctx, dbQuery, config.Conf.Live.Nodename, liveNodeDraining(), jobs.backgroundFree(),
+			jobPriorityInteractive).Scan(&jobID, &op, &subNode, &details)
 		if err != nil {
 			// Ignore any "no rows in result set" error
 			if !errors.Is(err, pgx.ErrNoRows) {
@@ -84,7 +94,7 @@ func JobQueueCheck() {
 		// picked up by future checks if something goes wrong before the job completes
 		dbQuery = `
 			UPDATE job_submissions
-			SET state = 'in progress'
+			SET state = 'in progress', started_date = now()
 			WHERE job_id = $1`
 		var t pgconn.CommandTag
 		var responsePayload []byte
@@ -117,286 +127,657 @@ func JobQueueCheck() {
 			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
 		}
 
-		// Perform the desired operation
-		switch op {
-		case "backup":
-			if JobQueueDebug > 0 {
-				log.Printf("%s: running [BACKUP] on '%s/%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName)
-			}
+		// Run the job in the background, so jobs reading databases don't wait for each other
+		jobs.run(op, req.DBOwner, req.DBName, func() {
+			jobQueueRun(jobID, op, subNode, req, responsePayload)
+		})
+	}
+}
 
-			// Return status of backup operation
-			err = SQLiteBackupLive(config.Conf.Live.StorageDir, req.DBOwner, req.DBName)
-			var response JobResponseDBError
-			if err != nil {
-				response.Err = err.Error()
-			}
-			responsePayload, err = json.Marshal(response) // Use an empty error message to indicate success
-			if err != nil {
-				log.Printf("%s: error when serialising backup response json: %s", config.Conf.Live.Nodename, err)
-				responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
-			}
+// jobQueueRun performs a job picked up from the job queue, then marks it as complete and submits its response
+func jobQueueRun(jobID int, op, subNode string, req JobRequest, responsePayload []byte) {
+	// Keep track of the use of the database.  Databases evicted from the node for being idle are downloaded again first
+	if op != "ping" {
+		defer liveDBUse(req.DBOwner, req.DBName, op == "createdb" || op == "delete", true)()
+	}
 
-		case "columns":
-			if JobQueueDebug > 0 {
-				log.Printf("%s: running [COLUMNS] on '%s/%s': '%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName, req.Data)
-			}
+	// Perform the desired operation
+	var err error
+	switch op {
+	case "backup":
+		if JobQueueDebug > 0 {
+			log.Printf("%s: running [BACKUP] on '%s/%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName)
+		}
 
-			// Return the column list to the caller
-			columns, pk, err, errCode := SQLiteGetColumnsLive(config.Conf.Live.StorageDir, req.DBOwner, req.DBName, fmt.Sprintf("%s", req.Data))
-			response := JobResponseDBColumns{Columns: columns, PkColumns: pk, ErrCode: errCode}
-			if err != nil {
-				response.Err = err.Error()
-			}
-			responsePayload, err = json.Marshal(response)
-			if err != nil {
-				log.Printf("%s: error when serialising the column list response json: %s", config.Conf.Live.Nodename, err)
-				responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
-			}
+		// Return status of backup operation
+		err = SQLiteBackupLive(config.Conf.Live.StorageDir, req.DBOwner, req.DBName)
+		var response JobResponseDBError
+		if err != nil {
+			response.Err = err.Error()
+		}
+		responsePayload, err = json.Marshal(response) // Use an empty error message to indicate success
+		if err != nil {
+			log.Printf("%s: error when serialising backup response json: %s", config.Conf.Live.Nodename, err)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
+		}
 
-		case "createdb":
-			if JobQueueDebug > 0 {
-				log.Printf("%s: running [CREATE DATABASE] on '%s/%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName)
-			}
+	case "blob":
+		if JobQueueDebug > 0 {
+			log.Printf("%s: running [BLOB] on '%s/%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName)
+		}
 
-			// Return status of database creation
-			err = JobQueueCreateDatabase(req)
-			response := JobResponseDBCreate{NodeName: config.Conf.Live.Nodename}
-			if err != nil {
-				response.Err = err.Error()
-			}
-			responsePayload, err = json.Marshal(response) // Use an empty error message to indicate success
-			if err != nil {
-				log.Printf("%s: error when serialising create database response json: %s", config.Conf.Live.Nodename, err)
-				responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
-			}
+		// Decode the base64 request data back to JSON
+		b64, err := base64.StdEncoding.DecodeString(req.Data.(string))
+		if err != nil {
+			msg := fmt.Sprintf("error when base64 decoding blob job details: %v", err)
+			log.Printf("%s: %s", config.Conf.Live.Nodename, msg)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
+			break
+		}
+		var reqData JobRequestBlob
+		err = json.Unmarshal(b64, &reqData)
+		if err != nil {
+			msg := fmt.Sprintf("error when unmarshalling blob job details: %v", err)
+			log.Printf("%s: %s", config.Conf.Live.Nodename, msg)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
+			break
+		}
 
-		case "delete":
-			if JobQueueDebug > 0 {
-				log.Printf("%s: running [DELETE] on '%s/%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName)
-			}
+		// Return the value of the requested cell
+		var response JobResponseBlob
+		response.Data, response.Status, err = SQLiteBlobLive(config.Conf.Live.StorageDir, req.DBOwner, req.DBName,
+			reqData)
+		if err != nil {
+			response.Err = err.Error()
+		}
+		responsePayload, err = json.Marshal(response)
+		if err != nil {
+			log.Printf("%s: error when serialising blob response json: %s", config.Conf.Live.Nodename, err)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
+		}
 
-			// Delete the database file from the node
-			err = RemoveLiveDB(req.DBOwner, req.DBName)
-			var response JobResponseDBError
-			if err != nil {
-				response.Err = err.Error()
-			}
-			responsePayload, err = json.Marshal(response)
-			if err != nil {
-				log.Printf("%s: error when serialising delete database response json: %s", config.Conf.Live.Nodename, err)
-				responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
-			}
+	case "bulk":
+		if JobQueueDebug > 0 {
+			log.Printf("%s: running [BULK] on '%s/%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName)
+		}
 
-		case "execute":
-			if JobQueueDebug > 0 {
-				log.Printf("%s: running [EXECUTE] on '%s/%s': '%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName, req.Data)
-			}
+		// Decode the base64 request data back to JSON.  Numbers are kept as they were given, so large integers
+		// don't lose precision
+		b64, err := base64.StdEncoding.DecodeString(req.Data.(string))
+		if err != nil {
+			msg := fmt.Sprintf("error when base64 decoding bulk job details: %v", err)
+			log.Printf("%s: %s", config.Conf.Live.Nodename, msg)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
+			break
+		}
+		var reqData JobRequestBulk
+		d := json.NewDecoder(bytes.NewReader(b64))
+		d.UseNumber()
+		err = d.Decode(&reqData)
+		if err != nil {
+			msg := fmt.Sprintf("error when unmarshalling bulk job details: %v", err)
+			log.Printf("%s: %s", config.Conf.Live.Nodename, msg)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
+			break
+		}
 
-			// Execute a SQL statement on the database
-			rowsChanged, err := SQLiteExecuteQueryLive(config.Conf.Live.StorageDir, req.DBOwner, req.DBName, req.RequestingUser, fmt.Sprintf("%s", req.Data))
-			response := JobResponseDBExecute{RowsChanged: rowsChanged}
-			if err != nil {
-				response.Err = err.Error()
-			}
-			responsePayload, err = json.Marshal(response)
-			if err != nil {
-				log.Printf("%s: error when serialising execute request response json: %s", config.Conf.Live.Nodename, err)
-				responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
-			}
+		// Change the rows of the table
+		rowsChanged, err := SQLiteBulkLive(config.Conf.Live.StorageDir, req.DBOwner, req.DBName, req.RequestingUser, reqData)
+		response := JobResponseDBExecute{RowsChanged: rowsChanged}
+		if err != nil {
+			response.Err = err.Error()
+		} else {
+			liveAfterWrite(req.DBOwner, req.DBName, true)
+		}
+		responsePayload, err = json.Marshal(response)
+		if err != nil {
+			log.Printf("%s: error when serialising bulk request response json: %s", config.Conf.Live.Nodename, err)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
+		}
 
-		case "indexes":
-			if JobQueueDebug > 0 {
-				log.Printf("%s: running [INDEXES] on '%s/%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName)
-			}
+	case "columns":
+		if JobQueueDebug > 0 {
+			log.Printf("%s: running [COLUMNS] on '%s/%s': '%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName, req.Data)
+		}
 
-			// Return the list of indexes
-			indexes, err := SQLiteGetIndexesLive(config.Conf.Live.StorageDir, req.DBOwner, req.DBName)
-			response := JobResponseDBIndexes{Indexes: indexes}
-			if err != nil {
-				response.Err = err.Error()
-			}
-			responsePayload, err = json.Marshal(response)
-			if err != nil {
-				log.Printf("%s: error when serialising index list response json: %s", config.Conf.Live.Nodename, err)
-				responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
-			}
+		// Return the column list to the caller
+		columns, pk, err, errCode := SQLiteGetColumnsLive(config.Conf.Live.StorageDir, req.DBOwner, req.DBName, fmt.Sprintf("%s", req.Data))
+		response := JobResponseDBColumns{Columns: columns, PkColumns: pk, ErrCode: errCode}
+		if err != nil {
+			response.Err = err.Error()
+		}
+		responsePayload, err = json.Marshal(response)
+		if err != nil {
+			log.Printf("%s: error when serialising the column list response json: %s", config.Conf.Live.Nodename, err)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
+		}
 
-		case "ping":
-			// This just returns an empty response
-			var response JobResponseDBError
-			responsePayload, err = json.Marshal(response)
-			if err != nil {
-				log.Printf("%s: error when serialising ping response json: %s", config.Conf.Live.Nodename, err)
-				responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
-			}
+	case "createdb":
+		if JobQueueDebug > 0 {
+			log.Printf("%s: running [CREATE DATABASE] on '%s/%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName)
+		}
 
-		case "query":
-			if JobQueueDebug > 0 {
-				log.Printf("%s: running [QUERY] on '%s/%s': '%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName, req.Data)
-			}
+		// Return status of database creation
+		err = JobQueueCreateDatabase(req)
+		response := JobResponseDBCreate{NodeName: config.Conf.Live.Nodename}
+		if err != nil {
+			response.Err = err.Error()
+		}
+		responsePayload, err = json.Marshal(response) // Use an empty error message to indicate success
+		if err != nil {
+			log.Printf("%s: error when serialising create database response json: %s", config.Conf.Live.Nodename, err)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
+		}
 
-			// Return the query result
-			rows, err := SQLiteRunQueryLive(config.Conf.Live.StorageDir, req.DBOwner, req.DBName, req.RequestingUser, fmt.Sprintf("%s", req.Data))
-			response := JobResponseDBQuery{Results: rows}
-			if err != nil {
-				response.Err = err.Error()
-			}
-			responsePayload, err = json.Marshal(response)
-			if err != nil {
-				log.Printf("%s: error when serialising query response json: %s", config.Conf.Live.Nodename, err)
-				responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
-			}
+	case "delete":
+		if JobQueueDebug > 0 {
+			log.Printf("%s: running [DELETE] on '%s/%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName)
+		}
 
-		case "rowdata":
-			if JobQueueDebug > 0 {
-				log.Printf("%s: running [ROWDATA] on '%s/%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName)
-			}
+		// Delete the database file from the node
+		err = RemoveLiveDB(req.DBOwner, req.DBName)
+		var response JobResponseDBError
+		if err != nil {
+			response.Err = err.Error()
+		}
+		responsePayload, err = json.Marshal(response)
+		if err != nil {
+			log.Printf("%s: error when serialising delete database response json: %s", config.Conf.Live.Nodename, err)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
+		}
 
-			// Decode the base64 request data back to JSON
-			b64, err := base64.StdEncoding.DecodeString(req.Data.(string))
-			if err != nil {
-				msg := fmt.Sprintf("error when base64 decoding rowdata job details: %v", err)
-				log.Printf("%s: %s", config.Conf.Live.Nodename, msg)
-				responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
-				break
-			}
+	case "execute":
+		if JobQueueDebug > 0 {
+			log.Printf("%s: running [EXECUTE] on '%s/%s': '%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName, req.Data)
+		}
 
-			// Extract the request information
-			var reqData JobRequestRows
-			err = json.Unmarshal(b64, &reqData)
-			if err != nil {
-				msg := fmt.Sprintf("error when unmarshalling rowdata job details: %v", err)
-				log.Printf("%s: %s", config.Conf.Live.Nodename, msg)
-				responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
-				break
-			}
-			dbTable := reqData.DbTable
-			sortCol := reqData.SortCol
-			sortDir := reqData.SortDir
-			commitID := reqData.CommitID
-			maxRows := reqData.MaxRows
-			rowOffset := reqData.RowOffset
-
-			// Read the desired row data and return it to the caller
-			var tmpErr error
-			resp := JobResponseDBRows{RowData: SQLiteRecordSet{}}
-			resp.Tables, resp.DefaultTable, resp.RowData, resp.DatabaseSize, tmpErr =
-				SQLiteReadDatabasePage("", "", req.RequestingUser, req.DBOwner, req.DBName, dbTable, sortCol, sortDir, commitID, rowOffset, maxRows, true)
-			if tmpErr != nil {
-				resp.Err = tmpErr.Error()
-			}
-			responsePayload, err = json.Marshal(resp)
-			if err != nil {
-				log.Printf("%s: error when serialising row data response json: %s", config.Conf.Live.Nodename, err)
-				responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
-			}
+		// Execute a SQL statement on the database
+		rowsChanged, err := SQLiteExecuteQueryLive(config.Conf.Live.StorageDir, req.DBOwner, req.DBName, req.RequestingUser, fmt.Sprintf("%s", req.Data))
+		response := JobResponseDBExecute{RowsChanged: rowsChanged}
+		if err != nil {
+			response.Err = err.Error()
+		} else {
+			liveAfterWrite(req.DBOwner, req.DBName, true)
+		}
+		responsePayload, err = json.Marshal(response)
+		if err != nil {
+			log.Printf("%s: error when serialising execute request response json: %s", config.Conf.Live.Nodename, err)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
+		}
 
-		case "size":
-			if JobQueueDebug > 0 {
-				log.Printf("%s: running [SIZE] on '%s/%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName)
-			}
+	case "executeparams":
+		if JobQueueDebug > 0 {
+			log.Printf("%s: running [EXECUTEPARAMS] on '%s/%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName)
+		}
 
-			// Return the on disk size of the database
-			size, err := JobQueueGetSize(req.DBOwner, req.DBName)
-			response := JobResponseDBSize{Size: size}
-			if err != nil {
-				response.Err = err.Error()
-			}
-			responsePayload, err = json.Marshal(response)
-			if err != nil {
-				log.Printf("%s: error when serialising size check response json: %s", config.Conf.Live.Nodename, err)
-				responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
-			}
+		// Decode the base64 request data back to JSON.  Numbers are kept as they were given, so large integers
+		// don't lose precision
+		b64, err := base64.StdEncoding.DecodeString(req.Data.(string))
+		if err != nil {
+			msg := fmt.Sprintf("error when base64 decoding executeparams job details: %v", err)
+			log.Printf("%s: %s", config.Conf.Live.Nodename, msg)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
+			break
+		}
+		var reqData JobRequestQuery
+		d := json.NewDecoder(bytes.NewReader(b64))
+		d.UseNumber()
+		err = d.Decode(&reqData)
+		if err != nil {
+			msg := fmt.Sprintf("error when unmarshalling executeparams job details: %v", err)
+			log.Printf("%s: %s", config.Conf.Live.Nodename, msg)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
+			break
+		}
 
-		case "tables":
-			if JobQueueDebug > 0 {
-				log.Printf("%s: running [TABLES] on '%s/%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName)
-			}
+		// Execute the SQL statement, with its parameter values
+		rowsChanged, err := SQLiteExecuteParamsLive(config.Conf.Live.StorageDir, req.DBOwner, req.DBName, req.RequestingUser, reqData.SQL, reqData.Params)
+		response := JobResponseDBExecute{RowsChanged: rowsChanged}
+		if err != nil {
+			response.Err = err.Error()
+		} else {
+			liveAfterWrite(req.DBOwner, req.DBName, true)
+		}
+		responsePayload, err = json.Marshal(response)
+		if err != nil {
+			log.Printf("%s: error when serialising execute request response json: %s", config.Conf.Live.Nodename, err)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
+		}
 
-			// Return the list of tables
-			tables, err := SQLiteGetTablesLive(config.Conf.Live.StorageDir, req.DBOwner, req.DBName)
-			response := JobResponseDBTables{Tables: tables}
-			if err != nil {
-				response.Err = err.Error()
-			}
-			responsePayload, err = json.Marshal(response)
-			if err != nil {
-				log.Printf("%s: error when serialising table list response json: %s", config.Conf.Live.Nodename, err)
-				responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
-			}
+	case "explain":
+		if JobQueueDebug > 0 {
+			log.Printf("%s: running [EXPLAIN] on '%s/%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName)
+		}
 
-		case "views":
-			if JobQueueDebug > 0 {
-				log.Printf("%s: running [VIEWS] on '%s/%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName)
-			}
+		// Decode the base64 request data back to JSON
+		b64, err := base64.StdEncoding.DecodeString(req.Data.(string))
+		if err != nil {
+			msg := fmt.Sprintf("error when base64 decoding explain job details: %v", err)
+			log.Printf("%s: %s", config.Conf.Live.Nodename, msg)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
+			break
+		}
+		var reqData JobRequestExplain
+		err = json.Unmarshal(b64, &reqData)
+		if err != nil {
+			msg := fmt.Sprintf("error when unmarshalling explain job details: %v", err)
+			log.Printf("%s: %s", config.Conf.Live.Nodename, msg)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
+			break
+		}
+
+		// Return the query plan
+		result, err := SQLiteExplainLive(config.Conf.Live.StorageDir, req.DBOwner, req.DBName, reqData)
+		response := JobResponseDBExplain{Result: result}
+		if err != nil {
+			response.Err = err.Error()
+		}
+		responsePayload, err = json.Marshal(response)
+		if err != nil {
+			log.Printf("%s: error when serialising explain response json: %s", config.Conf.Live.Nodename, err)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
+		}
+
+	case "ftscreate", "ftsdrop":
+		if JobQueueDebug > 0 {
+			log.Printf("%s: running [%s] on '%s/%s'", config.Conf.Live.Nodename, strings.ToUpper(op), req.DBOwner, req.DBName)
+		}
+
+		// Decode the base64 request data back to JSON
+		b64, err := base64.StdEncoding.DecodeString(req.Data.(string))
+		if err != nil {
+			msg := fmt.Sprintf("error when base64 decoding full text search job details: %v", err)
+			log.Printf("%s: %s", config.Conf.Live.Nodename, msg)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
+			break
+		}
+		var reqData JobRequestFTS
+		err = json.Unmarshal(b64, &reqData)
+		if err != nil {
+			msg := fmt.Sprintf("error when unmarshalling full text search job details: %v", err)
+			log.Printf("%s: %s", config.Conf.Live.Nodename, msg)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
+			break
+		}
+
+		// Create or remove the full text search index
+		if op == "ftscreate" {
+			err = SQLiteFTSCreateLive(config.Conf.Live.StorageDir, req.DBOwner, req.DBName, req.RequestingUser, reqData)
+		} else {
+			err = SQLiteFTSDropLive(config.Conf.Live.StorageDir, req.DBOwner, req.DBName, req.RequestingUser, reqData)
+		}
+		var response JobResponseDBError
+		if err != nil {
+			response.Err = err.Error()
+		} else {
+			liveAfterWrite(req.DBOwner, req.DBName, true)
+		}
+		responsePayload, err = json.Marshal(response)
+		if err != nil {
+			log.Printf("%s: error when serialising full text search response json: %s", config.Conf.Live.Nodename, err)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
+		}
+
+	case "indexadvice":
+		if JobQueueDebug > 0 {
+			log.Printf("%s: running [INDEX ADVICE] on '%s/%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName)
+		}
 
-			// Return the list of views
-			views, err := SQLiteGetViewsLive(config.Conf.Live.StorageDir, req.DBOwner, req.DBName)
-			response := JobResponseDBViews{Views: views}
+		// Decode the base64 request data back to JSON
+		b64, err := base64.StdEncoding.DecodeString(req.Data.(string))
+		if err != nil {
+			msg := fmt.Sprintf("error when base64 decoding index advice job details: %v", err)
+			log.Printf("%s: %s", config.Conf.Live.Nodename, msg)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
+			break
+		}
+		var reqData JobRequestIndexAdvice
+		err = json.Unmarshal(b64, &reqData)
+		if err != nil {
+			msg := fmt.Sprintf("error when unmarshalling index advice job details: %v", err)
+			log.Printf("%s: %s", config.Conf.Live.Nodename, msg)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
+			break
+		}
+
+		// Return the suggested indexes
+		suggestions, err := SQLiteIndexAdviceLive(config.Conf.Live.StorageDir, req.DBOwner, req.DBName, reqData)
+		response := JobResponseDBIndexAdvice{Suggestions: suggestions}
+		if err != nil {
+			response.Err = err.Error()
+		}
+		responsePayload, err = json.Marshal(response)
+		if err != nil {
+			log.Printf("%s: error when serialising index advice response json: %s", config.Conf.Live.Nodename, err)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
+		}
+
+	case "indexes":
+		if JobQueueDebug > 0 {
+			log.Printf("%s: running [INDEXES] on '%s/%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName)
+		}
+
+		// Return the list of indexes
+		indexes, err := SQLiteGetIndexesLive(config.Conf.Live.StorageDir, req.DBOwner, req.DBName)
+		response := JobResponseDBIndexes{Indexes: indexes}
+		if err != nil {
+			response.Err = err.Error()
+		}
+		responsePayload, err = json.Marshal(response)
+		if err != nil {
+			log.Printf("%s: error when serialising index list response json: %s", config.Conf.Live.Nodename, err)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
+		}
+
+	case "optimize":
+		if JobQueueDebug > 0 {
+			log.Printf("%s: running [OPTIMIZE] on '%s/%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName)
+		}
+
+		// Decode the base64 request data back to JSON
+		b64, err := base64.StdEncoding.DecodeString(req.Data.(string))
+		if err != nil {
+			msg := fmt.Sprintf("error when base64 decoding optimize job details: %v", err)
+			log.Printf("%s: %s", config.Conf.Live.Nodename, msg)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
+			break
+		}
+		var reqData JobRequestOptimize
+		err = json.Unmarshal(b64, &reqData)
+		if err != nil {
+			msg := fmt.Sprintf("error when unmarshalling optimize job details: %v", err)
+			log.Printf("%s: %s", config.Conf.Live.Nodename, msg)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
+			break
+		}
+
+		// Run VACUUM and/or ANALYZE on the database, recording its progress as it goes
+		var response JobResponseDBOptimize
+		response.SizeBefore, response.SizeAfter, err = SQLiteOptimizeLive(config.Conf.Live.StorageDir, req.DBOwner,
+			req.DBName, reqData, optimizeProgress(req.DBOwner, req.DBName))
+		if err != nil {
+			response.Err = err.Error()
+		}
+		responsePayload, err = json.Marshal(response)
+		if err != nil {
+			log.Printf("%s: error when serialising optimize response json: %s", config.Conf.Live.Nodename, err)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
+		}
+
+	case "ping":
+		// This just returns an empty response
+		var response JobResponseDBError
+		responsePayload, err = json.Marshal(response)
+		if err != nil {
+			log.Printf("%s: error when serialising ping response json: %s", config.Conf.Live.Nodename, err)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
+		}
+
+	case "query":
+		if JobQueueDebug > 0 {
+			log.Printf("%s: running [QUERY] on '%s/%s': '%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName, req.Data)
+		}
+
+		// Return the query result
+		rows, err := SQLiteRunQueryLive(config.Conf.Live.StorageDir, req.DBOwner, req.DBName, req.RequestingUser, fmt.Sprintf("%s", req.Data), nil)
+		response := JobResponseDBQuery{Results: rows}
+		if err != nil {
+			response.Err = err.Error()
+		}
+		responsePayload, err = json.Marshal(response)
+		if err != nil {
+			log.Printf("%s: error when serialising query response json: %s", config.Conf.Live.Nodename, err)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
+		}
+
+	case "queryparams":
+		if JobQueueDebug > 0 {
+			log.Printf("%s: running [QUERYPARAMS] on '%s/%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName)
+		}
+
+		// Decode the base64 request data back to JSON.  Numbers are kept as they were given, so large integers
+		// don't lose precision
+		b64, err := base64.StdEncoding.DecodeString(req.Data.(string))
+		if err != nil {
+			msg := fmt.Sprintf("error when base64 decoding queryparams job details: %v", err)
+			log.Printf("%s: %s", config.Conf.Live.Nodename, msg)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
+			break
+		}
+		var reqData JobRequestQuery
+		d := json.NewDecoder(bytes.NewReader(b64))
+		d.UseNumber()
+		err = d.Decode(&reqData)
+		if err != nil {
+			msg := fmt.Sprintf("error when unmarshalling queryparams job details: %v", err)
+			log.Printf("%s: %s", config.Conf.Live.Nodename, msg)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
+			break
+		}
+
+		// Return the query result
+		rows, err := SQLiteRunQueryLive(config.Conf.Live.StorageDir, req.DBOwner, req.DBName, req.RequestingUser, reqData.SQL, &reqData.Params)
+		response := JobResponseDBQuery{Results: rows}
+		if err != nil {
+			response.Err = err.Error()
+		}
+		responsePayload, err = json.Marshal(response)
+		if err != nil {
+			log.Printf("%s: error when serialising query response json: %s", config.Conf.Live.Nodename, err)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
+		}
+
+	case "rowdata":
+		if JobQueueDebug > 0 {
+			log.Printf("%s: running [ROWDATA] on '%s/%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName)
+		}
+
+		// Decode the base64 request data back to JSON
+		b64, err := base64.StdEncoding.DecodeString(req.Data.(string))
+		if err != nil {
+			msg := fmt.Sprintf("error when base64 decoding rowdata job details: %v", err)
+			log.Printf("%s: %s", config.Conf.Live.Nodename, msg)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
+			break
+		}
+
+		// Extract the request information
+		var reqData JobRequestRows
+		err = json.Unmarshal(b64, &reqData)
+		if err != nil {
+			msg := fmt.Sprintf("error when unmarshalling rowdata job details: %v", err)
+			log.Printf("%s: %s", config.Conf.Live.Nodename, msg)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
+			break
+		}
+		dbTable := reqData.DbTable
+		sortCol := reqData.SortCol
+		sortDir := reqData.SortDir
+		commitID := reqData.CommitID
+		maxRows := reqData.MaxRows
+		rowOffset := reqData.RowOffset
+
+		// Read the desired row data and return it to the caller
+		var tmpErr error
+		resp := JobResponseDBRows{RowData: SQLiteRecordSet{}}
+		resp.Tables, resp.DefaultTable, resp.RowData, resp.DatabaseSize, tmpErr =
+			SQLiteReadDatabasePage("", "", req.RequestingUser, req.DBOwner, req.DBName, dbTable, sortCol, sortDir, commitID, rowOffset, maxRows, true)
+		if tmpErr != nil {
+			resp.Err = tmpErr.Error()
+		}
+		responsePayload, err = json.Marshal(resp)
+		if err != nil {
+			log.Printf("%s: error when serialising row data response json: %s", config.Conf.Live.Nodename, err)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
+		}
+
+	case "sandboxdiff", "sandboxmerge", "sandboxsnapshot":
+		if JobQueueDebug > 0 {
+			log.Printf("%s: running [%s] on '%s/%s'", config.Conf.Live.Nodename, strings.ToUpper(op), req.DBOwner, req.DBName)
+		}
+
+		// Decode the base64 request data back to JSON
+		b64, err := base64.StdEncoding.DecodeString(req.Data.(string))
+		if err != nil {
+			msg := fmt.Sprintf("error when base64 decoding sandbox job details: %v", err)
+			log.Printf("%s: %s", config.Conf.Live.Nodename, msg)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
+			break
+		}
+		var reqData JobRequestSandbox
+		err = json.Unmarshal(b64, &reqData)
+		if err != nil {
+			msg := fmt.Sprintf("error when unmarshalling sandbox job details: %v", err)
+			log.Printf("%s: %s", config.Conf.Live.Nodename, msg)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
+			break
+		}
+
+		var response interface{}
+		switch op {
+		case "sandboxdiff":
+			// Work out the changes made to the sandbox since it was created
+			var resp JobResponseSandboxDiff
+			resp.Diffs, err = SQLiteSandboxDiffLive(config.Conf.Live.StorageDir, req.DBOwner, req.DBName, reqData)
 			if err != nil {
-				response.Err = err.Error()
+				resp.Err = err.Error()
 			}
-			responsePayload, err = json.Marshal(response)
+			response = resp
+		case "sandboxmerge":
+			// Apply the changes of a sandbox to its parent database
+			var resp JobResponseSandboxMerge
+			resp.Conflicts, err = SQLiteSandboxMergeLive(config.Conf.Live.StorageDir, req.DBOwner, req.DBName, reqData)
 			if err != nil {
-				log.Printf("%s: error when serialising view list response json: %s", config.Conf.Live.Nodename, err)
-				responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
+				resp.Err = err.Error()
+			} else if len(resp.Conflicts) == 0 {
+				liveAfterWrite(req.DBOwner, req.DBName, true)
 			}
-
+			response = resp
 		default:
-			log.Printf("%v: notification received for unhandled operation '%s'\n", config.Conf.Live.Nodename, op)
+			// Store the copies of the database a new sandbox is created from
+			var resp JobResponseSandboxSnapshot
+			resp.ObjectID, resp.BaseBucket, resp.BaseObject, err = SQLiteSandboxSnapshotLive(config.Conf.Live.StorageDir,
+				req.DBOwner, req.DBName, reqData)
+			if err != nil {
+				resp.Err = err.Error()
+			}
+			response = resp
+		}
+		responsePayload, err = json.Marshal(response)
+		if err != nil {
+			log.Printf("%s: error when serialising sandbox response json: %s", config.Conf.Live.Nodename, err)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
 		}
 
-		// Update the job completion status in the backend database
-		dbQuery = `
-			UPDATE job_submissions
-			SET state = 'complete', completed_date = now()
-			WHERE job_id = $1`
-		t, err = database.JobQueue.Exec(ctx, dbQuery, jobID)
+	case "size":
+		if JobQueueDebug > 0 {
+			log.Printf("%s: running [SIZE] on '%s/%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName)
+		}
+
+		// Return the on disk size of the database
+		size, err := JobQueueGetSize(req.DBOwner, req.DBName)
+		response := JobResponseDBSize{Size: size}
 		if err != nil {
-			log.Printf("%s: error when updating job completion status to complete in backend database: %s", config.Conf.Live.Nodename, err)
+			response.Err = err.Error()
+		}
+		responsePayload, err = json.Marshal(response)
+		if err != nil {
+			log.Printf("%s: error when serialising size check response json: %s", config.Conf.Live.Nodename, err)
 			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
 		}
 
-		// Safety check
-		numRows = t.RowsAffected()
-		if numRows != 1 {
-			msg := fmt.Sprintf("something went wrong when updating jobID '%d' to 'complete', number of rows updated = %d", jobID, numRows)
-			log.Printf("%s: %s", config.Conf.Live.Nodename, msg)
-			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
+	case "tables":
+		if JobQueueDebug > 0 {
+			log.Printf("%s: running [TABLES] on '%s/%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName)
 		}
 
-		// Add the response to the backend job queue database
-		err = ResponseSubmit(jobID, subNode, responsePayload)
+		// Return the list of tables
+		tables, err := SQLiteGetTablesLive(config.Conf.Live.StorageDir, req.DBOwner, req.DBName)
+		response := JobResponseDBTables{Tables: tables}
 		if err != nil {
-			log.Println(err)
+			response.Err = err.Error()
+		}
+		responsePayload, err = json.Marshal(response)
+		if err != nil {
+			log.Printf("%s: error when serialising table list response json: %s", config.Conf.Live.Nodename, err)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
+		}
+
+	case "txbegin", "txcommit", "txexecute", "txquery", "txrollback":
+		if JobQueueDebug > 0 {
+			log.Printf("%s: running [%s] on '%s/%s'", config.Conf.Live.Nodename, strings.ToUpper(op), req.DBOwner,
+				req.DBName)
+		}
+
+		// Begin, use, or end a transaction on the database
+		responsePayload = liveTransactionJob(op, req)
+
+	case "views":
+		if JobQueueDebug > 0 {
+			log.Printf("%s: running [VIEWS] on '%s/%s'", config.Conf.Live.Nodename, req.DBOwner, req.DBName)
+		}
+
+		// Return the list of views
+		views, err := SQLiteGetViewsLive(config.Conf.Live.StorageDir, req.DBOwner, req.DBName)
+		response := JobResponseDBViews{Views: views}
+		if err != nil {
+			response.Err = err.Error()
+		}
+		responsePayload, err = json.Marshal(response)
+		if err != nil {
+			log.Printf("%s: error when serialising view list response json: %s", config.Conf.Live.Nodename, err)
+			responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
 		}
+
+	default:
+		log.Printf("%v: notification received for unhandled operation '%s'\n", config.Conf.Live.Nodename, op)
+	}
+
+	// Update the job completion status in the backend database
+	dbQuery := `
+		UPDATE job_submissions
+		SET state = 'complete', completed_date = now()
+		WHERE job_id = $1`
+	t, err := database.JobQueue.Exec(context.Background(), dbQuery, jobID)
+	if err != nil {
+		log.Printf("%s: error when updating job completion status to complete in backend database: %s", config.Conf.Live.Nodename, err)
+		responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, err))
+	}
+
+	// Safety check
+	numRows := t.RowsAffected()
+	if numRows != 1 {
+		msg := fmt.Sprintf("something went wrong when updating jobID '%d' to 'complete', number of rows updated = %d", jobID, numRows)
+		log.Printf("%s: %s", config.Conf.Live.Nodename, msg)
+		responsePayload = []byte(fmt.Sprintf(`{"error": "%s"}`, msg))
+	}
+
+	// Add the response to the backend job queue database
+	err = ResponseSubmit(jobID, subNode, responsePayload)
+	if err != nil {
+		log.Println(err)
 	}
 }
 
 // JobQueueCreateDatabase creates a database on a live node
 func JobQueueCreateDatabase(req JobRequest) (err error) {
 	// Set up the live database locally
-	_, err = LiveRetrieveDatabaseMinio(config.Conf.Live.StorageDir, req.DBOwner, req.DBName, req.Data.(string))
+	_, err = LiveRetrieveDatabaseMinio(config.Conf.Live.StorageDir, req.DBOwner, req.DBName, req.Data.(string), nil)
 	if err != nil {
 		log.Println(err)
 		// TODO: Update the job status to failed and notify the caller
 		return
 	}
+
+	// Don't reuse any connections opened to an earlier database file of the same name
+	closeLiveReadConns(config.Conf.Live.StorageDir, req.DBOwner, req.DBName)
 	return
 }
 
 // JobQueueGetSize returns the on disk size of a database on a live node
 func JobQueueGetSize(DBOwner, DBName string) (size int64, err error) {
-	dbPath := filepath.Join(config.Conf.Live.StorageDir, DBOwner, DBName, "live.sqlite")
-	var db os.FileInfo
-	db, err = os.Stat(dbPath)
-	if err != nil {
-		return
-	}
-
 	// Return the database size to the caller
-	size = db.Size()
-	return
+	return liveDatabaseSize(config.Conf.Live.StorageDir, DBOwner, DBName)
 }
 
 // JobQueueListen listens for database notify events indicating newly submitted jobs
@@ -457,13 +838,19 @@ func JobSubmit[T any](response *T, targetNode, operation, requestingUser, dbOwne
 		return
 	}
 
+	// Refuse the job if the queue of the node is full, so one user's heavy workload can't starve everyone else
+	err = jobQueueDepthCheck(ctx, tx, targetNode, requestingUser)
+	if err != nil {
+		return
+	}
+
 	// Insert the job details
 	dbQuery := `
-		INSERT INTO job_submissions (target_node, operation, submitter_node, details)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO job_submissions (target_node, operation, submitter_node, details, priority)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING job_id`
 	var jobID int
-	err = tx.QueryRow(ctx, dbQuery, targetNode, operation, SubmitterInstance, details).Scan(&jobID)
+	err = tx.QueryRow(ctx, dbQuery, targetNode, operation, SubmitterInstance, details, jobPriority(operation)).Scan(&jobID)
 	if err != nil {
 		log.Printf("%s: error when adding a job to the backend job submission table: %v", config.Conf.Live.Nodename, err)
 		return
@@ -491,6 +878,34 @@ func JobSubmit[T any](response *T, targetNode, operation, requestingUser, dbOwne
 	return
 }
 
+// jobQueueDepthCheck returns ErrJobQueueFull when the queue of jobs waiting for a node, or the part of it submitted by
+// the requesting user, is already at its limit
+func jobQueueDepthCheck(ctx context.Context, tx pgx.Tx, targetNode, requestingUser string) (err error) {
+	maxNode := config.Conf.Live.QueueDepth
+	maxUser := config.Conf.Live.QueueDepthUser
+	if maxNode < 0 && (maxUser < 0 || requestingUser == "") {
+		return
+	}
+	dbQuery := `
+		SELECT count(*), count(*) FILTER (WHERE details->>'requesting_user' = $2)
+		FROM job_submissions
+		WHERE state = 'new'
+			AND target_node = $1`
+	var nodeJobs, userJobs int
+	err = tx.QueryRow(ctx, dbQuery, targetNode, requestingUser).Scan(&nodeJobs, &userJobs)
+	if err != nil {
+		log.Printf("%s: error when counting the jobs waiting in the job queue: %v", config.Conf.Live.Nodename, err)
+		return
+	}
+	if maxNode >= 0 && nodeJobs >= maxNode {
+		return fmt.Errorf("%w: too many jobs are waiting for the server holding the database", ErrJobQueueFull)
+	}
+	if maxUser >= 0 && requestingUser != "" && userJobs >= maxUser {
+		return fmt.Errorf("%w: you have too many jobs waiting for the server holding the database", ErrJobQueueFull)
+	}
+	return
+}
+
 // ResponseQueueCheck checks if a newly submitted response is available for processing
 func ResponseQueueCheck() {
 
@@ -564,11 +979,24 @@ func ResponseQueueListen() {
 		log.Fatal(err)
 	}
 
+	// Changes to live databases are announced on the same connection, for re-running subscribed queries
+	_, err = database.JobListen.Exec(context.Background(), "LISTEN "+liveChangesChannel)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// Start the endless loop handling database notifications
 	for {
 		n, err := database.JobListen.WaitForNotification(context.Background())
 		if err != nil {
 			log.Printf("%s: error in ResponseQueueListen(): %s", config.Conf.Live.Nodename, err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		if n.Channel == liveChangesChannel {
+			liveChanged(n.Payload)
+			continue
 		}
 
 		if JobQueueDebug > 0 && n.Payload == SubmitterInstance {
@@ -582,6 +1010,33 @@ func ResponseQueueListen() {
 	}
 }
 
+// liveAfterWrite runs the follow on work for a change to the contents of a live database.  Subscribed queries are told
+// about the change, and it's queued for replication and the automatic versioning of the database.  The transformations
+// set to run after each change are queued too, unless they made the change.  Each job changing the contents of a
+// database calls it once the change is made
+func liveAfterWrite(dbOwner, dbName string, runTransformations bool) {
+	LiveNotifyChange(dbOwner, dbName)
+	database.LiveReplicationPending(dbOwner, dbName)
+	database.LiveAutoVersionPending(dbOwner, dbName)
+	if runTransformations {
+		database.TransformationsPending(dbOwner, dbName, "write", nil)
+	}
+}
+
+// LiveNotifyChange lets the other DBHub.io daemons know a live database has been changed, so queries subscribed to it
+// can be run again
+func LiveNotifyChange(dbOwner, dbName string) {
+	payload, err := json.Marshal(LiveChange{DBOwner: dbOwner, DBName: dbName})
+	if err != nil {
+		log.Printf("%s: error when serialising live database change notification: %s", config.Conf.Live.Nodename, err)
+		return
+	}
+	_, err = database.JobQueue.Exec(context.Background(), "SELECT pg_notify($1, $2)", liveChangesChannel, string(payload))
+	if err != nil {
+		log.Printf("%s: error when sending live database change notification: %s", config.Conf.Live.Nodename, err)
+	}
+}
+
 // ResponseComplete marks a response as processed
 func ResponseComplete(responseID int) (err error) {
 	// Start a new transaction
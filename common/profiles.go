@@ -0,0 +1,115 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+const (
+	// MaxProfileBioLength is the maximum length of the bio on a user profile, in characters
+	MaxProfileBioLength = 500
+
+	// MaxProfileLinks is the maximum number of links on a user profile
+	MaxProfileLinks = 5
+)
+
+// GetUserProfile returns the public profile of a user, including the names of their public databases with the pinned
+// ones first.  It returns false if the user doesn't exist
+func GetUserProfile(userName string) (p UserProfile, exists bool, err error) {
+	usr, err := database.User(userName)
+	if err != nil || usr.Username == "" {
+		return
+	}
+	p = UserProfile{
+		AvatarURL:     usr.AvatarURL,
+		Bio:           usr.Bio,
+		Databases:     []string{},
+		DateJoined:    usr.DateJoined,
+		DisplayName:   usr.DisplayName,
+		Links:         usr.Links,
+		LiveDatabases: []string{},
+		Pinned:        []string{},
+		Username:      usr.Username,
+	}
+	if p.Links == nil {
+		p.Links = []string{}
+	}
+
+	dbs, err := database.UserDBs(usr.Username, database.DB_PUBLIC, database.DBOrderPinned, database.DBFilter{})
+	if err != nil {
+		return
+	}
+	for _, db := range dbs {
+		p.Databases = append(p.Databases, db.Database)
+		if db.PinPosition > 0 {
+			p.Pinned = append(p.Pinned, db.Database)
+		}
+	}
+	liveDBs, err := LiveUserDBs(usr.Username, database.DB_PUBLIC, database.DBOrderCreated, database.DBFilter{})
+	if err != nil {
+		return
+	}
+	for _, db := range liveDBs {
+		p.LiveDatabases = append(p.LiveDatabases, db.Database)
+	}
+	return p, true, nil
+}
+
+// SaveUserProfile validates and saves the details shown on the public profile of a user
+func SaveUserProfile(userName, displayName, bio string, links []string) error {
+	if displayName != "" {
+		err := ValidateDisplayName(displayName)
+		if err != nil {
+			return errors.New("Invalid display name")
+		}
+	}
+	if utf8.RuneCountInString(bio) > MaxProfileBioLength {
+		return fmt.Errorf("The bio can't be longer than %d characters", MaxProfileBioLength)
+	}
+	if len(links) > MaxProfileLinks {
+		return fmt.Errorf("Profiles can't have more than %d links", MaxProfileLinks)
+	}
+	for _, l := range links {
+		err := Validate.Var(l, "url,min=5,max=255")
+		if err != nil {
+			return fmt.Errorf("Invalid link: '%s'", l)
+		}
+
+		// Only web links are allowed, as these are displayed on the profile page
+		u, err := url.Parse(l)
+		if err != nil || (strings.ToLower(u.Scheme) != "http" && strings.ToLower(u.Scheme) != "https") {
+			return fmt.Errorf("Links need to be http or https URLs: '%s'", l)
+		}
+	}
+	return database.SetUserProfile(userName, displayName, bio, links)
+}
+
+// UserContributions returns the daily contributions of a user over the last year, as seen by the logged in user
+func UserContributions(loggedInUser, userName string) (g ContributionGraph, err error) {
+	// Start from the Sunday on or before this day last year, so the heatmap covers whole weeks
+	to := time.Now().UTC()
+	from := time.Date(to.Year()-1, to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	from = from.AddDate(0, 0, -int(from.Weekday()))
+
+	g.Days, err = database.UserContributions(loggedInUser, userName, from)
+	if err != nil {
+		return
+	}
+	if g.Days == nil {
+		g.Days = []database.ContributionDay{}
+	}
+	g.From = from.Format("2006-01-02")
+	g.To = to.Format("2006-01-02")
+	for _, d := range g.Days {
+		g.Commits += d.Commits
+		g.Discussions += d.Discussions
+		g.Uploads += d.Uploads
+	}
+	return
+}
@@ -0,0 +1,215 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	sqlite "github.com/gwenn/gosqlite"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// QueryParamsMax is the maximum number of parameter values accepted for a query
+const QueryParamsMax = 999
+
+// QueryParams holds the values bound to the parameters of a query.  Positional holds the values for "?" parameters, in
+// order, and Named holds the values for ":name", "@name", and "$name" parameters.  Only one of them is used
+type QueryParams struct {
+	Named      map[string]interface{} `json:"named,omitempty"`
+	Positional []interface{}          `json:"positional,omitempty"`
+}
+
+// JobRequestQuery holds the data used when making a query or execute request with parameter values to our job queue
+// backend
+type JobRequestQuery struct {
+	Params QueryParams `json:"params"`
+	SQL    string      `json:"sql"`
+}
+
+// ParseQueryParams reads the parameter values for a query.  A JSON array gives the values of positional parameters, and
+// a JSON object gives the values of named parameters.  Strings, numbers, booleans, and null are accepted as values
+func ParseQueryParams(data string) (params QueryParams, err error) {
+	d := json.NewDecoder(strings.NewReader(data))
+	d.UseNumber()
+	var v interface{}
+	err = d.Decode(&v)
+	if err != nil {
+		return params, fmt.Errorf("The parameter values couldn't be read: %s", err)
+	}
+	switch vals := v.(type) {
+	case []interface{}:
+		params.Positional = make([]interface{}, len(vals))
+		for i, val := range vals {
+			params.Positional[i], err = tableEditValue(val)
+			if err != nil {
+				return params, fmt.Errorf("Invalid value for parameter %d", i+1)
+			}
+		}
+	case map[string]interface{}:
+		params.Named = make(map[string]interface{})
+		for name, val := range vals {
+			params.Named[name], err = tableEditValue(val)
+			if err != nil {
+				return params, fmt.Errorf("Invalid value for parameter '%s'", name)
+			}
+		}
+	default:
+		return params, errors.New("The parameter values need to be a JSON array or object")
+	}
+	if len(params.Positional) > QueryParamsMax || len(params.Named) > QueryParamsMax {
+		return params, fmt.Errorf("Too many parameter values.  Up to %d can be given", QueryParamsMax)
+	}
+	return
+}
+
+// bindQueryParams binds parameter values to a prepared statement, checking a value is given for each parameter of the
+// statement and that every value is used
+func bindQueryParams(stmt *sqlite.Stmt, params QueryParams) (err error) {
+	count := stmt.BindParameterCount()
+	if params.Named == nil {
+		if len(params.Positional) != count {
+			return fmt.Errorf("The query has %d %s, but %d %s given", count, plural(count, "parameter", "parameters"),
+				len(params.Positional), plural(len(params.Positional), "value was", "values were"))
+		}
+		for i, v := range params.Positional {
+			val, err := tableEditValue(v)
+			if err != nil {
+				return fmt.Errorf("Invalid value for parameter %d", i+1)
+			}
+			if err = stmt.BindByIndex(i+1, val); err != nil {
+				return err
+			}
+		}
+		return
+	}
+
+	// Named values can be given with or without the prefix of their parameter
+	used := make(map[string]bool)
+	for i := 1; i <= count; i++ {
+		name, err := stmt.BindParameterName(i)
+		if err != nil || name == "" || strings.HasPrefix(name, "?") {
+			return fmt.Errorf("Parameter %d of the query doesn't have a name, so its values need to be given as a "+
+				"JSON array", i)
+		}
+		key := name
+		v, ok := params.Named[key]
+		if !ok {
+			key = name[1:]
+			v, ok = params.Named[key]
+		}
+		if !ok {
+			return fmt.Errorf("No value was given for parameter '%s'", name)
+		}
+		val, err := tableEditValue(v)
+		if err != nil {
+			return fmt.Errorf("Invalid value for parameter '%s'", name)
+		}
+		if err = stmt.BindByIndex(i, val); err != nil {
+			return err
+		}
+		used[key] = true
+	}
+	for name := range params.Named {
+		if !used[name] {
+			return fmt.Errorf("The query doesn't have a parameter named '%s'", name)
+		}
+	}
+	return
+}
+
+// LiveExecuteParams asks our job queue backend to execute a SQL statement with parameter values on a live database
+func LiveExecuteParams(liveNode, loggedInUser, dbOwner, dbName, sql string, params QueryParams) (rowsChanged int, err error) {
+	// Archived databases are read only
+	archived, err := database.CheckDBArchived(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	if archived {
+		return 0, database.ErrDBArchived
+	}
+
+	reqJSON, err := json.Marshal(JobRequestQuery{Params: params, SQL: sql})
+	if err != nil {
+		return
+	}
+
+	// Send the execute request to our job queue backend
+	var resp JobResponseDBExecute
+	err = JobSubmit(&resp, liveNode, "executeparams", loggedInUser, dbOwner, dbName, reqJSON)
+	if err != nil {
+		return
+	}
+	rowsChanged = resp.RowsChanged
+	if resp.Err != "" {
+		return rowsChanged, liveError(resp.Err)
+	}
+
+	// Update the "last_modified" field for the database
+	err = database.UpdateModified(dbOwner, dbName)
+	return
+}
+
+// LiveQueryParams sends a SQLite query with parameter values to a live database on its hosting node
+func LiveQueryParams(liveNode, loggedInUser, dbOwner, dbName, query string, params QueryParams) (rows SQLiteRecordSet, err error) {
+	reqJSON, err := json.Marshal(JobRequestQuery{Params: params, SQL: query})
+	if err != nil {
+		return
+	}
+
+	// Send the query to our job queue backend
+	var resp JobResponseDBQuery
+	err = JobSubmit(&resp, liveNode, "queryparams", loggedInUser, dbOwner, dbName, reqJSON)
+	if err != nil {
+		return
+	}
+	rows = resp.Results
+	if resp.Err != "" {
+		err = liveError(resp.Err)
+	}
+	return
+}
+
+// SQLiteExecuteParamsLive is used by our job queue backend nodes to execute a SQL statement with parameter values on a
+// live database
+func SQLiteExecuteParamsLive(baseDir, dbOwner, dbName, loggedInUser, sql string, params QueryParams) (rowsChanged int, err error) {
+	if err = liveTransactionCheck(dbOwner, dbName); err != nil {
+		return
+	}
+	sdb, err := OpenSQLiteDatabaseLive(baseDir, dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	defer sdb.Close()
+
+	rowsChanged, err = executeParamsLimited(sdb, dbOwner, dbName, loggedInUser, sql, params)
+	if err != nil && !strings.HasPrefix(err.Error(), "don't use exec with") {
+		log.Printf("%s: error when executing query with parameters by '%s' for LIVE database (%s/%s): '%s'",
+			config.Conf.Live.Nodename, SanitiseLogString(loggedInUser), SanitiseLogString(dbOwner),
+			SanitiseLogString(dbName), SanitiseLogString(err.Error()))
+	}
+	return
+}
+
+// executeParamsLimited executes a SQL statement with parameter values on a live database, within the limits for the
+// user
+func executeParamsLimited(sdb *sqlite.Conn, dbOwner, dbName, loggedInUser, sql string, params QueryParams) (rowsChanged int, err error) {
+	stmt, err := sdb.Prepare(sql)
+	if err != nil {
+		return
+	}
+	defer stmt.Finalize()
+
+	// Parameter values can only be bound to a single statement
+	if strings.TrimSpace(stmt.Tail()) != "" {
+		return 0, errors.New("Only one SQL statement can be executed when parameter values are given")
+	}
+	if err = bindQueryParams(stmt, params); err != nil {
+		return
+	}
+	return executeLimited(sdb, dbOwner, dbName, loggedInUser, sql, func() (int, error) {
+		return stmt.ExecDml()
+	})
+}
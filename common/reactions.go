@@ -0,0 +1,77 @@
+package common
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// AddCommentReactions fills in the reaction counts of a list of discussion comments, along with the reactions the
+// logged in user gave them
+func AddCommentReactions(loggedInUser, dbOwner, dbName string, discID int, comments []database.DiscussionCommentEntry) (err error) {
+	counts, err := CommentReactions(dbOwner, dbName, discID)
+	if err != nil {
+		return
+	}
+	mine := make(map[int][]string)
+	if loggedInUser != "" {
+		mine, err = database.UserCommentReactions(loggedInUser, dbOwner, dbName, discID)
+		if err != nil {
+			return
+		}
+	}
+	for i, c := range comments {
+		comments[i].Reactions = counts[c.ID]
+		if comments[i].Reactions == nil {
+			comments[i].Reactions = map[string]int{}
+		}
+		comments[i].MyReactions = mine[c.ID]
+		if comments[i].MyReactions == nil {
+			comments[i].MyReactions = []string{}
+		}
+	}
+	return
+}
+
+// CommentReactions returns the number of each reaction given to the comments of a discussion or MR, keyed by comment
+// ID.  The counts are cached in Memcached
+func CommentReactions(dbOwner, dbName string, discID int) (counts map[int]map[string]int, err error) {
+	cacheKey := reactionsCacheKey(dbOwner, dbName, discID)
+	ok, err := GetCachedData(cacheKey, &counts)
+	if err != nil {
+		log.Printf("Error retrieving reaction counts from cache: %v", err)
+	}
+	if ok {
+		return
+	}
+
+	// The counts aren't cached, so retrieve them from PostgreSQL then cache them
+	counts, err = database.CommentReactionCounts(dbOwner, dbName, discID)
+	if err != nil {
+		return
+	}
+	err = CacheData(cacheKey, counts, config.Conf.Memcache.DefaultCacheTime)
+	if err != nil {
+		log.Printf("Error when caching reaction counts for '%s/%s': %v", SanitiseLogString(dbOwner),
+			SanitiseLogString(dbName), err)
+	}
+	return counts, nil
+}
+
+// InvalidateCommentReactions removes the cached reaction counts of a discussion or MR, so they're recounted the next
+// time they're needed
+func InvalidateCommentReactions(dbOwner, dbName string, discID int) error {
+	return DeleteCacheItem(reactionsCacheKey(dbOwner, dbName, discID))
+}
+
+// reactionsCacheKey generates the cache key for the reaction counts of a discussion or MR
+func reactionsCacheKey(dbOwner, dbName string, discID int) string {
+	cacheString := fmt.Sprintf("reactions/%s/%s/%d", strings.ToLower(dbOwner), dbName, discID)
+	tempArr := md5.Sum([]byte(cacheString))
+	return hex.EncodeToString(tempArr[:])
+}
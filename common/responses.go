@@ -1,7 +1,12 @@
 package common
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"mime/multipart"
 	"net/http"
@@ -39,6 +44,66 @@ func BranchListResponse(dbOwner, dbName string) (list BranchListResponseContaine
 	return
 }
 
+// ColumnarResponseContainer holds the results of a query in a column oriented layout.  Each entry of Data holds all
+// of the values for one column, which is much quicker for dataframe based clients (eg pandas, R) to load than the
+// row oriented layout
+type ColumnarResponseContainer struct {
+	Columns  []string        `json:"columns"`
+	Data     [][]interface{} `json:"data"`
+	RowCount int             `json:"row_count"`
+	Types    []string        `json:"types"`
+}
+
+// ColumnarResponse converts the results of a query into the column oriented layout.  Numeric values are returned as
+// JSON numbers instead of strings, and the type of each column is taken from its first non NULL value
+func ColumnarResponse(data SQLiteRecordSet) (resp ColumnarResponseContainer) {
+	resp.Columns = data.ColNames
+	if resp.Columns == nil {
+		resp.Columns = []string{}
+	}
+	resp.RowCount = len(data.Records)
+	resp.Data = make([][]interface{}, len(resp.Columns))
+	resp.Types = make([]string, len(resp.Columns))
+	for i := range resp.Columns {
+		resp.Data[i] = make([]interface{}, 0, len(data.Records))
+		resp.Types[i] = "null"
+	}
+
+	for _, row := range data.Records {
+		for i := range resp.Columns {
+			if i >= len(row) || row[i].Type == Null {
+				resp.Data[i] = append(resp.Data[i], nil)
+				continue
+			}
+
+			// Convert the value to its native JSON type
+			var colType string
+			var val interface{} = row[i].Value
+			switch row[i].Type {
+			case Integer:
+				colType = "integer"
+				if v, err := strconv.ParseInt(fmt.Sprint(row[i].Value), 10, 64); err == nil {
+					val = v
+				}
+			case Float:
+				colType = "float"
+				if v, err := strconv.ParseFloat(fmt.Sprint(row[i].Value), 64); err == nil {
+					val = v
+				}
+			case Binary, Image:
+				colType = "binary"
+			default:
+				colType = "text"
+			}
+			if resp.Types[i] == "null" {
+				resp.Types[i] = colType
+			}
+			resp.Data[i] = append(resp.Data[i], val)
+		}
+	}
+	return
+}
+
 // ExecuteResponseContainer is used by our job queue backend, to return information in response to an
 // Execute() call on a live database.  It holds the success/failure status of the remote call,
 // and also the number of rows changed by the Execute() call (if it succeeded)
@@ -50,11 +115,13 @@ type ExecuteResponseContainer struct {
 // MetadataResponseContainer holds the response to a client request for database metadata. It's a temporary structure,
 // mainly so the JSON created for it is consistent between our various daemons
 type MetadataResponseContainer struct {
+	Archived  bool                             `json:"archived"`
 	Branches  map[string]database.BranchEntry  `json:"branches"`
 	Commits   map[string]database.CommitEntry  `json:"commits"`
 	DefBranch string                           `json:"default_branch"`
 	Releases  map[string]database.ReleaseEntry `json:"releases"`
 	Tags      map[string]database.TagEntry     `json:"tags"`
+	Verified  bool                             `json:"verified"`
 	WebPage   string                           `json:"web_page"`
 }
 
@@ -91,11 +158,52 @@ func MetadataResponse(dbOwner, dbName string) (meta MetadataResponseContainer, e
 		return
 	}
 
+	// Check whether the database has been verified by an admin
+	meta.Verified, err = database.DBVerified(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+
+	// Check whether the database has been archived by its owner
+	meta.Archived, err = database.CheckDBArchived(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+
 	// Generate the link to the web page of this database in the webUI module
 	meta.WebPage = "https://" + config.Conf.Web.ServerName + "/" + dbOwner + "/" + dbName
 	return
 }
 
+// MetadataValidators returns the ETag and Last-Modified values for the metadata of a database, so clients polling it
+// can skip downloading it again when nothing has changed.  The ETag is a hash of the metadata, and the last modified
+// time is that of the newest commit, release, or tag
+func MetadataValidators(meta MetadataResponseContainer) (etag string, lastModified time.Time, err error) {
+	j, err := json.Marshal(meta)
+	if err != nil {
+		return
+	}
+	sum := sha256.Sum256(j)
+	etag = `W/"` + hex.EncodeToString(sum[:]) + `"`
+
+	for _, c := range meta.Commits {
+		if c.Timestamp.After(lastModified) {
+			lastModified = c.Timestamp
+		}
+	}
+	for _, r := range meta.Releases {
+		if r.Date.After(lastModified) {
+			lastModified = r.Date
+		}
+	}
+	for _, t := range meta.Tags {
+		if t.Date.After(lastModified) {
+			lastModified = t.Date
+		}
+	}
+	return
+}
+
 // UploadResponse validates incoming upload requests from the db4s and api daemons, then processes the upload
 func UploadResponse(w http.ResponseWriter, r *http.Request, loggedInUser, targetUser, targetDB, commitID, serverSw string) (retMsg map[string]string, httpStatus int, err error) {
 	// Grab the uploaded file and form variables
@@ -126,7 +234,11 @@ func UploadResponse(w http.ResponseWriter, r *http.Request, loggedInUser, target
 	if targetDB == "" {
 		targetDB = handler.Filename
 	}
+	return uploadResponse(r, tempFile, loggedInUser, targetUser, targetDB, commitID, serverSw)
+}
 
+// uploadResponse does the remaining validation of an upload request, and adds the uploaded database to the system
+func uploadResponse(r *http.Request, tempFile io.Reader, loggedInUser, targetUser, targetDB, commitID, serverSw string) (retMsg map[string]string, httpStatus int, err error) {
 	// Validate the database name
 	err = ValidateDB(targetDB)
 	if err != nil {
@@ -182,6 +294,18 @@ func UploadResponse(w http.ResponseWriter, r *http.Request, loggedInUser, target
 		}
 	}
 
+	// If the client sent a "merge" field, validate it.  When set to true, pushes from a commit which is no longer the
+	// head of the branch have their changes merged into it, rather than being rejected
+	mergeOffline := false
+	if z := r.FormValue("merge"); z != "" {
+		mergeOffline, err = strconv.ParseBool(z)
+		if err != nil {
+			httpStatus = http.StatusBadRequest
+			err = fmt.Errorf("Error when converting merge '%s' value to boolean: %v\n", z, err)
+			return
+		}
+	}
+
 	// If a licence name was provided then use it, else default to "Not specified"
 	licenceName := "Not specified"
 	if z := r.FormValue("licence"); z != "" {
@@ -369,6 +493,13 @@ func UploadResponse(w http.ResponseWriter, r *http.Request, loggedInUser, target
 		dbSHA256 = z
 	}
 
+	// Was the database encrypted by the user before uploading?
+	clientEncrypted, err := GetFormEncrypted(r)
+	if err != nil {
+		httpStatus = http.StatusBadRequest
+		return
+	}
+
 	// Check if the database exists already
 	if !exists && branchName == "" {
 		// If the database doesn't already exist, and no branch name was provided, then default to "main"
@@ -377,6 +508,7 @@ func UploadResponse(w http.ResponseWriter, r *http.Request, loggedInUser, target
 
 	// If the database already exists, we need to do collision detection, check for forking, and check for force pushes
 	createBranch := false
+	var destBranch, offlineBranch string
 	if !exists {
 		createBranch = true
 	} else {
@@ -460,7 +592,14 @@ func UploadResponse(w http.ResponseWriter, r *http.Request, loggedInUser, target
 				// notify the client of the collision.  It probably just means the database has been updated on the
 				// server (eg through the webUI) but the user is still using an older version and needs to update
 
-				if !force {
+				// When asked to, the pushed database is stored on a branch of its own instead, which is then
+				// merged into this one once it's been added
+				if !force && mergeOffline && !clientEncrypted {
+					offlineBranch = OfflineBranchName(branchList)
+					destBranch = branchName
+					branchName = offlineBranch
+					createBranch = true
+				} else if !force {
 					httpStatus = http.StatusConflict
 					err = fmt.Errorf("Outdated commit '%s' provided.  You're probably using an "+
 						"old version of the database", commitID)
@@ -481,7 +620,18 @@ func UploadResponse(w http.ResponseWriter, r *http.Request, loggedInUser, target
 	// Sanity check the uploaded database, and if ok then add it to the system
 	numBytes, returnCommitID, sha, err := AddDatabase(loggedInUser, targetUser, targetDB, createBranch,
 		branchName, commitID, accessType, licenceName, commitMsg, sourceURL, tempFile, lastMod,
-		commitTime, authorName, authorEmail, committerName, committerEmail, otherParents, dbSHA256)
+		commitTime, authorName, authorEmail, committerName, committerEmail, otherParents, dbSHA256,
+		AddDatabaseOptions{ClientEncrypted: clientEncrypted})
+	if errors.Is(err, database.ErrDBArchived) {
+		httpStatus = http.StatusForbidden
+		return
+	}
+	var validationErr ValidationFailedError
+	var policyErr SchemaPolicyError
+	if errors.As(err, &validationErr) || errors.As(err, &policyErr) {
+		httpStatus = http.StatusBadRequest
+		return
+	}
 	if err != nil {
 		httpStatus = http.StatusInternalServerError
 		return
@@ -504,6 +654,22 @@ func UploadResponse(w http.ResponseWriter, r *http.Request, loggedInUser, target
 	// Log the successful database upload
 	log.Printf("Database uploaded: '%s/%s', bytes: %v", loggedInUser, SanitiseLogString(targetDB), numBytes)
 
+	// Merge the changes of a database edited offline into the branch it was pulled from
+	var mrID int
+	var conflicts []string
+	if offlineBranch != "" {
+		var mergeCommitID string
+		mergeCommitID, mrID, conflicts, err = MergeOffline(loggedInUser, targetUser, targetDB, destBranch, offlineBranch)
+		if err != nil {
+			httpStatus = http.StatusInternalServerError
+			return
+		}
+		if mrID == 0 {
+			branchName = destBranch
+			returnCommitID = mergeCommitID
+		}
+	}
+
 	// Generate the formatted server string
 	var server string
 	if config.Conf.DB4S.Port == 443 {
@@ -516,5 +682,14 @@ func UploadResponse(w http.ResponseWriter, r *http.Request, loggedInUser, target
 	u := server + filepath.Join("/", targetUser, targetDB)
 	u += fmt.Sprintf(`?branch=%s&commit=%s`, branchName, returnCommitID)
 	retMsg = map[string]string{"commit_id": returnCommitID, "url": u}
+	if offlineBranch != "" {
+		if mrID == 0 {
+			retMsg["merged"] = "true"
+		} else {
+			retMsg["merged"] = "false"
+			retMsg["merge_request"] = strconv.Itoa(mrID)
+			retMsg["conflicts"] = strings.Join(conflicts, "\n")
+		}
+	}
 	return
 }
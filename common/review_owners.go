@@ -0,0 +1,142 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// ParseReviewOwners reads table ownership rules written in the style of a CODEOWNERS file.  Each line holds a table
+// name pattern followed by the users owning the matching tables, separated by spaces.  The patterns can use the * and
+// ? wildcards.  Blank lines and lines starting with # are ignored, and the user names can have a leading @
+func ParseReviewOwners(text string) (rules []database.ReviewOwnerRule, err error) {
+	for i, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) == 1 {
+			return nil, fmt.Errorf("Line %d doesn't name any owners for '%s'", i+1, fields[0])
+		}
+		if _, err = path.Match(fields[0], ""); err != nil {
+			return nil, fmt.Errorf("Line %d has an invalid table pattern '%s'", i+1, fields[0])
+		}
+		r := database.ReviewOwnerRule{Table: fields[0]}
+		for _, u := range fields[1:] {
+			u = strings.TrimPrefix(u, "@")
+			if err = ValidateUser(u); err != nil {
+				return nil, fmt.Errorf("Line %d has an invalid user name '%s'", i+1, u)
+			}
+			r.Owners = append(r.Owners, u)
+		}
+		rules = append(rules, r)
+	}
+	return
+}
+
+// ReviewOwnersOf returns the owners of a table under a set of table ownership rules.  As with CODEOWNERS files, the
+// last rule matching the table is the one which applies.  Table names are matched case insensitively, the way SQLite
+// treats them
+func ReviewOwnersOf(rules []database.ReviewOwnerRule, table string) []string {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if ok, _ := path.Match(strings.ToLower(rules[i].Table), strings.ToLower(table)); ok {
+			return rules[i].Owners
+		}
+	}
+	return nil
+}
+
+// RequestMergeRequestReviews asks the owners of the tables changed by a merge request to review it, and notifies the
+// ones who hadn't been asked already.  The creator of the merge request isn't asked to review their own changes
+func RequestMergeRequestReviews(destOwner, destName string, disc database.DiscussionEntry) (err error) {
+	rules, err := database.ReviewOwnerRules(destOwner, destName)
+	if err != nil || len(rules) == 0 || len(disc.MRDetails.Commits) == 0 {
+		return
+	}
+	tables, err := mergeRequestTables(destOwner, destName, disc.MRDetails)
+	if err != nil {
+		return
+	}
+	reviewers := make(map[string]struct{})
+	for _, t := range tables {
+		for _, u := range ReviewOwnersOf(rules, t) {
+			if !strings.EqualFold(u, disc.Creator) {
+				reviewers[u] = struct{}{}
+			}
+		}
+	}
+	var list []string
+	for u := range reviewers {
+		list = append(list, u)
+	}
+	added, err := database.MergeRequestReviewRequestsAdd(destOwner, destName, disc.ID, list)
+	if err != nil {
+		return
+	}
+	return database.NewReviewRequestEvent(destOwner, destName, disc.Creator, disc.ID, disc.Title, added)
+}
+
+// mergeRequestOwnersApproved returns which changed table of a merge request still needs an approval from one of its
+// owners before the merge request can be merged, or an empty string when none do.  Tables owned by the creator of
+// the merge request don't need another owner's approval
+func mergeRequestOwnersApproved(destOwner, destName string, disc database.DiscussionEntry, reviews []database.MergeRequestReview) (blocked string, err error) {
+	rules, err := database.ReviewOwnerRules(destOwner, destName)
+	if err != nil || len(rules) == 0 {
+		return
+	}
+	tables, err := mergeRequestTables(destOwner, destName, disc.MRDetails)
+	if err != nil {
+		return
+	}
+	approved := make(map[string]bool)
+	for _, r := range reviews {
+		if r.State == database.ReviewApproved && r.Commit == disc.MRDetails.Commits[0].ID {
+			approved[strings.ToLower(r.User)] = true
+		}
+	}
+	for _, t := range tables {
+		owners := ReviewOwnersOf(rules, t)
+		if len(owners) == 0 {
+			continue
+		}
+		ok := false
+		for _, u := range owners {
+			if approved[strings.ToLower(u)] || strings.EqualFold(u, disc.Creator) {
+				ok = true
+			}
+		}
+		if !ok {
+			return fmt.Sprintf("The changes to table '%s' need to be approved by one of its owners: %s", t,
+				strings.Join(owners, ", ")), nil
+		}
+	}
+	return
+}
+
+// mergeRequestTables returns the tables a merge request changes, sorted by name.  Tables whose schema or data differs
+// between the head commit of the destination branch and the head commit of the merge request count as changed.  The
+// list is empty when the server can't read the databases
+func mergeRequestTables(destOwner, destName string, mr database.MergeRequestEntry) (tables []string, err error) {
+	dest, head, err := mergeRequestDatabases(destOwner, destName, mr)
+	if errors.Is(err, ErrClientEncrypted) {
+		return nil, nil
+	}
+	if err != nil {
+		return
+	}
+	diffs, err := DBDiff(dest, head, NoMerge, false)
+	if err != nil {
+		return
+	}
+	for _, d := range diffs.Diff {
+		if d.ObjectType == "table" {
+			tables = append(tables, d.ObjectName)
+		}
+	}
+	sort.Strings(tables)
+	return
+}
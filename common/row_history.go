@@ -0,0 +1,230 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	sqlite "github.com/gwenn/gosqlite"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// RowHistoryMaxVersions is the maximum number of different database files opened when working out the history of a
+// row.  Commits which don't change the database file (eg licence changes) don't count towards this
+const RowHistoryMaxVersions = 100
+
+// ErrRowKey is returned when the table or primary key given for a row history doesn't match the database
+var ErrRowKey = errors.New("The table needs to exist, and the key needs to give a value for each of its primary key " +
+	"columns")
+
+// ParseRowKey parses the primary key of a table row, given as a JSON object of column names and values.  Numbers are
+// accepted as well as strings, so keys can be written the same way as the row data
+func ParseRowKey(raw string) (key map[string]string, err error) {
+	var k map[string]interface{}
+	dec := json.NewDecoder(bytes.NewBufferString(raw))
+	dec.UseNumber()
+	err = dec.Decode(&k)
+	if err != nil || len(k) == 0 {
+		return nil, errors.New("The key needs to be a JSON object of primary key columns and their values")
+	}
+	key = make(map[string]string)
+	for col, val := range k {
+		switch v := val.(type) {
+		case string:
+			key[col] = v
+		case json.Number:
+			key[col] = v.String()
+		default:
+			return nil, fmt.Errorf("Invalid value for key column '%s'.  It needs to be a string or number",
+				SanitiseLogString(col))
+		}
+	}
+	return
+}
+
+// RowHistory walks back through the history of a database branch, reporting the commits which added, changed, or
+// deleted the table row with the given primary key.  The changes are returned newest first
+func RowHistory(loggedInUser, dbOwner, dbName, branchName, table string, key map[string]string) (prov RowProvenance, err error) {
+	branches, err := database.GetBranches(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	head, ok := branches[branchName]
+	if !ok {
+		return prov, fmt.Errorf("Unknown branch name: '%s'", branchName)
+	}
+
+	// This checks the user can read the database, and that its data isn't encrypted
+	bucket, id, err := SQLiteLocation(dbOwner, dbName, head.Commit, loggedInUser)
+	if err != nil {
+		return
+	}
+
+	// Make sure the key matches the primary key of the table in the branch head
+	sdb, err := OpenSQLiteDatabase(bucket, id)
+	if err != nil {
+		return
+	}
+	tables, err := sdb.Tables("")
+	if err != nil {
+		sdb.Close()
+		return
+	}
+	pks, _, _, err := GetPrimaryKeyAndOtherColumns(sdb, "main", table)
+	sdb.Close()
+	if err != nil {
+		return
+	}
+	found := false
+	for _, t := range tables {
+		if t == table {
+			found = true
+		}
+	}
+	if !found || len(pks) != len(key) {
+		return prov, ErrRowKey
+	}
+	for _, p := range pks {
+		if _, ok := key[p]; !ok {
+			return prov, ErrRowKey
+		}
+	}
+
+	commitList, err := database.GetCommitList(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+
+	// Look up the row in each database file only once, as many commits share the same file
+	type version struct {
+		commit database.CommitEntry
+		row    DataRow
+	}
+	var versions []version
+	rows := make(map[string]DataRow)
+	commitID := head.Commit
+	for commitID != "" {
+		c, ok := commitList[commitID]
+		if !ok {
+			return prov, fmt.Errorf("Commit '%s' is missing from the commit list", commitID)
+		}
+		sha := c.Tree.Entries[0].Sha256
+		row, ok := rows[sha]
+		if !ok {
+			if len(rows) == RowHistoryMaxVersions {
+				break
+			}
+			row, err = rowAtVersion(sha, table, key)
+			if err != nil {
+				return
+			}
+			rows[sha] = row
+		}
+		versions = append(versions, version{commit: c, row: row})
+		commitID = c.Parent
+	}
+	prov.Complete = commitID == ""
+	prov.Exists = versions[0].row != nil
+	prov.Key = key
+	prov.Table = table
+
+	// Compare each version of the row with the one before it, starting from the oldest.  When the start of the branch
+	// wasn't reached, the oldest version looked at is only used for comparing with
+	var prev DataRow
+	for i := len(versions) - 1; i >= 0; i-- {
+		v := versions[i]
+		if i == len(versions)-1 && !prov.Complete {
+			prev = v.row
+			continue
+		}
+		var action DiffType
+		switch {
+		case prev == nil && v.row != nil:
+			action = ActionAdd
+		case prev != nil && v.row == nil:
+			action = ActionDelete
+		case prev != nil && !reflect.DeepEqual(prev, v.row):
+			action = ActionModify
+		}
+		prev = v.row
+		if action == "" {
+			continue
+		}
+		change := RowChange{
+			Action:      action,
+			AuthorEmail: v.commit.AuthorEmail,
+			AuthorName:  v.commit.AuthorName,
+			CommitID:    v.commit.ID,
+			Message:     v.commit.Message,
+			Timestamp:   v.commit.Timestamp,
+		}
+		if v.row != nil {
+			change.Data = make(map[string]interface{})
+			for _, d := range v.row {
+				change.Data[d.Name] = d.Value
+			}
+		}
+		prov.Changes = append([]RowChange{change}, prov.Changes...)
+	}
+
+	// Point out the commit which added the row, and the one which made its latest change
+	if prov.Changes == nil {
+		prov.Changes = []RowChange{}
+		return
+	}
+	prov.LastModified = &prov.Changes[0]
+	for i, c := range prov.Changes {
+		if c.Action == ActionAdd {
+			prov.Introduced = &prov.Changes[i]
+			break
+		}
+	}
+	return
+}
+
+// rowAtVersion returns a table row from the database file with the given sha256, or nil when the file doesn't have the
+// table, the key columns, or the row
+func rowAtVersion(sha, table string, key map[string]string) (row DataRow, err error) {
+	var sdb *sqlite.Conn
+	sdb, err = OpenSQLiteDatabase(sha[:MinioFolderChars], sha[MinioFolderChars:])
+	if err != nil {
+		return
+	}
+	defer sdb.Close()
+
+	// Older versions of the database may not have the table or key columns yet
+	pks, _, other, err := GetPrimaryKeyAndOtherColumns(sdb, "main", table)
+	if err != nil {
+		return
+	}
+	cols := make(map[string]bool)
+	for _, c := range append(pks, other...) {
+		cols[c] = true
+	}
+	var keyCols []string
+	for k := range key {
+		if !cols[k] {
+			return nil, nil
+		}
+		keyCols = append(keyCols, k)
+	}
+	sort.Strings(keyCols)
+
+	var conds []string
+	for _, k := range keyCols {
+		conds = append(conds, EscapeId(k)+" = "+sqlite.Mprintf("%Q", key[k]))
+	}
+	query := "SELECT * FROM main." + EscapeId(table) + " WHERE " + strings.Join(conds, " AND ")
+	_, _, data, err := SQLiteRunQuery(sdb, QuerySourceAPI, query, false, false)
+	if err != nil {
+		return
+	}
+	if len(data.Records) == 0 {
+		return nil, nil
+	}
+	return data.Records[0], nil
+}
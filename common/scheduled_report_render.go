@@ -0,0 +1,296 @@
+package common
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// reportPDFColumnWidth is the most characters shown of each value in PDF reports
+	reportPDFColumnWidth = 40
+
+	// reportPDFFontSize is the size of the monospaced font PDF reports are written in, in points.  Its characters are
+	// 0.6 of this wide
+	reportPDFFontSize = 7
+
+	// reportPDFLineHeight is the distance between the lines of PDF reports, in points
+	reportPDFLineHeight = 9
+
+	// reportPDFMargin is the space around the edges of the pages of PDF reports, in points
+	reportPDFMargin = 36
+
+	// reportPDFPageHeight and reportPDFPageWidth are the size of the pages of PDF reports, in points.  This is A4 in
+	// landscape, so wider tables fit
+	reportPDFPageHeight = 595
+	reportPDFPageWidth  = 842
+)
+
+// reportHTMLTemplate is used for rendering HTML reports
+var reportHTMLTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Name }}</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; color: #333; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 6px; text-align: left; vertical-align: top; }
+th { background: #eee; }
+.null { color: #999; font-style: italic; }
+</style>
+</head>
+<body>
+<h1>{{ .Name }}</h1>
+<p>Generated by DBHub.io at {{ .Generated }} UTC</p>
+{{ range .Sections }}<h2>{{ .Title }}</h2>
+{{ if .Error }}<p>Not included: {{ .Error }}</p>
+{{ else }}{{ if .Chart }}<div>{{ .Chart }}</div>
+{{ end }}<table>
+<thead><tr>{{ range .Columns }}<th>{{ . }}</th>{{ end }}</tr></thead>
+<tbody>
+{{ range .Rows }}<tr>{{ range . }}{{ if .Null }}<td class="null">NULL</td>{{ else }}<td>{{ .Text }}</td>{{ end }}{{ end }}</tr>
+{{ end }}</tbody>
+</table>
+{{ end }}{{ end }}</body>
+</html>
+`))
+
+// reportCSV renders the results of a report as CSV.  When there's more than one section, such as for dashboards, each
+// one starts with a row holding its title, and they're separated by an empty row
+func reportCSV(sections []reportSection) ([]byte, error) {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	for i, s := range sections {
+		if len(sections) > 1 {
+			if i > 0 {
+				w.Write([]string{})
+			}
+			w.Write([]string{s.Title})
+		}
+		if s.Error != "" {
+			w.Write([]string{"Not included: " + s.Error})
+			continue
+		}
+		w.Write(s.Data.ColNames)
+		for _, row := range s.Data.Records {
+			values := make([]string, len(row))
+			for j, v := range row {
+				values[j] = reportValue(v, "")
+			}
+			w.Write(values)
+		}
+	}
+	w.Flush()
+	return b.Bytes(), w.Error()
+}
+
+// reportHTML renders the results of a report as a HTML page, including the charts of dashboard widgets
+func reportHTML(name string, sections []reportSection, generated time.Time) ([]byte, error) {
+	type cell struct {
+		Null bool
+		Text string
+	}
+	type section struct {
+		Chart   template.HTML
+		Columns []string
+		Error   string
+		Rows    [][]cell
+		Title   string
+	}
+	var list []section
+	for _, s := range sections {
+		z := section{Columns: s.Data.ColNames, Error: s.Error, Title: s.Title}
+
+		// The charts are SVG images we've rendered ourselves, with their text already escaped
+		z.Chart = template.HTML(s.Chart)
+		for _, row := range s.Data.Records {
+			cells := make([]cell, len(row))
+			for j, v := range row {
+				cells[j] = cell{Null: v.Type == Null || v.Value == nil, Text: reportValue(v, "")}
+			}
+			z.Rows = append(z.Rows, cells)
+		}
+		list = append(list, z)
+	}
+
+	var b bytes.Buffer
+	err := reportHTMLTemplate.Execute(&b, struct {
+		Generated string
+		Name      string
+		Sections  []section
+	}{
+		Generated: generated.Format("2006-01-02 15:04"),
+		Name:      name,
+		Sections:  list,
+	})
+	return b.Bytes(), err
+}
+
+// reportPDF renders the results of a report as a PDF document.  The tables are written as monospaced text, with long
+// values cut short.  Charts aren't included
+func reportPDF(name string, sections []reportSection, generated time.Time) []byte {
+	charsPerLine := (reportPDFPageWidth - 2*reportPDFMargin) * 10 / (reportPDFFontSize * 6)
+	linesPerPage := (reportPDFPageHeight - 2*reportPDFMargin) / reportPDFLineHeight
+
+	// Work out the lines of text, then split them into pages
+	lines := []string{name, "Generated by DBHub.io at " + generated.Format("2006-01-02 15:04") + " UTC", ""}
+	for _, s := range sections {
+		lines = append(lines, s.Title, strings.Repeat("=", utf8.RuneCountInString(s.Title)))
+		if s.Error != "" {
+			lines = append(lines, "Not included: "+s.Error, "")
+			continue
+		}
+		lines = append(lines, reportTextTable(s.Data)...)
+		lines = append(lines, "")
+	}
+	var pages [][]string
+	for len(lines) > 0 {
+		n := linesPerPage
+		if n > len(lines) {
+			n = len(lines)
+		}
+		pages = append(pages, lines[:n])
+		lines = lines[n:]
+	}
+
+	// Each object of the document is numbered in order.  The catalog, page tree, and font come first, followed by each
+	// page and its content
+	var b bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	b.WriteString("%PDF-1.4\n")
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	for i, p := range pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> "+
+			"/Contents %d 0 R >>", reportPDFPageWidth, reportPDFPageHeight, 5+2*i))
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT /F1 %d Tf %d TL %d %d Td\n", reportPDFFontSize, reportPDFLineHeight, reportPDFMargin,
+			reportPDFPageHeight-reportPDFMargin-reportPDFFontSize)
+		for _, l := range p {
+			fmt.Fprintf(&content, "(%s) Tj T*\n", reportPDFText(l, charsPerLine))
+		}
+		content.WriteString("ET")
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.Bytes()))
+	}
+
+	// The cross reference table gives the position of each object
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return b.Bytes()
+}
+
+// reportPDFText prepares a line of text for a PDF content stream, cutting it to the given length.  Characters the
+// standard PDF fonts don't have are replaced with question marks
+func reportPDFText(s string, maxChars int) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		if n == maxChars {
+			break
+		}
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32:
+			b.WriteByte(' ')
+		case r > 255, r > 126 && r < 160:
+			b.WriteByte('?')
+		case r > 126:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteRune(r)
+		}
+		n++
+	}
+	return b.String()
+}
+
+// reportTextTable lays out query results as lines of a monospaced text table
+func reportTextTable(data SQLiteRecordSet) (lines []string) {
+	if len(data.ColNames) == 0 {
+		return []string{"(no results)"}
+	}
+
+	// Each column is as wide as its widest value, up to a limit
+	cut := func(s string) string {
+		s = strings.Map(func(r rune) rune {
+			if r < 32 {
+				return ' '
+			}
+			return r
+		}, s)
+		if utf8.RuneCountInString(s) > reportPDFColumnWidth {
+			s = string([]rune(s)[:reportPDFColumnWidth-1]) + "~"
+		}
+		return s
+	}
+	widths := make([]int, len(data.ColNames))
+	for i, c := range data.ColNames {
+		widths[i] = utf8.RuneCountInString(cut(c))
+	}
+	for _, row := range data.Records {
+		for i, v := range row {
+			if i < len(widths) {
+				if w := utf8.RuneCountInString(cut(reportValue(v, "NULL"))); w > widths[i] {
+					widths[i] = w
+				}
+			}
+		}
+	}
+	line := func(values []string) string {
+		parts := make([]string, len(widths))
+		for i := range widths {
+			var v string
+			if i < len(values) {
+				v = cut(values[i])
+			}
+			parts[i] = v + strings.Repeat(" ", widths[i]-utf8.RuneCountInString(v))
+		}
+		return strings.TrimRight(strings.Join(parts, " | "), " ")
+	}
+
+	lines = append(lines, line(data.ColNames))
+	seps := make([]string, len(widths))
+	for i, w := range widths {
+		seps[i] = strings.Repeat("-", w)
+	}
+	lines = append(lines, strings.Join(seps, "-+-"))
+	for _, row := range data.Records {
+		values := make([]string, len(row))
+		for i, v := range row {
+			values[i] = reportValue(v, "NULL")
+		}
+		lines = append(lines, line(values))
+	}
+	if len(data.Records) == 0 {
+		lines = append(lines, "(no rows)")
+	}
+	return
+}
+
+// reportValue returns the text of a value in a report.  NULLs are shown as the given text
+func reportValue(v DataValue, null string) string {
+	if v.Type == Null || v.Value == nil {
+		return null
+	}
+	return fmt.Sprint(v.Value)
+}
@@ -0,0 +1,462 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+const (
+	// ScheduledReportMaxOutput is the largest a rendered report can be, in bytes
+	ScheduledReportMaxOutput = 5 * 1024 * 1024
+
+	// ScheduledReportMinInterval is the shortest time allowed between the scheduled runs of a report
+	ScheduledReportMinInterval = 15 * time.Minute
+
+	// scheduledReportCheckInterval is how often the scheduled report loop looks for reports due to run
+	scheduledReportCheckInterval = time.Minute
+
+	// scheduledReportInlineCSV is the largest CSV report included in the body of report emails, in bytes.  Larger
+	// ones, and the other formats, are linked to instead
+	scheduledReportInlineCSV = 64 * 1024
+
+	// scheduledReportMaxRows is the most rows each query of a report can return
+	scheduledReportMaxRows = 10000
+
+	// scheduledReportTimeout is the longest each query of a report on a standard database is allowed to run
+	scheduledReportTimeout = 2 * time.Minute
+)
+
+var (
+	// ErrScheduledReportWebhook is returned when a report webhook isn't on a server we're allowed to connect to
+	ErrScheduledReportWebhook = errors.New("Webhook address not allowed")
+
+	// scheduledReportClient is used for delivering reports and alerts to webhooks
+	scheduledReportClient = &http.Client{
+		Timeout: 30 * time.Second,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout: 10 * time.Second,
+				Control: scheduledReportDialControl,
+			}).DialContext,
+		},
+	}
+
+	// scheduledReportFormats are the content types and file extensions of the formats reports can be rendered as
+	scheduledReportFormats = map[string][2]string{
+		"csv":  {"text/csv; charset=utf-8", ".csv"},
+		"html": {"text/html; charset=utf-8", ".html"},
+		"pdf":  {"application/pdf", ".pdf"},
+	}
+)
+
+// reportSection is the results of one query of a report.  Saved query reports have a single section, while dashboard
+// reports have one for each widget, along with its chart.  Widgets which can't be run have the reason instead
+type reportSection struct {
+	Chart []byte
+	Data  SQLiteRecordSet
+	Error string
+	Title string
+}
+
+// ScheduledReportLoop runs the scheduled reports which are due, then delivers them.  When several nodes are running,
+// only one of them does it.  When ctx is cancelled the report being run is finished off and delivered, then wg is
+// marked as done
+func ScheduledReportLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// Ensure a warning message is displayed on the console if the scheduled report loop exits other than by shutting down
+	defer func() {
+		if ctx.Err() != nil {
+			log.Printf("%s: scheduled report loop stopped", config.Conf.Live.Nodename)
+			return
+		}
+		log.Printf("%s: WARN: Scheduled report loop exited", config.Conf.Live.Nodename)
+	}()
+
+	leader := database.NewLeader("scheduled reports")
+	defer leader.Resign()
+
+	log.Printf("%s: scheduled report loop started.  %v refresh.", config.Conf.Live.Nodename,
+		scheduledReportCheckInterval)
+	for {
+		if leader.IsLeader() {
+			list, err := database.ScheduledReportsDue()
+			if err != nil {
+				log.Printf("Error when retrieving the scheduled reports which are due: %v", err)
+			}
+			for _, r := range list {
+				if ctx.Err() != nil {
+					break
+				}
+				err = runScheduledReport(r)
+				if err != nil {
+					log.Printf("Running the scheduled report '%s' of '%s' failed: %v", SanitiseLogString(r.Name),
+						r.User, err)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(scheduledReportCheckInterval):
+		}
+	}
+}
+
+// ScheduledReportExtension returns the file extension for report output of the given content type
+func ScheduledReportExtension(contentType string) string {
+	for _, z := range scheduledReportFormats {
+		if z[0] == contentType {
+			return z[1]
+		}
+	}
+	return ""
+}
+
+// ScheduledReportFormat returns the content type and file extension of a report format, and whether it's known
+func ScheduledReportFormat(format string) (contentType, ext string, ok bool) {
+	z, ok := scheduledReportFormats[format]
+	return z[0], z[1], ok
+}
+
+// ScheduledReportSchedule parses the cron schedule of a report, checking it runs at some point and not more often than
+// ScheduledReportMinInterval
+func ScheduledReportSchedule(spec string) (sched CronSchedule, err error) {
+	sched, err = ParseCron(spec)
+	if err != nil {
+		return
+	}
+	prev := sched.Next(time.Now())
+	if prev.IsZero() {
+		return sched, errors.New("That schedule never runs")
+	}
+
+	// Looking at the next runs catches schedules which run too often, even when they only do for part of the day
+	for i := 0; i < 100; i++ {
+		next := sched.Next(prev)
+		if next.IsZero() {
+			break
+		}
+		if next.Sub(prev) < ScheduledReportMinInterval {
+			return sched, fmt.Errorf("Reports can't run more often than every %d minutes",
+				int(ScheduledReportMinInterval/time.Minute))
+		}
+		prev = next
+	}
+	return
+}
+
+// ValidateWebhookURL checks the address reports and alerts are delivered to is a http or https one.  Servers on private networks
+// are refused when connecting, rather than here, so that can't be bypassed using DNS
+func ValidateWebhookURL(webhookURL string) error {
+	u, err := url.Parse(webhookURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" || u.User != nil {
+		return errors.New("The webhook needs to be a http or https address")
+	}
+	return nil
+}
+
+// deliverScheduledReport sends the output of a report run to its webhook
+func deliverScheduledReport(r database.ScheduledReport, run database.ScheduledReportRun) error {
+	_, ext, _ := ScheduledReportFormat(r.Format)
+	return postSignedWebhook(r.WebhookURL, r.WebhookSecret, run.ContentType, run.Output, map[string]string{
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": r.Name + ext}),
+		"X-DBHub-Report":      r.Name,
+		"X-DBHub-Run":         strconv.FormatInt(run.RunID, 10),
+	})
+}
+
+// postSignedWebhook POSTs a body to a webhook, along with the given extra headers.  The request is signed with the
+// HMAC-SHA256 of the body using the given secret, so the receiver can check it came from us
+func postSignedWebhook(webhookURL, secret, contentType string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "DBHub.io webhooks")
+	req.Header.Set("X-DBHub-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	resp, err := scheduledReportClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("The webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// runScheduledReport runs a report, renders and delivers its results, then records the run.  Failures are recorded in
+// the run history rather than returned, with the report owner being emailed when a report starts failing
+func runScheduledReport(r database.ScheduledReport) (err error) {
+	run := database.ScheduledReportRun{Started: time.Now().UTC(), Trigger: r.Trigger}
+	run.RunID, err = database.ScheduledReportRunID()
+	if err != nil {
+		return
+	}
+
+	// Run the report and render its results
+	sections, runErr := scheduledReportSections(r)
+	if runErr == nil {
+		for _, s := range sections {
+			run.Rows += int64(s.Data.RowCount)
+		}
+		run.ContentType, run.Output, runErr = renderScheduledReport(r, sections, run.Started)
+	}
+
+	// Webhooks are delivered to straight away, while emails are queued along with the run being saved
+	var deliverSubj, deliverMsg string
+	if runErr == nil {
+		if r.Delivery == "webhook" {
+			runErr = deliverScheduledReport(r, run)
+			if runErr != nil {
+				runErr = fmt.Errorf("Delivering the report to its webhook failed: %v", runErr)
+			}
+			run.Delivered = runErr == nil
+		} else {
+			deliverSubj, deliverMsg = scheduledReportEmail(r, run)
+			run.Delivered = true
+		}
+	}
+	run.Finished = time.Now().UTC()
+	if runErr != nil {
+		run.Error = runErr.Error()
+	}
+
+	// Work out when the report next runs.  Running it by hand doesn't change that, unless it was due anyway
+	nextRun := r.NextRun
+	if r.Trigger != "manual" || !nextRun.After(run.Started) {
+		var sched CronSchedule
+		sched, err = ParseCron(r.Schedule)
+		if err == nil {
+			nextRun = sched.Next(run.Started)
+		}
+		if err != nil || nextRun.IsZero() {
+			// This shouldn't happen, as schedules are checked when they're saved
+			nextRun = run.Started.AddDate(1, 0, 0)
+		}
+	}
+
+	subj := fmt.Sprintf("DBHub.io: scheduled report '%s' failed", r.Name)
+	msg := fmt.Sprintf("Your scheduled report '%s' failed with this error:\n\n%s\n\nYou won't be emailed again until it "+
+		"has run successfully.  Its run history can be retrieved using the reportruns API call.", r.Name, run.Error)
+	return database.ScheduledReportRunSave(r, run, nextRun, subj, msg, deliverSubj, deliverMsg)
+}
+
+// scheduledReportEmail returns the subject and body of the email delivering a report run.  Small CSV reports are
+// included in the email, with the others being linked to
+func scheduledReportEmail(r database.ScheduledReport, run database.ScheduledReportRun) (subj, msg string) {
+	subj = fmt.Sprintf("DBHub.io: scheduled report '%s'", r.Name)
+	msg = fmt.Sprintf("Your scheduled report '%s' ran at %s UTC, returning %d rows.\n\nIt can be downloaded from:\n\n"+
+		"  https://%s/x/reportoutput/?name=%s&run=%d", r.Name, run.Started.Format("2006-01-02 15:04"), run.Rows,
+		config.Conf.Web.ServerName, url.QueryEscape(r.Name), run.RunID)
+	if r.Format == "csv" && len(run.Output) <= scheduledReportInlineCSV {
+		msg += "\n\nThe results are:\n\n" + string(run.Output)
+	}
+	return
+}
+
+// scheduledReportDialControl refuses connections to webhooks on loopback, private, and link-local addresses, unless
+// they've been allowed in the configuration.  It's checked after name resolution, so can't be bypassed by DNS
+func scheduledReportDialControl(network, address string, c syscall.RawConn) error {
+	if config.Conf.Reports.AllowPrivateHosts {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() {
+		return ErrScheduledReportWebhook
+	}
+	return nil
+}
+
+// scheduledReportQuery runs a query of a report on behalf of its owner.  Queries on standard databases use the head
+// commit of the default branch
+func scheduledReportQuery(loggedInUser, dbOwner, dbName, query string) (data SQLiteRecordSet, err error) {
+	isLive, liveNode, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	if isLive {
+		if liveNode == "" {
+			return data, errors.New("No job queue node available for the live database")
+		}
+		return LiveQuery(liveNode, loggedInUser, dbOwner, dbName, query)
+	}
+
+	bucket, id, err := SQLiteLocation(dbOwner, dbName, "", loggedInUser)
+	if err != nil {
+		return
+	}
+	if id == "" {
+		return data, fmt.Errorf("The database '%s/%s' doesn't exist, or you no longer have access to it", dbOwner,
+			dbName)
+	}
+	dbPath, err := RetrieveDatabaseFile(bucket, id)
+	if err != nil {
+		return
+	}
+	sdb, err := openValidationDatabase(dbPath)
+	if err != nil {
+		return
+	}
+	defer sdb.Close()
+
+	limiter := startQueryLimits(sdb, QueryLimits{MaxRows: scheduledReportMaxRows, Timeout: scheduledReportTimeout})
+	_, _, data, err = sqliteRunQuery(sdb, QuerySourceInternal, query, nil, limiter, false, false)
+	limiter.stop()
+	return data, limiter.err(err)
+}
+
+// scheduledReportSections runs the queries of a report.  Dashboard widgets which can't be run are included with the
+// reason, so one of them failing doesn't stop the rest of the report being delivered
+func scheduledReportSections(r database.ScheduledReport) (sections []reportSection, err error) {
+	if r.Source == "query" {
+		allowed, err := database.CheckDBPermissions(r.User, r.DBOwner, r.DBName, false)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			return nil, fmt.Errorf("The database '%s/%s' doesn't exist, or you no longer have access to it",
+				r.DBOwner, r.DBName)
+		}
+		q, exists, err := database.SavedQueryGet(r.User, r.DBOwner, r.DBName, r.SourceName, 0)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, fmt.Errorf("The saved query '%s' of '%s/%s' no longer exists", r.SourceName, r.DBOwner,
+				r.DBName)
+		}
+		data, err := scheduledReportQuery(r.User, r.DBOwner, r.DBName, q.SQL)
+		if err != nil {
+			return nil, err
+		}
+		return []reportSection{{Data: data, Title: q.Name}}, nil
+	}
+
+	dash, exists, err := database.DashboardGet(r.User, r.SourceName)
+	if err != nil {
+		return
+	}
+	if !exists {
+		return nil, fmt.Errorf("The dashboard '%s' no longer exists", r.SourceName)
+	}
+	for _, w := range dash.Widgets {
+		s := reportSection{Title: w.Title}
+		if s.Title == "" {
+			s.Title = fmt.Sprintf("%s/%s: %s", w.DBOwner, w.DBName, w.VisName)
+		}
+		s.Chart, s.Data, err = scheduledReportWidget(r.User, w)
+		if err != nil {
+			s.Error = err.Error()
+		}
+		sections = append(sections, s)
+	}
+	return sections, nil
+}
+
+// scheduledReportWidget runs the visualisation of a dashboard widget for a report, returning its chart and data
+func scheduledReportWidget(loggedInUser string, w database.DashboardWidget) (chart []byte, data SQLiteRecordSet, err error) {
+	// Public visualisations can be included by anyone, running their query on behalf of the database owner
+	queryUser := loggedInUser
+	allowed, err := database.CheckDBPermissions(loggedInUser, w.DBOwner, w.DBName, false)
+	if err != nil {
+		return
+	}
+	if !allowed {
+		allowed, err = database.VisualisationIsPublic(w.DBOwner, w.DBName, w.VisName)
+		if err != nil {
+			return
+		}
+		if !allowed {
+			return nil, data, errors.New("The visualisation doesn't exist, or you no longer have access to it")
+		}
+		queryUser = w.DBOwner
+	}
+	visualisations, err := database.GetVisualisations(w.DBOwner, w.DBName)
+	if err != nil {
+		return
+	}
+	params, ok := visualisations[w.VisName]
+	if !ok {
+		return nil, data, errors.New("The visualisation no longer exists")
+	}
+
+	// Pivot tables have their query wrapped with the SQL summarising it
+	query := params.SQL
+	if params.ChartType == "pivot" && params.Pivot != nil {
+		query, err = PivotQuery(query, *params.Pivot)
+		if err != nil {
+			return
+		}
+	}
+	data, err = scheduledReportQuery(queryUser, w.DBOwner, w.DBName, query)
+	if err != nil {
+		return
+	}
+	if params.ChartType == "pivot" && params.Pivot != nil {
+		data, err = PivotResults(*params.Pivot, data)
+		if err != nil {
+			return
+		}
+	}
+
+	// Not being able to draw the chart isn't a reason to leave out the data
+	chart, _, chartErr := RenderVisualisation(params, data, "svg")
+	if chartErr != nil {
+		chart = nil
+	}
+	return chart, data, nil
+}
+
+// renderScheduledReport renders the results of a report in its format
+func renderScheduledReport(r database.ScheduledReport, sections []reportSection, generated time.Time) (contentType string, output []byte, err error) {
+	contentType, _, ok := ScheduledReportFormat(r.Format)
+	if !ok {
+		return "", nil, fmt.Errorf("Unknown report format '%s'", r.Format)
+	}
+	switch r.Format {
+	case "csv":
+		output, err = reportCSV(sections)
+	case "html":
+		output, err = reportHTML(r.Name, sections, generated)
+	case "pdf":
+		output = reportPDF(r.Name, sections, generated)
+	}
+	if err != nil {
+		return
+	}
+	if len(output) > ScheduledReportMaxOutput {
+		return "", nil, fmt.Errorf("The report is %d bytes, larger than the %d MB limit", len(output),
+			ScheduledReportMaxOutput/1024/1024)
+	}
+	return contentType, output, nil
+}
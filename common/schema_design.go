@@ -0,0 +1,282 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	sqlite "github.com/gwenn/gosqlite"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+)
+
+const (
+	// SchemaMaxSize is the maximum size in bytes of a submitted schema definition
+	SchemaMaxSize = 1024 * 1024
+
+	// SchemaMaxTables is the maximum number of tables accepted in a submitted schema definition
+	SchemaMaxTables = 100
+
+	// SchemaMaxIndexes is the maximum number of indexes accepted in a submitted schema definition
+	SchemaMaxIndexes = 200
+)
+
+// schemaColumnType matches the declared column types accepted in a schema definition.  eg "INTEGER", "TEXT",
+// "VARCHAR(255)", "DECIMAL(10, 2)"
+var schemaColumnType = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_ ]{0,31}(\(\s*[0-9]{1,9}\s*(,\s*[0-9]{1,9}\s*)?\))?$`)
+
+// SchemaColumn is a column of a table in a schema definition
+type SchemaColumn struct {
+	AutoIncrement bool             `json:"autoincrement,omitempty"`
+	Default       json.RawMessage  `json:"default,omitempty"`
+	Name          string           `json:"name"`
+	NotNull       bool             `json:"not_null,omitempty"`
+	PrimaryKey    bool             `json:"primary_key,omitempty"`
+	References    *SchemaReference `json:"references,omitempty"`
+	Type          string           `json:"type,omitempty"`
+	Unique        bool             `json:"unique,omitempty"`
+}
+
+// SchemaDefinition describes the tables and indexes of a new database, for creating it without uploading a file
+type SchemaDefinition struct {
+	Indexes []SchemaIndex `json:"indexes,omitempty"`
+	Tables  []SchemaTable `json:"tables"`
+}
+
+// SchemaIndex is an index in a schema definition
+type SchemaIndex struct {
+	Columns []string `json:"columns"`
+	Name    string   `json:"name"`
+	Table   string   `json:"table"`
+	Unique  bool     `json:"unique,omitempty"`
+}
+
+// SchemaReference is the column of another table a column refers to, making it a foreign key
+type SchemaReference struct {
+	Column string `json:"column"`
+	Table  string `json:"table"`
+}
+
+// SchemaTable is a table in a schema definition.  PrimaryKey is for primary keys made of more than one column
+type SchemaTable struct {
+	Columns      []SchemaColumn `json:"columns"`
+	Name         string         `json:"name"`
+	PrimaryKey   []string       `json:"primary_key,omitempty"`
+	WithoutRowID bool           `json:"without_rowid,omitempty"`
+}
+
+// ParseSchemaDefinition reads a JSON schema definition, checking it can be turned into a database
+func ParseSchemaDefinition(data string) (def SchemaDefinition, err error) {
+	if len(data) > SchemaMaxSize {
+		return def, fmt.Errorf("The schema definition is too large.  It can't be more than %d KB", SchemaMaxSize/1024)
+	}
+	d := json.NewDecoder(strings.NewReader(data))
+	d.DisallowUnknownFields()
+	err = d.Decode(&def)
+	if err != nil {
+		return def, fmt.Errorf("The schema definition couldn't be read: %s", err)
+	}
+	if len(def.Tables) == 0 || len(def.Tables) > SchemaMaxTables {
+		return def, fmt.Errorf("The schema definition needs to have between 1 and %d tables", SchemaMaxTables)
+	}
+	if len(def.Indexes) > SchemaMaxIndexes {
+		return def, fmt.Errorf("The schema definition can't have more than %d indexes", SchemaMaxIndexes)
+	}
+
+	// Check the names of everything, and that the columns used by keys and indexes exist
+	tables := make(map[string]map[string]bool)
+	for _, t := range def.Tables {
+		if ValidatePGTable(t.Name) != nil || strings.HasPrefix(strings.ToLower(t.Name), "sqlite_") {
+			return def, fmt.Errorf("Invalid table name: '%s'", t.Name)
+		}
+		if _, ok := tables[strings.ToLower(t.Name)]; ok {
+			return def, fmt.Errorf("Table '%s' is in the schema definition more than once", t.Name)
+		}
+		if len(t.Columns) == 0 {
+			return def, fmt.Errorf("Table '%s' needs to have at least one column", t.Name)
+		}
+		cols := make(map[string]bool)
+		for _, c := range t.Columns {
+			if ValidateFieldName(c.Name) != nil {
+				return def, fmt.Errorf("Invalid column name in table '%s': '%s'", t.Name, c.Name)
+			}
+			if cols[strings.ToLower(c.Name)] {
+				return def, fmt.Errorf("Column '%s' is in table '%s' more than once", c.Name, t.Name)
+			}
+			if c.Type != "" && !schemaColumnType.MatchString(c.Type) {
+				return def, fmt.Errorf("Invalid type for column '%s' of table '%s': '%s'", c.Name, t.Name, c.Type)
+			}
+			if _, err = schemaDefault(c.Default); err != nil {
+				return def, fmt.Errorf("Invalid default value for column '%s' of table '%s'", c.Name, t.Name)
+			}
+			cols[strings.ToLower(c.Name)] = true
+		}
+		for _, k := range t.PrimaryKey {
+			if !cols[strings.ToLower(k)] {
+				return def, fmt.Errorf("Primary key column '%s' isn't a column of table '%s'", k, t.Name)
+			}
+		}
+		tables[strings.ToLower(t.Name)] = cols
+	}
+	for _, t := range def.Tables {
+		for _, c := range t.Columns {
+			if c.References == nil {
+				continue
+			}
+			refCols, ok := tables[strings.ToLower(c.References.Table)]
+			if !ok {
+				return def, fmt.Errorf("Column '%s' of table '%s' refers to table '%s', which isn't in the schema "+
+					"definition", c.Name, t.Name, c.References.Table)
+			}
+			if c.References.Column != "" && !refCols[strings.ToLower(c.References.Column)] {
+				return def, fmt.Errorf("Column '%s' of table '%s' refers to column '%s', which isn't in table '%s'",
+					c.Name, t.Name, c.References.Column, c.References.Table)
+			}
+		}
+	}
+	indexes := make(map[string]bool)
+	for _, i := range def.Indexes {
+		if ValidatePGTable(i.Name) != nil || strings.HasPrefix(strings.ToLower(i.Name), "sqlite_") {
+			return def, fmt.Errorf("Invalid index name: '%s'", i.Name)
+		}
+		if indexes[strings.ToLower(i.Name)] {
+			return def, fmt.Errorf("Index '%s' is in the schema definition more than once", i.Name)
+		}
+		cols, ok := tables[strings.ToLower(i.Table)]
+		if !ok {
+			return def, fmt.Errorf("Index '%s' is on table '%s', which isn't in the schema definition", i.Name, i.Table)
+		}
+		if len(i.Columns) == 0 {
+			return def, fmt.Errorf("Index '%s' needs to have at least one column", i.Name)
+		}
+		for _, c := range i.Columns {
+			if !cols[strings.ToLower(c)] {
+				return def, fmt.Errorf("Index '%s' column '%s' isn't a column of table '%s'", i.Name, c, i.Table)
+			}
+		}
+		indexes[strings.ToLower(i.Name)] = true
+	}
+	return def, nil
+}
+
+// CreateSchemaDatabase creates a new, empty, SQLite database holding the tables and indexes of a schema definition.
+// The caller needs to remove the returned temporary file when finished with it
+func CreateSchemaDatabase(def SchemaDefinition) (tempDB *os.File, err error) {
+	tempDB, err = os.CreateTemp(config.Conf.DiskCache.Directory, "dbhub-schema-*.db")
+	if err != nil {
+		return
+	}
+	err = func() (err error) {
+		sdb, err := sqlite.Open(tempDB.Name(), sqlite.OpenReadWrite|sqlite.OpenCreate)
+		if err != nil {
+			return
+		}
+		defer sdb.Close()
+		if err = sdb.EnableExtendedResultCodes(true); err != nil {
+			return
+		}
+		if err = sdb.Begin(); err != nil {
+			return
+		}
+		for _, sql := range SchemaStatements(def) {
+			err = sdb.Exec(sql)
+			if err != nil {
+				sdb.Rollback()
+				return err
+			}
+		}
+		return sdb.Commit()
+	}()
+	if err != nil {
+		tempDB.Close()
+		os.Remove(tempDB.Name())
+		return nil, err
+	}
+	return
+}
+
+// SchemaStatements returns the SQL statements creating the tables and indexes of a schema definition, in the order
+// they need running.  The definition needs to have been checked by ParseSchemaDefinition() first
+func SchemaStatements(def SchemaDefinition) (statements []string) {
+	for _, t := range def.Tables {
+		var cols []string
+		for _, c := range t.Columns {
+			col := EscapeId(c.Name)
+			if c.Type != "" {
+				col += " " + strings.ToUpper(c.Type)
+			}
+			if c.PrimaryKey {
+				col += " PRIMARY KEY"
+				if c.AutoIncrement {
+					col += " AUTOINCREMENT"
+				}
+			}
+			if c.NotNull {
+				col += " NOT NULL"
+			}
+			if c.Unique {
+				col += " UNIQUE"
+			}
+			if val, _ := schemaDefault(c.Default); val != "" {
+				col += " DEFAULT " + val
+			}
+			if c.References != nil {
+				col += " REFERENCES " + EscapeId(c.References.Table)
+				if c.References.Column != "" {
+					col += "(" + EscapeId(c.References.Column) + ")"
+				}
+			}
+			cols = append(cols, col)
+		}
+		if len(t.PrimaryKey) > 0 {
+			cols = append(cols, "PRIMARY KEY("+strings.Join(EscapeIds(t.PrimaryKey), ", ")+")")
+		}
+		sql := "CREATE TABLE " + EscapeId(t.Name) + " (" + strings.Join(cols, ", ") + ")"
+		if t.WithoutRowID {
+			sql += " WITHOUT ROWID"
+		}
+		statements = append(statements, sql)
+	}
+	for _, i := range def.Indexes {
+		sql := "CREATE INDEX "
+		if i.Unique {
+			sql = "CREATE UNIQUE INDEX "
+		}
+		sql += EscapeId(i.Name) + " ON " + EscapeId(i.Table) + " (" + strings.Join(EscapeIds(i.Columns), ", ") + ")"
+		statements = append(statements, sql)
+	}
+	return
+}
+
+// schemaDefault turns the JSON default value of a column into an SQL literal.  Strings, numbers, booleans, and null
+// are accepted.  An empty string is returned when the column doesn't have a default value
+func schemaDefault(raw json.RawMessage) (literal string, err error) {
+	if len(raw) == 0 {
+		return "", nil
+	}
+	d := json.NewDecoder(strings.NewReader(string(raw)))
+	d.UseNumber()
+	var v interface{}
+	if err = d.Decode(&v); err != nil {
+		return
+	}
+	switch val := v.(type) {
+	case nil:
+		return "NULL", nil
+	case bool:
+		if val {
+			return "1", nil
+		}
+		return "0", nil
+	case json.Number:
+		if _, err = val.Float64(); err != nil {
+			return
+		}
+		return val.String(), nil
+	case string:
+		return sqlite.Mprintf("%Q", val), nil
+	}
+	return "", errors.New("Unsupported default value")
+}
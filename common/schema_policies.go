@@ -0,0 +1,143 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// SchemaPolicies are the schema change policies a branch can have.  Branches without one accept any schema change
+var SchemaPolicies = []string{database.SchemaPolicyBlock, database.SchemaPolicyApproval}
+
+// SchemaPolicyError is returned when a new commit changes the schema of a branch whose schema change policy doesn't
+// allow that
+type SchemaPolicyError struct {
+	Message string
+}
+
+func (e SchemaPolicyError) Error() string {
+	return e.Message
+}
+
+// SchemaChanged returns whether the schema of the database file dbB differs from that of the database file dbA, by
+// comparing the definitions of their tables, indexes, views, and triggers
+func SchemaChanged(dbA, dbB string) (changed bool, err error) {
+	sdb, err := openDiffDatabases(dbA, dbB)
+	if err != nil {
+		return
+	}
+	defer sdb.Close()
+	return sdb.Exists(`
+		SELECT * FROM (
+			SELECT type, name, tbl_name, sql FROM main.sqlite_master WHERE name NOT LIKE 'sqlite_%'
+			EXCEPT
+			SELECT type, name, tbl_name, sql FROM aux.sqlite_master WHERE name NOT LIKE 'sqlite_%'
+		)
+		UNION ALL
+		SELECT * FROM (
+			SELECT type, name, tbl_name, sql FROM aux.sqlite_master WHERE name NOT LIKE 'sqlite_%'
+			EXCEPT
+			SELECT type, name, tbl_name, sql FROM main.sqlite_master WHERE name NOT LIKE 'sqlite_%'
+		)`)
+}
+
+// SchemaPolicyCheck returns an error when a new commit of a branch changes the schema of the database file at its parent
+// commit, and the schema change policy of the branch doesn't allow that.  Schema changes to branches with the
+// "approval" policy need to come from an approved merge request, so commits made any other way can't change the schema
+func SchemaPolicyCheck(dbOwner, dbName, branchName, parentCommit, newDB string) error {
+	policy, err := database.BranchSchemaPolicy(dbOwner, dbName, branchName)
+	if err != nil || policy == "" {
+		return err
+	}
+	changed, err := commitSchemaChanged(dbOwner, dbName, parentCommit, newDB)
+	if err != nil || !changed {
+		return err
+	}
+	if policy == database.SchemaPolicyApproval {
+		return SchemaPolicyError{Message: fmt.Sprintf("Schema changes to branch '%s' need to be made through an "+
+			"approved merge request", branchName)}
+	}
+	return SchemaPolicyError{Message: fmt.Sprintf("Branch '%s' doesn't accept schema changes, only changes to the data",
+		branchName)}
+}
+
+// commitSchemaChanged returns whether the schema of a database file differs from that of a commit of a database
+func commitSchemaChanged(dbOwner, dbName, commitID, newDB string) (changed bool, err error) {
+	bucket, id, err := SQLiteLocation(dbOwner, dbName, commitID, dbOwner)
+	if err != nil {
+		return
+	}
+	if id == "" {
+		return false, errors.New("Requested database not found")
+	}
+	dbPath, err := RetrieveDatabaseFile(bucket, id)
+	if err != nil {
+		return
+	}
+	return SchemaChanged(dbPath, newDB)
+}
+
+// mergeRequestDatabases retrieves the database files at the head commit of the destination branch of a merge request,
+// and at the head commit of the merge request
+func mergeRequestDatabases(destOwner, destName string, mr database.MergeRequestEntry) (dest, head string, err error) {
+	branches, err := database.GetBranches(destOwner, destName)
+	if err != nil {
+		return
+	}
+	branch, ok := branches[mr.DestBranch]
+	if !ok {
+		return "", "", fmt.Errorf("Could not retrieve details for the destination branch")
+	}
+	bucket, id, err := SQLiteLocation(destOwner, destName, branch.Commit, destOwner)
+	if err != nil {
+		return
+	}
+	if id == "" {
+		return "", "", errors.New("Requested database not found")
+	}
+	dest, err = RetrieveDatabaseFile(bucket, id)
+	if err != nil {
+		return
+	}
+	bucket, id, err = SQLiteLocation(mr.SourceOwner, mr.SourceDBName, mr.Commits[0].ID, mr.SourceOwner)
+	if err != nil {
+		return
+	}
+	head, err = RetrieveDatabaseFile(bucket, id)
+	return
+}
+
+// mergeRequestSchemaPolicy returns why a merge request can't be merged under the schema change policy of its
+// destination branch, or an empty string when it can be
+func mergeRequestSchemaPolicy(destOwner, destName string, discID int, mr database.MergeRequestEntry) (blocked string, err error) {
+	policy, err := database.BranchSchemaPolicy(destOwner, destName, mr.DestBranch)
+	if err != nil || policy == "" {
+		return
+	}
+
+	// Compare the head commit of the merge request with the head commit of the destination branch
+	dest, head, err := mergeRequestDatabases(destOwner, destName, mr)
+	if errors.Is(err, ErrClientEncrypted) {
+		// The server can't read databases encrypted by their owner, so their schema can't be checked
+		return "", nil
+	}
+	if err != nil {
+		return
+	}
+	changed, err := SchemaChanged(dest, head)
+	if err != nil || !changed {
+		return
+	}
+
+	if policy == database.SchemaPolicyBlock {
+		return fmt.Sprintf("The merge request changes the schema, which branch '%s' doesn't accept", mr.DestBranch),
+			nil
+	}
+	reviews, err := database.MergeRequestReviews(destOwner, destName, discID)
+	if err != nil || headApprovals(reviews, mr.Commits[0].ID) > 0 {
+		return
+	}
+	return fmt.Sprintf("The merge request changes the schema, so it needs to be approved before merging into "+
+		"branch '%s'", mr.DestBranch), nil
+}
@@ -0,0 +1,26 @@
+package common
+
+import (
+	"strings"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+)
+
+// SignupNeedsInvitation returns whether a new user with the given email address needs an invitation to sign up.  That's
+// the case when signups are closed, unless the email address is in one of the allowed domains
+func SignupNeedsInvitation(email string) bool {
+	if !config.Conf.Signup.Closed {
+		return false
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return true
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, d := range config.Conf.Signup.AllowedDomains {
+		if domain == strings.ToLower(strings.TrimPrefix(strings.TrimSpace(d), "@")) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// ErrBranchNotFound is returned when asking for the size history of a branch which doesn't exist
+var ErrBranchNotFound = errors.New("That branch doesn't exist in the database")
+
+// SizeEntry is the size of the database file of one commit
+type SizeEntry struct {
+	Commit    string    `json:"commit"`
+	Size      int64     `json:"size"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// BranchSizeHistory returns the size of the database file for each commit of a branch, oldest first.  Commits merged
+// into the branch from other branches aren't included, only the ones which were its head at some point.  When no
+// branch name is given, the default branch is used
+func BranchSizeHistory(dbOwner, dbName, branch string) (history []SizeEntry, err error) {
+	if branch == "" {
+		branch, err = database.GetDefaultBranchName(dbOwner, dbName)
+		if err != nil {
+			return
+		}
+	}
+	branches, err := database.GetBranches(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	b, ok := branches[branch]
+	if !ok {
+		return nil, ErrBranchNotFound
+	}
+	commitList, err := database.GetCommitList(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+
+	history = []SizeEntry{}
+	for commitID := b.Commit; commitID != ""; {
+		c, ok := commitList[commitID]
+		if !ok {
+			return nil, fmt.Errorf("Commit '%s' is missing from the commit list", commitID)
+		}
+		history = append(history, SizeEntry{Commit: c.ID, Size: c.Tree.Entries[0].Size, Timestamp: c.Timestamp})
+		commitID = c.Parent
+	}
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+	return
+}
+
+// sizeGrowthCheck emails the owner of a database when a new commit has grown it by more than its size alert allows.
+// Problems are only logged, as they shouldn't stop the commit from being added
+func sizeGrowthCheck(dbOwner, dbName, branchName string, c database.CommitEntry) {
+	if c.Parent == "" {
+		return
+	}
+	alert, err := database.SizeAlertFor(dbOwner, dbName)
+	if err != nil || (alert.GrowthBytes == 0 && alert.GrowthPercent == 0) {
+		return
+	}
+	commitList, err := database.GetCommitList(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	parent, ok := commitList[c.Parent]
+	if !ok {
+		return
+	}
+	oldSize := parent.Tree.Entries[0].Size
+	newSize := c.Tree.Entries[0].Size
+	growth := newSize - oldSize
+	if growth <= 0 {
+		return
+	}
+	overBytes := alert.GrowthBytes > 0 && growth > alert.GrowthBytes
+	overPercent := alert.GrowthPercent > 0 && oldSize > 0 && growth*100 > oldSize*int64(alert.GrowthPercent)
+	if !overBytes && !overPercent {
+		return
+	}
+
+	subj := fmt.Sprintf("DBHub.io: %s/%s has grown by %d bytes", dbOwner, dbName, growth)
+	msg := fmt.Sprintf("The latest commit to branch '%s' of your database '%s/%s' has grown it from %d bytes to %d "+
+		"bytes, which is more than its size alert allows.\n\nThe commit is:\n\n  https://%s/%s/%s?branch=%s&commit=%s"+
+		"\n\nThe size alert can be changed using the sizealertset API call.", branchName, dbOwner, dbName, oldSize,
+		newSize, config.Conf.Web.ServerName, url.PathEscape(dbOwner), url.PathEscape(dbName),
+		url.QueryEscape(branchName), c.ID)
+	if err = database.SizeAlertSend(dbOwner, subj, msg); err != nil {
+		log.Printf("Sending the size alert for '%s/%s' failed: %v", dbOwner, SanitiseLogString(dbName), err)
+	}
+}
@@ -0,0 +1,270 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+var (
+	// spamCheckers are the extra spam filters added with AddSpamChecker, which are run after the built in ones
+	spamCheckers []SpamChecker
+
+	// HTTP client used for the Akismet API
+	spamHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+	// spamLinks matches the web addresses in posts, including those in Markdown links
+	spamLinks = regexp.MustCompile(`(?i)\b(https?://|www\.)`)
+)
+
+// SpamContent is a new discussion, comment, or database description to be checked by the spam filters
+type SpamContent struct {
+	Author    string
+	Body      string
+	IP        string
+	Kind      string // Either "comment", "description", or "discussion"
+	Permalink string
+	UserAgent string
+}
+
+// SpamChecker is implemented by each of the spam filters.  Check returns whether the content is spam, along with a short
+// reason for the instance admins
+type SpamChecker interface {
+	Check(c SpamContent) (spam bool, reason string, err error)
+}
+
+// SpamFeedback is implemented by spam filters which learn from what the instance admins decide about held content
+type SpamFeedback interface {
+	Feedback(c SpamContent, spam bool) error
+}
+
+// AddSpamChecker adds a spam filter, which is run on new content after the built in ones
+func AddSpamChecker(checker SpamChecker) {
+	spamCheckers = append(spamCheckers, checker)
+}
+
+// CheckSpam runs content through the spam filters, returning whether any of them flagged it and why.  Filters which
+// fail are skipped, so problems with external services don't stop people posting
+func CheckSpam(c SpamContent) (spam bool, reason string) {
+	for _, checker := range spamFilters() {
+		s, r, err := checker.Check(c)
+		if err != nil {
+			log.Printf("Spam check of a %s by '%s' failed: %v", c.Kind, SanitiseLogString(c.Author), err)
+			continue
+		}
+		if s {
+			return true, r
+		}
+	}
+	return false, ""
+}
+
+// HoldIfSpam runs a new discussion, comment, or database description through the spam filters, holding it for
+// moderation when it's flagged.  The returned boolean is true when the content was held, so it shouldn't be published
+func HoldIfSpam(r *http.Request, h database.HeldContent) (held bool, err error) {
+	h.IP, _, err = net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		h.IP = r.RemoteAddr
+	}
+	h.UserAgent = r.UserAgent()
+
+	spam, reason := CheckSpam(heldSpamContent(h))
+	if !spam {
+		return false, nil
+	}
+	h.Reason = reason
+	_, err = database.HeldContentAdd(h)
+	if err != nil {
+		return
+	}
+	log.Printf("Held a %s by '%s' on database '%s/%s' for moderation: %s", h.Kind, SanitiseLogString(h.User),
+		SanitiseLogString(h.DBOwner), SanitiseLogString(h.DBName), reason)
+	return true, nil
+}
+
+// PublishHeldContent publishes content which was held for moderation, as if it had been posted just now, then removes
+// it from the moderation queue
+func PublishHeldContent(h database.HeldContent) (err error) {
+	switch h.Kind {
+	case "comment":
+		err = database.StoreComment(h.DBOwner, h.DBName, h.User, h.DiscID, h.Body, false, database.CLOSED_WITHOUT_MERGE)
+	case "description":
+		err = database.SetDBDescriptions(h.DBOwner, h.DBName, h.OneLineDesc, h.Body)
+	case "discussion":
+		var discID int
+		discID, err = database.StoreDiscussion(h.DBOwner, h.DBName, h.User, h.Title, h.Body, database.DISCUSSION,
+			database.MergeRequestEntry{})
+		if err != nil {
+			return
+		}
+		details := database.EventDetails{
+			DBName:   h.DBName,
+			DiscID:   discID,
+			Owner:    h.DBOwner,
+			Title:    h.Title,
+			Type:     database.EVENT_NEW_DISCUSSION,
+			URL:      fmt.Sprintf("/discuss/%s/%s?id=%d", url.PathEscape(h.DBOwner), url.PathEscape(h.DBName), discID),
+			UserName: h.User,
+		}
+		err = database.NewEvent(details)
+		if err == nil {
+			err = database.NewMentionEvents(details, h.Body)
+		}
+	default:
+		err = fmt.Errorf("Unknown kind of held content '%s'", h.Kind)
+	}
+	if err != nil {
+		return
+	}
+
+	// The discussion counts and descriptions are cached with the database details
+	err = InvalidateCacheEntry(h.DBOwner, h.DBOwner, h.DBName, "")
+	if err != nil {
+		return
+	}
+	return database.HeldContentDelete(h.HeldID)
+}
+
+// SpamDecision passes what the instance admins decided about held content back to the spam filters which learn from
+// it
+func SpamDecision(h database.HeldContent, spam bool) {
+	c := heldSpamContent(h)
+	for _, checker := range spamFilters() {
+		if f, ok := checker.(SpamFeedback); ok {
+			err := f.Feedback(c, spam)
+			if err != nil {
+				log.Printf("Sending spam feedback about held content %d failed: %v", h.HeldID, err)
+			}
+		}
+	}
+}
+
+// heldSpamContent returns the details of held content the spam filters check
+func heldSpamContent(h database.HeldContent) SpamContent {
+	c := SpamContent{
+		Author:    h.User,
+		Body:      h.Body,
+		IP:        h.IP,
+		Kind:      h.Kind,
+		Permalink: fmt.Sprintf("https://%s/%s/%s", config.Conf.Web.ServerName, url.PathEscape(h.DBOwner), url.PathEscape(h.DBName)),
+		UserAgent: h.UserAgent,
+	}
+	switch h.Kind {
+	case "comment":
+		c.Permalink = fmt.Sprintf("https://%s/discuss/%s/%s?id=%d", config.Conf.Web.ServerName,
+			url.PathEscape(h.DBOwner), url.PathEscape(h.DBName), h.DiscID)
+	case "description":
+		c.Body = strings.TrimSpace(h.OneLineDesc + "\n\n" + h.Body)
+	case "discussion":
+		c.Body = h.Title + "\n\n" + h.Body
+	}
+	return c
+}
+
+// spamFilters returns the spam filters in use.  The heuristics are always run, Akismet is run when an API key for it
+// has been configured, then any filters added with AddSpamChecker
+func spamFilters() (list []SpamChecker) {
+	list = append(list, spamHeuristics{})
+	if config.Conf.Spam.AkismetKey != "" {
+		list = append(list, akismetChecker{})
+	}
+	return append(list, spamCheckers...)
+}
+
+// spamHeuristics flags posts with lots of links, and users posting a lot of discussions and comments in a short time
+type spamHeuristics struct{}
+
+func (spamHeuristics) Check(c SpamContent) (spam bool, reason string, err error) {
+	if limit := config.Conf.Spam.MaxLinks; limit >= 0 && len(spamLinks.FindAllStringIndex(c.Body, -1)) > limit {
+		return true, fmt.Sprintf("More than %d links", limit), nil
+	}
+	if limit := config.Conf.Spam.MaxPostsPerHour; limit >= 0 && c.Kind != "description" {
+		var count int
+		count, err = database.RecentPostCount(c.Author)
+		if err != nil {
+			return
+		}
+		if count >= limit {
+			return true, fmt.Sprintf("More than %d posts in an hour", limit), nil
+		}
+	}
+	return
+}
+
+// akismetChecker checks posts using the Akismet API, and reports the decisions of the instance admins back to it
+type akismetChecker struct{}
+
+func (akismetChecker) Check(c SpamContent) (spam bool, reason string, err error) {
+	result, err := akismetRequest("comment-check", c)
+	if err != nil {
+		return
+	}
+	switch result {
+	case "true":
+		return true, "Flagged by Akismet", nil
+	case "false":
+		return false, "", nil
+	}
+	return false, "", fmt.Errorf("Unexpected response from Akismet: %s", result)
+}
+
+func (akismetChecker) Feedback(c SpamContent, spam bool) (err error) {
+	endpoint := "submit-ham"
+	if spam {
+		endpoint = "submit-spam"
+	}
+	_, err = akismetRequest(endpoint, c)
+	return
+}
+
+// akismetRequest calls one of the Akismet API endpoints about some content, returning the body of the response
+func akismetRequest(endpoint string, c SpamContent) (result string, err error) {
+	// Akismet uses different names for the kinds of content
+	commentType := "comment"
+	switch c.Kind {
+	case "description":
+		commentType = "blog-post"
+	case "discussion":
+		commentType = "forum-post"
+	}
+	form := url.Values{
+		"api_key":         {config.Conf.Spam.AkismetKey},
+		"blog":            {"https://" + config.Conf.Web.ServerName},
+		"comment_author":  {c.Author},
+		"comment_content": {c.Body},
+		"comment_type":    {commentType},
+		"permalink":       {c.Permalink},
+		"user_agent":      {c.UserAgent},
+		"user_ip":         {c.IP},
+	}
+	if usr, err := database.User(c.Author); err == nil {
+		form.Set("comment_author_email", usr.Email)
+	}
+
+	resp, err := spamHTTPClient.PostForm(strings.TrimSuffix(config.Conf.Spam.AkismetURL, "/")+"/"+endpoint, form)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Akismet returned status %d: %s", resp.StatusCode, body)
+	}
+	result = strings.TrimSpace(string(body))
+	if help := resp.Header.Get("X-akismet-debug-help"); help != "" {
+		result += " (" + help + ")"
+	}
+	return
+}
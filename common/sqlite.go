@@ -102,23 +102,27 @@ const (
 	fnNthValue    function = "nth_value"
 
 	// JSON1 functions: https://sqlite.org/json1.html
-	fnJson            function = "json"
-	fnJsonArray       function = "json_array"
-	fnJsonArrayLength function = "json_array_length"
-	fnJsonExtract     function = "json_extract"
-	fnJsonInsert      function = "json_insert"
-	fnJsonObject      function = "json_object"
-	fnJsonPatch       function = "json_patch"
-	fnJsonRemove      function = "json_remove"
-	fnJsonReplace     function = "json_replace"
-	fnJsonSet         function = "json_set"
-	fnJsonType        function = "json_type"
-	fnJsonValid       function = "json_valid"
-	fnJsonQuote       function = "json_quote"
-	fnJsonGroupArray  function = "json_group_array"
-	fnJsonGroupObject function = "json_group_object"
-	fnJsonEach        function = "json_each"
-	fnJsonTree        function = "json_tree"
+	fnJson              function = "json"
+	fnJsonArray         function = "json_array"
+	fnJsonArrayLength   function = "json_array_length"
+	fnJsonExtract       function = "json_extract"
+	fnJsonInsert        function = "json_insert"
+	fnJsonObject        function = "json_object"
+	fnJsonPatch         function = "json_patch"
+	fnJsonRemove        function = "json_remove"
+	fnJsonReplace       function = "json_replace"
+	fnJsonSet           function = "json_set"
+	fnJsonType          function = "json_type"
+	fnJsonValid         function = "json_valid"
+	fnJsonQuote         function = "json_quote"
+	fnJsonGroupArray    function = "json_group_array"
+	fnJsonGroupObject   function = "json_group_object"
+	fnJsonEach          function = "json_each"
+	fnJsonTree          function = "json_tree"
+	fnJsonErrorPosition function = "json_error_position"
+	fnJsonPretty        function = "json_pretty"
+	fnJsonArrow         function = "->"
+	fnJsonArrowText     function = "->>"
 
 	// FTS3 & FTS4 functions: https://www.sqlite.org/fts3.html
 	fnFts3         function = "fts3"
@@ -274,6 +278,10 @@ var SQLiteFunctions = []function{
 	fnJsonGroupObject,
 	fnJsonEach,
 	fnJsonTree,
+	fnJsonErrorPosition,
+	fnJsonPretty,
+	fnJsonArrow,
+	fnJsonArrowText,
 	fnFts3,
 	fnFts3Tokenize,
 	fnFts4,
@@ -375,6 +383,17 @@ func AuthorizerLive(d interface{}, action sqlite.Action, tableName, funcName, db
 			// Extension loading is disabled (at least for now)
 			return sqlite.AuthDeny
 		}
+
+		// Functions of the extensions which aren't allowed on this instance
+		if sqliteExtensionDenied(funcName) {
+			return sqlite.AuthDeny
+		}
+	case sqlite.CreateVTable:
+		// Virtual table modules of the extensions which aren't allowed.  The module name is given in place of the
+		// function name
+		if sqliteExtensionDenied(funcName) {
+			return sqlite.AuthDeny
+		}
 	}
 
 	// All other action types, functions, etc are allowed
@@ -404,8 +423,13 @@ func AuthorizerSelect(d interface{}, action sqlite.Action, tableName, funcName,
 				knownFunction = true
 			}
 		}
-		if knownFunction {
-			// Only known functions are allowed
+		if knownFunction && !sqliteExtensionDenied(funcName) {
+			// Only known functions are allowed, apart from those of the extensions which aren't allowed on this instance
+			return sqlite.AuthOk
+		}
+
+		// Some functions of the allowed loadable extensions are allowed too
+		if sqliteExtensionReadOnly(funcName) {
 			return sqlite.AuthOk
 		}
 	case sqlite.Update:
@@ -460,7 +484,12 @@ func OpenSQLiteDatabase(bucket, id string) (sdb *sqlite.Conn, err error) {
 func OpenSQLiteDatabaseDefensive(w http.ResponseWriter, r *http.Request, dbOwner, dbName, commitID, loggedInUser string) (sdb *sqlite.Conn, err error) {
 	// Check if the user has access to the requested database
 	var bucket, id string
-	bucket, id, _, err = MinioLocation(dbOwner, dbName, commitID, loggedInUser)
+	bucket, id, err = SQLiteLocation(dbOwner, dbName, commitID, loggedInUser)
+	if errors.Is(err, ErrClientEncrypted) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "%s", err.Error())
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -627,6 +656,14 @@ func OpenSQLiteDatabaseDefensive(w http.ResponseWriter, r *http.Request, dbOwner
 		return
 	}
 
+	// Load the extensions allowed on this instance
+	err = loadSQLiteExtensions(sdb)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "%s", err.Error())
+		return nil, err
+	}
+
 	// Set a SQLite authorizer which only allows SELECT statements to run
 	err = sdb.SetAuthorizer(AuthorizerSelect, "SELECT authorizer")
 	if err != nil {
@@ -659,6 +696,13 @@ func OpenSQLiteDatabaseDefensive(w http.ResponseWriter, r *http.Request, dbOwner
 // TODO: De-duplicate/refactor the common code in this function and OpenSQLiteDatabaseDefensive() above, as they're
 // TODO  mostly the same
 func OpenSQLiteDatabaseLive(baseDir, dbOwner, dbName string) (sdb *sqlite.Conn, err error) {
+	return openSQLiteDatabaseLive(baseDir, dbOwner, dbName, false)
+}
+
+// openSQLiteDatabaseLive opens a live SQLite database with the defensive precautions, either read only or read-write.
+// Read-write connections also switch the database to WAL mode, so connections reading it don't block the one writing
+// to it, nor the other way around
+func openSQLiteDatabaseLive(baseDir, dbOwner, dbName string, readOnly bool) (sdb *sqlite.Conn, err error) {
 	dbPath := filepath.Join(baseDir, dbOwner, dbName, "live.sqlite")
 	if _, err = os.Stat(dbPath); err != nil {
 		return
@@ -667,7 +711,11 @@ func OpenSQLiteDatabaseLive(baseDir, dbOwner, dbName string) (sdb *sqlite.Conn,
 	// Open database
 	// NOTE - OpenFullMutex seems like the right thing for ensuring multiple connections to a database file don't
 	// screw things up, but it wouldn't be a bad idea to keep it in mind if weirdness shows up
-	sdb, err = sqlite.Open(dbPath, sqlite.OpenReadWrite|sqlite.OpenFullMutex)
+	flags := sqlite.OpenReadWrite | sqlite.OpenFullMutex
+	if readOnly {
+		flags = sqlite.OpenReadOnly | sqlite.OpenFullMutex
+	}
+	sdb, err = sqlite.Open(dbPath, flags)
 	if err != nil {
 		log.Printf("Couldn't open LIVE database: %s", err)
 		return
@@ -677,6 +725,12 @@ func OpenSQLiteDatabaseLive(baseDir, dbOwner, dbName string) (sdb *sqlite.Conn,
 		return
 	}
 
+	// Wait a while for other connections to the database to finish with their locks, rather than failing straight away
+	if err = sdb.BusyTimeout(liveBusyTimeout); err != nil {
+		log.Printf("Couldn't set the busy timeout for LIVE database query: %v", err)
+		return
+	}
+
 	// Enable the defensive flag
 	var enabled bool
 	if enabled, err = sdb.EnableDefensive(true); !enabled || err != nil {
@@ -797,7 +851,28 @@ func OpenSQLiteDatabaseLive(baseDir, dbOwner, dbName string) (sdb *sqlite.Conn,
 		return
 	}
 
-	// Set a SQLite authorizer which only disallows pragma statements and the "load_extension" function
+	// Use WAL mode for the database.  This is kept in the database file, so read only connections use it too
+	if !readOnly {
+		var mode string
+		err = sdb.OneValue("PRAGMA journal_mode=WAL", &mode)
+		if err != nil {
+			log.Printf("Error when switching the LIVE database to WAL mode: %s", err)
+			return
+		}
+		if mode != "wal" {
+			err = fmt.Errorf("The LIVE database couldn't be switched to WAL mode.  Journal mode is '%s'", mode)
+			return
+		}
+	}
+
+	// Load the extensions allowed on this instance
+	err = loadSQLiteExtensions(sdb)
+	if err != nil {
+		return
+	}
+
+	// Set a SQLite authorizer which only disallows pragma statements, the "load_extension" function, and the extensions
+	// which aren't allowed
 	err = sdb.SetAuthorizer(AuthorizerLive, "SELECT authorizer")
 	if err != nil {
 		return
@@ -1114,6 +1189,11 @@ func SQLiteBackupLive(baseDir, dbOwner, dbName string) (err error) {
 
 // SQLiteExecuteQueryLive is used by our job queue backend infrastructure to execute a user provided SQLite statement
 func SQLiteExecuteQueryLive(baseDir, dbOwner, dbName, loggedInUser, query string) (rowsChanged int, err error) {
+	// Changes can't be made while a transaction is open on the database
+	if err = liveTransactionCheck(dbOwner, dbName); err != nil {
+		return
+	}
+
 	// Open the Live database on the local node
 	var sdb *sqlite.Conn
 	sdb, err = OpenSQLiteDatabaseLive(baseDir, dbOwner, dbName)
@@ -1122,11 +1202,10 @@ func SQLiteExecuteQueryLive(baseDir, dbOwner, dbName, loggedInUser, query string
 	}
 	defer sdb.Close()
 
-	// TODO: Probably add in the before and after logging info at some point (as per query function),
-	//       so we can analyse query execution times, memory use, etc
-
-	// Execute the statement
-	rowsChanged, err = sdb.ExecDml(query)
+	// Execute the statement, within the limits for the user
+	rowsChanged, err = executeLimited(sdb, dbOwner, dbName, loggedInUser, query, func() (int, error) {
+		return sdb.ExecDml(query)
+	})
 	if err != nil {
 		if !strings.HasPrefix(err.Error(), "don't use exec with") {
 			log.Printf("Error when executing query by '%s' for LIVE database (%s/%s): '%s'",
@@ -1142,11 +1221,12 @@ func SQLiteExecuteQueryLive(baseDir, dbOwner, dbName, loggedInUser, query string
 func SQLiteGetColumnsLive(baseDir, dbOwner, dbName, table string) (columns []sqlite.Column, pk []string, err error, errCode JobQueueErrorCode) {
 	// Open the database on the local node
 	var sdb *sqlite.Conn
-	sdb, err = OpenSQLiteDatabaseLive(baseDir, dbOwner, dbName)
+	var release func()
+	sdb, release, err = liveReadConn(baseDir, dbOwner, dbName)
 	if err != nil {
 		return
 	}
-	defer sdb.Close()
+	defer release()
 
 	// Verify the requested table or view we're about to query does exist
 	var tablesViews []string
@@ -1182,11 +1262,12 @@ func SQLiteGetColumnsLive(baseDir, dbOwner, dbName, table string) (columns []sql
 func SQLiteGetIndexesLive(baseDir, dbOwner, dbName string) (indexes []APIJSONIndex, err error) {
 	// Open the database on the local node
 	var sdb *sqlite.Conn
-	sdb, err = OpenSQLiteDatabaseLive(baseDir, dbOwner, dbName)
+	var release func()
+	sdb, release, err = liveReadConn(baseDir, dbOwner, dbName)
 	if err != nil {
 		return
 	}
-	defer sdb.Close()
+	defer release()
 
 	// Retrieve the list of indexes
 	var idx map[string]string
@@ -1222,11 +1303,12 @@ func SQLiteGetIndexesLive(baseDir, dbOwner, dbName string) (indexes []APIJSONInd
 func SQLiteGetTablesLive(baseDir, dbOwner, dbName string) (tables []string, err error) {
 	// Open the database on the local node
 	var sdb *sqlite.Conn
-	sdb, err = OpenSQLiteDatabaseLive(baseDir, dbOwner, dbName)
+	var release func()
+	sdb, release, err = liveReadConn(baseDir, dbOwner, dbName)
 	if err != nil {
 		return
 	}
-	defer sdb.Close()
+	defer release()
 
 	// Retrieve the list of tables
 	tables, err = Tables(sdb)
@@ -1240,11 +1322,12 @@ func SQLiteGetTablesLive(baseDir, dbOwner, dbName string) (tables []string, err
 func SQLiteGetViewsLive(baseDir, dbOwner, dbName string) (views []string, err error) {
 	// Open the database on the local node
 	var sdb *sqlite.Conn
-	sdb, err = OpenSQLiteDatabaseLive(baseDir, dbOwner, dbName)
+	var release func()
+	sdb, release, err = liveReadConn(baseDir, dbOwner, dbName)
 	if err != nil {
 		return
 	}
-	defer sdb.Close()
+	defer release()
 
 	// Retrieve the list of views
 	views, err = Views(sdb)
@@ -1327,28 +1410,28 @@ func SQLiteSanityCheck(fileName string) (tables []string, err error) {
 func SQLiteReadDatabasePage(bucket, id, loggedInUser, dbOwner, dbName, dbTable, sortCol, sortDir, commitID string, rowOffset, maxRows int, isLive bool) (tables []string, defaultTable string, rowData SQLiteRecordSet, dbSize int64, err error) {
 	// Get a handle from Minio for the database object
 	var sdb *sqlite.Conn
+	var release func()
 	if isLive {
-		// Open live database file
-		sdb, err = OpenSQLiteDatabaseLive(config.Conf.Live.StorageDir, dbOwner, dbName)
+		// We also return the file size for live database files
+		dbSize, err = liveDatabaseSize(config.Conf.Live.StorageDir, dbOwner, dbName)
 		if err != nil {
 			return
 		}
 
-		// We also return the file size for live database files
-		var z os.FileInfo
-		z, err = os.Stat(filepath.Join(config.Conf.Live.StorageDir, dbOwner, dbName, "live.sqlite"))
+		// Open live database file
+		sdb, release, err = liveReadConn(config.Conf.Live.StorageDir, dbOwner, dbName)
 		if err != nil {
 			return
 		}
-		dbSize = z.Size()
 	} else {
 		// Open standard database
 		sdb, err = OpenSQLiteDatabase(bucket, id)
 		if err != nil {
 			return
 		}
+		release = func() { sdb.Close() }
 	}
-	defer sdb.Close()
+	defer release()
 
 	// Retrieve the list of tables and views in the database
 	tables, err = TablesAndViews(sdb, dbName)
@@ -1431,7 +1514,7 @@ func SQLiteReadDatabasePage(bucket, id, loggedInUser, dbOwner, dbName, dbTable,
 	if !isLive {
 		rowCacheKey := TableRowsCacheKey(fmt.Sprintf("tablejson/%s/%s/%d", sortCol, sortDir, rowOffset),
 			loggedInUser, dbOwner, dbName, commitID, dbTable, maxRows)
-		okCache, err = GetCachedData(rowCacheKey, &rowData)
+		okCache, err = GetCachedData(rowCacheKey, &rowData, DatabaseCacheTags(dbOwner, dbName, commitID)...)
 		if err != nil {
 			log.Printf("Error retrieving page data from cache: %v", err)
 		}
@@ -1452,6 +1535,12 @@ func SQLiteReadDatabasePage(bucket, id, loggedInUser, dbOwner, dbName, dbTable,
 // SQLiteRunQuery runs a SQLite query.  DO NOT use this for user provided SQL queries.  For those,
 // use SQLiteRunQueryDefensive().
 func SQLiteRunQuery(sdb *sqlite.Conn, querySource QuerySource, dbQuery string, ignoreBinary, ignoreNull bool) (memUsed, memHighWater int64, dataRows SQLiteRecordSet, err error) {
+	return sqliteRunQuery(sdb, querySource, dbQuery, nil, nil, ignoreBinary, ignoreNull)
+}
+
+// sqliteRunQuery runs a SQLite query, binding parameter values to it when params isn't nil, and stopping it when it
+// goes over the limits of limiter when that isn't nil
+func sqliteRunQuery(sdb *sqlite.Conn, querySource QuerySource, dbQuery string, params *QueryParams, limiter *queryLimiter, ignoreBinary, ignoreNull bool) (memUsed, memHighWater int64, dataRows SQLiteRecordSet, err error) {
 	// Use the sort column as needed
 	var stmt *sqlite.Stmt
 	stmt, err = sdb.Prepare(dbQuery)
@@ -1460,6 +1549,14 @@ func SQLiteRunQuery(sdb *sqlite.Conn, querySource QuerySource, dbQuery string, i
 	}
 	defer stmt.Finalize()
 
+	// Bind the parameter values, if any were given
+	if params != nil {
+		err = bindQueryParams(stmt, *params)
+		if err != nil {
+			return 0, 0, dataRows, err
+		}
+	}
+
 	// Retrieve the field names
 	dataRows.ColNames = stmt.ColumnNames()
 	dataRows.ColCount = len(dataRows.ColNames)
@@ -1467,6 +1564,12 @@ func SQLiteRunQuery(sdb *sqlite.Conn, querySource QuerySource, dbQuery string, i
 	// Process each row
 	fieldCount := -1
 	err = stmt.Select(func(s *sqlite.Stmt) error {
+		// Stop once the query returns more rows than it's allowed
+		if limiter != nil {
+			if err := limiter.addRow(); err != nil {
+				return err
+			}
+		}
 
 		// Get the number of fields in the result
 		if fieldCount == -1 {
@@ -1561,6 +1664,9 @@ func SQLiteRunQuery(sdb *sqlite.Conn, querySource QuerySource, dbQuery string, i
 
 		return nil
 	})
+	if limiter != nil {
+		err = limiter.err(err)
+	}
 	if err != nil {
 		log.Printf("Error when retrieving select data from database: %s", err)
 		return 0, 0, dataRows, err
@@ -1610,6 +1716,7 @@ func SQLiteRunQueryDefensive(w http.ResponseWriter, r *http.Request, querySource
 	// Execute the SQLite select query (or queries)
 	var dataRows SQLiteRecordSet
 	var memUsed, memHighWater int64
+	start := time.Now()
 	memUsed, memHighWater, dataRows, err = SQLiteRunQuery(sdb, querySource, query, false, false)
 	if err != nil {
 		e := err.Error()
@@ -1623,39 +1730,58 @@ func SQLiteRunQueryDefensive(w http.ResponseWriter, r *http.Request, querySource
 	}
 
 	// Add the SQLite execution stats to the log record
-	err = database.LogSQLiteQueryAfter(logID, memUsed, memHighWater)
+	err = database.LogSQLiteQueryAfter(logID, memUsed, memHighWater, time.Since(start), dataRows.RowCount, "")
 	if err != nil {
 		return SQLiteRecordSet{}, err
 	}
 	return dataRows, err
 }
 
-// SQLiteRunQueryLive is used by our job queue backend infrastructure to run a user provided SQLite query
-func SQLiteRunQueryLive(baseDir, dbOwner, dbName, loggedInUser, query string) (records SQLiteRecordSet, err error) {
+// SQLiteRunQueryLive is used by our job queue backend infrastructure to run a user provided SQLite query.  When params
+// isn't nil, its values are bound to the parameters of the query
+func SQLiteRunQueryLive(baseDir, dbOwner, dbName, loggedInUser, query string, params *QueryParams) (records SQLiteRecordSet, err error) {
 	// Open the database on the local node
 	var sdb *sqlite.Conn
-	sdb, err = OpenSQLiteDatabaseLive(baseDir, dbOwner, dbName)
+	var release func()
+	sdb, release, err = liveReadConn(baseDir, dbOwner, dbName)
 	if err != nil {
 		return
 	}
-	defer sdb.Close()
+	defer release()
+	return runQueryLimited(sdb, dbOwner, dbName, loggedInUser, query, params)
+}
 
+// runQueryLimited runs a user provided SQLite query on a live database within the limits for the user, recording the
+// resources it used
+func runQueryLimited(sdb *sqlite.Conn, dbOwner, dbName, loggedInUser, query string, params *QueryParams) (records SQLiteRecordSet, err error) {
 	// Log the SQL query (prior to executing it)
 	logID, err := database.LogSQLiteQueryBefore("LIVE api", dbOwner, dbName, loggedInUser, "-", "-", query)
 	if err != nil {
 		return SQLiteRecordSet{}, err
 	}
 
-	// Execute the SQLite select query (or queries)
-	memUsed, memHighWater, records, err := SQLiteRunQuery(sdb, QuerySourceAPI, query, false, false)
+	// Execute the SQLite select query (or queries), within the limits for the user
+	limits, err := LiveQueryLimits(loggedInUser)
+	if err != nil {
+		return SQLiteRecordSet{}, err
+	}
+	limiter := startQueryLimits(sdb, limits)
+	memUsed, memHighWater, records, err := sqliteRunQuery(sdb, QuerySourceAPI, query, params, limiter, false, false)
+	limiter.stop()
 	if err != nil {
 		log.Printf("Error when running LIVE query by '%s' for LIVE database (%s/%s): '%s'", SanitiseLogString(loggedInUser),
 			SanitiseLogString(dbOwner), SanitiseLogString(dbName), SanitiseLogString(err.Error()))
+
+		// Record the queries stopped by a limit, as they still used the resources up to it
+		if limit := limiter.limitExceeded(); limit != "" {
+			database.LogSQLiteQueryAfter(logID, sqlite.MemoryUsed(), sqlite.MemoryHighwater(false), limiter.duration(),
+				limiter.rows, limit)
+		}
 		return SQLiteRecordSet{}, err
 	}
 
 	// Add the SQLite execution stats to the log record
-	err = database.LogSQLiteQueryAfter(logID, memUsed, memHighWater)
+	err = database.LogSQLiteQueryAfter(logID, memUsed, memHighWater, limiter.duration(), records.RowCount, "")
 	if err != nil {
 		return SQLiteRecordSet{}, err
 	}
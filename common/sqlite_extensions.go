@@ -0,0 +1,155 @@
+package common
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	sqlite "github.com/gwenn/gosqlite"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+)
+
+// SQLiteExtension is an optional set of SQLite functions and virtual table modules.  The instance admins choose which
+// of them user queries can use.  Loadable extensions come from a shared library loaded into each connection, while the
+// others are built into SQLite
+type SQLiteExtension struct {
+	EntryPoint string
+	Functions  []function
+	Loadable   bool
+	Modules    []string
+
+	// ReadOnly are the functions of the extension which are allowed in the read only queries run on standard
+	// databases.  For extensions built into SQLite, all of their functions are in SQLiteFunctions already
+	ReadOnly []function
+}
+
+// SQLiteExtensions is the curated set of SQLite extensions which can be allowed on an instance
+var SQLiteExtensions = map[string]SQLiteExtension{
+	"geopoly": {
+		Functions: []function{fnGeopolyArea, fnGeopolyBBox, fnGeopolyBlob, fnGeopolyCCW, fnGeopolyContainsPoint,
+			fnGeopolyGroupBBox, fnGeopolyJson, fnGeopolyOverlap, fnGeopolyRegular, fnGeopolySvg, fnGeopolyWithin,
+			fnGeopolyXForm},
+		Modules: []string{"geopoly"},
+	},
+	"json1": {
+		Functions: []function{fnJson, fnJsonArray, fnJsonArrayLength, fnJsonExtract, fnJsonInsert, fnJsonObject,
+			fnJsonPatch, fnJsonRemove, fnJsonReplace, fnJsonSet, fnJsonType, fnJsonValid, fnJsonQuote, fnJsonGroupArray,
+			fnJsonGroupObject, fnJsonErrorPosition, fnJsonPretty, fnJsonArrow, fnJsonArrowText},
+		Modules: []string{"json_each", "json_tree"},
+	},
+	"math": {
+		Functions: []function{fnACos, fnACosH, fnASin, fnASinH, fnATan, fnATan2, fnATanh, fnACeil, fnACeiling, fnCos,
+			fnCosH, fnDegrees, fnExp, fnFloor, fnLn, fnLog, fnLog10, fnLog2, fnMod, fnPi, fnPow, fnPower, fnRadians,
+			fnSin, fnSinH, fnSqrt, fnTan, fnTanH, fnTrunc},
+	},
+	"spatialite": {
+		EntryPoint: "sqlite3_modspatialite_init",
+		Loadable:   true,
+		ReadOnly: []function{"area", "asbinary", "asgeojson", "askml", "astext", "aswkt", "buffer", "centroid",
+			"contains", "coveredby", "covers", "crosses", "disjoint", "distance", "envelope", "equals", "geometrytype",
+			"geomfromgeojson", "geomfromtext", "geomfromwkb", "glength", "gunion", "intersection", "intersects",
+			"isvalid", "makeline", "makepoint", "makepolygon", "mbrcontains", "mbrintersects", "mbrwithin",
+			"numpoints", "overlaps", "pointn", "simplify", "spatialite_version", "srid", "st_area", "st_asbinary",
+			"st_astext", "st_buffer", "st_centroid", "st_contains", "st_coveredby", "st_covers", "st_crosses",
+			"st_disjoint", "st_distance", "st_envelope", "st_equals", "st_geometrytype", "st_geomfromtext",
+			"st_geomfromwkb", "st_intersection", "st_intersects", "st_isvalid", "st_length", "st_npoints",
+			"st_overlaps", "st_point", "st_pointn", "st_simplify", "st_srid", "st_touches", "st_transform", "st_union",
+			"st_within", "st_x", "st_y", "touches", "transform", "within", "x", "y"},
+	},
+}
+
+// sqliteExtensions holds the extensions available on this server, worked out from the config file the first time
+// they're needed.  Denied holds the functions and modules of the extensions built into SQLite which aren't allowed, and
+// ReadOnly holds the extra functions allowed in read only queries
+var sqliteExtensions struct {
+	once     sync.Once
+	denied   map[string]bool
+	loaded   []string
+	readOnly map[string]bool
+}
+
+// sqliteExtensionsInit works out which of the allowed extensions are available.  Extensions which don't exist or can't
+// be loaded are logged and left out
+func sqliteExtensionsInit() {
+	sqliteExtensions.once.Do(func() {
+		allowed := make(map[string]bool)
+		for _, name := range config.Conf.Extensions.Allowed {
+			ext, ok := SQLiteExtensions[name]
+			if !ok {
+				log.Printf("WARN: Unknown SQLite extension '%s' in the config file.  It won't be available", name)
+				continue
+			}
+			if !ext.Loadable {
+				allowed[name] = true
+				continue
+			}
+
+			// Make sure the extension library can be loaded, so a problem with it doesn't stop databases being opened
+			sdb, err := sqlite.Open(":memory:")
+			if err == nil {
+				err = loadSQLiteExtension(sdb, name)
+				sdb.Close()
+			}
+			if err != nil {
+				log.Printf("WARN: The SQLite extension '%s' couldn't be loaded, so it won't be available: %s", name, err)
+				continue
+			}
+			allowed[name] = true
+		}
+
+		sqliteExtensions.denied = make(map[string]bool)
+		sqliteExtensions.readOnly = make(map[string]bool)
+		for name, ext := range SQLiteExtensions {
+			if !allowed[name] {
+				for _, f := range ext.Functions {
+					sqliteExtensions.denied[string(f)] = true
+				}
+				for _, m := range ext.Modules {
+					sqliteExtensions.denied[m] = true
+				}
+				continue
+			}
+			if ext.Loadable {
+				sqliteExtensions.loaded = append(sqliteExtensions.loaded, name)
+			}
+			for _, f := range ext.ReadOnly {
+				sqliteExtensions.readOnly[string(f)] = true
+			}
+		}
+	})
+}
+
+// loadSQLiteExtensions loads the allowed loadable extensions into a connection.  It needs calling before the authorizer
+// of the connection is set
+func loadSQLiteExtensions(sdb *sqlite.Conn) (err error) {
+	sqliteExtensionsInit()
+	for _, name := range sqliteExtensions.loaded {
+		err = loadSQLiteExtension(sdb, name)
+		if err != nil {
+			log.Printf("Couldn't load the SQLite extension '%s': %s", name, err)
+			return
+		}
+	}
+	return
+}
+
+// sqliteExtensionFile returns the path of the shared library of a loadable extension, as set in the config file
+func sqliteExtensionFile(name string) string {
+	switch name {
+	case "spatialite":
+		return config.Conf.Extensions.Spatialite
+	}
+	return ""
+}
+
+// sqliteExtensionDenied returns whether a function or virtual table module belongs to an extension which isn't allowed
+func sqliteExtensionDenied(name string) bool {
+	sqliteExtensionsInit()
+	return sqliteExtensions.denied[strings.ToLower(name)]
+}
+
+// sqliteExtensionReadOnly returns whether a function of an allowed loadable extension can be used in read only queries
+func sqliteExtensionReadOnly(name string) bool {
+	sqliteExtensionsInit()
+	return sqliteExtensions.readOnly[strings.ToLower(name)]
+}
@@ -0,0 +1,26 @@
+//go:build all
+
+package common
+
+import (
+	"fmt"
+
+	sqlite "github.com/gwenn/gosqlite"
+)
+
+// loadSQLiteExtension loads a loadable extension into a connection.  Extension loading is only turned on while the
+// library is being loaded, so SQL statements can't load anything themselves
+func loadSQLiteExtension(sdb *sqlite.Conn, name string) (err error) {
+	file := sqliteExtensionFile(name)
+	if file == "" {
+		return fmt.Errorf("The path to the library of the '%s' extension isn't set in the config file", name)
+	}
+	if err = sdb.EnableLoadExtension(true); err != nil {
+		return
+	}
+	err = sdb.LoadExtension(file, SQLiteExtensions[name].EntryPoint)
+	if e := sdb.EnableLoadExtension(false); err == nil {
+		err = e
+	}
+	return
+}
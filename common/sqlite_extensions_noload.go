@@ -0,0 +1,15 @@
+//go:build !all
+
+package common
+
+import (
+	"errors"
+
+	sqlite "github.com/gwenn/gosqlite"
+)
+
+// loadSQLiteExtension can't load extensions in this build, as the SQLite library calls for loading them are only
+// included when building with the "all" tag
+func loadSQLiteExtension(sdb *sqlite.Conn, name string) error {
+	return errors.New("Loading SQLite extensions needs the daemons built with the \"all\" tag")
+}
@@ -0,0 +1,135 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// CommitStatusStates are the states a commit status can have
+var CommitStatusStates = []string{"pending", "success", "failure"}
+
+// MergeRequestStatusChecks returns the statuses posted for the head commit of a merge request, along with the reason it
+// can't be merged yet when one of the status checks required by the destination database hasn't succeeded, the commit
+// fails a blocking validation rule of the destination database, the schema change policy of the destination branch
+// doesn't allow it, or its reviews don't allow it yet.  The reason is empty when it can be merged
+func MergeRequestStatusChecks(destOwner, destName string, disc database.DiscussionEntry) (checks []database.CommitStatus, blocked string, err error) {
+	mr := disc.MRDetails
+	required, err := database.RequiredStatusChecks(destOwner, destName)
+	if err != nil {
+		return
+	}
+	if len(mr.Commits) == 0 {
+		if len(required) > 0 {
+			blocked = "The merge request has no commits for its required status checks to run against"
+		}
+		return
+	}
+
+	// The statuses are posted against the commits in the source database
+	checks, err = database.CommitStatuses(mr.SourceOwner, mr.SourceDBName, mr.Commits[0].ID)
+	if err != nil {
+		return
+	}
+
+	// The validation rules which matter are the destination database's ones, so their outcome replaces any posted by
+	// the source database
+	validation, err := mergeRequestValidation(destOwner, destName, mr)
+	if err != nil {
+		return
+	}
+	if validation != nil {
+		state := "success"
+		if !validation.Passed {
+			state = "failure"
+		}
+		s := database.CommitStatus{
+			Commit:       validation.Commit,
+			Context:      ValidationStatusContext,
+			Creator:      destOwner,
+			DateCreated:  validation.DateCreated,
+			Description:  ValidationSummary(*validation),
+			LastModified: validation.DateCreated,
+			State:        state,
+		}
+		replaced := false
+		for i, z := range checks {
+			if z.Context == ValidationStatusContext {
+				checks[i] = s
+				replaced = true
+			}
+		}
+		if !replaced {
+			checks = append(checks, s)
+		}
+		blocked = ValidationBlockingFailure(*validation)
+	}
+	if blocked == "" {
+		blocked, err = mergeRequestSchemaPolicy(destOwner, destName, disc.ID, mr)
+		if err != nil {
+			return
+		}
+	}
+	if blocked == "" {
+		blocked, err = mergeRequestReviewed(destOwner, destName, disc)
+		if err != nil {
+			return
+		}
+	}
+
+	states := make(map[string]string)
+	for _, s := range checks {
+		states[s.Context] = s.State
+	}
+	for _, r := range required {
+		if blocked != "" {
+			break
+		}
+		switch states[r] {
+		case "success":
+			continue
+		case "":
+			blocked = fmt.Sprintf("Waiting for the required '%s' status check", r)
+		default:
+			blocked = fmt.Sprintf("The required '%s' status check is %s", r, states[r])
+		}
+	}
+	return
+}
+
+// mergeRequestValidation returns the outcome of checking the head commit of a merge request against the validation
+// rules of the destination database, checking it first if that hasn't been done yet.  The returned result is nil when
+// the destination database has no validation rules, or the source database can't be read by the server
+func mergeRequestValidation(destOwner, destName string, mr database.MergeRequestEntry) (result *database.ValidationResult, err error) {
+	rules, err := database.ValidationRules(destOwner, destName)
+	if err != nil || len(rules) == 0 {
+		return
+	}
+	commitID := mr.Commits[0].ID
+	result, err = database.ValidationResultFor(destOwner, destName, commitID)
+	if err != nil || result != nil {
+		return
+	}
+
+	bucket, id, err := SQLiteLocation(mr.SourceOwner, mr.SourceDBName, commitID, mr.SourceOwner)
+	if errors.Is(err, ErrClientEncrypted) {
+		return nil, nil
+	}
+	if err != nil {
+		return
+	}
+	dbPath, err := RetrieveDatabaseFile(bucket, id)
+	if err != nil {
+		return
+	}
+	z, err := ValidateDatabaseFile(dbPath, commitID, rules)
+	if err != nil {
+		return
+	}
+	err = database.ValidationResultSave(destOwner, destName, z)
+	if err != nil {
+		return
+	}
+	return &z, nil
+}
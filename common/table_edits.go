@@ -0,0 +1,310 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	sqlite "github.com/gwenn/gosqlite"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// TableEditMaxRows is the maximum number of rows which can be changed by one table edit
+const TableEditMaxRows = 1000
+
+// TableEditAction is the kind of change a table edit makes to the rows of a table
+type TableEditAction string
+
+const (
+	TableEditDelete TableEditAction = "delete"
+	TableEditInsert TableEditAction = "insert"
+	TableEditUpdate TableEditAction = "update"
+)
+
+// TableEditRow is a row changed by a table edit.  Key holds the primary key values of the row to update or delete, and
+// Values holds the new column values of the row to insert or update.  JSON strings, numbers, booleans, and null are
+// accepted as values
+type TableEditRow struct {
+	Key    map[string]interface{} `json:"key,omitempty"`
+	Values map[string]interface{} `json:"values,omitempty"`
+}
+
+// EditTableRows inserts, updates, or deletes rows of a table in a standard database, storing the result as a new
+// commit on the head of the branch.  If no branch name is given, the default branch is used.  Rows to update or delete
+// are found by the values of all their primary key columns, and each needs to match exactly one row.  The returned
+// status is the HTTP status code matching the error
+func EditTableRows(loggedInUser, dbOwner, dbName, branchName, table string, action TableEditAction, rows []TableEditRow, commitMsg string) (commitID string, httpStatus int, err error) {
+	if action != TableEditDelete && action != TableEditInsert && action != TableEditUpdate {
+		return "", http.StatusBadRequest, errors.New("Unknown table edit action")
+	}
+	if len(rows) == 0 || len(rows) > TableEditMaxRows {
+		return "", http.StatusBadRequest, fmt.Errorf("Between 1 and %d rows need to be given", TableEditMaxRows)
+	}
+
+	// Make sure the user has write access to the database
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	if !allowed {
+		return "", http.StatusNotFound, errors.New("Database not found")
+	}
+
+	// Live databases are changed directly instead, and databases encrypted by their owner can't be read
+	isLive, _, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	if isLive {
+		return "", http.StatusBadRequest, errors.New("That database is a live database.  Its rows are changed " +
+			"directly, without creating commits")
+	}
+	clientEncrypted, err := database.CheckDBClientEncrypted(dbOwner, dbName)
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	if clientEncrypted {
+		return "", http.StatusBadRequest, ErrClientEncrypted
+	}
+	archived, err := database.CheckDBArchived(dbOwner, dbName)
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	if archived {
+		return "", http.StatusForbidden, database.ErrDBArchived
+	}
+
+	// Find the head commit of the branch
+	if branchName == "" {
+		branchName, err = database.GetDefaultBranchName(dbOwner, dbName)
+		if err != nil {
+			return "", http.StatusInternalServerError, err
+		}
+	}
+	branches, err := database.GetBranches(dbOwner, dbName)
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	head, ok := branches[branchName]
+	if !ok {
+		return "", http.StatusNotFound, errors.New("Branch not found")
+	}
+
+	// Work on a copy of the head commit, so the cached file isn't changed
+	bucket, id, err := SQLiteLocation(dbOwner, dbName, head.Commit, loggedInUser)
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	if id == "" {
+		return "", http.StatusNotFound, errors.New("Database not found")
+	}
+	dbFile, err := RetrieveDatabaseFile(bucket, id)
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	tmpFile, err := os.CreateTemp(config.Conf.DiskCache.Directory, "dbhub-edit-*.db")
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+	err = func() (err error) {
+		inFile, err := os.Open(dbFile)
+		if err != nil {
+			return
+		}
+		defer inFile.Close()
+		_, err = io.Copy(tmpFile, inFile)
+		return
+	}()
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+
+	// Change the rows of the copy
+	err = editTableRows(tmpFile.Name(), table, action, rows)
+	if err != nil {
+		return "", http.StatusBadRequest, err
+	}
+
+	// Store the changed database as a new commit
+	if commitMsg == "" {
+		switch action {
+		case TableEditDelete:
+			commitMsg = fmt.Sprintf("Deleted %s from table '%s'", plural(len(rows), "row", "rows"), table)
+		case TableEditInsert:
+			commitMsg = fmt.Sprintf("Inserted %s into table '%s'", plural(len(rows), "row", "rows"), table)
+		case TableEditUpdate:
+			commitMsg = fmt.Sprintf("Updated %s of table '%s'", plural(len(rows), "row", "rows"), table)
+		}
+	}
+	_, err = tmpFile.Seek(0, 0)
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	_, commitID, _, err = AddDatabase(loggedInUser, dbOwner, dbName, false, branchName, head.Commit,
+		database.KeepCurrentAccessType, "", commitMsg, "", tmpFile, time.Now().UTC(), time.Time{}, "", "", "", "", nil,
+		"", AddDatabaseOptions{})
+	if errors.Is(err, database.ErrDBArchived) {
+		return "", http.StatusForbidden, err
+	}
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	return commitID, http.StatusOK, nil
+}
+
+// editTableRows makes the changes of a table edit to a SQLite database file.  Either all of the changes are made, or
+// none of them are
+func editTableRows(fileName, table string, action TableEditAction, rows []TableEditRow) (err error) {
+	sdb, err := sqlite.Open(fileName, sqlite.OpenReadWrite)
+	if err != nil {
+		return
+	}
+	defer sdb.Close()
+	if err = sdb.EnableExtendedResultCodes(true); err != nil {
+		return
+	}
+
+	// Only tables can be changed, not views
+	tables, err := Tables(sdb)
+	if err != nil {
+		return
+	}
+	found := false
+	for _, t := range tables {
+		if t == table {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("Table '%s' not found", table)
+	}
+
+	// Work out the columns of the table.  All of the column names used in the statements are taken from the table
+	// schema, rather than from the request
+	pks, _, other, err := GetPrimaryKeyAndOtherColumns(sdb, "main", table)
+	if err != nil {
+		return
+	}
+	columns := make(map[string]string)
+	for _, c := range append(append([]string{}, pks...), other...) {
+		columns[strings.ToLower(c)] = c
+	}
+
+	if err = sdb.Begin(); err != nil {
+		return
+	}
+	for i, row := range rows {
+		err = editTableRow(sdb, table, action, pks, columns, row)
+		if err != nil {
+			sdb.Rollback()
+			return fmt.Errorf("Row %d: %s", i+1, err)
+		}
+	}
+	return sdb.Commit()
+}
+
+// editTableRow makes the change of a table edit to one row
+func editTableRow(sdb *sqlite.Conn, table string, action TableEditAction, pks []string, columns map[string]string, row TableEditRow) (err error) {
+	// Work out the columns and values to set
+	var setCols []string
+	var setArgs []interface{}
+	for name, val := range row.Values {
+		col, ok := columns[strings.ToLower(name)]
+		if !ok {
+			return fmt.Errorf("Column '%s' not found", name)
+		}
+		v, err := tableEditValue(val)
+		if err != nil {
+			return fmt.Errorf("Invalid value for column '%s'", name)
+		}
+		setCols = append(setCols, col)
+		setArgs = append(setArgs, v)
+	}
+
+	// Work out the condition matching the row, from the values of all its primary key columns
+	var where []string
+	var whereArgs []interface{}
+	if action != TableEditInsert {
+		if len(pks) == 0 {
+			return errors.New("The table doesn't have a primary key")
+		}
+		for _, p := range pks {
+			val, ok := row.Key[p]
+			if !ok {
+				return fmt.Errorf("The value of primary key column '%s' is missing", p)
+			}
+			v, err := tableEditValue(val)
+			if err != nil || v == nil {
+				return fmt.Errorf("Invalid value for primary key column '%s'", p)
+			}
+			where = append(where, EscapeId(p)+" = ?")
+			whereArgs = append(whereArgs, v)
+		}
+	}
+
+	var sql string
+	var args []interface{}
+	switch action {
+	case TableEditInsert:
+		if len(setCols) == 0 {
+			sql = "INSERT INTO " + EscapeId(table) + " DEFAULT VALUES"
+		} else {
+			sql = "INSERT INTO " + EscapeId(table) + " (" + strings.Join(EscapeIds(setCols), ", ") + ") VALUES (?" +
+				strings.Repeat(", ?", len(setCols)-1) + ")"
+			args = setArgs
+		}
+	case TableEditUpdate:
+		if len(setCols) == 0 {
+			return errors.New("No values to update were given")
+		}
+		sql = "UPDATE " + EscapeId(table) + " SET " + strings.Join(EscapeIds(setCols), " = ?, ") + " = ? WHERE " +
+			strings.Join(where, " AND ")
+		args = append(setArgs, whereArgs...)
+	case TableEditDelete:
+		sql = "DELETE FROM " + EscapeId(table) + " WHERE " + strings.Join(where, " AND ")
+		args = whereArgs
+	}
+	err = sdb.Exec(sql, args...)
+	if err != nil {
+		return
+	}
+	if sdb.Changes() != 1 {
+		return errors.New("No row with that primary key was found")
+	}
+	return
+}
+
+// tableEditValue turns a JSON value from a table edit into a value SQLite can store
+func tableEditValue(val interface{}) (interface{}, error) {
+	switch v := val.(type) {
+	case nil, string, int64:
+		return v, nil
+	case float64:
+		// Whole numbers are stored as integers, the same as SQLite does for numbers written without a decimal point
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v), nil
+		}
+		return v, nil
+	case bool:
+		if v {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	}
+	return nil, errors.New("Unsupported value")
+}
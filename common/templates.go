@@ -0,0 +1,166 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	sqlite "github.com/gwenn/gosqlite"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// ErrNotTemplate is returned when trying to create a database from one which isn't a template
+var ErrNotTemplate = errors.New("That database isn't a template")
+
+// CreateFromTemplate creates a new database for a user, with the schema of the latest commit of a template database.
+// The rows of the template are only copied when withData is true.  The new database starts its own history, so it
+// isn't a fork of the template.  The returned status is the HTTP status code matching the error
+func CreateFromTemplate(loggedInUser, tmplOwner, tmplName, dbName string, withData bool, accessType database.SetAccessType) (commitID string, httpStatus int, err error) {
+	// Make sure the template can be read by the user
+	bucket, id, err := SQLiteLocation(tmplOwner, tmplName, "", loggedInUser)
+	if errors.Is(err, ErrClientEncrypted) {
+		return "", http.StatusBadRequest, ErrNotTemplate
+	}
+	if err != nil || id == "" {
+		return "", http.StatusNotFound, errors.New("Database not found")
+	}
+	isTemplate, err := database.CheckDBTemplate(tmplOwner, tmplName)
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	if !isTemplate {
+		return "", http.StatusBadRequest, ErrNotTemplate
+	}
+
+	// Only new databases can be created this way
+	exists, err := database.CheckDBExists(loggedInUser, dbName)
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	if exists {
+		return "", http.StatusConflict, errors.New("A database with that name already exists.  Please choose a " +
+			"different name.")
+	}
+
+	// Work on a copy of the template, so the cached file isn't changed
+	dbFile, err := RetrieveDatabaseFile(bucket, id)
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	tmpFile, err := os.CreateTemp(config.Conf.DiskCache.Directory, "dbhub-template-*.db")
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+	err = func() (err error) {
+		inFile, err := os.Open(dbFile)
+		if err != nil {
+			return
+		}
+		defer inFile.Close()
+		_, err = io.Copy(tmpFile, inFile)
+		return
+	}()
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+
+	// Remove the rows from the copy, unless they were asked for
+	if !withData {
+		err = emptyTables(tmpFile.Name())
+		if err != nil {
+			return "", http.StatusInternalServerError, err
+		}
+	}
+
+	// Keep the licence of the template when its data is copied, as long as the user has the same licence available
+	licenceName, err := templateLicence(loggedInUser, tmplOwner, tmplName)
+	if err != nil || !withData {
+		licenceName = "Not specified"
+	}
+
+	// Seek to start of temporary file. When not doing this AddDatabase() cannot copy the file
+	_, err = tmpFile.Seek(0, 0)
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	commitMsg := fmt.Sprintf("Created from the %s/%s template", tmplOwner, tmplName)
+	_, commitID, _, err = AddDatabase(loggedInUser, loggedInUser, dbName, true, "main", "", accessType, licenceName,
+		commitMsg, "", tmpFile, time.Now().UTC(), time.Time{}, "", "", "", "", nil, "", AddDatabaseOptions{})
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	return commitID, http.StatusCreated, nil
+}
+
+// emptyTables deletes all of the rows from the tables of a SQLite database, keeping its schema.  The database is
+// vacuumed afterwards, so none of the deleted data is left in the file
+func emptyTables(fileName string) (err error) {
+	sdb, err := sqlite.Open(fileName, sqlite.OpenReadWrite)
+	if err != nil {
+		return
+	}
+	defer sdb.Close()
+	if err = sdb.EnableExtendedResultCodes(true); err != nil {
+		return
+	}
+	tables, err := sdb.Tables("")
+	if err != nil {
+		return
+	}
+	for _, t := range tables {
+		err = sdb.Exec("DELETE FROM " + EscapeId(t))
+		if err != nil {
+			return
+		}
+	}
+
+	// Start AUTOINCREMENT columns from the beginning again, when the database has them
+	var hasSequence bool
+	err = sdb.OneValue("SELECT count(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'sqlite_sequence'",
+		&hasSequence)
+	if err != nil {
+		return
+	}
+	if hasSequence {
+		err = sdb.Exec("DELETE FROM sqlite_sequence")
+		if err != nil {
+			return
+		}
+	}
+	return sdb.Exec("VACUUM")
+}
+
+// templateLicence returns the name of the licence of the latest commit of a template, when the user can use the same
+// licence for their own databases
+func templateLicence(loggedInUser, tmplOwner, tmplName string) (licenceName string, err error) {
+	commitID, err := database.DefaultCommit(tmplOwner, tmplName)
+	if err != nil {
+		return
+	}
+	commitList, err := database.GetCommitList(tmplOwner, tmplName)
+	if err != nil {
+		return
+	}
+	c, ok := commitList[commitID]
+	if !ok || len(c.Tree.Entries) == 0 || c.Tree.Entries[0].LicenceSHA == "" {
+		return "", errors.New("No licence")
+	}
+	name, _, err := database.GetLicenceInfoFromSha256(tmplOwner, c.Tree.Entries[0].LicenceSHA)
+	if err != nil {
+		return
+	}
+	licences, err := database.GetLicences(loggedInUser)
+	if err != nil {
+		return
+	}
+	if _, ok = licences[name]; !ok {
+		return "", errors.New("Licence not available")
+	}
+	return name, nil
+}
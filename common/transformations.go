@@ -0,0 +1,243 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	sqlite "github.com/gwenn/gosqlite"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+const (
+	// transformationCheckInterval is how often the live nodes look for transformations due to run
+	transformationCheckInterval = 30 * time.Second
+
+	// transformationTimeout is the longest a single transformation is allowed to run
+	transformationTimeout = 5 * time.Minute
+)
+
+// TransformationLoop runs the transformations of the live databases on this node, when they're due.  When ctx is
+// cancelled the transformations of the database being done are finished off, then wg is marked as done
+func TransformationLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// Ensure a warning message is displayed on the console if the transformation loop exits other than by shutting down
+	defer func() {
+		if ctx.Err() != nil {
+			log.Printf("%s: transformation loop stopped", config.Conf.Live.Nodename)
+			return
+		}
+		log.Printf("%s: WARN: Transformation loop exited", config.Conf.Live.Nodename)
+	}()
+
+	log.Printf("%s: transformation loop started.  %v refresh.", config.Conf.Live.Nodename, transformationCheckInterval)
+	for {
+		dbs, err := database.TransformationsDue(config.Conf.Live.Nodename)
+		if err == nil {
+			for _, z := range dbs {
+				if ctx.Err() != nil {
+					break
+				}
+				err = runTransformations(z[0], z[1])
+				if err != nil {
+					log.Printf("%s: running the transformations of '%s/%s' failed: %v", config.Conf.Live.Nodename, z[0],
+						SanitiseLogString(z[1]), err)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(transformationCheckInterval):
+		}
+	}
+}
+
+// TransformationOrder returns the names of a set of transformations in the order they need to run, with each one after
+// the transformations it depends on.  An error is returned when a dependency is missing, or they depend on each other
+// in a loop
+func TransformationOrder(list []database.Transformation) (order []string, err error) {
+	deps := make(map[string][]string)
+	for _, t := range list {
+		deps[t.Name] = t.DependsOn
+	}
+	for _, t := range list {
+		for _, d := range t.DependsOn {
+			if _, ok := deps[d]; !ok {
+				return nil, fmt.Errorf("Transformation '%s' depends on '%s', which doesn't exist", t.Name, d)
+			}
+		}
+	}
+
+	// Visit the transformations in name order, so the run order is always the same
+	names := make([]string, 0, len(deps))
+	for n := range deps {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	var visit func(n string) error
+	visit = func(n string) error {
+		switch state[n] {
+		case visiting:
+			return fmt.Errorf("Transformation '%s' depends on itself through its dependencies", n)
+		case visited:
+			return nil
+		}
+		state[n] = visiting
+		for _, d := range deps[n] {
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		state[n] = visited
+		order = append(order, n)
+		return nil
+	}
+	for _, n := range names {
+		if err = visit(n); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// materialiseTransformation replaces the table of a transformation with the result of its query, returning the number
+// of rows written.  The query needs to be a single statement which only reads from the database
+func materialiseTransformation(sdb *sqlite.Conn, t database.Transformation) (rows int64, err error) {
+	query := strings.TrimRight(strings.TrimSpace(t.SQL), "; \t\n")
+	stmt, err := sdb.Prepare(query)
+	if err != nil {
+		return
+	}
+	readOnly := stmt.ReadOnly() && stmt.ColumnCount() > 0 && strings.TrimSpace(stmt.Tail()) == ""
+	stmt.Finalize()
+	if !readOnly {
+		return 0, errors.New("The SQL needs to be a single SELECT statement")
+	}
+
+	// Stop the query if it runs for too long
+	timer := time.AfterFunc(transformationTimeout, sdb.Interrupt)
+	defer timer.Stop()
+
+	if err = sdb.Begin(); err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			sdb.Rollback()
+		}
+	}()
+	if err = sdb.Exec("DROP TABLE IF EXISTS " + EscapeId(t.Name)); err != nil {
+		return
+	}
+	if err = sdb.Exec("CREATE TABLE " + EscapeId(t.Name) + " AS " + query); err != nil {
+		return
+	}
+	if err = sdb.OneValue("SELECT count(*) FROM "+EscapeId(t.Name), &rows); err != nil {
+		return
+	}
+	err = sdb.Commit()
+	return
+}
+
+// runTransformations runs the transformations of a live database which are due, along with the ones depending on them.
+// A transformation whose dependency fails isn't run, and is recorded as failed too
+func runTransformations(dbOwner, dbName string) (err error) {
+	list, err := database.Transformations(dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	order, err := TransformationOrder(list)
+	if err != nil {
+		return
+	}
+	byName := make(map[string]database.Transformation)
+	for _, t := range list {
+		byName[t.Name] = t
+	}
+
+	// Work out what to run.  As the order has dependencies first, a single pass finds everything downstream of the
+	// transformations which are due
+	trigger := make(map[string]string)
+	for _, n := range order {
+		t := byName[n]
+		if t.Trigger != "" {
+			trigger[n] = t.Trigger
+			continue
+		}
+		for _, d := range t.DependsOn {
+			if trigger[d] != "" {
+				trigger[n] = trigger[d]
+				break
+			}
+		}
+	}
+
+	// While a transaction is open on the database the transformations are left for a later pass, as they'd only fail
+	// waiting for its write lock
+	if liveTransactionCheck(dbOwner, dbName) != nil {
+		return nil
+	}
+
+	defer liveDBUse(dbOwner, dbName, false, false)()
+	sdb, err := OpenSQLiteDatabaseLive(config.Conf.Live.StorageDir, dbOwner, dbName)
+	if err != nil {
+		return
+	}
+	defer sdb.Close()
+
+	failed := make(map[string]bool)
+	var changed bool
+	for _, n := range order {
+		if trigger[n] == "" {
+			continue
+		}
+		t := byName[n]
+		run := database.TransformationRun{Name: n, Started: time.Now().UTC(), Trigger: trigger[n]}
+		var runErr error
+		for _, d := range t.DependsOn {
+			if failed[d] {
+				runErr = fmt.Errorf("Not run, as the '%s' transformation it depends on failed", d)
+				break
+			}
+		}
+		if runErr == nil {
+			run.RowsWritten, runErr = materialiseTransformation(sdb, t)
+		}
+		run.Finished = time.Now().UTC()
+		if runErr != nil {
+			failed[n] = true
+			run.Error = runErr.Error()
+		} else {
+			changed = true
+		}
+
+		subj := fmt.Sprintf("DBHub.io: transformation '%s' of %s/%s failed", n, dbOwner, dbName)
+		msg := fmt.Sprintf("The '%s' transformation of your live database '%s/%s' failed with this error:\n\n%s\n\n"+
+			"You won't be emailed again until it has run successfully.  Its run history can be retrieved using the "+
+			"transformationruns API call.", n, dbOwner, dbName, run.Error)
+		err = database.TransformationRunSave(dbOwner, dbName, run, subj, msg)
+		if err != nil {
+			return
+		}
+	}
+
+	// Let anything following the database know it has changed
+	if changed {
+		liveAfterWrite(dbOwner, dbName, false)
+	}
+	return
+}
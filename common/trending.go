@@ -0,0 +1,48 @@
+package common
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// How often the trending scores of the databases are recalculated
+const trendingRefreshInterval = time.Hour
+
+// TrendingLoop periodically recalculates the trending scores of the public databases.  When ctx is cancelled the
+// loop stops once the run in progress is done, then wg is marked as done
+func TrendingLoop(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// Ensure a warning message is displayed on the console if the trending loop exits other than by shutting down
+	defer func() {
+		if ctx.Err() != nil {
+			log.Printf("%s: trending loop stopped", config.Conf.Live.Nodename)
+			return
+		}
+		log.Printf("%s: WARN: Trending loop exited", config.Conf.Live.Nodename)
+	}()
+
+	// When several nodes are running, only one of them recalculates the scores
+	leader := database.NewLeader("trending")
+	defer leader.Resign()
+
+	log.Printf("%s: trending refresh loop started.  %v refresh.", config.Conf.Live.Nodename, trendingRefreshInterval)
+	for {
+		if leader.IsLeader() {
+			err := database.RefreshTrending()
+			if err != nil {
+				log.Printf("Error when refreshing the trending databases: %v", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(trendingRefreshInterval):
+		}
+	}
+}
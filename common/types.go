@@ -1,9 +1,17 @@
 package common
 
 import (
+	"errors"
 	"time"
+
+	"github.com/sqlitebrowser/dbhub.io/common/database"
 )
 
+// ErrClientEncrypted is returned when the contents of a database encrypted by its owner before uploading are needed.
+// The server doesn't have the key for these, so can only store and return the file
+var ErrClientEncrypted = errors.New("This database was encrypted before being uploaded, so its data can't be viewed " +
+	"or queried on DBHub.io.  It can still be downloaded")
+
 // ValType indicates the type of data in a field returned from a SQLite query
 type ValType int
 
@@ -50,18 +58,81 @@ type APIJSONIndex struct {
 	Columns []APIJSONIndexColumn `json:"columns"`
 }
 
+// ContributionGraph holds the daily contributions of a user over a period, for drawing a contribution heatmap.  Days
+// without any contributions are left out
+type ContributionGraph struct {
+	Days        []database.ContributionDay `json:"days"`
+	From        string                     `json:"from"`
+	To          string                     `json:"to"`
+	Commits     int                        `json:"total_commits"`
+	Discussions int                        `json:"total_discussions"`
+	Uploads     int                        `json:"total_uploads"`
+}
+
 type DatabaseName struct {
 	Database string
 	Owner    string
 }
 
 type DataValue struct {
-	Name  string
-	Type  ValType
-	Value interface{}
+	Name    string
+	Type    ValType
+	Value   interface{}
+	Preview *CellPreview `json:"Preview,omitempty"`
 }
 type DataRow []DataValue
 
+// LicenceChange is a commit which changed the licence of a database branch
+type LicenceChange struct {
+	AuthorName      string    `json:"author_name"`
+	CommitID        string    `json:"commit_id"`
+	Licence         string    `json:"licence"`
+	LicenceURL      string    `json:"licence_url"`
+	Message         string    `json:"message"`
+	PreviousLicence string    `json:"previous_licence"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// ReleaseCitation holds the details needed for citing a database release
+type ReleaseCitation struct {
+	Authors      []string  `json:"authors"`
+	Commit       string    `json:"commit"`
+	DateReleased time.Time `json:"date_released"`
+	Description  string    `json:"description"`
+	DOI          string    `json:"doi"`
+	Licence      string    `json:"licence"`
+	LicenceURL   string    `json:"licence_url"`
+	Publisher    string    `json:"publisher"`
+	Release      string    `json:"release"`
+	Size         int64     `json:"size"`
+	Title        string    `json:"title"`
+	URL          string    `json:"url"`
+}
+
+// RowChange is a commit which added, changed, or deleted a table row.  Data holds the row after the change, and is
+// empty for deletions
+type RowChange struct {
+	Action      DiffType               `json:"action"`
+	AuthorEmail string                 `json:"author_email"`
+	AuthorName  string                 `json:"author_name"`
+	CommitID    string                 `json:"commit_id"`
+	Data        map[string]interface{} `json:"data"`
+	Message     string                 `json:"message"`
+	Timestamp   time.Time              `json:"timestamp"`
+}
+
+// RowProvenance is the history of a table row in a database branch.  When Complete is false, the history goes back
+// further than was looked at, so the commit which introduced the row may not be known
+type RowProvenance struct {
+	Changes      []RowChange       `json:"changes"`
+	Complete     bool              `json:"complete"`
+	Exists       bool              `json:"exists"`
+	Introduced   *RowChange        `json:"introduced"`
+	Key          map[string]string `json:"key"`
+	LastModified *RowChange        `json:"last_modified"`
+	Table        string            `json:"table"`
+}
+
 type SQLiteRecordSet struct {
 	ColCount          int
 	ColNames          []string
@@ -95,3 +166,16 @@ type UserInfo struct {
 	LastModified time.Time
 	Username     string
 }
+
+// UserProfile holds the public profile of a user
+type UserProfile struct {
+	AvatarURL     string    `json:"avatar_url"`
+	Bio           string    `json:"bio"`
+	Databases     []string  `json:"databases"`
+	DateJoined    time.Time `json:"date_joined"`
+	DisplayName   string    `json:"display_name"`
+	Links         []string  `json:"links"`
+	LiveDatabases []string  `json:"live_databases"`
+	Pinned        []string  `json:"pinned"`
+	Username      string    `json:"username"`
+}
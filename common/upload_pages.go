@@ -0,0 +1,181 @@
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// UploadPagesResponse adds a new commit to an existing database, from just the pages of the database file which have
+// changed since the commit it's based on.  The new database file is rebuilt on the server from the file of that commit,
+// and its SHA256 checked against the one given by the client before it's added.  This saves uploading the whole file
+// again when only a small part of a large database has changed.
+//
+// The changed pages are sent in the "pages" form file, as a series of records each holding the page number (4 bytes,
+// big endian, starting from 1) followed by the page data.  The "pagesize" field is the page size of the database,
+// "size" is the size in bytes of the new database file, and "dbshasum" is its SHA256.  The other form fields are the
+// same as for UploadResponse
+func UploadPagesResponse(r *http.Request, loggedInUser, targetUser, targetDB, commitID, serverSw string) (retMsg map[string]string, httpStatus int, err error) {
+	// Validate the database name
+	err = ValidateDB(targetDB)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	// The changed pages are applied to an existing commit of the database, so one is needed
+	if commitID == "" {
+		commitID, err = GetFormCommit(r)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+	}
+	if commitID == "" {
+		return nil, http.StatusBadRequest, errors.New("The commit the changed pages are based on is needed")
+	}
+	exists, err := database.CheckDBPermissions(loggedInUser, targetUser, targetDB, true)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if !exists {
+		return nil, http.StatusNotFound, fmt.Errorf("Database not found")
+	}
+	exists, err = database.CommitExists(targetUser, targetDB, commitID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if !exists {
+		return nil, http.StatusNotFound, fmt.Errorf("Commit '%s' doesn't exist in database '%s/%s'", commitID,
+			targetUser, targetDB)
+	}
+
+	// Databases encrypted by the client can't be rebuilt on the server, as their pages can't be lined up
+	clientEncrypted, err := GetFormEncrypted(r)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if clientEncrypted {
+		return nil, http.StatusBadRequest, errors.New("Encrypted databases need to be uploaded in full")
+	}
+
+	// Validate the page size, new database size, and database SHA256
+	pageSize, err := strconv.ParseInt(r.FormValue("pagesize"), 10, 64)
+	if err != nil || pageSize < 512 || pageSize > 65536 || pageSize&(pageSize-1) != 0 {
+		return nil, http.StatusBadRequest, fmt.Errorf("Invalid page size value: '%v'", r.FormValue("pagesize"))
+	}
+	newSize, err := strconv.ParseInt(r.FormValue("size"), 10, 64)
+	if err != nil || newSize < pageSize || newSize%pageSize != 0 {
+		return nil, http.StatusBadRequest, fmt.Errorf("Invalid database size value: '%v'", r.FormValue("size"))
+	}
+	dbSHA256 := r.FormValue("dbshasum")
+	if err = Validate.Var(dbSHA256, "required,hexadecimal,min=64,max=64"); err != nil {
+		return nil, http.StatusBadRequest, errors.New("The SHA256 of the new database is needed, to check it was " +
+			"rebuilt correctly")
+	}
+	maxSize, err := database.MaxUploadSizeForUser(loggedInUser)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if maxSize != -1 && newSize > maxSize {
+		return nil, http.StatusBadRequest, fmt.Errorf("Database is too large. Maximum database upload size is %d MB, "+
+			"yours is %d MB", maxSize/1024/1024, newSize/1024/1024)
+	}
+
+	pages, _, err := r.FormFile("pages")
+	if err != nil {
+		log.Printf("Uploading changed pages failed: %v", err)
+		return nil, http.StatusBadRequest, fmt.Errorf("Something went wrong when grabbing the page data: '%s'",
+			err.Error())
+	}
+	defer pages.Close()
+
+	// Start with a copy of the database file for the base commit
+	bucket, id, err := SQLiteLocation(targetUser, targetDB, commitID, loggedInUser)
+	if err != nil {
+		if errors.Is(err, ErrClientEncrypted) {
+			return nil, http.StatusBadRequest, errors.New("Encrypted databases need to be uploaded in full")
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+	basePath, err := RetrieveDatabaseFile(bucket, id)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	newFile, err := os.CreateTemp(config.Conf.DiskCache.Directory, "dbhub-pages-*.db")
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	newFile.Close()
+	defer os.Remove(newFile.Name())
+	if err = copyFile(basePath, newFile.Name()); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	f, err := os.OpenFile(newFile.Name(), os.O_RDWR, 0)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	defer f.Close()
+
+	// Apply the changed pages to it
+	httpStatus, err = applyPages(f, pages, pageSize, newSize)
+	if err != nil {
+		return
+	}
+
+	// Make sure the rebuilt file is the same as the one the client has
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != dbSHA256 {
+		return nil, http.StatusBadRequest, errors.New("The database rebuilt from the changed pages doesn't match " +
+			"the given SHA256.  Please push the whole file instead")
+	}
+
+	// Add the rebuilt database in the same way as a full upload
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return uploadResponse(r, f, loggedInUser, targetUser, targetDB, commitID, serverSw)
+}
+
+// applyPages writes changed database pages into a database file, after resizing it to the new database size
+func applyPages(f *os.File, pages io.Reader, pageSize, newSize int64) (httpStatus int, err error) {
+	if err = f.Truncate(newSize); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	numPages := newSize / pageSize
+	buf := make([]byte, 4+pageSize)
+	for {
+		_, err = io.ReadFull(pages, buf)
+		if err == io.EOF {
+			break
+		}
+		if err == io.ErrUnexpectedEOF {
+			return http.StatusBadRequest, errors.New("The page data ends part way through a page")
+		}
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+		pageNum := int64(binary.BigEndian.Uint32(buf[:4]))
+		if pageNum < 1 || pageNum > numPages {
+			return http.StatusBadRequest, fmt.Errorf("Page number %d is outside of the database", pageNum)
+		}
+		if _, err = f.WriteAt(buf[4:], (pageNum-1)*pageSize); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+	return http.StatusOK, nil
+}
@@ -2,6 +2,7 @@ package common
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"html"
@@ -117,6 +118,19 @@ func GetFormCommit(r *http.Request) (commitID string, err error) {
 	return commitID, nil
 }
 
+// GetFormEncrypted returns whether an uploaded database was encrypted by the user before uploading it
+func GetFormEncrypted(r *http.Request) (encrypted bool, err error) {
+	e := r.FormValue("encrypted")
+	if e == "" {
+		return
+	}
+	encrypted, err = strconv.ParseBool(e)
+	if err != nil {
+		err = fmt.Errorf("Error when converting encrypted value '%s' to boolean: %v", html.EscapeString(e), err)
+	}
+	return
+}
+
 // GetFormLicence returns the licence name (if any) present in the form data
 func GetFormLicence(r *http.Request) (licenceName string, err error) {
 	// If no licence name given, return an empty string
@@ -267,6 +281,27 @@ func GetFormTable(r *http.Request, allowGet bool) (table string, err error) {
 	return table, nil
 }
 
+// GetFormTables returns the list of table names present in the form data, as a JSON array in the "tables" field.  The
+// list is empty when the field wasn't given
+func GetFormTables(r *http.Request) (tables []string, err error) {
+	t := r.FormValue("tables")
+	if t == "" {
+		return nil, nil
+	}
+	err = json.Unmarshal([]byte(t), &tables)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid tables value.  It needs to be a JSON array of table names")
+	}
+	for _, table := range tables {
+		err = ValidatePGTable(table)
+		if err != nil {
+			log.Printf("Validation failed for table name: %s", err)
+			return nil, err
+		}
+	}
+	return
+}
+
 // GetFormUDC returns the username, database, and commit (if any) present in the form data
 func GetFormUDC(r *http.Request) (userName string, dbName string, commitID string, err error) {
 	// Extract the username
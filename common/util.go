@@ -2,6 +2,7 @@ package common
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
@@ -14,18 +15,28 @@ import (
 	"os/signal"
 	"runtime"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/sqlitebrowser/dbhub.io/common/config"
 	"github.com/sqlitebrowser/dbhub.io/common/database"
-
-	"github.com/minio/minio-go"
 )
 
+// How long the background loops get to finish their work when the daemon is shutting down
+const backgroundLoopsShutdownTimeout = 30 * time.Second
+
 var (
+	// BackgroundLoops is used by the background loops to report they've finished, so the daemon can wait for them
+	// when shutting down
+	BackgroundLoops sync.WaitGroup
+
 	// Our custom http error logger
 	httpErrorLogger *log.Logger
+
+	// ShutdownContext is cancelled when the daemon is shutting down, to let the background loops know they should
+	// finish up
+	ShutdownContext, shutdown = context.WithCancel(context.Background())
 )
 
 // FilteringErrorLogWriter is a custom error logger for our http servers, to filter out the copious
@@ -50,11 +61,17 @@ func HttpErrorLog() *log.Logger {
 	return httpErrorLogger
 }
 
+// AddDatabaseOptions holds the less common settings for AddDatabase.  The zero value suits most uploads
+type AddDatabaseOptions struct {
+	ClientEncrypted bool // The database was encrypted by its owner, so the server can't read it
+	MergeRequest    bool // The commit merges a merge request, which was checked against the schema change policy already
+}
+
 // AddDatabase is handles database upload processing
 func AddDatabase(loggedInUser, dbOwner, dbName string, createBranch bool, branchName,
 	commitID string, accessType database.SetAccessType, licenceName, commitMsg, sourceURL string, newDB io.Reader,
 	lastModified, commitTime time.Time, authorName, authorEmail, committerName, committerEmail string,
-	otherParents []string, dbSha string) (numBytes int64, newCommitID string, calculatedDbSha string, err error) {
+	otherParents []string, dbSha string, opts AddDatabaseOptions) (numBytes int64, newCommitID string, calculatedDbSha string, err error) {
 
 	// Check if the database already exists in the system
 	exists, err := database.CheckDBExists(dbOwner, dbName)
@@ -75,11 +92,38 @@ func AddDatabase(loggedInUser, dbOwner, dbName string, createBranch bool, branch
 		return 0, "", "", errors.New("You cannot upload a database for another user")
 	}
 
+	// Archived databases don't accept new commits
+	if exists {
+		archived, err := database.CheckDBArchived(dbOwner, dbName)
+		if err != nil {
+			return 0, "", "", err
+		}
+		if archived {
+			return 0, "", "", database.ErrDBArchived
+		}
+	}
+
+	// The server can't read databases encrypted by their owner, so they can't be mixed with unencrypted ones
+	if exists {
+		wasEncrypted, err := database.CheckDBClientEncrypted(dbOwner, dbName)
+		if err != nil {
+			return 0, "", "", err
+		}
+		if wasEncrypted && !opts.ClientEncrypted {
+			return 0, "", "", errors.New("This database was encrypted before being uploaded, so new commits need " +
+				"to be encrypted too")
+		}
+		if !wasEncrypted && opts.ClientEncrypted {
+			return 0, "", "", errors.New("This database wasn't encrypted before being uploaded, so new commits " +
+				"can't be encrypted either")
+		}
+	}
+
 	// Store the incoming database to a temporary file on disk, and sanity check it
 	var sha string
 	var sTbls []string
 	var tempDB *os.File
-	numBytes, tempDB, sha, sTbls, err = WriteDBtoDisk(loggedInUser, dbOwner, dbName, newDB)
+	numBytes, tempDB, sha, sTbls, err = WriteDBtoDisk(loggedInUser, dbOwner, dbName, newDB, opts.ClientEncrypted)
 	if err != nil {
 		return
 	}
@@ -91,6 +135,26 @@ func AddDatabase(loggedInUser, dbOwner, dbName string, createBranch bool, branch
 		return
 	}
 
+	// Check the new commit against the validation rules of the database.  Commits failing a blocking rule aren't
+	// accepted
+	var validation *database.ValidationResult
+	if exists && !opts.ClientEncrypted {
+		rules, err := database.ValidationRules(dbOwner, dbName)
+		if err != nil {
+			return 0, "", "", err
+		}
+		if len(rules) > 0 {
+			z, err := ValidateDatabaseFile(tempDB.Name(), "", rules)
+			if err != nil {
+				return 0, "", "", err
+			}
+			if msg := ValidationBlockingFailure(z); msg != "" {
+				return 0, "", "", ValidationFailedError{Message: msg}
+			}
+			validation = &z
+		}
+	}
+
 	// Figure out the branch structure to use
 	var defBranch string
 	needDefaultBranchCreated := false
@@ -301,6 +365,15 @@ func AddDatabase(loggedInUser, dbOwner, dbName string, createBranch bool, branch
 	// Create the commit ID for the new upload
 	c.ID = CreateCommitID(c)
 
+	// Check the new commit against the schema change policy of its branch.  Merge requests have already been checked
+	// against it before being merged
+	if exists && !opts.ClientEncrypted && !opts.MergeRequest && c.Parent != "" {
+		err = SchemaPolicyCheck(dbOwner, dbName, branchName, c.Parent, tempDB.Name())
+		if err != nil {
+			return
+		}
+	}
+
 	// If the database already exists, count the number of commits in the new branch
 	commitCount := 1
 	if exists {
@@ -340,17 +413,43 @@ func AddDatabase(loggedInUser, dbOwner, dbName string, createBranch bool, branch
 	b.CommitCount = commitCount
 	branches[branchName] = b
 	err = StoreDatabase(dbOwner, dbName, branches, c, public, tempDB, sha, numBytes, "",
-		"", needDefaultBranchCreated, branchName, sourceURL)
+		"", needDefaultBranchCreated, branchName, sourceURL, opts.ClientEncrypted)
 	if err != nil {
 		return
 	}
 
+	// Store the outcome of the validation rules, and post it as the status of the new commit
+	if validation != nil {
+		validation.Commit = c.ID
+		err = database.ValidationResultSave(dbOwner, dbName, *validation)
+		if err != nil {
+			return
+		}
+		state := "success"
+		if !validation.Passed {
+			state = "failure"
+		}
+		err = database.CommitStatusSave(dbOwner, dbName, database.CommitStatus{
+			Commit:      c.ID,
+			Context:     ValidationStatusContext,
+			Creator:     loggedInUser,
+			Description: ValidationSummary(*validation),
+			State:       state,
+		})
+		if err != nil {
+			return
+		}
+	}
+
 	// If the database already existed, update its contributor count
 	if exists {
 		err = database.UpdateContributorsCount(dbOwner, dbName)
 		if err != nil {
 			return
 		}
+
+		// Let the owner know if the new commit has grown the database by more than they expect
+		sizeGrowthCheck(dbOwner, dbName, branchName, c)
 	}
 
 	// If a new branch was created, then update the branch count for the database
@@ -905,8 +1004,10 @@ func DownloadDatabase(w http.ResponseWriter, r *http.Request, dbOwner, dbName, c
 
 	// Depending on whether this is a live database there's different ways to get a handle
 	// to the minio file
-	var userDB *minio.Object
+	var userDB BlobObject
 	var logStr string
+	var lastModified time.Time
+	var clientEncrypted bool
 	if isLive {
 		// It's a live database, so we tell the job queue backend to back it up into Minio, which we then provide to the user
 		err = LiveBackup(liveNode, loggedInUser, dbOwner, dbName)
@@ -932,11 +1033,17 @@ func DownloadDatabase(w http.ResponseWriter, r *http.Request, dbOwner, dbName, c
 	} else {
 		// Verify the given database exists and is ok to be downloaded (and get the Minio bucket + id while at it)
 		var bucket, id string
-		bucket, id, _, err = MinioLocation(dbOwner, dbName, commitID, loggedInUser)
+		bucket, id, lastModified, clientEncrypted, err = minioLocation(dbOwner, dbName, commitID, loggedInUser)
 		if err != nil {
 			return
 		}
 
+		// The database file is stored under its SHA256, which makes a good ETag.  If the client already has this
+		// version of the database there's no need to send it again
+		if NotModified(w, r, `"`+bucket+id+`"`, lastModified) {
+			return
+		}
+
 		// Get a handle from Minio for the database object
 		userDB, err = MinioHandle(bucket, id)
 		if err != nil {
@@ -952,12 +1059,24 @@ func DownloadDatabase(w http.ResponseWriter, r *http.Request, dbOwner, dbName, c
 		MinioHandleClose(userDB)
 	}()
 
-	// Get the file details
-	stat, err := userDB.Stat()
+	// Get the file size
+	size, err := userDB.Size()
 	if err != nil {
 		return
 	}
 
+	// Range requests retrieve just part of the database, for resuming downloads or reading the database page by page.
+	// The download was already recorded when it was started, so they're not logged or counted again.  Live databases
+	// are backed up again for each request, so they don't support ranges as those could come from different files
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, dbName))
+	if !isLive {
+		w.Header().Set("Accept-Ranges", "bytes")
+		if r.Header.Get("Range") != "" {
+			bytesWritten = ServeDatabaseRange(w, r, userDB, lastModified)
+			return
+		}
+	}
+
 	// Was a user agent part of the request?
 	var userAgent string
 	if ua, ok := r.Header["User-Agent"]; ok {
@@ -965,15 +1084,20 @@ func DownloadDatabase(w http.ResponseWriter, r *http.Request, dbOwner, dbName, c
 	}
 
 	// Make a record of the download
-	err = database.LogDownload(dbOwner, dbName, loggedInUser, r.RemoteAddr, sourceSw, userAgent, time.Now(), logStr)
+	err = database.LogDownload(dbOwner, dbName, loggedInUser, r.RemoteAddr, sourceSw, userAgent, RequestCountry(r),
+		RequestReferrer(r), time.Now(), logStr)
 	if err != nil {
 		return
 	}
 
 	// Send the database to the user
-	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, dbName))
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", stat.Size))
-	w.Header().Set("Content-Type", "application/x-sqlite3")
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", size))
+	if clientEncrypted {
+		// Databases encrypted by their owner are returned as is, and aren't readable as SQLite databases
+		w.Header().Set("Content-Type", "application/octet-stream")
+	} else {
+		w.Header().Set("Content-Type", "application/x-sqlite3")
+	}
 	bytesWritten, err = io.Copy(w, userDB)
 	if err != nil {
 		log.Printf("Error returning DB file: %v", err)
@@ -1046,6 +1170,57 @@ func IsCommitInBranchHistory(dbOwner, dbName, branchName, commitID string) (bool
 	return found, nil
 }
 
+// NotModified sets the ETag and Last-Modified headers of a response, then checks them against the conditional headers
+// of the request.  If the client already has the current version, a "304 Not Modified" response is sent and true is
+// returned, after which nothing further should be written.  POST requests are treated the same as GET ones, as that's
+// what the API uses for retrieving data
+func NotModified(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPost {
+		return false
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since when both are given (RFC 9110, section 13.2.2)
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if !etagMatches(inm, etag) {
+			return false
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err != nil || lastModified.Truncate(time.Second).After(t) {
+			return false
+		}
+	} else {
+		return false
+	}
+
+	w.Header().Del("Content-Length")
+	w.Header().Del("Content-Type")
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatches checks whether an ETag is in the list given in an If-None-Match header.  This uses weak comparison, so
+// the "W/" prefix of weak ETags is ignored
+func etagMatches(header, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
 // RandomString generates a random alphanumeric string of the desired length
 func RandomString(length int) string {
 	rand.Seed(time.Now().UnixNano())
@@ -1088,6 +1263,20 @@ func SignalHandler(done *chan struct{}) {
 		}
 	}
 
+	// Let the background loops finish the work they're doing, so it isn't lost
+	shutdown()
+	loopsDone := make(chan struct{})
+	go func() {
+		BackgroundLoops.Wait()
+		close(loopsDone)
+	}()
+	select {
+	case <-loopsDone:
+	case <-time.After(backgroundLoopsShutdownTimeout):
+		log.Printf("%s: background loops still running after %v.  Exiting anyway", config.Conf.Live.Nodename,
+			backgroundLoopsShutdownTimeout)
+	}
+
 	// Shut down connections
 	database.Disconnect()
 
@@ -1096,55 +1285,35 @@ func SignalHandler(done *chan struct{}) {
 	return
 }
 
-// StatusUpdateCheck checks if a status update for the user exists for a given discussion or MR, and if so then removes it
+// StatusUpdateCheck checks if there are unread status updates for the user about a given discussion or MR, and if so
+// then marks them as read.  It returns the number of unread status updates remaining for the user
 func StatusUpdateCheck(dbOwner, dbName string, thisID int, userName string) (numStatusUpdates int, err error) {
-	var lst map[string][]database.StatusUpdateEntry
-	lst, err = database.StatusUpdates(userName)
+	changed, err := database.StatusUpdatesMarkDiscussionRead(userName, dbOwner, dbName, thisID)
 	if err != nil {
 		return
 	}
-	db := fmt.Sprintf("%s/%s", dbOwner, dbName)
-	b, ok := lst[db]
-	if ok {
-		for i, j := range b {
-			if j.DiscID == thisID {
-				// Delete the matching status update
-				b = append(b[:i], b[i+1:]...)
-				if len(b) > 0 {
-					lst[db] = b
-				} else {
-					delete(lst, db)
-				}
-
-				// Store the updated list for the user
-				err = database.StoreStatusUpdates(userName, lst)
-				if err != nil {
-					return
-				}
-
-				// Update the status updates # stored in memcached
-				for _, z := range lst {
-					numStatusUpdates += len(z)
-				}
-				err = SetUserStatusUpdates(userName, numStatusUpdates)
-				if err != nil {
-					log.Printf("Error when updating user status updates # in memcached: %v", err)
-					return
-				}
-				return
-			}
-		}
+	if !changed {
+		return UserStatusUpdates(userName)
 	}
+	return StatusUpdatesRecount(userName)
+}
 
-	// Return the # of status updates for the user
-	for _, z := range lst {
-		numStatusUpdates += len(z)
+// StatusUpdatesRecount counts the unread status updates for a user, and updates the number stored in memcached
+func StatusUpdatesRecount(userName string) (numStatusUpdates int, err error) {
+	numStatusUpdates, err = database.StatusUpdatesUnreadCount(userName)
+	if err != nil {
+		return
+	}
+	err = SetUserStatusUpdates(userName, numStatusUpdates)
+	if err != nil {
+		log.Printf("Error when updating user status updates # in memcached: %v", err)
 	}
 	return
 }
 
-// WriteDBtoDisk gets an uploaded database file from the user's incoming request, and writes it to a local temporary file
-func WriteDBtoDisk(loggedInUser, dbOwner, dbName string, newDB io.Reader) (numBytes int64, tempDB *os.File, sha string, sTbls []string, err error) {
+// WriteDBtoDisk gets an uploaded database file from the user's incoming request, and writes it to a local temporary
+// file.  Databases encrypted by the user before uploading can't be opened, so aren't sanity checked
+func WriteDBtoDisk(loggedInUser, dbOwner, dbName string, newDB io.Reader, clientEncrypted bool) (numBytes int64, tempDB *os.File, sha string, sTbls []string, err error) {
 	// Create a temporary file to store the database in
 	tempDB, err = os.CreateTemp(config.Conf.DiskCache.Directory, "dbhub-upload-")
 	if err != nil {
@@ -1169,9 +1338,11 @@ func WriteDBtoDisk(loggedInUser, dbOwner, dbName string, newDB io.Reader) (numBy
 	}
 
 	// Sanity check the uploaded database, and get the list of tables in the database
-	sTbls, err = SQLiteSanityCheck(tempDBName)
-	if err != nil {
-		return
+	if !clientEncrypted {
+		sTbls, err = SQLiteSanityCheck(tempDBName)
+		if err != nil {
+			return
+		}
 	}
 
 	// Return to the start of the temporary file
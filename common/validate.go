@@ -17,6 +17,7 @@ var (
 	regexLicence         = regexp.MustCompile(`^[a-z,A-Z,0-9,\.,\-,\_,\(,\),\ ]+$`)
 	regexLicenceFullName = regexp.MustCompile(`^[a-z,A-Z,0-9,\.,\-,\_,\(,\),\ ]+$`)
 	regexMarkDownSource  = regexp.MustCompile(`^[a-z,A-Z,0-9` + ",`," + `‘,’,“,”,\.,\-,\_,\/,\(,\),\[,\],\\,\!,\#,\',\",\@,\$,\*,\%,\^,\&,\+,\=,\:,\;,\<,\>,\,,\?,\~,\|,\ ,\012,\015]+$`)
+	regexOrigin          = regexp.MustCompile(`^https?://(\*\.)?[a-zA-Z0-9\-]+(\.[a-zA-Z0-9\-]+)*(:[0-9]{1,5})?$`)
 	regexPGTable         = regexp.MustCompile(`^[a-z,A-Z,0-9,\.,\-,\_,\(,\),\ ]+$`)
 	regexUsername        = regexp.MustCompile(`^[a-z,A-Z,0-9,\.,\-,\_]+$`)
 	regexUuid            = regexp.MustCompile(`^[0-9a-fA-F]{8}\b-[0-9a-fA-F]{4}\b-[0-9a-fA-F]{4}\b-[0-9a-fA-F]{4}\b-[0-9a-fA-F]{12}$`)
@@ -200,6 +201,15 @@ func ReservedUsernamesCheck(userName string) error {
 	return nil
 }
 
+// ValidateAlertRuleName validates the provided name of an alert rule
+func ValidateAlertRuleName(name string) error {
+	err := Validate.Var(name, "required,visname,min=1,max=63")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 // ValidateBranchName validates the provided branch, release, or tag name
 func ValidateBranchName(fieldName string) error {
 	err := Validate.Var(fieldName, "branchortagname,min=1,max=32") // 32 seems a reasonable first guess
@@ -209,6 +219,15 @@ func ValidateBranchName(fieldName string) error {
 	return nil
 }
 
+// ValidateCollectionName validates the provided name of a database collection
+func ValidateCollectionName(name string) error {
+	err := Validate.Var(name, "required,visname,min=1,max=63")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 // ValidateCommitID validates the provided commit ID
 func ValidateCommitID(fieldName string) error {
 	err := Validate.Var(fieldName, "hexadecimal,min=64,max=64") // Always 64 alphanumeric characters
@@ -218,6 +237,15 @@ func ValidateCommitID(fieldName string) error {
 	return nil
 }
 
+// ValidateDashboardName validates the provided name of a dashboard
+func ValidateDashboardName(name string) error {
+	err := Validate.Var(name, "required,visname,min=1,max=63")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 // ValidateDB validates the database name
 func ValidateDB(dbName string) error {
 	err := Validate.Var(dbName, "required,dbname,min=1,max=256") // 256 char limit seems reasonable
@@ -254,6 +282,19 @@ func ValidateFieldName(fieldName string) error {
 	return nil
 }
 
+// ValidateLabel validates the provided name and colour of a discussion label
+func ValidateLabel(name, colour string) error {
+	err := Validate.Var(name, "required,visname,min=1,max=50")
+	if err != nil {
+		return err
+	}
+	err = Validate.Var(colour, "required,hexcolor")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 // ValidateLicence validates the provided licence name (ID)
 func ValidateLicence(licence string) error {
 	err := Validate.Var(licence, "licence,min=1,max=13") // 13 is the length of our longest licence name (thus far)
@@ -281,6 +322,24 @@ func ValidateMarkdown(fieldName string) error {
 	return nil
 }
 
+// ValidateMilestoneTitle validates the provided title of a discussion milestone
+func ValidateMilestoneTitle(title string) error {
+	err := Validate.Var(title, "required,discussiontitle,max=120")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ValidateOrigin validates an origin which browsers may call the API from, eg "https://example.org".  The host can
+// start with "*." to allow all of its subdomains
+func ValidateOrigin(origin string) error {
+	if len(origin) > 255 || !regexOrigin.MatchString(origin) {
+		return fmt.Errorf("Invalid origin '%s'.  It needs to look like 'https://example.org'", origin)
+	}
+	return nil
+}
+
 // ValidatePGTable validates the provided PostgreSQL table name
 func ValidatePGTable(table string) error {
 	// TODO: Improve this to work with all valid SQLite identifiers
@@ -304,6 +363,33 @@ func ValidateDiscussionTitle(fieldName string) error {
 	return nil
 }
 
+// ValidateReportName validates the provided name of a scheduled report
+func ValidateReportName(name string) error {
+	err := Validate.Var(name, "required,visname,min=1,max=63")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ValidateSavedQueryName validates the provided name of a saved query
+func ValidateSavedQueryName(name string) error {
+	err := Validate.Var(name, "required,visname,min=1,max=63")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ValidateStoryName validates the provided name of a data story
+func ValidateStoryName(name string) error {
+	err := Validate.Var(name, "required,visname,min=1,max=63")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 // ValidateUser validates the provided username
 func ValidateUser(user string) error {
 	err := Validate.Var(user, "required,username,min=2,max=63")
@@ -336,6 +422,15 @@ func ValidateUuid(uuid string) error {
 	return nil
 }
 
+// ValidateValidationRuleName validates the provided name of a database validation rule
+func ValidateValidationRuleName(name string) error {
+	err := Validate.Var(name, "required,visname,min=1,max=63")
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
 // ValidateVisualisationName validates the provided name of a saved visualisation query
 func ValidateVisualisationName(name string) error {
 	err := Validate.Var(name, "required,visname,min=1,max=63")
@@ -0,0 +1,185 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	sqlite "github.com/gwenn/gosqlite"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+const (
+	// ValidationStatusContext is the commit status context the outcome of checking a commit against the validation rules
+	// of its database is posted as
+	ValidationStatusContext = "dbhub/validation"
+
+	// validationTimeout is the longest a single validation rule is allowed to run
+	validationTimeout = time.Minute
+)
+
+// ValidationRuleTypes are the types of validation rule a database can have
+var ValidationRuleTypes = []string{"assertion", "not_null", "unique", "row_count"}
+
+// ValidationFailedError is returned when a new commit fails one of the blocking validation rules of its database
+type ValidationFailedError struct {
+	Message string
+}
+
+func (e ValidationFailedError) Error() string {
+	return e.Message
+}
+
+// ValidateDatabaseFile checks a SQLite database file against a set of validation rules.  The result passes when none
+// of the rules fail, and a rule which can't be run (eg as its table is missing) counts as failing
+func ValidateDatabaseFile(dbPath, commitID string, rules []database.ValidationRule) (result database.ValidationResult, err error) {
+	sdb, err := openValidationDatabase(dbPath)
+	if err != nil {
+		return
+	}
+	defer sdb.Close()
+
+	result.Commit = commitID
+	result.DateCreated = time.Now().UTC()
+	result.Passed = true
+	result.Rules = []database.ValidationRuleResult{}
+	for _, r := range rules {
+		msg := checkValidationRule(sdb, r)
+		result.Rules = append(result.Rules, database.ValidationRuleResult{
+			Blocking: r.Blocking,
+			Message:  msg,
+			Name:     r.Name,
+			Passed:   msg == "",
+		})
+		if msg != "" {
+			result.Passed = false
+		}
+	}
+	return
+}
+
+// ValidationBlockingFailure returns a description of the blocking rules a validation result failed, or an empty string
+// when there aren't any
+func ValidationBlockingFailure(result database.ValidationResult) string {
+	var failed []string
+	for _, r := range result.Rules {
+		if r.Blocking && !r.Passed {
+			failed = append(failed, fmt.Sprintf("'%s' (%s)", r.Name, r.Message))
+		}
+	}
+	if len(failed) == 0 {
+		return ""
+	}
+	return "The database failed these validation rules: " + strings.Join(failed, ", ")
+}
+
+// ValidationSummary returns a short description of a validation result, suitable for a commit status
+func ValidationSummary(result database.ValidationResult) string {
+	failed := 0
+	for _, r := range result.Rules {
+		if !r.Passed {
+			failed++
+		}
+	}
+	if failed == 0 {
+		return fmt.Sprintf("All %d validation rules passed", len(result.Rules))
+	}
+	return fmt.Sprintf("%d of %d validation rules failed", failed, len(result.Rules))
+}
+
+// checkValidationRule runs a validation rule against a database, returning why it failed.  The returned string is
+// empty when the rule passed
+func checkValidationRule(sdb *sqlite.Conn, r database.ValidationRule) string {
+	// Stop the rule if it runs for too long
+	timer := time.AfterFunc(validationTimeout, sdb.Interrupt)
+	defer timer.Stop()
+
+	switch r.Type {
+	case "assertion":
+		query := strings.TrimRight(strings.TrimSpace(r.SQL), "; \t\n")
+		stmt, err := sdb.Prepare(query)
+		if err != nil {
+			return fmt.Sprintf("Couldn't run the query: %s", err)
+		}
+		readOnly := stmt.ReadOnly() && stmt.ColumnCount() > 0 && strings.TrimSpace(stmt.Tail()) == ""
+		stmt.Finalize()
+		if !readOnly {
+			return "The query needs to be a single SELECT statement"
+		}
+		found, err := sdb.Exists(query)
+		if err != nil {
+			return fmt.Sprintf("Couldn't run the query: %s", err)
+		}
+		if found {
+			return "The query returned rows"
+		}
+	case "not_null":
+		found, err := sdb.Exists(fmt.Sprintf("SELECT 1 FROM %s WHERE %s IS NULL LIMIT 1", EscapeId(r.Table),
+			EscapeId(r.Column)))
+		if err != nil {
+			return fmt.Sprintf("Couldn't check the column: %s", err)
+		}
+		if found {
+			return fmt.Sprintf("Column '%s' of table '%s' has NULL values", r.Column, r.Table)
+		}
+	case "unique":
+		col := EscapeId(r.Column)
+		found, err := sdb.Exists(fmt.Sprintf("SELECT 1 FROM %s WHERE %s IS NOT NULL GROUP BY %s HAVING count(*) > 1 "+
+			"LIMIT 1", EscapeId(r.Table), col, col))
+		if err != nil {
+			return fmt.Sprintf("Couldn't check the column: %s", err)
+		}
+		if found {
+			return fmt.Sprintf("Column '%s' of table '%s' has duplicate values", r.Column, r.Table)
+		}
+	case "row_count":
+		var rows int64
+		err := sdb.OneValue("SELECT count(*) FROM "+EscapeId(r.Table), &rows)
+		if err != nil {
+			return fmt.Sprintf("Couldn't count the rows: %s", err)
+		}
+		if r.MinRows != nil && rows < *r.MinRows {
+			return fmt.Sprintf("Table '%s' has %d rows, fewer than the minimum of %d", r.Table, rows, *r.MinRows)
+		}
+		if r.MaxRows != nil && rows > *r.MaxRows {
+			return fmt.Sprintf("Table '%s' has %d rows, more than the maximum of %d", r.Table, rows, *r.MaxRows)
+		}
+	default:
+		return fmt.Sprintf("Unknown rule type '%s'", r.Type)
+	}
+	return ""
+}
+
+// openValidationDatabase opens a SQLite database file read only for checking against validation rules, with the
+// defensive precautions recommended for running user provided SQL: https://www.sqlite.org/security.html
+func openValidationDatabase(dbPath string) (sdb *sqlite.Conn, err error) {
+	sdb, err = sqlite.Open(dbPath, sqlite.OpenReadOnly)
+	if err != nil {
+		log.Printf("Couldn't open database for validation: %s", err)
+		return nil, errors.New("Internal server error")
+	}
+	defer func() {
+		if err != nil {
+			sdb.Close()
+			sdb = nil
+		}
+	}()
+	if err = sdb.EnableExtendedResultCodes(true); err != nil {
+		return
+	}
+	var enabled bool
+	if enabled, err = sdb.EnableDefensive(true); !enabled || err != nil {
+		log.Printf("Couldn't enable the defensive flag for validation: %v", err)
+		return sdb, errors.New("Internal server error")
+	}
+	if enabled, err = sdb.EnableTrustedSchema(false); enabled || err != nil {
+		log.Printf("Couldn't disable the trusted schema flag for validation: %v", err)
+		return sdb, errors.New("Internal server error")
+	}
+
+	// Only allow the rules to read from the database
+	err = sdb.SetAuthorizer(AuthorizerSelect, "SELECT authorizer")
+	return
+}
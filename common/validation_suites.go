@@ -0,0 +1,427 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+const (
+	// JSONSchemaDialect is the JSON Schema version used for exported validation rules
+	JSONSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+	// ValidationSuiteMaxSize is the largest expectation suite or JSON Schema accepted for importing validation rules
+	ValidationSuiteMaxSize = 1024 * 1024
+)
+
+// ValidationSuiteFormats are the formats validation rules can be imported from and exported to
+var ValidationSuiteFormats = []string{"greatexpectations", "jsonschema"}
+
+// GreatExpectationsSuite is a Great Expectations expectation suite for a table.  See
+// https://docs.greatexpectations.io/docs/reference/learn/terms/expectation_suite/
+type GreatExpectationsSuite struct {
+	Expectations []GreatExpectation `json:"expectations"`
+	Name         string             `json:"expectation_suite_name"`
+}
+
+// GreatExpectation is a single expectation of a Great Expectations expectation suite
+type GreatExpectation struct {
+	Kwargs map[string]interface{} `json:"kwargs"`
+	Meta   map[string]interface{} `json:"meta,omitempty"`
+	Type   string                 `json:"expectation_type"`
+}
+
+// JSONSchemaTable is a JSON Schema describing the rows of a table, as an array of objects with a property for each
+// column
+type JSONSchemaTable struct {
+	Items    JSONSchemaRow `json:"items"`
+	MaxItems *int64        `json:"maxItems,omitempty"`
+	MinItems *int64        `json:"minItems,omitempty"`
+	Schema   string        `json:"$schema"`
+	Title    string        `json:"title"`
+	Type     string        `json:"type"`
+}
+
+// JSONSchemaRow is the part of a JSON Schema describing a row of a table
+type JSONSchemaRow struct {
+	Properties map[string]JSONSchemaColumn `json:"properties"`
+	Type       string                      `json:"type"`
+}
+
+// JSONSchemaColumn is the part of a JSON Schema describing a column of a table
+type JSONSchemaColumn struct {
+	Enum    []interface{}     `json:"enum,omitempty"`
+	Maximum *json.Number      `json:"maximum,omitempty"`
+	Minimum *json.Number      `json:"minimum,omitempty"`
+	Not     *JSONSchemaColumn `json:"not,omitempty"`
+	Type    interface{}       `json:"type,omitempty"`
+}
+
+// ValidationRulesFromGreatExpectations converts the expectations of a Great Expectations expectation suite for a table
+// into validation rules.  When no table is given, the name of the suite is used.  Expectations which can't be converted
+// are skipped, with the reason returned for each.  The rules are named after what they check, unless the "meta" of an
+// expectation gives a "name".  Its "meta" can also give a "blocking" value, which is used instead of the blocking
+// argument
+func ValidationRulesFromGreatExpectations(r io.Reader, table string, blocking bool) (rules []database.ValidationRule, skipped []string, err error) {
+	// Both the classic suite format and the newer one (which uses "type" and "name") are accepted
+	var suite struct {
+		Expectations []struct {
+			ExpectationType string                 `json:"expectation_type"`
+			Kwargs          map[string]interface{} `json:"kwargs"`
+			Meta            map[string]interface{} `json:"meta"`
+			Type            string                 `json:"type"`
+		} `json:"expectations"`
+		ExpectationSuiteName string `json:"expectation_suite_name"`
+		Name                 string `json:"name"`
+	}
+	if err = decodeValidationSuite(r, &suite); err != nil {
+		return
+	}
+	if table == "" {
+		table = suite.ExpectationSuiteName
+		if table == "" {
+			table = suite.Name
+		}
+	}
+	if ValidatePGTable(table) != nil {
+		return nil, nil, errors.New("Invalid table name.  Give one, or use it as the name of the expectation suite")
+	}
+	for i, e := range suite.Expectations {
+		expType := e.ExpectationType
+		if expType == "" {
+			expType = e.Type
+		}
+		rule, reason := greatExpectationRule(expType, e.Kwargs, table)
+		if reason != "" {
+			skipped = append(skipped, fmt.Sprintf("Expectation %d (%s): %s", i+1, expType, reason))
+			continue
+		}
+		rule.Blocking = blocking
+		if b, ok := e.Meta["blocking"].(bool); ok {
+			rule.Blocking = b
+		}
+		if n, ok := e.Meta["name"].(string); ok && n != "" {
+			rule.Name = n
+		}
+		rules = append(rules, rule)
+	}
+	return
+}
+
+// ValidationRulesFromJSONSchema converts a JSON Schema for the rows of a table into validation rules.  The schema can
+// describe either a single row, or the table as an array of rows.  When no table is given, the "title" of the schema is
+// used.  Columns whose type doesn't allow null become "not_null" rules, "minimum", "maximum", and "enum" become
+// assertions, and "minItems" and "maxItems" become a "row_count" rule
+func ValidationRulesFromJSONSchema(r io.Reader, table string, blocking bool) (rules []database.ValidationRule, skipped []string, err error) {
+	var s struct {
+		Items      *JSONSchemaRow              `json:"items"`
+		MaxItems   *int64                      `json:"maxItems"`
+		MinItems   *int64                      `json:"minItems"`
+		Properties map[string]JSONSchemaColumn `json:"properties"`
+		Title      string                      `json:"title"`
+		Type       string                      `json:"type"`
+	}
+	if err = decodeValidationSuite(r, &s); err != nil {
+		return
+	}
+	if table == "" {
+		table = s.Title
+	}
+	if ValidatePGTable(table) != nil {
+		return nil, nil, errors.New("Invalid table name.  Give one, or put it in the \"title\" of the schema")
+	}
+
+	props := s.Properties
+	if s.Type == "array" {
+		if s.Items != nil {
+			props = s.Items.Properties
+		}
+		if s.MinItems != nil || s.MaxItems != nil {
+			rules = append(rules, database.ValidationRule{
+				MaxRows: s.MaxItems,
+				MinRows: s.MinItems,
+				Name:    validationRuleName(table, "", "row count"),
+				Table:   table,
+				Type:    "row_count",
+			})
+		}
+	}
+
+	// Go through the columns in name order, so the rules are created in the same order each time
+	cols := make([]string, 0, len(props))
+	for col := range props {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+	for _, col := range cols {
+		p := props[col]
+		if ValidateFieldName(col) != nil {
+			skipped = append(skipped, fmt.Sprintf("Column '%s': invalid column name", col))
+			continue
+		}
+		if jsonSchemaNotNull(p) {
+			rules = append(rules, database.ValidationRule{
+				Column: col,
+				Name:   validationRuleName(table, col, "not null"),
+				Table:  table,
+				Type:   "not_null",
+			})
+		}
+		if p.Minimum != nil || p.Maximum != nil {
+			var min, max interface{}
+			if p.Minimum != nil {
+				min = *p.Minimum
+			}
+			if p.Maximum != nil {
+				max = *p.Maximum
+			}
+			rule, reason := greatExpectationRule("expect_column_values_to_be_between",
+				map[string]interface{}{"column": col, "min_value": min, "max_value": max}, table)
+			if reason != "" {
+				skipped = append(skipped, fmt.Sprintf("Column '%s': %s", col, reason))
+			} else {
+				rules = append(rules, rule)
+			}
+		}
+		if p.Enum != nil {
+			rule, reason := greatExpectationRule("expect_column_values_to_be_in_set",
+				map[string]interface{}{"column": col, "value_set": p.Enum}, table)
+			if reason != "" {
+				skipped = append(skipped, fmt.Sprintf("Column '%s': %s", col, reason))
+			} else {
+				rules = append(rules, rule)
+			}
+		}
+	}
+	for i := range rules {
+		rules[i].Blocking = blocking
+	}
+	return
+}
+
+// ValidationRulesToGreatExpectations converts the validation rules of a database for a table into a Great Expectations
+// expectation suite.  Assertion rules can't be converted, so they're left out
+func ValidationRulesToGreatExpectations(rules []database.ValidationRule, table string) (suite GreatExpectationsSuite) {
+	suite.Name = table
+	suite.Expectations = []GreatExpectation{}
+	for _, r := range rules {
+		if r.Table != table {
+			continue
+		}
+		e := GreatExpectation{
+			Kwargs: map[string]interface{}{},
+			Meta:   map[string]interface{}{"blocking": r.Blocking, "name": r.Name},
+		}
+		switch r.Type {
+		case "not_null":
+			e.Type = "expect_column_values_to_not_be_null"
+			e.Kwargs["column"] = r.Column
+		case "unique":
+			e.Type = "expect_column_values_to_be_unique"
+			e.Kwargs["column"] = r.Column
+		case "row_count":
+			e.Type = "expect_table_row_count_to_be_between"
+			e.Kwargs["min_value"] = r.MinRows
+			e.Kwargs["max_value"] = r.MaxRows
+		default:
+			continue
+		}
+		suite.Expectations = append(suite.Expectations, e)
+	}
+	return
+}
+
+// ValidationRulesToJSONSchema converts the validation rules of a database for a table into a JSON Schema for its rows.
+// Only "not_null" and "row_count" rules can be described by JSON Schema, so the others are left out
+func ValidationRulesToJSONSchema(rules []database.ValidationRule, table string) (s JSONSchemaTable) {
+	s.Schema = JSONSchemaDialect
+	s.Title = table
+	s.Type = "array"
+	s.Items = JSONSchemaRow{Properties: map[string]JSONSchemaColumn{}, Type: "object"}
+	for _, r := range rules {
+		if r.Table != table {
+			continue
+		}
+		switch r.Type {
+		case "not_null":
+			s.Items.Properties[r.Column] = JSONSchemaColumn{Not: &JSONSchemaColumn{Type: "null"}}
+		case "row_count":
+			s.MinItems = r.MinRows
+			s.MaxItems = r.MaxRows
+		}
+	}
+	return
+}
+
+// decodeValidationSuite decodes an imported expectation suite or JSON Schema, keeping numbers as they were written
+func decodeValidationSuite(r io.Reader, v interface{}) error {
+	dec := json.NewDecoder(io.LimitReader(r, ValidationSuiteMaxSize))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("Couldn't read the file as JSON: %s", err)
+	}
+	return nil
+}
+
+// greatExpectationRule converts a Great Expectations expectation into a validation rule for a table.  When it can't
+// be converted, the reason is returned instead
+func greatExpectationRule(expType string, kwargs map[string]interface{}, table string) (rule database.ValidationRule, reason string) {
+	if m, ok := kwargs["mostly"]; ok && fmt.Sprint(m) != "1" && fmt.Sprint(m) != "1.0" {
+		return rule, "\"mostly\" isn't supported"
+	}
+	if ValidatePGTable(table) != nil {
+		return rule, "invalid table name"
+	}
+	rule.Table = table
+	column, _ := kwargs["column"].(string)
+	needsColumn := strings.HasPrefix(expType, "expect_column_")
+	if needsColumn && ValidateFieldName(column) != nil {
+		return rule, "invalid or missing column name"
+	}
+
+	switch expType {
+	case "expect_column_values_to_not_be_null":
+		rule.Column = column
+		rule.Name = validationRuleName(table, column, "not null")
+		rule.Type = "not_null"
+	case "expect_column_values_to_be_unique":
+		rule.Column = column
+		rule.Name = validationRuleName(table, column, "unique")
+		rule.Type = "unique"
+	case "expect_table_row_count_to_be_between", "expect_table_row_count_to_equal":
+		var err error
+		if expType == "expect_table_row_count_to_equal" {
+			rule.MinRows, err = jsonInt(kwargs["value"])
+			rule.MaxRows = rule.MinRows
+		} else {
+			rule.MinRows, err = jsonInt(kwargs["min_value"])
+			if err == nil {
+				rule.MaxRows, err = jsonInt(kwargs["max_value"])
+			}
+		}
+		if err != nil || (rule.MinRows == nil && rule.MaxRows == nil) {
+			return rule, "invalid row count"
+		}
+		rule.Name = validationRuleName(table, "", "row count")
+		rule.Type = "row_count"
+	case "expect_column_values_to_be_between":
+		min, err1 := sqlLiteral(kwargs["min_value"])
+		max, err2 := sqlLiteral(kwargs["max_value"])
+		if err1 != nil || err2 != nil || (min == "" && max == "") {
+			return rule, "invalid minimum or maximum value"
+		}
+		minOp, maxOp := "<", ">"
+		if strict, _ := kwargs["strict_min"].(bool); strict {
+			minOp = "<="
+		}
+		if strict, _ := kwargs["strict_max"].(bool); strict {
+			maxOp = ">="
+		}
+		var conds []string
+		if min != "" {
+			conds = append(conds, fmt.Sprintf("%s %s %s", EscapeId(column), minOp, min))
+		}
+		if max != "" {
+			conds = append(conds, fmt.Sprintf("%s %s %s", EscapeId(column), maxOp, max))
+		}
+		rule.Name = validationRuleName(table, column, "between")
+		rule.SQL = fmt.Sprintf("SELECT * FROM %s WHERE %s", EscapeId(table), strings.Join(conds, " OR "))
+		rule.Type = "assertion"
+	case "expect_column_values_to_be_in_set":
+		set, ok := kwargs["value_set"].([]interface{})
+		if !ok || len(set) == 0 {
+			return rule, "invalid value set"
+		}
+		var vals []string
+		for _, v := range set {
+			lit, err := sqlLiteral(v)
+			if err != nil || lit == "" {
+				return rule, "invalid value set"
+			}
+			vals = append(vals, lit)
+		}
+		rule.Name = validationRuleName(table, column, "in set")
+		rule.SQL = fmt.Sprintf("SELECT * FROM %s WHERE %s IS NOT NULL AND %s NOT IN (%s)", EscapeId(table),
+			EscapeId(column), EscapeId(column), strings.Join(vals, ", "))
+		rule.Type = "assertion"
+	default:
+		return rule, "not a supported expectation"
+	}
+	return
+}
+
+// jsonInt returns the whole number in a decoded JSON value, or nil when the value is null
+func jsonInt(v interface{}) (*int64, error) {
+	if v == nil {
+		return nil, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return nil, errors.New("Not a number")
+	}
+	i, err := n.Int64()
+	if err != nil || i < 0 {
+		return nil, errors.New("Not a whole number")
+	}
+	return &i, nil
+}
+
+// jsonSchemaNotNull returns whether the JSON Schema of a column doesn't allow null values
+func jsonSchemaNotNull(p JSONSchemaColumn) bool {
+	if p.Not != nil && p.Not.Type == "null" {
+		return true
+	}
+	switch t := p.Type.(type) {
+	case string:
+		return t != "null"
+	case []interface{}:
+		for _, z := range t {
+			if z == "null" {
+				return false
+			}
+		}
+		return len(t) > 0
+	}
+	return false
+}
+
+// sqlLiteral returns a decoded JSON number or string as an SQL literal.  An empty string is returned for null
+func sqlLiteral(v interface{}) (string, error) {
+	switch z := v.(type) {
+	case nil:
+		return "", nil
+	case json.Number:
+		if _, err := z.Float64(); err != nil {
+			return "", err
+		}
+		return EscapeValue(DataValue{Type: Float, Value: z.String()}), nil
+	case string:
+		return EscapeValue(DataValue{Type: Text, Value: z}), nil
+	}
+	return "", errors.New("Only numbers and strings are supported")
+}
+
+// validationRuleName returns the name of an imported validation rule, from the table and column it checks
+func validationRuleName(table, column, check string) string {
+	name := table + " " + check
+	if column != "" {
+		name = table + " " + column + " " + check
+	}
+
+	// Remove the characters which aren't allowed in rule names
+	name = strings.Map(func(r rune) rune {
+		if ValidateValidationRuleName(string(r)) != nil {
+			return '_'
+		}
+		return r
+	}, name)
+	if z := []rune(name); len(z) > 63 {
+		name = string(z[:63])
+	}
+	return name
+}
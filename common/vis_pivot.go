@@ -0,0 +1,235 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// PivotMaxColumns is the largest number of distinct values the column field of a pivot table can have.  Each one
+// becomes a column of the table, so beyond this it isn't useful to look at anyway
+const PivotMaxColumns = 200
+
+// pivotMaxGroups limits the number of groups returned by the aggregation query of a pivot table
+const pivotMaxGroups = 100000
+
+// pivotAggregates are the functions pivot tables can summarise their values with, and the SQLite function used for
+// each.  total() is used for sums, as unlike sum() it doesn't fail on integer overflow
+var pivotAggregates = map[string]string{
+	"avg":   "avg",
+	"count": "count",
+	"max":   "max",
+	"min":   "min",
+	"sum":   "total",
+}
+
+// ValidatePivot checks the settings of a pivot table visualisation
+func ValidatePivot(p database.VisPivot) error {
+	if _, ok := pivotAggregates[p.Aggregate]; !ok {
+		return fmt.Errorf("Unknown pivot table aggregate function '%s'", p.Aggregate)
+	}
+	if p.Row == "" {
+		return errors.New("Pivot tables need a row field")
+	}
+	if p.Value == "" && p.Aggregate != "count" {
+		return errors.New("Pivot tables need a value field, unless they're counting rows")
+	}
+	for _, f := range []string{p.Column, p.Row, p.Value} {
+		if f == "" {
+			continue
+		}
+		if err := ValidateFieldName(f); err != nil {
+			return fmt.Errorf("Invalid pivot table field name '%s'", f)
+		}
+	}
+	return nil
+}
+
+// PivotQuery wraps the query of a pivot table visualisation with the SQL which groups and summarises its results.
+// Each row returned holds the row value, column value, and summarised value of one group, followed by the rank of
+// its column value
+func PivotQuery(query string, p database.VisPivot) (string, error) {
+	if err := ValidatePivot(p); err != nil {
+		return "", err
+	}
+
+	query = pivotSubquery(query)
+	if query == "" {
+		return "", errors.New("No query given for the pivot table")
+	}
+
+	col := "NULL"
+	if p.Column != "" {
+		col = EscapeId(p.Column)
+	}
+	value := "*"
+	if p.Value != "" {
+		value = EscapeId(p.Value)
+	}
+
+	// The rank of each column value is returned too, so the columns of the pivot table can be put in the same order
+	return fmt.Sprintf("SELECT pivot_row, pivot_column, pivot_value, dense_rank() OVER (ORDER BY pivot_column) "+
+		"FROM (SELECT %s AS pivot_row, %s AS pivot_column, %s(%s) AS pivot_value FROM (%s\n) GROUP BY 1, 2) "+
+		"ORDER BY 1, 2 LIMIT %d", EscapeId(p.Row), col, pivotAggregates[p.Aggregate], value, query, pivotMaxGroups), nil
+}
+
+// PivotColumnsQuery returns SQL giving the columns of the query of a pivot table visualisation, without running the
+// query itself.  These are the fields the pivot table can be built from
+func PivotColumnsQuery(query string) string {
+	return fmt.Sprintf("SELECT * FROM (%s\n) LIMIT 0", pivotSubquery(query))
+}
+
+// pivotSubquery prepares the query of a pivot table visualisation for use as a subquery, by removing any trailing
+// semicolons
+func pivotSubquery(query string) string {
+	return strings.TrimRight(strings.TrimSpace(query), "; \t\r\n")
+}
+
+// PivotResults turns the results of a pivot table query into the pivot table itself.  The first column holds the row
+// values, followed by a column for each distinct column value, in the same layout as other query results
+func PivotResults(p database.VisPivot, data SQLiteRecordSet) (table SQLiteRecordSet, err error) {
+	if len(data.ColNames) != 4 {
+		return SQLiteRecordSet{}, errors.New("Unexpected results from the pivot table query")
+	}
+
+	// NULL values are shown as such, rather than being mixed in with empty strings
+	key := func(v DataValue) string {
+		if v.Type == Null {
+			return "NULL"
+		}
+		return fmt.Sprint(v.Value)
+	}
+
+	// Work out the distinct row and column values, in the order SQLite sorts them
+	var rowKeys []string
+	rowIdx := make(map[string]int)
+	colIdx := make(map[string]int)
+	for _, r := range data.Records {
+		if len(r) != 4 {
+			continue
+		}
+		if _, ok := rowIdx[key(r[0])]; !ok {
+			rowIdx[key(r[0])] = len(rowKeys)
+			rowKeys = append(rowKeys, key(r[0]))
+		}
+		rank, err := strconv.Atoi(fmt.Sprint(r[3].Value))
+		if err != nil || rank < 1 {
+			return SQLiteRecordSet{}, errors.New("Unexpected results from the pivot table query")
+		}
+		colIdx[key(r[1])] = rank - 1
+	}
+	if len(colIdx) > PivotMaxColumns {
+		return SQLiteRecordSet{}, fmt.Errorf("The pivot table column field has %d different values.  The limit is %d",
+			len(colIdx), PivotMaxColumns)
+	}
+	colKeys := make([]string, len(colIdx))
+	for k, i := range colIdx {
+		if i >= len(colKeys) {
+			return SQLiteRecordSet{}, errors.New("Unexpected results from the pivot table query")
+		}
+		colKeys[i] = k
+	}
+
+	// Without a column field there's just the one column of values, named after the aggregate
+	if p.Column == "" {
+		colKeys = []string{fmt.Sprintf("%s(%s)", p.Aggregate, p.Value)}
+		if p.Value == "" {
+			colKeys[0] = "count(*)"
+		}
+	}
+	table.ColNames = append([]string{p.Row}, colKeys...)
+	table.ColCount = len(table.ColNames)
+	table.Records = make([]DataRow, len(rowKeys))
+	for i, k := range rowKeys {
+		row := make(DataRow, len(table.ColNames))
+		row[0] = DataValue{Name: p.Row, Type: Text, Value: k}
+		for j, c := range colKeys {
+			row[j+1] = DataValue{Name: c, Type: Null, Value: ""}
+		}
+		table.Records[i] = row
+	}
+	for _, r := range data.Records {
+		if len(r) != 4 {
+			continue
+		}
+		j := 0
+		if p.Column != "" {
+			j = colIdx[key(r[1])]
+		}
+		cell := r[2]
+		cell.Name = table.ColNames[j+1]
+		if cell.Type == Null {
+			cell.Value = ""
+		}
+		table.Records[rowIdx[key(r[0])]][j+1] = cell
+	}
+	table.RowCount = len(table.Records)
+	table.TotalRows = table.RowCount
+	return
+}
+
+// visRenderPivotSVG draws a pivot table as an SVG image.  Only as many rows and columns as fit in the image are drawn,
+// with a note saying how many were left out
+func visRenderPivotSVG(table SQLiteRecordSet) []byte {
+	const cellHeight = 22
+	const maxColumns = 8
+	maxRows := (visRenderHeight - 2*cellHeight) / cellHeight
+
+	cols := table.ColNames
+	if len(cols) > maxColumns {
+		cols = cols[:maxColumns]
+	}
+	rows := table.Records
+	if len(rows) > maxRows {
+		rows = rows[:maxRows]
+	}
+	cellWidth := float64(visRenderWidth-20) / float64(len(cols))
+	maxChars := int(cellWidth / 7)
+
+	// Long values are cut short so they stay inside their cell
+	cellText := func(s string) string {
+		r := []rune(s)
+		if len(r) > maxChars && maxChars > 1 {
+			s = string(r[:maxChars-1]) + "…"
+		}
+		return html.EscapeString(s)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`,
+		visRenderWidth, visRenderHeight, visRenderWidth, visRenderHeight)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="white"/>`)
+	for i, c := range cols {
+		x := 10 + float64(i)*cellWidth
+		fmt.Fprintf(&b, `<rect x="%.2f" y="10" width="%.2f" height="%d" fill="#eeeeee" stroke="#cccccc"/>`, x, cellWidth,
+			cellHeight)
+		fmt.Fprintf(&b, `<text x="%.2f" y="%d" font-weight="bold">%s</text>`, x+4, 10+cellHeight-7, cellText(c))
+	}
+	for r, row := range rows {
+		y := 10 + (r+1)*cellHeight
+		for i := range cols {
+			x := 10 + float64(i)*cellWidth
+			fmt.Fprintf(&b, `<rect x="%.2f" y="%d" width="%.2f" height="%d" fill="white" stroke="#cccccc"/>`, x, y,
+				cellWidth, cellHeight)
+			if i < len(row) {
+				pos := fmt.Sprintf(`x="%.2f"`, x+4)
+				if i > 0 {
+					// Summarised values are numbers, so line them up on the right
+					pos = fmt.Sprintf(`x="%.2f" text-anchor="end"`, x+cellWidth-4)
+				}
+				fmt.Fprintf(&b, `<text %s y="%d">%s</text>`, pos, y+cellHeight-7, cellText(fmt.Sprint(row[i].Value)))
+			}
+		}
+	}
+	if len(rows) < len(table.Records) || len(cols) < len(table.ColNames) {
+		fmt.Fprintf(&b, `<text x="10" y="%d" font-style="italic">Showing %d of %d rows and %d of %d columns</text>`,
+			visRenderHeight-8, len(rows), len(table.Records), len(cols), len(table.ColNames))
+	}
+	b.WriteString("</svg>")
+	return b.Bytes()
+}
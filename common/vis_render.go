@@ -0,0 +1,362 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"strconv"
+
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+const (
+	// Dimensions and margin of server side rendered visualisations
+	visRenderHeight = 500
+	visRenderMargin = 60
+	visRenderWidth  = 800
+)
+
+// visRenderColours is the palette used when rendering visualisations
+var visRenderColours = []color.RGBA{
+	{R: 0x1f, G: 0x77, B: 0xb4, A: 0xff},
+	{R: 0xff, G: 0x7f, B: 0x0e, A: 0xff},
+	{R: 0x2c, G: 0xa0, B: 0x2c, A: 0xff},
+	{R: 0xd6, G: 0x27, B: 0x28, A: 0xff},
+	{R: 0x94, G: 0x67, B: 0xbd, A: 0xff},
+	{R: 0x8c, G: 0x56, B: 0x4b, A: 0xff},
+	{R: 0xe3, G: 0x77, B: 0xc2, A: 0xff},
+	{R: 0x7f, G: 0x7f, B: 0x7f, A: 0xff},
+}
+
+// RenderVisualisation draws a saved visualisation on the server side, so it can be embedded as an image.  The
+// format can be either "svg" or "png".  The content type of the returned image is also returned
+func RenderVisualisation(params database.VisParamsV2, data SQLiteRecordSet, format string) (img []byte, contentType string, err error) {
+	// Pivot tables are drawn as a table.  The data given needs to be the pivot table itself, from PivotResults()
+	if params.ChartType == "pivot" {
+		if format != "svg" {
+			return nil, "", errors.New("Pivot tables can only be rendered as SVG images")
+		}
+		return visRenderPivotSVG(data), "image/svg+xml", nil
+	}
+
+	// Maps are drawn from the locations in the data rather than along axes
+	if params.ChartType == "map" {
+		var shapes []visMapShape
+		shapes, err = visMapShapes(params, data)
+		if err != nil {
+			return
+		}
+		switch format {
+		case "svg":
+			return visRenderMapSVG(shapes), "image/svg+xml", nil
+		case "png":
+			img, err = visRenderMapPNG(shapes)
+			return img, "image/png", err
+		default:
+			return nil, "", fmt.Errorf("Unknown image format '%s'", format)
+		}
+	}
+
+	labels, values, err := visRenderPoints(params, data)
+	if err != nil {
+		return
+	}
+
+	switch format {
+	case "svg":
+		return visRenderSVG(params, labels, values), "image/svg+xml", nil
+	case "png":
+		img, err = visRenderPNG(params, values)
+		return img, "image/png", err
+	default:
+		return nil, "", fmt.Errorf("Unknown image format '%s'", format)
+	}
+}
+
+// visRenderPoints extracts the x axis labels and y axis values for a visualisation from its query results
+func visRenderPoints(params database.VisParamsV2, data SQLiteRecordSet) (labels []string, values []float64, err error) {
+	xCol, yCol := -1, -1
+	for i, n := range data.ColNames {
+		if n == params.XAXisColumn {
+			xCol = i
+		}
+		if n == params.YAXisColumn {
+			yCol = i
+		}
+	}
+	if xCol == -1 || yCol == -1 {
+		return nil, nil, errors.New("The visualisation axis columns aren't present in the query results")
+	}
+
+	for _, row := range data.Records {
+		if xCol >= len(row) || yCol >= len(row) {
+			continue
+		}
+		labels = append(labels, fmt.Sprint(row[xCol].Value))
+
+		// Non numeric values are plotted as zero, same as the web UI does
+		v, e := strconv.ParseFloat(fmt.Sprint(row[yCol].Value), 64)
+		if e != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			v = 0
+		}
+		values = append(values, v)
+	}
+	return
+}
+
+// visRenderRange returns the minimum and maximum of the plotted values, always including zero
+func visRenderRange(values []float64) (min, max float64) {
+	for _, v := range values {
+		if v < min {
+			min = v
+		}
+		if v > max {
+			max = v
+		}
+	}
+	if max == min {
+		max = min + 1
+	}
+	return
+}
+
+// visRenderSVG draws a visualisation as an SVG image
+func visRenderSVG(params database.VisParamsV2, labels []string, values []float64) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`,
+		visRenderWidth, visRenderHeight, visRenderWidth, visRenderHeight)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="white"/>`)
+
+	plotW := float64(visRenderWidth - 2*visRenderMargin)
+	plotH := float64(visRenderHeight - 2*visRenderMargin)
+	left := float64(visRenderMargin)
+	top := float64(visRenderMargin)
+	n := len(values)
+	min, max := visRenderRange(values)
+
+	switch params.ChartType {
+	case "pie":
+		var total float64
+		for _, v := range values {
+			total += math.Abs(v)
+		}
+		cx, cy := float64(visRenderWidth)/2, float64(visRenderHeight)/2
+		radius := plotH / 2
+		angle := -math.Pi / 2
+		for i, v := range values {
+			if total == 0 || v == 0 {
+				continue
+			}
+			sweep := 2 * math.Pi * math.Abs(v) / total
+			c := visRenderColours[i%len(visRenderColours)]
+			if sweep >= 2*math.Pi-1e-9 {
+				fmt.Fprintf(&b, `<circle cx="%.2f" cy="%.2f" r="%.2f" fill="%s"/>`, cx, cy, radius, visRenderHex(c))
+			} else {
+				largeArc := 0
+				if sweep > math.Pi {
+					largeArc = 1
+				}
+				x1, y1 := cx+radius*math.Cos(angle), cy+radius*math.Sin(angle)
+				x2, y2 := cx+radius*math.Cos(angle+sweep), cy+radius*math.Sin(angle+sweep)
+				fmt.Fprintf(&b, `<path d="M%.2f,%.2f L%.2f,%.2f A%.2f,%.2f 0 %d 1 %.2f,%.2f Z" fill="%s"><title>%s</title></path>`,
+					cx, cy, x1, y1, radius, radius, largeArc, x2, y2, visRenderHex(c), html.EscapeString(labels[i]))
+			}
+			angle += sweep
+		}
+
+	case "hbc":
+		if n == 0 {
+			break
+		}
+		barH := plotH / float64(n)
+		zero := left + plotW*(-min)/(max-min)
+		for i, v := range values {
+			w := plotW * v / (max - min)
+			x := zero
+			if w < 0 {
+				x, w = zero+w, -w
+			}
+			y := top + float64(i)*barH
+			fmt.Fprintf(&b, `<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" fill="%s"><title>%s</title></rect>`,
+				x, y+barH*0.1, w, barH*0.8, visRenderHex(visRenderColours[0]), html.EscapeString(labels[i]))
+			fmt.Fprintf(&b, `<text x="%.2f" y="%.2f" text-anchor="end" dominant-baseline="middle">%s</text>`,
+				left-4, y+barH/2, html.EscapeString(labels[i]))
+		}
+		fmt.Fprintf(&b, `<line x1="%.2f" y1="%.2f" x2="%.2f" y2="%.2f" stroke="black"/>`, zero, top, zero, top+plotH)
+
+	case "lc", "vbc":
+		if n == 0 {
+			break
+		}
+		zero := top + plotH*max/(max-min)
+		step := plotW / float64(n)
+		if params.ChartType == "lc" {
+			var points bytes.Buffer
+			for i, v := range values {
+				fmt.Fprintf(&points, "%.2f,%.2f ", left+step*(float64(i)+0.5), zero-plotH*v/(max-min))
+			}
+			fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2"/>`, bytes.TrimSpace(points.Bytes()),
+				visRenderHex(visRenderColours[0]))
+		} else {
+			for i, v := range values {
+				h := plotH * v / (max - min)
+				y := zero - h
+				if h < 0 {
+					y, h = zero, -h
+				}
+				fmt.Fprintf(&b, `<rect x="%.2f" y="%.2f" width="%.2f" height="%.2f" fill="%s"><title>%s</title></rect>`,
+					left+step*float64(i)+step*0.1, y, step*0.8, h, visRenderHex(visRenderColours[0]), html.EscapeString(labels[i]))
+			}
+		}
+		for i, l := range labels {
+			fmt.Fprintf(&b, `<text x="%.2f" y="%.2f" text-anchor="middle">%s</text>`, left+step*(float64(i)+0.5),
+				top+plotH+16, html.EscapeString(l))
+		}
+		fmt.Fprintf(&b, `<line x1="%.2f" y1="%.2f" x2="%.2f" y2="%.2f" stroke="black"/>`, left, zero, left+plotW, zero)
+	}
+
+	// Axis titles
+	if params.ChartType != "pie" {
+		xTitle, yTitle := params.XAXisColumn, params.YAXisColumn
+		if params.ChartType == "hbc" {
+			xTitle, yTitle = yTitle, xTitle
+		}
+		if params.ShowXLabel {
+			fmt.Fprintf(&b, `<text x="%.2f" y="%d" text-anchor="middle" font-weight="bold">%s</text>`, left+plotW/2,
+				visRenderHeight-visRenderMargin/4, html.EscapeString(xTitle))
+		}
+		if params.ShowYLabel {
+			fmt.Fprintf(&b, `<text x="%d" y="%.2f" text-anchor="middle" font-weight="bold" transform="rotate(-90 %d %.2f)">%s</text>`,
+				visRenderMargin/4, top+plotH/2, visRenderMargin/4, top+plotH/2, html.EscapeString(yTitle))
+		}
+	}
+	b.WriteString("</svg>")
+	return b.Bytes()
+}
+
+// visRenderPNG draws a visualisation as a PNG image.  As the standard library doesn't provide font rendering,
+// the PNG version doesn't include any text
+func visRenderPNG(params database.VisParamsV2, values []float64) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, visRenderWidth, visRenderHeight))
+	visRenderFill(img, img.Bounds(), color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff})
+
+	plotW := float64(visRenderWidth - 2*visRenderMargin)
+	plotH := float64(visRenderHeight - 2*visRenderMargin)
+	left := float64(visRenderMargin)
+	top := float64(visRenderMargin)
+	n := len(values)
+	min, max := visRenderRange(values)
+	black := color.RGBA{A: 0xff}
+
+	switch params.ChartType {
+	case "pie":
+		var total float64
+		for _, v := range values {
+			total += math.Abs(v)
+		}
+		if total == 0 {
+			break
+		}
+		cx, cy := float64(visRenderWidth)/2, float64(visRenderHeight)/2
+		radius := plotH / 2
+		for y := int(cy - radius); y <= int(cy+radius); y++ {
+			for x := int(cx - radius); x <= int(cx+radius); x++ {
+				dx, dy := float64(x)-cx, float64(y)-cy
+				if dx*dx+dy*dy > radius*radius {
+					continue
+				}
+
+				// Work out which slice this pixel is in, measuring clockwise from the top
+				a := math.Atan2(dy, dx) + math.Pi/2
+				if a < 0 {
+					a += 2 * math.Pi
+				}
+				var acc float64
+				for i, v := range values {
+					acc += 2 * math.Pi * math.Abs(v) / total
+					if a <= acc {
+						img.SetRGBA(x, y, visRenderColours[i%len(visRenderColours)])
+						break
+					}
+				}
+			}
+		}
+
+	case "hbc":
+		if n == 0 {
+			break
+		}
+		barH := plotH / float64(n)
+		zero := left + plotW*(-min)/(max-min)
+		for i, v := range values {
+			x0, x1 := zero, zero+plotW*v/(max-min)
+			if x1 < x0 {
+				x0, x1 = x1, x0
+			}
+			y := top + float64(i)*barH
+			visRenderFill(img, image.Rect(int(x0), int(y+barH*0.1), int(x1), int(y+barH*0.9)), visRenderColours[0])
+		}
+		visRenderFill(img, image.Rect(int(zero), int(top), int(zero)+1, int(top+plotH)), black)
+
+	case "lc", "vbc":
+		if n == 0 {
+			break
+		}
+		zero := top + plotH*max/(max-min)
+		step := plotW / float64(n)
+		if params.ChartType == "lc" {
+			for i := 1; i < n; i++ {
+				visRenderLine(img, left+step*(float64(i)-0.5), zero-plotH*values[i-1]/(max-min),
+					left+step*(float64(i)+0.5), zero-plotH*values[i]/(max-min), visRenderColours[0])
+			}
+		} else {
+			for i, v := range values {
+				y0, y1 := zero-plotH*v/(max-min), zero
+				if y1 < y0 {
+					y0, y1 = y1, y0
+				}
+				x := left + step*float64(i)
+				visRenderFill(img, image.Rect(int(x+step*0.1), int(y0), int(x+step*0.9), int(y1)), visRenderColours[0])
+			}
+		}
+		visRenderFill(img, image.Rect(int(left), int(zero), int(left+plotW), int(zero)+1), black)
+	}
+
+	var b bytes.Buffer
+	err := png.Encode(&b, img)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// visRenderFill fills a rectangle of an image with a solid colour
+func visRenderFill(img *image.RGBA, r image.Rectangle, c color.RGBA) {
+	r = r.Intersect(img.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+}
+
+// visRenderLine draws a two pixel wide line between two points
+func visRenderLine(img *image.RGBA, x0, y0, x1, y1 float64, c color.RGBA) {
+	steps := int(math.Max(math.Abs(x1-x0), math.Abs(y1-y0))) + 1
+	for i := 0; i <= steps; i++ {
+		t := float64(i) / float64(steps)
+		x := int(x0 + (x1-x0)*t)
+		y := int(y0 + (y1-y0)*t)
+		visRenderFill(img, image.Rect(x, y, x+2, y+2), c)
+	}
+}
+
+// visRenderHex returns the hex notation of a colour, for use in SVG attributes
+func visRenderHex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
@@ -0,0 +1,289 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"strconv"
+
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// visMapMaxLat is the furthest latitude north or south which the Web Mercator projection used by map tiles shows
+const visMapMaxLat = 85.0511
+
+// visMapBackground is the colour of the land on rendered maps, as the map tiles themselves aren't drawn
+var visMapBackground = color.RGBA{R: 0xf2, G: 0xef, B: 0xe9, A: 0xff}
+
+// visMapShape is a point, line, or polygon drawn on a map visualisation.  Its rings hold longitude and latitude pairs.
+// Points and lines have a single ring, while polygons can also have holes
+type visMapShape struct {
+	kind  string
+	label string
+	rings [][][2]float64
+}
+
+// visGeoJSON holds the parts of a GeoJSON object needed for drawing it.  Features and feature collections are
+// unwrapped to their geometries
+type visGeoJSON struct {
+	Coordinates json.RawMessage `json:"coordinates"`
+	Features    []visGeoJSON    `json:"features"`
+	Geometries  []visGeoJSON    `json:"geometries"`
+	Geometry    *visGeoJSON     `json:"geometry"`
+	Type        string          `json:"type"`
+}
+
+// visMapShapes extracts the shapes for a map visualisation from its query results.  Rows without a usable location
+// are skipped
+func visMapShapes(params database.VisParamsV2, data SQLiteRecordSet) (shapes []visMapShape, err error) {
+	geoCol, labelCol, latCol, lonCol := -1, -1, -1, -1
+	for i, n := range data.ColNames {
+		switch n {
+		case params.GeoJSONColumn:
+			geoCol = i
+		case params.LatColumn:
+			latCol = i
+		case params.LonColumn:
+			lonCol = i
+		}
+		if n == params.LabelColumn {
+			labelCol = i
+		}
+	}
+	if params.GeoJSONColumn != "" && geoCol == -1 {
+		return nil, errors.New("The visualisation GeoJSON column isn't present in the query results")
+	}
+	if params.GeoJSONColumn == "" && (latCol == -1 || lonCol == -1) {
+		return nil, errors.New("The visualisation latitude and longitude columns aren't present in the query results")
+	}
+
+	for _, row := range data.Records {
+		var label string
+		if labelCol != -1 && labelCol < len(row) {
+			label = fmt.Sprint(row[labelCol].Value)
+		}
+
+		if geoCol != -1 {
+			if geoCol >= len(row) {
+				continue
+			}
+			s, ok := row[geoCol].Value.(string)
+			if !ok {
+				continue
+			}
+			var g visGeoJSON
+			if json.Unmarshal([]byte(s), &g) != nil {
+				continue
+			}
+			shapes = append(shapes, visGeoJSONShapes(g, label, 0)...)
+			continue
+		}
+
+		if latCol >= len(row) || lonCol >= len(row) {
+			continue
+		}
+		lat, e1 := strconv.ParseFloat(fmt.Sprint(row[latCol].Value), 64)
+		lon, e2 := strconv.ParseFloat(fmt.Sprint(row[lonCol].Value), 64)
+		if e1 != nil || e2 != nil || math.Abs(lat) > 90 || math.Abs(lon) > 180 {
+			continue
+		}
+		shapes = append(shapes, visMapShape{kind: "point", label: label, rings: [][][2]float64{{{lon, lat}}}})
+	}
+	return
+}
+
+// visGeoJSONShapes converts a GeoJSON object into the shapes to draw for it.  Anything which can't be understood is
+// left out
+func visGeoJSONShapes(g visGeoJSON, label string, depth int) (shapes []visMapShape) {
+	// Collections of collections are allowed by GeoJSON, but there's no need to follow them very far
+	if depth > 3 {
+		return nil
+	}
+	switch g.Type {
+	case "Feature":
+		if g.Geometry != nil {
+			return visGeoJSONShapes(*g.Geometry, label, depth+1)
+		}
+	case "FeatureCollection":
+		for _, f := range g.Features {
+			shapes = append(shapes, visGeoJSONShapes(f, label, depth+1)...)
+		}
+	case "GeometryCollection":
+		for _, f := range g.Geometries {
+			shapes = append(shapes, visGeoJSONShapes(f, label, depth+1)...)
+		}
+	case "Point":
+		var p [2]float64
+		if json.Unmarshal(g.Coordinates, &p) == nil {
+			shapes = append(shapes, visMapShape{kind: "point", label: label, rings: [][][2]float64{{p}}})
+		}
+	case "MultiPoint":
+		var ps [][2]float64
+		if json.Unmarshal(g.Coordinates, &ps) == nil {
+			for _, p := range ps {
+				shapes = append(shapes, visMapShape{kind: "point", label: label, rings: [][][2]float64{{p}}})
+			}
+		}
+	case "LineString":
+		var l [][2]float64
+		if json.Unmarshal(g.Coordinates, &l) == nil {
+			shapes = append(shapes, visMapShape{kind: "line", label: label, rings: [][][2]float64{l}})
+		}
+	case "MultiLineString":
+		var ls [][][2]float64
+		if json.Unmarshal(g.Coordinates, &ls) == nil {
+			for _, l := range ls {
+				shapes = append(shapes, visMapShape{kind: "line", label: label, rings: [][][2]float64{l}})
+			}
+		}
+	case "Polygon":
+		var rs [][][2]float64
+		if json.Unmarshal(g.Coordinates, &rs) == nil {
+			shapes = append(shapes, visMapShape{kind: "polygon", label: label, rings: rs})
+		}
+	case "MultiPolygon":
+		var ps [][][][2]float64
+		if json.Unmarshal(g.Coordinates, &ps) == nil {
+			for _, rs := range ps {
+				shapes = append(shapes, visMapShape{kind: "polygon", label: label, rings: rs})
+			}
+		}
+	}
+	return
+}
+
+// visMapProjection places longitude and latitude pairs on the plot area of a rendered map, using the Web Mercator
+// projection so shapes look the same as on the interactive map
+type visMapProjection struct {
+	minX, maxY, scale, offsetX, offsetY float64
+}
+
+// visMapMercator converts a longitude and latitude pair to Web Mercator coordinates, with y increasing northwards
+func visMapMercator(p [2]float64) (x, y float64) {
+	lat := math.Max(-visMapMaxLat, math.Min(visMapMaxLat, p[1]))
+	return p[0] * math.Pi / 180, math.Log(math.Tan(math.Pi/4 + lat*math.Pi/360))
+}
+
+// newVisMapProjection works out the projection which fits all of the shapes in the plot area, keeping their aspect
+// ratio
+func newVisMapProjection(shapes []visMapShape) (proj visMapProjection) {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, s := range shapes {
+		for _, r := range s.rings {
+			for _, p := range r {
+				x, y := visMapMercator(p)
+				minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+				minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+			}
+		}
+	}
+	if math.IsInf(minX, 0) {
+		minX, minY, maxX, maxY = -math.Pi, -math.Pi, math.Pi, math.Pi
+	}
+
+	// Give single points, and shapes which are a straight line, some room around them
+	if maxX-minX < 0.001 {
+		minX, maxX = minX-0.001, maxX+0.001
+	}
+	if maxY-minY < 0.001 {
+		minY, maxY = minY-0.001, maxY+0.001
+	}
+
+	plotW := float64(visRenderWidth - 2*visRenderMargin)
+	plotH := float64(visRenderHeight - 2*visRenderMargin)
+	proj.scale = math.Min(plotW/(maxX-minX), plotH/(maxY-minY))
+	proj.minX, proj.maxY = minX, maxY
+	proj.offsetX = float64(visRenderMargin) + (plotW-(maxX-minX)*proj.scale)/2
+	proj.offsetY = float64(visRenderMargin) + (plotH-(maxY-minY)*proj.scale)/2
+	return
+}
+
+// point returns the position in the rendered image of a longitude and latitude pair
+func (proj visMapProjection) point(p [2]float64) (x, y float64) {
+	mx, my := visMapMercator(p)
+	return proj.offsetX + (mx-proj.minX)*proj.scale, proj.offsetY + (proj.maxY-my)*proj.scale
+}
+
+// visRenderMapSVG draws a map visualisation as an SVG image.  The map tiles aren't included, just the shapes
+func visRenderMapSVG(shapes []visMapShape) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`,
+		visRenderWidth, visRenderHeight, visRenderWidth, visRenderHeight)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="%s"/>`, visRenderHex(visMapBackground))
+
+	proj := newVisMapProjection(shapes)
+	colour := visRenderHex(visRenderColours[0])
+	for _, s := range shapes {
+		title := ""
+		if s.label != "" {
+			title = "<title>" + html.EscapeString(s.label) + "</title>"
+		}
+		switch s.kind {
+		case "point":
+			x, y := proj.point(s.rings[0][0])
+			fmt.Fprintf(&b, `<circle cx="%.2f" cy="%.2f" r="5" fill="%s" stroke="white">%s</circle>`, x, y, colour, title)
+		case "line":
+			var points bytes.Buffer
+			for _, p := range s.rings[0] {
+				x, y := proj.point(p)
+				fmt.Fprintf(&points, "%.2f,%.2f ", x, y)
+			}
+			fmt.Fprintf(&b, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2">%s</polyline>`,
+				bytes.TrimSpace(points.Bytes()), colour, title)
+		case "polygon":
+			var path bytes.Buffer
+			for _, r := range s.rings {
+				for i, p := range r {
+					x, y := proj.point(p)
+					cmd := "L"
+					if i == 0 {
+						cmd = "M"
+					}
+					fmt.Fprintf(&path, "%s%.2f,%.2f ", cmd, x, y)
+				}
+				path.WriteString("Z ")
+			}
+			fmt.Fprintf(&b, `<path d="%s" fill="%s" fill-opacity="0.3" fill-rule="evenodd" stroke="%s" stroke-width="1.5">%s</path>`,
+				bytes.TrimSpace(path.Bytes()), colour, colour, title)
+		}
+	}
+	b.WriteString("</svg>")
+	return b.Bytes()
+}
+
+// visRenderMapPNG draws a map visualisation as a PNG image.  Like the SVG version the map tiles aren't included, and
+// polygons are drawn as outlines
+func visRenderMapPNG(shapes []visMapShape) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, visRenderWidth, visRenderHeight))
+	visRenderFill(img, img.Bounds(), visMapBackground)
+
+	proj := newVisMapProjection(shapes)
+	for _, s := range shapes {
+		if s.kind == "point" {
+			x, y := proj.point(s.rings[0][0])
+			visRenderFill(img, image.Rect(int(x)-3, int(y)-3, int(x)+4, int(y)+4), visRenderColours[0])
+			continue
+		}
+		for _, r := range s.rings {
+			for i := 1; i < len(r); i++ {
+				x0, y0 := proj.point(r[i-1])
+				x1, y1 := proj.point(r[i])
+				visRenderLine(img, x0, y0, x1, y1, visRenderColours[0])
+			}
+		}
+	}
+
+	var b bytes.Buffer
+	err := png.Encode(&b, img)
+	if err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
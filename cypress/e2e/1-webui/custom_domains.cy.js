@@ -0,0 +1,147 @@
+// Domains under the ".invalid" top level domain never resolve, so they can't be verified
+const domain = 'data.cypress-test.invalid';
+
+// Calls one of the custom domain requests of the preferences page
+function domainCall(call, domain) {
+  return cy.request({
+    method: 'POST',
+    url: '/x/' + call,
+    form: true,
+    body: {
+      domain: domain
+    },
+    failOnStatusCode: false,
+  })
+}
+
+describe('custom domains', () => {
+  before(() => {
+    // Seed data
+    cy.request('/x/test/seed')
+  })
+
+  after(() => {
+    // Make sure the default user is logged in for the other tests
+    cy.request('/x/test/switchdefault')
+  })
+
+  // Add a custom domain from the preferences page
+  it('add', () => {
+    cy.visit('pref')
+    cy.get('[data-cy="customdomain"]').type(domain)
+    cy.get('[data-cy="customdomainaddbtn"]').click()
+    cy.get('[data-cy="customdomainstbl"]').should('contain', domain).and('contain', 'Verify')
+
+    // The domain is kept when the page is loaded again
+    cy.visit('pref')
+    cy.get('[data-cy="customdomainstbl"]').should('contain', domain)
+  })
+
+  // Domains need verifying before they're used, so they're added with a verification token
+  it('add (details)', () => {
+    domainCall('customdomainadd', 'Second.Cypress-Test.invalid.').then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        let jsonBody = JSON.parse(response.body)
+        expect(jsonBody).to.have.property('domain', 'second.cypress-test.invalid')
+        expect(jsonBody).to.have.property('date_verified', null)
+        expect(jsonBody.verification_token).to.match(/^[0-9a-f]{32}$/)
+      }
+    )
+  })
+
+  // Domains can't be added twice
+  it('add (duplicate)', () => {
+    domainCall('customdomainadd', domain.toUpperCase()).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body).to.eq('That domain has already been added')
+      }
+    )
+  })
+
+  // Invalid domains, and the domains of this server, are refused
+  it('add (invalid domains)', () => {
+    domainCall('customdomainadd', 'not a domain').then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body).to.eq('Invalid domain name')
+      }
+    )
+    for (const d of ['docker-dev.dbhub.io', 'sub.docker-dev.dbhub.io']) {
+      domainCall('customdomainadd', d).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body).to.eq("The domains of this server can't be used as custom domains")
+        }
+      )
+    }
+  })
+
+  // Each user can only have a few custom domains
+  it('add (too many)', () => {
+    domainCall('customdomainadd', 'third.cypress-test.invalid').its('status').should('eq', 200)
+    domainCall('customdomainadd', 'fourth.cypress-test.invalid').then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body).to.eq('You can have up to 3 custom domains')
+      }
+    )
+  })
+
+  // Domains can't be verified without their DNS TXT record
+  it('verify (no record)', () => {
+    domainCall('customdomainverify', domain).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body).to.eq("No TXT record was found for '_dbhub-verification." + domain + "'")
+      }
+    )
+    domainCall('customdomainverify', 'unknown.cypress-test.invalid').then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body).to.match(/^Unknown custom domain/)
+      }
+    )
+  })
+
+  // Adding a domain doesn't stop other users adding it too, as only the first to verify it gets it
+  it('add (other user)', () => {
+    cy.request('/x/test/switchfirst')
+    domainCall('customdomainadd', domain).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(JSON.parse(response.body)).to.have.property('domain', domain)
+      }
+    )
+    cy.visit('pref')
+    cy.get('[data-cy="customdomainstbl"]').should('contain', domain).and('not.contain', 'second.cypress-test.invalid')
+    cy.request('/x/test/switchdefault')
+  })
+
+  // Remove a custom domain
+  it('remove', () => {
+    domainCall('customdomaindel', domain).its('status').should('eq', 200)
+    cy.visit('pref')
+    cy.get('[data-cy="customdomainstbl"]').should('not.contain', domain).and('contain', 'second.cypress-test.invalid')
+
+    // It's gone, so it can't be removed again
+    domainCall('customdomaindel', domain).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body).to.eq('Unknown custom domain')
+      }
+    )
+
+    // The other user still has their claim on it
+    cy.request('/x/test/switchfirst')
+    cy.visit('pref')
+    cy.get('[data-cy="customdomainstbl"]').should('contain', domain)
+    cy.request('/x/test/switchdefault')
+  })
+
+  // Hosts which can't be custom domains are served as usual
+  it('other hosts', () => {
+    cy.request('https://127.0.0.1:9443/default').its('status').should('eq', 200)
+  })
+})
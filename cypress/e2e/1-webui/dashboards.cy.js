@@ -0,0 +1,187 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownDB = 'dashboard.sqlite';
+const sharedDB = 'dashboard shared.sqlite';
+const privateDB = 'dashboard private.sqlite';
+const publicDB = 'dashboard public.sqlite';
+
+// The widgets are given to the page as JSON, with each one's image URL pointing at the rendered visualisation
+const imageURL = /"image_url":"[^"]*visimage[^"]*dashboard\.sqlite/;
+
+// Saves a visualisation on one of the test databases, as the logged in user
+function saveVis(owner, db, name) {
+  return cy.request({
+    method: 'POST',
+    url: '/x/vissave/' + owner + '/' + encodeURIComponent(db) + '?visname=' + name,
+    body: {
+      chart_type: 'hbc',
+      sql: 'SELECT name, value FROM items',
+      x_axis_label: 'name',
+      y_axis_label: 'value'
+    },
+  })
+}
+
+// Saves the test dashboard with the given widgets
+function saveDashboard(widgets, isPublic = false) {
+  return cy.request({
+    method: 'POST',
+    url: '/x/dashboardsave',
+    body: {
+      name: 'testdash',
+      description: 'Dashboard for the Cypress tests',
+      public: isPublic,
+      widgets: widgets
+    },
+    failOnStatusCode: false,
+  })
+}
+
+// Returns a widget showing the visualisation of one of the test databases
+function widget(owner, db, refresh = 0) {
+  return {db_owner: owner, db_name: db, vis_name: 'dashvis', title: db, refresh_interval: refresh}
+}
+
+describe('dashboards', () => {
+  before(() => {
+    // Seed data, then add the databases the dashboard widgets use.  The default user can only read the shared
+    // database of the first user, and can't see their private one at all
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: ownDB},
+            {owner: 'first', name: sharedDB},
+            {owner: 'first', name: privateDB},
+            {owner: 'first', name: publicDB, public: true}
+          ],
+          shares: [{dbowner: 'first', dbname: sharedDB, user: 'default'}]
+        })
+      },
+    })
+    saveVis('default', ownDB, 'dashvis')
+    cy.request('/x/test/switchfirst')
+    for (const db of [sharedDB, privateDB, publicDB]) {
+      saveVis('first', db, 'dashvis')
+    }
+    cy.request('/x/test/switchdefault')
+  })
+
+  after(() => {
+    // Make sure the default user is logged in for the other tests
+    cy.request('/x/test/switchdefault')
+  })
+
+  // Save a dashboard showing a visualisation of one of the user's own databases
+  it('save', () => {
+    saveDashboard([widget('default', ownDB)]).its('status').should('eq', 200)
+    cy.request('/dashboard/default/testdash').then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.match(imageURL)
+      }
+    )
+  })
+
+  // Visualisations of databases the user can only read aren't allowed, as the dashboard shows them to other people
+  it('save (read only access)', () => {
+    saveDashboard([widget('default', ownDB), widget('first', sharedDB)]).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body).to.eq("You need write access to 'first/" + sharedDB + "' to show its visualisation " +
+          "'dashvis' on a dashboard, unless the visualisation is public")
+      }
+    )
+  })
+
+  // Databases the user can't see at all aren't found
+  it('save (no access)', () => {
+    saveDashboard([widget('first', privateDB)]).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body).to.eq("Database 'first/" + privateDB + "' doesn't exist")
+      }
+    )
+  })
+
+  // The visualisations of public databases can be shown by anyone
+  it('save (public database)', () => {
+    saveDashboard([widget('default', ownDB), widget('first', publicDB)]).its('status').should('eq', 200)
+  })
+
+  // Public visualisations can be shown by anyone too, even when the database is private
+  it('save (public visualisation)', () => {
+    cy.request('/x/test/switchfirst')
+    cy.request({
+      method: 'POST',
+      url: '/x/vispublic/first/' + encodeURIComponent(sharedDB),
+      form: true,
+      body: {
+        visname: 'dashvis',
+        public: 'true'
+      },
+    })
+    cy.request('/x/test/switchdefault')
+    saveDashboard([widget('default', ownDB), widget('first', sharedDB)]).its('status').should('eq', 200)
+  })
+
+  // Widgets need to show saved visualisations, and can't be refreshed too often
+  it('save (invalid widgets)', () => {
+    saveDashboard([{db_owner: 'default', db_name: ownDB, vis_name: 'unknownvis'}]).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body).to.eq("Visualisation 'unknownvis' doesn't exist for database 'default/" + ownDB + "'")
+      }
+    )
+    saveDashboard([widget('default', ownDB, 2)]).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body).to.eq('The refresh interval of widgets must be at least 5 seconds')
+      }
+    )
+  })
+
+  // Private dashboards can only be seen by their owner, public ones by everyone
+  it('public', () => {
+    cy.request('/x/test/switchfirst')
+    cy.request({url: '/dashboard/default/testdash', failOnStatusCode: false}).its('status').should('eq', 404)
+    cy.request('/x/test/switchdefault')
+
+    saveDashboard([widget('default', ownDB)], true).its('status').should('eq', 200)
+    cy.request('/x/test/switchfirst')
+    cy.request('/dashboard/default/testdash').then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.match(imageURL)
+      }
+    )
+    cy.request('/x/test/switchdefault')
+  })
+
+  // Delete the dashboard
+  it('delete', () => {
+    cy.request({
+      method: 'POST',
+      url: '/x/dashboarddel',
+      form: true,
+      body: {
+        name: 'testdash'
+      },
+    }).its('status').should('eq', 200)
+
+    // It's gone for everyone else, and its owner gets an empty one to start again with
+    cy.request('/x/test/switchfirst')
+    cy.request({url: '/dashboard/default/testdash', failOnStatusCode: false}).its('status').should('eq', 404)
+    cy.request('/x/test/switchdefault')
+    cy.request('/dashboard/default/testdash').then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).not.to.match(imageURL)
+      }
+    )
+  })
+})
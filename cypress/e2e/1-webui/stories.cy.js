@@ -0,0 +1,152 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const dbName = 'stories.sqlite';
+const dbPath = 'default/' + encodeURIComponent(dbName);
+
+// The SQL blocks of a story are run when it's shown, with the results included in the page
+const story = '# Test story\n\nThe items of the database:\n\n```sql\nSELECT \'story result \' || count(*) FROM items\n```\n';
+
+// Saves a data story on the test database, as the logged in user
+function saveStory(name, body) {
+  return cy.request({
+    method: 'POST',
+    url: '/x/storysave/' + dbPath,
+    body: {
+      name: name,
+      body: body
+    },
+    failOnStatusCode: false,
+  })
+}
+
+// Calls one of the other data story requests of the web UI on the test database
+function storyCall(call, name) {
+  return cy.request({
+    method: 'POST',
+    url: '/x/' + call + '/' + dbPath,
+    form: true,
+    body: {
+      name: name
+    },
+    failOnStatusCode: false,
+  })
+}
+
+// Shows a data story of the test database
+function storyPage(name) {
+  return cy.request({
+    url: '/story/' + dbPath,
+    qs: {name: name},
+    failOnStatusCode: false,
+  })
+}
+
+describe('data stories', () => {
+  before(() => {
+    // Seed data, then add a private database which is shared read only with the first user
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [{owner: 'default', name: dbName}],
+          shares: [{dbowner: 'default', dbname: dbName, user: 'first'}]
+        })
+      },
+    })
+  })
+
+  after(() => {
+    // Make sure the default user is logged in for the other tests
+    cy.request('/x/test/switchdefault')
+  })
+
+  // Save a data story, which runs its SQL when shown
+  it('save', () => {
+    saveStory('teststory', story).its('status').should('eq', 200)
+    storyPage('teststory').then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.contain('story result 10')
+        expect(response.body).to.match(/canEdit: *true/)
+      }
+    )
+  })
+
+  // Invalid story names are refused
+  it('save (invalid)', () => {
+    saveStory('', story).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body).to.match(/^Error when validating data story name/)
+      }
+    )
+  })
+
+  // Users who can read the database can see its stories, but not change or delete them
+  it('read only access', () => {
+    cy.request('/x/test/switchfirst')
+    storyPage('teststory').then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.contain('story result 10')
+        expect(response.body).to.match(/canEdit: *false/)
+      }
+    )
+    saveStory('teststory', '# Changed').then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body).to.eq("You don't have write access to this database")
+      }
+    )
+    storyCall('storydel', 'teststory').then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body).to.eq("You don't have write access to this database")
+      }
+    )
+
+    // Stories which don't exist can't be started by users without write access
+    storyPage('unknownstory').its('status').should('eq', 404)
+    cy.request('/x/test/switchdefault')
+  })
+
+  // Users without access to the database can't see its stories at all
+  it('no access', () => {
+    cy.request('/x/test/switchsecond')
+    storyPage('teststory').its('status').should('eq', 404)
+    storyCall('storyexport', 'teststory').then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body).to.eq("Database 'default/" + dbName + "' doesn't exist")
+      }
+    )
+    saveStory('teststory', '# Changed').its('status').should('eq', 403)
+    cy.request('/x/test/switchdefault')
+  })
+
+  // Stories can be exported as standalone HTML documents
+  it('export', () => {
+    storyCall('storyexport', 'teststory').then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.headers['content-disposition']).to.eq('attachment; filename="teststory.html"')
+        expect(response.body).to.contain('<td>story result 10</td>')
+      }
+    )
+    storyCall('storyexport', 'unknownstory').then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body).to.eq("Data story 'unknownstory' not found")
+      }
+    )
+  })
+
+  // Delete the story
+  it('delete', () => {
+    storyCall('storydel', 'teststory').its('status').should('eq', 200)
+    storyCall('storyexport', 'teststory').its('status').should('eq', 404)
+  })
+})
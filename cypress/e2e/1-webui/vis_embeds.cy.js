@@ -0,0 +1,189 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const dbName = 'embeds.sqlite';
+const visName = 'embedvis';
+
+// Calls one of the visualisation requests of the web UI on the (private) test database
+function visCall(call, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: '/x/' + call + '/default/' + encodeURIComponent(dbName),
+    form: true,
+    body: Object.assign({visname: visName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Requests the rendered image of the test visualisation
+function visImage(params = {}) {
+  return cy.request({
+    url: '/x/visimage/default/' + encodeURIComponent(dbName),
+    qs: Object.assign({visname: visName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('visualisation embeds', () => {
+  before(() => {
+    // Seed data, then add a private database with a saved visualisation
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [{owner: 'default', name: dbName}]
+        })
+      },
+    })
+    cy.request({
+      method: 'POST',
+      url: '/x/vissave/default/' + encodeURIComponent(dbName) + '?visname=' + visName,
+      body: {
+        chart_type: 'vbc',
+        sql: 'SELECT name, value FROM items',
+        x_axis_label: 'name',
+        y_axis_label: 'value'
+      },
+    })
+  })
+
+  after(() => {
+    // Make sure the default user is logged in for the other tests
+    cy.request('/x/test/switchdefault')
+  })
+
+  // The owner of the database gets the rendered image
+  it('image', () => {
+    visImage().then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.headers['content-type']).to.contain('image/svg+xml')
+        expect(response.body).to.contain('<svg')
+      }
+    )
+    visImage({format: 'png'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.headers['content-type']).to.contain('image/png')
+      }
+    )
+    visImage({format: 'gif'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body).to.eq('Unknown image format')
+      }
+    )
+  })
+
+  // Other users can't see the visualisation of a private database
+  it('image (no access)', () => {
+    cy.request('/x/test/switchfirst')
+    visImage().then(
+      (response) => {
+        expect(response.status).to.eq(404)
+      }
+    )
+    cy.request({
+      url: '/visembed/default/' + encodeURIComponent(dbName),
+      qs: {visname: visName},
+      failOnStatusCode: false,
+    }).its('status').should('eq', 404)
+    cy.request('/x/test/switchdefault')
+  })
+
+  // Only users with write access to the database can create embed tokens or make visualisations public
+  it('no write access', () => {
+    cy.request('/x/test/switchfirst')
+    visCall('visembedtoken').then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body).to.eq('Database not found')
+      }
+    )
+    visCall('vispublic', {public: 'true'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+      }
+    )
+    cy.request('/x/test/switchdefault')
+  })
+
+  // Embed tokens are valid for between 1 and 365 days, and only for saved visualisations
+  it('embed token (invalid)', () => {
+    for (const days of ['0', '366', 'abc']) {
+      visCall('visembedtoken', {days: days}).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body).to.eq('The number of days must be between 1 and 365')
+        }
+      )
+    }
+    visCall('visembedtoken', {visname: 'unknownvis'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body).to.eq('Visualisation not found')
+      }
+    )
+  })
+
+  // An embed token lets people without access to the database see the visualisation, but only as an image
+  it('embed token', () => {
+    visCall('visembedtoken', {days: '7'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        let jsonBody = JSON.parse(response.body)
+        expect(jsonBody).to.have.property('token')
+        expect(jsonBody).to.have.property('expiry')
+        let token = jsonBody.token
+
+        cy.request('/x/test/switchfirst')
+        visImage({token: token}).then(
+          (response) => {
+            expect(response.status).to.eq(200)
+            expect(response.headers['content-type']).to.contain('image/svg+xml')
+          }
+        )
+
+        // The embed page only has the image, not the details of the visualisation or the database branches
+        cy.request({
+          url: '/visembed/default/' + encodeURIComponent(dbName),
+          qs: {visname: visName, token: token},
+        }).then(
+          (response) => {
+            expect(response.status).to.eq(200)
+            expect(response.body).to.contain('/x/visimage/default/')
+            expect(response.body).not.to.contain('visualisationData')
+            expect(response.body).not.to.contain('branchData')
+            expect(response.body).not.to.contain('SELECT name, value FROM items')
+          }
+        )
+
+        // Tokens are only valid for the visualisation they were created for, and can't be changed
+        visImage({visname: 'othervis', token: token}).its('status').should('eq', 404)
+        visImage({token: token.slice(0, -2) + (token.endsWith('AA') ? 'BB' : 'AA')}).its('status').should('eq', 404)
+        cy.request('/x/test/switchdefault')
+      }
+    )
+  })
+
+  // Public visualisations can be seen by everyone, until they're made private again
+  it('public', () => {
+    visCall('vispublic', {public: 'maybe'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body).to.eq('Invalid public status')
+      }
+    )
+    visCall('vispublic', {public: 'true'}).its('status').should('eq', 200)
+    cy.request('/x/test/switchfirst')
+    visImage().its('status').should('eq', 200)
+    cy.request('/x/test/switchdefault')
+
+    visCall('vispublic', {public: 'false'}).its('status').should('eq', 200)
+    cy.request('/x/test/switchfirst')
+    visImage().its('status').should('eq', 404)
+    cy.request('/x/test/switchdefault')
+  })
+})
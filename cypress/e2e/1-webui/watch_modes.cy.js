@@ -0,0 +1,159 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const userKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const dbName = 'watch modes.sqlite';
+const privateDB = 'watch modes private.sqlite';
+
+// Events are turned into status updates by a background loop, which runs every couple of seconds
+const eventWaitTime = 5000;
+
+// Changes the watch mode of the default user for one of the databases of the first user
+function setWatchMode(mode, db = dbName) {
+  return cy.request({
+    method: 'POST',
+    url: '/x/watchmode/first/' + encodeURIComponent(db),
+    form: true,
+    body: {
+      mode: mode
+    },
+    failOnStatusCode: false,
+  })
+}
+
+// Starts a discussion on the test database as the first user, then waits for the status updates to be added
+function startDiscussion(title) {
+  cy.request('/x/test/switchfirst')
+  cy.request({
+    method: 'POST',
+    url: '/x/creatediscuss',
+    form: true,
+    body: {
+      username: 'first',
+      dbname: dbName,
+      title: title,
+      disctxt: 'Discussion started by the Cypress tests'
+    },
+  })
+  cy.request('/x/test/switchdefault')
+  cy.wait(eventWaitTime)
+}
+
+// Returns the titles of the status updates the default user has for the test database
+function statusUpdateTitles() {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/statusupdates',
+    form: true,
+    body: {
+      apikey: userKey
+    },
+  }).then((response) => response.body.updates.filter(u => u.database === 'first/' + dbName).map(u => u.title))
+}
+
+describe('watch modes', () => {
+  before(() => {
+    // Seed data, then add a public and a private database for the first user
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'first', name: dbName, public: true},
+            {owner: 'first', name: privateDB}
+          ]
+        })
+      },
+    })
+    cy.request('/x/test/switchdefault')
+  })
+
+  after(() => {
+    // Make sure the default user is logged in for the other tests
+    cy.request('/x/test/switchdefault')
+  })
+
+  // Setting a watch mode starts watching the database
+  it('set', () => {
+    setWatchMode('releases').then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.eq('1')
+      }
+    )
+    cy.request('/first/' + encodeURIComponent(dbName)).then(
+      (response) => {
+        expect(response.body).to.contain('watchMode: "releases"')
+      }
+    )
+  })
+
+  // Unknown watch modes are refused, as are databases the user can't see
+  it('set (invalid)', () => {
+    setWatchMode('sometimes').then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body).to.eq('Unknown watch mode')
+      }
+    )
+    setWatchMode('all', privateDB).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body).to.eq("Database 'first/" + privateDB + "' doesn't exist")
+      }
+    )
+  })
+
+  // Watchers only wanting releases don't get told about new discussions
+  it('releases only', () => {
+    startDiscussion('Releases only test')
+    statusUpdateTitles().should('deep.eq', [])
+  })
+
+  // The watch mode can be changed through the API too
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="first" \
+  //       -F dbname="watch modes.sqlite" -F dbwatch="all" https://localhost:9444/v1/notificationprefssave
+  it('set (API)', () => {
+    const params = {apikey: userKey, dbowner: 'first', dbname: dbName}
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/notificationprefssave',
+      form: true,
+      body: Object.assign({}, params, {dbwatch: 'sometimes'}),
+      failOnStatusCode: false,
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid value for dbwatch')
+      }
+    )
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/notificationprefssave',
+      form: true,
+      body: Object.assign({}, params, {apikey: roKey, dbwatch: 'all'}),
+      failOnStatusCode: false,
+    }).its('status').should('eq', 401)
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/notificationprefssave',
+      form: true,
+      body: Object.assign({}, params, {dbwatch: 'all'}),
+    }).its('status').should('eq', 200)
+    cy.request('/first/' + encodeURIComponent(dbName)).then(
+      (response) => {
+        expect(response.body).to.contain('watchMode: "all"')
+      }
+    )
+  })
+
+  // Watchers wanting everything get told about new discussions
+  it('all', () => {
+    startDiscussion('All activity test')
+    statusUpdateTitles().should('deep.eq', ['All activity test'])
+  })
+})
@@ -0,0 +1,18 @@
+describe('health', () => {
+  // The health of the API server's PostgreSQL connection pool doesn't need an API key
+  //   Equivalent curl command:
+  //     curl -k https://localhost:9444/health
+  it('health', () => {
+    cy.request('https://localhost:9444/health').then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.status).to.eq('ok')
+        expect(response.body.database.status).to.eq('ok')
+        expect(response.body.database.max_conns).to.be.greaterThan(0)
+        expect(response.body.database.total_conns).to.be.at.most(response.body.database.max_conns)
+        expect(response.body.database).to.include.keys(['acquire_count', 'acquire_duration_ms', 'acquired_conns',
+          'canceled_acquire_count', 'empty_acquire_count', 'idle_conns', 'ping_duration_ms'])
+      }
+    )
+  })
+})
@@ -0,0 +1,254 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const defaultKey = 'eL31ckFyWjKB0gTxFhTAzsS8xsoYK2v6fWg48Q6Ai7THhoz3JCY9VA'; // Key created for user 'default'
+const liveDB = 'maintenance live.sqlite';
+const standardDB = 'maintenance.sqlite';
+
+// The web UI checks for changes to read only mode every few seconds
+const refreshWait = 6000;
+
+// Switches read only mode on or off
+function setReadOnly(readOnly, message = '') {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/maintenanceset',
+    form: true,
+    body: {
+      apikey: adminKey,
+      readonly: readOnly,
+      message: message
+    },
+  })
+}
+
+// Runs a SQL statement on the live test database from the web UI
+function execLiveSQL(sql) {
+  return cy.request({
+    method: 'POST',
+    url: '/x/execlivesql/default/' + encodeURIComponent(liveDB),
+    body: {sql: sql},
+    failOnStatusCode: false,
+  })
+}
+
+describe('maintenance mode', () => {
+  before(() => {
+    // Seed data, then add the databases the tests change
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: liveDB, live: true},
+            {owner: 'default', name: standardDB, public: true}
+          ],
+          api_keys: [{user: 'default', key: defaultKey}]
+        })
+      },
+    })
+  })
+
+  after(() => {
+    // Make sure read only mode doesn't stay on for the other tests
+    setReadOnly(false)
+    cy.wait(refreshWait)
+  })
+
+  // Read only mode is off to start with
+  //   Equivalent curl command:
+  //     curl -k -F apikey="eL31ckFyWjKB0gTxFhTAzsS8xsoYK2v6fWg48Q6Ai7THhoz3JCY9VA" https://localhost:9444/v1/maintenance
+  it('status', () => {
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/maintenance',
+      form: true,
+      body: {
+        apikey: defaultKey
+      },
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.have.property('read_only', false)
+        expect(response.body).to.have.property('config_read_only', false)
+      }
+    )
+  })
+
+  // Only the instance admins can switch read only mode on or off
+  it('set (not an admin)', () => {
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/maintenanceset',
+      form: true,
+      body: {
+        apikey: defaultKey,
+        readonly: 'true'
+      },
+      failOnStatusCode: false,
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+      }
+    )
+  })
+
+  // Switch read only mode on
+  //   Equivalent curl command:
+  //     curl -k -F apikey="lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ" -F readonly="true" \
+  //       -F message="Cypress maintenance" https://localhost:9444/v1/maintenanceset
+  it('set', () => {
+    setReadOnly(true, 'Cypress maintenance').then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.have.property('status', 'OK')
+      }
+    )
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/maintenance',
+      form: true,
+      body: {
+        apikey: defaultKey
+      },
+    }).then(
+      (response) => {
+        expect(response.body).to.have.property('read_only', true)
+        expect(response.body).to.have.property('message', 'Cypress maintenance')
+        expect(response.body).to.have.property('changed_by', 'testadmin')
+      }
+    )
+    cy.wait(refreshWait)
+  })
+
+  // API calls which change things are refused
+  it('api writes', () => {
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/execute',
+      form: true,
+      body: {
+        apikey: defaultKey,
+        dbowner: 'default',
+        dbname: liveDB,
+        sql: btoa('DELETE FROM items')
+      },
+      failOnStatusCode: false,
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(503)
+        expect(response.headers).to.have.property('retry-after', '300')
+        expect(response.body).to.have.property('error', 'Cypress maintenance')
+      }
+    )
+  })
+
+  // API calls which only read keep working
+  it('api reads', () => {
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/query',
+      form: true,
+      body: {
+        apikey: defaultKey,
+        dbowner: 'default',
+        dbname: liveDB,
+        sql: btoa('SELECT count(*) FROM items')
+      },
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body[0][0]).to.have.property('Value', '10')
+      }
+    )
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/tables',
+      form: true,
+      body: {
+        apikey: defaultKey,
+        dbowner: 'default',
+        dbname: standardDB
+      },
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.include('items')
+      }
+    )
+  })
+
+  // Web UI requests which change things are refused
+  it('webui writes', () => {
+    cy.request({
+      url: '/x/star/default/' + encodeURIComponent(standardDB),
+      failOnStatusCode: false,
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(503)
+        expect(response.body).to.contain('Cypress maintenance')
+      }
+    )
+
+    // Live SQL statements changing the database are refused
+    execLiveSQL('DELETE FROM items').then(
+      (response) => {
+        expect(response.status).to.eq(503)
+        expect(response.body).to.contain('Cypress maintenance')
+      }
+    )
+    execLiveSQL("INSERT INTO items (name, added_in) VALUES ('maintenance', 0) RETURNING id").then(
+      (response) => {
+        expect(response.status).to.eq(503)
+      }
+    )
+  })
+
+  // Web UI pages, and requests which only read, keep working
+  it('webui reads', () => {
+    cy.visit('/default/' + standardDB)
+    cy.get('[data-cy="headerdblnk"]').should('contain', standardDB)
+    execLiveSQL('SELECT count(*) FROM items').then(
+      (response) => {
+        expect(response.status).to.eq(200)
+      }
+    )
+    cy.request({
+      method: 'POST',
+      url: '/x/markdownpreview/',
+      form: true,
+      body: {
+        mkdown: '# Maintenance'
+      },
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.contain('Maintenance</h1>')
+      }
+    )
+  })
+
+  // Switching read only mode off works while it's on, then changes work again
+  it('unset', () => {
+    setReadOnly(false).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+      }
+    )
+    cy.wait(refreshWait)
+    cy.request({
+      url: '/x/star/default/' + encodeURIComponent(standardDB),
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+      }
+    )
+    execLiveSQL('DELETE FROM items').then(
+      (response) => {
+        expect(response.status).to.eq(200)
+      }
+    )
+  })
+})
@@ -0,0 +1,129 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const seedKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const userKey = 'E1SN2w9spysn6DYTjumXIF0blgQm2c3N63BQDPcPeYFsCXAFCQx-IQ'; // Key created for user 'migrateuser'
+const dbName = 'migrations.sqlite';
+
+// Calls an API call with the key of the user created after resetting
+function apiCall(call, params = {}, failOnStatusCode = true) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: userKey}, params),
+    failOnStatusCode: failOnStatusCode,
+  })
+}
+
+describe('schema migrations', () => {
+  // Seeding resets the database each time, building the schema again from the migrations
+  it('seed twice', () => {
+    cy.request('/x/test/seed').its('status').should('eq', 200)
+    cy.request('/x/test/seed').its('status').should('eq', 200)
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/databases',
+      form: true,
+      body: {
+        apikey: seedKey
+      },
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.include('Assembly Election 2017.sqlite')
+      }
+    )
+  })
+
+  // Resetting leaves only the default data of the system
+  //   Equivalent curl command:
+  //     curl -k -F apikey="lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ" \
+  //       -F fixtures='{"reset": true, ...}' https://localhost:9444/v1/testfixtures
+  it('reset', () => {
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          reset: true,
+          users: [{name: 'testadmin', admin: true}, {name: 'migrateuser'}],
+          databases: [{owner: 'migrateuser', name: dbName}],
+          api_keys: [{user: 'testadmin', key: adminKey}, {user: 'migrateuser', key: userKey}]
+        })
+      },
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+      }
+    )
+
+    // The seed data is gone
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/databases',
+      form: true,
+      body: {
+        apikey: seedKey
+      },
+      failOnStatusCode: false,
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(401)
+      }
+    )
+    apiCall('databases').then(
+      (response) => {
+        expect(response.body).to.deep.eq([dbName])
+      }
+    )
+  })
+
+  // The default licences are added again
+  it('default licences', () => {
+    apiCall('licences').then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.include.keys(['CC0', 'Not specified'])
+      }
+    )
+  })
+
+  // The default discussion labels are added again
+  it('default labels', () => {
+    apiCall('labels', {dbowner: 'migrateuser', dbname: dbName}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.map(l => l.name)).to.include.members(['bug', 'data-error', 'enhancement'])
+      }
+    )
+  })
+
+  // The tables added by the newer migrations are there
+  it('newer tables', () => {
+    apiCall('maintenance').then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.have.property('read_only', false)
+      }
+    )
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/invitations',
+      form: true,
+      body: {
+        apikey: adminKey
+      },
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.have.lengthOf(0)
+      }
+    )
+  })
+
+  after(() => {
+    // Put the standard test data back for the other tests
+    cy.request('/x/test/seed')
+  })
+})
@@ -0,0 +1,245 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const liveDB = 'alert rules live.sqlite';
+const standardDB = 'alert rules.sqlite';
+const ruleName = 'Too few items';
+
+// The settings of the test alert rule
+const rule = {
+  name: ruleName,
+  dbowner: 'default',
+  dbname: liveDB,
+  query: 'Item count',
+  schedule: '0 * * * *',
+  metric: 'rows',
+  condition: 'below',
+  threshold: '5',
+  delivery: 'email'
+}
+
+// Calls an API call.  Calls for alert rules don't take a database, so it's only added when given
+function apiCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('alert rules', () => {
+  let secret = ''
+
+  before(() => {
+    // Seed data, then add a live database which is shared read only with the first user, along with a saved query for
+    // the alert rules.  Also add a standard database
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: liveDB, live: true},
+            {owner: 'default', name: standardDB}
+          ],
+          shares: [{dbowner: 'default', dbname: liveDB, user: 'first'}]
+        })
+      },
+    })
+    for (const dbName of [liveDB, standardDB]) {
+      apiCall('savedquerysave', ownerKey, {
+        dbowner: 'default',
+        dbname: dbName,
+        name: 'Item count',
+        sql: btoa('SELECT count(*) FROM items')
+      }).its('status').should('eq', 200)
+    }
+  })
+
+  // Add an alert rule, then change it
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F name="Too few items" \
+  //       -F dbowner="default" -F dbname="alert rules live.sqlite" -F query="Item count" -F schedule="0 * * * *" \
+  //       -F metric="rows" -F condition="below" -F threshold="5" -F delivery="email" \
+  //       https://localhost:9444/v1/alertrulesave
+  it('save', () => {
+    apiCall('alertrulesave', ownerKey, rule).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.webhook_secret).to.match(/^[0-9a-f]{64}$/)
+        expect(new Date(response.body.next_run).getUTCMinutes()).to.eq(0)
+        secret = response.body.webhook_secret
+      }
+    )
+    apiCall('alertrules', ownerKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.have.lengthOf(1)
+        expect(response.body[0]).to.include({
+          name: ruleName,
+          owner: 'default',
+          database: liveDB,
+          query_name: 'Item count',
+          schedule: '0 * * * *',
+          metric: 'rows',
+          condition: 'below',
+          threshold: 5,
+          delivery: 'email',
+          triggered: false,
+          user: 'default',
+          last_run: null,
+          last_value: null
+        })
+      }
+    )
+
+    // Changing the rule keeps its webhook secret
+    apiCall('alertrulesave', ownerKey, Object.assign({}, rule, {
+      metric: 'value',
+      condition: 'drop',
+      threshold: '20.5',
+      delivery: 'webhook',
+      webhookurl: 'https://example.org/alerts'
+    })).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.webhook_secret).to.eq(secret)
+      }
+    )
+    apiCall('alertrules', ownerKey).then(
+      (response) => {
+        expect(response.body).to.have.lengthOf(1)
+        expect(response.body[0]).to.include({
+          metric: 'value',
+          condition: 'drop',
+          threshold: 20.5,
+          delivery: 'webhook',
+          webhook_url: 'https://example.org/alerts'
+        })
+      }
+    )
+    apiCall('alertrulesave', ownerKey, rule).its('status').should('eq', 200)
+  })
+
+  // Return the evaluations of an alert rule.  Rules are evaluated on their schedule, so a new one doesn't have any yet
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F name="Too few items" \
+  //       https://localhost:9444/v1/alerthistory
+  it('history', () => {
+    apiCall('alerthistory', ownerKey, {name: ruleName}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq([])
+      }
+    )
+  })
+
+  // Alert rules belong to the user who added them, so other users can't see or change them
+  it('not the owner', () => {
+    for (const key of [readerKey, otherKey]) {
+      apiCall('alertrules', key).its('body').should('deep.eq', [])
+      apiCall('alerthistory', key, {name: ruleName}).its('body').should('deep.eq', [])
+      apiCall('alertruledelete', key, {name: ruleName}).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(response.body.error).to.eq("Alert rule 'Too few items' not found")
+        }
+      )
+    }
+
+    // Rules can only be added for databases the user has access to
+    apiCall('alertrulesave', otherKey, rule).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+      }
+    )
+
+    // The saved query of another user can't be used
+    apiCall('alertrulesave', readerKey, rule).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Saved query 'Item count' not found")
+      }
+    )
+
+    // Read only API keys can't change rules
+    for (const call of ['alertrulesave', 'alertruledelete']) {
+      apiCall(call, roKey, rule).its('status').should('eq', 401)
+    }
+
+    // Nothing was changed
+    apiCall('alertrules', ownerKey).then(
+      (response) => {
+        expect(response.body).to.have.lengthOf(1)
+        expect(response.body[0]).to.include({metric: 'rows', condition: 'below', threshold: 5, delivery: 'email'})
+      }
+    )
+  })
+
+  // Invalid requests are refused
+  it('invalid', () => {
+    for (const [params, status, message] of [
+      [{name: ''}, 400, 'Invalid alert rule name'],
+      [{name: 'a'.repeat(64)}, 400, 'Invalid alert rule name'],
+      [{schedule: ''}, 400, 'A cron schedule needs five fields: minute, hour, day of month, month, and day of week'],
+      [{schedule: '*/5 * * * *'}, 400, "Reports can't run more often than every 15 minutes"],
+      [{threshold: ''}, 400, 'Invalid threshold'],
+      [{threshold: 'NaN'}, 400, 'Invalid threshold'],
+      [{threshold: 'Inf'}, 400, 'Invalid threshold'],
+      [{metric: 'size'}, 400, "Unknown metric.  Must be either 'rows' or 'value'"],
+      [{condition: 'over'}, 400, "Unknown condition.  Must be one of 'above', 'below', 'equal', 'drop', or 'rise'"],
+      [{condition: 'rise', threshold: '0'}, 400, "The threshold of 'drop' and 'rise' conditions is a percentage, which needs to be above 0"],
+      [{condition: 'drop', threshold: '101'}, 400, "Values can't drop by more than 100%"],
+      [{delivery: 'sms'}, 400, "Unknown delivery method.  Must be either 'email' or 'webhook'"],
+      [{delivery: 'webhook', webhookurl: 'ftp://example.org/alerts'}, 400, 'The webhook needs to be a http or https address'],
+      [{dbname: ''}, 400, 'Invalid database owner or name'],
+      [{query: ''}, 400, 'Invalid saved query name'],
+      [{dbname: standardDB}, 400, 'Alert rules can only be used with live databases'],
+      [{query: 'Missing'}, 404, "Saved query 'Missing' not found"]
+    ]) {
+      apiCall('alertrulesave', ownerKey, Object.assign({}, rule, {name: 'Invalid'}, params)).then(
+        (response) => {
+          expect(response.status).to.eq(status)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+    for (const [call, params, status, message] of [
+      ['alertruledelete', {name: 'Missing'}, 404, "Alert rule 'Missing' not found"],
+      ['alerthistory', {name: ''}, 400, 'Invalid alert rule name']
+    ]) {
+      apiCall(call, ownerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(status)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+
+    // Nothing was changed
+    apiCall('alertrules', ownerKey).its('body').should('have.lengthOf', 1)
+  })
+
+  // Remove an alert rule
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F name="Too few items" \
+  //       https://localhost:9444/v1/alertruledelete
+  it('delete', () => {
+    apiCall('alertruledelete', ownerKey, {name: ruleName}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+    apiCall('alertrules', ownerKey).its('body').should('deep.eq', [])
+    apiCall('alertruledelete', ownerKey, {name: ruleName}).its('status').should('eq', 404)
+  })
+})
@@ -0,0 +1,110 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'analytics.sqlite';
+
+// Requests the analytics of the test database
+function analytics(key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/analytics',
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('analytics', () => {
+  before(() => {
+    // Seed data, then add a private database which the second user can change
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [{owner: 'default', name: dbName}],
+          shares: [{dbowner: 'default', dbname: dbName, user: 'second', write: true}]
+        })
+      },
+    })
+  })
+
+  after(() => {
+    // Make sure the default user is logged in for the other tests
+    cy.request('/x/test/switchdefault')
+  })
+
+  // The owner of the database can see its analytics, with a read only key too
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="analytics.sqlite" -F from="2026-09-01" -F to="2026-09-30" https://localhost:9444/v1/analytics
+  it('owner', () => {
+    for (const key of [ownerKey, roKey]) {
+      analytics(key, {from: '2026-09-01', to: '2026-09-30'}).then(
+        (response) => {
+          expect(response.status).to.eq(200)
+          expect(response.body).to.have.all.keys('days', 'downloads_by', 'totals')
+          expect(response.body.totals).to.have.all.keys('api_queries', 'clones', 'downloads', 'views')
+        }
+      )
+    }
+  })
+
+  // Nobody else can, even with write access to the database
+  it('other users', () => {
+    analytics(writerKey).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body.error).to.eq('Only the owner of a database can see its analytics')
+      }
+    )
+    analytics(otherKey).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+      }
+    )
+  })
+
+  // Invalid date ranges are refused
+  it('invalid', () => {
+    analytics(ownerKey, {from: '01/09/2026'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("Invalid 'from' date.  It needs to be in YYYY-MM-DD format")
+      }
+    )
+    analytics(ownerKey, {to: 'yesterday'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("Invalid 'to' date.  It needs to be in YYYY-MM-DD format")
+      }
+    )
+    for (const range of [{from: '2026-09-30', to: '2026-09-01'}, {from: '2025-01-01', to: '2026-09-30'}]) {
+      analytics(ownerKey, range).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq('Invalid date range.  It needs to cover between 1 and 366 days')
+        }
+      )
+    }
+  })
+
+  // The insights page is only shown to the owner of the database
+  it('insights page', () => {
+    cy.request('/insights/default/' + encodeURIComponent(dbName)).its('status').should('eq', 200)
+    cy.request('/x/test/switchsecond')
+    cy.request({url: '/insights/default/' + encodeURIComponent(dbName), failOnStatusCode: false}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body).to.contain('You can only see the insights for your own databases')
+      }
+    )
+    cy.request('/x/test/switchdefault')
+  })
+})
@@ -0,0 +1,144 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const userKey = 'iyyL03EN8BMxbK0pWyCWHzE6VEZ4Pm-dcKXLuMUdt04hGLcnYtrVcg'; // Key created for user 'apicallsuser'
+const roKey = 'aAr6iVfwc7_xUcAIi9mike7eLsry0epOhAFfMtQBL8yx0nnHnTnybg'; // Read only key created for user 'apicallsuser'
+const otherKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first'
+const dbName = 'api calls.sqlite';
+
+// Calls are logged once they've finished, which can be just after their response has been received
+const logWaitTime = 500;
+
+// Calls one of the API calls
+function apiCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('API call log', () => {
+  let keyIDs = {}
+
+  before(() => {
+    // Seed data, then add a user with two keys, and make a few calls with them
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          users: [{name: 'apicallsuser'}],
+          databases: [{owner: 'apicallsuser', name: dbName}],
+          api_keys: [{user: 'apicallsuser', key: userKey}, {user: 'apicallsuser', key: roKey, read_only: true}]
+        })
+      },
+    })
+    apiCall('databases', userKey)
+    apiCall('query', userKey, {dbowner: 'apicallsuser', dbname: 'no such database.sqlite', sql: btoa('SELECT 1')})
+    apiCall('tables', roKey, {dbowner: 'apicallsuser', dbname: dbName})
+    cy.wait(logWaitTime)
+  })
+
+  // Each key's calls are summarised
+  //   Equivalent curl command:
+  //     curl -k -F apikey="iyyL03EN8BMxbK0pWyCWHzE6VEZ4Pm-dcKXLuMUdt04hGLcnYtrVcg" -F days="7" \
+  //       https://localhost:9444/v1/apikeyusage
+  it('key usage', () => {
+    apiCall('apikeyusage', userKey, {days: '7'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.days).to.eq(7)
+        expect(response.body.keys).to.have.lengthOf(2)
+        for (const k of response.body.keys) {
+          expect(k.key_uuid).to.match(/^[0-9a-f-]{36}$/)
+          expect(k.last_call).not.to.be.null
+        }
+
+        // The key with a failed call is the read-write one
+        const rw = response.body.keys.find(k => k.errors > 0)
+        const ro = response.body.keys.find(k => k.errors === 0)
+        expect(rw.num_calls).to.eq(2)
+        expect(rw.errors).to.eq(1)
+        expect(ro.num_calls).to.eq(1)
+        keyIDs = {rw: rw.key_uuid, ro: ro.key_uuid}
+      }
+    )
+  })
+
+  // List the recent calls, newest first
+  //   Equivalent curl command:
+  //     curl -k -F apikey="iyyL03EN8BMxbK0pWyCWHzE6VEZ4Pm-dcKXLuMUdt04hGLcnYtrVcg" -F failed="true" \
+  //       https://localhost:9444/v1/apicalls
+  it('calls', () => {
+    apiCall('apicalls', userKey, {failed: 'true'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.total).to.eq(1)
+        expect(response.body.calls[0]).to.include({endpoint: '/v1/query', status_code: 404, key_uuid: keyIDs.rw})
+      }
+    )
+    apiCall('apicalls', userKey, {key: keyIDs.ro}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.total).to.eq(1)
+        expect(response.body.calls[0]).to.include({endpoint: '/v1/tables', owner: 'apicallsuser', database: dbName})
+      }
+    )
+    apiCall('apicalls', userKey, {limit: '1', offset: '1'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.calls).to.have.lengthOf(1)
+      }
+    )
+  })
+
+  // Users only see the calls made with their own keys
+  it('other users', () => {
+    apiCall('apicalls', otherKey, {key: keyIDs.rw}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.total).to.eq(0)
+      }
+    )
+    apiCall('apikeyusage', otherKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.keys.map(k => k.key_uuid)).not.to.include.members([keyIDs.rw, keyIDs.ro])
+      }
+    )
+  })
+
+  // Invalid filters and paging parameters are refused
+  it('invalid', () => {
+    apiCall('apicalls', userKey, {failed: 'maybe'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid value for failed')
+      }
+    )
+    apiCall('apicalls', userKey, {offset: '-1'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid offset')
+      }
+    )
+    apiCall('apicalls', userKey, {limit: '101'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid limit.  It needs to be between 1 and 100')
+      }
+    )
+    for (const days of ['0', '367']) {
+      apiCall('apikeyusage', userKey, {days: days}).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq('Invalid number of days.  It needs to be between 1 and 366')
+        }
+      )
+    }
+  })
+})
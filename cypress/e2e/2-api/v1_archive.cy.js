@@ -0,0 +1,157 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'archive.sqlite';
+const liveDB = 'archive live.sqlite';
+const archivedError = "This database has been archived by its owner, so it's read only";
+
+// Calls an API call for one of the test databases
+function apiCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Adds a new commit to the standard test database, holding the same data as its head commit
+function uploadNewCommit(headCommit) {
+  return apiCall('download', ownerKey, {}).then((download) => {
+    // Manually construct a form data object, as cy.request() doesn't yet have proper support for form data
+    const z = new FormData()
+    z.set('apikey', ownerKey)
+    z.set('dbname', dbName)
+    z.set('commit', headCommit)
+    z.set('file', Cypress.Blob.binaryStringToBlob(download.body))
+    return cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/upload',
+      body: z,
+      failOnStatusCode: false,
+    }).then((response) => {
+      // The response body arrives as an ArrayBuffer, as the request was sent as form data
+      response.body = JSON.parse(Cypress.Blob.arrayBufferToBinaryString(response.body))
+      return response
+    })
+  })
+}
+
+describe('archived databases', () => {
+  let headCommit = ''
+
+  before(() => {
+    // Seed data, then add a private database which is shared read only with the first user and read-write with the
+    // second user.  Also add a live database
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: dbName},
+            {owner: 'default', name: liveDB, live: true}
+          ],
+          shares: [
+            {dbowner: 'default', dbname: dbName, user: 'first'},
+            {dbowner: 'default', dbname: dbName, user: 'second', write: true}
+          ]
+        })
+      },
+    }).then((response) => {
+      headCommit = response.body.databases[0].commits[0]
+    })
+  })
+
+  // Archive a database, which makes it read only
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="archive.sqlite" -F archived="true" https://localhost:9444/v1/archive
+  it('archive', () => {
+    apiCall('archive', ownerKey, {archived: 'true'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({archived: true, status: 'OK'})
+      }
+    )
+    apiCall('metadata', readerKey).its('body.archived').should('eq', true)
+
+    // New commits are refused
+    uploadNewCommit(headCommit).then((response) => {
+      expect(response.status).to.eq(403)
+      expect(response.body.error).to.eq(archivedError)
+    })
+
+    // Archived live databases can't be changed either
+    apiCall('archive', ownerKey, {dbname: liveDB, archived: 'true'}).its('status').should('eq', 200)
+    apiCall('execute', ownerKey, {dbname: liveDB, sql: btoa('UPDATE items SET value = 1 WHERE id = 1')}).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body.error).to.eq(archivedError)
+      }
+    )
+
+    // They can still be read
+    apiCall('query', readerKey, {sql: btoa('SELECT count(*) FROM items')}).its('status').should('eq', 200)
+  })
+
+  // Only the owner of a database can archive it
+  it('no write access', () => {
+    apiCall('archive', writerKey, {archived: 'false'}).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body.error).to.eq('Only the owner of a database can archive it')
+      }
+    )
+    apiCall('archive', otherKey, {archived: 'false'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+      }
+    )
+    apiCall('archive', roKey, {archived: 'false'}).its('status').should('eq', 401)
+
+    // Nothing was changed
+    apiCall('metadata', ownerKey).its('body.archived').should('eq', true)
+  })
+
+  // Invalid values are refused
+  it('archive (invalid)', () => {
+    for (const archived of ['', 'maybe']) {
+      apiCall('archive', ownerKey, {archived: archived}).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq('Invalid value for archived')
+        }
+      )
+    }
+    apiCall('metadata', ownerKey).its('body.archived').should('eq', true)
+  })
+
+  // Make the databases writable again
+  it('unarchive', () => {
+    apiCall('archive', ownerKey, {archived: 'false'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({archived: false, status: 'OK'})
+      }
+    )
+    apiCall('metadata', readerKey).its('body.archived').should('eq', false)
+    uploadNewCommit(headCommit).its('status').should('eq', 201)
+
+    apiCall('archive', ownerKey, {dbname: liveDB, archived: 'false'}).its('status').should('eq', 200)
+    apiCall('execute', ownerKey, {dbname: liveDB, sql: btoa('UPDATE items SET value = 1 WHERE id = 1')}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.include({rows_changed: 1})
+      }
+    )
+  })
+})
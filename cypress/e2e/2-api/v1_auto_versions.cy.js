@@ -0,0 +1,199 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const anonKey = 'zp2NgD1HtHElHbMjJWQC9QVN8dLNo3QIGHUtpgYpyDta1BYh7Ump8A'; // Key of user 'versionuser', without a full name
+const liveDB = 'auto versions live.sqlite';
+const otherLiveDB = 'auto versions other live.sqlite';
+const targetDB = 'auto versions.sqlite';
+const archivedDB = 'auto versions archived.sqlite';
+
+// Calls an API call for the test database
+function apiCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: liveDB}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('automatic versions', () => {
+  before(() => {
+    // Seed data, then add two live databases and two standard databases.  The first live database is shared read only
+    // with the first user and read-write with the second user.  Also add a user without a full name, with a live
+    // database and a standard database of their own
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          users: [{name: 'versionuser'}],
+          databases: [
+            {owner: 'default', name: liveDB, live: true},
+            {owner: 'default', name: otherLiveDB, live: true},
+            {owner: 'default', name: targetDB, commits: 2},
+            {owner: 'default', name: archivedDB},
+            {owner: 'versionuser', name: liveDB, live: true},
+            {owner: 'versionuser', name: targetDB}
+          ],
+          shares: [
+            {dbowner: 'default', dbname: liveDB, user: 'first'},
+            {dbowner: 'default', dbname: liveDB, user: 'second', write: true}
+          ],
+          api_keys: [{user: 'versionuser', key: anonKey}]
+        })
+      },
+    })
+    apiCall('archive', ownerKey, {dbname: archivedDB, archived: 'true'}).its('status').should('eq', 200)
+  })
+
+  // Automatically version a live database into a standard database
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="auto versions live.sqlite" -F target="auto versions.sqlite" -F debounce="600" -F keep="20" \
+  //       https://localhost:9444/v1/autoversionset
+  it('set', () => {
+    apiCall('autoversionset', ownerKey, {target: targetDB, debounce: '600', keep: '20'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.include({
+          branch: 'main',
+          database: liveDB,
+          debounce_seconds: 600,
+          failures: 0,
+          interval_minutes: 0,
+          keep_versions: 20,
+          last_version: null,
+          on_write: true,
+          owner: 'default',
+          target: targetDB
+        })
+      }
+    )
+
+    // Changing the settings replaces them
+    apiCall('autoversionset', ownerKey, {target: targetDB, onwrite: 'false', interval: '60'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.include({debounce_seconds: 300, interval_minutes: 60, keep_versions: 0, on_write: false})
+      }
+    )
+  })
+
+  // Return the automatic versioning of a live database
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="auto versions live.sqlite" https://localhost:9444/v1/autoversion
+  it('get', () => {
+    for (const key of [ownerKey, roKey]) {
+      apiCall('autoversion', key).then(
+        (response) => {
+          expect(response.status).to.eq(200)
+          expect(response.body).to.include({branch: 'main', interval_minutes: 60, on_write: false, target: targetDB})
+        }
+      )
+    }
+  })
+
+  // Only the owner of a database can manage its automatic versioning
+  it('not the owner', () => {
+    for (const [call, params] of [
+      ['autoversion', {}],
+      ['autoversionset', {target: targetDB}],
+      ['autoversionremove', {}]
+    ]) {
+      for (const key of [readerKey, writerKey]) {
+        apiCall(call, key, params).then(
+          (response) => {
+            expect(response.status).to.eq(403)
+            expect(response.body.error).to.eq('Only the owner of a database can manage its automatic versioning')
+          }
+        )
+      }
+      apiCall(call, otherKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+        }
+      )
+    }
+    apiCall('autoversionset', roKey, {target: targetDB}).its('status').should('eq', 401)
+    apiCall('autoversionremove', roKey).its('status').should('eq', 401)
+
+    // Nothing was changed
+    apiCall('autoversion', ownerKey).its('body').should('include', {interval_minutes: 60, on_write: false})
+  })
+
+  // Invalid settings are refused
+  it('set (invalid)', () => {
+    for (const [params, status, message] of [
+      [{dbname: targetDB}, 400, 'Only live databases can be automatically versioned'],
+      [{target: ''}, 400, 'Invalid target database name'],
+      [{target: 'missing.sqlite'}, 404, "Database 'default/missing.sqlite' doesn't exist"],
+      [{target: otherLiveDB}, 400, 'The target database needs to be a standard database'],
+      [{target: archivedDB}, 403, "This database has been archived by its owner, so it's read only"],
+      [{dbname: otherLiveDB}, 409, "The live database '" + liveDB + "' is already versioned into that database"],
+      [{branch: 'missing'}, 404, 'Branch not found'],
+      [{onwrite: 'maybe'}, 400, 'Invalid onwrite value'],
+      [{debounce: '9'}, 400, 'The debounce time needs to be between 10 and 86400 seconds'],
+      [{debounce: '86401'}, 400, 'The debounce time needs to be between 10 and 86400 seconds'],
+      [{interval: '-1'}, 400, 'The interval needs to be between 0 and 10080 minutes'],
+      [{interval: '10081'}, 400, 'The interval needs to be between 0 and 10080 minutes'],
+      [{onwrite: 'false', interval: '0'}, 400, 'Versions need to be committed either after changes, or on an interval'],
+      [{keep: '1001'}, 400, 'The number of versions to keep needs to be between 0 and 1000'],
+      [{keep: 'all'}, 400, 'The number of versions to keep needs to be between 0 and 1000']
+    ]) {
+      apiCall('autoversionset', ownerKey, Object.assign({target: targetDB}, params)).then(
+        (response) => {
+          expect(response.status).to.eq(status)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+
+    // The versions are committed in the name of the owner, so they need a full name and email address
+    apiCall('autoversionset', anonKey, {dbowner: 'versionuser', target: targetDB}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('You need to set your full name and email address in Preferences first')
+      }
+    )
+
+    // Nothing was changed
+    apiCall('autoversion', ownerKey).its('body').should('include', {interval_minutes: 60, on_write: false})
+    for (const [key, params] of [[ownerKey, {dbname: otherLiveDB}], [anonKey, {dbowner: 'versionuser'}]]) {
+      apiCall('autoversion', key, params).its('status').should('eq', 404)
+    }
+  })
+
+  // Stop automatically versioning a live database
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="auto versions live.sqlite" https://localhost:9444/v1/autoversionremove
+  it('remove', () => {
+    apiCall('autoversionremove', ownerKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+    for (const call of ['autoversion', 'autoversionremove']) {
+      apiCall(call, ownerKey).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(response.body.error).to.eq("That database isn't being automatically versioned")
+        }
+      )
+    }
+
+    // The target database can be used by another live database now
+    apiCall('autoversionset', ownerKey, {dbname: otherLiveDB, target: targetDB}).its('status').should('eq', 200)
+  })
+})
@@ -0,0 +1,173 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'blobs.sqlite';
+const liveDB = 'blobs live.sqlite';
+
+// The start of a PNG image, which is enough for its content type to be worked out
+const png = '\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR'
+
+// Calls an API call for the test database
+function apiCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Retrieves the value of a cell of the test database, optionally with extra request headers such as a byte range
+function blob(key, params = {}, headers = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/blob',
+    form: true,
+    encoding: 'binary',
+    headers: headers,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName, table: 'items', column: 'name', rowid: '1'},
+      params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('blob', () => {
+  before(() => {
+    // Seed data, then add a standard and a live database which are both shared read only with the first user
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: dbName},
+            {owner: 'default', name: liveDB, live: true}
+          ],
+          shares: [
+            {dbowner: 'default', dbname: dbName, user: 'first'},
+            {dbowner: 'default', dbname: liveDB, user: 'first'}
+          ]
+        })
+      },
+    })
+
+    // Add a table holding an image and some HTML to the live database, and a table without rowids
+    for (const sql of [
+      'CREATE TABLE files(id INTEGER PRIMARY KEY, data BLOB)',
+      "INSERT INTO files VALUES (1, X'" + Array.from(png, (c) => c.charCodeAt(0).toString(16).padStart(2, '0')).join('') + "')",
+      "INSERT INTO files VALUES (2, '<html><script>alert(1)</script></html>')",
+      'INSERT INTO files VALUES (3, NULL)',
+      'CREATE TABLE keyed(k TEXT PRIMARY KEY, v BLOB) WITHOUT ROWID',
+      "INSERT INTO keyed VALUES ('a', X'00')"
+    ]) {
+      apiCall('execute', ownerKey, {dbname: liveDB, sql: btoa(sql)}).its('status').should('eq', 200)
+    }
+  })
+
+  // Return the value of a cell from a standard database
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+  //       -F dbname="blobs.sqlite" -F table="items" -F column="name" -F rowid="1" https://localhost:9444/v1/blob
+  it('standard database', () => {
+    blob(readerKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.eq('Item 1.1')
+        expect(response.headers['content-type']).to.eq('text/plain; charset=utf-8')
+        expect(response.headers['content-disposition']).to.match(/^inline; filename="items-name-1\./)
+        expect(response.headers['accept-ranges']).to.eq('bytes')
+        expect(response.headers).to.have.property('etag')
+      }
+    )
+
+    // Part of the value can be retrieved with a range request
+    blob(readerKey, {}, {Range: 'bytes=5-7'}).then(
+      (response) => {
+        expect(response.status).to.eq(206)
+        expect(response.body).to.eq('1.1')
+        expect(response.headers['content-range']).to.eq('bytes 5-7/8')
+      }
+    )
+
+    // The value can be sent as a file to save instead
+    blob(readerKey, {download: 'true'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.headers['content-disposition']).to.match(/^attachment; filename="items-name-1\./)
+      }
+    )
+  })
+
+  // Return the value of a cell from a live database
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+  //       -F dbname="blobs live.sqlite" -F table="files" -F column="data" -F rowid="1" https://localhost:9444/v1/blob
+  it('live database', () => {
+    blob(readerKey, {dbname: liveDB, table: 'files', column: 'data'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.eq(png)
+        expect(response.headers['content-type']).to.eq('image/png')
+        expect(response.headers['content-disposition']).to.eq('inline; filename="files-data-1.png"')
+      }
+    )
+    blob(readerKey, {dbname: liveDB, table: 'files', column: 'data'}, {Range: 'bytes=1-3'}).then(
+      (response) => {
+        expect(response.status).to.eq(206)
+        expect(response.body).to.eq('PNG')
+      }
+    )
+
+    // Values which web browsers would run are sent as plain text
+    blob(readerKey, {dbname: liveDB, table: 'files', column: 'data', rowid: '2'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.headers['content-type']).to.eq('text/plain; charset=utf-8')
+        expect(response.headers['content-security-policy']).to.eq('sandbox')
+        expect(response.headers['x-content-type-options']).to.eq('nosniff')
+      }
+    )
+  })
+
+  // Users without access to a database can't retrieve its values
+  it('no access', () => {
+    for (const params of [{}, {dbname: liveDB, table: 'files', column: 'data'}]) {
+      blob(otherKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(JSON.parse(response.body).error).to.eq("Database does not exist, or user isn't authorised to access it")
+        }
+      )
+    }
+  })
+
+  // Invalid requests are refused
+  it('invalid', () => {
+    for (const [params, status, message] of [
+      [{table: ''}, 400, 'The table and column names are needed'],
+      [{column: ''}, 400, 'The table and column names are needed'],
+      [{rowid: ''}, 400, 'Invalid rowid value'],
+      [{rowid: 'first'}, 400, 'Invalid rowid value'],
+      [{download: 'maybe'}, 400, 'Invalid download value'],
+      [{table: 'missing'}, 404, "That table or column doesn't exist in the database"],
+      [{column: 'missing'}, 404, "That table or column doesn't exist in the database"],
+      [{rowid: '999'}, 404, "Row 999 doesn't exist in the table"],
+      [{column: 'added_in'}, 400, 'That cell holds a value of type integer, not a BLOB or text'],
+      [{dbname: liveDB, table: 'files', column: 'data', rowid: '3'}, 404, 'That cell is empty'],
+      [{dbname: liveDB, table: 'files', column: 'data', rowid: '999'}, 404, "Row 999 doesn't exist in the table"],
+      [{dbname: liveDB, table: 'keyed', column: 'v'}, 400, "Values can't be streamed from WITHOUT ROWID tables"]
+    ]) {
+      blob(readerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(status)
+          expect(JSON.parse(response.body).error).to.eq(message)
+        }
+      )
+    }
+  })
+})
@@ -0,0 +1,201 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const publicDB = 'Assembly Election 2017.sqlite'; // Has the releases 'first' and 'second' from the seed data
+const privateDB = 'citations.sqlite';
+
+// Calls one of the citation API calls
+function citationCall(call, key, dbName, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('citations and DOIs', () => {
+  before(() => {
+    // Seed data, then add a private database shared read only with the first user, and give it a release
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [{owner: 'default', name: privateDB}],
+          shares: [{dbowner: 'default', dbname: privateDB, user: 'first'}]
+        })
+      },
+    })
+    cy.request('/x/test/switchdefault')
+    citationCall('commits', ownerKey, privateDB).then((response) => {
+      cy.request({
+        method: 'POST',
+        url: '/x/createtag',
+        form: true,
+        body: {
+          username: 'default',
+          dbname: privateDB,
+          commit: Object.keys(response.body)[0],
+          tag: 'v1.0',
+          tagtype: 'release',
+          tagdesc: 'The first version'
+        },
+      })
+    })
+  })
+
+  after(() => {
+    // Make sure the default user is logged in for the other tests
+    cy.request('/x/test/switchdefault')
+  })
+
+  // The citation of a release of a public database, as DataCite metadata
+  //   Equivalent curl command:
+  //     curl -k -F apikey="NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g" -F dbowner="default" \
+  //       -F dbname="Assembly Election 2017.sqlite" -F release="first" https://localhost:9444/v1/citation
+  it('citation (datacite)', () => {
+    citationCall('citation', otherKey, publicDB, {release: 'first'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.data.type).to.eq('dois')
+        const a = response.body.data.attributes
+        expect(a).to.include({publisher: 'DBHub.io (Docker)', version: 'first', schemaVersion: 'http://datacite.org/schema/kernel-4'})
+        expect(a.descriptions).to.deep.eq([{description: 'First release', descriptionType: 'Abstract'}])
+        expect(a.formats).to.deep.eq(['application/vnd.sqlite3'])
+        expect(a.rightsList[0]).to.include({rights: 'CC-BY-SA-4.0', rightsIdentifier: 'CC-BY-SA-4.0', rightsIdentifierScheme: 'SPDX'})
+        expect(a.titles).to.deep.eq([{title: publicDB}])
+        expect(a.types).to.deep.eq({resourceType: 'SQLite database', resourceTypeGeneral: 'Dataset'})
+        expect(a).not.to.have.property('doi')
+      }
+    )
+  })
+
+  // The same citation, in the Citation File Format
+  it('citation (cff)', () => {
+    citationCall('citation', otherKey, publicDB, {release: 'first', format: 'cff'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.headers['content-type']).to.eq('application/x-yaml; charset=utf-8')
+        expect(response.body).to.match(/^cff-version: 1\.2\.0\n/)
+        expect(response.body).to.contain('type: dataset\n')
+        expect(response.body).to.contain('version: "first"\n')
+        expect(response.body).to.contain('license: "CC-BY-SA-4.0"\n')
+        expect(response.body).to.contain('abstract: "First release"\n')
+      }
+    )
+  })
+
+  // Users who can read a private database can cite its releases.  Other users don't get told it exists
+  it('citation (private database)', () => {
+    citationCall('citation', readerKey, privateDB, {release: 'v1.0'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.data.attributes).to.include({version: 'v1.0'})
+      }
+    )
+    citationCall('citation', otherKey, privateDB, {release: 'v1.0'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+      }
+    )
+  })
+
+  // Invalid requests are refused
+  it('citation (invalid)', () => {
+    citationCall('citation', readerKey, privateDB).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('The release name is missing')
+      }
+    )
+    citationCall('citation', readerKey, privateDB, {release: 'nosuchrelease'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("Unknown release: 'nosuchrelease'")
+      }
+    )
+    citationCall('citation', readerKey, privateDB, {release: 'v1.0', format: 'bibtex'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Unknown citation format')
+      }
+    )
+  })
+
+  // Only users with write access can mint DOIs.  This server doesn't have a DOI provider set up, so that's as far as
+  // the owner gets
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="citations.sqlite" -F release="v1.0" https://localhost:9444/v1/releasedoi
+  it('mint DOI', () => {
+    citationCall('releasedoi', readerKey, privateDB, {release: 'v1.0'}).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body.error).to.eq("You don't have write access to this database")
+      }
+    )
+    citationCall('releasedoi', roKey, privateDB, {release: 'v1.0'}).its('status').should('eq', 401)
+    citationCall('releasedoi', otherKey, privateDB, {release: 'v1.0'}).its('status').should('eq', 404)
+    citationCall('releasedoi', ownerKey, privateDB).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('The release name is missing')
+      }
+    )
+    citationCall('releasedoi', ownerKey, privateDB, {release: 'v1.0'}).then(
+      (response) => {
+        expect(response.status).to.eq(501)
+        expect(response.body.error).to.eq("DOIs can't be minted on this server")
+      }
+    )
+  })
+
+  // The web UI provides the citation as a file download
+  it('web UI citation', () => {
+    cy.request('/x/citation/default/' + encodeURIComponent(publicDB) + '?release=second').then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.headers['content-disposition']).to.eq('attachment; filename="CITATION.cff"')
+        expect(response.body).to.contain('version: "second"\n')
+      }
+    )
+    cy.request('/x/citation/default/' + encodeURIComponent(privateDB) + '?release=v1.0&format=datacite').then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.headers['content-disposition']).to.eq('attachment; filename="datacite.json"')
+        expect(response.body.data.attributes.version).to.eq('v1.0')
+      }
+    )
+    cy.request('/x/test/switchthird')
+    cy.request({
+      url: '/x/citation/default/' + encodeURIComponent(privateDB) + '?release=v1.0',
+      failOnStatusCode: false,
+    }).its('status').should('eq', 400)
+  })
+
+  // The web UI checks for write access before minting DOIs too
+  it('web UI mint DOI', () => {
+    for (const [user, status] of [['first', 403], ['default', 400]]) {
+      cy.request('/x/test/switch' + user)
+      cy.request({
+        method: 'POST',
+        url: '/x/releasedoi/',
+        form: true,
+        body: {
+          username: 'default',
+          dbname: privateDB,
+          tag: 'v1.0'
+        },
+        failOnStatusCode: false,
+      }).its('status').should('eq', status)
+    }
+  })
+})
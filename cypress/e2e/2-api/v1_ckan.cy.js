@@ -0,0 +1,112 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'ckan.sqlite';
+const ckanParams = {mode: 'publish', ckanurl: 'https://demo.ckan.org', dataset: 'ckan-testing', token: 'abc'};
+
+// Calls one of the CKAN API calls
+function ckanCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('CKAN integration', () => {
+  before(() => {
+    // Seed data, then add a private database shared read-write with the second user
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [{owner: 'default', name: dbName}],
+          shares: [{dbowner: 'default', dbname: dbName, user: 'second', write: true}]
+        })
+      },
+    })
+  })
+
+  // Databases aren't connected to a CKAN catalog to start with
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="ckan.sqlite" https://localhost:9444/v1/ckan
+  it('ckan', () => {
+    for (const key of [ownerKey, writerKey]) {
+      ckanCall('ckan', key).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(response.body.error).to.eq("That database isn't connected to a CKAN catalog")
+        }
+      )
+    }
+    ckanCall('ckan', otherKey).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+      }
+    )
+  })
+
+  // Only the owner of a database can connect it to a CKAN catalog
+  it('no write access', () => {
+    for (const call of ['ckanset', 'ckanremove']) {
+      ckanCall(call, writerKey, ckanParams).then(
+        (response) => {
+          expect(response.status).to.eq(403)
+          expect(response.body.error).to.eq('Only the owner of a database can change its CKAN integration')
+        }
+      )
+      ckanCall(call, otherKey, ckanParams).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+        }
+      )
+      ckanCall(call, roKey, ckanParams).its('status').should('eq', 401)
+    }
+    ckanCall('ckanharvest', roKey, {ckanurl: 'https://demo.ckan.org', dataset: 'ckan-testing'}).its('status').should('eq', 401)
+  })
+
+  // This server doesn't have any CKAN catalogs set up, so the owner can't connect to one either
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="ckan.sqlite" -F mode="publish" -F ckanurl="https://demo.ckan.org" -F dataset="ckan-testing" \
+  //       -F token="abc" https://localhost:9444/v1/ckanset
+  it('not enabled', () => {
+    ckanCall('ckanset', ownerKey, ckanParams).then(
+      (response) => {
+        expect(response.status).to.eq(501)
+        expect(response.body.error).to.eq("This server can't connect to CKAN catalogs")
+      }
+    )
+    ckanCall('ckanharvest', ownerKey, {ckanurl: 'https://demo.ckan.org', dataset: 'ckan-testing', dbname: 'ckan harvest.sqlite'}).then(
+      (response) => {
+        expect(response.status).to.eq(501)
+        expect(response.body.error).to.eq("This server can't connect to CKAN catalogs")
+      }
+    )
+    ckanCall('databases', ownerKey).its('body').should('not.include', 'ckan harvest.sqlite')
+  })
+
+  // Disconnecting a database which isn't connected doesn't work
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="ckan.sqlite" https://localhost:9444/v1/ckanremove
+  it('remove', () => {
+    ckanCall('ckanremove', ownerKey).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("That database isn't connected to a CKAN catalog")
+      }
+    )
+  })
+})
@@ -0,0 +1,208 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const otherKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first'
+const publicDB = 'collection public.sqlite'; // Owned by the second user
+const privateDB = 'collection private.sqlite';
+const seedDB = 'Assembly Election 2017.sqlite';
+const colName = 'Election data';
+
+// Calls one of the collection API calls
+function collectionCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('collections', () => {
+  before(() => {
+    // Seed data, then add a public database of the second user, and a private database
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'second', name: publicDB, public: true},
+            {owner: 'default', name: privateDB}
+          ]
+        })
+      },
+    })
+  })
+
+  // Create a collection
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F name="Election data" \
+  //       -F description="Results of elections" https://localhost:9444/v1/collectionsave
+  it('save', () => {
+    collectionCall('collectionsave', ownerKey, {name: colName, description: 'Results of elections'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+    collectionCall('collectionsave', ownerKey, {name: 'Private list', public: 'false'}).its('status').should('eq', 200)
+    collectionCall('collections', ownerKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.map(c => c.name)).to.have.members([colName, 'Private list'])
+        expect(response.body.find(c => c.name === colName)).to.include({
+          database_count: 0,
+          description: 'Results of elections',
+          owner: 'default',
+          public: true,
+          stars: 0
+        })
+      }
+    )
+  })
+
+  // Add public databases to the collection, in a chosen order
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F name="Election data" \
+  //       -F dbowner="second" -F dbname="collection public.sqlite" -F note="Test data" \
+  //       https://localhost:9444/v1/collectionadd
+  it('add', () => {
+    collectionCall('collectionadd', ownerKey, {name: colName, dbowner: 'second', dbname: publicDB, note: 'Test data'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+    collectionCall('collectionadd', ownerKey, {name: colName, dbowner: 'default', dbname: seedDB, position: '1'}).its('status').should('eq', 200)
+    collectionCall('collection', otherKey, {username: 'default', name: colName}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.include({name: colName, owner: 'default', database_count: 2})
+        expect(response.body.databases.map(d => d.database)).to.deep.eq([seedDB, publicDB])
+        expect(response.body.databases[1]).to.include({owner: 'second', note: 'Test data', position: 2})
+      }
+    )
+  })
+
+  // Private databases can't be added, even by their owner
+  it('add (invalid)', () => {
+    collectionCall('collectionadd', ownerKey, {name: colName, dbowner: 'default', dbname: privateDB}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or isn't public")
+      }
+    )
+    collectionCall('collectionadd', ownerKey, {name: 'No such collection', dbowner: 'default', dbname: seedDB}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Collection 'No such collection' not found")
+      }
+    )
+    collectionCall('collectionadd', ownerKey, {name: colName, dbowner: 'default', dbname: seedDB, position: '0'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid position')
+      }
+    )
+    collectionCall('collectionsave', ownerKey, {name: colName, public: 'maybe'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid value for public')
+      }
+    )
+  })
+
+  // Users can only change their own collections, and read only API keys can't change anything
+  it('other users', () => {
+    for (const [call, params] of [
+      ['collectionsave', {name: colName, description: 'Changed'}],
+      ['collectionadd', {name: colName, dbowner: 'default', dbname: seedDB}],
+      ['collectionremove', {name: colName, dbowner: 'second', dbname: publicDB}],
+      ['collectiondelete', {name: colName}],
+      ['collectionstar', {name: colName, starred: 'true'}]
+    ]) {
+      collectionCall(call, roKey, params).its('status').should('eq', 401)
+    }
+
+    // The other user's calls only refer to their own collections
+    collectionCall('collectionadd', otherKey, {name: colName, dbowner: 'default', dbname: seedDB}).its('status').should('eq', 404)
+    collectionCall('collectionremove', otherKey, {name: colName, dbowner: 'second', dbname: publicDB}).its('status').should('eq', 404)
+    collectionCall('collectiondelete', otherKey, {name: colName}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Collection '" + colName + "' not found")
+      }
+    )
+
+    // Private collections are only visible to their owner
+    collectionCall('collections', otherKey, {username: 'default'}).its('body').then((body) => {
+      expect(body.map(c => c.name)).to.deep.eq([colName])
+    })
+    collectionCall('collection', otherKey, {username: 'default', name: 'Private list'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Collection 'Private list' not found")
+      }
+    )
+    collectionCall('collectionstar', otherKey, {username: 'default', name: 'Private list', starred: 'true'}).its('status').should('eq', 404)
+
+    // Nothing was changed
+    collectionCall('collection', ownerKey, {name: colName}).then(
+      (response) => {
+        expect(response.body).to.include({description: 'Results of elections', database_count: 2})
+      }
+    )
+  })
+
+  // Star a collection, to follow it
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F username="default" \
+  //       -F name="Election data" -F starred="true" https://localhost:9444/v1/collectionstar
+  it('star', () => {
+    collectionCall('collectionstar', otherKey, {username: 'default', name: colName, starred: 'true'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK', starred: true})
+      }
+    )
+    collectionCall('collections', otherKey, {starred: 'true'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.have.lengthOf(1)
+        expect(response.body[0]).to.include({name: colName, owner: 'default', stars: 1})
+      }
+    )
+    collectionCall('collectionstar', otherKey, {username: 'default', name: colName, starred: 'maybe'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid value for starred')
+      }
+    )
+    collectionCall('collectionstar', otherKey, {username: 'default', name: colName, starred: 'false'}).its('body.starred').should('eq', false)
+    collectionCall('collections', otherKey, {starred: 'true'}).its('body').should('deep.eq', [])
+  })
+
+  // Remove a database, then delete the collection.  The databases themselves aren't affected
+  it('remove and delete', () => {
+    collectionCall('collectionremove', ownerKey, {name: colName, dbowner: 'second', dbname: publicDB}).its('status').should('eq', 200)
+    collectionCall('collectionremove', ownerKey, {name: colName, dbowner: 'second', dbname: publicDB}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("That database isn't in the collection")
+      }
+    )
+    collectionCall('collection', ownerKey, {name: colName}).its('body.databases').should('have.lengthOf', 1)
+    collectionCall('collectiondelete', ownerKey, {name: colName}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+    collectionCall('collection', ownerKey, {name: colName}).its('status').should('eq', 404)
+    collectionCall('tables', otherKey, {dbowner: 'second', dbname: publicDB}).its('status').should('eq', 200)
+  })
+})
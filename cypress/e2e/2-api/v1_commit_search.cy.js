@@ -0,0 +1,145 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'commit search.sqlite';
+const liveDB = 'commit search live.sqlite';
+
+// Searches the commits of the test database
+function commitSearch(key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/commitsearch',
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('commit search', () => {
+  before(() => {
+    // Seed data, then add a private database with a commit on each of the last five days, which is shared read only
+    // with the first user.  Also add a live database
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: dbName, commits: 5},
+            {owner: 'default', name: liveDB, live: true}
+          ],
+          shares: [{dbowner: 'default', dbname: dbName, user: 'first'}]
+        })
+      },
+    })
+  })
+
+  // Search the commit messages
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+  //       -F dbname="commit search.sqlite" -F message="commit 3" https://localhost:9444/v1/commitsearch
+  it('message', () => {
+    commitSearch(readerKey, {message: 'commit 3'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.total).to.eq(1)
+        expect(response.body.commits).to.have.lengthOf(1)
+        expect(response.body.commits[0].message).to.eq('Commit 3 of the test data')
+        expect(response.body.commits[0].id).to.match(/^[0-9a-f]{64}$/)
+      }
+    )
+  })
+
+  // The matching commits are returned a page at a time, newest first
+  it('paging', () => {
+    commitSearch(readerKey, {message: 'test data', limit: '2'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.total).to.eq(5)
+        expect(response.body.commits.map(c => c.message)).to.deep.eq(['Commit 5 of the test data', 'Commit 4 of the test data'])
+      }
+    )
+    commitSearch(readerKey, {offset: '4'}).then(
+      (response) => {
+        expect(response.body.total).to.eq(5)
+        expect(response.body.commits.map(c => c.message)).to.deep.eq(['Commit 1 of the test data'])
+      }
+    )
+  })
+
+  // Search by author and date
+  it('author and date', () => {
+    commitSearch(readerKey, {author: 'DEFAULT'}).its('body.total').should('eq', 5)
+    commitSearch(readerKey, {author: 'nobody'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({commits: [], total: 0})
+      }
+    )
+
+    // The commits were made one a day, ending today
+    const from = new Date(Date.now() - 2 * 24 * 60 * 60 * 1000).toISOString().substring(0, 10)
+    commitSearch(readerKey, {from: from}).its('body.total').should('eq', 3)
+    commitSearch(readerKey, {to: from}).its('body.total').should('eq', 3)
+    commitSearch(readerKey, {from: from, to: from}).then(
+      (response) => {
+        expect(response.body.total).to.eq(1)
+        expect(response.body.commits[0].message).to.eq('Commit 3 of the test data')
+      }
+    )
+  })
+
+  // Users without access to the database don't get told it exists
+  it('no access', () => {
+    commitSearch(otherKey).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+      }
+    )
+  })
+
+  // Live databases don't have commits, and invalid conditions are refused
+  it('invalid', () => {
+    commitSearch(ownerKey, {dbname: liveDB}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("That database is a live database.  It doesn't have commits.")
+      }
+    )
+    commitSearch(ownerKey, {from: '01/01/2026'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid from date.  It needs to be in YYYY-MM-DD format')
+      }
+    )
+    commitSearch(ownerKey, {to: 'today'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid to date.  It needs to be in YYYY-MM-DD format')
+      }
+    )
+    commitSearch(ownerKey, {limit: '101'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid limit.  It needs to be between 1 and 100')
+      }
+    )
+    commitSearch(ownerKey, {offset: '-1'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid offset')
+      }
+    )
+    commitSearch(ownerKey, {message: 'x'.repeat(256)}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("The author and message to search for can't be longer than 255 characters")
+      }
+    )
+  })
+})
@@ -0,0 +1,198 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'commit statuses.sqlite';
+const otherDB = 'commit statuses other.sqlite';
+
+// Calls one of the commit status API calls
+function statusCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('commit statuses', () => {
+  let commits = []
+  let otherCommit = ''
+
+  before(() => {
+    // Seed data, then add a private database with two commits, shared read only with the first user and read-write
+    // with the second user.  Also add another database, for its commit
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: dbName, commits: 2},
+            {owner: 'default', name: otherDB}
+          ],
+          shares: [
+            {dbowner: 'default', dbname: dbName, user: 'first'},
+            {dbowner: 'default', dbname: dbName, user: 'second', write: true}
+          ]
+        })
+      },
+    }).then((response) => {
+      commits = response.body.databases[0].commits
+      otherCommit = response.body.databases[1].commits[0]
+    })
+  })
+
+  // Post the status of a commit, as a CI system would
+  //   Equivalent curl command:
+  //     curl -k -F apikey="EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw" -F dbowner="default" \
+  //       -F dbname="commit statuses.sqlite" -F commit="COMMIT_ID" -F state="pending" -F context="ci/tests" \
+  //       -F targeturl="https://ci.example.com/builds/1" https://localhost:9444/v1/commitstatus
+  it('post', () => {
+    statusCall('commitstatus', writerKey, {
+      commit: commits[1],
+      state: 'pending',
+      context: 'ci/tests',
+      targeturl: 'https://ci.example.com/builds/1'
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(201)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+
+    // A later status for the same context replaces the earlier one
+    statusCall('commitstatus', ownerKey, {
+      commit: commits[1],
+      state: 'success',
+      context: 'ci/tests',
+      description: 'All tests passed'
+    }).its('status').should('eq', 201)
+    statusCall('commitstatus', ownerKey, {commit: commits[1], state: 'failure'}).its('status').should('eq', 201)
+
+    // Users who can read the database can see the statuses
+    //   Equivalent curl command:
+    //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+    //       -F dbname="commit statuses.sqlite" -F commit="COMMIT_ID" https://localhost:9444/v1/commitstatuses
+    statusCall('commitstatuses', readerKey, {commit: commits[1]}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.map(s => s.context)).to.deep.eq(['ci/tests', 'default'])
+        expect(response.body[0]).to.include({
+          commit: commits[1],
+          creator: 'default',
+          description: 'All tests passed',
+          state: 'success'
+        })
+        expect(response.body[1]).to.include({creator: 'default', state: 'failure'})
+      }
+    )
+    statusCall('commitstatuses', readerKey, {commit: commits[0]}).its('body').should('deep.eq', [])
+  })
+
+  // Posting statuses needs write access to the database
+  it('post (no write access)', () => {
+    const params = {commit: commits[0], state: 'success'}
+    statusCall('commitstatus', readerKey, params).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body.error).to.eq('You need write access to the database to post commit statuses')
+      }
+    )
+    statusCall('commitstatus', otherKey, params).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+      }
+    )
+    statusCall('commitstatus', roKey, params).its('status').should('eq', 401)
+    statusCall('commitstatuses', otherKey, params).its('status').should('eq', 404)
+
+    // Nothing was added
+    statusCall('commitstatuses', ownerKey, {commit: commits[0]}).its('body').should('deep.eq', [])
+  })
+
+  // Invalid statuses are refused
+  it('post (invalid)', () => {
+    for (const [params, status, message] of [
+      [{state: 'success'}, 400, 'A commit ID is needed'],
+      [{commit: otherCommit, state: 'success'}, 404, 'Commit not found in the database'],
+      [{commit: commits[0], state: 'done'}, 400, 'The state needs to be one of: pending, success, failure'],
+      [{commit: commits[0], state: 'success', context: '/tests'}, 400, 'Invalid context'],
+      [{commit: commits[0], state: 'success', targeturl: 'ftp://ci.example.com/builds/1'}, 400, 'Invalid target URL'],
+      [{commit: commits[0], state: 'success', description: 'x'.repeat(256)}, 400, 'Invalid description']
+    ]) {
+      statusCall('commitstatus', writerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(status)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+    statusCall('commitstatuses', readerKey).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('A commit ID is needed')
+      }
+    )
+  })
+
+  // Choose the status checks merge requests need to pass
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="commit statuses.sqlite" -F contexts="ci/tests, ci/lint" https://localhost:9444/v1/requiredchecksset
+  it('required checks', () => {
+    statusCall('requiredchecks', readerKey).its('body').should('deep.eq', [])
+    statusCall('requiredchecksset', ownerKey, {contexts: 'ci/tests, ci/lint'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+    statusCall('requiredchecks', readerKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq(['ci/lint', 'ci/tests'])
+      }
+    )
+  })
+
+  // Only the owner of a database can change its required checks
+  it('required checks (invalid)', () => {
+    statusCall('requiredchecksset', writerKey, {contexts: ''}).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body.error).to.eq('Only the owner of a database can change its required status checks')
+      }
+    )
+    statusCall('requiredchecksset', otherKey, {contexts: ''}).its('status').should('eq', 404)
+    statusCall('requiredchecksset', roKey, {contexts: ''}).its('status').should('eq', 401)
+    statusCall('requiredchecks', otherKey).its('status').should('eq', 404)
+    statusCall('requiredchecksset', ownerKey, {contexts: 'ci/tests, /lint'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("Invalid context: '/lint'")
+      }
+    )
+    const many = Array.from({length: 21}, (_, i) => 'check' + i).join(',')
+    statusCall('requiredchecksset', ownerKey, {contexts: many}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('At most 20 status checks can be required')
+      }
+    )
+
+    // Nothing was changed
+    statusCall('requiredchecks', readerKey).its('body').should('deep.eq', ['ci/lint', 'ci/tests'])
+
+    // Leaving out the contexts lets merge requests be merged regardless of their status checks
+    statusCall('requiredchecksset', ownerKey).its('status').should('eq', 200)
+    statusCall('requiredchecks', readerKey).its('body').should('deep.eq', [])
+  })
+})
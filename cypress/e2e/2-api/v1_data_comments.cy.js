@@ -0,0 +1,249 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const commentKey = 'cFVAmiEtA4Bj3UuGJ5VlerupeFMNlV0y1tBJhe6ZNqAHfD9MUCecOA'; // Key of user 'commentuser', shared read only
+const dbName = 'data comments.sqlite';
+const sourceDB = 'data comments source.sqlite';
+
+// Calls one of the data comment API calls
+function commentCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('data comments', () => {
+  let mrID = ''
+  let headCommit = ''
+  let threadID = ''
+
+  before(() => {
+    // Seed data, then add a private database with ten rows which is shared read only with the first user and the
+    // comment user, and read-write with the second user.  Also add a database with twenty rows
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          users: [{name: 'commentuser'}],
+          databases: [
+            {owner: 'default', name: dbName},
+            {owner: 'default', name: sourceDB, commits: 2}
+          ],
+          shares: [
+            {dbowner: 'default', dbname: dbName, user: 'first'},
+            {dbowner: 'default', dbname: dbName, user: 'second', write: true},
+            {dbowner: 'default', dbname: dbName, user: 'commentuser'}
+          ],
+          api_keys: [{user: 'commentuser', key: commentKey}]
+        })
+      },
+    }).then((response) => {
+      // Add a "dev" branch holding the twenty rows
+      const mainCommit = response.body.databases[0].commits[0]
+      cy.request({
+        method: 'POST',
+        url: 'https://localhost:9444/v1/download',
+        form: true,
+        encoding: 'binary',
+        body: {apikey: ownerKey, dbowner: 'default', dbname: sourceDB},
+      }).then((download) => {
+        // Manually construct a form data object, as cy.request() doesn't yet have proper support for form data
+        const z = new FormData()
+        z.set('apikey', ownerKey)
+        z.set('dbname', dbName)
+        z.set('branch', 'dev')
+        z.set('commit', mainCommit)
+        z.set('file', Cypress.Blob.binaryStringToBlob(download.body))
+        cy.request({
+          method: 'POST',
+          url: 'https://localhost:9444/v1/upload',
+          body: z,
+        }).then((response) => {
+          // The response body arrives as an ArrayBuffer, as the request was sent as form data
+          headCommit = JSON.parse(Cypress.Blob.arrayBufferToBinaryString(response.body)).commit
+        })
+      })
+    })
+
+    // The second user asks for the "dev" branch to be merged into "main"
+    cy.request('/x/test/switchsecond')
+    cy.request({
+      method: 'POST',
+      url: '/x/createmerge/',
+      form: true,
+      body: {
+        sourceowner: 'default',
+        sourcedbname: dbName,
+        sourcebranch: 'dev',
+        destowner: 'default',
+        destdbname: dbName,
+        destbranch: 'main',
+        title: 'Data comments test',
+        desc: 'Test'
+      },
+    }).then((response) => {
+      mrID = String(response.body.mr_id)
+    })
+  })
+
+  after(() => {
+    // Make sure the default user is logged in for the other tests
+    cy.request('/x/test/switchdefault')
+  })
+
+  // Comment on a cell of a row added by the merge request
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+  //       -F dbname="data comments.sqlite" -F discid="1" -F table="items" -F key='{"id": 15}' -F column="name" \
+  //       -F body="Is this right?" https://localhost:9444/v1/datacomment
+  it('comment', () => {
+    commentCall('datacomment', readerKey, {discid: mrID, table: 'items', key: '{"id": 15}', column: 'name', body: 'Is this right?'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.com_id).to.be.a('number')
+        threadID = String(response.body.com_id)
+      }
+    )
+
+    // Users who can read the database can see the comments
+    //   Equivalent curl command:
+    //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+    //       -F dbname="data comments.sqlite" -F discid="1" https://localhost:9444/v1/datacomments
+    commentCall('datacomments', commentKey, {discid: mrID}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.have.lengthOf(1)
+        expect(response.body[0].comment).to.include({body: 'Is this right?', commenter: 'first'})
+        expect(response.body[0].comment.anchor).to.deep.eq({column: 'name', commit: headCommit, key: {id: '15'}, table: 'items'})
+        expect(response.body[0].replies).to.deep.eq([])
+      }
+    )
+  })
+
+  // Reply to a comment thread
+  //   Equivalent curl command:
+  //     curl -k -F apikey="cFVAmiEtA4Bj3UuGJ5VlerupeFMNlV0y1tBJhe6ZNqAHfD9MUCecOA" -F dbowner="default" \
+  //       -F dbname="data comments.sqlite" -F discid="1" -F comid="COMMENT_ID" -F body="Yes, it was renamed" \
+  //       https://localhost:9444/v1/datacommentreply
+  it('reply', () => {
+    commentCall('datacommentreply', commentKey, {discid: mrID, comid: threadID, body: 'Yes, it was renamed'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.com_id).to.be.a('number')
+      }
+    )
+    commentCall('datacomments', readerKey, {discid: mrID}).then(
+      (response) => {
+        expect(response.body).to.have.lengthOf(1)
+        expect(response.body[0].replies).to.have.lengthOf(1)
+        expect(response.body[0].replies[0]).to.include({body: 'Yes, it was renamed', commenter: 'commentuser'})
+      }
+    )
+  })
+
+  // Resolve the thread, and mark it as unresolved again
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+  //       -F dbname="data comments.sqlite" -F discid="1" -F comid="COMMENT_ID" \
+  //       https://localhost:9444/v1/datacommentresolve
+  it('resolve', () => {
+    // Whoever started the thread can resolve it
+    commentCall('datacommentresolve', readerKey, {discid: mrID, comid: threadID}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+    commentCall('datacomments', readerKey, {discid: mrID}).its('body.0.comment').should('include', {resolved: true, resolved_by: 'first'})
+
+    // So can the creator of the merge request
+    commentCall('datacommentresolve', writerKey, {discid: mrID, comid: threadID, unresolve: 'true'}).its('status').should('eq', 200)
+    commentCall('datacomments', readerKey, {discid: mrID}).its('body.0.comment').should('not.have.property', 'resolved')
+
+    // And users with write access to the database
+    commentCall('datacommentresolve', ownerKey, {discid: mrID, comid: threadID}).its('status').should('eq', 200)
+    commentCall('datacomments', readerKey, {discid: mrID}).its('body.0.comment').should('include', {resolved: true, resolved_by: 'default'})
+  })
+
+  // Other users can read and comment, but not resolve threads.  Users without access to the database can't do either
+  it('no access', () => {
+    commentCall('datacommentresolve', commentKey, {discid: mrID, comid: threadID, unresolve: 'true'}).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body.error).to.eq("You can't resolve this comment thread")
+      }
+    )
+    for (const [call, params] of [
+      ['datacomment', {discid: mrID, table: 'items', key: '{"id": 16}', body: 'Test'}],
+      ['datacommentreply', {discid: mrID, comid: threadID, body: 'Test'}],
+      ['datacommentresolve', {discid: mrID, comid: threadID, unresolve: 'true'}],
+      ['datacomments', {discid: mrID}]
+    ]) {
+      commentCall(call, otherKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+        }
+      )
+      if (call !== 'datacomments') {
+        commentCall(call, roKey, params).its('status').should('eq', 401)
+      }
+    }
+
+    // Nothing was changed
+    commentCall('datacomments', readerKey, {discid: mrID}).then(
+      (response) => {
+        expect(response.body).to.have.lengthOf(1)
+        expect(response.body[0].comment.resolved).to.eq(true)
+        expect(response.body[0].replies).to.have.lengthOf(1)
+      }
+    )
+  })
+
+  // Invalid comments are refused
+  it('invalid', () => {
+    const anchorError = 'The table needs to be changed by the merge request, the key needs to give the primary key of ' +
+      'a changed row, and the column needs to exist in the table'
+    for (const [params, status, message] of [
+      [{discid: 'abc', table: 'items', key: '{"id": 15}', body: 'Test'}, 400, 'Invalid merge request ID'],
+      [{discid: mrID, table: 'items', key: '{"id": 15}'}, 400, 'Invalid comment body'],
+      [{discid: mrID, key: '{"id": 15}', body: 'Test'}, 400, 'Invalid table name'],
+      [{discid: mrID, table: 'items', key: '15', body: 'Test'}, 400, 'The key needs to be a JSON object of primary key columns and their values'],
+      [{discid: mrID, table: 'items', key: '{"id": 5}', body: 'Test'}, 400, anchorError],
+      [{discid: mrID, table: 'items', key: '{"id": 15}', column: 'colour', body: 'Test'}, 400, anchorError],
+      [{discid: '99', table: 'items', key: '{"id": 15}', body: 'Test'}, 404, 'Merge request not found']
+    ]) {
+      commentCall('datacomment', readerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(status)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+    for (const [call, params, status, message] of [
+      ['datacommentreply', {discid: mrID, comid: 'abc', body: 'Test'}, 400, 'Invalid comment ID'],
+      ['datacommentreply', {discid: mrID, comid: '9999', body: 'Test'}, 404, 'Comment thread not found'],
+      ['datacommentresolve', {discid: mrID, comid: threadID, unresolve: 'maybe'}, 400, 'Invalid unresolve value'],
+      ['datacomments', {discid: '0'}, 400, 'Invalid merge request ID']
+    ]) {
+      commentCall(call, readerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(status)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+    commentCall('datacomments', readerKey, {discid: mrID}).its('body').should('have.lengthOf', 1)
+  })
+})
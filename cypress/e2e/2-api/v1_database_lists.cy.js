@@ -0,0 +1,105 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const userKey = 'm3qMNQZalQTPy-CshtZiuyKYXB8X_5tyxxRIBxJKNmsw6cwzTQiRig'; // Key created for user 'listuser'
+const seedKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const smallDB = 'list small.sqlite';
+const largeDB = 'list large.sqlite';
+
+// Lists the databases of the user the key belongs to
+function databases(key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/databases',
+    form: true,
+    body: Object.assign({apikey: key}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('database lists', () => {
+  before(() => {
+    // Seed data, then add a user with a small and a large database.  The small database uses the CC0 licence, and is
+    // pinned to the user's profile
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          users: [{name: 'listuser'}],
+          databases: [
+            {owner: 'listuser', name: smallDB, rows: 5},
+            {owner: 'listuser', name: largeDB, rows: 2000}
+          ],
+          api_keys: [{user: 'listuser', key: userKey}]
+        })
+      },
+    })
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/licenceset',
+      form: true,
+      body: {apikey: userKey, dbowner: 'listuser', dbname: smallDB, licence: 'CC0'},
+    })
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/profilepin',
+      form: true,
+      body: {apikey: userKey, dbname: smallDB, pinned: 'true'},
+    })
+  })
+
+  // Sort the list
+  //   Equivalent curl command:
+  //     curl -k -F apikey="m3qMNQZalQTPy-CshtZiuyKYXB8X_5tyxxRIBxJKNmsw6cwzTQiRig" -F sort="size" \
+  //       https://localhost:9444/v1/databases
+  it('sort', () => {
+    databases(userKey, {sort: 'size'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq([largeDB, smallDB])
+      }
+    )
+    databases(userKey, {sort: 'created'}).its('body').should('deep.eq', [largeDB, smallDB])
+    databases(userKey, {sort: 'pinned'}).its('body').should('deep.eq', [smallDB, largeDB])
+  })
+
+  // Narrow down the list by licence, or to the databases with releases
+  //   Equivalent curl command:
+  //     curl -k -F apikey="m3qMNQZalQTPy-CshtZiuyKYXB8X_5tyxxRIBxJKNmsw6cwzTQiRig" -F licence="CC0" \
+  //       https://localhost:9444/v1/databases
+  it('filter', () => {
+    databases(userKey, {licence: 'CC0'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq([smallDB])
+      }
+    )
+    databases(userKey, {licence: 'ODbL-1.0'}).its('body').should('be.null')
+    databases(seedKey, {releases: 'true'}).its('body').should('deep.eq', ['Assembly Election 2017.sqlite'])
+    databases(seedKey, {releases: 'true', licence: 'CC-BY-SA-4.0', sort: 'stars'}).its('body').should('deep.eq', ['Assembly Election 2017.sqlite'])
+  })
+
+  // Unknown sort orders and invalid filters are refused
+  it('invalid', () => {
+    databases(userKey, {sort: 'name'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Unknown sort order requested')
+      }
+    )
+    databases(userKey, {licence: 'CC0/1.0'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid licence name')
+      }
+    )
+    databases(userKey, {releases: 'maybe'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid value for releases')
+      }
+    )
+  })
+})
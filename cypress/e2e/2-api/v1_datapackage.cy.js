@@ -0,0 +1,194 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'datapackage.sqlite';
+const liveDB = 'datapackage live.sqlite';
+const importDB = 'datapackage import.sqlite';
+
+// Calls one of the data package API calls
+function dataPackageCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Imports a data package.  The zip file is uploaded as a file, so the form data is put together manually
+function dataPackageImport(key, fields, zip) {
+  const z = new FormData()
+  z.set('apikey', key)
+  for (const [name, value] of Object.entries(fields)) {
+    z.set(name, value)
+  }
+  z.set('file', Cypress.Blob.binaryStringToBlob(zip, 'application/zip'), 'datapackage.zip')
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/datapackageimport',
+    body: z,
+    failOnStatusCode: false,
+  }).then((response) => {
+    // The response body arrives as an ArrayBuffer, as the request was sent as form data
+    response.body = JSON.parse(Cypress.Blob.arrayBufferToBinaryString(response.body))
+    return response
+  })
+}
+
+describe('data packages', () => {
+  let zipData = ''
+
+  before(() => {
+    // Seed data, then add a private database with two commits which is shared read only with the first user, and a
+    // live database
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: dbName, commits: 2},
+            {owner: 'default', name: liveDB, live: true}
+          ],
+          shares: [{dbowner: 'default', dbname: dbName, user: 'first'}]
+        })
+      },
+    })
+  })
+
+  after(() => {
+    // Make sure the default user is logged in for the other tests
+    cy.request('/x/test/switchdefault')
+  })
+
+  // The data package descriptor describes each table and its columns
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+  //       -F dbname="datapackage.sqlite" https://localhost:9444/v1/datapackage
+  it('descriptor', () => {
+    dataPackageCall('datapackage', readerKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.include({name: 'datapackage', title: dbName})
+        expect(response.body.version).to.match(/^[0-9a-f]{64}$/)
+        expect(response.body).not.to.have.property('licenses')
+        expect(response.body.resources).to.have.lengthOf(1)
+        const res = response.body.resources[0]
+        expect(res).to.include({name: 'items', path: 'data/items.csv', format: 'csv', profile: 'tabular-data-resource', title: 'items'})
+        expect(res.schema.primaryKey).to.deep.eq(['id'])
+        expect(res.schema.fields).to.deep.eq([
+          {name: 'id', type: 'integer'},
+          {name: 'name', type: 'string', constraints: {required: true}},
+          {name: 'value', type: 'number'},
+          {name: 'added_in', type: 'integer', constraints: {required: true}}
+        ])
+      }
+    )
+  })
+
+  // Users without access to the database don't get told it exists, and live databases don't have data packages
+  it('descriptor (invalid)', () => {
+    dataPackageCall('datapackage', otherKey).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+      }
+    )
+    dataPackageCall('datapackage', ownerKey, {dbname: liveDB}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('That database is a live database.  Data packages are only available for standard databases.')
+      }
+    )
+  })
+
+  // The web UI provides the descriptor along with the data of each table, as a zip file
+  it('web UI download', () => {
+    cy.request('/x/test/switchfirst')
+    cy.request({url: '/x/downloaddatapackage/default/' + encodeURIComponent(dbName), encoding: 'binary'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.headers['content-type']).to.eq('application/zip')
+        expect(response.headers['content-disposition']).to.eq('attachment; filename="datapackage-datapackage.zip"')
+        expect(response.body.slice(0, 4)).to.eq('PK\x03\x04')
+        zipData = response.body
+      }
+    )
+    cy.request('/x/test/switchthird')
+    cy.request({url: '/x/downloaddatapackage/default/' + encodeURIComponent(dbName), failOnStatusCode: false}).its('status').should('eq', 404)
+  })
+
+  // A downloaded data package can be imported as a new database
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F file=@datapackage.zip \
+  //       -F dbname="datapackage import.sqlite" -F licence="CC0" https://localhost:9444/v1/datapackageimport
+  it('import', () => {
+    dataPackageImport(ownerKey, {dbname: importDB, licence: 'CC0', public: 'true'}, zipData).then(
+      (response) => {
+        expect(response.status).to.eq(201)
+        expect(response.body.commit).to.match(/^[0-9a-f]{64}$/)
+        expect(response.body.url).to.contain('/default/' + importDB + '?branch=main&commit=' + response.body.commit)
+      }
+    )
+
+    // All of the rows arrived, and anyone can see the new database as it's public
+    dataPackageCall('query', otherKey, {dbname: importDB, sql: btoa('SELECT count(*), max(name) FROM items')}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body[0][0].Value).to.eq('20')
+        expect(response.body[0][1].Value).to.eq('Item 2.9')
+      }
+    )
+    dataPackageCall('datapackage', otherKey, {dbname: importDB}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.licenses[0]).to.include({name: 'CC0'})
+        expect(response.body.resources[0].schema.primaryKey).to.deep.eq(['id'])
+      }
+    )
+  })
+
+  // Read only API keys can't import, and invalid imports are refused
+  it('import (invalid)', () => {
+    dataPackageImport(roKey, {dbname: 'datapackage other.sqlite'}, zipData).its('status').should('eq', 401)
+    dataPackageImport(ownerKey, {dbname: importDB}, zipData).then(
+      (response) => {
+        expect(response.status).to.eq(409)
+        expect(response.body.error).to.eq('A database with that name already exists.  Please choose a different name.')
+      }
+    )
+    dataPackageImport(ownerKey, {dbname: 'datapackage other.sqlite'}, 'This is not a zip file').then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('The data package needs to be a zip file')
+      }
+    )
+    dataPackageImport(ownerKey, {dbname: 'datapackage other.sqlite', licence: 'nosuchlicence'}, zipData).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("Unknown licence: 'nosuchlicence'")
+      }
+    )
+    dataPackageImport(ownerKey, {dbname: 'datapackage other.sqlite', public: 'maybe'}, zipData).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid public value')
+      }
+    )
+    dataPackageImport(ownerKey, {dbname: 'bad/name.sqlite'}, zipData).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid database name')
+      }
+    )
+
+    // None of them were created
+    dataPackageCall('databases', ownerKey).its('body').should('not.include', 'datapackage other.sqlite')
+  })
+})
@@ -0,0 +1,204 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'assignees.sqlite';
+
+// Events are turned into status updates by a background loop, which runs every couple of seconds
+const eventWaitTime = 5000;
+
+// Calls one of the discussion API calls on the test database
+function discCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Returns the titles of the status updates a user has for the test database
+function statusUpdateTitles(key) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/statusupdates',
+    form: true,
+    body: {
+      apikey: key
+    },
+  }).then((response) => response.body.updates.filter(u => u.database === 'default/' + dbName).map(u => u.title))
+}
+
+describe('discussion assignees and mentions', () => {
+  before(() => {
+    // Seed data, then add a private database with a discussion.  The first user can read the database, and the
+    // second user can change it
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [{owner: 'default', name: dbName}],
+          shares: [
+            {dbowner: 'default', dbname: dbName, user: 'first'},
+            {dbowner: 'default', dbname: dbName, user: 'second', write: true}
+          ],
+          discussions: [{dbowner: 'default', dbname: dbName, creator: 'first', title: 'Assignment test', body: 'Test'}]
+        })
+      },
+    })
+  })
+
+  after(() => {
+    // Make sure the default user is logged in for the other tests
+    cy.request('/x/test/switchdefault')
+  })
+
+  // Assign the discussion to a user, using their established capitalisation
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="assignees.sqlite" -F discid="1" -F assignee="second" https://localhost:9444/v1/discussionassign
+  it('assign', () => {
+    discCall('discussionassign', ownerKey, {discid: '1', assignee: 'SECOND'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({assignee: 'second'})
+      }
+    )
+    discCall('discussions', readerKey, {assigned: 'second'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.map(d => d.title)).to.deep.eq(['Assignment test'])
+        expect(response.body[0]).to.have.property('assignee', 'second')
+      }
+    )
+
+    // The assignee is told about it
+    cy.wait(eventWaitTime)
+    statusUpdateTitles(writerKey).should('deep.eq', ['Assignment test'])
+  })
+
+  // Users with write access through a share can assign discussions too
+  it('assign (read-write access)', () => {
+    discCall('discussionassign', writerKey, {discid: '1', assignee: 'first'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({assignee: 'first'})
+      }
+    )
+    discCall('discussions', readerKey, {assigned: 'me'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.map(d => d.title)).to.deep.eq(['Assignment test'])
+      }
+    )
+  })
+
+  // Users who can only read the database can't assign discussions
+  it('assign (read only access)', () => {
+    discCall('discussionassign', readerKey, {discid: '1', assignee: 'first'}).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body.error).to.eq("You don't have write access to this database")
+      }
+    )
+    discCall('discussionassign', roKey, {discid: '1', assignee: 'first'}).its('status').should('eq', 401)
+    discCall('discussionassign', otherKey, {discid: '1', assignee: 'third'}).its('status').should('eq', 404)
+  })
+
+  // Discussions can only be assigned to users who exist and can see the database
+  it('assign (invalid)', () => {
+    discCall('discussionassign', ownerKey, {discid: '1', assignee: 'third'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("User 'third' doesn't have access to this database")
+      }
+    )
+    discCall('discussionassign', ownerKey, {discid: '1', assignee: 'nosuchuser'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Unknown user 'nosuchuser'")
+      }
+    )
+    discCall('discussionassign', ownerKey, {discid: 'abc', assignee: 'first'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid discussion ID')
+      }
+    )
+    discCall('discussionassign', ownerKey, {discid: '999', assignee: 'first'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq('Unknown discussion')
+      }
+    )
+  })
+
+  // Remove the assignment
+  it('unassign', () => {
+    discCall('discussionassign', ownerKey, {discid: '1', assignee: ''}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({assignee: ''})
+      }
+    )
+    discCall('discussions', readerKey, {assigned: 'me'}).its('body').should('deep.eq', [])
+  })
+
+  // Invalid filters are refused, and users without access don't get told the database exists
+  it('list (invalid)', () => {
+    discCall('discussions', readerKey, {type: 'issue'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Unknown discussion type')
+      }
+    )
+    discCall('discussions', readerKey, {open: 'maybe'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid value for open')
+      }
+    )
+    discCall('discussions', otherKey).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+      }
+    )
+  })
+
+  // Mentioned users are told about the discussion, but only when they can see the database
+  it('mentions', () => {
+    cy.request({
+      method: 'POST',
+      url: '/x/creatediscuss',
+      form: true,
+      body: {
+        username: 'default',
+        dbname: dbName,
+        title: 'Mention test',
+        disctxt: 'What do @first and @third think?'
+      },
+    })
+    cy.wait(eventWaitTime)
+    statusUpdateTitles(readerKey).should('include', 'Mention test')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/statusupdates',
+      form: true,
+      body: {
+        apikey: otherKey
+      },
+    }).then(
+      (response) => {
+        expect(response.body.updates.map(u => u.title)).not.to.include('Mention test')
+      }
+    )
+  })
+})
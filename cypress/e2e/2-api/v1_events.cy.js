@@ -0,0 +1,160 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const watcherKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const publicDB = 'events public.sqlite';
+const privateDB = 'events private.sqlite';
+
+// Polls for the events of the default user, without waiting for new ones
+function pollEvents(params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/events',
+    form: true,
+    body: Object.assign({apikey: watcherKey, timeout: '0'}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Starts a discussion on one of the databases of the first user, as the first user
+function startDiscussion(db, title) {
+  cy.request('/x/test/switchfirst')
+  cy.request({
+    method: 'POST',
+    url: '/x/creatediscuss',
+    form: true,
+    body: {
+      username: 'first',
+      dbname: db,
+      title: title,
+      disctxt: 'Discussion started by the Cypress tests'
+    },
+  })
+  cy.request('/x/test/switchdefault')
+}
+
+describe('events', () => {
+  let lastID = 0
+
+  before(() => {
+    // Seed data, then add a public and a private database for the first user.  The default user watches both of them,
+    // but only has access to the public one
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'first', name: publicDB, public: true},
+            {owner: 'first', name: privateDB}
+          ]
+        })
+      },
+    })
+    cy.request('/x/test/switchdefault')
+    cy.request('/x/watch/first/' + encodeURIComponent(publicDB))
+    cy.request('/x/watch/first/' + encodeURIComponent(privateDB))
+    pollEvents().then((response) => {
+      lastID = response.body.last_event_id
+    })
+  })
+
+  after(() => {
+    // Make sure the default user is logged in for the other tests
+    cy.request('/x/test/switchdefault')
+  })
+
+  // Events for the watched databases are returned, along with the status updates of the user
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F since="1234" \
+  //       https://localhost:9444/v1/events
+  it('poll', () => {
+    startDiscussion(publicDB, 'Public events test')
+    pollEvents({since: lastID}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.have.property('status_updates')
+        expect(response.body.events).to.have.lengthOf(1)
+        expect(response.body.events[0].details).to.include({
+          database_owner: 'first',
+          database_name: publicDB,
+          title: 'Public events test',
+          username: 'first'
+        })
+        expect(response.body.last_event_id).to.eq(response.body.events[0].id)
+        lastID = response.body.last_event_id
+      }
+    )
+
+    // Events already received aren't returned again
+    pollEvents({since: lastID}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.events).to.have.lengthOf(0)
+        expect(response.body.last_event_id).to.eq(lastID)
+      }
+    )
+  })
+
+  // Watching a database doesn't give access to the events of a private database
+  it('poll (no access)', () => {
+    startDiscussion(privateDB, 'Private events test')
+    pollEvents({since: lastID}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.events).to.have.lengthOf(0)
+      }
+    )
+  })
+
+  // Users don't get events for their own actions
+  it('poll (own events)', () => {
+    cy.request({
+      method: 'POST',
+      url: '/x/creatediscuss',
+      form: true,
+      body: {
+        username: 'first',
+        dbname: publicDB,
+        title: 'Own events test',
+        disctxt: 'Discussion started by the Cypress tests'
+      },
+    })
+    pollEvents({since: lastID}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.events).to.have.lengthOf(0)
+      }
+    )
+  })
+
+  // Invalid event IDs, modes and timeouts are refused
+  it('invalid', () => {
+    for (const since of ['-1', 'abc']) {
+      pollEvents({since: since}).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq('Invalid event ID')
+        }
+      )
+    }
+    pollEvents({mode: 'push'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Unknown mode requested')
+      }
+    )
+    pollEvents({timeout: '9'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid timeout.  It needs to be between 0 and 8 seconds')
+      }
+    )
+  })
+
+  // The events API needs a valid API key
+  it('no key', () => {
+    pollEvents({apikey: 'notAValidKey'}).its('status').should('eq', 401)
+  })
+})
@@ -0,0 +1,124 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'explain.sqlite';
+const liveDB = 'explain live.sqlite';
+
+// Calls an API call for the test database
+function apiCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('explain', () => {
+  before(() => {
+    // Seed data, then add a private standard database and a private live database, both shared read only with the
+    // first user
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: dbName},
+            {owner: 'default', name: liveDB, live: true}
+          ],
+          shares: [
+            {dbowner: 'default', dbname: dbName, user: 'first'},
+            {dbowner: 'default', dbname: liveDB, user: 'first'}
+          ]
+        })
+      },
+    })
+  })
+
+  // Return the query plan of a statement on a standard database
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+  //       -F dbname="explain.sqlite" -F sql="U0VMRUNUICogRlJPTSBpdGVtcyBXSEVSRSBpZCA9IDE=" \
+  //       https://localhost:9444/v1/explain
+  //     Note, the base64 encoded SQL query above is:
+  //       'SELECT * FROM items WHERE id = 1'
+  it('standard database', () => {
+    apiCall('explain', readerKey, {sql: btoa('SELECT * FROM items WHERE id = 1')}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.plan).to.have.lengthOf(1)
+        expect(response.body.plan[0].detail).to.match(/^SEARCH (TABLE )?items USING INTEGER PRIMARY KEY/)
+        expect(response.body).not.to.have.property('bytecode')
+      }
+    )
+
+    // The bytecode listing is returned when asked for
+    apiCall('explain', roKey, {sql: btoa('SELECT name FROM items WHERE value > 0.5'), bytecode: 'true'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.plan[0].detail).to.match(/^SCAN (TABLE )?items/)
+        expect(response.body.bytecode[0]).to.include({addr: 0, opcode: 'Init'})
+      }
+    )
+  })
+
+  // Return the query plan of a statement on a live database.  Statements which change data aren't run
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+  //       -F dbname="explain live.sqlite" -F sql="REVMRVRFIEZST00gaXRlbXM=" https://localhost:9444/v1/explain
+  //     Note, the base64 encoded SQL query above is:
+  //       'DELETE FROM items'
+  it('live database', () => {
+    apiCall('explain', readerKey, {dbname: liveDB, sql: btoa('DELETE FROM items'), bytecode: 'true'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.plan).to.be.an('array')
+        expect(response.body.bytecode.length).to.be.greaterThan(0)
+      }
+    )
+    apiCall('query', readerKey, {dbname: liveDB, sql: btoa('SELECT count(*) FROM items')}).its('body.0.0.Value').should('eq', '10')
+  })
+
+  // Users without access to the database can't see the query plans of statements on it
+  it('no access', () => {
+    for (const db of [dbName, liveDB]) {
+      apiCall('explain', otherKey, {dbname: db, sql: btoa('SELECT * FROM items')}).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(response.body.error).to.eq("Database 'default/" + db + "' doesn't exist")
+        }
+      )
+    }
+  })
+
+  // Invalid statements are refused
+  it('invalid', () => {
+    for (const db of [dbName, liveDB]) {
+      for (const [params, message] of [
+        [{sql: btoa('SELECT 1'), bytecode: 'maybe'}, 'Invalid bytecode value'],
+        [{sql: ''}, 'No SQL statement was given'],
+        [{sql: btoa('SELECT 1; SELECT 2')}, 'Only one SQL statement can be explained at a time']
+      ]) {
+        apiCall('explain', ownerKey, Object.assign({dbname: db}, params)).then(
+          (response) => {
+            expect(response.status).to.eq(400)
+            expect(response.body.error).to.eq(message)
+          }
+        )
+      }
+      apiCall('explain', ownerKey, {dbname: db, sql: btoa('SELECT * FROM missing')}).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.contain('no such table: missing')
+        }
+      )
+    }
+  })
+})
@@ -0,0 +1,254 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const fixtureKey = 'cGKWZpjog30br1WlAvpVOE4U6Q5IoPT5TdgbnXOpVOcQelT_4jnyzw'; // Key created for user 'fixtureuser'
+const defaultKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const firstKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first' added by the seed data
+
+describe('test fixtures', () => {
+  before(() => {
+    // Seed data.  This adds the admin user, who can use the fixtures call
+    cy.request('/x/test/seed')
+  })
+
+  // Create the test data
+  //   Equivalent curl command:
+  //     curl -k -F apikey="lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ" \
+  //       -F fixtures='{"users": [{"name": "fixtureuser"}], ...}' https://localhost:9444/v1/testfixtures
+  it('create', () => {
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          users: [{name: 'fixtureuser', display_name: 'Fixture test user'}],
+          databases: [
+            {owner: 'fixtureuser', name: 'fixture.sqlite', commits: 3, rows: 5, public: true},
+            {owner: 'fixtureuser', name: 'fixture live.sqlite', live: true, rows: 4}
+          ],
+          shares: [{dbowner: 'fixtureuser', dbname: 'fixture live.sqlite', user: 'default'}],
+          discussions: [{
+            dbowner: 'fixtureuser',
+            dbname: 'fixture.sqlite',
+            creator: 'fixtureuser',
+            title: 'Fixture discussion',
+            body: 'Discussion created by the test fixtures',
+            comments: [{commenter: 'default', body: 'First comment'}, {commenter: 'fixtureuser', body: 'Second comment'}]
+          }],
+          api_keys: [{user: 'fixtureuser', key: fixtureKey}]
+        })
+      },
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        let jsonBody = response.body
+        expect(jsonBody.databases).to.have.lengthOf(2)
+        expect(jsonBody.databases[0]).to.have.property('name', 'fixture.sqlite')
+        expect(jsonBody.databases[0].commits).to.have.lengthOf(3)
+        expect(jsonBody.databases[1]).to.have.property('live', true)
+        expect(jsonBody.discussions).to.have.lengthOf(1)
+        expect(jsonBody.api_keys[0]).to.have.property('key', fixtureKey)
+      }
+    )
+  })
+
+  // The standard database has the requested commit history
+  it('standard database commits', () => {
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/commits',
+      form: true,
+      body: {
+        apikey: fixtureKey,
+        dbowner: 'fixtureuser',
+        dbname: 'fixture.sqlite'
+      },
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        let commits = Object.values(response.body)
+        expect(commits).to.have.lengthOf(3)
+        expect(commits.map(c => c.message)).to.include('Commit 3 of the test data')
+      }
+    )
+  })
+
+  // Each commit of the standard database adds the requested number of rows
+  it('standard database rows', () => {
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/query',
+      form: true,
+      body: {
+        apikey: fixtureKey,
+        dbowner: 'fixtureuser',
+        dbname: 'fixture.sqlite',
+        sql: btoa('SELECT count(*) FROM items')
+      },
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body[0][0]).to.have.property('Value', '15')
+      }
+    )
+  })
+
+  // The live database is set up on a live node
+  it('live database', () => {
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/query',
+      form: true,
+      body: {
+        apikey: fixtureKey,
+        dbowner: 'fixtureuser',
+        dbname: 'fixture live.sqlite',
+        sql: btoa('SELECT count(*) FROM items')
+      },
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body[0][0]).to.have.property('Value', '4')
+      }
+    )
+  })
+
+  // The private live database is shared with the given user, but nobody else
+  it('shares', () => {
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/query',
+      form: true,
+      body: {
+        apikey: defaultKey,
+        dbowner: 'fixtureuser',
+        dbname: 'fixture live.sqlite',
+        sql: btoa('SELECT count(*) FROM items')
+      },
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body[0][0]).to.have.property('Value', '4')
+      }
+    )
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/query',
+      form: true,
+      body: {
+        apikey: firstKey,
+        dbowner: 'fixtureuser',
+        dbname: 'fixture live.sqlite',
+        sql: btoa('SELECT count(*) FROM items')
+      },
+      failOnStatusCode: false,
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+      }
+    )
+  })
+
+  // The discussion has its comments
+  it('discussion', () => {
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/discussions',
+      form: true,
+      body: {
+        apikey: fixtureKey,
+        dbowner: 'fixtureuser',
+        dbname: 'fixture.sqlite'
+      },
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.have.lengthOf(1)
+        expect(response.body[0]).to.have.property('title', 'Fixture discussion')
+        expect(response.body[0]).to.have.property('creator', 'fixtureuser')
+        expect(response.body[0]).to.have.property('comment_count', 2)
+      }
+    )
+  })
+
+  // Only the instance admins can create test data
+  it('create (not an admin)', () => {
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: fixtureKey,
+        fixtures: JSON.stringify({users: [{name: 'notallowed'}]})
+      },
+      failOnStatusCode: false,
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+      }
+    )
+  })
+
+  // Invalid fixtures are refused
+  it('create (invalid fixtures)', () => {
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: '{"users": ['
+      },
+      failOnStatusCode: false,
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.match(/^Invalid fixtures/)
+      }
+    )
+  })
+
+  // Resetting empties the database first.  The API key used for the call is removed too, so a new one is created for
+  // the admin user
+  it('reset', () => {
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          reset: true,
+          users: [{name: 'testadmin', admin: true}],
+          api_keys: [{user: 'testadmin', key: adminKey}]
+        })
+      },
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+      }
+    )
+
+    // The data created earlier is gone
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/commits',
+      form: true,
+      body: {
+        apikey: fixtureKey,
+        dbowner: 'fixtureuser',
+        dbname: 'fixture.sqlite'
+      },
+      failOnStatusCode: false,
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(401)
+      }
+    )
+  })
+
+  after(() => {
+    // Put the standard test data back for the other tests
+    cy.request('/x/test/seed')
+  })
+})
@@ -0,0 +1,135 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'health reports.sqlite';
+const liveDB = 'health reports live.sqlite';
+
+// Calls an API call for the test database
+function apiCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Asks for a health report until it has been worked out.  The reports are worked out by a background loop which runs
+// once a minute, so this can take a while
+function waitForReport(params, tries = 40) {
+  return apiCall('healthreport', readerKey, params).then((response) => {
+    if (response.status !== 202 || tries <= 1) {
+      return response
+    }
+    cy.wait(5000)
+    return waitForReport(params, tries - 1)
+  })
+}
+
+describe('health reports', () => {
+  let commits = []
+
+  before(() => {
+    // Seed data, then add a private standard database with two commits which is shared read only with the first user.
+    // Also add a live database
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: dbName, commits: 2},
+            {owner: 'default', name: liveDB, live: true}
+          ],
+          shares: [
+            {dbowner: 'default', dbname: dbName, user: 'first'},
+            {dbowner: 'default', dbname: liveDB, user: 'first'}
+          ]
+        })
+      },
+    }).then((response) => {
+      commits = response.body.databases[0].commits
+    })
+  })
+
+  // Ask for the health report of a commit, then retrieve it once it has been worked out
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+  //       -F dbname="health reports.sqlite" https://localhost:9444/v1/healthreport
+  it('health report', () => {
+    // Only the head commit of the default branch is given a report without asking, so the first commit is pending
+    // until the report is asked for
+    apiCall('healthreport', readerKey, {commit: commits[0]}).then(
+      (response) => {
+        expect(response.status).to.eq(202)
+        expect(response.body).to.deep.eq({commit: commits[0], state: 'pending'})
+      }
+    )
+
+    // Wait for the report of the first commit to be worked out
+    waitForReport({commit: commits[0]}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.include({commit: commits[0], state: 'done'})
+        expect(response.body.details).to.include({
+          freelist_pages: 0,
+          integrity_ok: true,
+          unused_bytes: 0,
+          vacuum_suggested: false
+        })
+        expect(response.body.details.integrity_errors).to.deep.eq([])
+        expect(response.body.details.no_primary_key).to.deep.eq([])
+        expect(response.body.details.wide_tables).to.deep.eq([])
+        expect(response.body.details.page_count).to.be.greaterThan(0)
+      }
+    )
+
+    // Without a commit ID, the report of the head commit of the default branch is returned
+    waitForReport({}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.include({commit: commits[1], state: 'done'})
+      }
+    )
+
+    // Read only API keys can retrieve reports too
+    apiCall('healthreport', roKey, {commit: commits[0]}).its('status').should('eq', 200)
+  })
+
+  // Users without access to the database can't see its health reports
+  it('no access', () => {
+    for (const params of [{}, {commit: commits[0]}]) {
+      apiCall('healthreport', otherKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(response.body.error).to.eq("Database 'default/" + dbName + "' doesn't exist")
+        }
+      )
+    }
+  })
+
+  // Invalid requests are refused
+  it('invalid', () => {
+    apiCall('healthreport', ownerKey, {dbname: liveDB}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Health reports are only available for standard databases')
+      }
+    )
+    apiCall('healthreport', ownerKey, {commit: 'not a commit'}).its('status').should('eq', 400)
+
+    const missing = 'a'.repeat(64)
+    apiCall('healthreport', ownerKey, {commit: missing}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Commit '" + missing + "' doesn't exist in database 'default/" + dbName + "'")
+      }
+    )
+  })
+})
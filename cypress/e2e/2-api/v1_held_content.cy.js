@@ -0,0 +1,216 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const firstKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first'
+const thirdKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third'
+const dbName = 'held content.sqlite';
+
+// Text with more links than the spam filters allow in a post
+const links = Array.from({length: 11}, (_, i) => 'https://example.org/' + i).join(' ')
+
+// Calls an API call for the test database
+function apiCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Returns the content held for moderation, oldest first
+function heldContent() {
+  return apiCall('heldcontent', adminKey).its('body')
+}
+
+// Returns the discussion page of the test database, for checking which comments have been published
+function discussionPage(discID) {
+  return cy.request('/discuss/default/' + encodeURIComponent(dbName) + '?id=' + discID).its('body')
+}
+
+describe('held content', () => {
+  let discID = 0
+  let held = []
+
+  before(() => {
+    // Seed data, then add a public database with a discussion
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [{owner: 'default', name: dbName, public: true}],
+          discussions: [{dbowner: 'default', dbname: dbName, creator: 'default', title: 'Questions', body: 'Ask here'}]
+        })
+      },
+    }).then((response) => {
+      discID = response.body.discussions[0].id
+
+      // Post comments and a discussion with too many links from the web UI, which the spam filters hold for moderation
+      for (const [user, text] of [['first', 'Publish me'], ['first', 'Reject me'], ['third', 'Ban me']]) {
+        cy.request('/x/test/switch' + user)
+        cy.request({
+          method: 'POST',
+          url: '/x/createcomment/',
+          form: true,
+          body: {username: 'default', dbname: dbName, discid: String(discID), comtext: text + ' ' + links},
+        }).then((response) => {
+          expect(response.status).to.eq(202)
+          expect(response.body).to.eq("Your comment has been held for moderation, and will be published once it's been reviewed")
+        })
+      }
+      cy.request('/x/test/switchfirst')
+      cy.request({
+        method: 'POST',
+        url: '/x/creatediscuss/',
+        form: true,
+        body: {username: 'default', dbname: dbName, title: 'Held discussion', disctxt: encodeURIComponent(links)},
+      }).its('status').should('eq', 202)
+      cy.request('/x/test/switchdefault')
+    })
+  })
+
+  after(() => {
+    // Make sure the default user is logged in for the other tests
+    cy.request('/x/test/switchdefault')
+  })
+
+  // The admins can see the held content, oldest first
+  //   Equivalent curl command:
+  //     curl -k -F apikey="lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ" https://localhost:9444/v1/heldcontent
+  it('held content', () => {
+    apiCall('heldcontent', adminKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.have.lengthOf(4)
+        for (const [i, [user, text]] of [['first', 'Publish me'], ['first', 'Reject me'], ['third', 'Ban me']].entries()) {
+          expect(response.body[i]).to.include({
+            kind: 'comment',
+            user: user,
+            owner: 'default',
+            database: dbName,
+            disc_id: discID,
+            body: text + ' ' + links,
+            reason: 'More than 10 links'
+          })
+        }
+        expect(response.body[3]).to.include({kind: 'discussion', user: 'first', title: 'Held discussion', body: links})
+        held = response.body.map((h) => String(h.held_id))
+      }
+    )
+
+    // None of it has been published
+    discussionPage(discID).should('not.contain', 'Publish me')
+    apiCall('discussions', ownerKey).its('body').then((list) => {
+      expect(list.map((d) => d.title)).to.deep.eq(['Questions'])
+    })
+  })
+
+  // Publish held content which isn't spam
+  //   Equivalent curl command:
+  //     curl -k -F apikey="lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ" -F held="1" -F action="publish" \
+  //       https://localhost:9444/v1/heldcontentaction
+  it('publish', () => {
+    cy.then(() => {
+      for (const id of [held[0], held[3]]) {
+        apiCall('heldcontentaction', adminKey, {held: id, action: 'publish'}).then(
+          (response) => {
+            expect(response.status).to.eq(200)
+            expect(response.body).to.deep.eq({status: 'OK'})
+          }
+        )
+      }
+    })
+    discussionPage(discID).should('contain', 'Publish me')
+    apiCall('discussions', ownerKey).its('body').then((list) => {
+      expect(list.map((d) => d.title)).to.have.members(['Questions', 'Held discussion'])
+    })
+    heldContent().then((list) => {
+      expect(list.map((h) => String(h.held_id))).to.deep.eq([held[1], held[2]])
+    })
+  })
+
+  // Reject held spam, and ban the author of another one
+  it('reject and ban', () => {
+    cy.then(() => {
+      apiCall('heldcontentaction', adminKey, {held: held[1], action: 'reject'}).its('status').should('eq', 200)
+      apiCall('heldcontentaction', adminKey, {held: held[2], action: 'ban'}).its('status').should('eq', 200)
+    })
+    heldContent().should('deep.eq', [])
+    discussionPage(discID).should('not.contain', 'Reject me').and('not.contain', 'Ban me')
+
+    // Banned users can't use the API
+    apiCall('tables', thirdKey).its('status').should('eq', 401)
+    apiCall('tables', firstKey).its('status').should('eq', 200)
+
+    // Handled content can't be acted on again
+    cy.then(() => {
+      apiCall('heldcontentaction', adminKey, {held: held[1], action: 'publish'}).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(response.body.error).to.eq('Held content not found')
+        }
+      )
+    })
+  })
+
+  // Only the instance admins can see and act on held content
+  it('not an admin', () => {
+    cy.request('/x/test/switchfirst')
+    cy.request({
+      method: 'POST',
+      url: '/x/createcomment/',
+      form: true,
+      body: {username: 'default', dbname: dbName, discid: String(discID), comtext: 'Held again ' + links},
+    }).its('status').should('eq', 202)
+    cy.request('/x/test/switchdefault')
+    heldContent().then((list) => {
+      expect(list).to.have.lengthOf(1)
+      const id = String(list[0].held_id)
+      for (const key of [ownerKey, firstKey]) {
+        for (const [call, params] of [
+          ['heldcontent', {}],
+          ['heldcontentaction', {held: id, action: 'publish'}]
+        ]) {
+          apiCall(call, key, params).then(
+            (response) => {
+              expect(response.status).to.eq(403)
+              expect(response.body.error).to.eq('Only administrators can use this call')
+            }
+          )
+        }
+      }
+      apiCall('heldcontentaction', roKey, {held: id, action: 'publish'}).its('status').should('eq', 401)
+    })
+
+    // Nothing was changed
+    heldContent().its('length').should('eq', 1)
+    discussionPage(discID).should('not.contain', 'Held again')
+  })
+
+  // Invalid requests are refused
+  it('invalid', () => {
+    for (const [params, status, message] of [
+      [{held: '', action: 'publish'}, 400, 'Invalid held content ID'],
+      [{held: '0', action: 'publish'}, 400, 'Invalid held content ID'],
+      [{held: 'first', action: 'publish'}, 400, 'Invalid held content ID'],
+      [{held: '1', action: ''}, 400, "Unknown action.  Must be one of 'publish', 'reject', or 'ban'"],
+      [{held: '1', action: 'dismiss'}, 400, "Unknown action.  Must be one of 'publish', 'reject', or 'ban'"],
+      [{held: '999999999', action: 'reject'}, 404, 'Held content not found']
+    ]) {
+      apiCall('heldcontentaction', adminKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(status)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+
+    // Nothing was changed
+    heldContent().its('length').should('eq', 1)
+  })
+})
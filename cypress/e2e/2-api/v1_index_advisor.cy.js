@@ -0,0 +1,161 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'index advisor.sqlite';
+const liveDB = 'index advisor live.sqlite';
+
+// The queries run on the test databases before asking for suggestions
+const queries = [
+  "SELECT * FROM items WHERE name = 'Item 1.3'",
+  "SELECT * FROM items WHERE name = 'Item 1.4'",
+  'SELECT id FROM items WHERE added_in = 1 AND value > 0.5'
+];
+
+// Calls an API call for the test database
+function apiCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Returns the number of indexes in a database
+function indexCount(db) {
+  return apiCall('query', readerKey, {dbname: db, sql: btoa("SELECT count(*) FROM sqlite_master WHERE type = 'index'")})
+    .its('body.0.0.Value')
+}
+
+describe('index advisor', () => {
+  before(() => {
+    // Seed data, then add a standard database and a live database, both shared read only with the first user and
+    // read-write with the second user
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: dbName},
+            {owner: 'default', name: liveDB, live: true}
+          ],
+          shares: [
+            {dbowner: 'default', dbname: dbName, user: 'first'},
+            {dbowner: 'default', dbname: dbName, user: 'second', write: true},
+            {dbowner: 'default', dbname: liveDB, user: 'first'},
+            {dbowner: 'default', dbname: liveDB, user: 'second', write: true}
+          ]
+        })
+      },
+    })
+
+    // Run the queries the suggestions are based on
+    for (const db of [dbName, liveDB]) {
+      for (const q of queries) {
+        apiCall('query', readerKey, {dbname: db, sql: btoa(q)}).its('status').should('eq', 200)
+      }
+    }
+  })
+
+  // Suggest indexes for a standard database
+  //   Equivalent curl command:
+  //     curl -k -F apikey="EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw" -F dbowner="default" \
+  //       -F dbname="index advisor.sqlite" https://localhost:9444/v1/indexadvisor
+  it('standard database', () => {
+    apiCall('indexadvisor', writerKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.queries).to.be.at.least(3)
+        expect(response.body.suggestions).to.deep.eq([
+          {
+            applied: false,
+            columns: ['name'],
+            name: 'idx_items_name',
+            queries: 2,
+            sql: 'CREATE INDEX "idx_items_name" ON "items" ("name")',
+            table: 'items'
+          },
+          {
+            applied: false,
+            columns: ['added_in', 'value'],
+            name: 'idx_items_added_in_value',
+            queries: 1,
+            sql: 'CREATE INDEX "idx_items_added_in_value" ON "items" ("added_in", "value")',
+            table: 'items'
+          }
+        ])
+      }
+    )
+
+    // Read only API keys can still see the suggestions
+    apiCall('indexadvisor', roKey).its('body.suggestions').should('have.lengthOf', 2)
+  })
+
+  // Suggest indexes for a live database, creating them
+  //   Equivalent curl command:
+  //     curl -k -F apikey="EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw" -F dbowner="default" \
+  //       -F dbname="index advisor live.sqlite" -F apply="true" https://localhost:9444/v1/indexadvisor
+  it('live database', () => {
+    apiCall('indexadvisor', writerKey, {dbname: liveDB, apply: 'true'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.suggestions.map((s) => [s.name, s.queries, s.applied])).to.deep.eq([
+          ['idx_items_name', 2, true],
+          ['idx_items_added_in_value', 1, true]
+        ])
+      }
+    )
+    indexCount(liveDB).should('eq', '2')
+
+    // With the indexes in place, there's nothing more to suggest
+    apiCall('indexadvisor', ownerKey, {dbname: liveDB}).its('body.suggestions').should('deep.eq', [])
+  })
+
+  // The suggestions are only for users who can change the database, and only keys with write access can create them
+  it('no write access', () => {
+    for (const db of [dbName, liveDB]) {
+      for (const key of [readerKey, otherKey]) {
+        apiCall('indexadvisor', key, {dbname: db}).then(
+          (response) => {
+            expect(response.status).to.eq(404)
+            expect(response.body.error).to.eq("Database 'default/" + db + "' doesn't exist")
+          }
+        )
+      }
+    }
+    apiCall('indexadvisor', roKey, {dbname: liveDB, apply: 'true'}).then(
+      (response) => {
+        expect(response.status).to.eq(401)
+        expect(response.body.error).to.eq('Applying the suggested indexes requires an API key with Write access.  ' +
+          "The API key provided doesn't have it.")
+      }
+    )
+  })
+
+  // Invalid requests are refused
+  it('invalid', () => {
+    for (const [params, message] of [
+      [{apply: 'maybe'}, 'Invalid apply value'],
+      [{apply: 'true'}, 'Suggested indexes can only be applied to live databases.  For standard databases, add ' +
+        'them in a new commit instead.']
+    ]) {
+      apiCall('indexadvisor', ownerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+
+    // Nothing was changed
+    indexCount(dbName).should('eq', '0')
+  })
+})
@@ -0,0 +1,214 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const userKey = 'sGPqO4HUrFJd9JTPtyp8HLNA8yB9ld-e4d4p_UrkRNQ0BdglNfevXQ'; // Key created for user 'inviteuser'
+
+describe('invitations', () => {
+  let inviteID
+  let emailInviteID
+
+  before(() => {
+    // Seed data, then add a user who isn't an admin
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          users: [{name: 'inviteuser'}],
+          api_keys: [{user: 'inviteuser', key: userKey}]
+        })
+      },
+    })
+  })
+
+  // Create an invitation
+  //   Equivalent curl command:
+  //     curl -k -F apikey="lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ" \
+  //       https://localhost:9444/v1/invitationcreate
+  it('create', () => {
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/invitationcreate',
+      form: true,
+      body: {
+        apikey: adminKey
+      },
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        let jsonBody = response.body
+        expect(jsonBody).to.have.property('email', '')
+        expect(jsonBody).to.have.property('invited_by', 'testadmin')
+        expect(jsonBody.token).to.have.length.above(20)
+        expect(jsonBody).to.include.keys(['date_created', 'expiry_date', 'invite_id'])
+
+        // Invitations can be used for two weeks by default
+        let days = (new Date(jsonBody.expiry_date) - new Date(jsonBody.date_created)) / 86400000
+        expect(days).to.be.closeTo(14, 0.01)
+        inviteID = jsonBody.invite_id
+      }
+    )
+  })
+
+  // Create an invitation for someone, with a shorter expiry
+  //   Equivalent curl command:
+  //     curl -k -F apikey="lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ" \
+  //       -F email="invited@example.org" -F expires="3" https://localhost:9444/v1/invitationcreate
+  it('create (email and expiry)', () => {
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/invitationcreate',
+      form: true,
+      body: {
+        apikey: adminKey,
+        email: 'invited@example.org',
+        expires: '3'
+      },
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        let jsonBody = response.body
+        expect(jsonBody).to.have.property('email', 'invited@example.org')
+        let days = (new Date(jsonBody.expiry_date) - new Date(jsonBody.date_created)) / 86400000
+        expect(days).to.be.closeTo(3, 0.01)
+        emailInviteID = jsonBody.invite_id
+      }
+    )
+  })
+
+  // Invalid details are refused
+  it('create (invalid details)', () => {
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/invitationcreate',
+      form: true,
+      body: {
+        apikey: adminKey,
+        email: 'not an email address'
+      },
+      failOnStatusCode: false,
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid email address')
+      }
+    )
+    for (const expires of ['0', '366', 'abc']) {
+      cy.request({
+        method: 'POST',
+        url: 'https://localhost:9444/v1/invitationcreate',
+        form: true,
+        body: {
+          apikey: adminKey,
+          expires: expires
+        },
+        failOnStatusCode: false,
+      }).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq('Invalid expiry.  It needs to be between 1 and 365 days')
+        }
+      )
+    }
+  })
+
+  // List the invitations, newest first.  The invitation codes aren't included
+  //   Equivalent curl command:
+  //     curl -k -F apikey="lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ" \
+  //       https://localhost:9444/v1/invitations
+  it('list', () => {
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/invitations',
+      form: true,
+      body: {
+        apikey: adminKey
+      },
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        let jsonBody = response.body
+        expect(jsonBody).to.have.lengthOf(2)
+        expect(jsonBody[0]).to.have.property('invite_id', emailInviteID)
+        expect(jsonBody[0]).to.have.property('email', 'invited@example.org')
+        expect(jsonBody[0]).to.have.property('date_used', null)
+        expect(jsonBody[0]).to.not.have.property('token')
+        expect(jsonBody[1]).to.have.property('invite_id', inviteID)
+      }
+    )
+  })
+
+  // Revoke an invitation
+  //   Equivalent curl command:
+  //     curl -k -F apikey="lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ" \
+  //       -F invite="1" https://localhost:9444/v1/invitationrevoke
+  it('revoke', () => {
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/invitationrevoke',
+      form: true,
+      body: {
+        apikey: adminKey,
+        invite: inviteID
+      },
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.have.property('status', 'OK')
+      }
+    )
+
+    // It's gone from the list
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/invitations',
+      form: true,
+      body: {
+        apikey: adminKey
+      },
+    }).then(
+      (response) => {
+        expect(response.body).to.have.lengthOf(1)
+        expect(response.body[0]).to.have.property('invite_id', emailInviteID)
+      }
+    )
+
+    // So it can't be revoked again
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/invitationrevoke',
+      form: true,
+      body: {
+        apikey: adminKey,
+        invite: inviteID
+      },
+      failOnStatusCode: false,
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+      }
+    )
+  })
+
+  // Only the instance admins can use the invitation calls
+  it('not an admin', () => {
+    for (const call of ['invitationcreate', 'invitationrevoke', 'invitations']) {
+      cy.request({
+        method: 'POST',
+        url: 'https://localhost:9444/v1/' + call,
+        form: true,
+        body: {
+          apikey: userKey,
+          invite: emailInviteID
+        },
+        failOnStatusCode: false,
+      }).then(
+        (response) => {
+          expect(response.status).to.eq(403)
+          expect(response.body.error).to.eq('Only administrators can use this call')
+        }
+      )
+    }
+  })
+})
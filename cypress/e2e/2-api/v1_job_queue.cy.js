@@ -0,0 +1,63 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const dbName = 'job queue.sqlite';
+
+// Calls an API call for the test database
+function apiCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('job queue', () => {
+  before(() => {
+    // Seed data, then add a live database
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [{owner: 'default', name: dbName, live: true}]
+        })
+      },
+    })
+  })
+
+  // Return the statistics of the live job queue
+  //   Equivalent curl command:
+  //     curl -k -F apikey="lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ" https://localhost:9444/v1/jobqueue
+  it('job queue', () => {
+    // Queries are interactive jobs, so they show up in that priority class for the node holding the database
+    apiCall('query', ownerKey, {sql: btoa('SELECT count(*) FROM items')}).its('status').should('eq', 200)
+    apiCall('liveplacements', adminKey).its('body.0.node').then((nodeName) => {
+      apiCall('jobqueue', adminKey).then(
+        (response) => {
+          expect(response.status).to.eq(200)
+          for (const s of response.body) {
+            expect(s).to.include.keys(['avg_wait', 'in_progress', 'max_wait', 'node_name', 'oldest_waiting', 'waiting'])
+            expect(s.priority).to.be.oneOf(['interactive', 'background'])
+          }
+          const interactive = response.body.find((s) => s.node_name === nodeName && s.priority === 'interactive')
+          expect(interactive.started_last_hour).to.be.greaterThan(0)
+        }
+      )
+    })
+  })
+
+  // Only the instance admins can see the job queue statistics
+  it('not an admin', () => {
+    apiCall('jobqueue', ownerKey).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body.error).to.eq('Only administrators can use this call')
+      }
+    )
+  })
+})
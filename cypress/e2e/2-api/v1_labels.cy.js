@@ -0,0 +1,269 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'labels.sqlite';
+
+// Calls one of the label or milestone API calls on the test database
+function labelCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('labels and milestones', () => {
+  before(() => {
+    // Seed data, then add a private database with a discussion.  The first user can read the database, and the
+    // second user can change it
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [{owner: 'default', name: dbName}],
+          shares: [
+            {dbowner: 'default', dbname: dbName, user: 'first'},
+            {dbowner: 'default', dbname: dbName, user: 'second', write: true}
+          ],
+          discussions: [{dbowner: 'default', dbname: dbName, creator: 'first', title: 'Labels test', body: 'Test'}]
+        })
+      },
+    })
+  })
+
+  after(() => {
+    // Make sure the default user is logged in for the other tests
+    cy.request('/x/test/switchdefault')
+  })
+
+  // Add a label to the database, alongside the default ones
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="labels.sqlite" -F name="needs review" -F colour="#fbca04" https://localhost:9444/v1/labelsave
+  it('save label', () => {
+    labelCall('labelsave', ownerKey, {name: 'needs review', colour: '#fbca04', description: 'Waiting for a review'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+    labelCall('labels', readerKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.map(l => l.name)).to.include.members(['bug', 'enhancement', 'needs review'])
+        expect(response.body.find(l => l.name === 'needs review')).to.deep.eq({
+          colour: '#fbca04',
+          default: false,
+          description: 'Waiting for a review',
+          name: 'needs review'
+        })
+      }
+    )
+
+    // Users with write access through a share can add labels too
+    labelCall('labelsave', writerKey, {name: 'wontfix', colour: '#ffffff'}).its('status').should('eq', 200)
+  })
+
+  // Only users with write access can change the labels and milestones
+  it('no write access', () => {
+    for (const [call, params] of [
+      ['labelsave', {name: 'reader label', colour: '#000000'}],
+      ['labeldelete', {name: 'needs review'}],
+      ['milestonesave', {title: 'Reader milestone'}],
+      ['milestonedelete', {title: 'Version 2'}],
+      ['discussionlabels', {discid: '1', labels: 'bug'}],
+      ['discussionmilestone', {discid: '1', milestone: ''}]
+    ]) {
+      labelCall(call, readerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(403)
+          expect(response.body.error).to.eq("You don't have write access to this database")
+        }
+      )
+      labelCall(call, roKey, params).its('status').should('eq', 401)
+      labelCall(call, otherKey, params).its('status').should('eq', 404)
+    }
+    labelCall('labels', otherKey).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+      }
+    )
+  })
+
+  // Invalid label details are refused
+  it('save label (invalid)', () => {
+    labelCall('labelsave', ownerKey, {name: 'no colour'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid label name or colour')
+      }
+    )
+    labelCall('labelsave', ownerKey, {name: 'bad colour', colour: 'red'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid label name or colour')
+      }
+    )
+  })
+
+  // Add a milestone to the database
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="labels.sqlite" -F title="Version 2" -F due="2026-12-31" https://localhost:9444/v1/milestonesave
+  it('save milestone', () => {
+    labelCall('milestonesave', ownerKey, {title: 'Version 2', due: '2026-12-31'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+    labelCall('milestones', readerKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.have.lengthOf(1)
+        expect(response.body[0]).to.include({title: 'Version 2', open: true, open_count: 0, closed_count: 0})
+        expect(response.body[0].due_date).to.match(/^2026-12-31/)
+      }
+    )
+  })
+
+  // Invalid milestone details are refused
+  it('save milestone (invalid)', () => {
+    labelCall('milestonesave', ownerKey, {title: ''}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid milestone title')
+      }
+    )
+    labelCall('milestonesave', ownerKey, {title: 'Version 3', due: '31/12/2026'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid due date.  It needs to be in YYYY-MM-DD format')
+      }
+    )
+    labelCall('milestonesave', ownerKey, {title: 'Version 3', open: 'maybe'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid value for open')
+      }
+    )
+  })
+
+  // Apply labels and a milestone to the discussion, using their established capitalisation
+  it('apply', () => {
+    labelCall('discussionlabels', writerKey, {discid: '1', labels: 'BUG, needs review'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({labels: ['bug', 'needs review']})
+      }
+    )
+    labelCall('discussionmilestone', writerKey, {discid: '1', milestone: 'version 2'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({milestone: 'Version 2'})
+      }
+    )
+    labelCall('discussions', readerKey, {label: 'needs review', milestone: 'Version 2'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.map(d => d.title)).to.deep.eq(['Labels test'])
+        expect(response.body[0].labels).to.have.members(['bug', 'needs review'])
+      }
+    )
+    labelCall('milestones', readerKey).its('body.0.open_count').should('eq', 1)
+  })
+
+  // Only the labels and milestones of the database can be applied, to its own discussions
+  it('apply (invalid)', () => {
+    labelCall('discussionlabels', ownerKey, {discid: '1', labels: 'bug,unknown label'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("Unknown label 'unknown label'")
+      }
+    )
+    labelCall('discussionmilestone', ownerKey, {discid: '1', milestone: 'Version 9'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq('Unknown milestone')
+      }
+    )
+    labelCall('discussionlabels', ownerKey, {discid: '999', labels: 'bug'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq('Unknown discussion')
+      }
+    )
+    labelCall('discussionmilestone', ownerKey, {discid: 'abc', milestone: ''}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid discussion ID')
+      }
+    )
+  })
+
+  // The web UI checks for write access too
+  it('web UI', () => {
+    cy.request('/x/test/switchfirst')
+    cy.request({
+      method: 'POST',
+      url: '/x/labelsave/',
+      form: true,
+      body: {
+        username: 'default',
+        dbname: dbName,
+        name: 'reader label',
+        colour: '#000000'
+      },
+      failOnStatusCode: false,
+    }).its('status').should('eq', 403)
+    cy.request('/x/test/switchdefault')
+    cy.request({
+      method: 'POST',
+      url: '/x/labelsave/',
+      form: true,
+      body: {
+        username: 'default',
+        dbname: dbName,
+        name: 'web label',
+        colour: '#000000'
+      },
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(JSON.parse(response.body).map(l => l.name)).to.include('web label')
+      }
+    )
+  })
+
+  // Delete a label and the milestone.  The default labels can't be deleted
+  it('delete', () => {
+    labelCall('labeldelete', ownerKey, {name: 'needs review'}).its('status').should('eq', 200)
+    labelCall('labeldelete', ownerKey, {name: 'needs review'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Label 'needs review' not found")
+      }
+    )
+    labelCall('labeldelete', ownerKey, {name: 'bug'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Label 'bug' not found")
+      }
+    )
+    labelCall('milestonedelete', writerKey, {title: 'Version 2'}).its('status').should('eq', 200)
+    labelCall('milestones', readerKey).its('body').should('deep.eq', [])
+
+    // The discussion is kept
+    labelCall('discussions', readerKey).its('body.0.title').should('eq', 'Labels test')
+  })
+})
@@ -0,0 +1,249 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'licences.sqlite';
+const firstDB = 'licences first.sqlite';
+const licenceText = 'ACME Data Licence 1.0\n\nYou can do anything with this data, as long as you mention ACME.\n';
+
+// Calls one of the licence API calls
+function licenceCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Adds a custom licence.  The licence text is uploaded as a file, so the form data is put together manually
+function licenceAdd(key, fields, text) {
+  const z = new FormData()
+  z.set('apikey', key)
+  for (const [name, value] of Object.entries(fields)) {
+    z.set(name, value)
+  }
+  if (text !== undefined) {
+    z.set('file', new Blob([text], {type: 'text/plain'}), 'licence.txt')
+  }
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/licenceadd',
+    body: z,
+    failOnStatusCode: false,
+  }).then((response) => {
+    // The response body arrives as an ArrayBuffer, as the request was sent as form data
+    response.body = JSON.parse(Cypress.Blob.arrayBufferToBinaryString(response.body))
+    return response
+  })
+}
+
+describe('licences', () => {
+  before(() => {
+    // Seed data, then add a private database shared read only with the first user and read-write with the second
+    // user, and a database owned by the first user
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: dbName},
+            {owner: 'first', name: firstDB}
+          ],
+          shares: [
+            {dbowner: 'default', dbname: dbName, user: 'first'},
+            {dbowner: 'default', dbname: dbName, user: 'second', write: true}
+          ]
+        })
+      },
+    })
+  })
+
+  // Add a custom licence
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F licence="ACME-1.0" \
+  //       -F fullname="ACME Data Licence 1.0" -F file=@acme-1.0.txt https://localhost:9444/v1/licenceadd
+  it('add', () => {
+    licenceAdd(readerKey, {licence: 'ACME-1.0', fullname: 'ACME Data Licence 1.0'}, licenceText).then(
+      (response) => {
+        expect(response.status).to.eq(201)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+    licenceCall('licences', readerKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.include.keys('ACME-1.0', 'CC-BY-4.0', 'Not specified')
+        expect(response.body['ACME-1.0']).to.include({file_format: 'text', full_name: 'ACME Data Licence 1.0'})
+      }
+    )
+    licenceCall('licence', readerKey, {licence: 'ACME-1.0'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.headers['content-type']).to.eq('text/plain; charset=utf-8')
+        expect(response.body).to.eq(licenceText)
+      }
+    )
+  })
+
+  // Custom licences are only available to the user who added them
+  it('other users', () => {
+    licenceCall('licences', writerKey).its('body').should('not.have.property', 'ACME-1.0')
+    licenceCall('licence', writerKey, {licence: 'ACME-1.0'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq('unknown licence')
+      }
+    )
+  })
+
+  // Licences which clash with existing ones are refused, as are invalid ones
+  it('add (invalid)', () => {
+    licenceAdd(readerKey, {licence: 'ACME-1.0'}, 'Some other text').then(
+      (response) => {
+        expect(response.status).to.eq(409)
+        expect(response.body.error).to.eq('A licence with that short name/id already exists')
+      }
+    )
+    licenceAdd(readerKey, {licence: 'ACME-1.1'}, licenceText).then(
+      (response) => {
+        expect(response.status).to.eq(409)
+        expect(response.body.error).to.eq("This licence is already in the system, using the short name of 'ACME-1.0'")
+      }
+    )
+    licenceAdd(readerKey, {licence: 'ACME-1.1'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('The licence text is missing')
+      }
+    )
+    licenceAdd(readerKey, {licence: 'ACME/1.1'}, 'Some other text').then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid licence short name')
+      }
+    )
+    licenceAdd(readerKey, {licence: 'ACME-1.1', sourceurl: 'not a url'}, 'Some other text').then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid source URL')
+      }
+    )
+    licenceAdd(readerKey, {licence: 'ACME-1.1', format: 'pdf'}, 'Some other text').then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Unknown file format: pdf')
+      }
+    )
+
+    // Read only API keys can't add licences
+    licenceAdd(roKey, {licence: 'ACME-1.1'}, 'Some other text').its('status').should('eq', 401)
+  })
+
+  // Change the licence of a database
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="licences.sqlite" -F licence="CC-BY-4.0" https://localhost:9444/v1/licenceset
+  it('set', () => {
+    licenceCall('licenceset', ownerKey, {dbowner: 'default', dbname: dbName, licence: 'CC-BY-4.0'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.commit_id).to.match(/^[0-9a-f]{64}$/)
+        expect(response.body.licence_warnings).to.deep.eq([])
+      }
+    )
+    licenceCall('licencehistory', readerKey, {dbowner: 'default', dbname: dbName}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.have.lengthOf(2)
+        expect(response.body[0].licence).to.eq('CC-BY-4.0')
+        expect(response.body[0].message).to.match(/^Licence changed from '.*' to 'CC-BY-4\.0'\.$/)
+      }
+    )
+
+    // Users with write access through a share can change the licence too
+    licenceCall('licenceset', writerKey, {dbowner: 'default', dbname: dbName, licence: 'ODbL-1.0'}).its('status').should('eq', 200)
+    licenceCall('licencehistory', readerKey, {dbowner: 'default', dbname: dbName}).its('body.0.licence').should('eq', 'ODbL-1.0')
+  })
+
+  // Only users with write access can change the licence
+  it('set (no write access)', () => {
+    const params = {dbowner: 'default', dbname: dbName, licence: 'CC0'}
+    licenceCall('licenceset', readerKey, params).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body.error).to.eq("You don't have write access to this database")
+      }
+    )
+    licenceCall('licenceset', roKey, params).its('status').should('eq', 401)
+    licenceCall('licenceset', otherKey, params).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+      }
+    )
+    licenceCall('licencehistory', otherKey, {dbowner: 'default', dbname: dbName}).its('status').should('eq', 404)
+
+    // The licence wasn't changed
+    licenceCall('licencehistory', readerKey, {dbowner: 'default', dbname: dbName}).its('body.0.licence').should('eq', 'ODbL-1.0')
+  })
+
+  // Only the licences available to the database owner can be used
+  it('set (invalid)', () => {
+    licenceCall('licenceset', ownerKey, {dbowner: 'default', dbname: dbName, licence: 'ACME-1.0'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("Unknown licence: 'ACME-1.0'")
+      }
+    )
+    licenceCall('licenceset', ownerKey, {dbowner: 'default', dbname: dbName, licence: 'CC0', branch: 'nosuchbranch'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("Unknown branch name: 'nosuchbranch'")
+      }
+    )
+    licenceCall('licenceset', readerKey, {dbowner: 'first', dbname: firstDB, licence: 'ACME-1.0'}).its('status').should('eq', 200)
+  })
+
+  // Licences which are in use, and the default licences, can't be removed
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F licence="ACME-2.0" \
+  //       https://localhost:9444/v1/licencedelete
+  it('delete', () => {
+    licenceCall('licencedelete', readerKey, {licence: 'ACME-1.0'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("Can't delete the licence, as it's already being used by databases")
+      }
+    )
+    licenceCall('licencedelete', readerKey, {licence: 'CC0'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("Default licences can't be removed")
+      }
+    )
+    licenceCall('licencedelete', writerKey, {licence: 'ACME-1.0'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("A licence with that short name can't be found")
+      }
+    )
+
+    // Unused licences can be removed
+    licenceAdd(readerKey, {licence: 'ACME-2.0'}, 'ACME Data Licence 2.0\n').its('status').should('eq', 201)
+    licenceCall('licencedelete', readerKey, {licence: 'ACME-2.0'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+    licenceCall('licences', readerKey).its('body').should('not.have.property', 'ACME-2.0')
+  })
+})
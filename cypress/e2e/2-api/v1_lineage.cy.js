@@ -0,0 +1,202 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const firstKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first'
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const sourceDB = 'lineage source.sqlite'; // Private
+const derivedDB = 'lineage derived.sqlite'; // Public
+const firstDB = 'lineage first.sqlite'; // Owned by the first user
+
+// Calls one of the lineage API calls
+function lineageCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: derivedDB}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('lineage', () => {
+  let commits = []
+  let otherCommit = ''
+
+  before(() => {
+    // Seed data, then add a private source database with two commits, a public database derived from it which is
+    // shared read-write with the second user, and a database of the first user
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: sourceDB, commits: 2},
+            {owner: 'default', name: derivedDB, public: true},
+            {owner: 'first', name: firstDB}
+          ],
+          shares: [{dbowner: 'default', dbname: derivedDB, user: 'second', write: true}]
+        })
+      },
+    }).then((response) => {
+      commits = response.body.databases[0].commits
+      otherCommit = response.body.databases[1].commits[0]
+    })
+  })
+
+  // Declare which commit of another database the data came from
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="lineage derived.sqlite" -F sourceowner="default" -F sourcename="lineage source.sqlite" \
+  //       -F sourcecommit="COMMIT_ID" -F description="Cleaned up" https://localhost:9444/v1/lineageadd
+  it('add', () => {
+    lineageCall('lineageadd', ownerKey, {
+      sourceowner: 'default',
+      sourcename: sourceDB,
+      sourcecommit: commits[1],
+      description: 'Cleaned up'
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+
+    // Declaring the same commit again changes the description
+    lineageCall('lineageadd', ownerKey, {
+      sourceowner: 'default',
+      sourcename: sourceDB,
+      sourcecommit: commits[1],
+      description: 'Cleaned up the names'
+    }).its('status').should('eq', 200)
+  })
+
+  // The lineage graph holds both databases, joined by the declaration
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="lineage source.sqlite" https://localhost:9444/v1/lineage
+  it('lineage', () => {
+    lineageCall('lineage', ownerKey, {dbname: sourceDB}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.nodes).to.have.lengthOf(2)
+        expect(response.body.edges).to.have.lengthOf(1)
+        const source = response.body.nodes.find(n => n.database === sourceDB)
+        const derived = response.body.nodes.find(n => n.database === derivedDB)
+        expect(response.body.start).to.eq(source.id)
+        expect(derived).to.include({owner: 'default', private: false, deleted: false})
+        expect(response.body.edges[0]).to.include({
+          commit: commits[1],
+          derived: derived.id,
+          description: 'Cleaned up the names',
+          source: source.id
+        })
+      }
+    )
+  })
+
+  // Users who can't see the source database don't get told its name, or which commit was used
+  it('lineage (private source)', () => {
+    lineageCall('lineage', otherKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        const source = response.body.nodes.find(n => n.id !== response.body.start)
+        expect(source).to.include({database: 'private database', owner: '', private: true})
+        expect(response.body.edges[0]).to.include({commit: '', description: ''})
+      }
+    )
+    lineageCall('lineage', otherKey, {dbname: sourceDB}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+      }
+    )
+  })
+
+  // Only the owner of a database can change its lineage
+  it('no write access', () => {
+    const params = {sourceowner: 'default', sourcename: sourceDB, sourcecommit: commits[0]}
+    for (const call of ['lineageadd', 'lineageremove']) {
+      lineageCall(call, writerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(403)
+          expect(response.body.error).to.eq('Only the owner of a database can change its lineage')
+        }
+      )
+      lineageCall(call, otherKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(403)
+          expect(response.body.error).to.eq('Only the owner of a database can change its lineage')
+        }
+      )
+      lineageCall(call, roKey, params).its('status').should('eq', 401)
+    }
+
+    // The lineage wasn't changed
+    lineageCall('lineage', ownerKey).its('body.edges').should('have.lengthOf', 1)
+  })
+
+  // Only commits of other databases the user can see can be declared
+  it('add (invalid)', () => {
+    lineageCall('lineageadd', firstKey, {dbowner: 'first', dbname: firstDB, sourceowner: 'default', sourcename: sourceDB, sourcecommit: commits[0]}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Source database does not exist, or you don't have access to it")
+      }
+    )
+    lineageCall('lineageadd', ownerKey, {sourceowner: 'default', sourcename: sourceDB, sourcecommit: otherCommit}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("That commit doesn't exist in the source database")
+      }
+    )
+    lineageCall('lineageadd', ownerKey, {sourceowner: 'default', sourcename: derivedDB, sourcecommit: otherCommit}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("A database can't be derived from itself")
+      }
+    )
+    lineageCall('lineageadd', ownerKey, {sourceowner: 'default', sourcename: sourceDB, sourcecommit: 'abc'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid source commit ID')
+      }
+    )
+    lineageCall('lineageadd', ownerKey, {sourceowner: 'default', sourcename: 'bad/name', sourcecommit: commits[0]}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid source database owner or name')
+      }
+    )
+
+    // Public databases can be used as the source by anyone
+    lineageCall('lineageadd', firstKey, {dbowner: 'first', dbname: firstDB, sourceowner: 'default', sourcename: derivedDB, sourcecommit: otherCommit}).its('status').should('eq', 200)
+    lineageCall('lineage', ownerKey, {dbname: sourceDB}).its('body.nodes').should('have.lengthOf', 3)
+  })
+
+  // Remove a declaration
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="lineage derived.sqlite" -F sourceowner="default" -F sourcename="lineage source.sqlite" \
+  //       -F sourcecommit="COMMIT_ID" https://localhost:9444/v1/lineageremove
+  it('remove', () => {
+    const params = {sourceowner: 'default', sourcename: sourceDB, sourcecommit: commits[1]}
+    lineageCall('lineageremove', ownerKey, params).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+    lineageCall('lineageremove', ownerKey, params).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("The database isn't declared as derived from that commit")
+      }
+    )
+    lineageCall('lineage', ownerKey, {dbname: sourceDB}).its('body.edges').should('have.lengthOf', 0)
+  })
+})
@@ -0,0 +1,212 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'live bulk.sqlite';
+const standardDB = 'live bulk standard.sqlite';
+
+// Calls an API call for the test database
+function apiCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName, table: 'items'}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Runs a bulk operation on the items table, with the rows given as JSON
+function bulk(call, key, rows, params = {}) {
+  return apiCall(call, key, Object.assign({rows: JSON.stringify(rows)}, params))
+}
+
+// Runs a query on the test database, returning the values of the first row
+function queryRow(sql) {
+  return apiCall('query', readerKey, {sql: btoa(sql)}).then((response) => {
+    return response.body[0].map((c) => c.Value)
+  })
+}
+
+describe('live database bulk operations', () => {
+  before(() => {
+    // Seed data, then add a live database with ten rows which is shared read only with the first user and read-write
+    // with the second user.  Also add a standard database
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: dbName, live: true},
+            {owner: 'default', name: standardDB}
+          ],
+          shares: [
+            {dbowner: 'default', dbname: dbName, user: 'first'},
+            {dbowner: 'default', dbname: dbName, user: 'second', write: true}
+          ]
+        })
+      },
+    })
+  })
+
+  // Insert rows, given as JSON or CSV
+  //   Equivalent curl command:
+  //     curl -k -F apikey="EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw" -F dbowner="default" \
+  //       -F dbname="live bulk.sqlite" -F table="items" -F format="csv" \
+  //       -F rows=$'id,name,value,added_in\n13,Item 13,,2\n14,Item 14,0.5,2' https://localhost:9444/v1/bulkinsert
+  it('insert', () => {
+    bulk('bulkinsert', writerKey, [
+      {id: 11, name: 'Item 11', value: 1.5, added_in: 2},
+      {id: 12, name: 'Item 12', value: null, added_in: 2}
+    ]).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({batches: 1, batches_committed: 1, rows_changed: 2})
+      }
+    )
+    apiCall('bulkinsert', writerKey, {format: 'csv', rows: 'id,name,value,added_in\n13,Item 13,,2\n14,Item 14,0.5,2'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({batches: 1, batches_committed: 1, rows_changed: 2})
+      }
+    )
+    queryRow('SELECT count(*), max(id) FROM items').should('deep.eq', ['14', '14'])
+    queryRow('SELECT name, value IS NULL FROM items WHERE id = 13').should('deep.eq', ['Item 13', '1'])
+  })
+
+  // Insert rows, changing the existing ones with the same primary key instead
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="live bulk.sqlite" -F table="items" \
+  //       -F rows='[{"id": 1, "name": "Changed", "added_in": 1}]' https://localhost:9444/v1/bulkupsert
+  it('upsert', () => {
+    bulk('bulkupsert', ownerKey, [
+      {id: 1, name: 'Changed', added_in: 1},
+      {id: 15, name: 'Item 15', added_in: 2}
+    ]).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({batches: 1, batches_committed: 1, rows_changed: 2})
+      }
+    )
+    queryRow('SELECT count(*) FROM items').should('deep.eq', ['15'])
+    queryRow('SELECT name FROM items WHERE id = 1').should('deep.eq', ['Changed'])
+  })
+
+  // Delete rows, found by their primary key
+  //   Equivalent curl command:
+  //     curl -k -F apikey="EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw" -F dbowner="default" \
+  //       -F dbname="live bulk.sqlite" -F table="items" -F rows='[{"id": 14}, {"id": 15}]' \
+  //       https://localhost:9444/v1/bulkdelete
+  it('delete', () => {
+    bulk('bulkdelete', writerKey, [{id: 14}, {id: 15}, {id: 99}], {atomic: 'false', batchsize: '2'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({batches: 2, batches_committed: 2, rows_changed: 2})
+      }
+    )
+    queryRow('SELECT count(*), max(id) FROM items').should('deep.eq', ['13', '13'])
+  })
+
+  // Failing rows undo the whole operation when it's atomic, and stop it at the failing batch when it isn't
+  it('failing rows', () => {
+    bulk('bulkinsert', ownerKey, [
+      {id: 16, name: 'Item 16', added_in: 2},
+      {id: 1, name: 'Duplicate', added_in: 2}
+    ]).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body).to.include({batches: 1, batches_committed: 0, rows_changed: 0})
+        expect(response.body.error).to.match(/^Row 2: .*UNIQUE constraint failed/)
+      }
+    )
+    queryRow('SELECT count(*) FROM items WHERE id = 16').should('deep.eq', ['0'])
+
+    bulk('bulkinsert', ownerKey, [
+      {id: 16, name: 'Item 16', added_in: 2},
+      {id: 1, name: 'Duplicate', added_in: 2},
+      {id: 17, name: 'Item 17', added_in: 2}
+    ], {atomic: 'false', batchsize: '1'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body).to.include({batches: 3, batches_committed: 1, rows_changed: 1})
+        expect(response.body.error).to.match(/^Row 1: .*UNIQUE constraint failed/)
+      }
+    )
+    queryRow('SELECT count(*) FROM items WHERE id IN (16, 17)').should('deep.eq', ['1'])
+  })
+
+  // Only users with write access can run bulk operations
+  it('no write access', () => {
+    for (const call of ['bulkinsert', 'bulkupsert', 'bulkdelete']) {
+      bulk(call, readerKey, [{id: 3}]).then(
+        (response) => {
+          expect(response.status).to.eq(403)
+          expect(response.body.error).to.eq("You don't have write access to that database")
+        }
+      )
+      bulk(call, otherKey, [{id: 3}]).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+        }
+      )
+      bulk(call, roKey, [{id: 3}]).its('status').should('eq', 401)
+    }
+
+    // Archived databases can't be changed either
+    apiCall('archive', ownerKey, {archived: 'true'}).its('status').should('eq', 200)
+    bulk('bulkdelete', ownerKey, [{id: 3}]).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body.error).to.eq("This database has been archived by its owner, so it's read only")
+      }
+    )
+    apiCall('archive', ownerKey, {archived: 'false'}).its('status').should('eq', 200)
+
+    // Nothing was changed
+    queryRow('SELECT count(*) FROM items').should('deep.eq', ['14'])
+  })
+
+  // Invalid bulk operations are refused
+  it('invalid', () => {
+    const standardError = "That database isn't a live database.  The rows of standard databases are changed with " +
+      '/v1/rowsinsert, /v1/rowsupdate, and /v1/rowsdelete instead.'
+    for (const [call, params, message] of [
+      ['bulkinsert', {dbname: standardDB}, standardError],
+      ['bulkinsert', {table: ''}, 'Invalid table name'],
+      ['bulkinsert', {atomic: 'maybe'}, 'Invalid atomic value'],
+      ['bulkinsert', {batchsize: '0'}, 'The batch size needs to be between 1 and 10000'],
+      ['bulkinsert', {batchsize: '10001'}, 'The batch size needs to be between 1 and 10000'],
+      ['bulkinsert', {batchsize: 'ten'}, 'The batch size needs to be between 1 and 10000'],
+      ['bulkinsert', {format: 'xml'}, "Unknown format.  It needs to be either 'json' or 'csv'"],
+      ['bulkinsert', {rows: ''}, "The rows couldn't be read: EOF"],
+      ['bulkinsert', {rows: '[]'}, 'No rows were given'],
+      ['bulkinsert', {rows: '[{"id": 20}, {"name": "Test"}]'}, "Row 2 doesn't have the same columns as the first row"],
+      ['bulkinsert', {rows: '[{"name": ["a"]}]'}, "Row 1 has an invalid value for column 'name'"],
+      ['bulkinsert', {format: 'csv', rows: ''}, "The column names couldn't be read: EOF"],
+      ['bulkinsert', {format: 'csv', rows: 'id,name'}, 'No rows were given'],
+      ['bulkinsert', {format: 'csv', rows: 'id,name\n20'}, "The rows couldn't be read: record on line 2: wrong number of fields"],
+      ['bulkinsert', {table: 'missing'}, "Table 'missing' not found"],
+      ['bulkinsert', {rows: '[{"colour": "red"}]'}, "Column 'colour' not found"],
+      ['bulkupsert', {rows: '[{"name": "Test", "added_in": 2}]'}, 'Upserts need the values of all the primary key columns of the table'],
+      ['bulkdelete', {rows: '[{"id": 3, "name": "Item 1.3"}]'}, 'Deletes need the values of the primary key columns of the table, and only those']
+    ]) {
+      apiCall(call, ownerKey, Object.assign({rows: '[{"id": 20, "name": "Test", "added_in": 2}]'}, params)).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+
+    // Nothing was changed
+    queryRow('SELECT count(*) FROM items').should('deep.eq', ['14'])
+  })
+})
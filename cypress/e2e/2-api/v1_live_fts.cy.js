@@ -0,0 +1,172 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'live fts.sqlite';
+const standardDB = 'live fts standard.sqlite';
+
+// Calls an API call for the test database
+function apiCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Runs a query on the test database, returning the values of the first column of each row
+function queryColumn(sql) {
+  return apiCall('query', readerKey, {sql: btoa(sql)}).then((response) => {
+    expect(response.status).to.eq(200)
+    return response.body.map((r) => r[0].Value)
+  })
+}
+
+// Returns the names of the full text search indexes in the test database
+function indexNames() {
+  return queryColumn("SELECT name FROM sqlite_master WHERE type = 'table' AND sql LIKE '%USING fts5%' ORDER BY name")
+}
+
+describe('live database full text search indexes', () => {
+  before(() => {
+    // Seed data, then add a live database which is shared read only with the first user and read-write with the second
+    // user.  Also add a standard database
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: dbName, live: true},
+            {owner: 'default', name: standardDB}
+          ],
+          shares: [
+            {dbowner: 'default', dbname: dbName, user: 'first'},
+            {dbowner: 'default', dbname: dbName, user: 'second', write: true}
+          ]
+        })
+      },
+    })
+  })
+
+  // Create a full text search index
+  //   Equivalent curl command:
+  //     curl -k -F apikey="EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw" -F dbowner="default" \
+  //       -F dbname="live fts.sqlite" -F table="items" -F columns='["name"]' https://localhost:9444/v1/ftscreate
+  it('create', () => {
+    apiCall('ftscreate', writerKey, {table: 'items', columns: '["name"]'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({name: 'items_fts', status: 'OK'})
+      }
+    )
+    queryColumn("SELECT rowid FROM items_fts WHERE items_fts MATCH '\"Item 1.3\"'").should('deep.eq', ['3'])
+
+    // The index is kept up to date with changes to the table
+    apiCall('execute', ownerKey, {sql: btoa("UPDATE items SET name = 'Renamed' WHERE id = 4")}).its('status').should('eq', 200)
+    queryColumn("SELECT rowid FROM items_fts WHERE items_fts MATCH 'renamed'").should('deep.eq', ['4'])
+
+    // Indexes can be given a name and a tokenizer
+    apiCall('ftscreate', ownerKey, {table: 'items', columns: '["name"]', name: 'items_parts', tokenizer: 'trigram'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({name: 'items_parts', status: 'OK'})
+      }
+    )
+    queryColumn("SELECT rowid FROM items_parts WHERE items_parts MATCH 'name'").should('deep.eq', ['4'])
+    indexNames().should('deep.eq', ['items_fts', 'items_parts'])
+  })
+
+  // Remove a full text search index
+  //   Equivalent curl command:
+  //     curl -k -F apikey="EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw" -F dbowner="default" \
+  //       -F dbname="live fts.sqlite" -F name="items_parts" https://localhost:9444/v1/ftsdrop
+  it('drop', () => {
+    apiCall('ftsdrop', writerKey, {name: 'items_parts'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+    indexNames().should('deep.eq', ['items_fts'])
+
+    // The triggers are removed along with the index, and the table isn't changed
+    queryColumn("SELECT count(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'items_parts%'").should('deep.eq', ['0'])
+    queryColumn('SELECT count(*) FROM items').should('deep.eq', ['10'])
+  })
+
+  // Only users with write access can create and remove indexes
+  it('no write access', () => {
+    for (const [call, params] of [
+      ['ftscreate', {table: 'items', columns: '["name"]', name: 'items_search'}],
+      ['ftsdrop', {name: 'items_fts'}]
+    ]) {
+      apiCall(call, readerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(403)
+          expect(response.body.error).to.eq("You don't have write access to that database")
+        }
+      )
+      apiCall(call, otherKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+        }
+      )
+      apiCall(call, roKey, params).its('status').should('eq', 401)
+    }
+
+    // Archived databases can't be changed either
+    apiCall('archive', ownerKey, {archived: 'true'}).its('status').should('eq', 200)
+    apiCall('ftsdrop', ownerKey, {name: 'items_fts'}).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body.error).to.eq("This database has been archived by its owner, so it's read only")
+      }
+    )
+    apiCall('archive', ownerKey, {archived: 'false'}).its('status').should('eq', 200)
+
+    // Nothing was changed
+    indexNames().should('deep.eq', ['items_fts'])
+  })
+
+  // Invalid indexes are refused
+  it('invalid', () => {
+    const columnsError = 'The columns need to be a JSON array of between 1 and 32 column names'
+    const tooMany = JSON.stringify(Array.from({length: 33}, (_, i) => 'col' + i))
+    for (const [call, params, message] of [
+      ['ftscreate', {dbname: standardDB}, 'Full text search indexes are only available for live databases'],
+      ['ftscreate', {table: ''}, 'Invalid table name'],
+      ['ftscreate', {name: 'bad name;'}, 'Invalid index name'],
+      ['ftscreate', {columns: ''}, columnsError],
+      ['ftscreate', {columns: '[]'}, columnsError],
+      ['ftscreate', {columns: tooMany}, columnsError],
+      ['ftscreate', {tokenizer: 'icu'}, "Unknown tokenizer.  It needs to be one of 'unicode61', 'ascii', 'porter', or 'trigram'"],
+      ['ftscreate', {table: 'missing'}, "Table 'missing' not found"],
+      ['ftscreate', {name: 'items'}, "A table called 'items' already exists"],
+      ['ftscreate', {columns: '["colour"]'}, "Column 'colour' not found"],
+      ['ftscreate', {columns: '["name", "NAME"]'}, "Column 'NAME' is given more than once"],
+      ['ftsdrop', {name: ''}, 'Invalid index name'],
+      ['ftsdrop', {name: 'missing'}, "Full text search index 'missing' not found"],
+      ['ftsdrop', {name: 'items'}, "'items' isn't a full text search index"]
+    ]) {
+      apiCall(call, ownerKey, Object.assign({table: 'items', columns: '["name"]', name: 'items_search'}, params)).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+
+    // Nothing was changed
+    indexNames().should('deep.eq', ['items_fts'])
+    queryColumn('SELECT count(*) FROM items').should('deep.eq', ['10'])
+  })
+})
@@ -0,0 +1,59 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+
+// Calls one of the live node API calls
+function nodeCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('live nodes', () => {
+  before(() => {
+    // Seed data, then add a live database
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [{owner: 'default', name: 'live nodes.sqlite', live: true}]
+        })
+      },
+    })
+  })
+
+  // Return the statistics last reported by each live node
+  //   Equivalent curl command:
+  //     curl -k -F apikey="lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ" https://localhost:9444/v1/livenodes
+  it('live nodes', () => {
+    nodeCall('livenodes', adminKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.length).to.be.greaterThan(0)
+        for (const node of response.body) {
+          expect(node).to.include.keys(['database_count', 'databases', 'disk_free', 'evictions', 'memory_used',
+            'node_name', 'open_databases', 'reported', 'started', 'warm_ups'])
+          expect(node.state).to.be.oneOf(['active', 'draining', 'decommissioned'])
+          expect(node.databases).to.be.an('array')
+        }
+      }
+    )
+  })
+
+  // Only the instance admins can see the live node statistics
+  it('not an admin', () => {
+    nodeCall('livenodes', ownerKey).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body.error).to.eq('Only administrators can use this call')
+      }
+    )
+  })
+})
@@ -0,0 +1,120 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const adminROKey = 'RKMB1RRC4YCv_WMOPZOV7eeT8s49K1ftbAE9wPgQLa-l0KV7EuGgaA'; // Read only key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const dbName = 'live placements.sqlite';
+
+// Calls one of the live node API calls
+function nodeCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('live database placement', () => {
+  let nodeName = ''
+
+  before(() => {
+    // Seed data, then add a live database and a read only API key for the admin user
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [{owner: 'default', name: dbName, live: true}],
+          api_keys: [{user: 'testadmin', key: adminROKey, read_only: true}]
+        })
+      },
+    })
+  })
+
+  // Return the placement history of a live database
+  //   Equivalent curl command:
+  //     curl -k -F apikey="lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ" -F dbowner="default" \
+  //       -F dbname="live placements.sqlite" https://localhost:9444/v1/liveplacements
+  it('placements', () => {
+    nodeCall('livenodes', adminKey).its('body').then((nodes) => {
+      nodeCall('liveplacements', adminKey).then(
+        (response) => {
+          expect(response.status).to.eq(200)
+          expect(response.body).to.have.lengthOf(1)
+          expect(response.body[0]).to.include({reason: 'created'})
+          expect(response.body[0]).not.to.have.property('previous_node')
+          expect(nodes.map((n) => n.node_name)).to.include(response.body[0].node)
+          nodeName = response.body[0].node
+        }
+      )
+    })
+
+    // Databases which aren't live don't have a placement history
+    nodeCall('liveplacements', adminKey, {dbname: 'no such database.sqlite'}).its('body').should('deep.eq', [])
+  })
+
+  // Change the state of a live node
+  //   Equivalent curl command:
+  //     curl -k -F apikey="lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ" -F node="live1" -F state="active" \
+  //       https://localhost:9444/v1/livenodestate
+  it('node state', () => {
+    nodeCall('livenodestate', adminKey, {node: nodeName, state: 'active'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({node: nodeName, state: 'active'})
+      }
+    )
+    nodeCall('livenodes', adminKey).its('body').then((nodes) => {
+      expect(nodes.find((n) => n.node_name === nodeName)).to.include({state: 'active'})
+    })
+  })
+
+  // Only the instance admins can see placements and change the state of nodes
+  it('not an admin', () => {
+    for (const [call, params] of [
+      ['liveplacements', {}],
+      ['livenodestate', {node: nodeName, state: 'draining'}]
+    ]) {
+      nodeCall(call, ownerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(403)
+          expect(response.body.error).to.eq('Only administrators can use this call')
+        }
+      )
+    }
+    nodeCall('livenodestate', adminROKey, {node: nodeName, state: 'draining'}).its('status').should('eq', 401)
+
+    // Nothing was changed
+    nodeCall('livenodes', adminKey).its('body').then((nodes) => {
+      expect(nodes.find((n) => n.node_name === nodeName)).to.include({state: 'active'})
+    })
+  })
+
+  // Invalid state changes are refused
+  it('node state (invalid)', () => {
+    for (const [params, status, message] of [
+      [{node: nodeName, state: ''}, 400, "Invalid state.  It needs to be one of 'active', 'draining', or 'decommissioned'"],
+      [{node: nodeName, state: 'stopped'}, 400, "Invalid state.  It needs to be one of 'active', 'draining', or 'decommissioned'"],
+      [{node: nodeName, state: 'decommissioned'}, 409, 'Databases are still placed on the node.  It needs to be drained first'],
+      [{node: 'no such node', state: 'decommissioned'}, 404, 'Live node not found'],
+      [{node: 'no such node', state: 'active'}, 404, 'Live node not found']
+    ]) {
+      nodeCall('livenodestate', adminKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(status)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+    nodeCall('liveplacements', adminKey, {dbname: 'bad/name.sqlite'}).its('status').should('eq', 400)
+
+    // Nothing was changed
+    nodeCall('livenodes', adminKey).its('body').then((nodes) => {
+      expect(nodes.find((n) => n.node_name === nodeName)).to.include({state: 'active'})
+    })
+    nodeCall('liveplacements', adminKey).its('body').should('have.lengthOf', 1)
+  })
+})
@@ -0,0 +1,235 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'merge request reviews.sqlite';
+
+// Calls one of the merge request review API calls
+function reviewCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Returns the reason the merge request can't be merged yet, if any
+function mergeBlocked() {
+  return reviewCall('discussions', readerKey, {type: 'mr'}).then((response) => {
+    return response.body[0].mr_details.merge_blocked
+  })
+}
+
+describe('merge request reviews', () => {
+  let mrID = ''
+  let headCommit = ''
+
+  before(() => {
+    // Seed data, then add a private database which is shared read only with the first user and read-write with the
+    // second user
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [{owner: 'default', name: dbName}],
+          shares: [
+            {dbowner: 'default', dbname: dbName, user: 'first'},
+            {dbowner: 'default', dbname: dbName, user: 'second', write: true}
+          ]
+        })
+      },
+    }).then((response) => {
+      // Add a "dev" branch with a commit of its own
+      const mainCommit = response.body.databases[0].commits[0]
+      cy.request({
+        method: 'POST',
+        url: 'https://localhost:9444/v1/download',
+        form: true,
+        encoding: 'binary',
+        body: {apikey: ownerKey, dbowner: 'default', dbname: dbName},
+      }).then((download) => {
+        // Manually construct a form data object, as cy.request() doesn't yet have proper support for form data
+        const z = new FormData()
+        z.set('apikey', ownerKey)
+        z.set('dbname', dbName)
+        z.set('branch', 'dev')
+        z.set('commit', mainCommit)
+        z.set('file', Cypress.Blob.binaryStringToBlob(download.body))
+        cy.request({
+          method: 'POST',
+          url: 'https://localhost:9444/v1/upload',
+          body: z,
+        }).then((response) => {
+          // The response body arrives as an ArrayBuffer, as the request was sent as form data
+          headCommit = JSON.parse(Cypress.Blob.arrayBufferToBinaryString(response.body)).commit
+        })
+      })
+    })
+
+    // The second user asks for the "dev" branch to be merged into "main"
+    cy.request('/x/test/switchsecond')
+    cy.request({
+      method: 'POST',
+      url: '/x/createmerge/',
+      form: true,
+      body: {
+        sourceowner: 'default',
+        sourcedbname: dbName,
+        sourcebranch: 'dev',
+        destowner: 'default',
+        destdbname: dbName,
+        destbranch: 'main',
+        title: 'Review test',
+        desc: 'Test'
+      },
+    }).then((response) => {
+      mrID = String(response.body.mr_id)
+    })
+  })
+
+  after(() => {
+    // Make sure the default user is logged in for the other tests
+    cy.request('/x/test/switchdefault')
+  })
+
+  // Require merge requests to be approved before merging
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="merge request reviews.sqlite" -F approvals="1" https://localhost:9444/v1/requiredapprovalsset
+  it('required approvals', () => {
+    reviewCall('requiredapprovals', readerKey).its('body').should('deep.eq', {required_approvals: 0})
+    reviewCall('requiredapprovalsset', ownerKey, {approvals: '1'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+
+    // Users who can read the database can see how many approvals are needed
+    //   Equivalent curl command:
+    //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+    //       -F dbname="merge request reviews.sqlite" https://localhost:9444/v1/requiredapprovals
+    reviewCall('requiredapprovals', readerKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({required_approvals: 1})
+      }
+    )
+    mergeBlocked().should('eq', 'The merge request needs 1 approvals of its head commit before merging, and has 0')
+  })
+
+  // Ask for changes to the merge request
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="merge request reviews.sqlite" -F discid="1" -F state="changes_requested" \
+  //       -F body="Please add more rows" https://localhost:9444/v1/mergerequestreview
+  it('request changes', () => {
+    reviewCall('mergerequestreview', ownerKey, {discid: mrID, state: 'changes_requested', body: 'Please add more rows'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.have.lengthOf(1)
+        expect(response.body[0]).to.include({
+          body: 'Please add more rows',
+          commit: headCommit,
+          state: 'changes_requested',
+          user: 'default'
+        })
+      }
+    )
+    mergeBlocked().should('eq', "'default' has requested changes to the merge request")
+  })
+
+  // Approve the merge request, which replaces the earlier review
+  it('approve', () => {
+    reviewCall('mergerequestreview', ownerKey, {discid: mrID, state: 'approved'}).its('status').should('eq', 200)
+
+    // Users who can read the database can see the reviews
+    //   Equivalent curl command:
+    //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+    //       -F dbname="merge request reviews.sqlite" -F discid="1" https://localhost:9444/v1/mergerequestreviews
+    reviewCall('mergerequestreviews', readerKey, {discid: mrID}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.have.lengthOf(1)
+        expect(response.body[0]).to.include({commit: headCommit, state: 'approved', user: 'default'})
+        expect(response.body[0]).not.to.have.property('body')
+      }
+    )
+    mergeBlocked().should('be.undefined')
+
+    // Merge requests without reviews give an empty list
+    reviewCall('mergerequestreviews', readerKey, {discid: '99'}).its('body').should('deep.eq', [])
+  })
+
+  // Only users with write access can review merge requests, and not their own ones.  Only the owner of a database can
+  // change the approvals it needs
+  it('no write access', () => {
+    for (const [key, status, message] of [
+      [readerKey, 403, "You don't have write access to this database"],
+      [writerKey, 403, "You can't review your own merge request"],
+      [otherKey, 404, "Database does not exist, or user isn't authorised to access it"]
+    ]) {
+      reviewCall('mergerequestreview', key, {discid: mrID, state: 'changes_requested'}).then(
+        (response) => {
+          expect(response.status).to.eq(status)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+    reviewCall('mergerequestreview', roKey, {discid: mrID, state: 'changes_requested'}).its('status').should('eq', 401)
+    reviewCall('mergerequestreviews', otherKey, {discid: mrID}).its('status').should('eq', 404)
+
+    reviewCall('requiredapprovalsset', writerKey, {approvals: '2'}).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body.error).to.eq('Only the owner of a database can change the approvals its merge requests need')
+      }
+    )
+    reviewCall('requiredapprovalsset', otherKey, {approvals: '2'}).its('status').should('eq', 404)
+    reviewCall('requiredapprovalsset', roKey, {approvals: '2'}).its('status').should('eq', 401)
+    reviewCall('requiredapprovals', otherKey).its('status').should('eq', 404)
+
+    // Nothing was changed
+    reviewCall('mergerequestreviews', ownerKey, {discid: mrID}).its('body.0.state').should('eq', 'approved')
+    reviewCall('requiredapprovals', ownerKey).its('body').should('deep.eq', {required_approvals: 1})
+  })
+
+  // Invalid reviews and approval counts are refused
+  it('invalid', () => {
+    for (const [params, status, message] of [
+      [{discid: 'abc', state: 'approved'}, 400, 'Invalid merge request ID'],
+      [{discid: mrID, state: 'maybe'}, 400, 'The state needs to be one of: approved, changes_requested'],
+      [{discid: '99', state: 'approved'}, 404, 'Merge request not found']
+    ]) {
+      reviewCall('mergerequestreview', ownerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(status)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+    reviewCall('mergerequestreviews', ownerKey, {discid: '0'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid merge request ID')
+      }
+    )
+    for (const approvals of ['', '-1', '11', 'two']) {
+      reviewCall('requiredapprovalsset', ownerKey, {approvals: approvals}).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq('The number of approvals needs to be between 0 and 10')
+        }
+      )
+    }
+    reviewCall('requiredapprovals', ownerKey).its('body').should('deep.eq', {required_approvals: 1})
+  })
+})
@@ -0,0 +1,133 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'migration.sqlite';
+const liveDB = 'migration live.sqlite';
+
+// Requests a migration script for the test database
+function migration(key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/migration',
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Counts the rows inserted by a migration script
+function insertCount(script) {
+  return script.split('\n').filter(l => l.startsWith('INSERT INTO "items"')).length
+}
+
+describe('migration scripts', () => {
+  let commits = []
+
+  before(() => {
+    // Seed data, then add a private database with three commits of ten rows each, which is shared read only with the
+    // first user.  Also add a live database
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: dbName, commits: 3},
+            {owner: 'default', name: liveDB, live: true}
+          ],
+          shares: [{dbowner: 'default', dbname: dbName, user: 'first'}]
+        })
+      },
+    }).then((response) => {
+      commits = response.body.databases[0].commits
+    })
+  })
+
+  // Upgrade a copy of the database from its first commit to the head commit
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+  //       -F dbname="migration.sqlite" -F fromcommit="COMMIT_ID" https://localhost:9444/v1/migration
+  it('migration', () => {
+    migration(readerKey, {fromcommit: commits[0]}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.headers['content-type']).to.eq('application/sql')
+        expect(response.headers['content-disposition']).to.eq('attachment; filename="' + commits[2] + '-migration.sql"')
+        expect(response.body).to.match(new RegExp('^-- Migrates default/migration\\.sqlite from commit ' + commits[0] + ' to commit ' + commits[2] + '\n'))
+        expect(response.body).to.include('BEGIN TRANSACTION;')
+        expect(response.body).to.match(/\nCOMMIT;\nPRAGMA legacy_alter_table = OFF;\n$/)
+
+        // The rows added by the later two commits are inserted
+        expect(insertCount(response.body)).to.eq(20)
+      }
+    )
+
+    // Migrate to a commit other than the head one
+    migration(readerKey, {fromcommit: commits[0], commit: commits[1]}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.headers['content-disposition']).to.eq('attachment; filename="' + commits[1] + '-migration.sql"')
+        expect(insertCount(response.body)).to.eq(10)
+      }
+    )
+
+    // Leave the data out of the script
+    migration(readerKey, {fromcommit: commits[0], schemaonly: 'true'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(insertCount(response.body)).to.eq(0)
+      }
+    )
+  })
+
+  // Migration scripts need read access to the database
+  it('no access', () => {
+    migration(otherKey, {fromcommit: commits[0]}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+      }
+    )
+  })
+
+  // Live databases don't have commits to migrate between
+  it('live database', () => {
+    migration(ownerKey, {dbname: liveDB, fromcommit: commits[0]}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('That database is a live database.  Migration scripts are only available for standard databases.')
+      }
+    )
+  })
+
+  // Invalid requests are refused
+  it('migration (invalid)', () => {
+    for (const [params, message] of [
+      [{}, 'Missing commit ID to migrate from'],
+      [{fromcommit: 'abc'}, 'Invalid commit ID to migrate from'],
+      [{fromcommit: commits[0], schemaonly: 'maybe'}, 'Invalid value for schemaonly']
+    ]) {
+      migration(readerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+
+    // Both commits need to be part of the database
+    const unknown = 'a'.repeat(64)
+    for (const params of [{fromcommit: unknown}, {fromcommit: commits[0], commit: unknown}]) {
+      migration(readerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(response.body.error).to.eq("Commit '" + unknown + "' doesn't exist in database 'default/migration.sqlite'")
+        }
+      )
+    }
+  })
+})
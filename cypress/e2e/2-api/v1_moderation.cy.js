@@ -0,0 +1,341 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const firstKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first'
+const secondKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second'
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third'
+const spammerKey = 'DMDhLTh8KXQh611BjRM9hGqDtIKjrhqn_UqTTsTahjH9knw2KB4xTg'; // Key of user 'spammer', added below
+const dbName = 'moderation.sqlite';
+const privateDB = 'moderation private.sqlite';
+const deleteDB = 'moderation delete.sqlite';
+const spamDB = 'spam.sqlite';
+const adminDB = 'moderation admin.sqlite';
+
+// Calls an API call for the test database
+function apiCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Returns the open abuse reports, for checking what has been closed
+function openReports() {
+  return apiCall('moderationqueue', adminKey).its('body')
+}
+
+describe('moderation', () => {
+  let discID = 0
+  let comID = ''
+  let dbReport = 0
+  let comReport = 0
+
+  before(() => {
+    // Seed data, then add public databases for the default user, a spam account, and the admin.  The spam account
+    // comments on a discussion of the default user's database.  Also add a private database
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          users: [{name: 'spammer', display_name: 'Spam Account', email: 'spammer@example.org'}],
+          databases: [
+            {owner: 'default', name: dbName, public: true},
+            {owner: 'default', name: privateDB},
+            {owner: 'default', name: deleteDB, public: true},
+            {owner: 'spammer', name: spamDB, public: true},
+            {owner: 'testadmin', name: adminDB, public: true}
+          ],
+          discussions: [{
+            dbowner: 'default',
+            dbname: dbName,
+            creator: 'spammer',
+            title: 'Great deals',
+            body: 'Have a look',
+            comments: [{commenter: 'spammer', body: 'Buy cheap things'}]
+          }],
+          api_keys: [{user: 'spammer', key: spammerKey}]
+        })
+      },
+    }).then((response) => {
+      discID = response.body.discussions[0].id
+
+      // The ID of the comment is taken from the discussion page
+      cy.request('/x/test/switchdefault')
+      cy.request('/discuss/default/' + encodeURIComponent(dbName) + '?id=' + discID).then((response) => {
+        comID = /"com_id":(\d+)/.exec(response.body)[1]
+      })
+    })
+  })
+
+  // Report a database, and a comment in one of its discussions
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+  //       -F dbname="moderation.sqlite" -F reason="spam" -F details="Advertising links" \
+  //       https://localhost:9444/v1/abusereport
+  it('report', () => {
+    apiCall('abusereport', firstKey, {reason: 'spam', details: 'Advertising links'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.status).to.eq('OK')
+        expect(response.body.report_id).to.be.a('number')
+        dbReport = response.body.report_id
+
+        // Reporting it again while the report is open doesn't add another one
+        apiCall('abusereport', firstKey, {reason: 'other'}).its('body.report_id').should('eq', dbReport)
+      }
+    )
+    cy.then(() => {
+      apiCall('abusereport', firstKey, {comid: comID, reason: 'harassment'}).then(
+        (response) => {
+          expect(response.status).to.eq(200)
+          expect(response.body.report_id).not.to.eq(dbReport)
+          comReport = response.body.report_id
+        }
+      )
+    })
+    apiCall('abusereport', secondKey, {reason: 'copyright'}).its('status').should('eq', 200)
+
+    // The admins can see the open reports, oldest first
+    //   Equivalent curl command:
+    //     curl -k -F apikey="lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ" \
+    //       https://localhost:9444/v1/moderationqueue
+    openReports().then((reports) => {
+      expect(reports).to.have.lengthOf(3)
+      expect(reports[0]).to.include({
+        report_id: dbReport,
+        reporter: 'first',
+        owner: 'default',
+        database: dbName,
+        reason: 'spam',
+        details: 'Advertising links',
+        status: 'open',
+        action: '',
+        resolved_by: '',
+        date_resolved: null
+      })
+      expect(reports[1]).to.include({
+        report_id: comReport,
+        com_id: Number(comID),
+        disc_id: discID,
+        commenter: 'spammer',
+        comment: 'Buy cheap things',
+        reason: 'harassment'
+      })
+      expect(reports[2]).to.include({reporter: 'second', reason: 'copyright'})
+    })
+  })
+
+  // Dismissing a report closes the other open reports of the same database along with it
+  //   Equivalent curl command:
+  //     curl -k -F apikey="lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ" -F report="1" -F action="dismiss" \
+  //       https://localhost:9444/v1/moderationaction
+  it('dismiss', () => {
+    cy.then(() => {
+      apiCall('moderationaction', adminKey, {report: String(dbReport), action: 'dismiss'}).then(
+        (response) => {
+          expect(response.status).to.eq(200)
+          expect(response.body).to.deep.eq({status: 'OK'})
+        }
+      )
+      openReports().then((reports) => {
+        expect(reports.map((r) => r.report_id)).to.deep.eq([comReport])
+      })
+      apiCall('moderationqueue', adminKey, {status: 'dismissed'}).then(
+        (response) => {
+          expect(response.status).to.eq(200)
+          expect(response.body).to.have.lengthOf(2)
+          for (const r of response.body) {
+            expect(r).to.include({status: 'dismissed', action: '', resolved_by: 'testadmin'})
+            expect(r.date_resolved).not.to.eq(null)
+          }
+        }
+      )
+
+      // Closed reports can't be acted on again
+      apiCall('moderationaction', adminKey, {report: String(dbReport), action: 'hide'}).then(
+        (response) => {
+          expect(response.status).to.eq(409)
+          expect(response.body.error).to.eq('That abuse report has already been closed')
+        }
+      )
+    })
+
+    // The database is still public
+    apiCall('tables', otherKey).its('status').should('eq', 200)
+  })
+
+  // Hide a reported comment
+  it('hide', () => {
+    cy.then(() => {
+      apiCall('moderationaction', adminKey, {report: String(comReport), action: 'hide'}).its('status').should('eq', 200)
+      apiCall('moderationqueue', adminKey, {status: 'resolved'}).then(
+        (response) => {
+          expect(response.body).to.have.lengthOf(1)
+          expect(response.body[0]).to.include({report_id: comReport, status: 'resolved', action: 'hide'})
+        }
+      )
+    })
+    openReports().should('deep.eq', [])
+    cy.request('/discuss/default/' + encodeURIComponent(dbName) + '?id=' + discID).its('body').should('not.contain', 'Buy cheap things')
+  })
+
+  // Ban the owner of a reported database, and delete another reported database
+  it('ban and delete', () => {
+    apiCall('abusereport', firstKey, {dbowner: 'spammer', dbname: spamDB, reason: 'malware'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        apiCall('moderationaction', adminKey, {report: String(response.body.report_id), action: 'ban'}).its('status').should('eq', 200)
+      }
+    )
+
+    // Banned users can't use the API
+    apiCall('blocks', spammerKey).its('status').should('eq', 401)
+
+    apiCall('abusereport', firstKey, {dbname: deleteDB, reason: 'illegal'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        apiCall('moderationaction', adminKey, {report: String(response.body.report_id), action: 'delete'}).its('status').should('eq', 200)
+      }
+    )
+    apiCall('tables', ownerKey, {dbname: deleteDB}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+      }
+    )
+
+    // Admins can't ban themselves
+    apiCall('abusereport', firstKey, {dbowner: 'testadmin', dbname: adminDB, reason: 'other'}).then(
+      (response) => {
+        const report = String(response.body.report_id)
+        apiCall('moderationaction', adminKey, {report: report, action: 'ban'}).then(
+          (response) => {
+            expect(response.status).to.eq(400)
+            expect(response.body.error).to.eq("You can't ban yourself")
+          }
+        )
+        openReports().its('length').should('eq', 1)
+        apiCall('moderationaction', adminKey, {report: report, action: 'dismiss'}).its('status').should('eq', 200)
+      }
+    )
+  })
+
+  // Only the instance admins can see and act on abuse reports.  Users can only report databases they can see
+  it('not an admin', () => {
+    apiCall('abusereport', firstKey, {reason: 'spam'}).its('status').should('eq', 200)
+    for (const key of [ownerKey, firstKey]) {
+      for (const [call, params] of [
+        ['moderationqueue', {}],
+        ['moderationaction', {report: '1', action: 'delete'}]
+      ]) {
+        apiCall(call, key, params).then(
+          (response) => {
+            expect(response.status).to.eq(403)
+            expect(response.body.error).to.eq('Only administrators can use this call')
+          }
+        )
+      }
+    }
+    apiCall('moderationaction', roKey, {report: '1', action: 'delete'}).its('status').should('eq', 401)
+    apiCall('abusereport', otherKey, {dbname: privateDB, reason: 'spam'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+      }
+    )
+    apiCall('abusereport', roKey, {reason: 'spam'}).its('status').should('eq', 401)
+
+    // Nothing was changed
+    openReports().then((reports) => {
+      expect(reports).to.have.lengthOf(1)
+      expect(reports[0]).to.include({reporter: 'first', database: dbName, status: 'open'})
+    })
+  })
+
+  // Block a user, change whether they can fork, then unblock them
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F user="third" \
+  //       -F preventforks="true" https://localhost:9444/v1/block
+  it('block', () => {
+    apiCall('block', firstKey, {user: 'third', preventforks: 'true'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+    apiCall('blocks', firstKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.have.lengthOf(1)
+        expect(response.body[0]).to.include({user: 'third', prevent_forks: true})
+      }
+    )
+    apiCall('block', firstKey, {user: 'Third'}).its('status').should('eq', 200)
+    apiCall('blocks', firstKey).then(
+      (response) => {
+        expect(response.body).to.have.lengthOf(1)
+        expect(response.body[0]).to.include({user: 'third', prevent_forks: false})
+      }
+    )
+
+    // Blocks are only seen by the user who added them
+    apiCall('blocks', otherKey).its('body').should('deep.eq', [])
+
+    // Read only API keys can't change blocks
+    for (const call of ['block', 'unblock']) {
+      apiCall(call, roKey, {user: 'third'}).its('status').should('eq', 401)
+    }
+
+    //   Equivalent curl command:
+    //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F user="third" \
+    //       https://localhost:9444/v1/unblock
+    apiCall('unblock', firstKey, {user: 'third'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+    apiCall('blocks', firstKey).its('body').should('deep.eq', [])
+  })
+
+  // Invalid requests are refused
+  it('invalid', () => {
+    for (const [call, key, params, status, message] of [
+      ['abusereport', firstKey, {reason: 'spam', comid: 'first'}, 400, 'Invalid comment ID'],
+      ['abusereport', firstKey, {reason: 'spam', comid: '0'}, 400, 'Invalid comment ID'],
+      ['abusereport', firstKey, {reason: 'spam', comid: '999999999'}, 404, 'Comment not found'],
+      ['abusereport', firstKey, {reason: ''}, 400, "Unknown reason.  Must be one of 'copyright', 'harassment', 'illegal', 'malware', 'other', 'spam'"],
+      ['abusereport', firstKey, {reason: 'boring'}, 400, "Unknown reason.  Must be one of 'copyright', 'harassment', 'illegal', 'malware', 'other', 'spam'"],
+      ['abusereport', firstKey, {reason: 'spam', details: 'a'.repeat(2001)}, 400, 'Invalid details.  They can be up to 2000 characters long'],
+      ['moderationqueue', adminKey, {status: 'closed'}, 400, "Unknown status.  Must be one of 'open', 'resolved', 'dismissed', or 'all'"],
+      ['moderationaction', adminKey, {report: '', action: 'dismiss'}, 400, 'Invalid report ID'],
+      ['moderationaction', adminKey, {report: '0', action: 'dismiss'}, 400, 'Invalid report ID'],
+      ['moderationaction', adminKey, {report: '1', action: 'nuke'}, 400, "Unknown action.  Must be one of 'dismiss', 'hide', 'delete', or 'ban'"],
+      ['moderationaction', adminKey, {report: '999999999', action: 'dismiss'}, 404, 'Abuse report not found'],
+      ['block', firstKey, {user: ''}, 400, 'Invalid user name'],
+      ['block', firstKey, {user: 'first'}, 400, "You can't block yourself"],
+      ['block', firstKey, {user: 'third', preventforks: 'maybe'}, 400, 'Invalid value for preventforks'],
+      ['block', firstKey, {user: 'missing'}, 404, 'User not found'],
+      ['unblock', firstKey, {user: ''}, 400, 'Invalid user name'],
+      ['unblock', firstKey, {user: 'third'}, 404, "User 'third' isn't blocked"]
+    ]) {
+      apiCall(call, key, params).then(
+        (response) => {
+          expect(response.status).to.eq(status)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+
+    // Nothing was changed
+    openReports().its('length').should('eq', 1)
+    apiCall('blocks', firstKey).its('body').should('deep.eq', [])
+  })
+})
@@ -0,0 +1,171 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const userKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second'
+const roKey = 'pW3qVx7rT2nL8mK4jH6gF0dS9aZ5cB1vN3xM7kJ2hG8fD4sA6qW0eR'; // Read only key created for user 'second'
+const dbName = 'notifications.sqlite';
+
+// Calls one of the notification settings API calls as the second user
+function prefsCall(call, params = {}, key = userKey) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Saves the notification settings of the logged in user from the web UI
+function savePrefsPage(prefs) {
+  return cy.request({
+    method: 'POST',
+    url: '/x/notificationprefs',
+    body: prefs,
+    failOnStatusCode: false,
+  })
+}
+
+describe('notification preferences', () => {
+  before(() => {
+    // Seed data, then add a public database for the second user to watch, and a read only key for them
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [{owner: 'default', name: dbName, public: true}],
+          api_keys: [{user: 'second', key: roKey, read_only: true}]
+        })
+      },
+    })
+  })
+
+  after(() => {
+    // Make sure the default user is logged in for the other tests
+    cy.request('/x/test/switchdefault')
+  })
+
+  // Users who haven't changed their settings get all of the notification emails
+  //   Equivalent curl command:
+  //     curl -k -F apikey="EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw" \
+  //       https://localhost:9444/v1/notificationprefs
+  it('defaults', () => {
+    prefsCall('notificationprefs').then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({
+          comments: true,
+          databases: {},
+          digest: '',
+          discussions: true,
+          email: true,
+          merge_requests: true,
+          releases: true
+        })
+      }
+    )
+  })
+
+  // Only the settings given are changed
+  //   Equivalent curl command:
+  //     curl -k -F apikey="EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw" -F comments="false" \
+  //       -F digest="weekly" https://localhost:9444/v1/notificationprefssave
+  it('save', () => {
+    prefsCall('notificationprefssave', {comments: 'false', digest: 'weekly'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.include({comments: false, digest: 'weekly', discussions: true, email: true})
+      }
+    )
+    prefsCall('notificationprefssave', {digest: 'none'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.include({comments: false, digest: ''})
+      }
+    )
+    prefsCall('notificationprefs').its('body').should('include', {comments: false, digest: ''})
+  })
+
+  // Read only API keys can't change the settings
+  it('save (read only key)', () => {
+    prefsCall('notificationprefssave', {email: 'false'}, roKey).its('status').should('eq', 401)
+    prefsCall('notificationprefs', {}, roKey).its('body').should('include', {email: true})
+  })
+
+  // Invalid settings are refused
+  it('save (invalid)', () => {
+    prefsCall('notificationprefssave', {releases: 'maybe'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid value for releases')
+      }
+    )
+    prefsCall('notificationprefssave', {digest: 'hourly'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid digest mode')
+      }
+    )
+  })
+
+  // Emails can be turned on or off for each watched database
+  it('save (database)', () => {
+    prefsCall('notificationprefssave', {dbowner: 'default', dbname: dbName, dbemail: 'false'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("You're not watching database 'default/" + dbName + "'")
+      }
+    )
+
+    // Start watching the database
+    cy.request('/x/test/switchsecond')
+    cy.request('/x/watch/default/' + encodeURIComponent(dbName))
+    cy.request('/x/test/switchdefault')
+
+    prefsCall('notificationprefssave', {dbowner: 'default', dbname: dbName, dbemail: 'false'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.databases).to.deep.eq({['default/' + dbName]: false})
+      }
+    )
+    prefsCall('notificationprefssave', {dbowner: 'default', dbname: dbName, dbemail: 'yes please'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid value for dbemail')
+      }
+    )
+    prefsCall('notificationprefssave', {dbowner: 'default', dbname: dbName, dbemail: 'default'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.databases).to.deep.eq({})
+      }
+    )
+  })
+
+  // The settings page only keeps the settings of databases the user is watching
+  it('settings page', () => {
+    cy.request('/x/test/switchsecond')
+    savePrefsPage({digest: 'monthly'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body).to.eq('Invalid digest mode')
+      }
+    )
+    savePrefsPage({
+      email: true,
+      digest: 'daily',
+      databases: {['default/' + dbName]: false, 'default/not watched.sqlite': false}
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        let jsonBody = JSON.parse(response.body)
+        expect(jsonBody).to.have.property('digest', 'daily')
+        expect(jsonBody.databases).to.deep.eq({['default/' + dbName]: false})
+      }
+    )
+    cy.request('/x/test/switchdefault')
+    prefsCall('notificationprefs').its('body').should('include', {digest: 'daily'})
+  })
+})
@@ -0,0 +1,62 @@
+const userKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+
+describe('OpenAPI document', () => {
+  // The document can be retrieved without an API key
+  //   Equivalent curl command:
+  //     curl -k https://localhost:9444/v1/openapi.json
+  it('retrieve', () => {
+    cy.request('https://localhost:9444/v1/openapi.json').then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.openapi).to.match(/^3\./)
+        expect(response.body.info.title).to.eq('DBHub.io API')
+
+        // It points at this server, rather than the public one
+        expect(response.body.servers).to.have.lengthOf(1)
+        expect(response.body.servers[0].url).to.match(/^https:\/\/.+:9444$/)
+      }
+    )
+  })
+
+  // The end points are described, including the ones which change things
+  it('paths', () => {
+    cy.request('https://localhost:9444/v1/openapi.json').then(
+      (response) => {
+        const paths = response.body.paths
+        expect(paths).to.include.keys('/v1/query', '/v1/databases', '/v1/upload', '/v1/delete', '/v1/savedquerysave',
+          '/v1/labelsave', '/v1/statusupdatesread', '/v1/verify')
+
+        // The v1 calls are all POST requests, taking the API key as a form field
+        for (const [path, item] of Object.entries(paths)) {
+          if (!path.startsWith('/v1/')) {
+            continue
+          }
+          expect(item, path).to.have.property('post')
+          expect(item.post.operationId, path).to.be.a('string')
+          const forms = Object.values(item.post.requestBody.content).map(c => c.schema.properties)
+          expect(forms.some(p => p.apikey !== undefined), path).to.be.true
+        }
+
+        // The test fixtures end point isn't part of the public API
+        expect(paths).not.to.have.property('/v1/testfixtures')
+      }
+    )
+  })
+
+  // Every documented v1 end point exists, and refuses requests without a valid API key
+  it('documented end points exist', () => {
+    cy.request('https://localhost:9444/v1/openapi.json').then(
+      (response) => {
+        for (const path of Object.keys(response.body.paths).filter(p => p.startsWith('/v1/'))) {
+          cy.request({
+            method: 'POST',
+            url: 'https://localhost:9444' + path,
+            form: true,
+            body: {apikey: userKey + 'x'},
+            failOnStatusCode: false,
+          }).its('status').should('eq', 401)
+        }
+      }
+    )
+  })
+})
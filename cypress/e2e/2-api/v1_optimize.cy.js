@@ -0,0 +1,184 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'optimize.sqlite';
+const liveDB = 'optimize live.sqlite';
+const unusedDB = 'optimize unused.sqlite';
+
+// Calls an API call for the test database
+function apiCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('optimize', () => {
+  before(() => {
+    // Seed data, then add a standard database and a live database, both shared read only with the first user and
+    // read-write with the second user.  Also add a standard database which isn't optimised
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: dbName},
+            {owner: 'default', name: liveDB, live: true},
+            {owner: 'default', name: unusedDB}
+          ],
+          shares: [
+            {dbowner: 'default', dbname: dbName, user: 'first'},
+            {dbowner: 'default', dbname: dbName, user: 'second', write: true},
+            {dbowner: 'default', dbname: liveDB, user: 'first'},
+            {dbowner: 'default', dbname: liveDB, user: 'second', write: true}
+          ]
+        })
+      },
+    })
+  })
+
+  // Optimise a standard database, which adds a new commit
+  //   Equivalent curl command:
+  //     curl -k -F apikey="EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw" -F dbowner="default" \
+  //       -F dbname="optimize.sqlite" https://localhost:9444/v1/optimize
+  it('standard database', () => {
+    apiCall('optimize', writerKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.size_before).to.be.greaterThan(0)
+        expect(response.body.size_after).to.be.greaterThan(0)
+        expect(response.body.url).to.contain('/default/' + dbName + '?commit=' + response.body.commit)
+        const commit = response.body.commit
+
+        apiCall('commits', readerKey).then(
+          (response) => {
+            expect(Object.keys(response.body)).to.have.lengthOf(2)
+            expect(response.body[commit]).to.include({message: 'Optimised the database with VACUUM and ANALYZE'})
+          }
+        )
+
+        // The status shows the outcome of the optimisation
+        //   Equivalent curl command:
+        //     curl -k -F apikey="EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw" -F dbowner="default" \
+        //       -F dbname="optimize.sqlite" https://localhost:9444/v1/optimizestatus
+        apiCall('optimizestatus', writerKey).then(
+          (response) => {
+            expect(response.status).to.eq(200)
+            expect(response.body).to.include({commit_id: commit, requested_by: 'second', state: 'done'})
+            expect(response.body).not.to.have.property('error')
+          }
+        )
+      }
+    )
+
+    // The steps run and the commit message can be chosen
+    apiCall('optimize', ownerKey, {vacuum: 'false', commitmsg: 'Updated the statistics'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        const commit = response.body.commit
+        apiCall('commits', ownerKey).its('body').then((commits) => {
+          expect(commits[commit]).to.include({message: 'Updated the statistics'})
+        })
+        apiCall('optimizestatus', roKey).its('body').should('include', {commit_id: commit, requested_by: 'default'})
+      }
+    )
+    apiCall('query', readerKey, {sql: btoa('SELECT count(*) FROM items')}).its('body.0.0.Value').should('eq', '10')
+  })
+
+  // Optimise a live database, which is done in place
+  //   Equivalent curl command:
+  //     curl -k -F apikey="EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw" -F dbowner="default" \
+  //       -F dbname="optimize live.sqlite" -F analyze="false" https://localhost:9444/v1/optimize
+  it('live database', () => {
+    apiCall('optimize', writerKey, {dbname: liveDB, analyze: 'false'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.size_before).to.be.greaterThan(0)
+        expect(response.body.size_after).to.be.greaterThan(0)
+        expect(response.body).not.to.have.property('commit')
+      }
+    )
+    apiCall('optimizestatus', writerKey, {dbname: liveDB}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.include({requested_by: 'second', state: 'done'})
+        expect(response.body).not.to.have.property('commit_id')
+      }
+    )
+    apiCall('query', readerKey, {dbname: liveDB, sql: btoa('SELECT count(*) FROM items')}).its('body.0.0.Value').should('eq', '10')
+  })
+
+  // Only users with write access can optimise a database, or see its optimisations
+  it('no write access', () => {
+    for (const db of [dbName, liveDB]) {
+      for (const call of ['optimize', 'optimizestatus']) {
+        for (const key of [readerKey, otherKey]) {
+          apiCall(call, key, {dbname: db}).then(
+            (response) => {
+              expect(response.status).to.eq(404)
+              expect(response.body.error).to.eq("Database 'default/" + db + "' doesn't exist")
+            }
+          )
+        }
+      }
+      apiCall('optimize', roKey, {dbname: db}).its('status').should('eq', 401)
+
+      // Archived databases can't be optimised either
+      apiCall('archive', ownerKey, {dbname: db, archived: 'true'}).its('status').should('eq', 200)
+      apiCall('optimize', ownerKey, {dbname: db}).then(
+        (response) => {
+          expect(response.status).to.eq(403)
+          expect(response.body.error).to.eq("This database has been archived by its owner, so it's read only")
+        }
+      )
+      apiCall('archive', ownerKey, {dbname: db, archived: 'false'}).its('status').should('eq', 200)
+    }
+
+    // Nothing was changed
+    apiCall('commits', ownerKey).its('body').then((commits) => {
+      expect(Object.keys(commits)).to.have.lengthOf(3)
+    })
+    apiCall('optimizestatus', ownerKey, {dbname: liveDB}).its('body').should('include', {requested_by: 'second'})
+  })
+
+  // Invalid optimisations are refused
+  it('invalid', () => {
+    for (const [params, status, message] of [
+      [{vacuum: 'maybe'}, 400, 'Invalid vacuum value'],
+      [{analyze: 'maybe'}, 400, 'Invalid analyze value'],
+      [{vacuum: 'false', analyze: 'false'}, 400, 'At least one of vacuum and analyze needs to be true'],
+      [{branch: 'bad;branch'}, 400, 'Invalid branch name'],
+      [{branch: 'missing'}, 404, 'Branch not found']
+    ]) {
+      apiCall('optimize', ownerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(status)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+
+    // Databases which haven't been optimised don't have a status
+    apiCall('optimizestatus', ownerKey, {dbname: unusedDB}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("The database hasn't been optimised yet")
+      }
+    )
+
+    // Nothing was changed
+    apiCall('commits', ownerKey).its('body').then((commits) => {
+      expect(Object.keys(commits)).to.have.lengthOf(3)
+    })
+  })
+})
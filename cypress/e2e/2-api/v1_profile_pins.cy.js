@@ -0,0 +1,132 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const userKey = 'M7pY18KHuX75wGRzarJkIRAq_noAxnScfsz-T13PB71HdP8MPQxiqw'; // Key created for user 'pinuser'
+const roKey = 'MavxS7gRIn6lGtA_lboiyPf73u3ek4nJoSkeXMAnfNEnFiCDoJD_8Q'; // Read only key created for user 'pinuser'
+const otherKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first'
+const dbNames = ['pin 1.sqlite', 'pin 2.sqlite', 'pin 3.sqlite', 'pin 4.sqlite', 'pin 5.sqlite', 'pin 6.sqlite', 'pin 7.sqlite'];
+const liveDB = 'pin live.sqlite';
+
+// Pins or unpins one of the databases of the test user
+function pin(key, dbName, pinned, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/profilepin',
+    form: true,
+    body: Object.assign({apikey: key, dbname: dbName, pinned: pinned}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Returns the public profile of the test user
+function profile() {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/profile',
+    form: true,
+    body: {apikey: otherKey, username: 'pinuser'},
+  })
+}
+
+describe('pinned databases', () => {
+  before(() => {
+    // Seed data, then add a user with seven public databases and a live one
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          users: [{name: 'pinuser'}],
+          databases: dbNames.map(n => ({owner: 'pinuser', name: n, public: true})).concat(
+            [{owner: 'pinuser', name: liveDB, public: true, live: true}]),
+          api_keys: [{user: 'pinuser', key: userKey}, {user: 'pinuser', key: roKey, read_only: true}]
+        })
+      },
+    })
+  })
+
+  // Pin databases to the profile.  They're listed first, in the chosen order
+  //   Equivalent curl command:
+  //     curl -k -F apikey="M7pY18KHuX75wGRzarJkIRAq_noAxnScfsz-T13PB71HdP8MPQxiqw" -F dbname="pin 3.sqlite" \
+  //       -F pinned="true" -F position="1" https://localhost:9444/v1/profilepin
+  it('pin', () => {
+    pin(userKey, dbNames[4], 'true').then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK', pinned: true})
+      }
+    )
+    pin(userKey, dbNames[2], 'true', {position: '1'}).its('status').should('eq', 200)
+    profile().then(
+      (response) => {
+        expect(response.body.pinned).to.deep.eq([dbNames[2], dbNames[4]])
+        expect(response.body.databases.slice(0, 2)).to.deep.eq([dbNames[2], dbNames[4]])
+        expect(response.body.databases).to.have.lengthOf(7)
+      }
+    )
+
+    // Pinning a database again moves it
+    pin(userKey, dbNames[2], 'true', {position: '2'}).its('status').should('eq', 200)
+    profile().its('body.pinned').should('deep.eq', [dbNames[4], dbNames[2]])
+  })
+
+  // Read only API keys can't change the pins, and only the user's own standard databases can be pinned
+  it('pin (not allowed)', () => {
+    pin(roKey, dbNames[0], 'true').its('status').should('eq', 401)
+    pin(userKey, liveDB, 'true').then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or isn't a standard database")
+      }
+    )
+    pin(otherKey, dbNames[0], 'true').its('status').should('eq', 404)
+    profile().its('body.pinned').should('deep.eq', [dbNames[4], dbNames[2]])
+  })
+
+  // Invalid values are refused
+  it('pin (invalid)', () => {
+    pin(userKey, dbNames[0], 'maybe').then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid value for pinned')
+      }
+    )
+    pin(userKey, dbNames[0], 'true', {position: '0'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid position')
+      }
+    )
+  })
+
+  // Only six databases can be pinned
+  it('pin (too many)', () => {
+    for (const n of [dbNames[0], dbNames[1], dbNames[3], dbNames[5]]) {
+      pin(userKey, n, 'true').its('status').should('eq', 200)
+    }
+    pin(userKey, dbNames[6], 'true').then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("You can't pin more than 6 databases")
+      }
+    )
+    profile().its('body.pinned').should('have.lengthOf', 6)
+  })
+
+  // Unpin a database
+  it('unpin', () => {
+    pin(userKey, dbNames[4], 'false').then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK', pinned: false})
+      }
+    )
+    profile().then(
+      (response) => {
+        expect(response.body.pinned).to.have.lengthOf(5)
+        expect(response.body.pinned[0]).to.eq(dbNames[2])
+      }
+    )
+  })
+})
@@ -0,0 +1,162 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const userKey = 'ABRU8xHa4JVu4v0kDFqnEXbMcxOyLLO_Vwg64Zn9IP_IEsdh9h8PvQ'; // Key created for user 'profileuser'
+const roKey = '7eghFAY9F8VBPIMfIMvm9bI3O6hUWEDpm4mWJ-EiQXAtIl03nrY7Ow'; // Read only key created for user 'profileuser'
+const otherKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first'
+const publicDB = 'profile public.sqlite';
+const privateDB = 'profile private.sqlite';
+
+// Calls one of the profile API calls
+function profileCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('profiles', () => {
+  before(() => {
+    // Seed data, then add a user with a public and a private database, who has started a discussion on each
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          users: [{name: 'profileuser'}],
+          databases: [
+            {owner: 'profileuser', name: publicDB, public: true},
+            {owner: 'profileuser', name: privateDB}
+          ],
+          discussions: [
+            {dbowner: 'profileuser', dbname: publicDB, creator: 'profileuser', title: 'Public', body: 'Test'},
+            {dbowner: 'profileuser', dbname: privateDB, creator: 'profileuser', title: 'Private', body: 'Test'}
+          ],
+          api_keys: [{user: 'profileuser', key: userKey}, {user: 'profileuser', key: roKey, read_only: true}]
+        })
+      },
+    })
+  })
+
+  // Change the details shown on your profile
+  //   Equivalent curl command:
+  //     curl -k -F apikey="ABRU8xHa4JVu4v0kDFqnEXbMcxOyLLO_Vwg64Zn9IP_IEsdh9h8PvQ" -F bio="Collector of test data" \
+  //       -F links="https://example.org https://example.com/data" https://localhost:9444/v1/profilesave
+  it('save', () => {
+    profileCall('profilesave', userKey, {
+      displayname: 'Profile User',
+      bio: 'Collector of test data',
+      links: 'https://example.org https://example.com/data'
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+
+    // Only the fields given are changed
+    profileCall('profilesave', userKey, {bio: ' Collector of lots of test data '}).its('status').should('eq', 200)
+  })
+
+  // Anyone can see the profile, which only lists the public databases
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F username="profileuser" \
+  //       https://localhost:9444/v1/profile
+  it('profile', () => {
+    profileCall('profile', otherKey, {username: 'profileuser'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.include({
+          bio: 'Collector of lots of test data',
+          display_name: 'Profile User',
+          username: 'profileuser'
+        })
+        expect(response.body.links).to.deep.eq(['https://example.org', 'https://example.com/data'])
+        expect(response.body.databases).to.deep.eq([publicDB])
+        expect(response.body.live_databases).to.deep.eq([])
+        expect(response.body.pinned).to.deep.eq([])
+      }
+    )
+
+    // Without a user name, your own profile is returned
+    profileCall('profile', userKey).its('body.username').should('eq', 'profileuser')
+  })
+
+  // Read only API keys can't change the profile, and invalid details are refused
+  it('save (invalid)', () => {
+    profileCall('profilesave', roKey, {bio: 'Changed'}).its('status').should('eq', 401)
+    profileCall('profilesave', userKey, {bio: 'x'.repeat(501)}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("The bio can't be longer than 500 characters")
+      }
+    )
+    profileCall('profilesave', userKey, {links: 'https://a.org https://b.org https://c.org https://d.org https://e.org https://f.org'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("Profiles can't have more than 5 links")
+      }
+    )
+    profileCall('profilesave', userKey, {links: 'example'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("Invalid link: 'example'")
+      }
+    )
+    profileCall('profilesave', userKey, {links: 'ftp://example.org/data'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("Links need to be http or https URLs: 'ftp://example.org/data'")
+      }
+    )
+
+    // Nothing was changed
+    profileCall('profile', userKey).its('body.bio').should('eq', 'Collector of lots of test data')
+  })
+
+  // Unknown and invalid user names
+  it('profile (invalid)', () => {
+    profileCall('profile', otherKey, {username: 'nosuchuser'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq('Unknown user: nosuchuser')
+      }
+    )
+    profileCall('contributions', otherKey, {username: 'nosuchuser'}).its('status').should('eq', 404)
+    profileCall('profile', otherKey, {username: 'bad/name'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid user name')
+      }
+    )
+  })
+
+  // The contributions only include the databases the caller can see
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F username="profileuser" \
+  //       https://localhost:9444/v1/contributions
+  it('contributions', () => {
+    profileCall('contributions', userKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.have.all.keys('days', 'from', 'to', 'total_commits', 'total_discussions', 'total_uploads')
+        expect(response.body.total_discussions).to.eq(2)
+        expect(response.body.from).to.match(/^\d{4}-\d{2}-\d{2}$/)
+        expect(new Date(response.body.from).getUTCDay()).to.eq(0)
+      }
+    )
+    profileCall('contributions', otherKey, {username: 'profileuser'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.total_discussions).to.eq(1)
+        for (const d of response.body.days) {
+          expect(d).to.have.all.keys('commits', 'date', 'discussions', 'uploads')
+        }
+      }
+    )
+  })
+})
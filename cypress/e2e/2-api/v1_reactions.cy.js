@@ -0,0 +1,190 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'reactions.sqlite';
+
+// Calls one of the reaction API calls on the test database
+function reactCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('reactions', () => {
+  let comID = 0
+
+  before(() => {
+    // Seed data, then add a private database with two commented discussions, which is shared read only with the
+    // first user
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [{owner: 'default', name: dbName}],
+          shares: [{dbowner: 'default', dbname: dbName, user: 'first'}],
+          discussions: [
+            {
+              dbowner: 'default', dbname: dbName, creator: 'first', title: 'Reactions test', body: 'Test',
+              comments: [{commenter: 'default', body: 'First comment'}]
+            },
+            {
+              dbowner: 'default', dbname: dbName, creator: 'first', title: 'Other discussion', body: 'Test',
+              comments: [{commenter: 'default', body: 'Other comment'}]
+            }
+          ]
+        })
+      },
+    })
+    reactCall('reactions', ownerKey, {discid: '1'}).then((response) => {
+      comID = response.body.comments[0].com_id
+    })
+  })
+
+  // Add reactions to a comment.  Users who can read the database can react to its comments
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+  //       -F dbname="reactions.sqlite" -F discid="1" -F comid="12" -F reaction="+1" https://localhost:9444/v1/react
+  it('react', () => {
+    reactCall('react', readerKey, {discid: '1', comid: comID, reaction: '+1'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({com_id: comID, likes: 1, my_reactions: ['+1'], reactions: {'+1': 1}, total: 1})
+      }
+    )
+    reactCall('react', ownerKey, {discid: '1', comid: comID, reaction: 'heart'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.include({likes: 2, total: 2})
+        expect(response.body.my_reactions).to.deep.eq(['heart'])
+      }
+    )
+
+    // Reacting twice with the same reaction doesn't count twice
+    reactCall('react', ownerKey, {discid: '1', comid: comID, reaction: 'heart'}).its('body.total').should('eq', 2)
+  })
+
+  // The reactions of a discussion are summarised
+  it('list', () => {
+    reactCall('reactions', readerKey, {discid: '1'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.include({likes: 2, total: 2})
+        expect(response.body.reactions).to.deep.eq({'+1': 1, 'heart': 1})
+        expect(response.body.comments.find(c => c.com_id === comID).my_reactions).to.deep.eq(['+1'])
+      }
+    )
+  })
+
+  // Read only API keys can't react, and users without access to the database don't get told it exists
+  it('react (no access)', () => {
+    reactCall('react', roKey, {discid: '1', comid: comID, reaction: 'eyes'}).its('status').should('eq', 401)
+    reactCall('react', otherKey, {discid: '1', comid: comID, reaction: 'eyes'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+      }
+    )
+    reactCall('reactions', otherKey, {discid: '1'}).its('status').should('eq', 404)
+
+    // Nothing was added
+    reactCall('reactions', ownerKey, {discid: '1'}).its('body.total').should('eq', 2)
+  })
+
+  // Only known reactions can be added, and only to the comments of the given discussion
+  it('react (invalid)', () => {
+    reactCall('react', readerKey, {discid: '1', comid: comID, reaction: 'thumbsup'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Unknown reaction')
+      }
+    )
+    reactCall('react', readerKey, {discid: '2', comid: comID, reaction: 'eyes'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq('Unknown comment')
+      }
+    )
+    reactCall('react', readerKey, {discid: 'abc', comid: comID, reaction: 'eyes'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid discussion ID')
+      }
+    )
+    reactCall('react', readerKey, {discid: '1', comid: '0', reaction: 'eyes'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid comment ID')
+      }
+    )
+    reactCall('react', readerKey, {discid: '1', comid: comID, reaction: 'eyes', add: 'maybe'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid value for add')
+      }
+    )
+  })
+
+  // Remove a reaction.  Users can only remove their own reactions
+  it('remove', () => {
+    reactCall('react', readerKey, {discid: '1', comid: comID, reaction: 'heart', add: 'false'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.include({total: 2})
+      }
+    )
+    reactCall('react', readerKey, {discid: '1', comid: comID, reaction: '+1', add: 'false'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({com_id: comID, likes: 1, my_reactions: [], reactions: {'heart': 1}, total: 1})
+      }
+    )
+  })
+
+  // The web UI lets users react too, as long as they can see the database
+  it('web UI', () => {
+    cy.request('/x/test/switchthird')
+    cy.request({
+      method: 'POST',
+      url: '/x/reaction/',
+      form: true,
+      body: {
+        username: 'default',
+        dbname: dbName,
+        discid: '1',
+        comid: comID,
+        reaction: 'rocket'
+      },
+      failOnStatusCode: false,
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body).to.eq("Database 'default/" + dbName + "' doesn't exist")
+      }
+    )
+    cy.request('/x/test/switchfirst')
+    cy.request({
+      method: 'POST',
+      url: '/x/reaction/',
+      form: true,
+      body: {
+        username: 'default',
+        dbname: dbName,
+        discid: '1',
+        comid: comID,
+        reaction: 'rocket'
+      },
+    }).its('status').should('eq', 200)
+    cy.request('/x/test/switchdefault')
+    reactCall('reactions', ownerKey, {discid: '1'}).its('body.reactions').should('deep.eq', {'heart': 1, 'rocket': 1})
+  })
+})
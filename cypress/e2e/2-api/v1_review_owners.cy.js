@@ -0,0 +1,201 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'review owners.sqlite';
+const otherSchemaDB = 'review owners other.sqlite';
+
+// Calls one of the table owner API calls
+function ownersCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Returns the details of the merge request
+function mergeRequest() {
+  return ownersCall('discussions', readerKey, {type: 'mr'}).its('body.0.mr_details')
+}
+
+describe('table owners', () => {
+  let mainCommit = ''
+  let mrID = ''
+
+  before(() => {
+    // Seed data, then add a private database which is shared read only with the first user and read-write with the
+    // second user.  Also add a database with a "things" table instead of an "items" one
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [{owner: 'default', name: dbName}],
+          shares: [
+            {dbowner: 'default', dbname: dbName, user: 'first'},
+            {dbowner: 'default', dbname: dbName, user: 'second', write: true}
+          ]
+        })
+      },
+    }).then((response) => {
+      mainCommit = response.body.databases[0].commits[0]
+    })
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/schemacreate',
+      form: true,
+      body: {
+        apikey: ownerKey,
+        dbname: otherSchemaDB,
+        schema: JSON.stringify({tables: [{name: 'things', columns: [{name: 'id', type: 'INTEGER', primary_key: true}]}]})
+      },
+    })
+  })
+
+  after(() => {
+    // Make sure the default user is logged in for the other tests
+    cy.request('/x/test/switchdefault')
+  })
+
+  // Set the owners of the tables
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="review owners.sqlite" -F rules=$'# Table owners\nitem* default\nthings @second' \
+  //       https://localhost:9444/v1/reviewownersset
+  it('set', () => {
+    ownersCall('reviewownersset', ownerKey, {rules: '# Table owners\n*   second\n\nitem* default\nthings @second'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+
+    // Users who can read the database can see its table owners
+    //   Equivalent curl command:
+    //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+    //       -F dbname="review owners.sqlite" https://localhost:9444/v1/reviewowners
+    ownersCall('reviewowners', readerKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq([
+          {owners: ['second'], table: '*'},
+          {owners: ['default'], table: 'item*'},
+          {owners: ['second'], table: 'things'}
+        ])
+      }
+    )
+  })
+
+  // Merge requests changing a table ask its owners for a review, and need one of them to approve it
+  it('merge request', () => {
+    // Add a "dev" branch which replaces the "items" table with a "things" one
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/download',
+      form: true,
+      encoding: 'binary',
+      body: {apikey: ownerKey, dbowner: 'default', dbname: otherSchemaDB},
+    }).then((download) => {
+      // Manually construct a form data object, as cy.request() doesn't yet have proper support for form data
+      const z = new FormData()
+      z.set('apikey', ownerKey)
+      z.set('dbname', dbName)
+      z.set('branch', 'dev')
+      z.set('commit', mainCommit)
+      z.set('file', Cypress.Blob.binaryStringToBlob(download.body))
+      cy.request({
+        method: 'POST',
+        url: 'https://localhost:9444/v1/upload',
+        body: z,
+      })
+    })
+
+    // The second user asks for it to be merged
+    cy.request('/x/test/switchsecond')
+    cy.request({
+      method: 'POST',
+      url: '/x/createmerge/',
+      form: true,
+      body: {
+        sourceowner: 'default',
+        sourcedbname: dbName,
+        sourcebranch: 'dev',
+        destowner: 'default',
+        destdbname: dbName,
+        destbranch: 'main',
+        title: 'Table owners test',
+        desc: 'Test'
+      },
+    }).then((response) => {
+      mrID = String(response.body.mr_id)
+    })
+
+    // The owner of the "items" table is asked for a review.  The second user owns the "things" table, so doesn't need
+    // to be asked
+    mergeRequest().then((mr) => {
+      expect(mr.requested_reviewers).to.deep.eq(['default'])
+      expect(mr.merge_blocked).to.eq("The changes to table 'items' need to be approved by one of its owners: default")
+    })
+
+    // Once approved by the table owner, the merge request can be merged
+    cy.then(() => {
+      ownersCall('mergerequestreview', ownerKey, {discid: mrID, state: 'approved'}).its('status').should('eq', 200)
+    })
+    mergeRequest().its('merge_blocked').should('be.undefined')
+  })
+
+  // Only the owner of a database can change its table owners
+  it('no write access', () => {
+    ownersCall('reviewownersset', writerKey, {rules: '* second'}).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body.error).to.eq('Only the owner of a database can change its table owners')
+      }
+    )
+    for (const call of ['reviewownersset', 'reviewowners']) {
+      ownersCall(call, otherKey, {rules: '* second'}).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+        }
+      )
+    }
+    ownersCall('reviewownersset', roKey, {rules: '* second'}).its('status').should('eq', 401)
+
+    // Nothing was changed
+    ownersCall('reviewowners', ownerKey).its('body').should('have.lengthOf', 3)
+  })
+
+  // Invalid rules are refused
+  it('set (invalid)', () => {
+    for (const [rules, message] of [
+      ['items default\nthings', "Line 2 doesn't name any owners for 'things'"],
+      ['items[ default', "Line 1 has an invalid table pattern 'items['"],
+      ['items de/fault', "Line 1 has an invalid user name 'de/fault'"],
+      ['items default first', "'first' doesn't have write access to this database"],
+      ['items third', "'third' doesn't have write access to this database"]
+    ]) {
+      ownersCall('reviewownersset', ownerKey, {rules: rules}).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+    ownersCall('reviewowners', ownerKey).its('body').should('have.lengthOf', 3)
+  })
+
+  // Leaving out the rules removes the table owners
+  it('remove', () => {
+    ownersCall('reviewownersset', ownerKey).its('status').should('eq', 200)
+    ownersCall('reviewowners', readerKey).its('body').should('deep.eq', [])
+  })
+})
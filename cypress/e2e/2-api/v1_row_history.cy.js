@@ -0,0 +1,145 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'row history.sqlite';
+const liveDB = 'row history live.sqlite';
+
+// Requests the history of a row in the test database
+function rowHistory(key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/rowhistory',
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName, table: 'items'}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('row history', () => {
+  before(() => {
+    // Seed data, then add a private database with three commits of ten rows each, which is shared read only with the
+    // first user.  Also add a live database
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: dbName, commits: 3},
+            {owner: 'default', name: liveDB, live: true}
+          ],
+          shares: [{dbowner: 'default', dbname: dbName, user: 'first'}]
+        })
+      },
+    })
+  })
+
+  after(() => {
+    // Make sure the default user is logged in for the other tests
+    cy.request('/x/test/switchdefault')
+  })
+
+  // The history of a row points out the commit which added it
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+  //       -F dbname="row history.sqlite" -F table="items" -F key='{"id": 15}' https://localhost:9444/v1/rowhistory
+  it('history', () => {
+    rowHistory(readerKey, {key: '{"id": 15}'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.include({complete: true, exists: true, table: 'items'})
+        expect(response.body.key).to.deep.eq({id: '15'})
+        expect(response.body.changes).to.have.lengthOf(1)
+        expect(response.body.changes[0]).to.include({action: 'add', message: 'Commit 2 of the test data'})
+        expect(response.body.changes[0].data.name).to.eq('Item 2.5')
+        expect(response.body.introduced).to.deep.eq(response.body.changes[0])
+        expect(response.body.last_modified).to.deep.eq(response.body.changes[0])
+      }
+    )
+
+    // Keys can be given as strings too
+    rowHistory(readerKey, {key: '{"id": "25"}'}).its('body.introduced.message').should('eq', 'Commit 3 of the test data')
+  })
+
+  // Rows which were never in the table have an empty history
+  it('unknown row', () => {
+    rowHistory(readerKey, {key: '{"id": 999}'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.include({complete: true, exists: false, introduced: null, last_modified: null})
+        expect(response.body.changes).to.deep.eq([])
+      }
+    )
+  })
+
+  // Users without access to the database don't get told it exists
+  it('no access', () => {
+    rowHistory(otherKey, {key: '{"id": 15}'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+      }
+    )
+  })
+
+  // The key needs to match the primary key of the table
+  it('invalid', () => {
+    for (const key of ['', '[15]', '{}']) {
+      rowHistory(ownerKey, {key: key}).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq('The key needs to be a JSON object of primary key columns and their values')
+        }
+      )
+    }
+    rowHistory(ownerKey, {key: '{"id": [15]}'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("Invalid value for key column 'id'.  It needs to be a string or number")
+      }
+    )
+    for (const params of [{key: '{"name": "Item 2.5"}'}, {key: '{"id": 15, "name": "Item 2.5"}'}, {table: 'nosuchtable', key: '{"id": 15}'}]) {
+      rowHistory(ownerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq('The table needs to exist, and the key needs to give a value for each of its primary key columns')
+        }
+      )
+    }
+    rowHistory(ownerKey, {table: ''}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Missing table name')
+      }
+    )
+    rowHistory(ownerKey, {dbname: liveDB, key: '{"id": 1}'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("That database is a live database.  It doesn't have a row history.")
+      }
+    )
+  })
+
+  // The row history panel of the web UI uses the same history, and checks access too
+  it('web UI', () => {
+    const url = '/x/rowhistory/default/' + encodeURIComponent(dbName) + '?table=items&key=' + encodeURIComponent('{"id": 5}')
+    cy.request('/x/test/switchfirst')
+    cy.request(url).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(JSON.parse(response.body).introduced.message).to.eq('Commit 1 of the test data')
+      }
+    )
+    cy.request('/x/test/switchthird')
+    cy.request({url: url, failOnStatusCode: false}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body).to.eq("Database 'default/" + dbName + "' doesn't exist")
+      }
+    )
+  })
+})
@@ -0,0 +1,266 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'sandboxes.sqlite';
+const standardDB = 'sandboxes standard.sqlite';
+const readerSandbox = 'reader sandbox.sqlite';
+const writerSandbox = 'writer sandbox.sqlite';
+const ownerSandbox = 'owner sandbox.sqlite';
+
+// Calls an API call for the test database
+function apiCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Calls an API call for one of the sandboxes
+function sandboxCall(call, key, owner, sandbox, params = {}) {
+  return apiCall(call, key, Object.assign({dbowner: owner, dbname: sandbox}, params))
+}
+
+// Changes the data of a live database
+function execute(key, owner, db, sql) {
+  return apiCall('execute', key, {dbowner: owner, dbname: db, sql: btoa(sql)}).its('status').should('eq', 200)
+}
+
+// Returns the name of a row of the parent database
+function rowName(id) {
+  return apiCall('query', readerKey, {sql: btoa('SELECT name FROM items WHERE id = ' + id)}).its('body.0.0.Value')
+}
+
+describe('sandboxes', () => {
+  before(() => {
+    // Seed data, then add a live database which is shared read only with the first user and read-write with the second
+    // user.  Also add a standard database
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: dbName, live: true},
+            {owner: 'default', name: standardDB}
+          ],
+          shares: [
+            {dbowner: 'default', dbname: dbName, user: 'first'},
+            {dbowner: 'default', dbname: dbName, user: 'second', write: true}
+          ]
+        })
+      },
+    })
+  })
+
+  // Create a sandbox of a live database.  Users with read access to the database can create them
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+  //       -F dbname="sandboxes.sqlite" -F sandbox="reader sandbox.sqlite" https://localhost:9444/v1/sandboxcreate
+  it('create', () => {
+    for (const [key, owner, sandbox] of [
+      [readerKey, 'first', readerSandbox],
+      [writerKey, 'second', writerSandbox],
+      [ownerKey, 'default', ownerSandbox]
+    ]) {
+      apiCall('sandboxcreate', key, {sandbox: sandbox}).then(
+        (response) => {
+          expect(response.status).to.eq(200)
+          expect(response.body).to.include({
+            database: sandbox,
+            owner: owner,
+            parent_database: dbName,
+            parent_owner: 'default',
+            state: 'open'
+          })
+        }
+      )
+    }
+
+    // The sandboxes start out as private copies of the parent database
+    sandboxCall('query', readerKey, 'first', readerSandbox, {sql: btoa('SELECT count(*) FROM items')}).its('body.0.0.Value').should('eq', '10')
+    sandboxCall('query', otherKey, 'first', readerSandbox, {sql: btoa('SELECT count(*) FROM items')}).its('status').should('eq', 404)
+  })
+
+  // Return the sandboxes of a live database.  Users with write access see all of them, everyone else only sees their own
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="sandboxes.sqlite" https://localhost:9444/v1/sandboxes
+  it('list', () => {
+    for (const [key, expected] of [
+      [ownerKey, [ownerSandbox, writerSandbox, readerSandbox]],
+      [roKey, [ownerSandbox, writerSandbox, readerSandbox]],
+      [writerKey, [ownerSandbox, writerSandbox, readerSandbox]],
+      [readerKey, [readerSandbox]]
+    ]) {
+      apiCall('sandboxes', key).then(
+        (response) => {
+          expect(response.status).to.eq(200)
+          expect(response.body.map((s) => s.database)).to.deep.eq(expected)
+        }
+      )
+    }
+    apiCall('sandboxes', otherKey).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+      }
+    )
+  })
+
+  // Return the changes made to a sandbox
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="first" \
+  //       -F dbname="reader sandbox.sqlite" https://localhost:9444/v1/sandboxdiff
+  it('diff', () => {
+    execute(readerKey, 'first', readerSandbox, "UPDATE items SET name = 'Changed by first' WHERE id = 2")
+    sandboxCall('sandboxdiff', readerKey, 'first', readerSandbox).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.diff).to.have.lengthOf(1)
+        expect(response.body.diff[0]).to.include({object_name: 'items', object_type: 'table'})
+        expect(response.body.diff[0].data).to.have.lengthOf(1)
+        expect(response.body.diff[0].data[0].action_type).to.eq('modify')
+        expect(response.body.diff[0].data[0].data_after).to.include('Changed by first')
+      }
+    )
+
+    // The parent database isn't changed
+    rowName(2).should('eq', 'Item 1.2')
+  })
+
+  // Merge the changes made to a sandbox back into its parent database
+  //   Equivalent curl command:
+  //     curl -k -F apikey="EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw" -F dbowner="second" \
+  //       -F dbname="writer sandbox.sqlite" https://localhost:9444/v1/sandboxmerge
+  it('merge', () => {
+    execute(writerKey, 'second', writerSandbox, "UPDATE items SET name = 'Changed by second' WHERE id = 3")
+    execute(writerKey, 'second', writerSandbox, "INSERT INTO items (name, added_in) VALUES ('Added by second', 2)")
+    sandboxCall('sandboxmerge', writerKey, 'second', writerSandbox).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({objects: 1, status: 'OK'})
+      }
+    )
+    rowName(3).should('eq', 'Changed by second')
+    apiCall('query', readerKey, {sql: btoa("SELECT count(*) FROM items WHERE name = 'Added by second'")}).its('body.0.0.Value').should('eq', '1')
+
+    // The sandbox is closed once merged
+    apiCall('sandboxes', writerKey).its('body').then((list) => {
+      expect(list.find((s) => s.database === writerSandbox)).to.include({merged_by: 'second', state: 'merged'})
+    })
+    sandboxCall('sandboxmerge', writerKey, 'second', writerSandbox).then(
+      (response) => {
+        expect(response.status).to.eq(409)
+        expect(response.body.error).to.eq('That sandbox has already been merged')
+      }
+    )
+  })
+
+  // Nothing is merged when the changes conflict with changes made to the parent database
+  it('merge (conflict)', () => {
+    execute(ownerKey, 'default', ownerSandbox, "UPDATE items SET name = 'Changed in the sandbox' WHERE id = 3")
+    sandboxCall('sandboxmerge', ownerKey, 'default', ownerSandbox).then(
+      (response) => {
+        expect(response.status).to.eq(409)
+        expect(response.body.error).to.eq('The changes conflict with changes made to the parent database since the sandbox was created')
+        expect(response.body.conflicts.length).to.be.greaterThan(0)
+      }
+    )
+
+    // Nothing was changed
+    rowName(3).should('eq', 'Changed by second')
+    apiCall('sandboxes', ownerKey).its('body').then((list) => {
+      expect(list.find((s) => s.database === ownerSandbox)).to.include({state: 'open'})
+    })
+  })
+
+  // Only users with write access to the parent database can merge its sandboxes
+  it('no write access', () => {
+    sandboxCall('sandboxmerge', readerKey, 'first', readerSandbox).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body.error).to.eq('You need write access to the parent database to merge its sandboxes')
+      }
+    )
+
+    // Other users can't see the sandboxes of someone else
+    for (const call of ['sandboxdiff', 'sandboxmerge']) {
+      sandboxCall(call, otherKey, 'first', readerSandbox).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+        }
+      )
+    }
+    apiCall('sandboxcreate', otherKey, {sandbox: 'other sandbox.sqlite'}).its('status').should('eq', 404)
+    apiCall('sandboxcreate', roKey, {sandbox: 'read only sandbox.sqlite'}).its('status').should('eq', 401)
+    sandboxCall('sandboxmerge', roKey, 'default', ownerSandbox).its('status').should('eq', 401)
+
+    // Sandboxes can't be merged into archived databases
+    execute(ownerKey, 'default', ownerSandbox, "UPDATE items SET name = 'Item 1.3' WHERE id = 3")
+    execute(ownerKey, 'default', ownerSandbox, "UPDATE items SET name = 'Changed by default' WHERE id = 5")
+    apiCall('archive', ownerKey, {archived: 'true'}).its('status').should('eq', 200)
+    sandboxCall('sandboxmerge', ownerKey, 'default', ownerSandbox).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body.error).to.eq("This database has been archived by its owner, so it's read only")
+      }
+    )
+    apiCall('archive', ownerKey, {archived: 'false'}).its('status').should('eq', 200)
+
+    // Nothing was changed
+    rowName(2).should('eq', 'Item 1.2')
+    rowName(5).should('eq', 'Item 1.5')
+    apiCall('sandboxes', ownerKey).its('body').should('have.lengthOf', 3)
+  })
+
+  // Invalid sandbox requests are refused
+  it('invalid', () => {
+    for (const [params, status, message] of [
+      [{dbname: standardDB, sandbox: 'new sandbox.sqlite'}, 400, 'Sandboxes can only be created of live databases'],
+      [{sandbox: ''}, 400, 'Invalid sandbox name'],
+      [{sandbox: 'bad/name.sqlite'}, 400, 'Invalid sandbox name'],
+      [{sandbox: ownerSandbox}, 409, "You already have a database called '" + ownerSandbox + "'"],
+      [{sandbox: standardDB}, 409, "You already have a database called '" + standardDB + "'"]
+    ]) {
+      apiCall('sandboxcreate', ownerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(status)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+    for (const call of ['sandboxdiff', 'sandboxmerge']) {
+      apiCall(call, ownerKey).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq("That database isn't a sandbox")
+        }
+      )
+    }
+    for (const [params, message] of [
+      [{objects: 'items'}, 'Invalid objects value.  It needs to be a JSON array of object names'],
+      [{objects: '["missing"]'}, 'There are no changes to merge']
+    ]) {
+      sandboxCall('sandboxmerge', ownerKey, 'default', ownerSandbox, params).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+
+    // Nothing was changed
+    rowName(5).should('eq', 'Item 1.5')
+    apiCall('sandboxes', ownerKey).its('body').should('have.lengthOf', 3)
+  })
+})
@@ -0,0 +1,238 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'saved queries.sqlite';
+
+// Calls one of the saved query API calls on the test database
+function queryCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('saved queries', () => {
+  before(() => {
+    // Seed data, then add a private database shared read only with one user and read-write with another
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [{owner: 'default', name: dbName}],
+          shares: [
+            {dbowner: 'default', dbname: dbName, user: 'first'},
+            {dbowner: 'default', dbname: dbName, user: 'second', write: true}
+          ]
+        })
+      },
+    })
+  })
+
+  // Save a query, then save a changed version of it
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="saved queries.sqlite" -F name="Top items" -F sql="BASE64_SQL" -F shared="true" \
+  //       https://localhost:9444/v1/savedquerysave
+  it('save', () => {
+    queryCall('savedquerysave', ownerKey, {
+      name: 'Top items',
+      description: 'The items with the highest values',
+      sql: btoa('SELECT name, value FROM items ORDER BY value DESC LIMIT 3'),
+      shared: 'true'
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({version: 1})
+      }
+    )
+    queryCall('savedquerysave', ownerKey, {
+      name: 'Top items',
+      sql: btoa('SELECT name, value FROM items ORDER BY value DESC LIMIT 5'),
+      shared: 'true'
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({version: 2})
+      }
+    )
+
+    // Saving the same SQL again doesn't add a version
+    queryCall('savedquerysave', ownerKey, {
+      name: 'Top items',
+      sql: btoa('SELECT name, value FROM items ORDER BY value DESC LIMIT 5'),
+      shared: 'true'
+    }).its('body').should('deep.eq', {version: 2})
+  })
+
+  // Read only API keys can't save queries
+  it('save (read only key)', () => {
+    queryCall('savedquerysave', roKey, {name: 'Read only', sql: btoa('SELECT 1')}).then(
+      (response) => {
+        expect(response.status).to.eq(401)
+      }
+    )
+  })
+
+  // Users who can only read the database can't save queries for it, so they can't take the query names
+  it('save (read only access)', () => {
+    queryCall('savedquerysave', readerKey, {name: 'Reader query', sql: btoa('SELECT 1')}).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body.error).to.eq('You need write access to the database to save queries for it')
+      }
+    )
+  })
+
+  // Users without access to the database don't get told it exists
+  it('save (no access)', () => {
+    queryCall('savedquerysave', otherKey, {name: 'Other query', sql: btoa('SELECT 1')}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+      }
+    )
+  })
+
+  // Users with write access can save their own queries, but can't change the ones other people created
+  it('save (read-write access)', () => {
+    queryCall('savedquerysave', writerKey, {name: 'Unshared query', sql: btoa('SELECT count(*) FROM items')}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({version: 1})
+      }
+    )
+    queryCall('savedquerysave', writerKey, {name: 'Top items', sql: btoa('SELECT 1')}).then(
+      (response) => {
+        expect(response.status).to.eq(500)
+        expect(response.body.error).to.eq("A saved query called 'Top items' already exists for this database")
+      }
+    )
+  })
+
+  // Invalid details are refused
+  it('save (invalid)', () => {
+    queryCall('savedquerysave', ownerKey, {name: '', sql: btoa('SELECT 1')}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid saved query name')
+      }
+    )
+    queryCall('savedquerysave', ownerKey, {name: 'No SQL'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid SQL query')
+      }
+    )
+    queryCall('savedquerysave', ownerKey, {name: 'Bad shared', sql: btoa('SELECT 1'), shared: 'maybe'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid value for shared')
+      }
+    )
+  })
+
+  // Users see the queries they created, plus the shared ones
+  it('list', () => {
+    queryCall('savedqueries', readerKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.map(q => q.name)).to.deep.eq(['Top items'])
+        expect(response.body[0]).to.include({creator: 'default', shared: true, version: 2})
+      }
+    )
+    queryCall('savedqueries', writerKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.map(q => q.name)).to.have.members(['Top items', 'Unshared query'])
+      }
+    )
+    queryCall('savedqueries', ownerKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.map(q => q.name)).to.deep.eq(['Top items'])
+      }
+    )
+    queryCall('savedqueries', otherKey).its('status').should('eq', 404)
+  })
+
+  // Run a saved query, with the latest version being the default
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+  //       -F dbname="saved queries.sqlite" -F name="Top items" https://localhost:9444/v1/savedquery
+  it('run', () => {
+    queryCall('savedquery', readerKey, {name: 'Top items'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.have.lengthOf(5)
+      }
+    )
+    queryCall('savedquery', readerKey, {name: 'Top items', version: '1'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.have.lengthOf(3)
+      }
+    )
+    queryCall('savedquery', readerKey, {name: 'Top items', version: '1', format: 'columnar'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.columns).to.deep.eq(['name', 'value'])
+        expect(response.body.row_count).to.eq(3)
+      }
+    )
+
+    // Unshared queries can only be run by the user who created them
+    queryCall('savedquery', writerKey, {name: 'Unshared query'}).its('status').should('eq', 200)
+    queryCall('savedquery', readerKey, {name: 'Unshared query'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Saved query 'Unshared query' not found")
+      }
+    )
+  })
+
+  // Invalid versions and output formats are refused
+  it('run (invalid)', () => {
+    for (const version of ['0', 'abc']) {
+      queryCall('savedquery', readerKey, {name: 'Top items', version: version}).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq('Invalid version number')
+        }
+      )
+    }
+    queryCall('savedquery', readerKey, {name: 'Top items', format: 'xml'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Unknown output format requested')
+      }
+    )
+    queryCall('savedquery', otherKey, {name: 'Top items'}).its('status').should('eq', 404)
+  })
+
+  // The version history of a saved query
+  it('versions', () => {
+    queryCall('savedqueryversions', readerKey, {name: 'Top items'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.map(v => v.version)).to.have.members([1, 2])
+        expect(response.body.map(v => v.author)).to.deep.eq(['default', 'default'])
+      }
+    )
+    queryCall('savedqueryversions', readerKey, {name: 'Unknown query'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Saved query 'Unknown query' not found")
+      }
+    )
+  })
+})
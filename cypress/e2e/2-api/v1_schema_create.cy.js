@@ -0,0 +1,166 @@
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third'
+const dbName = 'schema create.sqlite';
+const schema = {
+  tables: [
+    {
+      name: 'authors',
+      columns: [
+        {name: 'id', type: 'INTEGER', primary_key: true, autoincrement: true},
+        {name: 'name', type: 'TEXT', not_null: true, unique: true}
+      ]
+    },
+    {
+      name: 'books',
+      columns: [
+        {name: 'id', type: 'INTEGER', primary_key: true},
+        {name: 'title', type: 'TEXT', default: 'Untitled'},
+        {name: 'author_id', type: 'INTEGER', references: {table: 'authors', column: 'id'}},
+        {name: 'price', type: 'DECIMAL(10, 2)', default: 0}
+      ]
+    }
+  ],
+  indexes: [{name: 'books_author', table: 'books', columns: ['author_id']}]
+};
+
+// Calls an API call for the test database
+function apiCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Returns a copy of the test schema definition, changed by the given function
+function changedSchema(change) {
+  const s = JSON.parse(JSON.stringify(schema))
+  change(s)
+  return JSON.stringify(s)
+}
+
+describe('create databases from a schema definition', () => {
+  before(() => {
+    // Seed data
+    cy.request('/x/test/seed')
+  })
+
+  // Create a new database from a schema definition
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbname="schema create.sqlite" \
+  //       -F schema='{"tables": [{"name": "authors", "columns": [{"name": "id", "type": "INTEGER", "primary_key": true}]}]}' \
+  //       -F commitmsg="Library schema" -F licence="CC0" -F public="true" https://localhost:9444/v1/schemacreate
+  it('create', () => {
+    apiCall('schemacreate', ownerKey, {schema: JSON.stringify(schema), commitmsg: 'Library schema', licence: 'CC0', public: 'true'}).then(
+      (response) => {
+        expect(response.status).to.eq(201)
+        expect(response.body.commit).to.match(/^[0-9a-f]{64}$/)
+        expect(response.body.url).to.contain('/default/' + dbName + '?branch=main&commit=' + response.body.commit)
+      }
+    )
+
+    // The new database has the tables, columns, and indexes of the definition.  It's public, so anyone can see them
+    apiCall('tables', otherKey).its('body').should('have.members', ['authors', 'books'])
+    apiCall('columns', otherKey, {table: 'books'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.map((c) => c.name)).to.deep.eq(['id', 'title', 'author_id', 'price'])
+        expect(response.body[1].default_value).to.eq("'Untitled'")
+      }
+    )
+    apiCall('columns', otherKey, {table: 'authors'}).its('body.1.not_null').should('eq', true)
+    apiCall('indexes', otherKey).then(
+      (response) => {
+        const index = response.body.find((i) => i.name === 'books_author')
+        expect(index).to.include({table: 'books'})
+        expect(index.columns[0]).to.include({name: 'author_id'})
+      }
+    )
+    apiCall('query', otherKey, {sql: btoa('SELECT count(*) FROM books')}).its('body.0.0.Value').should('eq', '0')
+
+    // The commit message was used for the first commit
+    apiCall('commits', otherKey).then(
+      (response) => {
+        const commits = Object.values(response.body)
+        expect(commits).to.have.lengthOf(1)
+        expect(commits[0]).to.include({message: 'Library schema', parent: ''})
+      }
+    )
+  })
+
+  // New databases are private unless asked otherwise
+  it('create (private)', () => {
+    apiCall('schemacreate', ownerKey, {dbname: 'schema create private.sqlite', schema: JSON.stringify(schema)}).its('status').should('eq', 201)
+    apiCall('tables', otherKey, {dbname: 'schema create private.sqlite'}).its('status').should('eq', 404)
+    apiCall('commits', ownerKey, {dbname: 'schema create private.sqlite'}).then(
+      (response) => {
+        expect(Object.values(response.body)[0]).to.include({message: 'Created from a schema definition'})
+      }
+    )
+  })
+
+  // Read only API keys can't create databases
+  it('no write access', () => {
+    apiCall('schemacreate', roKey, {dbname: 'schema create read only.sqlite', schema: JSON.stringify(schema)}).its('status').should('eq', 401)
+    apiCall('tables', ownerKey, {dbname: 'schema create read only.sqlite'}).its('status').should('eq', 404)
+  })
+
+  // Invalid schema definitions are refused
+  it('create (invalid)', () => {
+    for (const [params, message] of [
+      [{dbname: 'bad/name.sqlite'}, 'Invalid database name'],
+      [{schema: '{"tables": ['}, "The schema definition couldn't be read: unexpected EOF"],
+      [{schema: '{"tables": [], "views": []}'}, 'The schema definition couldn\'t be read: json: unknown field "views"'],
+      [{schema: '{"tables": []}'}, 'The schema definition needs to have between 1 and 100 tables'],
+      [{schema: changedSchema((s) => { s.tables[0].name = 'sqlite_authors' })}, "Invalid table name: 'sqlite_authors'"],
+      [{schema: changedSchema((s) => { s.tables[1].name = 'Authors' })}, "Table 'Authors' is in the schema definition more than once"],
+      [{schema: changedSchema((s) => { s.tables[0].columns = [] })}, "Table 'authors' needs to have at least one column"],
+      [{schema: changedSchema((s) => { s.tables[0].columns[1].name = 'ID' })}, "Column 'ID' is in table 'authors' more than once"],
+      [{schema: changedSchema((s) => { s.tables[0].columns[1].type = 'TEXT; DROP' })}, "Invalid type for column 'name' of table 'authors': 'TEXT; DROP'"],
+      [{schema: changedSchema((s) => { s.tables[1].columns[1].default = ['a'] })}, "Invalid default value for column 'title' of table 'books'"],
+      [{schema: changedSchema((s) => { s.tables[1].primary_key = ['isbn'] })}, "Primary key column 'isbn' isn't a column of table 'books'"],
+      [{schema: changedSchema((s) => { s.tables[1].columns[2].references.table = 'writers' })}, "Column 'author_id' of table 'books' refers to table 'writers', which isn't in the schema definition"],
+      [{schema: changedSchema((s) => { s.tables[1].columns[2].references.column = 'author' })}, "Column 'author_id' of table 'books' refers to column 'author', which isn't in table 'authors'"],
+      [{schema: changedSchema((s) => { s.indexes.push(s.indexes[0]) })}, "Index 'books_author' is in the schema definition more than once"],
+      [{schema: changedSchema((s) => { s.indexes[0].table = 'authors' })}, "Index 'books_author' column 'author_id' isn't a column of table 'authors'"],
+      [{schema: changedSchema((s) => { s.indexes[0].columns = [] })}, "Index 'books_author' needs to have at least one column"],
+      [{schema: JSON.stringify(schema), commitmsg: 'Test', licence: 'Mine'}, "Unknown licence: 'Mine'"],
+      [{schema: JSON.stringify(schema), public: 'maybe'}, 'Invalid public value']
+    ]) {
+      apiCall('schemacreate', ownerKey, Object.assign({dbname: 'schema create invalid.sqlite'}, params)).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+
+    // Definitions SQLite doesn't accept are refused too
+    apiCall('schemacreate', ownerKey, {
+      dbname: 'schema create invalid.sqlite',
+      schema: changedSchema((s) => { s.tables[1].columns[3].autoincrement = true; s.tables[1].columns[3].primary_key = true })
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.match(/^The database couldn't be created from the schema definition: /)
+      }
+    )
+
+    // Existing databases can't be replaced
+    apiCall('schemacreate', ownerKey, {schema: JSON.stringify(schema)}).then(
+      (response) => {
+        expect(response.status).to.eq(409)
+        expect(response.body.error).to.eq('A database with that name already exists.  Please choose a different name.')
+      }
+    )
+
+    // Nothing was changed
+    apiCall('tables', ownerKey, {dbname: 'schema create invalid.sqlite'}).its('status').should('eq', 404)
+    apiCall('commits', ownerKey).its('body').then((commits) => {
+      expect(Object.keys(commits)).to.have.lengthOf(1)
+    })
+  })
+})
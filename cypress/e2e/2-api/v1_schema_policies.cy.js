@@ -0,0 +1,192 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'schema policies.sqlite';
+const otherSchemaDB = 'schema policies other.sqlite';
+
+// Calls one of the schema policy API calls
+function policyCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Downloads the head commit of a database
+function download(db) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/download',
+    form: true,
+    encoding: 'binary',
+    body: {apikey: ownerKey, dbowner: 'default', dbname: db},
+  })
+}
+
+// Uploads a database file as a new commit of the test database
+function upload(file, headCommit) {
+  // Manually construct a form data object, as cy.request() doesn't yet have proper support for form data
+  const z = new FormData()
+  z.set('apikey', ownerKey)
+  z.set('dbname', dbName)
+  z.set('commit', headCommit)
+  z.set('file', Cypress.Blob.binaryStringToBlob(file))
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/upload',
+    body: z,
+    failOnStatusCode: false,
+  }).then((response) => {
+    // The response body arrives as an ArrayBuffer, as the request was sent as form data
+    response.body = JSON.parse(Cypress.Blob.arrayBufferToBinaryString(response.body))
+    return response
+  })
+}
+
+describe('schema change policies', () => {
+  let headCommit = ''
+  let sameSchema = ''
+  let otherSchema = ''
+
+  before(() => {
+    // Seed data, then add a private database which is shared read only with the first user and read-write with the
+    // second user
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [{owner: 'default', name: dbName}],
+          shares: [
+            {dbowner: 'default', dbname: dbName, user: 'first'},
+            {dbowner: 'default', dbname: dbName, user: 'second', write: true}
+          ]
+        })
+      },
+    }).then((response) => {
+      headCommit = response.body.databases[0].commits[0]
+    })
+
+    // Keep a copy of the test database, and of a database with a different schema
+    download(dbName).then((response) => {
+      sameSchema = response.body
+    })
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/schemacreate',
+      form: true,
+      body: {
+        apikey: ownerKey,
+        dbname: otherSchemaDB,
+        schema: JSON.stringify({tables: [{name: 'things', columns: [{name: 'id', type: 'INTEGER', primary_key: true}]}]})
+      },
+    })
+    download(otherSchemaDB).then((response) => {
+      otherSchema = response.body
+    })
+  })
+
+  // Stop schema changes to a branch
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="schema policies.sqlite" -F branch="main" -F policy="block" \
+  //       https://localhost:9444/v1/schemapolicyset
+  it('block', () => {
+    policyCall('schemapolicyset', ownerKey, {branch: 'main', policy: 'block'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+
+    // Users who can read the database can see its policies
+    //   Equivalent curl command:
+    //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+    //       -F dbname="schema policies.sqlite" https://localhost:9444/v1/schemapolicies
+    policyCall('schemapolicies', readerKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({main: 'block'})
+      }
+    )
+
+    // Changes to the data are still accepted
+    upload(sameSchema, headCommit).then((response) => {
+      expect(response.status).to.eq(201)
+      headCommit = response.body.commit
+    })
+
+    // Changes to the schema aren't
+    cy.then(() => {
+      upload(otherSchema, headCommit).then((response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("Branch 'main' doesn't accept schema changes, only changes to the data")
+      })
+    })
+  })
+
+  // Only accept schema changes from approved merge requests
+  it('approval', () => {
+    policyCall('schemapolicyset', ownerKey, {branch: 'main', policy: 'approval'}).its('status').should('eq', 200)
+    policyCall('schemapolicies', readerKey).its('body').should('deep.eq', {main: 'approval'})
+    upload(otherSchema, headCommit).then((response) => {
+      expect(response.status).to.eq(400)
+      expect(response.body.error).to.eq("Schema changes to branch 'main' need to be made through an approved merge request")
+    })
+  })
+
+  // Only the owner of a database can change its policies
+  it('no write access', () => {
+    policyCall('schemapolicyset', writerKey, {branch: 'main'}).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body.error).to.eq('Only the owner of a database can change its schema change policies')
+      }
+    )
+    for (const call of ['schemapolicyset', 'schemapolicies']) {
+      policyCall(call, otherKey, {branch: 'main'}).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+        }
+      )
+    }
+    policyCall('schemapolicyset', roKey, {branch: 'main'}).its('status').should('eq', 401)
+
+    // Nothing was changed
+    policyCall('schemapolicies', ownerKey).its('body').should('deep.eq', {main: 'approval'})
+  })
+
+  // Invalid policies are refused
+  it('set (invalid)', () => {
+    for (const [params, status, message] of [
+      [{policy: 'block'}, 400, 'Invalid branch name'],
+      [{branch: 'dev', policy: 'block'}, 404, "Unknown branch 'dev'"],
+      [{branch: 'main', policy: 'sometimes'}, 400, 'The policy needs to be one of: block, approval']
+    ]) {
+      policyCall('schemapolicyset', ownerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(status)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+    policyCall('schemapolicies', ownerKey).its('body').should('deep.eq', {main: 'approval'})
+  })
+
+  // Leaving out the policy lets the branch accept any schema change again
+  it('remove', () => {
+    policyCall('schemapolicyset', ownerKey, {branch: 'main'}).its('status').should('eq', 200)
+    policyCall('schemapolicies', readerKey).its('body').should('deep.eq', {})
+    upload(otherSchema, headCommit).its('status').should('eq', 201)
+  })
+})
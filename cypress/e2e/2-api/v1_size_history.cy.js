@@ -0,0 +1,159 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'size history.sqlite';
+const liveDB = 'size history live.sqlite';
+
+// Calls an API call for the test database
+function apiCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('size history', () => {
+  let commits = []
+
+  before(() => {
+    // Seed data, then add a private standard database with three commits which is shared read only with the first user
+    // and read-write with the second user.  Also add a live database
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: dbName, commits: 3},
+            {owner: 'default', name: liveDB, live: true}
+          ],
+          shares: [
+            {dbowner: 'default', dbname: dbName, user: 'first'},
+            {dbowner: 'default', dbname: dbName, user: 'second', write: true}
+          ]
+        })
+      },
+    }).then((response) => {
+      commits = response.body.databases[0].commits
+    })
+  })
+
+  // Return the size of the database for each commit of a branch
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+  //       -F dbname="size history.sqlite" -F branch="main" https://localhost:9444/v1/sizehistory
+  it('size history', () => {
+    for (const params of [{}, {branch: 'main'}]) {
+      apiCall('sizehistory', readerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(200)
+          expect(response.body.map((e) => e.commit)).to.deep.eq(commits)
+          for (const e of response.body) {
+            expect(e.size).to.be.greaterThan(0)
+            expect(e).to.include.keys(['timestamp'])
+          }
+        }
+      )
+    }
+  })
+
+  // Return the size alert of a database, which is off until it's set
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+  //       -F dbname="size history.sqlite" https://localhost:9444/v1/sizealert
+  it('size alert', () => {
+    apiCall('sizealert', readerKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({growth_bytes: 0, growth_percent: 0})
+      }
+    )
+  })
+
+  // Set the size alert of a database
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="size history.sqlite" -F growth_percent="50" -F growth_bytes="104857600" \
+  //       https://localhost:9444/v1/sizealertset
+  it('set size alert', () => {
+    apiCall('sizealertset', ownerKey, {growth_bytes: '104857600', growth_percent: '50'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+    apiCall('sizealert', readerKey).its('body').should('deep.eq', {growth_bytes: 104857600, growth_percent: 50})
+
+    // The settings are replaced, so the ones not given are turned off
+    apiCall('sizealertset', ownerKey, {growth_percent: '25'}).its('status').should('eq', 200)
+    apiCall('sizealert', roKey).its('body').should('deep.eq', {growth_bytes: 0, growth_percent: 25})
+  })
+
+  // Only the owner of a database can change its size alert, and users without access can't see its size
+  it('not the owner', () => {
+    for (const key of [readerKey, writerKey]) {
+      apiCall('sizealertset', key, {growth_percent: '10'}).then(
+        (response) => {
+          expect(response.status).to.eq(403)
+          expect(response.body.error).to.eq('Only the owner of a database can change its size alert')
+        }
+      )
+    }
+    for (const [call, params] of [
+      ['sizealert', {}],
+      ['sizealertset', {growth_percent: '10'}],
+      ['sizehistory', {}]
+    ]) {
+      apiCall(call, otherKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+        }
+      )
+    }
+    apiCall('sizealertset', roKey, {growth_percent: '10'}).its('status').should('eq', 401)
+
+    // Nothing was changed
+    apiCall('sizealert', ownerKey).its('body').should('deep.eq', {growth_bytes: 0, growth_percent: 25})
+  })
+
+  // Invalid requests are refused
+  it('invalid', () => {
+    for (const [params, message] of [
+      [{growth_bytes: '-1'}, 'Invalid growth_bytes value'],
+      [{growth_bytes: 'lots'}, 'Invalid growth_bytes value'],
+      [{growth_percent: '-1'}, 'Invalid growth_percent value'],
+      [{growth_percent: '1.5'}, 'Invalid growth_percent value']
+    ]) {
+      apiCall('sizealertset', ownerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+    for (const [params, status, message] of [
+      [{dbname: liveDB}, 400, "That database is a live database.  It doesn't have a size history."],
+      [{branch: 'missing'}, 404, "That branch doesn't exist in the database"]
+    ]) {
+      apiCall('sizehistory', ownerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(status)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+
+    // Nothing was changed
+    apiCall('sizealert', ownerKey).its('body').should('deep.eq', {growth_bytes: 0, growth_percent: 25})
+  })
+})
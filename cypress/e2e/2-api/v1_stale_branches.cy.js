@@ -0,0 +1,162 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'stale branches.sqlite';
+
+// Calls one of the branch API calls
+function branchCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Adds a branch to the test database, holding a new commit on top of the given one
+function addBranch(file, branch, commit) {
+  // Manually construct a form data object, as cy.request() doesn't yet have proper support for form data
+  const z = new FormData()
+  z.set('apikey', ownerKey)
+  z.set('dbname', dbName)
+  z.set('branch', branch)
+  z.set('commit', commit)
+  z.set('commitmsg', 'Start of the ' + branch + ' branch')
+  z.set('file', Cypress.Blob.binaryStringToBlob(file))
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/upload',
+    body: z,
+  }).then((response) => {
+    // The response body arrives as an ArrayBuffer, as the request was sent as form data
+    return JSON.parse(Cypress.Blob.arrayBufferToBinaryString(response.body)).commit
+  })
+}
+
+describe('stale branches', () => {
+  before(() => {
+    // Seed data, then add a private database which is shared read only with the first user and read-write with the
+    // second user
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [{owner: 'default', name: dbName}],
+          shares: [
+            {dbowner: 'default', dbname: dbName, user: 'first'},
+            {dbowner: 'default', dbname: dbName, user: 'second', write: true}
+          ]
+        })
+      },
+    }).then((response) => {
+      const mainCommit = response.body.databases[0].commits[0]
+
+      // Add the "old" and "tagged" branches, and tag the commit only on the "tagged" one
+      cy.request({
+        method: 'POST',
+        url: 'https://localhost:9444/v1/download',
+        form: true,
+        encoding: 'binary',
+        body: {apikey: ownerKey, dbowner: 'default', dbname: dbName},
+      }).then((download) => {
+        addBranch(download.body, 'old', mainCommit)
+        addBranch(download.body, 'tagged', mainCommit).then((commit) => {
+          cy.request('/x/test/switchdefault')
+          cy.request({
+            method: 'POST',
+            url: '/x/createtag',
+            form: true,
+            body: {username: 'default', dbname: dbName, commit: commit, tag: 'v1', tagtype: 'tag'},
+          })
+        })
+      })
+    })
+  })
+
+  // Branches are only flagged as stale after going without commits for a while
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+  //       -F dbname="stale branches.sqlite" https://localhost:9444/v1/stalebranches
+  it('stale branches', () => {
+    branchCall('stalebranches', readerKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq([])
+      }
+    )
+    branchCall('stalebranches', otherKey).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+      }
+    )
+  })
+
+  // Deleting branches needs write access to the database
+  it('delete (no write access)', () => {
+    branchCall('branchesdelete', readerKey, {branches: 'old'}).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body.error).to.eq("You don't have write access to that database")
+      }
+    )
+    branchCall('branchesdelete', otherKey, {branches: 'old'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+      }
+    )
+    branchCall('branchesdelete', roKey, {branches: 'old'}).its('status').should('eq', 401)
+
+    // Nothing was changed
+    branchCall('branches', ownerKey).then((response) => {
+      expect(Object.keys(response.body.branches).sort()).to.deep.eq(['main', 'old', 'tagged'])
+    })
+  })
+
+  // Branches which can't be deleted are refused
+  it('delete (invalid)', () => {
+    for (const [branches, status, message] of [
+      ['', 400, 'No branches given'],
+      [' , ', 400, 'No branches given'],
+      ['old,missing', 400, "Unknown branch 'missing'"],
+      ['main', 409, "The default branch 'main' can't be deleted"],
+      ['tagged', 409, "You need to delete the tag 'v1' before you can delete this branch"],
+      ['old, tagged', 409, "You need to delete the tag 'v1' before you can delete these branches"]
+    ]) {
+      branchCall('branchesdelete', ownerKey, {branches: branches}).then(
+        (response) => {
+          expect(response.status).to.eq(status)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+    branchCall('branches', ownerKey).then((response) => {
+      expect(Object.keys(response.body.branches).sort()).to.deep.eq(['main', 'old', 'tagged'])
+    })
+  })
+
+  // Users with write access can delete branches
+  //   Equivalent curl command:
+  //     curl -k -F apikey="EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw" -F dbowner="default" \
+  //       -F dbname="stale branches.sqlite" -F branches="old" https://localhost:9444/v1/branchesdelete
+  it('delete', () => {
+    branchCall('branchesdelete', writerKey, {branches: 'old'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+    branchCall('branches', ownerKey).then((response) => {
+      expect(Object.keys(response.body.branches).sort()).to.deep.eq(['main', 'tagged'])
+    })
+  })
+})
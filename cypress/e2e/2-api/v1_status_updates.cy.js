@@ -0,0 +1,213 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const userKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third'
+const dbName = 'status updates.sqlite';
+
+// Events are turned into status updates by a background loop, which runs every couple of seconds
+const eventWaitTime = 5000;
+
+// Calls one of the status update API calls
+function updatesCall(call, params = {}, key = userKey) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('status updates', () => {
+  let ids = []
+
+  before(() => {
+    // Seed data, then add a public database of the first user for the default user to watch
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [{owner: 'first', name: dbName, public: true}]
+        })
+      },
+    })
+    cy.request('/x/test/switchdefault')
+    cy.request('/x/watch/first/' + encodeURIComponent(dbName))
+
+    // Start two discussions on the database as the first user, which the default user gets status updates for
+    cy.request('/x/test/switchfirst')
+    for (const title of ['Status update test 1', 'Status update test 2']) {
+      cy.request({
+        method: 'POST',
+        url: '/x/creatediscuss',
+        form: true,
+        body: {
+          username: 'first',
+          dbname: dbName,
+          title: title,
+          disctxt: 'Discussion started by the Cypress tests'
+        },
+      })
+    }
+    cy.request('/x/test/switchdefault')
+    cy.wait(eventWaitTime)
+  })
+
+  after(() => {
+    // Make sure the default user is logged in for the other tests
+    cy.request('/x/test/switchdefault')
+  })
+
+  // List the status updates, most recent first
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F unread="true" \
+  //       https://localhost:9444/v1/statusupdates
+  it('list', () => {
+    updatesCall('statusupdates', {unread: 'true'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.unread).to.eq(2)
+        expect(response.body.total).to.eq(2)
+        expect(response.body.updates.map(u => u.title)).to.deep.eq(['Status update test 2', 'Status update test 1'])
+        expect(response.body.updates[0]).to.include({database: 'first/' + dbName, read: false})
+        ids = response.body.updates.map(u => u.id)
+      }
+    )
+    updatesCall('statusupdates', {limit: '1', offset: '1'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.total).to.eq(2)
+        expect(response.body.updates.map(u => u.title)).to.deep.eq(['Status update test 1'])
+      }
+    )
+
+    // Other users have their own status updates
+    updatesCall('statusupdates', {}, otherKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.total).to.eq(0)
+      }
+    )
+  })
+
+  // Invalid paging parameters are refused
+  it('list (invalid)', () => {
+    updatesCall('statusupdates', {offset: '-1'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid offset')
+      }
+    )
+    for (const limit of ['0', '101']) {
+      updatesCall('statusupdates', {limit: limit}).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq('Invalid limit.  It needs to be between 1 and 100')
+        }
+      )
+    }
+    updatesCall('statusupdates', {unread: 'maybe'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid value for unread')
+      }
+    )
+  })
+
+  // Mark status updates as read, then unread again
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F ids="12,15" -F read="true" \
+  //       https://localhost:9444/v1/statusupdatesread
+  it('read', () => {
+    updatesCall('statusupdatesread', {ids: ids[0]}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({unread: 1})
+      }
+    )
+    updatesCall('statusupdatesread', {ids: ids.join(','), read: 'false'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({unread: 2})
+      }
+    )
+    updatesCall('statusupdatesread', {ids: '1,abc'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid status update ID')
+      }
+    )
+  })
+
+  // Users can't change the status updates of other users
+  it('read (other user)', () => {
+    updatesCall('statusupdatesread', {ids: ids.join(',')}, otherKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({unread: 0})
+      }
+    )
+    updatesCall('statusupdatesdismiss', {}, otherKey).its('status').should('eq', 200)
+    updatesCall('statusupdates', {unread: 'true'}).its('body.unread').should('eq', 2)
+  })
+
+  // Read only API keys can't change the read state
+  it('read (read only key)', () => {
+    updatesCall('statusupdatesread', {ids: ids.join(',')}, roKey).its('status').should('eq', 401)
+    updatesCall('statusupdatesdismiss', {}, roKey).its('status').should('eq', 401)
+    updatesCall('statusupdates', {}, roKey).its('body.unread').should('eq', 2)
+  })
+
+  // Dismiss all of the status updates
+  it('dismiss', () => {
+    updatesCall('statusupdatesdismiss').then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({unread: 0})
+      }
+    )
+
+    // They're still listed, but as read
+    updatesCall('statusupdates').then(
+      (response) => {
+        expect(response.body.total).to.eq(2)
+        expect(response.body.updates.every(u => u.read)).to.be.true
+      }
+    )
+  })
+
+  // The web UI does the same
+  it('web UI', () => {
+    cy.request({
+      method: 'POST',
+      url: '/x/statusupdatesread/',
+      form: true,
+      body: {
+        ids: ids[1],
+        read: 'false'
+      },
+    }).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(JSON.parse(response.body)).to.deep.eq({unread: 1})
+      }
+    )
+    cy.request('/x/statusupdates/?unread=true').then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.contain('Status update test 1')
+        expect(response.body).not.to.contain('Status update test 2')
+      }
+    )
+    cy.request({method: 'POST', url: '/x/statusupdatesdismiss/'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(JSON.parse(response.body)).to.deep.eq({unread: 0})
+      }
+    )
+  })
+})
@@ -0,0 +1,192 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'table edits.sqlite';
+const liveDB = 'table edits live.sqlite';
+
+// Calls an API call for the test database
+function apiCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName, table: 'items'}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Changes the rows of the items table
+function editRows(call, key, rows, params = {}) {
+  return apiCall(call, key, Object.assign({rows: JSON.stringify(rows)}, params))
+}
+
+// Runs a query on the test database, returning the values of the first row
+function queryRow(sql) {
+  return apiCall('query', readerKey, {sql: btoa(sql)}).then((response) => {
+    return response.body[0].map((c) => c.Value)
+  })
+}
+
+// Returns the commit messages of the default branch, newest first
+function commitMessages() {
+  return apiCall('commits', ownerKey).then((response) => {
+    return Object.values(response.body).sort((a, b) => b.timestamp.localeCompare(a.timestamp)).map((c) => c.message)
+  })
+}
+
+describe('table edits', () => {
+  before(() => {
+    // Seed data, then add a private database with ten rows which is shared read only with the first user and
+    // read-write with the second user.  Also add a live database
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: dbName},
+            {owner: 'default', name: liveDB, live: true}
+          ],
+          shares: [
+            {dbowner: 'default', dbname: dbName, user: 'first'},
+            {dbowner: 'default', dbname: dbName, user: 'second', write: true}
+          ]
+        })
+      },
+    })
+  })
+
+  // Insert rows
+  //   Equivalent curl command:
+  //     curl -k -F apikey="EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw" -F dbowner="default" \
+  //       -F dbname="table edits.sqlite" -F table="items" \
+  //       -F rows='[{"values": {"id": 11, "name": "Item 11", "value": 1.5, "added_in": 2}}]' \
+  //       -F commitmsg="Add more items" https://localhost:9444/v1/rowsinsert
+  it('insert', () => {
+    editRows('rowsinsert', writerKey, [
+      {values: {id: 11, name: 'Item 11', value: 1.5, added_in: 2}},
+      {values: {Name: 'Item 12', value: null, added_in: 2}}
+    ], {commitmsg: 'Add more items'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.commit).to.match(/^[0-9a-f]{64}$/)
+        expect(response.body.url).to.contain('/default/' + dbName + '?commit=' + response.body.commit)
+      }
+    )
+    queryRow('SELECT count(*), max(id) FROM items').should('deep.eq', ['12', '12'])
+    queryRow('SELECT name, value FROM items WHERE id = 11').should('deep.eq', ['Item 11', '1.5'])
+    commitMessages().its(0).should('eq', 'Add more items')
+  })
+
+  // Update rows, found by their primary key
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="table edits.sqlite" -F table="items" -F branch="main" \
+  //       -F rows='[{"key": {"id": 1}, "values": {"name": "Changed"}}]' https://localhost:9444/v1/rowsupdate
+  it('update', () => {
+    editRows('rowsupdate', ownerKey, [
+      {key: {id: 1}, values: {name: 'Changed'}},
+      {key: {id: 12}, values: {name: 'Also changed', added_in: 3}}
+    ], {branch: 'main'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.url).to.contain('?commit=' + response.body.commit + '&branch=main')
+      }
+    )
+    queryRow('SELECT name FROM items WHERE id = 1').should('deep.eq', ['Changed'])
+    queryRow('SELECT name, added_in FROM items WHERE id = 12').should('deep.eq', ['Also changed', '3'])
+    commitMessages().its(0).should('eq', "Updated 2 rows of table 'items'")
+  })
+
+  // Delete rows, found by their primary key
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="table edits.sqlite" -F table="items" -F rows='[{"key": {"id": 2}}]' \
+  //       https://localhost:9444/v1/rowsdelete
+  it('delete', () => {
+    editRows('rowsdelete', writerKey, [{key: {id: 2}}]).its('status').should('eq', 200)
+    queryRow('SELECT count(*) FROM items WHERE id = 2').should('deep.eq', ['0'])
+    commitMessages().then((messages) => {
+      expect(messages[0]).to.eq("Deleted 1 row from table 'items'")
+      expect(messages).to.have.lengthOf(4)
+    })
+  })
+
+  // Only users with write access can change the rows
+  it('no write access', () => {
+    for (const call of ['rowsinsert', 'rowsupdate', 'rowsdelete']) {
+      editRows(call, readerKey, [{key: {id: 3}, values: {id: 13, name: 'Test', added_in: 2}}]).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(response.body.error).to.eq('Database not found')
+        }
+      )
+      editRows(call, otherKey, [{key: {id: 3}, values: {id: 13, name: 'Test', added_in: 2}}]).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+        }
+      )
+      editRows(call, roKey, [{key: {id: 3}, values: {id: 13, name: 'Test', added_in: 2}}]).its('status').should('eq', 401)
+    }
+
+    // Archived databases can't be changed either
+    apiCall('archive', ownerKey, {archived: 'true'}).its('status').should('eq', 200)
+    editRows('rowsdelete', ownerKey, [{key: {id: 3}}]).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body.error).to.eq("This database has been archived by its owner, so it's read only")
+      }
+    )
+    apiCall('archive', ownerKey, {archived: 'false'}).its('status').should('eq', 200)
+
+    // Nothing was changed
+    queryRow('SELECT count(*), max(id) FROM items').should('deep.eq', ['11', '12'])
+    commitMessages().should('have.lengthOf', 4)
+  })
+
+  // Invalid edits are refused, without changing any of the rows
+  it('invalid', () => {
+    for (const [call, params, status, message] of [
+      ['rowsinsert', {table: ''}, 400, 'Invalid table name'],
+      ['rowsinsert', {branch: 'a'.repeat(33)}, 400, 'Invalid branch name'],
+      ['rowsinsert', {branch: 'missing'}, 404, 'Branch not found'],
+      ['rowsinsert', {table: 'missing'}, 400, "Table 'missing' not found"],
+      ['rowsinsert', {rows: ''}, 400, "The rows couldn't be read: EOF"],
+      ['rowsinsert', {rows: '{"values": {}}'}, 400, "The rows couldn't be read: json: cannot unmarshal object into Go value of type []common.TableEditRow"],
+      ['rowsinsert', {rows: '[]'}, 400, 'Between 1 and 1000 rows need to be given'],
+      ['rowsinsert', {rows: '[{"values": {"colour": "red"}}]'}, 400, "Row 1: Column 'colour' not found"],
+      ['rowsinsert', {rows: '[{"values": {"name": ["a"]}}]'}, 400, "Row 1: Invalid value for column 'name'"],
+      ['rowsupdate', {rows: '[{"values": {"name": "Test"}}]'}, 400, "Row 1: The value of primary key column 'id' is missing"],
+      ['rowsupdate', {rows: '[{"key": {"id": null}, "values": {"name": "Test"}}]'}, 400, "Row 1: Invalid value for primary key column 'id'"],
+      ['rowsupdate', {rows: '[{"key": {"id": 3}}]'}, 400, 'Row 1: No values to update were given'],
+      ['rowsdelete', {rows: '[{"key": {"id": 3}}, {"key": {"id": 99}}]'}, 400, 'Row 2: No row with that primary key was found'],
+      ['rowsdelete', {dbname: liveDB, rows: '[{"key": {"id": 3}}]'}, 400, 'That database is a live database.  Its rows are changed directly, without creating commits']
+    ]) {
+      apiCall(call, ownerKey, Object.assign({rows: '[{"values": {"name": "Test", "added_in": 2}}]'}, params)).then(
+        (response) => {
+          expect(response.status).to.eq(status)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+
+    // Constraint failures are refused too
+    editRows('rowsinsert', ownerKey, [{values: {name: 'No added_in'}}]).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.match(/^Row 1: .*NOT NULL constraint failed/)
+      }
+    )
+
+    // Nothing was changed
+    queryRow('SELECT count(*), max(id) FROM items').should('deep.eq', ['11', '12'])
+    commitMessages().should('have.lengthOf', 4)
+  })
+})
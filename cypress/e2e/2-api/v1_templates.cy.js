@@ -0,0 +1,181 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const publicDB = 'template.sqlite';
+const privateDB = 'template private.sqlite';
+const plainDB = 'template plain.sqlite';
+const liveDB = 'template live.sqlite';
+
+// Calls one of the template API calls
+function templateCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: publicDB}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Returns the number of rows in the items table of a database
+function itemCount(key, dbOwner, dbName) {
+  return templateCall('query', key, {dbowner: dbOwner, dbname: dbName, sql: btoa('SELECT count(*) FROM items')}).its('body.0.0.Value')
+}
+
+describe('templates', () => {
+  before(() => {
+    // Seed data, then add a public database, and a private database which is shared read only with the first user and
+    // read-write with the second user.  Also add a database which won't be a template, and a live database
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: publicDB, public: true},
+            {owner: 'default', name: privateDB},
+            {owner: 'default', name: plainDB, public: true},
+            {owner: 'default', name: liveDB, live: true}
+          ],
+          shares: [
+            {dbowner: 'default', dbname: privateDB, user: 'first'},
+            {dbowner: 'default', dbname: privateDB, user: 'second', write: true}
+          ]
+        })
+      },
+    })
+  })
+
+  // Mark databases as templates
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="template.sqlite" -F template="true" https://localhost:9444/v1/templateset
+  it('set', () => {
+    templateCall('templateset', ownerKey, {template: 'true'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK', template: true})
+      }
+    )
+    templateCall('templateset', ownerKey, {dbname: privateDB, template: 'true'}).its('status').should('eq', 200)
+
+    // Only public templates are listed
+    //   Equivalent curl command:
+    //     curl -k -F apikey="NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g" https://localhost:9444/v1/templates
+    templateCall('templates', otherKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        const ours = response.body.filter((t) => t.owner === 'default')
+        expect(ours).to.have.lengthOf(1)
+        expect(ours[0]).to.include({database: publicDB, owner: 'default'})
+      }
+    )
+  })
+
+  // Create new databases from the templates
+  //   Equivalent curl command:
+  //     curl -k -F apikey="NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g" -F dbowner="default" \
+  //       -F dbname="template.sqlite" -F newname="from template.sqlite" https://localhost:9444/v1/templateuse
+  it('use', () => {
+    // Without the rows of the template
+    templateCall('templateuse', otherKey, {newname: 'from template.sqlite'}).then(
+      (response) => {
+        expect(response.status).to.eq(201)
+        expect(response.body.commit).to.match(/^[0-9a-f]{64}$/)
+        expect(response.body.url).to.contain('/third/from template.sqlite?branch=main&commit=' + response.body.commit)
+      }
+    )
+    itemCount(otherKey, 'third', 'from template.sqlite').should('eq', '0')
+
+    // Users who can read a private template can use it too, and copy its rows
+    templateCall('templateuse', readerKey, {dbname: privateDB, newname: 'from template.sqlite', data: 'true'}).its('status').should('eq', 201)
+    itemCount(readerKey, 'first', 'from template.sqlite').should('eq', '10')
+
+    // The new databases are private unless asked otherwise
+    templateCall('query', writerKey, {dbowner: 'first', dbname: 'from template.sqlite', sql: btoa('SELECT 1')}).its('status').should('eq', 404)
+    templateCall('templateuse', writerKey, {newname: 'public from template.sqlite', public: 'true'}).its('status').should('eq', 201)
+    itemCount(readerKey, 'second', 'public from template.sqlite').should('eq', '0')
+  })
+
+  // Only the owner of a database can make it a template, and users need to be able to read templates to use them
+  it('no write access', () => {
+    templateCall('templateset', writerKey, {dbname: privateDB, template: 'false'}).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body.error).to.eq('Only the owner of a database can make it a template')
+      }
+    )
+    for (const [call, params] of [
+      ['templateset', {dbname: privateDB, template: 'false'}],
+      ['templateuse', {dbname: privateDB, newname: 'private from template.sqlite'}]
+    ]) {
+      templateCall(call, otherKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+        }
+      )
+      templateCall(call, roKey, params).its('status').should('eq', 401)
+    }
+
+    // Nothing was changed, so the private database is still a template
+    templateCall('templateuse', ownerKey, {dbname: privateDB, newname: 'private from template.sqlite'}).its('status').should('eq', 201)
+  })
+
+  // Invalid requests are refused
+  it('invalid', () => {
+    for (const [params, message] of [
+      [{template: 'maybe'}, 'Invalid value for template'],
+      [{template: ''}, 'Invalid value for template'],
+      [{dbname: liveDB, template: 'true'}, "Live databases, and databases encrypted before being uploaded, can't be templates"]
+    ]) {
+      templateCall('templateset', ownerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+    for (const [params, status, message] of [
+      [{newname: ''}, 400, 'Invalid database name'],
+      [{newname: 'bad/name.sqlite'}, 400, 'Invalid database name'],
+      [{newname: 'invalid.sqlite', data: 'maybe'}, 400, 'Invalid data value'],
+      [{newname: 'invalid.sqlite', public: 'maybe'}, 400, 'Invalid public value'],
+      [{dbname: plainDB, newname: 'invalid.sqlite'}, 400, "That database isn't a template"],
+      [{newname: 'from template.sqlite'}, 409, 'A database with that name already exists.  Please choose a different name.']
+    ]) {
+      templateCall('templateuse', otherKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(status)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+    templateCall('query', otherKey, {dbowner: 'third', dbname: 'invalid.sqlite', sql: btoa('SELECT 1')}).its('status').should('eq', 404)
+  })
+
+  // Stop a database being a template
+  it('unset', () => {
+    templateCall('templateset', ownerKey, {template: 'false'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK', template: false})
+      }
+    )
+    templateCall('templates', otherKey).its('body').then((list) => {
+      expect(list.filter((t) => t.owner === 'default')).to.deep.eq([])
+    })
+    templateCall('templateuse', otherKey, {newname: 'too late.sqlite'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("That database isn't a template")
+      }
+    )
+  })
+})
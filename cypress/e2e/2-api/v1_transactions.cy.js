@@ -0,0 +1,300 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const txKey = 'n7h1au7934nkvoz-5ZixRmjaz-zMb-xbzkkLtGTYJgISIYm-rkghug'; // Key created for user 'txuser'
+const txROKey = 'iSRRvm4maAOP3jrui7c_bpAekscxyW7VInIh78OO-5X-mGQPwjOyrQ'; // Read only key created for user 'txuser'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'transactions live.sqlite';
+
+// The transaction limit is for each live node.  Spread over the two live nodes of the test environment, at least six
+// of these databases are on the same node
+const limitDBs = Array.from({length: 11}, (_, i) => 'transactions limit ' + i + '.sqlite');
+
+// Calls one of the transaction API calls on the test database
+function txCall(call, params, failOnStatusCode = true) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: txKey, dbowner: 'txuser', dbname: dbName}, params),
+    failOnStatusCode: failOnStatusCode,
+  })
+}
+
+// Counts the rows of the test table, outside of any transaction
+function countRows() {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/query',
+    form: true,
+    body: {
+      apikey: txKey,
+      dbowner: 'txuser',
+      dbname: dbName,
+      sql: btoa('SELECT count(*) FROM items')
+    },
+  }).then((response) => response.body[0][0].Value)
+}
+
+describe('live transactions', () => {
+  before(() => {
+    // Seed data, then add a user with a live database for the transactions.  It's shared read only with the first
+    // user, and read-write with the second user
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          users: [{name: 'txuser'}],
+          databases: [{owner: 'txuser', name: dbName, live: true, rows: 10}].concat(
+            limitDBs.map(name => ({owner: 'txuser', name: name, live: true}))),
+          shares: [
+            {dbowner: 'txuser', dbname: dbName, user: 'first'},
+            {dbowner: 'txuser', dbname: dbName, user: 'second', write: true}
+          ],
+          api_keys: [
+            {user: 'txuser', key: txKey},
+            {user: 'txuser', key: txROKey, read_only: true}
+          ]
+        })
+      },
+    })
+  })
+
+  // Changes made in a transaction are seen by the transaction, but nowhere else until it's committed
+  //   Equivalent curl commands:
+  //     curl -k -F apikey="n7h1au7934nkvoz-5ZixRmjaz-zMb-xbzkkLtGTYJgISIYm-rkghug" -F dbowner="txuser" \
+  //       -F dbname="transactions live.sqlite" https://localhost:9444/v1/transactionbegin
+  //     curl -k -F apikey="n7h1au7934nkvoz-5ZixRmjaz-zMb-xbzkkLtGTYJgISIYm-rkghug" -F dbowner="txuser" \
+  //       -F dbname="transactions live.sqlite" -F token="TOKEN" -F sql="BASE64_SQL" \
+  //       https://localhost:9444/v1/transactionexecute
+  //     curl -k -F apikey="n7h1au7934nkvoz-5ZixRmjaz-zMb-xbzkkLtGTYJgISIYm-rkghug" -F dbowner="txuser" \
+  //       -F dbname="transactions live.sqlite" -F token="TOKEN" https://localhost:9444/v1/transactioncommit
+  it('commit', () => {
+    txCall('transactionbegin', {}).then((response) => {
+      expect(response.status).to.eq(200)
+      expect(response.body).to.include.keys(['expires', 'token'])
+      let token = response.body.token
+
+      txCall('transactionexecute', {token: token, sql: btoa("INSERT INTO items (name, added_in) VALUES ('tx 1', 0)")}).then(
+        (response) => {
+          expect(response.body).to.have.property('rows_changed', 1)
+        }
+      )
+      txCall('transactionexecute', {token: token, sql: btoa("INSERT INTO items (name, added_in) VALUES ('tx 2', 0)")})
+
+      // The transaction sees its own changes
+      txCall('transactionquery', {token: token, sql: btoa('SELECT count(*) FROM items')}).then(
+        (response) => {
+          expect(response.body[0][0]).to.have.property('Value', '12')
+        }
+      )
+
+      // Nothing else does until it's committed
+      countRows().should('eq', '10')
+      txCall('transactioncommit', {token: token}).then(
+        (response) => {
+          expect(response.body).to.have.property('status', 'OK')
+        }
+      )
+      countRows().should('eq', '12')
+    })
+  })
+
+  // Rolling back discards the changes
+  it('rollback', () => {
+    txCall('transactionbegin', {}).then((response) => {
+      let token = response.body.token
+      txCall('transactionexecute', {token: token, sql: btoa('DELETE FROM items')})
+      txCall('transactionquery', {token: token, sql: btoa('SELECT count(*) FROM items')}).then(
+        (response) => {
+          expect(response.body[0][0]).to.have.property('Value', '0')
+        }
+      )
+      txCall('transactionrollback', {token: token})
+      countRows().should('eq', '12')
+
+      // The token can't be used once the transaction has ended
+      txCall('transactioncommit', {token: token}, false).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+        }
+      )
+    })
+  })
+
+  // Statements beginning or ending transactions are refused, and leave the transaction open
+  it('transaction statements', () => {
+    txCall('transactionbegin', {}).then((response) => {
+      let token = response.body.token
+      txCall('transactionexecute', {token: token, sql: btoa("INSERT INTO items (name, added_in) VALUES ('tx 3', 0)")})
+      for (const sql of ['COMMIT', 'ROLLBACK', 'BEGIN', 'END TRANSACTION']) {
+        txCall('transactionexecute', {token: token, sql: btoa(sql)}, false).then(
+          (response) => {
+            expect(response.status).to.eq(500)
+            expect(response.body.error).to.contain('not authorized')
+          }
+        )
+      }
+
+      // The insert made before is still pending in the open transaction
+      txCall('transactionquery', {token: token, sql: btoa('SELECT count(*) FROM items')}).then(
+        (response) => {
+          expect(response.body[0][0]).to.have.property('Value', '13')
+        }
+      )
+      countRows().should('eq', '12')
+      txCall('transactionrollback', {token: token})
+    })
+  })
+
+  // Transactions not used within their timeout are rolled back
+  it('timeout', () => {
+    txCall('transactionbegin', {timeout: '1'}).then((response) => {
+      let token = response.body.token
+      txCall('transactionexecute', {token: token, sql: btoa("INSERT INTO items (name, added_in) VALUES ('tx 4', 0)")})
+      cy.wait(2500)
+      txCall('transactionquery', {token: token, sql: btoa('SELECT count(*) FROM items')}, false).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(response.body.error).to.contain('timed out')
+        }
+      )
+      countRows().should('eq', '12')
+    })
+  })
+
+  // The timeout needs to be within the allowed range
+  it('invalid timeout', () => {
+    for (const timeout of ['0', '301', 'abc']) {
+      txCall('transactionbegin', {timeout: timeout}, false).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq('The timeout needs to be between 1 and 300 seconds')
+        }
+      )
+    }
+  })
+
+  // Only one transaction can be open on a database at once, and other changes to the database are refused until it
+  // ends instead of waiting for its lock
+  it('in progress', () => {
+    txCall('transactionbegin', {}).then((response) => {
+      let token = response.body.token
+      txCall('transactionbegin', {}, false).then(
+        (response) => {
+          expect(response.status).to.eq(409)
+          expect(response.body.error).to.match(/^A transaction is in progress on this database/)
+        }
+      )
+      cy.request({
+        method: 'POST',
+        url: 'https://localhost:9444/v1/execute',
+        form: true,
+        body: {
+          apikey: txKey,
+          dbowner: 'txuser',
+          dbname: dbName,
+          sql: btoa("INSERT INTO items (name, added_in) VALUES ('tx 5', 0)")
+        },
+        failOnStatusCode: false,
+      }).then(
+        (response) => {
+          expect(response.status).to.eq(409)
+          expect(response.body.error).to.match(/^A transaction is in progress on this database/)
+        }
+      )
+
+      // Queries keep working, and don't see the changes of the transaction
+      txCall('transactionexecute', {token: token, sql: btoa("INSERT INTO items (name, added_in) VALUES ('tx 6', 0)")})
+      countRows().should('eq', '12')
+
+      // Once the transaction has ended, changes can be made again
+      txCall('transactioncommit', {token: token})
+      cy.request({
+        method: 'POST',
+        url: 'https://localhost:9444/v1/execute',
+        form: true,
+        body: {
+          apikey: txKey,
+          dbowner: 'txuser',
+          dbname: dbName,
+          sql: btoa("DELETE FROM items WHERE name = 'tx 6'")
+        },
+      }).then(
+        (response) => {
+          expect(response.body).to.have.property('rows_changed', 1)
+        }
+      )
+    })
+  })
+
+  // Each user can only have a few transactions open at once on each live node
+  it('open limit', () => {
+    let tokens = []
+    let refused = 0
+    for (const name of limitDBs) {
+      txCall('transactionbegin', {dbname: name}, false).then((response) => {
+        if (response.status === 200) {
+          tokens.push({dbname: name, token: response.body.token})
+          return
+        }
+        expect(response.status).to.eq(429)
+        expect(response.body.error).to.eq("You can't have more than 5 transactions open at once")
+        refused++
+      })
+    }
+    cy.wrap(tokens).then(() => {
+      expect(refused).to.be.greaterThan(0)
+    })
+    cy.wrap(tokens).each((tx) => {
+      txCall('transactionrollback', tx)
+    })
+  })
+
+  // Unknown tokens aren't found
+  it('unknown token', () => {
+    txCall('transactionquery', {token: 'notatoken', sql: btoa('SELECT 1')}, false).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+      }
+    )
+  })
+
+  // Only users with write access to the database can use transactions on it, and only the user who began a
+  // transaction can use its token
+  it('no write access', () => {
+    for (const call of ['transactionbegin', 'transactionexecute', 'transactionquery', 'transactioncommit', 'transactionrollback']) {
+      for (const key of [readerKey, otherKey]) {
+        txCall(call, {apikey: key, token: 'notatoken', sql: btoa('SELECT 1')}, false).then(
+          (response) => {
+            expect(response.status).to.eq(404)
+            expect(response.body.error).to.eq("Database 'txuser/" + dbName + "' doesn't exist")
+          }
+        )
+      }
+      txCall(call, {apikey: txROKey, token: 'notatoken', sql: btoa('SELECT 1')}, false).its('status').should('eq', 401)
+    }
+
+    // Users with write access can use transactions on the database
+    txCall('transactionbegin', {apikey: writerKey}).then((response) => {
+      let token = response.body.token
+      txCall('transactionexecute', {apikey: writerKey, token: token, sql: btoa("INSERT INTO items (name, added_in) VALUES ('tx 7', 0)")})
+
+      // Its token doesn't work for anyone else
+      txCall('transactioncommit', {token: token}, false).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(response.body.error).to.eq('Transaction not found.  It may have timed out and been rolled back')
+        }
+      )
+      txCall('transactionrollback', {apikey: writerKey, token: token}).its('status').should('eq', 200)
+    })
+
+    // Nothing was changed
+    countRows().should('eq', '12')
+  })
+})
@@ -0,0 +1,195 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const liveDB = 'transformations.sqlite';
+const standardDB = 'transformations standard.sqlite';
+const totalsSQL = 'SELECT added_in, count(*) AS items FROM items GROUP BY added_in';
+const bigSQL = 'SELECT added_in FROM item_totals WHERE items > 5';
+
+// Calls one of the transformation API calls
+function transformationCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: liveDB}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('transformations', () => {
+  before(() => {
+    // Seed data, then add a live database shared read-write with the second user, and a standard database
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: liveDB, live: true},
+            {owner: 'default', name: standardDB}
+          ],
+          shares: [{dbowner: 'default', dbname: liveDB, user: 'second', write: true}]
+        })
+      },
+    })
+  })
+
+  // Add a transformation, and another one which runs after it
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="transformations.sqlite" -F name="item_totals" \
+  //       -F sql="U0VMRUNUIGFkZGVkX2luLCBjb3VudCgqKSBBUyBpdGVtcyBGUk9NIGl0ZW1zIEdST1VQIEJZIGFkZGVkX2lu" \
+  //       -F interval="60" https://localhost:9444/v1/transformationsave
+  it('save', () => {
+    transformationCall('transformationsave', ownerKey, {name: 'item_totals', sql: btoa(totalsSQL), interval: '60'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+    transformationCall('transformationsave', ownerKey, {
+      name: 'big_totals',
+      sql: btoa(bigSQL),
+      dependson: 'item_totals',
+      onwrite: 'true'
+    }).its('status').should('eq', 200)
+
+    // Users with access to the database can see its transformations
+    transformationCall('transformations', writerKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.map(t => t.name)).to.deep.eq(['big_totals', 'item_totals'])
+        expect(response.body[0]).to.include({interval_minutes: 0, run_on_write: true, sql: bigSQL})
+        expect(response.body[0].depends_on).to.deep.eq(['item_totals'])
+        expect(response.body[1]).to.include({interval_minutes: 60, run_on_write: false, sql: totalsSQL})
+      }
+    )
+  })
+
+  // Only the owner of a database can change its transformations
+  it('no write access', () => {
+    for (const [call, params] of [
+      ['transformationsave', {name: 'other_totals', sql: btoa(totalsSQL)}],
+      ['transformationrun', {name: 'item_totals'}],
+      ['transformationdelete', {name: 'big_totals'}]
+    ]) {
+      transformationCall(call, writerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(403)
+          expect(response.body.error).to.eq('Only the owner of a database can change its transformations')
+        }
+      )
+      transformationCall(call, otherKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+        }
+      )
+      transformationCall(call, roKey, params).its('status').should('eq', 401)
+    }
+    transformationCall('transformations', otherKey).its('status').should('eq', 404)
+    transformationCall('transformationruns', otherKey).its('status').should('eq', 404)
+
+    // Nothing was changed
+    transformationCall('transformations', ownerKey).its('body').should('have.lengthOf', 2)
+  })
+
+  // Invalid transformations are refused, including ones whose dependencies don't work out
+  it('save (invalid)', () => {
+    for (const [params, status, message] of [
+      [{name: 'x'.repeat(64), sql: btoa(totalsSQL)}, 400, 'Invalid transformation name'],
+      [{name: 'other_totals', sql: ''}, 400, 'Invalid SQL query'],
+      [{name: 'other_totals', sql: btoa(totalsSQL), interval: '1'}, 400, 'The interval needs to be between 5 and 10080 minutes'],
+      [{name: 'other_totals', sql: btoa(totalsSQL), onwrite: 'maybe'}, 400, 'Invalid onwrite value'],
+      [{name: 'other_totals', sql: btoa(totalsSQL), dependson: 'nosuchtransformation'}, 400, "Transformation 'other_totals' depends on 'nosuchtransformation', which doesn't exist"],
+      [{name: 'Item_Totals', sql: btoa(totalsSQL)}, 409, "That name is too similar to the 'item_totals' transformation"],
+      [{name: 'items', sql: btoa(totalsSQL)}, 409, 'The database already has a table or view with that name']
+    ]) {
+      transformationCall('transformationsave', ownerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(status)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+    transformationCall('transformationsave', ownerKey, {name: 'item_totals', sql: btoa(totalsSQL), dependson: 'big_totals'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.match(/^Transformation '(item|big)_totals' depends on itself through its dependencies$/)
+      }
+    )
+
+    // Only live databases have transformations
+    transformationCall('transformationsave', ownerKey, {dbname: standardDB, name: 'item_totals', sql: btoa(totalsSQL)}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Only live databases have transformations')
+      }
+    )
+
+    // Nothing was changed
+    transformationCall('transformations', ownerKey).its('body.1').then((t) => {
+      expect(t.depends_on || []).not.to.include('big_totals')
+    })
+  })
+
+  // Ask for a transformation to be run.  The server holding the database runs it shortly afterwards
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="transformations.sqlite" -F name="item_totals" https://localhost:9444/v1/transformationrun
+  it('run', () => {
+    transformationCall('transformationrun', ownerKey, {name: 'item_totals'}).then(
+      (response) => {
+        expect(response.status).to.eq(202)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+    transformationCall('transformationrun', ownerKey).its('status').should('eq', 202)
+    transformationCall('transformationrun', ownerKey, {name: 'nosuchtransformation'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq('Transformation not found')
+      }
+    )
+    transformationCall('transformationruns', writerKey, {name: 'item_totals'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.be.an('array')
+      }
+    )
+  })
+
+  // Transformations other ones depend on can't be removed until those are
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="transformations.sqlite" -F name="big_totals" https://localhost:9444/v1/transformationdelete
+  it('delete', () => {
+    transformationCall('transformationdelete', ownerKey, {name: 'item_totals'}).then(
+      (response) => {
+        expect(response.status).to.eq(409)
+        expect(response.body.error).to.eq("The 'big_totals' transformation depends on that one")
+      }
+    )
+    transformationCall('transformationdelete', ownerKey, {name: 'big_totals'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+    transformationCall('transformationdelete', ownerKey, {name: 'big_totals'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq('Transformation not found')
+      }
+    )
+    transformationCall('transformations', ownerKey).its('body').then((body) => {
+      expect(body.map(t => t.name)).to.deep.eq(['item_totals'])
+    })
+  })
+})
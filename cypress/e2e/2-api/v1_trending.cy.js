@@ -0,0 +1,89 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const privateDB = 'trending private.sqlite';
+
+// Calls an API call
+function apiCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('trending', () => {
+  before(() => {
+    // Seed data, then add a public and a private database
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: 'trending public.sqlite', public: true},
+            {owner: 'default', name: privateDB}
+          ]
+        })
+      },
+    })
+  })
+
+  // Return the trending databases.  The scores are recalculated every hour, so which databases are trending isn't
+  // known here, but only public databases with a score are ever returned
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F limit="10" \
+  //       https://localhost:9444/v1/trending
+  it('trending', () => {
+    apiCall('trending', ownerKey, {limit: '10'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.databases).to.be.an('array')
+        expect(response.body.databases.length).to.be.at.most(10)
+        expect(response.body.total).to.be.at.least(response.body.databases.length)
+        let previous = Infinity
+        for (const db of response.body.databases) {
+          expect(db.database).not.to.eq(privateDB)
+          expect(db.score).to.be.greaterThan(0)
+          expect(db.score).to.be.at.most(previous)
+          previous = db.score
+        }
+      }
+    )
+
+    // Paging past the end returns no databases
+    apiCall('trending', ownerKey, {offset: '100000'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.databases).to.deep.eq([])
+      }
+    )
+  })
+
+  // An API key is needed
+  it('no api key', () => {
+    apiCall('trending', '').its('status').should('eq', 401)
+  })
+
+  // Invalid paging parameters are refused
+  it('invalid', () => {
+    for (const [params, message] of [
+      [{offset: '-1'}, 'Invalid offset'],
+      [{offset: 'first'}, 'Invalid offset'],
+      [{limit: '0'}, 'Invalid limit.  It needs to be between 1 and 100'],
+      [{limit: '101'}, 'Invalid limit.  It needs to be between 1 and 100'],
+      [{limit: 'all'}, 'Invalid limit.  It needs to be between 1 and 100']
+    ]) {
+      apiCall('trending', ownerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+  })
+})
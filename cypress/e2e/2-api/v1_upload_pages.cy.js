@@ -0,0 +1,209 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const dbName = 'upload pages.sqlite';
+const liveDB = 'upload pages live.sqlite';
+
+// Calls an API call for the test database
+function apiCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Uploads changed pages of the test database.  The pages are given as a binary string
+function uploadPages(key, pages, params = {}) {
+  // Manually construct a form data object, as cy.request() doesn't yet have proper support for form data
+  const z = new FormData()
+  for (const [k, v] of Object.entries(Object.assign({apikey: key, dbname: dbName}, params))) {
+    z.set(k, v)
+  }
+  z.set('pages', Cypress.Blob.binaryStringToBlob(pages))
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/uploadpages',
+    body: z,
+    failOnStatusCode: false,
+  }).then((response) => {
+    // The response body arrives as an ArrayBuffer, as the request was sent as form data
+    return {status: response.status, body: JSON.parse(Cypress.Blob.arrayBufferToBinaryString(response.body))}
+  })
+}
+
+// Returns a changed page in the format the pages are uploaded in, which is the page number as 4 bytes (big endian)
+// followed by the page data
+function pageRecord(num, data) {
+  return String.fromCharCode(num >>> 24, (num >>> 16) & 255, (num >>> 8) & 255, num & 255) + data
+}
+
+// Returns the SHA256 of a binary string, in hex
+function sha256(data) {
+  const bytes = Uint8Array.from(data, (c) => c.charCodeAt(0))
+  return cy.wrap(crypto.subtle.digest('SHA-256', bytes)).then((hash) => {
+    return Array.from(new Uint8Array(hash), (b) => b.toString(16).padStart(2, '0')).join('')
+  })
+}
+
+describe('upload changed pages', () => {
+  let headCommit = ''
+  let newCommit = ''
+  let original = ''
+  let pageSize = 0
+
+  before(() => {
+    // Seed data, then add a standard database which is shared read-write with the second user, and a live database
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: dbName},
+            {owner: 'default', name: liveDB, live: true}
+          ],
+          shares: [{dbowner: 'default', dbname: dbName, user: 'second', write: true}]
+        })
+      },
+    }).then((response) => {
+      headCommit = response.body.databases[0].commits[0]
+    })
+
+    // Retrieve the database file the changed pages are applied to.  The page size is in bytes 16 and 17 of its header
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/download',
+      form: true,
+      encoding: 'binary',
+      body: {apikey: ownerKey, dbowner: 'default', dbname: dbName},
+    }).then((response) => {
+      original = response.body
+      pageSize = (original.charCodeAt(16) << 8) | original.charCodeAt(17)
+      if (pageSize === 1) {
+        pageSize = 65536
+      }
+    })
+  })
+
+  // Upload the changed pages of a database, which are applied to the file of the commit they're based on
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbname="upload pages.sqlite" \
+  //       -F commit="COMMIT_ID" -F pages=@changed.pages -F pagesize="4096" -F size="8192" -F dbshasum="SHA256" \
+  //       -F commitmsg="Set the user version" https://localhost:9444/v1/uploadpages
+  it('upload pages', () => {
+    // Change the user version in the header of the database, which is in bytes 60 to 63 of the first page
+    const changed = original.substring(0, 60) + String.fromCharCode(0, 0, 0, 7) + original.substring(64)
+    sha256(changed).then((hash) => {
+      uploadPages(ownerKey, pageRecord(1, changed.substring(0, pageSize)), {
+        commit: headCommit,
+        commitmsg: 'Set the user version',
+        dbshasum: hash,
+        pagesize: String(pageSize),
+        size: String(changed.length)
+      }).then(
+        (response) => {
+          expect(response.status).to.eq(201)
+          expect(response.body.url).to.contain('/default/' + dbName)
+          const commit = response.body.commit
+          newCommit = commit
+
+          // The new commit holds the rebuilt database
+          apiCall('commits', ownerKey).its('body').then((commits) => {
+            expect(Object.keys(commits)).to.have.lengthOf(2)
+            expect(commits[commit]).to.include({message: 'Set the user version', parent: headCommit})
+            expect(commits[commit].tree.entries[0]).to.include({sha256: hash, size: changed.length})
+          })
+        }
+      )
+    })
+  })
+
+  // Only the owner of the database can upload changed pages for it, using an API key with write access
+  it('no write access', () => {
+    const params = {
+      commit: headCommit,
+      dbshasum: 'f'.repeat(64),
+      pagesize: String(pageSize),
+      size: String(original.length)
+    }
+
+    // Uploads are always for the databases of the API key user, so the second user's upload is for a database of
+    // their own, which doesn't exist
+    uploadPages(writerKey, pageRecord(1, original.substring(0, pageSize)), params).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq('Database not found')
+      }
+    )
+    uploadPages(roKey, pageRecord(1, original.substring(0, pageSize)), params).its('status').should('eq', 401)
+
+    // Archived databases can't be changed either
+    apiCall('archive', ownerKey, {archived: 'true'}).its('status').should('eq', 200)
+    sha256(original).then((hash) => {
+      uploadPages(ownerKey, pageRecord(1, original.substring(0, pageSize)), Object.assign({}, params,
+        {commit: newCommit, dbshasum: hash})).then(
+        (response) => {
+          expect(response.status).to.eq(403)
+          expect(response.body.error).to.eq("This database has been archived by its owner, so it's read only")
+        }
+      )
+    })
+    apiCall('archive', ownerKey, {archived: 'false'}).its('status').should('eq', 200)
+
+    // Nothing was changed
+    apiCall('commits', ownerKey).its('body').then((commits) => {
+      expect(Object.keys(commits)).to.have.lengthOf(2)
+    })
+  })
+
+  // Invalid uploads are refused
+  it('invalid', () => {
+    const page = pageRecord(1, original.substring(0, pageSize))
+    const params = {
+      commit: headCommit,
+      dbshasum: 'f'.repeat(64),
+      force: 'true',
+      pagesize: String(pageSize),
+      size: String(original.length)
+    }
+    for (const [pages, changes, message] of [
+      [page, {commit: ''}, 'The commit the changed pages are based on is needed'],
+      [page, {pagesize: '1000'}, "Invalid page size value: '1000'"],
+      [page, {pagesize: '256'}, "Invalid page size value: '256'"],
+      [page, {size: String(original.length + 1)}, "Invalid database size value: '" + (original.length + 1) + "'"],
+      [page, {size: '0'}, "Invalid database size value: '0'"],
+      [page, {dbshasum: ''}, 'The SHA256 of the new database is needed, to check it was rebuilt correctly'],
+      [page, {dbshasum: 'abc'}, 'The SHA256 of the new database is needed, to check it was rebuilt correctly'],
+      [pageRecord(9999, original.substring(0, pageSize)), {}, 'Page number 9999 is outside of the database'],
+      [pageRecord(0, original.substring(0, pageSize)), {}, 'Page number 0 is outside of the database'],
+      [page.substring(0, 100), {}, 'The page data ends part way through a page'],
+      [page, {}, "The database rebuilt from the changed pages doesn't match the given SHA256.  Please push the whole file instead"],
+      [page, {dbname: liveDB}, 'Changed pages can only be uploaded for standard databases']
+    ]) {
+      uploadPages(ownerKey, pages, Object.assign({}, params, changes)).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+    uploadPages(ownerKey, page, Object.assign({}, params, {commit: 'a'.repeat(64)})).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Commit '" + 'a'.repeat(64) + "' doesn't exist in database 'default/" + dbName + "'")
+      }
+    )
+
+    // Nothing was changed
+    apiCall('commits', ownerKey).its('body').then((commits) => {
+      expect(Object.keys(commits)).to.have.lengthOf(2)
+    })
+  })
+})
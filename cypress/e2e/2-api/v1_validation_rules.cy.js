@@ -0,0 +1,239 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'validation rules.sqlite';
+
+// Calls one of the validation rule API calls
+function ruleCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: dbName}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Adds a new commit to the test database, holding the same data as its head commit
+function uploadNewCommit(headCommit) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/download',
+    form: true,
+    encoding: 'binary',
+    body: {apikey: ownerKey, dbowner: 'default', dbname: dbName},
+  }).then((download) => {
+    // Manually construct a form data object, as cy.request() doesn't yet have proper support for form data
+    const z = new FormData()
+    z.set('apikey', ownerKey)
+    z.set('dbname', dbName)
+    z.set('commit', headCommit)
+    z.set('commitmsg', 'Checked against the validation rules')
+    z.set('file', Cypress.Blob.binaryStringToBlob(download.body))
+    return cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/upload',
+      body: z,
+      failOnStatusCode: false,
+    }).then((response) => {
+      // The response body arrives as an ArrayBuffer, as the request was sent as form data
+      response.body = JSON.parse(Cypress.Blob.arrayBufferToBinaryString(response.body))
+      return response
+    })
+  })
+}
+
+describe('validation rules', () => {
+  let firstCommit = ''
+  let checkedCommit = ''
+
+  before(() => {
+    // Seed data, then add a private database with ten rows, shared read only with the first user and read-write with
+    // the second user
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [{owner: 'default', name: dbName}],
+          shares: [
+            {dbowner: 'default', dbname: dbName, user: 'first'},
+            {dbowner: 'default', dbname: dbName, user: 'second', write: true}
+          ]
+        })
+      },
+    }).then((response) => {
+      firstCommit = response.body.databases[0].commits[0]
+    })
+  })
+
+  // Add validation rules of several types
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="validation rules.sqlite" -F name="Names are set" -F type="not_null" -F table="items" \
+  //       -F column="name" -F blocking="true" https://localhost:9444/v1/validationrulesave
+  it('save', () => {
+    ruleCall('validationrulesave', ownerKey, {name: 'Names are set', type: 'not_null', table: 'items', column: 'name', blocking: 'true'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+    ruleCall('validationrulesave', ownerKey, {name: 'Enough items', type: 'row_count', table: 'items', minrows: '5', blocking: 'true'}).its('status').should('eq', 200)
+    ruleCall('validationrulesave', ownerKey, {name: 'Few items', type: 'row_count', table: 'items', maxrows: '5'}).its('status').should('eq', 200)
+
+    // Users who can read the database can see its rules
+    //   Equivalent curl command:
+    //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+    //       -F dbname="validation rules.sqlite" https://localhost:9444/v1/validationrules
+    ruleCall('validationrules', readerKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.map(r => r.name)).to.deep.eq(['Enough items', 'Few items', 'Names are set'])
+        expect(response.body[0]).to.include({blocking: true, min_rows: 5, table: 'items', type: 'row_count'})
+        expect(response.body[0]).not.to.have.property('max_rows')
+        expect(response.body[1]).to.include({blocking: false, max_rows: 5})
+        expect(response.body[2]).to.include({blocking: true, column: 'name', table: 'items', type: 'not_null'})
+      }
+    )
+  })
+
+  // Only the owner of a database can change its validation rules
+  it('no write access', () => {
+    for (const [call, params] of [
+      ['validationrulesave', {name: 'Ids are unique', type: 'unique', table: 'items', column: 'id'}],
+      ['validationruledelete', {name: 'Few items'}]
+    ]) {
+      ruleCall(call, writerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(403)
+          expect(response.body.error).to.eq('Only the owner of a database can change its validation rules')
+        }
+      )
+      ruleCall(call, otherKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+        }
+      )
+      ruleCall(call, roKey, params).its('status').should('eq', 401)
+    }
+    ruleCall('validationrules', otherKey).its('status').should('eq', 404)
+    ruleCall('validationresults', otherKey, {commit: firstCommit}).its('status').should('eq', 404)
+
+    // Nothing was changed
+    ruleCall('validationrules', ownerKey).its('body').should('have.lengthOf', 3)
+  })
+
+  // Invalid rules are refused
+  it('save (invalid)', () => {
+    for (const [params, message] of [
+      [{name: 'x'.repeat(64), type: 'unique', table: 'items', column: 'id'}, 'Invalid validation rule name'],
+      [{name: 'Test', type: 'regex', table: 'items'}, 'The type needs to be one of: assertion, not_null, unique, row_count'],
+      [{name: 'Test', type: 'assertion'}, 'Invalid SQL query'],
+      [{name: 'Test', type: 'unique', table: 'items'}, 'Invalid column name'],
+      [{name: 'Test', type: 'unique', column: 'id'}, 'Invalid table name'],
+      [{name: 'Test', type: 'row_count', table: 'items'}, 'Row count rules need a minrows or maxrows value'],
+      [{name: 'Test', type: 'row_count', table: 'items', minrows: '-1'}, 'Invalid minrows value'],
+      [{name: 'Test', type: 'row_count', table: 'items', minrows: '10', maxrows: '5'}, "The minrows value can't be larger than the maxrows one"],
+      [{name: 'Test', type: 'unique', table: 'items', column: 'id', blocking: 'maybe'}, 'Invalid blocking value']
+    ]) {
+      ruleCall('validationrulesave', ownerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+    ruleCall('validationrules', ownerKey).its('body').should('have.lengthOf', 3)
+  })
+
+  // New commits are checked against the rules, with the outcome posted as a status of the commit
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+  //       -F dbname="validation rules.sqlite" -F commit="COMMIT_ID" https://localhost:9444/v1/validationresults
+  it('results', () => {
+    uploadNewCommit(firstCommit).then((response) => {
+      expect(response.status).to.eq(201)
+      checkedCommit = response.body.commit
+      ruleCall('validationresults', readerKey, {commit: checkedCommit}).then(
+        (response) => {
+          expect(response.status).to.eq(200)
+          expect(response.body).to.include({commit: checkedCommit, passed: false})
+          expect(response.body.rules).to.have.lengthOf(3)
+          const failed = response.body.rules.filter(r => !r.passed)
+          expect(failed).to.deep.eq([{
+            blocking: false,
+            message: "Table 'items' has 10 rows, more than the maximum of 5",
+            name: 'Few items',
+            passed: false
+          }])
+        }
+      )
+      ruleCall('commitstatuses', readerKey, {commit: checkedCommit}).then(
+        (response) => {
+          expect(response.body.find(s => s.context === 'dbhub/validation')).to.include({
+            description: '1 of 3 validation rules failed',
+            state: 'failure'
+          })
+        }
+      )
+    })
+
+    // Commits made before the rules were added haven't been checked
+    ruleCall('validationresults', readerKey, {commit: firstCommit}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("That commit hasn't been checked against validation rules")
+      }
+    )
+    ruleCall('validationresults', readerKey).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('A commit ID is needed')
+      }
+    )
+  })
+
+  // Commits failing a blocking rule aren't accepted
+  it('blocking', () => {
+    ruleCall('validationrulesave', ownerKey, {name: 'Few items', type: 'row_count', table: 'items', maxrows: '5', blocking: 'true'}).its('status').should('eq', 200)
+    uploadNewCommit(checkedCommit).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("The database failed these validation rules: 'Few items' (Table 'items' has 10 rows, more than the maximum of 5)")
+      }
+    )
+    ruleCall('commits', ownerKey).its('body').then((body) => {
+      expect(Object.keys(body)).to.have.lengthOf(2)
+    })
+  })
+
+  // Remove a rule
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="validation rules.sqlite" -F name="Few items" https://localhost:9444/v1/validationruledelete
+  it('delete', () => {
+    ruleCall('validationruledelete', ownerKey, {name: 'Few items'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK'})
+      }
+    )
+    ruleCall('validationruledelete', ownerKey, {name: 'Few items'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq('Validation rule not found')
+      }
+    )
+
+    // Without the rule, the same data is accepted
+    uploadNewCommit(checkedCommit).its('status').should('eq', 201)
+  })
+})
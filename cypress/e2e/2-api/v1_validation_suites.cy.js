@@ -0,0 +1,299 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const roKey = 'ReuYtI49nGGA6rEYaBPxS6qdK4mlYRvToucoxjw4ZDiOT9tJ6NxRXw'; // Read only key of user 'default'
+const readerKey = 'KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q'; // Key of user 'first', shared read only
+const writerKey = 'EdmNqQcJZQzIoArVCAu6bByhmVUe_Oa780avsoluO-yFixGxrQQuGw'; // Key of user 'second', shared read-write
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const dbName = 'validation suites.sqlite';
+const copyName = 'validation suites copy.sqlite';
+
+// Calls one of the validation rule API calls
+function ruleCall(call, key, params = {}, db = dbName) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key, dbowner: 'default', dbname: db}, params),
+    failOnStatusCode: false,
+  })
+}
+
+// Imports validation rules from an expectation suite or JSON Schema.  The file is left out when it's undefined
+function importRules(key, params, file, db = dbName) {
+  // Manually construct a form data object, as cy.request() doesn't yet have proper support for form data
+  const z = new FormData()
+  z.set('apikey', key)
+  z.set('dbowner', 'default')
+  z.set('dbname', db)
+  for (const [k, v] of Object.entries(params)) {
+    z.set(k, v)
+  }
+  if (file !== undefined) {
+    z.set('file', Cypress.Blob.binaryStringToBlob(file))
+  }
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/validationrulesimport',
+    body: z,
+    failOnStatusCode: false,
+  }).then((response) => {
+    // The response body arrives as an ArrayBuffer, as the request was sent as form data
+    response.body = JSON.parse(Cypress.Blob.arrayBufferToBinaryString(response.body))
+    return response
+  })
+}
+
+describe('validation rule import and export', () => {
+  let exportedSuite = ''
+
+  before(() => {
+    // Seed data, then add two private databases.  The first is shared read only with the first user and read-write
+    // with the second user
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [{owner: 'default', name: dbName}, {owner: 'default', name: copyName}],
+          shares: [
+            {dbowner: 'default', dbname: dbName, user: 'first'},
+            {dbowner: 'default', dbname: dbName, user: 'second', write: true}
+          ]
+        })
+      },
+    })
+
+    // Add a rule of each type
+    ruleCall('validationrulesave', ownerKey, {name: 'Enough items', type: 'row_count', table: 'items', minrows: '5', maxrows: '100', blocking: 'true'})
+    ruleCall('validationrulesave', ownerKey, {name: 'Ids are unique', type: 'unique', table: 'items', column: 'id'})
+    ruleCall('validationrulesave', ownerKey, {name: 'Names are set', type: 'not_null', table: 'items', column: 'name', blocking: 'true'})
+    ruleCall('validationrulesave', ownerKey, {name: 'No negative values', type: 'assertion', sql: 'SELECT * FROM items WHERE value < 0'})
+  })
+
+  // Export the rules of a table as a Great Expectations expectation suite
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+  //       -F dbname="validation suites.sqlite" -F format="greatexpectations" -F table="items" \
+  //       https://localhost:9444/v1/validationrulesexport
+  it('export as an expectation suite', () => {
+    ruleCall('validationrulesexport', readerKey, {format: 'greatexpectations', table: 'items'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body.expectation_suite_name).to.eq('items')
+
+        // Assertions can't be described by an expectation, so they're left out
+        expect(response.body.expectations).to.deep.eq([
+          {
+            expectation_type: 'expect_table_row_count_to_be_between',
+            kwargs: {max_value: 100, min_value: 5},
+            meta: {blocking: true, name: 'Enough items'}
+          },
+          {
+            expectation_type: 'expect_column_values_to_be_unique',
+            kwargs: {column: 'id'},
+            meta: {blocking: false, name: 'Ids are unique'}
+          },
+          {
+            expectation_type: 'expect_column_values_to_not_be_null',
+            kwargs: {column: 'name'},
+            meta: {blocking: true, name: 'Names are set'}
+          }
+        ])
+        exportedSuite = JSON.stringify(response.body)
+      }
+    )
+
+    // Tables without rules give an empty suite
+    ruleCall('validationrulesexport', readerKey, {format: 'greatexpectations', table: 'other'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({expectation_suite_name: 'other', expectations: []})
+      }
+    )
+  })
+
+  // Export the rules of a table as a JSON Schema
+  //   Equivalent curl command:
+  //     curl -k -F apikey="KqHOvobv-lPcwFFYhQe426JWrsejPDWcaTJt3AKDTICeZDxOVpLt6Q" -F dbowner="default" \
+  //       -F dbname="validation suites.sqlite" -F format="jsonschema" -F table="items" \
+  //       https://localhost:9444/v1/validationrulesexport
+  it('export as a JSON Schema', () => {
+    ruleCall('validationrulesexport', readerKey, {format: 'jsonschema', table: 'items'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({
+          $schema: 'https://json-schema.org/draft/2020-12/schema',
+          items: {properties: {name: {not: {type: 'null'}}}, type: 'object'},
+          maxItems: 100,
+          minItems: 5,
+          title: 'items',
+          type: 'array'
+        })
+      }
+    )
+  })
+
+  // Exporting needs read access to the database, and a known format and valid table name
+  it('export (invalid)', () => {
+    ruleCall('validationrulesexport', otherKey, {format: 'jsonschema', table: 'items'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+      }
+    )
+    for (const [params, message] of [
+      [{table: 'items'}, 'The format needs to be one of: greatexpectations, jsonschema'],
+      [{format: 'dbt', table: 'items'}, 'The format needs to be one of: greatexpectations, jsonschema'],
+      [{format: 'jsonschema'}, 'Invalid table name'],
+      [{format: 'jsonschema', table: 'a"b'}, 'Invalid table name']
+    ]) {
+      ruleCall('validationrulesexport', readerKey, params).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          expect(response.body.error).to.eq(message)
+        }
+      )
+    }
+  })
+
+  // Import an exported expectation suite into another database, which keeps the names and blocking values of the rules
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="validation suites copy.sqlite" -F format="greatexpectations" -F file=@items_suite.json \
+  //       https://localhost:9444/v1/validationrulesimport
+  it('import an expectation suite', () => {
+    importRules(ownerKey, {format: 'greatexpectations'}, exportedSuite, copyName).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({imported: ['Enough items', 'Ids are unique', 'Names are set'], skipped: []})
+      }
+    )
+    ruleCall('validationrules', ownerKey, {}, copyName).then(
+      (response) => {
+        expect(response.body.map(r => r.name)).to.deep.eq(['Enough items', 'Ids are unique', 'Names are set'])
+        expect(response.body[0]).to.include({blocking: true, max_rows: 100, min_rows: 5, table: 'items', type: 'row_count'})
+        expect(response.body[1]).to.include({blocking: false, column: 'id', type: 'unique'})
+        expect(response.body[2]).to.include({blocking: true, column: 'name', type: 'not_null'})
+      }
+    )
+
+    // Rules without a name are named after what they check.  Expectations which can't be converted are skipped
+    const suite = {
+      expectation_suite_name: 'items',
+      expectations: [
+        {expectation_type: 'expect_column_values_to_be_between', kwargs: {column: 'value', min_value: 0}},
+        {expectation_type: 'expect_column_values_to_be_in_set', kwargs: {column: 'name', value_set: ['a', 'b']}},
+        {expectation_type: 'expect_column_values_to_match_regex', kwargs: {column: 'name', regex: '^Item'}},
+        {expectation_type: 'expect_column_values_to_not_be_null', kwargs: {column: 'value', mostly: 0.9}}
+      ]
+    }
+    importRules(ownerKey, {format: 'greatexpectations', blocking: 'true'}, JSON.stringify(suite), copyName).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({
+          imported: ['items value between', 'items name in set'],
+          skipped: [
+            'Expectation 3 (expect_column_values_to_match_regex): not a supported expectation',
+            'Expectation 4 (expect_column_values_to_not_be_null): "mostly" isn\'t supported'
+          ]
+        })
+      }
+    )
+    ruleCall('validationrules', ownerKey, {}, copyName).then(
+      (response) => {
+        expect(response.body).to.have.lengthOf(5)
+        const between = response.body.find(r => r.name === 'items value between')
+        expect(between).to.include({blocking: true, type: 'assertion'})
+        expect(between.sql).to.match(/^SELECT \* FROM "items" WHERE /)
+      }
+    )
+  })
+
+  // Import a JSON Schema, with the table given in the request rather than the schema
+  //   Equivalent curl command:
+  //     curl -k -F apikey="Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" -F dbowner="default" \
+  //       -F dbname="validation suites copy.sqlite" -F format="jsonschema" -F table="items" \
+  //       -F file=@items_schema.json https://localhost:9444/v1/validationrulesimport
+  it('import a JSON Schema', () => {
+    const schema = {
+      type: 'array',
+      minItems: 1,
+      items: {
+        type: 'object',
+        properties: {
+          value: {type: ['number', 'null'], maximum: 1000},
+          added_in: {type: 'integer'}
+        }
+      }
+    }
+    importRules(ownerKey, {format: 'jsonschema', table: 'items'}, JSON.stringify(schema), copyName).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({
+          imported: ['items row count', 'items added_in not null', 'items value between'],
+          skipped: []
+        })
+      }
+    )
+    ruleCall('validationrules', ownerKey, {}, copyName).then(
+      (response) => {
+        // The existing rule with the same name was replaced
+        expect(response.body).to.have.lengthOf(7)
+        expect(response.body.find(r => r.name === 'items row count')).to.include({blocking: false, min_rows: 1, type: 'row_count'})
+        expect(response.body.find(r => r.name === 'items value between')).to.include({blocking: false})
+      }
+    )
+  })
+
+  // Only the owner of a database can import validation rules
+  it('import (no write access)', () => {
+    importRules(writerKey, {format: 'greatexpectations'}, exportedSuite).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body.error).to.eq('Only the owner of a database can change its validation rules')
+      }
+    )
+    importRules(otherKey, {format: 'greatexpectations'}, exportedSuite).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database does not exist, or user isn't authorised to access it")
+      }
+    )
+    importRules(roKey, {format: 'greatexpectations'}, exportedSuite).its('status').should('eq', 401)
+
+    // Nothing was changed
+    ruleCall('validationrules', ownerKey).its('body').should('have.lengthOf', 4)
+  })
+
+  // Invalid imports are refused
+  it('import (invalid)', () => {
+    for (const [params, file, message] of [
+      [{}, exportedSuite, 'The format needs to be one of: greatexpectations, jsonschema'],
+      [{format: 'greatexpectations', blocking: 'maybe'}, exportedSuite, 'Invalid blocking value'],
+      [{format: 'greatexpectations'}, undefined, /^Something went wrong when grabbing the file data: /],
+      [{format: 'greatexpectations'}, 'not json', /^Couldn't read the file as JSON: /],
+      [{format: 'greatexpectations'}, JSON.stringify({expectations: []}), 'Invalid table name.  Give one, or use it as the name of the expectation suite'],
+      [{format: 'jsonschema'}, JSON.stringify({type: 'object', properties: {}}), 'Invalid table name.  Give one, or put it in the "title" of the schema'],
+      [
+        {format: 'greatexpectations'},
+        JSON.stringify({expectation_suite_name: 'items', expectations: [{expectation_type: 'expect_column_values_to_be_unique', kwargs: {column: 'id'}, meta: {name: 'x'.repeat(64)}}]}),
+        "Invalid validation rule name: '" + 'x'.repeat(64) + "'"
+      ]
+    ]) {
+      importRules(ownerKey, params, file).then(
+        (response) => {
+          expect(response.status).to.eq(400)
+          if (message instanceof RegExp) {
+            expect(response.body.error).to.match(message)
+          } else {
+            expect(response.body.error).to.eq(message)
+          }
+        }
+      )
+    }
+    ruleCall('validationrules', ownerKey).its('body').should('have.lengthOf', 4)
+  })
+})
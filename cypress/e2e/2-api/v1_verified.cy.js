@@ -0,0 +1,121 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const userKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const publicDB = 'verified.sqlite';
+const privateDB = 'verified private.sqlite';
+
+// Calls one of the verification API calls
+function verifyCall(call, key, params = {}) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/' + call,
+    form: true,
+    body: Object.assign({apikey: key}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('verified databases', () => {
+  before(() => {
+    // Seed data, then add a public and a private database
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: publicDB, public: true},
+            {owner: 'default', name: privateDB}
+          ]
+        })
+      },
+    })
+  })
+
+  // Only the instance admins can verify databases, even ones the user owns
+  it('verify (not admin)', () => {
+    verifyCall('verify', userKey, {dbowner: 'default', dbname: publicDB, verified: 'true'}).then(
+      (response) => {
+        expect(response.status).to.eq(403)
+        expect(response.body.error).to.eq('Only administrators can verify databases')
+      }
+    )
+    verifyCall('verified', userKey).its('body').should('deep.eq', [])
+  })
+
+  // Verify a database
+  //   Equivalent curl command:
+  //     curl -k -F apikey="lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ" -F dbowner="default" \
+  //       -F dbname="verified.sqlite" -F verified="true" https://localhost:9444/v1/verify
+  it('verify', () => {
+    verifyCall('verify', adminKey, {dbowner: 'default', dbname: publicDB, verified: 'true'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK', verified: true})
+      }
+    )
+    verifyCall('verified', userKey).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.have.lengthOf(1)
+        expect(response.body[0]).to.include({database: publicDB, owner: 'default'})
+      }
+    )
+  })
+
+  // Private databases aren't listed, even when verified
+  it('verify (private database)', () => {
+    verifyCall('verify', adminKey, {dbowner: 'default', dbname: privateDB, verified: 'true'}).its('status').should('eq', 200)
+    verifyCall('verified', userKey).then(
+      (response) => {
+        expect(response.body.map(d => d.database)).to.deep.eq([publicDB])
+      }
+    )
+  })
+
+  // Unknown databases and invalid values are refused
+  it('verify (invalid)', () => {
+    verifyCall('verify', adminKey, {dbowner: 'default', dbname: 'no such database.sqlite', verified: 'true'}).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq('Database does not exist')
+      }
+    )
+    verifyCall('verify', adminKey, {dbowner: 'default', dbname: publicDB, verified: 'maybe'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid value for verified')
+      }
+    )
+  })
+
+  // The web UI only lets admins verify databases too
+  it('web UI (not admin)', () => {
+    cy.request('/x/test/switchdefault')
+    cy.request({
+      method: 'POST',
+      url: '/x/verifydb/',
+      form: true,
+      body: {
+        username: 'default',
+        dbname: publicDB,
+        verified: 'false'
+      },
+      failOnStatusCode: false,
+    }).its('status').should('eq', 401)
+    verifyCall('verified', userKey).its('body').should('have.lengthOf', 1)
+  })
+
+  // Remove the verification
+  it('unverify', () => {
+    verifyCall('verify', adminKey, {dbowner: 'default', dbname: publicDB, verified: 'false'}).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(response.body).to.deep.eq({status: 'OK', verified: false})
+      }
+    )
+    verifyCall('verified', userKey).its('body').should('deep.eq', [])
+  })
+})
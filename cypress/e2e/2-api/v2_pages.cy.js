@@ -0,0 +1,136 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const ownerKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const publicDB = 'pages.sqlite';
+const privateDB = 'pages private.sqlite';
+const liveDB = 'pages live.sqlite';
+
+// Requests the pages of a database commit, from the authenticated end point when an API key is given and from the
+// public one otherwise
+function pages(key, dbName, commit, headers = {}) {
+  return cy.request({
+    method: 'GET',
+    url: 'https://localhost:9444' + (key ? '/v2' : '') + '/pages/default/' + encodeURIComponent(dbName) + '/' + commit,
+    headers: Object.assign(key ? {'Authorization': 'Apikey ' + key} : {}, headers),
+    failOnStatusCode: false,
+  })
+}
+
+// Retrieves the ID of the head commit of a database
+function headCommit(dbName) {
+  return cy.request({
+    method: 'POST',
+    url: 'https://localhost:9444/v1/commits',
+    form: true,
+    body: {apikey: ownerKey, dbowner: 'default', dbname: dbName},
+  }).then((response) => {
+    return Object.keys(response.body)[0]
+  })
+}
+
+describe('database pages', () => {
+  let publicCommit = ''
+  let privateCommit = ''
+
+  before(() => {
+    // Seed data, then add a public, a private, and a live database
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: publicDB, public: true},
+            {owner: 'default', name: privateDB},
+            {owner: 'default', name: liveDB, live: true}
+          ]
+        })
+      },
+    })
+    headCommit(publicDB).then((id) => { publicCommit = id })
+    headCommit(privateDB).then((id) => { privateCommit = id })
+  })
+
+  // Public databases can be retrieved by anyone, a range of bytes at a time
+  //   Equivalent curl command:
+  //     curl -k -H "Range: bytes=0-15" https://localhost:9444/pages/default/pages.sqlite/COMMIT_ID
+  it('public database', () => {
+    pages('', publicDB, publicCommit, {'Range': 'bytes=0-15'}).then(
+      (response) => {
+        expect(response.status).to.eq(206)
+        expect(response.headers['accept-ranges']).to.eq('bytes')
+        expect(response.headers['cache-control']).to.match(/^public, /)
+        expect(response.headers['content-type']).to.eq('application/x-sqlite3')
+        expect(response.body).to.eq('SQLite format 3\0')
+      }
+    )
+    pages('', publicDB, publicCommit).then(
+      (response) => {
+        expect(response.status).to.eq(200)
+        expect(Number(response.headers['content-length'])).to.be.greaterThan(16)
+      }
+    )
+  })
+
+  // Clients can check whether their copy is still current
+  it('not modified', () => {
+    pages('', publicDB, publicCommit).then(
+      (response) => {
+        pages('', publicDB, publicCommit, {'If-None-Match': response.headers['etag']}).its('status').should('eq', 304)
+      }
+    )
+  })
+
+  // Private databases need an API key with access to them, and aren't stored by shared caches
+  //   Equivalent curl command:
+  //     curl -k -H "Authorization: Apikey Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw" \
+  //       -H "Range: bytes=0-15" "https://localhost:9444/v2/pages/default/pages%20private.sqlite/COMMIT_ID"
+  it('private database', () => {
+    pages(ownerKey, privateDB, privateCommit, {'Range': 'bytes=0-15'}).then(
+      (response) => {
+        expect(response.status).to.eq(206)
+        expect(response.headers['cache-control']).to.match(/^private, /)
+        expect(response.body).to.eq('SQLite format 3\0')
+      }
+    )
+    for (const key of ['', otherKey]) {
+      pages(key, privateDB, privateCommit).then(
+        (response) => {
+          expect(response.status).to.eq(404)
+          expect(response.body.error).to.eq("Database 'default/" + privateDB + "' doesn't exist")
+        }
+      )
+    }
+    pages(ownerKey + 'x', privateDB, privateCommit).its('status').should('eq', 401)
+  })
+
+  // Only commits of the database can be retrieved
+  it('invalid commit', () => {
+    pages(ownerKey, privateDB, 'abc').then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid commit ID')
+      }
+    )
+    pages(ownerKey, privateDB, publicCommit).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Commit '" + publicCommit + "' of database 'default/" +
+          privateDB + "' doesn't exist")
+      }
+    )
+  })
+
+  // Live databases don't have commits, so can't be retrieved this way
+  it('live database', () => {
+    pages(ownerKey, liveDB, privateCommit).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq("That database is a live database.  It can't be retrieved by pages.")
+      }
+    )
+  })
+})
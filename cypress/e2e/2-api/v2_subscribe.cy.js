@@ -0,0 +1,116 @@
+const adminKey = 'lqtRAeaKpvymTilVWgPGMhe5CNCx_aUUvHfL0kKpp1OSYvZdmdyFLQ'; // Key of user 'testadmin'
+const userKey = 'Rh3fPl6cl84XEw2FeWtj-FlUsn9OrxKz9oSJfe6kho7jT_1l5hizqw'; // Key of user 'default' added by the seed data
+const otherKey = 'NvPG_Vh8uxK4BqkN7yJiRA4HP2HxCC0XXw0TBQGXbsaSlVhXZDrb1g'; // Key of user 'third', no access
+const liveDB = 'subscribe live.sqlite';
+const standardDB = 'subscribe.sqlite';
+
+// Requests a subscription, without upgrading the connection to a WebSocket.  That means the request gets as far as
+// the WebSocket handshake at most, which is enough to check the validation and permissions
+function subscribe(key, params = {}) {
+  return cy.request({
+    method: 'GET',
+    url: 'https://localhost:9444/v2/subscribe',
+    headers: key ? {'Authorization': 'Apikey ' + key} : {},
+    qs: Object.assign({dbowner: 'default', dbname: liveDB, sql: 'SELECT count(*) FROM items'}, params),
+    failOnStatusCode: false,
+  })
+}
+
+describe('live query subscriptions', () => {
+  before(() => {
+    // Seed data, then add a private live database and a private standard one
+    cy.request('/x/test/seed')
+    cy.request({
+      method: 'POST',
+      url: 'https://localhost:9444/v1/testfixtures',
+      form: true,
+      body: {
+        apikey: adminKey,
+        fixtures: JSON.stringify({
+          databases: [
+            {owner: 'default', name: liveDB, live: true},
+            {owner: 'default', name: standardDB}
+          ]
+        })
+      },
+    })
+  })
+
+  after(() => {
+    // Make sure the default user is logged in for the other tests
+    cy.request('/x/test/switchdefault')
+  })
+
+  // Requests for a live database the user can read get through to the WebSocket handshake, which refuses plain
+  // HTTP requests
+  it('subscribe', () => {
+    subscribe(userKey).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body).to.eq('not websocket protocol')
+      }
+    )
+  })
+
+  // Subscriptions using the session cookie of the web UI need to come from the web UI, so other sites can't open
+  // them for logged in users
+  it('subscribe (other site)', () => {
+    cy.request('/x/test/switchdefault')
+    cy.request({
+      method: 'GET',
+      url: 'https://localhost:9444/v2/subscribe',
+      headers: {
+        'Connection': 'Upgrade',
+        'Origin': 'https://example.org',
+        'Sec-WebSocket-Key': 'dGhlIHNhbXBsZSBub25jZQ==',
+        'Sec-WebSocket-Version': '13',
+        'Upgrade': 'websocket'
+      },
+      qs: {dbowner: 'default', dbname: liveDB, sql: 'SELECT count(*) FROM items'},
+      failOnStatusCode: false,
+    }).its('status').should('eq', 403)
+  })
+
+  // An API key or a session cookie is needed
+  it('subscribe (no API key)', () => {
+    cy.clearCookies()
+    subscribe('').its('status').should('eq', 401)
+    subscribe(userKey + 'x').its('status').should('eq', 401)
+  })
+
+  // Users without access to the database don't get told it exists
+  it('subscribe (no access)', () => {
+    subscribe(otherKey).then(
+      (response) => {
+        expect(response.status).to.eq(404)
+        expect(response.body.error).to.eq("Database 'default/" + liveDB + "' doesn't exist")
+      }
+    )
+  })
+
+  // Only live databases can be subscribed to
+  it('subscribe (standard database)', () => {
+    subscribe(userKey, {dbname: standardDB}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Subscriptions are only available for live databases')
+      }
+    )
+  })
+
+  // Invalid requests are refused before anything else is checked
+  it('subscribe (invalid)', () => {
+    subscribe(userKey, {dbname: 'bad/name.sqlite'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Invalid database owner or name')
+      }
+    )
+    subscribe(userKey, {format: 'csv'}).then(
+      (response) => {
+        expect(response.status).to.eq(400)
+        expect(response.body.error).to.eq('Unknown output format requested')
+      }
+    )
+  })
+})
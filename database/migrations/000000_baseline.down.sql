@@ -0,0 +1,24 @@
+BEGIN;
+
+DROP TABLE IF EXISTS public.watchers CASCADE;
+DROP TABLE IF EXISTS public.vis_query_runs CASCADE;
+DROP TABLE IF EXISTS public.vis_params CASCADE;
+DROP TABLE IF EXISTS public.sql_terminal_history CASCADE;
+DROP TABLE IF EXISTS public.events CASCADE;
+DROP TABLE IF EXISTS public.email_queue CASCADE;
+DROP TABLE IF EXISTS public.discussion_comments CASCADE;
+DROP TABLE IF EXISTS public.discussions CASCADE;
+DROP TABLE IF EXISTS public.db4s_connects CASCADE;
+DROP TABLE IF EXISTS public.database_uploads CASCADE;
+DROP TABLE IF EXISTS public.database_stars CASCADE;
+DROP TABLE IF EXISTS public.database_shares CASCADE;
+DROP TABLE IF EXISTS public.database_licences CASCADE;
+DROP TABLE IF EXISTS public.database_downloads CASCADE;
+DROP TABLE IF EXISTS public.api_keys CASCADE;
+DROP TABLE IF EXISTS public.api_call_log CASCADE;
+DROP TABLE IF EXISTS public.sqlite_databases CASCADE;
+DROP TABLE IF EXISTS public.users CASCADE;
+DROP TYPE IF EXISTS public.permissions;
+DROP EXTENSION IF EXISTS jsquery;
+
+COMMIT;
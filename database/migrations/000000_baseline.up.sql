@@ -1,22 +1,7 @@
--- noinspection SqlNoDataSourceInspectionForFile
+BEGIN;
 
---
--- PostgreSQL database dump
---
-
--- Dumped from database version 15.2
--- Dumped by pg_dump version 15.2
-
-SET statement_timeout = 0;
-SET lock_timeout = 0;
-SET idle_in_transaction_session_timeout = 0;
-SET client_encoding = 'UTF8';
-SET standard_conforming_strings = on;
-SELECT pg_catalog.set_config('search_path', '', false);
-SET check_function_bodies = false;
-SET xmloption = content;
-SET client_min_messages = warning;
-SET row_security = off;
+-- The schema the later migrations build on, from before migrations were used.  Databases which already had this schema
+-- loaded are marked as having this migration applied when the daemons first start, rather than running it
 
 --
 -- Name: jsquery; Type: EXTENSION; Schema: -; Owner: -
@@ -42,9 +27,6 @@ CREATE TYPE public.permissions AS ENUM (
 );
 
 
-SET default_tablespace = '';
-
-SET default_table_access_method = heap;
 
 --
 -- Name: api_call_log; Type: TABLE; Schema: public; Owner: -
@@ -1211,8 +1193,4 @@ ALTER TABLE ONLY public.watchers
 ALTER TABLE ONLY public.watchers
     ADD CONSTRAINT watchers_user_id_fkey FOREIGN KEY (user_id) REFERENCES public.users(user_id) ON UPDATE CASCADE ON DELETE CASCADE;
 
-
---
--- PostgreSQL database dump complete
---
-
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE vis_params DROP COLUMN public;
+
+COMMIT;
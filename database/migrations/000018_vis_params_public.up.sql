@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE vis_params ADD COLUMN public boolean DEFAULT false NOT NULL;
+
+COMMIT;
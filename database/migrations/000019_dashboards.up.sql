@@ -0,0 +1,23 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS dashboards
+(
+    dashboard_id  bigserial
+        CONSTRAINT dashboards_pk
+            PRIMARY KEY,
+    user_id       bigint                                 NOT NULL
+        CONSTRAINT dashboards_users_user_id_fk
+            REFERENCES users
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    name          text                                   NOT NULL,
+    description   text,
+    public        boolean                  DEFAULT false NOT NULL,
+    date_created  timestamp with time zone DEFAULT now() NOT NULL,
+    last_modified timestamp with time zone DEFAULT now() NOT NULL,
+    widgets       jsonb                    DEFAULT '[]'  NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS dashboards_user_id_name_uindex
+    ON dashboards (user_id, name);
+
+COMMIT;
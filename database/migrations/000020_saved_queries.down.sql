@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS saved_query_versions;
+DROP TABLE IF EXISTS saved_queries;
+
+COMMIT;
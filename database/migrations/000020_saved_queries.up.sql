@@ -0,0 +1,43 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS saved_queries
+(
+    query_id      bigserial
+        CONSTRAINT saved_queries_pk
+            PRIMARY KEY,
+    db_id         bigint                                 NOT NULL
+        CONSTRAINT saved_queries_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    user_id       bigint                                 NOT NULL
+        CONSTRAINT saved_queries_users_user_id_fk
+            REFERENCES users
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    name          text                                   NOT NULL,
+    description   text,
+    shared        boolean                  DEFAULT false NOT NULL,
+    date_created  timestamp with time zone DEFAULT now() NOT NULL,
+    last_modified timestamp with time zone DEFAULT now() NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS saved_queries_db_id_name_uindex
+    ON saved_queries (db_id, name);
+
+CREATE TABLE IF NOT EXISTS saved_query_versions
+(
+    query_id     bigint                                 NOT NULL
+        CONSTRAINT saved_query_versions_saved_queries_query_id_fk
+            REFERENCES saved_queries
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    version      integer                                NOT NULL,
+    sql_stmt     text                                   NOT NULL,
+    user_id      bigint
+        CONSTRAINT saved_query_versions_users_user_id_fk
+            REFERENCES users
+            ON UPDATE CASCADE ON DELETE SET NULL,
+    date_created timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT saved_query_versions_pk
+        PRIMARY KEY (query_id, version)
+);
+
+COMMIT;
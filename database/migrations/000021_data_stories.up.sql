@@ -0,0 +1,25 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS data_stories
+(
+    story_id      bigserial
+        CONSTRAINT data_stories_pk
+            PRIMARY KEY,
+    db_id         bigint                                 NOT NULL
+        CONSTRAINT data_stories_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    user_id       bigint
+        CONSTRAINT data_stories_users_user_id_fk
+            REFERENCES users
+            ON UPDATE CASCADE ON DELETE SET NULL,
+    name          text                                   NOT NULL,
+    body          text                                   NOT NULL,
+    date_created  timestamp with time zone DEFAULT now() NOT NULL,
+    last_modified timestamp with time zone DEFAULT now() NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS data_stories_db_id_name_uindex
+    ON data_stories (db_id, name);
+
+COMMIT;
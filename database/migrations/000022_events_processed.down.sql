@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP INDEX IF EXISTS events_db_id_index;
+DROP INDEX IF EXISTS events_processed_index;
+DELETE FROM events WHERE processed = true;
+ALTER TABLE events DROP COLUMN IF EXISTS processed;
+
+COMMIT;
@@ -0,0 +1,11 @@
+BEGIN;
+
+ALTER TABLE events ADD COLUMN IF NOT EXISTS processed boolean DEFAULT false NOT NULL;
+
+CREATE INDEX IF NOT EXISTS events_processed_index
+    ON events (processed);
+
+CREATE INDEX IF NOT EXISTS events_db_id_index
+    ON events (db_id);
+
+COMMIT;
@@ -0,0 +1,30 @@
+BEGIN;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status_updates jsonb;
+
+-- Move the unread status updates back into the JSON lists on the users table
+UPDATE users
+SET status_updates = lists.updates
+FROM (
+    SELECT grouped.user_id, jsonb_object_agg(grouped.db_path, grouped.entries) AS updates
+    FROM (
+        SELECT s.user_id, owner.user_name || '/' || db.db_name AS db_path,
+            jsonb_agg(jsonb_build_object(
+                'discussion_id', s.discussion_id,
+                'timestamp', s.date_created,
+                'title', s.title,
+                'event_type', s.event_type,
+                'event_url', s.event_url) ORDER BY s.update_id) AS entries
+        FROM status_updates AS s
+            JOIN sqlite_databases AS db ON db.db_id = s.db_id
+            JOIN users AS owner ON owner.user_id = db.user_id
+        WHERE s.is_read = false
+        GROUP BY s.user_id, owner.user_name, db.db_name
+    ) AS grouped
+    GROUP BY grouped.user_id
+) AS lists
+WHERE users.user_id = lists.user_id;
+
+DROP TABLE IF EXISTS status_updates;
+
+COMMIT;
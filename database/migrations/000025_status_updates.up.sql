@@ -0,0 +1,46 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS status_updates
+(
+    update_id     bigserial
+        CONSTRAINT status_updates_pk
+            PRIMARY KEY,
+    user_id       bigint                                 NOT NULL
+        CONSTRAINT status_updates_users_user_id_fk
+            REFERENCES users
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    db_id         bigint                                 NOT NULL
+        CONSTRAINT status_updates_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    discussion_id integer                  DEFAULT 0     NOT NULL,
+    event_type    integer                  DEFAULT 0     NOT NULL,
+    title         text                     DEFAULT ''    NOT NULL,
+    event_url     text                     DEFAULT ''    NOT NULL,
+    is_read       boolean                  DEFAULT false NOT NULL,
+    date_created  timestamp with time zone DEFAULT now() NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS status_updates_user_id_is_read_index
+    ON status_updates (user_id, is_read);
+
+-- Move the existing status updates out of the JSON lists on the users table.  Those lists are keyed by "owner/name"
+INSERT INTO status_updates (user_id, db_id, discussion_id, event_type, title, event_url, date_created)
+SELECT u.user_id, db.db_id,
+    coalesce((e.entry->>'discussion_id')::integer, 0),
+    coalesce((e.entry->>'event_type')::integer, 0),
+    coalesce(e.entry->>'title', ''),
+    coalesce(e.entry->>'event_url', ''),
+    coalesce((e.entry->>'timestamp')::timestamp with time zone, 'epoch')
+FROM users AS u
+    CROSS JOIN LATERAL jsonb_each(u.status_updates) AS d(db_path, entries)
+    CROSS JOIN LATERAL jsonb_array_elements(d.entries) AS e(entry)
+    JOIN users AS owner ON owner.user_name = split_part(d.db_path, '/', 1)
+    JOIN sqlite_databases AS db ON db.user_id = owner.user_id
+        AND db.db_name = substr(d.db_path, length(split_part(d.db_path, '/', 1)) + 2)
+WHERE jsonb_typeof(u.status_updates) = 'object'
+    AND jsonb_typeof(d.entries) = 'array';
+
+ALTER TABLE users DROP COLUMN IF EXISTS status_updates;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE watchers DROP CONSTRAINT IF EXISTS watchers_watch_mode_check;
+ALTER TABLE watchers DROP COLUMN IF EXISTS watch_mode;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE watchers ADD COLUMN IF NOT EXISTS watch_mode text DEFAULT 'all'::text NOT NULL;
+ALTER TABLE watchers ADD CONSTRAINT watchers_watch_mode_check CHECK (watch_mode IN ('all', 'releases', 'participating'));
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP INDEX IF EXISTS discussions_assignee_index;
+ALTER TABLE discussions DROP COLUMN IF EXISTS assignee;
+
+COMMIT;
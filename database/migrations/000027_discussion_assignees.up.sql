@@ -0,0 +1,11 @@
+BEGIN;
+
+ALTER TABLE discussions ADD COLUMN IF NOT EXISTS assignee bigint
+    CONSTRAINT discussions_users_assignee_fk
+        REFERENCES users (user_id)
+        ON UPDATE CASCADE ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS discussions_assignee_index
+    ON discussions (assignee);
+
+COMMIT;
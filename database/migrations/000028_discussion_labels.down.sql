@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP INDEX IF EXISTS discussions_milestone_id_index;
+ALTER TABLE discussions DROP COLUMN IF EXISTS milestone_id;
+DROP TABLE IF EXISTS discussion_labels;
+DROP TABLE IF EXISTS milestones;
+DROP TABLE IF EXISTS labels;
+
+COMMIT;
@@ -0,0 +1,61 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS labels (
+    label_id bigserial
+        CONSTRAINT labels_pk
+            PRIMARY KEY,
+    db_id bigint
+        CONSTRAINT labels_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases (db_id)
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    name text NOT NULL,
+    colour text NOT NULL DEFAULT '#6c757d',
+    description text NOT NULL DEFAULT ''
+);
+
+-- Labels without a database are the defaults, which are available on every database
+CREATE UNIQUE INDEX IF NOT EXISTS labels_db_id_name_uindex
+    ON labels (coalesce(db_id, 0), lower(name));
+
+CREATE TABLE IF NOT EXISTS milestones (
+    milestone_id bigserial
+        CONSTRAINT milestones_pk
+            PRIMARY KEY,
+    db_id bigint NOT NULL
+        CONSTRAINT milestones_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases (db_id)
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    title text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    due_date timestamp with time zone,
+    open boolean NOT NULL DEFAULT true
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS milestones_db_id_title_uindex
+    ON milestones (db_id, lower(title));
+
+CREATE TABLE IF NOT EXISTS discussion_labels (
+    internal_id bigint NOT NULL
+        CONSTRAINT discussion_labels_discussions_internal_id_fk
+            REFERENCES discussions (internal_id)
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    label_id bigint NOT NULL
+        CONSTRAINT discussion_labels_labels_label_id_fk
+            REFERENCES labels (label_id)
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT discussion_labels_pk
+        PRIMARY KEY (internal_id, label_id)
+);
+
+CREATE INDEX IF NOT EXISTS discussion_labels_label_id_index
+    ON discussion_labels (label_id);
+
+ALTER TABLE discussions ADD COLUMN IF NOT EXISTS milestone_id bigint
+    CONSTRAINT discussions_milestones_milestone_id_fk
+        REFERENCES milestones (milestone_id)
+        ON UPDATE CASCADE ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS discussions_milestone_id_index
+    ON discussions (milestone_id);
+
+COMMIT;
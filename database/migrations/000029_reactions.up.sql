@@ -0,0 +1,23 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS reactions (
+    com_id bigint NOT NULL
+        CONSTRAINT reactions_discussion_comments_com_id_fk
+            REFERENCES discussion_comments (com_id)
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    user_id bigint NOT NULL
+        CONSTRAINT reactions_users_user_id_fk
+            REFERENCES users (user_id)
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    reaction text NOT NULL
+        CONSTRAINT reactions_reaction_check
+            CHECK (reaction IN ('+1', '-1', 'laugh', 'hooray', 'confused', 'heart', 'rocket', 'eyes')),
+    date_created timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT reactions_pk
+        PRIMARY KEY (com_id, user_id, reaction)
+);
+
+CREATE INDEX IF NOT EXISTS reactions_user_id_index
+    ON reactions (user_id);
+
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN;
+
+DROP INDEX IF EXISTS sqlite_databases_verified_index;
+ALTER TABLE sqlite_databases DROP COLUMN IF EXISTS date_verified;
+ALTER TABLE sqlite_databases DROP COLUMN IF EXISTS verified_by;
+ALTER TABLE sqlite_databases DROP COLUMN IF EXISTS verified;
+
+COMMIT;
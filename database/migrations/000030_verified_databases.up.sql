@@ -0,0 +1,14 @@
+BEGIN;
+
+ALTER TABLE sqlite_databases ADD COLUMN IF NOT EXISTS verified boolean DEFAULT false NOT NULL;
+ALTER TABLE sqlite_databases ADD COLUMN IF NOT EXISTS verified_by bigint
+    CONSTRAINT sqlite_databases_users_verified_by_fk
+        REFERENCES users (user_id)
+        ON UPDATE CASCADE ON DELETE SET NULL;
+ALTER TABLE sqlite_databases ADD COLUMN IF NOT EXISTS date_verified timestamp with time zone;
+
+CREATE INDEX IF NOT EXISTS sqlite_databases_verified_index
+    ON sqlite_databases (db_id)
+    WHERE verified = true;
+
+COMMIT;
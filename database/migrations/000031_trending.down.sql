@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP INDEX IF EXISTS database_downloads_download_date_index;
+DROP TABLE IF EXISTS trending;
+
+COMMIT;
@@ -0,0 +1,25 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS trending (
+    db_id bigint NOT NULL
+        CONSTRAINT trending_pk
+            PRIMARY KEY
+        CONSTRAINT trending_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases (db_id)
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    score double precision DEFAULT 0 NOT NULL,
+    views_score double precision DEFAULT 0 NOT NULL,
+    stars_score double precision DEFAULT 0 NOT NULL,
+    forks_score double precision DEFAULT 0 NOT NULL,
+    downloads_score double precision DEFAULT 0 NOT NULL,
+    last_page_views bigint DEFAULT 0 NOT NULL,
+    date_updated timestamp with time zone DEFAULT now() NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS trending_score_index
+    ON trending (score DESC);
+
+CREATE INDEX IF NOT EXISTS database_downloads_download_date_index
+    ON database_downloads (download_date);
+
+COMMIT;
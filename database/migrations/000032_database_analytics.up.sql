@@ -0,0 +1,17 @@
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS database_analytics (
+    db_id bigint NOT NULL
+        CONSTRAINT database_analytics_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases (db_id)
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    day date NOT NULL,
+    downloads integer DEFAULT 0 NOT NULL,
+    clones integer DEFAULT 0 NOT NULL,
+    views integer DEFAULT 0 NOT NULL,
+    api_queries integer DEFAULT 0 NOT NULL,
+    CONSTRAINT database_analytics_pk
+        PRIMARY KEY (db_id, day)
+);
+
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN;
+
+ALTER TABLE database_downloads
+    DROP COLUMN IF EXISTS client,
+    DROP COLUMN IF EXISTS country,
+    DROP COLUMN IF EXISTS referrer;
+
+COMMIT;
@@ -0,0 +1,16 @@
+BEGIN;
+
+ALTER TABLE database_downloads
+    ADD COLUMN IF NOT EXISTS client text,
+    ADD COLUMN IF NOT EXISTS country text,
+    ADD COLUMN IF NOT EXISTS referrer text;
+
+-- Work out the client type of the existing downloads from the server software and user agent
+UPDATE database_downloads
+SET client = CASE
+        WHEN server_sw = 'db4s' AND lower(user_agent) LIKE 'dio%' THEN 'cli'
+        ELSE server_sw
+    END
+WHERE client IS NULL;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+-- The origins browsers may use an API key from.  NULL allows all origins
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS allowed_origins text[];
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+ALTER TABLE sqlite_databases
+    DROP COLUMN IF EXISTS latest_commit_id,
+    DROP COLUMN IF EXISTS latest_last_modified,
+    DROP COLUMN IF EXISTS latest_licence,
+    DROP COLUMN IF EXISTS latest_sha256,
+    DROP COLUMN IF EXISTS latest_size;
+
+COMMIT;
@@ -0,0 +1,25 @@
+BEGIN;
+
+-- Details of the latest commit (the head of the default branch) of each standard database, copied out of the
+-- commit_list and branch_heads fields so database listings don't need to dig through them.  latest_licence holds the
+-- SHA256 of the licence
+ALTER TABLE sqlite_databases
+    ADD COLUMN IF NOT EXISTS latest_commit_id text,
+    ADD COLUMN IF NOT EXISTS latest_last_modified timestamp with time zone,
+    ADD COLUMN IF NOT EXISTS latest_licence text,
+    ADD COLUMN IF NOT EXISTS latest_sha256 text,
+    ADD COLUMN IF NOT EXISTS latest_size bigint;
+
+-- Fill them in for the existing databases
+UPDATE sqlite_databases AS db
+SET (latest_commit_id, latest_last_modified, latest_licence, latest_sha256, latest_size) = (
+        SELECT head.id, (head.entry->>'last_modified')::timestamptz, head.entry->>'licence', head.entry->>'sha256',
+            (head.entry->>'size')::bigint
+        FROM (
+            SELECT db.branch_heads->db.default_branch->>'commit' AS id,
+                db.commit_list->(db.branch_heads->db.default_branch->>'commit')->'tree'->'entries'->0 AS entry
+        ) AS head
+    )
+WHERE db.live_db = false;
+
+COMMIT;
@@ -0,0 +1,43 @@
+BEGIN;
+
+ALTER TABLE sqlite_databases ADD COLUMN IF NOT EXISTS commit_list jsonb;
+
+-- Put the commits back into the commit_list field
+UPDATE sqlite_databases AS db
+SET commit_list = (
+        SELECT jsonb_object_agg(c.commit_id, jsonb_build_object(
+            'author_email', c.author_email,
+            'author_name', c.author_name,
+            'committer_email', c.committer_email,
+            'committer_name', c.committer_name,
+            'id', c.commit_id,
+            'message', c.message,
+            'other_parents', (
+                SELECT jsonb_agg(p.parent_id ORDER BY p.position)
+                FROM commit_parents AS p
+                WHERE p.db_id = c.db_id
+                    AND p.commit_id = c.commit_id
+                    AND p.position > 0
+            ),
+            'parent', coalesce((
+                SELECT p.parent_id
+                FROM commit_parents AS p
+                WHERE p.db_id = c.db_id
+                    AND p.commit_id = c.commit_id
+                    AND p.position = 0
+            ), ''),
+            'timestamp', c.commit_timestamp,
+            'tree', c.tree))
+        FROM commits AS c
+        WHERE c.db_id = db.db_id
+    )
+WHERE EXISTS (
+        SELECT 1
+        FROM commits AS c
+        WHERE c.db_id = db.db_id
+    );
+
+DROP TABLE IF EXISTS commit_parents;
+DROP TABLE IF EXISTS commits;
+
+COMMIT;
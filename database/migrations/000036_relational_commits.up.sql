@@ -0,0 +1,64 @@
+BEGIN;
+
+-- The commits of each standard database.  These used to be kept in the commit_list field of sqlite_databases, which
+-- had to be rewritten in full each time a commit was added
+CREATE TABLE IF NOT EXISTS commits (
+    db_id bigint NOT NULL
+        CONSTRAINT commits_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases (db_id)
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    commit_id text NOT NULL,
+    author_name text DEFAULT '' NOT NULL,
+    author_email text DEFAULT '' NOT NULL,
+    committer_name text DEFAULT '' NOT NULL,
+    committer_email text DEFAULT '' NOT NULL,
+    message text DEFAULT '' NOT NULL,
+    commit_timestamp timestamp with time zone NOT NULL,
+    tree jsonb NOT NULL,
+    CONSTRAINT commits_pk
+        PRIMARY KEY (db_id, commit_id)
+);
+
+-- The parents of each commit.  Position 0 holds the commit's parent, and positions 1 onwards hold the other parents
+-- of merge commits, in order
+CREATE TABLE IF NOT EXISTS commit_parents (
+    db_id bigint NOT NULL,
+    commit_id text NOT NULL,
+    position integer NOT NULL,
+    parent_id text NOT NULL,
+    CONSTRAINT commit_parents_pk
+        PRIMARY KEY (db_id, commit_id, position),
+    CONSTRAINT commit_parents_commits_fk
+        FOREIGN KEY (db_id, commit_id)
+            REFERENCES commits (db_id, commit_id)
+            ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+-- Move the existing commits across
+INSERT INTO commits (db_id, commit_id, author_name, author_email, committer_name, committer_email, message,
+    commit_timestamp, tree)
+SELECT db.db_id, c.key, coalesce(c.value->>'author_name', ''), coalesce(c.value->>'author_email', ''),
+    coalesce(c.value->>'committer_name', ''), coalesce(c.value->>'committer_email', ''),
+    coalesce(c.value->>'message', ''), (c.value->>'timestamp')::timestamptz, coalesce(c.value->'tree', '{}')
+FROM sqlite_databases AS db,
+    jsonb_each(CASE WHEN jsonb_typeof(db.commit_list) = 'object' THEN db.commit_list ELSE '{}' END) AS c
+ON CONFLICT DO NOTHING;
+
+INSERT INTO commit_parents (db_id, commit_id, position, parent_id)
+SELECT db.db_id, c.key, 0, c.value->>'parent'
+FROM sqlite_databases AS db,
+    jsonb_each(CASE WHEN jsonb_typeof(db.commit_list) = 'object' THEN db.commit_list ELSE '{}' END) AS c
+WHERE coalesce(c.value->>'parent', '') <> ''
+ON CONFLICT DO NOTHING;
+
+INSERT INTO commit_parents (db_id, commit_id, position, parent_id)
+SELECT db.db_id, c.key, p.position, p.parent_id
+FROM sqlite_databases AS db,
+    jsonb_each(CASE WHEN jsonb_typeof(db.commit_list) = 'object' THEN db.commit_list ELSE '{}' END) AS c,
+    jsonb_array_elements_text(CASE WHEN jsonb_typeof(c.value->'other_parents') = 'array'
+        THEN c.value->'other_parents' ELSE '[]' END) WITH ORDINALITY AS p(parent_id, position)
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE sqlite_databases DROP COLUMN IF EXISTS commit_list;
+
+COMMIT;
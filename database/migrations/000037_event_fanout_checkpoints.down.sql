@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP INDEX IF EXISTS status_updates_user_id_db_id_discussion_id_index;
+ALTER TABLE events DROP COLUMN IF EXISTS fanout_user_id;
+
+COMMIT;
@@ -0,0 +1,11 @@
+BEGIN;
+
+-- Events are fanned out to their users in batches, ordered by user ID.  This holds the ID of the last user the event
+-- has been fanned out to, so processing can pick up where it left off if it fails part way through
+ALTER TABLE events ADD COLUMN IF NOT EXISTS fanout_user_id bigint DEFAULT 0 NOT NULL;
+
+-- Used for replacing the older status updates about a discussion when a new one is added
+CREATE INDEX IF NOT EXISTS status_updates_user_id_db_id_discussion_id_index
+    ON status_updates (user_id, db_id, discussion_id);
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE users DROP COLUMN IF EXISTS encryption_key_id;
+ALTER TABLE users DROP COLUMN IF EXISTS encryption_key;
+
+COMMIT;
@@ -0,0 +1,8 @@
+BEGIN;
+
+-- The key used for encrypting the database files of each user, when per user encryption keys are enabled.  It's stored
+-- encrypted with the instance key named in encryption_key_id
+ALTER TABLE users ADD COLUMN IF NOT EXISTS encryption_key bytea;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS encryption_key_id text;
+
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE sqlite_databases DROP COLUMN IF EXISTS client_encrypted;
+
+COMMIT;
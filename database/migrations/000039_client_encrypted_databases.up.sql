@@ -0,0 +1,7 @@
+BEGIN;
+
+-- Databases uploaded already encrypted by their owner.  The key isn't given to the server, so the files are stored and
+-- returned as is, and features needing the contents of the database aren't available for them
+ALTER TABLE sqlite_databases ADD COLUMN IF NOT EXISTS client_encrypted boolean DEFAULT false NOT NULL;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP INDEX IF EXISTS commits_author_email_idx;
+ALTER TABLE users DROP COLUMN IF EXISTS profile_links;
+ALTER TABLE users DROP COLUMN IF EXISTS bio;
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+-- Profile details users can show on their public profile
+ALTER TABLE users ADD COLUMN IF NOT EXISTS bio text DEFAULT '' NOT NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS profile_links jsonb DEFAULT '[]'::jsonb NOT NULL;
+
+-- For finding the commits authored by a user when building their contribution graph
+CREATE INDEX IF NOT EXISTS commits_author_email_idx ON commits (lower(author_email));
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+DROP TABLE IF EXISTS collection_stars;
+DROP TABLE IF EXISTS collection_entries;
+DROP TABLE IF EXISTS collections;
+
+COMMIT;
@@ -0,0 +1,62 @@
+BEGIN;
+
+-- Named lists of public databases, curated by users
+CREATE TABLE IF NOT EXISTS collections
+(
+    collection_id bigserial
+        CONSTRAINT collections_pk
+            PRIMARY KEY,
+    user_id       bigint                                 NOT NULL
+        CONSTRAINT collections_users_user_id_fk
+            REFERENCES users
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    name          text                                   NOT NULL,
+    description   text                     DEFAULT ''    NOT NULL,
+    public        boolean                  DEFAULT true  NOT NULL,
+    stars         integer                  DEFAULT 0     NOT NULL,
+    date_created  timestamp with time zone DEFAULT now() NOT NULL,
+    last_modified timestamp with time zone DEFAULT now() NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS collections_user_id_name_uindex
+    ON collections (user_id, lower(name));
+
+CREATE TABLE IF NOT EXISTS collection_entries
+(
+    collection_id bigint                                 NOT NULL
+        CONSTRAINT collection_entries_collections_collection_id_fk
+            REFERENCES collections
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    db_id         bigint                                 NOT NULL
+        CONSTRAINT collection_entries_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    position      integer                                NOT NULL,
+    note          text                     DEFAULT ''    NOT NULL,
+    date_added    timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT collection_entries_pk
+        PRIMARY KEY (collection_id, db_id)
+);
+
+CREATE INDEX IF NOT EXISTS collection_entries_db_id_index
+    ON collection_entries (db_id);
+
+CREATE TABLE IF NOT EXISTS collection_stars
+(
+    collection_id bigint                                 NOT NULL
+        CONSTRAINT collection_stars_collections_collection_id_fk
+            REFERENCES collections
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    user_id       bigint                                 NOT NULL
+        CONSTRAINT collection_stars_users_user_id_fk
+            REFERENCES users
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    date_starred  timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT collection_stars_pk
+        PRIMARY KEY (collection_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS collection_stars_user_id_index
+    ON collection_stars (user_id);
+
+COMMIT;
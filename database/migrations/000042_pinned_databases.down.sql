@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP INDEX IF EXISTS sqlite_databases_pinned_index;
+ALTER TABLE sqlite_databases DROP COLUMN IF EXISTS pin_position;
+
+COMMIT;
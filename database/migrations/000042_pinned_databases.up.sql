@@ -0,0 +1,10 @@
+BEGIN;
+
+-- The place of a database among the ones pinned to its owner's profile.  NULL when it isn't pinned
+ALTER TABLE sqlite_databases ADD COLUMN IF NOT EXISTS pin_position integer;
+
+CREATE INDEX IF NOT EXISTS sqlite_databases_pinned_index
+    ON sqlite_databases (user_id, pin_position)
+    WHERE pin_position IS NOT NULL;
+
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP INDEX IF EXISTS commits_db_id_commit_timestamp_index;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+-- For listing and searching the commit history of a database, newest first
+CREATE INDEX IF NOT EXISTS commits_db_id_commit_timestamp_index
+    ON commits (db_id, commit_timestamp DESC);
+
+COMMIT;
@@ -0,0 +1,26 @@
+BEGIN;
+
+-- The commits of other databases a database was derived from.  Unlike forks, a database can have any number of these
+CREATE TABLE IF NOT EXISTS database_lineage
+(
+    db_id         bigint                                 NOT NULL
+        CONSTRAINT database_lineage_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    source_db_id  bigint                                 NOT NULL
+        CONSTRAINT database_lineage_sqlite_databases_source_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    source_commit text                                   NOT NULL,
+    description   text                     DEFAULT ''    NOT NULL,
+    date_added    timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT database_lineage_pk
+        PRIMARY KEY (db_id, source_db_id, source_commit),
+    CONSTRAINT database_lineage_not_self
+        CHECK (db_id <> source_db_id)
+);
+
+CREATE INDEX IF NOT EXISTS database_lineage_source_db_id_index
+    ON database_lineage (source_db_id);
+
+COMMIT;
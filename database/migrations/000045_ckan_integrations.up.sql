@@ -0,0 +1,26 @@
+BEGIN;
+
+-- The CKAN catalog each database is connected to.  Databases either publish their releases to a CKAN dataset, or are
+-- harvested from one
+CREATE TABLE IF NOT EXISTS ckan_integrations
+(
+    db_id             bigint                                 NOT NULL
+        CONSTRAINT ckan_integrations_pk
+            PRIMARY KEY
+        CONSTRAINT ckan_integrations_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    mode              text                                   NOT NULL
+        CONSTRAINT ckan_integrations_mode_check
+            CHECK (mode IN ('publish', 'harvest')),
+    ckan_url          text                                   NOT NULL,
+    ckan_dataset      text                                   NOT NULL,
+    ckan_organization text                     DEFAULT ''    NOT NULL,
+    api_token         text                     DEFAULT ''    NOT NULL,
+    synced_version    text                     DEFAULT ''    NOT NULL,
+    last_sync         timestamp with time zone,
+    last_error        text                     DEFAULT ''    NOT NULL,
+    date_created      timestamp with time zone DEFAULT now() NOT NULL
+);
+
+COMMIT;
@@ -0,0 +1,27 @@
+BEGIN;
+
+-- The external PostgreSQL or MySQL server each live database has its tables replicated to.  The tables column holds
+-- the list of tables to copy, along with any renaming of them and their columns
+CREATE TABLE IF NOT EXISTS live_replications
+(
+    db_id            bigint                                 NOT NULL
+        CONSTRAINT live_replications_pk
+            PRIMARY KEY
+        CONSTRAINT live_replications_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    target_type      text                                   NOT NULL
+        CONSTRAINT live_replications_target_type_check
+            CHECK (target_type IN ('postgresql', 'mysql')),
+    target_dsn       text                                   NOT NULL,
+    tables           jsonb                    DEFAULT '[]'  NOT NULL,
+    sync_on_write    boolean                  DEFAULT false NOT NULL,
+    interval_minutes integer                  DEFAULT 60    NOT NULL,
+    pending          boolean                  DEFAULT true  NOT NULL,
+    last_sync        timestamp with time zone,
+    last_error       text                     DEFAULT ''    NOT NULL,
+    failures         integer                  DEFAULT 0     NOT NULL,
+    date_created     timestamp with time zone DEFAULT now() NOT NULL
+);
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS transformation_runs;
+DROP TABLE IF EXISTS transformations;
+
+COMMIT;
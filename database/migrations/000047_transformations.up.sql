@@ -0,0 +1,50 @@
+BEGIN;
+
+-- SQL transformations of live databases.  Each one materialises the result of its query as a table of the same name,
+-- after the transformations it depends on have run
+CREATE TABLE IF NOT EXISTS transformations
+(
+    db_id            bigint                                 NOT NULL
+        CONSTRAINT transformations_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    name             text                                   NOT NULL,
+    sql              text                                   NOT NULL,
+    depends_on       text[]                   DEFAULT '{}'  NOT NULL,
+    interval_minutes integer                  DEFAULT 0     NOT NULL,
+    run_on_write     boolean                  DEFAULT false NOT NULL,
+    pending_trigger  text                     DEFAULT ''    NOT NULL
+        CONSTRAINT transformations_pending_trigger_check
+            CHECK (pending_trigger IN ('', 'manual', 'write')),
+    last_run         timestamp with time zone,
+    last_error       text                     DEFAULT ''    NOT NULL,
+    date_created     timestamp with time zone DEFAULT now() NOT NULL,
+    last_modified    timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT transformations_pk
+        PRIMARY KEY (db_id, name)
+);
+
+-- The run history of the transformations
+CREATE TABLE IF NOT EXISTS transformation_runs
+(
+    run_id       bigserial
+        CONSTRAINT transformation_runs_pk
+            PRIMARY KEY,
+    db_id        bigint                              NOT NULL,
+    name         text                                NOT NULL,
+    trigger      text                                NOT NULL
+        CONSTRAINT transformation_runs_trigger_check
+            CHECK (trigger IN ('manual', 'schedule', 'write')),
+    started      timestamp with time zone            NOT NULL,
+    finished     timestamp with time zone            NOT NULL,
+    rows_written bigint                   DEFAULT 0  NOT NULL,
+    error        text                     DEFAULT '' NOT NULL,
+    CONSTRAINT transformation_runs_transformations_fk
+        FOREIGN KEY (db_id, name) REFERENCES transformations
+            ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS transformation_runs_db_id_name_started_index
+    ON transformation_runs (db_id, name, started DESC);
+
+COMMIT;
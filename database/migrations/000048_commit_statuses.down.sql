@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS required_status_checks;
+DROP TABLE IF EXISTS commit_statuses;
+
+COMMIT;
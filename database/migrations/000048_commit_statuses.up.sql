@@ -0,0 +1,40 @@
+BEGIN;
+
+-- The statuses external systems (such as CI servers) have posted for commits.  Only the latest status of each context
+-- is kept for a commit
+CREATE TABLE IF NOT EXISTS commit_statuses
+(
+    db_id         bigint                                 NOT NULL
+        CONSTRAINT commit_statuses_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    commit_id     text                                   NOT NULL,
+    context       text                                   NOT NULL,
+    state         text                                   NOT NULL
+        CONSTRAINT commit_statuses_state_check
+            CHECK (state IN ('pending', 'success', 'failure')),
+    target_url    text                     DEFAULT ''    NOT NULL,
+    description   text                     DEFAULT ''    NOT NULL,
+    creator       bigint                                 NOT NULL
+        CONSTRAINT commit_statuses_users_user_id_fk
+            REFERENCES users
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    date_created  timestamp with time zone DEFAULT now() NOT NULL,
+    last_modified timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT commit_statuses_pk
+        PRIMARY KEY (db_id, commit_id, context)
+);
+
+-- The status check contexts which need to succeed on the head commit of a merge request before it can be merged
+CREATE TABLE IF NOT EXISTS required_status_checks
+(
+    db_id   bigint NOT NULL
+        CONSTRAINT required_status_checks_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    context text   NOT NULL,
+    CONSTRAINT required_status_checks_pk
+        PRIMARY KEY (db_id, context)
+);
+
+COMMIT;
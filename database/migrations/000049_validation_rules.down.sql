@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS validation_results;
+DROP TABLE IF EXISTS validation_rules;
+
+COMMIT;
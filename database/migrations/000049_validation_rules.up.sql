@@ -0,0 +1,40 @@
+BEGIN;
+
+-- The validation rules of databases, which are checked against each new commit
+CREATE TABLE IF NOT EXISTS validation_rules
+(
+    db_id        bigint                                 NOT NULL
+        CONSTRAINT validation_rules_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    rule_name    text                                   NOT NULL,
+    rule_type    text                                   NOT NULL
+        CONSTRAINT validation_rules_rule_type_check
+            CHECK (rule_type IN ('assertion', 'not_null', 'unique', 'row_count')),
+    table_name   text                     DEFAULT ''    NOT NULL,
+    column_name  text                     DEFAULT ''    NOT NULL,
+    sql          text                     DEFAULT ''    NOT NULL,
+    min_rows     bigint,
+    max_rows     bigint,
+    blocking     boolean                  DEFAULT false NOT NULL,
+    date_created timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT validation_rules_pk
+        PRIMARY KEY (db_id, rule_name)
+);
+
+-- The outcome of checking a commit against the validation rules of a database
+CREATE TABLE IF NOT EXISTS validation_results
+(
+    db_id        bigint                                 NOT NULL
+        CONSTRAINT validation_results_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    commit_id    text                                   NOT NULL,
+    passed       boolean                                NOT NULL,
+    results      jsonb                                  NOT NULL,
+    date_created timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT validation_results_pk
+        PRIMARY KEY (db_id, commit_id)
+);
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS merge_request_approvals;
+DROP TABLE IF EXISTS branch_schema_policies;
+
+COMMIT;
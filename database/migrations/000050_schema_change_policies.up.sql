@@ -0,0 +1,35 @@
+BEGIN;
+
+-- The branches which don't accept schema changes, or only accept them through approved merge requests
+CREATE TABLE IF NOT EXISTS branch_schema_policies
+(
+    db_id       bigint NOT NULL
+        CONSTRAINT branch_schema_policies_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    branch_name text   NOT NULL,
+    policy      text   NOT NULL
+        CONSTRAINT branch_schema_policies_policy_check
+            CHECK (policy IN ('block', 'approval')),
+    CONSTRAINT branch_schema_policies_pk
+        PRIMARY KEY (db_id, branch_name)
+);
+
+-- The approvals given to merge requests.  An approval only counts for the head commit it was given for
+CREATE TABLE IF NOT EXISTS merge_request_approvals
+(
+    internal_id  bigint                                 NOT NULL
+        CONSTRAINT merge_request_approvals_discussions_internal_id_fk
+            REFERENCES discussions (internal_id)
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    user_id      bigint                                 NOT NULL
+        CONSTRAINT merge_request_approvals_users_user_id_fk
+            REFERENCES users
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    commit_id    text                                   NOT NULL,
+    date_created timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT merge_request_approvals_pk
+        PRIMARY KEY (internal_id, user_id)
+);
+
+COMMIT;
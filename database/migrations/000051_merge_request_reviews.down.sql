@@ -0,0 +1,16 @@
+BEGIN;
+
+ALTER TABLE sqlite_databases DROP COLUMN IF EXISTS required_approvals;
+
+DELETE FROM merge_request_reviews WHERE state != 'approved';
+ALTER TABLE merge_request_reviews DROP COLUMN IF EXISTS body;
+ALTER TABLE merge_request_reviews DROP COLUMN IF EXISTS state;
+ALTER TABLE merge_request_reviews
+    RENAME CONSTRAINT merge_request_reviews_users_user_id_fk TO merge_request_approvals_users_user_id_fk;
+ALTER TABLE merge_request_reviews
+    RENAME CONSTRAINT merge_request_reviews_discussions_internal_id_fk TO merge_request_approvals_discussions_internal_id_fk;
+ALTER TABLE merge_request_reviews
+    RENAME CONSTRAINT merge_request_reviews_pk TO merge_request_approvals_pk;
+ALTER TABLE merge_request_reviews RENAME TO merge_request_approvals;
+
+COMMIT;
@@ -0,0 +1,19 @@
+BEGIN;
+
+-- Merge request approvals become reviews, which either approve the head commit or ask for changes to it
+ALTER TABLE merge_request_approvals RENAME TO merge_request_reviews;
+ALTER TABLE merge_request_reviews
+    RENAME CONSTRAINT merge_request_approvals_pk TO merge_request_reviews_pk;
+ALTER TABLE merge_request_reviews
+    RENAME CONSTRAINT merge_request_approvals_discussions_internal_id_fk TO merge_request_reviews_discussions_internal_id_fk;
+ALTER TABLE merge_request_reviews
+    RENAME CONSTRAINT merge_request_approvals_users_user_id_fk TO merge_request_reviews_users_user_id_fk;
+ALTER TABLE merge_request_reviews ADD COLUMN IF NOT EXISTS state text DEFAULT 'approved' NOT NULL
+    CONSTRAINT merge_request_reviews_state_check
+        CHECK (state IN ('approved', 'changes_requested'));
+ALTER TABLE merge_request_reviews ADD COLUMN IF NOT EXISTS body text DEFAULT '' NOT NULL;
+
+-- The number of approvals of its head commit a merge request needs before it can be merged
+ALTER TABLE sqlite_databases ADD COLUMN IF NOT EXISTS required_approvals integer DEFAULT 0 NOT NULL;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS merge_request_review_requests;
+DROP TABLE IF EXISTS review_owners;
+
+COMMIT;
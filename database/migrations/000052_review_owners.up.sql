@@ -0,0 +1,37 @@
+BEGIN;
+
+-- The users who own tables of a database, and are asked to review merge requests changing them.  Table patterns can
+-- use * and ? wildcards.  When several rules match a table, the one with the highest rule_order applies
+CREATE TABLE IF NOT EXISTS review_owners
+(
+    db_id         bigint  NOT NULL
+        CONSTRAINT review_owners_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    rule_order    integer NOT NULL,
+    table_pattern text    NOT NULL,
+    user_id       bigint  NOT NULL
+        CONSTRAINT review_owners_users_user_id_fk
+            REFERENCES users
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    CONSTRAINT review_owners_pk
+        PRIMARY KEY (db_id, rule_order, user_id)
+);
+
+-- The users asked to review merge requests
+CREATE TABLE IF NOT EXISTS merge_request_review_requests
+(
+    internal_id  bigint                                 NOT NULL
+        CONSTRAINT merge_request_review_requests_discussions_internal_id_fk
+            REFERENCES discussions (internal_id)
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    user_id      bigint                                 NOT NULL
+        CONSTRAINT merge_request_review_requests_users_user_id_fk
+            REFERENCES users
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    date_created timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT merge_request_review_requests_pk
+        PRIMARY KEY (internal_id, user_id)
+);
+
+COMMIT;
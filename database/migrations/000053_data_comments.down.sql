@@ -0,0 +1,15 @@
+BEGIN;
+
+DROP INDEX IF EXISTS discussion_comments_parent_com_id_index;
+
+ALTER TABLE discussion_comments
+    DROP COLUMN IF EXISTS date_resolved,
+    DROP COLUMN IF EXISTS resolved_by,
+    DROP COLUMN IF EXISTS resolved,
+    DROP COLUMN IF EXISTS parent_com_id,
+    DROP COLUMN IF EXISTS anchor_commit,
+    DROP COLUMN IF EXISTS anchor_column,
+    DROP COLUMN IF EXISTS anchor_key,
+    DROP COLUMN IF EXISTS anchor_table;
+
+COMMIT;
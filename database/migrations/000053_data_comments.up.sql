@@ -0,0 +1,25 @@
+BEGIN;
+
+-- Merge request comments can be attached to a row, or a single cell, of the data diff.  The row is given by the values
+-- of its primary key columns, as a JSON object.  Replies to those comments point to the comment starting the thread,
+-- which holds whether the thread has been resolved
+ALTER TABLE discussion_comments
+    ADD COLUMN anchor_table text,
+    ADD COLUMN anchor_key jsonb,
+    ADD COLUMN anchor_column text,
+    ADD COLUMN anchor_commit text,
+    ADD COLUMN parent_com_id bigint
+        CONSTRAINT discussion_comments_parent_com_id_fk
+            REFERENCES discussion_comments (com_id)
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    ADD COLUMN resolved boolean DEFAULT false NOT NULL,
+    ADD COLUMN resolved_by bigint
+        CONSTRAINT discussion_comments_resolved_by_fk
+            REFERENCES users (user_id)
+            ON UPDATE CASCADE ON DELETE SET NULL,
+    ADD COLUMN date_resolved timestamp with time zone;
+
+CREATE INDEX IF NOT EXISTS discussion_comments_parent_com_id_index
+    ON discussion_comments (parent_com_id);
+
+COMMIT;
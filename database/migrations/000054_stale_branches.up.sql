@@ -0,0 +1,20 @@
+BEGIN;
+
+-- The branches flagged as stale by the last check.  A flag only applies while the head of the branch is still the
+-- commit which was checked
+CREATE TABLE IF NOT EXISTS stale_branches
+(
+    db_id        bigint                                 NOT NULL
+        CONSTRAINT stale_branches_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    branch_name  text                                   NOT NULL,
+    commit_id    text                                   NOT NULL,
+    last_commit  timestamp with time zone               NOT NULL,
+    merged_into  text                                   NOT NULL,
+    date_flagged timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT stale_branches_pk
+        PRIMARY KEY (db_id, branch_name)
+);
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE sqlite_databases DROP COLUMN IF EXISTS date_archived;
+ALTER TABLE sqlite_databases DROP COLUMN IF EXISTS archived;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE sqlite_databases ADD COLUMN IF NOT EXISTS archived boolean DEFAULT false NOT NULL;
+ALTER TABLE sqlite_databases ADD COLUMN IF NOT EXISTS date_archived timestamp with time zone;
+
+COMMIT;
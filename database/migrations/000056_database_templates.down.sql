@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP INDEX IF EXISTS sqlite_databases_is_template_index;
+ALTER TABLE sqlite_databases DROP COLUMN IF EXISTS is_template;
+
+COMMIT;
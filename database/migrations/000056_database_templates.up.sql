@@ -0,0 +1,9 @@
+BEGIN;
+
+ALTER TABLE sqlite_databases ADD COLUMN IF NOT EXISTS is_template boolean DEFAULT false NOT NULL;
+
+CREATE INDEX IF NOT EXISTS sqlite_databases_is_template_index
+    ON sqlite_databases (db_id)
+    WHERE is_template = true;
+
+COMMIT;
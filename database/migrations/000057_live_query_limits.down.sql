@@ -0,0 +1,11 @@
+BEGIN;
+
+ALTER TABLE vis_query_runs DROP COLUMN IF EXISTS limit_exceeded;
+ALTER TABLE vis_query_runs DROP COLUMN IF EXISTS rows_returned;
+ALTER TABLE vis_query_runs DROP COLUMN IF EXISTS duration_ms;
+
+ALTER TABLE usage_limits DROP COLUMN IF EXISTS live_query_max_memory;
+ALTER TABLE usage_limits DROP COLUMN IF EXISTS live_query_max_rows;
+ALTER TABLE usage_limits DROP COLUMN IF EXISTS live_query_timeout;
+
+COMMIT;
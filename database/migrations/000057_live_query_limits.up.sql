@@ -0,0 +1,13 @@
+BEGIN;
+
+-- Limits for queries on live databases.  NULL uses the limit set for the whole instance, and 0 means no limit
+ALTER TABLE usage_limits ADD COLUMN IF NOT EXISTS live_query_timeout integer;
+ALTER TABLE usage_limits ADD COLUMN IF NOT EXISTS live_query_max_rows integer;
+ALTER TABLE usage_limits ADD COLUMN IF NOT EXISTS live_query_max_memory bigint;
+
+-- What each query run used, and the limit which stopped it (if any)
+ALTER TABLE vis_query_runs ADD COLUMN IF NOT EXISTS duration_ms bigint;
+ALTER TABLE vis_query_runs ADD COLUMN IF NOT EXISTS rows_returned bigint;
+ALTER TABLE vis_query_runs ADD COLUMN IF NOT EXISTS limit_exceeded text;
+
+COMMIT;
@@ -0,0 +1,18 @@
+BEGIN;
+
+-- The latest statistics reported by each live node about the databases it holds.  The databases column has an entry
+-- for each database on the node, with its state, size, and recent use
+CREATE TABLE IF NOT EXISTS live_node_stats
+(
+    node_name      text                                   NOT NULL
+        CONSTRAINT live_node_stats_pk
+            PRIMARY KEY,
+    open_databases integer                  DEFAULT 0     NOT NULL,
+    databases      jsonb                    DEFAULT '[]'  NOT NULL,
+    evictions      bigint                   DEFAULT 0     NOT NULL,
+    warm_ups       bigint                   DEFAULT 0     NOT NULL,
+    started        timestamp with time zone DEFAULT now() NOT NULL,
+    reported       timestamp with time zone DEFAULT now() NOT NULL
+);
+
+COMMIT;
@@ -0,0 +1,11 @@
+BEGIN;
+
+DROP TABLE IF EXISTS live_placements;
+
+ALTER TABLE live_node_stats
+    DROP COLUMN IF EXISTS state,
+    DROP COLUMN IF EXISTS database_count,
+    DROP COLUMN IF EXISTS disk_free,
+    DROP COLUMN IF EXISTS memory_used;
+
+COMMIT;
@@ -0,0 +1,34 @@
+BEGIN;
+
+-- The load of each live node, used for placing new live databases on the least loaded one.  Nodes being drained or
+-- decommissioned aren't given new databases, and draining nodes move their databases to other nodes
+ALTER TABLE live_node_stats
+    ADD COLUMN IF NOT EXISTS state          text    DEFAULT 'active' NOT NULL
+        CONSTRAINT live_node_stats_state_check
+            CHECK (state IN ('active', 'draining', 'decommissioned')),
+    ADD COLUMN IF NOT EXISTS database_count integer DEFAULT 0        NOT NULL,
+    ADD COLUMN IF NOT EXISTS disk_free      bigint  DEFAULT 0        NOT NULL,
+    ADD COLUMN IF NOT EXISTS memory_used    bigint  DEFAULT 0        NOT NULL;
+
+-- The history of which live node each live database has been placed on
+CREATE TABLE IF NOT EXISTS live_placements
+(
+    placement_id  bigserial
+        CONSTRAINT live_placements_pk
+            PRIMARY KEY,
+    db_id         bigint                                 NOT NULL
+        CONSTRAINT live_placements_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    node_name     text                                   NOT NULL,
+    previous_node text                     DEFAULT ''    NOT NULL,
+    reason        text                                   NOT NULL
+        CONSTRAINT live_placements_reason_check
+            CHECK (reason IN ('created', 'drain')),
+    placed_date   timestamp with time zone DEFAULT now() NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS live_placements_db_id_idx
+    ON live_placements (db_id, placed_date);
+
+COMMIT;
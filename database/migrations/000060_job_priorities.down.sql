@@ -0,0 +1,10 @@
+BEGIN;
+
+DROP INDEX IF EXISTS job_submissions_started_date_idx;
+DROP INDEX IF EXISTS job_submissions_state_priority_idx;
+
+ALTER TABLE job_submissions
+    DROP COLUMN IF EXISTS priority,
+    DROP COLUMN IF EXISTS started_date;
+
+COMMIT;
@@ -0,0 +1,17 @@
+BEGIN;
+
+-- The priority class of each job.  Interactive jobs (0) are picked up before background jobs (1) such as snapshots,
+-- and the time each job is picked up is kept for reporting how long jobs wait in the queue
+ALTER TABLE job_submissions
+    ADD COLUMN IF NOT EXISTS priority     smallint DEFAULT 0 NOT NULL
+        CONSTRAINT job_submissions_priority_check
+            CHECK (priority IN (0, 1)),
+    ADD COLUMN IF NOT EXISTS started_date timestamp with time zone;
+
+CREATE INDEX IF NOT EXISTS job_submissions_state_priority_idx
+    ON job_submissions (state, priority, submission_date);
+
+CREATE INDEX IF NOT EXISTS job_submissions_started_date_idx
+    ON job_submissions (started_date);
+
+COMMIT;
@@ -0,0 +1,27 @@
+BEGIN;
+
+-- The health reports of commits of standard databases.  Reports are worked out in the background, so a requested
+-- report is pending until then
+CREATE TABLE IF NOT EXISTS health_reports
+(
+    db_id          bigint                                   NOT NULL
+        CONSTRAINT health_reports_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    commit_id      text                                     NOT NULL,
+    state          text                     DEFAULT 'pending' NOT NULL
+        CONSTRAINT health_reports_state_check
+            CHECK (state IN ('pending', 'done', 'failed')),
+    report         jsonb,
+    error          text                     DEFAULT ''      NOT NULL,
+    date_requested timestamp with time zone DEFAULT now()   NOT NULL,
+    date_created   timestamp with time zone,
+    CONSTRAINT health_reports_pk
+        PRIMARY KEY (db_id, commit_id)
+);
+
+CREATE INDEX IF NOT EXISTS health_reports_pending_idx
+    ON health_reports (date_requested)
+    WHERE state = 'pending';
+
+COMMIT;
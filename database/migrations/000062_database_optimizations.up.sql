@@ -0,0 +1,31 @@
+BEGIN;
+
+-- The most recent optimisation (VACUUM and/or ANALYZE) of each database.  Live nodes update the stage and page counts
+-- while it runs, so its progress can be followed
+CREATE TABLE IF NOT EXISTS database_optimizations
+(
+    db_id         bigint                                     NOT NULL
+        CONSTRAINT database_optimizations_pk
+            PRIMARY KEY
+        CONSTRAINT database_optimizations_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    requested_by  bigint                                     NOT NULL
+        CONSTRAINT database_optimizations_users_user_id_fk
+            REFERENCES users
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    state         text                     DEFAULT 'queued'  NOT NULL
+        CONSTRAINT database_optimizations_state_check
+            CHECK (state IN ('queued', 'running', 'done', 'failed')),
+    stage         text                     DEFAULT ''        NOT NULL,
+    pages_done    bigint                   DEFAULT 0         NOT NULL,
+    pages_total   bigint                   DEFAULT 0         NOT NULL,
+    size_before   bigint                   DEFAULT 0         NOT NULL,
+    size_after    bigint                   DEFAULT 0         NOT NULL,
+    commit_id     text                     DEFAULT ''        NOT NULL,
+    error         text                     DEFAULT ''        NOT NULL,
+    date_started  timestamp with time zone DEFAULT now()     NOT NULL,
+    date_finished timestamp with time zone
+);
+
+COMMIT;
@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE IF EXISTS live_auto_versions;
+
+COMMIT;
@@ -0,0 +1,36 @@
+BEGIN;
+
+-- The standard database each live database has its automatic versions committed to.  A new version is committed once
+-- the live database has gone unchanged for debounce_seconds after a write, and/or every interval_minutes while it has
+-- changes.  When keep_versions isn't 0, only that many of the most recent automatic versions are kept on the branch
+CREATE TABLE IF NOT EXISTS live_auto_versions
+(
+    db_id            bigint                                 NOT NULL
+        CONSTRAINT live_auto_versions_pk
+            PRIMARY KEY
+        CONSTRAINT live_auto_versions_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    target_db_id     bigint                                 NOT NULL
+        CONSTRAINT live_auto_versions_target_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    branch           text                                   NOT NULL,
+    on_write         boolean                  DEFAULT true  NOT NULL,
+    debounce_seconds integer                  DEFAULT 300   NOT NULL,
+    interval_minutes integer                  DEFAULT 0     NOT NULL,
+    keep_versions    integer                  DEFAULT 0     NOT NULL,
+    pending          boolean                  DEFAULT true  NOT NULL,
+    changed_at       timestamp with time zone DEFAULT now() NOT NULL,
+    last_run         timestamp with time zone,
+    last_version     timestamp with time zone,
+    last_commit      text                     DEFAULT ''    NOT NULL,
+    last_error       text                     DEFAULT ''    NOT NULL,
+    failures         integer                  DEFAULT 0     NOT NULL,
+    date_created     timestamp with time zone DEFAULT now() NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS live_auto_versions_target_db_id_idx
+    ON live_auto_versions (target_db_id);
+
+COMMIT;
@@ -0,0 +1,34 @@
+BEGIN;
+
+-- The sandboxes of live databases.  A sandbox is a live database of its own, created as a copy of its parent.  The
+-- copy it started from is kept in base_bucket/base_object, so the changes made in the sandbox and in its parent since
+-- then can be worked out when merging the sandbox back into its parent
+CREATE TABLE IF NOT EXISTS live_sandboxes
+(
+    db_id         bigint                                  NOT NULL
+        CONSTRAINT live_sandboxes_pk
+            PRIMARY KEY
+        CONSTRAINT live_sandboxes_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    parent_db_id  bigint                                  NOT NULL
+        CONSTRAINT live_sandboxes_parent_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    base_bucket   text                                    NOT NULL,
+    base_object   text                                    NOT NULL,
+    state         text                     DEFAULT 'open' NOT NULL
+        CONSTRAINT live_sandboxes_state_check
+            CHECK (state IN ('open', 'merged')),
+    merged_by     bigint
+        CONSTRAINT live_sandboxes_merged_by_fk
+            REFERENCES users
+            ON UPDATE CASCADE ON DELETE SET NULL,
+    date_merged   timestamp with time zone,
+    date_created  timestamp with time zone DEFAULT now()  NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS live_sandboxes_parent_db_id_idx
+    ON live_sandboxes (parent_db_id);
+
+COMMIT;
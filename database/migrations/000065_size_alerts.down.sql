@@ -0,0 +1,6 @@
+BEGIN;
+
+ALTER TABLE sqlite_databases DROP COLUMN IF EXISTS size_alert_percent;
+ALTER TABLE sqlite_databases DROP COLUMN IF EXISTS size_alert_bytes;
+
+COMMIT;
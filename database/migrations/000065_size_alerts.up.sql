@@ -0,0 +1,8 @@
+BEGIN;
+
+-- The growth of a database from one commit to the next which its owner is emailed about.  Either can be 0 to turn it
+-- off.  The sizes themselves are already stored with each commit
+ALTER TABLE sqlite_databases ADD COLUMN IF NOT EXISTS size_alert_bytes bigint DEFAULT 0 NOT NULL;
+ALTER TABLE sqlite_databases ADD COLUMN IF NOT EXISTS size_alert_percent integer DEFAULT 0 NOT NULL;
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS scheduled_report_runs;
+DROP TABLE IF EXISTS scheduled_reports;
+
+COMMIT;
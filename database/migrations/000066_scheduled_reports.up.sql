@@ -0,0 +1,73 @@
+BEGIN;
+
+-- Reports which run a saved query or dashboard on a cron schedule, then deliver the rendered results by email or to a
+-- webhook.  Saved query reports also have the database the query belongs to
+CREATE TABLE IF NOT EXISTS scheduled_reports
+(
+    report_id      bigserial
+        CONSTRAINT scheduled_reports_pk
+            PRIMARY KEY,
+    user_id        bigint                                 NOT NULL
+        CONSTRAINT scheduled_reports_users_user_id_fk
+            REFERENCES users
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    name           text                                   NOT NULL,
+    source         text                                   NOT NULL
+        CONSTRAINT scheduled_reports_source_check
+            CHECK (source IN ('dashboard', 'query')),
+    db_id          bigint
+        CONSTRAINT scheduled_reports_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    source_name    text                                   NOT NULL,
+    schedule       text                                   NOT NULL,
+    format         text                                   NOT NULL
+        CONSTRAINT scheduled_reports_format_check
+            CHECK (format IN ('csv', 'html', 'pdf')),
+    delivery       text                                   NOT NULL
+        CONSTRAINT scheduled_reports_delivery_check
+            CHECK (delivery IN ('email', 'webhook')),
+    webhook_url    text                     DEFAULT ''    NOT NULL,
+    webhook_secret text                     DEFAULT ''    NOT NULL,
+    next_run       timestamp with time zone               NOT NULL,
+    run_pending    boolean                  DEFAULT false NOT NULL,
+    last_run       timestamp with time zone,
+    last_error     text                     DEFAULT ''    NOT NULL,
+    date_created   timestamp with time zone DEFAULT now() NOT NULL,
+    last_modified  timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT scheduled_reports_query_db_check
+        CHECK (source != 'query' OR db_id IS NOT NULL)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS scheduled_reports_user_id_name_uindex
+    ON scheduled_reports (user_id, name);
+
+CREATE INDEX IF NOT EXISTS scheduled_reports_next_run_index
+    ON scheduled_reports (next_run);
+
+-- The run history of the reports.  The rendered output of each run is kept, so it can be downloaded again
+CREATE TABLE IF NOT EXISTS scheduled_report_runs
+(
+    run_id       bigserial
+        CONSTRAINT scheduled_report_runs_pk
+            PRIMARY KEY,
+    report_id    bigint                                 NOT NULL
+        CONSTRAINT scheduled_report_runs_scheduled_reports_report_id_fk
+            REFERENCES scheduled_reports
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    trigger      text                                   NOT NULL
+        CONSTRAINT scheduled_report_runs_trigger_check
+            CHECK (trigger IN ('manual', 'schedule')),
+    started      timestamp with time zone               NOT NULL,
+    finished     timestamp with time zone               NOT NULL,
+    row_count    bigint                   DEFAULT 0     NOT NULL,
+    delivered    boolean                  DEFAULT false NOT NULL,
+    error        text                     DEFAULT ''    NOT NULL,
+    content_type text                     DEFAULT ''    NOT NULL,
+    output       bytea
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_report_runs_report_id_started_index
+    ON scheduled_report_runs (report_id, started DESC);
+
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS alert_history;
+DROP TABLE IF EXISTS alert_rules;
+
+COMMIT;
@@ -0,0 +1,69 @@
+BEGIN;
+
+-- Rules which run a saved query against a live database on a cron schedule, checking its result against a condition.
+-- When the condition starts being met the owner is notified by email or webhook
+CREATE TABLE IF NOT EXISTS alert_rules
+(
+    rule_id        bigserial
+        CONSTRAINT alert_rules_pk
+            PRIMARY KEY,
+    user_id        bigint                                 NOT NULL
+        CONSTRAINT alert_rules_users_user_id_fk
+            REFERENCES users
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    name           text                                   NOT NULL,
+    db_id          bigint                                 NOT NULL
+        CONSTRAINT alert_rules_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    query_name     text                                   NOT NULL,
+    schedule       text                                   NOT NULL,
+    metric         text                                   NOT NULL
+        CONSTRAINT alert_rules_metric_check
+            CHECK (metric IN ('rows', 'value')),
+    condition      text                                   NOT NULL
+        CONSTRAINT alert_rules_condition_check
+            CHECK (condition IN ('above', 'below', 'drop', 'equal', 'rise')),
+    threshold      double precision                       NOT NULL,
+    delivery       text                                   NOT NULL
+        CONSTRAINT alert_rules_delivery_check
+            CHECK (delivery IN ('email', 'webhook')),
+    webhook_url    text                     DEFAULT ''    NOT NULL,
+    webhook_secret text                     DEFAULT ''    NOT NULL,
+    next_run       timestamp with time zone               NOT NULL,
+    last_run       timestamp with time zone,
+    last_value     double precision,
+    last_error     text                     DEFAULT ''    NOT NULL,
+    triggered      boolean                  DEFAULT false NOT NULL,
+    date_created   timestamp with time zone DEFAULT now() NOT NULL,
+    last_modified  timestamp with time zone DEFAULT now() NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS alert_rules_user_id_name_uindex
+    ON alert_rules (user_id, name);
+
+CREATE INDEX IF NOT EXISTS alert_rules_next_run_index
+    ON alert_rules (next_run);
+
+-- The evaluation history of the rules
+CREATE TABLE IF NOT EXISTS alert_history
+(
+    event_id  bigserial
+        CONSTRAINT alert_history_pk
+            PRIMARY KEY,
+    rule_id   bigint                                 NOT NULL
+        CONSTRAINT alert_history_alert_rules_rule_id_fk
+            REFERENCES alert_rules
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    evaluated timestamp with time zone               NOT NULL,
+    value     double precision,
+    previous  double precision,
+    triggered boolean                  DEFAULT false NOT NULL,
+    notified  boolean                  DEFAULT false NOT NULL,
+    error     text                     DEFAULT ''    NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS alert_history_rule_id_evaluated_index
+    ON alert_history (rule_id, evaluated DESC);
+
+COMMIT;
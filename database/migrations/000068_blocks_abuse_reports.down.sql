@@ -0,0 +1,10 @@
+BEGIN;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS banned;
+ALTER TABLE discussion_comments
+    DROP COLUMN IF EXISTS hidden;
+DROP TABLE IF EXISTS abuse_reports;
+DROP TABLE IF EXISTS user_blocks;
+
+COMMIT;
@@ -0,0 +1,68 @@
+BEGIN;
+
+-- Users blocked by other users.  Their comments are hidden from the user who blocked them, and when prevent_forks is
+-- set they can't fork that user's databases
+CREATE TABLE IF NOT EXISTS user_blocks
+(
+    user_id         bigint                                 NOT NULL
+        CONSTRAINT user_blocks_users_user_id_fk
+            REFERENCES users
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    blocked_user_id bigint                                 NOT NULL
+        CONSTRAINT user_blocks_users_blocked_user_id_fk
+            REFERENCES users
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    prevent_forks   boolean                  DEFAULT false NOT NULL,
+    date_created    timestamp with time zone DEFAULT now() NOT NULL,
+    CONSTRAINT user_blocks_pk
+        PRIMARY KEY (user_id, blocked_user_id),
+    CONSTRAINT user_blocks_self_check
+        CHECK (user_id != blocked_user_id)
+);
+
+-- Reports of abusive databases and discussion comments, which are reviewed by the instance admins.  The comment ID
+-- isn't a foreign key, so reports of comments are still known to be about comments after they're deleted
+CREATE TABLE IF NOT EXISTS abuse_reports
+(
+    report_id     bigserial
+        CONSTRAINT abuse_reports_pk
+            PRIMARY KEY,
+    reporter_id   bigint                                 NOT NULL
+        CONSTRAINT abuse_reports_users_reporter_id_fk
+            REFERENCES users
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    db_id         bigint                                 NOT NULL
+        CONSTRAINT abuse_reports_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    com_id        bigint,
+    reason        text                                   NOT NULL
+        CONSTRAINT abuse_reports_reason_check
+            CHECK (reason IN ('copyright', 'harassment', 'illegal', 'malware', 'other', 'spam')),
+    details       text                     DEFAULT ''    NOT NULL,
+    status        text                     DEFAULT 'open' NOT NULL
+        CONSTRAINT abuse_reports_status_check
+            CHECK (status IN ('dismissed', 'open', 'resolved')),
+    action        text                     DEFAULT ''    NOT NULL
+        CONSTRAINT abuse_reports_action_check
+            CHECK (action IN ('', 'ban', 'delete', 'hide')),
+    resolved_by   bigint
+        CONSTRAINT abuse_reports_users_resolved_by_fk
+            REFERENCES users
+            ON UPDATE CASCADE ON DELETE SET NULL,
+    date_resolved timestamp with time zone,
+    date_created  timestamp with time zone DEFAULT now() NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS abuse_reports_status_date_created_index
+    ON abuse_reports (status, date_created);
+
+-- Discussion comments hidden by the instance admins
+ALTER TABLE discussion_comments
+    ADD COLUMN IF NOT EXISTS hidden boolean DEFAULT false NOT NULL;
+
+-- Users banned by the instance admins can no longer log in or use the API
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS banned boolean DEFAULT false NOT NULL;
+
+COMMIT;
@@ -0,0 +1,37 @@
+BEGIN;
+
+-- New discussions, comments, and database descriptions flagged by the spam filter.  They're held here until the
+-- instance admins either publish or reject them
+CREATE TABLE IF NOT EXISTS held_content
+(
+    held_id              bigserial
+        CONSTRAINT held_content_pk
+            PRIMARY KEY,
+    kind                 text                                  NOT NULL
+        CONSTRAINT held_content_kind_check
+            CHECK (kind IN ('comment', 'description', 'discussion')),
+    user_id              bigint                                NOT NULL
+        CONSTRAINT held_content_users_user_id_fk
+            REFERENCES users
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    db_id                bigint                                NOT NULL
+        CONSTRAINT held_content_sqlite_databases_db_id_fk
+            REFERENCES sqlite_databases
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    disc_id              integer                  DEFAULT 0    NOT NULL,
+    title                text                     DEFAULT ''   NOT NULL,
+    body                 text                     DEFAULT ''   NOT NULL,
+    one_line_description text                     DEFAULT ''   NOT NULL,
+    reason               text                                  NOT NULL,
+    ip                   text                     DEFAULT ''   NOT NULL,
+    user_agent           text                     DEFAULT ''   NOT NULL,
+    date_created         timestamp with time zone DEFAULT now() NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS held_content_date_created_index
+    ON held_content (date_created);
+
+CREATE INDEX IF NOT EXISTS held_content_user_id_date_created_index
+    ON held_content (user_id, date_created);
+
+COMMIT;
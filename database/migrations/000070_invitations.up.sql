@@ -0,0 +1,24 @@
+BEGIN;
+
+-- Invitations to sign up, issued by the instance admins for when signups are closed.  Only a hash of each invitation
+-- token is kept.  When an email address is given, only that address can use the invitation
+CREATE TABLE IF NOT EXISTS invitations
+(
+    invite_id    bigserial
+        CONSTRAINT invitations_pk
+            PRIMARY KEY,
+    token_hash   text                                  NOT NULL
+        CONSTRAINT invitations_token_hash_key
+            UNIQUE,
+    email        text                     DEFAULT ''   NOT NULL,
+    created_by   bigint
+        CONSTRAINT invitations_users_created_by_fk
+            REFERENCES users
+            ON UPDATE CASCADE ON DELETE SET NULL,
+    used_email   text,
+    date_used    timestamp with time zone,
+    expiry_date  timestamp with time zone              NOT NULL,
+    date_created timestamp with time zone DEFAULT now() NOT NULL
+);
+
+COMMIT;
@@ -0,0 +1,24 @@
+BEGIN;
+
+-- The read only mode set by the instance admins, shared by all of the daemons.  There's only ever a single row
+CREATE TABLE IF NOT EXISTS maintenance_mode
+(
+    id           boolean                  DEFAULT true  NOT NULL
+        CONSTRAINT maintenance_mode_pk
+            PRIMARY KEY
+        CONSTRAINT maintenance_mode_single_row
+            CHECK (id),
+    read_only    boolean                  DEFAULT false NOT NULL,
+    message      text                     DEFAULT ''    NOT NULL,
+    changed_by   bigint
+        CONSTRAINT maintenance_mode_users_changed_by_fk
+            REFERENCES users
+            ON UPDATE CASCADE ON DELETE SET NULL,
+    date_changed timestamp with time zone DEFAULT now() NOT NULL
+);
+
+INSERT INTO maintenance_mode (id)
+VALUES (true)
+ON CONFLICT DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+
+-- When each user last uploaded their own avatar.  NULL for users who haven't
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS avatar_uploaded timestamp with time zone;
+
+COMMIT;
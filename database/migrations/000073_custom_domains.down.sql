@@ -0,0 +1,5 @@
+BEGIN;
+
+DROP TABLE IF EXISTS custom_domains;
+
+COMMIT;
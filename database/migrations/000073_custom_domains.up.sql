@@ -0,0 +1,26 @@
+BEGIN;
+
+-- Custom domains, which serve the profile and databases of a user from a domain of their own.  A domain is only used
+-- once it's been verified, by the user publishing its verification token in a DNS TXT record
+CREATE TABLE IF NOT EXISTS custom_domains
+(
+    domain_id          bigserial
+        CONSTRAINT custom_domains_pk
+            PRIMARY KEY,
+    user_id            bigint                                NOT NULL
+        CONSTRAINT custom_domains_users_user_id_fk
+            REFERENCES users
+            ON UPDATE CASCADE ON DELETE CASCADE,
+    domain             text                                  NOT NULL,
+    verification_token text                                  NOT NULL,
+    date_verified      timestamp with time zone,
+    date_created       timestamp with time zone DEFAULT now() NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS custom_domains_domain_uindex
+    ON custom_domains (lower(domain));
+
+CREATE INDEX IF NOT EXISTS custom_domains_user_id_index
+    ON custom_domains (user_id);
+
+COMMIT;
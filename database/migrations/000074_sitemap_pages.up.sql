@@ -0,0 +1,13 @@
+BEGIN;
+
+-- The generated sitemap, so every node can serve the one the leader generated.  Page 0 is the index, the others are
+-- the pages it lists
+CREATE TABLE IF NOT EXISTS sitemap_pages
+(
+    page    integer NOT NULL
+        CONSTRAINT sitemap_pages_pk
+            PRIMARY KEY,
+    content bytea   NOT NULL
+);
+
+COMMIT;
@@ -0,0 +1,23 @@
+BEGIN;
+
+-- Only one claim of each domain can be kept.  That's the verified one when there is one, otherwise the oldest
+DELETE
+FROM custom_domains AS d
+WHERE EXISTS(SELECT 1
+             FROM custom_domains AS o
+             WHERE lower(o.domain) = lower(d.domain)
+               AND o.domain_id <> d.domain_id
+               AND (o.date_verified IS NOT NULL
+                 OR (d.date_verified IS NULL AND o.domain_id < d.domain_id)));
+
+DROP INDEX IF EXISTS custom_domains_user_id_domain_uindex;
+
+CREATE INDEX IF NOT EXISTS custom_domains_user_id_index
+    ON custom_domains (user_id);
+
+DROP INDEX IF EXISTS custom_domains_domain_uindex;
+
+CREATE UNIQUE INDEX IF NOT EXISTS custom_domains_domain_uindex
+    ON custom_domains (lower(domain));
+
+COMMIT;
@@ -0,0 +1,17 @@
+BEGIN;
+
+-- Only verified custom domains need to be unique.  Several users can claim the same domain, and the first one to verify
+-- it gets it, so nobody can hold on to a domain they don't control by adding it without verifying it
+DROP INDEX IF EXISTS custom_domains_domain_uindex;
+
+CREATE UNIQUE INDEX IF NOT EXISTS custom_domains_domain_uindex
+    ON custom_domains (lower(domain))
+    WHERE date_verified IS NOT NULL;
+
+-- Each user can only claim a domain once.  This covers looking up the domains of a user too
+DROP INDEX IF EXISTS custom_domains_user_id_index;
+
+CREATE UNIQUE INDEX IF NOT EXISTS custom_domains_user_id_domain_uindex
+    ON custom_domains (user_id, lower(domain));
+
+COMMIT;
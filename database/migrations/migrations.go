@@ -0,0 +1,10 @@
+// Package migrations holds the PostgreSQL schema migrations, which are embedded into the daemons so they can bring the
+// database schema up to date when they start
+package migrations
+
+import "embed"
+
+// FS holds the migration files.  Each migration has an "up" file applying it, and a "down" file reverting it
+//
+//go:embed *.sql
+var FS embed.FS
@@ -5,10 +5,8 @@ package main
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"html"
@@ -52,8 +50,8 @@ func main() {
 		log.Fatalf("Setting temp directory environment variable failed: '%s'", err)
 	}
 
-	// Connect to Minio server
-	err = com.ConnectMinio()
+	// Connect to the storage backend
+	err = com.ConnectBlobStore()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -77,6 +75,9 @@ func main() {
 	go com.ResponseQueueCheck()
 	go com.ResponseQueueListen()
 
+	// Start background goroutine to keep the read only mode up to date
+	go com.MaintenanceLoop()
+
 	// Start background signal handler
 	exitSignal := make(chan struct{}, 1)
 	go com.SignalHandler(&exitSignal)
@@ -113,7 +114,7 @@ func main() {
 	newServer := &http.Server{
 		Addr:         ":" + fmt.Sprint(config.Conf.DB4S.Port),
 		ErrorLog:     com.HttpErrorLog(),
-		Handler:      gz.GzipHandler(mux),
+		Handler:      gz.GzipHandler(com.ReadOnlyGuard(mux, nil, nil)),
 		TLSConfig:    newTLSConfig,
 		TLSNextProto: make(map[string]func(*http.Server, *tls.Conn, http.Handler), 0),
 	}
@@ -415,6 +416,26 @@ func getHandler(w http.ResponseWriter, r *http.Request, userAcc string) {
 		return
 	}
 
+	// When only some of the tables were asked for, send a copy of the database holding just those
+	tables, err := com.GetFormTables(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(tables) > 0 {
+		w.Header().Set("Branch", branchName)
+		w.Header().Set("Commit-ID", commit)
+		bytesWritten, httpStatus, err := com.DownloadPartialDatabase(w, r, dbOwner, dbName, commit, userAcc, "db4s",
+			tables)
+		if err != nil {
+			http.Error(w, err.Error(), httpStatus)
+			return
+		}
+		log.Printf("Tables of '%s/%s' downloaded by user '%v', %v bytes", com.SanitiseLogString(dbOwner),
+			com.SanitiseLogString(dbName), userAcc, bytesWritten)
+		return
+	}
+
 	// A specific database was requested, so send it to the user
 	err = retrieveDatabase(w, r, pageName, userAcc, dbOwner, dbName, branchName, commit)
 	if err != nil {
@@ -486,24 +507,6 @@ func licenceAddHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Ensure a licence by the same name (for this user) doesn't already exist, and the supplied display order isn't
-	// already used
-	licList, err := database.GetLicences(userAcc)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-	for i, j := range licList {
-		if i == licID {
-			http.Error(w, "A licence with that short name/id already exists", http.StatusConflict)
-			return
-		}
-		if dispOrder == j.Order {
-			http.Error(w, "That display order number is already used by another licence", http.StatusConflict)
-			return
-		}
-	}
-
 	// The file format parameter is required, and can only be "text" or "html"
 	var fileFormat string
 	ff := r.FormValue("file_format")
@@ -547,25 +550,10 @@ func licenceAddHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Make sure this licence isn't a duplicate of an existing one
-	tmpSHA := sha256.Sum256(licText.Bytes())
-	licSHA := hex.EncodeToString(tmpSHA[:])
-	licCheckName, licCheckURL, err := database.GetLicenceInfoFromSha256(userAcc, string(licSHA[:]))
-	if err != nil && err.Error() != "No matching licence found, something has gone wrong!" {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	if licCheckName != "" || licCheckURL != "" {
-		http.Error(w, fmt.Sprintf("This licence is already in the system, using the short name of '%s'",
-			licCheckName), http.StatusConflict)
-		return
-	}
-
-	// Save the licence in the database
-	err = database.StoreLicence(userAcc, licID, licText.Bytes(), sourceURL, dispOrder, licName, fileFormat)
+	// Save the licence in the database, unless it clashes with an existing one
+	httpStatus, err := com.AddLicence(userAcc, licID, licName, sourceURL, fileFormat, dispOrder, licText.Bytes())
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Something went wrong when storing the new licence file: '%s'", err.Error()),
-			http.StatusInternalServerError)
+		http.Error(w, err.Error(), httpStatus)
 		return
 	}
 
@@ -762,6 +750,16 @@ func metadataGetHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// If DB4S already has the current metadata there's no need to send it again
+	etag, lastModified, err := com.MetadataValidators(meta)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if com.NotModified(w, r, etag, lastModified) {
+		return
+	}
+
 	// Return the list as JSON
 	jsonList, err := json.MarshalIndent(meta, "", "  ")
 	if err != nil {
@@ -787,6 +785,14 @@ func metadataGetHandler(w http.ResponseWriter, r *http.Request) {
 //	    -F "sourceurl=https://example.org" -F "lastmodified=2017-01-02T03:04:05Z"  -F "licence=CC0"  -F "public=true" \
 //	    -F "commit=51d494f2c5eb6734ddaa204eccb9597b426091c79c951924ac83c72038f22b55" \
 //	    https://db4s.dbhub.io:5550/someuser
+//
+// When the commit is no longer the head of the branch, because the database was edited offline while the branch moved
+// on, the upload is rejected unless an additional "merge=true" field is included.  With it, the upload is stored on a
+// new "offline-N" branch forked from the commit, and a three-way merge of the row changes made on both sides is tried.
+// If that works, a merge commit is added to the branch and returned with "merged" set to "true", which the client needs
+// to download as it includes the changes from the server.  Otherwise a merge request is opened from the new branch,
+// and the commit on it is returned with "merged" set to "false", the merge request number in "merge_request", and the
+// list of conflicts in "conflicts"
 func postHandler(w http.ResponseWriter, r *http.Request, userAcc string) {
 	// Set the maximum accepted database size for uploading
 	maxSize, err := database.MaxUploadSizeForUser(userAcc)
@@ -860,6 +866,12 @@ func postHandler(w http.ResponseWriter, r *http.Request, userAcc string) {
 // Returns a file requested by the client.  An example curl command to simulate the request is:
 //
 //	$ curl -OL -kE ~/my.cert.pem -D headers.out -G https://db4s.dbhub.io:5550/someuser/somedb.sqlite
+//
+// To retrieve a copy of the database holding only some of its tables, add a "tables" field with a JSON array of their
+// names.  Their indexes and triggers are included, but views aren't:
+//
+//	$ curl -OL -kE ~/my.cert.pem -D headers.out -G --data-urlencode 'tables=["table1","table2"]' \
+//	    https://db4s.dbhub.io:5550/someuser/somedb.sqlite
 func retrieveDatabase(w http.ResponseWriter, r *http.Request, pageName string, userAcc string, dbOwner string,
 	dbName string, branchName string, commit string) (err error) {
 	pageName += ":retrieveDatabase()"
@@ -871,6 +883,11 @@ func retrieveDatabase(w http.ResponseWriter, r *http.Request, pageName string, u
 		return
 	}
 
+	// If DB4S already has this version of the database there's no need to send it again
+	if com.NotModified(w, r, `"`+bucket+id+`"`, lastMod) {
+		return
+	}
+
 	// Get a handle from Minio for the database object
 	userDB, err := com.MinioHandle(bucket, id)
 	if err != nil {
@@ -886,13 +903,29 @@ func retrieveDatabase(w http.ResponseWriter, r *http.Request, pageName string, u
 		}
 	}()
 
-	// Get the file details
-	stat, err := userDB.Stat()
+	// Get the file size
+	size, err := userDB.Size()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Note: modification-date parameter format copied from RFC 2183 (the closest match I could find easily)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"; modification-date="%s";`,
+		url.QueryEscape(dbName), lastMod.Format(time.RFC3339)))
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Branch", branchName)
+	w.Header().Set("Commit-ID", commit)
+
+	// Range requests retrieve just part of the database, for resuming an interrupted download.  The download was
+	// already recorded when it was started, so they're not logged or counted again
+	if r.Header.Get("Range") != "" {
+		bytesWritten := com.ServeDatabaseRange(w, r, userDB, lastMod)
+		log.Printf("Byte range of '%s/%s' downloaded by user '%v', %v bytes", com.SanitiseLogString(dbOwner),
+			com.SanitiseLogString(dbName), userAcc, bytesWritten)
+		return nil
+	}
+
 	// Was a user agent part of the request?
 	var userAgent string
 	ua, ok := r.Header["User-Agent"]
@@ -901,21 +934,16 @@ func retrieveDatabase(w http.ResponseWriter, r *http.Request, pageName string, u
 	}
 
 	// Make a record of the download
-	err = database.LogDownload(dbOwner, dbName, userAcc, r.RemoteAddr, "db4s", userAgent, time.Now().UTC(),
-		bucket+id)
+	err = database.LogDownload(dbOwner, dbName, userAcc, r.RemoteAddr, "db4s", userAgent, com.RequestCountry(r), "",
+		time.Now().UTC(), bucket+id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// Send the database to the user
-	// Note: modification-date parameter format copied from RFC 2183 (the closest match I could find easily)
-	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"; modification-date="%s";`,
-		url.QueryEscape(dbName), lastMod.Format(time.RFC3339)))
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", stat.Size))
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", size))
 	w.Header().Set("Content-Type", "application/x-sqlite3")
-	w.Header().Set("Branch", branchName)
-	w.Header().Set("Commit-ID", commit)
 	bytesWritten, err := io.Copy(w, userDB)
 	if err != nil {
 		log.Printf("%s: Error returning DB file: %v", pageName, err)
@@ -995,7 +1023,7 @@ func userDatabaseList(userAcc string, user string) (dbList []byte, err error) {
 	}
 
 	// Retrieve the database list
-	pubDBs, err := database.UserDBs(user, pubSetting)
+	pubDBs, err := database.UserDBs(user, pubSetting, database.DBOrderModified, database.DBFilter{})
 	if err != nil {
 		return nil, err
 	}
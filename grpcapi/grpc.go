@@ -0,0 +1,239 @@
+package main
+
+// The parts of the gRPC protocol used by the service, implemented on top of the HTTP/2 support in net/http.  See
+// https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-HTTP2.md for the details
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// The largest message accepted from clients.  Upload streams need to split the database file into chunks smaller
+// than this
+const maxMessageSize = 4 * 1024 * 1024
+
+// The largest chunk of a database file sent to clients in a single message
+const maxChunkSize = 64 * 1024
+
+// statusCode is a gRPC status code.  Only the codes returned by the service are included here
+type statusCode int
+
+const (
+	codeOK                 statusCode = 0
+	codeInvalidArgument    statusCode = 3
+	codeNotFound           statusCode = 5
+	codePermissionDenied   statusCode = 7
+	codeResourceExhausted  statusCode = 8
+	codeFailedPrecondition statusCode = 9
+	codeAborted            statusCode = 10
+	codeUnimplemented      statusCode = 12
+	codeInternal           statusCode = 13
+	codeUnavailable        statusCode = 14
+	codeUnauthenticated    statusCode = 16
+)
+
+// statusError is an error returned to the client with a specific status code.  Any other error is returned with the
+// "internal" status code
+type statusError struct {
+	code    statusCode
+	message string
+}
+
+func (e *statusError) Error() string {
+	return e.message
+}
+
+// statusErrorf returns a statusError with a formatted message
+func statusErrorf(code statusCode, format string, a ...interface{}) error {
+	return &statusError{code: code, message: fmt.Sprintf(format, a...)}
+}
+
+// codeFromHTTP returns the gRPC status code matching an HTTP status code, for errors from the functions shared with
+// the other daemons
+func codeFromHTTP(httpStatus int) statusCode {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codeInvalidArgument
+	case http.StatusUnauthorized:
+		return codeUnauthenticated
+	case http.StatusForbidden:
+		return codePermissionDenied
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusConflict:
+		return codeAborted
+	case http.StatusTooManyRequests:
+		return codeResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codeUnavailable
+	default:
+		return codeInternal
+	}
+}
+
+// httpFromCode returns the HTTP status code matching a gRPC status code.  It's used when logging calls, so they show
+// up the same way as calls to the REST API
+func httpFromCode(code statusCode) int {
+	switch code {
+	case codeOK:
+		return http.StatusOK
+	case codeInvalidArgument:
+		return http.StatusBadRequest
+	case codeNotFound:
+		return http.StatusNotFound
+	case codePermissionDenied:
+		return http.StatusForbidden
+	case codeResourceExhausted:
+		return http.StatusTooManyRequests
+	case codeFailedPrecondition:
+		return http.StatusPreconditionFailed
+	case codeAborted:
+		return http.StatusConflict
+	case codeUnimplemented:
+		return http.StatusNotImplemented
+	case codeUnauthenticated:
+		return http.StatusUnauthorized
+	case codeUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// call holds the state of an incoming call
+type call struct {
+	dbName       string // The database the call is for (if any), for the call log
+	dbOwner      string
+	key          database.APIKey
+	r            *http.Request
+	requestSize  int64
+	responseSize int
+	user         string
+	w            http.ResponseWriter
+}
+
+// recv reads the next message sent by the client.  io.EOF is returned when the client has finished sending
+func (c *call) recv(m interface{ unmarshal([]byte) error }) error {
+	var prefix [5]byte
+	_, err := io.ReadFull(c.r.Body, prefix[:])
+	if errors.Is(err, io.EOF) {
+		return io.EOF
+	}
+	if err != nil {
+		return statusErrorf(codeInvalidArgument, "Incomplete message received")
+	}
+	if prefix[0] != 0 {
+		return statusErrorf(codeUnimplemented, "Compressed messages aren't supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxMessageSize {
+		return statusErrorf(codeResourceExhausted, "Message too large.  The maximum message size is %d bytes",
+			maxMessageSize)
+	}
+	msg := make([]byte, size)
+	_, err = io.ReadFull(c.r.Body, msg)
+	if err != nil {
+		return statusErrorf(codeInvalidArgument, "Incomplete message received")
+	}
+	c.requestSize += int64(len(prefix) + len(msg))
+	if err = m.unmarshal(msg); err != nil {
+		return statusErrorf(codeInvalidArgument, "Malformed message: %s", err)
+	}
+	return nil
+}
+
+// send sends a message to the client
+func (c *call) send(msg []byte) error {
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(msg)))
+	if _, err := c.w.Write(prefix[:]); err != nil {
+		return err
+	}
+	if _, err := c.w.Write(msg); err != nil {
+		return err
+	}
+	c.responseSize += len(prefix) + len(msg)
+	if f, ok := c.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// writeStatus sends the status of a finished call to the client, in the response trailers
+func writeStatus(w http.ResponseWriter, err error) (code statusCode) {
+	var message string
+	if err != nil {
+		code = codeInternal
+		message = err.Error()
+		var se *statusError
+		if errors.As(err, &se) {
+			code = se.code
+		}
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(int(code)))
+	if message != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", encodeGrpcMessage(message))
+	}
+	return
+}
+
+// encodeGrpcMessage percent encodes a status message, as required for the grpc-message trailer
+func encodeGrpcMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// discardWriter is passed to functions shared with the other daemons which write error messages to an
+// http.ResponseWriter.  Those errors are returned to the client in the call status instead
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header {
+	if w.header == nil {
+		w.header = make(http.Header)
+	}
+	return w.header
+}
+
+func (w *discardWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (w *discardWriter) WriteHeader(int) {}
+
+// chunkWriter is passed to functions shared with the other daemons which write a database file to an
+// http.ResponseWriter, and sends the file to the client as a stream of DownloadChunk messages
+type chunkWriter struct {
+	discardWriter
+	c *call
+}
+
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	for written := 0; written < len(p); {
+		n := len(p) - written
+		if n > maxChunkSize {
+			n = maxChunkSize
+		}
+		if err := w.c.send(marshalDownloadChunk(p[written : written+n])); err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return len(p), nil
+}
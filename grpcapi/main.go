@@ -0,0 +1,174 @@
+package main
+
+// The gRPC API daemon.  It provides a subset of the REST API (listing databases, downloading and uploading them,
+// running queries, and retrieving their metadata) as a gRPC service, for lower overhead machine to machine
+// integrations.  The service is defined in dbhub.proto
+
+import (
+	"crypto/tls"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// method is a call provided by the service
+type method struct {
+	handler         func(c *call) error
+	writePermission bool // Whether the call needs an API key with write access
+}
+
+// The calls provided by the service, by their request path
+var methods = map[string]method{
+	"/dbhub.v1.DBHub/Databases": {handler: databasesCall},
+	"/dbhub.v1.DBHub/Download":  {handler: downloadCall},
+	"/dbhub.v1.DBHub/Metadata":  {handler: metadataCall},
+	"/dbhub.v1.DBHub/Query":     {handler: queryCall},
+	"/dbhub.v1.DBHub/Upload":    {handler: uploadCall, writePermission: true},
+}
+
+func main() {
+	// Read server configuration
+	var err error
+	if err = config.ReadConfig(); err != nil {
+		log.Fatalf("Configuration file problem: '%s'", err)
+	}
+
+	// Set the node name used in various logging strings
+	config.Conf.Live.Nodename = "gRPC API server"
+
+	// Set the temp dir environment variable, as uploads are received into temporary files
+	err = os.Setenv("TMPDIR", config.Conf.DiskCache.Directory)
+	if err != nil {
+		log.Fatalf("Setting temp directory environment variable failed: '%s'", err)
+	}
+
+	// Connect to the storage backend
+	err = com.ConnectBlobStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Connect to database
+	err = database.Connect()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Connect to the Memcached server
+	err = com.ConnectCache()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Start background goroutines to handle job queue responses
+	com.ResponseQueue = com.NewResponseQueue()
+	com.CheckResponsesQueue = make(chan struct{})
+	com.SubmitterInstance = com.RandomString(3)
+	go com.ResponseQueueCheck()
+	go com.ResponseQueueListen()
+
+	// Start background goroutine to keep the read only mode up to date
+	go com.MaintenanceLoop()
+
+	// Start background signal handler
+	exitSignal := make(chan struct{}, 1)
+	go com.SignalHandler(&exitSignal)
+
+	// gRPC needs HTTP/2, which net/http provides for TLS connections.  There's no overall read or write timeout, as
+	// uploads and downloads of large databases can take a while
+	s := &http.Server{
+		Addr:              config.Conf.GrpcApi.BindAddress,
+		ErrorLog:          com.HttpErrorLog(),
+		Handler:           http.HandlerFunc(serveCall),
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       5 * time.Minute,
+		MaxHeaderBytes:    1 << 20,
+		TLSConfig: &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		},
+	}
+
+	// Start gRPC API server
+	log.Printf("%s: listening on %s", config.Conf.Live.Nodename, config.Conf.GrpcApi.BindAddress)
+	go func() {
+		err := s.ListenAndServeTLS(config.Conf.GrpcApi.Certificate, config.Conf.GrpcApi.CertificateKey)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	// Wait for exit signal
+	<-exitSignal
+}
+
+// serveCall handles an incoming gRPC call, then logs it the same way as calls to the REST API
+func serveCall(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "This server only accepts gRPC requests", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// Send the response headers straight away.  The status of the call is sent afterwards, in the trailers
+	w.Header().Set("Content-Type", "application/grpc")
+	w.WriteHeader(http.StatusOK)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	t := time.Now()
+	c := &call{r: r, w: w}
+	code := writeStatus(w, c.run())
+	if c.user != "" {
+		database.ApiCallLog(c.key, c.user, c.dbOwner, c.dbName, r.URL.Path, r.UserAgent(), r.Method, httpFromCode(code),
+			time.Since(t), c.requestSize, c.responseSize)
+	}
+}
+
+// run authenticates a call, checks the user's usage limits, then runs it
+func (c *call) run() (err error) {
+	m, ok := methods[c.r.URL.Path]
+	if !ok {
+		return statusErrorf(codeUnimplemented, "Unknown method '%s'", c.r.URL.Path)
+	}
+
+	// Calls are authenticated with an API key in the "authorization" metadata, the same as for the v2 REST API
+	authHeader := c.r.Header.Get("Authorization")
+	if !strings.HasPrefix(strings.ToLower(authHeader), "apikey ") {
+		return statusErrorf(codeUnauthenticated, "No API key was provided")
+	}
+	user, key, err := database.GetAPIKeyBySecret(authHeader[7:])
+	if err != nil || user == "" {
+		return statusErrorf(codeUnauthenticated, "Unauthorised.  The provided API key doesn't have access.")
+	}
+	c.user = user
+	c.key = key
+
+	// Calls count towards the same usage limits as the REST API
+	allowed, err := com.CheckUsageLimits(user)
+	if err != nil {
+		return
+	}
+	if !allowed {
+		return statusErrorf(codeResourceExhausted, "Usage limit exceeded")
+	}
+
+	if m.writePermission && key.Permissions != database.MayReadAndWrite {
+		return statusErrorf(codePermissionDenied, "This function requires an API key with Write access.  The API "+
+			"key provided doesn't have it.")
+	}
+
+	// Calls which change things are refused while the server is in read only mode
+	if m.writePermission {
+		if ro, msg := com.ReadOnlyMode(); ro {
+			return statusErrorf(codeUnavailable, "%s", msg)
+		}
+	}
+	return m.handler(c)
+}
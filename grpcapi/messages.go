@@ -0,0 +1,350 @@
+package main
+
+// Encoding and decoding of the protocol buffer messages defined in dbhub.proto.  The field numbers here need to match
+// the ones in that file
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// DatabaseRequest identifies a database, and optionally a commit of it
+type DatabaseRequest struct {
+	Commit string
+	Name   string
+	Owner  string
+}
+
+// DatabasesRequest holds the filters for listing the databases in an account
+type DatabasesRequest struct {
+	Live     bool
+	Verified bool
+}
+
+// QueryRequest holds a SQL query to run on a database
+type QueryRequest struct {
+	Commit string
+	Name   string
+	Owner  string
+	SQL    string
+}
+
+// UploadInfo holds the details of a database upload, sent in the first message of an upload stream
+type UploadInfo struct {
+	Branch        string
+	Commit        string
+	CommitMessage string
+	Force         bool
+	LastModified  string
+	Licence       string
+	Name          string
+	Public        *bool
+	SourceURL     string
+}
+
+// UploadRequest is a message of an upload stream.  It holds either the upload details, or a chunk of the database
+type UploadRequest struct {
+	Chunk []byte
+	Info  *UploadInfo
+}
+
+// field is the value of a single field in an encoded message
+type field struct {
+	bytes  []byte
+	varint uint64
+}
+
+func (f field) bool() bool {
+	return f.varint != 0
+}
+
+func (f field) string() (string, error) {
+	if !utf8.Valid(f.bytes) {
+		return "", fmt.Errorf("String field contains invalid UTF-8")
+	}
+	return string(f.bytes), nil
+}
+
+// parseMessage calls fn for each varint and length delimited field of an encoded message.  Fields of other wire types
+// aren't used by any of our messages, so they're skipped
+func parseMessage(b []byte, fn func(num protowire.Number, f field) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var f field
+		switch typ {
+		case protowire.VarintType:
+			f.varint, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if typ != protowire.VarintType && typ != protowire.BytesType {
+			continue
+		}
+		if err := fn(num, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *DatabaseRequest) unmarshal(b []byte) error {
+	return parseMessage(b, func(num protowire.Number, f field) (err error) {
+		switch num {
+		case 1:
+			m.Owner, err = f.string()
+		case 2:
+			m.Name, err = f.string()
+		case 3:
+			m.Commit, err = f.string()
+		}
+		return
+	})
+}
+
+func (m *DatabasesRequest) unmarshal(b []byte) error {
+	return parseMessage(b, func(num protowire.Number, f field) error {
+		switch num {
+		case 1:
+			m.Live = f.bool()
+		case 2:
+			m.Verified = f.bool()
+		}
+		return nil
+	})
+}
+
+func (m *QueryRequest) unmarshal(b []byte) error {
+	return parseMessage(b, func(num protowire.Number, f field) (err error) {
+		switch num {
+		case 1:
+			m.Owner, err = f.string()
+		case 2:
+			m.Name, err = f.string()
+		case 3:
+			m.Commit, err = f.string()
+		case 4:
+			m.SQL, err = f.string()
+		}
+		return
+	})
+}
+
+func (m *UploadInfo) unmarshal(b []byte) error {
+	return parseMessage(b, func(num protowire.Number, f field) (err error) {
+		switch num {
+		case 1:
+			m.Name, err = f.string()
+		case 2:
+			m.Branch, err = f.string()
+		case 3:
+			m.Commit, err = f.string()
+		case 4:
+			m.CommitMessage, err = f.string()
+		case 5:
+			m.SourceURL, err = f.string()
+		case 6:
+			m.Licence, err = f.string()
+		case 7:
+			m.LastModified, err = f.string()
+		case 8:
+			public := f.bool()
+			m.Public = &public
+		case 9:
+			m.Force = f.bool()
+		}
+		return
+	})
+}
+
+func (m *UploadRequest) unmarshal(b []byte) error {
+	return parseMessage(b, func(num protowire.Number, f field) error {
+		switch num {
+		case 1:
+			m.Info = &UploadInfo{}
+			return m.Info.unmarshal(f.bytes)
+		case 2:
+			m.Chunk = f.bytes
+		}
+		return nil
+	})
+}
+
+// appendBool appends a boolean field, leaving it out when it has the default value
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, protowire.EncodeBool(v))
+}
+
+// appendBytes appends a length delimited field.  Unlike the other append functions, the field is always included, as
+// it's also used for repeated fields and embedded messages
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// appendInt appends an integer field, leaving it out when it has the default value
+func appendInt(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+// appendString appends a string field, leaving it out when it has the default value
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+// appendTime appends a timestamp as an RFC 3339 string field
+func appendTime(b []byte, num protowire.Number, t time.Time) []byte {
+	if t.IsZero() {
+		return b
+	}
+	return appendString(b, num, t.UTC().Format(time.RFC3339))
+}
+
+// marshalDatabases encodes a DatabasesResponse message
+func marshalDatabases(names []string) (b []byte) {
+	for _, n := range names {
+		b = appendBytes(b, 1, []byte(n))
+	}
+	return
+}
+
+// marshalDownloadChunk encodes a DownloadChunk message
+func marshalDownloadChunk(data []byte) []byte {
+	return appendBytes(nil, 1, data)
+}
+
+// marshalMetadata encodes a MetadataResponse message.  Branches, releases and tags are sorted by name, and commits
+// from newest to oldest
+func marshalMetadata(meta com.MetadataResponseContainer) (b []byte) {
+	b = appendString(b, 1, meta.DefBranch)
+
+	for _, name := range sortedKeys(meta.Branches) {
+		br := meta.Branches[name]
+		var m []byte
+		m = appendString(m, 1, name)
+		m = appendString(m, 2, br.Commit)
+		m = appendInt(m, 3, int64(br.CommitCount))
+		m = appendString(m, 4, br.Description)
+		b = appendBytes(b, 2, m)
+	}
+
+	commitIDs := sortedKeys(meta.Commits)
+	sort.SliceStable(commitIDs, func(i, j int) bool {
+		return meta.Commits[commitIDs[i]].Timestamp.After(meta.Commits[commitIDs[j]].Timestamp)
+	})
+	for _, id := range commitIDs {
+		c := meta.Commits[id]
+		var m []byte
+		m = appendString(m, 1, c.ID)
+		m = appendString(m, 2, c.Parent)
+		for _, p := range c.OtherParents {
+			m = appendBytes(m, 3, []byte(p))
+		}
+		m = appendString(m, 4, c.Message)
+		m = appendString(m, 5, c.AuthorName)
+		m = appendString(m, 6, c.AuthorEmail)
+		m = appendString(m, 7, c.CommitterName)
+		m = appendString(m, 8, c.CommitterEmail)
+		m = appendTime(m, 9, c.Timestamp)
+		b = appendBytes(b, 3, m)
+	}
+
+	for _, name := range sortedKeys(meta.Releases) {
+		r := meta.Releases[name]
+		var m []byte
+		m = appendString(m, 1, name)
+		m = appendString(m, 2, r.Commit)
+		m = appendTime(m, 3, r.Date)
+		m = appendString(m, 4, r.Description)
+		m = appendString(m, 5, r.ReleaserName)
+		m = appendString(m, 6, r.ReleaserEmail)
+		m = appendInt(m, 7, r.Size)
+		b = appendBytes(b, 4, m)
+	}
+
+	for _, name := range sortedKeys(meta.Tags) {
+		t := meta.Tags[name]
+		var m []byte
+		m = appendString(m, 1, name)
+		m = appendString(m, 2, t.Commit)
+		m = appendTime(m, 3, t.Date)
+		m = appendString(m, 4, t.Description)
+		m = appendString(m, 5, t.TaggerName)
+		m = appendString(m, 6, t.TaggerEmail)
+		b = appendBytes(b, 5, m)
+	}
+
+	b = appendBool(b, 6, meta.Verified)
+	b = appendString(b, 7, meta.WebPage)
+	b = appendBool(b, 8, meta.Archived)
+	return
+}
+
+// marshalQueryResult encodes a QueryResponse message.  The value types match the ValType constants of the common
+// package, so they're used as is
+func marshalQueryResult(data com.SQLiteRecordSet) (b []byte) {
+	for _, c := range data.ColNames {
+		b = appendBytes(b, 1, []byte(c))
+	}
+	for _, row := range data.Records {
+		var r []byte
+		for _, v := range row {
+			var m []byte
+			m = appendString(m, 1, v.Name)
+			m = appendInt(m, 2, int64(v.Type))
+			switch val := v.Value.(type) {
+			case nil:
+			case string:
+				m = appendString(m, 3, val)
+			default:
+				m = appendString(m, 3, fmt.Sprint(val))
+			}
+			r = appendBytes(r, 1, m)
+		}
+		b = appendBytes(b, 2, r)
+	}
+	return
+}
+
+// marshalUploadResult encodes an UploadResponse message
+func marshalUploadResult(commitID, url string) (b []byte) {
+	b = appendString(b, 1, commitID)
+	b = appendString(b, 2, url)
+	return
+}
+
+// sortedKeys returns the keys of a map in alphabetical order
+func sortedKeys[T any](m map[string]T) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
+}
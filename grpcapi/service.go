@@ -0,0 +1,274 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strconv"
+
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// checkDatabase validates the database a call is for, and checks the user has access to it
+func (c *call) checkDatabase(dbOwner, dbName, commitID string) error {
+	if err := com.ValidateUserDB(dbOwner, dbName); err != nil {
+		return statusErrorf(codeInvalidArgument, "Invalid database owner or name")
+	}
+	if commitID != "" {
+		if err := com.ValidateCommitID(commitID); err != nil {
+			return statusErrorf(codeInvalidArgument, "Invalid commit ID")
+		}
+	}
+	c.dbOwner = dbOwner
+	c.dbName = dbName
+
+	exists, err := database.CheckDBPermissions(c.user, dbOwner, dbName, false)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return statusErrorf(codeNotFound, "Database does not exist, or user isn't authorised to access it")
+	}
+	return nil
+}
+
+// databasesCall returns the names of the databases in the user's account
+func databasesCall(c *call) error {
+	var req DatabasesRequest
+	if err := c.recv(&req); err != nil {
+		return err
+	}
+
+	// Retrieve the list of live or standard databases
+	var dbs []database.DBInfo
+	var err error
+	if req.Live {
+		dbs, err = com.LiveUserDBs(c.user, database.DB_BOTH, database.DBOrderCreated, database.DBFilter{})
+	} else {
+		dbs, err = database.UserDBs(c.user, database.DB_BOTH, database.DBOrderModified, database.DBFilter{})
+	}
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, j := range dbs {
+		if req.Verified && !j.Verified {
+			continue
+		}
+		names = append(names, j.Database)
+	}
+	return c.send(marshalDatabases(names))
+}
+
+// downloadCall sends a database file to the client, as a stream of chunks
+func downloadCall(c *call) error {
+	var req DatabaseRequest
+	if err := c.recv(&req); err != nil {
+		return err
+	}
+	if err := c.checkDatabase(req.Owner, req.Name, req.Commit); err != nil {
+		return err
+	}
+	_, err := com.DownloadDatabase(&chunkWriter{c: c}, c.r, req.Owner, req.Name, req.Commit, c.user, "grpc")
+	return err
+}
+
+// metadataCall returns the branches, commits, releases and tags of a database
+func metadataCall(c *call) error {
+	var req DatabaseRequest
+	if err := c.recv(&req); err != nil {
+		return err
+	}
+	if err := c.checkDatabase(req.Owner, req.Name, ""); err != nil {
+		return err
+	}
+
+	// Live databases don't have any of this
+	isLive, _, err := database.CheckDBLive(req.Owner, req.Name)
+	if err != nil {
+		return err
+	}
+	if isLive {
+		return statusErrorf(codeFailedPrecondition, "That database is a live database.  It doesn't support metadata.")
+	}
+
+	meta, err := com.MetadataResponse(req.Owner, req.Name)
+	if err != nil {
+		return err
+	}
+	return c.send(marshalMetadata(meta))
+}
+
+// queryCall runs a read only SQL query on a database, returning the result set
+func queryCall(c *call) error {
+	var req QueryRequest
+	if err := c.recv(&req); err != nil {
+		return err
+	}
+	if err := c.checkDatabase(req.Owner, req.Name, req.Commit); err != nil {
+		return err
+	}
+	query, err := com.CheckUnicode(req.SQL, false)
+	if err != nil {
+		return statusErrorf(codeInvalidArgument, "%s", err)
+	}
+
+	// Check if the database is a live database, and get the node/queue to send the request to
+	isLive, liveNode, err := database.CheckDBLive(req.Owner, req.Name)
+	if err != nil {
+		return err
+	}
+	if isLive && liveNode == "" {
+		return statusErrorf(codeInternal, "No job queue node available for request")
+	}
+
+	// Run the query
+	var data com.SQLiteRecordSet
+	if !isLive {
+		data, err = com.SQLiteRunQueryDefensive(&discardWriter{}, c.r, com.QuerySourceAPI, req.Owner, req.Name, req.Commit,
+			c.user, query)
+	} else {
+		data, err = com.LiveQuery(liveNode, c.user, req.Owner, req.Name, query)
+	}
+	if err != nil {
+		return err
+	}
+	return c.send(marshalQueryResult(data))
+}
+
+// uploadCall creates a new database in the user's account, or adds a new commit to an existing one.  The first message
+// sent by the client holds the details of the upload, and the following ones hold the chunks of the database file
+func uploadCall(c *call) error {
+	var req UploadRequest
+	err := c.recv(&req)
+	if errors.Is(err, io.EOF) || (err == nil && req.Info == nil) {
+		return statusErrorf(codeInvalidArgument, "The first message of an upload needs to hold its details")
+	}
+	if err != nil {
+		return err
+	}
+	info := req.Info
+
+	// Uploads always go into the account of the API key user.  Unlike with the REST API there's no file name to fall
+	// back to, so the database name is required
+	if err = c.checkUpload(info); err != nil {
+		return err
+	}
+
+	// Receive the database file into a temporary file, making sure it doesn't go over the user's upload size limit
+	maxSize, err := database.MaxUploadSizeForUser(c.user)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp("", "grpc-upload-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	var size int64
+	for {
+		var chunk UploadRequest
+		err = c.recv(&chunk)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if chunk.Info != nil {
+			return statusErrorf(codeInvalidArgument, "Only the first message of an upload can hold its details")
+		}
+		size += int64(len(chunk.Chunk))
+		if maxSize != -1 && size > maxSize {
+			log.Printf("'%s' attempted to upload an oversized database over gRPC.  Limit is %d MB", c.user,
+				maxSize/1024/1024)
+			return statusErrorf(codeResourceExhausted, "Database is too large. Maximum database upload size is %d MB",
+				maxSize/1024/1024)
+		}
+		if _, err = f.Write(chunk.Chunk); err != nil {
+			return err
+		}
+	}
+	if size == 0 {
+		return statusErrorf(codeInvalidArgument, "No database file was sent")
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	// Process the upload with the same code as the other daemons, which expects it as a multipart form
+	r, done := uploadForm(c.r, info, f)
+	defer done()
+	retMsg, httpStatus, err := com.UploadResponse(&discardWriter{}, r, c.user, c.user, info.Name, info.Commit, "grpc")
+	if err != nil {
+		return statusErrorf(codeFromHTTP(httpStatus), "%s", err)
+	}
+	return c.send(marshalUploadResult(retMsg["commit_id"], retMsg["url"]))
+}
+
+// checkUpload validates the details of an upload
+func (c *call) checkUpload(info *UploadInfo) error {
+	if err := com.ValidateDB(info.Name); err != nil {
+		return statusErrorf(codeInvalidArgument, "Invalid database name")
+	}
+	if info.Commit != "" {
+		if err := com.ValidateCommitID(info.Commit); err != nil {
+			return statusErrorf(codeInvalidArgument, "Invalid commit ID")
+		}
+	}
+	c.dbOwner = c.user
+	c.dbName = info.Name
+	return nil
+}
+
+// uploadForm returns a request holding an upload as a multipart form, the way the REST API receives them.  The form
+// is streamed from the temporary file, and the returned function needs to be called once the request has been
+// processed
+func uploadForm(orig *http.Request, info *UploadInfo, f *os.File) (r *http.Request, done func()) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		fields := map[string]string{
+			"branch":       info.Branch,
+			"commitmsg":    info.CommitMessage,
+			"lastmodified": info.LastModified,
+			"licence":      info.Licence,
+			"sourceurl":    info.SourceURL,
+		}
+		if info.Force {
+			fields["force"] = "true"
+		}
+		if info.Public != nil {
+			fields["public"] = strconv.FormatBool(*info.Public)
+		}
+		for name, value := range fields {
+			if value == "" {
+				continue
+			}
+			if err := mw.WriteField(name, value); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		w, err := mw.CreateFormFile("file", info.Name)
+		if err == nil {
+			_, err = io.Copy(w, f)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	r, _ = http.NewRequest(http.MethodPost, "/", pr)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	r.Header.Set("User-Agent", orig.UserAgent())
+	r.RemoteAddr = orig.RemoteAddr
+	return r, func() { pr.Close() }
+}
@@ -45,8 +45,15 @@ func main() {
 		}
 	}
 
-	// Connect to Minio server
-	err = com.ConnectMinio()
+	// Connect to the storage backend
+	err = com.ConnectBlobStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Connect to the cache server, so the cached details of the databases automatic versions are committed to can be
+	// refreshed
+	err = com.ConnectCache()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -66,6 +73,20 @@ func main() {
 	go com.JobQueueCheck()
 	go com.JobQueueListen()
 
+	// Launch the replication of live databases to external servers.  It and the other goroutines given the shutdown
+	// context finish off their work when the daemon is shut down
+	com.BackgroundLoops.Add(4)
+	go com.LiveReplicationLoop(com.ShutdownContext, &com.BackgroundLoops)
+
+	// Launch the automatic versioning of live databases into standard databases
+	go com.LiveAutoVersionLoop(com.ShutdownContext, &com.BackgroundLoops)
+
+	// Launch the scheduled transformations of live databases
+	go com.TransformationLoop(com.ShutdownContext, &com.BackgroundLoops)
+
+	// Launch the eviction of idle databases, and the reporting of the node statistics
+	go com.LiveLifecycleLoop(com.ShutdownContext, &com.BackgroundLoops)
+
 	// Launch goroutine event generator for checking submitted jobs
 	// NOTE: This seems to work fine, but is kind of a pita to have enabled while developing this code atm.  So we disable it for now.
 	// TODO: Instead of this, should we run some code on startup of the live nodes that checks the database for
@@ -67,7 +67,7 @@ func main() {
 			}
 
 			// Get the list of standard databases for a user
-			dbList, err := database.UserDBs(user, database.DB_BOTH)
+			dbList, err := database.UserDBs(user, database.DB_BOTH, database.DBOrderModified, database.DBFilter{})
 			if err != nil {
 				log.Fatal(err)
 			}
@@ -95,7 +95,7 @@ func main() {
 			}
 
 			// Get the list of live databases for a user
-			liveList, err := com.LiveUserDBs(user, database.DB_BOTH)
+			liveList, err := com.LiveUserDBs(user, database.DB_BOTH, database.DBOrderCreated, database.DBFilter{})
 			if err != nil {
 				log.Fatal(err)
 			}
@@ -147,7 +147,7 @@ func main() {
 			}
 
 			// Get the list of standard databases for a user
-			dbList, err := database.UserDBs(user, database.DB_BOTH)
+			dbList, err := database.UserDBs(user, database.DB_BOTH, database.DBOrderModified, database.DBFilter{})
 			if err != nil {
 				log.Fatal(err)
 			}
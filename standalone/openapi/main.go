@@ -0,0 +1,650 @@
+package main
+
+// Stand alone utility to generate the OpenAPI document for the API server, and the Go client package from it.  The
+// document is built from the route definitions in api/main.go, and the doc comments of the handlers.  The parameters
+// of each end point are taken from the list of parameters in its doc comment, eg:
+//
+//	* "dbowner" is the owner of the database
+//	* "limit" is the (optional) maximum number of databases to return, up to 100.  Defaults to 25
+//
+// Parameters mentioned as "(optional)" aren't required, ones described as a "boolean" are booleans, and ones which
+// are a "number of" something or the "ID of the" something are integers.
+//
+// Run it from the root of the source tree after changing the API, to update api/openapi.json and client/endpoints.go:
+//
+//	$ go run ./standalone/openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// The version of the OpenAPI specification the generated document follows
+	openAPIVersion = "3.0.3"
+
+	// The version of the DBHub.io API described by the document
+	apiVersion = "1.0"
+)
+
+// Endpoints returning something other than JSON when successful, and the content type they return
+var nonJSONResponses = map[string]string{
+	"/v1/download":  "application/x-sqlite3",
+	"/v1/licence":   "text/plain",
+	"/v1/migration": "application/sql",
+}
+
+// Endpoints which aren't plain HTTP requests, so can't be described in the OpenAPI document
+var skippedRoutes = map[string]bool{
+	"/v2/pages/:dbowner/:dbname/:commit": true, // Byte ranges of a file, for SQLite HTTP VFS clients
+	"/v2/subscribe":                      true, // WebSocket
+	"/v1/testfixtures":                   true, // Only available in the test environment
+}
+
+var (
+	// Matches the names at the start of a parameter line, eg `"dbowner" and "dbname" are`
+	paramNamesRegex = regexp.MustCompile(`^\* ((?:"[^"]+"(?:, and |, | and )?)+)`)
+	quotedRegex     = regexp.MustCompile(`"([^"]+)"`)
+
+	// Matches the descriptions of integer parameters
+	integerRegex = regexp.MustCompile(`number of|ID of the`)
+
+	// Matches the line of a doc comment where the curl example starts
+	exampleRegex = regexp.MustCompile(`^This can be run from the command line`)
+
+	// Matches doc comment lines which just give the HTTP method and path, eg "GET /v2/status"
+	methodLineRegex = regexp.MustCompile(`^(GET|POST|PUT|PATCH|DELETE) /`)
+)
+
+// Document is the top level of an OpenAPI document.  Only the parts used by the DBHub.io API are included
+type Document struct {
+	Components Components           `json:"components"`
+	Info       Info                 `json:"info"`
+	OpenAPI    string               `json:"openapi"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Servers    []Server             `json:"servers"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes"`
+}
+
+type Info struct {
+	Description string `json:"description"`
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Operation is a single API call.  The extension fields hold details needed by the client generator
+type Operation struct {
+	Description     string                `json:"description,omitempty"`
+	OperationID     string                `json:"operationId"`
+	RequestBody     *RequestBody          `json:"requestBody,omitempty"`
+	Responses       map[string]*Response  `json:"responses"`
+	Security        []map[string][]string `json:"security,omitempty"`
+	Summary         string                `json:"summary"`
+	Tags            []string              `json:"tags"`
+	WritePermission bool                  `json:"x-write-permission,omitempty"`
+}
+
+type PathItem struct {
+	Get  *Operation `json:"get,omitempty"`
+	Post *Operation `json:"post,omitempty"`
+}
+
+type RequestBody struct {
+	Content  map[string]*MediaType `json:"content"`
+	Required bool                  `json:"required"`
+}
+
+type Response struct {
+	Content     map[string]*MediaType `json:"content,omitempty"`
+	Description string                `json:"description"`
+}
+
+type Schema struct {
+	Description string             `json:"description,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Ref         string             `json:"$ref,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Type        string             `json:"type,omitempty"`
+	XOrder      []string           `json:"x-order,omitempty"`
+}
+
+type SecurityScheme struct {
+	Description string `json:"description,omitempty"`
+	In          string `json:"in"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+// route is an API end point registered in api/main.go
+type route struct {
+	Handler         string
+	Method          string
+	Path            string
+	WritePermission bool
+}
+
+func main() {
+	handlers, err := handlerDocs("api")
+	if err != nil {
+		log.Fatal(err)
+	}
+	routes, err := apiRoutes(filepath.Join("api", "main.go"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Generate the OpenAPI document
+	doc := buildDocument(routes, handlers)
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join("api", "openapi.json"), append(data, '\n'), 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Generate the client from the document just written
+	var written Document
+	err = json.Unmarshal(data, &written)
+	if err != nil {
+		log.Fatal(err)
+	}
+	src, err := clientSource(written)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join("client", "endpoints.go"), src, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Generated the OpenAPI document and client for %d end points", len(routes))
+}
+
+// apiRoutes returns the v1 and v2 API routes registered in the given source file
+func apiRoutes(path string) (routes []route, err error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, nil, 0)
+	if err != nil {
+		return
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) < 2 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		group, ok := sel.X.(*ast.Ident)
+		if !ok || (group.Name != "v1" && group.Name != "v2") {
+			return true
+		}
+		lit, ok := call.Args[0].(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return true
+		}
+		handler, ok := call.Args[len(call.Args)-1].(*ast.Ident)
+		if !ok {
+			return true
+		}
+		p, _ := strconv.Unquote(lit.Value)
+		if skippedRoutes["/"+group.Name+p] {
+			return true
+		}
+		r := route{
+			Handler: handler.Name,
+			Method:  sel.Sel.Name,
+			Path:    "/" + group.Name + p,
+		}
+		for _, a := range call.Args[1 : len(call.Args)-1] {
+			if id, ok := a.(*ast.Ident); ok && id.Name == "authRequireWritePermission" {
+				r.WritePermission = true
+			}
+		}
+		routes = append(routes, r)
+		return true
+	})
+	return
+}
+
+// buildDocument generates the OpenAPI document for the given routes
+func buildDocument(routes []route, handlers map[string]string) (doc Document) {
+	doc.OpenAPI = openAPIVersion
+	doc.Info = Info{
+		Title:       "DBHub.io API",
+		Description: "The API for DBHub.io, for working with your SQLite databases.  Calls to the v1 end points are authenticated by including one of your API keys in the \"apikey\" form field.",
+		Version:     apiVersion,
+	}
+	doc.Servers = []Server{{URL: "https://api.dbhub.io"}}
+	doc.Paths = make(map[string]*PathItem)
+	doc.Components = Components{
+		Schemas: map[string]*Schema{
+			"Error": {
+				Type:       "object",
+				Properties: map[string]*Schema{"error": {Type: "string", Description: "A description of what went wrong"}},
+			},
+		},
+		SecuritySchemes: map[string]*SecurityScheme{
+			"ApiKeyHeader": {
+				Type:        "apiKey",
+				In:          "header",
+				Name:        "Authorization",
+				Description: "One of your API keys, given as \"apikey YOUR_API_KEY_HERE\"",
+			},
+		},
+	}
+
+	for _, r := range routes {
+		summary, description, params := parseDoc(r.Handler, handlers[r.Handler])
+		op := &Operation{
+			OperationID:     strings.TrimSuffix(r.Handler, "Handler"),
+			Summary:         summary,
+			Description:     description,
+			Tags:            []string{strings.Split(r.Path, "/")[1]},
+			WritePermission: r.WritePermission,
+			Responses: map[string]*Response{
+				"default": {
+					Description: "An error",
+					Content:     map[string]*MediaType{"application/json": {Schema: &Schema{Ref: "#/components/schemas/Error"}}},
+				},
+			},
+		}
+		if r.WritePermission {
+			op.Description = strings.TrimSpace(op.Description + "\n\nThis requires an API key with write access.")
+		}
+
+		// The successful response
+		contentType := "application/json"
+		schema := &Schema{}
+		if ct, ok := nonJSONResponses[r.Path]; ok {
+			contentType = ct
+			schema = &Schema{Type: "string", Format: "binary"}
+		}
+		op.Responses["200"] = &Response{
+			Description: "Success",
+			Content:     map[string]*MediaType{contentType: {Schema: schema}},
+		}
+
+		// The v2 end points are authenticated with a header, rather than a form field
+		if strings.HasPrefix(r.Path, "/v2/") {
+			op.Security = []map[string][]string{{"ApiKeyHeader": {}}}
+			params = removeParam(params, "apikey")
+		}
+
+		// The request parameters are sent as a form
+		if len(params) > 0 {
+			body := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+			formType := "application/x-www-form-urlencoded"
+			for _, p := range params {
+				body.Properties[p.Name] = p.Schema
+				body.XOrder = append(body.XOrder, p.Name)
+				if p.Required {
+					body.Required = append(body.Required, p.Name)
+				}
+				if p.Schema.Format == "binary" {
+					formType = "multipart/form-data"
+				}
+			}
+			op.RequestBody = &RequestBody{
+				Required: len(body.Required) > 0,
+				Content:  map[string]*MediaType{formType: {Schema: body}},
+			}
+		}
+
+		item, ok := doc.Paths[r.Path]
+		if !ok {
+			item = &PathItem{}
+			doc.Paths[r.Path] = item
+		}
+		switch r.Method {
+		case "GET":
+			item.Get = op
+		default:
+			item.Post = op
+		}
+	}
+	return
+}
+
+// handlerDocs returns the doc comments of the functions in the Go source files of a directory
+func handlerDocs(dir string) (docs map[string]string, err error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, nil, parser.ParseComments)
+	if err != nil {
+		return
+	}
+	docs = make(map[string]string)
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Files {
+			for _, d := range f.Decls {
+				fn, ok := d.(*ast.FuncDecl)
+				if ok && fn.Doc != nil {
+					docs[fn.Name.Name] = fn.Doc.Text()
+				}
+			}
+		}
+	}
+	return
+}
+
+// param is a request parameter of an end point
+type param struct {
+	Name     string
+	Required bool
+	Schema   *Schema
+}
+
+// parseDoc extracts the summary, description, and parameters of an end point from the doc comment of its handler
+func parseDoc(handler, doc string) (summary, description string, params []param) {
+	var descLines []string
+	inDesc := true
+	var current []string
+	addParam := func() {
+		if len(current) == 0 {
+			return
+		}
+		text := strings.Join(current, " ")
+		current = nil
+		m := paramNamesRegex.FindStringSubmatch(text)
+		if m == nil {
+			return
+		}
+		rest := strings.TrimSpace(strings.TrimPrefix(text, m[0]))
+		for _, prefix := range []string{"(optional) ", "is ", "are ", "(optional), ", "(optional) "} {
+			rest = strings.TrimPrefix(rest, prefix)
+		}
+		optional := strings.Contains(strings.ToLower(text), "optional")
+		for _, n := range quotedRegex.FindAllStringSubmatch(m[1], -1) {
+			name := n[1]
+			if hasParam(params, name) {
+				continue
+			}
+			s := &Schema{Type: "string", Description: upperFirst(rest)}
+			switch {
+			case name == "file":
+				s.Format = "binary"
+			case strings.Contains(text, "boolean"):
+				s.Type = "boolean"
+			case integerRegex.MatchString(text):
+				s.Type = "integer"
+			}
+			params = append(params, param{Name: name, Required: !optional, Schema: s})
+		}
+	}
+
+	for _, line := range strings.Split(doc, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if inDesc {
+			if exampleRegex.MatchString(trimmed) || strings.HasPrefix(line, "\t") {
+				inDesc = false
+			} else {
+				if trimmed != "" && !methodLineRegex.MatchString(trimmed) {
+					descLines = append(descLines, trimmed)
+				}
+				continue
+			}
+		}
+
+		// Parameter lines start with "* ", and may carry on over the following indented lines
+		switch {
+		case strings.HasPrefix(trimmed, "* "):
+			addParam()
+			current = []string{trimmed}
+		case len(current) > 0 && strings.HasPrefix(line, "\t  ") && trimmed != "":
+			current = append(current, trimmed)
+		default:
+			addParam()
+		}
+	}
+	addParam()
+
+	// The description starts with the handler name, which isn't useful outside the source code
+	description = strings.TrimSpace(strings.Join(descLines, " "))
+	description = strings.TrimSpace(strings.TrimPrefix(description, handler))
+	description = upperFirst(description)
+	summary = description
+	if i := strings.Index(summary, ".  "); i != -1 {
+		summary = summary[:i]
+	}
+	summary = strings.TrimSuffix(summary, ".")
+	return
+}
+
+// hasParam checks whether a parameter is in a list of parameters
+func hasParam(params []param, name string) bool {
+	for _, p := range params {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// removeParam removes a parameter from a list of parameters
+func removeParam(params []param, name string) (list []param) {
+	for _, p := range params {
+		if p.Name != name {
+			list = append(list, p)
+		}
+	}
+	return
+}
+
+// upperFirst returns the string with its first letter in upper case
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	r := []rune(s)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// Words in parameter names which are written differently in Go field names
+var goWords = map[string]string{
+	"ckanurl":      "CKANURL",
+	"comid":        "ComID",
+	"commitmsg":    "CommitMsg",
+	"dbemail":      "DBEmail",
+	"dbname":       "DBName",
+	"dbowner":      "DBOwner",
+	"dbwatch":      "DBWatch",
+	"dependson":    "DependsOn",
+	"discid":       "DiscID",
+	"fromcommit":   "FromCommit",
+	"dsn":          "DSN",
+	"id":           "ID",
+	"ids":          "IDs",
+	"keepupdated":  "KeepUpdated",
+	"lastmodified": "LastModified",
+	"maxrows":      "MaxRows",
+	"minrows":      "MinRows",
+	"onwrite":      "OnWrite",
+	"schemaonly":   "SchemaOnly",
+	"sourceurl":    "SourceURL",
+	"sql":          "SQL",
+	"targeturl":    "TargetURL",
+}
+
+// goName converts a parameter or operation name into an exported Go name.  eg "include_data" becomes "IncludeData"
+func goName(name string) string {
+	var b strings.Builder
+	for _, w := range strings.Split(name, "_") {
+		if g, ok := goWords[strings.ToLower(w)]; ok {
+			b.WriteString(g)
+		} else {
+			b.WriteString(upperFirst(w))
+		}
+	}
+	return b.String()
+}
+
+// clientSource generates the source code of the client methods for the end points in an OpenAPI document
+func clientSource(doc Document) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("// Code generated by standalone/openapi from api/openapi.json. DO NOT EDIT.\n\n")
+	b.WriteString("package client\n\n")
+	b.WriteString("import (\n\t\"context\"\n\t\"io\"\n)\n\n")
+	b.WriteString("// Make sure the io package is used, even when no end point takes a file\nvar _ io.Reader\n")
+
+	paths := make([]string, 0, len(doc.Paths))
+	for p := range doc.Paths {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		item := doc.Paths[path]
+		for _, m := range []struct {
+			method string
+			op     *Operation
+		}{{"GET", item.Get}, {"POST", item.Post}} {
+			if m.op == nil {
+				continue
+			}
+			writeClientMethod(&b, path, m.method, m.op)
+		}
+	}
+	return format.Source(b.Bytes())
+}
+
+// writeClientMethod writes the parameter type and the client method for an API call
+func writeClientMethod(b *bytes.Buffer, path, method string, op *Operation) {
+	name := goName(op.OperationID)
+	if strings.HasPrefix(path, "/v2/") {
+		name += "V2"
+	}
+	headerAuth := len(op.Security) > 0
+
+	// Collect the parameters, leaving out the API key as the client adds that itself
+	var body *Schema
+	if op.RequestBody != nil {
+		for _, mt := range op.RequestBody.Content {
+			body = mt.Schema
+		}
+	}
+	var names []string
+	required := make(map[string]bool)
+	if body != nil {
+		for _, n := range body.XOrder {
+			if n != "apikey" {
+				names = append(names, n)
+			}
+		}
+		for _, n := range body.Required {
+			required[n] = true
+		}
+	}
+
+	// The response is written out as is for non JSON responses, and decoded otherwise
+	binary := false
+	if r, ok := op.Responses["200"]; ok {
+		for _, mt := range r.Content {
+			binary = mt.Schema != nil && mt.Schema.Format == "binary"
+		}
+	}
+
+	// The parameter type
+	paramsType := ""
+	if len(names) > 0 {
+		paramsType = name + "Params"
+		fmt.Fprintf(b, "\n// %s holds the parameters for %s\ntype %s struct {\n", paramsType, name, paramsType)
+		for _, n := range names {
+			s := body.Properties[n]
+			goType := "string"
+			switch {
+			case s.Format == "binary":
+				goType = "io.Reader"
+			case s.Type == "boolean" && required[n]:
+				goType = "bool"
+			case s.Type == "boolean":
+				goType = "*bool"
+			case s.Type == "integer" && required[n]:
+				goType = "int"
+			case s.Type == "integer":
+				goType = "*int"
+			}
+			if s.Description != "" {
+				fmt.Fprintf(b, "\t// %s\n", strings.ReplaceAll(s.Description, "\n", " "))
+			}
+			fmt.Fprintf(b, "\t%s %s\n", goName(n), goType)
+		}
+		b.WriteString("}\n")
+	}
+
+	// The method
+	doc := op.Summary
+	if doc == "" {
+		doc = "Calls " + path
+	}
+	fmt.Fprintf(b, "\n// %s %s (%s %s)\n", name, lowerFirst(doc), method, path)
+	outName, outType, outDoc := "out", "interface{}", "The response is decoded into out, unless it's nil"
+	if binary {
+		outName, outType, outDoc = "w", "io.Writer", "The response is written to w"
+	}
+	fmt.Fprintf(b, "// %s\n", outDoc)
+	if paramsType != "" {
+		fmt.Fprintf(b, "func (c *Client) %s(ctx context.Context, p %s, %s %s) error {\n", name, paramsType, outName, outType)
+	} else {
+		fmt.Fprintf(b, "func (c *Client) %s(ctx context.Context, %s %s) error {\n", name, outName, outType)
+	}
+	b.WriteString("\tf := newForm()\n")
+	for _, n := range names {
+		s := body.Properties[n]
+		field := "p." + goName(n)
+		switch {
+		case s.Format == "binary":
+			fmt.Fprintf(b, "\tf.file(%q, %s)\n", n, field)
+		case s.Type == "boolean" && required[n]:
+			fmt.Fprintf(b, "\tf.bool(%q, %s)\n", n, field)
+		case s.Type == "boolean":
+			fmt.Fprintf(b, "\tf.optionalBool(%q, %s)\n", n, field)
+		case s.Type == "integer" && required[n]:
+			fmt.Fprintf(b, "\tf.int(%q, %s)\n", n, field)
+		case s.Type == "integer":
+			fmt.Fprintf(b, "\tf.optionalInt(%q, %s)\n", n, field)
+		case required[n]:
+			fmt.Fprintf(b, "\tf.string(%q, %s)\n", n, field)
+		default:
+			fmt.Fprintf(b, "\tf.optionalString(%q, %s)\n", n, field)
+		}
+	}
+	fmt.Fprintf(b, "\treturn c.call(ctx, %q, %q, %t, f, %s)\n}\n", method, path, headerAuth, outName)
+}
+
+// lowerFirst returns the string with its first letter in lower case
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
@@ -0,0 +1,99 @@
+package main
+
+// Stand alone (non-daemon) utility to rotate the instance keys used for encrypting the database files.  After adding a
+// new key to the config file and making it the current key, run this to encrypt the user keys and the data keys of
+// the stored database files with it.  The old key can be removed from the config file once this has finished without
+// errors.  Run with --encrypt-existing to also encrypt the database files stored before encryption was enabled
+
+import (
+	"log"
+	"os"
+
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+var (
+	// EncryptExisting controls whether database files which aren't encrypted yet are encrypted
+	EncryptExisting = false
+)
+
+func main() {
+	// Read server configuration
+	err := config.ReadConfig()
+	if err != nil {
+		log.Fatalf("Configuration file problem: '%s'", err)
+	}
+	if !config.Conf.Encryption.Enabled {
+		log.Fatalln("Encryption isn't enabled in the config file")
+	}
+
+	// Check if we should encrypt the existing unencrypted database files as well
+	if len(os.Args) > 1 && os.Args[1] == "--encrypt-existing" {
+		EncryptExisting = true
+		log.Println("Encrypting existing database files")
+	}
+
+	// Connect to the storage backend
+	config.Conf.Live.Nodename = "Key Rotation"
+	err = com.ConnectBlobStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Connect to database
+	err = database.Connect()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The user keys need rewrapping first, so any files encrypted with them can still be read once the old instance
+	// key is removed
+	numUsers, err := com.RewrapUserKeys()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("Rewrapped the keys of %d users", numUsers)
+
+	// Rewrap the data keys of the standard database files
+	var numFiles, numFailed int
+	owners, err := database.DatabaseFileOwners()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	for sha, owner := range owners {
+		changed, err := com.RewrapDatabaseFile(owner, sha[:com.MinioFolderChars], sha[com.MinioFolderChars:],
+			EncryptExisting)
+		if err != nil {
+			log.Printf("Rewrapping database file '%s' failed: %v", sha, err)
+			numFailed++
+			continue
+		}
+		if changed {
+			numFiles++
+		}
+	}
+
+	// Rewrap the data keys of the live database files
+	liveFiles, err := database.LiveDatabaseFiles()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	for _, f := range liveFiles {
+		changed, err := com.RewrapDatabaseFile(f.Owner, f.Bucket, f.ID, EncryptExisting)
+		if err != nil {
+			log.Printf("Rewrapping live database file '%s/%s' failed: %v", f.Bucket, f.ID, err)
+			numFailed++
+			continue
+		}
+		if changed {
+			numFiles++
+		}
+	}
+
+	log.Printf("Rewrapped %d database files, %d failed", numFiles, numFailed)
+	if numFailed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+const (
+	// Maximum number of widgets a single dashboard can hold
+	dashboardMaxWidgets = 50
+
+	// Minimum number of seconds between automatic refreshes of a dashboard widget
+	dashboardMinRefresh = 5
+)
+
+// dashboardWidgetInfo holds the details of a dashboard widget as needed for displaying it
+type dashboardWidgetInfo struct {
+	database.DashboardWidget
+	ImageURL string `json:"image_url"`
+	Live     bool   `json:"live"`
+}
+
+// getDashboardName returns the owner and name of the dashboard requested in the URL
+func getDashboardName(ignoreLeading int, r *http.Request) (owner, name string, err error) {
+	pathStrings := strings.Split(r.URL.Path, "/")
+	if len(pathStrings) < (3 + ignoreLeading) {
+		return "", "", errors.New("Invalid URL")
+	}
+	owner = pathStrings[1+ignoreLeading]
+	name = pathStrings[2+ignoreLeading]
+
+	// Validate the user supplied owner and dashboard name
+	err = com.ValidateUser(owner)
+	if err != nil {
+		return "", "", errors.New("Invalid dashboard owner")
+	}
+	err = com.ValidateDashboardName(name)
+	if err != nil {
+		return "", "", errors.New("Invalid dashboard name")
+	}
+	return
+}
+
+// dashboardPage displays a dashboard.  Public dashboards can be viewed by anyone, private ones only by their owner
+func dashboardPage(w http.ResponseWriter, r *http.Request) {
+	var pageData struct {
+		Dashboard database.Dashboard
+		IsOwner   bool
+		Owner     string
+		PageMeta  PageMetaInfo
+		Widgets   []dashboardWidgetInfo
+	}
+
+	// Get all meta information
+	errCode, err := collectPageMetaInfo(w, r, &pageData.PageMeta)
+	if err != nil {
+		errorPage(w, r, errCode, err.Error())
+		return
+	}
+
+	// Retrieve the dashboard owner and name
+	owner, name, err := getDashboardName(1, r) // 1 = Ignore "/dashboard/" at the start of the URL
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	usr, err := database.User(owner)
+	if err != nil {
+		errorPage(w, r, http.StatusNotFound, "Dashboard not found")
+		return
+	}
+	pageData.Owner = usr.Username
+	pageData.IsOwner = strings.ToLower(pageData.PageMeta.LoggedInUser) == strings.ToLower(usr.Username)
+
+	// Retrieve the dashboard.  If it doesn't exist yet, its owner gets an empty one to start adding widgets to
+	var exists bool
+	pageData.Dashboard, exists, err = database.DashboardGet(usr.Username, name)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if (!exists && !pageData.IsOwner) || (!pageData.Dashboard.Public && !pageData.IsOwner) {
+		errorPage(w, r, http.StatusNotFound, "Dashboard not found")
+		return
+	}
+	if !exists {
+		pageData.Dashboard.Name = name
+	}
+
+	// Work out the details needed to display each widget.  Widgets are shown using the server side rendered image of
+	// the visualisation, with an embed token so viewers of a public dashboard don't need access to the database
+	// itself.  Widgets the dashboard owner is no longer allowed to show are skipped
+	for _, wdg := range pageData.Dashboard.Widgets {
+		allowed, err := dashboardWidgetAllowed(usr.Username, wdg)
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !allowed {
+			continue
+		}
+		isLive, _, err := database.CheckDBLive(wdg.DBOwner, wdg.DBName)
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		token, err := com.EmbedToken(wdg.DBOwner, wdg.DBName, wdg.VisName, time.Now().Add(24*time.Hour))
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		v := url.Values{}
+		v.Set("visname", wdg.VisName)
+		v.Set("format", "svg")
+		v.Set("token", token)
+		pageData.Widgets = append(pageData.Widgets, dashboardWidgetInfo{
+			DashboardWidget: wdg,
+			ImageURL: fmt.Sprintf("/x/visimage/%s/%s?%s", url.PathEscape(wdg.DBOwner), url.PathEscape(wdg.DBName),
+				v.Encode()),
+			Live: isLive,
+		})
+	}
+
+	// Fill out page metadata
+	pageData.PageMeta.Title = fmt.Sprintf("Dashboard %s - %s", name, usr.Username)
+
+	// Render the page
+	t := tmpl.Lookup("dashboardPage")
+	err = t.Execute(w, pageData)
+	if err != nil {
+		log.Printf("Error: %s", err)
+	}
+}
+
+// dashboardDelete deletes one of the logged in user's dashboards
+func dashboardDelete(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, "You need to be logged in")
+		return
+	}
+
+	// Validate the dashboard name
+	name := r.FormValue("name")
+	err = com.ValidateDashboardName(name)
+	if err != nil {
+		log.Printf("Input validation error for dashboardDelete(): %s", err)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error when validating input: %s", err)
+		return
+	}
+
+	// Delete the dashboard
+	err = database.DashboardDelete(loggedInUser, name)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// dashboardSave creates or updates one of the logged in user's dashboards
+func dashboardSave(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, "You need to be logged in")
+		return
+	}
+
+	// Grab the incoming dashboard object
+	bodyData, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err)
+		return
+	}
+	var dash database.Dashboard
+	err = json.Unmarshal(bodyData, &dash)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err)
+		return
+	}
+
+	// Validate the dashboard details
+	err = com.ValidateDashboardName(dash.Name)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error when validating dashboard name: %s", err)
+		return
+	}
+	if dash.Description != "" {
+		err = com.ValidateMarkdown(dash.Description)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Error when validating dashboard description: %s", err)
+			return
+		}
+	}
+	if len(dash.Widgets) > dashboardMaxWidgets {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Dashboards can't have more than %d widgets", dashboardMaxWidgets)
+		return
+	}
+
+	// Validate each of the widgets, making sure the user is allowed to show the visualisations they display
+	for _, wdg := range dash.Widgets {
+		err = com.ValidateUserDB(wdg.DBOwner, wdg.DBName)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid database for widget: %s", err)
+			return
+		}
+		err = com.ValidateVisualisationName(wdg.VisName)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid visualisation name for widget: %s", err)
+			return
+		}
+		if wdg.Title != "" {
+			err = com.ValidateDiscussionTitle(wdg.Title)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(w, "Invalid widget title: %s", err)
+				return
+			}
+		}
+		if wdg.RefreshInterval != 0 && wdg.RefreshInterval < dashboardMinRefresh {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "The refresh interval of widgets must be at least %d seconds", dashboardMinRefresh)
+			return
+		}
+
+		exists, err := database.CheckDBPermissions(loggedInUser, wdg.DBOwner, wdg.DBName, false)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, err)
+			return
+		}
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "Database '%s/%s' doesn't exist", wdg.DBOwner, wdg.DBName)
+			return
+		}
+		allowed, err := dashboardWidgetAllowed(loggedInUser, wdg)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, err)
+			return
+		}
+		if !allowed {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprintf(w, "You need write access to '%s/%s' to show its visualisation '%s' on a dashboard, unless "+
+				"the visualisation is public", wdg.DBOwner, wdg.DBName, wdg.VisName)
+			return
+		}
+		visualisations, err := database.GetVisualisations(wdg.DBOwner, wdg.DBName)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, err)
+			return
+		}
+		if _, ok := visualisations[wdg.VisName]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "Visualisation '%s' doesn't exist for database '%s/%s'", wdg.VisName, wdg.DBOwner, wdg.DBName)
+			return
+		}
+	}
+
+	// Save the dashboard
+	err = database.DashboardSave(loggedInUser, dash)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// dashboardWidgetAllowed checks whether a user can show a visualisation on their dashboards.  Dashboard widgets are
+// displayed using embed tokens, so this needs the same write access as creating embed tokens does, unless anyone
+// can already see the visualisation
+func dashboardWidgetAllowed(userName string, wdg database.DashboardWidget) (bool, error) {
+	allowed, err := database.CheckDBPermissions(userName, wdg.DBOwner, wdg.DBName, true)
+	if err != nil || allowed {
+		return allowed, err
+	}
+	allowed, err = database.CheckDBPermissions("", wdg.DBOwner, wdg.DBName, false)
+	if err != nil || allowed {
+		return allowed, err
+	}
+	return database.VisualisationIsPublic(wdg.DBOwner, wdg.DBName, wdg.VisName)
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// discussLabelsHandler replaces the labels applied to a discussion or merge request
+func discussLabelsHandler(w http.ResponseWriter, r *http.Request) {
+	dbOwner, dbName, ok := labelsWriteAccess(w, r)
+	if !ok {
+		return
+	}
+	discID, ok := labelsDiscussionID(w, r)
+	if !ok {
+		return
+	}
+
+	// Only the labels available for the database can be applied
+	available, err := database.Labels(dbOwner, dbName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	labels := []string{}
+	for _, l := range strings.Split(r.PostFormValue("labels"), ",") {
+		l = strings.TrimSpace(l)
+		if l == "" {
+			continue
+		}
+		found := false
+		for _, a := range available {
+			if strings.ToLower(a.Name) == strings.ToLower(l) {
+				labels = append(labels, a.Name)
+				found = true
+				break
+			}
+		}
+		if !found {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Unknown label '%s'", l)
+			return
+		}
+	}
+
+	exists, err := database.SetDiscussionLabels(dbOwner, dbName, discID, labels)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "Unknown discussion")
+		return
+	}
+
+	// Return the applied labels
+	jsonResponse, err := json.Marshal(labels)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "%s", jsonResponse)
+}
+
+// discussMilestoneHandler adds a discussion or merge request to a milestone, or removes it from its milestone
+func discussMilestoneHandler(w http.ResponseWriter, r *http.Request) {
+	dbOwner, dbName, ok := labelsWriteAccess(w, r)
+	if !ok {
+		return
+	}
+	discID, ok := labelsDiscussionID(w, r)
+	if !ok {
+		return
+	}
+
+	// Make sure the milestone exists, and use its established capitalisation
+	milestone := r.PostFormValue("milestone")
+	if milestone != "" {
+		milestones, err := database.Milestones(dbOwner, dbName)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, err.Error())
+			return
+		}
+		found := false
+		for _, m := range milestones {
+			if strings.ToLower(m.Title) == strings.ToLower(milestone) {
+				milestone = m.Title
+				found = true
+				break
+			}
+		}
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "Unknown milestone")
+			return
+		}
+	}
+
+	exists, err := database.SetDiscussionMilestone(dbOwner, dbName, discID, milestone)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "Unknown discussion")
+		return
+	}
+	fmt.Fprint(w, milestone)
+}
+
+// labelDeleteHandler deletes a label of a database
+func labelDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	dbOwner, dbName, ok := labelsWriteAccess(w, r)
+	if !ok {
+		return
+	}
+
+	name := r.PostFormValue("name")
+	err := database.LabelDelete(dbOwner, dbName, name)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	labelsResponse(w, dbOwner, dbName)
+}
+
+// labelSaveHandler creates or updates a label of a database
+func labelSaveHandler(w http.ResponseWriter, r *http.Request) {
+	dbOwner, dbName, ok := labelsWriteAccess(w, r)
+	if !ok {
+		return
+	}
+
+	// Validate the label details
+	name := strings.TrimSpace(r.PostFormValue("name"))
+	colour := r.PostFormValue("colour")
+	err := com.ValidateLabel(name, colour)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Invalid label name or colour")
+		return
+	}
+	description := r.PostFormValue("description")
+	if description != "" {
+		err = com.ValidateMarkdown(description)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "Invalid label description")
+			return
+		}
+	}
+
+	err = database.LabelSave(dbOwner, dbName, name, colour, description)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	labelsResponse(w, dbOwner, dbName)
+}
+
+// milestoneDeleteHandler deletes a milestone of a database
+func milestoneDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	dbOwner, dbName, ok := labelsWriteAccess(w, r)
+	if !ok {
+		return
+	}
+
+	title := r.PostFormValue("title")
+	err := database.MilestoneDelete(dbOwner, dbName, title)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	milestonesResponse(w, dbOwner, dbName)
+}
+
+// milestoneSaveHandler creates or updates a milestone of a database
+func milestoneSaveHandler(w http.ResponseWriter, r *http.Request) {
+	dbOwner, dbName, ok := labelsWriteAccess(w, r)
+	if !ok {
+		return
+	}
+
+	// Validate the milestone details
+	title := strings.TrimSpace(r.PostFormValue("title"))
+	err := com.ValidateMilestoneTitle(title)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Invalid milestone title")
+		return
+	}
+	description := r.PostFormValue("description")
+	if description != "" {
+		err = com.ValidateMarkdown(description)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "Invalid milestone description")
+			return
+		}
+	}
+	var dueDate *time.Time
+	if d := r.PostFormValue("due"); d != "" {
+		due, err := time.Parse("2006-01-02", d)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "Invalid due date.  It needs to be in YYYY-MM-DD format")
+			return
+		}
+		dueDate = &due
+	}
+	open := true
+	if o := r.PostFormValue("open"); o != "" {
+		open, err = strconv.ParseBool(o)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "Invalid value for open")
+			return
+		}
+	}
+
+	err = database.MilestoneSave(dbOwner, dbName, title, description, dueDate, open)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	milestonesResponse(w, dbOwner, dbName)
+}
+
+// labelsDiscussionID returns the discussion ID given in the form data
+func labelsDiscussionID(w http.ResponseWriter, r *http.Request) (discID int, ok bool) {
+	a := r.PostFormValue("discid")
+	if a == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Missing discussion id")
+		return
+	}
+	discID, err := strconv.Atoi(a)
+	if err != nil {
+		log.Printf("Error converting string '%s' to integer in function '%s': %s", com.SanitiseLogString(a),
+			com.GetCurrentFunctionName(), err)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Error when parsing discussion id value")
+		return
+	}
+	return discID, true
+}
+
+// labelsResponse returns the labels available for a database as JSON
+func labelsResponse(w http.ResponseWriter, dbOwner, dbName string) {
+	labels, err := database.Labels(dbOwner, dbName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	jsonResponse, err := json.Marshal(labels)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "%s", jsonResponse)
+}
+
+// labelsWriteAccess checks the logged in user has write access to the database given in the form data, which is
+// needed for managing its labels and milestones.  It returns the established capitalisation of the database owner
+func labelsWriteAccess(w http.ResponseWriter, r *http.Request) (dbOwner, dbName string, ok bool) {
+	// Retrieve session data (if any)
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Extract the required form variables
+	usr, _, dbName, err := com.GetUFD(r, false)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Bad request")
+		return
+	}
+
+	// Use the established capitalisation of the username
+	z, err := database.User(usr)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	dbOwner = z.Username
+
+	// Only users with write access to the database can manage its labels and milestones
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	if !allowed {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "You don't have write access to this database")
+		return
+	}
+	return dbOwner, dbName, true
+}
+
+// milestonesResponse returns the milestones of a database as JSON
+func milestonesResponse(w http.ResponseWriter, dbOwner, dbName string) {
+	milestones, err := database.Milestones(dbOwner, dbName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	jsonResponse, err := json.Marshal(milestones)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "%s", jsonResponse)
+}
@@ -9,7 +9,6 @@ import (
 	"strings"
 
 	com "github.com/sqlitebrowser/dbhub.io/common"
-	"github.com/sqlitebrowser/dbhub.io/common/config"
 	"github.com/sqlitebrowser/dbhub.io/common/database"
 )
 
@@ -92,21 +91,10 @@ func executePage(w http.ResponseWriter, r *http.Request) {
 // execClearHistory deletes all items in the user's SQL history
 func execClearHistory(w http.ResponseWriter, r *http.Request) {
 	// Retrieve session data (if any)
-	var loggedInUser string
-	var u interface{}
-	var err error
-	if config.Conf.Environment.Environment == "production" {
-		sess, err := store.Get(r, "dbhub-user")
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		u = sess.Values["UserName"]
-	} else {
-		u = config.Conf.Environment.UserOverride
-	}
-	if u != nil {
-		loggedInUser = u.(string)
+	loggedInUser, _, err := checkLogin(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
 	// Retrieve user and database info
@@ -129,21 +117,10 @@ func execClearHistory(w http.ResponseWriter, r *http.Request) {
 // execLiveSQL executes a user provided SQLite statement on a database.
 func execLiveSQL(w http.ResponseWriter, r *http.Request) {
 	// Retrieve session data (if any)
-	var loggedInUser string
-	var u interface{}
-	var err error
-	if config.Conf.Environment.Environment == "production" {
-		sess, err := store.Get(r, "dbhub-user")
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		u = sess.Values["UserName"]
-	} else {
-		u = config.Conf.Environment.UserOverride
-	}
-	if u != nil {
-		loggedInUser = u.(string)
+	loggedInUser, _, err := checkLogin(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
 	// Retrieve user and database info
@@ -214,20 +191,34 @@ func execLiveSQL(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Send the SQL execution request to our job queue backend
+	// Send the SQL execution request to our job queue backend.  In read only mode the statement is only run as a query,
+	// which uses a read only connection to the database, so statements changing the database are refused
+	readOnly, readOnlyMsg := com.ReadOnlyMode()
 	var z interface{}
-	rowsChanged, err := com.LiveExecute(liveNode, loggedInUser, dbOwner, dbName, sql)
-	if err != nil {
-		if !strings.HasPrefix(err.Error(), "don't use exec with") {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprint(w, err)
-			logError(err)
-			return
-		}
+	var rowsChanged int
+	query := readOnly
+	if !readOnly {
+		rowsChanged, err = com.LiveExecute(liveNode, loggedInUser, dbOwner, dbName, sql)
+		if err != nil {
+			if !strings.HasPrefix(err.Error(), "don't use exec with") {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprint(w, err)
+				logError(err)
+				return
+			}
 
-		// The user tried to run a SELECT query.  Let's just run with it...
+			// The user tried to run a SELECT query.  Let's just run with it...
+			query = true
+		}
+	}
+	if query {
 		z, err = com.LiveQuery(liveNode, loggedInUser, dbOwner, dbName, sql)
 		if err != nil {
+			if readOnly && com.LiveQueryWriteError(err) {
+				w.Header().Set("Retry-After", "300")
+				http.Error(w, readOnlyMsg, http.StatusServiceUnavailable)
+				return
+			}
 			w.WriteHeader(http.StatusInternalServerError)
 			fmt.Fprint(w, err.Error())
 			logError(err)
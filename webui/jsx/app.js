@@ -6,11 +6,14 @@ import ModalImage from "react-modal-image";
 import AboutPage from "./about-page";
 import Auth from "./auth";
 import BranchesTable from "./branches";
+import DashboardPage from "./dashboard-page";
 import DatabaseCommits from "./database-commits";
 import DatabaseContributors from "./database-contributors";
 import DatabaseCreateBranch from "./database-create-branch";
 import DatabaseDiff from "./database-diff";
 import DatabaseForks from "./database-forks";
+import DatabaseHealth from "./database-health";
+import DatabaseInsights from "./database-insights";
 import DatabaseSettings from "./database-settings";
 import DatabaseTags from "./database-tags";
 import DatabaseView from "./database-view";
@@ -24,6 +27,7 @@ import PreferencesPage from "./preferences-page";
 import ProfilePage from "./profile-page";
 import RegisterUserPage from "./register-user-page";
 import SqlTerminal from "./sql-terminal";
+import StoryPage from "./story-page";
 import TagCreate from "./tag-create";
 import UpdatesPage from "./updates-page";
 import UploadForm from "./upload-form";
@@ -72,6 +76,14 @@ applyUserPrefTheme();
 	}
 }
 
+{
+	const rootNode = document.getElementById("dashboard-page");
+	if (rootNode) {
+		const root = ReactDOM.createRoot(rootNode);
+		root.render(<DashboardPage />);
+	}
+}
+
 {
 	const rootNode = document.getElementById("database-commits");
 	if (rootNode) {
@@ -114,6 +126,22 @@ applyUserPrefTheme();
 	}
 }
 
+{
+	const rootNode = document.getElementById("database-health");
+	if (rootNode) {
+		const root = ReactDOM.createRoot(rootNode);
+		root.render(<DatabaseHealth />);
+	}
+}
+
+{
+	const rootNode = document.getElementById("database-insights");
+	if (rootNode) {
+		const root = ReactDOM.createRoot(rootNode);
+		root.render(<DatabaseInsights />);
+	}
+}
+
 {
 	const rootNode = document.getElementById("database-settings");
 	if (rootNode) {
@@ -212,9 +240,10 @@ applyUserPrefTheme();
 	const rootNode = document.getElementById("register-user-page");
 	if (rootNode) {
 		const username = rootNode.dataset.username;
+		const inviteRequired = rootNode.dataset.inviteRequired === "true";
 
 		const root = ReactDOM.createRoot(rootNode);
-		root.render(<RegisterUserPage username={username} />);
+		root.render(<RegisterUserPage username={username} inviteRequired={inviteRequired} />);
 	}
 }
 
@@ -226,6 +255,14 @@ applyUserPrefTheme();
 	}
 }
 
+{
+	const rootNode = document.getElementById("story-page");
+	if (rootNode) {
+		const root = ReactDOM.createRoot(rootNode);
+		root.render(<StoryPage />);
+	}
+}
+
 {
 	const rootNode = document.getElementById("tag-create");
 	if (rootNode) {
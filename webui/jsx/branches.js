@@ -2,6 +2,7 @@ const React = require("react");
 const ReactDOM = require("react-dom");
 
 import MarkdownEditor from "./markdown-editor";
+import {getTimePeriod} from "./format";
 
 function BranchesTableRow({name, commit, description, setStatus}) {
 	// This is the branch name currently shown in the front end
@@ -120,6 +121,71 @@ function BranchesTableRow({name, commit, description, setStatus}) {
 	</>);
 }
 
+function StaleBranches({setStatus}) {
+	function deleteStaleBranches() {
+		fetch("/x/deletestalebranches/", {
+			method: "post",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded"
+			},
+			body: new URLSearchParams({
+				"dbname": meta.database,
+				"username": meta.owner
+			}),
+		}).then((response) => {
+			if (!response.ok) {
+				return Promise.reject(response);
+			}
+
+			window.location = "/branches/" + meta.owner + "/" + meta.database;
+		})
+		.catch((error) => {
+			// The delete failed, so display an error message
+			if (error.status === 409) {
+				error.text().then((text) => setStatus("red", "Error: " + text));
+			} else {
+				setStatus("red", "Error: Something went wrong when trying to delete the stale branches.");
+			}
+		});
+	}
+
+	return (
+		<div className="row mt-3">
+			<div className="col-md-12">
+				<div className="card" data-cy="stalebranches">
+					<div className="card-header">
+						Stale branches
+						{authInfo.loggedInUser === meta.owner ? <button className="btn btn-danger btn-sm float-end" onClick={() => {return deleteStaleBranches()}} data-cy="delstalebtn">Delete stale branches</button> : null}
+					</div>
+					<div className="card-body">
+						<p>These branches haven't had any commits for a while, and all of their commits are already part of another branch.  Deleting them doesn't lose any commits.</p>
+						<table className="table table-striped table-responsive table-borderless m-0">
+							<thead>
+								<tr>
+									<th>Name</th><th>Last commit</th><th>Merged into</th>
+								</tr>
+							</thead>
+							<tbody>
+								{staleBranches.map(b => (
+									<tr key={b.branch}>
+										<td><a href={"/" + meta.owner + "/" + meta.database + "?branch=" + b.branch}>{b.branch}</a></td>
+										<td><span title={new Date(b.last_commit).toLocaleString()}>{getTimePeriod(b.last_commit, false)}</span></td>
+										<td><a href={"/" + meta.owner + "/" + meta.database + "?branch=" + b.merged_into}>{b.merged_into}</a></td>
+									</tr>
+								))}
+							</tbody>
+						</table>
+					</div>
+				</div>
+			</div>
+			{staleBranches.length > 0 ? <StaleBranches setStatus={function(colour, text) {
+				setStatusMessage(text);
+				setStatusMessageColour(colour);
+			}} /> : null}
+		</div>
+	);
+}
+
 export default function BranchesTable() {
 	const [statusMessage, setStatusMessage] = React.useState("");
 	const [statusMessageColour, setStatusMessageColour] = React.useState("");
@@ -0,0 +1,120 @@
+const React = require("react");
+const ReactDOM = require("react-dom");
+
+function DashboardWidget({widget, onRemove}) {
+	const [refreshCount, setRefreshCount] = React.useState(0);
+
+	// Automatically refresh widgets of live databases
+	React.useEffect(() => {
+		if (!widget.live || !widget.refresh_interval) {
+			return;
+		}
+		const timer = setInterval(() => setRefreshCount(c => c + 1), widget.refresh_interval * 1000);
+		return () => clearInterval(timer);
+	}, [widget.live, widget.refresh_interval]);
+
+	const title = widget.title !== "" ? widget.title : widget.vis_name;
+	return (
+		<div className="col-md-6 mb-3">
+			<div className="card">
+				<div className="card-header">
+					{title}
+					<span className="pull-right">
+						<a href={"/vis/" + widget.db_owner + "/" + widget.db_name}>{widget.db_owner} / {widget.db_name}</a>
+						{onRemove ? <>&nbsp;<a href="#/" onClick={onRemove} title="Remove widget"><i className="fa fa-trash"></i></a></> : null}
+					</span>
+				</div>
+				<div className="card-body">
+					<img src={widget.image_url + (refreshCount > 0 ? "&refresh=" + refreshCount : "")} alt={title} style={{maxWidth: "100%"}} />
+				</div>
+			</div>
+		</div>
+	);
+}
+
+export default function DashboardPage() {
+	const [widgets, setWidgets] = React.useState(dashboardData.widgets !== null ? dashboardData.widgets : []);
+	const [isPublic, setPublic] = React.useState(dashboardData.dashboard.public);
+	const [description, setDescription] = React.useState(dashboardData.dashboard.description);
+	const [newWidget, setNewWidget] = React.useState({db_owner: "", db_name: "", vis_name: "", title: "", refresh_interval: 0});
+	const [status, setStatus] = React.useState("");
+
+	function saveDashboard(newWidgets) {
+		const data = {
+			name: dashboardData.dashboard.name,
+			description: description,
+			public: isPublic,
+			widgets: newWidgets.map(w => ({db_owner: w.db_owner, db_name: w.db_name, vis_name: w.vis_name, title: w.title, refresh_interval: Number(w.refresh_interval)})),
+		};
+
+		fetch("/x/dashboardsave", {
+			method: "post",
+			headers: {"Content-Type": "application/json"},
+			body: JSON.stringify(data),
+		}).then(response => {
+			if (!response.ok) {
+				return Promise.reject(response);
+			}
+
+			// Reload the page, so the widget images are regenerated
+			window.location.reload();
+		}).catch(error => {
+			error.text().then(text => setStatus("Saving the dashboard failed: " + text));
+		});
+	}
+
+	function deleteDashboard() {
+		fetch("/x/dashboarddel?name=" + encodeURIComponent(dashboardData.dashboard.name), {
+			method: "post",
+		}).then(response => {
+			if (!response.ok) {
+				return Promise.reject(response);
+			}
+			window.location = "/" + dashboardData.owner;
+		}).catch(error => {
+			error.text().then(text => setStatus("Deleting the dashboard failed: " + text));
+		});
+	}
+
+	const widgetList = widgets.map((w, i) => <DashboardWidget
+		key={i}
+		widget={w}
+		onRemove={dashboardData.isOwner ? () => setWidgets(widgets.filter((_, j) => j !== i)) : null}
+	/>);
+
+	return (<>
+		<h3 className="text-center">{dashboardData.dashboard.name}</h3>
+		<p className="text-center"><a href={"/" + dashboardData.owner}>{dashboardData.owner}</a></p>
+		{description !== "" ? <p>{description}</p> : null}
+		<div className="row">
+			{widgetList.length > 0 ? widgetList : <h5 className="text-center">This dashboard doesn't have any widgets yet</h5>}
+		</div>
+		{dashboardData.isOwner ? (
+			<div className="card mt-3">
+				<div className="card-header fw-bold">Edit dashboard</div>
+				<div className="card-body">
+					{status !== "" ? <div className="alert alert-danger">{status}</div> : null}
+					<div className="mb-2">
+						<label className="form-label">Description</label>
+						<input type="text" className="form-control" value={description} onChange={e => setDescription(e.target.value)} />
+					</div>
+					<div className="form-check mb-3">
+						<input type="checkbox" className="form-check-input" id="dashboard-public" checked={isPublic} onChange={e => setPublic(e.target.checked)} />
+						<label className="form-check-label" htmlFor="dashboard-public">Public</label>
+					</div>
+					<h5>Add widget</h5>
+					<div className="row mb-3">
+						<div className="col"><input type="text" className="form-control" placeholder="Database owner" value={newWidget.db_owner} onChange={e => setNewWidget({...newWidget, db_owner: e.target.value})} /></div>
+						<div className="col"><input type="text" className="form-control" placeholder="Database name" value={newWidget.db_name} onChange={e => setNewWidget({...newWidget, db_name: e.target.value})} /></div>
+						<div className="col"><input type="text" className="form-control" placeholder="Visualisation" value={newWidget.vis_name} onChange={e => setNewWidget({...newWidget, vis_name: e.target.value})} /></div>
+						<div className="col"><input type="text" className="form-control" placeholder="Title (optional)" value={newWidget.title} onChange={e => setNewWidget({...newWidget, title: e.target.value})} /></div>
+						<div className="col"><input type="number" className="form-control" placeholder="Refresh (seconds)" title="Refresh interval in seconds, for live databases" value={newWidget.refresh_interval} onChange={e => setNewWidget({...newWidget, refresh_interval: e.target.value})} /></div>
+						<div className="col-auto"><button className="btn btn-secondary" onClick={() => saveDashboard([...widgets, newWidget])}>Add</button></div>
+					</div>
+					<button className="btn btn-primary" onClick={() => saveDashboard(widgets)}>Save</button>&nbsp;
+					<button className="btn btn-danger" onClick={() => deleteDashboard()}>Delete dashboard</button>
+				</div>
+			</div>
+		) : null}
+	</>);
+}
@@ -54,6 +54,60 @@ function DatabaseForkRow({data}) {
 	</p>);
 }
 
+// Shows the databases this one was derived from, and the databases derived from it, as two trees
+function DatabaseLineage({graph}) {
+	if (graph.edges.length === 0) {
+		return null;
+	}
+
+	let nodes = {};
+	graph.nodes.forEach(n => nodes[n.id] = n);
+
+	function nodeLink(n) {
+		if (n.private || n.deleted) {
+			return n.database;
+		}
+		return <><a href={"/" + n.owner}>{n.owner}</a> / <a href={"/" + n.owner + "/" + n.database}>{n.database}</a></>;
+	}
+
+	// Walks the graph from the database being viewed in one direction, skipping databases already shown on the path
+	// to avoid looping forever on circular declarations
+	function tree(id, upstream, path) {
+		const edges = graph.edges.filter(e => (upstream ? e.derived : e.source) === id);
+		if (edges.length === 0) {
+			return null;
+		}
+		return (
+			<ul>
+				{edges.map(e => {
+					const next = upstream ? e.source : e.derived;
+					const n = nodes[next];
+					return (
+						<li key={e.derived + "/" + e.source + "/" + e.commit}>
+							{nodeLink(n)}
+							{upstream && e.commit ? <> at commit <a href={"/" + n.owner + "/" + n.database + "?commit=" + e.commit} className="font-monospace">{e.commit.substring(0, 8)}</a></> : null}
+							{e.description ? <span className="text-muted"> - {e.description}</span> : null}
+							{path.includes(next) ? null : tree(next, upstream, path.concat(next))}
+						</li>
+					);
+				})}
+			</ul>
+		);
+	}
+
+	const up = tree(graph.start, true, [graph.start]);
+	const down = tree(graph.start, false, [graph.start]);
+	return (
+		<div className="card mt-4" data-cy="lineage">
+			<div className="card-header">Lineage</div>
+			<div className="card-body">
+				{up ? <><b>Derived from</b>{up}</> : null}
+				{down ? <><b>Used to derive</b>{down}</> : null}
+			</div>
+		</div>
+	);
+}
+
 export default function DatabaseForks() {
 	// Render table rows
 	let rows = [];
@@ -67,5 +121,6 @@ export default function DatabaseForks() {
 			<a href={"/" + meta.owner + "/" + meta.database} data-cy="dblnk">{meta.database}</a>
 		</h3>
 		{rows}
+		<DatabaseLineage graph={lineageData} />
 	</>);
 }
@@ -0,0 +1,70 @@
+const React = require("react");
+const ReactDOM = require("react-dom");
+
+import {getTimePeriod} from "./format";
+
+// A card showing the outcome of one of the checks of the health report
+function HealthCheck({title, ok, children}) {
+	return (
+		<div className="card mb-2" data-cy={"check-" + title.toLowerCase().replace(/ /g, "-")}>
+			<div className="card-body">
+				<h5 className="card-title">
+					<i className={ok ? "fa fa-check text-success" : "fa fa-exclamation-triangle text-warning"}></i> {title}
+				</h5>
+				{children}
+			</div>
+		</div>
+	);
+}
+
+export default function DatabaseHealth() {
+	const report = healthReport;
+	const commitLink = <a href={"/" + meta.owner + "/" + meta.database + "?commit=" + report.commit}>{report.commit.substring(0, 8)}</a>;
+
+	// Reports are worked out in the background, so may not be ready yet
+	if (report.state === "pending") {
+		return (
+			<div className="mt-2" data-cy="health-pending">
+				<p>The health report for commit {commitLink} is being worked out.  Please check back in a few minutes.</p>
+			</div>
+		);
+	}
+	if (report.state === "failed") {
+		return (
+			<div className="mt-2" data-cy="health-failed">
+				<p>The health report for commit {commitLink} couldn't be worked out: {report.error}</p>
+			</div>
+		);
+	}
+
+	const d = report.details;
+	const unusedPercent = d.page_count === 0 ? 0 : Math.round(d.freelist_pages * 100 / d.page_count);
+	return (<>
+		<p className="mt-2 text-muted">Health report for commit {commitLink}, created {getTimePeriod(report.date_created, true)}.</p>
+		<HealthCheck title="Integrity check" ok={d.integrity_ok}>
+			{d.integrity_ok ? <p className="mb-0">No problems were found.</p> : <>
+				<p>The integrity check found these problems:</p>
+				<ul className="mb-0">{d.integrity_errors.map((e, i) => <li key={i}><code>{e}</code></li>)}</ul>
+			</>}
+		</HealthCheck>
+		<HealthCheck title="Unused space" ok={!d.vacuum_suggested}>
+			<p className="mb-0">
+				{d.freelist_pages.toLocaleString()} of {d.page_count.toLocaleString()} pages are unused
+				({Math.round(d.unused_bytes / 1024).toLocaleString()} KB, {unusedPercent}%).
+				{d.vacuum_suggested ? <> Running <code>VACUUM</code> on the database would make it smaller.</> : null}
+			</p>
+		</HealthCheck>
+		<HealthCheck title="Primary keys" ok={d.no_primary_key.length === 0}>
+			{d.no_primary_key.length === 0 ? <p className="mb-0">All tables have a primary key.</p> : <>
+				<p>These tables don't have a primary key:</p>
+				<ul className="mb-0">{d.no_primary_key.map(t => <li key={t}>{t}</li>)}</ul>
+			</>}
+		</HealthCheck>
+		<HealthCheck title="Wide tables" ok={d.wide_tables.length === 0}>
+			{d.wide_tables.length === 0 ? <p className="mb-0">No tables have a very large number of columns.</p> : <>
+				<p>These tables have a very large number of columns:</p>
+				<ul className="mb-0">{d.wide_tables.map(t => <li key={t.table}>{t.table}: {t.columns} columns</li>)}</ul>
+			</>}
+		</HealthCheck>
+	</>);
+}
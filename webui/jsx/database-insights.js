@@ -0,0 +1,241 @@
+const React = require("react");
+const ReactDOM = require("react-dom");
+
+import ButtonGroup from "react-bootstrap/ButtonGroup";
+import ToggleButton from "react-bootstrap/ToggleButton";
+import Select from "react-dropdown-select";
+import Plotly from "plotly.js-basic-dist";
+import createPlotlyComponent from "react-plotly.js/factory";
+const Plot = createPlotlyComponent(Plotly);
+
+// The kinds of traffic which can be charted
+const availableValues = [
+	{
+		label: "Views",
+		value: "views",
+	},
+	{
+		label: "Downloads",
+		value: "downloads",
+	},
+	{
+		label: "Clones",
+		value: "clones",
+	},
+	{
+		label: "API queries",
+		value: "api_queries",
+	},
+];
+
+// The time ranges which can be charted, in days
+const availableRanges = [
+	{
+		label: "30 days",
+		value: 30,
+	},
+	{
+		label: "90 days",
+		value: 90,
+	},
+	{
+		label: "1 year",
+		value: 365,
+	},
+];
+
+// The names shown for the kinds of client which can download a database
+const clientNames = {
+	"api": "API",
+	"cli": "Dio",
+	"db4s": "DB4S",
+	"grpc": "gRPC API",
+	"webui": "Web browser",
+};
+
+// A table of download counts, for one way of breaking down the downloads
+function BreakdownTable({title, entries, unknown, nameFormatter}) {
+	return (
+		<div className="col-md-4">
+			<table className="table table-sm table-striped" data-cy={"breakdown-" + title.toLowerCase()}>
+				<thead>
+					<tr><th>{title}</th><th className="text-end">Downloads</th></tr>
+				</thead>
+				<tbody>
+					{entries.length === 0 ? <tr><td colSpan="2" className="text-muted">No downloads yet</td></tr> : null}
+					{entries.map(e =>
+						<tr key={e.name}>
+							<td>{e.name === "" ? <i>{unknown}</i> : nameFormatter ? nameFormatter(e.name) : e.name}</td>
+							<td className="text-end">{e.downloads.toLocaleString()}</td>
+						</tr>
+					)}
+				</tbody>
+			</table>
+		</div>
+	);
+}
+
+// Formats a number of bytes for showing to people
+function formatSize(bytes) {
+	const units = ["bytes", "KB", "MB", "GB", "TB"];
+	let i = 0;
+	while (bytes >= 1024 && i < units.length - 1) {
+		bytes /= 1024;
+		i++;
+	}
+	return (i === 0 ? bytes : bytes.toFixed(1)) + " " + units[i];
+}
+
+// A chart of the size of the database for each commit of a branch
+function SizeHistoryChart() {
+	const [branch, setBranch] = React.useState(meta.defaultBranch);
+
+	const branches = Object.keys(sizeHistory).sort().map(b => ({name: b}));
+	const commits = sizeHistory[branch] || [];
+
+	// Commits which grew the database by more than the size alert allows are highlighted
+	const overAlert = commits.map((c, i) => {
+		if (i === 0) {
+			return false;
+		}
+		const growth = c.size - commits[i - 1].size;
+		return growth > 0 && ((sizeAlert.growth_bytes > 0 && growth > sizeAlert.growth_bytes) ||
+			(sizeAlert.growth_percent > 0 && growth * 100 > commits[i - 1].size * sizeAlert.growth_percent));
+	});
+
+	return (<>
+		<h5 className="mt-2">Database size</h5>
+		<div className="d-flex align-items-center">
+			<span className="me-2">Branch:</span>
+			<Select name="branchname" required={true} labelField="name" valueField="name" onChange={(values) => setBranch(values[0].name)} options={branches} values={[{name: branch}]} />
+		</div>
+		<Plot
+			data={[{
+				x: commits.map(c => c.timestamp),
+				y: commits.map(c => c.size),
+				text: commits.map(c => c.commit.substring(0, 8) + ": " + formatSize(c.size)),
+				hoverinfo: "text",
+				type: "scatter",
+				mode: "lines+markers",
+				marker: {color: overAlert.map(o => o ? "#a01e1a" : "#2e6da4")},
+				name: "Size",
+			}]}
+			layout={{
+				autosize: true,
+				xaxis: {
+					type: "date",
+					ticks: "outside",
+				},
+				yaxis: {
+					visible: true,
+					showline: true,
+					ticks: "outside",
+					title: "Bytes",
+					rangemode: "tozero",
+				},
+			}}
+			config={{
+				watermark: false,
+				displayModeBar: false,
+			}}
+			useResizeHandler={true}
+			className="mt-1 w-100"
+		/>
+		<p className="text-muted"><small>
+			{sizeAlert.growth_bytes === 0 && sizeAlert.growth_percent === 0 ?
+				"No size alert is set for this database.  One can be set using the sizealertset API call." :
+				"Commits growing the database by more than " + [
+					sizeAlert.growth_bytes > 0 ? formatSize(sizeAlert.growth_bytes) : null,
+					sizeAlert.growth_percent > 0 ? sizeAlert.growth_percent + "%" : null,
+				].filter(x => x !== null).join(" or ") + " are shown in red, and you're emailed about them."}
+		</small></p>
+	</>);
+}
+
+export default function DatabaseInsights() {
+	const [selectedRange, setSelectedRange] = React.useState(30);
+
+	// Only chart the days in the selected range.  The server provides one entry per day, oldest first
+	const days = analyticsData === null ? [] : analyticsData.slice(-selectedRange);
+
+	// Add up the totals for the selected range
+	const totals = {};
+	availableValues.forEach(v => totals[v.value] = days.reduce((sum, d) => sum + d[v.value], 0));
+
+	const data = availableValues.map(v => ({
+		x: days.map(d => d.date),
+		y: days.map(d => d[v.value]),
+		type: "scatter",
+		mode: "lines",
+		name: v.label,
+	}));
+
+	return (<>
+		<div className="row mt-2">
+			{availableValues.map(v =>
+				<div className="col-md-3" key={v.value}>
+					<div className="card text-center mb-2">
+						<div className="card-body">
+							<h3 className="card-title" data-cy={"total-" + v.value}>{totals[v.value].toLocaleString()}</h3>
+							<span className="text-muted">{v.label}</span>
+						</div>
+					</div>
+				</div>
+			)}
+		</div>
+		<ButtonGroup>
+			{availableRanges.map(r =>
+				<ToggleButton
+					id={"btn-" + r.value}
+					key={r.value}
+					type="radio"
+					variant="light"
+					name="ranges"
+					value={r.value}
+					checked={selectedRange === r.value}
+					onChange={e => setSelectedRange(parseInt(e.currentTarget.value))}
+				>{r.label}</ToggleButton>
+			)}
+		</ButtonGroup>
+		<Plot
+			data={data}
+			layout={{
+				autosize: true,
+				xaxis: {
+					type: "date",
+					ticks: "outside",
+				},
+				yaxis: {
+					visible: true,
+					showline: true,
+					ticks: "outside",
+					title: "Daily count",
+					rangemode: "tozero",
+				},
+				legend: {
+					orientation: "h",
+					xanchor: "center",
+					yanchor: "bottom",
+					y: 1.0,
+					x: 0.5,
+				},
+			}}
+			config={{
+				watermark: false,
+				displayModeBar: false,
+			}}
+			useResizeHandler={true}
+			className="mt-1 w-100"
+		/>
+		{downloadBreakdown === null ? null : <>
+			<h5 className="mt-2">Where downloads come from</h5>
+			<div className="row">
+				<BreakdownTable title="Client" entries={downloadBreakdown[selectedRange].clients} unknown="Unknown" nameFormatter={n => clientNames[n] || n} />
+				<BreakdownTable title="Country" entries={downloadBreakdown[selectedRange].countries} unknown="Unknown" />
+				<BreakdownTable title="Referrer" entries={downloadBreakdown[selectedRange].referrers} unknown="None / direct" />
+			</div>
+		</>}
+		<p className="text-muted"><small>Days are in UTC.  Clones are downloads by DB4S and Dio.  Downloads, clones, and API queries are updated every hour.</small></p>
+		{sizeHistory === null ? null : <SizeHistoryChart />}
+	</>);
+}
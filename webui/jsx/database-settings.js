@@ -196,6 +196,7 @@ export default function DatabaseSettings() {
 	const [defaultTable, setDefaultTable] = React.useState(meta.defaultTable);
 	const [defaultBranch, setDefaultBranch] = React.useState(meta.defaultBranch);
 	const [sourceUrl, setSourceUrl] = React.useState(meta.sourceUrl);
+	const [isTemplate, setTemplate] = React.useState(meta.isTemplate);
 
 	// Handler for the cancel button.  Just bounces back to the database page
 	function cancelSettings() {
@@ -352,6 +353,17 @@ export default function DatabaseSettings() {
 					<input id="sourceurl" name="sourceurl" value={sourceUrl} onChange={(e) => setSourceUrl(e.target.value)} data-cy="sourceurl" className="form-control" />
 				</div>
 			</div>
+			{meta.isLive === false && meta.clientEncrypted === false ?
+				<div className="row mb-2">
+					<label className="col-sm-2 col-form-label">Template?</label>
+					<div className="col-sm-10">
+						<div className="form-check form-switch mt-2">
+							<input type="checkbox" className="form-check-input" id="template" name="template" value="true" checked={isTemplate} onChange={(e) => setTemplate(e.target.checked)} data-cy="template" />
+							<label className="form-check-label" htmlFor="template">{isTemplate ? "People who can see this database can create new databases from its schema" : "This database isn't a template"}</label>
+						</div>
+					</div>
+				</div>
+			: null}
 			{meta.isLive === false ? <LicenceEdit /> : null}
 			<ShareEdit />
 			<div className="row mb-2">
@@ -69,12 +69,50 @@ function DatabaseTagRow({name, data, releases, setStatusMessage, setStatusMessag
 		});
         }
 
+	// This is the DOI of the release, if one has been minted
+	const [doi, setDoi] = React.useState(data.doi);
+
+	// Mint a DOI for the release
+	function mintDoi() {
+		fetch("/x/releasedoi/", {
+			method: "post",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded"
+			},
+			body: new URLSearchParams({
+				"tag": savedTagName,
+				"dbname": meta.database,
+				"username": meta.owner
+			}),
+		}).then((response) => {
+			if (!response.ok) {
+				return Promise.reject(response);
+			}
+			return response.json();
+		})
+		.then((data) => {
+			setDoi(data.doi);
+			setStatusMessageColour("green");
+			setStatusMessage("DOI minted");
+		})
+		.catch((error) => {
+			// The minting failed, so display an error message
+			setStatusMessageColour("red");
+			if (error.text) {
+				error.text().then(text => setStatusMessage("Minting the DOI failed: " + text));
+			} else {
+				setStatusMessage("Minting the DOI failed");
+			}
+		});
+	}
+
 	let actionsCol = null;
 	if (meta.owner === authInfo.loggedInUser) {
 		actionsCol = (
 			<td>
 				<p><button className="btn btn-primary" onClick={() => updateTag()} data-cy="updatebtn">Update</button></p>
 				<p><button className="btn btn-danger" onClick={() => deleteTag()} data-cy="delbtn">Delete</button></p>
+				{releases && doiEnabled && !doi ? <p><button className="btn btn-secondary" onClick={() => mintDoi()} data-cy="doibtn">Mint DOI</button></p> : null}
 			</td>
 		);
 	}
@@ -100,6 +138,8 @@ function DatabaseTagRow({name, data, releases, setStatusMessage, setStatusMessag
 				{releases ? <>
 					<a href={"/x/download/" + meta.owner + "/" + meta.database + "?commit=" + data.commit} className="btn btn-success">Download</a>
 					<p>{Math.round(data.size / 1024).toLocaleString()} KB</p>
+					{doi ? <p><a href={"https://doi.org/" + doi} data-cy="doilnk">{doi}</a></p> : null}
+					<p>Cite: <a href={"/x/citation/" + meta.owner + "/" + meta.database + "?format=cff&release=" + encodeURIComponent(savedTagName)}>CFF</a> | <a href={"/x/citation/" + meta.owner + "/" + meta.database + "?format=datacite&release=" + encodeURIComponent(savedTagName)}>DataCite</a></p>
 				</> : null}
 			</td>
 			{actionsCol}
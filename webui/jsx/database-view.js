@@ -8,6 +8,7 @@ import { confirmAlert } from "react-confirm-alert";
 import "react-confirm-alert/src/react-confirm-alert.css";
 
 import { copyToClipboard } from "./clipboard";
+import { getTimePeriod } from "./format";
 import { userPrefTheme } from "./theme";
 
 export function DatabaseDescription({oneLineDescription, sourceUrl}) {
@@ -77,7 +78,7 @@ export function DatabaseActions({table, numSelectedRows, allowInsert, setTable,
 	meta.tableList.forEach(function(v) {
 		tables.push({name: v});
 	});
-	const tableSelection = (
+	const tableSelection = meta.clientEncrypted ? null : (
 		<div className="d-inline-block">
 			<Select name="viewtable" required={true} labelField="name" valueField="name" onChange={(values) => setTable(values[0].name)} options={tables} values={[{name: table}]} contentRenderer={dropdownContentRendererWithLabel("Table/view")} />
 		</div>
@@ -101,7 +102,7 @@ export function DatabaseActions({table, numSelectedRows, allowInsert, setTable,
 		<div className="row mb-2">
 			<div className="col-md-8">
 				<span className="pull-left">{tableSelection}&nbsp; {branchSelection}&nbsp;
-					{authInfo.loggedInUser && !meta.isLive ? <a href={"/compare/" + meta.owner + "/" + meta.database} className="btn btn-primary" data-cy="newmrbtn">New Merge Request</a> : null}&nbsp;
+					{authInfo.loggedInUser && !meta.isLive && !meta.clientEncrypted ? <a href={"/compare/" + meta.owner + "/" + meta.database} className="btn btn-primary" data-cy="newmrbtn">New Merge Request</a> : null}&nbsp;
 					{authInfo.loggedInUser && !meta.isLive ? <a href={"/upload/?username=" + meta.owner + "&dbname=" + meta.database + "&branch=" + meta.branch} className="btn btn-primary" data-cy="uploadbtn">Upload database</a> : null}
 				</span>
 			</div>
@@ -124,13 +125,14 @@ export function DatabaseActions({table, numSelectedRows, allowInsert, setTable,
 						</button>
 						<div className="dropdown-menu">
 							<a className="dropdown-item" href={"/x/download/" + meta.owner + "/" + meta.database + "?commit=" + meta.commitID} data-cy="dldb">Entire database</a>
-							{meta.size <= 100000000  && meta.isLive === false ? <a className="dropdown-item" href={"/x/downloadcsv/" + meta.owner + "/" + meta.database + "?commit=" + meta.commitID + "&table=" + table} data-cy="dlcsv">Selected table as CSV</a> : null}
+							{meta.size <= 100000000  && meta.isLive === false && !meta.clientEncrypted ? <a className="dropdown-item" href={"/x/downloadcsv/" + meta.owner + "/" + meta.database + "?commit=" + meta.commitID + "&table=" + table} data-cy="dlcsv">Selected table as CSV</a> : null}
+							{meta.size <= 100000000  && meta.isLive === false && !meta.clientEncrypted ? <a className="dropdown-item" href={"/x/downloaddatapackage/" + meta.owner + "/" + meta.database + "?commit=" + meta.commitID} data-cy="dldatapackage">Data package (zip)</a> : null}
 						</div>
 					</div>
 				</span>
 			</div>
 		</div>
-		{meta.isLive && tableEdit.writeEnabled ? (
+		{tableEdit.writeEnabled ? (
 			<div className="row mb-2"><div className="col-md-12">
 				<button type="button" className="btn btn-primary btn-sm" disabled={allowInsert ? null : "disabled"} onClick={() => insertRow()}>
 					<span className="fa fa-plus" aria-hidden="true"></span> Insert empty row
@@ -189,6 +191,83 @@ function DatabasePageControls({position, offset, maxRows, rowCount, setOffset})
 	);
 }
 
+// Shows which commits added, changed, or deleted the selected row
+function RowHistoryPanel({table, rowKey, onClose}) {
+	const [history, setHistory] = React.useState(null);
+	const [error, setError] = React.useState(null);
+
+	React.useEffect(() => {
+		setHistory(null);
+		setError(null);
+		fetch("/x/rowhistory/" + meta.owner + "/" + meta.database + "?branch=" + encodeURIComponent(meta.branch) + "&table=" + encodeURIComponent(table) + "&key=" + encodeURIComponent(rowKey))
+			.then((response) => {
+				if (!response.ok) {
+					return Promise.reject(response);
+				}
+				return response.json();
+			})
+			.then((data) => setHistory(data))
+			.catch((error) => {
+				error.text().then((text) => setError(text));
+			});
+	}, [table, rowKey]);
+
+	const commitLink = function(c) {
+		return <a href={"/" + meta.owner + "/" + meta.database + "?commit=" + c.commit_id + "&table=" + encodeURIComponent(table)}>{c.commit_id.substring(0, 8)}</a>;
+	};
+
+	let body;
+	if (error !== null) {
+		body = <div className="text-danger">{error}</div>;
+	} else if (history === null) {
+		body = <i>Looking through the commit history...</i>;
+	} else {
+		body = (<>
+			<p>
+				{history.introduced ? <>Added in {commitLink(history.introduced)} by {history.introduced.author_name}, {getTimePeriod(history.introduced.timestamp, true)}.&nbsp;</> : null}
+				{history.last_modified && (!history.introduced || history.last_modified.commit_id !== history.introduced.commit_id) ? <>Last changed in {commitLink(history.last_modified)} by {history.last_modified.author_name}, {getTimePeriod(history.last_modified.timestamp, true)}.</> : null}
+				{history.complete ? null : <i> Only the most recent history of this branch was looked at.</i>}
+			</p>
+			<table className="table table-sm table-striped mb-0">
+				<thead><tr><th>Commit</th><th>Change</th><th>Author</th><th>When</th><th>Message</th></tr></thead>
+				<tbody>
+					{history.changes.map((c) => (
+						<tr key={c.commit_id}>
+							<td>{commitLink(c)}</td>
+							<td>{c.action === "add" ? "Added" : c.action === "delete" ? "Deleted" : "Changed"}</td>
+							<td>{c.author_name}</td>
+							<td><span title={new Date(c.timestamp).toLocaleString()}>{getTimePeriod(c.timestamp, false)}</span></td>
+							<td>{c.message}</td>
+						</tr>
+					))}
+				</tbody>
+			</table>
+		</>);
+	}
+
+	return (
+		<div className="card mt-2" data-cy="rowhistory">
+			<div className="card-header">
+				Row history
+				<button type="button" className="btn-close float-end" aria-label="Close" onClick={() => onClose()}></button>
+			</div>
+			<div className="card-body">{body}</div>
+		</div>
+	);
+}
+
+// The previews of the cells of a row are kept under this key, so they don't clash with any column name and aren't sent
+// back to the server when the row is edited
+const cellPreviews = Symbol("cellPreviews");
+
+// Renders the preview of an image or geometry cell value
+function CellPreview({preview}) {
+	if (preview.thumbnail) {
+		return <img src={preview.thumbnail} alt="Image preview" style={{maxHeight: "100%"}} />;
+	}
+	return <span title={JSON.stringify(preview.geojson)}><i className="fa fa-map-marker"></i> {preview.geojson.type}</span>;
+}
+
 function DataGridNoRowsRender() {
 	return <div className="text-center" style={{gridColumn: "1/-1"}}><i>This table is empty</i></div>;
 }
@@ -203,6 +282,7 @@ export default function DatabaseView() {
 	const [sortColumns, setSortColumns] = React.useState([]);
 	const [primaryKeyColumns, setPrimaryKeyColumns] = React.useState([]);
 	const [selectedRows, setSelectedRows] = React.useState(null);
+	const [historyRowKey, setHistoryRowKey] = React.useState(null);
 
 	// Retrieves the branch being viewed
 	function changeBranch(newbranch) {
@@ -219,16 +299,17 @@ export default function DatabaseView() {
 		// We do not need to check the value in newOffset here. It is checked on the server-side application
 		// and the corrected offset is reported back by the server
 
-		fetch("/x/table/" + meta.owner + "/" + meta.database + "?commit=" + meta.commitID + "&table=" + newTable + "&sort=" + (newSortCol ? newSortCol : "") + "&dir=" + (newSortDir ? newSortDir : "") + "&offset=" + newOffset)
+		fetch("/x/table/" + meta.owner + "/" + meta.database + "?commit=" + meta.commitID + "&table=" + newTable + "&sort=" + (newSortCol ? newSortCol : "") + "&dir=" + (newSortDir ? newSortDir : "") + "&offset=" + newOffset + "&previews=true")
 			.then((response) => response.json())
 			.then(function (data) {
 				// Get primary key columns. They are an optional property
 				let pk = Object.hasOwn(data, "primaryKeyColumns") ? data.primaryKeyColumns : [];
 
-				// The editing features are enabled if this is a live database and if there is
-				// a primary key here (which excludes views here)
+				// The editing features are enabled if the user can write to the database and if there is
+				// a primary key here (which excludes views here).  For standard databases, changes are
+				// stored as new commits on the branch
 				let editable = false;
-				if (meta.isLive === true && pk.length > 0 && tableEdit.writeEnabled) {
+				if (pk.length > 0 && tableEdit.writeEnabled) {
 					editable = true;
 				}
 
@@ -250,6 +331,8 @@ export default function DatabaseView() {
 							formatter: (props) => {
 								if (props.row[c] === null) {
 									return <i>NULL</i>;
+								} else if (props.row[cellPreviews]?.[c]) {
+									return <CellPreview preview={props.row[cellPreviews][c]} />;
 								} else {
 									return props.row[c];
 								}
@@ -262,9 +345,12 @@ export default function DatabaseView() {
 				let rows = [];
 				if  (data.Records !== null) {
 					data.Records.forEach(function(r) {
-						let row = {};
+						let row = {[cellPreviews]: {}};
 						r.forEach(function(c) {
 							row[c.Name] = c.Value;
+							if (c.Preview) {
+								row[cellPreviews][c.Name] = c.Preview;
+							}
 						});
 						rows.push(row);
 					});
@@ -279,6 +365,7 @@ export default function DatabaseView() {
 				setSortColumns([{columnKey: data.SortCol, direction: data.SortDir}]);
 				setPrimaryKeyColumns(pk);
 				setSelectedRows(null);
+				setHistoryRowKey(null);
 			});
 	}
 
@@ -292,6 +379,12 @@ export default function DatabaseView() {
 		return JSON.stringify(key);
 	}
 
+	// Changes to standard databases are stored as new commits, so after a change the page is reloaded to show the new
+	// head commit of the branch
+	function showBranchHead() {
+		window.location = "/" + meta.owner + "/" + meta.database + "?branch=" + encodeURIComponent(meta.branch) + "&table=" + encodeURIComponent(table) + "&offset=" + offset;
+	}
+
 	// This function is called when the user tries to edit a row
 	function updateRowData(rows, data) {
 		// Get name of updated column
@@ -319,13 +412,17 @@ export default function DatabaseView() {
 			headers: {
 				"Content-Type": "application/json",
 			},
-			body: JSON.stringify({table: table, data: updateData})
+			body: JSON.stringify({table: table, branch: meta.branch, data: updateData})
 		})
 			.then((response) => {
 				if (!response.ok) {
 					return Promise.reject(response);
 				}
-				setRecords(rows);
+				if (meta.isLive) {
+					setRecords(rows);
+				} else {
+					showBranchHead();
+				}
 			})
 			.catch((error) => {
 				// TODO Replace this by some prettier status message bar or so
@@ -349,7 +446,7 @@ export default function DatabaseView() {
 			headers: {
 				"Content-Type": "application/json",
 			},
-			body: JSON.stringify({table: table, data: data})
+			body: JSON.stringify({table: table, branch: meta.branch, data: data})
 		})
 			.then((response) => {
 				if (!response.ok) {
@@ -357,6 +454,10 @@ export default function DatabaseView() {
 				}
 
 				// If the delete process was successful, reload the page
+				if (!meta.isLive) {
+					showBranchHead();
+					return;
+				}
 				changeView(table, offset, sortColumns.length ? sortColumns[0].columnKey : null, sortColumns.length ? sortColumns[0].direction : null, true);
 			})
 			.catch((error) => {
@@ -387,7 +488,7 @@ export default function DatabaseView() {
 	// This function requests the server to insert a new empty row into the table. It then reloads the current view to
 	// allowing editing of the new row.
 	function insertRow() {
-		fetch("/x/insertdata/" + meta.owner + "/" + meta.database + "?table=" + table, {
+		fetch("/x/insertdata/" + meta.owner + "/" + meta.database + "?table=" + table + "&branch=" + encodeURIComponent(meta.branch), {
 			method: "post",
 		})
 			.then((response) => {
@@ -396,6 +497,10 @@ export default function DatabaseView() {
 				}
 
 				// If the insert was successful reload the page
+				if (!meta.isLive) {
+					showBranchHead();
+					return;
+				}
 				changeView(table, offset, sortColumns.length ? sortColumns[0].columnKey : null, sortColumns.length ? sortColumns[0].direction : null, true);
 			})
 			.catch((error) => {
@@ -408,6 +513,11 @@ export default function DatabaseView() {
 
 	// Initial load of the first table when first rendering the component
 	React.useEffect(() => {
+		// Databases encrypted by their owner can't be read by the server, so there's no data to show
+		if (meta.clientEncrypted) {
+			return;
+		}
+
 		// If provided, we use the values from the URL as default parameters
 		let urlParams = new URL(window.location.href).searchParams;
 		let urlTable = urlParams.get("table");
@@ -429,32 +539,41 @@ export default function DatabaseView() {
 		<DatabaseActions
 			table={table}
 			numSelectedRows={selectedRows ? selectedRows.size : 0}
-			allowInsert={meta.isLive && primaryKeyColumns.length}
+			allowInsert={primaryKeyColumns.length}
 			setBranch={changeBranch}
 			setTable={(newTable) => {if (newTable !== table) { changeView(newTable, 0); }}}
 			deleteSelectedRows={confirmDeleteSelectedRows}
 			insertRow={insertRow}
 		/>
-		<DatabasePageControls position="top" offset={offset} maxRows={maxRows} rowCount={rowCount} setOffset={(newOffset) => changeView(table, newOffset, sortColumns.length ? sortColumns[0].columnKey : null, sortColumns.length ? sortColumns[0].direction : null)} />
-		<DataGrid
-			// We are showing one page of rows unless this is the last page with a smaller number of rows.  The "+ 1" includes the header row.  The 35 is the default row height size in pixels.
-			style={{height: ((Math.min(rowCount - offset, maxRows) + 1) * 35) + "px", overflowY: "hidden"}}
-			className={"rdg-" + userPrefTheme()}
-			renderers={{noRowsFallback: <DataGridNoRowsRender />}}
-			columns={columns}
-			rows={records}
-			sortColumns={sortColumns}
-			onSortColumnsChange={(s) => changeView(table, offset, s.length ? s[0].columnKey : null, s.length ? s[0].direction : null)}
-			rowKeyGetter={rowKeyGetter}
-			onRowsChange={updateRowData}
-			selectedRows={selectedRows}
-			onSelectedRowsChange={setSelectedRows}
-			defaultColumnOptions={{
-				sortable: true,
-				resizable: true
-			}}
-		/>
-		<DatabasePageControls position="bottom" offset={offset} maxRows={maxRows} rowCount={rowCount} setOffset={(newOffset) => changeView(table, newOffset, sortColumns.length ? sortColumns[0].columnKey : null, sortColumns.length ? sortColumns[0].direction : null)} />
+		{meta.clientEncrypted ? (
+			<div className="alert alert-info" role="alert" data-cy="encryptedmsg">
+				This database was encrypted before being uploaded, so its data can't be viewed here.  It can still be downloaded, and opened with its key.
+			</div>
+		) : (<>
+			<DatabasePageControls position="top" offset={offset} maxRows={maxRows} rowCount={rowCount} setOffset={(newOffset) => changeView(table, newOffset, sortColumns.length ? sortColumns[0].columnKey : null, sortColumns.length ? sortColumns[0].direction : null)} />
+			<DataGrid
+				// We are showing one page of rows unless this is the last page with a smaller number of rows.  The "+ 1" includes the header row.  The 35 is the default row height size in pixels.
+				style={{height: ((Math.min(rowCount - offset, maxRows) + 1) * 35) + "px", overflowY: "hidden"}}
+				className={"rdg-" + userPrefTheme()}
+				renderers={{noRowsFallback: <DataGridNoRowsRender />}}
+				columns={columns}
+				rows={records}
+				sortColumns={sortColumns}
+				onSortColumnsChange={(s) => changeView(table, offset, s.length ? s[0].columnKey : null, s.length ? s[0].direction : null)}
+				rowKeyGetter={rowKeyGetter}
+				onRowsChange={updateRowData}
+				selectedRows={selectedRows}
+				onSelectedRowsChange={setSelectedRows}
+				// Clicking on a row of a standard database shows its history, when the row can be addressed by its primary key
+				onCellClick={(args) => {if (!meta.isLive && primaryKeyColumns.length) { setHistoryRowKey(rowKeyGetter(args.row)); }}}
+				defaultColumnOptions={{
+					sortable: true,
+					resizable: true
+				}}
+			/>
+			<DatabasePageControls position="bottom" offset={offset} maxRows={maxRows} rowCount={rowCount} setOffset={(newOffset) => changeView(table, newOffset, sortColumns.length ? sortColumns[0].columnKey : null, sortColumns.length ? sortColumns[0].direction : null)} />
+			{historyRowKey !== null ? <RowHistoryPanel table={table} rowKey={historyRowKey} onClose={() => setHistoryRowKey(null)} /> : null}
+		</>)}
 		<DatabaseFullDescription description={meta.fullDescription} />
 	</>);
 }
@@ -43,6 +43,198 @@ function ToggleButton({icon, textSet, textUnset, redirectUrl, updateUrl, pageUrl
 	);
 }
 
+function WatchButton() {
+	const [mode, setMode] = React.useState(meta.watchMode);
+	const [number, setNumber] = React.useState(meta.numWatchers);
+
+	function gotoPage() {
+		window.location = "/watchers/" + meta.owner + "/" + meta.database;
+	}
+
+	// Start or stop watching the database
+	function toggleWatch() {
+		if (!authInfo.loggedInUser) {
+			// User needs to be logged in
+			lock.show();
+			return;
+		}
+
+		fetch("/x/watch/" + meta.owner + "/" + meta.database)
+			.then((response) => response.text())
+			.then((text) => {
+				setMode(mode === "" ? "all" : "");
+				setNumber(text);
+			});
+	}
+
+	// Change the type of activity being watched for
+	function changeMode(newMode) {
+		fetch("/x/watchmode/" + meta.owner + "/" + meta.database, {
+			method: "post",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded"
+			},
+			body: new URLSearchParams({"mode": newMode}),
+		}).then(response => {
+			if (!response.ok) {
+				return Promise.reject(response);
+			}
+			return response.text();
+		}).then(text => {
+			setMode(newMode);
+			setNumber(text);
+		});
+	}
+
+	return (
+		<div className="btn-group">
+			<button type="button" className="btn btn-outline-secondary text-reset" onClick={toggleWatch} data-cy="watcherstogglebtn"><i className="fa fa-eye"></i> {mode !== "" ? "Unwatch" : "Watch"}</button>
+			{mode !== "" ? (
+				<select className="form-select form-select-sm" value={mode} onChange={e => changeMode(e.target.value)} title="Activity to be notified about" data-cy="watchmodesel">
+					<option value="all">All activity</option>
+					<option value="releases">Releases only</option>
+					<option value="participating">Participating</option>
+				</select>
+			) : null}
+			<button type="button" className="btn btn-outline-secondary text-reset" onClick={gotoPage} data-cy="watcherspagebtn">{number}</button>
+		</div>
+	);
+}
+
+// Shows the verified badge of the database.  Instance admins can also mark or unmark the database as verified from here
+function VerifiedBadge() {
+	const [verified, setVerified] = React.useState(meta.verified);
+
+	function toggleVerified() {
+		fetch("/x/verifydb/", {
+			method: "post",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded"
+			},
+			body: new URLSearchParams({
+				"dbname": meta.database,
+				"username": meta.owner,
+				"verified": !verified,
+			}),
+		}).then(response => {
+			if (response.ok) {
+				setVerified(!verified);
+			}
+		});
+	}
+
+	let badge = null;
+	if (verified) {
+		badge = <span className="badge bg-success ms-2" title="This database has been verified by the administrators" data-cy="verifiedbadge"><i className="fa fa-check-circle"></i> Verified</span>;
+	}
+	if (!authInfo.isAdmin) {
+		return badge;
+	}
+	return (<>
+		{badge}
+		<button type="button" className="btn btn-sm btn-outline-secondary ms-2" onClick={toggleVerified} data-cy="verifybtn">{verified ? "Remove verification" : "Mark as verified"}</button>
+	</>);
+}
+
+// Shows the archived badge of the database.  The owner can also archive the database, or make it writable again, from
+// here
+function ArchivedBadge() {
+	const [archived, setArchived] = React.useState(meta.archived);
+
+	function toggleArchived() {
+		fetch("/x/archivedb/", {
+			method: "post",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded"
+			},
+			body: new URLSearchParams({
+				"dbname": meta.database,
+				"username": meta.owner,
+				"archived": !archived,
+			}),
+		}).then(response => {
+			if (response.ok) {
+				setArchived(!archived);
+			}
+		});
+	}
+
+	let badge = null;
+	if (archived) {
+		badge = <span className="badge bg-secondary ms-2" title="This database has been archived by its owner, so it doesn't accept new commits, discussions, or merge requests" data-cy="archivedbadge"><i className="fa fa-archive"></i> Archived</span>;
+	}
+	if (meta.owner !== authInfo.loggedInUser) {
+		return badge;
+	}
+	return (<>
+		{badge}
+		<button type="button" className="btn btn-sm btn-outline-secondary ms-2" onClick={toggleArchived} data-cy="archivebtn">{archived ? "Unarchive" : "Archive"}</button>
+	</>);
+}
+
+// Shows the template badge of the database, along with a form for creating a new database from the template
+function TemplateBadge() {
+	const [showForm, setShowForm] = React.useState(false);
+	const [newName, setNewName] = React.useState(meta.database);
+	const [withData, setWithData] = React.useState(false);
+	const [status, setStatus] = React.useState("");
+
+	if (!meta.isTemplate) {
+		return null;
+	}
+
+	function createDatabase() {
+		fetch("/x/usetemplate/", {
+			method: "post",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded"
+			},
+			body: new URLSearchParams({
+				"dbname": meta.database,
+				"username": meta.owner,
+				"newname": newName,
+				"data": withData,
+			}),
+		}).then(response => {
+			response.text().then(text => {
+				if (response.ok) {
+					window.location = text;
+				} else {
+					setStatus(text);
+				}
+			});
+		});
+	}
+
+	const badge = <span className="badge bg-info ms-2" title="This database is a template.  Its schema can be used to create new databases" data-cy="templatebadge"><i className="fa fa-clone"></i> Template</span>;
+	if (!authInfo.loggedInUser) {
+		return badge;
+	}
+
+	let form = null;
+	if (showForm) {
+		form = (
+			<div className="fs-6 fw-normal mt-2" data-cy="templateform">
+				<div className="input-group input-group-sm mb-1" style={{maxWidth: "30em"}}>
+					<span className="input-group-text">New database name</span>
+					<input type="text" className="form-control" value={newName} onChange={e => setNewName(e.target.value)} data-cy="templatename" />
+					<button type="button" className="btn btn-success" onClick={createDatabase} data-cy="templatecreatebtn">Create</button>
+				</div>
+				<div className="form-check">
+					<input type="checkbox" className="form-check-input" id="templatedata" checked={withData} onChange={e => setWithData(e.target.checked)} data-cy="templatedata" />
+					<label className="form-check-label" htmlFor="templatedata">Include the data of the template</label>
+				</div>
+				{status ? <div className="text-danger" data-cy="templatestatus">{status}</div> : null}
+			</div>
+		);
+	}
+	return (<>
+		{badge}
+		<button type="button" className="btn btn-sm btn-outline-secondary ms-2" onClick={() => setShowForm(!showForm)} data-cy="usetemplatebtn">Use this template</button>
+		{form}
+	</>);
+}
+
 export default function DbHeader() {
 	// Fork and commit information and actions are only shown for non-live databases
 	let forkedFrom = null;
@@ -113,21 +305,14 @@ export default function DbHeader() {
 						<div>
 							<a href={"/" + meta.owner} data-cy="headerownerlnk">{meta.owner}</a> /&nbsp;
 							<a href={"/" + meta.owner + "/" + meta.database} data-cy="headerdblnk">{meta.database}</a>
+							<VerifiedBadge />
+							<ArchivedBadge />
+							<TemplateBadge />
 						</div>
 						{forkedFrom}
 					</div>
 					<div className="pull-right">
-						<ToggleButton
-							icon="fa-eye"
-							textSet="Unwatch"
-							textUnset="Watch"
-							updateUrl={"/x/watch/" + meta.owner + "/" + meta.database}
-							pageUrl={"/watchers/" + meta.owner + "/" + meta.database}
-							isSet={meta.isWatching}
-							count={meta.numWatchers}
-							cyToggle="watcherstogglebtn"
-							cyPage="watcherspagebtn"
-						/>
+						<WatchButton />
 						&nbsp;
 						<ToggleButton
 							icon="fa-star"
@@ -154,6 +339,8 @@ export default function DbHeader() {
 				{meta.isLive && (meta.owner === authInfo.loggedInUser) ? <a id="viewexec" className={meta.pageSection === "db_exec" ? "nav-link active" : "nav-link"} href={"/exec/" + meta.owner + "/" + meta.database} title="Execute SQL" data-cy="execlink"><i className="fa fa-wrench"></i> Execute SQL</a> : null }
 				<a id="viewdiscuss" className={meta.pageSection === "db_disc" ? "nav-link active" : "nav-link"} href={"/discuss/" + meta.owner + "/" + meta.database} title="Discussions" data-cy="discusslink"><i className="fa fa-commenting"></i> Discussions: {meta.numDiscussions}</a>
 				{meta.isLive ? null : <a id="viewmrs" className={meta.pageSection === "db_merge" ? "nav-link active" : "nav-link"} href={"/merge/" + meta.owner + "/" + meta.database} title="Merge Requests" data-cy="mrlink"><i className="fa fa-clone"></i> Merge Requests: {meta.numMRs}</a>}
+				{meta.isLive ? null : <a id="viewhealth" className={meta.pageSection === "db_health" ? "nav-link active" : "nav-link"} href={"/health/" + meta.owner + "/" + meta.database} title="Health" data-cy="healthlink"><i className="fa fa-heartbeat"></i> Health</a>}
+				{meta.owner === authInfo.loggedInUser ? <a id="viewinsights" className={meta.pageSection === "db_insights" ? "nav-link active" : "nav-link"} href={"/insights/" + meta.owner + "/" + meta.database} title="Insights" data-cy="insightslink"><i className="fa fa-line-chart"></i> Insights</a> : null}
 				{settings}
 			</nav>
 		    </div>
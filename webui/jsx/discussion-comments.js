@@ -4,9 +4,181 @@ const ReactDOM = require("react-dom");
 import MarkdownEditor from "./markdown-editor";
 import CommitList from "./commit-list";
 import { getTimePeriod } from "./format";
+import { LabelBadge } from "./discussion-labels";
 import { confirmAlert } from "react-confirm-alert";
 import "react-confirm-alert/src/react-confirm-alert.css";
 
+function DiscussionAssignee({setStatusMessage, setStatusMessageColour}) {
+	const [assignee, setAssignee] = React.useState(discussionData.assignee);
+	const [newAssignee, setNewAssignee] = React.useState(discussionData.assignee);
+	const [editAssignee, setEditAssignee] = React.useState(false);
+
+	// Send the new assignee to the server
+	function saveAssignee(name) {
+		fetch("/x/assigndiscuss/", {
+			method: "post",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded"
+			},
+			body: new URLSearchParams({
+				"assignee": name,
+				"discid": discussionData.disc_id,
+				"dbname": meta.database,
+				"username": meta.owner,
+			}),
+		}).then((response) => {
+			if (!response.ok) {
+				return Promise.reject(response);
+			}
+
+			// The server returns the correctly capitalised name of the assignee
+			response.text().then(text => {
+				setAssignee(text);
+				setNewAssignee(text);
+				setEditAssignee(false);
+				setStatusMessage("");
+			});
+		})
+		.catch((error) => {
+			error.text().then(text => {
+				setStatusMessageColour("red");
+				setStatusMessage("Assigning failed: " + text);
+			});
+		});
+	}
+
+	const canAssign = authInfo.loggedInUser && meta.owner === authInfo.loggedInUser;
+	if (editAssignee) {
+		return (
+			<span className="ms-2">
+				<input className="form-control form-control-sm w-auto d-inline" placeholder="Username" value={newAssignee} onChange={(e) => setNewAssignee(e.target.value)} data-cy="assigneeinput" />&nbsp;
+				<button className="btn btn-sm btn-success" onClick={() => saveAssignee(newAssignee)} data-cy="assigneesave">Assign</button>&nbsp;
+				<button className="btn btn-sm btn-secondary" onClick={() => setEditAssignee(false)}>Cancel</button>
+			</span>
+		);
+	}
+	return (
+		<span className="ms-2" data-cy="assignee">
+			<i className="fa fa-user-o"></i> {assignee !== "" ? <>Assigned to <a href={"/" + assignee}>{assignee}</a></> : "Unassigned"}
+			{canAssign ? <>
+				&nbsp;<a href="#/" onClick={() => setEditAssignee(true)} title="Change assignee"><i className="fa fa-pencil fa-fw"></i></a>
+				{assignee !== "" ? <a href="#/" onClick={() => saveAssignee("")} title="Remove assignee"><i className="fa fa-times fa-fw"></i></a> : null}
+			</> : null}
+		</span>
+	);
+}
+
+// Sends a change to the labels or milestone of the discussion to the server
+function saveDiscussionDetail(url, params, onSuccess, setStatusMessage, setStatusMessageColour) {
+	fetch(url, {
+		method: "post",
+		headers: {
+			"Content-Type": "application/x-www-form-urlencoded"
+		},
+		body: new URLSearchParams({
+			...params,
+			"discid": discussionData.disc_id,
+			"dbname": meta.database,
+			"username": meta.owner,
+		}),
+	}).then((response) => {
+		if (!response.ok) {
+			return Promise.reject(response);
+		}
+		response.text().then(text => {
+			onSuccess(text);
+			setStatusMessage("");
+		});
+	})
+	.catch((error) => {
+		error.text().then(text => {
+			setStatusMessageColour("red");
+			setStatusMessage("Saving failed: " + text);
+		});
+	});
+}
+
+function DiscussionLabels({setStatusMessage, setStatusMessageColour}) {
+	const [labels, setLabels] = React.useState(discussionData.labels);
+	const [editLabels, setEditLabels] = React.useState(false);
+	const available = labelData === null ? [] : labelData;
+
+	function toggleLabel(name) {
+		const newLabels = labels.includes(name) ? labels.filter(l => l !== name) : labels.concat([name]);
+		saveDiscussionDetail("/x/discusslabels/", {"labels": newLabels.join(",")}, text => setLabels(JSON.parse(text)), setStatusMessage, setStatusMessageColour);
+	}
+
+	const canEdit = authInfo.loggedInUser && meta.owner === authInfo.loggedInUser;
+	return (
+		<span className="ms-2" data-cy="labels">
+			<i className="fa fa-tags"></i> {labels.length > 0 ? labels.map(l => <LabelBadge key={l} name={l} labels={available} />) : "No labels"}
+			{canEdit ? <a href="#/" onClick={() => setEditLabels(!editLabels)} title="Change labels" data-cy="editlabels"><i className="fa fa-pencil fa-fw"></i></a> : null}
+			{editLabels ?
+				<span className="ms-1">
+					{available.map(l => (
+						<span key={l.name} className="form-check form-check-inline">
+							<input className="form-check-input" type="checkbox" id={"lbl-" + l.name} checked={labels.includes(l.name)} onChange={() => toggleLabel(l.name)} data-cy={"labelcheck-" + l.name} />
+							<label className="form-check-label" htmlFor={"lbl-" + l.name}>{l.name}</label>
+						</span>
+					))}
+				</span>
+			: null}
+		</span>
+	);
+}
+
+function DiscussionMilestone({setStatusMessage, setStatusMessageColour}) {
+	const [milestone, setMilestone] = React.useState(discussionData.milestone);
+	const milestones = milestoneData === null ? [] : milestoneData;
+
+	function saveMilestone(title) {
+		saveDiscussionDetail("/x/discussmilestone/", {"milestone": title}, text => setMilestone(text), setStatusMessage, setStatusMessageColour);
+	}
+
+	const canEdit = authInfo.loggedInUser && meta.owner === authInfo.loggedInUser;
+	if (canEdit && milestones.length > 0) {
+		return (
+			<span className="ms-2">
+				<i className="fa fa-flag-o"></i>&nbsp;
+				<select className="form-select form-select-sm d-inline w-auto" value={milestone} onChange={e => saveMilestone(e.target.value)} data-cy="milestone">
+					<option value="">No milestone</option>
+					{milestones.filter(m => m.open || m.title === milestone).map(m => <option key={m.title} value={m.title}>{m.title}</option>)}
+				</select>
+			</span>
+		);
+	}
+	if (milestone === "") {
+		return null;
+	}
+	return <span className="ms-2" data-cy="milestone"><i className="fa fa-flag-o"></i> {milestone}</span>;
+}
+
+// The icon and colour shown for each state of a commit status check
+const statusCheckIcons = {
+	"pending": "fa fa-clock-o text-warning",
+	"success": "fa fa-check text-success",
+	"failure": "fa fa-times text-danger",
+};
+
+function StatusChecks({checks}) {
+	return (<>
+		<div className="card-header">
+			<h4>Status checks</h4>
+			{mrData.mergeBlocked !== "" ? <span className="text-warning">{mrData.mergeBlocked}</span> : null}
+		</div>
+		<ul className="list-group list-group-flush">
+			{checks.map(c => (
+				<li className="list-group-item" key={c.context}>
+					<i className={statusCheckIcons[c.state]} title={c.state}></i>&nbsp;
+					<strong>{c.target_url !== "" ? <a href={c.target_url} rel="nofollow noopener">{c.context}</a> : c.context}</strong>
+					{c.description !== "" ? <span className="text-muted"> - {c.description}</span> : null}
+					<span className="pull-right text-muted" title={new Date(c.last_modified).toLocaleString()}>{getTimePeriod(c.last_modified, true)}</span>
+				</li>
+			))}
+		</ul>
+	</>);
+}
+
 function DiscussionTopComment({setStatusMessage, setStatusMessageColour}) {
 	const [discTitle, setDiscTitle] = React.useState(discussionData.title);
 	const [discBody, setDiscBody] = React.useState(discussionData.body);
@@ -148,6 +320,9 @@ function DiscussionTopComment({setStatusMessage, setStatusMessageColour}) {
 						Opened <span title={new Date(discussionData.creation_date).toLocaleString()} className="text-info">{getTimePeriod(discussionData.creation_date, true)}</span> by <a href={"/" + discussionData.creator}>{discussionData.creator}</a>
 					</span>
 				}
+				<DiscussionAssignee setStatusMessage={setStatusMessage} setStatusMessageColour={setStatusMessageColour} />
+				<DiscussionMilestone setStatusMessage={setStatusMessage} setStatusMessageColour={setStatusMessageColour} />
+				<DiscussionLabels setStatusMessage={setStatusMessage} setStatusMessageColour={setStatusMessageColour} />
 			</div>
 			<div className="card-body">
 				{editDiscussion ? <>
@@ -164,9 +339,10 @@ function DiscussionTopComment({setStatusMessage, setStatusMessageColour}) {
 					{discussionData.open ? <a href={"/diffs/" + discussionData.mr_details.source_owner + "/" + discussionData.mr_details.source_database_name + "?commit_a=" + mrData.commitList[mrData.commitList.length - 1].parent + "&commit_b=" + mrData.commitList[0].id}>View changes</a> : null}
 				</div>
 				<CommitList commits={mrData === null ? null : mrData.commitList} owner={discussionData.mr_details.source_owner} database={discussionData.mr_details.source_database_name} />
+				{discussionData.open && (mrData.statusChecks !== null || mrData.mergeBlocked !== "") ? <StatusChecks checks={mrData.statusChecks !== null ? mrData.statusChecks : []} /> : null}
 				{discussionData.mr_details.state !== 1 && (discussionData.creator === authInfo.loggedInUser || meta.owner === authInfo.loggedInUser) ?
 					<div className="card-body">
-						{discussionData.open === true && meta.owner === authInfo.loggedInUser && mrData.destBranchNameOk === true && mrData.destBranchUsable === true ? <><input className="btn btn-success" value="Merge the request" onClick={() => mergeRequest()} />&nbsp;</> : null}
+						{discussionData.open === true && meta.owner === authInfo.loggedInUser && mrData.destBranchNameOk === true && mrData.destBranchUsable === true ? <><input className="btn btn-success" value="Merge the request" disabled={mrData.mergeBlocked !== ""} title={mrData.mergeBlocked} onClick={() => mergeRequest()} />&nbsp;</> : null}
 						{discussionData.creator === authInfo.loggedInUser || meta.owner === authInfo.loggedInUser ? <input className="btn btn-secondary" value={discussionData.open ? "Close without merging" : "Reopen merge request"} onClick={() => closeRequest()} /> : null}
 					</div>
 				: null}
@@ -175,6 +351,79 @@ function DiscussionTopComment({setStatusMessage, setStatusMessageColour}) {
 	);
 }
 
+// The emoji shown for each of the reactions which can be added to comments
+const reactionEmoji = {
+	"+1": "\u{1F44D}",
+	"-1": "\u{1F44E}",
+	"laugh": "\u{1F604}",
+	"hooray": "\u{1F389}",
+	"confused": "\u{1F615}",
+	"heart": "\u{2764}\u{FE0F}",
+	"rocket": "\u{1F680}",
+	"eyes": "\u{1F440}",
+};
+
+function CommentReactions({commentData, setStatusMessage, setStatusMessageColour}) {
+	const [reactions, setReactions] = React.useState(commentData.reactions ? commentData.reactions : {});
+	const [myReactions, setMyReactions] = React.useState(commentData.my_reactions ? commentData.my_reactions : []);
+	const [showPicker, setShowPicker] = React.useState(false);
+
+	// Add or remove a reaction of the logged in user
+	function toggleReaction(reaction) {
+		if (!authInfo.loggedInUser) {
+			// User needs to be logged in
+			lock.show();
+			return;
+		}
+		setShowPicker(false);
+		fetch("/x/reaction/", {
+			method: "post",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded"
+			},
+			body: new URLSearchParams({
+				"add": !myReactions.includes(reaction),
+				"comid": commentData.com_id,
+				"discid": discussionData.disc_id,
+				"reaction": reaction,
+				"dbname": meta.database,
+				"username": meta.owner,
+			}),
+		}).then((response) => {
+			if (!response.ok) {
+				return Promise.reject(response);
+			}
+			return response.json();
+		})
+		.then(data => {
+			setReactions(data.reactions);
+			setMyReactions(data.my_reactions);
+		})
+		.catch((error) => {
+			error.text().then(text => {
+				setStatusMessageColour("red");
+				setStatusMessage("Reacting failed: " + text);
+			});
+		});
+	}
+
+	return (
+		<div className="mt-2" data-cy={"reactions-" + commentData.com_id}>
+			{Object.keys(reactionEmoji).filter(r => reactions[r] > 0).map(r => (
+				<button key={r} className={"btn btn-sm me-1 " + (myReactions.includes(r) ? "btn-outline-primary" : "btn-outline-secondary")} onClick={() => toggleReaction(r)} title={r} data-cy={"reaction-" + r}>
+					{reactionEmoji[r]} {reactions[r]}
+				</button>
+			))}
+			<button className="btn btn-sm btn-light" onClick={() => setShowPicker(!showPicker)} title="Add reaction" data-cy="reactionpicker"><i className="fa fa-smile-o"></i></button>
+			{showPicker ?
+				<span className="ms-1">
+					{Object.keys(reactionEmoji).map(r => <a key={r} href="#/" className="me-1" onClick={() => toggleReaction(r)} title={r}>{reactionEmoji[r]}</a>)}
+				</span>
+			: null}
+		</div>
+	);
+}
+
 function DiscussionComment({commentData, setStatusMessage, setStatusMessageColour}) {
 	const [commentBody, setCommentBody] = React.useState(commentData.body);
 	const [commentBodyRendered, setCommentBodyRendered] = React.useState(commentData.body_rendered);
@@ -260,6 +509,45 @@ function DiscussionComment({commentData, setStatusMessage, setStatusMessageColou
 		});
 	}
 
+	// Reports a comment to the instance admins
+	function reportComment() {
+		const reasons = ["spam", "harassment", "illegal", "malware", "copyright", "other"];
+		confirmAlert({
+			title: "Report comment",
+			message: "Why are you reporting this comment to the admins?",
+			buttons: reasons.map(reason => ({
+				label: reason.charAt(0).toUpperCase() + reason.slice(1),
+				onClick: () => {
+					fetch("/x/abusereport/", {
+						method: "post",
+						headers: {
+							"Content-Type": "application/x-www-form-urlencoded"
+						},
+						body: new URLSearchParams({
+							"comid": commentData.com_id,
+							"dbname": meta.database,
+							"reason": reason,
+							"username": meta.owner,
+						}),
+					}).then((response) => {
+						if (!response.ok) {
+							return Promise.reject(response);
+						}
+
+						setStatusMessageColour("green");
+						setStatusMessage("Thanks, the comment has been reported to the admins");
+					})
+					.catch((error) => {
+						setStatusMessageColour("red");
+						setStatusMessage("Reporting comment failed");
+					});
+				}
+			})).concat([{
+				label: "Cancel"
+			}])
+		});
+	}
+
 	// Special comment type: Discussion closed?
 	if (commentData.entry_type === "cls") {
 		return (
@@ -298,6 +586,11 @@ function DiscussionComment({commentData, setStatusMessage, setStatusMessageColou
 						<a href="#/" onClick={() => deleteComment()}><i className="fa fa-trash-o fa-fw"></i></a>
 					</span>
 				) : null}
+				{authInfo.loggedInUser && commentData.commenter !== authInfo.loggedInUser ? (
+					<span className="pull-right fs-6">
+						<a href="#/" onClick={() => reportComment()} title="Report this comment" data-cy={"report-" + commentData.com_id}><i className="fa fa-flag-o fa-fw"></i></a>
+					</span>
+				) : null}
 			</div>
 			<div className="card-body">
 				{editComment ? <>
@@ -307,6 +600,7 @@ function DiscussionComment({commentData, setStatusMessage, setStatusMessageColou
 				</> :
 					<span dangerouslySetInnerHTML={{__html: commentBodyRendered}} />
 				}
+				<CommentReactions commentData={commentData} setStatusMessage={setStatusMessage} setStatusMessageColour={setStatusMessageColour} />
 			</div>
 		</div>
 	);
@@ -353,6 +647,15 @@ export default function DiscussionComments() {
 				return Promise.reject(response);
 			}
 
+			// Comments flagged as spam are held for moderation, so there's nothing new to display yet
+			if (response.status === 202) {
+				response.text().then(text => {
+					setStatusMessageColour("green");
+					setStatusMessage(text);
+				});
+				return;
+			}
+
 			// Adding the comment succeeded, so display it in the list (we cheat for now by just reloading the page)
 			window.location = "/" + (mrData === null ? "discuss" : "merge") + "/" + meta.owner + "/" + meta.database + "?id=" + discussionData.disc_id;
 		})
@@ -409,6 +712,13 @@ export default function DiscussionComments() {
 				</div>
 			</div>
 		) : null}
+		{mrData !== null && mrData.licenceWarnings !== null ? mrData.licenceWarnings.map(w => (
+			<div className="row" key={w}>
+				<div className="col-md-12 text-center mb-2">
+					<h6 className="text-warning">{w}</h6>
+				</div>
+			</div>
+		)) : null}
 		<DiscussionTopComment setStatusMessage={setStatusMessage} setStatusMessageColour={setStatusMessageColour} />
 		{comments}
 		{authInfo.loggedInUser ? (
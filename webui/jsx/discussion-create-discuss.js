@@ -39,6 +39,15 @@ export default function DiscussionCreateDiscuss() {
 				return Promise.reject(response);
 			}
 
+			// Discussions flagged as spam are held for moderation, so there's no discussion to bounce to yet
+			if (response.status === 202) {
+				response.text().then(text => {
+					setStatusMessageColour("green");
+					setStatusMessage(text);
+				});
+				return;
+			}
+
 			response.json().then(data => {
 				// Discussion creation succeeded.  The response should include the discussion # we'll bounce to
 				window.location = "/discuss/" + meta.owner + "/" + meta.database + "?id=" + data.discuss_id;
@@ -0,0 +1,129 @@
+const React = require("react");
+const ReactDOM = require("react-dom");
+
+// Returns the details of a label available for the database, by name
+function findLabel(labels, name) {
+	return labels.find(l => l.name.toLowerCase() === name.toLowerCase());
+}
+
+// Picks black or white text, whichever is easier to read on the given background colour
+function textColour(colour) {
+	const r = parseInt(colour.substr(1, 2), 16);
+	const g = parseInt(colour.substr(3, 2), 16);
+	const b = parseInt(colour.substr(5, 2), 16);
+	return (r * 299 + g * 587 + b * 114) / 1000 > 150 ? "#000000" : "#ffffff";
+}
+
+export function LabelBadge({name, labels}) {
+	const label = findLabel(labels === null ? [] : labels, name);
+	const colour = label === undefined ? "#6c757d" : label.colour;
+	return (
+		<span className="badge me-1" style={{backgroundColor: colour, color: textColour(colour)}} title={label === undefined ? "" : label.description} data-cy={"label-" + name}>{name}</span>
+	);
+}
+
+// Sends a change to the labels or milestones of the database to the server.  The server returns the updated list
+function sendChange(url, params, onSuccess, setStatusMessage) {
+	fetch(url, {
+		method: "post",
+		headers: {
+			"Content-Type": "application/x-www-form-urlencoded"
+		},
+		body: new URLSearchParams({
+			...params,
+			"dbname": meta.database,
+			"username": meta.owner,
+		}),
+	}).then(response => {
+		if (!response.ok) {
+			return Promise.reject(response);
+		}
+		return response.json();
+	})
+	.then(data => {
+		onSuccess(data === null ? [] : data);
+		setStatusMessage("");
+	})
+	.catch(error => {
+		error.text().then(text => setStatusMessage("Saving failed: " + text));
+	});
+}
+
+export function LabelManager({labels, setLabels, milestones, setMilestones}) {
+	const [labelName, setLabelName] = React.useState("");
+	const [labelColour, setLabelColour] = React.useState("#0075ca");
+	const [labelDescription, setLabelDescription] = React.useState("");
+	const [milestoneTitle, setMilestoneTitle] = React.useState("");
+	const [milestoneDescription, setMilestoneDescription] = React.useState("");
+	const [milestoneDue, setMilestoneDue] = React.useState("");
+	const [statusMessage, setStatusMessage] = React.useState("");
+
+	function saveLabel() {
+		sendChange("/x/labelsave/", {"name": labelName, "colour": labelColour, "description": labelDescription}, data => {
+			setLabels(data);
+			setLabelName("");
+			setLabelDescription("");
+		}, setStatusMessage);
+	}
+
+	function deleteLabel(name) {
+		sendChange("/x/labeldel/", {"name": name}, setLabels, setStatusMessage);
+	}
+
+	function saveMilestone(title, description, due, open) {
+		sendChange("/x/milestonesave/", {"title": title, "description": description, "due": due, "open": open}, data => {
+			setMilestones(data);
+			setMilestoneTitle("");
+			setMilestoneDescription("");
+			setMilestoneDue("");
+		}, setStatusMessage);
+	}
+
+	function deleteMilestone(title) {
+		sendChange("/x/milestonedel/", {"title": title}, setMilestones, setStatusMessage);
+	}
+
+	return (
+		<div className="card mt-2" data-cy="labelmanager">
+			<div className="card-body">
+				{statusMessage !== "" ? <div className="text-center text-danger mb-2" data-cy="labelstatus">{statusMessage}</div> : null}
+				<h5>Labels</h5>
+				<ul className="list-group mb-2">
+					{labels.map(l => (
+						<li key={l.name} className="list-group-item d-flex justify-content-between align-items-center">
+							<span><LabelBadge name={l.name} labels={labels} /> <small className="text-muted">{l.description}</small></span>
+							{l.default ? <small className="text-muted">Default</small> : <a href="#/" onClick={() => deleteLabel(l.name)} title="Delete label" data-cy={"labeldel-" + l.name}><i className="fa fa-trash fa-fw"></i></a>}
+						</li>
+					))}
+				</ul>
+				<div className="d-flex mb-3">
+					<input className="form-control form-control-sm me-1" placeholder="Label name" value={labelName} onChange={e => setLabelName(e.target.value)} data-cy="labelname" />
+					<input className="form-control form-control-sm form-control-color me-1" type="color" value={labelColour} onChange={e => setLabelColour(e.target.value)} data-cy="labelcolour" />
+					<input className="form-control form-control-sm me-1" placeholder="Description" value={labelDescription} onChange={e => setLabelDescription(e.target.value)} />
+					<button className="btn btn-sm btn-success" onClick={() => saveLabel()} disabled={labelName === ""} data-cy="labelsave">Save</button>
+				</div>
+				<h5>Milestones</h5>
+				<ul className="list-group mb-2">
+					{milestones.map(m => (
+						<li key={m.title} className="list-group-item d-flex justify-content-between align-items-center">
+							<span>
+								<i className="fa fa-flag-o"></i> {m.title} {m.open ? null : <span className="badge bg-secondary">Closed</span>}
+								<small className="text-muted ms-2">{m.due_date !== null ? "Due " + new Date(m.due_date).toLocaleDateString() + ", " : null}{m.open_count} open, {m.closed_count} closed</small>
+							</span>
+							<span>
+								<a href="#/" onClick={() => saveMilestone(m.title, m.description, m.due_date !== null ? m.due_date.substr(0, 10) : "", !m.open)} title={m.open ? "Close milestone" : "Reopen milestone"}><i className={"fa fa-fw " + (m.open ? "fa-check" : "fa-undo")}></i></a>
+								<a href="#/" onClick={() => deleteMilestone(m.title)} title="Delete milestone" data-cy={"milestonedel-" + m.title}><i className="fa fa-trash fa-fw"></i></a>
+							</span>
+						</li>
+					))}
+				</ul>
+				<div className="d-flex">
+					<input className="form-control form-control-sm me-1" placeholder="Milestone title" value={milestoneTitle} onChange={e => setMilestoneTitle(e.target.value)} data-cy="milestonetitle" />
+					<input className="form-control form-control-sm me-1 w-auto" type="date" value={milestoneDue} onChange={e => setMilestoneDue(e.target.value)} data-cy="milestonedue" />
+					<input className="form-control form-control-sm me-1" placeholder="Description" value={milestoneDescription} onChange={e => setMilestoneDescription(e.target.value)} />
+					<button className="btn btn-sm btn-success" onClick={() => saveMilestone(milestoneTitle, milestoneDescription, milestoneDue, true)} disabled={milestoneTitle === ""} data-cy="milestonesave">Save</button>
+				</div>
+			</div>
+		</div>
+	);
+}
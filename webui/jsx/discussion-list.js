@@ -2,13 +2,16 @@ const React = require("react");
 const ReactDOM = require("react-dom");
 
 import { getTimePeriod } from "./format";
+import { LabelBadge, LabelManager } from "./discussion-labels";
 
-function DiscussionListRow({data, mergeRequests}) {
+function DiscussionListRow({data, mergeRequests, labels}) {
 	return (
 		<div className="card mt-1">
 			<div className="card-body">
-				<h5 className="card-title"># {data.disc_id} {data.open === true ? <i className="fa fa-minus-square-o fa-lg text-success fs-4" /> : <i className="fa fa fa-check-square-o fa-lg text-danger fs-4" />} <a href={"/" + (mergeRequests ? "merge" : "discuss") + "/" + meta.owner + "/" + meta.database + "?id=" + data.disc_id}>{data.title}</a></h5>
+				<h5 className="card-title"># {data.disc_id} {data.open === true ? <i className="fa fa-minus-square-o fa-lg text-success fs-4" /> : <i className="fa fa fa-check-square-o fa-lg text-danger fs-4" />} <a href={"/" + (mergeRequests ? "merge" : "discuss") + "/" + meta.owner + "/" + meta.database + "?id=" + data.disc_id}>{data.title}</a> {data.labels.map(l => <LabelBadge key={l} name={l} labels={labels} />)}</h5>
 				<h6 className="card-subtitle">Created <span className="text-info" title={new Date(data.creation_date).toLocaleString()}>{getTimePeriod(data.creation_date, true)}</span> by <a href={"/" + data.creator}>{data.avatar_url !== "" ? <img src={data.avatar_url} height="18" width="18" className="border border-secondary" /> : null} {data.creator}</a>. Last modified <span className="text-info" title={new Date(data.last_modified).toLocaleString()}>{getTimePeriod(data.last_modified, true)}</span></h6>
+				{data.milestone !== "" ? <p className="card-text mb-0"><i className="fa fa-flag-o"></i> {data.milestone}</p> : null}
+				{data.assignee !== "" ? <p className="card-text mb-0"><i className="fa fa-user-o"></i> Assigned to <a href={"/" + data.assignee}>{data.assignee}</a></p> : null}
 				{data.comment_count > 0 ? <p className="card-text"> <i className="fa fa-comment-o"></i> <a href={"/" + (mergeRequests ? "merge" : "discuss") + "/" + meta.owner + "/" + meta.database + "?id=" + data.disc_id}>{data.comment_count} comment{data.comment_count > 1 ? "s" : ""}</a></p> : null}
 			</div>
 		</div>
@@ -17,6 +20,12 @@ function DiscussionListRow({data, mergeRequests}) {
 
 export default function DiscussionList({mergeRequests}) {
 	const [showOpen, setShowOpen] = React.useState(true);
+	const [assignedToMe, setAssignedToMe] = React.useState(new URLSearchParams(window.location.search).get("assigned") === "me");
+	const [labelFilter, setLabelFilter] = React.useState(new URLSearchParams(window.location.search).get("label") || "");
+	const [milestoneFilter, setMilestoneFilter] = React.useState(new URLSearchParams(window.location.search).get("milestone") || "");
+	const [labels, setLabels] = React.useState(labelData === null ? [] : labelData);
+	const [milestones, setMilestones] = React.useState(milestoneData === null ? [] : milestoneData);
+	const [manageLabels, setManageLabels] = React.useState(false);
 
 	// Switch to the create discussion page
 	function createDiscussion() {
@@ -39,7 +48,26 @@ export default function DiscussionList({mergeRequests}) {
 						<label className={"btn btn-light " + (showOpen ? "active" : null)} onClick={() => setShowOpen(true)}>Open</label>
 						<label className={"btn btn-light " + (showOpen ? null : "active")} onClick={() => setShowOpen(false)}>Closed</label>
 					</div>
+					{authInfo.loggedInUser ? <>
+						&nbsp;
+						<label className={"btn btn-light " + (assignedToMe ? "active" : null)} onClick={() => setAssignedToMe(!assignedToMe)} data-cy="assignedtome">Assigned to me</label>
+					</> : null}
+					&nbsp;
+					<select className="form-select form-select-sm d-inline w-auto" value={labelFilter} onChange={e => setLabelFilter(e.target.value)} data-cy="labelfilter">
+						<option value="">All labels</option>
+						{labels.map(l => <option key={l.name} value={l.name}>{l.name}</option>)}
+					</select>
+					&nbsp;
+					<select className="form-select form-select-sm d-inline w-auto" value={milestoneFilter} onChange={e => setMilestoneFilter(e.target.value)} data-cy="milestonefilter">
+						<option value="">All milestones</option>
+						{milestones.map(m => <option key={m.title} value={m.title}>{m.title}</option>)}
+					</select>
+					{authInfo.loggedInUser && meta.owner === authInfo.loggedInUser ? <>
+						&nbsp;
+						<button className="btn btn-sm btn-outline-secondary" onClick={() => setManageLabels(!manageLabels)} data-cy="managelabels">Manage labels</button>
+					</> : null}
 				</div>
+				{manageLabels ? <LabelManager labels={labels} setLabels={setLabels} milestones={milestones} setMilestones={setMilestones} /> : null}
 			</div>
 		</div>
 	);
@@ -52,10 +80,19 @@ export default function DiscussionList({mergeRequests}) {
 	// Render discussion items
 	const rows = discussionData
 		.filter(item => item.open === showOpen)
-		.map(item => DiscussionListRow({mergeRequests: mergeRequests, data: item}));
+		.filter(item => !assignedToMe || item.assignee === authInfo.loggedInUser)
+		.filter(item => labelFilter === "" || item.labels.some(l => l.toLowerCase() === labelFilter.toLowerCase()))
+		.filter(item => milestoneFilter === "" || item.milestone.toLowerCase() === milestoneFilter.toLowerCase())
+		.map(item => DiscussionListRow({mergeRequests: mergeRequests, data: item, labels: labels}));
 
 	// If no discussions are visible in the current selection print a message
 	if (rows.length === 0) {
+		if (labelFilter !== "" || milestoneFilter !== "") {
+			return <>{buttonRow}<h5 data-cy="nodisc" className="text-center mt-2">There are no {showOpen ? "open" : "closed"} {mergeRequests ? "merge requests" : "discussions"} matching the selected filters</h5></>;
+		}
+		if (assignedToMe) {
+			return <>{buttonRow}<h5 data-cy="nodisc" className="text-center mt-2">There are no {showOpen ? "open" : "closed"} {mergeRequests ? "merge requests" : "discussions"} assigned to you</h5></>;
+		}
 		return <>{buttonRow}<h5 data-cy="nodisc" className="text-center mt-2">This database does not have any {showOpen ? "open" : "closed"} {mergeRequests ? "merge requests" : "discussions"} yet</h5></>;
 	}
 
@@ -21,12 +21,16 @@ export default function PreferencesPage() {
 	const [createApiKeyDialogExpiryEnabled, setCreateApiKeyDialogExpiryEnabled] = React.useState(true);
 	const [createApiKeyDialogExpiryDate, setCreateApiKeyDialogExpiryDate] = React.useState((new Date((new Date()).valueOf() + 1000*3600*24*365)).toISOString().split("T")[0]); // 365 days
 	const [createApiKeyDialogComment, setCreateApiKeyDialogComment] = React.useState("");
+	const [createApiKeyDialogOrigins, setCreateApiKeyDialogOrigins] = React.useState("");
 
 	const [fullName, setFullName] = React.useState(preferences.fullName);
 	const [email, setEmail] = React.useState(preferences.email);
 	const [maxRows, setMaxRows] = React.useState(preferences.maxRows);
 	const [colourTheme, setColourTheme] = React.useState(userPrefTheme());
 	const [apiKeys, setApiKeys] = React.useState(preferences.apiKeys || []);
+	const [notifications, setNotifications] = React.useState(preferences.notifications);
+	const [customDomains, setCustomDomains] = React.useState(preferences.customDomains || []);
+	const [newDomain, setNewDomain] = React.useState("");
 
 	// Handler for the cancel button.  Just bounces back to the profile page
 	function cancel() {
@@ -66,6 +70,175 @@ export default function PreferencesPage() {
 		});
 	}
 
+	// Send changed notification settings to the server for saving
+	function saveNotifications() {
+		fetch("/x/notificationprefs", {
+			method: "post",
+			headers: {
+				"Content-Type": "application/json"
+			},
+			body: JSON.stringify(notifications),
+		}).then(response => {
+			if (!response.ok) {
+				return Promise.reject(response);
+			}
+
+			setStatusMessageColour("green");
+			setStatusMessage("Notification settings saved");
+		})
+		.catch(error => {
+			// Saving failed, display the error message
+			error.text().then(text => {
+				setStatusMessageColour("red");
+				setStatusMessage("Saving notification settings failed: " + text);
+			});
+		});
+	}
+
+	// Change the email setting for one of the watched databases
+	function setDatabaseNotification(db, enabled) {
+		let dbs = Object.assign({}, notifications.databases);
+		dbs[db] = enabled;
+		setNotifications({...notifications, databases: dbs});
+	}
+
+	// Upload a new avatar image
+	function uploadAvatar(file) {
+		let data = new FormData();
+		data.append("avatar", file);
+		fetch("/x/avatarupload", {
+			method: "post",
+			body: data,
+		}).then(response => {
+			if (!response.ok) {
+				return Promise.reject(response);
+			}
+
+			// Reload the page, to show the new avatar
+			window.location.reload();
+		})
+		.catch(error => {
+			// Uploading failed, display the error message
+			error.text().then(text => {
+				setStatusMessageColour("red");
+				setStatusMessage("Uploading the avatar failed: " + text);
+			});
+		});
+	}
+
+	// Remove the uploaded avatar, going back to the default one
+	function removeAvatar() {
+		fetch("/x/avatardelete", {
+			method: "post",
+		}).then(response => {
+			if (!response.ok) {
+				return Promise.reject(response);
+			}
+
+			window.location.reload();
+		})
+		.catch(error => {
+			error.text().then(text => {
+				setStatusMessageColour("red");
+				setStatusMessage("Removing the avatar failed: " + text);
+			});
+		});
+	}
+
+	// Add a custom domain, which then needs verifying
+	function addCustomDomain() {
+		fetch("/x/customdomainadd", {
+			method: "post",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded"
+			},
+			body: new URLSearchParams({
+				"domain": newDomain,
+			}),
+		}).then(response => {
+			if (!response.ok) {
+				return Promise.reject(response);
+			}
+
+			response.json().then(data => {
+				setCustomDomains([...customDomains, data]);
+				setNewDomain("");
+			});
+		})
+		.catch(error => {
+			error.text().then(text => {
+				setStatusMessageColour("red");
+				setStatusMessage("Adding the custom domain failed: " + text);
+			});
+		});
+	}
+
+	// Check the DNS verification record of a custom domain
+	function verifyCustomDomain(domain) {
+		fetch("/x/customdomainverify", {
+			method: "post",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded"
+			},
+			body: new URLSearchParams({
+				"domain": domain,
+			}),
+		}).then(response => {
+			if (!response.ok) {
+				return Promise.reject(response);
+			}
+
+			setCustomDomains(customDomains.map(d => d.domain === domain ? {...d, date_verified: new Date().toISOString()} : d));
+			setStatusMessageColour("green");
+			setStatusMessage("The custom domain \"" + domain + "\" has been verified");
+		})
+		.catch(error => {
+			error.text().then(text => {
+				setStatusMessageColour("red");
+				setStatusMessage("Verifying the custom domain failed: " + text);
+			});
+		});
+	}
+
+	// Remove a custom domain
+	function deleteCustomDomain(domain) {
+		confirmAlert({
+			title: "Confirm removal",
+			message: "Are you sure you want to remove the custom domain \"" + domain + "\"?",
+			buttons: [
+				{
+					label: 'Yes',
+					onClick: () => {
+						fetch("/x/customdomaindel", {
+							method: "post",
+							headers: {
+								"Content-Type": "application/x-www-form-urlencoded"
+							},
+							body: new URLSearchParams({
+								"domain": domain,
+							}),
+						}).then(response => {
+							if (!response.ok) {
+								return Promise.reject(response);
+							}
+
+							setCustomDomains(customDomains.filter(d => d.domain !== domain));
+						})
+						.catch(error => {
+							error.text().then(text => {
+								setStatusMessageColour("red");
+								setStatusMessage("Removing the custom domain failed: " + text);
+							});
+						});
+					},
+				},
+				{
+					label: 'No'
+				}
+			]
+		});
+	}
+
 	// Generate a new client certificate
 	function genCert() {
 		window.location = "/x/gencert";
@@ -83,6 +256,7 @@ export default function PreferencesPage() {
 				"permissions": createApiKeyDialogPermissions,
 				"expiry": createApiKeyDialogExpiryEnabled ? encodeURIComponent(createApiKeyDialogExpiryDate) : "",
 				"comment": createApiKeyDialogComment,
+				"origins": createApiKeyDialogOrigins,
 			}),
 		}).then(response => {
 			if (!response.ok) {
@@ -172,7 +346,7 @@ export default function PreferencesPage() {
 		apiKeysTable = (
 			<table className="table table-sm table-hover table-responsive" data-cy="apikeystbl">
 				<thead>
-					<tr><th>ID</th><th>Permissions</th><th>Generation date</th><th>Expiry date</th><th>Description</th><th></th></tr>
+					<tr><th>ID</th><th>Permissions</th><th>Generation date</th><th>Expiry date</th><th>Allowed origins</th><th>Description</th><th></th></tr>
 				</thead>
 				<tbody>
 					{apiKeys.map(row => (
@@ -181,6 +355,7 @@ export default function PreferencesPage() {
 							<td>{row.permissions === "rw" ? "Read and write" : row.permissions === "r" ? "Read only" : row.permissions}</td>
 							<td>{new Date(row.date_created).toLocaleString()}</td>
 							<td className={row.expiry_date && (new Date() >= new Date(row.expiry_date)) ? "table-warning" : ""}>{row.expiry_date ? Intl.DateTimeFormat().format(new Date(row.expiry_date)) : <i>never</i>}</td>
+							<td>{row.allowed_origins && row.allowed_origins.length > 0 ? row.allowed_origins.join(", ") : <i>any</i>}</td>
 							<td>{row.comment}</td>
 							<td><button type="button" className="btn btn-outline-danger" title="Delete this API key" onClick={() => deleteApiKey(row.uuid)}><span className="fa fa-trash"></span></button></td>
 						</tr>
@@ -230,6 +405,85 @@ export default function PreferencesPage() {
 
 		<hr />
 
+		<h5>Notifications</h5>
+		<form>
+			<div className="form-check mb-2">
+				<input className="form-check-input" type="checkbox" id="notifyemail" checked={notifications.email} onChange={e => setNotifications({...notifications, email: e.target.checked})} />
+				<label className="form-check-label" htmlFor="notifyemail">Send me emails about activity on databases I'm watching</label>
+			</div>
+			<div className="mb-2 ms-4">
+				{[["discussions", "New discussions"], ["merge_requests", "New merge requests"], ["comments", "New comments"], ["releases", "New releases"]].map(([field, label]) => (
+					<div className="form-check" key={field}>
+						<input className="form-check-input" type="checkbox" id={"notify" + field} disabled={!notifications.email} checked={notifications[field]} onChange={e => setNotifications({...notifications, [field]: e.target.checked})} />
+						<label className="form-check-label" htmlFor={"notify" + field}>{label}</label>
+					</div>
+				))}
+			</div>
+			<div className="mb-2">
+				<label className="form-label" htmlFor="notifydigest">Email frequency</label>
+				<select className="form-select" id="notifydigest" disabled={!notifications.email} value={notifications.digest} onChange={e => setNotifications({...notifications, digest: e.target.value})}>
+					<option value="">An email for each update</option>
+					<option value="daily">Daily digest</option>
+					<option value="weekly">Weekly digest</option>
+				</select>
+			</div>
+			{preferences.watching !== null && preferences.watching.length > 0 ? (
+				<div className="mb-2">
+					<label className="form-label">Emails per watched database</label>
+					{preferences.watching.map(db => (
+						<div className="form-check" key={db}>
+							<input className="form-check-input" type="checkbox" id={"notifydb-" + db} disabled={!notifications.email} checked={notifications.databases[db] !== false} onChange={e => setDatabaseNotification(db, e.target.checked)} />
+							<label className="form-check-label" htmlFor={"notifydb-" + db}>{db}</label>
+						</div>
+					))}
+				</div>
+			) : null}
+			<button type="button" className="btn btn-success" onClick={() => saveNotifications()}>Save notification settings</button>
+		</form>
+
+		<hr />
+
+		<h5>Avatar</h5>
+		<div className="d-flex align-items-center mb-2">
+			{preferences.avatarUrl !== "" ? <img src={preferences.avatarUrl} height="96" width="96" className="me-3" data-cy="avatarimg" /> : null}
+			<div>
+				<input type="file" className="form-control mb-2" id="avatarfile" accept="image/gif,image/jpeg,image/png" data-cy="avatarfile" onChange={e => e.target.files.length > 0 && uploadAvatar(e.target.files[0])} />
+				{preferences.avatarUploaded ? <button type="button" className="btn btn-outline-danger" data-cy="avatarremovebtn" onClick={() => removeAvatar()}>Remove avatar</button> : null}
+			</div>
+		</div>
+		<div className="form-text">Upload a GIF, JPEG, or PNG image to use as your avatar. It's cropped to a square.</div>
+
+		<hr />
+
+		{preferences.domainsEnabled ? (<>
+			<h5>Custom domains</h5>
+			<div className="form-text mb-2">Serve your profile and databases from a domain of your own. Point the domain at this server, then verify it by adding a TXT record holding the verification token under "{preferences.domainTxt}.&lt;your domain&gt;". Domains not verified within {preferences.domainExpiry} days are removed.</div>
+			{customDomains.length > 0 ? (
+				<table className="table table-sm table-hover table-responsive" data-cy="customdomainstbl">
+					<thead>
+						<tr><th>Domain</th><th>TXT record</th><th>Verification token</th><th>Status</th><th></th></tr>
+					</thead>
+					<tbody>
+						{customDomains.map(d => (
+							<tr key={d.domain}>
+								<td>{d.domain}</td>
+								<td><code>{preferences.domainTxt + "." + d.domain}</code></td>
+								<td><code>{d.verification_token}</code></td>
+								<td>{d.date_verified ? "Verified" : <button type="button" className="btn btn-sm btn-outline-primary" onClick={() => verifyCustomDomain(d.domain)}>Verify</button>}</td>
+								<td><button type="button" className="btn btn-outline-danger" title="Remove this custom domain" onClick={() => deleteCustomDomain(d.domain)}><span className="fa fa-trash"></span></button></td>
+							</tr>
+						))}
+					</tbody>
+				</table>
+			) : null}
+			<div className="input-group mb-2">
+				<input type="text" className="form-control" id="customdomain" data-cy="customdomain" placeholder="data.example.org" value={newDomain} onChange={e => setNewDomain(e.target.value)} />
+				<button type="button" className="btn btn-primary" data-cy="customdomainaddbtn" disabled={newDomain === ""} onClick={() => addCustomDomain()}>Add domain</button>
+			</div>
+
+			<hr />
+		</>) : null}
+
 		<h5><a href="https://sqlitebrowser.org/" target="_blank" rel="noopener noreferrer external">DB4S</a> Integration</h5>
 		<div className="form-text">This is needed for easily making changes to your uploaded databases.</div>
 		<button type="button" className="btn btn-primary" data-cy="gencertbtn" onClick={() => genCert()}>Generate new client certificate</button>
@@ -271,6 +525,11 @@ export default function PreferencesPage() {
 						<input type="text" className="form-control" id="createapikeydescr" value={createApiKeyDialogComment} onChange={e => setCreateApiKeyDialogComment(e.target.value)} />
 						<div className="form-text">Optionally you can provide a description of this API key. This can help identifying keys if you have multiple.</div>
 					</div>
+					<div className="mb-3">
+						<label htmlFor="createapikeyorigins" className="form-label">Allowed origins</label>
+						<textarea className="form-control" id="createapikeyorigins" rows={2} placeholder="https://example.org" value={createApiKeyDialogOrigins} onChange={e => setCreateApiKeyDialogOrigins(e.target.value)} />
+						<div className="form-text">If this key is used by a web application, you can restrict the websites it can be used from, one per line. Use "https://*.example.org" to allow all subdomains. Leave this empty to allow all websites.</div>
+					</div>
 				</form>
 			</Modal.Body>
 			<Modal.Footer>
@@ -1,7 +1,7 @@
 const React = require("react");
 const ReactDOM = require("react-dom");
 
-export default function RegisterUserPage({username}) {
+export default function RegisterUserPage({username, inviteRequired}) {
 	const [statusMessage, setStatusMessage] = React.useState("");
 	const [statusMessageColour, setStatusMessageColour] = React.useState("");
 
@@ -49,6 +49,13 @@ export default function RegisterUserPage({username}) {
 				<label className="form-label" htmlFor="username">Username</label>
 				<input type="text" className="form-control" id="username" name="username" maxlength={80} value={name} onChange={e => setName(e.target.value)} required />
 			</div>
+			{inviteRequired ? (
+				<div className="mb-2">
+					<label className="form-label" htmlFor="invite">Invitation code</label>
+					<input type="text" className="form-control" id="invite" name="invite" required />
+					<div className="form-text">Signups are by invitation only.  Enter the invitation code you were sent.</div>
+				</div>
+			) : null}
 
 			<button type="button" className="btn btn-primary" onClick={() => checkName()}>Check</button>&nbsp;
 			<input type="submit" className="btn btn-success" value="Continue" />
@@ -0,0 +1,89 @@
+const React = require("react");
+const ReactDOM = require("react-dom");
+
+function StoryEditor({onStatus}) {
+	const [name, setName] = React.useState(storyData.story.name);
+	const [body, setBody] = React.useState(storyData.story.body);
+
+	const storyUrl = "/" + encodeURIComponent(storyData.dbOwner) + "/" + encodeURIComponent(storyData.dbName);
+
+	function saveStory() {
+		fetch("/x/storysave" + storyUrl, {
+			method: "post",
+			headers: {"Content-Type": "application/json"},
+			body: JSON.stringify({name: name, body: body}),
+		}).then(response => {
+			if (!response.ok) {
+				return Promise.reject(response);
+			}
+			window.location = "/story" + storyUrl + "?name=" + encodeURIComponent(name);
+		}).catch(error => {
+			error.text().then(text => onStatus("Saving the data story failed: " + text));
+		});
+	}
+
+	function deleteStory() {
+		fetch("/x/storydel" + storyUrl + "?name=" + encodeURIComponent(storyData.story.name), {
+			method: "post",
+		}).then(response => {
+			if (!response.ok) {
+				return Promise.reject(response);
+			}
+			window.location = "/story" + storyUrl;
+		}).catch(error => {
+			error.text().then(text => onStatus("Deleting the data story failed: " + text));
+		});
+	}
+
+	return (
+		<div className="card mt-3">
+			<div className="card-header fw-bold">Edit data story</div>
+			<div className="card-body">
+				<div className="mb-2">
+					<label className="form-label">Name</label>
+					<input type="text" className="form-control" value={name} onChange={e => setName(e.target.value)} />
+				</div>
+				<div className="mb-2">
+					<label className="form-label">Story</label>
+					<textarea className="form-control font-monospace" rows="16" value={body} onChange={e => setBody(e.target.value)} />
+					<div className="form-text">Markdown.  Fenced <code>```sql</code> code blocks are run against the database when the story is viewed, with their results shown in place.</div>
+				</div>
+				<button className="btn btn-primary" onClick={() => saveStory()}>Save</button>&nbsp;
+				{storyData.story.body !== "" ? <button className="btn btn-danger" onClick={() => deleteStory()}>Delete story</button> : null}
+			</div>
+		</div>
+	);
+}
+
+export default function StoryPage() {
+	const [status, setStatus] = React.useState("");
+	const [editing, setEditing] = React.useState(storyData.canEdit && storyData.story.name !== "" && storyData.story.body === "");
+
+	const storyUrl = "/" + encodeURIComponent(storyData.dbOwner) + "/" + encodeURIComponent(storyData.dbName);
+
+	const storyList = (storyData.stories !== null ? storyData.stories : []).map(s => (
+		<li key={s.name}>
+			<a href={"/story" + storyUrl + "?name=" + encodeURIComponent(s.name)}>{s.name}</a> <small className="text-muted">by {s.author}</small>
+		</li>
+	));
+
+	return (<>
+		<h3 className="text-center"><a href={storyUrl}>{storyData.dbOwner} / {storyData.dbName}</a></h3>
+		{status !== "" ? <div className="alert alert-danger">{status}</div> : null}
+		{storyData.story.name !== "" ? (<>
+			<h4>
+				{storyData.story.name}
+				<span className="pull-right">
+					{storyData.story.body !== "" ? <a href={"/x/storyexport" + storyUrl + "?name=" + encodeURIComponent(storyData.story.name)} className="btn btn-sm btn-secondary">Export as HTML</a> : null}&nbsp;
+					{storyData.canEdit ? <button className="btn btn-sm btn-secondary" onClick={() => setEditing(!editing)}>Edit</button> : null}
+				</span>
+			</h4>
+			<div dangerouslySetInnerHTML={{__html: storyData.rendered}} />
+			{editing ? <StoryEditor onStatus={setStatus} /> : null}
+		</>) : (<>
+			<h4>Data stories</h4>
+			{storyList.length > 0 ? <ul>{storyList}</ul> : <p>This database doesn't have any data stories yet</p>}
+			{storyData.canEdit ? <StoryEditor onStatus={setStatus} /> : null}
+		</>)}
+	</>);
+}
@@ -1,30 +1,102 @@
 const React = require("react");
 const ReactDOM = require("react-dom");
 
+import {getTimePeriod} from "./format";
+
 export default function UpdatesPage() {
-	let rows = <h5 className="text-center">No new status updates</h5>;
-
-	if (updates !== null) {
-		rows = [];
-		for (const [dbname, entries] of Object.entries(updates)) {
-			let dbEntries = [];
-			entries.forEach(e => {
-				dbEntries.push(<li className="list-group-item"><a href={e.event_url}>{e.title}</a></li>);
-			});
-
-			rows.push(
-				<div className="card mb-2">
-					<div className="card-header fw-bold"><a href={"/" + dbname}>{dbname}</a></div>
-					<ul className="list-group list-group-flush">
-						{dbEntries}
-					</ul>
-				</div>
-			);
-		}
+	const [entries, setEntries] = React.useState(updates.updates);
+	const [total, setTotal] = React.useState(updates.total);
+	const [unread, setUnread] = React.useState(updates.unread);
+	const [offset, setOffset] = React.useState(0);
+	const [unreadOnly, setUnreadOnly] = React.useState(false);
+	const [statusMessage, setStatusMessage] = React.useState("");
+
+	// Retrieve a page of status updates
+	function loadPage(newOffset, newUnreadOnly) {
+		fetch("/x/statusupdates/?offset=" + newOffset + "&unread=" + newUnreadOnly)
+		.then(response => {
+			if (!response.ok) {
+				return Promise.reject(response);
+			}
+			return response.json();
+		})
+		.then(data => {
+			setEntries(data.updates);
+			setTotal(data.total);
+			setOffset(newOffset);
+			setUnreadOnly(newUnreadOnly);
+			setStatusMessage("");
+		})
+		.catch(error => {
+			error.text().then(text => setStatusMessage("Retrieving status updates failed: " + text));
+		});
+	}
+
+	// Send a change of read state to the server, then update the page to match
+	function sendChange(url, params, updateEntries) {
+		fetch(url, {
+			method: "post",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded"
+			},
+			body: new URLSearchParams(params),
+		}).then(response => {
+			if (!response.ok) {
+				return Promise.reject(response);
+			}
+			return response.json();
+		})
+		.then(data => {
+			setUnread(data.unread);
+			if (unreadOnly) {
+				loadPage(offset, unreadOnly);
+			} else {
+				setEntries(entries.map(updateEntries));
+			}
+		})
+		.catch(error => {
+			error.text().then(text => setStatusMessage("Updating status updates failed: " + text));
+		});
+	}
+
+	function markRead(entry, read) {
+		sendChange("/x/statusupdatesread/", {"ids": entry.id, "read": read}, e => e.id === entry.id ? {...e, read: read} : e);
+	}
+
+	function dismissAll() {
+		sendChange("/x/statusupdatesdismiss/", {}, e => ({...e, read: true}));
+	}
+
+	let rows = <h5 className="text-center">{unreadOnly ? "No unread status updates" : "No status updates"}</h5>;
+	if (entries !== null && entries.length > 0) {
+		rows = entries.map(e => (
+			<li key={e.id} className={"list-group-item d-flex justify-content-between align-items-center" + (e.read ? "" : " fw-bold")}>
+				<span>
+					<a href={"/" + e.database}>{e.database}</a>: <a href={e.event_url}>{e.title}</a>
+					<small className="text-muted ms-2" title={new Date(e.timestamp).toLocaleString()}>{getTimePeriod(e.timestamp, false)}</small>
+				</span>
+				<button className="btn btn-sm btn-outline-secondary" onClick={() => markRead(e, !e.read)} data-cy={"readbtn-" + e.id}>
+					{e.read ? "Mark unread" : "Mark read"}
+				</button>
+			</li>
+		));
+		rows = <ul className="list-group mb-2">{rows}</ul>;
 	}
 
 	return (<>
 		<h3 className="text-center" data-cy="updates">Status updates</h3>
+		{statusMessage !== "" ? <div className="text-center text-danger mb-2" data-cy="statusmsg">{statusMessage}</div> : null}
+		<div className="d-flex justify-content-between align-items-center mb-2">
+			<div className="form-check">
+				<input className="form-check-input" type="checkbox" id="unreadonly" checked={unreadOnly} onChange={() => loadPage(0, !unreadOnly)} data-cy="unreadonly" />
+				<label className="form-check-label" htmlFor="unreadonly">Only show unread ({unread})</label>
+			</div>
+			<button className="btn btn-sm btn-primary" onClick={() => dismissAll()} disabled={unread === 0} data-cy="dismissall">Mark all as read</button>
+		</div>
 		{rows}
+		<div className="d-flex justify-content-between">
+			<button className="btn btn-sm btn-outline-secondary" onClick={() => loadPage(Math.max(0, offset - updates.pageSize), unreadOnly)} disabled={offset === 0} data-cy="prevpage">Newer</button>
+			<button className="btn btn-sm btn-outline-secondary" onClick={() => loadPage(offset + updates.pageSize, unreadOnly)} disabled={offset + updates.pageSize >= total} data-cy="nextpage">Older</button>
+		</div>
 	</>);
 }
@@ -13,6 +13,7 @@ export default function UploadForm({branch}) {
 
 	const [live, setLive] = React.useState(false);
 	const [isPublic, setPublic] = React.useState(meta.publicDb);
+	const [encrypted, setEncrypted] = React.useState(meta.clientEncrypted);
 	const [licence, setLicence] = React.useState("Not specified");
 	const [branchName, setBranchName] = React.useState(branch);
 	const [sourceUrl, setSourceUrl] = React.useState("");
@@ -32,6 +33,7 @@ export default function UploadForm({branch}) {
 		formData.append("username", meta.owner);
 		formData.append("dbname", meta.database);
 		formData.append("live", live);
+		formData.append("encrypted", !live && encrypted);
 		formData.append("public", isPublic);
 		formData.append("licence", licence);
 		formData.append("commitmsg", commitMsg);
@@ -148,6 +150,13 @@ export default function UploadForm({branch}) {
 						/>
 					</div>
 				: null}
+				{live === false ?
+					<div className="mb-2 form-check">
+						<input type="checkbox" className="form-check-input" id="encrypted" checked={encrypted} onChange={e => setEncrypted(e.target.checked)} data-cy="encryptedchk" />
+						<label className="form-check-label" htmlFor="encrypted">Database is encrypted</label>&nbsp;
+						<span>Tick this if the database was encrypted before uploading (eg with SQLCipher).  It's stored and downloaded as is, but its data can't be viewed or queried here.</span>
+					</div>
+				: null}
 			</>}
 
 			{live === false ?
@@ -2,6 +2,8 @@ const React = require("react");
 const ReactDOM = require("react-dom");
 
 import { getTimePeriod } from "./format";
+import { confirmAlert } from "react-confirm-alert";
+import "react-confirm-alert/src/react-confirm-alert.css";
 
 function DatabasePanel({data, username}) {
 	const [isExpanded, setExpanded] = React.useState(false);
@@ -12,6 +14,9 @@ function DatabasePanel({data, username}) {
 				{username === authInfo.loggedInUser ? (<a href={"/settings/" + username + "/" + data.Database}><i className="fa fa-cog"></i></a>) : null}
 				&nbsp;
 				<a href={"/" + username + "/" + data.Database}>{data.Database}</a>
+				{data.Verified ? <span className="badge bg-success ms-2" title="This database has been verified by the administrators"><i className="fa fa-check-circle"></i> Verified</span> : null}
+				{data.Archived ? <span className="badge bg-secondary ms-2" title="This database has been archived by its owner, so it's read only"><i className="fa fa-archive"></i> Archived</span> : null}
+				{data.PinPosition > 0 ? <span className="badge bg-secondary ms-2" title="This database is pinned to the profile"><i className="fa fa-thumb-tack"></i> Pinned</span> : null}
 				<span className="pull-right">
 					<a href="#/" onClick={() => setExpanded(!isExpanded)}><i className={isExpanded ? "fa fa-minus" : "fa fa-plus"}></i></a>
 				</span>
@@ -55,11 +60,66 @@ export function DatabasePanelGroup({title, noDatabasesMessage, databases, userna
 }
 
 export default function UserPage() {
+	const [blocked, setBlocked] = React.useState(userData.blocked);
+	const [statusMessage, setStatusMessage] = React.useState("");
+
+	// Blocks or unblocks the user for the logged in user
+	function changeBlock(block, preventForks) {
+		fetch("/x/blockuser", {
+			method: "post",
+			headers: {
+				"Content-Type": "application/x-www-form-urlencoded"
+			},
+			body: new URLSearchParams({
+				"block": block,
+				"preventforks": preventForks,
+				"user": userData.name,
+			}),
+		}).then((response) => {
+			if (!response.ok) {
+				return Promise.reject(response);
+			}
+
+			setBlocked(block);
+			setStatusMessage("");
+		})
+		.catch((error) => {
+			setStatusMessage((block ? "Blocking" : "Unblocking") + " user failed");
+		});
+	}
+
+	// Asks whether the user should also be stopped from forking the databases of the logged in user
+	function blockUser() {
+		confirmAlert({
+			title: "Block " + userData.name,
+			message: "Their discussion comments will be hidden from you.  You can also stop them from forking your databases.",
+			buttons: [
+				{
+					label: "Block",
+					onClick: () => changeBlock(true, false)
+				},
+				{
+					label: "Block and prevent forks",
+					onClick: () => changeBlock(true, true)
+				},
+				{
+					label: "Cancel"
+				}
+			]
+		});
+	}
+
 	return (<>
 		<h3>
 			{userData.avatarUrl ? <img src={userData.avatarUrl} height="48" width="48" className="border border-secondary" /> : null}&nbsp;
 			{userData.name + (userData.fullName ? ": " + userData.fullName : "")}'s <span data-cy="userpg">public projects</span>
+			{authInfo.loggedInUser ? (
+				<button className="btn btn-sm btn-outline-secondary pull-right" onClick={() => blocked ? changeBlock(false, false) : blockUser()} data-cy="blockbtn">
+					<i className="fa fa-ban"></i> {blocked ? "Unblock" : "Block"}
+				</button>
+			) : null}
 		</h3>
+		{statusMessage !== "" ? <div className="text-danger mb-2">{statusMessage}</div> : null}
 		<div className="row">
 			<div className="col-md-6">
 				<DatabasePanelGroup title="Public standard databases" noDatabasesMessage="No public standard databases yet" databases={userData.databases} username={userData.name} />
@@ -1,8 +1,8 @@
 const React = require("react");
 const ReactDOM = require("react-dom");
 
-// Import the Plotly basic bundle for reduced size
-import Plotly from "plotly.js-basic-dist";
+// Import the full Plotly bundle, as the basic one doesn't include maps
+import Plotly from "plotly.js-dist";
 import createPlotlyComponent from "react-plotly.js/factory";
 const Plot = createPlotlyComponent(Plotly);
 
@@ -104,9 +104,148 @@ function SavedVisualisations({visualisations, visualisationsStatus, preselectedV
 	);
 }
 
+// Calls a function for each position of a GeoJSON object, unwrapping features and collections
+function forEachGeoJSONPosition(g, fn) {
+	if (!g || typeof g !== "object") {
+		return;
+	}
+	if (g.type === "Feature") {
+		forEachGeoJSONPosition(g.geometry, fn);
+	} else if (g.type === "FeatureCollection") {
+		(g.features || []).forEach(f => forEachGeoJSONPosition(f, fn));
+	} else if (g.type === "GeometryCollection") {
+		(g.geometries || []).forEach(f => forEachGeoJSONPosition(f, fn));
+	} else {
+		const walk = c => {
+			if (Array.isArray(c) && typeof c[0] === "number") {
+				fn(c);
+			} else if (Array.isArray(c)) {
+				c.forEach(walk);
+			}
+		};
+		walk(g.coordinates);
+	}
+}
+
+// Converts query results into the data and layout of a Plotly map.  Rows are placed using either their latitude and
+// longitude columns, or a column holding GeoJSON.  Returns null if those columns aren't in the results
+function mapPlotData(plotConfig, newData) {
+	const labelColumnIndex = newData.ColNames.findIndex(e => e === plotConfig.label_column);
+	const label = r => labelColumnIndex === -1 || r[labelColumnIndex].Value === null ? "" : String(r[labelColumnIndex].Value);
+
+	// Each row gets a marker, which shows its label when hovered over.  Rows with GeoJSON have it at their first position
+	let marker = {lat: [], lon: [], text: []};
+	let features = [];
+	let bounds = {minLat: 90, maxLat: -90, minLon: 180, maxLon: -180};
+	const extendBounds = p => {
+		bounds.minLon = Math.min(bounds.minLon, p[0]);
+		bounds.maxLon = Math.max(bounds.maxLon, p[0]);
+		bounds.minLat = Math.min(bounds.minLat, p[1]);
+		bounds.maxLat = Math.max(bounds.maxLat, p[1]);
+	};
+	if (plotConfig.geojson_column) {
+		const geoColumnIndex = newData.ColNames.findIndex(e => e === plotConfig.geojson_column);
+		if (geoColumnIndex === -1) {
+			return null;
+		}
+		newData.Records.forEach(r => {
+			let g;
+			try {
+				g = JSON.parse(r[geoColumnIndex].Value);
+			} catch (e) {
+				return;
+			}
+			if (!g || typeof g !== "object") {
+				return;
+			}
+			if (g.type === "FeatureCollection") {
+				features.push(...(g.features || []));
+			} else if (g.type === "Feature") {
+				features.push(g);
+			} else {
+				features.push({type: "Feature", geometry: g, properties: {}});
+			}
+			let first = null;
+			forEachGeoJSONPosition(g, p => {
+				first = first || p;
+				extendBounds(p);
+			});
+			if (first !== null) {
+				marker.lon.push(first[0]);
+				marker.lat.push(first[1]);
+				marker.text.push(label(r));
+			}
+		});
+	} else {
+		const latColumnIndex = newData.ColNames.findIndex(e => e === plotConfig.lat_column);
+		const lonColumnIndex = newData.ColNames.findIndex(e => e === plotConfig.lon_column);
+		if (latColumnIndex === -1 || lonColumnIndex === -1) {
+			return null;
+		}
+		newData.Records.forEach(r => {
+			const lat = parseFloat(r[latColumnIndex].Value);
+			const lon = parseFloat(r[lonColumnIndex].Value);
+			if (isNaN(lat) || isNaN(lon) || Math.abs(lat) > 90 || Math.abs(lon) > 180) {
+				return;
+			}
+			marker.lat.push(lat);
+			marker.lon.push(lon);
+			marker.text.push(label(r));
+			extendBounds([lon, lat]);
+		});
+	}
+
+	// Use the chosen tile provider, or the default one
+	const providers = typeof mapTileProviders !== "undefined" && mapTileProviders !== null ? mapTileProviders : [];
+	const provider = providers.find(p => p.name === plotConfig.map_tiles) || providers[0];
+	let layers = [];
+	if (provider !== undefined) {
+		layers.push({sourcetype: "raster", source: [provider.url], sourceattribution: provider.attribution, below: "traces", maxzoom: provider.max_zoom});
+	}
+	if (features.length > 0) {
+		const source = {type: "FeatureCollection", features: features};
+		layers.push({sourcetype: "geojson", source: source, type: "fill", color: "#1f77b4", opacity: 0.3});
+		layers.push({sourcetype: "geojson", source: source, type: "line", color: "#1f77b4", line: {width: 2}});
+	}
+
+	// Centre the map on the data, zoomed in as far as possible while still showing all of it
+	let center = {lat: 0, lon: 0};
+	let zoom = 0;
+	if (marker.lat.length > 0) {
+		const mercator = lat => Math.log(Math.tan(Math.PI / 4 + Math.max(-85, Math.min(85, lat)) * Math.PI / 360));
+		center = {lat: (bounds.minLat + bounds.maxLat) / 2, lon: (bounds.minLon + bounds.maxLon) / 2};
+		const lonZoom = Math.log2(360 / Math.max(bounds.maxLon - bounds.minLon, 0.0001));
+		const latZoom = Math.log2(2 * Math.PI / Math.max(mercator(bounds.maxLat) - mercator(bounds.minLat), 0.0001));
+		zoom = Math.max(0, Math.min(lonZoom, latZoom, provider !== undefined ? provider.max_zoom : 18, 16) - 1);
+	}
+
+	return {
+		data: {type: "scattermapbox", lat: marker.lat, lon: marker.lon, text: marker.text, mode: "markers", hoverinfo: "text", marker: {size: 9}},
+		mapbox: {style: "white-bg", center: center, zoom: zoom, layers: layers},
+	};
+}
+
+// Shows the summarised results of a pivot table visualisation
+function PivotTable({name, data}) {
+	return (
+		<div className="table-responsive">
+			<h5 className="text-center">{name}</h5>
+			<table className="table table-striped table-sm table-bordered">
+				<thead>
+					<tr>{data.ColNames.map((n, i) => <th className={i > 0 ? "text-end" : null}>{n}</th>)}</tr>
+				</thead>
+				<tbody>
+					{data.Records.map(r => <tr>{r.map((c, i) => i === 0 ? <th>{c.Value}</th> : <td className="text-end">{c.Value}</td>)}</tr>)}
+				</tbody>
+			</table>
+		</div>
+	);
+}
+
 export function Visualisation({name, plotConfig, branch, setRawData, setLastRunResultMessage}) {
 	const [state, setState] = React.useState("new");
 	const [data, setData] = React.useState(null);
+	const [mapbox, setMapbox] = React.useState(null);
 
 	// Retrieve data from the server whenever the plot config changes
 	React.useEffect(() => {
@@ -125,11 +264,15 @@ export function Visualisation({name, plotConfig, branch, setRawData, setLastRunR
 			setLastRunResultMessage("loading...");
 		}
 
+		// Pivot tables are summarised by the server once their fields have been chosen.  Until then the query results are
+		// returned as is, so the fields can be picked from them
+		const pivotReady = plotConfig.chart_type === "pivot" && plotConfig.pivot && plotConfig.pivot.row;
+
 		// Send the SQL string to the backend
 		fetch("/x/execsql/" + meta.owner + "/" + meta.database + (branchData && branch in branchData ? ("?commit=" + branchData[branch].commit) : ""), {
 			method: "post",
 			headers: {"Content-Type": "application/json"},
-			body: JSON.stringify({sql: plotConfig.sql}),
+			body: JSON.stringify({sql: plotConfig.sql, pivot: pivotReady ? plotConfig.pivot : undefined}),
 		}).then(response => {
 			if (!response.ok) {
 				return Promise.reject(response);
@@ -149,7 +292,26 @@ export function Visualisation({name, plotConfig, branch, setRawData, setLastRunR
 
 				// Convert data returned by server to the format expected by Plotly
 				let plotData = {};
-				if (newData.Records !== null) {
+				if (plotConfig.chart_type === "pivot") {
+					// Pivot tables are shown as they were returned
+					if (!pivotReady) {
+						setState("nopivot");
+					} else if (newData.Records === null || newData.Records.length === 0) {
+						setState("nodata");
+					}
+					setData(newData);
+					return;
+				} else if (newData.Records !== null && plotConfig.chart_type === "map") {
+					// Maps don't have axes, so are converted separately
+					const map = mapPlotData(plotConfig, newData);
+					if (map === null) {
+						setState("error");
+						setData("unknown column selected for map");
+						return;
+					}
+					plotData = map.data;
+					setMapbox(map.mapbox);
+				} else if (newData.Records !== null) {
 					// Figure out the column indexes in newData.Records for the X and Y columns
 					const xColumnIndex = newData.ColNames.findIndex(e => e === plotConfig.x_axis_label);
 					const yColumnIndex = newData.ColNames.findIndex(e => e === plotConfig.y_axis_label);
@@ -212,12 +374,22 @@ export function Visualisation({name, plotConfig, branch, setRawData, setLastRunR
 	} else if(state === "nodata") {
 		// The server responded but the query did not return any records to plot
 		return <div className="alert alert-info" role="alert">SQL query ran without error, but returned no records</div>;
+	} else if(state === "nopivot") {
+		// The pivot table fields haven't been chosen yet
+		return <div className="alert alert-info" role="alert">Please choose the fields of the pivot table in the chart settings.</div>;
+	} else if(state === "done" && plotConfig?.chart_type === "pivot") {
+		return <PivotTable name={name} data={data} />;
 	} else if(state === "done") {
 		// The server responsed and the query returned some records to plot
 		return (
 			<Plot
 				data={[data]}
-				layout={{
+				layout={plotConfig?.chart_type === "map" ? {
+					autosize: true,
+					title: name,
+					mapbox: mapbox,
+					margin: {l: 0, r: 0, b: 0},
+				} : {
 					autosize: true,
 					title: name,
 					xaxis: {visible: plotConfig?.show_x_label, title: plotConfig?.chart_type === "hbc" ? plotConfig?.y_axis_label : plotConfig?.x_axis_label},
@@ -258,6 +430,11 @@ export function VisualisationEditor() {
 			return;
 		}
 
+		// Maps and pivot tables don't use the axis columns
+		if (visualisations[selectedVisualisation].chart_type === "map" || visualisations[selectedVisualisation].chart_type === "pivot") {
+			return;
+		}
+
 		// Check x axis column
 		if (rawData.ColNames.indexOf(visualisations[selectedVisualisation].x_axis_label) === -1) {
 			updatePlotConfig({x_axis_label: rawData.ColNames[0]});
@@ -551,12 +728,25 @@ export function VisualisationEditor() {
 		{value: "vbc", label: "Vertical bar chart"},
 		{value: "lc", label: "Line chart"},
 		{value: "pie", label: "Pie chart"},
+		{value: "map", label: "Map"},
+		{value: "pivot", label: "Pivot table"},
 	];
 	const selectedChartType = chartTypes.find(t => {return t.value === (visualisations[selectedVisualisation]?.chart_type || "vbc")});
 
 	// List of data columns for the chart axis dropdown elements
 	const columnList = rawData === null ? [] : rawData.ColNames.map(c => new Object({name: String(c)}));
 
+	// Pivot tables are built from the columns of the query, which are returned alongside the summarised results
+	const sourceColumnList = rawData === null ? [] : (rawData.SourceColNames || rawData.ColNames).map(c => new Object({name: String(c)}));
+	const pivot = visualisations[selectedVisualisation]?.pivot || {aggregate: "count", row: ""};
+	const pivotAggregates = [
+		{value: "count", label: "Count"},
+		{value: "sum", label: "Sum"},
+		{value: "avg", label: "Average"},
+		{value: "min", label: "Minimum"},
+		{value: "max", label: "Maximum"},
+	];
+
 	return (<>
 		{meta.isLive === false ? (
 			<div className="row">
@@ -627,19 +817,80 @@ export function VisualisationEditor() {
 										<Select name="charttype" required={true} onChange={values => updatePlotConfig({chart_type: values[0].value})} options={chartTypes} values={[selectedChartType]} />
 									</div>
 								</div>
-								<div className="row mb-2">
-									<label htmlFor="xaxiscol" className="col-sm-2 col-form-label">X axis column</label>
-									<div className="col-sm-10">
-										<Select name="xaxiscol" required={true} labelField="name" valueField="name" onChange={values => updatePlotConfig({x_axis_label: values[0].name})} options={columnList} values={[{name: visualisations[selectedVisualisation]?.x_axis_label}]} />
+								{visualisations[selectedVisualisation]?.chart_type === "pivot" ? (<>
+									<div className="row mb-2">
+										<label htmlFor="pivotrow" className="col-sm-2 col-form-label">Row field</label>
+										<div className="col-sm-10">
+											<Select name="pivotrow" required={true} labelField="name" valueField="name" onChange={values => updatePlotConfig({pivot: {...pivot, row: values[0].name}})} options={sourceColumnList} values={pivot.row ? [{name: pivot.row}] : []} />
+										</div>
 									</div>
-								</div>
-								<div className="row mb-2">
-									<label htmlFor="yaxiscol" className="col-sm-2 col-form-label">Y axis column</label>
-									<div className="col-sm-10">
-										<Select name="yaxiscol" required={true} labelField="name" valueField="name" onChange={values => updatePlotConfig({y_axis_label: values[0].name})} options={columnList} values={[{name: visualisations[selectedVisualisation]?.y_axis_label}]} />
+									<div className="row mb-2">
+										<label htmlFor="pivotcolumn" className="col-sm-2 col-form-label">Column field</label>
+										<div className="col-sm-10">
+											<Select name="pivotcolumn" labelField="name" valueField="name" clearable={true} onChange={values => updatePlotConfig({pivot: {...pivot, column: values.length ? values[0].name : ""}})} options={sourceColumnList} values={pivot.column ? [{name: pivot.column}] : []} />
+											<small className="form-text text-muted">Optional.  Each of its values becomes a column of the pivot table</small>
+										</div>
+									</div>
+									<div className="row mb-2">
+										<label htmlFor="pivotaggregate" className="col-sm-2 col-form-label">Summarise by</label>
+										<div className="col-sm-10">
+											<Select name="pivotaggregate" required={true} onChange={values => updatePlotConfig({pivot: {...pivot, aggregate: values[0].value}})} options={pivotAggregates} values={[pivotAggregates.find(a => a.value === pivot.aggregate) || pivotAggregates[0]]} />
+										</div>
+									</div>
+									<div className="row mb-2">
+										<label htmlFor="pivotvalue" className="col-sm-2 col-form-label">Value field</label>
+										<div className="col-sm-10">
+											<Select name="pivotvalue" labelField="name" valueField="name" clearable={true} onChange={values => updatePlotConfig({pivot: {...pivot, value: values.length ? values[0].name : ""}})} options={sourceColumnList} values={pivot.value ? [{name: pivot.value}] : []} />
+											<small className="form-text text-muted">Not needed when counting rows</small>
+										</div>
+									</div>
+								</>) : visualisations[selectedVisualisation]?.chart_type === "map" ? (<>
+									<div className="row mb-2">
+										<label htmlFor="latcol" className="col-sm-2 col-form-label">Latitude column</label>
+										<div className="col-sm-10">
+											<Select name="latcol" labelField="name" valueField="name" clearable={true} onChange={values => updatePlotConfig({lat_column: values.length ? values[0].name : ""})} options={columnList} values={visualisations[selectedVisualisation]?.lat_column ? [{name: visualisations[selectedVisualisation].lat_column}] : []} />
+										</div>
 									</div>
-								</div>
-								{visualisations[selectedVisualisation]?.chart_type !== "pie" ? (<>
+									<div className="row mb-2">
+										<label htmlFor="loncol" className="col-sm-2 col-form-label">Longitude column</label>
+										<div className="col-sm-10">
+											<Select name="loncol" labelField="name" valueField="name" clearable={true} onChange={values => updatePlotConfig({lon_column: values.length ? values[0].name : ""})} options={columnList} values={visualisations[selectedVisualisation]?.lon_column ? [{name: visualisations[selectedVisualisation].lon_column}] : []} />
+										</div>
+									</div>
+									<div className="row mb-2">
+										<label htmlFor="geojsoncol" className="col-sm-2 col-form-label">GeoJSON column</label>
+										<div className="col-sm-10">
+											<Select name="geojsoncol" labelField="name" valueField="name" clearable={true} onChange={values => updatePlotConfig({geojson_column: values.length ? values[0].name : ""})} options={columnList} values={visualisations[selectedVisualisation]?.geojson_column ? [{name: visualisations[selectedVisualisation].geojson_column}] : []} />
+											<small className="form-text text-muted">Used instead of the latitude and longitude columns when set.  SpatiaLite geometries can be converted with <code>AsGeoJSON()</code> in the query</small>
+										</div>
+									</div>
+									<div className="row mb-2">
+										<label htmlFor="labelcol" className="col-sm-2 col-form-label">Label column</label>
+										<div className="col-sm-10">
+											<Select name="labelcol" labelField="name" valueField="name" clearable={true} onChange={values => updatePlotConfig({label_column: values.length ? values[0].name : ""})} options={columnList} values={visualisations[selectedVisualisation]?.label_column ? [{name: visualisations[selectedVisualisation].label_column}] : []} />
+										</div>
+									</div>
+									<div className="row mb-2">
+										<label htmlFor="maptiles" className="col-sm-2 col-form-label">Map tiles</label>
+										<div className="col-sm-10">
+											<Select name="maptiles" required={true} labelField="name" valueField="name" onChange={values => updatePlotConfig({map_tiles: values[0].name})} options={mapTileProviders} values={mapTileProviders.length ? [mapTileProviders.find(p => p.name === visualisations[selectedVisualisation]?.map_tiles) || mapTileProviders[0]] : []} />
+										</div>
+									</div>
+								</>) : (<>
+									<div className="row mb-2">
+										<label htmlFor="xaxiscol" className="col-sm-2 col-form-label">X axis column</label>
+										<div className="col-sm-10">
+											<Select name="xaxiscol" required={true} labelField="name" valueField="name" onChange={values => updatePlotConfig({x_axis_label: values[0].name})} options={columnList} values={[{name: visualisations[selectedVisualisation]?.x_axis_label}]} />
+										</div>
+									</div>
+									<div className="row mb-2">
+										<label htmlFor="yaxiscol" className="col-sm-2 col-form-label">Y axis column</label>
+										<div className="col-sm-10">
+											<Select name="yaxiscol" required={true} labelField="name" valueField="name" onChange={values => updatePlotConfig({y_axis_label: values[0].name})} options={columnList} values={[{name: visualisations[selectedVisualisation]?.y_axis_label}]} />
+										</div>
+									</div>
+								</>)}
+								{visualisations[selectedVisualisation]?.chart_type !== "pie" && visualisations[selectedVisualisation]?.chart_type !== "map" && visualisations[selectedVisualisation]?.chart_type !== "pivot" ? (<>
 									<div className="row mb-2">
 										<label htmlFor="showxaxis" className="col-sm-2 col-form-label">Show X axis</label>
 										<div className="col-sm-10">
@@ -689,6 +940,10 @@ export function VisualisationEditor() {
 							<code>
 								&lt;iframe width="425" height="350" src={"\"" + window.location.origin + "/visembed/" + meta.owner + "/" + meta.database + "?visname=" + selectedVisualisation + "\""} title={"\"" + selectedVisualisation + " - DBHub.io visualisation\""} style="border: 1px solid black"&gt;&lt;/iframe&gt;
 							</code>
+							<h6 className="mt-2">Or include it as an image in READMEs and other Markdown documents. The image always shows the data of the latest commit.</h6>
+							<code>
+								{"![" + selectedVisualisation + "](" + window.location.origin + "/chart/" + meta.owner + "/" + encodeURIComponent(meta.database) + "/" + encodeURIComponent(selectedVisualisation) + ".svg)"}
+							</code>
 						</div>
 					) : null}
 				</>)}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html"
 	"html/template"
@@ -20,7 +22,6 @@ import (
 	"time"
 
 	gz "github.com/NYTimes/gziphandler"
-	"github.com/bradfitz/gomemcache/memcache"
 	gsm "github.com/bradleypeabody/gorilla-sessions-memcache"
 	sqlite "github.com/gwenn/gosqlite"
 	com "github.com/sqlitebrowser/dbhub.io/common"
@@ -39,6 +40,14 @@ var (
 
 	// Session cookie storage
 	store *gsm.MemcacheStore
+
+	// POST requests which only read, so keep working in read only mode.  Live SQL statements are run as queries in read
+	// only mode, so ones changing the database are refused by the handler instead
+	readPaths = []string{"/x/branchnames", "/x/diffcommitlist/", "/x/execlivesql/", "/x/execsql/", "/x/markdownpreview/",
+		"/x/tablenames/"}
+
+	// GET requests which change things, so are refused in read only mode
+	writePaths = []string{"/x/forkdb/", "/x/star/", "/x/watch/"}
 )
 
 // apiKeyDelHandler deletes an existing API key
@@ -143,12 +152,28 @@ func apiKeyGenHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Get the origins browsers may use the key from.  These are optional, one per line
+	var allowedOrigins []string
+	for _, o := range strings.Split(r.PostFormValue("origins"), "\n") {
+		o = strings.TrimSuffix(strings.TrimSpace(o), "/")
+		if o == "" {
+			continue
+		}
+		err = com.ValidateOrigin(o)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, err.Error())
+			return
+		}
+		allowedOrigins = append(allowedOrigins, o)
+	}
+
 	// Generate new API key
 	var expiryDateOpt *time.Time
 	if expiryDate.IsZero() == false {
 		expiryDateOpt = &expiryDate
 	}
-	key, err := database.APIKeyGenerate(loggedInUser, expiryDateOpt, permissions, comment)
+	key, err := database.APIKeyGenerate(loggedInUser, expiryDateOpt, permissions, comment, allowedOrigins)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -159,12 +184,13 @@ func apiKeyGenHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Return the API key to the caller
 	data, err := json.Marshal(APIKey{
-		Uuid:        key.Uuid,
-		Key:         key.Key,
-		DateCreated: key.DateCreated,
-		ExpiryDate:  key.ExpiryDate,
-		Comment:     key.Comment,
-		Permissions: key.Permissions,
+		Uuid:           key.Uuid,
+		Key:            key.Key,
+		DateCreated:    key.DateCreated,
+		ExpiryDate:     key.ExpiryDate,
+		Comment:        key.Comment,
+		Permissions:    key.Permissions,
+		AllowedOrigins: key.AllowedOrigins,
 	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -173,6 +199,188 @@ func apiKeyGenHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, string(data))
 }
 
+// archiveDBHandler archives a database, making it read only, or makes it writable again.  Only the owner of the
+// database can do this
+func archiveDBHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Extract the required form variables
+	usr, _, dbName, err := com.GetUFD(r, false)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Bad request")
+		return
+	}
+	archived, err := strconv.ParseBool(r.PostFormValue("archived"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Invalid value for archived")
+		return
+	}
+
+	// Use the established capitalisation of the username
+	z, err := database.User(usr)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	dbOwner := z.Username
+
+	// Only the owner of a database can archive it
+	if !strings.EqualFold(loggedInUser, dbOwner) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "Only the owner of a database can archive it")
+		return
+	}
+
+	// Update the archived status of the database
+	exists, err := database.SetDBArchived(dbOwner, dbName, archived)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Database '%s/%s' doesn't exist", dbOwner, dbName)
+		return
+	}
+
+	// Invalidate the memcache data for the database, so the new status gets picked up
+	err = com.InvalidateCacheEntry(loggedInUser, dbOwner, dbName, "") // Empty string indicates "for all versions"
+	if err != nil {
+		log.Printf("Error when invalidating memcache entries: %s", err.Error())
+	}
+
+	// Return the new status
+	fmt.Fprint(w, archived)
+}
+
+// assignDiscussHandler assigns a discussion or MR to a user, or removes the assignment when no assignee is given.
+// Only users with write access to the database can do this, and discussions can only be assigned to users who can
+// access the database
+func assignDiscussHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Extract the required form variables
+	usr, _, dbName, err := com.GetUFD(r, false)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Bad request")
+		return
+	}
+
+	// Use the established capitalisation of the username
+	z, err := database.User(usr)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	dbOwner := z.Username
+
+	// Ensure a discussion ID was given
+	a := r.PostFormValue("discid")
+	if a == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Missing discussion id")
+		return
+	}
+	discID, err := strconv.Atoi(a)
+	if err != nil {
+		log.Printf("Error converting string '%s' to integer in function '%s': %s", com.SanitiseLogString(a),
+			com.GetCurrentFunctionName(), err)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Error when parsing discussion id value")
+		return
+	}
+
+	// Only users with write access to the database can assign discussions
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	if !allowed {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "You don't have write access to this database")
+		return
+	}
+
+	// Validate the assignee
+	assignee := r.PostFormValue("assignee")
+	if assignee != "" {
+		err = com.ValidateUser(assignee)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "Invalid assignee")
+			return
+		}
+		u, err := database.User(assignee)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if u.Username == "" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "Unknown user '%s'", assignee)
+			return
+		}
+		assignee = u.Username
+		canAccess, err := database.CheckDBPermissions(assignee, dbOwner, dbName, false)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, err.Error())
+			return
+		}
+		if !canAccess {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "User '%s' doesn't have access to this database", assignee)
+			return
+		}
+	}
+
+	// Assign the discussion, and let the assignee know
+	exists, err := database.SetDiscussionAssignee(dbOwner, dbName, discID, assignee)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "Unknown discussion")
+		return
+	}
+	err = database.NewAssignmentEvent(dbOwner, dbName, loggedInUser, discID, assignee)
+	if err != nil {
+		log.Printf("Error when creating a new assignment event: %s", err.Error())
+	}
+	fmt.Fprint(w, assignee)
+}
+
 // auth0CallbackHandler is called at the end of the Auth0 authentication process, whether successful or not.
 // If the authentication process was successful:
 //   - if the user already has an account on our system then this function creates a login session for them.
@@ -298,7 +506,7 @@ func auth0CallbackHandler(w http.ResponseWriter, r *http.Request) {
 		// Create a special session cookie, purely for the registration page
 		sess, err := store.Get(r, "user-reg")
 		if err != nil {
-			if err == memcache.ErrCacheMiss {
+			if err == com.ErrCacheMiss {
 				// Seems like a stale session token, so delete the session and reload the page
 				sess.Options.MaxAge = -1
 				err = sess.Save(r, w)
@@ -329,14 +537,15 @@ func auth0CallbackHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// If Auth0 provided a picture URL for the user, check if it's different to what we already have (eg it may have
-	// been updated)
-	if avatarURL != "" {
+	// been updated).  Avatars uploaded by the user take precedence, and the Auth0 ones aren't used when Gravatar is
+	// turned off, as they're often Gravatars too
+	if avatarURL != "" && !config.Conf.Avatars.DisableGravatar {
 		usr, err := database.User(userName)
 		if err != nil {
 			errorPage(w, r, http.StatusBadRequest, err.Error())
 			return
 		}
-		if usr.AvatarURL != avatarURL {
+		if !usr.AvatarUploaded && usr.AvatarURL != avatarURL {
 			// The Auth0 provided pic URL is different to what we have already, so we update the database with the new
 			// value
 			err = database.UpdateAvatarURL(userName, avatarURL)
@@ -369,6 +578,118 @@ func auth0CallbackHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/"+userName, http.StatusSeeOther)
 }
 
+// avatarDeleteHandler removes the uploaded avatar of the logged in user, so they get the default one again
+func avatarDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	err = com.RemoveAvatar(loggedInUser)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// avatarHandler returns the avatar of a user as a PNG image.  The optional "s" parameter gives the size in pixels,
+// up to com.AvatarSize.  Avatar URLs change when a new one is uploaded, so they can be cached for a while
+func avatarHandler(w http.ResponseWriter, r *http.Request) {
+	userName := strings.TrimPrefix(r.URL.Path, "/avatar/")
+	err := com.ValidateUser(userName)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Invalid user name")
+		return
+	}
+	size := com.AvatarSize
+	if z := r.FormValue("s"); z != "" {
+		size, err = strconv.Atoi(z)
+		if err != nil || size < 1 || size > com.AvatarSize {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Invalid size.  It needs to be between 1 and %d", com.AvatarSize)
+			return
+		}
+	}
+
+	img, modified, err := com.Avatar(userName, size)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("ETag", fmt.Sprintf(`"%d-%d"`, modified.Unix(), size))
+	http.ServeContent(w, r, "avatar.png", modified, bytes.NewReader(img))
+}
+
+// avatarUploadHandler stores a new avatar for the logged in user, from the "avatar" field of a multipart form
+func avatarUploadHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check the image isn't too large
+	maxSize := config.Conf.Avatars.MaxUpload
+	if r.ContentLength > maxSize {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "The image is too large.  Avatars can be up to %d KB", maxSize/1024)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+	err = r.ParseMultipartForm(maxSize)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	f, _, err := r.FormFile("avatar")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "No image was uploaded")
+		return
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+
+	err = com.SetAvatar(loggedInUser, data)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+}
+
 // Returns a list of the branches present in a database
 func branchNamesHandler(w http.ResponseWriter, r *http.Request) {
 	// Retrieve session data (if any)
@@ -479,11 +800,61 @@ func checkLogin(w http.ResponseWriter, r *http.Request) (loggedInUser string, va
 	if u != nil {
 		loggedInUser = u.(string)
 		validSession = true
+
+		// Users banned by the instance admins are treated as logged out, even with an existing session
+		var banned bool
+		banned, err = database.UserBanned(loggedInUser)
+		if err != nil {
+			return "", false, err
+		}
+		if banned {
+			return "", false, nil
+		}
 	}
 
 	return
 }
 
+// Returns the metadata for citing a release of a database, as a CITATION.cff file or DataCite JSON.
+func citationHandler(w http.ResponseWriter, r *http.Request) {
+	dbOwner, dbName, err := com.GetOD(2, r) // 2 = Ignore "/x/citation/" at the start of the URL
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	relName := r.FormValue("release")
+	err = com.ValidateBranchName(relName)
+	if relName == "" || err != nil {
+		errorPage(w, r, http.StatusBadRequest, "Validation failed for release name")
+		return
+	}
+
+	// Retrieve session data (if any)
+	loggedInUser, _, err := checkLogin(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	cit, err := com.GetReleaseCitation(loggedInUser, dbOwner, dbName, relName)
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	switch r.FormValue("format") {
+	case "", "cff":
+		w.Header().Set("Content-Disposition", `attachment; filename="CITATION.cff"`)
+		w.Header().Set("Content-Type", "application/x-yaml; charset=utf-8")
+		w.Write([]byte(cit.CFF()))
+	case "datacite":
+		w.Header().Set("Content-Disposition", `attachment; filename="datacite.json"`)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cit.DataCite())
+	default:
+		errorPage(w, r, http.StatusBadRequest, "Unknown citation format")
+	}
+}
+
 func collectPageMetaInfo(w http.ResponseWriter, r *http.Request, pageMeta *PageMetaInfo) (errCode int, err error) {
 	// Auth0 info
 	pageMeta.Auth0.CallbackURL = "https://" + config.Conf.Web.ServerName + "/x/callback"
@@ -499,6 +870,11 @@ func collectPageMetaInfo(w http.ResponseWriter, r *http.Request, pageMeta *PageM
 	// API info
 	pageMeta.ApiUrl = "https://" + config.Conf.Api.ServerName
 
+	// Let people know when changes can't be made
+	if ro, msg := com.ReadOnlyMode(); ro {
+		pageMeta.ReadOnlyMessage = msg
+	}
+
 	// Retrieve session data (if any)
 	loggedInUser, validSession, err := checkLogin(w, r)
 	if err != nil {
@@ -514,9 +890,8 @@ func collectPageMetaInfo(w http.ResponseWriter, r *http.Request, pageMeta *PageM
 		if err != nil {
 			return http.StatusBadRequest, err
 		}
-		if ur.AvatarURL != "" {
-			pageMeta.AvatarURL = ur.AvatarURL + "&s=48"
-		}
+		pageMeta.AvatarURL = database.AvatarURLSized(ur.AvatarURL, 48)
+		pageMeta.IsAdmin = ur.IsAdmin
 		pageMeta.NumStatusUpdates, err = com.UserStatusUpdates(loggedInUser)
 		if err != nil {
 			return http.StatusBadRequest, err
@@ -739,13 +1114,37 @@ func createCommentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Comments flagged as spam are held for moderation rather than published.  Closing or reopening the discussion
+	// still goes ahead
+	held := false
+	if comText != "" {
+		held, err = com.HoldIfSpam(r, database.HeldContent{
+			Body:    comText,
+			DBName:  dbName,
+			DBOwner: dbOwner,
+			DiscID:  discID,
+			Kind:    "comment",
+			User:    loggedInUser,
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, err.Error())
+			return
+		}
+		if held {
+			comText = ""
+		}
+	}
+
 	// Add the comment to PostgreSQL
-	err = database.StoreComment(dbOwner, dbName, loggedInUser, discID, comText, discClose,
-		database.CLOSED_WITHOUT_MERGE) // database.CLOSED_WITHOUT_MERGE is ignored for discussions.  It's only used for MRs
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprint(w, err.Error())
-		return
+	if comText != "" || discClose {
+		err = database.StoreComment(dbOwner, dbName, loggedInUser, discID, comText, discClose,
+			database.CLOSED_WITHOUT_MERGE) // database.CLOSED_WITHOUT_MERGE is ignored for discussions.  It's only used for MRs
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, err.Error())
+			return
+		}
 	}
 
 	// Invalidate the memcache data for the database, so if the discussion counter for the database was changed it
@@ -760,6 +1159,11 @@ func createCommentHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Send a success message
+	if held {
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, "Your comment has been held for moderation, and will be published once it's been reviewed")
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -838,6 +1242,26 @@ func createDiscussHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Discussions flagged as spam are held for moderation rather than published
+	held, err := com.HoldIfSpam(r, database.HeldContent{
+		Body:    discText,
+		DBName:  dbName,
+		DBOwner: dbOwner,
+		Kind:    "discussion",
+		Title:   discTitle,
+		User:    loggedInUser,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	if held {
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, "Your discussion has been held for moderation, and will be published once it's been reviewed")
+		return
+	}
+
 	// Add the discussion detail to PostgreSQL
 	var x struct {
 		ID int `json:"discuss_id"`
@@ -866,6 +1290,13 @@ func createDiscussHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Notify any users mentioned in the description
+	err = database.NewMentionEvents(details, discText)
+	if err != nil {
+		log.Printf("Error when creating a new mention event: %s", err.Error())
+		return
+	}
+
 	// Invalidate the memcache data for the database, so the new discussion count gets picked up
 	err = com.InvalidateCacheEntry(loggedInUser, dbOwner, dbName, "") // Empty string indicates "for all versions"
 	if err != nil {
@@ -1151,6 +1582,25 @@ func createMergeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Notify any users mentioned in the description
+	err = database.NewMentionEvents(details, descrip)
+	if err != nil {
+		log.Printf("Error when creating a new mention event: %s", err.Error())
+		return
+	}
+
+	// Ask the owners of the tables changed by the merge request to review it
+	err = com.RequestMergeRequestReviews(destOwner, destDBName, database.DiscussionEntry{
+		Creator:   loggedInUser,
+		ID:        x.ID,
+		MRDetails: mrDetails,
+		Title:     title,
+	})
+	if err != nil {
+		log.Printf("Error when requesting merge request reviews: %s", err.Error())
+		return
+	}
+
 	// Invalidate the memcache data for the destination database, so the new MR count gets picked up
 	err = com.InvalidateCacheEntry(loggedInUser, destOwner, destDBName, "") // Empty string indicates "for all versions"
 	if err != nil {
@@ -1381,7 +1831,7 @@ func createUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	av, ok := sess.Values["avatar"]
-	if ok {
+	if ok && !config.Conf.Avatars.DisableGravatar {
 		avatarURL = av.(string)
 	}
 	em := sess.Values["email"]
@@ -1500,9 +1950,29 @@ func createUserHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// When signups are closed, the user needs a valid invitation unless their email address is in an allowed domain
+	var inviteID int64
+	if com.SignupNeedsInvitation(email) {
+		inviteID, err = database.InvitationClaim(strings.TrimSpace(r.PostFormValue("invite")), email)
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, "Invitation check failed")
+			return
+		}
+		if inviteID == 0 {
+			errorPage(w, r, http.StatusForbidden, "Signups are by invitation only, and that invitation code isn't "+
+				"valid for your email address.  It may have expired or already been used")
+			return
+		}
+	}
+
 	// Add the user to the system
 	err = database.AddUser(auth0ID, userName, email, displayName, avatarURL)
 	if err != nil {
+		// Let the invitation (if any) be used again
+		if inviteID != 0 {
+			database.InvitationRelease(inviteID)
+		}
+
 		// Note : gorilla/sessions uses MaxAge < 0 to mean "delete this session"
 		sess.Options.MaxAge = -1
 		err = sess.Save(r, w)
@@ -1602,10 +2072,9 @@ func checkUserExistsHandler(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
-// This function deletes a branch.
-func deleteBranchHandler(w http.ResponseWriter, r *http.Request) {
-	pageName := "Delete Branch handler"
-
+// customDomainAddHandler adds a custom domain for the logged in user, returning its details including the token to
+// verify it with
+func customDomainAddHandler(w http.ResponseWriter, r *http.Request) {
 	// Retrieve session data (if any)
 	loggedInUser, validSession, err := checkLogin(w, r)
 	if err != nil {
@@ -1619,379 +2088,247 @@ func deleteBranchHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Extract the required form variables
-	usr, _, dbName, err := com.GetUFD(r, false)
+	d, err := com.CustomDomainAdd(loggedInUser, r.PostFormValue("domain"))
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err.Error())
 		return
 	}
-
-	// Use the established capitalisation of the username
-	z, err := database.User(usr)
+	data, err := json.Marshal(d)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	dbOwner := z.Username
+	fmt.Fprint(w, string(data))
+}
 
-	// Check if a branch name was requested
-	branchName, err := com.GetFormBranch(r)
+// customDomainDelHandler removes a custom domain of the logged in user
+func customDomainDelHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	loggedInUser, validSession, err := checkLogin(w, r)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// If any of the required values were empty, indicate failure
-	if branchName == "" || dbName == "" || dbOwner == "" {
-		w.WriteHeader(http.StatusBadRequest)
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
-	// Make sure the database exists in the system
-	exists, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+	err = com.CustomDomainRemove(loggedInUser, r.PostFormValue("domain"))
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	if !exists {
-		log.Printf("%s: Validation failed for database to delete: %s", pageName, err)
-		w.WriteHeader(http.StatusNotFound)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err.Error())
 		return
 	}
+}
 
-	// Load the existing branchHeads for the database
-	branchList, err := database.GetBranches(loggedInUser, dbName)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+// customDomainHandler serves the requests made to the custom domains of users.  The root of a custom domain shows the
+// profile of its owner, and "/<database>" shows one of their databases.  Everything else, including logging in and the
+// "/x/" requests, is redirected to the main server.  So no sessions or cookies are ever issued for a custom domain, as
+// its owner could point it at a server of their own later on
+func customDomainHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Hosts which can't be custom domains, such as "localhost" or IP addresses, are served as usual
+		host := com.NormaliseDomain(r.Host)
+		if !config.Conf.Domains.Enabled || host == com.NormaliseDomain(config.Conf.Web.ServerName) ||
+			com.Validate.Var(host, "fqdn") != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		owner, err := com.CustomDomainOwner(host)
+		if err != nil {
+			http.Error(w, "Database query failed", http.StatusInternalServerError)
+			return
+		}
+		if owner == "" {
+			http.Error(w, "Unknown domain", http.StatusNotFound)
+			return
+		}
 
-	// Make sure the given branch exists
-	branch, ok := branchList[branchName]
-	if !ok {
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
+		// Only the user and database pages, which are shown by mainHandler, are mapped onto the custom domain
+		if _, pattern := http.DefaultServeMux.Handler(r); pattern != "/" {
+			http.Redirect(w, r, "https://"+config.Conf.Web.ServerName+r.URL.RequestURI(), http.StatusMovedPermanently)
+			return
+		}
+		pathStrings := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		switch {
+		case pathStrings[0] == "":
+			r.URL.Path = "/" + owner
+		case strings.EqualFold(pathStrings[0], owner):
+			// The path already starts with the owner, as used by the links on the pages
+		case len(pathStrings) == 1:
+			r.URL.Path = "/" + owner + "/" + pathStrings[0]
+		default:
+			http.Redirect(w, r, "https://"+config.Conf.Web.ServerName+r.URL.RequestURI(), http.StatusMovedPermanently)
+			return
+		}
+		r.URL.RawPath = ""
+		next.ServeHTTP(w, r)
+	})
+}
 
-	// Make sure the branch being deleted isn't the default one
-	defBranch, err := database.GetDefaultBranchName(dbOwner, dbName)
+// customDomainVerifyHandler checks the DNS verification record of a custom domain of the logged in user
+func customDomainVerifyHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	loggedInUser, validSession, err := checkLogin(w, r)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	if defBranch == branchName {
-		w.WriteHeader(http.StatusConflict)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Make sure that deleting this branch wouldn't result in any isolated tags or releases.  For example, when there
-	// is a tag or release on a commit which is only in this branch, deleting the branch would leave the tag or
-	// release in place with no way to reach it
-
-	// Get the commit list for the database
-	commitList, err := database.GetCommitList(dbOwner, dbName)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
-	// Get the tag list for the database
-	tags, err := database.GetTags(dbOwner, dbName)
+	err = com.CustomDomainVerify(loggedInUser, r.PostFormValue("domain"))
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err.Error())
 		return
 	}
+}
 
-	// Get the release list for the database
-	rels, err := database.GetReleases(dbOwner, dbName)
+// This function deletes a branch.
+func deleteBranchHandler(w http.ResponseWriter, r *http.Request) {
+	pageName := "Delete Branch handler"
+
+	// Retrieve session data (if any)
+	loggedInUser, validSession, err := checkLogin(w, r)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// If the database has tags, walk the commit history for the branch checking if any of the tags are on commits in
-	// this branch
-	branchTags := make(map[string]string)
-	if len(tags) > 0 {
-		// Walk the commit history for the branch checking if any of the tags are on commits in this branch
-		c, ok := commitList[branch.Commit]
-		if !ok {
-			log.Printf("Error when checking for isolated tags while deleting branch '%s' of database "+
-				"'%s/%s'", com.SanitiseLogString(branchName), com.SanitiseLogString(dbOwner), com.SanitiseLogString(dbName))
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		for tName, tEntry := range tags {
-			// Scan through the tags, checking if any of them are for this commit
-			if tEntry.Commit == c.ID {
-				// It's a match, so add this tag to the list of tags on this branch
-				branchTags[tName] = c.ID
-			}
-		}
-		for c.Parent != "" {
-			c, ok = commitList[c.Parent]
-			if !ok {
-				log.Printf("Error when checking for isolated tags while deleting branch '%s' of database "+
-					"'%s/%s'", com.SanitiseLogString(branchName), com.SanitiseLogString(dbOwner), com.SanitiseLogString(dbName))
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
-			for tName, tEntry := range tags {
-				// Scan through the tags, checking if any of them are for this commit
-				if tEntry.Commit == c.ID {
-					// It's a match, so add this tag to the list of tags on this branch
-					branchTags[tName] = c.ID
-				}
-			}
-		}
-
-		// For any tags on commits in this branch, check if they're also on other branches
-		if len(branchTags) > 0 {
-			for bName, bEntry := range branchList {
-				if bName == branchName {
-					// We're only checking "other branches"
-					continue
-				}
-
-				// If there are no tags left to check, we might as well stop further looping
-				if len(branchTags) == 0 {
-					break
-				}
-
-				c := commitList[bEntry.Commit]
-				for tName, tCommit := range branchTags {
-					if c.ID == tCommit {
-						// This commit matches a tag, so remove the tag from the list
-						delete(branchTags, tName)
-					}
-				}
-				for c.Parent != "" {
-					c, ok = commitList[c.Parent]
-					if !ok {
-						log.Printf("Error when checking for isolated tags while deleting branch '%s' of "+
-							"database '%s/%s'", com.SanitiseLogString(branchName), com.SanitiseLogString(dbOwner), com.SanitiseLogString(dbName))
-						w.WriteHeader(http.StatusInternalServerError)
-						return
-					}
-					for tName, tCommit := range branchTags {
-						if c.ID == tCommit {
-							// This commit matches a tag, so remove the tag from the list
-							delete(branchTags, tName)
-						}
-					}
-				}
-			}
-		}
-
-		// If there are any tags left over which aren't on other branches, abort this branch deletion and tell the user
-		if len(branchTags) > 0 {
-			var conflictedTags string
-			for tName := range branchTags {
-				if conflictedTags == "" {
-					conflictedTags = tName
-				} else {
-					conflictedTags += ", " + tName
-				}
-			}
-
-			w.WriteHeader(http.StatusConflict)
-			if len(branchTags) > 1 {
-				w.Write([]byte(fmt.Sprintf("You need to delete the tags '%s' before you can delete this branch",
-					conflictedTags)))
-			} else {
-				w.Write([]byte(fmt.Sprintf("You need to delete the tag '%s' before you can delete this branch",
-					conflictedTags)))
-			}
-			return
-		}
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
 	}
 
-	// If the database has releases, walk the commit history for the branch checking if any of the releases are on
-	// commits in this branch
-	branchRels := make(map[string]string)
-	if len(rels) > 0 {
-		// Walk the commit history for the branch checking if any of the releases are on commits in this branch
-		c, ok := commitList[branch.Commit]
-		if !ok {
-			log.Printf("Error when checking for isolated releases while deleting branch '%s' of database "+
-				"'%s/%s'", com.SanitiseLogString(branchName), com.SanitiseLogString(dbOwner), com.SanitiseLogString(dbName))
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		for rName, rEntry := range rels {
-			// Scan through the releases, checking if any of them are for this commit
-			if rEntry.Commit == c.ID {
-				// It's a match, so add this release to the list of releases on this branch
-				branchRels[rName] = c.ID
-			}
-		}
-		for c.Parent != "" {
-			c, ok = commitList[c.Parent]
-			if !ok {
-				log.Printf("Error when checking for isolated releases while deleting branch '%s' of database "+
-					"'%s/%s'", com.SanitiseLogString(branchName), com.SanitiseLogString(dbOwner), com.SanitiseLogString(dbName))
-				w.WriteHeader(http.StatusInternalServerError)
-				return
-			}
-			for rName, rEntry := range rels {
-				// Scan through the releases, checking if any of them are for this commit
-				if rEntry.Commit == c.ID {
-					// It's a match, so add this release to the list of releases on this branch
-					branchRels[rName] = c.ID
-				}
-			}
-		}
-
-		// For any releases on commits in this branch, check if they're also on other branches
-		if len(branchRels) > 0 {
-			for bName, bEntry := range branchList {
-				if bName == branchName {
-					// We're only checking "other branches"
-					continue
-				}
-
-				// If there are no releases left to check, we might as well stop further looping
-				if len(branchRels) == 0 {
-					break
-				}
-
-				c := commitList[bEntry.Commit]
-				for rName, rCommit := range branchRels {
-					if c.ID == rCommit {
-						// This commit matches a release, so remove the release from the list
-						delete(branchRels, rName)
-					}
-				}
-				for c.Parent != "" {
-					c, ok = commitList[c.Parent]
-					if !ok {
-						log.Printf("Error when checking for isolated releases while deleting branch '%s' of "+
-							"database '%s/%s'", com.SanitiseLogString(branchName), com.SanitiseLogString(dbOwner), com.SanitiseLogString(dbName))
-						w.WriteHeader(http.StatusInternalServerError)
-						return
-					}
-					for rName, rCommit := range branchRels {
-						if c.ID == rCommit {
-							// This commit matches a release, so remove the release from the list
-							delete(branchRels, rName)
-						}
-					}
-				}
-			}
-		}
+	// Extract the required form variables
+	usr, _, dbName, err := com.GetUFD(r, false)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
 
-		// If there are any releases left over which aren't on other branches, abort this branch deletion and tell the user
-		if len(branchRels) > 0 {
-			var conflictedRels string
-			for rName := range branchRels {
-				if conflictedRels == "" {
-					conflictedRels = rName
-				} else {
-					conflictedRels += ", " + rName
-				}
-			}
+	// Use the established capitalisation of the username
+	z, err := database.User(usr)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	dbOwner := z.Username
 
-			w.WriteHeader(http.StatusConflict)
-			if len(branchRels) > 1 {
-				w.Write([]byte(fmt.Sprintf("You need to delete the releases '%s' before you can delete this branch",
-					conflictedRels)))
-			} else {
-				w.Write([]byte(fmt.Sprintf("You need to delete the release '%s' before you can delete this branch",
-					conflictedRels)))
-			}
-			return
-		}
+	// Check if a branch name was requested
+	branchName, err := com.GetFormBranch(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
 
-	// Make a list of commits in this branch
-	lst := map[string]bool{}
-	c, ok := commitList[branch.Commit]
-	if !ok {
-		log.Printf("Error when creating commit list while deleting branch '%s' of database '%s/%s'",
-			com.SanitiseLogString(branchName), com.SanitiseLogString(dbOwner), com.SanitiseLogString(dbName))
+	// If any of the required values were empty, indicate failure
+	if branchName == "" || dbName == "" || dbOwner == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Make sure the database exists in the system
+	exists, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	lst[c.ID] = true
-	for c.Parent != "" {
-		c, ok = commitList[c.Parent]
-		if !ok {
-			log.Printf("Error when creating commit list while deleting branch '%s' of database '%s/%s'",
-				com.SanitiseLogString(branchName), com.SanitiseLogString(dbOwner), com.SanitiseLogString(dbName))
-			w.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-		lst[c.ID] = true
+	if !exists {
+		log.Printf("%s: Validation failed for database to delete: %s", pageName, err)
+		w.WriteHeader(http.StatusNotFound)
+		return
 	}
 
-	// For each commit, determine if it's only on this branch, and will need to be deleted after the branch
-	for bName, bEntry := range branchList {
-		if bName == branchName {
-			// We only run this comparison from "other branches", not the branch we're deleting
-			continue
+	// Delete the branch, along with the commits only part of it
+	httpStatus, err := com.DeleteBranches(loggedInUser, dbOwner, dbName, []string{branchName})
+	if err != nil {
+		w.WriteHeader(httpStatus)
+		if httpStatus == http.StatusConflict {
+			w.Write([]byte(err.Error()))
 		}
+		return
+	}
 
-		// If there are no commits left to check, we might as well stop further looping
-		if len(lst) == 0 {
-			break
-		}
+	// Update succeeded
+	w.WriteHeader(http.StatusOK)
+}
 
-		c, ok = commitList[bEntry.Commit]
-		if !ok {
-			err = fmt.Errorf("Broken commit history encountered when checking for commits while deleting "+
-				"branch '%s' of database '%s/%s'\n", branchName, dbOwner, dbName)
-			log.Print(err.Error()) // Broken commit history is pretty serious, so we log it for admin investigation
-			return
-		}
-		for delCommit := range lst {
-			if c.ID == delCommit {
-				// The commit is also on another branch, so we *must not* delete the commit afterwards
-				delete(lst, c.ID)
-			}
-		}
-		for c.Parent != "" {
-			c, ok = commitList[c.Parent]
-			if !ok {
-				err = fmt.Errorf("Broken commit history encountered when checking for commits while "+
-					"deleting branch '%s' of database '%s/%s'\n", branchName, dbOwner, dbName)
-				log.Print(err.Error()) // Broken commit history is pretty serious, so we log it for admin investigation
-				return
-			}
-			for delCommit := range lst {
-				if c.ID == delCommit {
-					// The commit is also on another branch, so we *must not* delete the commit afterwards
-					delete(lst, c.ID)
-				}
-			}
-		}
+// This function deletes all of the branches of a database flagged as stale.
+func deleteStaleBranchesHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Extract the required form variables
+	usr, _, dbName, err := com.GetUFD(r, false)
+	if err != nil || usr == "" || dbName == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
 
-	// Delete the branch
-	delete(branchList, branchName)
-	err = database.StoreBranches(dbOwner, dbName, branchList)
+	// Use the established capitalisation of the username
+	z, err := database.User(usr)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	dbOwner := z.Username
 
-	// Delete the left over commits
-	// TODO: We may want to consider clearing any memcache entries for the deleted commits too
-	for cid := range lst {
-		delete(commitList, cid)
+	// Only the database owner can clean up its branches in bulk
+	if !strings.EqualFold(loggedInUser, dbOwner) {
+		w.WriteHeader(http.StatusForbidden)
+		return
 	}
-	err = database.StoreCommits(dbOwner, dbName, commitList)
+	exists, err := database.CheckDBExists(dbOwner, dbName)
 	if err != nil {
-		log.Printf("Error when updating commit list while deleting branch '%s' of database '%s/%s': %s",
-			com.SanitiseLogString(branchName), com.SanitiseLogString(dbOwner), com.SanitiseLogString(dbName), err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
 
-	// Invalidate the memcache data for the database, so the new branch count gets picked up
-	err = com.InvalidateCacheEntry(loggedInUser, dbOwner, dbName, "") // Empty string indicates "for all versions"
+	// Delete the branches still flagged as stale
+	stale, err := com.StaleBranches(dbOwner, dbName)
 	if err != nil {
-		// Something went wrong when invalidating memcached entries for the database
-		log.Printf("Error when invalidating memcache entries: %s", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if len(stale) == 0 {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	var names []string
+	for _, b := range stale {
+		names = append(names, b.Branch)
+	}
+	httpStatus, err := com.DeleteBranches(loggedInUser, dbOwner, dbName, names)
+	if err != nil {
+		w.WriteHeader(httpStatus)
+		if httpStatus == http.StatusConflict {
+			w.Write([]byte(err.Error()))
+		}
 		return
 	}
 
@@ -2212,7 +2549,14 @@ func deleteCommitHandler(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	if branchName == defBranch {
+
+	// Databases encrypted by their owner can't be opened, and never have a default table
+	clientEncrypted, err := database.CheckDBClientEncrypted(dbOwner, dbName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if branchName == defBranch && !clientEncrypted {
 		// * Retrieve the list of tables present in the prior commit *
 		bkt, id, _, err := com.MinioLocation(dbOwner, dbName, prevCommit, loggedInUser)
 		if err != nil {
@@ -2309,7 +2653,8 @@ func deleteCommitHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
-// This function deletes some records in a table of a live database
+// This function deletes some records in a table of a database.  For standard databases the change is stored as a new
+// commit on the branch
 func deleteDataHandler(w http.ResponseWriter, r *http.Request) {
 	// Retrieve user and database
 	dbOwner, dbName, err := com.GetOD(2, r) // 2 = Ignore "/x/deletedata/" at the start of the URL
@@ -2336,16 +2681,12 @@ func deleteDataHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Make sure this is a live database
+	// Check if this is a live database
 	isLive, liveNode, err := database.CheckDBLive(dbOwner, dbName)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	if !isLive {
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
 
 	// Get request data
 	body, err := io.ReadAll(r.Body)
@@ -2360,6 +2701,12 @@ func deleteDataHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Standard databases get a new commit with the records deleted
+	if !isLive {
+		editStandardTable(w, loggedInUser, dbOwner, dbName, data.Branch, data.Table, com.TableEditDelete, data.Data)
+		return
+	}
+
 	// Get column information for table
 	_, pkColumns, err := com.LiveColumns(liveNode, loggedInUser, dbOwner, dbName, data.Table)
 	if err != nil {
@@ -2907,9 +3254,7 @@ func diffCommitListHandler(w http.ResponseWriter, r *http.Request) {
 			errorPage(w, r, http.StatusInternalServerError, err.Error())
 			return
 		}
-		if c.AuthorAvatar != "" {
-			c.AuthorAvatar += "&s=18"
-		}
+		c.AuthorAvatar = database.AvatarURLSized(c.AuthorAvatar, 18)
 
 		// Check for licence changes
 		commitLicSHA := j.Tree.Entries[0].LicenceSHA
@@ -2963,7 +3308,11 @@ func downloadCSVHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify the given database exists and is ok to be downloaded (and get the Minio bucket + id while at it)
-	bucket, id, _, err := com.MinioLocation(dbOwner, dbName, commitID, loggedInUser)
+	bucket, id, err := com.SQLiteLocation(dbOwner, dbName, commitID, loggedInUser)
+	if errors.Is(err, com.ErrClientEncrypted) {
+		errorPage(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		errorPage(w, r, http.StatusInternalServerError, err.Error())
 		return
@@ -3021,6 +3370,52 @@ func downloadCSVHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// downloadDataPackageHandler sends a database commit as a Frictionless Data Package.  This is a zip file holding a
+// datapackage.json descriptor, and a CSV file for each table
+func downloadDataPackageHandler(w http.ResponseWriter, r *http.Request) {
+	pageName := "Download data package"
+
+	// NOTE - The commit ID is optional.  Without it, we just pick the latest commit from the default branch
+	dbOwner, dbName, commitID, err := com.GetODC(2, r) // 2 = Ignore "/x/downloaddatapackage/" at the start of the URL
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Retrieve session data (if any)
+	loggedInUser, _, err := checkLogin(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure the database being requested exists, and isn't overly large.  The same limit as CSV exports is used
+	var tmp database.SQLiteDBinfo
+	err = database.DBDetails(&tmp, loggedInUser, dbOwner, dbName, commitID)
+	if err != nil {
+		errorPage(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	if tmp.Info.DBEntry.Size >= 100000000 {
+		errorPage(w, r, http.StatusBadRequest, "Data package export not allowed for this database due to size restrictions.")
+		return
+	}
+	if tmp.Info.ClientEncrypted {
+		errorPage(w, r, http.StatusBadRequest, com.ErrClientEncrypted.Error())
+		return
+	}
+
+	// Send the data package to the user
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-datapackage.zip"`,
+		url.QueryEscape(strings.TrimSuffix(dbName, ".sqlite"))))
+	w.Header().Set("Content-Type", "application/zip")
+	err = com.WriteDataPackage(w, loggedInUser, dbOwner, dbName, commitID)
+	if err != nil {
+		log.Printf("%s: Error when generating data package: %v", pageName, err)
+		return
+	}
+}
+
 func downloadHandler(w http.ResponseWriter, r *http.Request) {
 	pageName := "Download Handler"
 
@@ -3097,6 +3492,17 @@ func forkDBHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Make sure the database owner hasn't blocked the user from forking their databases
+	blocked, err := database.ForkBlocked(dbOwner, loggedInUser)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if blocked {
+		errorPage(w, r, http.StatusForbidden, "The owner of this database doesn't allow you to fork it")
+		return
+	}
+
 	// Make sure the user doesn't have a database of the same name already
 	// Note the use of "loggedInUser" for the 2nd parameter in this call, unlike using "dbOwner" in the call above
 	exists, err := database.CheckDBPermissions(loggedInUser, loggedInUser, dbName, false)
@@ -3197,7 +3603,39 @@ func getDatabaseName(r *http.Request) (db com.DatabaseName, err error) {
 	return
 }
 
-// This function tries to insert an empty row into a table of a live database
+// editStandardTable changes the records of a table in a standard database, by adding a new commit to the branch.  The
+// ID of the new commit is returned to the caller
+func editStandardTable(w http.ResponseWriter, loggedInUser, dbOwner, dbName, branchName, table string, action com.TableEditAction, data []UpdateDataRequestRow) {
+	if branchName != "" && com.ValidateBranchName(branchName) != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Invalid branch name")
+		return
+	}
+	var rows []com.TableEditRow
+	for _, d := range data {
+		row := com.TableEditRow{
+			Key:    make(map[string]interface{}),
+			Values: make(map[string]interface{}),
+		}
+		for k, v := range d.Key {
+			row.Key[k] = v
+		}
+		for k, v := range d.Values {
+			row.Values[k] = v
+		}
+		rows = append(rows, row)
+	}
+	commitID, httpStatus, err := com.EditTableRows(loggedInUser, dbOwner, dbName, branchName, table, action, rows, "")
+	if err != nil {
+		w.WriteHeader(httpStatus)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	fmt.Fprint(w, commitID)
+}
+
+// This function tries to insert an empty row into a table of a database.  For standard databases the change is stored
+// as a new commit on the branch
 func insertDataHandler(w http.ResponseWriter, r *http.Request) {
 	// Retrieve user, database, and table
 	dbOwner, dbName, table, err := com.GetODT(2, r) // 2 = Ignore "/x/insertdata/" at the start of the URL
@@ -3224,14 +3662,15 @@ func insertDataHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Make sure this is a live database
+	// Standard databases get a new commit with the row inserted
 	isLive, liveNode, err := database.CheckDBLive(dbOwner, dbName)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 	if !isLive {
-		w.WriteHeader(http.StatusBadRequest)
+		editStandardTable(w, loggedInUser, dbOwner, dbName, r.FormValue("branch"), table, com.TableEditInsert,
+			[]UpdateDataRequestRow{{}})
 		return
 	}
 
@@ -3291,6 +3730,18 @@ func logoutHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
+// Wrapper function to gzip compress responses, except for range requests as their ranges refer to the uncompressed bytes.
+func gzipUnlessRange(fn http.HandlerFunc) http.HandlerFunc {
+	compressed := gz.GzipHandler(fn)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			fn(w, r)
+			return
+		}
+		compressed.ServeHTTP(w, r)
+	}
+}
+
 // Wrapper function to log incoming https requests.
 func logReq(fn http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -3298,7 +3749,7 @@ func logReq(fn http.HandlerFunc) http.HandlerFunc {
 		var loggedInUser string
 		sess, err := store.Get(r, "dbhub-user")
 		if err != nil {
-			if err == memcache.ErrCacheMiss {
+			if err == com.ErrCacheMiss {
 				// If the memcache session token is stale (eg memcached has been restarted), delete the session
 				// TODO: This should probably look for the session token in persistent storage (eg PG) instead, so
 				// TODO  restarts of memcached don't nuke everyone's saved sessions
@@ -3373,8 +3824,8 @@ func main() {
 	tmpl = template.Must(template.New("templates").Delims("[[", "]]").ParseGlob(
 		filepath.Join(config.Conf.Web.BaseDir, "webui", "templates", "*.html")))
 
-	// Connect to Minio server
-	err = com.ConnectMinio()
+	// Connect to the storage backend
+	err = com.ConnectBlobStore()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -3392,17 +3843,49 @@ func main() {
 	}
 
 	// Setup session storage
-	store = gsm.NewMemcacheStore(com.MemcacheHandle(), "dbhub_", []byte(config.Conf.Web.SessionStorePassword))
+	store = gsm.NewMemcacherStore(com.SessionCache{}, "dbhub_", []byte(config.Conf.Web.SessionStorePassword))
 	store.Options.Domain, _, _ = strings.Cut(config.Conf.Web.ServerName, ":") // Remove any port if it is specified as part of the server name
 
-	// Start the view count flushing routine in the background
-	go com.FlushViewCount()
+	// Start the view count flushing routine in the background.  It and the other goroutines given the shutdown context
+	// finish off their work when the daemon is shut down
+	com.BackgroundLoops.Add(12)
+	go com.FlushViewCount(com.ShutdownContext, &com.BackgroundLoops)
 
 	// Start the status update processing goroutine in the background (will likely need moving into a separate daemon)
-	go com.StatusUpdatesLoop()
+	go com.StatusUpdatesLoop(com.ShutdownContext, &com.BackgroundLoops)
 
 	// Start the email sending goroutine in the background
-	go com.SendEmails()
+	go com.SendEmails(com.ShutdownContext, &com.BackgroundLoops)
+
+	// Start the email digest goroutine in the background
+	go com.DigestLoop(com.ShutdownContext, &com.BackgroundLoops)
+
+	// Start the trending score goroutine in the background
+	go com.TrendingLoop(com.ShutdownContext, &com.BackgroundLoops)
+
+	// Start the database analytics goroutine in the background
+	go com.AnalyticsLoop(com.ShutdownContext, &com.BackgroundLoops)
+
+	// Start the sitemap generation goroutine in the background
+	go com.SitemapLoop(com.ShutdownContext, &com.BackgroundLoops)
+
+	// Start the CKAN sync goroutine in the background
+	go com.CKANSyncLoop(com.ShutdownContext, &com.BackgroundLoops)
+
+	// Start the stale branch goroutine in the background
+	go com.StaleBranchLoop(com.ShutdownContext, &com.BackgroundLoops)
+
+	// Start the health report goroutine in the background
+	go com.HealthReportLoop(com.ShutdownContext, &com.BackgroundLoops)
+
+	// Start the scheduled report goroutine in the background
+	go com.ScheduledReportLoop(com.ShutdownContext, &com.BackgroundLoops)
+
+	// Start the alert rule goroutine in the background
+	go com.AlertLoop(com.ShutdownContext, &com.BackgroundLoops)
+
+	// Start the goroutine keeping the read only mode up to date in the background
+	go com.MaintenanceLoop()
 
 	// Start background goroutines to handle job queue responses
 	com.ResponseQueue = com.NewResponseQueue()
@@ -3418,17 +3901,22 @@ func main() {
 	// Our pages
 	http.Handle("/", gz.GzipHandler(logReq(mainHandler)))
 	http.Handle("/about", gz.GzipHandler(logReq(aboutPage)))
+	http.Handle("/avatar/", gz.GzipHandler(logReq(avatarHandler)))
 	http.Handle("/branches/", gz.GzipHandler(logReq(branchesPage)))
+	http.Handle("/chart/", gz.GzipHandler(logReq(visChart)))
 	http.Handle("/commits/", gz.GzipHandler(logReq(commitsPage)))
 	http.Handle("/compare/", gz.GzipHandler(logReq(comparePage)))
 	http.Handle("/contributors/", gz.GzipHandler(logReq(contributorsPage)))
 	http.Handle("/createbranch/", gz.GzipHandler(logReq(createBranchPage)))
 	http.Handle("/creatediscuss/", gz.GzipHandler(logReq(createDiscussionPage)))
 	http.Handle("/createtag/", gz.GzipHandler(logReq(createTagPage)))
+	http.Handle("/dashboard/", gz.GzipHandler(logReq(dashboardPage)))
 	http.Handle("/diffs/", gz.GzipHandler(logReq(diffPage)))
 	http.Handle("/discuss/", gz.GzipHandler(logReq(discussPage)))
 	http.Handle("/exec/", gz.GzipHandler(logReq(executePage)))
 	http.Handle("/forks/", gz.GzipHandler(logReq(forksPage)))
+	http.Handle("/health/", gz.GzipHandler(logReq(healthPage)))
+	http.Handle("/insights/", gz.GzipHandler(logReq(insightsPage)))
 	http.Handle("/logout", gz.GzipHandler(logReq(logoutHandler)))
 	http.Handle("/merge/", gz.GzipHandler(logReq(mergePage)))
 	http.Handle("/pref", gz.GzipHandler(logReq(prefHandler)))
@@ -3437,6 +3925,7 @@ func main() {
 	http.Handle("/selectusername", gz.GzipHandler(logReq(selectUserNamePage)))
 	http.Handle("/settings/", gz.GzipHandler(logReq(settingsPage)))
 	http.Handle("/stars/", gz.GzipHandler(logReq(starsPage)))
+	http.Handle("/story/", gz.GzipHandler(logReq(storyPage)))
 	http.Handle("/tags/", gz.GzipHandler(logReq(tagsPage)))
 	http.Handle("/updates/", gz.GzipHandler(logReq(updatesPage)))
 	http.Handle("/upload/", gz.GzipHandler(logReq(uploadPage)))
@@ -3444,39 +3933,76 @@ func main() {
 	http.Handle("/vis/", gz.GzipHandler(logReq(visualisePage)))
 	http.Handle("/visembed/", gz.GzipHandler(logReq(visEmbedPage)))
 	http.Handle("/watchers/", gz.GzipHandler(logReq(watchersPage)))
+	http.Handle("/x/abusereport/", gz.GzipHandler(logReq(abuseReportHandler)))
 	http.Handle("/x/apikeydel", gz.GzipHandler(logReq(apiKeyDelHandler)))
 	http.Handle("/x/apikeygen", gz.GzipHandler(logReq(apiKeyGenHandler)))
+	http.Handle("/x/archivedb/", gz.GzipHandler(logReq(archiveDBHandler)))
+	http.Handle("/x/assigndiscuss/", gz.GzipHandler(logReq(assignDiscussHandler)))
+	http.Handle("/x/avatardelete", gz.GzipHandler(logReq(avatarDeleteHandler)))
+	http.Handle("/x/avatarupload", gz.GzipHandler(logReq(avatarUploadHandler)))
+	http.Handle("/x/blockuser", gz.GzipHandler(logReq(blockUserHandler)))
 	http.Handle("/x/branchnames", gz.GzipHandler(logReq(branchNamesHandler)))
 	http.Handle("/x/callback", gz.GzipHandler(logReq(auth0CallbackHandler)))
 	http.Handle("/x/checkname", gz.GzipHandler(logReq(checkNameHandler)))
 	http.Handle("/x/checkuserexists", gz.GzipHandler(logReq(checkUserExistsHandler)))
+	http.Handle("/x/citation/", gz.GzipHandler(logReq(citationHandler)))
 	http.Handle("/x/createbranch", gz.GzipHandler(logReq(createBranchHandler)))
 	http.Handle("/x/createcomment/", gz.GzipHandler(logReq(createCommentHandler)))
 	http.Handle("/x/creatediscuss", gz.GzipHandler(logReq(createDiscussHandler)))
 	http.Handle("/x/createmerge/", gz.GzipHandler(logReq(createMergeHandler)))
 	http.Handle("/x/createtag", gz.GzipHandler(logReq(createTagHandler)))
+	http.Handle("/x/customdomainadd", gz.GzipHandler(logReq(customDomainAddHandler)))
+	http.Handle("/x/customdomaindel", gz.GzipHandler(logReq(customDomainDelHandler)))
+	http.Handle("/x/customdomainverify", gz.GzipHandler(logReq(customDomainVerifyHandler)))
+	http.Handle("/x/dashboarddel", gz.GzipHandler(logReq(dashboardDelete)))
+	http.Handle("/x/dashboardsave", gz.GzipHandler(logReq(dashboardSave)))
 	http.Handle("/x/deletebranch/", gz.GzipHandler(logReq(deleteBranchHandler)))
 	http.Handle("/x/deletecomment/", gz.GzipHandler(logReq(deleteCommentHandler)))
 	http.Handle("/x/deletecommit/", gz.GzipHandler(logReq(deleteCommitHandler)))
 	http.Handle("/x/deletedata/", gz.GzipHandler(logReq(deleteDataHandler)))
 	http.Handle("/x/deletedatabase/", gz.GzipHandler(logReq(deleteDatabaseHandler)))
 	http.Handle("/x/deleterelease/", gz.GzipHandler(logReq(deleteReleaseHandler)))
+	http.Handle("/x/deletestalebranches/", gz.GzipHandler(logReq(deleteStaleBranchesHandler)))
 	http.Handle("/x/deletetag/", gz.GzipHandler(logReq(deleteTagHandler)))
 	http.Handle("/x/diffcommitlist/", gz.GzipHandler(logReq(diffCommitListHandler)))
-	http.Handle("/x/download/", gz.GzipHandler(logReq(downloadHandler)))
+	http.Handle("/x/discusslabels/", gz.GzipHandler(logReq(discussLabelsHandler)))
+	http.Handle("/x/discussmilestone/", gz.GzipHandler(logReq(discussMilestoneHandler)))
+	http.Handle("/x/download/", gzipUnlessRange(logReq(downloadHandler)))
 	http.Handle("/x/downloadcsv/", gz.GzipHandler(logReq(downloadCSVHandler)))
+	http.Handle("/x/downloaddatapackage/", logReq(downloadDataPackageHandler))
+	http.Handle("/x/emailbounce/", gz.GzipHandler(logReq(emailBounceHandler)))
 	http.Handle("/x/execclearhistory/", gz.GzipHandler(logReq(execClearHistory)))
 	http.Handle("/x/execlivesql/", gz.GzipHandler(logReq(execLiveSQL)))
 	http.Handle("/x/execsql/", gz.GzipHandler(logReq(visExecuteSQL)))
 	http.Handle("/x/forkdb/", gz.GzipHandler(logReq(forkDBHandler)))
 	http.Handle("/x/gencert", gz.GzipHandler(logReq(generateCertHandler)))
 	http.Handle("/x/insertdata/", gz.GzipHandler(logReq(insertDataHandler)))
+	http.Handle("/x/labeldel/", gz.GzipHandler(logReq(labelDeleteHandler)))
+	http.Handle("/x/labelsave/", gz.GzipHandler(logReq(labelSaveHandler)))
 	http.Handle("/x/markdownpreview/", gz.GzipHandler(logReq(markdownPreview)))
 	http.Handle("/x/mergerequest/", gz.GzipHandler(logReq(mergeRequestHandler)))
+	http.Handle("/x/milestonedel/", gz.GzipHandler(logReq(milestoneDeleteHandler)))
+	http.Handle("/x/milestonesave/", gz.GzipHandler(logReq(milestoneSaveHandler)))
+	http.Handle("/x/notificationprefs", gz.GzipHandler(logReq(notificationPrefsHandler)))
+	http.Handle("/x/reaction/", gz.GzipHandler(logReq(reactionHandler)))
+	http.Handle("/x/releasedoi/", gz.GzipHandler(logReq(releaseDOIHandler)))
+	http.Handle("/x/reportoutput/", gz.GzipHandler(logReq(reportOutputHandler)))
+	http.Handle("/x/rowhistory/", gz.GzipHandler(logReq(rowHistoryHandler)))
 	http.Handle("/x/savelimits", gz.GzipHandler(logReq(saveLimitsHandler)))
+	http.Handle("/x/savedqueries/", gz.GzipHandler(logReq(savedQueriesHandler)))
+	http.Handle("/x/savedquerydel/", gz.GzipHandler(logReq(savedQueryDelHandler)))
+	http.Handle("/x/savedqueryexec/", gz.GzipHandler(logReq(savedQueryExecHandler)))
+	http.Handle("/x/savedquerysave/", gz.GzipHandler(logReq(savedQuerySaveHandler)))
+	http.Handle("/x/savedqueryversions/", gz.GzipHandler(logReq(savedQueryVersionsHandler)))
 	http.Handle("/x/savesettings", gz.GzipHandler(logReq(saveSettingsHandler)))
 	http.Handle("/x/setdefaultbranch/", gz.GzipHandler(logReq(setDefaultBranchHandler)))
 	http.Handle("/x/star/", gz.GzipHandler(logReq(starToggleHandler)))
+	http.Handle("/x/statusupdates/", gz.GzipHandler(logReq(statusUpdatesHandler)))
+	http.Handle("/x/statusupdatesdismiss/", gz.GzipHandler(logReq(statusUpdatesDismissHandler)))
+	http.Handle("/x/statusupdatesread/", gz.GzipHandler(logReq(statusUpdatesReadHandler)))
+	http.Handle("/x/storydel/", gz.GzipHandler(logReq(storyDelHandler)))
+	http.Handle("/x/storyexport/", gz.GzipHandler(logReq(storyExportHandler)))
+	http.Handle("/x/storysave/", gz.GzipHandler(logReq(storySaveHandler)))
 	http.Handle("/x/table/", gz.GzipHandler(logReq(tableViewHandler)))
 	http.Handle("/x/tablenames/", gz.GzipHandler(logReq(tableNamesHandler)))
 	http.Handle("/x/updatebranch/", gz.GzipHandler(logReq(updateBranchHandler)))
@@ -3486,10 +4012,16 @@ func main() {
 	http.Handle("/x/updaterelease/", gz.GzipHandler(logReq(updateReleaseHandler)))
 	http.Handle("/x/updatetag/", gz.GzipHandler(logReq(updateTagHandler)))
 	http.Handle("/x/uploaddata/", gz.GzipHandler(logReq(uploadDataHandler)))
+	http.Handle("/x/usetemplate/", gz.GzipHandler(logReq(useTemplateHandler)))
+	http.Handle("/x/verifydb/", gz.GzipHandler(logReq(verifyDBHandler)))
 	http.Handle("/x/visdel/", gz.GzipHandler(logReq(visDel)))
+	http.Handle("/x/visembedtoken/", gz.GzipHandler(logReq(visEmbedToken)))
+	http.Handle("/x/visimage/", gz.GzipHandler(logReq(visImage)))
+	http.Handle("/x/vispublic/", gz.GzipHandler(logReq(visPublic)))
 	http.Handle("/x/vissave/", gz.GzipHandler(logReq(visSave)))
 	http.Handle("/x/visrename/", gz.GzipHandler(logReq(visRename)))
 	http.Handle("/x/watch/", gz.GzipHandler(logReq(watchToggleHandler)))
+	http.Handle("/x/watchmode/", gz.GzipHandler(logReq(watchModeHandler)))
 
 	// Add routes which are only useful during testing
 	if config.Conf.Environment.Environment == "test" {
@@ -3547,9 +4079,9 @@ func main() {
 	http.Handle("/favicon.ico", gz.GzipHandler(logReq(func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, filepath.Join(config.Conf.Web.BaseDir, "webui", "favicon.ico"))
 	})))
-	http.Handle("/robots.txt", gz.GzipHandler(logReq(func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, filepath.Join(config.Conf.Web.BaseDir, "webui", "robots.txt"))
-	})))
+	http.Handle("/robots.txt", gz.GzipHandler(logReq(robotsHandler)))
+	http.Handle("/sitemap.xml", gz.GzipHandler(logReq(sitemapHandler)))
+	http.Handle("/sitemap/", gz.GzipHandler(logReq(sitemapHandler)))
 
 	// Landing page images
 	http.Handle("/images/db4s_screenshot1.png", gz.GzipHandler(logReq(func(w http.ResponseWriter, r *http.Request) {
@@ -3672,6 +4204,7 @@ func main() {
 	srv := &http.Server{
 		Addr:     config.Conf.Web.BindAddress,
 		ErrorLog: com.HttpErrorLog(),
+		Handler:  com.ReadOnlyGuard(customDomainHandler(http.DefaultServeMux), readPaths, writePaths),
 		TLSConfig: &tls.Config{
 			MinVersion: tls.VersionTLS12, // TLS 1.2 is now the lowest acceptable level
 		},
@@ -3831,6 +4364,19 @@ func mergeRequestHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Ensure the status checks required by the database have passed
+	_, blocked, err := com.MergeRequestStatusChecks(dbOwner, dbName, disc[0])
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	if blocked != "" {
+		w.WriteHeader(http.StatusConflict)
+		fmt.Fprint(w, blocked)
+		return
+	}
+
 	// * The required details have been collected, and sanity checks completed, so merge the MR *
 
 	message := fmt.Sprintf("Merge branch '%s' of '%s/%s' into '%s'", srcBranchName, srcOwner, srcDBName, branchName)
@@ -3983,6 +4529,72 @@ func prefHandler(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/"+loggedInUser, http.StatusSeeOther)
 }
 
+// Mints a DOI for a release of a database.
+func releaseDOIHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Extract the required form variables
+	usr, _, dbName, err := com.GetUFD(r, false)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Use the established capitalisation of the username
+	z, err := database.User(usr)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	dbOwner := z.Username
+
+	// Ensure a release name was supplied in the tag parameter
+	relName, err := com.GetFormTag(r)
+	if err != nil || relName == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Make sure the user has write access to the database
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	doi, err := com.MintReleaseDOI(loggedInUser, dbOwner, dbName, relName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("DOI '%s' minted for release '%s' of '%s/%s' by user '%s'", doi, com.SanitiseLogString(relName),
+		dbOwner, dbName, loggedInUser)
+
+	// Return the new DOI
+	data, err := json.Marshal(map[string]string{"doi": doi})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
 // Returns an error if the user is not logged in according to the page meta data.
 // This requires the meta data structure to be filled in before
 func requireLogin(pageMeta PageMetaInfo) (errCode int, err error) {
@@ -3993,6 +4605,18 @@ func requireLogin(pageMeta PageMetaInfo) (errCode int, err error) {
 	return
 }
 
+// Returns the robots.txt file, pointing search engines at the sitemap.
+func robotsHandler(w http.ResponseWriter, r *http.Request) {
+	data, err := os.ReadFile(filepath.Join(config.Conf.Web.BaseDir, "webui", "robots.txt"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(data)
+	fmt.Fprintf(w, "\nSitemap: https://%s/sitemap.xml\n", config.Conf.Web.ServerName)
+}
+
 // Handles saving of new usage limits for a user
 func saveLimitsHandler(w http.ResponseWriter, r *http.Request) {
 	// Retrieve session data (if any)
@@ -4255,32 +4879,41 @@ func saveSettingsHandler(w http.ResponseWriter, r *http.Request) {
 		// Retrieve the SHA256 for the database file
 		head, ok := branchList[defBranch]
 		if !ok {
-			errorPage(w, r, http.StatusInternalServerError, "Requested branch name not found")
-			return
-		}
-		bkt, id, _, err := com.MinioLocation(dbOwner, dbName, head.Commit, loggedInUser)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			errorPage(w, r, http.StatusInternalServerError, "Requested branch name not found")
 			return
 		}
 
-		// Get a handle from Minio for the database object
-		sdb, err := com.OpenSQLiteDatabase(bkt, id)
+		// Databases encrypted by their owner can't be opened, so have no tables to choose a default from
+		clientEncrypted, err := database.CheckDBClientEncrypted(dbOwner, dbName)
 		if err != nil {
 			errorPage(w, r, http.StatusInternalServerError, err.Error())
 			return
 		}
+		if !clientEncrypted {
+			bkt, id, _, err := com.MinioLocation(dbOwner, dbName, head.Commit, loggedInUser)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
 
-		// Automatically close the SQLite database when this function finishes
-		defer sdb.Close()
+			// Get a handle from Minio for the database object
+			sdb, err := com.OpenSQLiteDatabase(bkt, id)
+			if err != nil {
+				errorPage(w, r, http.StatusInternalServerError, err.Error())
+				return
+			}
 
-		// Retrieve the list of tables in the database
-		// TODO: Update this to handle having a default table "per branch".  Even though it would mean looping here, it
-		// TODO  seems like the only way to be flexible and accurate enough for our purposes
-		tables, err = com.TablesAndViews(sdb, fmt.Sprintf("%s/%s", dbOwner, dbName))
-		if err != nil {
-			errorPage(w, r, http.StatusInternalServerError, err.Error())
-			return
+			// Automatically close the SQLite database when this function finishes
+			defer sdb.Close()
+
+			// Retrieve the list of tables in the database
+			// TODO: Update this to handle having a default table "per branch".  Even though it would mean looping here, it
+			// TODO  seems like the only way to be flexible and accurate enough for our purposes
+			tables, err = com.TablesAndViews(sdb, fmt.Sprintf("%s/%s", dbOwner, dbName))
+			if err != nil {
+				errorPage(w, r, http.StatusInternalServerError, err.Error())
+				return
+			}
 		}
 
 		// Grab the complete commit list for the database
@@ -4331,40 +4964,12 @@ func saveSettingsHandler(w http.ResponseWriter, r *http.Request) {
 					return
 				}
 
-				// Create a new dbTree entry for the database file
-				var e database.DBTreeEntry
-				e.EntryType = database.DATABASE
-				e.LastModified = dbEntry.LastModified.UTC()
-				e.LicenceSHA = newLicSHA
-				e.Name = dbEntry.Name
-				e.Sha256 = dbEntry.Sha256
-				e.Size = dbEntry.Size
-
-				// Create a new dbTree structure for the new database entry
-				var t database.DBTree
-				t.Entries = append(t.Entries, e)
-				t.ID = com.CreateDBTreeID(t.Entries)
-
-				// Retrieve the user details
-				usr, err := database.User(loggedInUser)
+				// Create the commit changing the licence
+				newCom, err := com.NewLicenceCommit(loggedInUser, c, bEntry.Commit, oldLic, newLic, newLicSHA)
 				if err != nil {
-					errorPage(w, r, http.StatusInternalServerError, "An error occurred when retrieving user details")
-				}
-
-				// Create a new commit for the new tree
-				newCom := database.CommitEntry{
-					CommitterName:  c.AuthorName,
-					CommitterEmail: c.AuthorEmail,
-					Message:        fmt.Sprintf("Licence changed from '%s' to '%s'.", oldLic, newLic),
-					Parent:         bEntry.Commit,
-					Timestamp:      time.Now().UTC(),
-					Tree:           t,
+					errorPage(w, r, http.StatusInternalServerError, err.Error())
+					return
 				}
-				newCom.AuthorName = usr.DisplayName
-				newCom.AuthorEmail = usr.Email
-
-				// Calculate the new commit ID, which incorporates the updated tree ID (and thus the new licence sha256)
-				newCom.ID = com.CreateCommitID(newCom)
 
 				// Add the new commit to the commit list
 				commitList[newCom.ID] = newCom
@@ -4440,6 +5045,16 @@ func saveSettingsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Store the template status.  Live databases and those encrypted by their owner can't be templates, which the
+	// database layer refuses anyway
+	if !isLive {
+		_, err = database.SetDBTemplate(dbOwner, dbName, r.PostFormValue("template") == "true")
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
 	// If the database doesn't have a 1-liner description, don't save the placeholder text as one
 	if oneLineDesc == "No description" {
 		oneLineDesc = ""
@@ -4450,6 +5065,30 @@ func saveSettingsHandler(w http.ResponseWriter, r *http.Request) {
 		fullDesc = ""
 	}
 
+	// Changed descriptions flagged as spam are held for moderation, with the current ones kept until they're reviewed
+	curOneLineDesc, curFullDesc, err := database.DBDescriptions(dbOwner, dbName)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if oneLineDesc != curOneLineDesc || fullDesc != curFullDesc {
+		held, err := com.HoldIfSpam(r, database.HeldContent{
+			Body:        fullDesc,
+			DBName:      dbName,
+			DBOwner:     dbOwner,
+			Kind:        "description",
+			OneLineDesc: oneLineDesc,
+			User:        loggedInUser,
+		})
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if held {
+			oneLineDesc, fullDesc = curOneLineDesc, curFullDesc
+		}
+	}
+
 	// Save settings
 	err = com.SaveDBSettings(dbOwner, dbName, oneLineDesc, fullDesc, defTable, public, sourceURL, defBranch)
 	if err != nil {
@@ -4565,6 +5204,33 @@ func setDefaultBranchHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// Returns the sitemap of the public databases.  "/sitemap.xml" is the index of the sitemap pages, which are served from
+// "/sitemap/<page number>.xml".
+func sitemapHandler(w http.ResponseWriter, r *http.Request) {
+	var data []byte
+	var ok bool
+	if r.URL.Path == "/sitemap.xml" {
+		data, ok = com.Sitemap()
+		if !ok {
+			// The sitemap hasn't been generated yet
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+	} else {
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/sitemap/"), ".xml"))
+		if err == nil {
+			data, ok = com.SitemapPage(n)
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write(data)
+}
+
 // Handles JSON requests from the front end to toggle a database's star.
 func starToggleHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract the user and database name
@@ -4687,7 +5353,12 @@ func tableNamesHandler(w http.ResponseWriter, r *http.Request) {
 	// * Retrieve the table names for the given commit *
 
 	// Retrieve the Minio bucket and id for the commit
-	bkt, id, _, err := com.MinioLocation(dbOwner, dbName, commitID, loggedInUser)
+	bkt, id, err := com.SQLiteLocation(dbOwner, dbName, commitID, loggedInUser)
+	if errors.Is(err, com.ErrClientEncrypted) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err.Error())
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -4872,11 +5543,15 @@ func tableViewHandler(w http.ResponseWriter, r *http.Request) {
 	if !isLive {
 		// Standard database, so we read the data locally
 
-		// If a cached version of the page data exists, use it
+		// If a cached version of the page data exists, use it.  Otherwise other requests for the same data wait while
+		// this one generates it
 		var ok bool
+		var unlock func()
 		dataCacheKey := com.TableRowsCacheKey(fmt.Sprintf("tablejson/%s/%s/%d", sortCol, sortDir, rowOffset),
 			loggedInUser, dbOwner, dbName, commitID, requestedTable, maxRows)
-		ok, err = com.GetCachedData(dataCacheKey, &dataRows)
+		cacheTags := com.DatabaseCacheTags(dbOwner, dbName, commitID)
+		ok, unlock, err = com.GetCachedDataOrLock(dataCacheKey, &dataRows, cacheTags...)
+		defer unlock()
 		if err != nil {
 			log.Printf("%s: Error retrieving table data from cache: %v", pageName, err)
 			ok = false // Fall through to retrieving the data from the database
@@ -4886,7 +5561,12 @@ func tableViewHandler(w http.ResponseWriter, r *http.Request) {
 
 			// Get the Minio details
 			var bucket, id string
-			bucket, id, _, err = com.MinioLocation(dbOwner, dbName, commitID, loggedInUser)
+			bucket, id, err = com.SQLiteLocation(dbOwner, dbName, commitID, loggedInUser)
+			if errors.Is(err, com.ErrClientEncrypted) {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, err.Error())
+				return
+			}
 			if err != nil {
 				w.WriteHeader(http.StatusInternalServerError)
 				return
@@ -5011,7 +5691,7 @@ func tableViewHandler(w http.ResponseWriter, r *http.Request) {
 			}
 
 			// Cache the data in memcache
-			err = com.CacheData(dataCacheKey, dataRows, config.Conf.Memcache.DefaultCacheTime)
+			err = com.CacheData(dataCacheKey, dataRows, config.Conf.Memcache.DefaultCacheTime, cacheTags...)
 			if err != nil {
 				log.Printf("%s: Error when caching table data for '%s/%s': %v", pageName, com.SanitiseLogString(dbOwner),
 					com.SanitiseLogString(dbName), err)
@@ -5035,6 +5715,12 @@ func tableViewHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Add previews of images and geometries if they were asked for.  These are made after the data is cached, so the
+	// cached rows stay small
+	if r.FormValue("previews") == "true" {
+		com.AddCellPreviews(&dataRows)
+	}
+
 	// Format the output.  Use json.MarshalIndent() for nicer looking output
 	jsonResponse, err := json.MarshalIndent(dataRows, "", " ")
 	if err != nil {
@@ -5182,6 +5868,15 @@ func updateBranchHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The schema change policy of the branch moves with it
+	if newName != branchName {
+		err = database.BranchSchemaPolicyRename(dbOwner, dbName, branchName, newName)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
 	// Invalidate the memcache data for the database, so the new branch name gets picked up
 	err = com.InvalidateCacheEntry(loggedInUser, dbOwner, dbName, "") // Empty string indicates "for all versions"
 	if err != nil {
@@ -5332,16 +6027,12 @@ func updateDataHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Make sure this is a live database
+	// Check if this is a live database
 	isLive, liveNode, err := database.CheckDBLive(dbOwner, dbName)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	if !isLive {
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
 
 	// Get request data
 	body, err := io.ReadAll(r.Body)
@@ -5356,6 +6047,12 @@ func updateDataHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Standard databases get a new commit with the records changed
+	if !isLive {
+		editStandardTable(w, loggedInUser, dbOwner, dbName, data.Branch, data.Table, com.TableEditUpdate, data.Data)
+		return
+	}
+
 	// Get column information for table
 	columns, pkColumns, err := com.LiveColumns(liveNode, loggedInUser, dbOwner, dbName, data.Table)
 	if err != nil {
@@ -5633,6 +6330,7 @@ func updateReleaseHandler(w http.ResponseWriter, r *http.Request) {
 		Commit:        oldInfo.Commit,
 		Date:          oldInfo.Date,
 		Description:   newDesc,
+		DOI:           oldInfo.DOI,
 		ReleaserEmail: oldInfo.ReleaserEmail,
 		ReleaserName:  oldInfo.ReleaserName,
 		Size:          oldInfo.Size,
@@ -5845,6 +6543,22 @@ func uploadDataHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Grab and validate the supplied "encrypted" form field
+	clientEncrypted, err := com.GetFormEncrypted(r)
+	if err != nil {
+		log.Printf("%s: %v", pageName, err)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, fmt.Sprintf("Encrypted value '%v' incorrect", html.EscapeString(r.PostFormValue("encrypted"))))
+		return
+	}
+
+	// Live databases are queried by the server, so they can't be encrypted with a key it doesn't have
+	if isLiveDB && clientEncrypted {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Live databases can't be encrypted before uploading")
+		return
+	}
+
 	// Validate the licence value
 	licenceName, err := com.GetFormLicence(r)
 	if err != nil {
@@ -5984,7 +6698,14 @@ func uploadDataHandler(w http.ResponseWriter, r *http.Request) {
 		// Sanity check the uploaded database, and if ok then add it to the system
 		numBytes, _, sha, err := com.AddDatabase(loggedInUser, dbOwner, dbName, createBranch, branchName,
 			commitID, accessType, licenceName, commitMsg, sourceURL, tempFile, time.Now(), time.Time{},
-			"", "", "", "", nil, "")
+			"", "", "", "", nil, "", com.AddDatabaseOptions{ClientEncrypted: clientEncrypted})
+		var validationErr com.ValidationFailedError
+		var policyErr com.SchemaPolicyError
+		if errors.As(err, &validationErr) || errors.As(err, &policyErr) {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, err.Error())
+			return
+		}
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			fmt.Fprint(w, err.Error())
@@ -6008,7 +6729,7 @@ func uploadDataHandler(w http.ResponseWriter, r *http.Request) {
 	// ** Live databases **
 
 	// Write the incoming database to a temporary file on disk, and sanity check it
-	numBytes, tempDB, _, _, err := com.WriteDBtoDisk(loggedInUser, dbOwner, dbName, tempFile)
+	numBytes, tempDB, _, _, err := com.WriteDBtoDisk(loggedInUser, dbOwner, dbName, tempFile, false)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprint(w, err.Error())
@@ -6066,6 +6787,198 @@ func uploadDataHandler(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// Handles requests from the front end to change the type of activity a user is watching a database for.  If the user
+// isn't already watching the database, they start watching it.
+// useTemplateHandler creates a new database for the logged in user from a template database
+func useTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Extract the required form variables
+	usr, _, dbName, err := com.GetUFD(r, false)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Bad request")
+		return
+	}
+	newName := r.PostFormValue("newname")
+	err = com.ValidateDB(newName)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Invalid database name")
+		return
+	}
+	withData := r.PostFormValue("data") == "true"
+
+	// Use the established capitalisation of the username
+	z, err := database.User(usr)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	dbOwner := z.Username
+
+	// Create the new database.  It starts out private, the same as a newly uploaded one
+	_, httpStatus, err := com.CreateFromTemplate(loggedInUser, dbOwner, dbName, newName, withData, database.SetToPrivate)
+	if err != nil {
+		w.WriteHeader(httpStatus)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	log.Printf("Database '%s/%s' created from the '%s/%s' template", loggedInUser, com.SanitiseLogString(newName),
+		dbOwner, com.SanitiseLogString(dbName))
+
+	// Return the URL of the new database, so the page can be redirected to it
+	fmt.Fprint(w, "/"+loggedInUser+"/"+url.PathEscape(newName))
+}
+
+// verifyDBHandler lets instance admins mark a database as verified, or remove the verification again
+func verifyDBHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Check if the current user is an admin user
+	auhenticatedUser, err := database.User(loggedInUser)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !auhenticatedUser.IsAdmin {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Extract the required form variables
+	usr, _, dbName, err := com.GetUFD(r, false)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Bad request")
+		return
+	}
+	verified, err := strconv.ParseBool(r.PostFormValue("verified"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Invalid value for verified")
+		return
+	}
+
+	// Use the established capitalisation of the username
+	z, err := database.User(usr)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	dbOwner := z.Username
+
+	// Update the verified status of the database
+	exists, err := database.SetDBVerified(loggedInUser, dbOwner, dbName, verified)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Database '%s/%s' doesn't exist", dbOwner, dbName)
+		return
+	}
+
+	// Return the new status
+	fmt.Fprint(w, verified)
+}
+
+func watchModeHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract the user and database name
+	dbOwner, dbName, err := com.GetOD(2, r) // 2 = Ignore "/x/watchmode/" at the start of the URL
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Retrieve session data (if any)
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		// No logged in username, so nothing to update
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Validate the requested watch mode
+	mode := database.WatchMode(r.PostFormValue("mode"))
+	if !mode.Valid() {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Unknown watch mode")
+		return
+	}
+
+	// Make sure the database exists and the user has access to it
+	exists, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, false)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Database '%s/%s' doesn't exist", dbOwner, dbName)
+		return
+	}
+
+	// Change the watch mode
+	err = database.SetDBWatchMode(loggedInUser, dbOwner, dbName, mode)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+
+	// Invalidate the old memcached entry for the database
+	err = com.InvalidateCacheEntry(loggedInUser, dbOwner, dbName, "") // Empty string indicates "for all versions"
+	if err != nil {
+		// Something went wrong when invalidating memcached entries for the database
+		log.Printf("Error when invalidating memcache entries: %s", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+
+	// Return the updated watchers count
+	numWatchers, err := database.DBWatchers(dbOwner, dbName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, numWatchers)
+}
+
 // Handles JSON requests from the front end to toggle watching of a database.
 func watchToggleHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract the user and database name
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// abuseReportHandler reports a database, or a comment in one of its discussions, to the instance admins
+func abuseReportHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Extract the required form variables
+	usr, _, dbName, err := com.GetUFD(r, false)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Bad request")
+		return
+	}
+
+	// Use the established capitalisation of the username
+	z, err := database.User(usr)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	dbOwner := z.Username
+
+	// Validate the report details
+	var comID int64
+	if c := r.PostFormValue("comid"); c != "" {
+		comID, err = strconv.ParseInt(c, 10, 64)
+		if err != nil || comID < 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "Invalid comment id")
+			return
+		}
+	}
+	reason := r.PostFormValue("reason")
+	if !com.ValidAbuseReason(reason) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Unknown reason")
+		return
+	}
+	details, err := com.CheckUnicode(r.PostFormValue("details"), false)
+	if err != nil || utf8.RuneCountInString(details) > com.AbuseReportMaxDetails {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Invalid details.  They can be up to %d characters long", com.AbuseReportMaxDetails)
+		return
+	}
+
+	// Anyone who can see the database can report it
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, false)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	if !allowed {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Database '%s/%s' doesn't exist", dbOwner, dbName)
+		return
+	}
+
+	// Record the report
+	_, exists, err := database.AbuseReportAdd(loggedInUser, dbOwner, dbName, comID, reason, details)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "Comment not found")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// blockUserHandler blocks or unblocks a user for the logged in user
+func blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Validate the form variables
+	user := r.PostFormValue("user")
+	err = com.ValidateUser(user)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Invalid user name")
+		return
+	}
+	if strings.ToLower(user) == strings.ToLower(loggedInUser) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "You can't block yourself")
+		return
+	}
+	block := r.PostFormValue("block") != "false"
+	preventForks := r.PostFormValue("preventforks") == "true"
+
+	var exists bool
+	if block {
+		exists, err = database.BlockUser(loggedInUser, user, preventForks)
+	} else {
+		exists, err = database.UnblockUser(loggedInUser, user)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "User not found")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
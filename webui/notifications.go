@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// emailBounceHandler receives bounce notifications from the email backend.  The webhook URL is
+// "/x/emailbounce/<secret>", with the secret from the configuration file
+func emailBounceHandler(w http.ResponseWriter, r *http.Request) {
+	// Check the secret in the URL, so only the email backend can send us bounce notifications
+	secret := strings.TrimPrefix(r.URL.Path, "/x/emailbounce/")
+	if config.Conf.Event.BounceWebhookSecret == "" ||
+		subtle.ConstantTimeCompare([]byte(secret), []byte(config.Conf.Event.BounceWebhookSecret)) != 1 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// Make sure the email backend supports bounce notifications
+	sender, err := com.NewEmailSender()
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, err)
+		return
+	}
+	parser, ok := sender.(com.EmailBounceParser)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		fmt.Fprintf(w, "The '%s' email backend doesn't support bounce notifications", config.Conf.Event.EmailBackend)
+		return
+	}
+
+	// Process the bounce notification
+	bounces, err := parser.ParseBounces(r)
+	if err != nil {
+		log.Printf("Error when parsing email bounce notification: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	com.HandleEmailBounces(bounces)
+	w.WriteHeader(http.StatusOK)
+}
+
+// notificationPrefsHandler saves the notification settings of the logged in user
+func notificationPrefsHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, "You need to be logged in")
+		return
+	}
+
+	// Grab the incoming settings
+	bodyData, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err)
+		return
+	}
+	prefs, err := database.ParseNotificationPrefs(bodyData)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err)
+		return
+	}
+
+	// Validate the settings
+	if prefs.Digest != database.DigestNone && prefs.Digest != database.DigestDaily && prefs.Digest != database.DigestWeekly {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Invalid digest mode")
+		return
+	}
+
+	// Only keep the per database settings for databases the user is watching
+	watching, err := database.UserWatchingDBs(loggedInUser)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	dbSettings := make(map[string]bool)
+	for _, db := range watching {
+		dbKey := fmt.Sprintf("%s/%s", db.Owner, db.DBName)
+		if enabled, ok := prefs.Databases[dbKey]; ok {
+			dbSettings[dbKey] = enabled
+		}
+	}
+	prefs.Databases = dbSettings
+
+	// Save the settings
+	err = database.SetNotificationPreferences(loggedInUser, prefs)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+
+	// Return the saved settings
+	jsonResponse, err := json.Marshal(prefs)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "%s", jsonResponse)
+}
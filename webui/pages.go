@@ -16,6 +16,9 @@ import (
 	gfm "github.com/sqlitebrowser/github_flavored_markdown"
 )
 
+// The number of trending databases shown on the front page
+const frontPageTrendingCount = 10
+
 // Renders the "About Us" page.
 func aboutPage(w http.ResponseWriter, r *http.Request) {
 	var pageData struct {
@@ -42,9 +45,10 @@ func aboutPage(w http.ResponseWriter, r *http.Request) {
 func branchesPage(w http.ResponseWriter, r *http.Request) {
 	// Structure to hold page data
 	var pageData struct {
-		Branches map[string]database.BranchEntry
-		DB       database.SQLiteDBinfo
-		PageMeta PageMetaInfo
+		Branches      map[string]database.BranchEntry
+		DB            database.SQLiteDBinfo
+		PageMeta      PageMetaInfo
+		StaleBranches []database.StaleBranch
 	}
 	pageData.PageMeta.Title = "Branch list"
 	pageData.PageMeta.PageSection = "db_data"
@@ -75,6 +79,13 @@ func branchesPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Retrieve the branches flagged as stale, so they can be cleaned up
+	pageData.StaleBranches, err = com.StaleBranches(dbName.Owner, dbName.Database)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	// Render the page
 	t := tmpl.Lookup("branchesPage")
 	err = t.Execute(w, pageData)
@@ -218,9 +229,7 @@ func commitsPage(w http.ResponseWriter, r *http.Request) {
 			if err != nil {
 				return err
 			}
-			if avatarURL != "" {
-				avatarURL += "&s=30"
-			}
+			avatarURL = database.AvatarURLSized(avatarURL, 30)
 
 			// Create a history entry
 			newEntry := HistEntry{
@@ -408,9 +417,7 @@ func comparePage(w http.ResponseWriter, r *http.Request) {
 				errorPage(w, r, http.StatusInternalServerError, err.Error())
 				return
 			}
-			if c.AuthorAvatar != "" {
-				c.AuthorAvatar += "&s=18"
-			}
+			c.AuthorAvatar = database.AvatarURLSized(c.AuthorAvatar, 18)
 
 			// Check for licence changes
 			commitLicSHA := j.Tree.Entries[0].LicenceSHA
@@ -491,9 +498,7 @@ func contributorsPage(w http.ResponseWriter, r *http.Request) {
 			errorPage(w, r, http.StatusInternalServerError, err.Error())
 			return
 		}
-		if avatarURL != "" {
-			avatarURL += "&s=30"
-		}
+		avatarURL = database.AvatarURLSized(avatarURL, 30)
 
 		// This ok check is just a way to decide whether to increment the NumCommits counter
 		if _, ok := pageData.Contributors[j.AuthorName]; !ok {
@@ -723,6 +728,13 @@ func databasePage(w http.ResponseWriter, r *http.Request, dbOwner string, dbName
 		return
 	}
 
+	// Point search engines at the custom domain of the owner, when they have one
+	pageData.PageMeta.CanonicalURL, err = com.CustomDomainURL(dbOwner, dbName)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	// Figure out the correct commit ID from the provided tag, branch, release name or commit id
 	// For live databases these do not exist yet, so this step is skipped.
 	var commitID string
@@ -860,17 +872,26 @@ func databasePage(w http.ResponseWriter, r *http.Request, dbOwner string, dbName
 		}
 		pageData.DB.Info.Commits = branchHeads[pageData.DB.Info.Branch].CommitCount
 
-		// Query the database
-		sdb, err := com.OpenSQLiteDatabaseDefensive(w, r, dbOwner, dbName, commitID, pageData.PageMeta.LoggedInUser)
-		if err != nil {
-			errorPage(w, r, http.StatusInternalServerError, err.Error())
-			return
+		// Changes to standard databases are added as commits on the head of the branch, so the data can only be edited
+		// when the head commit is shown
+		if pageData.WriteEnabled {
+			pageData.WriteEnabled = !pageData.DB.Info.ClientEncrypted && !pageData.DB.Info.Archived &&
+				branchHeads[pageData.DB.Info.Branch].Commit == pageData.DB.Info.CommitID
 		}
-		defer sdb.Close()
-		pageData.DB.Info.Tables, err = com.TablesAndViews(sdb, dbName)
-		if err != nil {
-			errorPage(w, r, http.StatusInternalServerError, err.Error())
-			return
+
+		// Query the database, unless it was encrypted by its owner in which case it can't be opened
+		if !pageData.DB.Info.ClientEncrypted {
+			sdb, err := com.OpenSQLiteDatabaseDefensive(w, r, dbOwner, dbName, commitID, pageData.PageMeta.LoggedInUser)
+			if err != nil {
+				errorPage(w, r, http.StatusInternalServerError, err.Error())
+				return
+			}
+			defer sdb.Close()
+			pageData.DB.Info.Tables, err = com.TablesAndViews(sdb, dbName)
+			if err != nil {
+				errorPage(w, r, http.StatusInternalServerError, err.Error())
+				return
+			}
 		}
 	} else {
 		pageData.DB.Info.Tables, err = com.LiveTablesAndViews(pageData.DB.Info.LiveNode, pageData.PageMeta.LoggedInUser, dbOwner, dbName)
@@ -897,6 +918,11 @@ func databasePage(w http.ResponseWriter, r *http.Request, dbOwner string, dbName
 		pageData.DB.MaxRows = database.DefaultNumDisplayRows
 	}
 
+	// Describe public databases for search engines, using the markdown source of the full description
+	if pageData.DB.Info.Public {
+		pageData.PageMeta.DatasetJSONLD = com.DatasetJSONLD(pageData.DB)
+	}
+
 	// Render the full description as markdown
 	pageData.DB.Info.FullDesc = string(gfm.Markdown([]byte(pageData.DB.Info.FullDesc)))
 
@@ -1016,6 +1042,8 @@ func discussPage(w http.ResponseWriter, r *http.Request) {
 		CommentList    []database.DiscussionCommentEntry
 		DB             database.SQLiteDBinfo
 		DiscussionList []database.DiscussionEntry
+		Labels         []database.Label
+		Milestones     []database.Milestone
 		SelectedID     int
 		PageMeta       PageMetaInfo
 	}
@@ -1060,6 +1088,18 @@ func discussPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Retrieve the labels and milestones available for this database
+	pageData.Labels, err = database.Labels(dbName.Owner, dbName.Database)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	pageData.Milestones, err = database.Milestones(dbName.Owner, dbName.Database)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	// Fill out the metadata
 	pageData.PageMeta.Title = "Discussion List"
 
@@ -1084,6 +1124,16 @@ func discussPage(w http.ResponseWriter, r *http.Request) {
 			errorPage(w, r, http.StatusInternalServerError, err.Error())
 			return
 		}
+		pageData.CommentList, err = com.HideBlockedComments(pageData.PageMeta.LoggedInUser, pageData.CommentList)
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		err = com.AddCommentReactions(pageData.PageMeta.LoggedInUser, dbName.Owner, dbName.Database, pageData.SelectedID, pageData.CommentList)
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
 
 		// If this discussion matches one of the user's status updates, remove the status update from the list
 		if pageData.PageMeta.LoggedInUser != "" {
@@ -1143,6 +1193,7 @@ func forksPage(w http.ResponseWriter, r *http.Request) {
 	var pageData struct {
 		DB       database.SQLiteDBinfo
 		Forks    []database.ForkEntry
+		Lineage  database.LineageGraph
 		PageMeta PageMetaInfo
 	}
 	pageData.PageMeta.Title = "Forks"
@@ -1174,6 +1225,13 @@ func forksPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Retrieve the databases this one was derived from, and the ones derived from it
+	pageData.Lineage, err = database.LineageGraphFor(pageData.PageMeta.LoggedInUser, dbName.Owner, dbName.Database)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	// Render the page
 	t := tmpl.Lookup("forksPage")
 	err = t.Execute(w, pageData)
@@ -1187,7 +1245,7 @@ func frontPage(w http.ResponseWriter, r *http.Request) {
 	// Structure to hold page data
 	var pageData struct {
 		PageMeta PageMetaInfo
-		Stats    map[ActivityRange]database.ActivityStats
+		Trending []database.TrendingEntry
 	}
 
 	// Get all meta information
@@ -1197,14 +1255,12 @@ func frontPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Retrieve the database activity stats
-	pageData.Stats = make(map[ActivityRange]database.ActivityStats)
-	statsAll, err := database.GetActivityStats()
+	// Retrieve the databases which are trending at the moment
+	pageData.Trending, _, err = database.Trending(0, frontPageTrendingCount)
 	if err != nil {
 		errorPage(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
-	pageData.Stats[ALL_TIME] = statsAll
 
 	// Set other relevant metadata
 	pageData.PageMeta.Title = `SQLite storage "in the cloud"`
@@ -1217,6 +1273,175 @@ func frontPage(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Renders the "Insights" page, showing the daily traffic of a database to its owner
+func healthPage(w http.ResponseWriter, r *http.Request) {
+	var pageData struct {
+		DB       database.SQLiteDBinfo
+		PageMeta PageMetaInfo
+		Report   database.HealthReport
+	}
+	pageData.PageMeta.Title = "Health"
+	pageData.PageMeta.PageSection = "db_health"
+
+	// Get all meta information
+	errCode, err := collectPageMetaInfo(w, r, &pageData.PageMeta)
+	if err != nil {
+		errorPage(w, r, errCode, err.Error())
+		return
+	}
+	dbName, err := getDatabaseName(r)
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Retrieve the (optional) commit ID.  If none was given, the head commit of the default branch is used
+	commitID, err := com.GetFormCommit(r)
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if commitID != "" {
+		exists, err := database.CommitExists(dbName.Owner, dbName.Database, commitID)
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, "Checking if the commit exists failed")
+			return
+		}
+		if !exists {
+			errorPage(w, r, http.StatusNotFound, "Unknown commit for this database")
+			return
+		}
+	}
+
+	// Retrieve the database details.  This also checks the user has access to the database
+	err = database.DBDetails(&pageData.DB, pageData.PageMeta.LoggedInUser, dbName.Owner, dbName.Database, commitID)
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Health reports are only for the commits of standard databases
+	if pageData.DB.Info.IsLive {
+		errorPage(w, r, http.StatusBadRequest, "Health reports are only available for standard databases")
+		return
+	}
+
+	// Retrieve the health report, asking for it to be worked out if that hasn't happened yet
+	report, err := database.HealthReportFor(dbName.Owner, dbName.Database, pageData.DB.Info.CommitID)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, "Retrieving the health report failed")
+		return
+	}
+	if report == nil {
+		err = database.HealthReportRequest(dbName.Owner, dbName.Database, pageData.DB.Info.CommitID)
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, "Requesting the health report failed")
+			return
+		}
+		report = &database.HealthReport{Commit: pageData.DB.Info.CommitID, State: "pending"}
+	}
+	pageData.Report = *report
+
+	// Render the page
+	t := tmpl.Lookup("healthPage")
+	err = t.Execute(w, pageData)
+	if err != nil {
+		log.Printf("Error: %s", err)
+	}
+}
+
+func insightsPage(w http.ResponseWriter, r *http.Request) {
+	var pageData struct {
+		Analytics   []database.AnalyticsDay
+		DB          database.SQLiteDBinfo
+		Downloads   map[int]database.DownloadBreakdown
+		PageMeta    PageMetaInfo
+		SizeAlert   database.SizeAlert
+		SizeHistory map[string][]com.SizeEntry
+	}
+	pageData.PageMeta.Title = "Insights"
+	pageData.PageMeta.PageSection = "db_insights"
+
+	// Get all meta information
+	errCode, err := collectPageMetaInfo(w, r, &pageData.PageMeta)
+	if err != nil {
+		errorPage(w, r, errCode, err.Error())
+		return
+	}
+	dbName, err := getDatabaseName(r)
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Require login
+	errCode, err = requireLogin(pageData.PageMeta)
+	if err != nil {
+		errorPage(w, r, errCode, err.Error())
+		return
+	}
+
+	// Only the owner of a database can see its analytics
+	if strings.ToLower(dbName.Owner) != strings.ToLower(pageData.PageMeta.LoggedInUser) {
+		errorPage(w, r, http.StatusBadRequest, "You can only see the insights for your own databases")
+		return
+	}
+
+	// Retrieve the database details
+	err = database.DBDetails(&pageData.DB, pageData.PageMeta.LoggedInUser, dbName.Owner, dbName.Database, "")
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Retrieve the daily traffic for the last year
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	pageData.Analytics, err = database.Analytics(dbName.Owner, dbName.Database, today.AddDate(-1, 0, 1), today)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, "Retrieving the database analytics failed")
+		return
+	}
+
+	// Break down the downloads for each of the time ranges which can be selected on the page
+	pageData.Downloads = make(map[int]database.DownloadBreakdown)
+	for _, days := range []int{30, 90, 365} {
+		pageData.Downloads[days], err = database.DownloadStats(dbName.Owner, dbName.Database, today.AddDate(0, 0, 1-days), today)
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, "Retrieving the download breakdown failed")
+			return
+		}
+	}
+
+	// Retrieve the size of the database for each commit of its branches.  Live databases don't have commits
+	if !pageData.DB.Info.IsLive {
+		branches, err := database.GetBranches(dbName.Owner, dbName.Database)
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, "Retrieving the branches of the database failed")
+			return
+		}
+		pageData.SizeHistory = make(map[string][]com.SizeEntry)
+		for branch := range branches {
+			pageData.SizeHistory[branch], err = com.BranchSizeHistory(dbName.Owner, dbName.Database, branch)
+			if err != nil {
+				errorPage(w, r, http.StatusInternalServerError, "Retrieving the size history failed")
+				return
+			}
+		}
+		pageData.SizeAlert, err = database.SizeAlertFor(dbName.Owner, dbName.Database)
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, "Retrieving the size alert settings failed")
+			return
+		}
+	}
+
+	// Render the page
+	t := tmpl.Lookup("insightsPage")
+	err = t.Execute(w, pageData)
+	if err != nil {
+		log.Printf("Error: %s", err)
+	}
+}
+
 func mergePage(w http.ResponseWriter, r *http.Request) {
 	var pageData struct {
 		CommentList         []database.DiscussionCommentEntry
@@ -1224,10 +1449,15 @@ func mergePage(w http.ResponseWriter, r *http.Request) {
 		DB                  database.SQLiteDBinfo
 		DestBranchNameOK    bool
 		DestBranchUsable    bool
+		Labels              []database.Label
 		LicenceWarning      string
+		LicenceWarnings     []string
+		MergeBlocked        string
+		Milestones          []database.Milestone
 		MRList              []database.DiscussionEntry
 		PageMeta            PageMetaInfo
 		SelectedID          int
+		StatusChecks        []database.CommitStatus
 		StatusMessage       string
 		StatusMessageColour string
 		SourceBranchOK      bool
@@ -1275,6 +1505,18 @@ func mergePage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Retrieve the labels and milestones available for this database
+	pageData.Labels, err = database.Labels(dbName.Owner, dbName.Database)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	pageData.Milestones, err = database.Milestones(dbName.Owner, dbName.Database)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
 	// Fill out the metadata
 	pageData.PageMeta.Title = "Merge Requests"
 
@@ -1372,6 +1614,8 @@ func mergePage(w http.ResponseWriter, r *http.Request) {
 				} else {
 					// The source can still be applied to the destination.  Update the merge commit list, just in case
 					// the source branch commit list has changed
+					headChanged := len(newCommitList) > 0 && (len(mr.MRDetails.Commits) == 0 ||
+						mr.MRDetails.Commits[0].ID != newCommitList[0].ID)
 					mr.MRDetails.Commits = newCommitList
 
 					// Save the updated commit list back to PostgreSQL
@@ -1381,6 +1625,15 @@ func mergePage(w http.ResponseWriter, r *http.Request) {
 						errorPage(w, r, http.StatusInternalServerError, err.Error())
 						return
 					}
+
+					// New commits can change other tables, whose owners then need asking for a review too
+					if headChanged {
+						err = com.RequestMergeRequestReviews(dbName.Owner, dbName.Database, *mr)
+						if err != nil {
+							errorPage(w, r, http.StatusInternalServerError, err.Error())
+							return
+						}
+					}
 				}
 			}
 		}
@@ -1413,9 +1666,7 @@ func mergePage(w http.ResponseWriter, r *http.Request) {
 				errorPage(w, r, http.StatusInternalServerError, err.Error())
 				return
 			}
-			if c.AuthorAvatar != "" {
-				c.AuthorAvatar += "&s=18"
-			}
+			c.AuthorAvatar = database.AvatarURLSized(c.AuthorAvatar, 18)
 
 			// Check for licence changes
 			commitLicSHA := j.Tree.Entries[0].LicenceSHA
@@ -1438,12 +1689,40 @@ func mergePage(w http.ResponseWriter, r *http.Request) {
 				"change. Proceed with caution."
 		}
 
+		// Warn the user if the merge would combine data under incompatible licences
+		if mr.Open {
+			pageData.LicenceWarnings, err = com.MergeRequestLicenceWarnings(dbName.Owner, dbName.Database, mr.MRDetails)
+			if err != nil {
+				errorPage(w, r, http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+
+		// Show the status checks of the head commit, and whether they stop the MR being merged
+		if mr.Open {
+			pageData.StatusChecks, pageData.MergeBlocked, err = com.MergeRequestStatusChecks(dbName.Owner, dbName.Database, *mr)
+			if err != nil {
+				errorPage(w, r, http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+
 		// Load the comments for the requested MR
 		pageData.CommentList, err = database.DiscussionComments(dbName.Owner, dbName.Database, pageData.SelectedID, 0)
 		if err != nil {
 			errorPage(w, r, http.StatusInternalServerError, err.Error())
 			return
 		}
+		pageData.CommentList, err = com.HideBlockedComments(pageData.PageMeta.LoggedInUser, pageData.CommentList)
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		err = com.AddCommentReactions(pageData.PageMeta.LoggedInUser, dbName.Owner, dbName.Database, pageData.SelectedID, pageData.CommentList)
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
 
 		// If this MR matches one of the user's status updates, remove the status update from the list
 		if pageData.PageMeta.LoggedInUser != "" {
@@ -1474,11 +1753,19 @@ func mergePage(w http.ResponseWriter, r *http.Request) {
 // Renders the user Settings page.
 func prefPage(w http.ResponseWriter, r *http.Request, loggedInUser string) {
 	var pageData struct {
-		APIKeys     []APIKey
-		DisplayName string
-		Email       string
-		MaxRows     int
-		PageMeta    PageMetaInfo
+		APIKeys        []APIKey
+		AvatarUploaded bool
+		AvatarURL      string
+		CustomDomains  []database.CustomDomain
+		DisplayName    string
+		DomainExpiry   int
+		DomainsEnabled bool
+		DomainTXT      string
+		Email          string
+		MaxRows        int
+		Notifications  database.NotificationPrefs
+		PageMeta       PageMetaInfo
+		Watching       []string
 	}
 	pageData.PageMeta.Title = "Preferences"
 	errCode, err := collectPageMetaInfo(w, r, &pageData.PageMeta)
@@ -1493,6 +1780,8 @@ func prefPage(w http.ResponseWriter, r *http.Request, loggedInUser string) {
 		errorPage(w, r, http.StatusInternalServerError, "Database query failed")
 		return
 	}
+	pageData.AvatarUploaded = usr.AvatarUploaded
+	pageData.AvatarURL = database.AvatarURLSized(usr.AvatarURL, 96)
 	pageData.DisplayName = usr.DisplayName
 	pageData.Email = usr.Email
 
@@ -1509,6 +1798,33 @@ func prefPage(w http.ResponseWriter, r *http.Request, loggedInUser string) {
 	// Retrieve the user preference data
 	pageData.MaxRows = database.PrefUserMaxRows(loggedInUser)
 
+	// Retrieve the notification settings for the user, and the databases they're watching
+	pageData.Notifications, err = database.NotificationPreferences(loggedInUser)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	watching, err := database.UserWatchingDBs(loggedInUser)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, db := range watching {
+		pageData.Watching = append(pageData.Watching, fmt.Sprintf("%s/%s", db.Owner, db.DBName))
+	}
+
+	// Retrieve the custom domains of the user, when they can add them
+	pageData.DomainsEnabled = config.Conf.Domains.Enabled
+	pageData.DomainTXT = config.Conf.Domains.TXTPrefix
+	pageData.DomainExpiry = config.Conf.Domains.VerifyExpiry
+	if pageData.DomainsEnabled {
+		pageData.CustomDomains, err = com.CustomDomains(loggedInUser)
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
 	// Retrieve the list of API keys for the user
 	apiKeys, err := database.GetAPIKeys(loggedInUser)
 	if err != nil {
@@ -1517,11 +1833,12 @@ func prefPage(w http.ResponseWriter, r *http.Request, loggedInUser string) {
 	}
 	for _, k := range apiKeys {
 		pageData.APIKeys = append(pageData.APIKeys, APIKey{
-			Uuid:        k.Uuid,
-			DateCreated: k.DateCreated,
-			ExpiryDate:  k.ExpiryDate,
-			Comment:     k.Comment,
-			Permissions: k.Permissions,
+			Uuid:           k.Uuid,
+			DateCreated:    k.DateCreated,
+			ExpiryDate:     k.ExpiryDate,
+			Comment:        k.Comment,
+			Permissions:    k.Permissions,
+			AllowedOrigins: k.AllowedOrigins,
 		})
 	}
 
@@ -1567,14 +1884,14 @@ func profilePage(w http.ResponseWriter, r *http.Request, userName string) {
 	}
 
 	// Retrieve list of public databases for the user
-	pageData.PublicDBs, err = database.UserDBs(userName, database.DB_PUBLIC)
+	pageData.PublicDBs, err = database.UserDBs(userName, database.DB_PUBLIC, database.DBOrderPinned, database.DBFilter{})
 	if err != nil {
 		errorPage(w, r, http.StatusInternalServerError, "Database query failed")
 		return
 	}
 
 	// Retrieve list of private databases for the user
-	pageData.PrivateDBs, err = database.UserDBs(userName, database.DB_PRIVATE)
+	pageData.PrivateDBs, err = database.UserDBs(userName, database.DB_PRIVATE, database.DBOrderPinned, database.DBFilter{})
 	if err != nil {
 		errorPage(w, r, http.StatusInternalServerError, "Database query failed")
 		return
@@ -1595,13 +1912,13 @@ func profilePage(w http.ResponseWriter, r *http.Request, userName string) {
 	}
 
 	// Retrieve the list of live databases created by the user
-	pageData.PublicLiveDBS, err = com.LiveUserDBs(userName, database.DB_PUBLIC)
+	pageData.PublicLiveDBS, err = com.LiveUserDBs(userName, database.DB_PUBLIC, database.DBOrderCreated, database.DBFilter{})
 	if err != nil {
 		errorPage(w, r, http.StatusInternalServerError, "Database query failed")
 		return
 	}
 
-	pageData.PrivateLiveDBS, err = com.LiveUserDBs(userName, database.DB_PRIVATE)
+	pageData.PrivateLiveDBS, err = com.LiveUserDBs(userName, database.DB_PRIVATE, database.DBOrderCreated, database.DBFilter{})
 	if err != nil {
 		errorPage(w, r, http.StatusInternalServerError, "Database query failed")
 		return
@@ -1698,14 +2015,16 @@ func releasesPage(w http.ResponseWriter, r *http.Request) {
 		Commit            string    `json:"commit"`
 		Date              time.Time `json:"date"`
 		Description       string    `json:"description"`
+		DOI               string    `json:"doi"`
 		Size              int64     `json:"size"`
 		TaggerUserName    string    `json:"tagger_user_name"`
 		TaggerDisplayName string    `json:"tagger_display_name"`
 	}
 	var pageData struct {
-		DB       database.SQLiteDBinfo
-		PageMeta PageMetaInfo
-		TagList  map[string]tgEntry
+		DB         database.SQLiteDBinfo
+		DOIEnabled bool
+		PageMeta   PageMetaInfo
+		TagList    map[string]tgEntry
 	}
 	pageData.PageMeta.Title = "Release list"
 	pageData.PageMeta.PageSection = "db_data"
@@ -1756,9 +2075,7 @@ func releasesPage(w http.ResponseWriter, r *http.Request) {
 					errorPage(w, r, http.StatusInternalServerError, err.Error())
 					return
 				}
-				if avatarURL != "" {
-					avatarURL += "&s=28"
-				}
+				avatarURL = database.AvatarURLSized(avatarURL, 28)
 				userNameCache[j.ReleaserEmail] = userCacheEntry{AvatarURL: avatarURL, Email: eml}
 			}
 
@@ -1768,6 +2085,7 @@ func releasesPage(w http.ResponseWriter, r *http.Request) {
 				Commit:            j.Commit,
 				Date:              j.Date,
 				Description:       j.Description,
+				DOI:               j.DOI,
 				Size:              j.Size,
 				TaggerUserName:    userNameCache[j.ReleaserEmail].Email,
 				TaggerDisplayName: j.ReleaserName,
@@ -1775,6 +2093,9 @@ func releasesPage(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// DOIs can only be minted for public databases
+	pageData.DOIEnabled = com.DOIEnabled() && pageData.DB.Info.Public
+
 	// Render the page
 	t := tmpl.Lookup("releasesPage")
 	err = t.Execute(w, pageData)
@@ -1786,8 +2107,9 @@ func releasesPage(w http.ResponseWriter, r *http.Request) {
 // Displays a web page for new users to choose their username.
 func selectUserNamePage(w http.ResponseWriter, r *http.Request) {
 	var pageData struct {
-		Nick     string
-		PageMeta PageMetaInfo
+		InviteRequired bool
+		Nick           string
+		PageMeta       PageMetaInfo
 	}
 	pageData.PageMeta.Title = "Select your username"
 
@@ -1821,6 +2143,13 @@ func selectUserNamePage(w http.ResponseWriter, r *http.Request) {
 		pageData.Nick = ni.(string)
 	}
 
+	// When signups are closed, ask for an invitation code unless the email address is in an allowed domain
+	var email string
+	if em := sess.Values["email"]; em != nil {
+		email = em.(string)
+	}
+	pageData.InviteRequired = com.SignupNeedsInvitation(email)
+
 	// Render the page
 	t := tmpl.Lookup("selectUserNamePage")
 	err = t.Execute(w, pageData)
@@ -1878,23 +2207,26 @@ func settingsPage(w http.ResponseWriter, r *http.Request) {
 
 	// If it's a standard database then we query it directly, otherwise we query it via our job queue backend
 	if !pageData.DB.Info.IsLive {
-		// Get a handle from Minio for the database object
-		bkt := pageData.DB.Info.DBEntry.Sha256[:com.MinioFolderChars]
-		id := pageData.DB.Info.DBEntry.Sha256[com.MinioFolderChars:]
-		sdb, err := com.OpenSQLiteDatabase(bkt, id)
-		if err != nil {
-			errorPage(w, r, http.StatusInternalServerError, err.Error())
-			return
-		}
+		// Databases encrypted by their owner can't be opened, so have no tables to list
+		if !pageData.DB.Info.ClientEncrypted {
+			// Get a handle from Minio for the database object
+			bkt := pageData.DB.Info.DBEntry.Sha256[:com.MinioFolderChars]
+			id := pageData.DB.Info.DBEntry.Sha256[com.MinioFolderChars:]
+			sdb, err := com.OpenSQLiteDatabase(bkt, id)
+			if err != nil {
+				errorPage(w, r, http.StatusInternalServerError, err.Error())
+				return
+			}
 
-		// Automatically close the SQLite database when this function finishes
-		defer sdb.Close()
+			// Automatically close the SQLite database when this function finishes
+			defer sdb.Close()
 
-		// Retrieve the list of tables in the database
-		pageData.DB.Info.Tables, err = com.TablesAndViews(sdb, fmt.Sprintf("%s/%s", dbName.Owner, dbName.Database))
-		if err != nil {
-			errorPage(w, r, http.StatusInternalServerError, err.Error())
-			return
+			// Retrieve the list of tables in the database
+			pageData.DB.Info.Tables, err = com.TablesAndViews(sdb, fmt.Sprintf("%s/%s", dbName.Owner, dbName.Database))
+			if err != nil {
+				errorPage(w, r, http.StatusInternalServerError, err.Error())
+				return
+			}
 		}
 
 		// Retrieve the list of branches
@@ -2099,9 +2431,7 @@ func tagsPage(w http.ResponseWriter, r *http.Request) {
 					errorPage(w, r, http.StatusInternalServerError, err.Error())
 					return
 				}
-				if avatarURL != "" {
-					avatarURL += "&s=28"
-				}
+				avatarURL = database.AvatarURLSized(avatarURL, 28)
 				userNameCache[j.TaggerEmail] = userCacheEntry{AvatarURL: avatarURL, Email: eml}
 			}
 
@@ -2129,7 +2459,9 @@ func tagsPage(w http.ResponseWriter, r *http.Request) {
 func updatesPage(w http.ResponseWriter, r *http.Request) {
 	var pageData struct {
 		PageMeta PageMetaInfo
-		Updates  map[string][]database.StatusUpdateEntry
+		PageSize int
+		Total    int
+		Updates  []database.StatusUpdateEntry
 	}
 
 	// Get all meta information
@@ -2146,8 +2478,10 @@ func updatesPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Retrieve the list of status updates for the user
-	pageData.Updates, err = database.StatusUpdates(pageData.PageMeta.LoggedInUser)
+	// Retrieve the first page of status updates for the user
+	pageData.PageSize = statusUpdatesPageSize
+	pageData.Updates, pageData.Total, err = database.StatusUpdatesList(pageData.PageMeta.LoggedInUser, false, 0,
+		statusUpdatesPageSize)
 	if err != nil {
 		errorPage(w, r, http.StatusInternalServerError, err.Error())
 		return
@@ -2343,9 +2677,11 @@ func usagePage(w http.ResponseWriter, r *http.Request) {
 func userPage(w http.ResponseWriter, r *http.Request, userName string) {
 	// Structure to hold page data
 	var pageData struct {
+		Blocked       bool
 		DBRows        []database.DBInfo
 		FullName      string
 		PageMeta      PageMetaInfo
+		PreventForks  bool
 		PublicLiveDBS []database.DBInfo
 		UserAvatarURL string
 		UserName      string
@@ -2377,6 +2713,13 @@ func userPage(w http.ResponseWriter, r *http.Request, userName string) {
 		return
 	}
 
+	// Point search engines at the custom domain of the user, when they have one
+	pageData.PageMeta.CanonicalURL, err = com.CustomDomainURL(userName, "")
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, "Database query failed")
+		return
+	}
+
 	// Retrieve the details for the user whose page we're looking at
 	usr, err := database.User(userName)
 	if err != nil {
@@ -2386,24 +2729,37 @@ func userPage(w http.ResponseWriter, r *http.Request, userName string) {
 	pageData.FullName = usr.DisplayName
 	pageData.PageMeta.Title = usr.Username
 	pageData.UserName = usr.Username
-	if usr.AvatarURL != "" {
-		pageData.UserAvatarURL = usr.AvatarURL + "&s=48"
-	}
+	pageData.UserAvatarURL = database.AvatarURLSized(usr.AvatarURL, 48)
 
 	// Retrieve list of public standard databases owned by the user
-	pageData.DBRows, err = database.UserDBs(userName, database.DB_PUBLIC)
+	pageData.DBRows, err = database.UserDBs(userName, database.DB_PUBLIC, database.DBOrderPinned, database.DBFilter{})
 	if err != nil {
 		errorPage(w, r, http.StatusInternalServerError, "Database query failed")
 		return
 	}
 
 	// Retrieve the list of public live databases created by the user
-	pageData.PublicLiveDBS, err = com.LiveUserDBs(userName, database.DB_PUBLIC)
+	pageData.PublicLiveDBS, err = com.LiveUserDBs(userName, database.DB_PUBLIC, database.DBOrderCreated, database.DBFilter{})
 	if err != nil {
 		errorPage(w, r, http.StatusInternalServerError, "Database query failed")
 		return
 	}
 
+	// Check whether the logged in user has blocked this user
+	if pageData.PageMeta.LoggedInUser != "" {
+		blocks, err := database.BlockedUsers(pageData.PageMeta.LoggedInUser)
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, "Database query failed")
+			return
+		}
+		for _, b := range blocks {
+			if strings.ToLower(b.User) == strings.ToLower(usr.Username) {
+				pageData.Blocked = true
+				pageData.PreventForks = b.PreventForks
+			}
+		}
+	}
+
 	// Render the page
 	t := tmpl.Lookup("userPage")
 	err = t.Execute(w, pageData)
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// reactionHandler adds or removes a reaction of the logged in user on a discussion comment.  It returns the updated
+// reactions of the comment
+func reactionHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Extract the required form variables
+	usr, _, dbName, err := com.GetUFD(r, false)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Bad request")
+		return
+	}
+
+	// Use the established capitalisation of the username
+	z, err := database.User(usr)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	dbOwner := z.Username
+
+	// Validate the discussion and comment IDs, and the reaction
+	discID, err := strconv.Atoi(r.PostFormValue("discid"))
+	if err != nil || discID < 1 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Invalid discussion id")
+		return
+	}
+	comID, err := strconv.Atoi(r.PostFormValue("comid"))
+	if err != nil || comID < 1 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Invalid comment id")
+		return
+	}
+	reaction := r.PostFormValue("reaction")
+	if !database.ValidReaction(reaction) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Unknown reaction")
+		return
+	}
+	add := r.PostFormValue("add") != "false"
+
+	// Anyone who can see the database can react to its comments
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, false)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	if !allowed {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Database '%s/%s' doesn't exist", dbOwner, dbName)
+		return
+	}
+
+	if add {
+		exists, err := database.ReactionAdd(loggedInUser, dbOwner, dbName, discID, comID, reaction)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, err.Error())
+			return
+		}
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "Unknown comment")
+			return
+		}
+	} else {
+		err = database.ReactionRemove(loggedInUser, dbOwner, dbName, discID, comID, reaction)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, err.Error())
+			return
+		}
+	}
+	err = com.InvalidateCommentReactions(dbOwner, dbName, discID)
+	if err != nil {
+		log.Printf("Error when invalidating the cached reactions for '%s/%s': %v", com.SanitiseLogString(dbOwner),
+			com.SanitiseLogString(dbName), err)
+	}
+
+	// Return the updated reactions of the comment
+	comment := []database.DiscussionCommentEntry{{ID: comID}}
+	err = com.AddCommentReactions(loggedInUser, dbOwner, dbName, discID, comment)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err.Error())
+		return
+	}
+	jsonResponse, err := json.Marshal(comment[0])
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "%s", jsonResponse)
+}
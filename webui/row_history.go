@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// rowHistoryHandler returns the history of a table row in a database branch as JSON, for the row history panel of the
+// database page
+func rowHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	loggedInUser, _, err := checkLogin(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Retrieve the database owner, name, and table
+	dbOwner, dbName, table, err := com.GetODT(2, r) // 2 = Ignore "/x/rowhistory/" at the start of the URL
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err)
+		return
+	}
+	if table == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Missing table name")
+		return
+	}
+	key, err := com.ParseRowKey(r.FormValue("key"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err)
+		return
+	}
+
+	// Make sure the user has access to the database
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, false)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	if !allowed {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Database '%s/%s' doesn't exist", dbOwner, dbName)
+		return
+	}
+
+	// Live databases don't have commits
+	isLive, _, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if isLive {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Live databases don't have a row history")
+		return
+	}
+
+	// Use the default branch if none was given
+	branchName, err := com.GetFormBranch(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err)
+		return
+	}
+	if branchName == "" {
+		branchName, err = database.GetDefaultBranchName(dbOwner, dbName)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	history, err := com.RowHistory(loggedInUser, dbOwner, dbName, branchName, table, key)
+	if errors.Is(err, com.ErrClientEncrypted) || errors.Is(err, com.ErrRowKey) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+
+	// Return the history as JSON
+	jsonResponse, err := json.Marshal(history)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "%s", jsonResponse)
+}
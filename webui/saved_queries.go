@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// SavedQueryRequest holds the details of a saved query sent to us for saving
+type SavedQueryRequest struct {
+	Description string `json:"description"`
+	Name        string `json:"name"`
+	Shared      bool   `json:"shared"`
+	SQL         string `json:"sql"`
+}
+
+// savedQueryAccess checks the logged in user and their access to the database given in the request URL.  If anything
+// isn't right, an error response is written and ok is false
+func savedQueryAccess(w http.ResponseWriter, r *http.Request, requireLogin bool) (loggedInUser, dbOwner, dbName, commitID string, ok bool) {
+	// Retrieve session data (if any)
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we have a valid logged in user, if required
+	if requireLogin && validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, "You need to be logged in")
+		return
+	}
+
+	// Retrieve user, database, and commit ID
+	dbOwner, dbName, commitID, err = com.GetODC(2, r) // 2 = Ignore "/x/savedqueryxxx/" at the start of the URL
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err)
+		return
+	}
+
+	// Make sure the user has access to the database
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, false)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	if !allowed {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Database '%s/%s' doesn't exist", dbOwner, dbName)
+		return
+	}
+	ok = true
+	return
+}
+
+// savedQueriesHandler returns the list of saved queries for a database which are visible to the user
+func savedQueriesHandler(w http.ResponseWriter, r *http.Request) {
+	loggedInUser, dbOwner, dbName, _, ok := savedQueryAccess(w, r, false)
+	if !ok {
+		return
+	}
+
+	queries, err := database.SavedQueries(loggedInUser, dbOwner, dbName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+
+	// Return the list as JSON
+	jsonResponse, err := json.Marshal(queries)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "%s", jsonResponse)
+}
+
+// savedQueryDelHandler deletes a saved query.  Only the creator of the saved query can do this
+func savedQueryDelHandler(w http.ResponseWriter, r *http.Request) {
+	loggedInUser, dbOwner, dbName, _, ok := savedQueryAccess(w, r, true)
+	if !ok {
+		return
+	}
+
+	// Validate the saved query name
+	queryName := r.FormValue("name")
+	err := com.ValidateSavedQueryName(queryName)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error when validating input: %s", err)
+		return
+	}
+
+	err = database.SavedQueryDelete(loggedInUser, dbOwner, dbName, queryName)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// savedQueryExecHandler runs a saved query, returning the results as JSON.  By default the latest version of the
+// query is run, though a specific version can be requested
+func savedQueryExecHandler(w http.ResponseWriter, r *http.Request) {
+	loggedInUser, dbOwner, dbName, commitID, ok := savedQueryAccess(w, r, false)
+	if !ok {
+		return
+	}
+
+	// Validate the saved query name and version
+	queryName := r.FormValue("name")
+	err := com.ValidateSavedQueryName(queryName)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error when validating input: %s", err)
+		return
+	}
+	version := 0
+	if v := r.FormValue("version"); v != "" {
+		version, err = strconv.Atoi(v)
+		if err != nil || version < 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "Invalid version number")
+			return
+		}
+	}
+
+	// Retrieve the saved query
+	query, exists, err := database.SavedQueryGet(loggedInUser, dbOwner, dbName, queryName, version)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "Saved query not found")
+		return
+	}
+
+	// Check if this is a live database
+	isLive, liveNode, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+
+	// Run the query
+	var data com.SQLiteRecordSet
+	if !isLive {
+		data, err = com.SQLiteRunQueryDefensive(w, r, com.QuerySourceVisualisation, dbOwner, dbName, commitID, loggedInUser, query.SQL)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, err)
+			return
+		}
+	} else {
+		// Send the query to the appropriate backend live node
+		data, err = com.LiveQuery(liveNode, loggedInUser, dbOwner, dbName, query.SQL)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, err.Error())
+			return
+		}
+	}
+
+	// Return the results as JSON
+	jsonResponse, err := json.Marshal(data)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "%s", jsonResponse)
+}
+
+// savedQuerySaveHandler saves a query for a database.  Saving an existing query adds a new version of it
+func savedQuerySaveHandler(w http.ResponseWriter, r *http.Request) {
+	loggedInUser, dbOwner, dbName, _, ok := savedQueryAccess(w, r, true)
+	if !ok {
+		return
+	}
+
+	// Saving and sharing queries needs write access to the database, so other users can't take the query names
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	if !allowed {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "You need write access to the database to save queries for it")
+		return
+	}
+
+	// Grab the incoming saved query
+	bodyData, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err)
+		return
+	}
+	var req SavedQueryRequest
+	err = json.Unmarshal(bodyData, &req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err)
+		return
+	}
+
+	// Validate the saved query details
+	err = com.ValidateSavedQueryName(req.Name)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error when validating saved query name: %s", err)
+		return
+	}
+	if req.Description != "" {
+		err = com.ValidateMarkdown(req.Description)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Error when validating saved query description: %s", err)
+			return
+		}
+	}
+	sql, err := com.CheckUnicode(req.SQL, false)
+	if err != nil || sql == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Invalid SQL query")
+		return
+	}
+
+	// Save the query
+	version, err := database.SavedQuerySave(loggedInUser, dbOwner, dbName, req.Name, req.Description, sql, req.Shared)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	fmt.Fprintf(w, `{"version": %d}`, version)
+}
+
+// savedQueryVersionsHandler returns the version history of a saved query
+func savedQueryVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	loggedInUser, dbOwner, dbName, _, ok := savedQueryAccess(w, r, false)
+	if !ok {
+		return
+	}
+
+	// Validate the saved query name
+	queryName := r.FormValue("name")
+	err := com.ValidateSavedQueryName(queryName)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error when validating input: %s", err)
+		return
+	}
+
+	versions, err := database.SavedQueryVersions(loggedInUser, dbOwner, dbName, queryName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	if len(versions) == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "Saved query not found")
+		return
+	}
+
+	// Return the list as JSON
+	jsonResponse, err := json.Marshal(versions)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "%s", jsonResponse)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// reportOutputHandler returns the rendered output of a run of one of the logged in user's scheduled reports.  It's
+// linked to from the emails reports are delivered with, as "/x/reportoutput/?name=<report>&run=<run id>"
+func reportOutputHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, "You need to be logged in")
+		return
+	}
+
+	// Validate the report name and run ID
+	name := r.FormValue("name")
+	err = com.ValidateReportName(name)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Invalid report name")
+		return
+	}
+	runID, err := strconv.ParseInt(r.FormValue("run"), 10, 64)
+	if err != nil || runID < 1 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Invalid run ID")
+		return
+	}
+
+	// Retrieve the output of the run
+	contentType, output, exists, err := database.ScheduledReportRunOutput(loggedInUser, name, runID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	if !exists || output == nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "Report output not found")
+		return
+	}
+
+	// HTML reports include database values and charts, so are sandboxed from the rest of the site
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{
+		"filename": name + com.ScheduledReportExtension(contentType)}))
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(output)
+}
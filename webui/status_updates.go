@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+)
+
+// Number of status updates shown on each page of the notification center
+const statusUpdatesPageSize = 25
+
+// statusUpdatesDismissHandler marks all of the status updates for the logged in user as read
+func statusUpdatesDismissHandler(w http.ResponseWriter, r *http.Request) {
+	loggedInUser, ok := statusUpdatesUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := database.StatusUpdatesMarkAllRead(loggedInUser)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	statusUpdatesCountResponse(w, loggedInUser)
+}
+
+// statusUpdatesHandler returns a page of the status updates for the logged in user
+func statusUpdatesHandler(w http.ResponseWriter, r *http.Request) {
+	loggedInUser, ok := statusUpdatesUser(w, r)
+	if !ok {
+		return
+	}
+
+	// Retrieve the requested page
+	offset := 0
+	if o := r.FormValue("offset"); o != "" {
+		var err error
+		offset, err = strconv.Atoi(o)
+		if err != nil || offset < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "Invalid offset")
+			return
+		}
+	}
+	unreadOnly := r.FormValue("unread") == "true"
+	updates, total, err := database.StatusUpdatesList(loggedInUser, unreadOnly, offset, statusUpdatesPageSize)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	if updates == nil {
+		updates = []database.StatusUpdateEntry{}
+	}
+
+	// Return the results as JSON
+	jsonResponse, err := json.Marshal(struct {
+		Total   int                          `json:"total"`
+		Updates []database.StatusUpdateEntry `json:"updates"`
+	}{
+		Total:   total,
+		Updates: updates,
+	})
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "%s", jsonResponse)
+}
+
+// statusUpdatesReadHandler marks a list of status updates for the logged in user as read or unread
+func statusUpdatesReadHandler(w http.ResponseWriter, r *http.Request) {
+	loggedInUser, ok := statusUpdatesUser(w, r)
+	if !ok {
+		return
+	}
+
+	// Validate the status update IDs, which are given as a comma separated list
+	var ids []int64
+	for _, i := range strings.Split(r.PostFormValue("ids"), ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(i), 10, 64)
+		if err != nil || id < 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "Invalid status update ID")
+			return
+		}
+		ids = append(ids, id)
+	}
+	read := true
+	if v := r.PostFormValue("read"); v != "" {
+		var err error
+		read, err = strconv.ParseBool(v)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "Invalid value for read")
+			return
+		}
+	}
+
+	err := database.StatusUpdatesMarkRead(loggedInUser, ids, read)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	statusUpdatesCountResponse(w, loggedInUser)
+}
+
+// statusUpdatesCountResponse updates the cached number of unread status updates for a user, then returns it as JSON
+func statusUpdatesCountResponse(w http.ResponseWriter, loggedInUser string) {
+	numUpdates, err := com.StatusUpdatesRecount(loggedInUser)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	fmt.Fprintf(w, `{"unread": %d}`, numUpdates)
+}
+
+// statusUpdatesUser returns the logged in user for the status update handlers.  If there isn't one, an error is
+// written to the response and false is returned
+func statusUpdatesUser(w http.ResponseWriter, r *http.Request) (loggedInUser string, ok bool) {
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, "You need to be logged in")
+		return
+	}
+	return loggedInUser, true
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+
+	com "github.com/sqlitebrowser/dbhub.io/common"
+	"github.com/sqlitebrowser/dbhub.io/common/config"
+	"github.com/sqlitebrowser/dbhub.io/common/database"
+	gfm "github.com/sqlitebrowser/github_flavored_markdown"
+)
+
+const (
+	// Number of seconds the rendered output of a data story for a live database is cached for.  Live databases can
+	// change at any time, so this is kept short
+	storyLiveCacheTime = 60
+
+	// Maximum number of result rows displayed for each SQL block in a data story
+	storyMaxRows = 1000
+)
+
+// storySQLBlock matches the fenced ```sql code blocks of a data story, which are run when the story is viewed
+var storySQLBlock = regexp.MustCompile("(?ms)^```sql[ \\t]*\\r?\\n(.*?)\\r?\\n```[ \\t]*$")
+
+// StorySaveRequest holds the details of a data story sent to us for saving
+type StorySaveRequest struct {
+	Body string `json:"body"`
+	Name string `json:"name"`
+}
+
+// renderStory converts a data story to HTML, running each of its SQL blocks against the database and including the
+// results as a table.  The rendered output is cached, keyed on the database commit and story modification time
+func renderStory(r *http.Request, loggedInUser, dbOwner, dbName, commitID string, story database.DataStory) (string, error) {
+	// Check if this is a live database
+	isLive, liveNode, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		return "", err
+	}
+	cacheTime := config.Conf.Memcache.DefaultCacheTime
+	if isLive {
+		cacheTime = storyLiveCacheTime
+	} else if commitID == "" {
+		// Standard databases use the commit given to us, or the default one if none was
+		commitID, err = database.DefaultCommit(dbOwner, dbName)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// Use the cached output if it's available
+	cacheKey := com.MetadataCacheKey(fmt.Sprintf("story/%s/%d", story.Name, story.LastModified.UnixNano()), "",
+		dbOwner, dbName, commitID)
+	var rendered string
+	ok, err := com.GetCachedData(cacheKey, &rendered)
+	if err != nil {
+		log.Printf("Error retrieving data story from cache: %v", err)
+	}
+	if ok {
+		return rendered, nil
+	}
+
+	// Render the Markdown between the SQL blocks, and the results of running each SQL block
+	var out strings.Builder
+	pos := 0
+	for _, loc := range storySQLBlock.FindAllStringSubmatchIndex(story.Body, -1) {
+		out.Write(gfm.Markdown([]byte(story.Body[pos:loc[0]])))
+		query := story.Body[loc[2]:loc[3]]
+
+		var data com.SQLiteRecordSet
+		if !isLive {
+			// SQLiteRunQueryDefensive() writes its own error responses, which we don't want mixed into the page, so
+			// it's given a throwaway response writer
+			data, err = com.SQLiteRunQueryDefensive(httptest.NewRecorder(), r, com.QuerySourceVisualisation, dbOwner,
+				dbName, commitID, loggedInUser, query)
+		} else {
+			data, err = com.LiveQuery(liveNode, loggedInUser, dbOwner, dbName, query)
+		}
+		out.WriteString(`<details class="mb-1"><summary>SQL</summary><pre><code>`)
+		out.WriteString(html.EscapeString(query))
+		out.WriteString("</code></pre></details>\n")
+		if err != nil {
+			out.WriteString(`<div class="alert alert-danger">`)
+			out.WriteString(html.EscapeString(err.Error()))
+			out.WriteString("</div>\n")
+		} else {
+			out.WriteString(storyResultTable(data))
+		}
+		pos = loc[1]
+	}
+	out.Write(gfm.Markdown([]byte(story.Body[pos:])))
+	rendered = out.String()
+
+	// Cache the rendered story
+	err = com.CacheData(cacheKey, rendered, cacheTime)
+	if err != nil {
+		log.Printf("Error when caching data story: %v", err)
+	}
+	return rendered, nil
+}
+
+// storyResultTable returns the results of a SQL block as a HTML table
+func storyResultTable(data com.SQLiteRecordSet) string {
+	var out strings.Builder
+	out.WriteString(`<table class="table table-sm table-striped table-bordered"><thead><tr>`)
+	for _, c := range data.ColNames {
+		out.WriteString("<th>")
+		out.WriteString(html.EscapeString(c))
+		out.WriteString("</th>")
+	}
+	out.WriteString("</tr></thead><tbody>\n")
+	for i, row := range data.Records {
+		if i >= storyMaxRows {
+			break
+		}
+		out.WriteString("<tr>")
+		for _, cell := range row {
+			switch cell.Type {
+			case com.Null:
+				out.WriteString("<td><i>NULL</i></td>")
+			case com.Binary, com.Image:
+				out.WriteString("<td><i>BINARY</i></td>")
+			default:
+				out.WriteString("<td>")
+				out.WriteString(html.EscapeString(fmt.Sprint(cell.Value)))
+				out.WriteString("</td>")
+			}
+		}
+		out.WriteString("</tr>\n")
+	}
+	out.WriteString("</tbody></table>\n")
+	if len(data.Records) > storyMaxRows {
+		out.WriteString(fmt.Sprintf("<p><i>Only the first %d rows are shown</i></p>\n", storyMaxRows))
+	}
+	return out.String()
+}
+
+// storyAccess checks the logged in user has access to the database given in the request URL, and retrieves the data
+// story requested in the form data.  If anything isn't right, an error response is written and ok is false
+func storyAccess(w http.ResponseWriter, r *http.Request) (loggedInUser, dbOwner, dbName, commitID string, story database.DataStory, ok bool) {
+	// Retrieve session data (if any)
+	loggedInUser, _, err := checkLogin(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Retrieve user, database, and commit ID
+	dbOwner, dbName, commitID, err = com.GetODC(2, r) // 2 = Ignore "/x/storyxxx/" at the start of the URL
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err)
+		return
+	}
+
+	// Validate the story name
+	storyName := r.FormValue("name")
+	err = com.ValidateStoryName(storyName)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error when validating input: %s", err)
+		return
+	}
+
+	// Make sure the user has access to the database
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, false)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	if !allowed {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Database '%s/%s' doesn't exist", dbOwner, dbName)
+		return
+	}
+
+	// Retrieve the story
+	var exists bool
+	story, exists, err = database.DataStoryGet(dbOwner, dbName, storyName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Data story '%s' not found", storyName)
+		return
+	}
+	ok = true
+	return
+}
+
+// storyPage displays the data stories of a database.  If no story name is given, the list of stories is shown
+func storyPage(w http.ResponseWriter, r *http.Request) {
+	var pageData struct {
+		CanEdit  bool
+		DBName   string
+		DBOwner  string
+		PageMeta PageMetaInfo
+		Rendered string
+		Stories  []database.DataStory
+		Story    database.DataStory
+	}
+
+	// Get all meta information
+	errCode, err := collectPageMetaInfo(w, r, &pageData.PageMeta)
+	if err != nil {
+		errorPage(w, r, errCode, err.Error())
+		return
+	}
+	dbName, err := getDatabaseName(r)
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Check if a specific database commit ID was given
+	commitID, err := com.GetFormCommit(r)
+	if err != nil {
+		errorPage(w, r, http.StatusBadRequest, "Invalid database commit ID")
+		return
+	}
+
+	// Validate the story name, if one was given
+	storyName := r.FormValue("name")
+	if storyName != "" {
+		err = com.ValidateStoryName(storyName)
+		if err != nil {
+			errorPage(w, r, http.StatusBadRequest, "Invalid data story name")
+			return
+		}
+	}
+
+	// Check if the database exists and the user has access to view it
+	exists, err := database.CheckDBPermissions(pageData.PageMeta.LoggedInUser, dbName.Owner, dbName.Database, false)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !exists {
+		errorPage(w, r, http.StatusNotFound, fmt.Sprintf("Database '%s%s%s' doesn't exist", dbName.Owner, "/",
+			dbName.Database))
+		return
+	}
+	pageData.DBOwner = dbName.Owner
+	pageData.DBName = dbName.Database
+
+	// Users with write access to the database can edit its stories
+	pageData.CanEdit, err = database.CheckDBPermissions(pageData.PageMeta.LoggedInUser, dbName.Owner, dbName.Database, true)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Retrieve the list of stories for the database
+	pageData.Stories, err = database.DataStories(dbName.Owner, dbName.Database)
+	if err != nil {
+		errorPage(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Render the requested story
+	if storyName != "" {
+		pageData.Story, exists, err = database.DataStoryGet(dbName.Owner, dbName.Database, storyName)
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !exists && !pageData.CanEdit {
+			errorPage(w, r, http.StatusNotFound, fmt.Sprintf("Data story '%s' not found", storyName))
+			return
+		}
+		if exists {
+			pageData.Rendered, err = renderStory(r, pageData.PageMeta.LoggedInUser, dbName.Owner, dbName.Database,
+				commitID, pageData.Story)
+			if err != nil {
+				errorPage(w, r, http.StatusInternalServerError, err.Error())
+				return
+			}
+		} else {
+			// Users able to edit the story get an empty one to start with
+			pageData.Story.Name = storyName
+		}
+	}
+
+	// Fill out page metadata
+	pageData.PageMeta.Title = fmt.Sprintf("Data stories - %s / %s", dbName.Owner, dbName.Database)
+
+	// Render the page
+	t := tmpl.Lookup("storyPage")
+	err = t.Execute(w, pageData)
+	if err != nil {
+		log.Printf("Error: %s", err)
+	}
+}
+
+// storyDelHandler deletes a data story.  Users need write access to the database for this
+func storyDelHandler(w http.ResponseWriter, r *http.Request) {
+	loggedInUser, dbOwner, dbName, _, story, ok := storyAccess(w, r)
+	if !ok {
+		return
+	}
+
+	// Make sure the user has write access to the database
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	if !allowed {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "You don't have write access to this database")
+		return
+	}
+
+	err = database.DataStoryDelete(dbOwner, dbName, story.Name)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// storyExportHandler returns a data story as a standalone HTML document
+func storyExportHandler(w http.ResponseWriter, r *http.Request) {
+	loggedInUser, dbOwner, dbName, commitID, story, ok := storyAccess(w, r)
+	if !ok {
+		return
+	}
+
+	// Render the story
+	rendered, err := renderStory(r, loggedInUser, dbOwner, dbName, commitID, story)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+
+	// Return the story as a downloadable HTML document
+	title := html.EscapeString(fmt.Sprintf("%s - %s / %s", story.Name, dbOwner, dbName))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.html"`, story.Name))
+	fmt.Fprintf(w, `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style>
+body { font-family: sans-serif; margin: 2em auto; max-width: 60em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 0.25em 0.5em; }
+pre { background: #f5f5f5; padding: 0.5em; }
+.alert-danger { color: #a94442; background: #f2dede; padding: 0.5em; }
+</style>
+</head>
+<body>
+<h1>%s</h1>
+%s
+</body>
+</html>
+`, title, html.EscapeString(story.Name), rendered)
+}
+
+// storySaveHandler creates or updates a data story.  Users need write access to the database for this
+func storySaveHandler(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, "You need to be logged in")
+		return
+	}
+
+	// Retrieve user and database name
+	dbOwner, dbName, _, err := com.GetODC(2, r) // 2 = Ignore "/x/storysave/" at the start of the URL
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err)
+		return
+	}
+
+	// Make sure the user has write access to the database
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	if !allowed {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, "You don't have write access to this database")
+		return
+	}
+
+	// Grab the incoming story
+	bodyData, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err)
+		return
+	}
+	var req StorySaveRequest
+	err = json.Unmarshal(bodyData, &req)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err)
+		return
+	}
+
+	// Validate the story details
+	err = com.ValidateStoryName(req.Name)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error when validating data story name: %s", err)
+		return
+	}
+	err = com.ValidateMarkdown(req.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error when validating data story: %s", err)
+		return
+	}
+
+	// Save the story
+	err = database.DataStorySave(loggedInUser, dbOwner, dbName, req.Name, req.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -6,22 +6,14 @@ import (
 	"github.com/sqlitebrowser/dbhub.io/common/database"
 )
 
-type ActivityRange string
-
-const (
-	TODAY      ActivityRange = "today"
-	THIS_WEEK                = "week"
-	THIS_MONTH               = "month"
-	ALL_TIME                 = "all"
-)
-
 type APIKey struct {
-	Uuid        string                            `json:"uuid"`
-	Key         string                            `json:"key"`
-	DateCreated time.Time                         `json:"date_created"`
-	ExpiryDate  *time.Time                        `json:"expiry_date"`
-	Comment     string                            `json:"comment"`
-	Permissions database.ShareDatabasePermissions `json:"permissions"`
+	Uuid           string                            `json:"uuid"`
+	Key            string                            `json:"key"`
+	DateCreated    time.Time                         `json:"date_created"`
+	ExpiryDate     *time.Time                        `json:"expiry_date"`
+	Comment        string                            `json:"comment"`
+	Permissions    database.ShareDatabasePermissions `json:"permissions"`
+	AllowedOrigins []string                          `json:"allowed_origins"`
 }
 
 type Auth0Set struct {
@@ -46,11 +38,15 @@ type PageMetaInfo struct {
 	ApiUrl           string
 	Auth0            Auth0Set
 	AvatarURL        string
+	CanonicalURL     string                 // The preferred URL of the page, when it's served from a custom domain
+	DatasetJSONLD    map[string]interface{} // The schema.org description of a public database, for search engines
 	Environment      string
+	IsAdmin          bool
 	LoggedInUser     string
 	NumStatusUpdates int
 	PageSection      string
 	Protocol         string
+	ReadOnlyMessage  string // Shown at the top of each page while the server is in read only mode
 	Server           string
 	Title            string
 }
@@ -68,12 +64,14 @@ type UpdateDataRequestRow struct {
 }
 
 type UpdateDataRequest struct {
-	Table string                 `json:"table"`
-	Data  []UpdateDataRequestRow `json:"data"`
+	Table  string                 `json:"table"`
+	Branch string                 `json:"branch,omitempty"`
+	Data   []UpdateDataRequestRow `json:"data"`
 }
 
 type ExecuteSqlRequest struct {
-	Sql string `json:"sql"`
+	Pivot *database.VisPivot `json:"pivot,omitempty"` // When given, the results are summarised into a pivot table
+	Sql   string             `json:"sql"`
 }
 
 type SaveSqlRequest struct {
@@ -1,22 +1,34 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	com "github.com/sqlitebrowser/dbhub.io/common"
 	"github.com/sqlitebrowser/dbhub.io/common/config"
 	"github.com/sqlitebrowser/dbhub.io/common/database"
 )
 
+// visChartMaxAge is how many seconds chart images of standard databases can be used from a cache before checking
+// whether there's been a new commit
+const visChartMaxAge = 300
+
 func visualisePage(w http.ResponseWriter, r *http.Request) {
 	var pageData struct {
 		DB             database.SQLiteDBinfo
 		PageMeta       PageMetaInfo
 		Branches       map[string]database.BranchEntry
+		MapTiles       []config.MapTileProvider
 		Visualisations map[string]database.VisParamsV2
 	}
 
@@ -194,6 +206,7 @@ func visualisePage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Fill out various metadata fields
+	pageData.MapTiles = config.Conf.Map.TileProviders
 	pageData.PageMeta.Title = fmt.Sprintf("Visualisations - %s %s %s", dbName.Owner, "/", dbName.Database)
 	pageData.PageMeta.PageSection = "db_vis"
 
@@ -205,6 +218,214 @@ func visualisePage(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// visChart renders a saved visualisation as an image at a stable URL, such as /chart/owner/database/visname.svg, so
+// it can be included in READMEs and other external documentation.  For standard databases the chart follows the head
+// commit of the requested branch (or the default branch), with its cache headers tied to that commit.  So the image
+// updates whenever new data is committed
+func visChart(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	loggedInUser, _, err := checkLogin(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Retrieve user and database
+	dbOwner, dbName, err := com.GetOD(1, r) // 1 = Ignore "/chart/" at the start of the URL
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, err)
+		return
+	}
+
+	// The rest of the path is the visualisation name, with the image format as its extension
+	pathStrings := strings.Split(r.URL.Path, "/")
+	if len(pathStrings) < 5 {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "No visualisation name given")
+		return
+	}
+	visName := strings.Join(pathStrings[4:], "/")
+	format := strings.ToLower(path.Ext(visName))
+	if format != ".svg" && format != ".png" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Unknown image format.  The chart URL needs to end in .svg or .png")
+		return
+	}
+	visName = strings.TrimSuffix(visName, path.Ext(visName))
+	format = format[1:]
+	err = com.ValidateVisualisationName(visName)
+	if err != nil {
+		log.Printf("Input validation error for visChart(): %s", err)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error when validating input: %s", err)
+		return
+	}
+	branchName, err := com.GetFormBranch(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Validation failed for branch name")
+		return
+	}
+
+	// Check if the user has access to the database.  If they don't, the chart can still be rendered when the
+	// visualisation is public or a valid embed token was given.  In that case the query is run on behalf of the
+	// database owner
+	queryUser := loggedInUser
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, false)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	if !allowed {
+		allowed, err = visEmbedAllowed(dbOwner, dbName, visName, r.FormValue("token"))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, err)
+			return
+		}
+		if !allowed {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "Database '%s/%s' doesn't exist", dbOwner, dbName)
+			return
+		}
+		queryUser = dbOwner
+	}
+
+	// Retrieve the visualisation parameters
+	visualisations, err := database.GetVisualisations(dbOwner, dbName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	params, ok := visualisations[visName]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "Visualisation not found")
+		return
+	}
+
+	// Charts which anyone can see are allowed to be cached by shared caches too
+	cacheScope := "private"
+	public, err := database.CheckDBPermissions("", dbOwner, dbName, false)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	if !public {
+		public, err = database.VisualisationIsPublic(dbOwner, dbName, visName)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, err)
+			return
+		}
+	}
+	if public {
+		cacheScope = "public"
+	}
+
+	// Check if this is a live database
+	isLive, liveNode, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+
+	// Live databases change without new commits, so their charts are always rendered again, with clients checking
+	// whether the image has changed
+	if isLive {
+		img, contentType, err := visRenderSaved(w, r, isLive, liveNode, queryUser, dbOwner, dbName, "", params, format)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, err)
+			return
+		}
+		w.Header().Set("Cache-Control", cacheScope+", no-cache")
+		h := sha256.Sum256(img)
+		if com.NotModified(w, r, `"`+hex.EncodeToString(h[:16])+`"`, time.Time{}) {
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Write(img)
+		return
+	}
+
+	// Work out the head commit of the requested branch
+	if branchName == "" {
+		branchName, err = database.GetDefaultBranchName(dbOwner, dbName)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, err)
+			return
+		}
+	}
+	branches, err := database.GetBranches(dbOwner, dbName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	branch, ok := branches[branchName]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Unknown branch '%s'", branchName)
+		return
+	}
+	commitID := branch.Commit
+	commitList, err := database.GetCommitList(dbOwner, dbName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+
+	// The image only changes when there's a new commit or the visualisation is changed, so the validators are based on
+	// those.  If the client already has the current image there's no need to render it
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s/%s/%s", commitID, format, paramsJSON)))
+	etag := hex.EncodeToString(h[:16])
+	w.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d", cacheScope, visChartMaxAge))
+	if com.NotModified(w, r, `"`+etag+`"`, commitList[commitID].Timestamp) {
+		return
+	}
+
+	// Use the cached image if it's already been rendered
+	contentType := "image/svg+xml"
+	if format == "png" {
+		contentType = "image/png"
+	}
+	cacheKey := "chart/" + etag
+	cacheTags := com.DatabaseCacheTags(dbOwner, dbName, commitID)
+	var img []byte
+	ok, err = com.GetCachedData(cacheKey, &img, cacheTags...)
+	if err != nil {
+		log.Printf("Error retrieving chart image from cache: %v", err)
+	}
+	if !ok {
+		img, contentType, err = visRenderSaved(w, r, isLive, liveNode, queryUser, dbOwner, dbName, commitID, params, format)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, err)
+			return
+		}
+		err = com.CacheData(cacheKey, img, config.Conf.Memcache.DefaultCacheTime, cacheTags...)
+		if err != nil {
+			log.Printf("Error when caching chart image: %v", err)
+		}
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(img)
+}
+
 // This function handles requests to delete a saved database visualisation
 func visDel(w http.ResponseWriter, r *http.Request) {
 	// Retrieve user, database
@@ -216,22 +437,10 @@ func visDel(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Retrieve session data (if any)
-	var loggedInUser string
-	var u interface{}
-	validSession := false
-	if config.Conf.Environment.Environment == "production" {
-		sess, err := store.Get(r, "dbhub-user")
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		u = sess.Values["UserName"]
-	} else {
-		u = config.Conf.Environment.UserOverride
-	}
-	if u != nil {
-		loggedInUser = u.(string)
-		validSession = true
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
 	// Ensure we have a valid logged in user
@@ -282,8 +491,10 @@ func visEmbedPage(w http.ResponseWriter, r *http.Request) {
 		DB            database.SQLiteDBinfo
 		PageMeta      PageMetaInfo
 		Branches      map[string]database.BranchEntry
+		MapTiles      []config.MapTileProvider
 		Visualisation database.VisParamsV2
 		VisName       string
+		ImageURL      string
 	}
 
 	// Get all meta information
@@ -298,6 +509,14 @@ func visEmbedPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Initial sanity check of the visualisation name
+	pageData.VisName = r.FormValue("visname")
+	err = com.ValidateVisualisationName(pageData.VisName)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
 	// Check if a specific database commit ID was given
 	commitID, err := com.GetFormCommit(r)
 	if err != nil {
@@ -330,18 +549,35 @@ func visEmbedPage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if the database exists and the user has access to view it
+	queryUser := pageData.PageMeta.LoggedInUser
+	imageOnly := false
 	exists, err := database.CheckDBPermissions(pageData.PageMeta.LoggedInUser, dbName.Owner, dbName.Database, false)
 	if err != nil {
 		errorPage(w, r, http.StatusInternalServerError, err.Error())
 		return
 	}
 	if !exists {
-		errorPage(w, r, http.StatusNotFound, fmt.Sprintf("Database '%s%s%s' doesn't exist", dbName.Owner, "/",
-			dbName.Database))
-		return
+		// Public visualisations, and ones requested with a valid embed token, can still be embedded.  They're
+		// displayed using a server side rendered image, as the viewer has no access to the database itself
+		exists, err = visEmbedAllowed(dbName.Owner, dbName.Database, pageData.VisName, r.FormValue("token"))
+		if err != nil {
+			errorPage(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !exists {
+			errorPage(w, r, http.StatusNotFound, fmt.Sprintf("Database '%s%s%s' doesn't exist", dbName.Owner, "/",
+				dbName.Database))
+			return
+		}
+		queryUser = dbName.Owner
+		imageOnly = true
+
+		// Embed tokens aren't tied to a commit, so viewers without access to the database only see the visualisation
+		// for the head of the default branch rather than picking older data
+		commitID, branchName, tagName, releaseName = "", "", "", ""
 	}
 
-	// * Execution can only get here if the user has access to the requested database *
+	// * Execution can only get here if the user has access to the requested database or visualisation *
 
 	// Check if this is a live database
 	isLive, _, err := database.CheckDBLive(dbName.Owner, dbName.Database)
@@ -383,7 +619,7 @@ func visEmbedPage(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Read the branch heads list from the database
-		pageData.Branches, err = database.GetBranches(dbName.Owner, dbName.Database)
+		branches, err := database.GetBranches(dbName.Owner, dbName.Database)
 		if err != nil {
 			errorPage(w, r, http.StatusInternalServerError, err.Error())
 			return
@@ -391,7 +627,7 @@ func visEmbedPage(w http.ResponseWriter, r *http.Request) {
 
 		// If a specific branch was requested and no commit ID was given, use the latest commit for the branch
 		if commitID == "" && branchName != "" {
-			c, ok := pageData.Branches[branchName]
+			c, ok := branches[branchName]
 			if !ok {
 				errorPage(w, r, http.StatusInternalServerError, "Unknown branch requested for this database")
 				return
@@ -433,23 +669,18 @@ func visEmbedPage(w http.ResponseWriter, r *http.Request) {
 		}
 
 		pageData.DB.Info.Branch = branchName
+		if !imageOnly {
+			pageData.Branches = branches
+		}
 	}
 
 	// Retrieve the database details
-	err = database.DBDetails(&pageData.DB, pageData.PageMeta.LoggedInUser, dbName.Owner, dbName.Database, commitID)
+	err = database.DBDetails(&pageData.DB, queryUser, dbName.Owner, dbName.Database, commitID)
 	if err != nil {
 		errorPage(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// Initial sanity check of the visualisation name
-	pageData.VisName = r.FormValue("visname")
-	err = com.ValidateVisualisationName(pageData.VisName)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		return
-	}
-
 	// Get a list of all saved visualisations for this database
 	visualisations, err := database.GetVisualisations(dbName.Owner, dbName.Database)
 	if err != nil {
@@ -458,14 +689,29 @@ func visEmbedPage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get visualisation data
-	var ok bool
-	pageData.Visualisation, ok = visualisations[pageData.VisName]
+	vis, ok := visualisations[pageData.VisName]
 	if ok == false {
 		errorPage(w, r, http.StatusNotFound, "visualisation not found")
 		return
 	}
 
+	// When the viewer doesn't have access to the database, point the page at a rendered image of the visualisation.
+	// The visualisation details aren't included in the page then, so its query and settings stay private
+	if imageOnly {
+		v := url.Values{}
+		v.Set("visname", pageData.VisName)
+		v.Set("format", "svg")
+		if token := r.FormValue("token"); token != "" {
+			v.Set("token", token)
+		}
+		pageData.ImageURL = fmt.Sprintf("/x/visimage/%s/%s?%s", url.PathEscape(dbName.Owner),
+			url.PathEscape(dbName.Database), v.Encode())
+	} else {
+		pageData.Visualisation = vis
+	}
+
 	// Page title
+	pageData.MapTiles = config.Conf.Map.TileProviders
 	pageData.PageMeta.Title = fmt.Sprintf("Visualisation %s - %s %s %s", pageData.VisName, dbName.Owner, "/", dbName.Database)
 
 	// Render the visualisation page
@@ -476,23 +722,124 @@ func visEmbedPage(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// visExecuteSQL executes a custom SQLite SELECT query.
-func visExecuteSQL(w http.ResponseWriter, r *http.Request) {
+// visEmbedAllowed checks whether a visualisation can be embedded by someone without access to its database.  This
+// is the case for visualisations which have been marked as public, and when a valid embed token is provided
+func visEmbedAllowed(dbOwner, dbName, visName, token string) (bool, error) {
+	public, err := database.VisualisationIsPublic(dbOwner, dbName, visName)
+	if err != nil {
+		return false, err
+	}
+	if public {
+		return true, nil
+	}
+	if token != "" && com.ValidateEmbedToken(token, dbOwner, dbName, visName) == nil {
+		return true, nil
+	}
+	return false, nil
+}
+
+// visEmbedToken generates a signed embed token for a saved visualisation.  The token allows the visualisation to be
+// embedded by people who don't have access to the database, which is useful for private databases
+func visEmbedToken(w http.ResponseWriter, r *http.Request) {
+	// Retrieve user and database
+	dbOwner, dbName, err := com.GetOD(2, r) // 2 = Ignore "/x/visembedtoken/" at the start of the URL
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Required information is missing")
+		return
+	}
+
 	// Retrieve session data (if any)
-	var loggedInUser string
-	var u interface{}
-	if config.Conf.Environment.Environment == "production" {
-		sess, err := store.Get(r, "dbhub-user")
-		if err != nil {
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, "You need to be logged in")
+		return
+	}
+
+	// Make sure the logged in user has the permissions to proceed
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	if allowed == false {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "Database not found")
+		return
+	}
+
+	// Initial sanity check of the visualisation name
+	visName := r.FormValue("visname")
+	err = com.ValidateVisualisationName(visName)
+	if err != nil {
+		log.Printf("Input validation error for visEmbedToken(): %s", err)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error when validating input: %s", err)
+		return
+	}
+
+	// Retrieve the number of days the token should be valid for.  Defaults to 30 days
+	days := 30
+	if d := r.FormValue("days"); d != "" {
+		days, err = strconv.Atoi(d)
+		if err != nil || days < 1 || days > 365 {
 			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "The number of days must be between 1 and 365")
 			return
 		}
-		u = sess.Values["UserName"]
-	} else {
-		u = config.Conf.Environment.UserOverride
 	}
-	if u != nil {
-		loggedInUser = u.(string)
+
+	// Make sure the visualisation exists
+	visualisations, err := database.GetVisualisations(dbOwner, dbName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	if _, ok := visualisations[visName]; !ok {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "Visualisation not found")
+		return
+	}
+
+	// Generate the token and return it
+	expiry := time.Now().AddDate(0, 0, days)
+	token, err := com.EmbedToken(dbOwner, dbName, visName, expiry)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	jsonResponse, err := json.Marshal(struct {
+		Expiry time.Time `json:"expiry"`
+		Token  string    `json:"token"`
+	}{
+		Expiry: expiry,
+		Token:  token,
+	})
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "%s", jsonResponse)
+}
+
+// visExecuteSQL executes a custom SQLite SELECT query.
+func visExecuteSQL(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	loggedInUser, _, err := checkLogin(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
 	// Retrieve user, database, and commit ID
@@ -524,6 +871,17 @@ func visExecuteSQL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Pivot tables are grouped and summarised by SQLite, rather than sending all of the rows to the browser
+	query := decodedStr
+	if reqData.Pivot != nil {
+		query, err = com.PivotQuery(decodedStr, *reqData.Pivot)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, err)
+			return
+		}
+	}
+
 	// Check if the requested database exists
 	exists, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, false)
 	if err != nil {
@@ -546,26 +904,45 @@ func visExecuteSQL(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Run the visualisation query
-	var data com.SQLiteRecordSet
-	if !isLive {
-		data, err = com.SQLiteRunQueryDefensive(w, r, com.QuerySourceVisualisation, dbOwner, dbName, commitID, loggedInUser, decodedStr)
+	run := func(q string) (com.SQLiteRecordSet, error) {
+		if !isLive {
+			return com.SQLiteRunQueryDefensive(w, r, com.QuerySourceVisualisation, dbOwner, dbName, commitID, loggedInUser, q)
+		}
+
+		// Send the query to the appropriate backend live node
+		return com.LiveQuery(liveNode, loggedInUser, dbOwner, dbName, q)
+	}
+	data, err := run(query)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+
+	// The fields of pivot tables are picked from the columns of the query itself, so those are returned as well
+	var resp interface{} = data
+	if reqData.Pivot != nil {
+		var cols com.SQLiteRecordSet
+		cols, err = run(com.PivotColumnsQuery(decodedStr))
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
 			fmt.Fprint(w, err)
 			return
 		}
-	} else {
-		// Send the query to the appropriate backend live node
-		data, err = com.LiveQuery(liveNode, loggedInUser, dbOwner, dbName, decodedStr)
+		data, err = com.PivotResults(*reqData.Pivot, data)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprint(w, err.Error())
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, err)
 			return
 		}
+		resp = struct {
+			com.SQLiteRecordSet
+			SourceColNames []string
+		}{data, cols.ColNames}
 	}
 
 	// Return the results as JSON
-	jsonResponse, err := json.Marshal(data)
+	jsonResponse, err := json.Marshal(resp)
 	if err != nil {
 		log.Println(err)
 		return
@@ -573,32 +950,214 @@ func visExecuteSQL(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "%s", jsonResponse)
 }
 
-// This function handles requests to rename an existing saved visualisation
-func visRename(w http.ResponseWriter, r *http.Request) {
-	// Retrieve user and database
-	dbOwner, dbName, err := com.GetOD(2, r) // 2 = Ignore "/x/visrename/" at the start of the URL
+// visImage renders a saved visualisation on the server side, returning it as an SVG or PNG image
+func visImage(w http.ResponseWriter, r *http.Request) {
+	// Retrieve session data (if any)
+	loggedInUser, _, err := checkLogin(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Retrieve user, database, and commit ID
+	dbOwner, dbName, commitID, err := com.GetODC(2, r) // 2 = Ignore "/x/visimage/" at the start of the URL
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
-	// Retrieve session data (if any)
-	var loggedInUser string
-	var u interface{}
-	validSession := false
-	if config.Conf.Environment.Environment == "production" {
-		sess, err := store.Get(r, "dbhub-user")
+	// Initial sanity check of the visualisation name
+	visName := r.FormValue("visname")
+	err = com.ValidateVisualisationName(visName)
+	if err != nil {
+		log.Printf("Input validation error for visImage(): %s", err)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error when validating input: %s", err)
+		return
+	}
+
+	// Determine the requested image format.  Defaults to SVG
+	format := r.FormValue("format")
+	if format == "" {
+		format = "svg"
+	}
+	if format != "svg" && format != "png" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Unknown image format")
+		return
+	}
+
+	// Check if the user has access to the database.  If they don't, the visualisation can still be rendered when
+	// it's public or a valid embed token was given.  In that case the query is run on behalf of the database owner
+	queryUser := loggedInUser
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, false)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	if !allowed {
+		allowed, err = visEmbedAllowed(dbOwner, dbName, visName, r.FormValue("token"))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, err)
+			return
+		}
+		if !allowed {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "Database '%s/%s' doesn't exist", dbOwner, dbName)
+			return
+		}
+		queryUser = dbOwner
+
+		// Embed tokens aren't tied to a commit, so the default one is always used for them
+		commitID = ""
+	}
+
+	// Retrieve the visualisation parameters
+	visualisations, err := database.GetVisualisations(dbOwner, dbName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	params, ok := visualisations[visName]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "Visualisation not found")
+		return
+	}
+
+	// Check if this is a live database
+	isLive, liveNode, err := database.CheckDBLive(dbOwner, dbName)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+
+	// Render the image
+	img, contentType, err := visRenderSaved(w, r, isLive, liveNode, queryUser, dbOwner, dbName, commitID, params, format)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(img)
+}
+
+// visRenderSaved runs the query of a saved visualisation, then renders its results as an SVG or PNG image
+func visRenderSaved(w http.ResponseWriter, r *http.Request, isLive bool, liveNode, queryUser, dbOwner, dbName, commitID string, params database.VisParamsV2, format string) (img []byte, contentType string, err error) {
+	// Pivot tables have their query wrapped with the SQL summarising it
+	query := params.SQL
+	if params.ChartType == "pivot" && params.Pivot != nil {
+		query, err = com.PivotQuery(query, *params.Pivot)
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		u = sess.Values["UserName"]
+	}
+
+	// Run the visualisation query
+	var data com.SQLiteRecordSet
+	if !isLive {
+		data, err = com.SQLiteRunQueryDefensive(w, r, com.QuerySourceVisualisation, dbOwner, dbName, commitID, queryUser, query)
 	} else {
-		u = config.Conf.Environment.UserOverride
+		// Send the query to the appropriate backend live node
+		data, err = com.LiveQuery(liveNode, queryUser, dbOwner, dbName, query)
 	}
-	if u != nil {
-		loggedInUser = u.(string)
-		validSession = true
+	if err != nil {
+		return
+	}
+	if params.ChartType == "pivot" && params.Pivot != nil {
+		data, err = com.PivotResults(*params.Pivot, data)
+		if err != nil {
+			return
+		}
+	}
+	return com.RenderVisualisation(params, data, format)
+}
+
+// visPublic changes whether a saved visualisation is public.  Public visualisations can be embedded by anyone, even
+// when the database is private
+func visPublic(w http.ResponseWriter, r *http.Request) {
+	// Retrieve user and database
+	dbOwner, dbName, err := com.GetOD(2, r) // 2 = Ignore "/x/vispublic/" at the start of the URL
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Required information is missing")
+		return
+	}
+
+	// Retrieve session data (if any)
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we have a valid logged in user
+	if validSession != true {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, "You need to be logged in")
+		return
+	}
+
+	// Make sure the logged in user has the permissions to proceed
+	allowed, err := database.CheckDBPermissions(loggedInUser, dbOwner, dbName, true)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	if allowed == false {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "Database not found")
+		return
+	}
+
+	// Initial sanity check of the visualisation name
+	visName := r.FormValue("visname")
+	err = com.ValidateVisualisationName(visName)
+	if err != nil {
+		log.Printf("Input validation error for visPublic(): %s", err)
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "Error when validating input: %s", err)
+		return
+	}
+
+	// Retrieve the new public status
+	public, err := strconv.ParseBool(r.FormValue("public"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, "Invalid public status")
+		return
+	}
+
+	// Save the new public status
+	err = database.VisualisationSetPublic(dbOwner, dbName, visName, public)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// This function handles requests to rename an existing saved visualisation
+func visRename(w http.ResponseWriter, r *http.Request) {
+	// Retrieve user and database
+	dbOwner, dbName, err := com.GetOD(2, r) // 2 = Ignore "/x/visrename/" at the start of the URL
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Retrieve session data (if any)
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
 	// Ensure we have a valid logged in user
@@ -659,22 +1218,10 @@ func visSave(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Retrieve session data (if any)
-	var loggedInUser string
-	var u interface{}
-	validSession := false
-	if config.Conf.Environment.Environment == "production" {
-		sess, err := store.Get(r, "dbhub-user")
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		u = sess.Values["UserName"]
-	} else {
-		u = config.Conf.Environment.UserOverride
-	}
-	if u != nil {
-		loggedInUser = u.(string)
-		validSession = true
+	loggedInUser, validSession, err := checkLogin(w, r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
 
 	// Ensure we have a valid logged in user
@@ -723,32 +1270,75 @@ func visSave(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Ensure minimum viable parameters are present
-	if data.ChartType == "" || data.XAXisColumn == "" || data.YAXisColumn == "" || visName == "" || data.SQL == "" {
+	if data.ChartType == "" || visName == "" || data.SQL == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
 	// Ensure only valid chart types are accepted
-	if data.ChartType != "hbc" && data.ChartType != "vbc" && data.ChartType != "lc" && data.ChartType != "pie" {
+	if data.ChartType != "hbc" && data.ChartType != "vbc" && data.ChartType != "lc" && data.ChartType != "pie" &&
+		data.ChartType != "map" && data.ChartType != "pivot" {
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprint(w, "Unknown chart type")
 		return
 	}
 
-	// Validate the X axis field name
-	err = com.ValidateFieldName(data.XAXisColumn)
-	if err != nil {
-		log.Printf("Validation failed on requested X axis field name '%v': %v", com.SanitiseLogString(data.XAXisColumn), err.Error())
-		w.WriteHeader(http.StatusBadRequest)
-		return
+	// Maps need either latitude and longitude columns or a GeoJSON column, pivot tables need their fields, and the
+	// other chart types need their axes
+	var fields []string
+	if data.ChartType == "pivot" {
+		if data.Pivot == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "Pivot tables need their settings")
+			return
+		}
+		err = com.ValidatePivot(*data.Pivot)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, err)
+			return
+		}
+		fields = []string{data.XAXisColumn, data.YAXisColumn}
+	} else if data.ChartType == "map" {
+		if data.GeoJSONColumn == "" && (data.LatColumn == "" || data.LonColumn == "") {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, "Maps need either latitude and longitude columns, or a GeoJSON column")
+			return
+		}
+		if data.MapTiles != "" {
+			found := false
+			for _, p := range config.Conf.Map.TileProviders {
+				if p.Name == data.MapTiles {
+					found = true
+				}
+			}
+			if !found {
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, "Unknown map tile provider")
+				return
+			}
+		}
+		fields = []string{data.GeoJSONColumn, data.LabelColumn, data.LatColumn, data.LonColumn, data.XAXisColumn,
+			data.YAXisColumn}
+	} else {
+		if data.XAXisColumn == "" || data.YAXisColumn == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fields = []string{data.XAXisColumn, data.YAXisColumn}
 	}
 
-	// Validate the Y axis field name
-	err = com.ValidateFieldName(data.YAXisColumn)
-	if err != nil {
-		log.Printf("Validation failed on requested Y axis field name '%v': %v", com.SanitiseLogString(data.YAXisColumn), err.Error())
-		w.WriteHeader(http.StatusBadRequest)
-		return
+	// Validate the field names
+	for _, f := range fields {
+		if f == "" {
+			continue
+		}
+		err = com.ValidateFieldName(f)
+		if err != nil {
+			log.Printf("Validation failed on requested field name '%v': %v", com.SanitiseLogString(f), err.Error())
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
 	}
 
 	// Validate SQL string